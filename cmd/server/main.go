@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,7 +15,7 @@ import (
 	"github.com/nishad/srake/internal/api"
 	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
-	"github.com/nishad/srake/internal/paths"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -25,10 +26,11 @@ var (
 
 func main() {
 	var (
-		port        = flag.Int("port", 8080, "Server port")
-		host        = flag.String("host", "0.0.0.0", "Server host")
-		dbPath      = flag.String("db", "", "Database path")
-		configPath  = flag.String("config", "", "Configuration file path")
+		port        = flag.Int("port", 0, "Server port (overrides server.port)")
+		grpcPort    = flag.Int("grpc-port", 0, "gRPC API port (overrides server.grpc_port)")
+		host        = flag.String("host", "", "Server host (overrides server.host)")
+		dbPath      = flag.String("db", "", "Database path (overrides database.path)")
+		configPath  = flag.String("config", "", "Configuration file (YAML or TOML)")
 		showVersion = flag.Bool("version", false, "Show version information")
 	)
 	flag.Parse()
@@ -38,34 +40,69 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Load configuration
-	cfg := config.DefaultConfig()
-	if *configPath != "" {
-		// TODO: Add config file loading if needed
-		log.Printf("Config file loading not yet implemented")
+	// Load configuration: config files, then environment variables, then flags
+	cfg, report, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
-
-	// Set database path
-	if *dbPath == "" {
-		*dbPath = paths.GetDatabasePath()
+	for _, w := range report.Warnings {
+		log.Printf("Config warning: %s", w)
+	}
+	if *dbPath != "" {
+		cfg.Database.Path = *dbPath
+	}
+	if *port != 0 {
+		cfg.Server.Port = *port
+	}
+	if *host != "" {
+		cfg.Server.Host = *host
+	}
+	if *grpcPort != 0 {
+		cfg.Server.GRPCPort = *grpcPort
 	}
 
 	// Initialize database
-	log.Printf("Initializing database at %s...", *dbPath)
-	db, err := database.Initialize(*dbPath)
+	log.Printf("Initializing database at %s...", cfg.Database.Path)
+	db, err := database.Open(cfg.Database.Path, database.OpenOptions{Mode: cfg.Database.Mode, Replication: cfg.Database.Replication})
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
-	// Create API handler
-	handler, err := api.NewHandler(db, cfg)
+	// Create API handler, reading the config again on SIGHUP; settings
+	// given as flags are not read from it, and those this server does not
+	// use are not reported
+	flags := map[string]bool{
+		"database.path":    *dbPath != "",
+		"server.host":      *host != "",
+		"server.port":      *port != 0,
+		"server.grpc_port": *grpcPort != 0,
+	}
+	unused := map[string]bool{
+		"server.read_only":  true,
+		"server.ingest_dir": true,
+		"database.max_lag":  true,
+		"server.ui":         true,
+	}
+	loadSettings := func() (*api.Settings, error) {
+		reloaded, report, err := loadConfig(*configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		for _, w := range report.Warnings {
+			log.Printf("Config warning: %s", w)
+		}
+		return api.NewSettings(reloaded, cfg, func(name string) bool {
+			return flags[name] || unused[name]
+		}), nil
+	}
+	handler, err := api.NewHandler(db, cfg, loadSettings)
 	if err != nil {
 		log.Fatalf("Failed to create API handler: %v", err)
 	}
 
 	// Create HTTP server
-	addr := fmt.Sprintf("%s:%d", *host, *port)
+	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	srv := &http.Server{
 		Addr:         addr,
 		Handler:      handler,
@@ -77,12 +114,31 @@ func main() {
 	// Start server
 	go func() {
 		log.Printf("Starting server on %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := api.ListenAndServe(srv, cfg.Server.TLS); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
 
-	// Wait for interrupt signal
+	// Serve the gRPC API on its own port; its streams have no write
+	// timeout, so that long exports are not cut off
+	var grpcSrv *grpc.Server
+	if cfg.Server.GRPCPort != 0 {
+		grpcAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.GRPCPort)
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			log.Fatalf("Failed to start gRPC server: %v", err)
+		}
+		grpcSrv = handler.GRPC()
+		go func() {
+			log.Printf("Starting gRPC server on %s", grpcAddr)
+			if err := grpcSrv.Serve(lis); err != nil {
+				log.Fatalf("Failed to start gRPC server: %v", err)
+			}
+		}()
+	}
+
+	// Wait for interrupt signal, reloading the config on SIGHUP
+	defer api.ReloadOnHangup(handler)()
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
@@ -94,6 +150,29 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
+	if grpcSrv != nil {
+		// Streams still running when the timeout is up are cut off
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			log.Printf("gRPC server forced to shutdown: %v", ctx.Err())
+			grpcSrv.Stop()
+		}
+	}
 
 	log.Println("Server stopped")
 }
+
+// loadConfig reads the config files, then environment variables; path,
+// when set, names the config file to read
+func loadConfig(path string) (*config.Config, *config.Report, error) {
+	if path != "" {
+		return config.LoadLayeredFile(path)
+	}
+	return config.LoadLayered()
+}
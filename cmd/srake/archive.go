@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/export"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/spf13/cobra"
+)
+
+// Database archive subcommand
+var dbArchiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Move old runs to cold storage",
+	Long: `Move runs published more than a number of years ago out of the database,
+keeping it within the disk budget of fast storage. Studies, experiments and
+samples stay in the database; only runs, the bulk of it, are moved.
+
+Runs go to one of two kinds of archive:
+
+  sqlite   A database file read back by commands given --include-archived,
+           such as 'srake runs', 'srake metadata' and 'srake export'
+  parquet  A Parquet file for other tools, which srake does not read back
+
+The age, format and directory of archives default to the database.archive
+settings of the configuration file. Archiving again into the same SQLite
+archive adds to it. Runs without a publication date are never archived.
+
+Archived runs are logged as deleted in the change log, so a search index
+kept in step drops them. Run 'srake db vacuum' afterwards to return the
+space they took to the file system.`,
+	Example: `  srake db archive --dry-run
+  srake db archive --older-than 8
+  srake db archive --archive-format parquet -o /cold/runs-2016.parquet
+  srake db archive --list
+  srake runs SRP000001 --include-archived`,
+	Args: cobra.NoArgs,
+	RunE: runDBArchive,
+}
+
+var (
+	archiveYears      int
+	archiveFormat     string
+	archiveOutput     string
+	archiveDryRun     bool
+	archiveList       bool
+	archiveListFormat string
+	includeArchived   bool
+)
+
+func init() {
+	dbCmd.AddCommand(dbArchiveCmd)
+
+	dbArchiveCmd.Flags().IntVar(&archiveYears, "older-than", 0, "Archive runs published more than this many years ago (default: database.archive.run_years)")
+	dbArchiveCmd.Flags().StringVar(&archiveFormat, "archive-format", "", "Archive format (sqlite|parquet, default: database.archive.format)")
+	dbArchiveCmd.Flags().StringVarP(&archiveOutput, "output", "o", "", "Archive file (default: runs-before-<date> in database.archive.directory)")
+	dbArchiveCmd.Flags().BoolVar(&archiveDryRun, "dry-run", false, "Count the runs that would be archived without moving them")
+	dbArchiveCmd.Flags().BoolVar(&archiveList, "list", false, "List the archives runs have been moved to")
+	dbArchiveCmd.Flags().StringVarP(&archiveListFormat, "format", "f", "table", "Output format of --list (table|json)")
+
+	for _, cmd := range []*cobra.Command{metadataCmd, runsCmd, samplesCmd, experimentsCmd, studiesCmd, dumpCmd} {
+		cmd.Flags().BoolVar(&includeArchived, "include-archived", false, "Also read runs moved to SQLite archives by 'srake db archive'")
+	}
+}
+
+func runDBArchive(cmd *cobra.Command, args []string) error {
+	if archiveListFormat != "table" && archiveListFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", archiveListFormat)
+	}
+
+	dbPath := serverDBPath
+	if dbPath == "" {
+		dbPath = paths.GetDatabasePath()
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		printError("Database not found at %s", dbPath)
+		return fmt.Errorf("database not found")
+	}
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if archiveList {
+		return listRunArchives(db)
+	}
+
+	cfg, _, err := config.LoadLayered()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	years, format := cfg.Database.Archive.RunYears, cfg.Database.Archive.Format
+	if archiveYears != 0 {
+		years = archiveYears
+	}
+	if archiveFormat != "" {
+		format = archiveFormat
+	}
+	if years <= 0 {
+		return fmt.Errorf("invalid age: %d years (must be at least 1)", years)
+	}
+	if format != database.ArchiveSQLite && format != database.ArchiveParquet {
+		return fmt.Errorf("invalid archive format: %s (must be %s or %s)", format, database.ArchiveSQLite, database.ArchiveParquet)
+	}
+
+	before := time.Now().AddDate(-years, 0, 0)
+	path := archiveOutput
+	if path == "" {
+		ext := ".db"
+		if format == database.ArchiveParquet {
+			ext = ".parquet"
+		}
+		path = filepath.Join(cfg.Database.Archive.Directory, "runs-before-"+before.Format("2006-01-02")+ext)
+	}
+
+	ctx := cmd.Context()
+	due, err := db.CountArchivableRuns(ctx, before)
+	if err != nil {
+		return fmt.Errorf("failed to count runs: %v", err)
+	}
+	if archiveDryRun || due == 0 {
+		printInfo("%d runs were published before %s", due, before.Format("2006-01-02"))
+		if due > 0 {
+			printInfo("They would be moved to %s", path)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	var archive *database.RunArchive
+	message := fmt.Sprintf("Archiving %d runs published before %s", due, before.Format("2006-01-02"))
+	if format == database.ArchiveSQLite {
+		err = withProgress(true, message, func() error {
+			archive, err = db.ArchiveRuns(ctx, before, path)
+			return err
+		})
+	} else {
+		err = withProgress(true, message, func() error {
+			archive, err = archiveRunsToParquet(ctx, db, before, path)
+			return err
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("archive failed: %v", err)
+	}
+	if err := db.UpdateStatistics(); err != nil {
+		printWarning("Failed to update statistics: %v", err)
+	}
+
+	var size int64
+	if info, err := os.Stat(archive.Path); err == nil {
+		size = info.Size()
+	}
+	printSuccess("Archived %d runs to %s (%s)", archive.Runs, archive.Path, downloader.FormatSize(size))
+	printInfo("Run 'srake db vacuum' to reclaim their space")
+	return nil
+}
+
+// archiveRunsToParquet moves the runs published before a date into a new
+// Parquet file, which is removed again if the move fails
+func archiveRunsToParquet(ctx context.Context, db *database.DB, before time.Time, path string) (*database.RunArchive, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists; Parquet archives cannot be added to", path)
+	}
+	columns, err := export.TableColumns(db.DB, "runs")
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %v", err)
+	}
+	defer file.Close()
+
+	archive, err := db.ArchiveRunsTo(ctx, before, path, database.ArchiveParquet, func(rows *sql.Rows) (int64, error) {
+		w, err := export.NewRowWriter(file, export.FormatParquet, export.CompressGzip, columns)
+		if err != nil {
+			return 0, err
+		}
+		n, err := export.CopyRows(rows, w)
+		if err != nil {
+			w.Close()
+			return n, err
+		}
+		if err := w.Close(); err != nil {
+			return n, err
+		}
+		return n, file.Sync()
+	})
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return archive, nil
+}
+
+// listRunArchives prints the archives runs have been moved to
+func listRunArchives(db *database.DB) error {
+	archives, err := db.ListRunArchives()
+	if err != nil {
+		return fmt.Errorf("failed to list archives: %v", err)
+	}
+	if archiveListFormat == "json" {
+		if archives == nil {
+			archives = []database.RunArchive{}
+		}
+		return printJSON(archives)
+	}
+	if len(archives) == 0 {
+		printInfo("No runs have been archived")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tFORMAT\tRUNS\tPUBLISHED BEFORE\tARCHIVED")
+	for _, a := range archives {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", a.Path, a.Format, a.Runs, a.PublishedBefore, a.ArchivedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// includeArchivedRuns reads the runs of the database's SQLite archives
+// along with its own when --include-archived is given
+func includeArchivedRuns(cmd *cobra.Command, db *database.DB) error {
+	if !includeArchived {
+		return nil
+	}
+	n, err := db.IncludeArchived(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to include archived runs: %v", err)
+	}
+	if n == 0 {
+		printWarning("No SQLite archives to include; runs are archived with 'srake db archive'")
+	}
+	return nil
+}
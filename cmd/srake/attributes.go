@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var attributesCmd = &cobra.Command{
+	Use:   "attributes",
+	Short: "Query samples by their attributes",
+	Long: `Query samples by the tag/value attributes submitters attach to them, such as
+tissue, age or disease.
+
+Attributes are kept one row per tag at ingest. Tags are matched without
+regard to case, spaces or underscores, so "Cell Type" and cell_type are the
+same tag.`,
+	Example: `  srake attributes query "tissue=liver" "age>40"
+  srake attributes tags --prefix cell
+  srake attributes rebuild`,
+}
+
+var attributesQueryCmd = &cobra.Command{
+	Use:   "query <condition> [<condition> ...]",
+	Short: "Find samples whose attributes satisfy every condition",
+	Long: `Find samples whose attributes satisfy every condition.
+
+Conditions:
+  tag           the sample has the attribute
+  tag=value     the value equals value, ignoring case
+  tag!=value    the sample has the attribute with another value
+  tag~text      the value contains text, ignoring case
+  tag>n, tag>=n, tag<n, tag<=n
+                the number the value starts with compares with n,
+                so age>40 matches "52 years"
+
+Quote conditions so the shell does not read > and < as redirection.`,
+	Example: `  srake attributes query "tissue=liver" "age>40"
+  srake attributes query "disease~carcinoma" "sex=female" --format accession
+  srake attributes query cell_line --limit 0 --format json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runAttributesQuery,
+}
+
+var attributesTagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "List attribute tags by the number of samples that have them",
+	Args:  cobra.NoArgs,
+	RunE:  runAttributesTags,
+}
+
+var attributesRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Fill the attribute table from sample metadata",
+	Long: `Fill the attribute table from the attribute lists kept in sample metadata.
+Databases ingested before attributes were kept one row per tag need this
+once; re-ingesting has the same effect.`,
+	Args: cobra.NoArgs,
+	RunE: runAttributesRebuild,
+}
+
+var (
+	attributesLimit    int
+	attributesOffset   int
+	attributesFormat   string
+	attributesPrefix   string
+	attributesTagLimit int
+)
+
+func init() {
+	attributesCmd.AddCommand(attributesQueryCmd)
+	attributesCmd.AddCommand(attributesTagsCmd)
+	attributesCmd.AddCommand(attributesRebuildCmd)
+
+	attributesQueryCmd.Flags().IntVarP(&attributesLimit, "limit", "l", 100, "Maximum samples to return (0 for all)")
+	attributesQueryCmd.Flags().IntVar(&attributesOffset, "offset", 0, "Number of samples to skip")
+	attributesQueryCmd.Flags().StringVarP(&attributesFormat, "format", "f", "table", "Output format (table|json|accession)")
+
+	attributesTagsCmd.Flags().StringVar(&attributesPrefix, "prefix", "", "Only tags starting with this prefix")
+	attributesTagsCmd.Flags().IntVarP(&attributesTagLimit, "limit", "l", 50, "Maximum tags to list")
+	attributesTagsCmd.Flags().StringVarP(&attributesFormat, "format", "f", "table", "Output format (table|json)")
+}
+
+func runAttributesQuery(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	limit := attributesLimit
+	if limit == 0 {
+		limit = -1 // all matches; a zero limit asks for the default
+	}
+	response, err := service.NewMetadataService(db).QueryAttributes(context.Background(), &service.AttributeQueryRequest{
+		Conditions: args,
+		Limit:      limit,
+		Offset:     attributesOffset,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch attributesFormat {
+	case "json":
+		return printJSON(response)
+	case "accession":
+		for _, s := range response.Samples {
+			fmt.Println(s.SampleAccession)
+		}
+		return nil
+	}
+
+	if response.Total == 0 {
+		printInfo("No samples match %s", strings.Join(args, " AND "))
+		return nil
+	}
+
+	var tags []string
+	for _, c := range response.Conditions {
+		if !slices.Contains(tags, c.Tag) {
+			tags = append(tags, c.Tag)
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{colorize(colorBold, "SAMPLE"), colorize(colorBold, "ORGANISM")}
+	for _, tag := range tags {
+		header = append(header, colorize(colorBold, strings.ToUpper(tag)))
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, s := range response.Samples {
+		row := []string{colorize(colorCyan, s.SampleAccession), truncateStr(s.Organism, 30)}
+		for _, tag := range tags {
+			var values []string
+			for _, a := range s.Attributes {
+				if a.Tag == tag {
+					v := a.Value
+					if a.Units != "" {
+						v += " " + a.Units
+					}
+					values = append(values, v)
+				}
+			}
+			row = append(row, truncateStr(strings.Join(values, "; "), 40))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if shown := response.Offset + len(response.Samples); shown < response.Total && !quiet {
+		printInfo("Showing %d-%d of %d samples (use --limit and --offset for more)", response.Offset+1, shown, response.Total)
+	}
+	return nil
+}
+
+func runAttributesTags(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	tags, err := service.NewMetadataService(db).ListAttributeTags(context.Background(), attributesPrefix, attributesTagLimit)
+	if err != nil {
+		return err
+	}
+	if attributesFormat == "json" {
+		return printJSON(tags)
+	}
+	if len(tags) == 0 {
+		printInfo("No attribute tags found (run 'srake attributes rebuild' for databases ingested before attributes were kept)")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\n", colorize(colorBold, "TAG"), colorize(colorBold, "SAMPLES"))
+	for _, t := range tags {
+		fmt.Fprintf(w, "%s\t%d\n", t.Tag, t.Samples)
+	}
+	return w.Flush()
+}
+
+func runAttributesRebuild(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	n, err := db.RebuildSampleAttributes()
+	if err != nil {
+		return fmt.Errorf("failed to rebuild sample attributes: %w", err)
+	}
+	printSuccess("Sample attribute table holds %d attributes", n)
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/packaging"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var citeCmd = &cobra.Command{
+	Use:   "cite <accession>",
+	Short: "Print a citation and data availability statement for a record",
+	Long: `Print a citation of a study, experiment, sample, or run for a manuscript,
+with the title, submitting center, release date, BioProject, and runs of
+its study, and its canonical URLs at NCBI, ENA, and DDBJ.
+
+Styles:
+  • text:   a reference and a data availability statement
+  • bibtex: a BibTeX @misc entry keyed by the accession
+
+The record is cited at the archive it was submitted to (SRA for SRP/SRR,
+ENA for ERP/ERR, DDBJ for DRP/DRR), with the other archives as mirrors.`,
+	Example: `  srake cite SRP123456
+  srake cite SRP123456 --style bibtex >> references.bib
+  srake cite SRR1234567 --format json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCite,
+}
+
+var (
+	citeStyle  string
+	citeFormat string
+)
+
+func init() {
+	citeCmd.Flags().StringVarP(&citeStyle, "style", "s", packaging.StyleText,
+		fmt.Sprintf("Citation style (%s)", strings.Join(packaging.CitationStyles(), "|")))
+	citeCmd.Flags().StringVarP(&citeFormat, "format", "f", "", "Output format: json prints the citation fields instead of a styled citation")
+}
+
+func runCite(cmd *cobra.Command, args []string) error {
+	accession := strings.ToUpper(args[0])
+	if detectAccessionType(accession) == "unknown" {
+		return fmt.Errorf("%s is not an SRA study, experiment, sample, or run accession", accession)
+	}
+	if !packaging.ValidCitationStyle(citeStyle) {
+		return fmt.Errorf("unsupported citation style: %s (supported: %s)",
+			citeStyle, strings.Join(packaging.CitationStyles(), ", "))
+	}
+	if citeFormat != "" && citeFormat != "json" {
+		return fmt.Errorf("unsupported format: %s (supported: json)", citeFormat)
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	citation, err := service.NewMetadataService(db).GetCitation(context.Background(), accession)
+	if err != nil {
+		return err
+	}
+	if citeFormat == "json" {
+		return printJSON(citation)
+	}
+	return packaging.WriteCitation(os.Stdout, citeStyle, citation)
+}
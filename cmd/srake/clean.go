@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/retention"
+	"github.com/spf13/cobra"
+)
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Apply data retention limits",
+	Long: `Remove ingest bookkeeping, caches, and generated files that exceed the
+retention limits in the 'retention' section of the configuration file.
+
+Targets:
+  progress      Finished ingest progress, processed files, and checkpoints;
+                unfinished ingests keep only their newest checkpoints
+  downloads     Downloaded archives, by age and total size
+  search-cache  Cached query results
+  snapshots     Index build snapshots, by age and total size
+  jobs          Finished background jobs and their result files
+
+The server applies the same limits periodically when retention.auto_cleanup
+is enabled.`,
+	Example: `  # Show what would be removed
+  srake clean --dry-run
+
+  # Clean only downloads and snapshots
+  srake clean --only downloads,snapshots
+
+  # Remove everything older than a week, regardless of configured ages
+  srake clean --older 7d`,
+	Args: cobra.NoArgs,
+	RunE: runClean,
+}
+
+var (
+	cleanDryRun bool
+	cleanOnly   []string
+	cleanAge    string
+	cleanFormat string
+)
+
+func init() {
+	cleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "Report what would be removed without removing it")
+	cleanCmd.Flags().StringSliceVar(&cleanOnly, "only", nil, "Only clean these targets ("+strings.Join(retention.Targets, ", ")+")")
+	cleanCmd.Flags().StringVar(&cleanAge, "older", "", "Override all age limits (e.g. 7d, 12h)")
+	cleanCmd.Flags().StringVarP(&cleanFormat, "format", "f", "table", "Output format (table|json)")
+}
+
+func runClean(cmd *cobra.Command, args []string) error {
+	if cleanFormat != "table" && cleanFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", cleanFormat)
+	}
+
+	cfg, _, err := config.LoadLayered()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	policy := retention.FromConfig(cfg.Retention)
+
+	if cleanAge != "" {
+		age, err := parseDuration(cleanAge)
+		if err != nil || age <= 0 {
+			return fmt.Errorf("invalid duration: %s", cleanAge)
+		}
+		policy.ProgressAge = age
+		policy.DownloadAge = age
+		policy.SearchCacheAge = age
+		policy.SnapshotAge = age
+		policy.JobAge = age
+	}
+
+	// Database targets are skipped when there is no database yet
+	var db *database.DB
+	if _, err := os.Stat(paths.GetDatabasePath()); err == nil {
+		db, err = database.Initialize(paths.GetDatabasePath())
+		if err != nil {
+			return fmt.Errorf("failed to open database: %v", err)
+		}
+		defer db.Close()
+	}
+
+	report, err := retention.Run(db, policy, cleanOnly, cleanDryRun)
+	if err != nil {
+		return err
+	}
+
+	if cleanFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	if quiet {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tROWS\tFILES\tSIZE")
+	for _, r := range report.Results {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", r.Target, r.Rows, r.Files, downloader.FormatSize(r.Bytes))
+	}
+	w.Flush()
+
+	rows, files, size := report.Totals()
+	if cleanDryRun {
+		printInfo("Dry run: %d rows and %d files (%s) would be removed", rows, files, downloader.FormatSize(size))
+	} else {
+		printSuccess("Removed %d rows and %d files (%s)", rows, files, downloader.FormatSize(size))
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/plan"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var cohortCmd = &cobra.Command{
+	Use:   "cohort",
+	Short: "Freeze search results and track how they change",
+	Long: `Freeze the records matched by a search as a named cohort, and later report
+which records were added, removed, or changed as the database is updated.
+
+A cohort stores its query and filters, the database generation it was frozen
+against (record count and last update), and a fingerprint of each matched
+record's fields, so longitudinal analyses can state exactly which data they
+used and what has changed since.`,
+	Example: `  # Freeze today's liver cohort
+  srake cohort freeze --query "liver AND organism:human" --name liver-2024
+
+  # After ingesting new data, see what changed
+  srake cohort diff liver-2024
+
+  # Re-freeze the cohort with the current results
+  srake cohort freeze --query "liver AND organism:human" --name liver-2024 --replace`,
+}
+
+var cohortFreezeCmd = &cobra.Command{
+	Use:   "freeze",
+	Short: "Store the current results of a search as a cohort",
+	Args:  cobra.NoArgs,
+	RunE:  runCohortFreeze,
+}
+
+var cohortDiffCmd = &cobra.Command{
+	Use:   "diff <name>",
+	Short: "Compare a cohort with the current results of its query",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCohortDiff,
+}
+
+var cohortListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cohorts",
+	Args:  cobra.NoArgs,
+	RunE:  runCohortList,
+}
+
+var cohortShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show a cohort and its members",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCohortShow,
+}
+
+var cohortDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a cohort",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCohortDelete,
+}
+
+var (
+	cohortName    string
+	cohortQuery   string
+	cohortFilters []string
+	cohortLimit   int
+	cohortReplace bool
+	cohortJSON    bool
+)
+
+func init() {
+	cohortFreezeCmd.Flags().StringVar(&cohortName, "name", "", "Cohort name")
+	cohortFreezeCmd.Flags().StringVar(&cohortQuery, "query", "", "Search query")
+	cohortFreezeCmd.Flags().StringSliceVar(&cohortFilters, "filter", nil, "Filters as field=value (repeatable)")
+	cohortFreezeCmd.Flags().IntVarP(&cohortLimit, "limit", "l", 0, "Maximum records to freeze (0 for all matches)")
+	cohortFreezeCmd.Flags().BoolVar(&cohortReplace, "replace", false, "Replace an existing cohort of the same name")
+	cohortFreezeCmd.MarkFlagRequired("name")
+	cohortFreezeCmd.MarkFlagRequired("query")
+
+	for _, cmd := range []*cobra.Command{cohortFreezeCmd, cohortDiffCmd, cohortListCmd, cohortShowCmd} {
+		cmd.Flags().BoolVar(&cohortJSON, "json", false, "Output as JSON")
+	}
+
+	cohortCmd.AddCommand(cohortFreezeCmd, cohortDiffCmd, cohortListCmd, cohortShowCmd, cohortDeleteCmd)
+}
+
+// openCohortService opens the local database and, for commands that run
+// the cohort query, the search index. The returned function closes both.
+func openCohortService(withSearch bool) (*service.CohortService, func(), error) {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	if !withSearch {
+		return service.NewCohortService(db, nil), func() { db.Close() }, nil
+	}
+
+	indexPath := paths.GetIndexPath()
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		db.Close()
+		return nil, nil, fmt.Errorf("search index not found at %s (build it with 'srake index --build')", indexPath)
+	}
+	searchService, err := service.NewSearchService(db, indexPath)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to initialize search service: %v", err)
+	}
+	return service.NewCohortService(db, searchService), func() {
+		searchService.Close()
+		db.Close()
+	}, nil
+}
+
+func runCohortFreeze(cmd *cobra.Command, args []string) error {
+	filters, err := parseFilterFlags(cohortFilters)
+	if err != nil {
+		return err
+	}
+
+	cohorts, closeFn, err := openCohortService(true)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	cohort, err := cohorts.Freeze(context.Background(), &service.CohortRequest{
+		Name:    cohortName,
+		Query:   cohortQuery,
+		Filters: filters,
+		Limit:   cohortLimit,
+		Replace: cohortReplace,
+	})
+	if err != nil {
+		return err
+	}
+
+	if cohortJSON {
+		return printJSON(cohort)
+	}
+	if !quiet {
+		printSuccess("Froze %d records as cohort %s", cohort.MemberCount, cohort.Name)
+		printInfo("Database generation: %s", cohort.Generation)
+	}
+	return nil
+}
+
+func runCohortDiff(cmd *cobra.Command, args []string) error {
+	cohorts, closeFn, err := openCohortService(true)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	diff, err := cohorts.Diff(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if cohortJSON {
+		return printJSON(diff)
+	}
+
+	fmt.Printf("%s %s\n", colorize(colorBold, "Cohort:"), diff.Cohort.Name)
+	fmt.Printf("%s %s\n", colorize(colorBold, "Query:"), formatCohortQuery(diff.Cohort))
+	fmt.Printf("%s %s (%d records)\n", colorize(colorBold, "Frozen:"),
+		diff.Cohort.CreatedAt.Local().Format("2006-01-02 15:04"), diff.Cohort.MemberCount)
+	fmt.Printf("%s %s\n", colorize(colorBold, "Then:"), diff.Cohort.Generation)
+	fmt.Printf("%s %s\n", colorize(colorBold, "Now:"), diff.Generation)
+	fmt.Println()
+
+	printCohortChanges("+", colorGreen, "Added", diff.Added)
+	printCohortChanges("-", colorRed, "Removed", diff.Removed)
+	printCohortChanges("~", colorYellow, "Changed", diff.Changed)
+
+	fmt.Printf("%d added, %d removed, %d changed, %d unchanged (%d matched now)\n",
+		len(diff.Added), len(diff.Removed), len(diff.Changed), diff.Unchanged, diff.Matched)
+	return nil
+}
+
+func printCohortChanges(marker, color, label string, members []database.CohortMember) {
+	if len(members) == 0 {
+		return
+	}
+	fmt.Printf("%s\n", colorize(colorBold, fmt.Sprintf("%s (%d):", label, len(members))))
+	for _, m := range members {
+		fmt.Printf("  %s %s %s\n", colorize(color, marker), m.Accession, colorize(colorGray, m.RecordType))
+	}
+	fmt.Println()
+}
+
+func runCohortList(cmd *cobra.Command, args []string) error {
+	cohorts, closeFn, err := openCohortService(false)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	list, err := cohorts.List(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if cohortJSON {
+		return printJSON(list)
+	}
+	if len(list) == 0 {
+		printInfo("No cohorts")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tRECORDS\tFROZEN\tQUERY")
+	for _, c := range list {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", c.Name, c.MemberCount,
+			c.CreatedAt.Local().Format("2006-01-02 15:04"), truncateStr(formatCohortQuery(&c), 60))
+	}
+	return w.Flush()
+}
+
+func runCohortShow(cmd *cobra.Command, args []string) error {
+	cohorts, closeFn, err := openCohortService(false)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	cohort, members, err := cohorts.Get(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if cohortJSON {
+		return printJSON(struct {
+			*database.Cohort
+			Members []database.CohortMember `json:"members"`
+		}{cohort, members})
+	}
+
+	fmt.Printf("%s %s\n", colorize(colorBold, "Cohort:"), cohort.Name)
+	fmt.Printf("%s %s\n", colorize(colorBold, "Query:"), formatCohortQuery(cohort))
+	fmt.Printf("%s %s\n", colorize(colorBold, "Frozen:"), cohort.CreatedAt.Local().Format(time.RFC3339))
+	fmt.Printf("%s %s\n", colorize(colorBold, "Generation:"), cohort.Generation)
+	fmt.Printf("%s %d\n\n", colorize(colorBold, "Records:"), cohort.MemberCount)
+	for _, m := range members {
+		fmt.Printf("  %s %s\n", m.Accession, colorize(colorGray, m.RecordType))
+	}
+	return nil
+}
+
+func runCohortDelete(cmd *cobra.Command, args []string) error {
+	if dryRun {
+		return writeDatabasePlan(func(db *database.DB, dbPath string) (*plan.Plan, error) {
+			c, err := db.GetCohort(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return planDelete("srake cohort delete", dbPath, "cohort", c.Name, "cohorts", "cohort_members", "members", c.MemberCount), nil
+		})
+	}
+
+	cohorts, closeFn, err := openCohortService(false)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := cohorts.Delete(context.Background(), args[0]); err != nil {
+		return err
+	}
+	if !quiet {
+		printSuccess("Deleted cohort %s", args[0])
+	}
+	return nil
+}
+
+// formatCohortQuery formats a cohort's query with its filters
+func formatCohortQuery(c *database.Cohort) string {
+	keys := make([]string, 0, len(c.Filters))
+	for key := range c.Filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	query := c.Query
+	for _, key := range keys {
+		query += fmt.Sprintf(" [%s=%s]", key, c.Filters[key])
+	}
+	return query
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/search"
+	"github.com/spf13/cobra"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <query-a> <query-b>",
+	Short: "Compare facet counts between two searches",
+	Long: `Run two searches against the local index and report, side by side, how
+often each facet value occurs in their results.
+
+Percentages are relative to the total hits of each query, and values are
+ordered by the difference in share between the two (in percentage points),
+so the most distinctive values come first. Every value in either query's
+top --top terms is counted in both, so a value common in A but outside B's
+top terms still shows its real count in B.`,
+	Example: `  # How does single-cell adoption differ between human and mouse?
+  srake compare "single cell AND organism:human" "single cell AND organism:mouse" --facet library_strategy,platform
+
+  # Compare organisms for two topics, as JSON
+  srake compare "liver cancer" "lung cancer" --facet organism --format json`,
+	Args: cobra.ExactArgs(2),
+	RunE: runCompare,
+}
+
+var (
+	compareFacets    []string
+	compareTop       int
+	compareFormat    string
+	compareIndexPath string
+)
+
+// compareFacetAliases maps short facet names to index fields.
+var compareFacetAliases = map[string]string{
+	"strategy":   "library_strategy",
+	"source":     "library_source",
+	"layout":     "library_layout",
+	"instrument": "instrument_model",
+}
+
+func init() {
+	compareCmd.Flags().StringSliceVar(&compareFacets, "facet", []string{"organism", "library_strategy", "platform"}, "Facet fields to compare (comma-separated)")
+	compareCmd.Flags().IntVar(&compareTop, "top", 10, "Number of values counted per facet and query")
+	compareCmd.Flags().StringVarP(&compareFormat, "format", "f", "table", "Output format (table|json)")
+	compareCmd.Flags().StringVar(&compareIndexPath, "index-path", "", "Path to search index (defaults to the standard location)")
+}
+
+// compareResult is the JSON form of a facet comparison.
+type compareResult struct {
+	QueryA string                   `json:"query_a"`
+	QueryB string                   `json:"query_b"`
+	TotalA uint64                   `json:"total_a"`
+	TotalB uint64                   `json:"total_b"`
+	Facets []search.FacetComparison `json:"facets"`
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	if compareFormat != "table" && compareFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", compareFormat)
+	}
+
+	var fields []string
+	for _, f := range compareFacets {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if alias, ok := compareFacetAliases[f]; ok {
+			f = alias
+		}
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("at least one facet is required")
+	}
+
+	indexPath := compareIndexPath
+	if indexPath == "" {
+		indexPath = paths.GetIndexPath()
+	}
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		return fmt.Errorf("search index not found at %s (build it with 'srake index --build')", indexPath)
+	}
+
+	idx, err := search.InitBleveIndex(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to open search index: %v", err)
+	}
+	defer idx.Close()
+
+	resultA, err := idx.FacetCounts(args[0], fields, compareTop)
+	if err != nil {
+		return fmt.Errorf("search failed for %q: %v", args[0], err)
+	}
+	resultB, err := idx.FacetCounts(args[1], fields, compareTop)
+	if err != nil {
+		return fmt.Errorf("search failed for %q: %v", args[1], err)
+	}
+
+	result := &compareResult{
+		QueryA: args[0],
+		QueryB: args[1],
+		TotalA: resultA.Total,
+		TotalB: resultB.Total,
+	}
+	for _, field := range fields {
+		valuesA, valuesB := facetValues(resultA, field), facetValues(resultB, field)
+		// A value in one query's top terms may fall outside the other's; count
+		// it there directly rather than showing it as absent
+		if valuesB, err = addMissingValues(idx, args[1], field, valuesB, valuesA); err != nil {
+			return fmt.Errorf("search failed for %q: %v", args[1], err)
+		}
+		if valuesA, err = addMissingValues(idx, args[0], field, valuesA, valuesB); err != nil {
+			return fmt.Errorf("search failed for %q: %v", args[0], err)
+		}
+		result.Facets = append(result.Facets, search.CompareFacets(field, resultA.Total, resultB.Total, valuesA, valuesB))
+	}
+
+	if compareFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	printComparison(result)
+	return nil
+}
+
+// facetValues extracts the term counts of one facet from a Bleve result.
+func facetValues(result *search.BleveSearchResult, field string) []search.FacetValue {
+	facet, ok := result.Facets[field]
+	if !ok || facet.Terms == nil {
+		return nil
+	}
+	var values []search.FacetValue
+	for _, term := range facet.Terms.Terms() {
+		values = append(values, search.FacetValue{Value: term.Term, Count: term.Count})
+	}
+	return values
+}
+
+// addMissingValues appends to values the counts, under query, of the values
+// in other that it lacks.
+func addMissingValues(idx *search.BleveIndex, query, field string, values, other []search.FacetValue) ([]search.FacetValue, error) {
+	have := make(map[string]bool, len(values))
+	for _, v := range values {
+		have[v.Value] = true
+	}
+	var missing []string
+	for _, v := range other {
+		if !have[v.Value] {
+			missing = append(missing, v.Value)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	counts, err := idx.FacetValueCounts(query, field, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range missing {
+		values = append(values, search.FacetValue{Value: value, Count: counts[value]})
+	}
+	return values, nil
+}
+
+func printComparison(r *compareResult) {
+	fmt.Printf("%s %s (%d hits)\n", colorize(colorBold, "A:"), r.QueryA, r.TotalA)
+	fmt.Printf("%s %s (%d hits)\n", colorize(colorBold, "B:"), r.QueryB, r.TotalB)
+
+	for _, facet := range r.Facets {
+		fmt.Printf("\n%s\n", colorize(colorBold, facet.Field))
+		if len(facet.Deltas) == 0 {
+			fmt.Println("  (no values)")
+			continue
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  VALUE\tA\tB\tDIFF")
+		for _, d := range facet.Deltas {
+			diff := fmt.Sprintf("%+.1f pp", d.Difference)
+			switch {
+			case d.Difference > 0:
+				diff = colorize(colorGreen, diff)
+			case d.Difference < 0:
+				diff = colorize(colorRed, diff)
+			}
+			fmt.Fprintf(w, "  %s\t%d (%.1f%%)\t%d (%.1f%%)\t%s\n",
+				truncateStr(d.Value, 40), d.CountA, d.PercentA, d.CountB, d.PercentB, diff)
+		}
+		w.Flush()
+	}
+}
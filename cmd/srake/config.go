@@ -30,8 +30,29 @@ and state directories. Also shows any environment variable overrides.`,
 var configShowCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Show current configuration",
-	Long:  `Display the current configuration settings.`,
-	RunE:  runConfigShow,
+	Long: `Display the current configuration settings, merged from all config files.
+
+Config files are applied in this order, each overriding the ones before it:
+  1. System:   /etc/srake/config.yaml (or $SRAKE_SYSTEM_CONFIG)
+  2. User:     ~/.config/srake/config.yaml
+  3. Project:  ./srake.yaml
+  4. Explicit: $SRAKE_CONFIG`,
+	RunE: runConfigShow,
+}
+
+var configDoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check how configuration files are merged",
+	Long: `Show which configuration files are in effect, where each setting comes
+from, and any problems with the merged configuration.
+
+Settings set to different values by more than one file are reported as
+conflicts, showing which value is in effect. Unknown settings (usually typos)
+and settings that cancel each other out are reported as problems, and make
+the command exit with an error.`,
+	Example: `  srake config doctor
+  srake config doctor --format json`,
+	RunE: runConfigDoctor,
 }
 
 var configInitCmd = &cobra.Command{
@@ -60,16 +81,19 @@ Uses the EDITOR environment variable, falling back to vi if not set.`,
 }
 
 var (
-	configForce bool
+	configForce        bool
+	configDoctorFormat string
 )
 
 func init() {
 	configInitCmd.Flags().BoolVar(&configForce, "force", false, "Overwrite existing configuration")
+	configDoctorCmd.Flags().StringVarP(&configDoctorFormat, "format", "f", "text", "Output format (text|json)")
 
 	configCmd.AddCommand(configPathsCmd)
 	configCmd.AddCommand(configShowCmd)
 	configCmd.AddCommand(configInitCmd)
 	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configDoctorCmd)
 }
 
 func runConfigPaths(cmd *cobra.Command, args []string) error {
@@ -156,10 +180,8 @@ func runConfigPaths(cmd *cobra.Command, args []string) error {
 }
 
 func runConfigShow(cmd *cobra.Command, args []string) error {
-	configPath := config.GetConfigPath()
-
 	// Load configuration
-	cfg, err := config.Load(configPath)
+	cfg, report, err := config.LoadLayered()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
@@ -167,15 +189,31 @@ func runConfigShow(cmd *cobra.Command, args []string) error {
 	printInfo("Configuration")
 	fmt.Println(colorize(colorGray, "────────────────────────────────────────"))
 
-	fmt.Printf("%s %s\n", colorize(colorBold, "Config File:"), configPath)
+	printConfigLayers(report.Layers)
+	fmt.Println()
 
-	// Check if file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	return printConfigYAML(cfg)
+}
+
+// printConfigLayers lists the config files in precedence order
+func printConfigLayers(layers []config.Layer) {
+	fmt.Printf("%s\n", colorize(colorBold, "Config Files (lowest to highest precedence):"))
+	found := false
+	for _, layer := range layers {
+		status := colorize(colorGray, "✗ not found")
+		if layer.Exists {
+			status = colorize(colorGreen, "✓ loaded")
+			found = true
+		}
+		fmt.Printf("  %-9s %s  %s\n", layer.Name+":", layer.Path, status)
+	}
+	if !found {
 		fmt.Println(colorize(colorYellow, "  (using defaults - no config file found)"))
 	}
+}
 
-	fmt.Println()
-
+// printConfigYAML prints a config as YAML with simple highlighting
+func printConfigYAML(cfg *config.Config) error {
 	// Marshal config to YAML for display
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
@@ -209,6 +247,70 @@ func runConfigShow(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runConfigDoctor(cmd *cobra.Command, args []string) error {
+	cfg, report, err := config.LoadLayered()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	problems := len(report.Warnings)
+
+	if configDoctorFormat == "json" {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		printInfo("Configuration Doctor")
+		fmt.Println(colorize(colorGray, "────────────────────────────────────────"))
+		printConfigLayers(report.Layers)
+
+		if len(report.Settings) > 0 {
+			fmt.Println()
+			fmt.Printf("%s\n", colorize(colorBold, "Settings From Config Files and Environment:"))
+			for _, s := range report.Settings {
+				fmt.Printf("  %s = %s %s\n", colorize(colorCyan, s.Key), s.Value,
+					colorize(colorGray, "("+s.Layer+")"))
+			}
+		}
+
+		if len(report.Conflicts) > 0 {
+			fmt.Println()
+			fmt.Printf("%s\n", colorize(colorBold, "Conflicting Settings:"))
+			for _, c := range report.Conflicts {
+				fmt.Printf("  %s\n", colorize(colorYellow, c.Key))
+				for i, v := range c.Values {
+					marker := "overridden"
+					if i == len(c.Values)-1 {
+						marker = "in effect"
+					}
+					fmt.Printf("    %-9s %s %s\n", v.Layer+":", v.Value, colorize(colorGray, "("+marker+")"))
+				}
+			}
+		}
+
+		if len(report.Warnings) > 0 {
+			fmt.Println()
+			for _, w := range report.Warnings {
+				printWarning("%s", w)
+			}
+		}
+
+		fmt.Println()
+		fmt.Printf("%s\n", colorize(colorBold, "Merged Configuration:"))
+		if err := printConfigYAML(cfg); err != nil {
+			return err
+		}
+
+		if problems == 0 {
+			printSuccess("No problems found")
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d configuration problem(s)", problems)
+	}
+	return nil
+}
+
 func runConfigInit(cmd *cobra.Command, args []string) error {
 	configPath := filepath.Join(paths.GetPaths().ConfigDir, "config.yaml")
 
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
 	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/processor"
+	"github.com/nishad/srake/internal/search"
+	"github.com/nishad/srake/internal/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -23,33 +30,231 @@ var dbCmd = &cobra.Command{
 var dbInfoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "Show database statistics",
-	Long:  `Display information about the local SRAKE metadata database.`,
-	RunE:  runDBInfo,
+	Long: `Display information about the local SRAKE metadata database.
+
+Record counts and the number of distinct organisms, platforms and other
+facet values are estimated from HyperLogLog sketches kept during ingest,
+typically within 1% of the exact count. Use --exact to count them, which
+can take minutes on a full SRA database.`,
+	Example: `  srake db info
+  srake db info --exact`,
+	RunE: runDBInfo,
 }
 
 // Database stats subcommand
 var dbStatsCmd = &cobra.Command{
 	Use:   "stats",
 	Short: "Manage database statistics",
-	Long:  `Manage the pre-computed database statistics table.`,
+	Long: `Manage the pre-computed database statistics table.
+
+--rebuild also rebuilds the HyperLogLog sketches behind the estimates of
+'srake db info', which keep counting records removed since they were built.`,
 	Example: `  srake db stats --rebuild  # Rebuild statistics from scratch
   srake db stats --show     # Show current statistics`,
 }
 
+// Database check subcommand
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check database integrity",
+	Long: `Scan the database for records whose parent is missing, JSON columns that
+fail to parse and, with --index, search documents stored in the wrong shard.
+
+Foreign keys are not enforced during ingest, so partial archives and
+suppressed records can leave runs without experiments or experiments
+without studies. --fix repairs them in one of two ways:
+
+  placeholders  Create empty parent records, keeping every ingested record
+  delete        Remove orphans, and the records orphaned in turn
+
+Either strategy clears invalid JSON. Misrouted index documents are moved to
+their shard, or removed when that shard already has them.`,
+	Example: `  srake db check
+  srake db check --index
+  srake db check --fix placeholders
+  srake db check --format json`,
+	Args: cobra.NoArgs,
+	RunE: runDBCheck,
+}
+
+// Database vacuum subcommand
+var dbVacuumCmd = &cobra.Command{
+	Use:   "vacuum",
+	Short: "Reclaim the space of deleted and replaced records",
+	Long: `Rebuild the database file without the free pages left behind by deleted
+and replaced records, and report its size before and after.
+
+Vacuuming rewrites the whole database: on a full SRA database it takes a
+while and needs free disk space of up to twice the database size. With
+--auto, the database is only vacuumed when over 10% of it is free space,
+as after 'srake ingest --optimize'.`,
+	Example: `  srake db vacuum
+  srake db vacuum --auto`,
+	Args: cobra.NoArgs,
+	RunE: runDBVacuum,
+}
+
+// Database analyze subcommand
+var dbAnalyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Update the statistics the query planner uses",
+	Long: `Gather the table and index statistics SQLite uses to choose indexes.
+
+Queries can pick poor indexes after a large ingest changes the shape of
+the data; analyzing afterwards, or ingesting with --optimize, keeps them
+fast.`,
+	Example: `  srake db analyze`,
+	Args:    cobra.NoArgs,
+	RunE:    runDBAnalyze,
+}
+
+// Database diff subcommand
+var dbDiffCmd = &cobra.Command{
+	Use:   "diff <old.db> <new.db>",
+	Short: "Show the records added, removed and changed between two databases",
+	Long: `Compare two database snapshots, such as those of consecutive monthly
+releases, and report the accessions added, removed and changed for each
+record type.
+
+A record has changed when any of its columns differs between the two
+databases, including its stored metadata. Neither database is modified.`,
+	Example: `  srake db diff srake-2025-07.db srake-2025-08.db
+  srake db diff old.db new.db --limit 0 --format json > changes.json`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDBDiff,
+}
+
+// Database extract subcommand
+var dbExtractCmd = &cobra.Command{
+	Use:   "extract <study>...",
+	Short: "Copy studies and everything they reference into a new database",
+	Long: `Copy studies, with their experiments, samples, runs and analyses and the
+identifiers, links, attributes, curations and stored XML of those records,
+into a new database. The copy is self-contained, so collaborators can
+search and export a small slice of the archive with srake.
+
+The lineage of each sample's taxon is copied too, so taxonomy searches
+work. Build a search index of the copy with 'srake index --build'.`,
+	Example: `  srake db extract SRP123456 --output subset.db
+  srake db extract SRP123456 SRP234567 -o cohort.db --force`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runDBExtract,
+}
+
+// Database changes subcommand
+var dbChangesCmd = &cobra.Command{
+	Use:   "changes",
+	Short: "List the records changed since a generation of the change log",
+	Long: `List the records inserted, updated or deleted since a generation of the
+database's change log. Every write to studies, experiments, samples, runs,
+analyses, submissions and curations is logged, and only the latest change
+to each record is kept. The search index applies the log on each sync.
+
+Other consumers, such as a sink feeding a separate search engine or
+warehouse, name themselves with --consumer: changes are listed from the
+consumer's cursor, and --commit moves the cursor once they have been
+applied. Changes are kept until every consumer has applied them; a new
+consumer should copy every record before following the log.`,
+	Example: `  srake db changes --since 1200 --limit 500 --format json
+  srake db changes --consumer warehouse --format json
+  srake db changes --consumer warehouse --commit 1700
+  srake db changes --prune`,
+	Args: cobra.NoArgs,
+	RunE: runDBChanges,
+}
+
+// Database provenance subcommand
+var dbProvenanceCmd = &cobra.Command{
+	Use:   "provenance <accession>",
+	Short: "Show when and from which file a record was last ingested",
+	Long: `Show the archive and file a record was last ingested from, and when, with
+the ingest that wrote it: the file or URL it read, when it started and
+finished, and how many records it inserted.
+
+An ingest that never finished was interrupted; records it wrote before
+stopping keep its ID. Records ingested before ingests were recorded show
+their file and time only. Use it to find out why a record looks stale:
+whether the latest update that should carry it was ingested at all.`,
+	Example: `  srake db provenance SRR000001
+  srake db provenance SRP000001 --format json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDBProvenance,
+}
+
 var (
 	statsRebuild bool
 	statsShow    bool
+
+	infoExact bool
+
+	checkFix      string
+	checkIndex    bool
+	checkExamples int
+	checkFormat   string
+	checkQuick    bool
+
+	vacuumAuto      bool
+	diffLimit       int
+	diffFormat      string
+	extractOutput   string
+	extractForce    bool
+	maintenanceWait bool
+
+	changesSince    int64
+	changesLimit    int
+	changesConsumer string
+	changesCommit   int64
+	changesPrune    bool
+	changesFormat   string
+
+	provenanceFormat string
 )
 
 func init() {
 	// Add subcommands to db
 	dbCmd.AddCommand(dbInfoCmd)
 	dbCmd.AddCommand(dbStatsCmd)
+	dbCmd.AddCommand(dbCheckCmd)
+	dbCmd.AddCommand(dbVacuumCmd)
+	dbCmd.AddCommand(dbAnalyzeCmd)
+	dbCmd.AddCommand(dbDiffCmd)
+	dbCmd.AddCommand(dbExtractCmd)
+	dbCmd.AddCommand(dbChangesCmd)
+	dbCmd.AddCommand(dbProvenanceCmd)
+
+	dbInfoCmd.Flags().BoolVar(&infoExact, "exact", false, "Count records and distinct values exactly instead of estimating them")
 
 	// Add flags to stats command
 	dbStatsCmd.Flags().BoolVar(&statsRebuild, "rebuild", false, "Rebuild statistics table")
 	dbStatsCmd.Flags().BoolVar(&statsShow, "show", false, "Show statistics table contents")
 	dbStatsCmd.RunE = runDBStats
+
+	dbCheckCmd.Flags().StringVar(&checkFix, "fix", "", "Repair problems ("+database.FixPlaceholders+"|"+database.FixDelete+")")
+	dbCheckCmd.Flags().BoolVar(&checkIndex, "index", false, "Also check the search index for misrouted and duplicate documents")
+	dbCheckCmd.Flags().IntVar(&checkExamples, "examples", 5, "Examples to show per check")
+	dbCheckCmd.Flags().StringVarP(&checkFormat, "format", "f", "table", "Output format (table|json)")
+	dbCheckCmd.Flags().BoolVar(&checkQuick, "quick", false, "Check the database file with SQLite's faster quick_check, which skips indexes")
+
+	dbVacuumCmd.Flags().BoolVar(&vacuumAuto, "auto", false, "Only vacuum when over 10% of the database is free space")
+	dbDiffCmd.Flags().IntVar(&diffLimit, "limit", 10, "Accessions to list per record type and change (0 for all)")
+	dbDiffCmd.Flags().StringVarP(&diffFormat, "format", "f", "table", "Output format (table|json)")
+
+	dbExtractCmd.Flags().StringVarP(&extractOutput, "output", "o", "", "Path of the new database")
+	dbExtractCmd.Flags().BoolVar(&extractForce, "force", false, "Replace the output database if it exists")
+	dbExtractCmd.MarkFlagRequired("output")
+
+	dbChangesCmd.Flags().Int64Var(&changesSince, "since", 0, "List changes after this generation (default: the consumer's cursor)")
+	dbChangesCmd.Flags().IntVar(&changesLimit, "limit", 100, "Changes to list (0 for all)")
+	dbChangesCmd.Flags().StringVar(&changesConsumer, "consumer", "", "Name of the consumer whose cursor to read or commit")
+	dbChangesCmd.Flags().Int64Var(&changesCommit, "commit", 0, "Record that the consumer has applied the changes up to this generation")
+	dbChangesCmd.Flags().BoolVar(&changesPrune, "prune", false, "Remove the changes every consumer has applied")
+	dbChangesCmd.Flags().StringVarP(&changesFormat, "format", "f", "table", "Output format (table|json)")
+
+	dbProvenanceCmd.Flags().StringVarP(&provenanceFormat, "format", "f", "table", "Output format (table|json)")
+
+	for _, cmd := range []*cobra.Command{dbVacuumCmd, dbAnalyzeCmd} {
+		cmd.Flags().BoolVar(&maintenanceWait, "wait", false, "Wait for another process writing the database to finish instead of failing")
+	}
 }
 
 func runDBInfo(cmd *cobra.Command, args []string) error {
@@ -74,10 +279,19 @@ func runDBInfo(cmd *cobra.Command, args []string) error {
 	defer db.Close()
 
 	// Get database statistics
-	stats, err := db.GetStats()
+	var stats *database.DatabaseStats
+	if infoExact {
+		stats, err = db.GetStats()
+	} else {
+		stats, err = db.EstimateStats()
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get statistics: %v", err)
 	}
+	distinct, err := db.DistinctCounts(infoExact)
+	if err != nil {
+		return fmt.Errorf("failed to count distinct values: %v", err)
+	}
 
 	printInfo("Database Information")
 	fmt.Println(colorize(colorGray, strings.Repeat("─", 40)))
@@ -92,12 +306,42 @@ func runDBInfo(cmd *cobra.Command, args []string) error {
 
 	// Table statistics
 	fmt.Println()
-	fmt.Printf("%s\n", colorize(colorBold, "Tables:"))
+	if stats.Approximate {
+		fmt.Printf("%s\n", colorize(colorBold, "Tables (estimated):"))
+	} else {
+		fmt.Printf("%s\n", colorize(colorBold, "Tables:"))
+	}
 	fmt.Printf("  studies:     %s\n", colorize(colorCyan, fmt.Sprintf("%d", stats.TotalStudies)))
 	fmt.Printf("  experiments: %s\n", colorize(colorCyan, fmt.Sprintf("%d", stats.TotalExperiments)))
 	fmt.Printf("  runs:        %s\n", colorize(colorCyan, fmt.Sprintf("%d", stats.TotalRuns)))
 	fmt.Printf("  samples:     %s\n", colorize(colorCyan, fmt.Sprintf("%d", stats.TotalSamples)))
 
+	// Distinct facet values
+	fmt.Println()
+	fmt.Printf("%s\n", colorize(colorBold, "Distinct values:"))
+	for _, c := range distinct {
+		switch c.Dimension {
+		case database.SketchStudies, database.SketchExperiments, database.SketchSamples, database.SketchRuns:
+			continue
+		}
+		count := fmt.Sprintf("%d", c.Count)
+		if c.Approximate {
+			count = "~" + count
+		}
+		fmt.Printf("  %-18s %s\n", c.Dimension+":", colorize(colorCyan, count))
+	}
+
+	// Records by source archive, when provenance was recorded
+	if archives, err := db.CountRecordsByArchive(); err == nil && len(archives) > 0 {
+		fmt.Println()
+		fmt.Printf("%s\n", colorize(colorBold, "Archives:"))
+		for _, archive := range processor.Sources {
+			if count, ok := archives[archive]; ok {
+				fmt.Printf("  %-12s %s\n", archive+":", colorize(colorCyan, fmt.Sprintf("%d", count)))
+			}
+		}
+	}
+
 	if !stats.LastUpdate.IsZero() {
 		fmt.Println()
 		fmt.Printf("%s %s\n", colorize(colorBold, "Last Update:"),
@@ -143,6 +387,9 @@ func runDBStats(cmd *cobra.Command, args []string) error {
 		if err := db.UpdateStatistics(); err != nil {
 			return fmt.Errorf("failed to rebuild statistics: %v", err)
 		}
+		if err := db.RebuildSketches(); err != nil {
+			return fmt.Errorf("failed to rebuild sketches: %v", err)
+		}
 
 		printSuccess("Statistics rebuilt successfully")
 
@@ -184,3 +431,506 @@ func runDBStats(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// dbCheckOutput is the JSON output of srake db check
+type dbCheckOutput struct {
+	*database.IntegrityReport
+	Misrouted []search.MisroutedDoc   `json:"misrouted,omitempty"`
+	Fixes     []database.IntegrityFix `json:"fixes,omitempty"`
+}
+
+func runDBCheck(cmd *cobra.Command, args []string) error {
+	if checkFormat != "table" && checkFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", checkFormat)
+	}
+	if checkFix != "" && checkFix != database.FixPlaceholders && checkFix != database.FixDelete {
+		return fmt.Errorf("invalid fix strategy: %s (must be %s or %s)", checkFix, database.FixPlaceholders, database.FixDelete)
+	}
+
+	dbPath := serverDBPath
+	if dbPath == "" {
+		dbPath = paths.GetDatabasePath()
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		printError("Database not found at %s", dbPath)
+		return fmt.Errorf("database not found")
+	}
+
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var report *database.IntegrityReport
+	var storage database.IntegrityResult
+	err = withProgress(checkFormat == "table", "Checking database integrity", func() error {
+		if report, err = db.CheckIntegrity(checkExamples); err != nil {
+			return err
+		}
+		storage, err = db.CheckStorageIntegrity(cmd.Context(), checkQuick, checkExamples)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %v", err)
+	}
+	out := dbCheckOutput{IntegrityReport: report}
+
+	indexPath := paths.GetIndexPath()
+	if checkIndex {
+		out.Misrouted, err = search.CheckShards(indexPath)
+		if err != nil {
+			return fmt.Errorf("index check failed: %v", err)
+		}
+	}
+
+	// Damage to the file itself is reported, but cannot be fixed
+	problems := report.Problems() + int64(len(out.Misrouted))
+	report.Results = append(report.Results, storage)
+	if checkFix != "" && problems > 0 {
+		out.Fixes, err = db.FixIntegrity(checkFix)
+		if err != nil {
+			return fmt.Errorf("failed to fix problems: %v", err)
+		}
+		if len(out.Misrouted) > 0 {
+			if err := search.RemoveMisrouted(indexPath, out.Misrouted); err != nil {
+				return fmt.Errorf("failed to fix index: %v", err)
+			}
+		}
+	}
+
+	if checkFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(out)
+	}
+	if quiet {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tCOUNT\tDESCRIPTION")
+	for _, r := range report.Results {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", r.Check, r.Count, r.Description)
+	}
+	if checkIndex {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", "misrouted_documents", len(out.Misrouted), "index documents stored in the wrong shard")
+	}
+	w.Flush()
+
+	for _, r := range report.Results {
+		for _, p := range r.Examples {
+			switch {
+			case p.Missing != "":
+				fmt.Printf("  %s: %s %s references missing %s\n", r.Check, p.Table, p.Key, p.Missing)
+			case p.Column != "":
+				fmt.Printf("  %s: %s %s has invalid %s\n", r.Check, p.Table, p.Key, p.Column)
+			case p.Message != "":
+				fmt.Printf("  %s: %s\n", r.Check, p.Message)
+			}
+		}
+	}
+	for i, d := range out.Misrouted {
+		if i >= checkExamples {
+			break
+		}
+		note := ""
+		if d.Duplicate {
+			note = ", duplicated"
+		}
+		fmt.Printf("  misrouted_documents: %s in shard %d, belongs in %d%s\n", d.ID, d.Shard, d.Home, note)
+	}
+
+	if storage.Count > 0 {
+		printWarning("SQLite found %d errors in the database file, which --fix cannot repair; restore it from a backup or ingest again", storage.Count)
+	}
+	switch {
+	case problems == 0 && storage.Count == 0:
+		printSuccess("No integrity problems found")
+	case problems == 0:
+	case checkFix == "":
+		printWarning("Found %d problems; run with --fix %s or --fix %s to repair them",
+			problems, database.FixPlaceholders, database.FixDelete)
+	default:
+		for _, f := range out.Fixes {
+			printInfo("%s: %s %d rows in %s", f.Check, f.Action, f.Rows, f.Table)
+		}
+		if len(out.Misrouted) > 0 {
+			printInfo("misrouted_documents: repaired %d documents", len(out.Misrouted))
+		}
+		printSuccess("Fixed %d problems", problems)
+	}
+	return nil
+}
+
+// openMaintainedDB opens the database for vacuum or analyze, holding its
+// write lock so that no ingest or index build runs meanwhile
+func openMaintainedDB(command string) (*database.DB, func(), error) {
+	dbPath := serverDBPath
+	if dbPath == "" {
+		dbPath = paths.GetDatabasePath()
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		printError("Database not found at %s", dbPath)
+		return nil, nil, fmt.Errorf("database not found")
+	}
+
+	lock, err := acquireLock(dbPath, command, maintenanceWait)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		lock.Release()
+		return nil, nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return db, func() {
+		db.Close()
+		lock.Release()
+	}, nil
+}
+
+// withProgress runs fn with a spinner showing the time elapsed, when show
+// is set and output is not quiet
+func withProgress(show bool, message string, fn func() error) error {
+	if !show || quiet {
+		return fn()
+	}
+	spinner := ui.NewSpinner(message)
+	spinner.Start()
+	defer spinner.Stop("")
+
+	done := make(chan struct{})
+	defer close(done)
+	start := time.Now()
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				spinner.Update(fmt.Sprintf("%s (%s)", message, time.Since(start).Round(time.Second)))
+			}
+		}
+	}()
+	return fn()
+}
+
+func runDBVacuum(cmd *cobra.Command, args []string) error {
+	db, release, err := openMaintainedDB("srake db vacuum")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	before, err := db.SpaceUsage()
+	if err != nil {
+		return err
+	}
+	if vacuumAuto && !before.NeedsVacuum() {
+		printInfo("Only %s of %s is free; not vacuuming", downloader.FormatSize(before.FreeBytes()), downloader.FormatSize(before.FileBytes))
+		return nil
+	}
+
+	start := time.Now()
+	message := fmt.Sprintf("Vacuuming %s (%s, %s free)", db.Path(), downloader.FormatSize(before.FileBytes), downloader.FormatSize(before.FreeBytes()))
+	if err := withProgress(true, message, func() error { return db.Vacuum(cmd.Context()) }); err != nil {
+		return err
+	}
+	after, err := db.SpaceUsage()
+	if err != nil {
+		return err
+	}
+	printSuccess("Vacuumed in %s: %s → %s (%s reclaimed)", time.Since(start).Round(time.Second),
+		downloader.FormatSize(before.FileBytes), downloader.FormatSize(after.FileBytes),
+		downloader.FormatSize(max(before.FileBytes-after.FileBytes, 0)))
+	return nil
+}
+
+func runDBAnalyze(cmd *cobra.Command, args []string) error {
+	db, release, err := openMaintainedDB("srake db analyze")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	start := time.Now()
+	if err := withProgress(true, "Analyzing "+db.Path(), func() error { return db.Analyze(cmd.Context()) }); err != nil {
+		return err
+	}
+	printSuccess("Analyzed in %s", time.Since(start).Round(time.Second))
+	return nil
+}
+
+func runDBDiff(cmd *cobra.Command, args []string) error {
+	if diffFormat != "table" && diffFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", diffFormat)
+	}
+
+	var diff *database.SnapshotDiff
+	err := withProgress(diffFormat == "table", "Comparing databases", func() error {
+		var err error
+		diff, err = database.DiffSnapshots(cmd.Context(), args[0], args[1], diffLimit)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if diffFormat == "json" {
+		return printJSON(diff)
+	}
+
+	fmt.Printf("%s %s\n", colorize(colorBold, "Old:"), diff.Old)
+	fmt.Printf("%s %s\n\n", colorize(colorBold, "New:"), diff.New)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tADDED\tREMOVED\tCHANGED")
+	for _, t := range diff.Tables {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", t.Table, t.Added.Count, t.Removed.Count, t.Changed.Count)
+	}
+	w.Flush()
+
+	for _, t := range diff.Tables {
+		printDiffAccessions("+", colorGreen, t.Table+" added", t.Added)
+		printDiffAccessions("-", colorRed, t.Table+" removed", t.Removed)
+		printDiffAccessions("~", colorYellow, t.Table+" changed", t.Changed)
+	}
+	return nil
+}
+
+func printDiffAccessions(marker, color, label string, a database.Accessions) {
+	if a.Count == 0 {
+		return
+	}
+	fmt.Printf("\n%s\n", colorize(colorBold, fmt.Sprintf("%s (%d):", label, a.Count)))
+	for _, accession := range a.Accessions {
+		fmt.Printf("  %s %s\n", colorize(color, marker), accession)
+	}
+	if more := a.Count - int64(len(a.Accessions)); more > 0 {
+		fmt.Printf("  %s\n", colorize(colorGray, fmt.Sprintf("... and %d more", more)))
+	}
+}
+
+func runDBExtract(cmd *cobra.Command, args []string) error {
+	dbPath := serverDBPath
+	if dbPath == "" {
+		dbPath = paths.GetDatabasePath()
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		printError("Database not found at %s", dbPath)
+		return fmt.Errorf("database not found")
+	}
+	if _, err := os.Stat(extractOutput); err == nil {
+		if !extractForce {
+			return fmt.Errorf("%s already exists; use --force to replace it", extractOutput)
+		}
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Remove(extractOutput + suffix); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var summary *database.ExtractSummary
+	err = withProgress(true, fmt.Sprintf("Extracting %d studies", len(args)), func() error {
+		summary, err = db.ExtractStudies(cmd.Context(), args, extractOutput)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(summary.Missing) > 0 {
+		printWarning("Not in the database: %s", strings.Join(summary.Missing, ", "))
+	}
+	if !quiet {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TABLE\tROWS")
+		for _, t := range summary.Tables {
+			if t.Rows > 0 {
+				fmt.Fprintf(w, "%s\t%d\n", t.Table, t.Rows)
+			}
+		}
+		w.Flush()
+	}
+
+	var size int64
+	if info, err := os.Stat(summary.Path); err == nil {
+		size = info.Size()
+	}
+	printSuccess("Extracted %d studies to %s (%s)", summary.Studies, summary.Path, downloader.FormatSize(size))
+	return nil
+}
+
+func runDBChanges(cmd *cobra.Command, args []string) error {
+	if changesFormat != "table" && changesFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", changesFormat)
+	}
+	committing := cmd.Flags().Changed("commit")
+	if committing && changesConsumer == "" {
+		return fmt.Errorf("--commit needs --consumer")
+	}
+
+	dbPath := serverDBPath
+	if dbPath == "" {
+		dbPath = paths.GetDatabasePath()
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		printError("Database not found at %s", dbPath)
+		return fmt.Errorf("database not found")
+	}
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	ctx := cmd.Context()
+
+	if changesPrune {
+		pruned, err := db.PruneChanges(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to prune changes: %v", err)
+		}
+		printSuccess("Pruned %d changes", pruned)
+		return nil
+	}
+	if committing {
+		if err := db.SetChangeCursor(ctx, changesConsumer, changesCommit); err != nil {
+			return fmt.Errorf("failed to save cursor: %v", err)
+		}
+		printSuccess("%s has applied the changes up to generation %d", changesConsumer, changesCommit)
+		return nil
+	}
+
+	since := changesSince
+	if changesConsumer != "" && !cmd.Flags().Changed("since") {
+		cursor, ok, err := db.ChangeCursor(ctx, changesConsumer)
+		if err != nil {
+			return fmt.Errorf("failed to read cursor: %v", err)
+		}
+		if !ok {
+			printWarning("%s has no cursor yet; copy every record before applying the changes listed", changesConsumer)
+		}
+		since = cursor
+	}
+
+	limit := changesLimit
+	if limit <= 0 {
+		limit = -1 // SQLite reads a negative limit as no limit
+	}
+	changes, err := db.ChangesSince(ctx, since, limit)
+	if err != nil {
+		return fmt.Errorf("failed to read changes: %v", err)
+	}
+	generation, err := db.ChangeGeneration(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read change generation: %v", err)
+	}
+
+	if changesFormat == "json" {
+		if changes == nil {
+			changes = []database.Change{}
+		}
+		return printJSON(struct {
+			Since      int64             `json:"since"`
+			Generation int64             `json:"generation"`
+			Changes    []database.Change `json:"changes"`
+		}{since, generation, changes})
+	}
+
+	if len(changes) == 0 {
+		printInfo("No changes after generation %d", since)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GENERATION\tOP\tTYPE\tACCESSION\tCHANGED")
+	for _, c := range changes {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", c.Generation, c.Op, c.RecordType, c.Accession, c.ChangedAt.Format(time.DateTime))
+	}
+	w.Flush()
+	if last := changes[len(changes)-1].Generation; last < generation {
+		printInfo("\nMore changes follow; list them with --since %d", last)
+	}
+	return nil
+}
+
+func runDBProvenance(cmd *cobra.Command, args []string) error {
+	if provenanceFormat != "table" && provenanceFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", provenanceFormat)
+	}
+
+	dbPath := serverDBPath
+	if dbPath == "" {
+		dbPath = paths.GetDatabasePath()
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		printError("Database not found at %s", dbPath)
+		return fmt.Errorf("database not found")
+	}
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	accession, err := resolveInternalAccession(db, args[0])
+	if err != nil {
+		return err
+	}
+	source, err := db.GetRecordSource(accession)
+	if err != nil {
+		return fmt.Errorf("no provenance recorded for %s; it was not ingested, or was ingested before provenance was recorded", accession)
+	}
+	var ingest *database.Ingest
+	if source.IngestID != "" {
+		if ingest, err = db.GetIngest(source.IngestID); err != nil {
+			ingest = nil
+		}
+	}
+
+	if provenanceFormat == "json" {
+		return printJSON(struct {
+			*database.RecordSource
+			Ingest *database.Ingest `json:"ingest,omitempty"`
+		}{source, ingest})
+	}
+
+	fmt.Printf("%s %s (%s)\n", colorize(colorBold, "Record:"), colorize(colorCyan, source.Accession), source.RecordType)
+	fmt.Printf("  %-12s %s\n", "Archive:", source.Archive)
+	if source.SourceFile != "" {
+		fmt.Printf("  %-12s %s\n", "File:", source.SourceFile)
+	}
+	fmt.Printf("  %-12s %s\n", "Ingested:", source.IngestedAt.Local().Format(time.DateTime))
+	if source.IngestID == "" {
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", colorize(colorBold, "Ingest:"), source.IngestID)
+	if ingest == nil {
+		printWarning("The ingest is no longer recorded")
+		return nil
+	}
+	fmt.Printf("  %-12s %s\n", "Input:", ingest.Input)
+	fmt.Printf("  %-12s %s\n", "Started:", ingest.StartedAt.Local().Format(time.DateTime))
+	switch {
+	case ingest.FinishedAt == nil:
+		fmt.Printf("  %-12s %s\n", "Finished:", colorize(colorYellow, "no; interrupted or still running"))
+	case ingest.Error != "":
+		fmt.Printf("  %-12s %s\n", "Finished:", ingest.FinishedAt.Local().Format(time.DateTime))
+		fmt.Printf("  %-12s %s\n", "Failed:", colorize(colorRed, ingest.Error))
+	default:
+		fmt.Printf("  %-12s %s\n", "Finished:", ingest.FinishedAt.Local().Format(time.DateTime))
+	}
+	fmt.Printf("  %-12s %d\n", "Records:", ingest.Records)
+	return nil
+}
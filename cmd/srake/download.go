@@ -6,8 +6,10 @@ import (
 	"os"
 	"strings"
 
+	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
 	"github.com/nishad/srake/internal/downloader"
+	srerrors "github.com/nishad/srake/internal/errors"
 	"github.com/nishad/srake/internal/paths"
 	"github.com/spf13/cobra"
 )
@@ -51,6 +53,7 @@ var (
 	downloadRetry    int
 	downloadValidate bool
 	downloadDryRun   bool
+	downloadOpen     bool
 )
 
 func init() {
@@ -61,9 +64,10 @@ func init() {
 	downloadCmd.Flags().IntVarP(&downloadParallel, "parallel", "p", 1, "Number of parallel downloads")
 	downloadCmd.Flags().BoolVar(&downloadAspera, "aspera", false, "Use Aspera for high-speed transfer")
 	downloadCmd.Flags().StringVarP(&downloadList, "list", "l", "", "File containing accessions (one per line)")
-	downloadCmd.Flags().IntVar(&downloadRetry, "retry", 3, "Number of retry attempts")
+	downloadCmd.Flags().IntVar(&downloadRetry, "retry", 4, "Number of retries after a network failure (overrides retry.network in the config)")
 	downloadCmd.Flags().BoolVar(&downloadValidate, "validate", true, "Validate downloaded files")
 	downloadCmd.Flags().BoolVar(&downloadDryRun, "dry-run", false, "Show what would be downloaded without downloading")
+	downloadCmd.Flags().BoolVar(&downloadOpen, "open-access-only", false, "Skip controlled-access runs, and runs not in the local database")
 }
 
 func runDownload(cmd *cobra.Command, args []string) error {
@@ -120,6 +124,13 @@ func runDownload(cmd *cobra.Command, args []string) error {
 		Verbose:       verbose,
 	}
 
+	if cfg, _, err := config.LoadLayered(); err == nil {
+		dlConfig.RetryPolicies = srerrors.PoliciesFromConfig(cfg.Retry)
+		if !cmd.Flags().Changed("retry") {
+			dlConfig.RetryAttempts = max(cfg.Retry.Network.MaxAttempts-1, 0)
+		}
+	}
+
 	dl := downloader.NewSRADownloader(dlConfig)
 
 	// Expand accessions (e.g., SRP to multiple SRRs)
@@ -128,6 +139,13 @@ func runDownload(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to expand accessions: %w", err)
 	}
 
+	if downloadOpen {
+		expandedAccessions, err = openAccessRuns(expandedAccessions)
+		if err != nil {
+			return err
+		}
+	}
+
 	if verbose || downloadDryRun {
 		printInfo("Will download %d files", len(expandedAccessions))
 	}
@@ -221,6 +239,32 @@ func expandAccessions(ctx context.Context, accessions []string) ([]string, error
 	return expanded, nil
 }
 
+// openAccessRuns drops controlled-access runs, and runs whose access level
+// cannot be checked because they are not in the database
+func openAccessRuns(runs []string) ([]string, error) {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	open, controlled, unknown, err := db.SplitOpenAccessRuns(runs)
+	if err != nil {
+		return nil, err
+	}
+	excluded := controlled
+	for _, run := range unknown {
+		excluded = append(excluded, &database.RecordAccess{Accession: run, RecordType: "run", Access: database.AccessUnknown})
+	}
+	if len(excluded) > 0 {
+		printWarning("Skipping %d runs that are not open access: %s", len(excluded), formatExcludedRuns(excluded))
+	}
+	if len(open) == 0 {
+		return nil, fmt.Errorf("no open-access runs to download")
+	}
+	return open, nil
+}
+
 // Helper functions to get runs from database
 func getRunsForStudy(studyAccession string) ([]string, error) {
 	db, err := database.Initialize(paths.GetDatabasePath())
@@ -300,27 +344,14 @@ func getRunsForSample(sampleAccession string) ([]string, error) {
 	}
 	defer db.Close()
 
-	// Samples are linked via experiments
-	query := `
-		SELECT r.run_accession
-		FROM runs r
-		JOIN experiments e ON r.experiment_accession = e.experiment_accession
-		WHERE e.sample_accession = ?
-		ORDER BY r.run_accession
-	`
-	rows, err := db.Query(query, sampleAccession)
+	links, err := db.GetSampleRuns(sampleAccession)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
-	defer rows.Close()
 
 	var runs []string
-	for rows.Next() {
-		var run string
-		if err := rows.Scan(&run); err != nil {
-			continue
-		}
-		runs = append(runs, run)
+	for _, l := range links {
+		runs = append(runs, l.RunAccession)
 	}
 
 	if len(runs) == 0 {
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/export"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/search"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+// dumpCmd writes tables or search results as files for analysis tools.
+// srake db export, in export.go, writes SRAmetadb databases instead.
+var dumpCmd = &cobra.Command{
+	Use:   "export [query]",
+	Short: "Export tables or search results to Parquet, JSONL or CSV",
+	Long: `Export a table, or the records matching a search, for analysis in R, Python
+or other tools. Rows are streamed, so whole tables can be exported without
+loading them into memory.
+
+Formats:
+  parquet  Typed columns, readable by arrow, pandas, polars and DuckDB
+  jsonl    One JSON object per line
+  csv      Comma-separated values with a header line
+  tsv      Tab-separated values with a header line
+
+The format and compression are inferred from the output file name, such as
+runs.parquet or runs.csv.gz. Output goes to stdout when no file is given.
+
+With a query, the search index is searched for records of the table's type
+and the matching rows are written in rank order.
+
+With --joined, runs are written joined to their samples, experiments and
+studies, one row per run and sample, with the most common sample attributes
+flattened into attr_<tag> columns: one table for R or a spreadsheet. The
+rows are read from a single query as they are written, so memory use stays
+the same however many runs there are. --estimate shows the number of rows
+and the expected size of the output without writing it. --inherit fills
+the attributes a sample lacks from its experiment, then its study, adding an
+attr_<tag>_source column that names where each value came from.
+
+With --server, the records matching a query are exported by a remote srake
+server instead, as JSON lines. They are pulled in a compact binary encoding
+(gzip-compressed MessagePack) decoded one record at a time, about half the
+transfer and memory of JSON; older servers send JSON lines. The API key is
+read from --api-key or SRAKE_API_KEY.
+
+Exports estimated to read more rows than guardrails.max_rows in the config
+are stopped before they start; --force runs them unless the guardrails
+refuse them outright.`,
+	Example: `  # Export every run to Parquet
+  srake export --table runs -o runs.parquet
+
+  # Export selected study columns as compressed CSV
+  srake export --table studies --columns study_accession,study_title,organism -o studies.csv.gz
+
+  # Export the experiments matching a search as JSONL
+  srake export "single cell liver" --table experiments --limit 500 > liver.jsonl
+
+  # One table of runs with study titles and sample attributes
+  srake export --joined --estimate -o runs.csv.gz
+  srake export --joined -o runs.csv.gz
+  srake export --joined --columns run_accession,study_title,organism,attr_sex,attr_age -o runs.parquet
+  srake export --joined --inherit --columns run_accession,attr_tissue,attr_disease -o runs.csv
+
+  # Pull the matching experiments from a remote server
+  srake export "RNA-Seq" --table experiments --server https://srake.example.org -o experiments.jsonl.gz`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDump,
+}
+
+var (
+	dumpTable    string
+	dumpColumns  []string
+	dumpFormat   string
+	dumpCompress string
+	dumpOutput   string
+	dumpLimit    int
+	dumpForce    bool
+
+	dumpJoined     bool
+	dumpAttributes int
+	dumpEstimate   bool
+	dumpInherit    bool
+
+	dumpServer string
+	dumpAPIKey string
+)
+
+// dumpSearchLimit bounds the hits exported for a query without --limit
+const dumpSearchLimit = 10000
+
+// dumpTypes are the search document types of the tables a query can export
+var dumpTypes = map[string]string{
+	"studies":     "study",
+	"experiments": "experiment",
+	"samples":     "sample",
+	"runs":        "run",
+}
+
+func init() {
+	dumpCmd.Flags().StringVarP(&dumpTable, "table", "t", "", "Table to export ("+strings.Join(export.DumpTables, ", ")+")")
+	dumpCmd.Flags().StringSliceVar(&dumpColumns, "columns", nil, "Columns to export, in order (default: all)")
+	dumpCmd.Flags().StringVarP(&dumpFormat, "format", "f", "", "Output format (parquet|jsonl|csv|tsv, default: from file name, or jsonl)")
+	dumpCmd.Flags().StringVar(&dumpCompress, "compress", "", "Compression (none|gzip, default: from file name)")
+	dumpCmd.Flags().StringVarP(&dumpOutput, "output", "o", "", "Output file (default: stdout)")
+	dumpCmd.Flags().IntVarP(&dumpLimit, "limit", "l", 0, fmt.Sprintf("Maximum rows to export (default: all rows, or %d search hits)", dumpSearchLimit))
+	dumpCmd.Flags().BoolVar(&dumpForce, "force", false, "Overwrite an existing output file, and export more rows than guardrails.max_rows")
+	dumpCmd.Flags().BoolVar(&dumpJoined, "joined", false, "Export runs joined to their samples, experiments and studies")
+	dumpCmd.Flags().IntVar(&dumpAttributes, "attributes", 20, "With --joined, the number of most common sample attributes to add as columns")
+	dumpCmd.Flags().BoolVar(&dumpEstimate, "estimate", false, "With --joined, show the rows and expected size of the export without writing it")
+	dumpCmd.Flags().StringVar(&dumpServer, "server", "", "Export the records matching a query from a remote srake server, as JSON lines")
+	dumpCmd.Flags().StringVar(&dumpAPIKey, "api-key", "", "API key of the server given by --server (default: $SRAKE_API_KEY)")
+	dumpCmd.Flags().BoolVar(&dumpInherit, "inherit", false, "With --joined, fill missing sample attributes from the experiment, then the study, with their source")
+}
+
+func runDump(cmd *cobra.Command, args []string) error {
+	if dryRun {
+		if err := checkPlanFormat(); err != nil {
+			return err
+		}
+	}
+	if dumpJoined {
+		if dumpTable != "" || len(args) > 0 {
+			return fmt.Errorf("--joined exports every run; it cannot be combined with --table or a query")
+		}
+	} else if dumpEstimate {
+		return fmt.Errorf("--estimate needs --joined")
+	} else if dumpInherit {
+		return fmt.Errorf("--inherit needs --joined")
+	} else if dumpTable == "" {
+		if len(args) == 0 {
+			return fmt.Errorf("--table is required")
+		}
+		dumpTable = "studies"
+	}
+
+	toStdout := dumpOutput == "" || dumpOutput == "-"
+	format, compression := dumpFormat, dumpCompress
+	if !toStdout {
+		pathFormat, pathCompression := export.FormatFromPath(dumpOutput)
+		if format == "" {
+			format = pathFormat
+		}
+		if compression == "" {
+			compression = pathCompression
+		}
+	}
+	if format == "" {
+		format = export.FormatJSONL
+	}
+	if format == export.FormatParquet && toStdout && isTerminal() && !dumpEstimate {
+		return fmt.Errorf("refusing to write Parquet to a terminal; use --output")
+	}
+	if _, err := os.Stat(dumpOutput); !toStdout && !dumpEstimate && err == nil && !dumpForce {
+		return fmt.Errorf("output file already exists: %s (use --force to overwrite)", dumpOutput)
+	}
+	if dumpServer != "" {
+		return runDumpRemote(args, format, compression, toStdout)
+	}
+
+	dbPath := serverDBPath
+	if dbPath == "" {
+		dbPath = paths.GetDatabasePath()
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		printError("Database not found at %s", dbPath)
+		fmt.Fprintf(os.Stderr, "\nIngest the database first:\n")
+		fmt.Fprintf(os.Stderr, "  srake ingest --auto\n")
+		return fmt.Errorf("database not found")
+	}
+	var db *database.DB
+	var err error
+	if dryRun {
+		db, err = openPlanDatabase(dbPath)
+	} else {
+		db, err = database.Initialize(dbPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := includeArchivedRuns(cmd, db); err != nil {
+		return err
+	}
+
+	// The guardrails are checked before anything is written
+	if !dryRun && !dumpEstimate && len(args) == 0 {
+		table := dumpTable
+		if dumpJoined {
+			table = "runs"
+		}
+		if err := checkDumpCost(db, table); err != nil {
+			return err
+		}
+	}
+
+	var joined export.JoinedOptions
+	if dumpJoined {
+		joined = export.JoinedOptions{Columns: dumpColumns, Limit: dumpLimit, Inherit: dumpInherit}
+		if len(dumpColumns) == 0 && dumpAttributes > 0 {
+			tags, err := db.ListAttributeTags("", dumpAttributes)
+			if err != nil {
+				return fmt.Errorf("failed to list sample attributes: %v", err)
+			}
+			for _, t := range tags {
+				joined.Attributes = append(joined.Attributes, t.Tag)
+			}
+		}
+
+		// The estimate is shown before a file is written, and on its own
+		// with --estimate
+		if !dryRun && (dumpEstimate || (!toStdout && !quiet)) {
+			estimate, err := export.EstimateJoined(context.Background(), db.DB, joined, format, compression)
+			if err != nil {
+				return fmt.Errorf("failed to estimate export: %v", err)
+			}
+			sizeMB := float64(estimate.Bytes) / (1024 * 1024)
+			if dumpEstimate {
+				fmt.Printf("Rows:    %d\n", estimate.Rows)
+				fmt.Printf("Columns: %d\n", estimate.Columns)
+				fmt.Printf("Size:    about %.2f MB as %s\n", sizeMB, format)
+				return nil
+			}
+			printInfo("Exporting %d rows of %d columns, about %.2f MB", estimate.Rows, estimate.Columns, sizeMB)
+		}
+	}
+
+	if dryRun {
+		output, query := dumpOutput, ""
+		if toStdout {
+			output = ""
+		}
+		if len(args) > 0 {
+			query = args[0]
+		}
+		var joinedPlan *export.JoinedOptions
+		if dumpJoined {
+			joinedPlan = &joined
+		}
+		p, err := planDump(context.Background(), db, dbPath, output, query, format, compression, joinedPlan)
+		if err != nil {
+			return err
+		}
+		return writePlan(p)
+	}
+
+	opts := export.DumpOptions{Table: dumpTable, Columns: dumpColumns, Limit: dumpLimit}
+	if len(args) > 0 {
+		opts.Accessions, err = dumpSearchHits(args[0], dumpTable, dumpLimit)
+		if err != nil {
+			return err
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if !toStdout {
+		file, err := os.Create(dumpOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	open := func(columns []export.Column) (export.RowWriter, error) {
+		return export.NewRowWriter(out, format, compression, columns)
+	}
+	var count int64
+	source := dumpTable
+	if dumpJoined {
+		source = "runs joined to samples and studies"
+		count, err = export.DumpJoined(context.Background(), db.DB, joined, open)
+	} else {
+		count, err = export.DumpTable(context.Background(), db.DB, opts, open)
+	}
+	if err != nil {
+		if !toStdout {
+			os.Remove(dumpOutput)
+		}
+		return fmt.Errorf("export failed: %v", err)
+	}
+
+	if !toStdout && !quiet {
+		printSuccess("Exported %d rows from %s to %s", count, source, dumpOutput)
+	}
+	return nil
+}
+
+// runDumpRemote exports the records matching a query from the server named
+// by --server
+func runDumpRemote(args []string, format, compression string, toStdout bool) error {
+	if len(args) == 0 || dumpJoined || dryRun {
+		return fmt.Errorf("--server exports the records matching a query; it cannot be combined with --joined or --dry-run")
+	}
+	if format != export.FormatJSONL {
+		return fmt.Errorf("--server exports JSON lines; use a .jsonl or .jsonl.gz output")
+	}
+	docType, ok := dumpTypes[dumpTable]
+	if !ok {
+		return fmt.Errorf("search results can only be exported from studies, experiments, samples or runs")
+	}
+	req := &service.ExportRequest{
+		Query:   args[0],
+		Filters: map[string]string{"type": docType},
+		Format:  export.FormatJSONL,
+		Limit:   dumpLimit,
+		Fields:  dumpColumns,
+	}
+	apiKey := dumpAPIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("SRAKE_API_KEY")
+	}
+
+	var out io.Writer = os.Stdout
+	if !toStdout {
+		file, err := os.Create(dumpOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	count, err := dumpRemote(context.Background(), dumpServer, apiKey, req, compression, out)
+	if err != nil {
+		if !toStdout {
+			os.Remove(dumpOutput)
+		}
+		return fmt.Errorf("export failed: %v", err)
+	}
+	if !toStdout && !quiet {
+		printSuccess("Exported %d records from %s to %s", count, dumpServer, dumpOutput)
+	}
+	return nil
+}
+
+// checkDumpCost applies the guardrails to an export of a whole table, or
+// of the runs joined to their records, from the size of the table
+func checkDumpCost(db *database.DB, table string) error {
+	if _, err := export.TableColumns(db.DB, table); err != nil {
+		return err
+	}
+	rows, err := db.EstimateTableRows(context.Background(), table)
+	if err != nil {
+		return fmt.Errorf("failed to estimate export: %v", err)
+	}
+	if dumpLimit > 0 {
+		rows = min(rows, int64(dumpLimit))
+	}
+	return checkQueryCost("This export", rows, dumpForce)
+}
+
+// dumpSearchHits returns the accessions of the records of a table that
+// match a query, best first
+func dumpSearchHits(query, table string, limit int) ([]string, error) {
+	docType, ok := dumpTypes[table]
+	if !ok {
+		return nil, fmt.Errorf("search results can only be exported from studies, experiments, samples or runs")
+	}
+	if limit <= 0 {
+		limit = dumpSearchLimit
+	}
+
+	indexPath := paths.GetIndexPath()
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		printError("Search index not found at %s", indexPath)
+		fmt.Fprintf(os.Stderr, "\nPlease build the search index first:\n")
+		fmt.Fprintf(os.Stderr, "  srake search index --build\n")
+		return nil, fmt.Errorf("index not found")
+	}
+	idx, err := search.InitBleveIndex(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index: %v", err)
+	}
+	defer idx.Close()
+
+	if docs, err := idx.GetDocCount(); err == nil {
+		if err := checkQueryCost("This export", min(int64(docs), int64(limit)), dumpForce); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := idx.SearchWithFilters(query, map[string]string{"type": docType}, limit)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %v", err)
+	}
+	accessions := make([]string, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		accessions = append(accessions, hit.ID)
+	}
+	return accessions, nil
+}
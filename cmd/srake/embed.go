@@ -1,11 +1,180 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/embeddings"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/search"
+	"github.com/nishad/srake/internal/ui"
 	"github.com/spf13/cobra"
 )
 
 var embedCmd = &cobra.Command{
 	Use:   "embed",
 	Short: "Manage embeddings",
-	Long:  `Generate and manage embeddings for SRA metadata.`,
+	Long: `Generate and manage embeddings for SRA metadata.
+
+Study embeddings are stored in the database by model, with a hash of the
+title, abstract and type they were made from. Without flags, lists the
+models embeddings are stored for. --update embeds only the studies that
+have no embedding of the model yet or whose text changed, and rewrites the
+study vector index searched by --search-mode vector.`,
+	Example: `  srake embed
+  srake embed --update
+  srake embed --update --model Xenova/SapBERT-from-PubMedBERT-fulltext
+  srake embed --drop old-model`,
+	Args: cobra.NoArgs,
+	RunE: runEmbed,
+}
+
+var (
+	embedUpdate    bool
+	embedModel     string
+	embedBatchSize int
+	embedDrop      string
+	embedWait      bool
+	embedJSON      bool
+)
+
+func init() {
+	embedCmd.Flags().BoolVar(&embedUpdate, "update", false, "Embed the studies that are new or changed since their stored embeddings were made")
+	embedCmd.Flags().StringVar(&embedModel, "model", "", "Embedding model (default: the one set with 'srake models use')")
+	embedCmd.Flags().IntVar(&embedBatchSize, "batch-size", 512, "Studies embedded and stored per batch")
+	embedCmd.Flags().StringVar(&embedDrop, "drop", "", "Remove the stored embeddings of a model")
+	embedCmd.Flags().BoolVar(&embedWait, "wait", false, "Wait for another process writing the database to finish instead of failing")
+	embedCmd.Flags().BoolVar(&embedJSON, "json", false, "Output as JSON")
+}
+
+func runEmbed(cmd *cobra.Command, args []string) error {
+	if embedUpdate && embedDrop != "" {
+		return fmt.Errorf("--update and --drop cannot be combined")
+	}
+	if embedModel == "" {
+		embedModel = defaultEmbeddingModel()
+	}
+
+	dbPath := paths.GetDatabasePath()
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("database not found at %s\nPlease run 'srake ingest' first", dbPath)
+	}
+	if embedUpdate || embedDrop != "" {
+		lock, err := acquireLock(dbPath, "srake embed", embedWait)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch {
+	case embedUpdate:
+		return runEmbedUpdate(db)
+	case embedDrop != "":
+		removed, err := db.DeleteEmbeddings(embedDrop, nil)
+		if err != nil {
+			return fmt.Errorf("failed to remove embeddings: %v", err)
+		}
+		if removed == 0 {
+			return fmt.Errorf("no embeddings stored for model %s", embedDrop)
+		}
+		printSuccess("Removed %d embeddings of %s", removed, embedDrop)
+		return nil
+	}
+
+	models, err := db.ListEmbeddingModels()
+	if err != nil {
+		return fmt.Errorf("failed to list embeddings: %v", err)
+	}
+	if embedJSON {
+		if models == nil {
+			models = []database.EmbeddingModel{}
+		}
+		return printJSON(models)
+	}
+	if len(models) == 0 {
+		printInfo("No embeddings stored; create them with 'srake embed --update'")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tSTUDIES\tDIMS")
+	for _, m := range models {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", m.Model, m.Count, m.Dims)
+	}
+	return w.Flush()
+}
+
+// runEmbedUpdate embeds the new and changed studies with --model and
+// rewrites the study vector index from the stored embeddings
+func runEmbedUpdate(db *database.DB) error {
+	cfg := config.DefaultConfig()
+	if layered, _, err := config.LoadLayered(); err == nil {
+		cfg = layered
+	}
+	cfg.Embeddings.Enabled = true
+	cfg.Embeddings.DefaultModel = embedModel
+	cfg.Embeddings.ModelsDirectory = paths.GetModelsPath()
+
+	embedder, err := embeddings.NewSearchEmbedder(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize embedder: %v", err)
+	}
+	defer embedder.Close()
+	if !embedder.IsEnabled() {
+		return fmt.Errorf("model %s is not available\nDownload it with 'srake models download %s'", embedModel, embedModel)
+	}
+
+	var spinner *ui.Spinner
+	if !quiet && !embedJSON {
+		spinner = ui.NewSpinner("Finding studies to embed")
+		spinner.Start()
+	}
+	progress := func(done, total int) {
+		if spinner != nil {
+			spinner.Update(fmt.Sprintf("Embedded %d of %d studies", done, total))
+		}
+	}
+	update, err := search.UpdateStudyEmbeddings(context.Background(), db, embedder, embedModel, embedBatchSize, progress)
+	if spinner != nil {
+		spinner.Stop("")
+	}
+	if errors.Is(err, database.ErrEmbeddingDims) {
+		return fmt.Errorf("%v\nThe model's stored embeddings were made by a model of another dimension; remove them with 'srake embed --drop %s'", err, embedModel)
+	}
+	if err != nil {
+		return err
+	}
+
+	vectors, err := search.LoadStudyVectors(db, embedModel, cfg.Vectors.UseQuantized)
+	if err != nil {
+		return err
+	}
+	path := search.VectorIndexPath(paths.GetEmbeddingsPath())
+	if vectors.Len() > 0 {
+		if err := vectors.Save(path); err != nil {
+			return fmt.Errorf("failed to save study embeddings: %v", err)
+		}
+	}
+
+	if embedJSON {
+		return printJSON(update)
+	}
+	if !quiet {
+		printSuccess("Embedded %d new or changed studies with %s", update.Embedded, embedModel)
+		fmt.Printf("Unchanged: %d\n", update.Unchanged)
+		fmt.Printf("Removed:   %d\n", update.Removed)
+		fmt.Printf("Vectors:   %d in %s\n", vectors.Len(), path)
+	}
+	return nil
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/spf13/cobra"
+)
+
+// runInfoSource names NCBI's SRA run info as the source of enriched values
+const runInfoSource = "ncbi-runinfo"
+
+var metadataEnrichCmd = &cobra.Command{
+	Use:   "enrich [accessions...]",
+	Short: "Fill in missing run statistics from NCBI",
+	Long: `Fetch the SRA run info of the given accessions from NCBI E-utilities and
+fill in the spot and base counts, size and release dates their runs are
+missing, which the metadata dumps often leave out. Studies, experiments and
+samples enrich every run of theirs. With --missing, the runs of the database
+without spot or base counts are enriched, up to --limit of them.
+
+Values the database already has are kept. Each enriched run records in its
+metadata JSON, under "enrichment", the fields filled in, their source and
+when they were filled in.
+
+Requests are spaced to NCBI's rate limit of 3 a second, or 10 with an API
+key in NCBI_API_KEY; --rate lowers it further.`,
+	Example: `  srake metadata enrich SRR390728
+  srake metadata enrich SRP012345 --json
+  srake metadata enrich --missing --limit 5000 --rate 1`,
+	RunE: runMetadataEnrich,
+}
+
+var (
+	enrichMissing bool
+	enrichLimit   int
+	enrichRate    float64
+	enrichJSON    bool
+)
+
+func init() {
+	metadataEnrichCmd.Flags().BoolVar(&enrichMissing, "missing", false, "Enrich the runs of the database without spot or base counts")
+	metadataEnrichCmd.Flags().IntVar(&enrichLimit, "limit", 1000, "Most runs --missing enriches")
+	metadataEnrichCmd.Flags().Float64Var(&enrichRate, "rate", 0, "Most requests a second to NCBI (default: 3, or 10 with NCBI_API_KEY)")
+	metadataEnrichCmd.Flags().BoolVar(&enrichJSON, "json", false, "Output as JSON")
+
+	metadataCmd.AddCommand(metadataEnrichCmd)
+}
+
+// enrichedRun is a run fetched from NCBI and the fields it filled in
+type enrichedRun struct {
+	downloader.RunInfo
+	Filled     []string `json:"filled"`
+	InDatabase bool     `json:"in_database"`
+}
+
+func runMetadataEnrich(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && !enrichMissing {
+		return fmt.Errorf("give the accessions to enrich, or --missing")
+	}
+	if enrichRate < 0 {
+		return fmt.Errorf("--rate must be positive")
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	accessions := resolveInternalIDs(db, args)
+	if enrichMissing {
+		runs, err := db.RunsMissingStats(enrichLimit)
+		if err != nil {
+			return fmt.Errorf("failed to find runs missing statistics: %v", err)
+		}
+		accessions = append(accessions, runs...)
+	}
+	if len(accessions) == 0 {
+		printSuccess("No runs are missing statistics")
+		return nil
+	}
+
+	feed := downloader.NewEntrezFeed()
+	feed.Rate = enrichRate
+	if !enrichJSON {
+		printInfo("Fetching run info of %d accessions from NCBI...", len(accessions))
+	}
+	infos, err := feed.RunInfo(cmd.Context(), accessions)
+	if err != nil {
+		return fmt.Errorf("failed to fetch run info: %v", err)
+	}
+
+	results := make([]enrichedRun, 0, len(infos))
+	enriched, absent := 0, 0
+	for _, info := range infos {
+		filled, err := db.EnrichRun(database.RunEnrichment{
+			RunAccession: info.Run,
+			TotalSpots:   info.Spots,
+			TotalBases:   info.Bases,
+			SizeMB:       info.SizeMB,
+			Published:    info.ReleaseDate,
+			Source:       runInfoSource,
+		})
+		result := enrichedRun{RunInfo: info, Filled: filled, InDatabase: true}
+		switch {
+		case errors.Is(err, database.ErrRunNotFound):
+			result.InDatabase = false
+			absent++
+		case err != nil:
+			return fmt.Errorf("failed to enrich %s: %v", info.Run, err)
+		case len(filled) > 0:
+			enriched++
+		}
+		if result.Filled == nil {
+			result.Filled = []string{}
+		}
+		results = append(results, result)
+	}
+
+	if enrichJSON {
+		return printJSON(results)
+	}
+	if enriched > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\t%s\n", colorize(colorBold, "RUN"), colorize(colorBold, "FILLED IN"))
+		for _, r := range results {
+			if len(r.Filled) > 0 {
+				fmt.Fprintf(w, "%s\t%s\n", colorize(colorCyan, r.Run), strings.Join(r.Filled, ", "))
+			}
+		}
+		w.Flush()
+		fmt.Println()
+	}
+	printSuccess("Enriched %d of %d runs found at NCBI", enriched, len(infos))
+	if absent > 0 {
+		printInfo("%d runs found at NCBI are not in the database; ingest them to enrich them", absent)
+	}
+	if len(infos) == 0 {
+		printWarning("NCBI found no runs for the given accessions")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nishad/srake/internal/examples"
+	"github.com/spf13/cobra"
+)
+
+var examplesCmd = &cobra.Command{
+	Use:   "examples [topic]",
+	Short: "Show runnable command recipes for common workflows",
+	Long: `Show step-by-step command recipes for common workflows.
+
+Without a topic, lists the topics. With one, prints its recipes as a shell
+script: explanations are comments, so the output can be copied into a
+terminal or saved and edited.`,
+	Example: `  srake examples
+  srake examples search
+  srake examples ingest > update.sh`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: examples.Names(),
+	RunE:      runExamples,
+}
+
+func runExamples(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		fmt.Println(colorize(colorBold, "Topics:"))
+		for _, t := range examples.Topics {
+			fmt.Printf("  %-10s %s\n", colorize(colorCyan, t.Name), t.Summary)
+		}
+		fmt.Println("\nRun 'srake examples <topic>' to show its recipes.")
+		return nil
+	}
+
+	topic, ok := examples.Lookup(args[0])
+	if !ok {
+		return fmt.Errorf("unknown topic %q (choose from %s)", args[0], strings.Join(examples.Names(), ", "))
+	}
+	examples.Render(os.Stdout, topic)
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nishad/srake/internal/examples"
+)
+
+// TestExamplesMatchCommands parses every srake command in the recipes of
+// 'srake examples' against the command tree, so recipes cannot name
+// commands, flags or argument counts that no longer exist.
+func TestExamplesMatchCommands(t *testing.T) {
+	for _, topic := range examples.Topics {
+		for _, ex := range topic.Examples {
+			for _, line := range ex.Commands {
+				commands, err := examples.SrakeArgs(line)
+				if err != nil {
+					t.Errorf("%s / %s: %v", topic.Name, ex.Title, err)
+					continue
+				}
+				for _, args := range commands {
+					cmd, rest, err := rootCmd.Find(args)
+					if err != nil || cmd == rootCmd {
+						t.Errorf("%s / %s: no command for %q", topic.Name, ex.Title, line)
+						continue
+					}
+					if err := cmd.ParseFlags(rest); err != nil {
+						t.Errorf("%s / %s: %q: %v", topic.Name, ex.Title, line, err)
+						continue
+					}
+					if err := cmd.ValidateArgs(cmd.Flags().Args()); err != nil {
+						t.Errorf("%s / %s: %q: %v", topic.Name, ex.Title, line, err)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/spf13/cobra"
+)
+
+var expectCmd = &cobra.Command{
+	Use:   "expect",
+	Short: "Track when expected submissions go public",
+	Long: `Register the accessions or aliases of submissions that are not public yet,
+and see when their records appear.
+
+After each ingest, srake reports the expected records that have now appeared,
+with the accession each was found under, and how many are still pending.`,
+	Example: `  # Register the samples of a sample sheet
+  srake expect import samples.tsv
+
+  # See which are public and which are still pending
+  srake expect status
+  srake expect status --pending`,
+}
+
+var expectImportCmd = &cobra.Command{
+	Use:   "import <file.tsv>",
+	Short: "Import expected accessions and aliases from a TSV file",
+	Long: `Import expected records from a tab-separated file with an accession or alias
+in the first column and an optional label, such as a sample description, in
+the second. Further columns are ignored, as are blank lines and lines
+starting with #. A first line whose first column is accession, alias,
+sample_alias or sample_name is taken as a header.
+
+An accession appears once a record with it is ingested; an alias, once a
+record with it as an identifier is, the sample preferred over its
+experiment and runs. Records already public are reported at once.
+
+Expectations are recorded under a source, the file name unless --source is
+given; with --replace, those imported before from the same source are
+deleted. Importing an expected record again keeps whether it appeared.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExpectImport,
+}
+
+var expectStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List expected records and whether they appeared",
+	Args:  cobra.NoArgs,
+	RunE:  runExpectStatus,
+}
+
+var expectRemoveCmd = &cobra.Command{
+	Use:   "remove <source>",
+	Short: "Delete the expected records imported from a source",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runExpectRemove,
+}
+
+var (
+	expectSource  string
+	expectReplace bool
+	expectPending bool
+	expectJSON    bool
+)
+
+// expectHeaders are the first columns of a header line
+var expectHeaders = map[string]bool{
+	"accession":    true,
+	"alias":        true,
+	"sample_alias": true,
+	"sample_name":  true,
+}
+
+func init() {
+	expectImportCmd.Flags().StringVar(&expectSource, "source", "", "Name to record the expectations under (default: the file name)")
+	expectImportCmd.Flags().BoolVar(&expectReplace, "replace", false, "Delete the expectations imported before from the same source")
+	expectStatusCmd.Flags().StringVar(&expectSource, "source", "", "Only list the expectations of this source")
+	expectStatusCmd.Flags().BoolVar(&expectPending, "pending", false, "Only list the records that have not appeared")
+	expectStatusCmd.Flags().BoolVar(&expectJSON, "json", false, "Output as JSON")
+
+	expectCmd.AddCommand(expectImportCmd, expectStatusCmd, expectRemoveCmd)
+}
+
+func runExpectImport(cmd *cobra.Command, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open expectation file: %v", err)
+	}
+	defer f.Close()
+
+	expectations, err := parseExpectations(f)
+	if err != nil {
+		return err
+	}
+	if len(expectations) == 0 {
+		return fmt.Errorf("no expected records found in %s", args[0])
+	}
+
+	source := expectSource
+	if source == "" {
+		source = filepath.Base(args[0])
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	stored, err := db.ImportExpectations(source, expectations, expectReplace)
+	if err != nil {
+		return fmt.Errorf("failed to import expectations: %v", err)
+	}
+	appeared, err := db.ReconcileExpectations()
+	if err != nil {
+		return fmt.Errorf("failed to reconcile expectations: %v", err)
+	}
+	if quiet {
+		return nil
+	}
+	printSuccess("Imported %d expected records from %s", stored, source)
+	if len(appeared) > 0 {
+		printInfo("%d already public:", len(appeared))
+		for _, e := range appeared {
+			fmt.Printf("  %s → %s (%s)\n", e.Expected, colorize(colorCyan, e.Accession), e.RecordType)
+		}
+	}
+	return nil
+}
+
+// parseExpectations reads expected accessions or aliases, with optional
+// labels, from a TSV file
+func parseExpectations(r io.Reader) ([]database.Expectation, error) {
+	var expectations []database.Expectation
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		columns := strings.Split(line, "\t")
+		expected := strings.TrimSpace(columns[0])
+		if first && expectHeaders[strings.ToLower(expected)] {
+			first = false
+			continue
+		}
+		first = false
+		if expected == "" {
+			continue
+		}
+		if detectAccessionType(expected) != "unknown" {
+			expected = strings.ToUpper(expected)
+		}
+		e := database.Expectation{Expected: expected}
+		if len(columns) > 1 {
+			e.Label = strings.TrimSpace(columns[1])
+		}
+		expectations = append(expectations, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read expectation file: %v", err)
+	}
+	return expectations, nil
+}
+
+func runExpectStatus(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	expectations, err := db.ListExpectations(expectSource, expectPending)
+	if err != nil {
+		return fmt.Errorf("failed to list expectations: %v", err)
+	}
+	if expectJSON {
+		if expectations == nil {
+			expectations = []database.Expectation{}
+		}
+		return printJSON(expectations)
+	}
+	if len(expectations) == 0 {
+		if expectPending {
+			printInfo("No expected records pending")
+		} else {
+			printInfo("No expected records imported (import them with 'srake expect import')")
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", colorize(colorBold, "EXPECTED"), colorize(colorBold, "LABEL"),
+		colorize(colorBold, "STATUS"), colorize(colorBold, "ACCESSION"), colorize(colorBold, "SOURCE"))
+	var public int
+	for _, e := range expectations {
+		status, accession := colorize(colorYellow, "pending"), "-"
+		if e.AppearedAt != nil {
+			public++
+			status = colorize(colorCyan, "public "+e.AppearedAt.Local().Format("2006-01-02"))
+			accession = e.Accession
+		}
+		label := e.Label
+		if label == "" {
+			label = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Expected, label, status, accession, e.Source)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("\n%d public, %d pending\n", public, len(expectations)-public)
+	}
+	return nil
+}
+
+func runExpectRemove(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	deleted, err := db.DeleteExpectations(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to delete expectations: %v", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("no expected records imported from %s", args[0])
+	}
+	if !quiet {
+		printSuccess("Deleted %d expected records from %s", deleted, args[0])
+	}
+	return nil
+}
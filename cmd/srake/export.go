@@ -73,6 +73,11 @@ func runExport(cmd *cobra.Command, args []string) error {
 	if exportFTSVersion != 3 && exportFTSVersion != 5 {
 		return fmt.Errorf("invalid FTS version: %d (must be 3 or 5)", exportFTSVersion)
 	}
+	if dryRun {
+		if err := checkPlanFormat(); err != nil {
+			return err
+		}
+	}
 
 	// Get source database path
 	srcDBPath := exportDBPath
@@ -107,6 +112,15 @@ func runExport(cmd *cobra.Command, args []string) error {
 		outputPath += ".gz"
 	}
 
+	if dryRun {
+		db, err := openPlanDatabase(srcDBPath)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+		return writePlan(planExport(db, srcDBPath, outputPath))
+	}
+
 	// Create exporter
 	cfg := &export.Config{
 		SourceDB:     srcDBPath,
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nishad/srake/internal/compat"
+	"github.com/nishad/srake/internal/export"
+	"github.com/nishad/srake/internal/service"
+	"github.com/nishad/srake/internal/wire"
+)
+
+// dumpRemote exports the records of a server matching a query to out as
+// JSON lines. They are pulled in the compact wire format, gzip-compressed,
+// and decoded one record at a time, so memory use does not grow with the
+// export; servers without it send JSON lines, which are copied as they
+// arrive. It returns the number of records written.
+func dumpRemote(ctx context.Context, baseURL, apiKey string, req *service.ExportRequest, compression string, out io.Writer) (int64, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+	post := func(path string) (*http.Response, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", wire.ContentType+", application/x-ndjson;q=0.5")
+		httpReq.Header.Set(compat.HeaderSchemaVersion, strconv.Itoa(compat.SchemaVersion))
+		if apiKey != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		// The transport asks for gzip and decompresses the response itself
+		return http.DefaultClient.Do(httpReq)
+	}
+
+	// Servers released before v2 of the API only serve v1
+	resp, err := post("/api/v2/export")
+	if err == nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		resp, err = post("/api/v1/export")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot reach server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if json.Unmarshal(data, &e) == nil && e.Message != "" {
+			return 0, fmt.Errorf("server returned %s: %s", resp.Status, e.Message)
+		}
+		return 0, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	var zw *gzip.Writer
+	if compression == export.CompressGzip {
+		zw = gzip.NewWriter(out)
+		out = zw
+	}
+	w := bufio.NewWriter(out)
+
+	var count int64
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if wire.Accepts(mediaType) {
+		dec := wire.NewDecoder(resp.Body)
+		enc := json.NewEncoder(w)
+		for {
+			record, err := dec.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return count, fmt.Errorf("failed to read export: %w", err)
+			}
+			if err := enc.Encode(record); err != nil {
+				return count, err
+			}
+			count++
+		}
+	} else {
+		lines := bufio.NewScanner(resp.Body)
+		lines.Buffer(make([]byte, 64*1024), 64<<20)
+		for lines.Scan() {
+			w.Write(lines.Bytes())
+			if err := w.WriteByte('\n'); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err := lines.Err(); err != nil {
+			return count, fmt.Errorf("failed to read export: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return count, err
+	}
+	if zw != nil {
+		return count, zw.Close()
+	}
+	return count, nil
+}
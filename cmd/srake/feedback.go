@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var feedbackCmd = &cobra.Command{
+	Use:   "feedback",
+	Short: "Record search relevance judgments",
+	Long: `Record whether records are relevant to a search query.
+
+Judgments are stored in the local database and can later be used to evaluate
+and tune search ranking. Queries are normalized (lowercased, whitespace
+collapsed) so judgments for the same query are grouped together.`,
+	Example: `  # Mark results as relevant or irrelevant for a query
+  srake feedback --query "liver cancer" --relevant SRP000001,SRP000002 --irrelevant SRP000003
+
+  # Show recorded judgments
+  srake feedback --list
+  srake feedback --list --query "liver cancer" --format json`,
+	Args: cobra.NoArgs,
+	RunE: runFeedback,
+}
+
+var (
+	feedbackQuery      string
+	feedbackRelevant   []string
+	feedbackIrrelevant []string
+	feedbackList       bool
+	feedbackLimit      int
+	feedbackFormat     string
+)
+
+func init() {
+	feedbackCmd.Flags().StringVar(&feedbackQuery, "query", "", "Search query the judgments apply to")
+	feedbackCmd.Flags().StringSliceVar(&feedbackRelevant, "relevant", nil, "Accessions relevant to the query")
+	feedbackCmd.Flags().StringSliceVar(&feedbackIrrelevant, "irrelevant", nil, "Accessions not relevant to the query")
+	feedbackCmd.Flags().BoolVar(&feedbackList, "list", false, "List recorded judgments instead of recording")
+	feedbackCmd.Flags().IntVarP(&feedbackLimit, "limit", "l", 100, "Maximum judgments to list (0 for all)")
+	feedbackCmd.Flags().StringVarP(&feedbackFormat, "format", "f", "table", "Output format for --list (table|json)")
+}
+
+func runFeedback(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if feedbackList {
+		return listFeedback(db)
+	}
+
+	feedback, err := service.BuildFeedback(&service.FeedbackRequest{
+		Query:      feedbackQuery,
+		Relevant:   feedbackRelevant,
+		Irrelevant: feedbackIrrelevant,
+		Source:     "cli",
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := db.InsertFeedback(feedback); err != nil {
+		return fmt.Errorf("failed to record feedback: %v", err)
+	}
+
+	if !quiet {
+		printSuccess("Recorded %d judgments for \"%s\"", len(feedback), feedback[0].Query)
+	}
+	return nil
+}
+
+// listFeedback prints recorded judgments, optionally filtered by --query
+func listFeedback(db *database.DB) error {
+	feedback, err := db.GetFeedback(feedbackQuery, feedbackLimit)
+	if err != nil {
+		return fmt.Errorf("failed to read feedback: %v", err)
+	}
+
+	if feedbackFormat == "json" {
+		if feedback == nil {
+			feedback = []database.Feedback{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(feedback)
+	}
+
+	if len(feedback) == 0 {
+		printInfo("No feedback recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", colorize(colorBold, "QUERY"), colorize(colorBold, "ACCESSION"),
+		colorize(colorBold, "JUDGMENT"), colorize(colorBold, "SOURCE"), colorize(colorBold, "RECORDED"))
+	for _, f := range feedback {
+		judgment := colorize(colorGreen, "relevant")
+		if !f.Relevant {
+			judgment = colorize(colorRed, "irrelevant")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", truncateStr(f.Query, 40), colorize(colorCyan, f.Accession),
+			judgment, f.Source, f.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
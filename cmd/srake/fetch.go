@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	srerrors "github.com/nishad/srake/internal/errors"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch [<accession> ...]",
+	Short: "Download the sequence data of runs",
+	Long: `Download the FASTQ or SRA files of runs named by accession.
+
+Studies, experiments and samples expand to their runs through the local
+database. Each run is resolved to its data files at the source:
+  • ena:  FASTQ or SRA files listed by ENA, with sizes and MD5 checksums
+  • ncbi: SRA objects served by NCBI
+  • aws:  SRA objects in the AWS Open Data registry
+  • gcp:  SRA objects in Google Cloud public datasets
+
+Files are written to <output>/<run>/. An interrupted download is kept as a
+.part file and resumed by the next fetch, and files already downloaded are
+skipped. Files are checked against the published size and MD5 checksum;
+the aws, gcp and ncbi sources publish none.
+
+With --connections, files of 64 MB and more are split into ranges
+downloaded over parallel connections, each resumed on its own after an
+interruption. Servers that do not serve ranges are read as a single
+stream.
+
+Accession lists from 'srake search --format accession' can be read with
+--from-file (use - for stdin).`,
+	Example: `  # Paired FASTQ files of a run from ENA
+  srake fetch SRR000001
+
+  # SRA files of every run in a study from NCBI
+  srake fetch SRP123456 --source ncbi --type sra -o data/
+
+  # Runs matched by a search
+  srake search "liver AND organism:human" --format accession > runs.txt
+  srake fetch --from-file runs.txt --parallel 4`,
+	RunE: runFetch,
+}
+
+var (
+	fetchFromFile string
+	fetchType     string
+	fetchSource   string
+	fetchOutput   string
+	fetchParallel int
+	fetchConns    int
+	fetchRetry    int
+	fetchDryRun   bool
+	fetchOpen     bool
+)
+
+func init() {
+	fetchCmd.Flags().StringVarP(&fetchFromFile, "from-file", "f", "", "File of accessions, one per line (- for stdin)")
+	fetchCmd.Flags().StringVarP(&fetchType, "type", "t", "fastq", "File type (fastq|sra)")
+	fetchCmd.Flags().StringVarP(&fetchSource, "source", "s", service.ManifestSourceENA, "File source (ena|ncbi|aws|gcp)")
+	fetchCmd.Flags().StringVarP(&fetchOutput, "output", "o", ".", "Output directory")
+	fetchCmd.Flags().IntVarP(&fetchParallel, "parallel", "p", 2, "Number of files downloaded at once")
+	fetchCmd.Flags().IntVar(&fetchConns, "connections", 1, "Split each large file into this many ranges downloaded in parallel")
+	fetchCmd.Flags().IntVar(&fetchRetry, "retry", 4, "Number of retries after a network failure (overrides retry.network in the config)")
+	fetchCmd.Flags().BoolVar(&fetchDryRun, "dry-run", false, "List the files that would be downloaded")
+	fetchCmd.Flags().BoolVar(&fetchOpen, "open-access-only", false, "Leave out controlled-access runs (e.g. dbGaP)")
+}
+
+func runFetch(cmd *cobra.Command, args []string) error {
+	accessions := args
+	if fetchFromFile != "" {
+		var listed []string
+		var err error
+		if fetchFromFile == "-" {
+			listed, err = readAccessionsFromReader(os.Stdin)
+		} else {
+			listed, err = readAccessionFile(fetchFromFile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read accessions: %w", err)
+		}
+		accessions = append(accessions, listed...)
+	}
+	if len(accessions) == 0 {
+		return fmt.Errorf("provide accessions or --from-file")
+	}
+	if fetchParallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if fetchConns < 1 {
+		return fmt.Errorf("--connections must be at least 1")
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	manifest, err := service.NewManifestService(db, nil).Build(ctx, &service.ManifestRequest{
+		Accessions:     accessions,
+		FileType:       fetchType,
+		Source:         fetchSource,
+		OpenAccessOnly: fetchOpen,
+	})
+	db.Close()
+	if err != nil {
+		return err
+	}
+	if len(manifest.Excluded) > 0 {
+		printWarning("Left out %d runs that are not open access: %s", len(manifest.Excluded), formatExcludedRuns(manifest.Excluded))
+	}
+	if len(manifest.Unresolved) > 0 {
+		printWarning("%d runs have no %s files at %s: %s", len(manifest.Unresolved), fetchType, fetchSource,
+			strings.Join(manifest.Unresolved, ", "))
+	}
+	if len(manifest.Files) == 0 {
+		return fmt.Errorf("no data files found for %d runs", len(manifest.Runs))
+	}
+
+	if fetchDryRun {
+		for _, f := range manifest.Files {
+			fmt.Printf("%s\t%s\t%s\n", f.Path, sizeOrUnknown(f.Size), f.URL)
+		}
+		printInfo("Would download %d files for %d runs", len(manifest.Files), len(manifest.Runs))
+		return nil
+	}
+
+	fetcher := downloader.NewFetcher(fetchOutput)
+	fetcher.Segments = fetchConns
+	if cfg, _, err := config.LoadLayered(); err == nil {
+		fetcher.RetryPolicies = srerrors.PoliciesFromConfig(cfg.Retry)
+		if !cmd.Flags().Changed("retry") {
+			fetchRetry = max(cfg.Retry.Network.MaxAttempts-1, 0)
+		}
+	}
+	if fetcher.RetryPolicies == nil {
+		fetcher.RetryPolicies = srerrors.DefaultPolicies()
+	}
+	network := fetcher.RetryPolicies.For(srerrors.KindNetwork)
+	network.MaxAttempts = fetchRetry + 1
+	fetcher.RetryPolicies[srerrors.KindNetwork] = network
+	fetcher.OnRetry = func(err error, kind srerrors.Kind, attempt int, policy srerrors.Policy, wait time.Duration) {
+		printDebug("Fetch failed (%s error: %v); attempt %d/%d in %v", kind, err, attempt, policy.MaxAttempts, wait)
+	}
+
+	return fetchFiles(ctx, fetcher, manifest.Files)
+}
+
+// fetchFiles downloads files with --parallel workers, reporting each file
+// as it finishes
+func fetchFiles(ctx context.Context, fetcher *downloader.Fetcher, files []downloader.ManifestFile) error {
+	jobs := make(chan downloader.ManifestFile)
+	var mu sync.Mutex
+	var failed []string
+	var transferred int64
+	done, skipped := 0, 0
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(fetchParallel, len(files)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				result, err := fetcher.Fetch(ctx, f)
+
+				mu.Lock()
+				done++
+				progress := fmt.Sprintf("[%d/%d]", done, len(files))
+				switch {
+				case err != nil:
+					failed = append(failed, f.Path)
+					printError("%s %s: %v", progress, f.Path, err)
+				case result.Skipped:
+					skipped++
+					if !quiet {
+						printInfo("%s %s already downloaded", progress, f.Path)
+					}
+				default:
+					transferred += result.Bytes
+					if !quiet {
+						note := ""
+						if result.Resumed > 0 {
+							note = fmt.Sprintf(", resumed after %s", downloader.FormatSize(result.Resumed))
+						}
+						if result.Verified {
+							note += ", checksum verified"
+						}
+						printSuccess("%s %s (%s in %s%s)", progress, f.Path, downloader.FormatSize(result.Bytes),
+							downloader.FormatDuration(result.Duration), note)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !quiet {
+		printInfo("Downloaded %s in %s (%d files already present)", downloader.FormatSize(transferred),
+			downloader.FormatDuration(time.Since(start)), skipped)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d files failed: %s", len(failed), len(files), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// sizeOrUnknown formats a published file size
+func sizeOrUnknown(size int64) string {
+	if size <= 0 {
+		return "unknown size"
+	}
+	return downloader.FormatSize(size)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/processor"
+	"github.com/spf13/cobra"
+)
+
+var filterCmd = &cobra.Command{
+	Use:   "filter",
+	Short: "Evaluate ingest filter profiles",
+	Long: `Work with the YAML filter profiles used by 'srake ingest --filter-profile'.
+
+Profiles list the same criteria as the ingest filter flags, using snake_case
+keys (taxon_ids, organisms, strategies, date_from, min_reads, ...).`,
+}
+
+var filterApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Evaluate a filter profile against the local database",
+	Long: `Evaluate a filter profile against the records already in the local database
+instead of an archive, so a profile can be checked before a long ingest.
+
+The matching studies, experiments, samples, and runs are counted as they are
+streamed from the database. Unless --dry-run is given, the accessions at the
+chosen --level are written to --output and/or added to --collection.`,
+	Example: `  # Count what a profile would keep
+  srake filter apply --profile human-rnaseq.yaml --dry-run
+
+  # Save the matching runs to a file and a collection
+  srake filter apply --profile human-rnaseq.yaml --level run --output runs.txt
+  srake filter apply --profile human-rnaseq.yaml --collection human-rnaseq`,
+	Args: cobra.NoArgs,
+	RunE: runFilterApply,
+}
+
+var (
+	filterApplyProfile    string
+	filterApplyDryRun     bool
+	filterApplyLevel      string
+	filterApplyOutput     string
+	filterApplyCollection string
+	filterApplyFormat     string
+)
+
+func init() {
+	filterApplyCmd.Flags().StringVar(&filterApplyProfile, "profile", "", "Filter profile (YAML)")
+	filterApplyCmd.Flags().BoolVar(&filterApplyDryRun, "dry-run", false, "Only report match counts")
+	filterApplyCmd.Flags().StringVar(&filterApplyLevel, "level", "study", "Accession level to materialize (study|experiment|sample|run)")
+	filterApplyCmd.Flags().StringVarP(&filterApplyOutput, "output", "o", "", "Write matching accessions to a file (one per line)")
+	filterApplyCmd.Flags().StringVar(&filterApplyCollection, "collection", "", "Add matching accessions to a collection")
+	filterApplyCmd.Flags().StringVarP(&filterApplyFormat, "format", "f", "table", "Report format (table|json)")
+	filterApplyCmd.MarkFlagRequired("profile")
+
+	filterCmd.AddCommand(filterApplyCmd)
+}
+
+// filterReport summarizes a profile evaluation.
+type filterReport struct {
+	Profile      string           `json:"profile"`
+	Filters      string           `json:"filters"`
+	DryRun       bool             `json:"dry_run"`
+	Matched      map[string]int   `json:"matched"`
+	Total        map[string]int64 `json:"total"`
+	Level        string           `json:"level"`
+	Materialized int              `json:"materialized"`
+	Output       string           `json:"output,omitempty"`
+	Collection   string           `json:"collection,omitempty"`
+	ElapsedMS    int64            `json:"elapsed_ms"`
+}
+
+// filterLevelTables maps materialization levels to their tables.
+var filterLevelTables = map[string]string{
+	"study":      "studies",
+	"experiment": "experiments",
+	"sample":     "samples",
+	"run":        "runs",
+}
+
+func runFilterApply(cmd *cobra.Command, args []string) error {
+	if _, ok := filterLevelTables[filterApplyLevel]; !ok {
+		return fmt.Errorf("invalid level: %s (must be study, experiment, sample, or run)", filterApplyLevel)
+	}
+	if filterApplyFormat != "table" && filterApplyFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", filterApplyFormat)
+	}
+
+	filters, err := processor.LoadFilterProfile(filterApplyProfile)
+	if err != nil {
+		return err
+	}
+	if !filters.HasFilters() {
+		printWarning("Profile %s sets no filters; every record matches", filterApplyProfile)
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	stats, err := processor.EvaluateFilters(db, filters, nil)
+	if err != nil {
+		return err
+	}
+
+	report := &filterReport{
+		Profile: filterApplyProfile,
+		Filters: filters.String(),
+		DryRun:  filterApplyDryRun,
+		Matched: map[string]int{
+			"study":      len(stats.UniqueStudies),
+			"experiment": len(stats.UniqueExperiments),
+			"sample":     len(stats.UniqueSamples),
+			"run":        len(stats.UniqueRuns),
+		},
+		Total:     make(map[string]int64),
+		Level:     filterApplyLevel,
+		ElapsedMS: stats.ProcessingTime.Milliseconds(),
+	}
+	for level, table := range filterLevelTables {
+		count, err := db.CountTable(table)
+		if err != nil {
+			return fmt.Errorf("failed to count %s: %v", table, err)
+		}
+		report.Total[level] = count
+	}
+
+	if !filterApplyDryRun && (filterApplyOutput != "" || filterApplyCollection != "") {
+		accessions := filterLevelAccessions(stats, filterApplyLevel)
+		if err := materializeFilterMatches(db, accessions, report); err != nil {
+			return err
+		}
+	}
+
+	if filterApplyFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	printFilterReport(report)
+	return nil
+}
+
+// filterLevelAccessions returns the sorted matching accessions at a level.
+func filterLevelAccessions(stats *processor.FilterStats, level string) []string {
+	var set map[string]bool
+	switch level {
+	case "experiment":
+		set = stats.UniqueExperiments
+	case "sample":
+		set = stats.UniqueSamples
+	case "run":
+		set = stats.UniqueRuns
+	default:
+		set = stats.UniqueStudies
+	}
+
+	accessions := make([]string, 0, len(set))
+	for acc := range set {
+		accessions = append(accessions, acc)
+	}
+	sort.Strings(accessions)
+	return accessions
+}
+
+// materializeFilterMatches writes the matching accessions to the output
+// file and adds them to the collection, as requested.
+func materializeFilterMatches(db *database.DB, accessions []string, report *filterReport) error {
+	report.Materialized = len(accessions)
+
+	if filterApplyOutput != "" {
+		f, err := os.Create(filterApplyOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer f.Close()
+		for _, acc := range accessions {
+			if _, err := fmt.Fprintln(f, acc); err != nil {
+				return fmt.Errorf("failed to write output file: %v", err)
+			}
+		}
+		report.Output = filterApplyOutput
+	}
+
+	if filterApplyCollection != "" {
+		members := make([]database.CollectionMember, len(accessions))
+		for i, acc := range accessions {
+			members[i] = database.CollectionMember{Accession: acc, RecordType: filterApplyLevel}
+		}
+		if _, err := db.AddToCollection(filterApplyCollection, members); err != nil {
+			return fmt.Errorf("failed to update collection: %v", err)
+		}
+		report.Collection = filterApplyCollection
+	}
+	return nil
+}
+
+func printFilterReport(r *filterReport) {
+	if quiet {
+		return
+	}
+
+	printInfo("Profile: %s (%s)", r.Profile, r.Filters)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tMATCHED\tTOTAL")
+	for _, level := range []string{"study", "experiment", "sample", "run"} {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", level, r.Matched[level], r.Total[level])
+	}
+	w.Flush()
+
+	switch {
+	case r.Output != "" || r.Collection != "":
+		if r.Output != "" {
+			printSuccess("Wrote %d %s accessions to %s", r.Materialized, r.Level, r.Output)
+		}
+		if r.Collection != "" {
+			printSuccess("Added %d %s accessions to collection %s", r.Materialized, r.Level, r.Collection)
+		}
+	case r.DryRun:
+		printInfo("Dry run: %d %s accessions would be materialized", r.Matched[r.Level], r.Level)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nishad/srake/internal/config"
+)
+
+// checkQueryCost stops a query estimated to read more rows or documents
+// than guardrails.max_rows, unless the guardrails let --force run it. what
+// describes the query, as in "This search".
+func checkQueryCost(what string, rows int64, force bool) error {
+	cfg := config.DefaultConfig()
+	if layered, _, err := config.LoadLayered(); err == nil {
+		cfg = layered
+	}
+	guard := cfg.Guardrails
+	if guard.MaxRows <= 0 || rows <= guard.MaxRows {
+		return nil
+	}
+
+	estimate := fmt.Sprintf("%s would read about %d rows, more than guardrails.max_rows (%d)", what, rows, guard.MaxRows)
+	switch guard.Action {
+	case config.GuardrailRefuse:
+		return fmt.Errorf("%s; narrow it or lower --limit", estimate)
+	case config.GuardrailForce, "":
+		if force {
+			printWarning("%s; running it because of --force", estimate)
+			return nil
+		}
+		return fmt.Errorf("%s; narrow it, lower --limit, or run it anyway with --force", estimate)
+	default:
+		return fmt.Errorf("invalid guardrails.action: %s (must be %s or %s)", guard.Action, config.GuardrailForce, config.GuardrailRefuse)
+	}
+}
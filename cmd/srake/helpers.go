@@ -2,11 +2,15 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
 )
 
 // Color codes for terminal output
@@ -177,3 +181,56 @@ func printPhase(phase string) {
 		fmt.Printf("\n%s %s\n", colorize(colorBlue, "▶"), colorize(colorBold, phase))
 	}
 }
+
+// parseFilterFlags parses repeated field=value flags into a filter map
+func parseFilterFlags(flags []string) (map[string]string, error) {
+	filters := make(map[string]string)
+	for _, f := range flags {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid filter %q (expected field=value)", f)
+		}
+		filters[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return filters, nil
+}
+
+// formatExcludedRuns lists runs left out by --open-access-only with their
+// access level and consent group, abbreviating long lists
+func formatExcludedRuns(runs []*database.RecordAccess) string {
+	const shown = 10
+	parts := make([]string, 0, min(len(runs), shown)+1)
+	for i, r := range runs {
+		if i == shown {
+			parts = append(parts, fmt.Sprintf("and %d more", len(runs)-shown))
+			break
+		}
+		label := r.Access
+		if r.Consent != "" {
+			label += ", " + r.Consent
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s)", r.Accession, label))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// openExistingDB opens the local database for lookups that are skipped
+// without it, or returns nil when it does not exist or cannot be opened
+func openExistingDB() *database.DB {
+	dbPath := paths.GetDatabasePath()
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil
+	}
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return nil
+	}
+	return db
+}
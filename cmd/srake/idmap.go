@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/search"
+	"github.com/spf13/cobra"
+)
+
+var idmapCmd = &cobra.Command{
+	Use:   "idmap",
+	Short: "Map internal IDs to SRA accessions",
+	Long: `Map the IDs your lab uses, such as LIMS or sample sheet IDs, to SRA accessions.
+
+Once imported, internal IDs are accepted wherever an accession is: metadata,
+runs, samples, experiments and studies resolve them to their accessions,
+search replaces them with the accessions they map to, and lookup finds them
+like aliases. Search and metadata output show the internal IDs of the records
+they list.`,
+	Example: `  # Import a two-column TSV of internal IDs and accessions
+  srake idmap import lims_map.tsv
+
+  # Use internal IDs in place of accessions
+  srake metadata LIMS-2291
+  srake runs LIMS-2291
+
+  # Re-import a changed file, dropping mappings it no longer has
+  srake idmap import lims_map.tsv --replace`,
+}
+
+var idmapImportCmd = &cobra.Command{
+	Use:   "import <file.tsv>",
+	Short: "Import internal ID to accession mappings from a TSV file",
+	Long: `Import mappings from a tab-separated file with an internal ID in the first
+column and an SRA study, experiment, sample or run accession in the second.
+Further columns are ignored, as are blank lines and lines starting with #. A
+first line whose second column is not an accession is taken as a header.
+
+An internal ID may map to several accessions, such as the runs of a sample.
+Mappings are recorded under a source, the file name unless --source is given;
+with --replace, the mappings imported before from the same source are deleted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runIDMapImport,
+}
+
+var idmapListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List imported mapping sources",
+	Args:  cobra.NoArgs,
+	RunE:  runIDMapList,
+}
+
+var idmapRemoveCmd = &cobra.Command{
+	Use:   "remove <source>",
+	Short: "Delete the mappings imported from a source",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runIDMapRemove,
+}
+
+var (
+	idmapSource  string
+	idmapReplace bool
+	idmapJSON    bool
+)
+
+func init() {
+	idmapImportCmd.Flags().StringVar(&idmapSource, "source", "", "Name to record the mappings under (default: the file name)")
+	idmapImportCmd.Flags().BoolVar(&idmapReplace, "replace", false, "Delete the mappings imported before from the same source")
+	idmapListCmd.Flags().BoolVar(&idmapJSON, "json", false, "Output as JSON")
+
+	idmapCmd.AddCommand(idmapImportCmd, idmapListCmd, idmapRemoveCmd)
+}
+
+func runIDMapImport(cmd *cobra.Command, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open mapping file: %v", err)
+	}
+	defer f.Close()
+
+	mappings, skipped, err := parseIDMappings(f)
+	if err != nil {
+		return err
+	}
+	for _, line := range skipped {
+		printWarning("Skipping %s", line)
+	}
+	if len(mappings) == 0 {
+		return fmt.Errorf("no mappings found in %s", args[0])
+	}
+
+	source := idmapSource
+	if source == "" {
+		source = filepath.Base(args[0])
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	stored, err := db.ImportIDMappings(source, mappings, idmapReplace)
+	if err != nil {
+		return fmt.Errorf("failed to import mappings: %v", err)
+	}
+	if !quiet {
+		printSuccess("Imported %d mappings from %s", stored, source)
+	}
+	return nil
+}
+
+// parseIDMappings reads internal ID and accession pairs from a TSV file. It
+// returns the mappings and a description of each line it skipped.
+func parseIDMappings(r io.Reader) ([]database.IDMapping, []string, error) {
+	var mappings []database.IDMapping
+	var skipped []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		columns := strings.Split(line, "\t")
+		if len(columns) < 2 {
+			skipped = append(skipped, fmt.Sprintf("line %d: expected an internal ID and an accession separated by a tab", lineNum))
+			continue
+		}
+		internalID := strings.TrimSpace(columns[0])
+		accession := strings.ToUpper(strings.TrimSpace(columns[1]))
+		recordType := detectAccessionType(accession)
+		if recordType == "unknown" {
+			if len(mappings) == 0 && len(skipped) == 0 {
+				continue // A header
+			}
+			skipped = append(skipped, fmt.Sprintf("line %d: %s is not an SRA accession", lineNum, columns[1]))
+			continue
+		}
+		if internalID == "" {
+			skipped = append(skipped, fmt.Sprintf("line %d: missing internal ID", lineNum))
+			continue
+		}
+		mappings = append(mappings, database.IDMapping{
+			InternalID: internalID,
+			Accession:  accession,
+			RecordType: recordType,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read mapping file: %v", err)
+	}
+	return mappings, skipped, nil
+}
+
+func runIDMapList(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	sources, err := db.ListIDMappingSources()
+	if err != nil {
+		return fmt.Errorf("failed to list mappings: %v", err)
+	}
+	if idmapJSON {
+		if sources == nil {
+			sources = []database.IDMappingSource{}
+		}
+		return printJSON(sources)
+	}
+	if len(sources) == 0 {
+		printInfo("No ID mappings imported (import them with 'srake idmap import')")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\n", colorize(colorBold, "SOURCE"), colorize(colorBold, "MAPPINGS"), colorize(colorBold, "IMPORTED"))
+	for _, s := range sources {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", colorize(colorCyan, s.Source), s.Mappings, s.ImportedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+func runIDMapRemove(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	deleted, err := db.DeleteIDMappings(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to delete mappings: %v", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("no mappings imported from %s", args[0])
+	}
+	if !quiet {
+		printSuccess("Deleted %d mappings from %s", deleted, args[0])
+	}
+	return nil
+}
+
+// resolveInternalIDs replaces the arguments that are not accessions but
+// internal IDs imported with 'srake idmap import' by the accessions they
+// map to. Other arguments are kept as they are.
+func resolveInternalIDs(db *database.DB, args []string) []string {
+	var resolved []string
+	for _, arg := range args {
+		if detectAccessionType(arg) != "unknown" {
+			resolved = append(resolved, arg)
+			continue
+		}
+		mappings, err := db.ResolveInternalID(arg)
+		if err != nil || len(mappings) == 0 {
+			resolved = append(resolved, arg)
+			continue
+		}
+		for _, m := range mappings {
+			resolved = append(resolved, m.Accession)
+		}
+	}
+	return resolved
+}
+
+// resolveInternalAccession resolves an argument that must name a single
+// record: an internal ID mapped to one accession is replaced by it
+func resolveInternalAccession(db *database.DB, arg string) (string, error) {
+	if detectAccessionType(arg) != "unknown" {
+		return arg, nil
+	}
+	mappings, err := db.ResolveInternalID(arg)
+	if err != nil || len(mappings) == 0 {
+		return arg, nil
+	}
+	if len(mappings) > 1 {
+		accessions := make([]string, len(mappings))
+		for i, m := range mappings {
+			accessions[i] = m.Accession
+		}
+		return "", fmt.Errorf("%s maps to %d accessions (%s); pass one of them", arg, len(mappings), strings.Join(accessions, ", "))
+	}
+	return mappings[0].Accession, nil
+}
+
+// resolveSearchInternalIDs replaces the words of a search query that are
+// internal IDs by the accessions they map to
+func resolveSearchInternalIDs(query string) string {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return query
+	}
+	db := openExistingDB()
+	if db == nil {
+		return query
+	}
+	defer db.Close()
+
+	resolved := resolveInternalIDs(db, words)
+	if strings.Join(resolved, " ") == strings.Join(words, " ") {
+		return query
+	}
+	return strings.Join(resolved, " ")
+}
+
+// addInternalIDFields adds the internal IDs of the hits, comma-separated,
+// to their fields as internal_id
+func addInternalIDFields(result *search.BleveSearchResult) {
+	if len(result.Hits) == 0 {
+		return
+	}
+	db := openExistingDB()
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	accessions := make([]string, len(result.Hits))
+	for i, hit := range result.Hits {
+		accessions[i] = hit.ID
+	}
+	ids, err := db.InternalIDsOf(accessions)
+	if err != nil {
+		return
+	}
+	for _, hit := range result.Hits {
+		if internal, ok := ids[hit.ID]; ok {
+			if hit.Fields == nil {
+				hit.Fields = make(map[string]interface{})
+			}
+			hit.Fields["internal_id"] = strings.Join(internal, ",")
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"github.com/nishad/srake/internal/cli"
 	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/filelock"
 	"github.com/nishad/srake/internal/paths"
 	"github.com/nishad/srake/internal/search"
 	"github.com/nishad/srake/internal/search/builder"
@@ -28,7 +30,27 @@ The default tiered backend provides optimized performance:
   • Tier 2: Experiments with selective Bleve (~2M records)
   • Tier 3: Samples/Runs with SQLite FTS5 (~34M records)
   • Smart query intent detection for optimal tier routing
-  • Memory-optimized lazy index loading`,
+  • Memory-optimized lazy index loading
+
+Very large indexes, such as those including samples, can be split into
+shards (--shards) routed by accession hash. Shards are built in parallel and
+searched in parallel, with results merged on read. The shard count is fixed
+when the index is created; use --rebuild to change it.
+
+An index left unreadable, for example by an unclean shutdown, is searched
+around: 'srake search' and the server fall back to the database with a
+warning. --rebuild --only-missing moves the unreadable index, or only its
+unreadable shards, aside to <index>.corrupt-<time> and indexes again just
+the records missing from it.
+
+The optional trigram index (--trigram) covers accessions and aliases and
+speeds up 'srake metadata --partial' and 'srake raw --partial' lookups. It
+is kept current as records are ingested and deleted.
+
+The SQLite FTS5 tables for samples and runs are built along with the index,
+or on their own with --build-fts. Once built, they are kept current as
+records are ingested, and 'srake search' falls back to them when the Bleve
+index is missing.`,
 	Example: `  # Build or rebuild the search index
   srake index --build
 
@@ -44,6 +66,23 @@ The default tiered backend provides optimized performance:
   # Resume interrupted index build
   srake index --resume
 
+  # Rebuild the index split into 8 shards
+  srake index --rebuild --shards 8
+
+  # Rebuild only the missing or unreadable shards of the index
+  srake index --rebuild --only-missing
+
+  # Build trigram index for partial accession lookups
+  srake index --trigram
+
+  # Build only the FTS5 tables for sample and run search
+  srake index --build-fts
+
+Building locks the index (through <index>.lock), and --trigram and
+--build-fts lock the database, so that concurrent builds and ingests do not
+write them at once. A locked build fails with the PID of the process holding
+the lock, or waits for it with --wait.
+
   # Show index statistics
   srake index --stats
 
@@ -53,25 +92,31 @@ The default tiered backend provides optimized performance:
 }
 
 var (
-	indexBuild      bool
-	indexRebuild    bool
-	indexVerify     bool
-	indexStats      bool
-	indexBatchSize  int
-	indexWorkers    int
-	indexPath       string
-	indexBackend    string
-	indexEmbeddings bool
-	embeddingModel  string
-	indexProgress   bool
-	indexResume     bool
-	progressFile    string
-	checkpointDir   string
+	indexBuild       bool
+	indexRebuild     bool
+	indexVerify      bool
+	indexStats       bool
+	indexBatchSize   int
+	indexWorkers     int
+	indexPath        string
+	indexBackend     string
+	indexEmbeddings  bool
+	embeddingModel   string
+	indexProgress    bool
+	indexResume      bool
+	progressFile     string
+	checkpointDir    string
+	indexTrigram     bool
+	indexFTS         bool
+	indexShards      int
+	indexWait        bool
+	indexOnlyMissing bool
 )
 
 func init() {
 	indexCmd.Flags().BoolVar(&indexBuild, "build", false, "Build search index from database")
 	indexCmd.Flags().BoolVar(&indexRebuild, "rebuild", false, "Rebuild index from scratch")
+	indexCmd.Flags().BoolVar(&indexOnlyMissing, "only-missing", false, "With --rebuild, rebuild only the parts of the index that are missing or unreadable")
 	indexCmd.Flags().BoolVar(&indexVerify, "verify", false, "Verify index integrity")
 	indexCmd.Flags().BoolVar(&indexStats, "stats", false, "Show index statistics")
 	indexCmd.Flags().IntVar(&indexBatchSize, "batch-size", 500, "Batch size for indexing")
@@ -79,11 +124,15 @@ func init() {
 	indexCmd.Flags().StringVar(&indexPath, "path", "", "Custom index path")
 	indexCmd.Flags().StringVar(&indexBackend, "backend", "", "Search backend to use (tiered, bleve) - defaults to tiered")
 	indexCmd.Flags().BoolVar(&indexEmbeddings, "with-embeddings", false, "Generate vector embeddings for documents")
-	indexCmd.Flags().StringVar(&embeddingModel, "embedding-model", "Xenova/SapBERT-from-PubMedBERT-fulltext", "Model to use for embeddings")
+	indexCmd.Flags().StringVar(&embeddingModel, "embedding-model", "", "Model to use for embeddings (default: the one set with 'srake models use')")
 	indexCmd.Flags().BoolVar(&indexProgress, "progress", false, "Show real-time indexing progress")
 	indexCmd.Flags().BoolVar(&indexResume, "resume", false, "Resume interrupted index build from checkpoint")
 	indexCmd.Flags().StringVar(&progressFile, "progress-file", "", "Custom progress file path (default: .srake/index-progress.json)")
 	indexCmd.Flags().StringVar(&checkpointDir, "checkpoint-dir", "", "Custom checkpoint directory (default: .srake/checkpoints)")
+	indexCmd.Flags().IntVar(&indexShards, "shards", 0, "Number of shards for a new index (default: search.shards from config)")
+	indexCmd.Flags().BoolVar(&indexTrigram, "trigram", false, "Build trigram index over accessions and aliases for --partial lookups")
+	indexCmd.Flags().BoolVar(&indexFTS, "build-fts", false, "Build only the SQLite FTS5 tables for sample and run search")
+	indexCmd.Flags().BoolVar(&indexWait, "wait", false, "Wait for another process writing the index or database to finish instead of failing")
 
 	// Setup custom help for index command
 	cli.SetupIndexHelp(indexCmd)
@@ -93,6 +142,24 @@ func init() {
 }
 
 func runSearchIndex(cmd *cobra.Command, args []string) error {
+	if embeddingModel == "" {
+		embeddingModel = defaultEmbeddingModel()
+	}
+	if dryRun {
+		if err := checkPlanFormat(); err != nil {
+			return err
+		}
+	}
+	if indexOnlyMissing && !indexRebuild {
+		return fmt.Errorf("--only-missing needs --rebuild")
+	}
+	if indexTrigram {
+		return buildTrigramIndex()
+	}
+	if indexFTS {
+		return buildFTSTables()
+	}
+
 	// Determine action
 	if !indexBuild && !indexRebuild && !indexVerify && !indexStats && !indexResume {
 		indexStats = true // Default to showing stats
@@ -110,6 +177,11 @@ func runSearchIndex(cmd *cobra.Command, args []string) error {
 
 	cfg.Search.Enabled = true
 	cfg.Search.BatchSize = indexBatchSize
+	if indexShards > 0 {
+		cfg.Search.Shards = indexShards
+	} else if layered, _, err := config.LoadLayered(); err == nil {
+		cfg.Search.Shards = layered.Search.Shards
+	}
 
 	// Set backend if specified
 	if indexBackend != "" {
@@ -135,7 +207,7 @@ func runSearchIndex(cmd *cobra.Command, args []string) error {
 	}
 	defer sqlDB.Close()
 
-	db := &database.DB{DB: sqlDB}
+	db := database.Wrap(sqlDB)
 
 	// Handle different actions
 	if indexStats {
@@ -146,10 +218,24 @@ func runSearchIndex(cmd *cobra.Command, args []string) error {
 		return verifyIndex(cfg, db)
 	}
 
+	if dryRun {
+		return writePlan(planIndexBuild(cfg, db, dbPath, indexRebuild))
+	}
+
+	lock, err := acquireLock(cfg.Search.IndexPath, "srake index", indexWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	if indexResume {
 		return resumeIndex(cfg, db)
 	}
 
+	if indexRebuild && indexOnlyMissing {
+		return rebuildMissing(cfg, db)
+	}
+
 	if indexBuild || indexRebuild {
 		return buildIndex(cfg, db, indexRebuild)
 	}
@@ -157,6 +243,23 @@ func runSearchIndex(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// acquireLock takes the write lock on path, a database or index, waiting
+// for it when wait is set by --wait
+func acquireLock(path, command string, wait bool) (*filelock.Lock, error) {
+	lock, err := filelock.Acquire(context.Background(), path, filelock.Options{
+		Command: command,
+		Wait:    wait,
+		OnWait: func(err *filelock.LockedError) {
+			printInfo("%v; waiting for it to finish...", err)
+		},
+	})
+	var locked *filelock.LockedError
+	if errors.As(err, &locked) {
+		return nil, fmt.Errorf("%w\nRerun with --wait to start once it finishes", err)
+	}
+	return lock, err
+}
+
 func buildIndex(cfg *config.Config, db *database.DB, rebuild bool) error {
 	// Check if index exists
 	indexExists := false
@@ -170,10 +273,20 @@ func buildIndex(cfg *config.Config, db *database.DB, rebuild bool) error {
 		return nil
 	}
 
-	// Create search manager
-	manager, err := search.NewManager(cfg, db)
+	// A rebuild replaces an unreadable index, which is kept aside
+	if rebuild {
+		repair, err := search.SetAsideCorrupt(cfg.Search.IndexPath)
+		if err != nil {
+			return fmt.Errorf("failed to check index: %v", err)
+		}
+		if repair.SetAside != "" {
+			printWarning("Moved the unreadable index to %s", repair.SetAside)
+		}
+	}
+
+	manager, err := openIndexManager(cfg, db)
 	if err != nil {
-		return fmt.Errorf("failed to create search manager: %v", err)
+		return err
 	}
 	defer manager.Close()
 
@@ -187,6 +300,7 @@ func buildIndex(cfg *config.Config, db *database.DB, rebuild bool) error {
 	if err != nil {
 		return fmt.Errorf("failed to create syncer: %v", err)
 	}
+	syncer.IndexLocked = true // taken by runSearchIndex
 
 	// Show progress
 	if !quiet {
@@ -231,6 +345,145 @@ func buildIndex(cfg *config.Config, db *database.DB, rebuild bool) error {
 	return nil
 }
 
+// rebuildMissing indexes again only the records missing from the index:
+// those of shards that were never built or cannot be opened, which are set
+// aside first, or all of them when an unsharded index is unreadable
+func rebuildMissing(cfg *config.Config, db *database.DB) error {
+	repair, err := search.SetAsideCorrupt(cfg.Search.IndexPath)
+	if err != nil {
+		return fmt.Errorf("failed to check index: %v", err)
+	}
+	if repair.SetAside != "" {
+		printWarning("Moved the unreadable index files to %s", repair.SetAside)
+	}
+	if len(repair.Rebuild) == 0 {
+		printSuccess("Index at %s opens cleanly; nothing to rebuild", cfg.Search.IndexPath)
+		return nil
+	}
+	if repair.Shards == 1 {
+		return buildIndex(cfg, db, true)
+	}
+
+	manager, err := openIndexManager(cfg, db)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	syncer, err := search.NewSyncer(cfg, db, manager.GetBackend())
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %v", err)
+	}
+	syncer.IndexLocked = true // taken by runSearchIndex
+
+	if !quiet {
+		printInfo("Rebuilding %d of %d shards...", len(repair.Rebuild), repair.Shards)
+		fmt.Printf("Index path: %s\n", cfg.Search.IndexPath)
+	}
+	startTime := time.Now()
+	var indexed int64
+	syncer.OnProgress = func(n int64) { indexed = n }
+	if err := syncer.SyncShards(context.Background(), repair.Shards, repair.Rebuild); err != nil {
+		return fmt.Errorf("indexing failed: %v", err)
+	}
+
+	printSuccess("Indexed %d documents into shards %s in %v", indexed, formatShards(repair.Rebuild), time.Since(startTime).Round(time.Millisecond))
+	return nil
+}
+
+// formatShards lists shard numbers as they are named on disk
+func formatShards(shards []int) string {
+	names := make([]string, len(shards))
+	for i, shard := range shards {
+		names[i] = fmt.Sprintf("%03d", shard)
+	}
+	return strings.Join(names, ", ")
+}
+
+// openIndexManager opens the search manager that builds the index, failing
+// instead of falling back to the database when the index cannot be opened
+func openIndexManager(cfg *config.Config, db *database.DB) (*search.Manager, error) {
+	manager, err := search.NewManager(cfg, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search manager: %v", err)
+	}
+	if err := manager.Degraded(); err != nil {
+		manager.Close()
+		return nil, err
+	}
+	return manager, nil
+}
+
+// buildTrigramIndex builds the trigram accession index in the database
+func buildTrigramIndex() error {
+	dbPath := paths.GetDatabasePath()
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("database not found at %s\nPlease run 'srake ingest' first", dbPath)
+	}
+	if dryRun {
+		return writeFTSPlan(dbPath, true)
+	}
+
+	lock, err := acquireLock(dbPath, "srake index", indexWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	count, err := database.NewFTS5Manager(db).CreateTrigramTable()
+	if err != nil {
+		return fmt.Errorf("failed to build trigram index: %v", err)
+	}
+
+	printSuccess("Indexed %d accessions for partial lookup in %v", count, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// buildFTSTables builds the FTS5 tables searched by --search-mode fts5,
+// without the Bleve index
+func buildFTSTables() error {
+	dbPath := paths.GetDatabasePath()
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("database not found at %s\nPlease run 'srake ingest' first", dbPath)
+	}
+	if dryRun {
+		return writeFTSPlan(dbPath, false)
+	}
+
+	lock, err := acquireLock(dbPath, "srake index", indexWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	fts := database.NewFTS5Manager(db)
+	if err := fts.CreateFTSTables(); err != nil {
+		return fmt.Errorf("failed to build FTS5 tables: %v", err)
+	}
+	if err := fts.OptimizeFTSTables(); err != nil {
+		printWarning("Failed to optimize FTS5 tables: %v", err)
+	}
+	stats, _ := fts.GetFTSStats()
+
+	printSuccess("Indexed %d samples and %d runs for full-text search in %v",
+		stats["fts_samples"], stats["fts_runs"], time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
 func showIndexStats(cfg *config.Config, db *database.DB) error {
 	// Check if index exists
 	if _, err := os.Stat(cfg.Search.IndexPath); os.IsNotExist(err) {
@@ -241,9 +494,9 @@ func showIndexStats(cfg *config.Config, db *database.DB) error {
 	}
 
 	// Create search manager
-	manager, err := search.NewManager(cfg, db)
+	manager, err := openIndexManager(cfg, db)
 	if err != nil {
-		return fmt.Errorf("failed to create search manager: %v", err)
+		return err
 	}
 	defer manager.Close()
 
@@ -265,6 +518,13 @@ func showIndexStats(cfg *config.Config, db *database.DB) error {
 	fmt.Printf("Vectors Enabled: %v\n", stats.VectorsEnabled)
 	fmt.Printf("Index Healthy:   %v\n", stats.IsHealthy)
 
+	if sizes, err := search.ShardSizes(cfg.Search.IndexPath); err == nil && len(sizes) > 0 {
+		fmt.Printf("Shards:          %d\n", len(sizes))
+		for i, size := range sizes {
+			fmt.Printf("  shard %03d:     %.2f MB\n", i, float64(size)/(1024*1024))
+		}
+	}
+
 	// Get database counts for comparison
 	var studyCount, experimentCount, sampleCount, runCount int
 	db.DB.QueryRow("SELECT COUNT(*) FROM studies").Scan(&studyCount)
@@ -431,9 +691,9 @@ func buildWithProgress(cfg *config.Config, db *database.DB, backend search.Searc
 // resumeIndex resumes an interrupted index build from checkpoint
 func resumeIndex(cfg *config.Config, db *database.DB) error {
 	// Create search manager
-	manager, err := search.NewManager(cfg, db)
+	manager, err := openIndexManager(cfg, db)
 	if err != nil {
-		return fmt.Errorf("failed to create search manager: %v", err)
+		return err
 	}
 	defer manager.Close()
 
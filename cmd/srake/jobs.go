@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Manage background search and export jobs",
+	Long: `Queue long-running searches and exports and collect their results later.
+
+Jobs are stored in the local database and processed by the API server's job
+worker, or by 'srake jobs work'. Results are written to the jobs directory
+(SRAKE_JOBS_PATH) and kept across restarts; a job interrupted by a restart is
+queued again.`,
+	Example: `  # Queue an export and check on it
+  srake jobs submit --query "RNA-seq AND organism:human" --format csv --limit 100000
+  srake jobs status 3f9a2c1e8b7d6a54
+
+  # Download the result once completed
+  srake jobs result 3f9a2c1e8b7d6a54 -o human-rnaseq.csv
+
+  # Process queued jobs without running the API server
+  srake jobs work`,
+}
+
+var jobsSubmitCmd = &cobra.Command{
+	Use:   "submit",
+	Short: "Queue a search or export job",
+	Args:  cobra.NoArgs,
+	RunE:  runJobsSubmit,
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List jobs",
+	Args:  cobra.NoArgs,
+	RunE:  runJobsList,
+}
+
+var jobsStatusCmd = &cobra.Command{
+	Use:   "status <id>",
+	Short: "Show the status of a job",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runJobsStatus,
+}
+
+var jobsResultCmd = &cobra.Command{
+	Use:   "result <id>",
+	Short: "Write the result of a completed job",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runJobsResult,
+}
+
+var jobsCancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "Cancel a queued or running job",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runJobsCancel,
+}
+
+var jobsWorkCmd = &cobra.Command{
+	Use:   "work",
+	Short: "Process queued jobs in the foreground",
+	Long: `Process queued jobs until interrupted. Not needed while 'srake server' is
+running, since the server runs its own worker.`,
+	Args: cobra.NoArgs,
+	RunE: runJobsWork,
+}
+
+var (
+	jobsType    string
+	jobsQuery   string
+	jobsFilters []string
+	jobsFormat  string
+	jobsLimit   int
+	jobsFields  []string
+	jobsStatus  string
+	jobsOutput  string
+	jobsJSON    bool
+)
+
+func init() {
+	jobsSubmitCmd.Flags().StringVar(&jobsType, "type", "export", "Job type (export|search)")
+	jobsSubmitCmd.Flags().StringVar(&jobsQuery, "query", "", "Search query")
+	jobsSubmitCmd.Flags().StringSliceVar(&jobsFilters, "filter", nil, "Filters as field=value (repeatable)")
+	jobsSubmitCmd.Flags().StringVarP(&jobsFormat, "format", "f", "json", "Export format (json|jsonl|csv|tsv|xml)")
+	jobsSubmitCmd.Flags().IntVarP(&jobsLimit, "limit", "l", 0, "Maximum results (0 for the search default)")
+	jobsSubmitCmd.Flags().StringSliceVar(&jobsFields, "fields", nil, "Fields to include in the result")
+
+	jobsListCmd.Flags().StringVar(&jobsStatus, "status", "", "Only list jobs with this status (queued|running|completed|failed|cancelled)")
+	jobsListCmd.Flags().IntVarP(&jobsLimit, "limit", "l", 20, "Maximum jobs to list (0 for all)")
+
+	jobsResultCmd.Flags().StringVarP(&jobsOutput, "output", "o", "", "Output file (default: stdout)")
+
+	for _, cmd := range []*cobra.Command{jobsSubmitCmd, jobsListCmd, jobsStatusCmd, jobsCancelCmd} {
+		cmd.Flags().BoolVar(&jobsJSON, "json", false, "Output as JSON")
+	}
+
+	jobsCmd.AddCommand(jobsSubmitCmd, jobsListCmd, jobsStatusCmd, jobsResultCmd, jobsCancelCmd, jobsWorkCmd)
+}
+
+// openJobService opens the local database and a job service without search
+// capabilities, which is enough to submit and inspect jobs.
+func openJobService() (*database.DB, *service.JobService, error) {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return db, service.NewJobService(db, nil, nil, paths.GetJobsPath()), nil
+}
+
+func runJobsSubmit(cmd *cobra.Command, args []string) error {
+	filters, err := parseFilterFlags(jobsFilters)
+	if err != nil {
+		return err
+	}
+
+	db, jobs, err := openJobService()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	job, err := jobs.Submit(context.Background(), &service.JobRequest{
+		Type:    jobsType,
+		Query:   jobsQuery,
+		Filters: filters,
+		Format:  jobsFormat,
+		Limit:   jobsLimit,
+		Fields:  jobsFields,
+	})
+	if err != nil {
+		return err
+	}
+
+	if jobsJSON {
+		return printJSON(job)
+	}
+	if quiet {
+		fmt.Println(job.ID)
+		return nil
+	}
+	printSuccess("Queued %s job %s", job.Kind, job.ID)
+	printInfo("Check progress with 'srake jobs status %s'", job.ID)
+	return nil
+}
+
+func runJobsList(cmd *cobra.Command, args []string) error {
+	db, jobs, err := openJobService()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	list, err := jobs.List(context.Background(), jobsStatus, jobsLimit)
+	if err != nil {
+		return fmt.Errorf("failed to list jobs: %v", err)
+	}
+
+	if jobsJSON {
+		return printJSON(list)
+	}
+	if len(list) == 0 {
+		printInfo("No jobs")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tSTATUS\tCREATED\tSIZE")
+	for _, job := range list {
+		size := ""
+		if job.Status == database.JobCompleted {
+			size = downloader.FormatSize(job.ResultSize)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.ID, job.Kind, colorizeJobStatus(job.Status),
+			job.CreatedAt.Local().Format("2006-01-02 15:04:05"), size)
+	}
+	return w.Flush()
+}
+
+func runJobsStatus(cmd *cobra.Command, args []string) error {
+	db, jobs, err := openJobService()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	job, err := jobs.Get(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if jobsJSON {
+		return printJSON(job)
+	}
+
+	fmt.Printf("%s %s\n", colorize(colorBold, "Job:"), job.ID)
+	fmt.Printf("%s %s\n", colorize(colorBold, "Type:"), job.Kind)
+	fmt.Printf("%s %s\n", colorize(colorBold, "Status:"), colorizeJobStatus(job.Status))
+	fmt.Printf("%s %s\n", colorize(colorBold, "Spec:"), job.Spec)
+	fmt.Printf("%s %s\n", colorize(colorBold, "Created:"), job.CreatedAt.Local().Format(time.RFC3339))
+	if job.StartedAt != nil {
+		fmt.Printf("%s %s\n", colorize(colorBold, "Started:"), job.StartedAt.Local().Format(time.RFC3339))
+	}
+	if job.FinishedAt != nil {
+		fmt.Printf("%s %s\n", colorize(colorBold, "Finished:"), job.FinishedAt.Local().Format(time.RFC3339))
+	}
+	if job.Error != "" {
+		fmt.Printf("%s %s\n", colorize(colorBold, "Error:"), colorize(colorRed, job.Error))
+	}
+	if job.Status == database.JobCompleted {
+		fmt.Printf("%s %s (%s)\n", colorize(colorBold, "Result:"), job.ResultPath, downloader.FormatSize(job.ResultSize))
+	}
+	return nil
+}
+
+func runJobsResult(cmd *cobra.Command, args []string) error {
+	db, jobs, err := openJobService()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	job, err := jobs.ResultPath(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(job.ResultPath)
+	if err != nil {
+		return fmt.Errorf("failed to open job result: %v", err)
+	}
+	defer in.Close()
+
+	if jobsOutput == "" {
+		_, err = io.Copy(os.Stdout, in)
+		return err
+	}
+
+	out, err := os.Create(jobsOutput)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer out.Close()
+	n, err := io.Copy(out, in)
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	if !quiet {
+		printSuccess("Wrote %s to %s", downloader.FormatSize(n), jobsOutput)
+	}
+	return nil
+}
+
+func runJobsCancel(cmd *cobra.Command, args []string) error {
+	db, jobs, err := openJobService()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	job, err := jobs.Cancel(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if jobsJSON {
+		return printJSON(job)
+	}
+	if !quiet {
+		printSuccess("Cancelled job %s", job.ID)
+	}
+	return nil
+}
+
+func runJobsWork(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	searchService, err := service.NewSearchService(db, paths.GetIndexPath())
+	if err != nil {
+		return fmt.Errorf("failed to initialize search service: %v", err)
+	}
+	defer searchService.Close()
+	exportService := service.NewExportService(db, searchService)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	jobsPath := paths.GetJobsPath()
+	printInfo("Processing jobs (results in %s); press Ctrl+C to stop", jobsPath)
+	return service.NewJobService(db, searchService, exportService, jobsPath).Run(ctx)
+}
+
+func colorizeJobStatus(status string) string {
+	switch status {
+	case database.JobCompleted:
+		return colorize(colorGreen, status)
+	case database.JobFailed:
+		return colorize(colorRed, status)
+	case database.JobRunning:
+		return colorize(colorCyan, status)
+	case database.JobCancelled, database.JobQueued:
+		return colorize(colorGray, status)
+	}
+	return status
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var lookupCmd = &cobra.Command{
+	Use:   "lookup [value]",
+	Short: "Find records by alias, submitter ID, internal ID or run file, or fetch a list of accessions",
+	Long: `Find records by the alias or submitter ID assigned by the submitting center,
+such as a GEO sample name or a lab's internal sample ID, or by an internal ID
+imported with 'srake idmap import'.
+
+Candidates are ranked by match quality: exact, case-insensitive, prefix, then
+substring. A bare value searches aliases, submitter IDs and internal IDs.
+
+--md5 and --filename find the runs with a data file of that MD5 checksum or
+name, as listed in the run's DATA_BLOCK, to trace a file back to its run.
+They match exactly; a path given to --filename is reduced to its base name.
+
+Aliases and submitter IDs are recorded at ingest; re-ingest older databases to
+make them searchable, along with run files.
+
+--from-file fetches the records of a list of study, experiment, sample and run
+accessions instead, one per line (- for stdin), with batched queries rather
+than one lookup per accession, and lists the accessions that were not found.`,
+	Example: `  srake lookup --alias GSM123_rep2
+  srake lookup --submitter-id LAB-0042
+  srake lookup --internal-id LIMS-2291
+  srake lookup --md5 9e107d9d372bb6826bd81d3542a419d6
+  srake lookup --filename ./fastq/sample1_R1.fastq.gz
+  srake lookup rep2 --limit 50 --format json
+  srake lookup --from-file accessions.txt
+  cut -f1 samplesheet.tsv | srake lookup --from-file - --format json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLookup,
+}
+
+var (
+	lookupAlias       string
+	lookupSubmitterID string
+	lookupInternalID  string
+	lookupMD5         string
+	lookupFilename    string
+	lookupFromFile    string
+	lookupLimit       int
+	lookupFormat      string
+)
+
+func init() {
+	lookupCmd.Flags().StringVar(&lookupAlias, "alias", "", "Center-assigned alias to look up")
+	lookupCmd.Flags().StringVar(&lookupSubmitterID, "submitter-id", "", "Submitter ID to look up")
+	lookupCmd.Flags().StringVar(&lookupInternalID, "internal-id", "", "Internal ID from 'srake idmap import' to look up")
+	lookupCmd.Flags().StringVar(&lookupMD5, "md5", "", "MD5 checksum of a run data file to look up")
+	lookupCmd.Flags().StringVar(&lookupFilename, "filename", "", "Name of a run data file to look up")
+	lookupCmd.Flags().StringVar(&lookupFromFile, "from-file", "", "Fetch the records of the accessions in a file, one per line (- for stdin)")
+	lookupCmd.Flags().IntVarP(&lookupLimit, "limit", "l", 20, "Maximum candidates to return")
+	lookupCmd.Flags().StringVarP(&lookupFormat, "format", "f", "table", "Output format (table|json)")
+}
+
+func runLookup(cmd *cobra.Command, args []string) error {
+	if lookupFromFile != "" {
+		if len(args) > 0 || lookupAlias != "" || lookupSubmitterID != "" || lookupInternalID != "" ||
+			lookupMD5 != "" || lookupFilename != "" {
+			return fmt.Errorf("--from-file cannot be combined with a value or other lookup flags")
+		}
+		return runLookupAccessions()
+	}
+
+	req := &service.LookupRequest{
+		Alias:       lookupAlias,
+		SubmitterID: lookupSubmitterID,
+		InternalID:  lookupInternalID,
+		MD5:         lookupMD5,
+		Limit:       lookupLimit,
+	}
+	if lookupFilename != "" {
+		req.Filename = filepath.Base(lookupFilename)
+	}
+	if len(args) == 1 {
+		req.Query = args[0]
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	response, err := service.NewMetadataService(db).Lookup(context.Background(), req)
+	if err != nil {
+		return err
+	}
+
+	if lookupFormat == "json" {
+		return printJSON(response)
+	}
+	if response.Total == 0 {
+		printInfo("No records match %s", response.Value)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", colorize(colorBold, "ACCESSION"), colorize(colorBold, "TYPE"),
+		colorize(colorBold, "MATCH"), colorize(colorBold, "ID TYPE"), colorize(colorBold, "VALUE"))
+	for _, m := range response.Candidates {
+		value := m.Value
+		if m.Namespace != "" {
+			value += " (" + m.Namespace + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", colorize(colorCyan, m.Accession), m.RecordType,
+			m.Match, m.IDType, truncateStr(value, 60))
+	}
+	return w.Flush()
+}
+
+// runLookupAccessions fetches the records of the accessions listed in
+// --from-file, a batch of database.MaxAccessionLookup at a time
+func runLookupAccessions() error {
+	var listed []string
+	var err error
+	if lookupFromFile == "-" {
+		listed, err = readAccessionsFromReader(os.Stdin)
+	} else {
+		listed, err = readAccessionFile(lookupFromFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read accessions: %w", err)
+	}
+
+	// Repeats are looked up once, even across batches
+	seen := make(map[string]bool, len(listed))
+	accessions := make([]string, 0, len(listed))
+	for _, acc := range listed {
+		acc = strings.ToUpper(acc)
+		if !seen[acc] {
+			seen[acc] = true
+			accessions = append(accessions, acc)
+		}
+	}
+	if len(accessions) == 0 {
+		return fmt.Errorf("no accessions in %s", lookupFromFile)
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	svc := service.NewMetadataService(db)
+	lookup := &database.AccessionLookup{
+		Studies:     []*database.Study{},
+		Experiments: []*database.Experiment{},
+		Samples:     []*database.Sample{},
+		Runs:        []*database.Run{},
+		NotFound:    []string{},
+	}
+	for start := 0; start < len(accessions); start += database.MaxAccessionLookup {
+		batch := accessions[start:min(start+database.MaxAccessionLookup, len(accessions))]
+		found, err := svc.LookupAccessions(context.Background(), &service.AccessionLookupRequest{Accessions: batch})
+		if err != nil {
+			return err
+		}
+		lookup.Studies = append(lookup.Studies, found.Studies...)
+		lookup.Experiments = append(lookup.Experiments, found.Experiments...)
+		lookup.Samples = append(lookup.Samples, found.Samples...)
+		lookup.Runs = append(lookup.Runs, found.Runs...)
+		lookup.NotFound = append(lookup.NotFound, found.NotFound...)
+	}
+
+	if lookupFormat == "json" {
+		return printJSON(lookup)
+	}
+
+	if lookup.Found() > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", colorize(colorBold, "ACCESSION"), colorize(colorBold, "TYPE"),
+			colorize(colorBold, "PARENT"), colorize(colorBold, "SUMMARY"))
+		row := func(acc, recordType, parent, summary string) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", colorize(colorCyan, acc), recordType, parent, truncateStr(summary, 60))
+		}
+		for _, s := range lookup.Studies {
+			row(s.StudyAccession, "study", "", s.StudyTitle)
+		}
+		for _, e := range lookup.Experiments {
+			row(e.ExperimentAccession, "experiment", e.StudyAccession, strings.Join(nonEmpty(e.LibraryStrategy, e.Platform, e.Title), ", "))
+		}
+		for _, s := range lookup.Samples {
+			row(s.SampleAccession, "sample", "", strings.Join(nonEmpty(s.Organism, s.Tissue, s.CellType), ", "))
+		}
+		for _, r := range lookup.Runs {
+			row(r.RunAccession, "run", r.ExperimentAccession, fmt.Sprintf("%d spots, %d bases", r.TotalSpots, r.TotalBases))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	printInfo("Found %d of %d accessions", lookup.Found(), len(accessions))
+	if n := len(lookup.NotFound); n > 0 {
+		const shown = 20
+		if n > shown {
+			printWarning("Not found: %s and %d more (use --format json for the full list)",
+				strings.Join(lookup.NotFound[:shown], ", "), n-shown)
+		} else {
+			printWarning("Not found: %s", strings.Join(lookup.NotFound, ", "))
+		}
+	}
+	return nil
+}
+
+// nonEmpty returns the values that are not empty
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
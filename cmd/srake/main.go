@@ -41,6 +41,9 @@ ENVIRONMENT VARIABLES:
   SRAKE_DATA_DIR         Data directory (default: ~/.local/share/srake)
   SRAKE_CACHE_DIR        Cache directory (default: ~/.cache/srake)
   SRAKE_MODEL_VARIANT    Model variant for embeddings (full|quantized)
+  SRAKE_ONNX_PROVIDER    Execution provider for embeddings (cpu|cuda|coreml)
+  NCBI_API_KEY           NCBI API key for E-utilities requests of ingest --entrez
+                         and metadata enrich
   NO_COLOR               Disable colored output
 
 The tool follows XDG Base Directory Specification and respects standard
@@ -99,9 +102,39 @@ func init() {
 	rootCmd.AddCommand(dbCmd)
 	rootCmd.AddCommand(ingestCmd)
 	rootCmd.AddCommand(metadataCmd)
+	rootCmd.AddCommand(rawCmd)
+	rootCmd.AddCommand(lookupCmd)
+	rootCmd.AddCommand(idmapCmd)
+	rootCmd.AddCommand(expectCmd)
+	rootCmd.AddCommand(resolveCmd)
+	rootCmd.AddCommand(attributesCmd)
+	rootCmd.AddCommand(taxonomyCmd)
+	rootCmd.AddCommand(ontologyCmd)
+	rootCmd.AddCommand(tagCmd)
+	rootCmd.AddCommand(filterCmd)
+	rootCmd.AddCommand(recommendCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(feedbackCmd)
+	rootCmd.AddCommand(cohortCmd)
+	rootCmd.AddCommand(jobsCmd)
+	rootCmd.AddCommand(cleanCmd)
+	rootCmd.AddCommand(dumpCmd)
+	rootCmd.AddCommand(packageCmd)
+	rootCmd.AddCommand(citeCmd)
+	rootCmd.AddCommand(manifestCmd)
+	rootCmd.AddCommand(fetchCmd)
 	rootCmd.AddCommand(modelsCmd)
 	rootCmd.AddCommand(embedCmd)
 	rootCmd.AddCommand(mcpCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(examplesCmd)
+	rootCmd.AddCommand(templatesCmd)
+	rootCmd.AddCommand(savedCmd)
+	rootCmd.AddCommand(qcCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(quarantineCmd)
+	rootCmd.AddCommand(reportCmd)
+	rootCmd.AddCommand(selfUpdateCmd)
 }
 
 func main() {
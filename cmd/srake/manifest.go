@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest [<accession> ...]",
+	Short: "Write a download manifest for the data files of matched runs",
+	Long: `Write a ready-to-run download manifest for the data files of the runs matched
+by a search or named by accession, so large transfers can run on a
+data-transfer node without srake installed.
+
+Studies, experiments and samples expand to their runs.
+
+Supported formats:
+  • aria2:   aria2c input file (aria2c -i manifest.txt -c)
+  • wget:    POSIX shell script using wget
+  • aws-cli: POSIX shell script using aws s3 cp (requires --source aws)
+
+Sources:
+  • ena:  files listed by ENA, with expected sizes and MD5 checksums
+          (queried once per run)
+  • aws:  SRA objects in the AWS Open Data registry
+  • gcp:  SRA objects in Google Cloud public datasets
+  • ncbi: SRA objects served by NCBI
+The aws, gcp and ncbi sources serve SRA files only and publish no checksums,
+so their manifests carry none.
+
+The scripts verify each file's size and checksum after download when known.`,
+	Example: `  # aria2 input file of FASTQ files for a search
+  srake manifest --query "liver AND organism:human" --type fastq --format aria2 -o liver.aria2
+
+  # wget script for the runs of a study
+  srake manifest SRP123456 --format wget -o fetch.sh
+
+  # aws-cli script pulling SRA objects from the AWS Open Data registry
+  srake manifest --query "tumor" --source aws --format aws-cli -o fetch.sh`,
+	RunE: runManifest,
+}
+
+var (
+	manifestQuery   string
+	manifestFilters []string
+	manifestFormat  string
+	manifestType    string
+	manifestSource  string
+	manifestLimit   int
+	manifestOutput  string
+	manifestOpen    bool
+)
+
+func init() {
+	manifestCmd.Flags().StringVar(&manifestQuery, "query", "", "Search query selecting runs")
+	manifestCmd.Flags().StringSliceVar(&manifestFilters, "filter", nil, "Filters as field=value (repeatable)")
+	manifestCmd.Flags().StringVarP(&manifestFormat, "format", "f", downloader.ManifestAria2,
+		fmt.Sprintf("Manifest format (%s)", strings.Join(downloader.ManifestFormats(), "|")))
+	manifestCmd.Flags().StringVarP(&manifestType, "type", "t", "sra", "File type (sra|fastq)")
+	manifestCmd.Flags().StringVarP(&manifestSource, "source", "s", "", "File source (ena|aws|gcp|ncbi; default: ena, or aws for aws-cli)")
+	manifestCmd.Flags().IntVarP(&manifestLimit, "limit", "l", 0, "Maximum runs to include (0 for all matches)")
+	manifestCmd.Flags().StringVarP(&manifestOutput, "output", "o", "", "Output file (default: stdout)")
+	manifestCmd.Flags().BoolVar(&manifestOpen, "open-access-only", false, "Leave out controlled-access runs (e.g. dbGaP)")
+}
+
+func runManifest(cmd *cobra.Command, args []string) error {
+	if !downloader.ValidManifestFormat(manifestFormat) {
+		return fmt.Errorf("unsupported manifest format: %s (supported: %s)",
+			manifestFormat, strings.Join(downloader.ManifestFormats(), ", "))
+	}
+	if manifestQuery == "" && len(args) == 0 {
+		return fmt.Errorf("provide accessions or --query")
+	}
+	source := manifestSource
+	if source == "" {
+		source = service.ManifestSourceENA
+		if manifestFormat == downloader.ManifestAWSCLI {
+			source = service.ManifestSourceAWS
+		}
+	}
+	if manifestFormat == downloader.ManifestAWSCLI && source != service.ManifestSourceAWS {
+		return fmt.Errorf("the aws-cli format needs --source aws")
+	}
+	filters, err := parseFilterFlags(manifestFilters)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var searchService *service.SearchService
+	if manifestQuery != "" {
+		indexPath := paths.GetIndexPath()
+		if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+			return fmt.Errorf("search index not found at %s (build it with 'srake index --build')", indexPath)
+		}
+		searchService, err = service.NewSearchService(db, indexPath)
+		if err != nil {
+			return fmt.Errorf("failed to initialize search service: %v", err)
+		}
+		defer searchService.Close()
+	}
+
+	manifest, err := service.NewManifestService(db, searchService).Build(context.Background(), &service.ManifestRequest{
+		Query:          manifestQuery,
+		Filters:        filters,
+		Accessions:     args,
+		Limit:          manifestLimit,
+		FileType:       manifestType,
+		Source:         source,
+		OpenAccessOnly: manifestOpen,
+	})
+	if err != nil {
+		return err
+	}
+	if len(manifest.Excluded) > 0 {
+		printWarning("Left out %d runs that are not open access: %s", len(manifest.Excluded), formatExcludedRuns(manifest.Excluded))
+	}
+	if len(manifest.Files) == 0 {
+		return fmt.Errorf("no data files found for %d matched runs", len(manifest.Runs))
+	}
+
+	var w io.Writer = os.Stdout
+	if manifestOutput != "" {
+		mode := os.FileMode(0644)
+		if manifestFormat != downloader.ManifestAria2 {
+			mode = 0755
+		}
+		f, err := os.OpenFile(manifestOutput, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := downloader.WriteManifest(w, manifestFormat, manifest.Files); err != nil {
+		return err
+	}
+
+	if len(manifest.Unresolved) > 0 {
+		printWarning("%d runs have no %s files at %s: %s", len(manifest.Unresolved), manifestType, source,
+			strings.Join(manifest.Unresolved, ", "))
+	}
+	if manifestOutput != "" && !quiet {
+		printSuccess("Wrote %d files for %d runs to %s", len(manifest.Files), len(manifest.Runs), manifestOutput)
+	}
+	return nil
+}
@@ -16,20 +16,37 @@ var metadataCmd = &cobra.Command{
 	Short: "Get metadata for specific accessions",
 	Long: `Retrieve detailed metadata for one or more SRA accessions.
 
-Supports SRX (experiment), SRR (run), SRP/DRP/ERP (study), and SRS/DRS/ERS (sample) accessions.`,
+Supports SRX (experiment), SRR (run), SRP/DRP/ERP (study), and SRS/DRS/ERS (sample) accessions.
+
+Internal IDs imported with 'srake idmap import' are accepted in place of
+accessions, and the internal IDs of each record are shown with it.
+
+With --inherit, samples are shown with their attributes, including those
+they lack that their experiments or studies set, each marked with the
+experiment or study it was inherited from.
+
+With --partial, each argument is treated as a fragment and every accession or
+alias containing it is looked up. Build the trigram index with
+'srake index --trigram' to avoid scanning the tables on large databases.`,
 	Example: `  srake metadata SRX123456
   srake metadata SRX123456 SRX123457 --format json
   srake metadata SRR999999 --fields title,platform,strategy
-  srake metadata SRP123456 --format json --output metadata.json`,
+  srake metadata SRP123456 --format json --output metadata.json
+  srake metadata SRS123456 --inherit
+  srake metadata 1234567 --partial`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: runMetadata,
 }
 
 var (
-	metadataFormat string
-	metadataFields string
-	metadataExpand bool
-	metadataOutput string
+	metadataFormat  string
+	metadataFields  string
+	metadataExpand  bool
+	metadataOutput  string
+	metadataInherit bool
+
+	partialLookup      bool
+	partialLookupLimit int
 )
 
 func init() {
@@ -37,6 +54,9 @@ func init() {
 	metadataCmd.Flags().StringVarP(&metadataFormat, "format", "f", "table", "Output format (table|json|yaml)")
 	metadataCmd.Flags().StringVar(&metadataFields, "fields", "", "Comma-separated list of fields")
 	metadataCmd.Flags().BoolVar(&metadataExpand, "expand", false, "Expand nested structures")
+	metadataCmd.Flags().BoolVar(&metadataInherit, "inherit", false, "Show sample attributes, filling missing ones from their experiments and studies")
+	metadataCmd.Flags().BoolVar(&partialLookup, "partial", false, "Match accessions and aliases containing the given fragments")
+	metadataCmd.Flags().IntVar(&partialLookupLimit, "partial-limit", 20, "Maximum matches per fragment with --partial")
 }
 
 func runMetadata(cmd *cobra.Command, args []string) error {
@@ -49,6 +69,32 @@ func runMetadata(cmd *cobra.Command, args []string) error {
 	}
 	defer db.Close()
 
+	if err := includeArchivedRuns(cmd, db); err != nil {
+		return err
+	}
+
+	if partialLookup {
+		accessions = resolvePartialAccessions(db, accessions, partialLookupLimit)
+	} else {
+		accessions = resolveInternalIDs(db, accessions)
+	}
+	internalIDs, err := db.InternalIDsOf(accessions)
+	if err != nil {
+		return fmt.Errorf("failed to read internal IDs: %v", err)
+	}
+	var attributes map[string][]database.InheritedAttribute
+	if metadataInherit {
+		var samples []string
+		for _, acc := range accessions {
+			if detectAccessionType(acc) == "sample" {
+				samples = append(samples, acc)
+			}
+		}
+		if attributes, err = db.ResolveSampleAttributes(samples); err != nil {
+			return fmt.Errorf("failed to resolve sample attributes: %v", err)
+		}
+	}
+
 	for _, acc := range accessions {
 		accType := detectAccessionType(acc)
 		var data interface{}
@@ -74,17 +120,61 @@ func runMetadata(cmd *cobra.Command, args []string) error {
 		}
 
 		if metadataFormat == "json" {
+			if ids := internalIDs[acc]; len(ids) > 0 {
+				data = withField(data, "internal_ids", ids)
+			}
+			if metadataInherit && accType == "sample" {
+				attrs := attributes[acc]
+				if attrs == nil {
+					attrs = []database.InheritedAttribute{}
+				}
+				data = withField(data, "attributes", attrs)
+			}
 			encoder := json.NewEncoder(os.Stdout)
 			encoder.SetIndent("", "  ")
 			encoder.Encode(data)
 		} else {
-			printMetadataTable(acc, accType, data)
+			source, _ := db.GetRecordSource(acc)
+			printMetadataTable(acc, accType, data, source, internalIDs[acc], attributes[acc])
 		}
 	}
 
 	return nil
 }
 
+// resolvePartialAccessions expands accession fragments into the accessions
+// that contain them, preserving order and dropping duplicates
+func resolvePartialAccessions(db *database.DB, fragments []string, limit int) []string {
+	fts := database.NewFTS5Manager(db)
+	if !fts.HasTrigramTable() {
+		printWarning("Trigram index not built, scanning tables (build it with 'srake index --trigram')")
+	}
+
+	seen := make(map[string]bool)
+	var accessions []string
+	for _, fragment := range fragments {
+		matches, err := fts.SearchPartialAccessions(fragment, limit)
+		if err != nil {
+			printError("Partial lookup failed for %s: %v", fragment, err)
+			continue
+		}
+		if len(matches) == 0 {
+			printWarning("No accessions match %s", fragment)
+			continue
+		}
+		if len(matches) == limit {
+			printWarning("Showing the first %d matches for %s (raise --partial-limit for more)", limit, fragment)
+		}
+		for _, m := range matches {
+			if !seen[m.Accession] {
+				seen[m.Accession] = true
+				accessions = append(accessions, m.Accession)
+			}
+		}
+	}
+	return accessions
+}
+
 // detectAccessionType determines the type of accession based on prefix
 func detectAccessionType(acc string) string {
 	acc = strings.ToUpper(acc)
@@ -103,8 +193,23 @@ func detectAccessionType(acc string) string {
 	return "unknown"
 }
 
+// withField returns a record as a JSON object with a field added, such as
+// its internal IDs
+func withField(data interface{}, name string, value interface{}) interface{} {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return data
+	}
+	fields[name] = value
+	return fields
+}
+
 // printMetadataTable prints metadata in table format
-func printMetadataTable(acc, accType string, data interface{}) {
+func printMetadataTable(acc, accType string, data interface{}, source *database.RecordSource, internalIDs []string, attributes []database.InheritedAttribute) {
 	printInfo("Metadata for %s (%s):", colorize(colorCyan, acc), accType)
 
 	switch v := data.(type) {
@@ -141,6 +246,33 @@ func printMetadataTable(acc, accType string, data interface{}) {
 		fmt.Printf("  Total Bases:%d\n", v.TotalBases)
 		fmt.Printf("  Published:  %s\n", v.Published)
 	}
+	if len(internalIDs) > 0 {
+		fmt.Printf("  Internal ID:%s\n", strings.Join(internalIDs, ", "))
+	}
+	if source != nil {
+		fmt.Printf("  Archive:    %s", strings.ToUpper(source.Archive))
+		if source.SourceFile != "" {
+			fmt.Printf(" (%s)", source.SourceFile)
+		}
+		fmt.Println()
+	}
+	if len(attributes) > 0 {
+		fmt.Printf("  Attributes:\n")
+		width := 0
+		for _, a := range attributes {
+			width = max(width, len(a.Tag))
+		}
+		for _, a := range attributes {
+			value := a.Value
+			if a.Units != "" {
+				value += " " + a.Units
+			}
+			if a.Source != database.AttrSourceSample {
+				value += colorize(colorYellow, fmt.Sprintf(" (from %s %s)", a.Source, a.SourceAccession))
+			}
+			fmt.Printf("    %-*s  %s\n", width+1, a.Tag+":", value)
+		}
+	}
 	fmt.Println()
 }
 
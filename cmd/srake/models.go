@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/embeddings"
 	"github.com/spf13/cobra"
 )
@@ -12,9 +16,18 @@ import (
 var modelsCmd = &cobra.Command{
 	Use:   "models",
 	Short: "Manage embedding models",
-	Long:  `Download and manage ONNX models for generating embeddings.`,
+	Long: `Download and manage ONNX models for generating embeddings.
+
+Models are pulled from HuggingFace repositories with ONNX exports under
+onnx/, such as those published by Xenova. The dimension of each model and
+the checksums of its files are recorded when it is pulled, so that
+'srake models verify' can detect corrupted or altered files. The model
+set with 'srake models use' is the default of 'srake embed' and
+'srake index --with-embeddings'.`,
 	Example: `  srake models list
-  srake models download Xenova/SapBERT-from-PubMedBERT-fulltext
+  srake models pull Xenova/SapBERT-from-PubMedBERT-fulltext
+  srake models verify
+  srake models use Xenova/all-MiniLM-L6-v2
   srake models test Xenova/SapBERT-from-PubMedBERT-fulltext "test text"`,
 }
 
@@ -43,16 +56,25 @@ func runModelsList(cmd *cobra.Command, args []string) error {
 		for _, modelID := range embeddings.ListAvailableModels() {
 			fmt.Printf("  %s\n", modelID)
 		}
-		fmt.Printf("\nUse 'srake models download <model-id>' to download a model\n")
+		fmt.Printf("\nUse 'srake models pull <hf-repo>' to download a model\n")
 		return nil
 	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	defaultModel := defaultEmbeddingModel()
 
 	printInfo("Installed Models")
 	fmt.Println(colorize(colorGray, strings.Repeat("─", 80)))
 
 	for _, model := range models {
-		fmt.Printf("%s %s\n", colorize(colorBold, "Model:"), model.ID)
+		marker := ""
+		if model.ID == defaultModel {
+			marker = colorize(colorGreen, " (default)")
+		}
+		fmt.Printf("%s %s%s\n", colorize(colorBold, "Model:"), model.ID, marker)
 		fmt.Printf("  Path: %s\n", model.Path)
+		if model.Dims > 0 {
+			fmt.Printf("  Dimensions: %d\n", model.Dims)
+		}
 		fmt.Printf("  Active variant: %s\n", colorize(colorCyan, model.ActiveVariant))
 
 		fmt.Printf("  Variants:\n")
@@ -69,26 +91,84 @@ func runModelsList(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// Models download subcommand
-var modelsDownloadCmd = &cobra.Command{
-	Use:   "download <model-id> [--variant <variant>]",
-	Short: "Download a model",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runModelsDownload,
+// Models pull subcommand
+var modelsPullCmd = &cobra.Command{
+	Use:     "pull <hf-repo> [--variant <variant>]",
+	Aliases: []string{"download"},
+	Short:   "Download a model from a HuggingFace repository",
+	Long: `Download a model from a HuggingFace repository: its config, tokenizer, and
+one ONNX variant. Models outside the built-in registry are expected to
+keep ONNX exports under onnx/ as model_quantized.onnx, model_fp16.onnx,
+or model.onnx. The model's dimension and the SHA-256 of its files are
+recorded for 'srake models verify'.`,
+	Example: `  srake models pull Xenova/SapBERT-from-PubMedBERT-fulltext
+  srake models pull Xenova/all-MiniLM-L6-v2 --variant full`,
+	Args: cobra.ExactArgs(1),
+	RunE: runModelsDownload,
+}
+
+// Models verify subcommand
+var modelsVerifyCmd = &cobra.Command{
+	Use:   "verify [model-id]...",
+	Short: "Check model files against the checksums recorded when they were pulled",
+	Long: `Check the ONNX and tokenizer files of installed models, or of all of them,
+against the SHA-256 checksums recorded when they were pulled and those
+published in the built-in registry. Fails if a file was modified or is
+missing. Files with no recorded checksum, such as models copied in by hand,
+are reported as unrecorded; 'srake models verify --record' records their
+current checksums.`,
+	Example: `  srake models verify
+  srake models verify Xenova/SapBERT-from-PubMedBERT-fulltext --json`,
+	RunE: runModelsVerify,
+}
+
+// Models use subcommand
+var modelsUseCmd = &cobra.Command{
+	Use:   "use <model-id>",
+	Short: "Set the default embedding model",
+	Long: `Set the default embedding model, embeddings.default_model, in the user
+config file. It is used by 'srake embed', 'srake index --with-embeddings',
+and vector search. With --variant, the model's active ONNX variant is
+switched too.
+
+Embeddings of different models are stored apart, so switching never mixes
+them; run 'srake embed --update' to embed the studies with the new model.`,
+	Example: `  srake models use Xenova/all-MiniLM-L6-v2
+  srake models use Xenova/SapBERT-from-PubMedBERT-fulltext --variant fp16`,
+	Args: cobra.ExactArgs(1),
+	RunE: runModelsUse,
 }
 
-var downloadVariant string
+var (
+	downloadVariant string
+	verifyRecord    bool
+	verifyJSON      bool
+	useVariant      string
+)
 
 func init() {
-	// Models download command flags
-	modelsDownloadCmd.Flags().StringVar(&downloadVariant, "variant", "", "Model variant to download (quantized|fp16|full)")
+	modelsPullCmd.Flags().StringVar(&downloadVariant, "variant", "", "Model variant to download (quantized|fp16|full)")
+	modelsVerifyCmd.Flags().BoolVar(&verifyRecord, "record", false, "Record the current checksums of the files instead of checking them")
+	modelsVerifyCmd.Flags().BoolVar(&verifyJSON, "json", false, "Output as JSON")
+	modelsUseCmd.Flags().StringVar(&useVariant, "variant", "", "Also switch the model's active variant (quantized|fp16|full)")
 
 	// Add subcommands to models
 	modelsCmd.AddCommand(modelsListCmd)
-	modelsCmd.AddCommand(modelsDownloadCmd)
+	modelsCmd.AddCommand(modelsPullCmd)
+	modelsCmd.AddCommand(modelsVerifyCmd)
+	modelsCmd.AddCommand(modelsUseCmd)
 	modelsCmd.AddCommand(modelsTestCmd)
 }
 
+// defaultEmbeddingModel returns the embedding model set with 'srake models
+// use', or the built-in default
+func defaultEmbeddingModel() string {
+	if cfg, _, err := config.LoadLayered(); err == nil && cfg.Embeddings.DefaultModel != "" {
+		return cfg.Embeddings.DefaultModel
+	}
+	return embeddings.DefaultEmbedderConfig().DefaultModel
+}
+
 func runModelsDownload(cmd *cobra.Command, args []string) error {
 	modelID := args[0]
 
@@ -128,6 +208,127 @@ func runModelsDownload(cmd *cobra.Command, args []string) error {
 	}
 
 	printSuccess("Model %s downloaded successfully", modelID)
+	if info, err := manager.GetModel(modelID); err == nil && !quiet {
+		if info.Dims > 0 {
+			fmt.Printf("Dimensions: %d\n", info.Dims)
+		}
+		fmt.Printf("Checksums:  recorded for %d files\n", len(info.Checksums))
+	}
+	return nil
+}
+
+func runModelsVerify(cmd *cobra.Command, args []string) error {
+	manager, err := embeddings.NewManager(embeddings.DefaultEmbedderConfig().ModelsDir)
+	if err != nil {
+		return fmt.Errorf("failed to create model manager: %v", err)
+	}
+
+	modelIDs := args
+	if len(modelIDs) == 0 {
+		models, _ := manager.ListModels()
+		for _, model := range models {
+			modelIDs = append(modelIDs, model.ID)
+		}
+		sort.Strings(modelIDs)
+	}
+	if len(modelIDs) == 0 {
+		printInfo("No models installed")
+		return nil
+	}
+
+	if verifyRecord {
+		for _, modelID := range modelIDs {
+			info, err := manager.RecordModelFiles(modelID)
+			if err != nil {
+				return err
+			}
+			printSuccess("Recorded checksums of %d files of %s", len(info.Checksums), modelID)
+		}
+		return nil
+	}
+
+	results := make(map[string][]embeddings.FileCheck)
+	failed := 0
+	for _, modelID := range modelIDs {
+		checks, err := manager.VerifyModel(modelID)
+		if err != nil {
+			return err
+		}
+		results[modelID] = checks
+		for _, check := range checks {
+			if check.Status == embeddings.FileModified || check.Status == embeddings.FileMissing {
+				failed++
+			}
+		}
+	}
+
+	if verifyJSON {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MODEL\tFILE\tSTATUS")
+		for _, modelID := range modelIDs {
+			for _, check := range results[modelID] {
+				status := check.Status
+				switch status {
+				case embeddings.FileOK:
+					status = colorize(colorGreen, status)
+				case embeddings.FileModified, embeddings.FileMissing:
+					status = colorize(colorRed, status)
+				default:
+					status = colorize(colorYellow, status)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", modelID, check.File, status)
+			}
+		}
+		w.Flush()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d model files failed verification; pull the model again to replace them", failed)
+	}
+	return nil
+}
+
+func runModelsUse(cmd *cobra.Command, args []string) error {
+	modelID := args[0]
+
+	manager, err := embeddings.NewManager(embeddings.DefaultEmbedderConfig().ModelsDir)
+	if err != nil {
+		return fmt.Errorf("failed to create model manager: %v", err)
+	}
+	info, err := manager.GetModel(modelID)
+	if err != nil {
+		return fmt.Errorf("model %s is not installed\nPull it with 'srake models pull %s'", modelID, modelID)
+	}
+	if useVariant != "" {
+		if err := manager.SetActiveVariant(modelID, useVariant); err != nil {
+			return err
+		}
+	}
+
+	path := config.UserConfigPath()
+	if err := config.SetFileSetting(path, "embeddings.default_model", modelID); err != nil {
+		return err
+	}
+	printSuccess("Default embedding model set to %s in %s", modelID, path)
+	if info.Dims > 0 && !quiet {
+		fmt.Printf("Dimensions: %d\n", info.Dims)
+	}
+
+	// A project file, SRAKE_CONFIG or the environment may still win
+	if _, report, err := config.LoadLayered(); err == nil {
+		for _, setting := range report.Settings {
+			if setting.Key == "embeddings.default_model" && setting.Value != modelID {
+				printWarning("The %s layer sets embeddings.default_model to %s, which takes precedence", setting.Layer, setting.Value)
+			}
+		}
+	}
+	if !quiet {
+		fmt.Printf("Run 'srake embed --update' to embed the studies with %s\n", modelID)
+	}
 	return nil
 }
 
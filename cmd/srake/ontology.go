@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/ontology"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/search"
+	"github.com/spf13/cobra"
+)
+
+var ontologyCmd = &cobra.Command{
+	Use:   "ontology",
+	Short: "Load vocabularies that expand search terms with their synonyms",
+	Long: `Load biomedical vocabularies, such as MeSH or EFO, so that searches also
+match the synonyms of their terms: "liver cancer" also finds records saying
+"hepatocellular carcinoma".
+
+Text searches look up runs of up to five words and quoted phrases of the query
+in every loaded vocabulary, longest first, and add the preferred name and
+exact synonyms of the terms they name. Terms with a field, a wildcard or a NOT
+are searched as written. Turn expansion off for one search with
+'srake search --no-expand', or for all with search.expand_synonyms: false.`,
+	Example: `  srake ontology load efo.obo
+  srake ontology load desc2025.xml.gz
+  srake ontology expand "liver cancer"
+  srake search "liver cancer" --no-expand`,
+}
+
+var ontologyLoadCmd = &cobra.Command{
+	Use:   "load <file>",
+	Short: "Load an OBO ontology or MeSH descriptor file",
+	Long: `Load an OBO ontology (such as efo.obo, mondo.obo or doid.obo) or the MeSH
+descriptors (desc<year>.xml), either of which may be gzip-compressed.
+
+OBO terms are loaded with their exact synonyms, MeSH descriptors with the
+entry terms of their preferred concept; obsolete terms and broader, narrower
+or related names are left out. The vocabulary is named by the ontology header
+of an OBO file, or mesh, unless --name is given, and replaces any loaded
+before under the same name.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runOntologyLoad,
+}
+
+var ontologyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List loaded vocabularies",
+	Args:  cobra.NoArgs,
+	RunE:  runOntologyList,
+}
+
+var ontologyRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Delete a loaded vocabulary",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runOntologyRemove,
+}
+
+var ontologyExpandCmd = &cobra.Command{
+	Use:   "expand <query>",
+	Short: "Show how a search query is expanded with synonyms",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runOntologyExpand,
+}
+
+var (
+	ontologyName string
+	ontologyJSON bool
+)
+
+func init() {
+	ontologyLoadCmd.Flags().StringVar(&ontologyName, "name", "", "Name of the vocabulary (default: from the file)")
+	for _, cmd := range []*cobra.Command{ontologyListCmd, ontologyExpandCmd} {
+		cmd.Flags().BoolVar(&ontologyJSON, "json", false, "Output as JSON")
+	}
+
+	ontologyCmd.AddCommand(ontologyLoadCmd, ontologyListCmd, ontologyRemoveCmd, ontologyExpandCmd)
+}
+
+func runOntologyLoad(cmd *cobra.Command, args []string) error {
+	printInfo("Reading %s", args[0])
+	vocabulary, err := ontology.Load(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read vocabulary: %w", err)
+	}
+	if len(vocabulary.Terms) == 0 {
+		return fmt.Errorf("no terms found in %s", args[0])
+	}
+
+	name := ontologyName
+	if name == "" {
+		name = strings.ToLower(vocabulary.Name)
+	}
+	if name == "" {
+		return fmt.Errorf("%s does not name its ontology; give it a name with --name", args[0])
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	terms := make([]database.OntologyTerm, len(vocabulary.Terms))
+	labels := 0
+	for i, t := range vocabulary.Terms {
+		terms[i] = database.OntologyTerm{ID: t.ID, Labels: t.Labels()}
+		labels += len(terms[i].Labels)
+	}
+	err = db.ReplaceOntology(database.Ontology{
+		Name:       name,
+		Format:     vocabulary.Format,
+		SourceFile: filepath.Base(args[0]),
+	}, terms)
+	if err != nil {
+		return fmt.Errorf("failed to store vocabulary: %w", err)
+	}
+
+	printSuccess("Loaded %d terms with %d names as %s", len(terms), labels, name)
+	return nil
+}
+
+func runOntologyList(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	ontologies, err := db.ListOntologies()
+	if err != nil {
+		return fmt.Errorf("failed to list vocabularies: %v", err)
+	}
+	if ontologyJSON {
+		if ontologies == nil {
+			ontologies = []database.Ontology{}
+		}
+		return printJSON(ontologies)
+	}
+	if len(ontologies) == 0 {
+		printInfo("No vocabularies loaded (load one with 'srake ontology load')")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", colorize(colorBold, "NAME"), colorize(colorBold, "FORMAT"),
+		colorize(colorBold, "TERMS"), colorize(colorBold, "FILE"), colorize(colorBold, "LOADED"))
+	for _, o := range ontologies {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", colorize(colorCyan, o.Name), o.Format, o.Terms,
+			o.SourceFile, o.LoadedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+func runOntologyRemove(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.DeleteOntology(args[0]); err != nil {
+		return err
+	}
+	printSuccess("Deleted vocabulary %s", args[0])
+	return nil
+}
+
+func runOntologyExpand(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	expanded, expansions, err := search.ExpandQuery(db, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to expand query: %v", err)
+	}
+	if ontologyJSON {
+		if expansions == nil {
+			expansions = []search.Expansion{}
+		}
+		return printJSON(map[string]interface{}{
+			"query":      args[0],
+			"expanded":   expanded,
+			"expansions": expansions,
+		})
+	}
+	if len(expansions) == 0 {
+		printInfo("No terms of %q have synonyms in the loaded vocabularies", args[0])
+		return nil
+	}
+	for _, e := range expansions {
+		fmt.Printf("%s %s\n", colorize(colorBold, e.Term+":"), strings.Join(e.Synonyms, ", "))
+	}
+	fmt.Printf("\n%s %s\n", colorize(colorBold, "Searched as:"), expanded)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/packaging"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var packageCmd = &cobra.Command{
+	Use:   "package <study-accession>",
+	Short: "Build a standards-based metadata package for a study",
+	Long: `Build a metadata package describing a study, its samples, and its runs,
+with links to the public SRA data files.
+
+Supported formats:
+  • ro-crate: RO-Crate 1.1 JSON-LD (ro-crate-metadata.json)
+  • dats:     DATS 2.2 Dataset JSON
+
+Packages are suitable for deposition in institutional repositories and for
+FAIR compliance reporting. Local curations (titles, tags, notes) are included.`,
+	Example: `  # Print an RO-Crate to stdout
+  srake package SRP123456
+
+  # Write an RO-Crate into a directory as ro-crate-metadata.json
+  srake package SRP123456 --format ro-crate --output ./SRP123456-crate/
+
+  # Write a DATS description to a file
+  srake package SRP123456 --format dats --output SRP123456.dats.json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPackage,
+}
+
+var (
+	packageFormat string
+	packageOutput string
+)
+
+func init() {
+	packageCmd.Flags().StringVarP(&packageFormat, "format", "f", packaging.FormatROCrate,
+		fmt.Sprintf("Package format (%s)", strings.Join(packaging.Formats(), "|")))
+	packageCmd.Flags().StringVarP(&packageOutput, "output", "o", "", "Output file or directory (default: stdout)")
+}
+
+func runPackage(cmd *cobra.Command, args []string) error {
+	accession := strings.ToUpper(args[0])
+	if detectAccessionType(accession) != "study" {
+		return fmt.Errorf("%s is not a study accession (expected SRP/ERP/DRP)", accession)
+	}
+	if !packaging.ValidFormat(packageFormat) {
+		return fmt.Errorf("unsupported package format: %s (supported: %s)",
+			packageFormat, strings.Join(packaging.Formats(), ", "))
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	bundle, err := service.NewMetadataService(db).GetStudyBundle(context.Background(), accession)
+	if err != nil {
+		return err
+	}
+
+	if packageOutput == "" {
+		return packaging.Write(os.Stdout, packageFormat, bundle)
+	}
+
+	path := packageOutput
+	if info, err := os.Stat(path); (err == nil && info.IsDir()) || strings.HasSuffix(path, string(os.PathSeparator)) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+		path = filepath.Join(path, packaging.DefaultFilename(packageFormat))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer file.Close()
+
+	if err := packaging.Write(file, packageFormat, bundle); err != nil {
+		return err
+	}
+
+	if !quiet {
+		printSuccess("Wrote %s package for %s (%d samples, %d runs) to %s",
+			packageFormat, accession, len(bundle.Samples), len(bundle.Runs), path)
+	}
+	return nil
+}
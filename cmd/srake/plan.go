@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/export"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/plan"
+	"github.com/spf13/cobra"
+)
+
+// Flags of the commands that print a plan instead of running with --dry-run
+var (
+	dryRun     bool
+	planFormat string
+)
+
+// recordTables are the tables of the four record types, in the order
+// records are indexed and exported
+var recordTables = []string{"studies", "experiments", "samples", "runs"}
+
+func init() {
+	for _, cmd := range []*cobra.Command{indexCmd, exportCmd, dumpCmd, cohortDeleteCmd, savedDeleteCmd, tagDeleteCmd, tagRemoveCmd} {
+		cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the plan of the command (sources, sizes, tables and steps) without running it")
+		cmd.Flags().StringVar(&planFormat, "plan-format", plan.FormatJSON, "Format of the --dry-run plan (json|yaml|text)")
+	}
+}
+
+// checkPlanFormat validates --plan-format before a dry run does any work
+func checkPlanFormat() error {
+	if !plan.ValidFormat(planFormat) {
+		return fmt.Errorf("invalid plan format: %s (must be json, yaml or text)", planFormat)
+	}
+	return nil
+}
+
+// writePlan prints a --dry-run plan to stdout
+func writePlan(p *plan.Plan) error {
+	return p.Write(os.Stdout, planFormat)
+}
+
+// addRecordTables adds the record tables to a plan with their row counts
+// from the statistics table, which are those of the last ingest
+func addRecordTables(p *plan.Plan, db *database.DB, access string) {
+	stats, _ := db.GetStatistics()
+	for _, table := range recordTables {
+		p.AddTable(table, access, stats[table])
+	}
+}
+
+// planIndexBuild returns the plan of building the search index with
+// --build, --rebuild or --resume
+func planIndexBuild(cfg *config.Config, db *database.DB, dbPath string, rebuild bool) *plan.Plan {
+	p := plan.New("srake index")
+	p.Database = dbPath
+	dbSize, _ := getDirStats(dbPath)
+	p.AddSource("database", dbPath, dbSize)
+	addRecordTables(p, db, plan.AccessRead)
+	p.AddTable("curations", plan.AccessRead, 0)
+
+	indexPath := cfg.Search.IndexPath
+	indexSize, _ := getDirStats(indexPath)
+	_, err := os.Stat(indexPath)
+	exists := err == nil
+	switch {
+	case indexResume:
+		p.AddOutput(indexPath, indexSize)
+		p.AddStep("Resume the interrupted build from the checkpoints in %s", orDefault(checkpointDir, ".srake/checkpoints"))
+		return p
+	case exists && !rebuild && !indexProgress:
+		p.AddStep("Nothing: an index already exists at %s; use --rebuild to replace it", indexPath)
+		return p
+	}
+
+	// A rebuilt index takes about the space of the one it replaces
+	p.AddOutput(indexPath, indexSize)
+	if exists && rebuild {
+		p.AddDestructiveStep("Remove every document of the existing index at %s", indexPath)
+	}
+	stats, _ := db.GetStatistics()
+	counts := make([]string, len(recordTables))
+	for i, table := range recordTables {
+		counts[i] = fmt.Sprintf("%d %s", stats[table], table)
+	}
+	p.AddStep("Index %s in batches of %d with the %s backend", strings.Join(counts, ", "), cfg.Search.BatchSize, orDefault(cfg.Search.Backend, "tiered"))
+	if cfg.Search.Shards > 1 {
+		p.AddStep("Split the index into %d shards by accession hash", cfg.Search.Shards)
+	}
+	if indexEmbeddings {
+		p.AddStep("Generate vector embeddings with %s", embeddingModel)
+	}
+	return p
+}
+
+// planFTSBuild returns the plan of rebuilding the trigram table of --trigram,
+// or the FTS5 tables of --build-fts, in the database
+func planFTSBuild(db *database.DB, dbPath string, trigram bool) *plan.Plan {
+	p := plan.New("srake index")
+	p.Database = dbPath
+	addRecordTables(p, db, plan.AccessRead)
+	if trigram {
+		p.AddTable("submissions", plan.AccessRead, 0)
+		p.AddTable("analyses", plan.AccessRead, 0)
+		p.AddTable("identifiers", plan.AccessRead, 0)
+		p.AddTable("fts_accession_trigram", plan.AccessWrite, 0)
+		p.AddDestructiveStep("Drop fts_accession_trigram")
+		p.AddStep("Recreate it from the accessions and aliases of every record")
+		return p
+	}
+	p.AddTable("fts_samples", plan.AccessWrite, 0)
+	p.AddTable("fts_runs", plan.AccessWrite, 0)
+	p.AddDestructiveStep("Drop fts_samples and fts_runs and their triggers")
+	p.AddStep("Recreate them from the samples and runs, with triggers keeping them current")
+	p.AddStep("Optimize the FTS5 tables")
+	return p
+}
+
+// openPlanDatabase opens the database read-only for a dry run, which must
+// not migrate or otherwise change it
+func openPlanDatabase(dbPath string) (*database.DB, error) {
+	sqlDB, err := sql.Open("sqlite3", dbPath+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	return database.Wrap(sqlDB), nil
+}
+
+// writeFTSPlan prints the plan of --trigram or --build-fts
+func writeFTSPlan(dbPath string, trigram bool) error {
+	db, err := openPlanDatabase(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	return writePlan(planFTSBuild(db, dbPath, trigram))
+}
+
+// planExport returns the plan of exporting the database to an SRAmetadb
+// file at outputPath
+func planExport(db *database.DB, srcPath, outputPath string) *plan.Plan {
+	p := plan.New("srake db export")
+	p.Database = srcPath
+	srcSize, _ := getDirStats(srcPath)
+	p.AddSource("database", srcPath, srcSize)
+
+	// The export holds the same records in about the same space; a
+	// compressed one is too dependent on the data to estimate
+	var estimate int64
+	if !exportCompress {
+		estimate = srcSize
+	}
+	p.AddOutput(outputPath, estimate)
+	p.AddTable("submissions", plan.AccessRead, 0)
+	addRecordTables(p, db, plan.AccessRead)
+
+	if _, err := os.Stat(outputPath); err == nil {
+		p.AddDestructiveStep("Overwrite %s", outputPath)
+	}
+	p.AddStep("Create the SRAmetadb schema in %s.tmp", outputPath)
+	p.AddStep("Copy the submissions, studies, samples, experiments and runs in batches of %d", exportBatchSize)
+	p.AddStep("Build the denormalized sra table")
+	p.AddStep("Build the FTS%d index of the sra table", exportFTSVersion)
+	p.AddStep("Write the metaInfo and col_desc tables")
+	if exportCompress {
+		p.AddStep("Compress the export with gzip to %s", outputPath)
+	} else {
+		p.AddStep("Move the export to %s", outputPath)
+	}
+	return p
+}
+
+// planDump returns the plan of 'srake export', of a --joined export when
+// joined is set, or of a table export optionally limited to the hits of
+// query; output is "" when writing to stdout
+func planDump(ctx context.Context, db *database.DB, dbPath, output, query, format, compression string, joined *export.JoinedOptions) (*plan.Plan, error) {
+	p := plan.New("srake export")
+	p.Database = dbPath
+	dbSize, _ := getDirStats(dbPath)
+	p.AddSource("database", dbPath, dbSize)
+
+	stats, _ := db.GetStatistics()
+	var estimate int64
+	if joined != nil {
+		est, err := export.EstimateJoined(ctx, db.DB, *joined, format, compression)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate export: %v", err)
+		}
+		estimate = est.Bytes
+		p.AddTable("runs", plan.AccessRead, est.Rows)
+		for _, table := range []string{"sample_runs", "samples", "experiments", "studies"} {
+			p.AddTable(table, plan.AccessRead, 0)
+		}
+		if len(joined.Attributes) > 0 {
+			p.AddTable("sample_attributes", plan.AccessRead, 0)
+		}
+	} else {
+		rows := stats[dumpTable]
+		if dumpLimit > 0 && int64(dumpLimit) < rows {
+			rows = int64(dumpLimit)
+		}
+		p.AddTable(dumpTable, plan.AccessRead, rows)
+	}
+
+	if output != "" {
+		p.AddOutput(output, estimate)
+		if _, err := os.Stat(output); err == nil {
+			p.AddDestructiveStep("Overwrite %s", output)
+		}
+	}
+	if query != "" {
+		limit := dumpLimit
+		if limit <= 0 {
+			limit = dumpSearchLimit
+		}
+		p.AddStep("Search the index for %q and keep up to %d matching %s", query, limit, dumpTable)
+	}
+	dest := orDefault(output, "stdout")
+	if joined != nil {
+		p.AddStep("Write the runs joined to their samples, experiments and studies, with %d sample attribute columns, as %s to %s",
+			len(joined.Attributes), format, dest)
+	} else {
+		p.AddStep("Write the %s as %s to %s", dumpTable, format, dest)
+	}
+	if compression != "" && compression != export.CompressNone {
+		p.AddStep("Compress the output with %s", compression)
+	}
+	return p, nil
+}
+
+// writeDatabasePlan prints the plan build returns from the database,
+// opened read-only
+func writeDatabasePlan(build func(db *database.DB, dbPath string) (*plan.Plan, error)) error {
+	if err := checkPlanFormat(); err != nil {
+		return err
+	}
+	dbPath := paths.GetDatabasePath()
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("database not found at %s", dbPath)
+	}
+	db, err := openPlanDatabase(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	p, err := build(db, dbPath)
+	if err != nil {
+		return err
+	}
+	return writePlan(p)
+}
+
+// planDelete returns the plan of deleting a named object, such as a
+// cohort, from table along with its rows in memberTable
+func planDelete(command, dbPath, what, name, table, memberTable, noun string, members int) *plan.Plan {
+	p := plan.New(command)
+	p.Database = dbPath
+	p.AddTable(table, plan.AccessDelete, 1)
+	p.AddTable(memberTable, plan.AccessDelete, int64(members))
+	p.AddDestructiveStep("Delete %s %s and its %d %s", what, name, members, noun)
+	return p
+}
+
+// orDefault returns value, or def when value is empty
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
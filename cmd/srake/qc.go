@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/qc"
+	"github.com/spf13/cobra"
+)
+
+var qcCmd = &cobra.Command{
+	Use:   "qc",
+	Short: "Check the database against quality rules",
+	Long: `Check records against declarative quality rules, such as "RNA-Seq
+experiments must have a transcriptomic library source" or "human samples
+must have a sex attribute", and report the records that violate them.
+
+Rules are YAML. Each applies to one record type (study, experiment, sample
+or run), optionally only to the records matching a 'when' expression, and
+requires its 'check' expression to hold for them. Expressions use the
+syntax of 'srake ingest --filter-expr'. A rules file saved in the rules
+directory adds to the built-in rules and replaces those of the same name;
+set SRAKE_RULES_PATH to share a team's rules.
+
+With --flag, the violations are stored on the records, and search can
+filter on them with 'srake search --qc-flag <rule>'.`,
+	Example: `  srake qc rules
+  srake qc run
+  srake qc run --rule human-sample-sex --limit 0 --format csv > missing-sex.csv
+  srake qc run --rules lab-rules.yaml --flag
+  srake search --qc-flag rnaseq-transcriptomic-source`,
+}
+
+var qcRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Check the database and report rule violations",
+	Args:  cobra.NoArgs,
+	RunE:  runQCRun,
+}
+
+var qcRulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "List the quality rules",
+	Args:  cobra.NoArgs,
+	RunE:  runQCRules,
+}
+
+var qcFlagsCmd = &cobra.Command{
+	Use:   "flags [rule]",
+	Short: "List or clear the records flagged by 'srake qc run --flag'",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runQCFlags,
+}
+
+var (
+	qcRuleNames []string
+	qcRulesFile string
+	qcFlag      bool
+	qcLimit     int
+	qcFormat    string
+	qcClear     bool
+)
+
+func init() {
+	qcRunCmd.Flags().StringSliceVar(&qcRuleNames, "rule", nil, "Check only the rules with these names (repeatable)")
+	qcRunCmd.Flags().StringVar(&qcRulesFile, "rules", "", "Check the rules of a YAML file instead of the built-in and rules directory rules")
+	qcRunCmd.Flags().BoolVar(&qcFlag, "flag", false, "Store the violations on the records, replacing the earlier flags of the rules checked")
+	qcRunCmd.Flags().IntVarP(&qcLimit, "limit", "l", 50, "Maximum violations to list (0 for all)")
+	qcRunCmd.Flags().StringVarP(&qcFormat, "format", "f", "table", "Output format (table|json|csv)")
+
+	qcFlagsCmd.Flags().IntVarP(&qcLimit, "limit", "l", 50, "Maximum flags to list (0 for all)")
+	qcFlagsCmd.Flags().StringVarP(&qcFormat, "format", "f", "table", "Output format (table|json|csv)")
+	qcFlagsCmd.Flags().BoolVar(&qcClear, "clear", false, "Remove the flags of the rule, or all flags")
+
+	qcCmd.AddCommand(qcRunCmd, qcRulesCmd, qcFlagsCmd)
+}
+
+// openQCDB opens the local database for quality checks
+func openQCDB() (*database.DB, error) {
+	dbPath := paths.GetDatabasePath()
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		printError("Database not found at %s", dbPath)
+		return nil, fmt.Errorf("database not found")
+	}
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return db, nil
+}
+
+// loadQCRules returns the rules selected by --rules and --rule
+func loadQCRules() ([]*qc.Rule, error) {
+	var rules []*qc.Rule
+	var err error
+	if qcRulesFile != "" {
+		rules, err = qc.LoadFile(qcRulesFile)
+		qc.Sort(rules)
+	} else {
+		rules, err = qc.List()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(qcRuleNames) > 0 {
+		return qc.Select(rules, qcRuleNames)
+	}
+	return rules, nil
+}
+
+func runQCRun(cmd *cobra.Command, args []string) error {
+	if qcFormat != "table" && qcFormat != "json" && qcFormat != "csv" {
+		return fmt.Errorf("invalid format: %s (must be table, json or csv)", qcFormat)
+	}
+	rules, err := loadQCRules()
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("no rules to check")
+	}
+
+	db, err := openQCDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Flags are written a batch at a time as violations are found; those
+	// this run does not find again are removed at the end
+	run := time.Now().UnixNano()
+	var batch []database.QCFlag
+	var flagged int64
+	writeFlags := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := db.FlagRecords(run, batch); err != nil {
+			return fmt.Errorf("failed to flag records: %v", err)
+		}
+		flagged += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	var violations []qc.Violation
+	var results []qc.Result
+	err = withProgress(qcFormat == "table", fmt.Sprintf("Checking %d rules", len(rules)), func() error {
+		results, err = qc.Run(cmd.Context(), db, rules, func(v qc.Violation) error {
+			if qcLimit <= 0 || len(violations) < qcLimit {
+				violations = append(violations, v)
+			}
+			if !qcFlag {
+				return nil
+			}
+			batch = append(batch, database.QCFlag{
+				Accession:  v.Accession,
+				RecordType: v.RecordType,
+				Rule:       v.Rule,
+				Severity:   v.Severity,
+				Message:    v.Message,
+			})
+			if len(batch) >= 1000 {
+				return writeFlags()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writeFlags()
+	})
+	if err != nil {
+		return err
+	}
+
+	var cleared int64
+	if qcFlag {
+		names := make([]string, len(rules))
+		for i, r := range rules {
+			names[i] = r.Name
+		}
+		if cleared, err = db.ClearStaleFlags(run, names); err != nil {
+			return fmt.Errorf("failed to clear flags: %v", err)
+		}
+	}
+
+	var total int64
+	for _, r := range results {
+		total += r.Violations
+	}
+
+	switch qcFormat {
+	case "json":
+		if violations == nil {
+			violations = []qc.Violation{}
+		}
+		return printJSON(map[string]interface{}{
+			"rules":      results,
+			"violations": violations,
+			"total":      total,
+		})
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"accession", "record_type", "rule", "severity", "message"})
+		for _, v := range violations {
+			w.Write([]string{v.Accession, v.RecordType, v.Rule, v.Severity, v.Message})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tRECORD\tSEVERITY\tCHECKED\tVIOLATIONS")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", r.Rule, r.Record, r.Severity, r.Checked, r.Violations)
+	}
+	w.Flush()
+
+	if len(violations) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCESSION\tRULE\tMESSAGE")
+		for _, v := range violations {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", v.Accession, v.Rule, v.Message)
+		}
+		w.Flush()
+		if int64(len(violations)) < total {
+			printInfo("Showing %d of %d violations; use --limit 0 to list them all", len(violations), total)
+		}
+	}
+
+	if qcFlag {
+		printSuccess("Flagged %d records; cleared %d flags that no longer apply", flagged, cleared)
+		printInfo("Search them with 'srake search --qc-flag <rule>' once the index is rebuilt or synced")
+	} else if total == 0 {
+		printSuccess("No violations")
+	}
+	return nil
+}
+
+func runQCRules(cmd *cobra.Command, args []string) error {
+	rules, err := qc.List()
+	if err != nil {
+		return err
+	}
+	fmt.Println(colorize(colorBold, "Rules:"))
+	for _, r := range rules {
+		fmt.Printf("  %-32s %-10s %-8s %s\n", colorize(colorCyan, r.Name), r.Record, r.Severity, r.Description)
+		if r.When != "" {
+			fmt.Printf("  %-32s %s\n", "", colorize(colorGray, "when:  "+r.When))
+		}
+		fmt.Printf("  %-32s %s\n", "", colorize(colorGray, "check: "+r.Check))
+		if r.Source != qc.Builtin {
+			fmt.Printf("  %-32s from %s\n", "", r.Source)
+		}
+	}
+	fmt.Printf("\nRules directory: %s\n", paths.GetRulesPath())
+	fmt.Println("Run 'srake qc run' to check the database against them.")
+	return nil
+}
+
+func runQCFlags(cmd *cobra.Command, args []string) error {
+	if qcFormat != "table" && qcFormat != "json" && qcFormat != "csv" {
+		return fmt.Errorf("invalid format: %s (must be table, json or csv)", qcFormat)
+	}
+	rule := ""
+	if len(args) == 1 {
+		rule = args[0]
+	}
+
+	db, err := openQCDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if qcClear {
+		cleared, err := db.ClearFlags(rule)
+		if err != nil {
+			return fmt.Errorf("failed to clear flags: %v", err)
+		}
+		printSuccess("Cleared %d flags", cleared)
+		return nil
+	}
+
+	flags, err := db.ListFlags(rule, qcLimit)
+	if err != nil {
+		return fmt.Errorf("failed to list flags: %v", err)
+	}
+	switch qcFormat {
+	case "json":
+		if flags == nil {
+			flags = []database.QCFlag{}
+		}
+		return printJSON(flags)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"accession", "record_type", "rule", "severity", "message", "flagged_at"})
+		for _, f := range flags {
+			w.Write([]string{f.Accession, f.RecordType, f.Rule, f.Severity, f.Message, f.FlaggedAt.Format(time.RFC3339)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	if len(flags) == 0 {
+		printInfo("No flagged records; flag them with 'srake qc run --flag'")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCESSION\tRULE\tSEVERITY\tFLAGGED\tMESSAGE")
+	for _, f := range flags {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Accession, f.Rule, f.Severity, f.FlaggedAt.Format("2006-01-02"), f.Message)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/spf13/cobra"
+)
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine [accession]",
+	Short: "List the records 'srake ingest --validate' quarantined",
+	Long: `List the records that failed validation during 'srake ingest --validate'
+and were quarantined instead of inserted, newest first, with the errors
+they failed on.
+
+Given an accession, its quarantined copies are listed; --xml prints their
+original XML instead, for fixing and ingesting again. --ingest lists only
+the records of one ingest. --clear removes the quarantined records, of one
+ingest with --ingest.`,
+	Example: `  srake quarantine
+  srake quarantine SRX123456 --xml
+  srake quarantine --format json --limit 0 > quarantine.json
+  srake quarantine --clear`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runQuarantine,
+}
+
+var (
+	quarantineIngest string
+	quarantineLimit  int
+	quarantineFormat string
+	quarantineXML    bool
+	quarantineClear  bool
+)
+
+func init() {
+	quarantineCmd.Flags().StringVar(&quarantineIngest, "ingest", "", "Only the records of this ingest ID")
+	quarantineCmd.Flags().IntVarP(&quarantineLimit, "limit", "l", 50, "Maximum records to list (0 for all)")
+	quarantineCmd.Flags().StringVarP(&quarantineFormat, "format", "f", "table", "Output format (table|json)")
+	quarantineCmd.Flags().BoolVar(&quarantineXML, "xml", false, "Print the original XML of the records instead")
+	quarantineCmd.Flags().BoolVar(&quarantineClear, "clear", false, "Remove the quarantined records, of one ingest with --ingest")
+}
+
+func runQuarantine(cmd *cobra.Command, args []string) error {
+	if quarantineFormat != "table" && quarantineFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", quarantineFormat)
+	}
+	accession := ""
+	if len(args) == 1 {
+		accession = strings.ToUpper(args[0])
+	}
+	if quarantineClear && accession != "" {
+		return fmt.Errorf("--clear removes whole ingests; use --ingest to pick one")
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if quarantineClear {
+		cleared, err := db.ClearQuarantine(quarantineIngest)
+		if err != nil {
+			return fmt.Errorf("failed to clear quarantined records: %v", err)
+		}
+		printSuccess("Cleared %d quarantined records", cleared)
+		return nil
+	}
+
+	records, err := db.ListQuarantine(quarantineIngest, accession, quarantineLimit)
+	if err != nil {
+		return fmt.Errorf("failed to list quarantined records: %v", err)
+	}
+	if quarantineXML {
+		if len(records) == 0 {
+			return fmt.Errorf("no quarantined records found")
+		}
+		for _, r := range records {
+			fmt.Printf("%s\n", r.XML)
+		}
+		return nil
+	}
+	if quarantineFormat == "json" {
+		if records == nil {
+			records = []database.QuarantinedRecord{}
+		}
+		return printJSON(records)
+	}
+
+	if len(records) == 0 {
+		printInfo("No quarantined records; records are validated with 'srake ingest --validate'")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCESSION\tTYPE\tINGEST\tFILE\tQUARANTINED\tERRORS")
+	for _, r := range records {
+		var errs []string
+		for _, e := range r.Errors {
+			errs = append(errs, e.Type+": "+e.Message)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Accession, r.RecordType, r.IngestID, r.SourceFile,
+			r.QuarantinedAt.Local().Format("2006-01-02 15:04"), strings.Join(errs, "; "))
+	}
+	return w.Flush()
+}
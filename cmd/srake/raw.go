@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/spf13/cobra"
+)
+
+var rawCmd = &cobra.Command{
+	Use:   "raw <accession> [accessions...]",
+	Short: "Print the original XML of records",
+	Long: `Print the original XML of records exactly as it appeared in the ingested
+archive, including fields srake does not extract.
+
+Raw XML is only available for records ingested with 'srake ingest --store-raw'.
+It is stored compressed and content-addressed, so identical records from
+different archives take space once.
+
+With --partial, each argument is treated as a fragment of an accession or alias.`,
+	Example: `  srake raw SRX123456
+  srake raw SRR999999 SRR999998 -o runs.xml
+  srake raw SRP123456 --info
+  srake raw 123456 --partial --info`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runRaw,
+}
+
+var (
+	rawOutput string
+	rawInfo   bool
+)
+
+func init() {
+	rawCmd.Flags().StringVarP(&rawOutput, "output", "o", "", "Output file (default: stdout)")
+	rawCmd.Flags().BoolVar(&rawInfo, "info", false, "Show storage details instead of the XML")
+	rawCmd.Flags().BoolVar(&partialLookup, "partial", false, "Match accessions and aliases containing the given fragments")
+	rawCmd.Flags().IntVar(&partialLookupLimit, "partial-limit", 20, "Maximum matches per fragment with --partial")
+}
+
+func runRaw(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	accessions := args
+	if partialLookup {
+		accessions = resolvePartialAccessions(db, args, partialLookupLimit)
+		if len(accessions) == 0 {
+			return fmt.Errorf("no accessions match %s", strings.Join(args, ", "))
+		}
+	} else {
+		accessions = resolveInternalIDs(db, args)
+	}
+
+	out := os.Stdout
+	if rawOutput != "" {
+		out, err = os.Create(rawOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer out.Close()
+	}
+
+	failed := 0
+	for _, acc := range accessions {
+		info, xml, err := db.GetRawRecord(strings.ToUpper(acc))
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				printError("No raw XML stored for %s (ingest with --store-raw to keep it)", acc)
+			} else {
+				printError("Failed to read raw XML for %s: %v", acc, err)
+			}
+			failed++
+			continue
+		}
+
+		if rawInfo {
+			fmt.Fprintf(out, "%s %s\n", colorize(colorBold, "Accession:"), info.Accession)
+			fmt.Fprintf(out, "%s %s\n", colorize(colorBold, "Type:"), info.RecordType)
+			fmt.Fprintf(out, "%s %s\n", colorize(colorBold, "Hash:"), info.Hash)
+			fmt.Fprintf(out, "%s %s (%s stored, %s)\n", colorize(colorBold, "Size:"),
+				downloader.FormatSize(info.Size), downloader.FormatSize(info.StoredSize), info.Codec)
+			fmt.Fprintf(out, "%s %s\n\n", colorize(colorBold, "Updated:"), info.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+			continue
+		}
+		fmt.Fprintf(out, "%s\n", xml)
+	}
+
+	if failed == len(accessions) {
+		return fmt.Errorf("no raw records found")
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/search"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var recommendCmd = &cobra.Command{
+	Use:   "recommend <study-accession>",
+	Short: "Recommend comparable studies",
+	Long: `Recommend studies comparable to a study, for literature-style discovery of
+datasets.
+
+Studies are ranked by shared cross-references (the same BioProject or other
+external identifier, the same PubMed publication or database link, samples
+from the same cell line) and, when the search index has embeddings, by
+similarity of their titles and abstracts. Each recommendation explains why it
+was suggested.`,
+	Example: `  # Recommend studies related to a study
+  srake recommend SRP123456
+
+  # Cross-references only, as JSON
+  srake recommend SRP123456 --no-semantic --format json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRecommend,
+}
+
+var (
+	recommendLimit      int
+	recommendFormat     string
+	recommendNoSemantic bool
+)
+
+func init() {
+	recommendCmd.Flags().IntVarP(&recommendLimit, "limit", "l", 10, "Maximum number of recommendations")
+	recommendCmd.Flags().StringVarP(&recommendFormat, "format", "f", "table", "Output format (table|json)")
+	recommendCmd.Flags().BoolVar(&recommendNoSemantic, "no-semantic", false, "Skip embedding similarity")
+}
+
+func runRecommend(cmd *cobra.Command, args []string) error {
+	accession := strings.ToUpper(args[0])
+	if accType := detectAccessionType(accession); accType != "study" {
+		return fmt.Errorf("recommendations require a study accession, got %s", accType)
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var similar service.SimilarFinder
+	if !recommendNoSemantic {
+		cfg := config.DefaultConfig()
+		cfg.DataDirectory = paths.GetPaths().DataDir
+		cfg.Search.Enabled = true
+		cfg.Search.IndexPath = paths.GetIndexPath()
+
+		manager, err := search.NewManager(cfg, db)
+		if err != nil {
+			printWarning("Search index unavailable, using cross-references only: %v", err)
+		} else {
+			defer manager.Close()
+			similar = manager
+		}
+	}
+
+	resp, err := service.NewRecommendService(db, similar).Recommend(context.Background(), &service.RecommendRequest{
+		Accession: accession,
+		Limit:     recommendLimit,
+		Semantic:  !recommendNoSemantic,
+	})
+	if err != nil {
+		return err
+	}
+
+	if recommendFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(resp)
+	}
+
+	if resp.Note != "" && !quiet {
+		printWarning("%s", resp.Note)
+	}
+	if len(resp.Recommendations) == 0 {
+		printInfo("No related studies found for %s", accession)
+		return nil
+	}
+
+	fmt.Printf("%s %s\n\n", colorize(colorBold, "Studies related to"), colorize(colorCyan, accession))
+	for i, rec := range resp.Recommendations {
+		fmt.Printf("%2d. %s  %s\n", i+1, colorize(colorCyan, rec.Accession), truncateStr(rec.Title, 70))
+		fmt.Printf("    %s %s\n", colorize(colorGray, fmt.Sprintf("score %.2f:", rec.Score)), strings.Join(rec.Reasons, "; "))
+	}
+	return nil
+}
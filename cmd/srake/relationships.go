@@ -20,7 +20,8 @@ var (
 		Use:   "runs <accession>",
 		Short: "Get all runs for a study, experiment, or sample",
 		Long: `Retrieve all run accessions associated with a given study (SRP),
-experiment (SRX), or sample (SRS) accession.`,
+experiment (SRX), or sample (SRS) accession, or an internal ID imported with
+'srake idmap import'.`,
 		Example: `  # Get all runs for a study
   srake runs SRP123456
 
@@ -37,7 +38,8 @@ experiment (SRX), or sample (SRS) accession.`,
 		Use:   "samples <accession>",
 		Short: "Get all samples for a study or experiment",
 		Long: `Retrieve all sample accessions associated with a given study (SRP)
-or experiment (SRX) accession.`,
+or experiment (SRX) accession, or an internal ID imported with
+'srake idmap import'.`,
 		Example: `  # Get all samples for a study
   srake samples SRP123456
 
@@ -51,7 +53,8 @@ or experiment (SRX) accession.`,
 		Use:   "experiments <accession>",
 		Short: "Get all experiments for a study or sample",
 		Long: `Retrieve all experiment accessions associated with a given study (SRP)
-or sample (SRS) accession.`,
+or sample (SRS) accession, or an internal ID imported with
+'srake idmap import'.`,
 		Example: `  # Get all experiments for a study
   srake experiments SRP123456
 
@@ -65,7 +68,8 @@ or sample (SRS) accession.`,
 		Use:   "studies <accession>",
 		Short: "Get study information for any SRA accession",
 		Long: `Retrieve the parent study (SRP) for any SRA accession type
-(experiment, sample, run).`,
+(experiment, sample, run), or an internal ID imported with
+'srake idmap import'.`,
 		Example: `  # Get study for an experiment
   srake studies SRX123456
 
@@ -124,6 +128,16 @@ func runGetRuns(cmd *cobra.Command, args []string) error {
 	}
 	defer db.Close()
 
+	if err := includeArchivedRuns(cmd, db); err != nil {
+		return err
+	}
+
+	// Internal IDs from 'srake idmap import' stand for their accession
+	accession, err = resolveInternalAccession(db, accession)
+	if err != nil {
+		return err
+	}
+
 	// Determine query based on accession type
 	var query string
 	switch {
@@ -146,19 +160,22 @@ func runGetRuns(cmd *cobra.Command, args []string) error {
 			WHERE r.experiment_accession = ?`
 
 	case strings.HasPrefix(accession, "SRS"):
-		// Get runs for a sample
+		// Get runs for a sample via the denormalized sample_runs table
 		query = `
 			SELECT r.run_accession, r.experiment_accession, r.total_spots,
 			       r.total_bases, r.published, e.platform, e.library_strategy
-			FROM runs r
-			JOIN experiments e ON r.experiment_accession = e.experiment_accession
-			JOIN experiment_samples es ON e.experiment_accession = es.experiment_accession
-			WHERE es.sample_accession = ?`
+			FROM sample_runs sr
+			JOIN runs r ON r.run_accession = sr.run_accession
+			LEFT JOIN experiments e ON r.experiment_accession = e.experiment_accession
+			WHERE sr.sample_accession = ?`
 
 	default:
 		return fmt.Errorf("unsupported accession type: %s", accession)
 	}
 
+	// Order by accession, the first column, so that limits are stable
+	query += " ORDER BY 1"
+
 	// Add limit if specified
 	if relLimit > 0 {
 		query += fmt.Sprintf(" LIMIT %d", relLimit)
@@ -222,6 +239,16 @@ func runGetSamples(cmd *cobra.Command, args []string) error {
 	}
 	defer db.Close()
 
+	if err := includeArchivedRuns(cmd, db); err != nil {
+		return err
+	}
+
+	// Internal IDs from 'srake idmap import' stand for their accession
+	accession, err = resolveInternalAccession(db, accession)
+	if err != nil {
+		return err
+	}
+
 	// Determine query based on accession type
 	var query string
 	switch {
@@ -248,6 +275,9 @@ func runGetSamples(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("unsupported accession type: %s", accession)
 	}
 
+	// Order by accession, the first column, so that limits are stable
+	query += " ORDER BY 1"
+
 	// Add limit if specified
 	if relLimit > 0 {
 		query += fmt.Sprintf(" LIMIT %d", relLimit)
@@ -322,6 +352,16 @@ func runGetExperiments(cmd *cobra.Command, args []string) error {
 	}
 	defer db.Close()
 
+	if err := includeArchivedRuns(cmd, db); err != nil {
+		return err
+	}
+
+	// Internal IDs from 'srake idmap import' stand for their accession
+	accession, err = resolveInternalAccession(db, accession)
+	if err != nil {
+		return err
+	}
+
 	// Determine query based on accession type
 	var query string
 	switch {
@@ -346,6 +386,9 @@ func runGetExperiments(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("unsupported accession type: %s", accession)
 	}
 
+	// Order by accession, the first column, so that limits are stable
+	query += " ORDER BY 1"
+
 	// Add limit if specified
 	if relLimit > 0 {
 		query += fmt.Sprintf(" LIMIT %d", relLimit)
@@ -423,6 +466,16 @@ func runGetStudies(cmd *cobra.Command, args []string) error {
 	}
 	defer db.Close()
 
+	if err := includeArchivedRuns(cmd, db); err != nil {
+		return err
+	}
+
+	// Internal IDs from 'srake idmap import' stand for their accession
+	accession, err = resolveInternalAccession(db, accession)
+	if err != nil {
+		return err
+	}
+
 	// Determine query based on accession type
 	var query string
 	switch {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report on how the catalog is used",
+}
+
+var reportPopularCmd = &cobra.Command{
+	Use:   "popular",
+	Short: "List the studies and runs returned and fetched most often",
+	Long: `List the studies and runs the API server returned in search results and
+served on their own most often, most popular first.
+
+Counts are kept only by servers started with --track-popularity or with
+server.popularity.enabled set in the config, and are saved every
+server.popularity.flush_interval seconds.`,
+	Example: `  # The 20 most popular records of the last 30 days
+  srake report popular
+
+  # The 50 most popular studies ever
+  srake report popular --type study --days 0 --limit 50`,
+	Args: cobra.NoArgs,
+	RunE: runReportPopular,
+}
+
+var (
+	reportType  string
+	reportDays  int
+	reportLimit int
+	reportJSON  bool
+)
+
+func init() {
+	reportPopularCmd.Flags().StringVar(&reportType, "type", "", "Only list records of this type: study or run")
+	reportPopularCmd.Flags().IntVar(&reportDays, "days", 30, "Count the last N days (0 for all time)")
+	reportPopularCmd.Flags().IntVar(&reportLimit, "limit", 20, "Maximum records to list")
+	reportPopularCmd.Flags().BoolVar(&reportJSON, "json", false, "Output as JSON")
+
+	reportCmd.AddCommand(reportPopularCmd)
+}
+
+func runReportPopular(cmd *cobra.Command, args []string) error {
+	if reportType != "" && reportType != "study" && reportType != "run" {
+		return fmt.Errorf("invalid --type %q: expected study or run", reportType)
+	}
+	if reportLimit < 1 {
+		return fmt.Errorf("--limit must be at least 1")
+	}
+	var since time.Time
+	if reportDays > 0 {
+		since = time.Now().AddDate(0, 0, -(reportDays - 1))
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	popular, err := db.PopularRecords(reportType, since, reportLimit)
+	if err != nil {
+		return fmt.Errorf("failed to list popular records: %v", err)
+	}
+	if reportJSON {
+		if popular == nil {
+			popular = []database.PopularityCount{}
+		}
+		return printJSON(popular)
+	}
+	if len(popular) == 0 {
+		printInfo("No popularity counted (start the server with --track-popularity)")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", colorize(colorBold, "ACCESSION"), colorize(colorBold, "TYPE"),
+		colorize(colorBold, "RETURNED"), colorize(colorBold, "FETCHED"))
+	for _, p := range popular {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", colorize(colorCyan, p.Accession), p.RecordType, p.Returned, p.Fetched)
+	}
+	return w.Flush()
+}
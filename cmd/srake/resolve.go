@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishad/srake/internal/converter"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve <accession>...",
+	Short: "List the SRA records linked to a BioSample, BioProject or GEO accession",
+	Long: `List the SRA studies, experiments, samples and runs linked to BioSample
+(SAMN, SAMEA, SAMD), BioProject (PRJNA, PRJEB, PRJDB) or GEO series and
+sample (GSE, GSM) accessions.
+
+A BioSample resolves to the samples naming it, with their experiments, runs
+and studies. A BioProject resolves to the studies naming it, with all their
+records, and to the samples naming it in their attributes. A GEO accession
+resolves to the records carrying it as an alias or identifier, usually a
+study for a series and a sample or experiment for a GEO sample, and the
+records related to them.
+
+Links are read from the identifiers and attributes of ingested records.
+With --geo, the title, organism and sample count of GEO series are also
+fetched from NCBI E-utilities.`,
+	Example: `  srake resolve SAMN12345678
+  srake resolve PRJNA123456 --format json
+  srake resolve GSE123456 --geo
+  srake resolve SAMN12345678 SAMEA1234567`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runResolve,
+}
+
+var (
+	resolveFormat string
+	resolveGEO    bool
+)
+
+func init() {
+	resolveCmd.Flags().StringVarP(&resolveFormat, "format", "f", "table", "Output format (table|json)")
+	resolveCmd.Flags().BoolVar(&resolveGEO, "geo", false, "Fetch the summary of GEO series from NCBI E-utilities")
+}
+
+// resolveResult is the records linked to an accession and, with --geo, the
+// summary of the GEO series it names
+type resolveResult struct {
+	*database.ExternalLinks
+	GEO *converter.GEOSeries `json:"geo,omitempty"`
+}
+
+func runResolve(cmd *cobra.Command, args []string) error {
+	if resolveFormat != "table" && resolveFormat != "json" {
+		return fmt.Errorf("invalid format: %s (must be table or json)", resolveFormat)
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	svc := service.NewMetadataService(db)
+	client := &http.Client{Timeout: 30 * time.Second}
+	results := []resolveResult{}
+	missing := 0
+	for _, accession := range args {
+		accession = strings.ToUpper(strings.TrimSpace(accession))
+		links, err := svc.Resolve(ctx, accession)
+		linked := err == nil
+		if err != nil {
+			if !strings.Contains(err.Error(), "not found") {
+				return err
+			}
+			printWarning("No records linked to %s", accession)
+			missing++
+			links = &database.ExternalLinks{Accession: accession, Type: database.ExternalAccessionType(accession)}
+		}
+		result := resolveResult{ExternalLinks: links}
+		if resolveGEO && links.Type == database.XrefGEOSeries {
+			if result.GEO, err = converter.FetchGEOSeries(ctx, client, accession); err != nil {
+				printWarning("Failed to fetch %s from GEO: %v", accession, err)
+			}
+		}
+		// A series unknown locally is still worth its GEO summary
+		if linked || result.GEO != nil {
+			results = append(results, result)
+		}
+	}
+
+	if resolveFormat == "json" {
+		if len(args) == 1 && len(results) == 1 {
+			return printJSON(results[0])
+		}
+		return printJSON(results)
+	}
+
+	for _, r := range results {
+		if r.GEO != nil {
+			printGEOSeries(r.GEO)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := false
+	for _, r := range results {
+		for _, group := range []struct {
+			kind       string
+			accessions []string
+		}{
+			{"study", r.Studies},
+			{"experiment", r.Experiments},
+			{"sample", r.Samples},
+			{"run", r.Runs},
+		} {
+			for _, acc := range group.accessions {
+				if !header {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", colorize(colorBold, "ACCESSION"), colorize(colorBold, "TYPE"),
+						colorize(colorBold, "LINKED"), colorize(colorBold, "RECORD TYPE"))
+					header = true
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Accession, r.Type, colorize(colorCyan, acc), group.kind)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if missing == len(args) && len(results) == 0 {
+		return fmt.Errorf("no records linked to %s", strings.Join(args, ", "))
+	}
+	return nil
+}
+
+// printGEOSeries prints the summary of a GEO series fetched with --geo
+func printGEOSeries(s *converter.GEOSeries) {
+	fmt.Printf("%s  %s\n", colorize(colorBold, s.Accession), s.Title)
+	if s.Organism != "" {
+		fmt.Printf("  Organism:   %s\n", s.Organism)
+	}
+	if s.Type != "" {
+		fmt.Printf("  Type:       %s\n", s.Type)
+	}
+	fmt.Printf("  Samples:    %d\n", s.Samples)
+	if s.Published != "" {
+		fmt.Printf("  Published:  %s\n", s.Published)
+	}
+	if s.BioProject != "" {
+		fmt.Printf("  BioProject: %s\n", s.BioProject)
+	}
+	fmt.Println()
+}
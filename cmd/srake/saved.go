@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/plan"
+	"github.com/nishad/srake/internal/search"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var savedCmd = &cobra.Command{
+	Use:   "saved",
+	Short: "Run saved searches and watch them for new records",
+	Long: `Manage the searches saved with 'srake search --save <name>'.
+
+A saved search stores its query and filter flags in the local database.
+'srake saved run' runs it again with the output flags of 'srake search',
+and 'srake saved watch' runs every saved search and reports the records
+none of its earlier runs matched, such as datasets published since the
+last ingest. Saving a search records what it matches at that time, so the
+first watch only reports records added after it was saved.
+
+With --interval, watch keeps running and checks the saved searches again
+each time the database changes, so it can follow scheduled ingests. New
+records are found through the search index, which must be rebuilt or
+synced after an ingest for them to appear.`,
+	Example: `  # Save a search while running it
+  srake search "single cell liver" --organism "homo sapiens" --save liver-sc
+
+  # Run it again later
+  srake saved run liver-sc --format csv --limit 0
+
+  # Report records matched since the last watch
+  srake saved watch
+
+  # Check after every ingest, once an hour
+  srake saved watch --interval 1h`,
+}
+
+var savedListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved searches",
+	Args:  cobra.NoArgs,
+	RunE:  runSavedList,
+}
+
+var savedRunCmd = &cobra.Command{
+	Use:   "run <name>",
+	Short: "Run a saved search",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSavedRun,
+}
+
+var savedDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a saved search",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSavedDelete,
+}
+
+var savedWatchCmd = &cobra.Command{
+	Use:   "watch [name...]",
+	Short: "Run saved searches and report records they did not match before",
+	RunE:  runSavedWatch,
+}
+
+var (
+	savedJSON     bool
+	savedInterval time.Duration
+)
+
+// savedNamePattern restricts saved search names like collection names
+var savedNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// savedSearchFlags are the 'srake search' flags stored with a saved search
+var savedSearchFlags = []string{
+	"organism", "platform", "library-strategy", "library-source", "library-selection",
+	"library-layout", "study-type", "instrument-model", "attribute-range", "taxon",
+	"include-descendants", "date-from", "date-to", "spots-min", "spots-max",
+	"bases-min", "bases-max", "collection", "qc-flag",
+}
+
+func init() {
+	// The output flags of 'srake search' apply to the results of run
+	savedRunCmd.Flags().IntVarP(&searchLimit, "limit", "l", 100, "Maximum results to return (0 for all with --format ndjson)")
+	savedRunCmd.Flags().IntVar(&searchOffset, "offset", 0, "Number of results to skip")
+	savedRunCmd.Flags().StringVarP(&searchFormat, "format", "f", "table", "Output format (table|json|ndjson|csv|tsv)")
+	savedRunCmd.Flags().StringVar(&searchOutput, "output", "", "Save results to file")
+	savedRunCmd.Flags().BoolVar(&searchNoHeader, "no-header", false, "Omit header in output")
+	savedRunCmd.Flags().StringVar(&searchFields, "fields", "", "Comma-separated list of fields to display")
+
+	savedWatchCmd.Flags().DurationVar(&savedInterval, "interval", 0, "Keep watching, checking for database changes at this interval (0 checks once)")
+
+	for _, cmd := range []*cobra.Command{savedListCmd, savedWatchCmd} {
+		cmd.Flags().BoolVar(&savedJSON, "json", false, "Output as JSON")
+	}
+
+	savedCmd.AddCommand(savedListCmd, savedRunCmd, savedDeleteCmd, savedWatchCmd)
+}
+
+// saveSearch stores the query and the filter flags of a search under name,
+// with the records it matches now when the index exists
+func saveSearch(cmd *cobra.Command, name, query string) error {
+	if !savedNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid saved search name %q: it must start with a letter or digit and contain only letters, digits, '.', '_' or '-'", name)
+	}
+	filters := make(map[string]string)
+	for _, flag := range savedSearchFlags {
+		if f := cmd.Flags().Lookup(flag); f != nil && f.Changed {
+			filters[flag] = f.Value.String()
+		}
+	}
+	if strings.TrimSpace(query) == "" && len(filters) == 0 {
+		return fmt.Errorf("--save needs a query or filters")
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	saved := &database.SavedSearch{Name: name, Query: query, Filters: filters}
+	if _, err := db.GetSavedSearch(name); err == nil {
+		return fmt.Errorf("saved search %s already exists (delete it with 'srake saved delete %s')", name, name)
+	}
+	if err := db.SaveSearch(saved, false); err != nil {
+		return fmt.Errorf("failed to save search: %v", err)
+	}
+
+	// The search results go to stdout, so the notes go to stderr
+	if _, err := os.Stat(paths.GetIndexPath()); err != nil {
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "Saved search %s; its first watch will record what it matches\n", name)
+		}
+		return nil
+	}
+	results, err := watchSavedSearches(db, cmd.Flags(), []database.SavedSearch{*saved})
+	if err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Saved search %s (%d records matched now)\n", name, results[0].Matched)
+	}
+	return nil
+}
+
+// applySavedSearch sets the filter flags of a saved search on the flags
+// of the search command, clearing those it does not set
+func applySavedSearch(flags *pflag.FlagSet, s *database.SavedSearch) error {
+	for _, name := range savedSearchFlags {
+		f := flags.Lookup(name)
+		if err := f.Value.Set(f.DefValue); err != nil {
+			return err
+		}
+		f.Changed = false
+	}
+	for name, value := range s.Filters {
+		if !slices.Contains(savedSearchFlags, name) {
+			return fmt.Errorf("saved search %s: unknown filter %q", s.Name, name)
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("saved search %s: invalid %s: %v", s.Name, name, err)
+		}
+	}
+	return nil
+}
+
+func runSavedList(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	searches, err := db.ListSavedSearches()
+	if err != nil {
+		return fmt.Errorf("failed to list saved searches: %v", err)
+	}
+
+	if savedJSON {
+		if searches == nil {
+			searches = []database.SavedSearch{}
+		}
+		return printJSON(searches)
+	}
+	if len(searches) == 0 {
+		printInfo("No saved searches; save one with 'srake search <query> --save <name>'")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSEEN\tLAST WATCHED\tQUERY")
+	for _, s := range searches {
+		watched := "never"
+		if !s.LastRunAt.IsZero() {
+			watched = s.LastRunAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", s.Name, s.Seen, watched, truncateStr(formatSavedSearch(&s), 60))
+	}
+	return w.Flush()
+}
+
+func runSavedRun(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	s, err := db.GetSavedSearch(args[0])
+	db.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := applySavedSearch(searchCmd.Flags(), s); err != nil {
+		return err
+	}
+	var searchArgs []string
+	if s.Query != "" {
+		searchArgs = []string{s.Query}
+	}
+	return runSearch(searchCmd, searchArgs)
+}
+
+func runSavedDelete(cmd *cobra.Command, args []string) error {
+	if dryRun {
+		return writeDatabasePlan(func(db *database.DB, dbPath string) (*plan.Plan, error) {
+			s, err := db.GetSavedSearch(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return planDelete("srake saved delete", dbPath, "saved search", s.Name, "saved_searches", "saved_search_hits", "recorded hits", s.Seen), nil
+		})
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.DeleteSavedSearch(args[0]); err != nil {
+		return err
+	}
+	printSuccess("Deleted saved search %s", args[0])
+	return nil
+}
+
+// savedWatchResult is the outcome of one watch run of a saved search
+type savedWatchResult struct {
+	Name    string                    `json:"name"`
+	Matched int                       `json:"matched"`
+	New     []database.SavedSearchHit `json:"new"`
+	First   bool                      `json:"first,omitempty"` // the search was never watched, so nothing is new
+	titles  map[string]string
+}
+
+func runSavedWatch(cmd *cobra.Command, args []string) error {
+	if savedInterval < 0 {
+		return fmt.Errorf("--interval must not be negative")
+	}
+	if _, err := os.Stat(paths.GetIndexPath()); os.IsNotExist(err) {
+		return fmt.Errorf("search index not found at %s (build it with 'srake index --build')", paths.GetIndexPath())
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var last *database.Generation
+	for {
+		generation, err := db.GetGeneration()
+		if err != nil {
+			return fmt.Errorf("failed to read database generation: %v", err)
+		}
+		// Between checks, the searches only run again once the database changed
+		if last == nil || generation.Records != last.Records || !generation.UpdatedAt.Equal(last.UpdatedAt) {
+			last = generation
+			if err := watchOnce(db, args); err != nil {
+				return err
+			}
+		}
+
+		if savedInterval == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(savedInterval):
+		}
+	}
+}
+
+// watchOnce runs the saved searches named, or all of them, and prints the
+// records each matched for the first time
+func watchOnce(db *database.DB, names []string) error {
+	var searches []database.SavedSearch
+	if len(names) == 0 {
+		all, err := db.ListSavedSearches()
+		if err != nil {
+			return fmt.Errorf("failed to list saved searches: %v", err)
+		}
+		searches = all
+	}
+	for _, name := range names {
+		s, err := db.GetSavedSearch(name)
+		if err != nil {
+			return err
+		}
+		searches = append(searches, *s)
+	}
+	if len(searches) == 0 {
+		printInfo("No saved searches; save one with 'srake search <query> --save <name>'")
+		return nil
+	}
+
+	results, err := watchSavedSearches(db, searchCmd.Flags(), searches)
+	if err != nil {
+		return err
+	}
+
+	if savedJSON {
+		return printJSON(results)
+	}
+	if savedInterval > 0 {
+		fmt.Printf("%s %s\n", colorize(colorBold, "Checked:"), time.Now().Format("2006-01-02 15:04"))
+	}
+	for _, r := range results {
+		if r.First {
+			fmt.Printf("%s %s\n", colorize(colorCyan, r.Name), colorize(colorGray, fmt.Sprintf("first watch, recorded %d matching records", r.Matched)))
+			continue
+		}
+		if len(r.New) == 0 {
+			fmt.Printf("%s %s\n", colorize(colorCyan, r.Name), colorize(colorGray, fmt.Sprintf("no new records (%d matched)", r.Matched)))
+			continue
+		}
+		fmt.Printf("%s %s\n", colorize(colorCyan, r.Name), colorize(colorBold, fmt.Sprintf("%d new records (%d matched)", len(r.New), r.Matched)))
+		for _, hit := range r.New {
+			fmt.Printf("  %s %s %s %s\n", colorize(colorGreen, "+"), hit.Accession,
+				colorize(colorGray, hit.RecordType), truncateStr(r.titles[hit.Accession], 70))
+		}
+	}
+	return nil
+}
+
+// watchSavedSearches runs saved searches against the search index, setting
+// their filters on the search command flags, and records what they match.
+// It returns the records each matched for the first time; nothing is new
+// to a search never watched before.
+func watchSavedSearches(db *database.DB, flags *pflag.FlagSet, searches []database.SavedSearch) ([]savedWatchResult, error) {
+	generation, err := db.GetGeneration()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database generation: %v", err)
+	}
+	idx, err := search.InitBleveIndex(paths.GetIndexPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index: %v", err)
+	}
+	defer idx.Close()
+
+	results := make([]savedWatchResult, 0, len(searches))
+	for i := range searches {
+		s := &searches[i]
+		if err := applySavedSearch(flags, s); err != nil {
+			return nil, err
+		}
+		filters, err := searchFilters()
+		if err != nil {
+			return nil, fmt.Errorf("saved search %s: %v", s.Name, err)
+		}
+		var ids []string
+		if searchCollection != "" {
+			if ids, err = loadCollectionAccessions(searchCollection); err != nil {
+				return nil, fmt.Errorf("saved search %s: %v", s.Name, err)
+			}
+		}
+
+		result := savedWatchResult{Name: s.Name, First: s.LastRunAt.IsZero(), titles: make(map[string]string)}
+		var hits []database.SavedSearchHit
+		if searchCollection == "" || len(ids) > 0 {
+			err = idx.StreamSearch(s.Query, filters, ids, 0, func(hit *search.BleveMatch) error {
+				recordType, _ := hit.Fields["type"].(string)
+				if title, ok := hit.Fields["title"].(string); ok {
+					result.titles[hit.ID] = title
+				}
+				hits = append(hits, database.SavedSearchHit{Accession: hit.ID, RecordType: recordType})
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("saved search %s failed: %v", s.Name, err)
+			}
+		}
+
+		result.Matched = len(hits)
+		if result.New, err = db.RecordSavedSearchRun(s.Name, *generation, hits); err != nil {
+			return nil, fmt.Errorf("failed to record saved search %s: %v", s.Name, err)
+		}
+		if result.First {
+			result.New = []database.SavedSearchHit{}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// formatSavedSearch formats a saved search's query with its filter flags
+func formatSavedSearch(s *database.SavedSearch) string {
+	parts := []string{}
+	if s.Query != "" {
+		parts = append(parts, s.Query)
+	}
+	for _, flag := range savedSearchFlags {
+		if value, ok := s.Filters[flag]; ok {
+			parts = append(parts, fmt.Sprintf("--%s %q", flag, value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -14,6 +18,8 @@ import (
 	"github.com/nishad/srake/internal/cli"
 	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/embeddings"
+	"github.com/nishad/srake/internal/facets"
 	"github.com/nishad/srake/internal/paths"
 	"github.com/nishad/srake/internal/search"
 	"github.com/nishad/srake/internal/ui"
@@ -28,9 +34,14 @@ var searchCmd = &cobra.Command{
 The search supports:
   • Full-text search across all metadata fields
   • Organism names, accession numbers, and keywords
+  • Internal IDs imported with 'srake idmap import', searched as the
+    accessions they map to
   • Advanced filtering by platform, library strategy, and other fields
+  • A query language: organism:"Homo sapiens", AND, OR and NOT with
+    parentheses, ranges such as spots:>1000000 or
+    date:[2020-01-01 TO 2021-01-01], and "quoted phrases"
   • Fuzzy search for typo tolerance
-  • Multiple output formats (table, JSON, CSV, TSV)
+  • Multiple output formats (table, JSON, NDJSON, CSV, TSV)
   • Export results to file
 
 Search modes:
@@ -42,6 +53,10 @@ Search modes:
   srake search "homo sapiens"
   srake search "RNA-seq human cancer"
 
+  # Query language
+  srake search 'organism:"mus musculus" AND strategy:RNA-Seq'
+  srake search 'liver NOT organism:mouse spots:>1000000'
+
   # Search with filters
   srake search --organism "homo sapiens" --platform ILLUMINA
   srake search --library-strategy "RNA-Seq" --limit 50
@@ -53,6 +68,26 @@ Search modes:
   srake search "mouse brain" --format json --output results.json
   srake search "COVID-19" --format csv > results.csv
 
+  # Stream every hit, one JSON object per line
+  srake search "RNA-Seq" --format ndjson --limit 0 | jq -r .id
+
+  # Drill down on a numeric attribute range listed by --facets
+  srake search "liver" --facets
+  srake search "liver" --attribute-range "age:40-50 years"
+
+  # Restrict to a taxon, or to it and everything below (all primates)
+  srake search "liver" --taxon "Homo sapiens"
+  srake search --taxon 9443 --include-descendants
+
+  # Search within a collection
+  srake search "liver" --collection my-cohort
+
+  # Use a query template, filling in its parameters
+  srake search --template covid-wastewater --param country=Japan
+
+  # Add experiment, sample and run counts to study results
+  srake search "liver fibrosis" --enrich
+
   # Show all available data (no query)
   srake search --limit 100
 
@@ -72,12 +107,20 @@ var (
 	searchLibraryLayout    string
 	searchStudyType        string
 	searchInstrumentModel  string
+	searchAttributeRange   string
+	searchTaxon            string
+	searchWithDescendants  bool
 	searchDateFrom         string
 	searchDateTo           string
 	searchSpotsMin         int64
 	searchSpotsMax         int64
 	searchBasesMin         int64
 	searchBasesMax         int64
+	searchCollection       string
+	searchQCFlag           string
+	searchTemplate         string
+	searchParams           []string
+	searchSave             string
 
 	// Output flags
 	searchLimit    int
@@ -87,6 +130,10 @@ var (
 	searchNoHeader bool
 	searchFields   string
 
+	// Enrichment flags
+	searchEnrich       bool
+	searchEnrichBudget time.Duration
+
 	// Search mode flags
 	searchFuzzy       bool
 	searchExact       bool
@@ -105,11 +152,23 @@ var (
 	searchTimeout   int
 
 	// Search mode flags
-	searchMode         string
-	searchNoFTS        bool
-	searchNoVectors    bool
-	searchVectorWeight float64
-	searchKNN          int
+	searchMode      string
+	searchNoFTS     bool
+	searchNoVectors bool
+	searchKNN       int
+	searchFusion    string
+
+	// Reranking flags
+	searchRerank           bool
+	searchRerankCandidates int
+
+	// Guardrail override
+	searchForce bool
+
+	// Synonym expansion; searchExpansions are the terms the query was
+	// expanded with, for the table output
+	searchNoExpand   bool
+	searchExpansions []search.Expansion
 
 	// Quality control flags
 	searchSimilarityThreshold float32
@@ -129,27 +188,42 @@ func init() {
 	searchCmd.Flags().StringVar(&searchLibraryLayout, "library-layout", "", "Filter by library layout")
 	searchCmd.Flags().StringVar(&searchStudyType, "study-type", "", "Filter by study type")
 	searchCmd.Flags().StringVar(&searchInstrumentModel, "instrument-model", "", "Filter by instrument model")
+	searchCmd.Flags().StringVar(&searchAttributeRange, "attribute-range", "", "Filter samples by a numeric attribute range shown in --facets (e.g. \"age:40-50 years\")")
+	searchCmd.Flags().StringVar(&searchTaxon, "taxon", "", "Filter samples by NCBI taxon ID or scientific name")
+	searchCmd.Flags().BoolVar(&searchWithDescendants, "include-descendants", false, "With --taxon, also match taxa below it (needs 'srake taxonomy load')")
 	searchCmd.Flags().StringVar(&searchDateFrom, "date-from", "", "Filter by submission date from (YYYY-MM-DD)")
 	searchCmd.Flags().StringVar(&searchDateTo, "date-to", "", "Filter by submission date to (YYYY-MM-DD)")
 	searchCmd.Flags().Int64Var(&searchSpotsMin, "spots-min", 0, "Filter by minimum number of spots")
 	searchCmd.Flags().Int64Var(&searchSpotsMax, "spots-max", 0, "Filter by maximum number of spots")
 	searchCmd.Flags().Int64Var(&searchBasesMin, "bases-min", 0, "Filter by minimum number of bases")
 	searchCmd.Flags().Int64Var(&searchBasesMax, "bases-max", 0, "Filter by maximum number of bases")
+	searchCmd.Flags().StringVar(&searchCollection, "collection", "", "Restrict results to members of a collection (see 'srake tag')")
+	searchCmd.Flags().StringVar(&searchQCFlag, "qc-flag", "", "Restrict results to records flagged by a quality rule (see 'srake qc run --flag')")
+	searchCmd.Flags().StringVar(&searchTemplate, "template", "", "Search with a query template by name or YAML file (see 'srake templates')")
+	searchCmd.Flags().StringArrayVar(&searchParams, "param", nil, "Set a template parameter (name=value, repeatable)")
+	searchCmd.Flags().StringVar(&searchSave, "save", "", "Save the query and filters under a name (see 'srake saved')")
 
 	// Quality control flags with short aliases
 	searchCmd.Flags().Float32VarP(&searchSimilarityThreshold, "similarity-threshold", "s", 0.5, "Minimum cosine similarity for vector search (0-1, where 1=exact match)")
 	searchCmd.Flags().Float32VarP(&searchMinScore, "min-score", "m", 0.0, "Minimum BM25 score for text search results")
 	searchCmd.Flags().IntVarP(&searchTopPercentile, "top-percentile", "t", 0, "Only show top N percentile of results (0=disabled)")
 	searchCmd.Flags().BoolVarP(&searchShowConfidence, "show-confidence", "c", false, "Display confidence levels for results")
-	searchCmd.Flags().Float32VarP(&searchHybridWeight, "hybrid-weight", "w", 0.7, "Weight for vector scores in hybrid search (0=text only, 1=vector only)")
+	searchCmd.Flags().Float32VarP(&searchHybridWeight, "hybrid-weight", "w", search.DefaultHybridWeight, "Weight for vector scores in hybrid search (0=text only, 1=vector only)")
+	searchCmd.Flags().Float32Var(&searchHybridWeight, "vector-weight", search.DefaultHybridWeight, "Alias for --hybrid-weight")
+	searchCmd.Flags().StringVar(&searchFusion, "fusion", search.FusionWeighted, "Hybrid rank fusion (weighted|rrf)")
+	searchCmd.Flags().BoolVar(&searchRerank, "rerank", false, "Reorder the top results with a cross-encoder (search.rerank_model)")
+	searchCmd.Flags().IntVar(&searchRerankCandidates, "rerank-candidates", 0, "Top results --rerank reorders (0 uses search.rerank_candidates)")
+	searchCmd.Flags().BoolVar(&searchNoExpand, "no-expand", false, "Search the query as written, without synonyms from vocabularies loaded by 'srake ontology load'")
 
 	// Output flags
-	searchCmd.Flags().IntVarP(&searchLimit, "limit", "l", 100, "Maximum results to return")
+	searchCmd.Flags().IntVarP(&searchLimit, "limit", "l", 100, "Maximum results to return (0 for all with --format ndjson)")
 	searchCmd.Flags().IntVar(&searchOffset, "offset", 0, "Number of results to skip")
-	searchCmd.Flags().StringVarP(&searchFormat, "format", "f", "table", "Output format (table|json|csv|tsv)")
+	searchCmd.Flags().StringVarP(&searchFormat, "format", "f", "table", "Output format (table|json|ndjson|csv|tsv)")
 	searchCmd.Flags().StringVar(&searchOutput, "output", "", "Save results to file")
 	searchCmd.Flags().BoolVar(&searchNoHeader, "no-header", false, "Omit header in output")
 	searchCmd.Flags().StringVar(&searchFields, "fields", "", "Comma-separated list of fields to display")
+	searchCmd.Flags().BoolVar(&searchEnrich, "enrich", false, "Add child record counts and platforms to study results")
+	searchCmd.Flags().DurationVar(&searchEnrichBudget, "enrich-budget", 500*time.Millisecond, "Time allowed for --enrich; studies not reached are shown without counts")
 
 	// Search mode flags
 	searchCmd.Flags().BoolVar(&searchFuzzy, "fuzzy", false, "Enable fuzzy search for typo tolerance")
@@ -157,8 +231,8 @@ func init() {
 	searchCmd.Flags().BoolVar(&searchStats, "stats", false, "Show search statistics only")
 	searchCmd.Flags().BoolVar(&searchFacets, "facets", false, "Show search facets")
 	searchCmd.Flags().BoolVar(&searchHighlight, "highlight", false, "Highlight search terms in results")
-	searchCmd.Flags().BoolVar(&searchAdvanced, "advanced", false, "Enable advanced search syntax")
-	searchCmd.Flags().StringVar(&searchMode, "search-mode", "auto", "Search mode (auto|text|vector|hybrid|database)")
+	searchCmd.Flags().BoolVar(&searchAdvanced, "advanced", false, "Parse the query as the query language even when it is plain words")
+	searchCmd.Flags().StringVar(&searchMode, "search-mode", "auto", "Search mode (auto|text|vector|hybrid|fts5|database)")
 	searchCmd.Flags().BoolVar(&searchNoFTS, "no-fts", false, "Disable full-text search")
 	searchCmd.Flags().BoolVar(&searchNoVectors, "no-vectors", false, "Disable vector search")
 
@@ -166,6 +240,7 @@ func init() {
 	searchCmd.Flags().StringVar(&searchIndexPath, "index-path", "", "Path to search index")
 	searchCmd.Flags().BoolVar(&searchNoCache, "no-cache", false, "Disable search cache")
 	searchCmd.Flags().IntVar(&searchTimeout, "timeout", 30, "Search timeout in seconds")
+	searchCmd.Flags().BoolVar(&searchForce, "force", false, "Run a search estimated to read more rows than guardrails.max_rows")
 
 	// Hide some advanced flags by default
 	searchCmd.Flags().MarkHidden("no-cache")
@@ -187,7 +262,66 @@ func runSearch(cmd *cobra.Command, args []string) error {
 		return showSearchStats()
 	}
 
-	// Build filters from flags
+	if searchTemplate != "" {
+		templateQuery, err := applySearchTemplate(cmd, searchTemplate, searchParams)
+		if err != nil {
+			return err
+		}
+		if query == "" {
+			query = templateQuery
+		}
+	} else if len(searchParams) > 0 {
+		return fmt.Errorf("--param requires --template")
+	}
+
+	// Internal IDs from 'srake idmap import' search for their accessions
+	query = resolveSearchInternalIDs(query)
+
+	filters, err := searchFilters()
+	if err != nil {
+		return err
+	}
+
+	if searchSave != "" {
+		if err := saveSearch(cmd, searchSave, query); err != nil {
+			return err
+		}
+	}
+
+	// Start spinner for immediate feedback (within 100ms)
+	var spinner *ui.Spinner
+	if !quiet && isTerminal() && searchFormat != "ndjson" {
+		var message string
+		if query != "" {
+			message = fmt.Sprintf("Searching for \"%s\"", query)
+		} else if len(filters) > 0 || searchCollection != "" {
+			message = "Searching with filters"
+		} else {
+			message = "Fetching all records"
+		}
+		spinner = ui.NewSpinner(message)
+		spinner.Start()
+		defer func() {
+			if spinner != nil {
+				spinner.Stop("")
+			}
+		}()
+	}
+
+	// Always use local search - CLI should work independently
+	err = performSearch(query, filters)
+	if spinner != nil {
+		if err != nil {
+			spinner.Stop(fmt.Sprintf("✗ Search failed: %v", err))
+		} else {
+			spinner.Stop("✓ Search completed")
+		}
+	}
+	return err
+}
+
+// searchFilters builds the index filters of the filter flags
+func searchFilters() (map[string]string, error) {
 	filters := make(map[string]string)
 	if searchOrganism != "" {
 		filters["organism"] = searchOrganism
@@ -213,6 +347,21 @@ func runSearch(cmd *cobra.Command, args []string) error {
 	if searchInstrumentModel != "" {
 		filters["instrument_model"] = searchInstrumentModel
 	}
+	if searchAttributeRange != "" {
+		filters[facets.FieldName] = searchAttributeRange
+	}
+	if searchTaxon != "" {
+		field, value, err := resolveTaxonFilter(searchTaxon, searchWithDescendants)
+		if err != nil {
+			return nil, err
+		}
+		filters[field] = value
+	} else if searchWithDescendants {
+		return nil, fmt.Errorf("--include-descendants requires --taxon")
+	}
+	if searchQCFlag != "" {
+		filters[search.FieldQCFlags] = searchQCFlag
+	}
 	if searchDateFrom != "" {
 		filters["submission_date_from"] = searchDateFrom
 	}
@@ -231,37 +380,17 @@ func runSearch(cmd *cobra.Command, args []string) error {
 	if searchBasesMax > 0 {
 		filters["bases_max"] = fmt.Sprintf("%d", searchBasesMax)
 	}
+	return filters, nil
+}
 
-	// Start spinner for immediate feedback (within 100ms)
-	var spinner *ui.Spinner
-	if !quiet && isTerminal() {
-		var message string
-		if query != "" {
-			message = fmt.Sprintf("Searching for \"%s\"", query)
-		} else if len(filters) > 0 {
-			message = "Searching with filters"
-		} else {
-			message = "Fetching all records"
-		}
-		spinner = ui.NewSpinner(message)
-		spinner.Start()
-		defer func() {
-			if spinner != nil {
-				spinner.Stop("")
-			}
-		}()
-	}
-
-	// Always use local search - CLI should work independently
-	err := performSearch(query, filters)
-	if spinner != nil {
-		if err != nil {
-			spinner.Stop(fmt.Sprintf("✗ Search failed: %v", err))
-		} else {
-			spinner.Stop("✓ Search completed")
-		}
+// resolveTaxonFilter turns --taxon into an index filter
+func resolveTaxonFilter(taxon string, includeDescendants bool) (string, string, error) {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open database: %v", err)
 	}
-	return err
+	defer db.Close()
+	return search.TaxonFilter(db, taxon, includeDescendants)
 }
 
 // performSearch performs search using local Bleve index and database
@@ -283,7 +412,7 @@ func performSearch(query string, filters map[string]string) error {
 	}
 
 	// Determine effective search mode
-	effectiveMode := determineSearchMode(cfg)
+	effectiveMode := determineSearchMode(cfg, query)
 
 	// Override index path if specified
 	if searchIndexPath != "" {
@@ -292,13 +421,47 @@ func performSearch(query string, filters map[string]string) error {
 		cfg.Search.IndexPath = paths.GetIndexPath()
 	}
 
+	// Resolve collection members up front so both search paths can use them
+	var collectionAccessions []string
+	if searchCollection != "" {
+		accessions, err := loadCollectionAccessions(searchCollection)
+		if err != nil {
+			return err
+		}
+		collectionAccessions = accessions
+	}
+
+	if searchRerank && (effectiveMode == "database" || effectiveMode == "fts5") {
+		return fmt.Errorf("--rerank is not supported with --search-mode %s", effectiveMode)
+	}
+
 	// For database-only mode, skip index check
 	if effectiveMode == "database" {
 		return performDatabaseSearch(query, filters)
 	}
 
+	// Vector mode searches the study embeddings instead of the Bleve index
+	if effectiveMode == "vector" {
+		if searchCollection != "" {
+			return fmt.Errorf("--collection is not supported with --search-mode vector")
+		}
+		return performVectorSearch(cfg, query, filters)
+	}
+
+	// Samples and runs are searched in the SQLite FTS5 tables
+	if effectiveMode == "fts5" {
+		if searchCollection != "" {
+			return fmt.Errorf("--collection is not supported with --search-mode fts5")
+		}
+		return performFTS5Search(query, filters)
+	}
+
 	// Check if index exists for FTS/vector modes
 	if _, err := os.Stat(cfg.Search.IndexPath); os.IsNotExist(err) {
+		if canFallBackToFTS5(query) {
+			printWarning("Search index not found at %s; searching samples and runs instead", cfg.Search.IndexPath)
+			return performFTS5Search(query, filters)
+		}
 		if searchMode != "database" {
 			printError("Search index not found at %s", cfg.Search.IndexPath)
 			fmt.Fprintf(os.Stderr, "\nPlease build the search index first:\n")
@@ -311,19 +474,74 @@ func performSearch(query string, filters map[string]string) error {
 
 	// Initialize Bleve index
 	idx, err := search.InitBleveIndex(cfg.Search.IndexPath)
+	var corrupt *search.CorruptIndexError
+	if errors.As(err, &corrupt) {
+		// Stay usable on the database until the index is rebuilt
+		printWarning("The search index at %s cannot be opened and may be corrupt: %v", corrupt.Path, corrupt.Err)
+		fmt.Fprintf(os.Stderr, "  Searching the database instead. Rebuild the index with:\n")
+		fmt.Fprintf(os.Stderr, "    srake index --rebuild --only-missing\n\n")
+		if canFallBackToFTS5(query) {
+			return performFTS5Search(query, filters)
+		}
+		return performDatabaseSearch(query, filters)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to open search index: %v", err)
 	}
 	defer idx.Close()
 
+	if effectiveMode == "hybrid" {
+		if searchCollection != "" {
+			return fmt.Errorf("--collection is not supported with --search-mode hybrid")
+		}
+		return performHybridSearch(cfg, idx, query, filters)
+	}
+
+	// Terms of loaded vocabularies also match their synonyms; the reranker
+	// and the output read the query as written
+	textQuery := query
+	if !searchFuzzy {
+		textQuery = expandSearchQuery(query)
+	}
+
+	if canStreamSearch() {
+		return streamSearch(idx, textQuery, filters, collectionAccessions)
+	}
+
+	// Reranking reads the top candidates, of which the best are shown
+	reranker, candidates, closeReranker, err := openSearchReranker()
+	if err != nil {
+		return err
+	}
+	defer closeReranker()
+	limit := max(searchLimit, candidates)
+
+	// Collected hits are held in memory, so the guardrails bound them
+	if docs, err := idx.GetDocCount(); err == nil {
+		n := int64(docs)
+		if limit > 0 {
+			n = min(n, int64(limit))
+		}
+		if err := checkQueryCost("This search", n, searchForce); err != nil {
+			return err
+		}
+	}
+
 	// Perform search based on mode
 	var results interface{}
 	startTime := time.Now()
 
-	if searchAdvanced && query != "" {
+	if searchCollection != "" {
+		// Search restricted to collection members
+		bleveResult, err := idx.SearchInCollection(textQuery, filters, collectionAccessions, limit)
+		if err != nil {
+			return fmt.Errorf("collection search failed: %v", err)
+		}
+		results = bleveResult
+	} else if searchAdvanced && query != "" {
 		// Advanced query parsing
 		parser := search.NewQueryParser()
-		advancedQuery, err := parser.ParseAdvancedQuery(query)
+		advancedQuery, err := parser.ParseAdvancedQuery(textQuery)
 		if err != nil {
 			return fmt.Errorf("failed to parse advanced query: %v", err)
 		}
@@ -343,13 +561,13 @@ func performSearch(query string, filters map[string]string) error {
 			} else {
 				finalQuery = advancedQuery
 			}
-			bleveResult, err := idx.SearchWithQuery(finalQuery, searchLimit)
+			bleveResult, err := idx.SearchWithQuery(finalQuery, limit)
 			if err != nil {
 				return fmt.Errorf("advanced search failed: %v", err)
 			}
 			results = bleveResult
 		} else {
-			bleveResult, err := idx.SearchWithQuery(advancedQuery, searchLimit)
+			bleveResult, err := idx.SearchWithQuery(advancedQuery, limit)
 			if err != nil {
 				return fmt.Errorf("advanced search failed: %v", err)
 			}
@@ -357,27 +575,37 @@ func performSearch(query string, filters map[string]string) error {
 		}
 	} else if searchFuzzy && query != "" {
 		// Fuzzy search
-		bleveResult, err := idx.FuzzySearch(query, 2, searchLimit)
+		bleveResult, err := idx.FuzzySearch(query, 2, limit)
 		if err != nil {
 			return fmt.Errorf("fuzzy search failed: %v", err)
 		}
 		results = bleveResult
 	} else if len(filters) > 0 {
 		// Filtered search
-		bleveResult, err := idx.SearchWithFilters(query, filters, searchLimit)
+		bleveResult, err := idx.SearchWithFilters(textQuery, filters, limit)
 		if err != nil {
 			return fmt.Errorf("filtered search failed: %v", err)
 		}
 		results = bleveResult
 	} else {
 		// Regular search
-		bleveResult, err := idx.Search(query, searchLimit)
+		bleveResult, err := idx.Search(textQuery, limit)
 		if err != nil {
 			return fmt.Errorf("search failed: %v", err)
 		}
 		results = bleveResult
 	}
 
+	if reranker != nil {
+		bleveResult := results.(*search.BleveSearchResult)
+		if _, err := search.RerankBleve(reranker, query, bleveResult, candidates); err != nil {
+			return err
+		}
+		if searchLimit > 0 && len(bleveResult.Hits) > searchLimit {
+			bleveResult.Hits = bleveResult.Hits[:searchLimit]
+		}
+	}
+
 	elapsed := time.Since(startTime)
 
 	// Handle aggregation if requested
@@ -389,6 +617,286 @@ func performSearch(query string, filters map[string]string) error {
 	return formatSearchResults(results, query, elapsed)
 }
 
+// expandSearchQuery adds the synonyms of the query's terms from the
+// vocabularies loaded by 'srake ontology load', unless --no-expand or
+// search.expand_synonyms turn expansion off
+func expandSearchQuery(query string) string {
+	if searchNoExpand || strings.TrimSpace(query) == "" {
+		return query
+	}
+	cfg := config.DefaultConfig()
+	if layered, _, err := config.LoadLayered(); err == nil {
+		cfg = layered
+	}
+	if !cfg.Search.ExpandSynonyms {
+		return query
+	}
+	db := openExistingDB()
+	if db == nil {
+		return query
+	}
+	defer db.Close()
+
+	expanded, expansions, err := search.ExpandQuery(db, query)
+	if err != nil {
+		printWarning("Could not expand the query with synonyms: %v", err)
+		return query
+	}
+	searchExpansions = expansions
+	return expanded
+}
+
+// performVectorSearch embeds the query and finds the nearest studies in the
+// vector index written by 'srake index --build --with-embeddings'
+func performVectorSearch(cfg *config.Config, query string, filters map[string]string) error {
+	if query == "" {
+		return fmt.Errorf("vector search needs a query")
+	}
+
+	searcher, closeSearcher, err := openVectorSearcher(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeSearcher()
+
+	reranker, candidates, closeReranker, err := openSearchReranker()
+	if err != nil {
+		return err
+	}
+	defer closeReranker()
+
+	startTime := time.Now()
+	result, err := searcher.Search(query, rerankSearchOptions(vectorSearchOptions(filters), candidates))
+	if err != nil {
+		return fmt.Errorf("vector search failed: %v", err)
+	}
+	if err := rerankSearchResult(reranker, query, result, candidates); err != nil {
+		return err
+	}
+	elapsed := time.Since(startTime)
+
+	if searchAggregateBy != "" || searchCountOnly {
+		return formatAggregatedResults(result.AsBleveResult(), query, elapsed)
+	}
+	return formatSearchResults(result.AsBleveResult(), query, elapsed)
+}
+
+// performHybridSearch ranks the full-text results for the query together
+// with the studies nearest to it in the embedding space, fusing their
+// scores by --fusion and --hybrid-weight
+func performHybridSearch(cfg *config.Config, idx *search.BleveIndex, query string, filters map[string]string) error {
+	if query == "" {
+		return fmt.Errorf("hybrid search needs a query")
+	}
+	if err := search.ValidFusion(searchFusion); err != nil {
+		return err
+	}
+
+	searcher, closeSearcher, err := openVectorSearcher(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeSearcher()
+
+	reranker, candidates, closeReranker, err := openSearchReranker()
+	if err != nil {
+		return err
+	}
+	defer closeReranker()
+
+	startTime := time.Now()
+
+	// Both sides contribute candidates for the requested page
+	opts := rerankSearchOptions(vectorSearchOptions(filters), candidates)
+	var text *search.BleveSearchResult
+	if len(filters) > 0 {
+		text, err = idx.SearchWithFilters(query, filters, opts.Limit+opts.Offset)
+	} else {
+		text, err = idx.Search(query, opts.Limit+opts.Offset)
+	}
+	if err != nil {
+		return fmt.Errorf("search failed: %v", err)
+	}
+
+	result, err := searcher.SearchHybrid(query, search.HitsFromBleve(text), opts)
+	if err != nil {
+		return fmt.Errorf("hybrid search failed: %v", err)
+	}
+	if err := rerankSearchResult(reranker, query, result, candidates); err != nil {
+		return err
+	}
+	elapsed := time.Since(startTime)
+
+	if searchAggregateBy != "" || searchCountOnly {
+		return formatAggregatedResults(result.AsBleveResult(), query, elapsed)
+	}
+	return formatSearchResults(result.AsBleveResult(), query, elapsed)
+}
+
+// performFTS5Search searches samples and runs in the SQLite FTS5 tables
+// built by 'srake index --build-fts'
+func performFTS5Search(query string, filters map[string]string) error {
+	if query == "" {
+		return fmt.Errorf("fts5 search needs a query")
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	opts := search.SearchOptions{Limit: searchLimit, Offset: searchOffset}
+	if len(filters) > 0 {
+		opts.Filters = make(map[string]interface{}, len(filters))
+		for k, v := range filters {
+			opts.Filters[k] = v
+		}
+	}
+
+	startTime := time.Now()
+	result, err := search.SearchFTS(db, query, opts)
+	if err != nil {
+		return fmt.Errorf("fts5 search failed: %v", err)
+	}
+	elapsed := time.Since(startTime)
+
+	if searchAggregateBy != "" || searchCountOnly {
+		return formatAggregatedResults(result.AsBleveResult(), query, elapsed)
+	}
+	return formatSearchResults(result.AsBleveResult(), query, elapsed)
+}
+
+// canFallBackToFTS5 reports whether a search without the Bleve index can
+// use the FTS5 tables instead
+func canFallBackToFTS5(query string) bool {
+	if query == "" || searchCollection != "" || searchAdvanced || searchFuzzy || searchRerank || (searchMode != "auto" && searchMode != "") {
+		return false
+	}
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	return database.NewFTS5Manager(db).HasFTSTables()
+}
+
+// openVectorSearcher loads the study embeddings and the model that embeds
+// queries. The returned function releases them.
+func openVectorSearcher(cfg *config.Config) (*search.VectorSearcher, func(), error) {
+	indexPath := search.VectorIndexPath(paths.GetEmbeddingsPath())
+	index, err := search.OpenVectorIndex(indexPath)
+	if os.IsNotExist(err) {
+		printError("Study embeddings not found at %s", indexPath)
+		fmt.Fprintf(os.Stderr, "\nPlease build the index with embeddings first:\n")
+		fmt.Fprintf(os.Stderr, "  srake index --build --with-embeddings\n")
+		return nil, nil, fmt.Errorf("embeddings not found")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	cfg.Embeddings.Enabled = true
+	cfg.Embeddings.ModelsDirectory = paths.GetModelsPath()
+	embedder, err := embeddings.NewSearchEmbedder(cfg)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to load embedding model: %v", err)
+	}
+
+	closeSearcher := func() {
+		embedder.Close()
+		db.Close()
+	}
+	return search.NewVectorSearcher(db, index, embedder), closeSearcher, nil
+}
+
+// openSearchReranker loads the cross-encoder of --rerank, configured by the
+// search section of the config, and returns how many of the top results it
+// reorders. Without --rerank it returns no reranker. The returned function
+// releases it.
+func openSearchReranker() (*embeddings.ONNXReranker, int, func(), error) {
+	if !searchRerank {
+		return nil, 0, func() {}, nil
+	}
+	cfg := config.DefaultConfig()
+	if layered, _, err := config.LoadLayered(); err == nil {
+		cfg = layered
+	}
+	candidates := searchRerankCandidates
+	if candidates <= 0 {
+		candidates = cfg.Search.RerankCandidates
+	}
+	if candidates <= 0 {
+		candidates = search.DefaultRerankCandidates
+	}
+	model := cfg.Search.RerankModel
+	if model == "" {
+		model = embeddings.DefaultRerankModel
+	}
+
+	reranker, err := embeddings.NewONNXReranker(model, paths.GetModelsPath(), embeddings.ONNXOptionsFromConfig(cfg.Embeddings))
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to load reranking model: %v", err)
+	}
+	return reranker, candidates, func() { reranker.Close() }, nil
+}
+
+// rerankSearchOptions widens the options of a vector or hybrid search to
+// the candidates of --rerank, which rerankSearchResult pages afterwards
+func rerankSearchOptions(opts search.SearchOptions, candidates int) search.SearchOptions {
+	if candidates > 0 {
+		opts.Limit = max(candidates, opts.Offset+opts.Limit)
+		opts.Offset = 0
+	}
+	return opts
+}
+
+// rerankSearchResult reorders the top candidates of a vector or hybrid
+// search with the reranker, when there is one, and keeps the page of
+// --offset and --limit
+func rerankSearchResult(reranker *embeddings.ONNXReranker, query string, result *search.SearchResult, candidates int) error {
+	if reranker == nil {
+		return nil
+	}
+	reranked, err := search.RerankHits(reranker, query, result.Hits, candidates)
+	if err != nil {
+		return err
+	}
+	result.Reranked = reranked
+	result.Hits = result.Hits[min(searchOffset, len(result.Hits)):]
+	if searchLimit > 0 && len(result.Hits) > searchLimit {
+		result.Hits = result.Hits[:searchLimit]
+	}
+	return nil
+}
+
+// vectorSearchOptions returns the search options of the vector and hybrid
+// modes from the command-line flags
+func vectorSearchOptions(filters map[string]string) search.SearchOptions {
+	opts := search.SearchOptions{
+		Limit:               searchLimit,
+		Offset:              searchOffset,
+		KNN:                 searchKNN,
+		SimilarityThreshold: searchSimilarityThreshold,
+		ShowConfidence:      searchShowConfidence,
+		HybridWeight:        searchHybridWeight,
+		Fusion:              searchFusion,
+	}
+	if len(filters) > 0 {
+		opts.Filters = make(map[string]interface{}, len(filters))
+		for k, v := range filters {
+			opts.Filters[k] = v
+		}
+	}
+	return opts
+}
+
 // formatSearchResults formats search results based on output format
 func formatSearchResults(results interface{}, query string, elapsed time.Duration) error {
 	// Type assertion for Bleve results
@@ -397,10 +905,17 @@ func formatSearchResults(results interface{}, query string, elapsed time.Duratio
 		return fmt.Errorf("unexpected result type")
 	}
 
+	if searchEnrich {
+		enrichStudyHits(bleveResult)
+	}
+	addInternalIDFields(bleveResult)
+
 	// Handle different output formats
 	switch searchFormat {
 	case "json":
 		return outputJSON(bleveResult)
+	case "ndjson":
+		return outputNDJSON(bleveResult)
 	case "csv":
 		return outputCSV(bleveResult, ",")
 	case "tsv":
@@ -412,6 +927,53 @@ func formatSearchResults(results interface{}, query string, elapsed time.Duratio
 	}
 }
 
+// enrichStudyHits adds the child record counts and technologies of the
+// study hits to their fields. The studies are summarised in rank order
+// until --enrich-budget runs out, so the best hits are enriched first.
+func enrichStudyHits(result *search.BleveSearchResult) {
+	var accessions []string
+	for _, hit := range result.Hits {
+		if detectAccessionType(hit.ID) == "study" {
+			accessions = append(accessions, hit.ID)
+		}
+	}
+	if len(accessions) == 0 {
+		return
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		printWarning("Could not enrich results: %v", err)
+		return
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), searchEnrichBudget)
+	defer cancel()
+	summaries, err := db.StudySummaries(ctx, accessions)
+	if errors.Is(err, context.DeadlineExceeded) {
+		printWarning("Enriched %d of %d studies within %v", len(summaries), len(accessions), searchEnrichBudget)
+	} else if err != nil {
+		printWarning("Could not enrich results: %v", err)
+	}
+
+	for _, hit := range result.Hits {
+		summary, ok := summaries[hit.ID]
+		if !ok {
+			continue
+		}
+		if hit.Fields == nil {
+			hit.Fields = make(map[string]interface{})
+		}
+		hit.Fields["experiment_count"] = summary.ExperimentCount
+		hit.Fields["sample_count"] = summary.SampleCount
+		hit.Fields["run_count"] = summary.RunCount
+		hit.Fields["total_bases"] = summary.TotalBases
+		hit.Fields["platforms"] = strings.Join(summary.Platforms, ",")
+		hit.Fields["library_strategies"] = strings.Join(summary.LibraryStrategies, ",")
+	}
+}
+
 // outputTable outputs results in table format
 func outputTable(result *search.BleveSearchResult, query string, elapsed time.Duration) error {
 	if result.Total == 0 {
@@ -436,9 +998,23 @@ func outputTable(result *search.BleveSearchResult, query string, elapsed time.Du
 		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	}
 
+	hasInternalIDs := false
+	for _, hit := range result.Hits {
+		if _, ok := hit.Fields["internal_id"]; ok {
+			hasInternalIDs = true
+			break
+		}
+	}
+
 	// Header
 	if !searchNoHeader {
 		headers := []string{"ACCESSION", "TYPE", "TITLE", "ORGANISM", "PLATFORM"}
+		if searchEnrich {
+			headers = append(headers, "EXPS", "SAMPLES", "RUNS")
+		}
+		if hasInternalIDs {
+			headers = append(headers, "INTERNAL ID")
+		}
 		if searchFields != "" {
 			headers = strings.Split(strings.ToUpper(searchFields), ",")
 		}
@@ -466,7 +1042,7 @@ func outputTable(result *search.BleveSearchResult, query string, elapsed time.Du
 		docType := getField(fields, "type")
 		title := truncate(getField(fields, "title", "study_title"), 40)
 		organism := getField(fields, "organism")
-		platform := getField(fields, "platform")
+		platform := getField(fields, "platform", "platforms")
 
 		if searchFields != "" {
 			// Custom fields
@@ -490,6 +1066,15 @@ func outputTable(result *search.BleveSearchResult, query string, elapsed time.Du
 				title,
 				organism,
 				platform)
+			if searchEnrich {
+				fmt.Fprintf(w, "\t%s\t%s\t%s",
+					getField(fields, "experiment_count"),
+					getField(fields, "sample_count"),
+					getField(fields, "run_count"))
+			}
+			if hasInternalIDs {
+				fmt.Fprintf(w, "\t%s", getField(fields, "internal_id"))
+			}
 		}
 
 		// Add highlights if requested
@@ -512,11 +1097,21 @@ func outputTable(result *search.BleveSearchResult, query string, elapsed time.Du
 		fmt.Printf("\n%s\n", colorize(colorGray,
 			fmt.Sprintf("Found %d results in %v (showing %d)",
 				result.Total, elapsed, len(result.Hits))))
+		for _, e := range searchExpansions {
+			fmt.Println(colorize(colorGray, fmt.Sprintf("Also matched synonyms of \"%s\": %s (--no-expand to turn off)",
+				e.Term, strings.Join(e.Synonyms, ", "))))
+		}
 
 		// Show facets if requested
 		if searchFacets && len(result.Facets) > 0 {
 			fmt.Println("\n" + colorize(colorBold, "Facets:"))
-			for facetName, facet := range result.Facets {
+			names := make([]string, 0, len(result.Facets))
+			for facetName := range result.Facets {
+				names = append(names, facetName)
+			}
+			sort.Strings(names)
+			for _, facetName := range names {
+				facet := result.Facets[facetName]
 				fmt.Printf("\n  %s:\n", colorize(colorBold, facetName))
 				for _, term := range facet.Terms.Terms() {
 					fmt.Printf("    %s: %d\n", term.Term, term.Count)
@@ -553,6 +1148,80 @@ func outputJSON(result *search.BleveSearchResult) error {
 	return encoder.Encode(output)
 }
 
+// outputNDJSON writes each hit as one line of JSON
+func outputNDJSON(result *search.BleveSearchResult) error {
+	w, closeOutput, err := openNDJSONOutput()
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for _, hit := range result.Hits {
+		if err := encoder.Encode(hit); err != nil {
+			closeOutput()
+			return err
+		}
+	}
+	return closeOutput()
+}
+
+// openNDJSONOutput opens a buffered writer on --output or stdout. The
+// returned function flushes and closes it.
+func openNDJSONOutput() (*bufio.Writer, func() error, error) {
+	if searchOutput == "" {
+		w := bufio.NewWriter(os.Stdout)
+		return w, w.Flush, nil
+	}
+	file, err := os.Create(searchOutput)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file: %v", err)
+	}
+	w := bufio.NewWriter(file)
+	return w, func() error {
+		if err := w.Flush(); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}, nil
+}
+
+// canStreamSearch reports whether the Bleve search can stream its hits
+// instead of collecting them. Fuzzy and advanced queries, reranking,
+// aggregation and enrichment need the whole result, which is then written line by line.
+func canStreamSearch() bool {
+	return searchFormat == "ndjson" && !searchAdvanced && !searchFuzzy && !searchEnrich &&
+		!searchRerank && searchAggregateBy == "" && !searchCountOnly
+}
+
+// streamSearch writes the hits of a search as NDJSON while paging through
+// the index, so that memory use does not grow with the number of hits
+func streamSearch(idx *search.BleveIndex, query string, filters map[string]string, collectionAccessions []string) error {
+	if searchCollection != "" && len(collectionAccessions) == 0 {
+		return nil
+	}
+
+	w, closeOutput, err := openNDJSONOutput()
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	count := 0
+	err = idx.StreamSearch(query, filters, collectionAccessions, searchLimit, func(hit *search.BleveMatch) error {
+		count++
+		return encoder.Encode(hit)
+	})
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("search failed: %v", err)
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Streamed %d results\n", count)
+	}
+	return nil
+}
+
 // outputCSV outputs results as CSV or TSV
 func outputCSV(result *search.BleveSearchResult, separator string) error {
 	var writer *csv.Writer
@@ -646,7 +1315,7 @@ func showSearchStats() error {
 	}
 	defer sqlDB.Close()
 
-	db := &database.DB{DB: sqlDB}
+	db := database.Wrap(sqlDB)
 
 	// Create search manager
 	cfg.DataDirectory = dataDir
@@ -681,7 +1350,7 @@ func showSearchStats() error {
 // Helper functions
 
 // determineSearchMode determines the effective search mode based on config and flags
-func determineSearchMode(cfg *config.Config) string {
+func determineSearchMode(cfg *config.Config, query string) string {
 	// Explicit mode from CLI
 	if searchMode != "auto" && searchMode != "" {
 		return searchMode
@@ -692,11 +1361,15 @@ func determineSearchMode(cfg *config.Config) string {
 		return "database"
 	}
 
-	if cfg.Vectors.Enabled && !searchNoVectors {
-		if searchVectorWeight >= 1.0 {
-			return "vector"
+	// Use the study embeddings when they have been built, unless the
+	// search needs a feature only full-text search has
+	if cfg.Vectors.Enabled && !searchNoVectors && query != "" && searchCollection == "" && !searchAdvanced && !searchFuzzy {
+		if _, err := os.Stat(search.VectorIndexPath(paths.GetEmbeddingsPath())); err == nil {
+			if searchHybridWeight >= 1.0 {
+				return "vector"
+			}
+			return "hybrid"
 		}
-		return "hybrid"
 	}
 
 	return "fts"
@@ -711,29 +1384,79 @@ func performDatabaseSearch(query string, filters map[string]string) error {
 	defer db.Close()
 
 	// Build SQL query with filters
-	sqlQuery := buildSQLQuery(query, filters)
+	sqlQuery, args := buildSQLQuery(query, filters)
+
+	cost, err := db.EstimateQueryCost(context.Background(), sqlQuery, args...)
+	if err != nil {
+		return fmt.Errorf("failed to estimate search: %v", err)
+	}
+	// A listing without conditions reads no more rows than it returns
+	scanned := cost.Rows
+	if query == "" && len(filters) == 0 && searchCollection == "" && searchLimit > 0 {
+		scanned = min(scanned, int64(searchLimit+searchOffset))
+	}
+	if err := checkQueryCost("This search", scanned, searchForce); err != nil {
+		return err
+	}
 
 	// Execute query
-	rows, err := db.GetSQLDB().Query(sqlQuery)
+	rows, err := db.GetSQLDB().Query(sqlQuery, args...)
 	if err != nil {
 		return fmt.Errorf("database query failed: %v", err)
 	}
 	defer rows.Close()
 
 	// Process and display results
+	if searchFormat == "ndjson" {
+		return streamDatabaseResults(rows)
+	}
 	return displayDatabaseResults(rows)
 }
 
-// buildSQLQuery builds a SQL query for database-only search
-func buildSQLQuery(query string, filters map[string]string) string {
+// loadCollectionAccessions returns the member accessions of a collection
+func loadCollectionAccessions(name string) ([]string, error) {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.GetCollection(name); err != nil {
+		return nil, err
+	}
+	return db.GetCollectionAccessions(name)
+}
+
+// collectionStudiesSQL selects the studies of a collection's members.
+// Experiments, samples and runs resolve to the studies they belong to; each
+// placeholder takes the collection name.
+const collectionStudiesSQL = `study_accession IN (
+	SELECT accession FROM collection_members WHERE collection_name = ?
+	UNION SELECT e.study_accession FROM collection_members m
+		JOIN experiments e ON e.experiment_accession = m.accession
+		WHERE m.collection_name = ?
+	UNION SELECT e.study_accession FROM collection_members m
+		JOIN runs r ON r.run_accession = m.accession
+		JOIN experiments e ON e.experiment_accession = r.experiment_accession
+		WHERE m.collection_name = ?
+	UNION SELECT e.study_accession FROM collection_members m
+		JOIN experiment_samples es ON es.sample_accession = m.accession
+		JOIN experiments e ON e.experiment_accession = es.experiment_accession
+		WHERE m.collection_name = ?)`
+
+// buildSQLQuery builds a SQL query for database-only search and the
+// arguments for its placeholders
+func buildSQLQuery(query string, filters map[string]string) (string, []interface{}) {
 	// Basic implementation - will be expanded
 	whereClause := []string{}
+	var args []interface{}
 
 	if query != "" {
 		// Simple text search across key fields
-		whereClause = append(whereClause, fmt.Sprintf(
-			"(study_title LIKE '%%%s%%' OR study_abstract LIKE '%%%s%%' OR organism LIKE '%%%s%%')",
-			query, query, query))
+		whereClause = append(whereClause,
+			"(study_title LIKE ? OR study_abstract LIKE ? OR organism LIKE ?)")
+		like := "%" + query + "%"
+		args = append(args, like, like, like)
 	}
 
 	for field, value := range filters {
@@ -742,12 +1465,23 @@ func buildSQLQuery(query string, filters map[string]string) string {
 		switch field {
 		case "library_strategy", "library_source", "library_selection", "library_layout":
 			// These are in metadata JSON
-			whereClause = append(whereClause, fmt.Sprintf("json_extract(metadata, '$.%s') = '%s'", field, value))
+			whereClause = append(whereClause, fmt.Sprintf("json_extract(metadata, '$.%s') = ?", field))
 		case "platform", "instrument_model":
 			// Also in metadata
-			whereClause = append(whereClause, fmt.Sprintf("json_extract(metadata, '$.%s') = '%s'", field, value))
+			whereClause = append(whereClause, fmt.Sprintf("json_extract(metadata, '$.%s') = ?", field))
+		case search.FieldQCFlags:
+			whereClause = append(whereClause, "study_accession IN (SELECT accession FROM qc_flags WHERE rule = ?)")
 		default:
-			whereClause = append(whereClause, fmt.Sprintf("%s = '%s'", dbField, value))
+			whereClause = append(whereClause, fmt.Sprintf("%s = ?", dbField))
+		}
+		args = append(args, value)
+	}
+
+	if searchCollection != "" {
+		// Restrict to studies that are, or contain, members of the collection
+		whereClause = append(whereClause, collectionStudiesSQL)
+		for range strings.Count(collectionStudiesSQL, "?") {
+			args = append(args, searchCollection)
 		}
 	}
 
@@ -755,9 +1489,58 @@ func buildSQLQuery(query string, filters map[string]string) string {
 	if len(whereClause) > 0 {
 		sql += " WHERE " + strings.Join(whereClause, " AND ")
 	}
-	sql += fmt.Sprintf(" LIMIT %d OFFSET %d", searchLimit, searchOffset)
+	limit := searchLimit
+	if limit <= 0 && searchFormat == "ndjson" {
+		limit = -1 // no limit
+	}
+	sql += " ORDER BY study_accession LIMIT ? OFFSET ?"
+	args = append(args, limit, searchOffset)
+
+	return sql, args
+}
+
+// streamDatabaseResults writes each row of a database-only search as one
+// line of JSON as it is read
+func streamDatabaseResults(rows *sql.Rows) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get columns: %v", err)
+	}
 
-	return sql
+	w, closeOutput, err := openNDJSONOutput()
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	row := make(map[string]interface{}, len(columns))
+
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			closeOutput()
+			return err
+		}
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		if err := encoder.Encode(row); err != nil {
+			closeOutput()
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
 }
 
 // displayDatabaseResults displays results from database-only search
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// TestBuildSQLQueryCollectionMembers checks that a database-only search in
+// a collection of runs finds the studies the runs belong to
+func TestBuildSQLQueryCollectionMembers(t *testing.T) {
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, acc := range []string{"SRP000001", "SRP000002"} {
+		if err := db.InsertStudy(&database.Study{StudyAccession: acc, StudyTitle: "Liver RNA-seq"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertExperiment(&database.Experiment{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRun(&database.Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddToCollection("runs'only", []database.CollectionMember{
+		{Accession: "SRR000001", RecordType: "run"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	oldCollection, oldLimit := searchCollection, searchLimit
+	defer func() { searchCollection, searchLimit = oldCollection, oldLimit }()
+	searchCollection, searchLimit = "runs'only", 10
+
+	query, args := buildSQLQuery("liver", nil)
+	if _, err := db.EstimateQueryCost(t.Context(), query, args...); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.GetSQLDB().Query("SELECT study_accession FROM ("+query+")", args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var acc string
+		if err := rows.Scan(&acc); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, acc)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "SRP000001" {
+		t.Errorf("studies = %v, want [SRP000001]", got)
+	}
+}
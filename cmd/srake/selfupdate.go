@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nishad/srake/internal/selfupdate"
+	"github.com/spf13/cobra"
+)
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update srake to the latest release",
+	Long: `Replace this srake binary with the latest release from GitHub.
+
+The release archive for this platform is checked against the SHA-256
+checksums published with the release, and the new binary must run before
+it atomically replaces the current one. Newer releases often carry schema
+compatibility fixes for the SRA metadata dumps.
+
+Channels:
+  stable  Published releases (default)
+  beta    Pre-releases (-alpha, -beta, -rc) as well
+
+Set GITHUB_TOKEN to raise the GitHub API rate limit on shared hosts.`,
+	Example: `  # Check for a newer release without installing it
+  srake self-update --check
+
+  # Update to the latest stable release
+  srake self-update
+
+  # Follow pre-releases
+  srake self-update --channel beta`,
+	Args: cobra.NoArgs,
+	RunE: runSelfUpdate,
+}
+
+var (
+	selfUpdateChannel string
+	selfUpdateCheck   bool
+	selfUpdateForce   bool
+)
+
+func init() {
+	selfUpdateCmd.Flags().StringVar(&selfUpdateChannel, "channel", selfupdate.ChannelStable, "Release channel ("+strings.Join(selfupdate.Channels, "|")+")")
+	selfUpdateCmd.Flags().BoolVar(&selfUpdateCheck, "check", false, "Only report whether a newer release is available")
+	selfUpdateCmd.Flags().BoolVar(&selfUpdateForce, "force", false, "Install the latest release even if it is not newer")
+}
+
+func runSelfUpdate(cmd *cobra.Command, args []string) error {
+	if err := selfupdate.ValidChannel(selfUpdateChannel); err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	updater := selfupdate.New()
+	release, err := updater.Latest(ctx, selfUpdateChannel)
+	if err != nil {
+		return err
+	}
+
+	newer := selfupdate.CompareVersions(release.TagName, Version) > 0
+	if !newer && !selfUpdateForce {
+		printSuccess("srake %s is up to date (latest %s release: %s)", Version, selfUpdateChannel, release.TagName)
+		return nil
+	}
+	if selfUpdateCheck {
+		if newer {
+			printInfo("srake %s is available (installed: %s)", release.TagName, Version)
+			if release.HTMLURL != "" {
+				printInfo("Release notes: %s", release.HTMLURL)
+			}
+			printInfo("Run 'srake self-update' to install it")
+		} else {
+			printSuccess("srake %s is up to date (latest %s release: %s)", Version, selfUpdateChannel, release.TagName)
+		}
+		return nil
+	}
+
+	target, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the srake binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+
+	printInfo("Downloading srake %s (%s)...", release.TagName, updater.AssetName())
+	if err := updater.Install(ctx, release, target); err != nil {
+		return err
+	}
+	printSuccess("Updated %s from %s to %s", target, Version, release.TagName)
+	return nil
+}
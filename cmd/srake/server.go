@@ -4,12 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/nishad/srake/internal/api"
-	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/compat"
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/packaging"
+	"github.com/nishad/srake/internal/retention"
 	"github.com/spf13/cobra"
 )
 
@@ -22,46 +30,170 @@ The server provides:
 - RESTful API endpoints for searching and retrieving metadata
 - Export functionality in multiple formats
 - CORS support for web applications
+- An OAI-PMH endpoint (/oai) for harvesting study metadata
+
+Settings not given as flags come from the server, database, search and
+embeddings sections of the config files (see 'srake config show'), or from
+environment variables such as SRAKE_SERVER_PORT. The server section also
+sets allowed CORS origins, per-client rate limits and TLS.
+
+On SIGHUP, or a POST to /admin/reload, the server reads its config files
+again and applies the log level, CORS, rate limits, API keys and search
+cache TTL without a restart, so that running exports are not dropped.
+Changes to the database and index paths, address and TLS take a restart.
+/admin/reload takes an API key that is not read-only, or, without API
+keys, a request from the server's own host.
 
 For MCP (Model Context Protocol) support, use 'srake mcp' instead.`,
 	Example: `  srake server
   srake server --port 3000
-  srake server --enable-cors`,
+  srake server --config /etc/srake/server.toml
+  srake server --enable-cors
+  srake server --base-url https://sra.example.org --publisher-name "Example Institute"`,
 	RunE: runServer,
 }
 
+var serverCheckCmd = &cobra.Command{
+	Use:   "check <url>",
+	Short: "Check that a remote srake server is compatible with this CLI",
+	Long: `Ask a srake API server for its release, API schema version and
+capabilities, and compare them with this CLI.
+
+Servers answer clients whose API schema is too old with an upgrade message
+instead of responses the client cannot decode. This command reports which
+side needs upgrading, and which features are unavailable when the server is
+older than the CLI.`,
+	Example: `  srake server check http://sra.example.org:8080`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runServerCheck,
+}
+
+var serverKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the API keys accepted by srake server",
+	Long: `Create, list and revoke the API keys stored in the database.
+
+When server.auth.enabled is set, every API request except the health and
+version checks needs a key, given in the X-API-Key header or as a bearer
+token. Keys can also be listed in server.auth.keys of the config file.
+Only a hash of each stored key is kept, so a key is shown once, when it is
+created.`,
+	Example: `  srake server keys create lab-portal --rate 5 --burst 20 --read-only
+  srake server keys list
+  srake server keys revoke lab-portal`,
+}
+
+var serverKeysCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create an API key and print it",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runServerKeysCreate,
+}
+
+var serverKeysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the stored API keys",
+	Args:  cobra.NoArgs,
+	RunE:  runServerKeysList,
+}
+
+var serverKeysRevokeCmd = &cobra.Command{
+	Use:   "revoke <name>",
+	Short: "Revoke a stored API key",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runServerKeysRevoke,
+}
+
 var (
 	serverPort       int
 	serverHost       string
 	serverDBPath     string
 	serverIndexPath  string
 	serverEnableCORS bool
+	serverConfigPath string
+	serverNoWarmup   bool
+	serverPopularity bool
+	serverReplica    bool
+
+	serverBaseURL       string
+	serverPublisherName string
+	serverPublisherURL  string
+	serverLicense       string
+	serverAdminEmail    string
+
+	keysDBPath   string
+	keysRate     float64
+	keysBurst    int
+	keysReadOnly bool
 )
 
 func init() {
 	// Server command flags
-	serverCmd.Flags().IntVarP(&serverPort, "port", "p", 8080, "Port to listen on")
-	serverCmd.Flags().StringVar(&serverHost, "host", "0.0.0.0", "Host to bind to")
-	serverCmd.Flags().StringVar(&serverDBPath, "db", "", "Database path (default: uses SRAKE_DB_PATH)")
-	serverCmd.Flags().StringVar(&serverIndexPath, "index", "", "Index path (default: uses SRAKE_INDEX_PATH)")
-	serverCmd.Flags().BoolVar(&serverEnableCORS, "enable-cors", true, "Enable CORS for web access")
+	serverCmd.Flags().IntVarP(&serverPort, "port", "p", 8080, "Port to listen on (overrides server.port)")
+	serverCmd.Flags().StringVar(&serverHost, "host", "0.0.0.0", "Host to bind to (overrides server.host)")
+	serverCmd.Flags().StringVar(&serverDBPath, "db", "", "Database path (default: database.path)")
+	serverCmd.Flags().StringVar(&serverIndexPath, "index", "", "Index path (default: search.index_path)")
+	serverCmd.Flags().BoolVar(&serverEnableCORS, "enable-cors", true, "Enable CORS for web access (overrides server.cors.enabled)")
+	serverCmd.Flags().BoolVar(&serverNoWarmup, "no-warmup", false, "Report ready at once, without warming up the index and database (overrides server.warmup.enabled)")
+	serverCmd.Flags().BoolVar(&serverPopularity, "track-popularity", false, "Count how often studies and runs are returned and fetched (overrides server.popularity.enabled)")
+	serverCmd.Flags().BoolVar(&serverReplica, "replica", false, "Serve the database as a read-only replica of a primary (overrides database.mode)")
+	serverCmd.Flags().StringVar(&serverConfigPath, "config", "", "Config file (YAML or TOML) applied over the other config files")
+	serverCmd.Flags().StringVar(&serverBaseURL, "base-url", "", "Public URL of the catalog, used for canonical URLs in JSON-LD (default: catalog.base_url)")
+	serverCmd.Flags().StringVar(&serverPublisherName, "publisher-name", "", "Publisher name for JSON-LD (default: catalog.publisher_name)")
+	serverCmd.Flags().StringVar(&serverPublisherURL, "publisher-url", "", "Publisher URL for JSON-LD (default: catalog.publisher_url)")
+	serverCmd.Flags().StringVar(&serverLicense, "license", "", "License URL for JSON-LD (default: catalog.license)")
+	serverCmd.Flags().StringVar(&serverAdminEmail, "admin-email", "", "Contact email reported by the OAI-PMH endpoint (default: catalog.admin_email)")
+
+	serverKeysCmd.PersistentFlags().StringVar(&keysDBPath, "db", "", "Database path (default: database.path)")
+	serverKeysCreateCmd.Flags().Float64Var(&keysRate, "rate", 0, "Requests per second allowed to the key (default: server.rate_limit)")
+	serverKeysCreateCmd.Flags().IntVar(&keysBurst, "burst", 0, "Requests the key may make at once (default: one second of requests)")
+	serverKeysCreateCmd.Flags().BoolVar(&keysReadOnly, "read-only", false, "Refuse requests from the key that change data or start ingests and index rebuilds")
+	serverKeysCmd.AddCommand(serverKeysCreateCmd, serverKeysListCmd, serverKeysRevokeCmd)
+
+	serverCmd.AddCommand(serverCheckCmd)
+	serverCmd.AddCommand(serverKeysCmd)
 }
 
 func runServer(cmd *cobra.Command, args []string) error {
-	// Get database path
-	if serverDBPath == "" {
-		serverDBPath = os.Getenv("SRAKE_DB_PATH")
-		if serverDBPath == "" {
-			serverDBPath = paths.GetDatabasePath()
-		}
+	// Flags override the config files and environment
+	var cfg *config.Config
+	var report *config.Report
+	var err error
+	if serverConfigPath != "" {
+		cfg, report, err = config.LoadLayeredFile(serverConfigPath)
+	} else {
+		cfg, report, err = config.LoadLayered()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	for _, w := range report.Warnings {
+		printWarning("%s", w)
 	}
 
-	// Get index path
+	if serverDBPath == "" {
+		serverDBPath = cfg.Database.Path
+	}
 	if serverIndexPath == "" {
-		serverIndexPath = os.Getenv("SRAKE_INDEX_PATH")
-		if serverIndexPath == "" {
-			serverIndexPath = paths.GetIndexPath()
-		}
+		serverIndexPath = cfg.Search.IndexPath
+	}
+	if !cmd.Flags().Changed("port") {
+		serverPort = cfg.Server.Port
+	}
+	if !cmd.Flags().Changed("host") {
+		serverHost = cfg.Server.Host
+	}
+	if cmd.Flags().Changed("enable-cors") {
+		cfg.Server.CORS.Enabled = serverEnableCORS
+	}
+	if serverNoWarmup {
+		cfg.Server.Warmup.Enabled = false
+	}
+	if cmd.Flags().Changed("track-popularity") {
+		cfg.Server.Popularity.Enabled = serverPopularity
+	}
+	if serverReplica {
+		cfg.Database.Mode = database.ModeReplica
 	}
 
 	// Validate database exists
@@ -69,32 +201,91 @@ func runServer(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("database not found: %s", serverDBPath)
 	}
 
+	// Catalog settings for published metadata
+	catalog := packaging.Catalog{
+		BaseURL:       cfg.Catalog.BaseURL,
+		PublisherName: cfg.Catalog.PublisherName,
+		PublisherURL:  cfg.Catalog.PublisherURL,
+		License:       cfg.Catalog.License,
+	}
+	if serverBaseURL != "" {
+		catalog.BaseURL = serverBaseURL
+	}
+	if serverPublisherName != "" {
+		catalog.PublisherName = serverPublisherName
+	}
+	if serverPublisherURL != "" {
+		catalog.PublisherURL = serverPublisherURL
+	}
+	if serverLicense != "" {
+		catalog.License = serverLicense
+	}
+	adminEmail := cfg.Catalog.AdminEmail
+	if serverAdminEmail != "" {
+		adminEmail = serverAdminEmail
+	}
+
 	// Create server configuration
-	config := &api.Config{
+	serverConfig := &api.Config{
 		Host:         serverHost,
 		Port:         serverPort,
 		DatabasePath: serverDBPath,
 		IndexPath:    serverIndexPath,
-		EnableCORS:   serverEnableCORS,
+		CORS:         cfg.Server.CORS,
+		RateLimit:    cfg.Server.RateLimit,
+		Auth:         cfg.Server.Auth,
+		ReadOnly:     cfg.Server.ReadOnly,
+		IngestDir:    cfg.Server.IngestDir,
+		Open:         database.OpenOptions{Mode: cfg.Database.Mode, Replication: cfg.Database.Replication},
+		MaxLag:       time.Duration(cfg.Database.MaxLag) * time.Second,
+		TLS:          cfg.Server.TLS,
+		Metrics:      cfg.Server.Metrics,
+		UI:           cfg.Server.UI,
+		Warmup:       cfg.Server.Warmup,
+		Popularity:   cfg.Server.Popularity,
+		APISunset:    cfg.Server.APISunset,
+		LogLevel:     cfg.Server.LogLevel,
+		CacheTTL:     time.Duration(cfg.Search.CacheTTL) * time.Second,
+		Embeddings:   &cfg.Embeddings,
+		Catalog:      catalog,
+		AdminEmail:   adminEmail,
+		Version:      Version,
+
+		RerankModel:      cfg.Search.RerankModel,
+		RerankCandidates: cfg.Search.RerankCandidates,
+		NoExpand:         !cfg.Search.ExpandSynonyms,
+
+		LoadSettings: func() (*api.Settings, error) {
+			return loadServerSettings(cmd, cfg)
+		},
+	}
+	if cfg.Retention.AutoCleanup && cfg.Retention.CleanupInterval > 0 {
+		policy := retention.FromConfig(cfg.Retention)
+		serverConfig.Retention = &policy
+		serverConfig.CleanupInterval = time.Duration(cfg.Retention.CleanupInterval) * time.Hour
 	}
 
 	// Print initialization header
 	printPhase("Initializing srake server")
 	printInfo("Database: %s", serverDBPath)
 	printInfo("Index: %s", serverIndexPath)
+	if catalog.BaseURL != "" {
+		printInfo("Catalog URL: %s", catalog.BaseURL)
+	}
 
 	// Initialize API server with spinner
 	spinner := StartSpinner("Initializing server components")
-	server, err := api.NewServer(config)
+	server, err := api.NewServer(serverConfig)
 	if err != nil {
 		spinner.Stop(false, "failed")
 		return fmt.Errorf("failed to initialize server: %w", err)
 	}
 	spinner.Stop(true, "ready")
 
-	// Setup graceful shutdown
+	// Setup graceful shutdown, and config reloads on SIGHUP
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer api.ReloadOnHangup(server)()
 
 	// Start server in goroutine
 	serverErr := make(chan error, 1)
@@ -103,12 +294,35 @@ func runServer(cmd *cobra.Command, args []string) error {
 		printInfo("Database: %s", serverDBPath)
 		printInfo("Index: %s", serverIndexPath)
 
-		if serverEnableCORS {
-			printInfo("CORS enabled for web access")
+		if cfg.Server.CORS.Enabled {
+			printInfo("CORS enabled for %s", strings.Join(cfg.Server.CORS.AllowedOrigins, ", "))
+		}
+		if rl := cfg.Server.RateLimit; rl.Enabled {
+			printInfo("Rate limit: %g requests/s per client (burst %d)", rl.RequestsPerSecond, rl.Burst)
+		}
+		if cfg.Server.Auth.Enabled {
+			printInfo("API keys required (%d configured, more may be stored in the database)", len(cfg.Server.Auth.Keys))
+		}
+		if cfg.Server.ReadOnly {
+			printInfo("Read-only: changes, ingests and index rebuilds are refused")
 		}
 
-		printSuccess("\nServer ready at http://%s:%d", serverHost, serverPort)
-		printInfo("API documentation at http://%s:%d/", serverHost, serverPort)
+		scheme := "http"
+		if cfg.Server.TLS.Enabled {
+			scheme = "https"
+		}
+		printSuccess("\nServer ready at %s://%s:%d", scheme, serverHost, serverPort)
+		printInfo("API documentation at %s://%s:%d/", scheme, serverHost, serverPort)
+		printInfo("OAI-PMH endpoint at %s://%s:%d/oai", scheme, serverHost, serverPort)
+		if cfg.Server.UI {
+			printInfo("Web UI at %s://%s:%d/ui/", scheme, serverHost, serverPort)
+		}
+		if cfg.Server.Warmup.Enabled {
+			printInfo("Warming up; /readyz reports ready once done")
+		}
+		if cfg.Server.Metrics {
+			printInfo("Prometheus metrics at %s://%s:%d/metrics", scheme, serverHost, serverPort)
+		}
 
 		if err := server.Start(); err != nil {
 			serverErr <- err
@@ -135,3 +349,156 @@ func runServer(cmd *cobra.Command, args []string) error {
 	printSuccess("Server stopped gracefully")
 	return nil
 }
+
+// loadServerSettings reads the config files the server started from again,
+// with the flags of cmd still overriding them, and returns the settings a
+// running server applies. Settings changed from started that only a
+// restart applies are listed in Restart.
+func loadServerSettings(cmd *cobra.Command, started *config.Config) (*api.Settings, error) {
+	var cfg *config.Config
+	var report *config.Report
+	var err error
+	if serverConfigPath != "" {
+		cfg, report, err = config.LoadLayeredFile(serverConfigPath)
+	} else {
+		cfg, report, err = config.LoadLayered()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	for _, w := range report.Warnings {
+		log.Printf("Config warning: %s", w)
+	}
+	if cmd.Flags().Changed("enable-cors") {
+		cfg.Server.CORS.Enabled = serverEnableCORS
+	}
+
+	// Settings given as flags are not read from the config, and this
+	// server has no gRPC port
+	flags := map[string]string{
+		"database.path":     "db",
+		"search.index_path": "index",
+		"server.host":       "host",
+		"server.port":       "port",
+		"database.mode":     "replica",
+	}
+	return api.NewSettings(cfg, started, func(name string) bool {
+		return name == "server.grpc_port" || flags[name] != "" && cmd.Flags().Changed(flags[name])
+	}), nil
+}
+
+func runServerCheck(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	server, result, err := compat.Negotiate(ctx, http.DefaultClient, args[0], compat.Local(Version))
+	if err != nil {
+		return err
+	}
+
+	printInfo("Server:  srake %s (API schema %d)", server.Version, server.SchemaVersion)
+	printInfo("Client:  srake %s (API schema %d)", Version, compat.SchemaVersion)
+	if !result.Compatible {
+		printError("%s", result.Message)
+		return fmt.Errorf("incompatible server")
+	}
+	if len(result.Missing) > 0 || server.SchemaVersion > compat.SchemaVersion {
+		printWarning("%s", result.Message)
+		return nil
+	}
+	printSuccess("%s", result.Message)
+	return nil
+}
+
+// openKeysDB opens the database holding the API keys
+func openKeysDB() (*database.DB, error) {
+	dbPath := keysDBPath
+	if dbPath == "" {
+		cfg, _, err := config.LoadLayered()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		dbPath = cfg.Database.Path
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("database not found: %s", dbPath)
+	}
+	db, err := database.Initialize(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return db, nil
+}
+
+func runServerKeysCreate(cmd *cobra.Command, args []string) error {
+	if keysRate < 0 || keysBurst < 0 {
+		return fmt.Errorf("--rate and --burst must not be negative")
+	}
+	db, err := openKeysDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	key, err := db.CreateAPIKey(&database.APIKey{
+		Name:              args[0],
+		RequestsPerSecond: keysRate,
+		Burst:             keysBurst,
+		ReadOnly:          keysReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+	printSuccess("Created API key %s", args[0])
+	printInfo("Store the key now; it cannot be shown again")
+	fmt.Println(key)
+	return nil
+}
+
+func runServerKeysList(cmd *cobra.Command, args []string) error {
+	db, err := openKeysDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	keys, err := db.ListAPIKeys()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		printInfo("No API keys stored; create one with 'srake server keys create <name>'")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tRATE\tBURST\tACCESS\tCREATED")
+	for _, k := range keys {
+		rate, burst := "default", "default"
+		if k.RequestsPerSecond > 0 {
+			rate = fmt.Sprintf("%g/s", k.RequestsPerSecond)
+		}
+		if k.Burst > 0 {
+			burst = fmt.Sprintf("%d", k.Burst)
+		}
+		access := "read-write"
+		if k.ReadOnly {
+			access = "read-only"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.Name, rate, burst, access, k.CreatedAt.Format("2006-01-02"))
+	}
+	return w.Flush()
+}
+
+func runServerKeysRevoke(cmd *cobra.Command, args []string) error {
+	db, err := openKeysDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.DeleteAPIKey(args[0]); err != nil {
+		return err
+	}
+	printSuccess("Revoked API key %s", args[0])
+	return nil
+}
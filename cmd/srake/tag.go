@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/plan"
+	"github.com/spf13/cobra"
+)
+
+var tagCmd = &cobra.Command{
+	Use:     "tag",
+	Aliases: []string{"collection"},
+	Short:   "Organize records into named collections",
+	Long: `Group studies, experiments, samples, and runs into named collections.
+
+Collections are stored in the local database and survive re-ingest of upstream
+metadata. Use 'srake search --collection <name>' to search within a collection.`,
+	Example: `  # Add runs to a collection (created on first use)
+  srake tag add my-cohort SRR000001 SRR000002
+  srake tag add my-cohort --from accessions.txt
+
+  # List collections, or the members of one
+  srake tag list
+  srake tag list my-cohort
+
+  # Search within a collection
+  srake search "liver" --collection my-cohort`,
+}
+
+var tagAddCmd = &cobra.Command{
+	Use:   "add <collection> [accessions...]",
+	Short: "Add records to a collection",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runTagAdd,
+}
+
+var tagRemoveCmd = &cobra.Command{
+	Use:   "remove <collection> [accessions...]",
+	Short: "Remove records from a collection",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runTagRemove,
+}
+
+var tagListCmd = &cobra.Command{
+	Use:   "list [collection]",
+	Short: "List collections or the members of a collection",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runTagList,
+}
+
+var tagDeleteCmd = &cobra.Command{
+	Use:   "delete <collection>",
+	Short: "Delete a collection",
+	Long:  `Delete a collection and all of its memberships. The records themselves are not affected.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runTagDelete,
+}
+
+var (
+	tagFrom        string
+	tagDescription string
+	tagFormat      string
+)
+
+func init() {
+	tagAddCmd.Flags().StringVar(&tagFrom, "from", "", "File containing accessions (one per line)")
+	tagAddCmd.Flags().StringVarP(&tagDescription, "description", "d", "", "Collection description")
+	tagRemoveCmd.Flags().StringVar(&tagFrom, "from", "", "File containing accessions (one per line)")
+	tagListCmd.Flags().StringVarP(&tagFormat, "format", "f", "table", "Output format (table|json)")
+
+	tagCmd.AddCommand(tagAddCmd)
+	tagCmd.AddCommand(tagRemoveCmd)
+	tagCmd.AddCommand(tagListCmd)
+	tagCmd.AddCommand(tagDeleteCmd)
+}
+
+// collectTagAccessions gathers accessions from arguments, the --from file, and piped stdin.
+func collectTagAccessions(args []string) ([]string, error) {
+	accessions := args
+
+	if len(args) == 0 && tagFrom == "" {
+		stat, _ := os.Stdin.Stat()
+		if (stat.Mode() & os.ModeCharDevice) == 0 {
+			stdinAccessions, err := readAccessionsFromReader(os.Stdin)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read from stdin: %w", err)
+			}
+			accessions = stdinAccessions
+		}
+	}
+
+	if tagFrom != "" {
+		fileAccessions, err := readAccessionFile(tagFrom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read accession file: %w", err)
+		}
+		accessions = append(accessions, fileAccessions...)
+	}
+
+	if len(accessions) == 0 {
+		return nil, fmt.Errorf("no accessions provided")
+	}
+
+	return accessions, nil
+}
+
+func runTagAdd(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	accessions, err := collectTagAccessions(args[1:])
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if tagDescription != "" {
+		if err := db.CreateCollection(name, tagDescription); err != nil {
+			return fmt.Errorf("failed to create collection: %v", err)
+		}
+	}
+
+	members := make([]database.CollectionMember, 0, len(accessions))
+	for _, acc := range accessions {
+		acc = strings.ToUpper(acc)
+		accType := detectAccessionType(acc)
+		if accType == "unknown" {
+			printWarning("Skipping unknown accession type: %s", acc)
+			continue
+		}
+		members = append(members, database.CollectionMember{Accession: acc, RecordType: accType})
+	}
+
+	added, err := db.AddToCollection(name, members)
+	if err != nil {
+		return fmt.Errorf("failed to add to collection: %v", err)
+	}
+
+	if !quiet {
+		printSuccess("Added %d records to %s (%d already present)",
+			added, colorize(colorCyan, name), len(members)-added)
+	}
+	return nil
+}
+
+func runTagRemove(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	accessions, err := collectTagAccessions(args[1:])
+	if err != nil {
+		return err
+	}
+	for i, acc := range accessions {
+		accessions[i] = strings.ToUpper(acc)
+	}
+
+	if dryRun {
+		return writeDatabasePlan(func(db *database.DB, dbPath string) (*plan.Plan, error) {
+			return planTagRemove(db, dbPath, name, accessions)
+		})
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.GetCollection(name); err != nil {
+		return err
+	}
+
+	removed, err := db.RemoveFromCollection(name, accessions)
+	if err != nil {
+		return fmt.Errorf("failed to remove from collection: %v", err)
+	}
+
+	if !quiet {
+		printSuccess("Removed %d records from %s", removed, colorize(colorCyan, name))
+	}
+	return nil
+}
+
+// planTagRemove returns the plan of removing accessions from a collection,
+// counting those that are members
+func planTagRemove(db *database.DB, dbPath, name string, accessions []string) (*plan.Plan, error) {
+	if _, err := db.GetCollection(name); err != nil {
+		return nil, err
+	}
+	members, err := db.GetCollectionMembers(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection members: %v", err)
+	}
+	requested := make(map[string]bool, len(accessions))
+	for _, acc := range accessions {
+		requested[acc] = true
+	}
+	removed := 0
+	for _, m := range members {
+		if requested[m.Accession] {
+			removed++
+		}
+	}
+
+	p := plan.New("srake tag remove")
+	p.Database = dbPath
+	p.AddTable("collection_members", plan.AccessDelete, int64(removed))
+	p.AddDestructiveStep("Remove %d of the %d requested records from collection %s; the others are not members", removed, len(accessions), name)
+	return p, nil
+}
+
+func runTagList(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if len(args) == 0 {
+		collections, err := db.ListCollections()
+		if err != nil {
+			return fmt.Errorf("failed to list collections: %v", err)
+		}
+		if tagFormat == "json" {
+			return encodeTagJSON(collections)
+		}
+		if len(collections) == 0 {
+			printInfo("No collections found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\t%s\t%s\n", colorize(colorBold, "NAME"),
+			colorize(colorBold, "RECORDS"), colorize(colorBold, "DESCRIPTION"))
+		for _, c := range collections {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", colorize(colorCyan, c.Name), c.MemberCount, truncateStr(c.Description, 60))
+		}
+		return w.Flush()
+	}
+
+	name := args[0]
+	if _, err := db.GetCollection(name); err != nil {
+		return err
+	}
+	members, err := db.GetCollectionMembers(name)
+	if err != nil {
+		return fmt.Errorf("failed to list collection members: %v", err)
+	}
+	if tagFormat == "json" {
+		return encodeTagJSON(members)
+	}
+	if len(members) == 0 {
+		printInfo("Collection %s is empty", name)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\n", colorize(colorBold, "ACCESSION"),
+		colorize(colorBold, "TYPE"), colorize(colorBold, "ADDED"))
+	for _, m := range members {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", colorize(colorCyan, m.Accession), m.RecordType,
+			m.AddedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+func runTagDelete(cmd *cobra.Command, args []string) error {
+	if dryRun {
+		return writeDatabasePlan(func(db *database.DB, dbPath string) (*plan.Plan, error) {
+			c, err := db.GetCollection(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return planDelete("srake tag delete", dbPath, "collection", c.Name, "collections", "collection_members", "members", c.MemberCount), nil
+		})
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.DeleteCollection(args[0]); err != nil {
+		return err
+	}
+
+	if !quiet {
+		printSuccess("Deleted collection %s", colorize(colorCyan, args[0]))
+	}
+	return nil
+}
+
+func encodeTagJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
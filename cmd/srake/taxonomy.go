@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/taxonomy"
+	"github.com/spf13/cobra"
+)
+
+var taxonomyCmd = &cobra.Command{
+	Use:   "taxonomy",
+	Short: "Load and browse the NCBI taxonomy",
+	Long: `Load the NCBI taxonomy so searches can filter and facet samples at any
+taxonomic rank.
+
+Once loaded, indexing adds the lineage of each sample's taxon to the search
+index, and 'srake search --taxon <id|name> --include-descendants' matches a
+taxon and everything below it. Rebuild the index after loading the taxonomy
+for the first time.`,
+	Example: `  srake taxonomy load --download
+  srake taxonomy load ~/Downloads/taxdump.tar.gz
+  srake taxonomy lineage "Homo sapiens"
+  srake search --taxon 9443 --include-descendants`,
+}
+
+var taxonomyLoadCmd = &cobra.Command{
+	Use:   "load [<taxdump>]",
+	Short: "Load the NCBI taxonomy dump into the database",
+	Long: `Load the NCBI taxonomy dump (taxdump.tar.gz, or a directory holding its
+nodes.dmp and names.dmp) into the database, replacing any loaded before.
+With --download the dump is fetched from NCBI first.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runTaxonomyLoad,
+}
+
+var taxonomyLineageCmd = &cobra.Command{
+	Use:   "lineage <id|name>",
+	Short: "Show the lineage of a taxon",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runTaxonomyLineage,
+}
+
+var (
+	taxonomyDownload bool
+	taxonomyFormat   string
+)
+
+func init() {
+	taxonomyCmd.AddCommand(taxonomyLoadCmd)
+	taxonomyCmd.AddCommand(taxonomyLineageCmd)
+
+	taxonomyLoadCmd.Flags().BoolVar(&taxonomyDownload, "download", false, "Download the dump from NCBI")
+	taxonomyLineageCmd.Flags().StringVarP(&taxonomyFormat, "format", "f", "table", "Output format (table|json)")
+}
+
+func runTaxonomyLoad(cmd *cobra.Command, args []string) error {
+	var path string
+	switch {
+	case len(args) == 1 && taxonomyDownload:
+		return fmt.Errorf("give either a taxdump path or --download, not both")
+	case len(args) == 1:
+		path = args[0]
+	case taxonomyDownload:
+		var err error
+		if path, err = downloadTaxdump(cmd.Context()); err != nil {
+			return fmt.Errorf("failed to download taxonomy: %w", err)
+		}
+	default:
+		return fmt.Errorf("give a taxdump path or --download")
+	}
+
+	printInfo("Reading %s", path)
+	nodes, err := taxonomy.Load(path)
+	if err != nil {
+		return fmt.Errorf("failed to read taxonomy: %w", err)
+	}
+
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	taxa := make([]database.Taxon, len(nodes))
+	for i, n := range nodes {
+		taxa[i] = database.Taxon{
+			TaxID:    n.TaxID,
+			ParentID: n.ParentID,
+			Rank:     n.Rank,
+			Name:     n.Name,
+			Left:     n.Left,
+			Right:    n.Right,
+		}
+	}
+	if err := db.ReplaceTaxonomy(taxa); err != nil {
+		return fmt.Errorf("failed to store taxonomy: %w", err)
+	}
+
+	printSuccess("Loaded %d taxa", len(taxa))
+	printInfo("Rebuild the search index ('srake index --rebuild') to add sample lineages")
+	return nil
+}
+
+// downloadTaxdump fetches the taxonomy dump to the downloads directory,
+// keeping a copy that still matches the checksum NCBI publishes
+func downloadTaxdump(ctx context.Context) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	file := downloader.ManifestFile{URL: taxonomy.DumpURL, Path: filepath.Base(taxonomy.DumpURL)}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, taxonomy.DumpURL+".md5", nil)
+	if err != nil {
+		return "", err
+	}
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if fields := strings.Fields(string(body)); resp.StatusCode == http.StatusOK && len(fields) > 0 {
+			file.MD5 = fields[0]
+		}
+	}
+	if file.MD5 == "" {
+		// Without a checksum an earlier copy may be stale
+		os.Remove(filepath.Join(paths.GetDownloadsPath(), file.Path))
+	}
+
+	printInfo("Downloading %s", taxonomy.DumpURL)
+	result, err := downloader.NewFetcher(paths.GetDownloadsPath()).Fetch(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	if result.Skipped {
+		printInfo("Using the current dump already downloaded")
+	}
+	return result.Path, nil
+}
+
+func runTaxonomyLineage(cmd *cobra.Command, args []string) error {
+	db, err := database.Initialize(paths.GetDatabasePath())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	taxon, err := db.ResolveTaxon(args[0])
+	if err != nil {
+		if n, _ := db.CountTaxa(); n == 0 {
+			return fmt.Errorf("no taxonomy loaded; run 'srake taxonomy load --download' first")
+		}
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	lineage, err := db.TaxonLineage(taxon.TaxID)
+	if err != nil {
+		return err
+	}
+	samples, err := db.CountDescendantSamples(taxon.TaxID)
+	if err != nil {
+		return err
+	}
+
+	if taxonomyFormat == "json" {
+		return printJSON(map[string]interface{}{
+			"taxon":   taxon,
+			"lineage": lineage,
+			"samples": samples,
+		})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\n", colorize(colorBold, "TAX ID"), colorize(colorBold, "RANK"), colorize(colorBold, "NAME"))
+	for _, t := range lineage {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", colorize(colorCyan, fmt.Sprint(t.TaxID)), t.Rank, t.Name)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !quiet {
+		printInfo("%d samples are %s or below it", samples, taxon.Name)
+	}
+	return nil
+}
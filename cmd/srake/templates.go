@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/templates"
+	"github.com/spf13/cobra"
+)
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates [name]",
+	Short: "List query templates or print one as YAML",
+	Long: `List the query templates available to 'srake search --template'.
+
+A template is a reviewed, parameterized set of search filters for a common
+use case. With a name, prints the template as YAML, which can be edited and
+saved to the templates directory to share it: a template there is used by
+its name and replaces a built-in template of the same name. Set
+SRAKE_TEMPLATES_PATH to a shared directory to use a team's templates.`,
+	Example: `  srake templates
+  srake templates covid-wastewater
+  srake search --template covid-wastewater --param country=Japan
+
+  # Customize a template; the copy replaces the built-in one
+  srake templates gut-microbiome > ~/.config/srake/templates/gut-microbiome.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runTemplates,
+}
+
+func runTemplates(cmd *cobra.Command, args []string) error {
+	if len(args) == 1 {
+		tpl, err := templates.Load(args[0])
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(tpl.YAML())
+		return nil
+	}
+
+	list, err := templates.List()
+	if err != nil {
+		return err
+	}
+	fmt.Println(colorize(colorBold, "Templates:"))
+	for _, tpl := range list {
+		fmt.Printf("  %-20s %s\n", colorize(colorCyan, tpl.Name), tpl.Description)
+		if tpl.Source != templates.Builtin {
+			fmt.Printf("  %-20s from %s\n", "", tpl.Source)
+		}
+		for _, p := range tpl.Params {
+			param := "--param " + p.Name + "=..."
+			switch {
+			case p.Required:
+				param += " (required)"
+			case p.Default != "":
+				param += fmt.Sprintf(" (default %s)", p.Default)
+			}
+			fmt.Printf("  %-20s %s\n", "", colorize(colorGray, param))
+		}
+	}
+	fmt.Printf("\nTemplates directory: %s\n", paths.GetTemplatesPath())
+	fmt.Println("Run 'srake templates <name>' to print a template as YAML.")
+	return nil
+}
+
+// applySearchTemplate sets the search flags a template filters on, except
+// those given on the command line, and returns the template's query
+func applySearchTemplate(cmd *cobra.Command, name string, params []string) (string, error) {
+	values, err := templates.ParseParams(params)
+	if err != nil {
+		return "", err
+	}
+	tpl, err := templates.Load(name)
+	if err != nil {
+		return "", err
+	}
+	query, filters, err := tpl.Expand(values)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(filters))
+	for flag := range filters {
+		names = append(names, flag)
+	}
+	sort.Strings(names)
+	for _, flag := range names {
+		f := cmd.Flags().Lookup(flag)
+		if f == nil || flag == "template" || flag == "param" {
+			return "", fmt.Errorf("template %s: unknown filter %q (filters are 'srake search' flags)", tpl.Name, flag)
+		}
+		if f.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(flag, filters[flag]); err != nil {
+			return "", fmt.Errorf("template %s: invalid %s: %v", tpl.Name, flag, err)
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nishad/srake/internal/templates"
+)
+
+// TestTemplatesMatchSearchFlags checks that every built-in template filters
+// only on flags 'srake search' has
+func TestTemplatesMatchSearchFlags(t *testing.T) {
+	t.Setenv("SRAKE_TEMPLATES_PATH", t.TempDir())
+	list, err := templates.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tpl := range list {
+		for flag := range tpl.Filters {
+			if searchCmd.Flags().Lookup(flag) == nil || flag == "template" || flag == "param" {
+				t.Errorf("%s: unknown filter %q", tpl.Name, flag)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nishad/srake/internal/validator"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <file|dir|tar.gz>...",
+	Short: "Validate SRA XML files before submitting them",
+	Long: `Check SRA XML documents for the problems that get submissions rejected:
+XML that does not parse, missing required fields, values outside the SRA
+vocabularies, and malformed references.
+
+Each argument may be an XML document, gzipped or plain, a tar or tar.gz
+archive, whose XML documents are checked, or a directory, whose .xml,
+.xml.gz, .tar, .tar.gz and .tgz files are. Problems are reported per file
+as errors or warnings; --strict reports warnings as errors.
+
+With --schema, documents are instead validated against the official SRA
+XSDs bundled with srake (study, sample, experiment, run, analysis and
+submission), and each error is reported at its line and column.
+
+The command exits non-zero when any file has errors, so that it can gate a
+submission pipeline. --format sarif writes SARIF 2.1.0 for code scanning
+tools such as GitHub's.`,
+	Example: `  # Check the XML of a submission
+  srake validate submission/
+
+  # Fail on warnings too, as JSON
+  srake validate --strict --format json experiment.xml run.xml
+
+  # Check against the SRA XSDs
+  srake validate --schema submission/
+
+  # Upload the findings to GitHub code scanning
+  srake validate --format sarif submission.tar.gz > srake.sarif`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runValidate,
+}
+
+var (
+	validateFormat string
+	validateStrict bool
+	validateSchema bool
+)
+
+func init() {
+	validateCmd.Flags().StringVarP(&validateFormat, "format", "f", "table", "Output format (table|json|sarif)")
+	validateCmd.Flags().BoolVar(&validateStrict, "strict", false, "Report warnings as errors")
+	validateCmd.Flags().BoolVar(&validateSchema, "schema", false, "Validate against the bundled official SRA XSDs")
+}
+
+// validateReport is the JSON output of srake validate
+type validateReport struct {
+	Files    int                    `json:"files"`
+	Failed   int                    `json:"failed"`
+	Errors   int                    `json:"errors"`
+	Warnings int                    `json:"warnings"`
+	Results  []validator.FileResult `json:"results"`
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	if validateFormat != "table" && validateFormat != "json" && validateFormat != "sarif" {
+		return fmt.Errorf("invalid format: %s (must be table, json or sarif)", validateFormat)
+	}
+
+	v := validator.NewValidator(validator.ValidationConfig{
+		ValidateEnumerations: true,
+		ValidateReferences:   true,
+		ValidateRequired:     true,
+		StrictMode:           validateStrict,
+		Schema:               validateSchema,
+	})
+	report := validateReport{Results: []validator.FileResult{}}
+	for _, arg := range args {
+		results, err := v.ValidatePath(arg)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", arg, err)
+		}
+		report.Results = append(report.Results, results...)
+	}
+	for i := range report.Results {
+		r := &report.Results[i]
+		if r.Failed() {
+			report.Failed++
+		}
+		if r.Error != "" {
+			report.Errors++
+		} else if r.Result != nil {
+			report.Errors += len(r.Result.Errors)
+			report.Warnings += len(r.Result.Warnings)
+		}
+	}
+	report.Files = len(report.Results)
+
+	var err error
+	switch validateFormat {
+	case "json":
+		err = printJSON(report)
+	case "sarif":
+		err = validator.WriteSARIF(os.Stdout, report.Results, "srake", Version)
+	default:
+		err = printValidateTable(&report)
+	}
+	if err != nil {
+		return err
+	}
+
+	if report.Failed > 0 {
+		// The report explains the failure; usage would only bury it
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d files failed validation", report.Failed, report.Files)
+	}
+	return nil
+}
+
+// printValidateTable prints each error and warning of a report, then a
+// summary
+func printValidateTable(report *validateReport) error {
+	if report.Files == 0 {
+		printWarning("No XML files found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	problems := 0
+	for i := range report.Results {
+		r := &report.Results[i]
+		if r.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name(), colorize(colorRed, "error"), "READ_ERROR", r.Error)
+			problems++
+			continue
+		}
+		if r.Result == nil {
+			continue
+		}
+		for _, e := range r.Result.Errors {
+			name := r.Name()
+			if e.Line > 0 {
+				name = fmt.Sprintf("%s:%d", name, e.Line)
+				if e.Column > 0 {
+					name = fmt.Sprintf("%s:%d", name, e.Column)
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, colorize(colorRed, "error"), e.Type, e.Message)
+			problems++
+		}
+		for _, warn := range r.Result.Warnings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name(), colorize(colorYellow, "warning"), warn.Type, warn.Message)
+			problems++
+		}
+	}
+	if problems > 0 {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+
+	if quiet {
+		return nil
+	}
+	if report.Failed == 0 {
+		printSuccess("%d files valid, %d warnings", report.Files, report.Warnings)
+	} else {
+		fmt.Printf("%d files checked: %d failed, %d errors, %d warnings\n",
+			report.Files, report.Failed, report.Errors, report.Warnings)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+)
+
+// authExempt are the paths served without an API key, so that load
+// balancers can check the server's health and readiness and clients its
+// version, in every API version
+var authExempt = func() map[string]bool {
+	exempt := map[string]bool{"/readyz": true}
+	for i := range apiVersions {
+		exempt[apiVersions[i].prefix()+"/health"] = true
+		exempt[apiVersions[i].prefix()+"/version"] = true
+	}
+	return exempt
+}()
+
+// apiKey is the API key a request was made with
+type apiKey struct {
+	name     string
+	rate     float64 // requests per second; 0 uses the server's rate limit
+	burst    int
+	readOnly bool
+}
+
+// apiKeyContextKey is the context key of the API key of a request
+type apiKeyContextKey struct{}
+
+// requestAPIKey returns the API key a request was made with, or nil when
+// the server does not require keys
+func requestAPIKey(ctx context.Context) *apiKey {
+	k, _ := ctx.Value(apiKeyContextKey{}).(*apiKey)
+	return k
+}
+
+// keyStore finds API keys among those listed in the config and those
+// stored in the database
+type keyStore struct {
+	configured map[string]*apiKey // by SHA-256 hash in hex
+	db         *database.DB       // nil when keys are only configured
+}
+
+// newKeyStore returns a store of the keys in cfg and db
+func newKeyStore(cfg config.AuthConfig, db *database.DB) (*keyStore, error) {
+	s := &keyStore{configured: make(map[string]*apiKey), db: db}
+	for _, k := range cfg.Keys {
+		hash := strings.ToLower(k.KeySHA256)
+		if k.Key != "" {
+			hash = database.HashAPIKey(k.Key)
+		}
+		if k.Name == "" || hash == "" {
+			return nil, fmt.Errorf("server.auth.keys: every key needs a name, and a key or key_sha256")
+		}
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("server.auth.keys: key_sha256 of %s is not a SHA-256 hash in hex", k.Name)
+		}
+		s.configured[hash] = &apiKey{name: k.Name, rate: k.RequestsPerSecond, burst: k.Burst, readOnly: k.ReadOnly}
+	}
+	return s, nil
+}
+
+// lookup returns the key matching key, or nil if there is none
+func (s *keyStore) lookup(key string) (*apiKey, error) {
+	if k, ok := s.configured[database.HashAPIKey(key)]; ok {
+		return k, nil
+	}
+	if s.db == nil {
+		return nil, nil
+	}
+	stored, err := s.db.LookupAPIKey(key)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	return &apiKey{name: stored.Name, rate: stored.RequestsPerSecond, burst: stored.Burst, readOnly: stored.ReadOnly}, nil
+}
+
+// middleware answers requests without a valid API key with 401
+// Unauthorized, and passes the key of the others on in their context
+func (s *keyStore) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || authExempt[r.URL.Path] || isUIPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := requestKey(r)
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="srake"`)
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+		k, err := s.lookup(key)
+		if err != nil {
+			log.Printf("API key lookup failed: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if k == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="srake", error="invalid_token"`)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, k)))
+	})
+}
+
+// requestKey returns the API key sent as a bearer token or in the
+// X-API-Key header
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// refuseWrite answers with 403 Forbidden and returns true when the server,
+// or the API key of r, is read-only
+func (s *Server) refuseWrite(w http.ResponseWriter, r *http.Request) bool {
+	if s.db.ReadOnly() {
+		s.writeError(w, http.StatusForbidden, "This server is a read-only replica; send changes to the primary")
+		return true
+	}
+	if s.readOnly {
+		s.writeError(w, http.StatusForbidden, "This server is read-only")
+		return true
+	}
+	if k := requestAPIKey(r.Context()); k != nil && k.readOnly {
+		s.writeError(w, http.StatusForbidden, fmt.Sprintf("API key %s is read-only", k.name))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nishad/srake/internal/processor"
+)
+
+// jobEventInterval is how often a job event stream checks the job for
+// changes
+var jobEventInterval = time.Second
+
+// handleJobEvents streams the progress of a job as Server-Sent Events. A
+// "status" event carries the job whenever its status changes, and a
+// "progress" event carries the processor progress of running ingests and
+// index rebuilds. The stream ends after the job finishes.
+func (s *Server) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	job, err := s.jobService.Get(ctx, id)
+	if err != nil {
+		s.writeJobError(w, err)
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep proxies from buffering events
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, data interface{}) bool {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !send("status", job) {
+		return
+	}
+	status := job.Status
+	var last processor.Progress
+
+	ticker := time.NewTicker(jobEventInterval)
+	defer ticker.Stop()
+	for !job.IsFinished() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if p, ok := s.jobService.Progress(id); ok && p != last {
+			if !send("progress", p) {
+				return
+			}
+			last = p
+		}
+		if job, err = s.jobService.Get(ctx, id); err != nil {
+			return
+		}
+		if job.Status != status {
+			if !send("status", job) {
+				return
+			}
+			status = job.Status
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/service"
+)
+
+// maxGraphQLRequestSize bounds the body of a GraphQL POST request
+const maxGraphQLRequestSize = 1 << 20
+
+// maxGraphQLStudies caps the page size of the studies query, matching the
+// REST listing
+const maxGraphQLStudies = 100
+
+// maxGraphQLList caps the limit of the nested lists of a record, such as
+// the samples of a study, which return defaultGraphQLList records unless
+// given a limit
+const (
+	maxGraphQLList     = 1000
+	defaultGraphQLList = 20
+)
+
+// maxGraphQLRecords caps the records a query may return, counting each
+// list at its limit, so that nesting lists cannot fan out without bound
+const maxGraphQLRecords = 10000
+
+// maxGraphQLDepth is the deepest field nesting a query may select
+const maxGraphQLDepth = 15
+
+// graphQLRequest is a GraphQL request as sent over HTTP
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// graphQLErrors is the response to a request that fails before it is
+// executed, which has no data
+type graphQLErrors struct {
+	Errors []gqlerrors.FormattedError `json:"errors"`
+}
+
+// newGraphQLSchema maps studies, experiments, samples and runs, with their
+// relationships, onto the metadata service. Field names follow the JSON
+// field names of the REST API.
+func newGraphQLSchema(meta *service.MetadataService) (graphql.Schema, error) {
+	// notFound turns a missing record into a null result
+	notFound := func(record interface{}, err error) (interface{}, error) {
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return record, nil
+	}
+	accessionArg := graphql.FieldConfigArgument{
+		"accession": {Type: graphql.NewNonNull(graphql.ID), Description: "Record accession."},
+	}
+	// list returns a list field of t, resolved by fetch with its limit
+	list := func(t graphql.Type, description string, defaultLimit int, fetch func(p graphql.ResolveParams, limit int) (interface{}, error)) *graphql.Field {
+		return &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(t))),
+			Description: description,
+			Args: graphql.FieldConfigArgument{
+				"limit": {Type: graphql.Int, DefaultValue: defaultLimit, Description: fmt.Sprintf("Maximum records, at most %d.", maxGraphQLList)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				limit, _ := p.Args["limit"].(int)
+				if err := checkGraphQLLimit(limit, maxGraphQLList); err != nil {
+					return nil, err
+				}
+				return fetch(p, limit)
+			},
+		}
+	}
+	metadata := &graphql.Field{Type: graphql.String, Description: "Full record metadata as a JSON document."}
+
+	var study, experiment, sample, run *graphql.Object
+	study = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Study",
+		Description: "An SRA study (SRP, ERP or DRP).",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"study_accession": {Type: graphql.NewNonNull(graphql.ID)},
+				"study_title":     {Type: graphql.String},
+				"study_abstract":  {Type: graphql.String},
+				"study_type":      {Type: graphql.String},
+				"organism":        {Type: graphql.String},
+				"submission_date": {Type: graphql.DateTime, Description: "RFC 3339 timestamp."},
+				"metadata":        metadata,
+				"experiments": list(experiment, "Experiments of the study.", defaultGraphQLList, func(p graphql.ResolveParams, limit int) (interface{}, error) {
+					return meta.GetExperimentsByStudy(p.Context, p.Source.(*database.Study).StudyAccession, limit)
+				}),
+				"samples": list(sample, "Samples of the study's experiments.", defaultGraphQLList, func(p graphql.ResolveParams, limit int) (interface{}, error) {
+					return meta.GetSamplesByStudy(p.Context, p.Source.(*database.Study).StudyAccession, limit)
+				}),
+				"runs": list(run, "Runs of the study's experiments.", 100, func(p graphql.ResolveParams, limit int) (interface{}, error) {
+					return meta.GetRunsByStudy(p.Context, p.Source.(*database.Study).StudyAccession, limit)
+				}),
+			}
+		}),
+	})
+
+	experiment = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Experiment",
+		Description: "An SRA experiment (SRX, ERX or DRX).",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"experiment_accession": {Type: graphql.NewNonNull(graphql.ID)},
+				"study_accession":      {Type: graphql.String},
+				"title":                {Type: graphql.String},
+				"library_strategy":     {Type: graphql.String},
+				"library_source":       {Type: graphql.String},
+				"platform":             {Type: graphql.String},
+				"instrument_model":     {Type: graphql.String},
+				"metadata":             metadata,
+				"study": {Type: study, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return notFound(meta.GetStudy(p.Context, p.Source.(*database.Experiment).StudyAccession))
+				}},
+				"samples": list(sample, "Samples the experiment sequenced.", defaultGraphQLList, func(p graphql.ResolveParams, limit int) (interface{}, error) {
+					return meta.GetSamplesByExperiment(p.Context, p.Source.(*database.Experiment).ExperimentAccession, limit)
+				}),
+				"runs": list(run, "Runs of the experiment.", defaultGraphQLList, func(p graphql.ResolveParams, limit int) (interface{}, error) {
+					return meta.GetRunsByExperiment(p.Context, p.Source.(*database.Experiment).ExperimentAccession, limit)
+				}),
+			}
+		}),
+	})
+
+	sample = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Sample",
+		Description: "An SRA sample (SRS, ERS or DRS).",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"sample_accession": {Type: graphql.NewNonNull(graphql.ID)},
+				"organism":         {Type: graphql.String},
+				"scientific_name":  {Type: graphql.String},
+				"taxon_id":         {Type: graphql.Int},
+				"tissue":           {Type: graphql.String},
+				"cell_type":        {Type: graphql.String},
+				"description":      {Type: graphql.String},
+				"metadata":         metadata,
+				"experiments": list(experiment, "Experiments that sequenced the sample.", defaultGraphQLList, func(p graphql.ResolveParams, limit int) (interface{}, error) {
+					return meta.GetExperimentsBySample(p.Context, p.Source.(*database.Sample).SampleAccession, limit)
+				}),
+				"runs": list(run, "Runs of the experiments that sequenced the sample.", defaultGraphQLList, func(p graphql.ResolveParams, limit int) (interface{}, error) {
+					return meta.GetRunsBySample(p.Context, p.Source.(*database.Sample).SampleAccession, limit)
+				}),
+			}
+		}),
+	})
+
+	run = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Run",
+		Description: "An SRA run (SRR, ERR or DRR).",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"run_accession":        {Type: graphql.NewNonNull(graphql.ID)},
+				"experiment_accession": {Type: graphql.String},
+				// Spot and base counts overflow GraphQL's 32-bit Int
+				"total_spots": {Type: graphql.Float},
+				"total_bases": {Type: graphql.Float},
+				"published":   {Type: graphql.String},
+				"metadata":    metadata,
+				"experiment": {Type: experiment, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return notFound(meta.GetExperiment(p.Context, p.Source.(*database.Run).ExperimentAccession))
+				}},
+			}
+		}),
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"study": {Type: study, Args: accessionArg, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return notFound(meta.GetStudy(p.Context, p.Args["accession"].(string)))
+			}},
+			"experiment": {Type: experiment, Args: accessionArg, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return notFound(meta.GetExperiment(p.Context, p.Args["accession"].(string)))
+			}},
+			"sample": {Type: sample, Args: accessionArg, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return notFound(meta.GetSample(p.Context, p.Args["accession"].(string)))
+			}},
+			"run": {Type: run, Args: accessionArg, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return notFound(meta.GetRun(p.Context, p.Args["accession"].(string)))
+			}},
+			"studies": {
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(study))),
+				Description: "Studies in accession order.",
+				Args: graphql.FieldConfigArgument{
+					"limit":  {Type: graphql.Int, DefaultValue: 20, Description: fmt.Sprintf("Page size, at most %d.", maxGraphQLStudies)},
+					"offset": {Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, _ := p.Args["limit"].(int)
+					offset, _ := p.Args["offset"].(int)
+					if err := checkGraphQLLimit(limit, maxGraphQLStudies); err != nil {
+						return nil, err
+					}
+					if offset < 0 {
+						return nil, fmt.Errorf("offset must not be negative")
+					}
+					return meta.GetStudies(p.Context, limit, offset)
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// checkGraphQLLimit checks the limit of a list field
+func checkGraphQLLimit(limit, max int) error {
+	if limit < 1 || limit > max {
+		return fmt.Errorf("limit must be between 1 and %d", max)
+	}
+	return nil
+}
+
+// handleGraphQL executes a GraphQL query sent as GET parameters, a JSON
+// POST body, or an application/graphql POST body
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeGraphQLRequest(w, r)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, graphQLErrors{gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		s.writeJSON(w, http.StatusOK, graphQLErrors{gqlerrors.FormatErrors(err)})
+		return
+	}
+	if result := graphql.ValidateDocument(&s.graphql, doc, nil); !result.IsValid {
+		s.writeJSON(w, http.StatusOK, graphQLErrors{result.Errors})
+		return
+	}
+	if err := checkGraphQLCost(s.graphql, doc, req); err != nil {
+		s.writeJSON(w, http.StatusOK, graphQLErrors{gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.graphql,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       r.Context(),
+	}))
+}
+
+func decodeGraphQLRequest(w http.ResponseWriter, r *http.Request) (*graphQLRequest, error) {
+	req := &graphQLRequest{}
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return nil, fmt.Errorf("invalid variables: %v", err)
+			}
+		}
+	} else {
+		body := http.MaxBytesReader(w, r.Body, maxGraphQLRequestSize)
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			data, err := io.ReadAll(body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read request: %v", err)
+			}
+			req.Query = string(data)
+		} else if err := json.NewDecoder(body).Decode(req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	return req, nil
+}
+
+// graphQLCost walks the operation of a validated query, counting the
+// records it may return with each list at its limit
+type graphQLCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	records   int
+}
+
+// checkGraphQLCost refuses a query nested deeper than maxGraphQLDepth, with
+// a list limit out of range, or that may return more than
+// maxGraphQLRecords records. Introspection fields are not counted.
+func checkGraphQLCost(schema graphql.Schema, doc *ast.Document, req *graphQLRequest) error {
+	c := &graphQLCost{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: req.Variables,
+	}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			c.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if req.OperationName == "" || (def.Name != nil && def.Name.Value == req.OperationName) {
+				op = def
+			}
+		}
+	}
+	if op == nil || op.Operation != ast.OperationTypeQuery {
+		return nil // Left to execution to report
+	}
+	for _, v := range op.VariableDefinitions {
+		if _, given := req.Variables[v.Variable.Name.Value]; !given && v.DefaultValue != nil {
+			if c.variables == nil {
+				c.variables = make(map[string]interface{})
+			}
+			c.variables[v.Variable.Name.Value] = v.DefaultValue.GetValue()
+		}
+	}
+	return c.walk(op.SelectionSet, schema.QueryType(), 1, 1)
+}
+
+func (c *graphQLCost) walk(set *ast.SelectionSet, parent *graphql.Object, multiplier, depth int) error {
+	if set == nil {
+		return nil
+	}
+	if depth > maxGraphQLDepth {
+		return fmt.Errorf("query exceeds the maximum depth of %d", maxGraphQLDepth)
+	}
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.InlineFragment:
+			if err := c.walk(selection.SelectionSet, parent, multiplier, depth); err != nil {
+				return err
+			}
+		case *ast.FragmentSpread:
+			if fragment := c.fragments[selection.Name.Value]; fragment != nil {
+				if err := c.walk(fragment.SelectionSet, parent, multiplier, depth); err != nil {
+					return err
+				}
+			}
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+			def := parent.Fields()[selection.Name.Value]
+			if def == nil {
+				continue
+			}
+			t, isList := unwrapGraphQLType(def.Type)
+			object, ok := t.(*graphql.Object)
+			if !ok {
+				continue
+			}
+			count := 1
+			if isList {
+				limit, err := c.limit(selection, def)
+				if err != nil {
+					return err
+				}
+				count = limit
+			}
+			c.records += multiplier * count
+			if c.records > maxGraphQLRecords {
+				return fmt.Errorf("query may return over %d records; lower the limits of its lists", maxGraphQLRecords)
+			}
+			if err := c.walk(selection.SelectionSet, object, multiplier*count, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// limit returns the limit argument of a list field, given in the query, as
+// a variable, or by its default
+func (c *graphQLCost) limit(field *ast.Field, def *graphql.FieldDefinition) (int, error) {
+	var value interface{}
+	maxLimit := maxGraphQLList
+	for _, arg := range def.Args {
+		if arg.Name() == "limit" {
+			value = arg.DefaultValue
+		}
+	}
+	if def.Name == "studies" {
+		maxLimit = maxGraphQLStudies
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.Variable:
+			if given, ok := c.variables[v.Name.Value]; ok {
+				value = given
+			}
+		default:
+			value = v.GetValue()
+		}
+	}
+
+	var limit int
+	switch v := value.(type) {
+	case int:
+		limit = v
+	case float64:
+		limit = int(v)
+	case string:
+		fmt.Sscan(v, &limit)
+	}
+	return limit, checkGraphQLLimit(limit, maxLimit)
+}
+
+// unwrapGraphQLType returns the named type of t and whether it is a list
+func unwrapGraphQLType(t graphql.Type) (graphql.Type, bool) {
+	isList := false
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		case *graphql.List:
+			isList = true
+			t = wrapped.OfType
+		default:
+			return t, isList
+		}
+	}
+}
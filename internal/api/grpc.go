@@ -0,0 +1,423 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/export"
+	"github.com/nishad/srake/internal/search"
+	"github.com/nishad/srake/internal/service"
+	srakev1 "github.com/nishad/srake/proto/srake/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// grpcExportPage is the number of search hits a streamed export reads
+// from the index at a time
+const grpcExportPage = 1000
+
+// grpcRecordType is a record type of the gRPC API. Its message has the
+// columns of its table as fields of the same names, and is the field of
+// the Record message named as the type.
+type grpcRecordType struct {
+	table   string
+	columns []string
+}
+
+var grpcRecordTypes = map[string]grpcRecordType{
+	"study": {table: "studies", columns: []string{
+		"study_accession", "study_title", "study_abstract", "study_type",
+		"organism", "submission_date", "metadata",
+	}},
+	"experiment": {table: "experiments", columns: []string{
+		"experiment_accession", "study_accession", "title", "library_strategy",
+		"library_source", "platform", "instrument_model", "metadata",
+	}},
+	"sample": {table: "samples", columns: []string{
+		"sample_accession", "experiment_accession", "organism", "scientific_name",
+		"taxon_id", "tissue", "cell_type", "description", "metadata",
+	}},
+	"run": {table: "runs", columns: []string{
+		"run_accession", "experiment_accession", "total_spots", "total_bases",
+		"published", "metadata",
+	}},
+}
+
+// grpcAPI implements the srake gRPC service of proto/srake/v1/srake.proto
+// over the database and search backend of the HTTP API
+type grpcAPI struct {
+	srakev1.UnimplementedSrakeServer
+	db       *database.DB
+	backend  search.SearchBackend
+	metadata *service.MetadataService
+}
+
+// newGRPCServer returns a gRPC server of the srake service. Each call is
+// first passed through middleware when it is set, the API key and rate
+// limit middleware of the HTTP API around grpcPassed, and refused if the
+// middleware refuses it.
+func newGRPCServer(db *database.DB, backend search.SearchBackend, middleware http.Handler, opts ...grpc.ServerOption) *grpc.Server {
+	g := &grpcAPI{db: db, backend: backend, metadata: service.NewMetadataService(db)}
+	if middleware != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := grpcAuthorize(ctx, info.FullMethod, middleware); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := grpcAuthorize(ss.Context(), info.FullMethod, middleware); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+	srv := grpc.NewServer(opts...)
+	srakev1.RegisterSrakeServer(srv, g)
+	return srv
+}
+
+// grpcTLS returns the option serving gRPC over TLS as server.tls sets it
+// for the HTTP API, or none without TLS
+func grpcTLS(cfg config.TLSConfig) ([]grpc.ServerOption, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(tlsConfig))}, nil
+}
+
+// grpcPassed is the handler at the end of the middleware gRPC calls are
+// checked with; a call that reaches it is let through
+var grpcPassed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+})
+
+// grpcAuthorize runs a call to method through middleware as a request
+// with the call's metadata as headers, and returns the status matching
+// the response if the middleware refuses it
+func grpcAuthorize(ctx context.Context, method string, middleware http.Handler) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, method, nil)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, values := range md {
+		for _, v := range values {
+			r.Header.Add(k, v)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	w := &grpcAuthResponse{header: make(http.Header)}
+	middleware.ServeHTTP(w, r)
+	code := codes.Unavailable
+	switch w.status {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusInternalServerError:
+		code = codes.Internal
+	}
+	return status.Error(code, strings.TrimSpace(w.body.String()))
+}
+
+// grpcAuthResponse records the response of the middleware to a call
+type grpcAuthResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *grpcAuthResponse) Header() http.Header { return w.header }
+
+func (w *grpcAuthResponse) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *grpcAuthResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// GRPC returns the gRPC API, to be served on a port of its own. It has the
+// API keys, rate limits and TLS settings of the HTTP API, though its
+// clients are limited apart from those of the HTTP port.
+func (h *Handler) GRPC() *grpc.Server {
+	return h.grpcServer
+}
+
+func (g *grpcAPI) Search(ctx context.Context, req *srakev1.SearchRequest) (*srakev1.SearchResponse, error) {
+	const maxQueryLength = 1000
+	if len(req.Query) > maxQueryLength {
+		return nil, status.Errorf(codes.InvalidArgument, "query too long (max %d characters)", maxQueryLength)
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	if req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative offset")
+	}
+
+	result, err := g.backend.Search(req.Query, search.SearchOptions{
+		Limit:        limit,
+		Offset:       int(req.Offset),
+		Filters:      searchFilters(req.Filters),
+		IncludeScore: true,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "search failed: %v", err)
+	}
+
+	resp := &srakev1.SearchResponse{Total: int64(result.TotalHits), TookMs: result.TimeMs}
+	for _, hit := range result.Hits {
+		field := func(name string) string {
+			s, _ := hit.Fields[name].(string)
+			return s
+		}
+		resp.Hits = append(resp.Hits, &srakev1.SearchHit{
+			Id:              hit.ID,
+			Type:            hit.Type,
+			Title:           field("title"),
+			Organism:        field("organism"),
+			Platform:        field("platform"),
+			LibraryStrategy: field("library_strategy"),
+			Score:           hit.Score,
+		})
+	}
+	return resp, nil
+}
+
+func (g *grpcAPI) GetRecord(ctx context.Context, req *srakev1.GetRecordRequest) (*srakev1.Record, error) {
+	if req.Accession == "" {
+		return nil, status.Error(codes.InvalidArgument, "accession required")
+	}
+	typ, err := g.metadata.GetAccessionType(ctx, req.Accession)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "accession not found: %s", req.Accession)
+	}
+
+	var record *srakev1.Record
+	err = g.dump(ctx, typ, export.DumpOptions{Accessions: []string{req.Accession}}, func(r *srakev1.Record) error {
+		record = r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, status.Errorf(codes.NotFound, "accession not found: %s", req.Accession)
+	}
+	return record, nil
+}
+
+// ListRuns streams the runs of a study, experiment or sample in accession
+// order, straight from the query
+func (g *grpcAPI) ListRuns(req *srakev1.ListRunsRequest, stream grpc.ServerStreamingServer[srakev1.Run]) error {
+	columns, err := g.columns(grpcRecordTypes["run"])
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = `r."` + col.Name + `"`
+	}
+	selectCols := strings.Join(names, ", ")
+
+	var query, accession string
+	set := 0
+	if req.StudyAccession != "" {
+		set++
+		accession = req.StudyAccession
+		query = `SELECT ` + selectCols + ` FROM runs r
+			JOIN experiments e ON e.experiment_accession = r.experiment_accession
+			WHERE e.study_accession = ?`
+	}
+	if req.ExperimentAccession != "" {
+		set++
+		accession = req.ExperimentAccession
+		query = `SELECT ` + selectCols + ` FROM runs r WHERE r.experiment_accession = ?`
+	}
+	if req.SampleAccession != "" {
+		set++
+		accession = req.SampleAccession
+		query = `SELECT ` + selectCols + ` FROM sample_runs sr
+			JOIN runs r ON r.run_accession = sr.run_accession
+			WHERE sr.sample_accession = ?`
+	}
+	if set != 1 {
+		return status.Error(codes.InvalidArgument, "set one of study_accession, experiment_accession and sample_accession")
+	}
+	query += ` ORDER BY r.run_accession`
+	args := []interface{}{accession}
+	if req.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, req.Limit)
+	}
+
+	rows, err := g.db.QueryContext(stream.Context(), query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	_, err = export.CopyRows(rows, grpcRows(func(values []interface{}) error {
+		run := &srakev1.Run{}
+		setRow(run.ProtoReflect(), columns, values)
+		return stream.Send(run)
+	}))
+	return err
+}
+
+// StreamExport streams the records of a type that match a search, reading
+// the index a page at a time, or every record of the type without a query
+func (g *grpcAPI) StreamExport(req *srakev1.ExportRequest, stream grpc.ServerStreamingServer[srakev1.Record]) error {
+	ctx := stream.Context()
+	if _, ok := grpcRecordTypes[req.Type]; !ok {
+		return status.Error(codes.InvalidArgument, "type must be study, experiment, sample or run")
+	}
+	if req.Limit < 0 {
+		return status.Error(codes.InvalidArgument, "negative limit")
+	}
+	limit := int(req.Limit)
+	if req.Query == "" && len(req.Filters) == 0 {
+		return g.dump(ctx, req.Type, export.DumpOptions{Limit: limit}, stream.Send)
+	}
+
+	sent := 0
+	for cursor := search.StartCursor; cursor != ""; {
+		result, err := g.backend.Search(req.Query, search.SearchOptions{
+			Limit:   grpcExportPage,
+			Cursor:  cursor,
+			Filters: searchFilters(req.Filters),
+		})
+		if err != nil {
+			return status.Errorf(codes.Internal, "search failed: %v", err)
+		}
+		var accessions []string
+		for _, hit := range result.Hits {
+			if hit.Type == req.Type {
+				accessions = append(accessions, hit.ID)
+			}
+		}
+		if len(accessions) > 0 {
+			opts := export.DumpOptions{Accessions: accessions}
+			if limit > 0 {
+				opts.Limit = limit - sent
+			}
+			err := g.dump(ctx, req.Type, opts, func(r *srakev1.Record) error {
+				sent++
+				return stream.Send(r)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if limit > 0 && sent >= limit {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cursor = result.NextCursor
+	}
+	return nil
+}
+
+// dump sends the rows of a record type's table selected by opts, each as
+// a Record
+func (g *grpcAPI) dump(ctx context.Context, typ string, opts export.DumpOptions, send func(*srakev1.Record) error) error {
+	t := grpcRecordTypes[typ]
+	opts.Table = t.table
+	opts.Columns = t.columns
+	_, err := export.DumpTable(ctx, g.db.DB, opts, func(columns []export.Column) (export.RowWriter, error) {
+		return grpcRows(func(values []interface{}) error {
+			record := &srakev1.Record{}
+			r := record.ProtoReflect()
+			field := r.Descriptor().Fields().ByName(protoreflect.Name(typ))
+			m := r.NewField(field).Message()
+			setRow(m, columns, values)
+			r.Set(field, protoreflect.ValueOfMessage(m))
+			return send(record)
+		}), nil
+	})
+	return err
+}
+
+// columns returns the typed columns of a record type's message
+func (g *grpcAPI) columns(t grpcRecordType) ([]export.Column, error) {
+	all, err := export.TableColumns(g.db.DB, t.table)
+	if err != nil {
+		return nil, err
+	}
+	return export.SelectColumns(all, t.columns)
+}
+
+// searchFilters converts request filters to search options filters
+func searchFilters(filters map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(filters))
+	for k, v := range filters {
+		out[k] = v
+	}
+	return out
+}
+
+// grpcRows passes each row it is given to its function
+type grpcRows func(values []interface{}) error
+
+func (w grpcRows) WriteRow(values []interface{}) error { return w(values) }
+
+func (w grpcRows) Close() error { return nil }
+
+// setRow sets the fields of m named as columns to the values of a row
+func setRow(m protoreflect.Message, columns []export.Column, values []interface{}) {
+	fields := m.Descriptor().Fields()
+	for i, col := range columns {
+		field := fields.ByName(protoreflect.Name(col.Name))
+		if field == nil {
+			continue
+		}
+		switch field.Kind() {
+		case protoreflect.Int64Kind:
+			if n, ok := export.ValueInt(values[i]); ok {
+				m.Set(field, protoreflect.ValueOfInt64(n))
+			}
+		case protoreflect.StringKind:
+			m.Set(field, protoreflect.ValueOfString(export.ValueText(values[i])))
+		}
+	}
+}
@@ -3,17 +3,19 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
 	"github.com/nishad/srake/internal/search"
+	"google.golang.org/grpc"
 )
 
 // Handler serves the srake REST API, routing requests to the appropriate
@@ -22,10 +24,25 @@ type Handler struct {
 	db            *database.DB
 	searchBackend search.SearchBackend
 	mux           *http.ServeMux
+	metrics       *serverMetrics // nil when /metrics is disabled
+	ready         readiness
+
+	// handler serves routes, and grpc checks the calls of grpcServer,
+	// through the CORS, API key and rate limit middleware of the settings
+	// last loaded; Reload replaces them
+	routes       http.Handler
+	handler      handlerSwitch
+	grpc         handlerSwitch
+	grpcServer   *grpc.Server
+	settings     Settings
+	reloadMu     sync.Mutex
+	loadSettings func() (*Settings, error) // nil when there is no config to reload
 }
 
 // NewHandler creates a new Handler with all API routes registered.
-func NewHandler(db *database.DB, cfg *config.Config) (*Handler, error) {
+// loadSettings, when set, reads the settings again from the config on
+// SIGHUP.
+func NewHandler(db *database.DB, cfg *config.Config, loadSettings func() (*Settings, error)) (*Handler, error) {
 	// Create search backend
 	searchBackend, err := search.CreateSearchBackend(cfg)
 	if err != nil {
@@ -38,35 +55,111 @@ func NewHandler(db *database.DB, cfg *config.Config) (*Handler, error) {
 		mux:           http.NewServeMux(),
 	}
 
-	// Set up API routes
-	h.mux.HandleFunc("/api/v1/search", h.handleSearch)
-	h.mux.HandleFunc("/api/v1/stats", h.handleStats)
-	h.mux.HandleFunc("/api/v1/health", h.handleHealth)
-	h.mux.HandleFunc("/api/v1/studies/", h.handleStudyDetails)
-	h.mux.HandleFunc("/api/v1/samples/", h.handleSampleDetails)
-	h.mux.HandleFunc("/api/v1/runs/", h.handleRunDetails)
-	h.mux.HandleFunc("/api/v1/export", h.handleExport)
-	h.mux.HandleFunc("/api/v1/aggregations/", h.handleAggregations)
+	// Set up API routes under every version of the REST API, with the
+	// same version and deprecation headers as the API server; these
+	// endpoints are the same in each version
+	versions, err := newAPIVersions(cfg.Server.APISunset)
+	if err != nil {
+		searchBackend.Close()
+		return nil, err
+	}
+	current := &versions[len(versions)-1]
+	for i := range versions {
+		v := &versions[i]
+		withVersion := versionMiddleware(v, current)
+		for path, handle := range map[string]http.HandlerFunc{
+			"/search":               h.handleSearch,
+			"/stats":                h.handleStats,
+			"/health":               h.handleHealth,
+			"/studies/{accession}":  h.handleStudyDetails,
+			"/samples/{accession}":  h.handleSampleDetails,
+			"/runs/{accession}":     h.handleRunDetails,
+			"/export":               h.handleExport,
+			"/aggregations/{field}": h.handleAggregations,
+		} {
+			h.mux.Handle(v.prefix()+path, withVersion(handle))
+		}
+	}
+	h.mux.HandleFunc("/readyz", h.ready.handleReady)
+
+	// Prometheus metrics
+	var handler http.Handler = h.mux
+	if cfg.Server.Metrics {
+		h.metrics = newServerMetrics(db, cfg.Search.IndexPath, nil)
+		h.mux.Handle("/metrics", h.metrics.handler())
+		handler = h.metrics.middleware(h.mux)
+	}
 
 	// Serve static files for the web app
 	h.mux.Handle("/", http.FileServer(http.Dir("./web/build")))
 
+	h.routes = handler
+	grpcOpts, err := grpcTLS(cfg.Server.TLS)
+	if err != nil {
+		searchBackend.Close()
+		return nil, err
+	}
+	h.grpcServer = newGRPCServer(db, searchBackend, &h.grpc, grpcOpts...)
+	h.loadSettings = loadSettings
+	if _, err := h.Reload(*NewSettings(cfg, cfg, nil)); err != nil {
+		searchBackend.Close()
+		return nil, err
+	}
+
+	// Warm up while serving; /readyz reports ready once done
+	go warmer{
+		db: db,
+		index: func() error {
+			if w, ok := searchBackend.(search.Warmer); ok {
+				return w.Warm()
+			}
+			return nil
+		},
+		search: func(ctx context.Context, query string) error {
+			_, err := searchBackend.Search(query, search.SearchOptions{Limit: 20})
+			return err
+		},
+	}.run(context.Background(), cfg.Server.Warmup, &h.ready)
+
 	return h, nil
 }
 
-// ServeHTTP dispatches incoming requests, adding CORS headers and handling OPTIONS preflight.
+// ServeHTTP dispatches incoming requests, applying the CORS, API key and
+// rate limit settings of the server config.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Enable CORS for development
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	h.handler.ServeHTTP(w, r)
+}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+// Reload applies the CORS, API key and rate limit settings to the running
+// handler, as Server.Reload does; the log level and search cache TTL are
+// not used by this handler.
+func (h *Handler) Reload(settings Settings) (*ReloadResult, error) {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	server := config.ServerConfig{CORS: settings.CORS, RateLimit: settings.RateLimit, Auth: settings.Auth}
+	handler, err := serverMiddleware(h.routes, server, h.db)
+	if err != nil {
+		return nil, err
 	}
+	grpcHandler, err := serverMiddleware(grpcPassed, server, h.db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newReloadResult(settings)
+	result.Changed = append(result.Changed, middlewareChanges(h.settings, settings)...)
+	h.handler.set(handler)
+	h.grpc.set(grpcHandler)
+	settings.Restart = nil
+	h.settings = settings
+	return result, nil
+}
 
-	h.mux.ServeHTTP(w, r)
+// ReloadConfig reads the settings again with the loadSettings of
+// NewHandler and applies them, as on SIGHUP
+func (h *Handler) ReloadConfig() (*ReloadResult, error) {
+	return reloadConfig(h.loadSettings, h.Reload)
 }
 
 func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
@@ -137,7 +230,9 @@ func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Execute search
+	done := h.metrics.searching()
 	result, err := h.searchBackend.Search(searchQuery, opts)
+	done()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
 		return
@@ -288,8 +383,7 @@ func (h *Handler) handleStudyDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Extract study ID from path
-	path := strings.TrimPrefix(r.URL.Path, "/api/v1/studies/")
-	studyID := strings.TrimSuffix(path, "/")
+	studyID := r.PathValue("accession")
 
 	if studyID == "" {
 		http.Error(w, "Study ID required", http.StatusBadRequest)
@@ -318,8 +412,7 @@ func (h *Handler) handleSampleDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Extract sample ID from path
-	path := strings.TrimPrefix(r.URL.Path, "/api/v1/samples/")
-	sampleID := strings.TrimSuffix(path, "/")
+	sampleID := r.PathValue("accession")
 
 	if sampleID == "" {
 		http.Error(w, "Sample ID required", http.StatusBadRequest)
@@ -348,8 +441,7 @@ func (h *Handler) handleRunDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Extract run ID from path
-	path := strings.TrimPrefix(r.URL.Path, "/api/v1/runs/")
-	runID := strings.TrimSuffix(path, "/")
+	runID := r.PathValue("accession")
 
 	if runID == "" {
 		http.Error(w, "Run ID required", http.StatusBadRequest)
@@ -392,8 +484,7 @@ func (h *Handler) handleAggregations(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Extract field from path
-	path := strings.TrimPrefix(r.URL.Path, "/api/v1/aggregations/")
-	field := strings.TrimSuffix(path, "/")
+	field := r.PathValue("field")
 
 	if field == "" {
 		http.Error(w, "Field required", http.StatusBadRequest)
@@ -415,21 +506,21 @@ func (h *Handler) handleAggregations(w http.ResponseWriter, r *http.Request) {
 				 FROM studies
 				 WHERE organism IS NOT NULL
 				 GROUP BY organism
-				 ORDER BY count DESC
+				 ORDER BY count DESC, value
 				 LIMIT 20`
 	case "library_strategy":
 		query = `SELECT library_strategy as value, COUNT(*) as count
 				 FROM experiments
 				 WHERE library_strategy IS NOT NULL
 				 GROUP BY library_strategy
-				 ORDER BY count DESC
+				 ORDER BY count DESC, value
 				 LIMIT 20`
 	case "platform":
 		query = `SELECT platform as value, COUNT(*) as count
 				 FROM experiments
 				 WHERE platform IS NOT NULL
 				 GROUP BY platform
-				 ORDER BY count DESC
+				 ORDER BY count DESC, value
 				 LIMIT 20`
 	default:
 		http.Error(w, "Invalid aggregation field", http.StatusBadRequest)
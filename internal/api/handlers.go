@@ -1,20 +1,29 @@
 package api
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/facets"
+	"github.com/nishad/srake/internal/jsonpatch"
+	"github.com/nishad/srake/internal/packaging"
 	"github.com/nishad/srake/internal/service"
+	"github.com/nishad/srake/internal/wire"
 )
 
 // Search handlers
 
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
 	// Build search request from query parameters or JSON body
 	var req service.SearchRequest
 
@@ -50,6 +59,7 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 				req.Offset = o
 			}
 		}
+		req.Cursor = q.Get("cursor")
 
 		// Quality control parameters
 		if threshold := q.Get("similarity_threshold"); threshold != "" {
@@ -68,6 +78,20 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		req.ShowConfidence = q.Get("show_confidence") == "true"
+		if weight := q.Get("hybrid_weight"); weight != "" {
+			if w, err := strconv.ParseFloat(weight, 32); err == nil {
+				req.HybridWeight = float32(w)
+			}
+		}
+		req.Fusion = q.Get("fusion")
+		req.Rerank = q.Get("rerank") == "true"
+		if candidates := q.Get("rerank_candidates"); candidates != "" {
+			if c, err := strconv.Atoi(candidates); err == nil {
+				req.RerankCandidates = c
+			}
+		}
+		req.NoExpand = q.Get("expand") == "false"
+		req.BoostPopular = q.Get("boost_popular") == "true"
 
 		// Search mode
 		req.SearchMode = q.Get("mode")
@@ -97,21 +121,33 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 			}
 			req.Filters["platform"] = platform
 		}
+		if attributeRange := q.Get("attribute_range"); attributeRange != "" {
+			if req.Filters == nil {
+				req.Filters = make(map[string]string)
+			}
+			req.Filters[facets.FieldName] = attributeRange
+		}
+		req.Taxon = q.Get("taxon")
+		req.IncludeDescendants = q.Get("include_descendants") == "true"
 	}
 
-	// Perform search
-	response, err := s.searchService.Search(ctx, &req)
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+	s.writeSearch(w, r, &req)
+}
+
+// writeSearchError writes a search failure, as a bad request when the
+// request itself was at fault
+func (s *Server) writeSearchError(w http.ResponseWriter, err error) {
+	var svcErr *service.ServiceError
+	if errors.As(err, &svcErr) && (svcErr.Code == service.ErrCodeInvalidCursor ||
+		svcErr.Code == service.ErrCodeUnknownTaxon || svcErr.Code == service.ErrCodeInvalidQuery ||
+		svcErr.Code == service.ErrCodeInvalidOptions) {
+		s.writeError(w, http.StatusBadRequest, svcErr.Message)
 		return
 	}
-
-	s.writeJSON(w, http.StatusOK, response)
+	s.writeError(w, http.StatusInternalServerError, err.Error())
 }
 
 func (s *Server) handleAdvancedSearch(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
 	var req service.SearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -124,14 +160,33 @@ func (s *Server) handleAdvancedSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Perform search
-	response, err := s.searchService.Search(ctx, &req)
+	s.writeSearch(w, r, &req)
+}
+
+func (s *Server) handleSearchFeedback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req service.FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Source == "" {
+		req.Source = "api"
+	}
+
+	response, err := s.searchService.RecordFeedback(ctx, &req)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, err.Error())
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidFeedback {
+			s.writeError(w, http.StatusBadRequest, svcErr.Message)
+		} else {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, response)
+	s.writeJSON(w, http.StatusCreated, response)
 }
 
 // Metadata handlers
@@ -151,6 +206,7 @@ func (s *Server) handleGetStudy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.popularity.fetched("study", accession)
 	s.writeJSON(w, http.StatusOK, study)
 }
 
@@ -205,10 +261,44 @@ func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.popularity.fetched("run", accession)
 	s.writeJSON(w, http.StatusOK, run)
 }
 
 func (s *Server) handleListStudies(w http.ResponseWriter, r *http.Request) {
+	studies, limit, offset, ok := s.listStudies(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, studyListResponse{
+		Studies: studies,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
+
+// handleListStudiesPage lists studies in the v2 shape, with a pagination
+// object giving the offset of the next page
+func (s *Server) handleListStudiesPage(w http.ResponseWriter, r *http.Request) {
+	studies, limit, offset, ok := s.listStudies(w, r)
+	if !ok {
+		return
+	}
+
+	page := pagination{Limit: limit, Offset: offset}
+	if len(studies) == limit {
+		page.NextOffset = offset + limit
+	}
+	if studies == nil {
+		studies = []*database.Study{}
+	}
+	s.writeJSON(w, http.StatusOK, studyPageResponse{Studies: studies, Pagination: page})
+}
+
+// listStudies reads the page of studies a list request asks for, writing
+// an error response and returning false when it fails
+func (s *Server) listStudies(w http.ResponseWriter, r *http.Request) ([]*database.Study, int, int, bool) {
 	ctx := r.Context()
 	q := r.URL.Query()
 
@@ -233,16 +323,9 @@ func (s *Server) handleListStudies(w http.ResponseWriter, r *http.Request) {
 	studies, err := s.metadataService.GetStudies(ctx, limit, offset)
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, err.Error())
-		return
+		return nil, 0, 0, false
 	}
-
-	response := map[string]interface{}{
-		"studies": studies,
-		"limit":   limit,
-		"offset":  offset,
-	}
-
-	s.writeJSON(w, http.StatusOK, response)
+	return studies, limit, offset, true
 }
 
 func (s *Server) handleGetStudyMetadata(w http.ResponseWriter, r *http.Request) {
@@ -268,16 +351,16 @@ func (s *Server) handleGetStudyExperiments(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	accession := vars["accession"]
 
-	experiments, err := s.metadataService.GetExperimentsByStudy(ctx, accession)
+	experiments, err := s.metadataService.GetExperimentsByStudy(ctx, accession, 0)
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"study_accession": accession,
-		"experiments":     experiments,
-		"total":           len(experiments),
+	s.writeJSON(w, http.StatusOK, studyExperimentsResponse{
+		StudyAccession: accession,
+		Experiments:    experiments,
+		Total:          len(experiments),
 	})
 }
 
@@ -286,16 +369,16 @@ func (s *Server) handleGetStudySamples(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accession := vars["accession"]
 
-	samples, err := s.metadataService.GetSamplesByStudy(ctx, accession)
+	samples, err := s.metadataService.GetSamplesByStudy(ctx, accession, 0)
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"study_accession": accession,
-		"samples":         samples,
-		"total":           len(samples),
+	s.writeJSON(w, http.StatusOK, studySamplesResponse{
+		StudyAccession: accession,
+		Samples:        samples,
+		Total:          len(samples),
 	})
 }
 
@@ -318,14 +401,338 @@ func (s *Server) handleGetStudyRuns(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"study_accession": accession,
-		"runs":            runs,
-		"total":           len(runs),
-		"limit":           limit,
+	s.writeJSON(w, http.StatusOK, studyRunsResponse{
+		StudyAccession: accession,
+		Runs:           runs,
+		Total:          len(runs),
+		Limit:          limit,
 	})
 }
 
+// handleGetStudyJSONLD returns Bioschemas Dataset markup for a study page
+func (s *Server) handleGetStudyJSONLD(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	accession := vars["accession"]
+
+	bundle, err := s.metadataService.GetStudyBundle(ctx, accession)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			s.writeError(w, http.StatusNotFound, "Study not found")
+		} else {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	doc, err := packaging.BuildBioschemas(bundle, s.catalog)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/ld+json")
+	s.writeJSON(w, http.StatusOK, doc)
+}
+
+// Curation handlers
+
+// maxPatchBodySize bounds the size of JSON Patch request bodies
+const maxPatchBodySize = 1 << 20
+
+func (s *Server) handlePatchRecord(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	accession := vars["accession"]
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPatchBodySize))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	patch, err := jsonpatch.Decode(body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	curation, err := s.metadataService.PatchRecord(ctx, accession, patch)
+	if err != nil {
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidPatch {
+			s.writeError(w, http.StatusUnprocessableEntity, svcErr.Message)
+		} else if strings.Contains(err.Error(), "not found") {
+			s.writeError(w, http.StatusNotFound, "Record not found")
+		} else {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, curation)
+}
+
+// handleLookup finds records by alias, submitter ID or internal ID, or runs
+// by the MD5 checksum or name of a data file
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	req := service.LookupRequest{
+		Alias:       q.Get("alias"),
+		SubmitterID: q.Get("submitter_id"),
+		InternalID:  q.Get("internal_id"),
+		MD5:         q.Get("md5"),
+		Filename:    q.Get("filename"),
+		Query:       q.Get("q"),
+	}
+	if limit := q.Get("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			req.Limit = l
+		}
+	}
+
+	response, err := s.metadataService.Lookup(ctx, &req)
+	if err != nil {
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidLookup {
+			s.writeError(w, http.StatusBadRequest, svcErr.Message)
+		} else {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// handleLookupAccessions fetches the records of a list of accessions, such
+// as one read from a file, with batched queries instead of a request per
+// accession
+// maxLookupRequestSize bounds the body of a POST lookup: room for the most
+// accessions a lookup resolves, at 64 bytes each
+const maxLookupRequestSize = database.MaxAccessionLookup * 64
+
+func (s *Server) handleLookupAccessions(w http.ResponseWriter, r *http.Request) {
+	var req service.AccessionLookupRequest
+	body := http.MaxBytesReader(w, r.Body, maxLookupRequestSize)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, http.StatusRequestEntityTooLarge,
+				"request body too large (at most "+strconv.Itoa(database.MaxAccessionLookup)+" accessions per lookup)")
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	response, err := s.metadataService.LookupAccessions(r.Context(), &req)
+	if err != nil {
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidLookup {
+			s.writeError(w, http.StatusBadRequest, svcErr.Message)
+		} else {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleResolveBioSample(w http.ResponseWriter, r *http.Request) {
+	s.resolveExternal(w, r, "BioSample", database.XrefBioSample)
+}
+
+func (s *Server) handleResolveBioProject(w http.ResponseWriter, r *http.Request) {
+	s.resolveExternal(w, r, "BioProject", database.XrefBioProject)
+}
+
+func (s *Server) handleResolveGEO(w http.ResponseWriter, r *http.Request) {
+	s.resolveExternal(w, r, "GEO", database.XrefGEOSeries, database.XrefGEOSample)
+}
+
+// resolveExternal writes the SRA records linked to the accession of a
+// route, which must be of one of the route's kinds
+func (s *Server) resolveExternal(w http.ResponseWriter, r *http.Request, name string, kinds ...string) {
+	accession := mux.Vars(r)["accession"]
+	if !slices.Contains(kinds, database.ExternalAccessionType(accession)) {
+		s.writeError(w, http.StatusBadRequest, "not a "+name+" accession: "+accession)
+		return
+	}
+
+	links, err := s.metadataService.Resolve(r.Context(), accession)
+	if err != nil {
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidAccession {
+			s.writeError(w, http.StatusBadRequest, svcErr.Message)
+		} else if strings.Contains(err.Error(), "not found") {
+			s.writeError(w, http.StatusNotFound, "No records linked to "+name+" "+accession)
+		} else {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, links)
+}
+
+// handleQueryAttributes finds samples whose attributes satisfy every
+// where condition
+func (s *Server) handleQueryAttributes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	req := service.AttributeQueryRequest{Conditions: q["where"]}
+	if limit := q.Get("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			req.Limit = l
+		}
+	}
+	if offset := q.Get("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil {
+			req.Offset = o
+		}
+	}
+
+	response, err := s.metadataService.QueryAttributes(ctx, &req)
+	if err != nil {
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidAttributeQuery {
+			s.writeError(w, http.StatusBadRequest, svcErr.Message)
+		} else {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// handleListAttributeTags lists the most common sample attribute tags
+func (s *Server) handleListAttributeTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	limit := 0
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil {
+		limit = l
+	}
+	tags, err := s.metadataService.ListAttributeTags(ctx, q.Get("prefix"), limit)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, attributeTagsResponse{Tags: tags, Total: len(tags)})
+}
+
+// Collection handlers
+
+func (s *Server) handleListCollections(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	collections, err := s.metadataService.ListCollections(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, collectionListResponse{
+		Collections: collections,
+		Total:       len(collections),
+	})
+}
+
+func (s *Server) handleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req service.CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	update, err := s.metadataService.CreateCollection(ctx, &req)
+	if err != nil {
+		s.writeCollectionError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, update)
+}
+
+func (s *Server) handleGetCollection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	collection, err := s.metadataService.GetCollection(ctx, vars["name"])
+	if err != nil {
+		s.writeCollectionError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, collection)
+}
+
+func (s *Server) handleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	if err := s.metadataService.DeleteCollection(ctx, vars["name"]); err != nil {
+		s.writeCollectionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAddCollectionMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	var req service.CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	update, err := s.metadataService.AddToCollection(ctx, vars["name"], req.Accessions)
+	if err != nil {
+		s.writeCollectionError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, update)
+}
+
+func (s *Server) handleRemoveCollectionMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	update, err := s.metadataService.RemoveFromCollection(ctx, vars["name"], []string{vars["accession"]})
+	if err != nil {
+		s.writeCollectionError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, update)
+}
+
+// writeCollectionError maps collection service errors to HTTP status codes
+func (s *Server) writeCollectionError(w http.ResponseWriter, err error) {
+	var svcErr *service.ServiceError
+	if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidCollection {
+		s.writeError(w, http.StatusBadRequest, svcErr.Message)
+	} else if strings.Contains(err.Error(), "not found") {
+		s.writeError(w, http.StatusNotFound, "Collection not found")
+	} else {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 // Statistics handlers
 
 func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
@@ -349,9 +756,9 @@ func (s *Server) handleGetOrganismStats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"organisms": stats.TopOrganisms,
-		"total":     len(stats.TopOrganisms),
+	s.writeJSON(w, http.StatusOK, organismStatsResponse{
+		Organisms: stats.TopOrganisms,
+		Total:     len(stats.TopOrganisms),
 	})
 }
 
@@ -364,9 +771,9 @@ func (s *Server) handleGetPlatformStats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"platforms": stats.TopPlatforms,
-		"total":     len(stats.TopPlatforms),
+	s.writeJSON(w, http.StatusOK, platformStatsResponse{
+		Platforms: stats.TopPlatforms,
+		Total:     len(stats.TopPlatforms),
 	})
 }
 
@@ -379,9 +786,24 @@ func (s *Server) handleGetStrategyStats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"strategies": stats.TopStrategies,
-		"total":      len(stats.TopStrategies),
+	s.writeJSON(w, http.StatusOK, strategyStatsResponse{
+		Strategies: stats.TopStrategies,
+		Total:      len(stats.TopStrategies),
+	})
+}
+
+func (s *Server) handleGetDistinctStats(w http.ResponseWriter, r *http.Request) {
+	exact := r.URL.Query().Get("exact") == "true"
+
+	counts, err := s.metadataService.DistinctCounts(r.Context(), exact)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, distinctStatsResponse{
+		Dimensions: counts,
+		Exact:      exact,
 	})
 }
 
@@ -396,25 +818,43 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Clients pulling many records ask for the compact wire format with
+	// Accept, and for JSON lines from servers without it
+	format := strings.ToLower(req.Format)
+	if wire.Accepts(r.Header.Get("Accept")) && (format == "" || format == "jsonl") {
+		format = "msgpack"
+	}
+	req.Format = format
+
 	// Validate format
 	validFormats := map[string]bool{
-		"json": true, "csv": true, "tsv": true, "xml": true, "jsonl": true,
+		"json": true, "csv": true, "tsv": true, "xml": true, "jsonl": true, "msgpack": true,
 	}
-	if !validFormats[strings.ToLower(req.Format)] {
-		s.writeError(w, http.StatusBadRequest, "Invalid format. Supported: json, csv, tsv, xml, jsonl")
+	if !validFormats[format] {
+		s.writeError(w, http.StatusBadRequest, "Invalid format. Supported: json, csv, tsv, xml, jsonl, msgpack")
 		return
 	}
 
 	// Set appropriate content type
 	contentTypes := map[string]string{
-		"json":  "application/json",
-		"jsonl": "application/x-ndjson",
-		"csv":   "text/csv",
-		"tsv":   "text/tab-separated-values",
-		"xml":   "application/xml",
+		"json":    "application/json",
+		"jsonl":   "application/x-ndjson",
+		"csv":     "text/csv",
+		"tsv":     "text/tab-separated-values",
+		"xml":     "application/xml",
+		"msgpack": wire.ContentType,
+	}
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", "attachment; filename=export."+format)
+	w.Header().Add("Vary", "Accept, Accept-Encoding")
+
+	// Exports are compressed for clients that accept it, errors included
+	if wire.AcceptsGzip(r.Header.Get("Accept-Encoding")) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := &gzipResponseWriter{ResponseWriter: w, gz: gzip.NewWriter(w)}
+		defer gz.gz.Close()
+		w = gz
 	}
-	w.Header().Set("Content-Type", contentTypes[strings.ToLower(req.Format)])
-	w.Header().Set("Content-Disposition", "attachment; filename=export."+strings.ToLower(req.Format))
 
 	// Perform export
 	if err := s.exportService.Export(ctx, &req, w); err != nil {
@@ -422,3 +862,205 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// gzipResponseWriter compresses a response as it is written
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	return w.gz.Write(p)
+}
+
+// Job handlers
+
+// jobContentTypes maps job result file extensions to content types.
+var jobContentTypes = map[string]string{
+	".json":  "application/json",
+	".jsonl": "application/x-ndjson",
+	".csv":   "text/csv",
+	".tsv":   "text/tab-separated-values",
+	".xml":   "application/xml",
+}
+
+func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req service.JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	// Searches and exports only read, and stay open to read-only clients;
+	// replicas cannot queue any job, as the queue is in the database
+	kind := strings.ToLower(strings.TrimSpace(req.Type))
+	writes := kind == service.JobKindIngest || kind == service.JobKindIndex
+	if (s.db.ReadOnly() || writes) && s.refuseWrite(w, r) {
+		return
+	}
+	// Ingests and index rebuilds run for long and replace data, so they
+	// are not left to anonymous clients
+	if writes && requestAPIKey(ctx) == nil {
+		s.writeError(w, http.StatusForbidden, "Ingest and index jobs need an API key; enable server.auth")
+		return
+	}
+	if kind == service.JobKindIngest {
+		file, err := s.ingestFile(req.File)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.File = file
+	}
+
+	job, err := s.jobService.Submit(ctx, &req)
+	if err != nil {
+		s.writeJobError(w, err)
+		return
+	}
+
+	// The job under the jobs endpoint of the API version submitted to
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+job.ID)
+	s.writeJSON(w, http.StatusAccepted, job)
+}
+
+// ingestMirrors are the URLs under which ingest jobs may fetch archives
+var ingestMirrors = []string{
+	downloader.NCBIMetadataBaseURL,
+	downloader.ENAMetadataBaseURL,
+	downloader.DDBJMetadataBaseURL,
+}
+
+// ingestFile checks the file of an ingest job, which is read by the
+// server: a URL must be on one of the archive mirrors, and a path must be
+// inside the ingest directory, relative paths being taken from there. It
+// returns the path with symbolic links resolved.
+func (s *Server) ingestFile(file string) (string, error) {
+	if file == "" {
+		return "", nil // Submit reports the missing file
+	}
+	if strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://") {
+		for _, mirror := range ingestMirrors {
+			if strings.HasPrefix(file, mirror) && !strings.Contains(file, "..") {
+				return file, nil
+			}
+		}
+		return "", errors.New("Ingest URLs must be on the NCBI, ENA or DDBJ metadata mirrors")
+	}
+	if s.ingestDir == "" {
+		return "", errors.New("Ingesting files on the server is disabled; set server.ingest_dir")
+	}
+	dir, err := filepath.EvalSymlinks(s.ingestDir)
+	if err != nil {
+		return "", errors.New("Ingest directory is not available")
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	// Checked before and after resolving links, so that files outside are
+	// not probed for
+	if !withinDir(dir, file) {
+		return "", errors.New("File is outside the ingest directory")
+	}
+	resolved, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", errors.New("File not found in the ingest directory")
+	}
+	if !withinDir(dir, resolved) {
+		return "", errors.New("File is outside the ingest directory")
+	}
+	return resolved, nil
+}
+
+// withinDir reports whether path is inside dir
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	jobs, err := s.jobService.List(ctx, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, jobListResponse{
+		Jobs:  jobs,
+		Total: len(jobs),
+	})
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	job, err := s.jobService.Get(ctx, vars["id"])
+	if err != nil {
+		s.writeJobError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) handleGetJobResult(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	job, err := s.jobService.ResultPath(ctx, vars["id"])
+	if err != nil {
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidJob {
+			s.writeError(w, http.StatusConflict, svcErr.Message)
+			return
+		}
+		s.writeJobError(w, err)
+		return
+	}
+
+	ext := filepath.Ext(job.ResultPath)
+	if contentType, ok := jobContentTypes[ext]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+job.ID+ext)
+	http.ServeFile(w, r, job.ResultPath)
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	job, err := s.jobService.Cancel(ctx, vars["id"])
+	if err != nil {
+		if strings.Contains(err.Error(), "already") {
+			s.writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		s.writeJobError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) writeJobError(w http.ResponseWriter, err error) {
+	var svcErr *service.ServiceError
+	if errors.As(err, &svcErr) && svcErr.Code == service.ErrCodeInvalidJob {
+		s.writeError(w, http.StatusBadRequest, svcErr.Message)
+	} else if strings.Contains(err.Error(), "not found") {
+		s.writeError(w, http.StatusNotFound, "Job not found")
+	} else {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
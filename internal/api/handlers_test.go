@@ -1,17 +1,36 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nishad/srake/internal/compat"
+	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
 	"github.com/nishad/srake/internal/service"
+	srakev1 "github.com/nishad/srake/proto/srake/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 // testServer is a simplified server for testing handlers
@@ -39,11 +58,20 @@ func setupTestServer(t *testing.T) (*testServer, func()) {
 	// Create services
 	metadataService := service.NewMetadataService(db)
 
+	schema, err := newGraphQLSchema(metadataService)
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dir)
+		t.Fatalf("failed to build GraphQL schema: %v", err)
+	}
+
 	// Create minimal server
 	s := &Server{
 		router:          mux.NewRouter(),
 		metadataService: metadataService,
+		jobService:      service.NewJobService(db, nil, nil, filepath.Join(dir, "jobs")),
 		db:              db,
+		graphql:         schema,
 	}
 
 	// Setup routes manually - only metadata endpoints that don't require search service
@@ -52,9 +80,29 @@ func setupTestServer(t *testing.T) (*testServer, func()) {
 	api.HandleFunc("/experiment/{accession}", s.handleGetExperiment).Methods("GET")
 	api.HandleFunc("/sample/{accession}", s.handleGetSample).Methods("GET")
 	api.HandleFunc("/run/{accession}", s.handleGetRun).Methods("GET")
+	api.HandleFunc("/study/{accession}/jsonld", s.handleGetStudyJSONLD).Methods("GET")
+	api.HandleFunc("/records/{accession}", s.handlePatchRecord).Methods("PATCH")
+	api.HandleFunc("/lookup", s.handleLookup).Methods("GET")
+	api.HandleFunc("/lookup", s.handleLookupAccessions).Methods("POST")
+	api.HandleFunc("/attributes/query", s.handleQueryAttributes).Methods("GET")
+	api.HandleFunc("/attributes/tags", s.handleListAttributeTags).Methods("GET")
+	api.HandleFunc("/stats/distinct", s.handleGetDistinctStats).Methods("GET")
+	api.HandleFunc("/collections", s.handleListCollections).Methods("GET")
+	api.HandleFunc("/collections", s.handleCreateCollection).Methods("POST")
+	api.HandleFunc("/collections/{name}", s.handleGetCollection).Methods("GET")
+	api.HandleFunc("/collections/{name}", s.handleDeleteCollection).Methods("DELETE")
+	api.HandleFunc("/collections/{name}/members", s.handleAddCollectionMembers).Methods("POST")
+	api.HandleFunc("/collections/{name}/members/{accession}", s.handleRemoveCollectionMember).Methods("DELETE")
+	api.HandleFunc("/jobs", s.handleListJobs).Methods("GET")
+	api.HandleFunc("/jobs", s.handleSubmitJob).Methods("POST")
+	api.HandleFunc("/jobs/{id}", s.handleGetJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}", s.handleCancelJob).Methods("DELETE")
+	api.HandleFunc("/jobs/{id}/result", s.handleGetJobResult).Methods("GET")
+	api.HandleFunc("/jobs/{id}/events", s.handleJobEvents).Methods("GET")
+	s.router.HandleFunc("/graphql", s.handleGraphQL).Methods("GET", "POST")
 
 	// Add middleware
-	s.router.Use(corsMiddleware)
+	s.router.Use(corsMiddleware(config.DefaultConfig().Server.CORS))
 	s.router.Use(jsonMiddleware)
 
 	cleanup := func() {
@@ -114,6 +162,42 @@ func TestStudyEndpointNotFound(t *testing.T) {
 	}
 }
 
+func TestStudyJSONLDEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	server.catalog.BaseURL = "https://sra.example.org"
+
+	if err := server.db.InsertStudy(&database.Study{StudyAccession: "SRP000001", StudyTitle: "Test Study"}); err != nil {
+		t.Fatalf("failed to insert test study: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/study/SRP000001/jsonld", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/ld+json" {
+		t.Errorf("expected application/ld+json, got %s", ct)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if doc["@type"] != "Dataset" || doc["url"] != "https://sra.example.org/browse/study/SRP000001" {
+		t.Errorf("unexpected JSON-LD: %v", doc)
+	}
+
+	req = httptest.NewRequest("GET", "/api/study/SRP999999/jsonld", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
+
 func TestExperimentEndpoint(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -240,6 +324,303 @@ func TestRunEndpointNotFound(t *testing.T) {
 	}
 }
 
+func TestPatchRecord(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	if err := server.db.InsertStudy(&database.Study{StudyAccession: "SRP000001", StudyTitle: "Upstream"}); err != nil {
+		t.Fatalf("failed to insert test study: %v", err)
+	}
+
+	patch := `[{"op":"replace","path":"/curated_title","value":"Curated"},{"op":"add","path":"/tags/-","value":"cohort"}]`
+	req := httptest.NewRequest("PATCH", "/api/records/SRP000001", strings.NewReader(patch))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Curation is merged into subsequent reads
+	req = httptest.NewRequest("GET", "/api/study/SRP000001", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var resp struct {
+		StudyTitle string             `json:"study_title"`
+		Curation   *database.Curation `json:"curation"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.StudyTitle != "Upstream" {
+		t.Errorf("expected upstream title to be preserved, got %q", resp.StudyTitle)
+	}
+	if resp.Curation == nil || resp.Curation.CuratedTitle != "Curated" || len(resp.Curation.Tags) != 1 {
+		t.Errorf("unexpected curation: %+v", resp.Curation)
+	}
+}
+
+func TestPatchRecordErrors(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	if err := server.db.InsertStudy(&database.Study{StudyAccession: "SRP000001"}); err != nil {
+		t.Fatalf("failed to insert test study: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		accession string
+		body      string
+		status    int
+	}{
+		{"malformed patch", "SRP000001", `{"op":"add"}`, http.StatusBadRequest},
+		{"non-editable field", "SRP000001", `[{"op":"add","path":"/study_title","value":"x"}]`, http.StatusUnprocessableEntity},
+		{"wrong type", "SRP000001", `[{"op":"replace","path":"/tags","value":"x"}]`, http.StatusUnprocessableEntity},
+		{"unknown record", "SRP999999", `[{"op":"replace","path":"/notes","value":"x"}]`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/api/records/"+tt.accession, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestCollectionEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	if err := server.db.InsertRun(&database.Run{RunAccession: "SRR000001"}); err != nil {
+		t.Fatalf("failed to insert test run: %v", err)
+	}
+
+	body := `{"name":"my-cohort","description":"Liver","accessions":["SRR000001","SRR999999"]}`
+	req := httptest.NewRequest("POST", "/api/collections", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var update service.CollectionUpdate
+	if err := json.Unmarshal(w.Body.Bytes(), &update); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if update.Added != 1 || len(update.Missing) != 1 || update.Missing[0] != "SRR999999" {
+		t.Errorf("unexpected update: %+v", update)
+	}
+
+	req = httptest.NewRequest("GET", "/api/collections/my-cohort", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var collection service.CollectionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &collection); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(collection.Members) != 1 || collection.Members[0].RecordType != "run" {
+		t.Errorf("unexpected members: %+v", collection.Members)
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/collections/my-cohort/members/SRR000001", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/collections/my-cohort", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/collections/my-cohort", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/collections", strings.NewReader(`{"name":"bad name"}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestLookupEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	err := server.db.InsertIdentifiers([]database.Identifier{
+		{RecordType: "sample", RecordAccession: "SRS000001", IDType: database.IDTypeAlias, IDValue: "GSM123_rep2"},
+		{RecordType: "sample", RecordAccession: "SRS000002", IDType: database.IDTypeSubmitter, IDValue: "GSM123_rep2_b"},
+	})
+	if err != nil {
+		t.Fatalf("failed to insert identifiers: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/lookup?q=gsm123_rep2", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response service.LookupResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Total != 2 || response.Candidates[0].Accession != "SRS000001" ||
+		response.Candidates[0].Match != database.MatchCaseInsensitive {
+		t.Errorf("unexpected candidates: %+v", response.Candidates)
+	}
+
+	req = httptest.NewRequest("GET", "/api/lookup?alias=GSM123_rep2&submitter_id=x", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestLookupAccessionsEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	if err := server.db.InsertStudy(&database.Study{StudyAccession: "SRP000001", StudyTitle: "Liver"}); err != nil {
+		t.Fatalf("failed to insert study: %v", err)
+	}
+	if err := server.db.InsertRun(&database.Run{RunAccession: "SRR000001", TotalSpots: 100}); err != nil {
+		t.Fatalf("failed to insert run: %v", err)
+	}
+
+	body := `{"accessions": ["SRR000001", "srp000001", "SRR999999", "GSM1"]}`
+	req := httptest.NewRequest("POST", "/api/lookup", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response database.AccessionLookup
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(response.Studies) != 1 || len(response.Runs) != 1 || response.Runs[0].TotalSpots != 100 {
+		t.Errorf("unexpected records: %+v", response)
+	}
+	if len(response.NotFound) != 2 || response.NotFound[0] != "SRR999999" {
+		t.Errorf("unexpected not found: %v", response.NotFound)
+	}
+
+	req = httptest.NewRequest("POST", "/api/lookup", strings.NewReader(`{"accessions": []}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without accessions, got %d", w.Code)
+	}
+
+	// A body larger than the most accessions a lookup takes is not read
+	// in full
+	oversized := `{"accessions": ["` + strings.Repeat("SRR000001", maxLookupRequestSize/9+1) + `"]}`
+	req = httptest.NewRequest("POST", "/api/lookup", strings.NewReader(oversized))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 for an oversized body, got %d", w.Code)
+	}
+}
+
+func TestAttributeQueryEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for _, sample := range []database.Sample{
+		{SampleAccession: "SRS000001", SampleAttributes: `[{"tag":"tissue","value":"liver"},{"tag":"age","value":"52 years"}]`},
+		{SampleAccession: "SRS000002", SampleAttributes: `[{"tag":"tissue","value":"liver"},{"tag":"age","value":"35"}]`},
+	} {
+		if err := server.db.InsertSample(&sample); err != nil {
+			t.Fatalf("failed to insert sample: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/attributes/query?where=tissue%3Dliver&where=age%3E40", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response service.AttributeQueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Total != 1 || response.Samples[0].SampleAccession != "SRS000001" {
+		t.Errorf("unexpected samples: %+v", response.Samples)
+	}
+
+	req = httptest.NewRequest("GET", "/api/attributes/query?where=age%3Eforty", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestDistinctStatsEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for _, exp := range []database.Experiment{
+		{ExperimentAccession: "SRX000001", Platform: "ILLUMINA"},
+		{ExperimentAccession: "SRX000002", Platform: "ILLUMINA"},
+	} {
+		if err := server.db.InsertExperiment(&exp); err != nil {
+			t.Fatalf("failed to insert experiment: %v", err)
+		}
+	}
+	if err := server.db.FlushSketches(); err != nil {
+		t.Fatalf("failed to flush sketches: %v", err)
+	}
+
+	for _, exact := range []bool{false, true} {
+		req := httptest.NewRequest("GET", "/api/stats/distinct?exact="+strconv.FormatBool(exact), nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var response distinctStatsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		for _, c := range response.Dimensions {
+			switch c.Dimension {
+			case database.SketchExperiments, database.SketchPlatforms:
+				want := map[string]int64{database.SketchExperiments: 2, database.SketchPlatforms: 1}[c.Dimension]
+				if c.Count != want || c.Approximate == exact {
+					t.Errorf("exact=%v: unexpected %s count %+v", exact, c.Dimension, c)
+				}
+			}
+		}
+	}
+}
+
 func TestCORSHeaders(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -357,3 +738,1304 @@ func BenchmarkStudyEndpoint(b *testing.B) {
 		s.router.ServeHTTP(w, req)
 	}
 }
+
+func TestJobEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body := `{"type":"export","query":"liver","format":"csv","limit":100}`
+	req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var job database.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if job.ID == "" || job.Status != database.JobQueued || job.Kind != "export" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	req = httptest.NewRequest("GET", "/api/jobs/"+job.ID, nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/jobs/"+job.ID+"/result", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for pending result, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/jobs/"+job.ID, nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/jobs/"+job.ID, nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 cancelling twice, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/jobs/unknown", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/jobs", strings.NewReader(`{"type":"reindex","query":"liver"}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown job type, got %d", w.Code)
+	}
+}
+
+func TestGraphQLEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	if err := server.db.InsertStudy(&database.Study{StudyAccession: "SRP000001", StudyTitle: "Liver atlas"}); err != nil {
+		t.Fatalf("failed to insert study: %v", err)
+	}
+	if err := server.db.InsertExperiment(&database.Experiment{
+		ExperimentAccession: "SRX000001", StudyAccession: "SRP000001", LibraryStrategy: "RNA-Seq",
+	}); err != nil {
+		t.Fatalf("failed to insert experiment: %v", err)
+	}
+	if err := server.db.InsertSample(&database.Sample{SampleAccession: "SRS000001", Organism: "Homo sapiens"}); err != nil {
+		t.Fatalf("failed to insert sample: %v", err)
+	}
+	if _, err := server.db.Exec(`INSERT INTO experiment_samples (experiment_accession, sample_accession) VALUES (?, ?)`,
+		"SRX000001", "SRS000001"); err != nil {
+		t.Fatalf("failed to link sample: %v", err)
+	}
+	if err := server.db.InsertRun(&database.Run{
+		RunAccession: "SRR000001", ExperimentAccession: "SRX000001", TotalBases: 5000000000,
+	}); err != nil {
+		t.Fatalf("failed to insert run: %v", err)
+	}
+
+	body := `{"query":"query ($acc: ID!) { study(accession: $acc) { study_title experiments { library_strategy samples { organism } runs { run_accession total_bases } } } missing: run(accession: \"SRR999999\") { run_accession } }","variables":{"acc":"SRP000001"}}`
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	want := `{"data":{"study":{"study_title":"Liver atlas","experiments":[{"library_strategy":"RNA-Seq",` +
+		`"samples":[{"organism":"Homo sapiens"}],"runs":[{"run_accession":"SRR000001","total_bases":5000000000}]}]},"missing":null}}`
+	if got := canonicalJSON(t, w.Body.String()); got != canonicalJSON(t, want) {
+		t.Errorf("unexpected response:\n got: %s\nwant: %s", got, want)
+	}
+
+	// Runs link back to their experiment and study
+	req = httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(`{ run(accession: "SRR000001") { experiment { study { study_accession } } } }`), nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if want := `{"data":{"run":{"experiment":{"study":{"study_accession":"SRP000001"}}}}}`; canonicalJSON(t, w.Body.String()) != want {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/graphql", strings.NewReader(`{ sample(accession: "SRS000001") { experiments(limit: 1) { experiment_accession runs { run_accession } } } }`))
+	req.Header.Set("Content-Type", "application/graphql")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if want := `{"data":{"sample":{"experiments":[{"experiment_accession":"SRX000001","runs":[{"run_accession":"SRR000001"}]}]}}}`; canonicalJSON(t, w.Body.String()) != want {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+
+	// Lists without records are empty, not null
+	req = httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"{ study(accession: \"SRP000001\") { samples { experiments { runs(limit: 5) { run_accession } } } runs { run_accession } } }"}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"data"`) || strings.Contains(w.Body.String(), `"errors"`) {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"{ study(accession: \"SRP000001\") { owner } }"}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `Cannot query field \"owner\" on type \"Study\"`) {
+		t.Errorf("expected a validation error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"variables":{}}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a query, got %d", w.Code)
+	}
+}
+
+// TestGraphQLLimits tests that every list takes a capped limit and that
+// queries that may return too many records are refused before they run
+func TestGraphQLLimits(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for name, tt := range map[string]struct {
+		query string
+		err   string
+	}{
+		"zero limit":      {`{ study(accession: "SRP000001") { runs(limit: 0) { run_accession } } }`, "limit must be between 1 and 1000"},
+		"limit too high":  {`{ run(accession: "SRR000001") { experiment { samples(limit: 5000) { organism } } } }`, "limit must be between 1 and 1000"},
+		"page too large":  {`{ studies(limit: 500) { study_accession } }`, "limit must be between 1 and 100"},
+		"variable limit":  {`query ($n: Int = 0) { experiment(accession: "SRX000001") { runs(limit: $n) { run_accession } } }`, "limit must be between 1 and 1000"},
+		"fan out":         {`{ studies(limit: 100) { runs(limit: 1000) { experiment { samples { organism } } } } }`, "query may return over 10000 records"},
+		"default fan out": {`{ studies(limit: 100) { experiments { study_accession } } }`, ""},
+		"fragment fan out": {`{ studies(limit: 100) { ...s } } fragment s on Study { samples(limit: 50) { runs(limit: 10) { run_accession } } }`,
+			"query may return over 10000 records"},
+		"too deep": {`{ run(accession: "SRR000001") { experiment { study { experiments(limit: 1) { study { experiments(limit: 1) { study { experiments(limit: 1) { study { experiments(limit: 1) { study { experiments(limit: 1) { study { experiments(limit: 1) { study { study_accession } } } } } } } } } } } } } } } }`,
+			"maximum depth of 15"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/graphql", strings.NewReader(tt.query))
+			req.Header.Set("Content-Type", "application/graphql")
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			if tt.err == "" {
+				if strings.Contains(w.Body.String(), `"errors"`) {
+					t.Errorf("expected the query to run, got %s", w.Body.String())
+				}
+				return
+			}
+			if !strings.Contains(w.Body.String(), tt.err) || strings.Contains(w.Body.String(), `"data"`) {
+				t.Errorf("expected %q before execution, got %s", tt.err, w.Body.String())
+			}
+		})
+	}
+}
+
+// canonicalJSON re-encodes a JSON document with its object keys sorted
+func canonicalJSON(t *testing.T, doc string) string {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatalf("invalid JSON %s: %v", doc, err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestJobEvents(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	jobEventInterval = 10 * time.Millisecond
+	defer func() { jobEventInterval = time.Second }()
+
+	job, err := server.jobService.Submit(context.Background(), &service.JobRequest{Type: "index"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.jobService.Cancel(context.Background(), job.ID)
+	}()
+
+	// The stream reports the queued job, then ends once it is cancelled
+	req := httptest.NewRequest("GET", "/api/jobs/"+job.ID+"/events", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %q", events)
+	}
+	for i, want := range []string{database.JobQueued, database.JobCancelled} {
+		if !strings.HasPrefix(events[i], "event: status\ndata: ") || !strings.Contains(events[i], `"status":"`+want+`"`) {
+			t.Errorf("event %d: expected status %s, got %q", i, want, events[i])
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/api/jobs/unknown/events", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	server.router.HandleFunc("/openapi.json", server.handleOpenAPI).Methods("GET")
+
+	type document struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	fetch := func(target string) (*document, string, int) {
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		var doc document
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("failed to parse document: %v", err)
+			}
+		}
+		return &doc, w.Body.String(), w.Code
+	}
+
+	doc, body, status := fetch("/openapi.json")
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	if doc.OpenAPI != openAPIVersion {
+		t.Errorf("expected openapi %s, got %q", openAPIVersion, doc.OpenAPI)
+	}
+	current := &apiVersions[len(apiVersions)-1]
+	if doc.Info.Version != current.Release {
+		t.Errorf("expected the current version %s by default, got %s", current.Release, doc.Info.Version)
+	}
+
+	// Every route of every version is documented once, under a unique
+	// operation ID, and deprecated with its version
+	for i := range apiVersions {
+		v := &apiVersions[i]
+		doc, _, status := fetch("/openapi.json?version=" + v.Name)
+		if status != http.StatusOK || doc.Info.Version != v.Release {
+			t.Fatalf("expected the %s document, got status %d and version %s", v.Name, status, doc.Info.Version)
+		}
+		operations := make(map[string]bool)
+		for _, rt := range v.Routes {
+			op, ok := doc.Paths[v.prefix()+rt.Path][strings.ToLower(rt.Method)]
+			if !ok {
+				t.Errorf("%s %s %s is not documented", v.Name, rt.Method, rt.Path)
+				continue
+			}
+			if operations[rt.OperationID] {
+				t.Errorf("%s: duplicate operation ID %s", v.Name, rt.OperationID)
+			}
+			operations[rt.OperationID] = true
+			if op["operationId"] != rt.OperationID {
+				t.Errorf("%s %s has operation ID %v", rt.Method, rt.Path, op["operationId"])
+			}
+			if deprecated, _ := op["deprecated"].(bool); deprecated != !v.Deprecated.IsZero() {
+				t.Errorf("%s %s %s: expected deprecated %v", v.Name, rt.Method, rt.Path, !v.Deprecated.IsZero())
+			}
+		}
+	}
+	if _, _, status := fetch("/openapi.json?version=v0"); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown version, got %d", status)
+	}
+
+	// Schemas follow json tags, and every reference resolves
+	study, _ := json.Marshal(doc.Components.Schemas["Study"])
+	if !strings.Contains(string(study), `"study_accession"`) || strings.Contains(string(study), `"StudyAccession"`) {
+		t.Errorf("unexpected Study schema: %s", study)
+	}
+	for _, ref := range regexp.MustCompile(`#/components/schemas/(\w+)`).FindAllStringSubmatch(body, -1) {
+		if _, ok := doc.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("unresolved reference to %s", ref[1])
+		}
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	v1 := server.router.PathPrefix(apiVersions[0].prefix()).Subrouter()
+	for _, rt := range apiRoutes {
+		if rt.OperationID != "lookup" && rt.OperationID != "createCollection" {
+			continue
+		}
+		handler := rt.Handler
+		v1.HandleFunc(rt.Path, server.validateRequest(rt, func(w http.ResponseWriter, r *http.Request) {
+			handler(server.Server, w, r)
+		})).Methods(rt.Method)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		errors []fieldError
+	}{
+		{"valid query", "GET", "/lookup?q=x&limit=5", "", http.StatusOK, nil},
+		{"empty value", "GET", "/lookup?q=x&limit=", "", http.StatusOK, nil},
+		{"unknown parameter", "GET", "/lookup?q=x&limt=5", "", http.StatusBadRequest,
+			[]fieldError{{"limt", "unknown parameter"}}},
+		{"malformed integer", "GET", "/lookup?q=x&limit=ten", "", http.StatusBadRequest,
+			[]fieldError{{"limit", "must be an integer"}}},
+		{"valid body", "POST", "/collections", `{"name":"liver","accessions":["SRR000001"]}`, http.StatusCreated, nil},
+		{"unknown field", "POST", "/collections", `{"name":"liver","accesions":["SRR000001"]}`, http.StatusBadRequest,
+			[]fieldError{{"accesions", "unknown field"}}},
+		{"wrong type", "POST", "/collections", `{"name":"liver","accessions":"SRR000001"}`, http.StatusBadRequest,
+			[]fieldError{{"accessions", "must be an array"}}},
+		{"missing body", "POST", "/collections", "", http.StatusBadRequest,
+			[]fieldError{{"body", "is required"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, apiVersions[0].prefix()+tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.errors == nil {
+				return
+			}
+			var response errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if len(response.Errors) != len(tt.errors) {
+				t.Fatalf("expected errors %+v, got %+v", tt.errors, response.Errors)
+			}
+			for i := range tt.errors {
+				if response.Errors[i] != tt.errors[i] {
+					t.Errorf("expected error %+v, got %+v", tt.errors[i], response.Errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	server.version = "v1.5.0"
+	server.router.Use(server.compatMiddleware)
+	server.router.HandleFunc(compat.VersionPath, server.handleVersion).Methods("GET")
+
+	srv := httptest.NewServer(server.router)
+	defer srv.Close()
+
+	info, result, err := compat.Negotiate(context.Background(), srv.Client(), srv.URL, compat.Local("v1.5.0"))
+	if err != nil {
+		t.Fatalf("Negotiate failed: %v", err)
+	}
+	if info.Version != "v1.5.0" || info.SchemaVersion != compat.SchemaVersion || !result.Compatible {
+		t.Errorf("unexpected negotiation: %+v %+v", info, result)
+	}
+
+	// Every response carries the server's versions
+	req := httptest.NewRequest("GET", "/api/lookup?q=x", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Header().Get(compat.HeaderVersion) != "v1.5.0" || w.Header().Get(compat.HeaderSchemaVersion) == "" {
+		t.Errorf("expected version headers, got %v", w.Header())
+	}
+
+	// Clients speaking an older schema than the server answers are turned away
+	req = httptest.NewRequest("GET", "/api/lookup?q=x", nil)
+	req.Header.Set(compat.HeaderSchemaVersion, strconv.Itoa(compat.MinSchemaVersion-1))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUpgradeRequired {
+		t.Fatalf("expected status 426, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "srake self-update") {
+		t.Errorf("expected an upgrade message, got %s", w.Body.String())
+	}
+}
+
+// TestAPIVersions tests that each API version is served under its own
+// prefix, and that deprecated versions say so and point to their successor
+func TestAPIVersions(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	versions, err := newAPIVersions(map[string]string{"v1": "2027-06-30"})
+	if err != nil {
+		t.Fatalf("newAPIVersions failed: %v", err)
+	}
+	server.versions = versions
+	server.setupRoutes()
+
+	for _, acc := range []string{"SRP000001", "SRP000002", "SRP000003"} {
+		if err := server.db.InsertStudy(&database.Study{StudyAccession: acc}); err != nil {
+			t.Fatalf("failed to insert study: %v", err)
+		}
+	}
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status 200, got %d: %s", target, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	// v1 keeps its shape, and announces its deprecation and sunset
+	w := get("/api/v1/studies?limit=2")
+	var v1 studyListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &v1); err != nil || len(v1.Studies) != 2 || v1.Limit != 2 {
+		t.Errorf("unexpected v1 response: %s", w.Body.String())
+	}
+	h := w.Header()
+	if h.Get(HeaderAPIVersion) != "v1" {
+		t.Errorf("expected %s v1, got %q", HeaderAPIVersion, h.Get(HeaderAPIVersion))
+	}
+	if h.Get("Deprecation") != fmt.Sprintf("@%d", apiVersions[0].Deprecated.Unix()) {
+		t.Errorf("unexpected Deprecation header %q", h.Get("Deprecation"))
+	}
+	if h.Get("Sunset") != "Wed, 30 Jun 2027 00:00:00 GMT" {
+		t.Errorf("unexpected Sunset header %q", h.Get("Sunset"))
+	}
+	if h.Get("Link") != `</api/v2/studies>; rel="successor-version"` {
+		t.Errorf("unexpected Link header %q", h.Get("Link"))
+	}
+
+	// v2 lists studies with a pagination object, and is not deprecated
+	w = get("/api/v2/studies?limit=2")
+	var v2 studyPageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &v2); err != nil || len(v2.Studies) != 2 {
+		t.Errorf("unexpected v2 response: %s", w.Body.String())
+	}
+	if v2.Pagination != (pagination{Limit: 2, Offset: 0, NextOffset: 2}) {
+		t.Errorf("unexpected pagination %+v", v2.Pagination)
+	}
+	if w.Header().Get(HeaderAPIVersion) != "v2" || w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" {
+		t.Errorf("unexpected v2 headers %v", w.Header())
+	}
+	w = get("/api/v2/studies?limit=2&offset=2")
+	v2 = studyPageResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &v2); err != nil || len(v2.Studies) != 1 || v2.Pagination.NextOffset != 0 {
+		t.Errorf("expected the last page without next_offset, got %s", w.Body.String())
+	}
+
+	// Every v1 endpoint is served by v2, so successor links resolve
+	for _, rt := range apiRoutes {
+		found := false
+		for _, rt2 := range versions[1].Routes {
+			found = found || (rt2.Method == rt.Method && rt2.Path == rt.Path)
+		}
+		if !found {
+			t.Errorf("%s %s has no v2 successor", rt.Method, rt.Path)
+		}
+	}
+
+	// Sunset dates are only accepted for deprecated versions, after their
+	// deprecation
+	for _, sunset := range []map[string]string{{"v9": "2027-06-30"}, {"v2": "2027-06-30"}, {"v1": "June 2027"}, {"v1": "2027-01-31"}} {
+		if _, err := newAPIVersions(sunset); err == nil {
+			t.Errorf("expected an error for %v", sunset)
+		}
+	}
+}
+
+// TestHandlerVersions tests that the standalone server's handler serves
+// each API version with the same headers as the API server
+func TestHandlerVersions(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	if err := server.db.InsertStudy(&database.Study{StudyAccession: "SRP000001"}); err != nil {
+		t.Fatalf("failed to insert study: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Search.IndexPath = filepath.Join(t.TempDir(), "index")
+	cfg.Server.APISunset = map[string]string{"v1": "2027-06-30"}
+	h, err := NewHandler(server.db, cfg, nil)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	defer h.searchBackend.Close()
+
+	for _, v := range apiVersions {
+		req := httptest.NewRequest("GET", v.prefix()+"/studies/SRP000001", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "SRP000001") {
+			t.Fatalf("%s: expected the study, got %d: %s", v.Name, w.Code, w.Body.String())
+		}
+		if w.Header().Get(HeaderAPIVersion) != v.Name {
+			t.Errorf("%s: unexpected %s %q", v.Name, HeaderAPIVersion, w.Header().Get(HeaderAPIVersion))
+		}
+		if deprecated := w.Header().Get("Deprecation") != ""; deprecated != !v.Deprecated.IsZero() {
+			t.Errorf("%s: expected deprecated %v, got headers %v", v.Name, !v.Deprecated.IsZero(), w.Header())
+		}
+	}
+	req := httptest.NewRequest("GET", "/api/v1/stats", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Header().Get("Sunset") != "Wed, 30 Jun 2027 00:00:00 GMT" || w.Header().Get("Link") != `</api/v2/stats>; rel="successor-version"` {
+		t.Errorf("unexpected v1 headers %v", w.Header())
+	}
+
+	cfg.Server.APISunset = map[string]string{"v3": "2027-06-30"}
+	if _, err := NewHandler(server.db, cfg, nil); err == nil {
+		t.Error("expected an error for an unknown API version")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(config.RateLimitConfig{Enabled: true, RequestsPerSecond: 1, Burst: 2})
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+
+	handler := limiter.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/health", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The burst passes, the next request waits for a token
+	for i := 0; i < 2; i++ {
+		if w := request("192.0.2.1:5000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	w := request("192.0.2.1:5001")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 429 with Retry-After 1, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Other clients have their own budget, and tokens refill over time
+	if w := request("192.0.2.2:5000"); w.Code != http.StatusOK {
+		t.Errorf("expected another client to pass, got %d", w.Code)
+	}
+	now = now.Add(time.Second)
+	if w := request("192.0.2.1:5000"); w.Code != http.StatusOK {
+		t.Errorf("expected a refilled token, got %d", w.Code)
+	}
+
+	if newRateLimiter(config.RateLimitConfig{RequestsPerSecond: 1}) != nil {
+		t.Error("expected no limiter when rate limiting is disabled")
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	stored, err := server.db.CreateAPIKey(&database.APIKey{Name: "lab", ReadOnly: true})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	handler, err := serverMiddleware(server.router, config.ServerConfig{Auth: config.AuthConfig{
+		Enabled: true,
+		Keys:    []config.APIKeyConfig{{Name: "admin", Key: "admin-secret", RequestsPerSecond: 1, Burst: 1}},
+	}}, server.db)
+	if err != nil {
+		t.Fatalf("serverMiddleware failed: %v", err)
+	}
+	request := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("GET", "/api/collections", ""); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected 401 without a key, got %d", w.Code)
+	}
+	if w := request("GET", "/api/collections", "", "Authorization", "Bearer wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong key, got %d", w.Code)
+	}
+	if w := request("GET", "/api/v1/health", ""); w.Code == http.StatusUnauthorized {
+		t.Error("expected health checks without a key")
+	}
+
+	// A read-only key reads but cannot start an index rebuild
+	if w := request("GET", "/api/collections", "", "Authorization", "Bearer "+stored); w.Code != http.StatusOK {
+		t.Errorf("expected 200 with a stored key, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("POST", "/api/jobs", `{"type":"index"}`, "Authorization", "Bearer "+stored); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for an index job with a read-only key, got %d", w.Code)
+	}
+
+	// A configured key has its own rate limit
+	if w := request("GET", "/api/collections", "", "X-API-Key", "admin-secret"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 with a configured key, got %d", w.Code)
+	}
+	if w := request("GET", "/api/collections", "", "X-API-Key", "admin-secret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the key's burst of 1 to be used up, got %d", w.Code)
+	}
+
+	if _, err := newKeyStore(config.AuthConfig{Keys: []config.APIKeyConfig{{Name: "bad", KeySHA256: "abc"}}}, nil); err == nil {
+		t.Error("expected an error for a malformed key_sha256")
+	}
+}
+
+func TestReadOnlyServer(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	server.readOnly = true
+
+	for _, tt := range []struct {
+		body string
+		want bool
+	}{
+		{`{"type":"ingest","file":"/data/NCBI_SRA_Metadata.tar.gz"}`, true},
+		{`{"type":"index"}`, true},
+		{`{"type":"export","query":"cancer"}`, false},
+	} {
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if refused := w.Code == http.StatusForbidden; refused != tt.want {
+			t.Errorf("%s: expected refused=%v, got %d: %s", tt.body, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	// Every route that deletes or edits must be refused by read-only servers
+	for _, rt := range apiRoutes {
+		if (rt.Method == "PATCH" || rt.Method == "DELETE") && !rt.Writes {
+			t.Errorf("%s %s is not marked as writing", rt.Method, rt.Path)
+		}
+	}
+}
+
+func TestIngestJobs(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	server.ingestDir = t.TempDir()
+	archive := filepath.Join(server.ingestDir, "NCBI_SRA_Metadata.tar.gz")
+	if err := os.WriteFile(archive, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "NCBI_SRA_Metadata.tar.gz")
+	if err := os.WriteFile(outside, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	submit := func(handler http.Handler, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without auth, nobody may start an ingest or an index rebuild
+	for _, body := range []string{`{"type":"Ingest","file":"NCBI_SRA_Metadata.tar.gz"}`, `{"type":"index"}`} {
+		if w := submit(server.router, body); w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403 without a key, got %d", body, w.Code)
+		}
+	}
+
+	handler, err := serverMiddleware(server.router, config.ServerConfig{Auth: config.AuthConfig{
+		Enabled: true,
+		Keys:    []config.APIKeyConfig{{Name: "admin", Key: "admin-secret"}},
+	}}, server.db)
+	if err != nil {
+		t.Fatalf("serverMiddleware failed: %v", err)
+	}
+	for _, tt := range []struct {
+		file string
+		want int
+	}{
+		{"NCBI_SRA_Metadata.tar.gz", http.StatusAccepted},
+		{archive, http.StatusAccepted},
+		{outside, http.StatusBadRequest},
+		{"../" + filepath.Base(filepath.Dir(outside)) + "/NCBI_SRA_Metadata.tar.gz", http.StatusBadRequest},
+		{"https://example.org/NCBI_SRA_Metadata.tar.gz", http.StatusBadRequest},
+	} {
+		body := fmt.Sprintf(`{"type":"ingest","file":%q}`, tt.file)
+		if w := submit(handler, body, "X-API-Key", "admin-secret"); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.file, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	// Links out of the directory are followed before the check
+	link := filepath.Join(server.ingestDir, "link.tar.gz")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.ingestFile(link); err == nil {
+		t.Error("expected a link out of the ingest directory to be refused")
+	}
+	if _, err := server.ingestFile("https://ftp.ncbi.nlm.nih.gov/sra/reports/Metadata/NCBI_SRA_Metadata_20240101.tar.gz"); err != nil {
+		t.Errorf("expected a mirror URL to be accepted: %v", err)
+	}
+	if _, err := server.ingestFile("https://ftp.ncbi.nlm.nih.gov/sra/reports/Metadata/../../../private/x.tar.gz"); err == nil {
+		t.Error("expected a URL leaving the mirror to be refused")
+	}
+
+	server.ingestDir = ""
+	if _, err := server.ingestFile(archive); err == nil {
+		t.Error("expected files to be refused without an ingest directory")
+	}
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	handler := corsMiddleware(config.CORSConfig{
+		Enabled:        true,
+		AllowedOrigins: []string{"https://sra.example.org"},
+		AllowedMethods: []string{"GET"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tt := range []struct {
+		origin string
+		want   string
+	}{
+		{"https://sra.example.org", "https://sra.example.org"},
+		{"https://evil.example.com", ""},
+	} {
+		req := httptest.NewRequest("OPTIONS", "/api/v1/search", nil)
+		req.Header.Set("Origin", tt.origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("origin %s: expected Access-Control-Allow-Origin %q, got %q", tt.origin, tt.want, got)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	settings := Settings{LogLevel: "info", RateLimit: config.RateLimitConfig{Enabled: true, RequestsPerSecond: 0.001, Burst: 1}}
+	server.loadSettings = func() (*Settings, error) {
+		loaded := settings
+		return &loaded, nil
+	}
+	server.router.HandleFunc("/admin/reload", server.handleReload).Methods("POST")
+	server.handler.set(server.router)
+
+	request := func(method, path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		server.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Reloading from another host is refused without API keys
+	if w := request("POST", "/admin/reload", "192.0.2.1:5000"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 from another host, got %d", w.Code)
+	}
+	w := request("POST", "/admin/reload", "127.0.0.1:5000")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from the server's host, got %d: %s", w.Code, w.Body.String())
+	}
+	var result ReloadResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode reload result: %v", err)
+	}
+	if len(result.Changed) != 1 || result.Changed[0] != "server.rate_limit" {
+		t.Errorf("expected server.rate_limit to change, got %v", result.Changed)
+	}
+
+	// The new rate limit applies to the next requests
+	request("GET", "/api/collections", "192.0.2.2:5000")
+	if w := request("GET", "/api/collections", "192.0.2.2:5000"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the reloaded burst of 1 to be used up, got %d", w.Code)
+	}
+
+	// Invalid settings leave the server as it was
+	settings.LogLevel = "loud"
+	settings.RateLimit.Enabled = false
+	if _, err := server.ReloadConfig(); err == nil {
+		t.Error("expected an error for an invalid log level")
+	}
+	if w := request("GET", "/api/collections", "192.0.2.2:5000"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the rate limit to stay after a failed reload, got %d", w.Code)
+	}
+	settings.LogLevel = "warn"
+	result2, err := server.Reload(settings)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(result2.Changed) != 2 || server.logLevel.Load() != logWarn {
+		t.Errorf("expected the log level and rate limit to change, got %v", result2.Changed)
+	}
+	if w := request("GET", "/api/collections", "192.0.2.2:5000"); w.Code != http.StatusOK {
+		t.Errorf("expected no rate limit after reloading without one, got %d", w.Code)
+	}
+}
+
+// TestHandlerReload tests that the standalone server's handler applies
+// the settings it reads again, and lists those that take a restart
+func TestHandlerReload(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	started := config.DefaultConfig()
+	started.Search.IndexPath = filepath.Join(t.TempDir(), "index")
+	reloaded := *started
+	reloaded.Server.RateLimit = config.RateLimitConfig{Enabled: true, RequestsPerSecond: 0.001, Burst: 1}
+	reloaded.Server.Port = started.Server.Port + 1
+	reloaded.Server.UI = !started.Server.UI
+	h, err := NewHandler(server.db, started, func() (*Settings, error) {
+		return NewSettings(&reloaded, started, func(name string) bool { return name == "server.ui" }), nil
+	})
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	defer h.searchBackend.Close()
+
+	request := func() int {
+		req := httptest.NewRequest("GET", "/api/v2/stats", nil)
+		req.RemoteAddr = "192.0.2.1:5000"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	request()
+	if code := request(); code == http.StatusTooManyRequests {
+		t.Fatal("expected no rate limit before the reload")
+	}
+
+	result, err := h.ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Changed, []string{"server.rate_limit"}) || !reflect.DeepEqual(result.Restart, []string{"server.port"}) {
+		t.Errorf("unexpected reload result %+v", result)
+	}
+	request()
+	if code := request(); code != http.StatusTooManyRequests {
+		t.Errorf("expected the reloaded burst of 1 to be used up, got %d", code)
+	}
+
+	if _, err := (&Handler{}).ReloadConfig(); err == nil {
+		t.Error("expected an error without a config to reload")
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	server.metrics = newServerMetrics(server.db, t.TempDir(), func() int64 { return 2 })
+	server.router.Use(server.metrics.middleware)
+	server.router.Handle("/metrics", server.metrics.handler()).Methods("GET")
+
+	for _, acc := range []string{"SRP000001", "SRP000002"} {
+		server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/study/"+acc, nil))
+	}
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected a text response, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// Requests are counted by route template, not by accession
+	for _, want := range []string{
+		`srake_http_requests_total{method="GET",route="/api/study/{accession}",status="404"} 2`,
+		`srake_http_request_duration_seconds_count{method="GET",route="/api/study/{accession}"} 2`,
+		`srake_active_searches 0`,
+		`srake_index_size_bytes 0`,
+		`srake_database_rows{table="studies"} 0`,
+		`srake_embedder_queue_depth 2`,
+		`go_goroutines `,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected %s in:\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	server.router.Handle("/ui", http.RedirectHandler(uiPath, http.StatusMovedPermanently)).Methods("GET", "HEAD")
+	server.router.PathPrefix(uiPath).Handler(uiHandler()).Methods("GET", "HEAD")
+	handler, err := serverMiddleware(server.router, config.ServerConfig{Auth: config.AuthConfig{
+		Enabled: true,
+		Keys:    []config.APIKeyConfig{{Name: "admin", Key: "admin-secret"}},
+	}}, server.db)
+	if err != nil {
+		t.Fatalf("serverMiddleware failed: %v", err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// The UI's files are served without a key, with their own types
+	for path, contentType := range map[string]string{
+		"/ui/":          "text/html",
+		"/ui/app.js":    "text/javascript",
+		"/ui/style.css": "text/css",
+	} {
+		w := get(path)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: expected status 200, got %d", path, w.Code)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, contentType) {
+			t.Errorf("GET %s: expected %s, got %q", path, contentType, ct)
+		}
+		if w.Header().Get("Content-Security-Policy") == "" {
+			t.Errorf("GET %s: expected a content security policy", path)
+		}
+	}
+	if w := get("/ui/"); !strings.Contains(w.Body.String(), `<script src="app.js"`) {
+		t.Errorf("expected the UI page, got %s", w.Body.String())
+	}
+	if w := get("/ui"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != uiPath {
+		t.Errorf("expected /ui to redirect to %s, got %d %q", uiPath, w.Code, w.Header().Get("Location"))
+	}
+	if w := get("/ui/missing.js"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, got %d", w.Code)
+	}
+
+	// The API it calls still needs one
+	if w := get("/api/collections"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 from the API without a key, got %d", w.Code)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	server.router.HandleFunc("/readyz", server.ready.handleReady).Methods("GET")
+
+	ready := func() int {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before warming up, got %d", code)
+	}
+
+	var opened bool
+	var searched []string
+	warmer{
+		db:    server.db,
+		index: func() error { opened = true; return nil },
+		search: func(ctx context.Context, query string) error {
+			searched = append(searched, query)
+			return errors.New("no index")
+		},
+	}.run(context.Background(), config.WarmupConfig{Enabled: true, Queries: []string{"cancer", "RNA-Seq"}}, &server.ready)
+
+	// Failed searches are logged, not fatal
+	if !opened || strings.Join(searched, ",") != "cancer,RNA-Seq" {
+		t.Errorf("expected the index opened and both queries searched, got %v %v", opened, searched)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("expected 200 once warmed up, got %d", code)
+	}
+}
+
+func TestReplicaServer(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	path := server.db.Path()
+	replica, err := database.Open(path, database.OpenOptions{Mode: database.ModeReplica})
+	if err != nil {
+		t.Fatalf("failed to open replica: %v", err)
+	}
+	defer replica.Close()
+	server.db = replica
+	server.readOnly = true
+	server.maxLag = time.Hour
+	server.ready.stale = server.replicaStale
+	server.ready.ready.Store(true)
+	server.router.HandleFunc("/readyz", server.ready.handleReady).Methods("GET")
+
+	// Even reading jobs are queued in the database
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/jobs", strings.NewReader(`{"type":"search","query":"liver"}`)))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "replica") {
+		t.Errorf("expected 403 for a job on a replica, got %d: %s", w.Code, w.Body.String())
+	}
+
+	ready := func() (int, string) {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code, w.Body.String()
+	}
+	if code, body := ready(); code != http.StatusOK {
+		t.Errorf("expected a fresh replica ready, got %d: %s", code, body)
+	}
+
+	// No change from the primary for longer than the max lag
+	old := time.Now().Add(-2 * time.Hour)
+	for _, file := range []string{path, path + "-wal"} {
+		os.Chtimes(file, old, old)
+	}
+	if code, body := ready(); code != http.StatusServiceUnavailable || !strings.Contains(body, `"stale"`) {
+		t.Errorf("expected a stale replica out of rotation, got %d: %s", code, body)
+	}
+}
+
+func TestPopularityCounting(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	study := &database.Study{StudyAccession: "SRP000001", StudyTitle: "Test Study"}
+	if err := server.db.InsertStudy(study); err != nil {
+		t.Fatalf("failed to insert test study: %v", err)
+	}
+
+	// A server not counting ignores records
+	server.popularity.fetched("study", "SRP000001")
+
+	server.popularity = newPopularityCounter(server.db)
+	for i := 0; i < 2; i++ {
+		server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/study/SRP000001", nil))
+	}
+	server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/study/SRP999999", nil))
+	server.popularity.returned("study", "SRP000001")
+	server.popularity.returned("experiment", "SRX000001")
+
+	if err := server.popularity.flush(); err != nil {
+		t.Fatalf("failed to flush counts: %v", err)
+	}
+	popular, err := server.db.PopularRecords("", time.Time{}, 10)
+	if err != nil {
+		t.Fatalf("failed to list popular records: %v", err)
+	}
+	if len(popular) != 1 || popular[0].Accession != "SRP000001" || popular[0].Fetched != 2 || popular[0].Returned != 1 {
+		t.Errorf("expected SRP000001 fetched twice and returned once, got %+v", popular)
+	}
+}
+
+// flushRecorder records how many lines had been written at each flush
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes []int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes = append(f.flushes, strings.Count(f.Body.String(), "\n"))
+	f.ResponseRecorder.Flush()
+}
+
+func TestSearchStream(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// stream emits results after a header, failing with err after them
+	stream := func(results int, err error) searchStreamFunc {
+		return func(header func(*service.SearchStreamHeader) error, emit func(*service.SearchResult) error) error {
+			if err := header(&service.SearchStreamHeader{TotalResults: 500, Returned: results, Query: "liver"}); err != nil {
+				return err
+			}
+			for i := 0; i < results; i++ {
+				if err := emit(&service.SearchResult{ID: fmt.Sprintf("SRP%06d", i), Type: "study"}); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+	}
+	lines := func(t *testing.T, w *flushRecorder) []string {
+		t.Helper()
+		if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("expected Content-Type application/x-ndjson, got %q", ct)
+		}
+		return strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	}
+
+	t.Run("header and results", func(t *testing.T) {
+		w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		server.streamSearch(w, httptest.NewRequest("GET", "/api/search?q=liver&format=ndjson", nil), stream(120, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		got := lines(t, w)
+		if len(got) != 121 {
+			t.Fatalf("expected a header and 120 result lines, got %d lines", len(got))
+		}
+		var header service.SearchStreamHeader
+		if err := json.Unmarshal([]byte(got[0]), &header); err != nil {
+			t.Fatalf("failed to parse header line: %v", err)
+		}
+		if header.TotalResults != 500 || header.Returned != 120 || header.Query != "liver" {
+			t.Errorf("unexpected header %+v", header)
+		}
+		for i, line := range got[1:] {
+			var result service.SearchResult
+			if err := json.Unmarshal([]byte(line), &result); err != nil {
+				t.Fatalf("failed to parse result line %d: %v", i+1, err)
+			}
+			if want := fmt.Sprintf("SRP%06d", i); result.ID != want {
+				t.Fatalf("expected result %d to be %s, got %s", i, want, result.ID)
+			}
+		}
+
+		// The header and the first result are flushed on their own, then
+		// every searchStreamFlushEvery results
+		want := []int{1, 2, 1 + searchStreamFlushEvery, 1 + 2*searchStreamFlushEvery}
+		if !reflect.DeepEqual(w.flushes, want) {
+			t.Errorf("expected flushes after lines %v, got %v", want, w.flushes)
+		}
+	})
+
+	t.Run("error after header", func(t *testing.T) {
+		w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		server.streamSearch(w, httptest.NewRequest("GET", "/api/search?q=liver&format=ndjson", nil), stream(3, errors.New("index closed")))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 once streaming, got %d", w.Code)
+		}
+		got := lines(t, w)
+		if len(got) != 5 {
+			t.Fatalf("expected a header, 3 results and an error line, got %d lines", len(got))
+		}
+		var resp errorResponse
+		if err := json.Unmarshal([]byte(got[4]), &resp); err != nil {
+			t.Fatalf("failed to parse error line: %v", err)
+		}
+		if !resp.Error || resp.Message != "index closed" || resp.Status != http.StatusInternalServerError {
+			t.Errorf("unexpected error line %+v", resp)
+		}
+	})
+
+	t.Run("error before header", func(t *testing.T) {
+		w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		server.streamSearch(w, httptest.NewRequest("GET", "/api/search?q=liver&format=ndjson", nil),
+			func(header func(*service.SearchStreamHeader) error, emit func(*service.SearchResult) error) error {
+				return &service.ServiceError{Code: service.ErrCodeInvalidQuery, Message: "bad query"}
+			})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+		var resp errorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse error response: %v", err)
+		}
+		if resp.Message != "bad query" {
+			t.Errorf("expected message 'bad query', got %q", resp.Message)
+		}
+		if len(w.flushes) != 0 {
+			t.Errorf("expected no flushes, got %v", w.flushes)
+		}
+	})
+}
+
+func TestGRPCAPI(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	if err := server.db.InsertExperiment(&database.Experiment{ExperimentAccession: "SRX000001", Title: "Test Experiment"}); err != nil {
+		t.Fatalf("failed to insert experiment: %v", err)
+	}
+	for _, acc := range []string{"SRR000002", "SRR000001"} {
+		run := &database.Run{RunAccession: acc, ExperimentAccession: "SRX000001", TotalSpots: 1000000}
+		if err := server.db.InsertRun(run); err != nil {
+			t.Fatalf("failed to insert run: %v", err)
+		}
+	}
+
+	// Only the methods that read the database; searches need an index.
+	// Calls need the API key of the middleware.
+	middleware, err := serverMiddleware(grpcPassed, config.ServerConfig{Auth: config.AuthConfig{
+		Enabled: true,
+		Keys:    []config.APIKeyConfig{{Name: "admin", Key: "admin-secret"}},
+	}}, server.db)
+	if err != nil {
+		t.Fatalf("serverMiddleware failed: %v", err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	srv := newGRPCServer(server.db, nil, middleware)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := srakev1.NewSrakeClient(conn)
+
+	if _, err := client.GetRecord(context.Background(), &srakev1.GetRecordRequest{Accession: "SRR000001"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("GetRecord without a key: got %v, want Unauthenticated", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "admin-secret")
+
+	record, err := client.GetRecord(ctx, &srakev1.GetRecordRequest{Accession: "SRR000001"})
+	if err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+	if run := record.GetRun(); run == nil || run.RunAccession != "SRR000001" || run.TotalSpots != 1000000 {
+		t.Errorf("GetRecord returned %v", record)
+	}
+	if _, err := client.GetRecord(ctx, &srakev1.GetRecordRequest{Accession: "SRR999999"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetRecord of a missing accession: got %v, want NotFound", err)
+	}
+
+	// collect reads a stream to its end
+	collect := func(recv func() error) (int, error) {
+		n := 0
+		for {
+			err := recv()
+			if err == io.EOF {
+				return n, nil
+			}
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+
+	runs, err := client.ListRuns(ctx, &srakev1.ListRunsRequest{ExperimentAccession: "SRX000001"})
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	first, err := runs.Recv()
+	if err != nil || first.RunAccession != "SRR000001" {
+		t.Fatalf("ListRuns: first run %v, %v", first, err)
+	}
+	if n, err := collect(func() error { _, err := runs.Recv(); return err }); err != nil || n != 1 {
+		t.Errorf("ListRuns: %d more runs, %v", n, err)
+	}
+	runs, _ = client.ListRuns(ctx, &srakev1.ListRunsRequest{})
+	if _, err := collect(func() error { _, err := runs.Recv(); return err }); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListRuns without an accession: got %v, want InvalidArgument", err)
+	}
+
+	exported, _ := client.StreamExport(ctx, &srakev1.ExportRequest{Type: "run"})
+	if n, err := collect(func() error { _, err := exported.Recv(); return err }); err != nil || n != 2 {
+		t.Errorf("StreamExport: %d records, %v", n, err)
+	}
+	exported, _ = client.StreamExport(ctx, &srakev1.ExportRequest{Type: "library"})
+	if _, err := collect(func() error { _, err := exported.Recv(); return err }); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("StreamExport of an unknown type: got %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+)
+
+// ListenAndServe serves srv over HTTPS when TLS is enabled in cfg, and over
+// HTTP otherwise.
+func ListenAndServe(srv *http.Server, cfg config.TLSConfig) error {
+	if !cfg.Enabled {
+		return srv.ListenAndServe()
+	}
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = tlsConfig
+	return srv.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+}
+
+// serverTLSConfig returns the TLS settings of cfg, without its certificate
+func serverTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("TLS is enabled but server.tls.cert_file or server.tls.key_file is not set")
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	switch cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported server.tls.min_version %q (use 1.2 or 1.3)", cfg.MinVersion)
+	}
+	return &tls.Config{MinVersion: minVersion}, nil
+}
+
+// serverMiddleware wraps h with the CORS, API key and rate limit settings
+// of cfg; API keys are also looked up in db. It wraps the whole router so
+// that preflight requests are answered for routes that do not accept
+// OPTIONS.
+func serverMiddleware(h http.Handler, cfg config.ServerConfig, db *database.DB) (http.Handler, error) {
+	limiter := newRateLimiter(cfg.RateLimit)
+	if cfg.Auth.Enabled && limiter == nil {
+		// Keys may have rate limits of their own
+		limiter = newLimiter(0, 0)
+	}
+	if limiter != nil {
+		h = limiter.middleware(h)
+	}
+	if cfg.Auth.Enabled {
+		keys, err := newKeyStore(cfg.Auth, db)
+		if err != nil {
+			return nil, err
+		}
+		h = keys.middleware(h)
+	}
+	if cfg.CORS.Enabled {
+		h = corsMiddleware(cfg.CORS)(h)
+	}
+	return h, nil
+}
+
+// corsMiddleware adds CORS headers for allowed origins and answers
+// preflight requests
+func corsMiddleware(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin := len(cfg.AllowedOrigins) == 0 || slices.Contains(cfg.AllowedOrigins, "*")
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			switch {
+			case anyOrigin:
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			case origin != "" && slices.Contains(cfg.AllowedOrigins, origin):
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			default:
+				// Other origins get no CORS headers, so browsers refuse them
+				next.ServeHTTP(w, r)
+				return
+			}
+			if methods != "" {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+			}
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+			}
+
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
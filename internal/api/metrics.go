@@ -0,0 +1,172 @@
+package api
+
+import (
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rowCountInterval is how long database row counts are reused between
+// scrapes, since Prometheus may scrape more often than they change
+const rowCountInterval = time.Minute
+
+// serverMetrics are the Prometheus metrics served at /metrics
+type serverMetrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	searches prometheus.Gauge
+}
+
+// newServerMetrics registers the request metrics, and gauges measured at
+// scrape time from db and the index at indexPath. pending, when set,
+// returns the query embeddings waiting for the model.
+func newServerMetrics(db *database.DB, indexPath string, pending func() int64) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "srake_http_requests_total", Help: "HTTP requests served",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "srake_http_request_duration_seconds", Help: "HTTP request latency",
+		}, []string{"route", "method"}),
+		searches: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "srake_active_searches", Help: "Searches in progress",
+		}),
+	}
+	m.registry.MustRegister(m.requests, m.latency, m.searches)
+
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "srake_index_size_bytes", Help: "Size of the search index on disk",
+	}, func() float64 { return float64(dirSize(indexPath)) }))
+	if pending != nil {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "srake_embedder_queue_depth", Help: "Query embeddings waiting for the model",
+		}, func() float64 { return float64(pending()) }))
+	}
+
+	var mu sync.Mutex
+	var counted time.Time
+	var stats database.DatabaseStats
+	rows := func(count func(*database.DatabaseStats) int) func() float64 {
+		return func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			if db != nil && time.Since(counted) >= rowCountInterval {
+				if s, err := db.EstimateStats(); err == nil {
+					stats, counted = *s, time.Now()
+				}
+			}
+			return float64(count(&stats))
+		}
+	}
+	for table, count := range map[string]func(*database.DatabaseStats) int{
+		"studies":     func(s *database.DatabaseStats) int { return s.TotalStudies },
+		"experiments": func(s *database.DatabaseStats) int { return s.TotalExperiments },
+		"samples":     func(s *database.DatabaseStats) int { return s.TotalSamples },
+		"runs":        func(s *database.DatabaseStats) int { return s.TotalRuns },
+	} {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "srake_database_rows",
+			Help:        "Rows in the core tables of the database, estimated from count sketches",
+			ConstLabels: prometheus.Labels{"table": table},
+		}, rows(count)))
+	}
+	return m
+}
+
+// handler serves the metrics, with the Go runtime and process metrics
+func (m *serverMetrics) handler() http.Handler {
+	return metrics.Handler(m.registry)
+}
+
+// middleware counts requests and their latency by route. Inside a mux
+// router the route is its path template; around a ServeMux it is the
+// pattern that matched.
+func (m *serverMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := routeTemplate(r)
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		m.latency.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// searching counts a search in progress until the returned function is
+// called. It does nothing when metrics are disabled.
+func (m *serverMetrics) searching() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.searches.Inc()
+	return m.searches.Dec
+}
+
+// routeTemplate returns the pattern of the route that served r, such as
+// /api/v1/runs/{accession}, so that each accession does not get a series
+// of its own
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	return "unmatched"
+}
+
+// statusRecorder remembers the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wrote {
+		w.status = status
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// dirSize returns the total size of the files under path, or 0 if it
+// cannot be read
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIVersion is the version of the OpenAPI specification produced
+const openAPIVersion = "3.0.3"
+
+// pathParamPattern matches the {name} placeholders of a route path
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// handleOpenAPI serves the OpenAPI document of the current API version,
+// or of the one named by the version parameter, such as v1
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	versions := s.servedVersions()
+	v := &versions[len(versions)-1]
+	if name := r.URL.Query().Get("version"); name != "" {
+		if v = findAPIVersion(versions, name); v == nil {
+			s.writeError(w, http.StatusNotFound, fmt.Sprintf("unknown API version %q", name))
+			return
+		}
+	}
+	s.writeJSON(w, http.StatusOK, buildOpenAPI(v))
+}
+
+// buildOpenAPI describes the routes of an API version as an OpenAPI 3
+// document. Request and response schemas are derived from the Go types the
+// handlers decode and encode, following their json tags.
+func buildOpenAPI(v *apiVersion) map[string]interface{} {
+	schemas := newSchemaRegistry()
+	paths := make(map[string]map[string]interface{})
+
+	for _, rt := range v.Routes {
+		path := v.prefix() + pathParamPattern.ReplaceAllString(rt.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+
+		var params []interface{}
+		for _, m := range pathParamPattern.FindAllStringSubmatch(rt.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, p := range rt.Query {
+			param := map[string]interface{}{
+				"name":   p.Name,
+				"in":     "query",
+				"schema": map[string]interface{}{"type": p.Type},
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+
+		op := map[string]interface{}{
+			"operationId": rt.OperationID,
+			"summary":     rt.Summary,
+			"tags":        []string{rt.Tag},
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if !v.Deprecated.IsZero() {
+			op["deprecated"] = true
+		}
+		if rt.Body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": schemas.schemaOf(reflect.TypeOf(rt.Body)),
+					},
+				},
+			}
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		if rt.Response != nil {
+			contentType := rt.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			schema := schemas.schemaOf(reflect.TypeOf(rt.Response))
+			if contentType == "application/octet-stream" {
+				schema = map[string]interface{}{"type": "string", "format": "binary"}
+			}
+			response["content"] = map[string]interface{}{
+				contentType: map[string]interface{}{"schema": schema},
+			}
+		}
+		responses := map[string]interface{}{
+			strconv.Itoa(status): response,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": schemas.schemaOf(reflect.TypeOf(errorResponse{})),
+					},
+				},
+			},
+		}
+		op["responses"] = responses
+
+		paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "SRAKE API",
+			"version":     v.Release,
+			"description": "SRA Knowledgebase Engine API",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.schemas,
+		},
+	}
+}
+
+// schemaRegistry converts Go types to JSON schemas, collecting named
+// struct types as reusable components
+type schemaRegistry struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: make(map[string]interface{}),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaOf returns the schema of a type, or a reference to it for named
+// structs
+func (r *schemaRegistry) schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": r.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": r.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + r.component(t)}
+	}
+	// Interfaces and anything else accept any value
+	return map[string]interface{}{}
+}
+
+// component registers a named struct type, returning its component name.
+// Types from different packages with the same name are told apart by
+// their package name.
+func (r *schemaRegistry) component(t reflect.Type) string {
+	if name, ok := r.names[t]; ok {
+		return name
+	}
+	// Unexported response types are named like exported ones, so that
+	// generated clients get conventional class names
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if _, taken := r.schemas[name]; taken {
+		pkg := t.PkgPath()
+		pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	r.names[t] = name
+	r.schemas[name] = map[string]interface{}{} // placeholder for recursive types
+	r.schemas[name] = r.structSchema(t)
+	return name
+}
+
+// structSchema describes the JSON encoding of a struct. Embedded structs
+// without a json name are flattened, as encoding/json does.
+func (r *schemaRegistry) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	r.addFields(t, properties)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func (r *schemaRegistry) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				r.addFields(ft, properties)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := r.schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			// nil pointers, slices and maps are encoded as null
+			switch f.Type.Kind() {
+			case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+				schema = nullable(schema)
+			}
+		}
+		properties[name] = schema
+	}
+}
+
+// nullable allows null in place of a schema's value. A reference cannot
+// have siblings in OpenAPI 3.0, so it is wrapped in allOf.
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if _, ok := schema["$ref"]; ok {
+		return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+	}
+	if len(schema) == 0 {
+		// An empty schema already accepts null
+		return schema
+	}
+	schema["nullable"] = true
+	return schema
+}
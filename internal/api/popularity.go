@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// popularTypes are the record types whose popularity is counted
+var popularTypes = map[string]bool{"study": true, "run": true}
+
+// popularityCounter counts how often studies and runs are returned by
+// searches and fetched, in memory, and adds the counts to the database
+// every flush, so that requests do not wait on a write. Its methods do
+// nothing on a nil counter, which servers not counting have.
+type popularityCounter struct {
+	db *database.DB
+
+	mu     sync.Mutex
+	counts map[string]*database.PopularityCount // by accession
+}
+
+func newPopularityCounter(db *database.DB) *popularityCounter {
+	return &popularityCounter{db: db, counts: make(map[string]*database.PopularityCount)}
+}
+
+// returned counts a record returned by a search
+func (c *popularityCounter) returned(recordType, accession string) {
+	c.add(recordType, accession, 1, 0)
+}
+
+// fetched counts a record fetched on its own
+func (c *popularityCounter) fetched(recordType, accession string) {
+	c.add(recordType, accession, 0, 1)
+}
+
+func (c *popularityCounter) add(recordType, accession string, returned, fetched int64) {
+	if c == nil || !popularTypes[recordType] || accession == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count, ok := c.counts[accession]
+	if !ok {
+		count = &database.PopularityCount{Accession: accession, RecordType: recordType}
+		c.counts[accession] = count
+	}
+	count.Returned += returned
+	count.Fetched += fetched
+}
+
+// flush adds the counts made since the last flush to the database
+func (c *popularityCounter) flush() error {
+	c.mu.Lock()
+	pending := c.counts
+	c.counts = make(map[string]*database.PopularityCount, len(pending))
+	c.mu.Unlock()
+
+	counts := make([]database.PopularityCount, 0, len(pending))
+	for _, count := range pending {
+		counts = append(counts, *count)
+	}
+	return c.db.AddPopularity(time.Now(), counts)
+}
+
+// run flushes the counts every interval until ctx is done, and once more
+// then
+func (c *popularityCounter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err := c.flush(); err != nil {
+				log.Printf("[POPULARITY] Warning: failed to save counts: %v", err)
+			}
+			return
+		}
+		if err := c.flush(); err != nil {
+			log.Printf("[POPULARITY] Warning: failed to save counts: %v", err)
+		}
+	}
+}
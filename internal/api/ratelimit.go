@@ -0,0 +1,132 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+)
+
+// rateLimiter limits the requests of each client address with a token
+// bucket: a client may make Burst requests at once and RequestsPerSecond
+// after that. Requests made with an API key share the key's bucket, which
+// may have a rate of its own.
+type rateLimiter struct {
+	rate  float64 // 0 leaves clients without a rate of their own unlimited
+	burst float64
+
+	mu      sync.Mutex
+	clients map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// bucket holds the tokens left to a client
+type bucket struct {
+	tokens      float64
+	last        time.Time
+	rate, burst float64
+}
+
+// newRateLimiter returns a limiter for cfg, or nil when rate limiting is
+// disabled
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	if !cfg.Enabled || cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	return newLimiter(cfg.RequestsPerSecond, cfg.Burst)
+}
+
+// newLimiter returns a limiter allowing each client rate requests per
+// second after a burst of burst
+func newLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   burstFor(rate, burst),
+		clients: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// burstFor returns burst, or a second's worth of requests when it is unset
+func burstFor(rate float64, burst int) float64 {
+	if burst >= 1 {
+		return float64(burst)
+	}
+	return math.Max(1, math.Ceil(rate))
+}
+
+// allow takes a token from the client's bucket, which refills at rate up
+// to burst. When none is left it returns how long until one is.
+func (l *rateLimiter) allow(client string, rate, burst float64) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.clients[client]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.clients[client] = b
+	}
+	b.rate, b.burst = rate, burst
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose buckets have refilled, once a minute
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for client, b := range l.clients {
+		full := time.Duration(b.burst / b.rate * float64(time.Second))
+		if now.Sub(b.last) > full {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// middleware answers clients over their limit with 429 Too Many Requests
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, rate, burst := clientAddress(r), l.rate, l.burst
+		if k := requestAPIKey(r.Context()); k != nil {
+			// Clients of a key share its budget wherever they connect from
+			client = "key:" + k.name
+			if k.rate > 0 {
+				rate, burst = k.rate, burstFor(k.rate, k.burst)
+			}
+		}
+		if rate > 0 {
+			if ok, wait := l.allow(client, rate, burst); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientAddress returns the IP address a request came from
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+)
+
+// Levels of server.log_level. Every request is logged at info, failed
+// ones at warn and server errors at error; debug adds the client address
+// and status.
+const (
+	logDebug int32 = iota - 1
+	logInfo
+	logWarn
+	logError
+)
+
+var logLevels = map[string]int32{
+	"debug": logDebug,
+	"info":  logInfo,
+	"warn":  logWarn,
+	"error": logError,
+}
+
+// parseLogLevel returns the level named, info when the name is empty
+func parseLogLevel(name string) (int32, error) {
+	if name == "" {
+		return logInfo, nil
+	}
+	level, ok := logLevels[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid log level %q (must be debug, info, warn or error)", name)
+	}
+	return level, nil
+}
+
+// Settings are the settings a running server applies again when it is
+// reloaded. The database, index, address and TLS take a restart.
+type Settings struct {
+	LogLevel  string
+	CORS      config.CORSConfig
+	RateLimit config.RateLimitConfig
+	Auth      config.AuthConfig
+	CacheTTL  time.Duration // search result cache; 0 keeps the default
+
+	// Restart names the settings that changed in the config but are only
+	// applied by a restart, such as database.path
+	Restart []string
+}
+
+// restartSettings are the settings of the config that a running server
+// only applies on a restart
+var restartSettings = []struct {
+	name    string
+	changed func(cfg, started *config.Config) bool
+}{
+	{"database.path", func(c, s *config.Config) bool { return c.Database.Path != s.Database.Path }},
+	{"search.index_path", func(c, s *config.Config) bool { return c.Search.IndexPath != s.Search.IndexPath }},
+	{"server.host", func(c, s *config.Config) bool { return c.Server.Host != s.Server.Host }},
+	{"server.port", func(c, s *config.Config) bool { return c.Server.Port != s.Server.Port }},
+	{"server.grpc_port", func(c, s *config.Config) bool { return c.Server.GRPCPort != s.Server.GRPCPort }},
+	{"server.tls", func(c, s *config.Config) bool { return c.Server.TLS != s.Server.TLS }},
+	{"server.read_only", func(c, s *config.Config) bool { return c.Server.ReadOnly != s.Server.ReadOnly }},
+	{"server.ingest_dir", func(c, s *config.Config) bool { return c.Server.IngestDir != s.Server.IngestDir }},
+	{"database.mode", func(c, s *config.Config) bool { return c.Database.Mode != s.Database.Mode }},
+	{"database.replication", func(c, s *config.Config) bool { return c.Database.Replication != s.Database.Replication }},
+	{"database.max_lag", func(c, s *config.Config) bool { return c.Database.MaxLag != s.Database.MaxLag }},
+	{"server.ui", func(c, s *config.Config) bool { return c.Server.UI != s.Server.UI }},
+}
+
+// NewSettings returns the settings of cfg that a running server applies.
+// Settings changed from started, the config the server started with, that
+// only a restart applies are listed in Restart, unless ignored reports
+// that the server does not read them from the config, as a flag set them
+// or the server does not use them.
+func NewSettings(cfg, started *config.Config, ignored func(name string) bool) *Settings {
+	settings := &Settings{
+		LogLevel:  cfg.Server.LogLevel,
+		CORS:      cfg.Server.CORS,
+		RateLimit: cfg.Server.RateLimit,
+		Auth:      cfg.Server.Auth,
+		CacheTTL:  time.Duration(cfg.Search.CacheTTL) * time.Second,
+	}
+	for _, r := range restartSettings {
+		if r.changed(cfg, started) && (ignored == nil || !ignored(r.name)) {
+			settings.Restart = append(settings.Restart, r.name)
+		}
+	}
+	return settings
+}
+
+// ReloadResult reports what a reload applied
+type ReloadResult struct {
+	Changed []string `json:"changed"` // settings applied
+	Restart []string `json:"restart"` // settings changed that need a restart
+}
+
+// handlerSwitch serves requests with a handler that can be replaced while
+// the server runs
+type handlerSwitch struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (s *handlerSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.handler.Load()).ServeHTTP(w, r)
+}
+
+func (s *handlerSwitch) set(h http.Handler) {
+	s.handler.Store(&h)
+}
+
+// Reload applies settings to the running server. Requests in flight, such
+// as long exports, finish as they started, and later requests are served
+// under the new settings; clients' rate limits start over. Settings that
+// cannot be applied, such as a malformed API key, leave the server as it
+// was.
+func (s *Server) Reload(settings Settings) (*ReloadResult, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	level, err := parseLogLevel(settings.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := serverMiddleware(s.router, config.ServerConfig{CORS: settings.CORS, RateLimit: settings.RateLimit, Auth: settings.Auth}, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newReloadResult(settings)
+	old := s.settings
+	if level != s.logLevel.Load() {
+		result.Changed = append(result.Changed, "server.log_level")
+	}
+	result.Changed = append(result.Changed, middlewareChanges(old, settings)...)
+	if settings.CacheTTL != old.CacheTTL {
+		result.Changed = append(result.Changed, "search.cache_ttl")
+	}
+
+	s.handler.set(handler)
+	s.logLevel.Store(level)
+	if settings.CacheTTL > 0 && s.searchService != nil {
+		s.searchService.SetCacheTTL(settings.CacheTTL)
+	}
+	settings.Restart = nil
+	s.settings = settings
+	return result, nil
+}
+
+// newReloadResult returns the result of applying settings, with the
+// settings that take a restart and none applied yet
+func newReloadResult(settings Settings) *ReloadResult {
+	result := &ReloadResult{Changed: []string{}, Restart: settings.Restart}
+	if result.Restart == nil {
+		result.Restart = []string{}
+	}
+	return result
+}
+
+// middlewareChanges names the settings of the CORS, API key and rate limit
+// middleware that differ between old and settings
+func middlewareChanges(old, settings Settings) []string {
+	var changed []string
+	for _, c := range []struct {
+		name    string
+		changed bool
+	}{
+		{"server.cors", !reflect.DeepEqual(settings.CORS, old.CORS)},
+		{"server.rate_limit", settings.RateLimit != old.RateLimit},
+		{"server.auth", !reflect.DeepEqual(settings.Auth, old.Auth)},
+	} {
+		if c.changed {
+			changed = append(changed, c.name)
+		}
+	}
+	return changed
+}
+
+// ReloadConfig reads the settings again with Config.LoadSettings and
+// applies them, as on SIGHUP and POST /admin/reload
+func (s *Server) ReloadConfig() (*ReloadResult, error) {
+	return reloadConfig(s.loadSettings, s.Reload)
+}
+
+// reloadConfig reads the settings with load and applies them with apply,
+// logging what changed
+func reloadConfig(load func() (*Settings, error), apply func(Settings) (*ReloadResult, error)) (*ReloadResult, error) {
+	if load == nil {
+		return nil, fmt.Errorf("this server has no config to reload")
+	}
+	settings, err := load()
+	if err != nil {
+		return nil, err
+	}
+	result, err := apply(*settings)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Reloaded config; changed: %v", result.Changed)
+	for _, name := range result.Restart {
+		log.Printf("Warning: %s changed, but is only applied by a restart", name)
+	}
+	return result, nil
+}
+
+// Reloader is a running server that reads its config again
+type Reloader interface {
+	ReloadConfig() (*ReloadResult, error)
+}
+
+// ReloadOnHangup reloads the config of server on every SIGHUP until the
+// function returned is called. A config that cannot be read or applied is
+// logged, and the server keeps running with its old settings.
+func ReloadOnHangup(server Reloader) (stop func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-hup:
+				if _, err := server.ReloadConfig(); err != nil {
+					log.Printf("Config reload failed, keeping the running config: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hup)
+		close(done)
+	}
+}
+
+// handleReload reloads the config. It takes an API key that is not
+// read-only, or without API keys a request from the server's own host.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if k := requestAPIKey(r.Context()); k != nil {
+		if k.readOnly {
+			s.writeError(w, http.StatusForbidden, fmt.Sprintf("API key %s is read-only", k.name))
+			return
+		}
+	} else if ip := net.ParseIP(clientAddress(r)); ip == nil || !ip.IsLoopback() {
+		s.writeError(w, http.StatusForbidden, "Reloading takes an API key, or a request from the server's host")
+		return
+	}
+
+	result, err := s.ReloadConfig()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Reload failed: %v", err))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/nishad/srake/internal/compat"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/jsonpatch"
+	"github.com/nishad/srake/internal/service"
+)
+
+// route describes one REST endpoint. The routes of each API version drive
+// the router, request validation and the OpenAPI document served at
+// /openapi.json, so the document always matches the endpoints served.
+type route struct {
+	Method      string
+	Path        string // relative to the version's prefix, with {name} path parameters
+	Handler     func(*Server, http.ResponseWriter, *http.Request)
+	OperationID string
+	Summary     string
+	Tag         string
+	Query       []queryParam // the only query parameters accepted
+
+	// Body and Response are values of the types the handler decodes and
+	// encodes; nil when there is no JSON body
+	Body     interface{}
+	Response interface{}
+
+	Status      int    // success status; defaults to 200
+	ContentType string // response content type; defaults to application/json
+
+	// Writes marks routes that change the database, which read-only
+	// servers and keys refuse
+	Writes bool
+}
+
+// queryParam describes a query string parameter
+type queryParam struct {
+	Name        string
+	Type        string // OpenAPI type: string, integer, number or boolean
+	Description string
+}
+
+var paginationParams = []queryParam{
+	{"limit", "integer", "Maximum number of results"},
+	{"offset", "integer", "Number of results to skip"},
+}
+
+var searchParams = append([]queryParam{
+	{"q", "string", "Search query"},
+	{"query", "string", "Alias of q"},
+	{"mode", "string", "Search mode: auto, text, vector, hybrid or database"},
+	{"search_mode", "string", "Alias of mode"},
+	{"organism", "string", "Filter by organism"},
+	{"library_strategy", "string", "Filter by library strategy"},
+	{"platform", "string", "Filter by sequencing platform"},
+	{"attribute_range", "string", "Filter samples by a numeric attribute range facet, e.g. age:40-50 years"},
+	{"taxon", "string", "Filter samples by NCBI taxon ID or scientific name"},
+	{"include_descendants", "boolean", "With taxon, also match the taxa below it"},
+	{"similarity_threshold", "number", "Minimum cosine similarity for vector results (0-1)"},
+	{"min_score", "number", "Minimum relevance score"},
+	{"top_percentile", "integer", "Only return the top N percentile of results"},
+	{"show_confidence", "boolean", "Include confidence levels"},
+	{"hybrid_weight", "number", "Weight of vector scores in hybrid search (0-1)"},
+	{"fusion", "string", "Hybrid rank fusion: weighted or rrf"},
+	{"rerank", "boolean", "Reorder the top results with a cross-encoder"},
+	{"rerank_candidates", "integer", "How many of the top results rerank reorders"},
+	{"boost_popular", "boolean", "Rank records higher the more often they were returned and fetched"},
+	{"expand", "boolean", "Expand query terms with synonyms from loaded vocabularies (default true)"},
+	{"format", "string", "Response format"},
+	{"cursor", "string", "Cursor pagination: * starts a scan, next_cursor of the previous page continues it"},
+}, paginationParams...)
+
+// apiRoutes are the endpoints of the REST API v1, in the order they are
+// registered. Later versions override some of them; see apiVersions.
+var apiRoutes = []route{
+	// Search
+	{Method: "GET", Path: "/search", Handler: (*Server).handleSearch, OperationID: "search",
+		Summary: "Search records", Tag: "search", Query: searchParams,
+		Response: service.SearchResponse{}},
+	{Method: "POST", Path: "/search", Handler: (*Server).handleSearch, OperationID: "searchPost",
+		Summary: "Search records with a JSON request", Tag: "search",
+		Body: service.SearchRequest{}, Response: service.SearchResponse{}},
+	{Method: "POST", Path: "/search/advanced", Handler: (*Server).handleAdvancedSearch, OperationID: "advancedSearch",
+		Summary: "Search with a query or filters required", Tag: "search",
+		Body: service.SearchRequest{}, Response: service.SearchResponse{}},
+	{Method: "POST", Path: "/search/feedback", Handler: (*Server).handleSearchFeedback, OperationID: "searchFeedback",
+		Summary: "Record relevance judgments for a query", Tag: "search",
+		Body: service.FeedbackRequest{}, Response: service.FeedbackResponse{}, Status: http.StatusCreated, Writes: true},
+
+	// Records
+	{Method: "GET", Path: "/studies/{accession}", Handler: (*Server).handleGetStudy, OperationID: "getStudy",
+		Summary: "Get a study", Tag: "records", Response: database.Study{}},
+	{Method: "GET", Path: "/experiments/{accession}", Handler: (*Server).handleGetExperiment, OperationID: "getExperiment",
+		Summary: "Get an experiment", Tag: "records", Response: database.Experiment{}},
+	{Method: "GET", Path: "/samples/{accession}", Handler: (*Server).handleGetSample, OperationID: "getSample",
+		Summary: "Get a sample", Tag: "records", Response: database.Sample{}},
+	{Method: "GET", Path: "/runs/{accession}", Handler: (*Server).handleGetRun, OperationID: "getRun",
+		Summary: "Get a run", Tag: "records", Response: database.Run{}},
+	{Method: "GET", Path: "/studies", Handler: (*Server).handleListStudies, OperationID: "listStudies",
+		Summary: "List studies", Tag: "records", Query: paginationParams, Response: studyListResponse{}},
+
+	// Relationships
+	{Method: "GET", Path: "/studies/{accession}/metadata", Handler: (*Server).handleGetStudyMetadata, OperationID: "getStudyMetadata",
+		Summary: "Get a study with its related records", Tag: "relationships", Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/studies/{accession}/experiments", Handler: (*Server).handleGetStudyExperiments, OperationID: "getStudyExperiments",
+		Summary: "List the experiments of a study", Tag: "relationships", Response: studyExperimentsResponse{}},
+	{Method: "GET", Path: "/studies/{accession}/samples", Handler: (*Server).handleGetStudySamples, OperationID: "getStudySamples",
+		Summary: "List the samples of a study", Tag: "relationships", Response: studySamplesResponse{}},
+	{Method: "GET", Path: "/studies/{accession}/runs", Handler: (*Server).handleGetStudyRuns, OperationID: "getStudyRuns",
+		Summary: "List the runs of a study", Tag: "relationships",
+		Query: []queryParam{{"limit", "integer", "Maximum number of runs"}}, Response: studyRunsResponse{}},
+	{Method: "GET", Path: "/studies/{accession}/jsonld", Handler: (*Server).handleGetStudyJSONLD, OperationID: "getStudyJSONLD",
+		Summary: "Get Bioschemas Dataset markup for a study", Tag: "relationships",
+		Response: map[string]interface{}{}, ContentType: "application/ld+json"},
+
+	// Curation
+	{Method: "PATCH", Path: "/records/{accession}", Handler: (*Server).handlePatchRecord, OperationID: "patchRecord",
+		Summary: "Curate a record with a JSON Patch", Tag: "curation",
+		Body: jsonpatch.Patch{}, Response: database.Curation{}, Writes: true},
+
+	// Lookup
+	{Method: "GET", Path: "/lookup", Handler: (*Server).handleLookup, OperationID: "lookup",
+		Summary: "Find records by alias, submitter ID, internal ID or run file", Tag: "records",
+		Query: []queryParam{
+			{"alias", "string", "Center-assigned alias"},
+			{"submitter_id", "string", "Submitter ID"},
+			{"internal_id", "string", "Internal ID imported with srake idmap import"},
+			{"md5", "string", "MD5 checksum of a run data file"},
+			{"filename", "string", "Name of a run data file"},
+			{"q", "string", "Alias, submitter ID or internal ID"},
+			{"limit", "integer", "Maximum number of candidates"},
+		},
+		Response: service.LookupResponse{}},
+	{Method: "POST", Path: "/lookup", Handler: (*Server).handleLookupAccessions, OperationID: "lookupAccessions",
+		Summary: "Fetch the records of many accessions at once", Tag: "records",
+		Body: service.AccessionLookupRequest{}, Response: database.AccessionLookup{}},
+
+	// Cross-references
+	{Method: "GET", Path: "/biosamples/{accession}", Handler: (*Server).handleResolveBioSample, OperationID: "resolveBioSample",
+		Summary: "List the SRA records linked to a BioSample", Tag: "records", Response: database.ExternalLinks{}},
+	{Method: "GET", Path: "/bioprojects/{accession}", Handler: (*Server).handleResolveBioProject, OperationID: "resolveBioProject",
+		Summary: "List the SRA records linked to a BioProject", Tag: "records", Response: database.ExternalLinks{}},
+	{Method: "GET", Path: "/geo/{accession}", Handler: (*Server).handleResolveGEO, OperationID: "resolveGEO",
+		Summary: "List the SRA records linked to a GEO series or sample", Tag: "records", Response: database.ExternalLinks{}},
+
+	// Sample attributes
+	{Method: "GET", Path: "/attributes/query", Handler: (*Server).handleQueryAttributes, OperationID: "queryAttributes",
+		Summary: "Find samples by their attributes", Tag: "records",
+		Query: append([]queryParam{
+			{"where", "string", "Attribute condition such as tissue=liver, age>40 or disease~carcinoma (repeatable; all must hold)"},
+		}, paginationParams...),
+		Response: service.AttributeQueryResponse{}},
+	{Method: "GET", Path: "/attributes/tags", Handler: (*Server).handleListAttributeTags, OperationID: "listAttributeTags",
+		Summary: "List sample attribute tags by frequency", Tag: "records",
+		Query: []queryParam{
+			{"prefix", "string", "Only tags starting with this prefix"},
+			{"limit", "integer", "Maximum number of tags"},
+		},
+		Response: attributeTagsResponse{}},
+
+	// Collections
+	{Method: "GET", Path: "/collections", Handler: (*Server).handleListCollections, OperationID: "listCollections",
+		Summary: "List collections", Tag: "collections", Response: collectionListResponse{}},
+	{Method: "POST", Path: "/collections", Handler: (*Server).handleCreateCollection, OperationID: "createCollection",
+		Summary: "Create a collection", Tag: "collections",
+		Body: service.CollectionRequest{}, Response: service.CollectionUpdate{}, Status: http.StatusCreated, Writes: true},
+	{Method: "GET", Path: "/collections/{name}", Handler: (*Server).handleGetCollection, OperationID: "getCollection",
+		Summary: "Get a collection and its members", Tag: "collections", Response: service.CollectionResponse{}},
+	{Method: "DELETE", Path: "/collections/{name}", Handler: (*Server).handleDeleteCollection, OperationID: "deleteCollection",
+		Summary: "Delete a collection", Tag: "collections", Status: http.StatusNoContent, Writes: true},
+	{Method: "POST", Path: "/collections/{name}/members", Handler: (*Server).handleAddCollectionMembers, OperationID: "addCollectionMembers",
+		Summary: "Add records to a collection", Tag: "collections",
+		Body: service.CollectionRequest{}, Response: service.CollectionUpdate{}, Writes: true},
+	{Method: "DELETE", Path: "/collections/{name}/members/{accession}", Handler: (*Server).handleRemoveCollectionMember, OperationID: "removeCollectionMember",
+		Summary: "Remove a record from a collection", Tag: "collections", Response: service.CollectionUpdate{}, Writes: true},
+
+	// Statistics
+	{Method: "GET", Path: "/stats", Handler: (*Server).handleGetStats, OperationID: "getStats",
+		Summary: "Get database and index statistics", Tag: "stats", Response: service.SearchStats{}},
+	{Method: "GET", Path: "/stats/organisms", Handler: (*Server).handleGetOrganismStats, OperationID: "getOrganismStats",
+		Summary: "Get the most common organisms", Tag: "stats", Response: organismStatsResponse{}},
+	{Method: "GET", Path: "/stats/platforms", Handler: (*Server).handleGetPlatformStats, OperationID: "getPlatformStats",
+		Summary: "Get the most common platforms", Tag: "stats", Response: platformStatsResponse{}},
+	{Method: "GET", Path: "/stats/strategies", Handler: (*Server).handleGetStrategyStats, OperationID: "getStrategyStats",
+		Summary: "Get the most common library strategies", Tag: "stats", Response: strategyStatsResponse{}},
+	{Method: "GET", Path: "/stats/distinct", Handler: (*Server).handleGetDistinctStats, OperationID: "getDistinctStats",
+		Summary: "Get record and distinct facet value counts", Tag: "stats",
+		Query:    []queryParam{{"exact", "boolean", "Count exactly instead of estimating from sketches (slow on large databases)"}},
+		Response: distinctStatsResponse{}},
+
+	// Export
+	{Method: "POST", Path: "/export", Handler: (*Server).handleExport, OperationID: "export",
+		Summary: "Export search results as json, jsonl, csv, tsv, xml or msgpack", Tag: "export",
+		Body: service.ExportRequest{}, Response: "", ContentType: "application/octet-stream"},
+
+	// Background jobs
+	{Method: "GET", Path: "/jobs", Handler: (*Server).handleListJobs, OperationID: "listJobs",
+		Summary: "List background jobs", Tag: "jobs",
+		Query: []queryParam{
+			{"status", "string", "Only list jobs with this status"},
+			{"limit", "integer", "Maximum number of jobs"},
+		},
+		Response: jobListResponse{}},
+	{Method: "POST", Path: "/jobs", Handler: (*Server).handleSubmitJob, OperationID: "submitJob",
+		Summary: "Queue a background search, export, ingest or index rebuild", Tag: "jobs",
+		Body: service.JobRequest{}, Response: database.Job{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/jobs/{id}", Handler: (*Server).handleGetJob, OperationID: "getJob",
+		Summary: "Get a background job", Tag: "jobs", Response: database.Job{}},
+	{Method: "DELETE", Path: "/jobs/{id}", Handler: (*Server).handleCancelJob, OperationID: "cancelJob",
+		Summary: "Cancel a background job", Tag: "jobs", Response: database.Job{}, Writes: true},
+	{Method: "GET", Path: "/jobs/{id}/result", Handler: (*Server).handleGetJobResult, OperationID: "getJobResult",
+		Summary: "Download the result of a finished job", Tag: "jobs",
+		Response: "", ContentType: "application/octet-stream"},
+	{Method: "GET", Path: "/jobs/{id}/events", Handler: (*Server).handleJobEvents, OperationID: "streamJobEvents",
+		Summary: "Stream the status and progress of a job as Server-Sent Events", Tag: "jobs",
+		Response: "", ContentType: "text/event-stream"},
+
+	// Health
+	{Method: "GET", Path: "/health", Handler: (*Server).handleHealth, OperationID: "health",
+		Summary: "Check service health", Tag: "health", Response: healthResponse{}},
+	{Method: "GET", Path: "/version", Handler: (*Server).handleVersion, OperationID: "version",
+		Summary: "Get the server release, API schema versions and capabilities", Tag: "health",
+		Response: compat.Info{}},
+}
+
+// Response bodies of handlers that wrap service results
+
+type studyListResponse struct {
+	Studies []*database.Study `json:"studies"`
+	Limit   int               `json:"limit"`
+	Offset  int               `json:"offset"`
+}
+
+// studyPageResponse is the v2 shape of a list of studies, with its
+// pagination in an object of its own
+type studyPageResponse struct {
+	Studies    []*database.Study `json:"studies"`
+	Pagination pagination        `json:"pagination"`
+}
+
+// pagination describes a page of a v2 list. NextOffset is the offset of
+// the next page, and is omitted on the last page.
+type pagination struct {
+	Limit      int `json:"limit"`
+	Offset     int `json:"offset"`
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+type studyExperimentsResponse struct {
+	StudyAccession string                 `json:"study_accession"`
+	Experiments    []*database.Experiment `json:"experiments"`
+	Total          int                    `json:"total"`
+}
+
+type studySamplesResponse struct {
+	StudyAccession string             `json:"study_accession"`
+	Samples        []*database.Sample `json:"samples"`
+	Total          int                `json:"total"`
+}
+
+type studyRunsResponse struct {
+	StudyAccession string          `json:"study_accession"`
+	Runs           []*database.Run `json:"runs"`
+	Total          int             `json:"total"`
+	Limit          int             `json:"limit"`
+}
+
+type attributeTagsResponse struct {
+	Tags  []database.AttributeTagCount `json:"tags"`
+	Total int                          `json:"total"`
+}
+
+type collectionListResponse struct {
+	Collections []database.Collection `json:"collections"`
+	Total       int                   `json:"total"`
+}
+
+type organismStatsResponse struct {
+	Organisms []service.StatItem `json:"organisms"`
+	Total     int                `json:"total"`
+}
+
+type platformStatsResponse struct {
+	Platforms []service.StatItem `json:"platforms"`
+	Total     int                `json:"total"`
+}
+
+type distinctStatsResponse struct {
+	Dimensions []database.DistinctCount `json:"dimensions"`
+	Exact      bool                     `json:"exact"`
+}
+
+type strategyStatsResponse struct {
+	Strategies []service.StatItem `json:"strategies"`
+	Total      int                `json:"total"`
+}
+
+type jobListResponse struct {
+	Jobs  []database.Job `json:"jobs"`
+	Total int            `json:"total"`
+}
+
+type healthResponse struct {
+	Status          string `json:"status"`
+	Timestamp       string `json:"timestamp"`
+	SearchService   string `json:"search_service"`
+	SearchIndex     string `json:"search_index"` // For frontend compatibility
+	MetadataService string `json:"metadata_service"`
+	Database        string `json:"database"` // For frontend compatibility
+
+	// Replication is reported by replicas
+	Replication *database.ReplicationStatus `json:"replication,omitempty"`
+}
+
+type errorResponse struct {
+	Error   bool         `json:"error"`
+	Message string       `json:"message"`
+	Status  int          `json:"status"`
+	Errors  []fieldError `json:"errors,omitempty"` // set when request validation fails
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/nishad/srake/internal/service"
+)
+
+// searchStreamFlushEvery is how many result lines a streamed search writes
+// between flushes, after flushing the header and the first result at once
+const searchStreamFlushEvery = 50
+
+// wantsSearchStream reports whether a search asks for a streamed response,
+// with Accept: application/x-ndjson or format=ndjson
+func wantsSearchStream(r *http.Request, req *service.SearchRequest) bool {
+	return req.Format == "ndjson" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// writeSearch runs a search and writes its response, streamed as NDJSON
+// when the client asks for it
+func (s *Server) writeSearch(w http.ResponseWriter, r *http.Request, req *service.SearchRequest) {
+	done := s.metrics.searching()
+	if wantsSearchStream(r, req) {
+		s.streamSearch(w, r, func(header func(*service.SearchStreamHeader) error, emit func(*service.SearchResult) error) error {
+			return s.searchService.SearchStream(r.Context(), req, header, emit)
+		})
+		done()
+		return
+	}
+
+	response, err := s.searchService.Search(r.Context(), req)
+	done()
+	if err != nil {
+		s.writeSearchError(w, err)
+		return
+	}
+	for _, result := range response.Results {
+		s.popularity.returned(result.Type, result.ID)
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// searchStreamFunc runs a search, handing its header and results to header
+// and emit as SearchService.SearchStream does
+type searchStreamFunc func(header func(*service.SearchStreamHeader) error, emit func(*service.SearchResult) error) error
+
+// streamSearch writes the response of a search run by run as
+// newline-delimited JSON: a header line with the total and facets, then a
+// line per result in rank order as run emits it. The header and first
+// result are flushed at once, so that a client can render them before the
+// rest of the page arrives. An error after the header has been written
+// ends the stream with an error line.
+func (s *Server) streamSearch(w http.ResponseWriter, r *http.Request, run searchStreamFunc) {
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	started := false
+	written := 0
+
+	header := func(h *service.SearchStreamHeader) error {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Accel-Buffering", "no") // Keep proxies from buffering lines
+		w.WriteHeader(http.StatusOK)
+		started = true
+		if err := enc.Encode(h); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	emit := func(result *service.SearchResult) error {
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+		written++
+		s.popularity.returned(result.Type, result.ID)
+		if written == 1 || written%searchStreamFlushEvery == 0 {
+			return rc.Flush()
+		}
+		return nil
+	}
+
+	err := run(header, emit)
+	switch {
+	case err == nil:
+	case !started:
+		s.writeSearchError(w, err)
+	case r.Context().Err() == nil:
+		log.Printf("Error streaming search results: %v", err)
+		enc.Encode(errorResponse{Error: true, Message: err.Error(), Status: http.StatusInternalServerError})
+	}
+}
@@ -6,11 +6,19 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"github.com/nishad/srake/internal/compat"
+	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/oaipmh"
+	"github.com/nishad/srake/internal/packaging"
 	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/retention"
 	"github.com/nishad/srake/internal/service"
 )
 
@@ -21,7 +29,34 @@ type Server struct {
 	searchService   *service.SearchService
 	metadataService *service.MetadataService
 	exportService   *service.ExportService
+	jobService      *service.JobService
 	db              *database.DB
+	catalog         packaging.Catalog
+	oai             *oaipmh.Provider
+	graphql         graphql.Schema
+	version         string // srake release, reported for compatibility checks
+	tls             config.TLSConfig
+	metrics         *serverMetrics     // nil when /metrics is disabled
+	popularity      *popularityCounter // nil unless counting is enabled
+	versions        []apiVersion       // versions of the REST API served, oldest first
+	readOnly        bool
+	ingestDir       string        // see Config.IngestDir
+	maxLag          time.Duration // see Config.MaxLag
+	ui              bool          // serve the web UI at /ui/
+	ready           readiness
+
+	// handler serves requests through the CORS, API key and rate limit
+	// middleware of the settings last loaded; Reload replaces it
+	handler      handlerSwitch
+	logLevel     atomic.Int32
+	settings     Settings
+	reloadMu     sync.Mutex
+	loadSettings func() (*Settings, error) // nil when there is no config to reload
+
+	// stopWorkers stops the background job worker and retention cleanup;
+	// workers tracks them until they have returned
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
 }
 
 // Config holds server configuration
@@ -30,21 +65,116 @@ type Config struct {
 	Port         int
 	DatabasePath string
 	IndexPath    string
-	EnableCORS   bool
+	JobsPath     string
+
+	// CORS, RateLimit, Auth and TLS come from the server section of the
+	// config
+	CORS      config.CORSConfig
+	RateLimit config.RateLimitConfig
+	Auth      config.AuthConfig
+	TLS       config.TLSConfig
+
+	// ReadOnly refuses requests that change the database or start ingests
+	// and index rebuilds
+	ReadOnly bool
+
+	// IngestDir is the directory ingest jobs may read archives from; see
+	// config.ServerConfig.IngestDir
+	IngestDir string
+
+	// Open sets how the database is opened. A replica serves read-only,
+	// without a job worker, retention cleanup or popularity counts, which
+	// write to the database; they run on the primary.
+	Open database.OpenOptions
+
+	// MaxLag, when set, is how long a replica may go without a change from
+	// the primary before /readyz takes it out of rotation
+	MaxLag time.Duration
+
+	// LogLevel sets which requests are logged: debug, info, warn or error
+	LogLevel string
+
+	// CacheTTL sets how long search results stay cached; 0 keeps the
+	// default
+	CacheTTL time.Duration
+
+	// LoadSettings, when set, reads the settings again from the config on
+	// SIGHUP and POST /admin/reload
+	LoadSettings func() (*Settings, error)
+
+	// Metrics serves Prometheus metrics at /metrics
+	Metrics bool
+
+	// UI serves the web UI at /ui/
+	UI bool
+
+	// Warmup sets what is loaded on startup before /readyz reports the
+	// server ready
+	Warmup config.WarmupConfig
+
+	// Popularity sets whether studies and runs returned and fetched are
+	// counted, and how the counts boost searches with boost_popular=true
+	Popularity config.PopularityConfig
+
+	// APISunset maps deprecated API versions, such as v1, to the date as
+	// YYYY-MM-DD after which they may be removed
+	APISunset map[string]string
+
+	// Embeddings, when set, configures the model that embeds queries in
+	// vector and hybrid search
+	Embeddings *config.EmbeddingConfig
+
+	// RerankModel and RerankCandidates configure the cross-encoder that
+	// reorders the top results of searches with rerank=true
+	RerankModel      string
+	RerankCandidates int
+
+	// NoExpand searches queries as written, without the synonyms of their
+	// terms from vocabularies loaded by 'srake ontology load'
+	NoExpand bool
+
+	// Catalog is used for canonical URLs and publisher info in JSON-LD
+	// and OAI-PMH records
+	Catalog packaging.Catalog
+
+	// AdminEmail is reported by the OAI-PMH Identify verb
+	AdminEmail string
+
+	// Version is the srake release reported to clients for compatibility
+	// checks
+	Version string
+
+	// Retention, when set, is applied every CleanupInterval while the
+	// server runs
+	Retention       *retention.Policy
+	CleanupInterval time.Duration
 }
 
 // NewServer creates a new API server instance
 func NewServer(cfg *Config) (*Server, error) {
 	start := time.Now()
 
+	versions, err := newAPIVersions(cfg.APISunset)
+	if err != nil {
+		return nil, err
+	}
+	logLevel, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
 	// Open database
 	log.Printf("[INIT] Opening database: %s", cfg.DatabasePath)
 	dbStart := time.Now()
-	db, err := database.Initialize(cfg.DatabasePath)
+	db, err := database.Open(cfg.DatabasePath, cfg.Open)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 	log.Printf("[INIT] Database opened in %v", time.Since(dbStart))
+	replica := db.ReadOnly()
+	if replica {
+		log.Printf("[INIT] Serving a read-only replica; ingests and jobs run on the primary")
+	}
 
 	// Initialize services
 	indexPath := cfg.IndexPath
@@ -60,6 +190,15 @@ func NewServer(cfg *Config) (*Server, error) {
 		db.Close()
 		return nil, fmt.Errorf("failed to initialize search service: %w", err)
 	}
+	if cfg.Embeddings != nil {
+		searchService.SetEmbeddingConfig(*cfg.Embeddings)
+	}
+	searchService.SetRerankConfig(cfg.RerankModel, cfg.RerankCandidates)
+	searchService.SetExpandSynonyms(!cfg.NoExpand)
+	searchService.SetPopularityConfig(cfg.Popularity)
+	if cfg.CacheTTL > 0 {
+		searchService.SetCacheTTL(cfg.CacheTTL)
+	}
 	log.Printf("[INIT] Search service initialized in %v", time.Since(searchStart))
 
 	// Initialize other services
@@ -67,13 +206,54 @@ func NewServer(cfg *Config) (*Server, error) {
 	metadataService := service.NewMetadataService(db)
 	exportService := service.NewExportService(db, searchService)
 
+	schema, err := newGraphQLSchema(metadataService)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to build GraphQL schema: %w", err)
+	}
+
+	jobsPath := cfg.JobsPath
+	if jobsPath == "" {
+		jobsPath = paths.GetJobsPath()
+	}
+	jobService := service.NewJobService(db, searchService, exportService, jobsPath)
+
 	// Create server
 	s := &Server{
 		router:          mux.NewRouter(),
 		searchService:   searchService,
 		metadataService: metadataService,
 		exportService:   exportService,
+		jobService:      jobService,
 		db:              db,
+		catalog:         cfg.Catalog,
+		oai: oaipmh.NewProvider(db, oaipmh.Config{
+			AdminEmail: cfg.AdminEmail,
+			Catalog:    cfg.Catalog,
+		}),
+		graphql:   schema,
+		version:   cfg.Version,
+		tls:       cfg.TLS,
+		readOnly:  cfg.ReadOnly || replica,
+		ingestDir: cfg.IngestDir,
+		maxLag:    cfg.MaxLag,
+		ui:        cfg.UI,
+		versions:  versions,
+		settings: Settings{
+			LogLevel:  cfg.LogLevel,
+			CORS:      cfg.CORS,
+			RateLimit: cfg.RateLimit,
+			Auth:      cfg.Auth,
+			CacheTTL:  cfg.CacheTTL,
+		},
+		loadSettings: cfg.LoadSettings,
+	}
+	s.logLevel.Store(logLevel)
+	if s.version == "" {
+		s.version = "dev"
+	}
+	if cfg.Metrics {
+		s.metrics = newServerMetrics(db, indexPath, searchService.PendingEmbeddings)
 	}
 
 	// Setup routes
@@ -81,60 +261,138 @@ func NewServer(cfg *Config) (*Server, error) {
 	routeStart := time.Now()
 	s.setupRoutes()
 
-	// Setup middleware
-	if cfg.EnableCORS {
-		s.router.Use(corsMiddleware)
+	// Setup middleware; CORS, API keys and rate limits wrap the router below
+	if s.metrics != nil {
+		s.router.Use(s.metrics.middleware)
 	}
-	s.router.Use(loggingMiddleware)
+	s.router.Use(s.loggingMiddleware)
 	s.router.Use(jsonMiddleware)
+	s.router.Use(s.compatMiddleware)
 	log.Printf("[INIT] Routes configured in %v", time.Since(routeStart))
 
 	// Create HTTP server
+	handler, err := serverMiddleware(s.router, config.ServerConfig{CORS: cfg.CORS, RateLimit: cfg.RateLimit, Auth: cfg.Auth}, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.handler.set(handler)
 	s.server = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Handler:      s.router,
+		Handler:      &s.handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Start background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	s.stopWorkers = stopWorkers
+
+	if !replica {
+		log.Printf("[INIT] Starting job worker with results in: %s", jobsPath)
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			if err := jobService.Run(workerCtx); err != nil {
+				log.Printf("Job worker stopped: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Retention != nil && cfg.CleanupInterval > 0 && !replica {
+		log.Printf("[INIT] Scheduling retention cleanup every %v", cfg.CleanupInterval)
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			retention.Schedule(workerCtx, db, *cfg.Retention, cfg.CleanupInterval)
+		}()
+	}
+
+	if cfg.Popularity.Enabled && !replica {
+		interval := time.Duration(cfg.Popularity.FlushInterval) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		log.Printf("[INIT] Counting record popularity, saved every %v", interval)
+		s.popularity = newPopularityCounter(db)
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.popularity.run(workerCtx, interval)
+		}()
+	}
+
+	// Warm up while serving; /readyz reports ready once done, and while
+	// a replica keeps up with the primary
+	if replica && s.maxLag > 0 {
+		s.ready.stale = s.replicaStale
+	}
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		warmer{
+			db:    db,
+			index: searchService.Warm,
+			search: func(ctx context.Context, query string) error {
+				_, err := searchService.Search(ctx, &service.SearchRequest{Query: query, Limit: 20})
+				return err
+			},
+		}.run(workerCtx, cfg.Warmup, &s.ready)
+	}()
+
 	log.Printf("[INIT] Server initialization complete in %v", time.Since(start))
 	return s, nil
 }
 
 // setupRoutes configures all API routes
 func (s *Server) setupRoutes() {
-	// API v1 routes
-	api := s.router.PathPrefix("/api/v1").Subrouter()
-
-	// Search endpoints
-	api.HandleFunc("/search", s.handleSearch).Methods("GET", "POST")
-	api.HandleFunc("/search/advanced", s.handleAdvancedSearch).Methods("POST")
-
-	// Metadata endpoints
-	api.HandleFunc("/studies/{accession}", s.handleGetStudy).Methods("GET")
-	api.HandleFunc("/experiments/{accession}", s.handleGetExperiment).Methods("GET")
-	api.HandleFunc("/samples/{accession}", s.handleGetSample).Methods("GET")
-	api.HandleFunc("/runs/{accession}", s.handleGetRun).Methods("GET")
-
-	// Batch metadata endpoints
-	api.HandleFunc("/studies", s.handleListStudies).Methods("GET")
-	api.HandleFunc("/studies/{accession}/metadata", s.handleGetStudyMetadata).Methods("GET")
-	api.HandleFunc("/studies/{accession}/experiments", s.handleGetStudyExperiments).Methods("GET")
-	api.HandleFunc("/studies/{accession}/samples", s.handleGetStudySamples).Methods("GET")
-	api.HandleFunc("/studies/{accession}/runs", s.handleGetStudyRuns).Methods("GET")
-
-	// Statistics endpoints
-	api.HandleFunc("/stats", s.handleGetStats).Methods("GET")
-	api.HandleFunc("/stats/organisms", s.handleGetOrganismStats).Methods("GET")
-	api.HandleFunc("/stats/platforms", s.handleGetPlatformStats).Methods("GET")
-	api.HandleFunc("/stats/strategies", s.handleGetStrategyStats).Methods("GET")
-
-	// Export endpoints
-	api.HandleFunc("/export", s.handleExport).Methods("POST")
-
-	// Health check
-	api.HandleFunc("/health", s.handleHealth).Methods("GET")
+	// REST API routes, each version under its own prefix
+	versions := s.servedVersions()
+	current := &versions[len(versions)-1]
+	for i := range versions {
+		v := &versions[i]
+		api := s.router.PathPrefix(v.prefix()).Subrouter()
+		api.Use(versionMiddleware(v, current))
+		for _, rt := range v.Routes {
+			handler, writes := rt.Handler, rt.Writes
+			api.HandleFunc(rt.Path, s.validateRequest(rt, func(w http.ResponseWriter, r *http.Request) {
+				if writes && s.refuseWrite(w, r) {
+					return
+				}
+				handler(s, w, r)
+			})).Methods(rt.Method)
+		}
+	}
+
+	// OpenAPI documents describing the routes above
+	s.router.HandleFunc("/openapi.json", s.handleOpenAPI).Methods("GET")
+
+	// OAI-PMH metadata harvesting
+	s.router.Handle("/oai", s.oai).Methods("GET", "POST")
+	s.router.Handle("/oai/sra.xsd", s.oai).Methods("GET")
+
+	// GraphQL
+	s.router.HandleFunc("/graphql", s.handleGraphQL).Methods("GET", "POST")
+
+	// Prometheus metrics
+	if s.metrics != nil {
+		s.router.Handle("/metrics", s.metrics.handler()).Methods("GET")
+	}
+
+	// Readiness for load balancers, once warmed up
+	s.router.HandleFunc("/readyz", s.ready.handleReady).Methods("GET")
+
+	// Config reload without a restart
+	if s.loadSettings != nil {
+		s.router.HandleFunc("/admin/reload", s.handleReload).Methods("POST")
+	}
+
+	// Web UI
+	if s.ui {
+		s.router.Handle("/ui", http.RedirectHandler(uiPath, http.StatusMovedPermanently)).Methods("GET", "HEAD")
+		s.router.PathPrefix(uiPath).Handler(uiHandler()).Methods("GET", "HEAD")
+	}
 
 	// Root endpoint
 	s.router.HandleFunc("/", s.handleRoot).Methods("GET")
@@ -143,7 +401,7 @@ func (s *Server) setupRoutes() {
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	log.Printf("Starting API server on %s", s.server.Addr)
-	return s.server.ListenAndServe()
+	return ListenAndServe(s.server, s.tls)
 }
 
 // Shutdown gracefully shuts down the server
@@ -155,6 +413,20 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return err
 	}
 
+	// Stop background workers; an interrupted job is requeued on restart
+	if s.stopWorkers != nil {
+		s.stopWorkers()
+		done := make(chan struct{})
+		go func() {
+			s.workers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+
 	// Close services
 	if s.searchService != nil {
 		s.searchService.Close()
@@ -176,32 +448,43 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 // Middleware functions
 
-func corsMiddleware(next http.Handler) http.Handler {
+// loggingMiddleware logs the requests the log level asks for
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		switch level := s.logLevel.Load(); {
+		case level == logDebug:
+			log.Printf("%s %s %s %d %s", clientAddress(r), r.Method, r.RequestURI, rec.status, time.Since(start))
+		case level == logInfo,
+			level == logWarn && rec.status >= 400,
+			level == logError && rec.status >= 500:
+			log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
 		}
-
-		next.ServeHTTP(w, r)
 	})
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
+func jsonMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+		w.Header().Set("Content-Type", "application/json")
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
 	})
 }
 
-func jsonMiddleware(next http.Handler) http.Handler {
+// compatMiddleware reports the server's release and API schema versions
+// on every response, and turns away clients whose schema is too old to be
+// answered with an upgrade message instead of responses they cannot decode
+func (s *Server) compatMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+		compat.SetHeaders(w.Header(), s.version)
+		if v, tooOld := compat.ClientTooOld(r); tooOld {
+			s.writeError(w, http.StatusUpgradeRequired, fmt.Sprintf(
+				"This client speaks API schema %d, but the server (srake %s) requires schema %d or newer; run 'srake self-update'",
+				v, s.version, compat.MinSchemaVersion))
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -216,58 +499,106 @@ func (s *Server) writeJSON(w http.ResponseWriter, status int, data interface{})
 }
 
 func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
-	s.writeJSON(w, status, map[string]interface{}{
-		"error":   true,
-		"message": message,
-		"status":  status,
+	s.writeJSON(w, status, errorResponse{
+		Error:   true,
+		Message: message,
+		Status:  status,
 	})
 }
 
-// handleRoot returns API information
+// handleRoot returns API information, with the endpoints of the current
+// API version
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	versions := s.servedVersions()
+	current := &versions[len(versions)-1]
+	prefix := current.prefix()
 	info := map[string]interface{}{
 		"name":        "SRAKE API",
-		"version":     "1.0.0",
+		"version":     current.Release,
 		"description": "SRA Knowledgebase Engine API",
+		"versions":    describeVersions(versions),
 		"endpoints": map[string]string{
-			"search":  "/api/v1/search",
-			"studies": "/api/v1/studies",
-			"stats":   "/api/v1/stats",
-			"health":  "/api/v1/health",
+			"search":      prefix + "/search",
+			"studies":     prefix + "/studies",
+			"collections": prefix + "/collections",
+			"jobs":        prefix + "/jobs",
+			"stats":       prefix + "/stats",
+			"health":      prefix + "/health",
+			"version":     compat.VersionPath,
+			"oai-pmh":     "/oai",
+			"graphql":     "/graphql",
+			"openapi":     "/openapi.json",
 		},
 	}
+	if s.ui {
+		info["endpoints"].(map[string]string)["ui"] = uiPath
+	}
 	s.writeJSON(w, http.StatusOK, info)
 }
 
+// handleVersion reports the release, API schema versions and capabilities
+// of the server, for clients to check compatibility
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, compat.Local(s.version))
+}
+
+// replicaStale returns an error when the server is a replica that has not
+// had a change from its primary for longer than its max lag
+func (s *Server) replicaStale() error {
+	if !s.db.ReadOnly() || s.maxLag <= 0 {
+		return nil
+	}
+	status, err := s.db.ReplicationStatus()
+	if err != nil {
+		return err
+	}
+	if lag := time.Since(status.LastChange); lag > s.maxLag {
+		return fmt.Errorf("no change from the primary for %v, more than the max lag of %v", lag.Round(time.Second), s.maxLag)
+	}
+	return nil
+}
+
 // handleHealth returns health status
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	health := map[string]interface{}{
-		"status":    "healthy",
-		"timestamp": time.Now().Format(time.RFC3339),
+	health := healthResponse{
+		Status:    "healthy",
+		Timestamp: time.Now().Format(time.RFC3339),
 	}
 
 	// Check search service
-	searchStatus := "healthy"
+	health.SearchService = "healthy"
 	if err := s.searchService.Health(ctx); err != nil {
-		health["status"] = "unhealthy"
-		searchStatus = err.Error()
+		health.Status = "unhealthy"
+		health.SearchService = err.Error()
+	} else if err := s.searchService.Degraded(); err != nil {
+		// Searches still answer from the database
+		health.Status = "degraded"
+		health.SearchService = "degraded: " + err.Error()
 	}
-	health["search_service"] = searchStatus
-	health["search_index"] = searchStatus // For frontend compatibility
+	health.SearchIndex = health.SearchService
 
 	// Check metadata service (database)
-	dbStatus := "healthy"
+	health.MetadataService = "healthy"
 	if err := s.metadataService.Health(ctx); err != nil {
-		health["status"] = "unhealthy"
-		dbStatus = err.Error()
+		health.Status = "unhealthy"
+		health.MetadataService = err.Error()
+	}
+	if s.db.ReadOnly() {
+		if status, err := s.db.ReplicationStatus(); err == nil {
+			health.Replication = status
+		}
+		if err := s.replicaStale(); err != nil && health.Status != "unhealthy" {
+			// A stale replica still answers, from older data
+			health.Status = "degraded"
+			health.MetadataService = "degraded: " + err.Error()
+		}
 	}
-	health["metadata_service"] = dbStatus
-	health["database"] = dbStatus // For frontend compatibility
+	health.Database = health.MetadataService
 
 	status := http.StatusOK
-	if health["status"] != "healthy" {
+	if health.Status == "unhealthy" {
 		status = http.StatusServiceUnavailable
 	}
 
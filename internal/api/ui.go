@@ -0,0 +1,42 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// uiPath is where the web UI is served
+const uiPath = "/ui/"
+
+// uiFiles are the static files of the web UI: a page, script and
+// stylesheet that search and browse through the API of the same server
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the web UI. The page only loads its own files and calls
+// this server, which its content security policy enforces.
+func uiHandler() http.Handler {
+	root, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix(uiPath, http.FileServer(http.FS(root)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Let the file server set the type from the file name
+		h := w.Header()
+		h.Del("Content-Type")
+		h.Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// isUIPath reports whether a request is for the web UI, which is served
+// without an API key; the UI asks for one when the API it calls needs it
+func isUIPath(path string) bool {
+	return path == "/ui" || strings.HasPrefix(path, uiPath)
+}
@@ -0,0 +1,445 @@
+// The srake web UI: search with facets, record pages and exports, served by
+// 'srake server' at /ui. It talks to the REST API and GraphQL endpoint of the
+// same server, so it needs no build step and no other host.
+'use strict';
+
+const API = '/api/v2';
+const PAGE_SIZE = 20;
+const EXPORT_LIMIT = 10000;
+const KEY_STORAGE = 'srake.apiKey';
+
+// Facets shown in the sidebar, in order, with their labels
+const FACETS = [
+  ['type', 'Record type'],
+  ['organism', 'Organism'],
+  ['library_strategy', 'Library strategy'],
+  ['library_source', 'Library source'],
+  ['library_layout', 'Library layout'],
+  ['platform', 'Platform'],
+  ['attribute_ranges', 'Attribute ranges'],
+];
+
+// Record types by the third letter of their accession
+const ACCESSION = /^[SED]R([PXSR])\d+$/i;
+const TYPES = { P: 'study', X: 'experiment', S: 'sample', R: 'run' };
+
+const content = document.getElementById('content');
+const facetsPane = document.getElementById('facets');
+const searchInput = document.getElementById('search-input');
+const keyForm = document.getElementById('key-form');
+const welcome = [...content.childNodes];
+
+// el creates an element with attributes and children. Text is always set as
+// text, never parsed as HTML, so record fields cannot inject markup.
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [name, value] of Object.entries(attrs || {})) {
+    if (name === 'onclick') {
+      node.addEventListener('click', value);
+    } else if (value !== undefined && value !== null && value !== false) {
+      node.setAttribute(name, value === true ? '' : value);
+    }
+  }
+  for (const child of children.flat()) {
+    if (child !== undefined && child !== null && child !== '') {
+      node.append(child instanceof Node ? child : String(child));
+    }
+  }
+  return node;
+}
+
+function show(...nodes) {
+  content.replaceChildren(...nodes);
+}
+
+function showError(err) {
+  show(el('p', { class: 'error' }, err.message || String(err)));
+}
+
+class AuthError extends Error {}
+
+// request calls the API with the stored API key, asking for one when the
+// server requires it
+async function request(path, body) {
+  const headers = { Accept: 'application/json' };
+  const key = localStorage.getItem(KEY_STORAGE);
+  if (key) {
+    headers['X-API-Key'] = key;
+  }
+  const init = { headers };
+  if (body !== undefined) {
+    init.method = 'POST';
+    headers['Content-Type'] = 'application/json';
+    init.body = JSON.stringify(body);
+  }
+
+  const resp = await fetch(path, init);
+  if (resp.status === 401) {
+    keyForm.hidden = false;
+    document.getElementById('key-input').focus();
+    throw new AuthError(key ? 'The API key was not accepted.' : 'Enter an API key to continue.');
+  }
+  if (!resp.ok) {
+    let message = resp.status + ' ' + resp.statusText;
+    try {
+      const data = await resp.json();
+      message = data.message || message;
+    } catch (e) {
+      // Not a JSON error; keep the status
+    }
+    throw new Error(message);
+  }
+  return resp;
+}
+
+async function getJSON(path, body) {
+  return (await request(path, body)).json();
+}
+
+async function graphql(query, variables) {
+  const data = await getJSON('/graphql', { query, variables });
+  if (data.errors && data.errors.length) {
+    throw new Error(data.errors.map((e) => e.message).join('; '));
+  }
+  return data.data;
+}
+
+// Routes, kept in the fragment so that the back button and links work:
+// #/search?q=liver&organism=Homo+sapiens&offset=20 and #/<type>/<accession>
+function parseRoute() {
+  const hash = location.hash.replace(/^#\/?/, '');
+  const split = hash.indexOf('?');
+  const path = split < 0 ? hash : hash.slice(0, split);
+  const parts = path.split('/').filter(Boolean).map(decodeURIComponent);
+  return { parts, params: new URLSearchParams(split < 0 ? '' : hash.slice(split + 1)) };
+}
+
+function searchHash(query, filters, offset) {
+  const params = new URLSearchParams();
+  params.set('q', query);
+  for (const [field, value] of Object.entries(filters)) {
+    params.set(field, value);
+  }
+  if (offset) {
+    params.set('offset', offset);
+  }
+  return '#/search?' + params.toString();
+}
+
+function recordHash(type, accession) {
+  return '#/' + type + '/' + encodeURIComponent(accession);
+}
+
+async function route() {
+  const { parts, params } = parseRoute();
+  document.title = 'srake';
+  try {
+    if (parts[0] === 'search') {
+      const query = params.get('q') || '';
+      const offset = parseInt(params.get('offset') || '0', 10) || 0;
+      const filters = {};
+      for (const [field] of FACETS) {
+        if (params.get(field)) {
+          filters[field] = params.get(field);
+        }
+      }
+      searchInput.value = query;
+      await runSearch(query, filters, offset);
+    } else if (parts.length === 2 && RECORDS[parts[0]]) {
+      facetsPane.replaceChildren();
+      await showRecord(parts[0], parts[1]);
+    } else {
+      facetsPane.replaceChildren();
+      searchInput.value = '';
+      show(...welcome);
+    }
+  } catch (err) {
+    showError(err);
+  }
+}
+
+// Search
+
+async function runSearch(query, filters, offset) {
+  show(el('p', { class: 'hint' }, 'Searching…'));
+  const body = { query, filters, limit: PAGE_SIZE, offset };
+  const data = await getJSON(API + '/search', body);
+  renderFacets(query, filters, data.facets || {});
+
+  const total = data.total_results || 0;
+  const results = data.results || [];
+  const summary = el('div', { class: 'summary' },
+    el('span', {}, total.toLocaleString() + ' results' + (data.time_taken_ms !== undefined ? ' in ' + data.time_taken_ms + ' ms' : '')),
+    exportButtons(query, filters));
+
+  const list = el('ol', { class: 'results', start: offset + 1 },
+    results.map((r) => el('li', {},
+      el('div', { class: 'result-head' },
+        el('span', { class: 'badge badge-' + r.type }, r.type),
+        el('a', { href: recordHash(r.type, r.id) }, r.id),
+        el('span', { class: 'title' }, r.title || '')),
+      r.description ? el('p', { class: 'description' }, truncate(r.description, 240)) : null,
+      el('p', { class: 'meta' }, [r.organism, r.library_strategy, r.platform].filter(Boolean).join(' · ')))));
+
+  const pager = el('nav', { class: 'pager' },
+    offset > 0 ? el('a', { href: searchHash(query, filters, Math.max(0, offset - PAGE_SIZE)) }, '← Previous') : null,
+    total > 0 ? el('span', {}, (offset + 1) + '–' + (offset + results.length) + ' of ' + total.toLocaleString()) : null,
+    offset + results.length < total ? el('a', { href: searchHash(query, filters, offset + PAGE_SIZE) }, 'Next →') : null);
+
+  show(summary,
+    data.warning ? el('p', { class: 'notice' }, data.warning) : null,
+    results.length ? list : el('p', { class: 'hint' }, 'No records match.'),
+    pager);
+}
+
+function renderFacets(query, filters, facets) {
+  const sections = [];
+  for (const [field, label] of FACETS) {
+    const values = facets[field] || [];
+    const active = filters[field];
+    if (!values.length && !active) {
+      continue;
+    }
+    const items = values.map((v) => {
+      const next = { ...filters };
+      if (active === v.value) {
+        delete next[field];
+      } else {
+        next[field] = v.value;
+      }
+      return el('li', {},
+        el('a', { href: searchHash(query, next, 0), class: active === v.value ? 'active' : null },
+          el('span', {}, v.value), el('span', { class: 'count' }, v.count.toLocaleString())));
+    });
+    if (active && !values.some((v) => v.value === active)) {
+      const next = { ...filters };
+      delete next[field];
+      items.unshift(el('li', {}, el('a', { href: searchHash(query, next, 0), class: 'active' }, el('span', {}, active))));
+    }
+    sections.push(el('section', {}, el('h3', {}, label), el('ul', {}, items)));
+  }
+  facetsPane.replaceChildren(...sections);
+}
+
+function exportButtons(query, filters) {
+  const formats = [['csv', 'CSV'], ['tsv', 'TSV'], ['jsonl', 'JSON lines']];
+  return el('span', { class: 'exports' }, 'Export:',
+    formats.map(([format, label]) => el('button', {
+      type: 'button',
+      title: 'Download up to ' + EXPORT_LIMIT.toLocaleString() + ' matching records',
+      onclick: (e) => downloadExport(e.target, query, filters, format),
+    }, label)));
+}
+
+async function downloadExport(button, query, filters, format) {
+  button.disabled = true;
+  try {
+    const resp = await request(API + '/export', { query, filters, format, limit: EXPORT_LIMIT });
+    const url = URL.createObjectURL(await resp.blob());
+    const link = el('a', { href: url, download: 'srake-export.' + format });
+    document.body.append(link);
+    link.click();
+    link.remove();
+    setTimeout(() => URL.revokeObjectURL(url), 1000);
+  } catch (err) {
+    showError(err);
+  } finally {
+    button.disabled = false;
+  }
+}
+
+// Records
+
+const RUN_FIELDS = 'run_accession experiment_accession total_spots total_bases published';
+const SAMPLE_FIELDS = 'sample_accession organism scientific_name taxon_id tissue cell_type description';
+const EXPERIMENT_FIELDS = 'experiment_accession study_accession title library_strategy library_source platform instrument_model';
+const STUDY_FIELDS = 'study_accession study_title study_abstract study_type organism submission_date';
+
+// RECORDS are the GraphQL queries of each record page, with the record's
+// own fields and its place in the study → experiment → run hierarchy
+const RECORDS = {
+  study: `query($acc: ID!) { study(accession: $acc) { ${STUDY_FIELDS}
+    experiments { ${EXPERIMENT_FIELDS} runs { ${RUN_FIELDS} } }
+    samples { sample_accession organism tissue cell_type } } }`,
+  experiment: `query($acc: ID!) { experiment(accession: $acc) { ${EXPERIMENT_FIELDS}
+    study { study_accession study_title }
+    samples { sample_accession organism tissue cell_type }
+    runs { ${RUN_FIELDS} } } }`,
+  sample: `query($acc: ID!) { sample(accession: $acc) { ${SAMPLE_FIELDS} metadata
+    experiments { experiment_accession title library_strategy study { study_accession study_title } }
+    runs { ${RUN_FIELDS} } } }`,
+  run: `query($acc: ID!) { run(accession: $acc) { ${RUN_FIELDS}
+    experiment { ${EXPERIMENT_FIELDS} study { study_accession study_title } } } }`,
+};
+
+async function showRecord(type, accession) {
+  show(el('p', { class: 'hint' }, 'Loading ' + accession + '…'));
+  const data = await graphql(RECORDS[type], { acc: accession });
+  const record = data[type];
+  if (!record) {
+    show(el('p', { class: 'error' }, accession + ' was not found.'));
+    return;
+  }
+  document.title = accession + ' · srake';
+  show(...RENDER[type](record));
+}
+
+const RENDER = {
+  study: (s) => [
+    breadcrumbs([['study', s.study_accession]]),
+    el('h1', {}, s.study_title || s.study_accession),
+    fields(s, [['Accession', 'study_accession'], ['Type', 'study_type'], ['Organism', 'organism'], ['Submitted', 'submission_date']]),
+    s.study_abstract ? el('p', { class: 'abstract' }, s.study_abstract) : null,
+    el('h2', {}, 'Experiments and runs (' + s.experiments.length + ')'),
+    hierarchy(s.experiments),
+    el('h2', {}, 'Samples (' + s.samples.length + ')'),
+    samplesTable(s.samples),
+  ],
+  experiment: (e) => [
+    breadcrumbs([e.study && ['study', e.study.study_accession], ['experiment', e.experiment_accession]]),
+    el('h1', {}, e.title || e.experiment_accession),
+    fields(e, [['Accession', 'experiment_accession'], ['Strategy', 'library_strategy'], ['Source', 'library_source'],
+      ['Platform', 'platform'], ['Instrument', 'instrument_model']]),
+    el('h2', {}, 'Runs (' + e.runs.length + ')'),
+    runsTable(e.runs),
+    el('h2', {}, 'Samples (' + e.samples.length + ')'),
+    samplesTable(e.samples),
+  ],
+  sample: (s) => [
+    breadcrumbs([['sample', s.sample_accession]]),
+    el('h1', {}, s.sample_accession),
+    fields(s, [['Organism', 'organism'], ['Scientific name', 'scientific_name'], ['Taxon ID', 'taxon_id'],
+      ['Tissue', 'tissue'], ['Cell type', 'cell_type'], ['Description', 'description']]),
+    attributesTable(s.metadata),
+    el('h2', {}, 'Experiments (' + s.experiments.length + ')'),
+    table(['Experiment', 'Title', 'Strategy', 'Study'], s.experiments.map((e) => [
+      link('experiment', e.experiment_accession), e.title, e.library_strategy,
+      e.study ? link('study', e.study.study_accession) : ''])),
+    el('h2', {}, 'Runs (' + s.runs.length + ')'),
+    runsTable(s.runs),
+  ],
+  run: (r) => [
+    breadcrumbs([r.experiment && r.experiment.study && ['study', r.experiment.study.study_accession],
+      r.experiment && ['experiment', r.experiment.experiment_accession], ['run', r.run_accession]]),
+    el('h1', {}, r.run_accession),
+    fields(r, [['Experiment', 'experiment_accession'], ['Spots', 'total_spots'], ['Bases', 'total_bases'], ['Published', 'published']]),
+    r.experiment ? el('p', {}, r.experiment.title || '') : null,
+  ],
+};
+
+function link(type, accession) {
+  return el('a', { href: recordHash(type, accession) }, accession);
+}
+
+// breadcrumbs shows where a record sits in the study → experiment → run
+// hierarchy
+function breadcrumbs(levels) {
+  const items = levels.filter(Boolean).map(([type, accession], i, all) =>
+    el('li', {}, el('span', { class: 'badge badge-' + type }, type),
+      i === all.length - 1 ? accession : link(type, accession)));
+  return el('ol', { class: 'breadcrumbs' }, items);
+}
+
+function fields(record, names) {
+  return el('dl', { class: 'fields' }, names
+    .filter(([, key]) => record[key] !== null && record[key] !== undefined && record[key] !== '')
+    .map(([label, key]) => [el('dt', {}, label), el('dd', {}, formatValue(key, record[key]))]));
+}
+
+function formatValue(key, value) {
+  if (typeof value === 'number' && key.startsWith('total_')) {
+    return value.toLocaleString();
+  }
+  return String(value);
+}
+
+// hierarchy lists the experiments of a study, each with its runs
+function hierarchy(experiments) {
+  if (!experiments.length) {
+    return el('p', { class: 'hint' }, 'No experiments.');
+  }
+  const open = experiments.length <= 10;
+  return el('ul', { class: 'tree' }, experiments.map((e) => el('li', {},
+    el('details', { open },
+      el('summary', {}, link('experiment', e.experiment_accession), ' ', e.title || '',
+        el('span', { class: 'meta' }, ' ' + [e.library_strategy, e.platform, e.runs.length + ' runs'].filter(Boolean).join(' · '))),
+      runsTable(e.runs)))));
+}
+
+function runsTable(runs) {
+  return table(['Run', 'Spots', 'Bases', 'Published'], runs.map((r) => [
+    link('run', r.run_accession), formatValue('total_spots', r.total_spots),
+    formatValue('total_bases', r.total_bases), r.published]));
+}
+
+function samplesTable(samples) {
+  return table(['Sample', 'Organism', 'Tissue', 'Cell type'], samples.map((s) => [
+    link('sample', s.sample_accession), s.organism, s.tissue, s.cell_type]));
+}
+
+// attributesTable lists the tag/value attributes kept in a sample's
+// metadata
+function attributesTable(metadata) {
+  let attrs = [];
+  try {
+    attrs = (JSON.parse(metadata || '{}').attributes) || [];
+  } catch (e) {
+    return null;
+  }
+  if (!attrs.length) {
+    return null;
+  }
+  return [el('h2', {}, 'Attributes'),
+    table(['Tag', 'Value'], attrs.map((a) => [a.tag, [a.value, a.units].filter(Boolean).join(' ')]))];
+}
+
+function table(headers, rows) {
+  if (!rows.length) {
+    return el('p', { class: 'hint' }, 'None.');
+  }
+  return el('table', {},
+    el('thead', {}, el('tr', {}, headers.map((h) => el('th', {}, h)))),
+    el('tbody', {}, rows.map((row) => el('tr', {}, row.map((cell) => el('td', {}, cell === null || cell === undefined ? '' : cell))))));
+}
+
+function truncate(text, length) {
+  return text.length > length ? text.slice(0, length - 1) + '…' : text;
+}
+
+// Wiring
+
+document.getElementById('search-form').addEventListener('submit', (e) => {
+  e.preventDefault();
+  const query = searchInput.value.trim();
+  const match = ACCESSION.exec(query);
+  if (match) {
+    location.hash = recordHash(TYPES[match[1].toUpperCase()], query.toUpperCase());
+  } else if (query) {
+    location.hash = searchHash(query, {}, 0);
+  }
+});
+
+keyForm.addEventListener('submit', (e) => {
+  e.preventDefault();
+  const key = document.getElementById('key-input').value.trim();
+  if (key) {
+    localStorage.setItem(KEY_STORAGE, key);
+    keyForm.hidden = true;
+    document.getElementById('forget-key').hidden = false;
+    route();
+  }
+});
+
+document.getElementById('forget-key').addEventListener('click', (e) => {
+  e.preventDefault();
+  localStorage.removeItem(KEY_STORAGE);
+  e.target.hidden = true;
+});
+document.getElementById('forget-key').hidden = !localStorage.getItem(KEY_STORAGE);
+
+fetch('/api/v1/version').then((r) => r.json()).then((info) => {
+  document.getElementById('server-version').textContent = 'srake ' + info.version;
+}).catch(() => {});
+
+window.addEventListener('hashchange', route);
+route();
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRequestBodySize bounds the JSON bodies read for validation
+const maxRequestBodySize = 16 << 20
+
+// fieldError explains why one parameter or body field was rejected
+type fieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// validateRequest checks a request against its route's declared query
+// parameters and body type before the handler runs. Unknown parameters,
+// values of the wrong type and bodies that do not decode into the body
+// type are rejected with a 400 listing each problem.
+func (s *Server) validateRequest(rt route, next http.HandlerFunc) http.HandlerFunc {
+	declared := make(map[string]queryParam, len(rt.Query))
+	for _, p := range rt.Query {
+		declared[p.Name] = p
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		problems := validateQuery(declared, r)
+
+		if rt.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize+1))
+			switch {
+			case err != nil:
+				problems = append(problems, fieldError{Field: "body", Reason: "could not be read"})
+			case len(body) > maxRequestBodySize:
+				problems = append(problems, fieldError{Field: "body", Reason: fmt.Sprintf("exceeds %d bytes", maxRequestBodySize)})
+			default:
+				problems = append(problems, validateBody(rt.Body, body)...)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if len(problems) > 0 {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{
+				Error:   true,
+				Message: "Invalid request",
+				Status:  http.StatusBadRequest,
+				Errors:  problems,
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validateQuery checks the query string against the declared parameters.
+// Empty values are left to the handler's defaults.
+func validateQuery(declared map[string]queryParam, r *http.Request) []fieldError {
+	query := r.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []fieldError
+	for _, name := range names {
+		p, ok := declared[name]
+		if !ok {
+			problems = append(problems, fieldError{Field: name, Reason: "unknown parameter"})
+			continue
+		}
+		for _, value := range query[name] {
+			if value == "" {
+				continue
+			}
+			if reason := checkParam(p, value); reason != "" {
+				problems = append(problems, fieldError{Field: name, Reason: reason})
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// checkParam returns why a value is invalid for a parameter, or ""
+func checkParam(p queryParam, value string) string {
+	switch p.Type {
+	case "integer":
+		if _, err := strconv.Atoi(value); err != nil {
+			return "must be an integer"
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "must be a number"
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "must be true or false"
+		}
+	}
+	return ""
+}
+
+// validateBody decodes a JSON body into a new value of the body's type,
+// rejecting unknown fields and values of the wrong type
+func validateBody(bodyType interface{}, body []byte) []fieldError {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return []fieldError{{Field: "body", Reason: "is required"}}
+	}
+
+	v := reflect.New(reflect.TypeOf(bodyType)).Interface()
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		return []fieldError{{Field: "body", Reason: "must contain a single JSON value"}}
+	}
+	if err == nil {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		return []fieldError{{Field: field, Reason: "must be " + jsonKind(typeErr.Type)}}
+	case errors.As(err, &syntaxErr):
+		return []fieldError{{Field: "body", Reason: fmt.Sprintf("is not valid JSON at offset %d", syntaxErr.Offset)}}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return []fieldError{{Field: "body", Reason: "is not valid JSON: unexpected end of input"}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return []fieldError{{Field: field, Reason: "unknown field"}}
+	}
+	return []fieldError{{Field: "body", Reason: err.Error()}}
+}
+
+// jsonKind names the JSON type a Go type decodes from
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.String()
+}
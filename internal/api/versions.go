@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiBase is the path prefix under which each version of the REST API is
+// served, as apiBase/<name>
+const apiBase = "/api"
+
+// HeaderAPIVersion names the version of the REST API that answered a
+// request
+const HeaderAPIVersion = "Srake-API-Version"
+
+// apiVersion is one version of the REST API. Versions are served side by
+// side, so that a response shape can change in a new version while clients
+// of the old one keep working until they move.
+type apiVersion struct {
+	Name    string  // path segment, such as v1
+	Release string  // version reported by the root endpoint and OpenAPI document
+	Routes  []route // endpoints, relative to the version's prefix
+
+	// Deprecated is when the version is superseded by the next one, which
+	// may be announced ahead; zero for the current version. Sunset, when set, is the date after which a
+	// deprecated version may be removed.
+	Deprecated time.Time
+	Sunset     time.Time
+}
+
+// prefix returns the path prefix of the version
+func (v *apiVersion) prefix() string {
+	return apiBase + "/" + v.Name
+}
+
+// apiVersions are the versions of the REST API, oldest first. The last is
+// current; the others are deprecated in favour of it. v1 is deprecated six
+// months after v2 was released with all of its endpoints, on both servers,
+// so that clients have time to move; its Deprecation header announces the
+// date until then.
+var apiVersions = []apiVersion{
+	{Name: "v1", Release: "1.0.0", Routes: apiRoutes,
+		Deprecated: time.Date(2027, time.April, 16, 0, 0, 0, 0, time.UTC)},
+	{Name: "v2", Release: "2.0.0", Routes: overrideRoutes(apiRoutes, v2Routes)},
+}
+
+// v2Routes are the endpoints whose request or response shape changed in
+// v2; the other endpoints of v1 are served unchanged
+var v2Routes = []route{
+	{Method: "GET", Path: "/studies", Handler: (*Server).handleListStudiesPage, OperationID: "listStudies",
+		Summary: "List studies", Tag: "records", Query: paginationParams, Response: studyPageResponse{}},
+}
+
+// overrideRoutes returns routes with those of the same method and path
+// replaced by overrides, keeping their order
+func overrideRoutes(routes, overrides []route) []route {
+	out := make([]route, len(routes))
+	copy(out, routes)
+	for _, o := range overrides {
+		replaced := false
+		for i := range out {
+			if out[i].Method == o.Method && out[i].Path == o.Path {
+				out[i], replaced = o, true
+			}
+		}
+		if !replaced {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// newAPIVersions returns apiVersions with the sunset dates of
+// server.api_sunset, which maps deprecated versions to dates as
+// YYYY-MM-DD
+func newAPIVersions(sunset map[string]string) ([]apiVersion, error) {
+	versions := make([]apiVersion, len(apiVersions))
+	copy(versions, apiVersions)
+	for name, date := range sunset {
+		v := findAPIVersion(versions, name)
+		if v == nil {
+			return nil, fmt.Errorf("server.api_sunset: unknown API version %q", name)
+		}
+		if v.Deprecated.IsZero() {
+			return nil, fmt.Errorf("server.api_sunset: %s is the current API version", name)
+		}
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, fmt.Errorf("server.api_sunset: invalid date %q for %s, expected YYYY-MM-DD", date, name)
+		}
+		if t.Before(v.Deprecated) {
+			return nil, fmt.Errorf("server.api_sunset: %s is deprecated from %s, after its sunset date %s", name, v.Deprecated.Format("2006-01-02"), date)
+		}
+		v.Sunset = t
+	}
+	return versions, nil
+}
+
+// findAPIVersion returns the version of versions with name, or nil
+func findAPIVersion(versions []apiVersion, name string) *apiVersion {
+	for i := range versions {
+		if versions[i].Name == name {
+			return &versions[i]
+		}
+	}
+	return nil
+}
+
+// servedVersions returns the versions of the REST API the server serves
+func (s *Server) servedVersions() []apiVersion {
+	if s.versions == nil {
+		return apiVersions
+	}
+	return s.versions
+}
+
+// versionMiddleware names the version that answers each request in
+// HeaderAPIVersion. Responses of a deprecated version also carry a
+// Deprecation header (RFC 9745), a Sunset header (RFC 8594) once a sunset
+// date is set, and a Link to the same endpoint in the current version.
+func versionMiddleware(v *apiVersion, current *apiVersion) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set(HeaderAPIVersion, v.Name)
+			if !v.Deprecated.IsZero() {
+				h.Set("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+				if !v.Sunset.IsZero() {
+					h.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+				}
+				successor := current.prefix() + strings.TrimPrefix(r.URL.Path, v.prefix())
+				h.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// versionInfo describes an API version in the root endpoint
+type versionInfo struct {
+	Name       string `json:"name"`
+	Release    string `json:"release"`
+	Prefix     string `json:"prefix"`
+	Status     string `json:"status"` // current or deprecated
+	Deprecated string `json:"deprecated,omitempty"`
+	Sunset     string `json:"sunset,omitempty"`
+}
+
+// describeVersions lists versions for the root endpoint
+func describeVersions(versions []apiVersion) []versionInfo {
+	var infos []versionInfo
+	for i := range versions {
+		v := &versions[i]
+		info := versionInfo{Name: v.Name, Release: v.Release, Prefix: v.prefix(), Status: "current"}
+		if !v.Deprecated.IsZero() {
+			info.Status = "deprecated"
+			info.Deprecated = v.Deprecated.Format("2006-01-02")
+		}
+		if !v.Sunset.IsZero() {
+			info.Sunset = v.Sunset.Format("2006-01-02")
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+)
+
+// readiness reports at /readyz whether a server has warmed up, so that
+// load balancers send it traffic only once its first searches are fast
+type readiness struct {
+	ready atomic.Bool
+
+	// stale, when set, reports why a replica has fallen too far behind
+	// its primary to take traffic
+	stale func() error
+}
+
+// readyResponse is the body of /readyz
+type readyResponse struct {
+	Status string `json:"status"` // ready, warming_up or stale
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleReady answers 200 once the server has warmed up and 503 before,
+// or while it is stale
+func (r *readiness) handleReady(w http.ResponseWriter, req *http.Request) {
+	resp, status := readyResponse{Status: "ready"}, http.StatusOK
+	if !r.ready.Load() {
+		resp, status = readyResponse{Status: "warming_up"}, http.StatusServiceUnavailable
+	} else if r.stale != nil {
+		if err := r.stale(); err != nil {
+			resp, status = readyResponse{Status: "stale", Reason: err.Error()}, http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// warmer loads what the first requests after a start would otherwise
+// wait for
+type warmer struct {
+	db     *database.DB
+	index  func() error // opens a lazily opened search index and its caches
+	search func(ctx context.Context, query string) error
+}
+
+// run warms up as cfg sets, then marks the server ready. Warming up stops
+// at the timeout of cfg, and steps that fail are only logged: the server
+// serves either way, its first requests slower.
+func (wu warmer) run(ctx context.Context, cfg config.WarmupConfig, r *readiness) {
+	defer r.ready.Store(true)
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wu.warm(ctx, cfg.Queries)
+	}()
+	select {
+	case <-done:
+		log.Printf("[WARMUP] Warmed up in %v", time.Since(start))
+	case <-ctx.Done():
+		log.Printf("[WARMUP] Warning: stopped warming up after %v: %v", time.Since(start), ctx.Err())
+	}
+}
+
+// warm opens the search index, reads the key database indexes into the
+// page cache and runs each query once
+func (wu warmer) warm(ctx context.Context, queries []string) {
+	step := time.Now()
+	if err := wu.index(); err != nil {
+		log.Printf("[WARMUP] Warning: failed to open search index: %v", err)
+	} else {
+		log.Printf("[WARMUP] Search index opened in %v", time.Since(step))
+	}
+
+	step = time.Now()
+	if err := wu.db.WarmCache(ctx); err != nil {
+		log.Printf("[WARMUP] Warning: %v", err)
+	} else {
+		log.Printf("[WARMUP] Database indexes read in %v", time.Since(step))
+	}
+
+	for _, query := range queries {
+		if ctx.Err() != nil {
+			return
+		}
+		step = time.Now()
+		if err := wu.search(ctx, query); err != nil {
+			log.Printf("[WARMUP] Warning: search for %q failed: %v", query, err)
+			continue
+		}
+		log.Printf("[WARMUP] Searched %q in %v", query, time.Since(step))
+	}
+}
@@ -24,6 +24,8 @@ func SetupGroupedHelp(cmd *cobra.Command) {
 		// Now print grouped flags
 		fmt.Println("\nFlags:")
 		printFlagGroup(cmd, "FILTER OPTIONS", []string{
+			"template",
+			"param",
 			"organism", "o",
 			"platform",
 			"library-strategy",
@@ -2,31 +2,61 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"runtime"
 	"strings"
 	"syscall"
 	"text/tabwriter"
 	"time"
 
+	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
 	"github.com/nishad/srake/internal/downloader"
+	srerrors "github.com/nishad/srake/internal/errors"
+	"github.com/nishad/srake/internal/filelock"
+	"github.com/nishad/srake/internal/i18n"
 	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/plan"
 	"github.com/nishad/srake/internal/processor"
 	"github.com/spf13/cobra"
 )
 
 var (
 	// Ingest flags
-	ingestAuto       bool
-	ingestDaily      bool
-	ingestMonthly    bool
-	ingestFile       string
-	ingestList       bool
-	ingestDBPath     string
-	ingestForce      bool
-	ingestNoProgress bool
+	ingestAuto           bool
+	ingestDaily          bool
+	ingestMonthly        bool
+	ingestFile           string
+	ingestList           bool
+	ingestDBPath         string
+	ingestForce          bool
+	ingestNoProgress     bool
+	ingestStoreRaw       bool
+	ingestValidate       bool
+	ingestValidateSchema bool
+	ingestSource         string
+	ingestIncremental    bool
+	ingestSince          string
+	ingestEntrez         bool
+	ingestWatch          time.Duration
+	ingestWait           bool
+	ingestConnections    int
+	ingestDryRun         bool
+	ingestPlanFormat     string
+	ingestMetricsAddr    string
+	ingestPushgateway    string
+	ingestNice           int
+	ingestWorkers        int
+	ingestBulk           bool
+	ingestMaxLatency     time.Duration
+	ingestTransforms     string
+
+	// transforms loaded from ingestTransforms or the config
+	ingestTransformRules *processor.Transforms
 
 	// Filter flags
 	filterTaxonIDs      []int
@@ -43,15 +73,18 @@ var (
 	filterStatsOnly     bool
 	filterVerbose       bool
 	filterProfile       string
+	filterExpr          string
 	skipStats           bool // Skip updating database statistics
+	ingestOptimize      bool // Analyze, and vacuum if needed, after ingesting
 )
 
 // NewIngestCmd creates the ingest command
 func NewIngestCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "ingest",
-		Short: "Ingest SRA metadata from NCBI or local archives",
-		Long: `Ingest SRA metadata from NCBI FTP servers or local tar.gz archives.
+		Short: "Ingest SRA metadata from NCBI, ENA, DDBJ, or local archives",
+		Long: `Ingest SRA metadata from the NCBI FTP servers, the ENA or DDBJ mirrors,
+or local tar.gz archives.
 
 This command streams tar.gz files directly without extracting to disk,
 processes them on-the-fly, and inserts records into the database.
@@ -67,6 +100,12 @@ Examples:
   # Ingest the latest monthly full dataset
   srake ingest --monthly
 
+  # Apply the daily updates published since the last ingest
+  srake ingest --incremental
+
+  # Apply the records NCBI modified since the last sync, polling hourly
+  srake ingest --entrez --watch 1h
+
   # List available files on NCBI
   srake ingest --list
 
@@ -74,19 +113,97 @@ Examples:
   srake ingest --file NCBI_SRA_Metadata_20250915.tar.gz
 
   # Ingest a local archive file
-  srake ingest --file /path/to/archive.tar.gz`,
+  srake ingest --file /path/to/archive.tar.gz
+
+  # Keep human RNA-Seq and ATAC-seq with over a gigabase per run
+  srake ingest --auto --filter-expr 'taxon_id == 9606 && strategy in ["RNA-Seq", "ATAC-seq"] && total_bases > 1e9'
+
+  # Download the monthly dataset over 8 connections, then ingest it
+  srake ingest --monthly --connections 8
+
+  # Load the monthly dataset into a new database, indexing it at the end
+  srake ingest --monthly --bulk --db /data/srake.db
+
+  # Auto-select and ingest the best file from the ENA mirror
+  srake ingest --auto --source ena
+
+  # Ingest an ENA or DDBJ XML dump (gzipped or plain)
+  srake ingest --file ena_study.xml.gz --source ena
+
+  # Quarantine records that fail validation instead of inserting them
+  srake ingest --file /path/to/archive.tar.gz --validate
+
+Estimates:
+  Before an archive is ingested, the records it holds, the disk space the
+  database and search index will take and the time it takes are estimated
+  from the ingests before it, and the ingest asks to start. --yes skips
+  the question, as does running without a terminal, unless the estimate
+  does not fit in the free space of the volume.
+
+Validation:
+  --validate checks each study, experiment, sample and run with the
+  checks of 'srake validate' before inserting it, and --validate-schema
+  against the bundled SRA XSDs. Records with errors are not inserted but
+  quarantined with their original XML and errors, and the ingest ends
+  with a count of them by error type. 'srake quarantine' lists them.
+
+Runtime controls:
+  A running ingest prints a status snapshot on SIGUSR1 and toggles pause
+  on SIGUSR2 (not on Windows). From another terminal, 'srake ingest
+  status', 'srake ingest pause', and 'srake ingest resume' do the same
+  over a control socket.
+  Pausing checkpoints the database and idles the download.
+
+  An ingest locks the database (through <db>.lock) so that a second ingest
+  or index build cannot write it at the same time. It fails with the PID of
+  the process holding the lock, or waits for it with --wait.
+
+Metrics:
+  --metrics-addr serves Prometheus metrics of the ingest (records and bytes
+  processed, and their rates) at /metrics while it runs; --pushgateway
+  pushes them to a Pushgateway every 15 seconds and when it ends.
+
+Throttling:
+  When the server answers queries from the database being ingested,
+  --nice slows the ingest down by a fixed level, and --max-query-latency
+  adapts the level to the latency of queries, measured every 2 seconds.
+
+Entrez:
+  --entrez finds the SRA records NCBI modified since the last sync, or
+  since the last metadata file ingested, through E-utilities and applies
+  them, for fresher records than the daily updates. Entrez dates
+  modifications to the day, so each poll fetches those of the last day
+  synced again. Set NCBI_API_KEY to raise NCBI's rate limit.`,
 		RunE: runIngest,
 	}
 
 	// Add basic flags
-	cmd.Flags().BoolVar(&ingestAuto, "auto", false, "Auto-select the best file to ingest from NCBI")
-	cmd.Flags().BoolVar(&ingestDaily, "daily", false, "Ingest the latest daily update from NCBI")
-	cmd.Flags().BoolVar(&ingestMonthly, "monthly", false, "Ingest the latest monthly full dataset from NCBI")
-	cmd.Flags().StringVar(&ingestFile, "file", "", "Ingest a specific file (local path or NCBI filename)")
-	cmd.Flags().BoolVar(&ingestList, "list", false, "List available files on NCBI without ingesting")
+	cmd.Flags().BoolVar(&ingestAuto, "auto", false, "Auto-select the best file to ingest from the mirror")
+	cmd.Flags().BoolVar(&ingestDaily, "daily", false, "Ingest the latest daily update from the mirror")
+	cmd.Flags().BoolVar(&ingestMonthly, "monthly", false, "Ingest the latest monthly full dataset from the mirror")
+	cmd.Flags().StringVar(&ingestFile, "file", "", "Ingest a specific file (local path or mirror filename)")
+	cmd.Flags().BoolVar(&ingestList, "list", false, "List available files on the mirror without ingesting")
 	cmd.Flags().StringVar(&ingestDBPath, "db", "", "Database path (defaults to ~/.local/share/srake/srake.db)")
 	cmd.Flags().BoolVar(&ingestForce, "force", false, "Force ingestion even if data exists")
+	cmd.Flags().BoolP("yes", "y", false, "Start without asking for confirmation, even when the ingest is estimated not to fit on disk")
 	cmd.Flags().BoolVar(&ingestNoProgress, "no-progress", false, "Disable progress bar")
+	cmd.Flags().StringVar(&ingestSource, "source", "", "Archive to download from (ncbi, ena, or ddbj; default ncbi), or of a local file (detected from the file name by default)")
+	cmd.Flags().BoolVar(&ingestStoreRaw, "store-raw", false, "Also store the original XML of each record (see 'srake raw')")
+	cmd.Flags().BoolVar(&ingestValidate, "validate", false, "Validate each record, quarantining those with errors instead of inserting them (see 'srake quarantine')")
+	cmd.Flags().BoolVar(&ingestValidateSchema, "validate-schema", false, "Validate each record against the bundled SRA XSDs; implies --validate")
+	cmd.Flags().StringVar(&ingestTransforms, "transforms", "", "Rewrite the attributes of records from the centers in this YAML file (default: transforms in the config)")
+	cmd.Flags().BoolVar(&ingestIncremental, "incremental", false, "Apply the daily updates published since the last metadata file ingested, oldest first")
+	cmd.Flags().StringVar(&ingestSince, "since", "", "With --incremental, apply daily updates published after this date; with --entrez, records modified from this date (YYYY-MM-DD)")
+	cmd.Flags().BoolVar(&ingestEntrez, "entrez", false, "Apply the SRA records NCBI modified since the last sync, found and fetched through E-utilities")
+	cmd.Flags().DurationVar(&ingestWatch, "watch", 0, "With --entrez, keep polling at this interval, e.g. 1h")
+	cmd.Flags().BoolVar(&ingestWait, "wait", false, "Wait for another process writing the database to finish instead of failing")
+	cmd.Flags().IntVar(&ingestConnections, "connections", 1, "Download the archive over this many parallel connections before ingesting it, resuming an interrupted download")
+	cmd.Flags().StringVar(&ingestMetricsAddr, "metrics-addr", "", "Serve Prometheus metrics of the ingest at this address, e.g. :9101")
+	cmd.Flags().StringVar(&ingestPushgateway, "pushgateway", "", "Push Prometheus metrics of the ingest to this Pushgateway URL while it runs")
+	cmd.Flags().IntVar(&ingestNice, "nice", 0, "Slow the ingest down to leave the database to queries: at level n (0-10) it rests n times as long as it works")
+	cmd.Flags().IntVar(&ingestWorkers, "workers", runtime.NumCPU(), "Decode this many XML files of the archive in parallel, writing their records in archive order")
+	cmd.Flags().BoolVar(&ingestBulk, "bulk", false, "Stage records in bulk and build the secondary indexes once at the end, for full loads")
+	cmd.Flags().DurationVar(&ingestMaxLatency, "max-query-latency", 0, "Slow the ingest down while queries on the database take longer than this, e.g. 100ms")
 
 	// Add filter flags
 	cmd.Flags().IntSliceVar(&filterTaxonIDs, "taxon-ids", nil, "Filter by taxonomy IDs (comma-separated, e.g., 9606,10090)")
@@ -103,10 +220,16 @@ Examples:
 	cmd.Flags().BoolVar(&filterStatsOnly, "stats-only", false, "Only show statistics without inserting data")
 	cmd.Flags().BoolVar(&filterVerbose, "filter-verbose", false, "Show detailed filtering information")
 	cmd.Flags().StringVar(&filterProfile, "filter-profile", "", "Load filter settings from YAML profile")
+	cmd.Flags().StringVar(&filterExpr, "filter-expr", "", "Keep records matching a CEL expression, e.g. 'taxon_id == 9606 && total_bases > 1e9'")
 	cmd.Flags().BoolVar(&skipStats, "skip-stats", false, "Skip updating database statistics after ingestion")
+	cmd.Flags().BoolVar(&ingestOptimize, "optimize", false, "After ingesting, analyze the database, and vacuum it when over 10% of it is free space")
+	cmd.Flags().BoolVar(&ingestDryRun, "dry-run", false, "Print the plan of the ingest (sources, sizes, tables and steps) without running it")
+	cmd.Flags().StringVar(&ingestPlanFormat, "plan-format", plan.FormatJSON, "Format of the --dry-run plan (json|yaml|text)")
 
 	// Mark mutually exclusive flags
-	cmd.MarkFlagsMutuallyExclusive("auto", "daily", "monthly", "file", "list")
+	cmd.MarkFlagsMutuallyExclusive("auto", "daily", "monthly", "file", "list", "incremental", "entrez")
+
+	cmd.AddCommand(newIngestControlCmds()...)
 
 	return cmd
 }
@@ -132,21 +255,101 @@ func runIngest(cmd *cobra.Command, args []string) error {
 		cancel()
 	}()
 
-	// Initialize metadata manager for NCBI operations
-	manager := downloader.NewMetadataManager()
+	source, err := processor.ParseSource(ingestSource)
+	if err != nil {
+		return err
+	}
+	ingestSource = source
+	if ingestNice < 0 || ingestNice > processor.MaxThrottleLevel {
+		return fmt.Errorf("--nice must be between 0 and %d", processor.MaxThrottleLevel)
+	}
+	if ingestWorkers < 1 {
+		return fmt.Errorf("--workers must be at least 1")
+	}
+	if ingestBulk && (ingestIncremental || ingestEntrez) {
+		return fmt.Errorf("--bulk is for full loads, not --incremental or --entrez")
+	}
+	if ingestTransformRules, err = loadIngestTransforms(); err != nil {
+		return err
+	}
+
+	// A dry run only reads, so it takes no lock and reports no metrics
+	var planOut io.Writer
+	if ingestDryRun {
+		if !plan.ValidFormat(ingestPlanFormat) {
+			return fmt.Errorf("invalid plan format: %s (must be json, yaml or text)", ingestPlanFormat)
+		}
+		out, restore := startDryRun()
+		defer restore()
+		planOut = out
+	}
+
+	// Keep other ingests and index builds from writing the database at once
+	// Entrez polls take the lock themselves, so a watch leaves the
+	// database to other ingests between polls
+	if !ingestList && !ingestDryRun && !ingestEntrez {
+		lock, err := lockDatabase(ctx, ingestDBPath)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	// Report throughput to Prometheus during long ingests
+	if !ingestList && !ingestDryRun && (ingestMetricsAddr != "" || ingestPushgateway != "") {
+		stop, err := startIngestMetrics(ingestMetricsAddr, ingestPushgateway)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	// Local files are ingested without listing a mirror
+	if ingestFile != "" {
+		if _, err := os.Stat(ingestFile); err == nil {
+			if ingestDryRun {
+				p, err := planLocalIngest(ingestFile)
+				if err != nil {
+					return err
+				}
+				return p.Write(planOut, ingestPlanFormat)
+			}
+			return ingestLocalFile(ctx, ingestFile, ingestDBPath, ingestForce, ingestNoProgress, yes)
+		}
+	}
+
+	if ingestEntrez {
+		return runEntrezIngest(ctx, planOut)
+	}
+	if ingestWatch > 0 {
+		return fmt.Errorf("--watch requires --entrez")
+	}
+
+	// Initialize metadata manager for the selected mirror
+	manager, err := newMetadataManager(remoteSource())
+	if err != nil {
+		return err
+	}
+	mirror := strings.ToUpper(manager.Source().Name)
 
 	// List files if requested
 	if ingestList {
 		return listAvailableFiles(ctx, manager)
 	}
 
+	if ingestIncremental {
+		return runIncrementalIngest(ctx, manager, planOut)
+	}
+	if ingestSince != "" {
+		return fmt.Errorf("--since requires --incremental or --entrez")
+	}
+
 	// Select file to ingest
 	var targetFile *downloader.MetadataFile
-	var err error
 
 	switch {
 	case ingestAuto:
-		fmt.Println("🔍 Auto-selecting best file from NCBI...")
+		fmt.Printf("🔍 Auto-selecting best file from %s...\n", mirror)
 		targetFile, err = manager.AutoSelectFile(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to auto-select file: %w", err)
@@ -167,22 +370,16 @@ func runIngest(cmd *cobra.Command, args []string) error {
 		}
 
 	case ingestFile != "":
-		// Check if it's a local file first
-		if _, err := os.Stat(ingestFile); err == nil {
-			// Local file exists, ingest it directly
-			return ingestLocalFile(ctx, ingestFile, ingestDBPath, ingestForce, ingestNoProgress, yes)
-		}
-
-		// Not a local file, try to find it on NCBI
-		fmt.Printf("🔍 Looking for file on NCBI: %s\n", ingestFile)
+		// Not a local file, try to find it on the mirror
+		fmt.Printf("🔍 Looking for file on %s: %s\n", mirror, ingestFile)
 		targetFile, err = manager.GetFileByName(ctx, ingestFile)
 		if err != nil {
-			return fmt.Errorf("file not found on NCBI: %w", err)
+			return fmt.Errorf("file not found on %s: %w", mirror, err)
 		}
 
 	default:
 		// Default to auto-select
-		fmt.Println("🔍 No option specified, auto-selecting from NCBI...")
+		fmt.Printf("🔍 No option specified, auto-selecting from %s...\n", mirror)
 		targetFile, err = manager.AutoSelectFile(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to auto-select file: %w", err)
@@ -197,24 +394,38 @@ func runIngest(cmd *cobra.Command, args []string) error {
 	fmt.Printf("   Date: %s\n", targetFile.Date.Format("2006-01-02"))
 	fmt.Printf("   URL:  %s\n", targetFile.URL)
 
+	if ingestDryRun {
+		db, err := openPlanDatabase(ingestDBPath)
+		if err != nil {
+			return err
+		}
+		if db != nil {
+			defer db.Close()
+		}
+		p := newIngestPlan(db, ingestDBPath)
+		if err := planIngestFiles(p, db, []downloader.MetadataFile{*targetFile}, ingestConnections > 1, false); err != nil {
+			return err
+		}
+		return p.Write(planOut, ingestPlanFormat)
+	}
+
 	// Initialize database
 	fmt.Printf("\n🗄️  Initializing database at %s...\n", ingestDBPath)
-	db, err := database.Initialize(ingestDBPath)
+	started := time.Now()
+	db, err := openIngestDatabase(ingestDBPath)
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer db.Close()
 
 	// Check if database already has data (unless forced)
+	confirmed := false
 	if !ingestForce {
-		stats, _ := db.GetStats()
+		stats := databaseCounts(db)
 		if stats.TotalExperiments > 0 || stats.TotalStudies > 0 {
-			fmt.Printf("\n⚠️  Database already contains data:\n")
-			fmt.Printf("   Studies:     %d\n", stats.TotalStudies)
-			fmt.Printf("   Experiments: %d\n", stats.TotalExperiments)
-			fmt.Printf("   Samples:     %d\n", stats.TotalSamples)
-			fmt.Printf("   Runs:        %d\n", stats.TotalRuns)
-			fmt.Printf("\nUse --force to overwrite existing data\n")
+			fmt.Printf("\n⚠️  %s\n", i18n.T("ingest.db_has_data"))
+			printDatabaseCounts(stats)
+			fmt.Printf("\n%s\n", i18n.T("ingest.use_force"))
 
 			// Ask for confirmation (unless --yes flag is set)
 			if !yes {
@@ -222,15 +433,48 @@ func runIngest(cmd *cobra.Command, args []string) error {
 				var response string
 				fmt.Scanln(&response)
 				if strings.ToLower(response) != "y" {
-					fmt.Println("Ingestion cancelled")
+					fmt.Println(i18n.T("ingest.cancelled"))
 					return nil
 				}
+				confirmed = true
 			} else {
 				fmt.Println("\n--yes flag set, continuing without confirmation")
 			}
 		}
 	}
 
+	// Estimate the records, disk space and time the ingest takes
+	proceed, err := confirmIngestEstimate(db, ingestDBPath, targetFile.Size, yes, confirmed)
+	if err != nil {
+		return err
+	}
+	if !proceed {
+		fmt.Println(i18n.T("ingest.cancelled"))
+		return nil
+	}
+	dbBytesBefore := databaseBytes(db)
+
+	// With --connections, download the archive in parallel ranges first and
+	// ingest the local copy
+	input := targetFile.URL
+	if ingestConnections > 1 {
+		input, err = downloadArchive(ctx, targetFile)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n❌ " + i18n.T("ingest.cancelled_by_user"))
+				return nil
+			}
+			printIngestHint(err)
+			return fmt.Errorf("download failed: %w", err)
+		}
+	}
+
+	bulk, err := beginBulkIngest(db)
+	if err != nil {
+		return err
+	}
+	defer bulk.finish()
+
 	// Check if filters are specified and create appropriate processor
 	if hasFilters() {
 		filterOpts, err := buildFilterOptions()
@@ -247,6 +491,13 @@ func runIngest(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return fmt.Errorf("failed to create filtered processor: %w", err)
 		}
+		filteredProcessor.SetStoreRaw(ingestStoreRaw)
+		filteredProcessor.SetValidator(ingestValidator())
+		filteredProcessor.SetTransforms(ingestTransformRules)
+		filteredProcessor.SetWorkers(ingestWorkers)
+		filteredProcessor.SetSource(remoteSource())
+		defer attachIngestControls(filteredProcessor.StreamProcessor, db)()
+		defer trackIngestMetrics(filteredProcessor.StreamProcessor)()
 
 		// Set up progress reporting if not disabled
 		if !ingestNoProgress {
@@ -258,34 +509,46 @@ func runIngest(cmd *cobra.Command, args []string) error {
 		}
 
 		// Start ingestion
-		fmt.Printf("\n🚀 Starting filtered ingestion...\n")
-		fmt.Println("   This may take a while for large files.")
-		fmt.Println("   Press Ctrl+C to cancel.")
+		fmt.Printf("\n🚀 %s\n", i18n.T("ingest.starting_filtered"))
+		fmt.Println("   " + i18n.T("ingest.may_take_a_while"))
+		fmt.Println("   " + i18n.T("ingest.press_ctrl_c"))
 
 		startTime := time.Now()
 
 		// Process the URL with filters
-		err = filteredProcessor.ProcessWithFilters(ctx, targetFile.URL)
+		err = ingestWithRetry(ctx, func() error {
+			return filteredProcessor.ProcessWithFilters(ctx, input)
+		})
 
 		if err != nil {
 			if err == context.Canceled {
-				fmt.Println("\n❌ Ingestion cancelled by user")
+				fmt.Println("\n❌ " + i18n.T("ingest.cancelled_by_user"))
 				return nil
 			}
+			printIngestHint(err)
 			return fmt.Errorf("ingestion failed: %w", err)
 		}
 
+		if err := bulk.finish(); err != nil {
+			return err
+		}
+
 		// Display final statistics
 		elapsed := time.Since(startTime)
 		stats := filteredProcessor.StreamProcessor.GetStats()
 
-		fmt.Printf("\n✅ Ingestion completed successfully!\n\n")
-		fmt.Printf("📊 Statistics:\n")
-		fmt.Printf("   Time elapsed:      %s\n", downloader.FormatDuration(elapsed))
-		fmt.Printf("   Records processed: %v\n", stats["records_processed"])
-		fmt.Printf("   Bytes processed:   %s\n", downloader.FormatSize(stats["bytes_processed"].(int64)))
-		fmt.Printf("   Speed:             %.2f MB/s\n", stats["bytes_per_second"].(float64)/(1024*1024))
-		fmt.Printf("   Records/second:    %.0f\n", stats["records_per_second"])
+		fmt.Printf("\n✅ %s\n\n", i18n.T("ingest.completed"))
+		fmt.Printf("📊 %s\n", i18n.T("summary.statistics"))
+		printStat("summary.time_elapsed", 18, downloader.FormatDuration(elapsed))
+		printStat("summary.records_processed", 18, stats["records_processed"])
+		printStat("summary.bytes_processed", 18, downloader.FormatSize(stats["bytes_processed"].(int64)))
+		printStat("summary.speed", 18, fmt.Sprintf("%.2f MB/s", stats["bytes_per_second"].(float64)/(1024*1024)))
+		printStat("summary.records_per_second", 18, fmt.Sprintf("%.0f", stats["records_per_second"]))
+		bulk.printPhases()
+
+		if !filterStatsOnly {
+			recordAppliedFile(db, targetFile, stats["records_processed"].(int64))
+		}
 
 		// Display filter statistics if available
 		filterStats := filteredProcessor.GetStats()
@@ -296,16 +559,26 @@ func runIngest(cmd *cobra.Command, args []string) error {
 
 		// Update database statistics after successful ingestion
 		if !skipStats {
-			fmt.Printf("\n📈 Updating database statistics...")
+			fmt.Printf("\n📈 %s", i18n.T("ingest.updating_stats"))
 			if err := db.UpdateStatistics(); err != nil {
-				fmt.Printf(" ⚠️ Warning: Failed to update statistics: %v\n", err)
+				fmt.Printf(" ⚠️ %s\n", i18n.T("ingest.stats_failed", err))
 			} else {
 				fmt.Printf(" ✓\n")
 			}
 		}
+		if ingestOptimize {
+			optimizeDatabase(ctx, db)
+		}
 	} else {
 		// No filters, use standard processor
 		streamProcessor := processor.NewStreamProcessor(db)
+		streamProcessor.SetStoreRaw(ingestStoreRaw)
+		streamProcessor.SetValidator(ingestValidator())
+		streamProcessor.SetTransforms(ingestTransformRules)
+		streamProcessor.SetWorkers(ingestWorkers)
+		streamProcessor.SetSource(remoteSource())
+		defer attachIngestControls(streamProcessor, db)()
+		defer trackIngestMetrics(streamProcessor)()
 
 		// Set up progress reporting if not disabled
 		if !ingestNoProgress {
@@ -317,50 +590,191 @@ func runIngest(cmd *cobra.Command, args []string) error {
 		}
 
 		// Start ingestion
-		fmt.Printf("\n🚀 Starting ingestion...\n")
-		fmt.Println("   This may take a while for large files.")
-		fmt.Println("   Press Ctrl+C to cancel.")
+		fmt.Printf("\n🚀 %s\n", i18n.T("ingest.starting"))
+		fmt.Println("   " + i18n.T("ingest.may_take_a_while"))
+		fmt.Println("   " + i18n.T("ingest.press_ctrl_c"))
 
 		startTime := time.Now()
 
-		// Process the URL
-		err = streamProcessor.ProcessURL(ctx, targetFile.URL)
+		// Process the URL, or the downloaded copy
+		err = ingestWithRetry(ctx, func() error {
+			if input != targetFile.URL {
+				return streamProcessor.ProcessFile(ctx, input)
+			}
+			return streamProcessor.ProcessURL(ctx, targetFile.URL)
+		})
 
 		if err != nil {
 			if err == context.Canceled {
-				fmt.Println("\n❌ Ingestion cancelled by user")
+				fmt.Println("\n❌ " + i18n.T("ingest.cancelled_by_user"))
 				return nil
 			}
+			printIngestHint(err)
 			return fmt.Errorf("ingestion failed: %w", err)
 		}
 
+		if err := bulk.finish(); err != nil {
+			return err
+		}
+
 		// Display final statistics
 		elapsed := time.Since(startTime)
 		stats := streamProcessor.GetStats()
 
-		fmt.Printf("\n✅ Ingestion completed successfully!\n\n")
-		fmt.Printf("📊 Statistics:\n")
-		fmt.Printf("   Time elapsed:      %s\n", downloader.FormatDuration(elapsed))
-		fmt.Printf("   Records processed: %v\n", stats["records_processed"])
-		fmt.Printf("   Bytes processed:   %s\n", downloader.FormatSize(stats["bytes_processed"].(int64)))
-		fmt.Printf("   Speed:             %.2f MB/s\n", stats["bytes_per_second"].(float64)/(1024*1024))
-		fmt.Printf("   Records/second:    %.0f\n", stats["records_per_second"])
+		fmt.Printf("\n✅ %s\n\n", i18n.T("ingest.completed"))
+		fmt.Printf("📊 %s\n", i18n.T("summary.statistics"))
+		printStat("summary.time_elapsed", 18, downloader.FormatDuration(elapsed))
+		printStat("summary.records_processed", 18, stats["records_processed"])
+		printStat("summary.bytes_processed", 18, downloader.FormatSize(stats["bytes_processed"].(int64)))
+		printStat("summary.speed", 18, fmt.Sprintf("%.2f MB/s", stats["bytes_per_second"].(float64)/(1024*1024)))
+		printStat("summary.records_per_second", 18, fmt.Sprintf("%.0f", stats["records_per_second"]))
+		bulk.printPhases()
+
+		recordAppliedFile(db, targetFile, stats["records_processed"].(int64))
+		measureIngest(db, streamProcessor, targetFile.Size, dbBytesBefore, elapsed)
+	}
+
+	// The downloaded copy is not needed once ingested
+	if input != targetFile.URL {
+		os.Remove(input)
 	}
 
 	// Get database statistics
-	dbStats, _ := db.GetStats()
-	fmt.Printf("\n📚 Database totals:\n")
-	fmt.Printf("   Studies:     %d\n", dbStats.TotalStudies)
-	fmt.Printf("   Experiments: %d\n", dbStats.TotalExperiments)
-	fmt.Printf("   Samples:     %d\n", dbStats.TotalSamples)
-	fmt.Printf("   Runs:        %d\n", dbStats.TotalRuns)
+	dbStats := databaseCounts(db)
+	fmt.Printf("\n📚 %s\n", i18n.T("summary.database_totals"))
+	printDatabaseCounts(dbStats)
+	reportExpectations(db)
+	reportQuarantine(db, started)
 
 	return nil
 }
 
-// listAvailableFiles lists available files from NCBI
+// remoteSource returns the archive whose mirror --source selects, NCBI by
+// default. Records ingested from a mirror are tagged with its archive.
+func remoteSource() string {
+	if ingestSource == "" {
+		return processor.SourceNCBI
+	}
+	return ingestSource
+}
+
+// newMetadataManager creates a metadata manager for an archive's mirror,
+// applying the mirrors section of the configuration
+func newMetadataManager(source string) (*downloader.MetadataManager, error) {
+	mirrors := config.DefaultConfig().Mirrors
+	if cfg, _, err := config.LoadLayered(); err == nil {
+		mirrors = cfg.Mirrors
+	}
+	src, err := downloader.MetadataSourceFromConfig(source, mirrors)
+	if err != nil {
+		return nil, err
+	}
+	return downloader.NewMetadataManagerForSource(src), nil
+}
+
+// lockDatabase takes the ingest lock on the database at dbPath, waiting for
+// it with --wait
+func lockDatabase(ctx context.Context, dbPath string) (*filelock.Lock, error) {
+	lock, err := filelock.Acquire(ctx, dbPath, filelock.Options{
+		Command: "srake ingest",
+		Wait:    ingestWait,
+		OnWait: func(err *filelock.LockedError) {
+			fmt.Printf("⏳ %s\n", i18n.T("ingest.lock_waiting", err))
+		},
+	})
+	var locked *filelock.LockedError
+	if errors.As(err, &locked) {
+		return nil, fmt.Errorf("%w\n%s", err, i18n.T("ingest.lock_hint"))
+	}
+	return lock, err
+}
+
+// openIngestDatabase opens the database at dbPath to ingest into. Ingests
+// write, so on a replicated database they run only on the primary.
+func openIngestDatabase(dbPath string) (*database.DB, error) {
+	var opts database.OpenOptions
+	if cfg, _, err := config.LoadLayered(); err == nil {
+		opts = database.OpenOptions{Mode: cfg.Database.Mode, Replication: cfg.Database.Replication}
+	}
+	if opts.Mode == database.ModeReplica {
+		return nil, errors.New("this node serves a read-only replica (database.mode: replica); run ingests on the primary")
+	}
+	return database.Open(dbPath, opts)
+}
+
+// ingestWithRetry runs an ingest from a mirror, retrying each kind of failure
+// according to the retry section of the configuration. The archive is
+// streamed again from the start on each attempt.
+func ingestWithRetry(ctx context.Context, ingest func() error) error {
+	return srerrors.Retry(ctx, ingestRetryPolicies(), ingest, printIngestRetry)
+}
+
+// ingestRetryPolicies returns the retry section of the configuration
+func ingestRetryPolicies() srerrors.Policies {
+	if cfg, _, err := config.LoadLayered(); err == nil {
+		return srerrors.PoliciesFromConfig(cfg.Retry)
+	}
+	return srerrors.DefaultPolicies()
+}
+
+// printIngestRetry reports a failure that is about to be retried
+func printIngestRetry(err error, kind srerrors.Kind, attempt int, policy srerrors.Policy, wait time.Duration) {
+	fmt.Printf("\n⚠️  %s\n", i18n.T("ingest.interrupted", kind, err))
+	fmt.Printf("   %s\n", i18n.T("ingest.retrying", downloader.FormatDuration(wait), attempt, policy.MaxAttempts))
+}
+
+// downloadArchive downloads a metadata archive to the downloads directory
+// over --connections parallel ranges and returns its path. A download
+// interrupted by an earlier run is resumed.
+func downloadArchive(ctx context.Context, file *downloader.MetadataFile) (string, error) {
+	fetcher := downloader.NewFetcher(paths.GetDownloadsPath())
+	fetcher.Segments = ingestConnections
+	fetcher.RetryPolicies = ingestRetryPolicies()
+	fetcher.OnRetry = printIngestRetry
+
+	if !ingestNoProgress {
+		progressBar := newProgressBar(file.Size)
+		start := time.Now()
+		var first int64 = -1
+		fetcher.OnProgress = func(done, total int64) {
+			if first < 0 {
+				first = done // Resumed bytes do not count towards the speed
+			}
+			p := processor.Progress{BytesProcessed: done, TotalBytes: total, TimeElapsed: time.Since(start)}
+			if total > 0 {
+				progressBar.totalBytes = total
+				p.PercentComplete = float64(done) / float64(total) * 100
+			}
+			if secs := p.TimeElapsed.Seconds(); secs > 0 {
+				p.BytesPerSecond = float64(done-first) / secs
+			}
+			if p.BytesPerSecond > 0 && total > done {
+				p.EstimatedTimeRemaining = time.Duration(float64(total-done) / p.BytesPerSecond * float64(time.Second))
+			}
+			progressBar.Update(p)
+		}
+		defer progressBar.Finish()
+	}
+
+	fmt.Printf("\n⬇️  %s\n", i18n.T("ingest.downloading", ingestConnections))
+	result, err := fetcher.Fetch(ctx, downloader.ManifestFile{URL: file.URL, Path: file.Name})
+	if err != nil {
+		return "", err
+	}
+	return result.Path, nil
+}
+
+// printIngestHint explains what a failed ingest's kind of error usually
+// means and what to do about it
+func printIngestHint(err error) {
+	if hint := srerrors.Hint(err); hint != "" {
+		fmt.Printf("\n💡 %s\n", hint)
+	}
+}
+
+// listAvailableFiles lists available files on the mirror
 func listAvailableFiles(ctx context.Context, manager *downloader.MetadataManager) error {
-	fmt.Println("🔍 Fetching available files from NCBI...")
+	fmt.Printf("🔍 Fetching available files from %s...\n", strings.ToUpper(manager.Source().Name))
 
 	files, err := manager.ListAvailableFiles(ctx)
 	if err != nil {
@@ -417,7 +831,7 @@ func listAvailableFiles(ctx context.Context, manager *downloader.MetadataManager
 	return nil
 }
 
-// ingestLocalFile processes a local tar.gz file
+// ingestLocalFile processes a local tar.gz archive or XML dump
 func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force bool, noProgress bool, yes bool) error {
 	// Get file info
 	stat, err := os.Stat(filePath)
@@ -428,27 +842,33 @@ func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force
 	// Display file information
 	fmt.Printf("\n📦 Ingesting local archive:\n")
 	fmt.Printf("   Path: %s\n", colorBold(filePath))
+	source := ingestSource
+	if source == "" {
+		source = processor.DetectSource(filePath)
+	}
+	if source != "" {
+		fmt.Printf("   Source: %s\n", strings.ToUpper(source))
+	}
 	fmt.Printf("   Size: %s\n", colorize(downloader.FormatSize(stat.Size())))
 	fmt.Printf("   Modified: %s\n", stat.ModTime().Format("2006-01-02 15:04:05"))
 
 	// Initialize database
 	fmt.Printf("\n🗄️  Initializing database at %s...\n", dbPath)
-	db, err := database.Initialize(dbPath)
+	started := time.Now()
+	db, err := openIngestDatabase(dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer db.Close()
 
 	// Check if database already has data (unless forced)
+	confirmed := false
 	if !force {
-		stats, _ := db.GetStats()
+		stats := databaseCounts(db)
 		if stats.TotalExperiments > 0 || stats.TotalStudies > 0 {
-			fmt.Printf("\n⚠️  Database already contains data:\n")
-			fmt.Printf("   Studies:     %d\n", stats.TotalStudies)
-			fmt.Printf("   Experiments: %d\n", stats.TotalExperiments)
-			fmt.Printf("   Samples:     %d\n", stats.TotalSamples)
-			fmt.Printf("   Runs:        %d\n", stats.TotalRuns)
-			fmt.Printf("\nUse --force to overwrite existing data\n")
+			fmt.Printf("\n⚠️  %s\n", i18n.T("ingest.db_has_data"))
+			printDatabaseCounts(stats)
+			fmt.Printf("\n%s\n", i18n.T("ingest.use_force"))
 
 			// Ask for confirmation (unless --yes flag is set)
 			if !yes {
@@ -456,15 +876,33 @@ func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force
 				var response string
 				fmt.Scanln(&response)
 				if strings.ToLower(response) != "y" {
-					fmt.Println("Ingestion cancelled")
+					fmt.Println(i18n.T("ingest.cancelled"))
 					return nil
 				}
+				confirmed = true
 			} else {
 				fmt.Println("\n--yes flag set, continuing without confirmation")
 			}
 		}
 	}
 
+	// Estimate the records, disk space and time the ingest takes
+	proceed, err := confirmIngestEstimate(db, dbPath, stat.Size(), yes, confirmed)
+	if err != nil {
+		return err
+	}
+	if !proceed {
+		fmt.Println(i18n.T("ingest.cancelled"))
+		return nil
+	}
+	dbBytesBefore := databaseBytes(db)
+
+	bulk, err := beginBulkIngest(db)
+	if err != nil {
+		return err
+	}
+	defer bulk.finish()
+
 	// Check if filters are specified and create appropriate processor
 	if hasFilters() {
 		filterOpts, err := buildFilterOptions()
@@ -481,6 +919,13 @@ func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force
 		if err != nil {
 			return fmt.Errorf("failed to create filtered processor: %w", err)
 		}
+		filteredProcessor.SetStoreRaw(ingestStoreRaw)
+		filteredProcessor.SetValidator(ingestValidator())
+		filteredProcessor.SetTransforms(ingestTransformRules)
+		filteredProcessor.SetWorkers(ingestWorkers)
+		filteredProcessor.SetSource(ingestSource)
+		defer attachIngestControls(filteredProcessor.StreamProcessor, db)()
+		defer trackIngestMetrics(filteredProcessor.StreamProcessor)()
 
 		// Set up progress reporting if not disabled
 		if !noProgress {
@@ -492,9 +937,9 @@ func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force
 		}
 
 		// Start ingestion
-		fmt.Printf("\n🚀 Starting filtered ingestion...\n")
-		fmt.Println("   This may take a while for large files.")
-		fmt.Println("   Press Ctrl+C to cancel.")
+		fmt.Printf("\n🚀 %s\n", i18n.T("ingest.starting_filtered"))
+		fmt.Println("   " + i18n.T("ingest.may_take_a_while"))
+		fmt.Println("   " + i18n.T("ingest.press_ctrl_c"))
 
 		startTime := time.Now()
 
@@ -503,30 +948,37 @@ func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force
 
 		if err != nil {
 			if err == context.Canceled {
-				fmt.Println("\n\n❌ Ingestion cancelled")
+				fmt.Println("\n\n❌ " + i18n.T("ingest.cancelled"))
+			} else {
+				printIngestHint(err)
 			}
 			return err
 		}
 
+		if err := bulk.finish(); err != nil {
+			return err
+		}
+
 		// Display completion stats
 		duration := time.Since(startTime)
 		stats := filteredProcessor.StreamProcessor.GetStats()
 
-		fmt.Printf("\n\n✅ Ingestion completed successfully!\n")
-		fmt.Printf("\n📊 Statistics:\n")
-		fmt.Printf("   Duration:    %s\n", downloader.FormatDuration(duration))
+		fmt.Printf("\n\n✅ %s\n", i18n.T("ingest.completed"))
+		fmt.Printf("\n📊 %s\n", i18n.T("summary.statistics"))
+		printStat("summary.duration", 12, downloader.FormatDuration(duration))
 
 		// Safely get statistics with nil checks
 		if bytesProcessed, ok := stats["bytes_processed"].(int64); ok {
-			fmt.Printf("   Processed:   %s\n", downloader.FormatSize(bytesProcessed))
+			printStat("summary.processed", 12, downloader.FormatSize(bytesProcessed))
 			if duration.Seconds() > 0 {
-				fmt.Printf("   Speed:       %.1f MB/s\n", float64(bytesProcessed)/duration.Seconds()/(1024*1024))
+				printStat("summary.speed", 12, fmt.Sprintf("%.1f MB/s", float64(bytesProcessed)/duration.Seconds()/(1024*1024)))
 			}
 		}
 		if recordsInserted, ok := stats["records_inserted"].(int64); ok {
-			fmt.Printf("   Records:     %d\n", recordsInserted)
+			printStat("summary.records", 12, recordsInserted)
 		}
-		fmt.Printf("   Database:    %s\n", dbPath)
+		printStat("summary.database", 12, dbPath)
+		bulk.printPhases()
 
 		// Display filter statistics
 		filterStats := filteredProcessor.GetStats()
@@ -537,6 +989,13 @@ func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force
 	} else {
 		// No filters, use standard processor
 		streamProcessor := processor.NewStreamProcessor(db)
+		streamProcessor.SetStoreRaw(ingestStoreRaw)
+		streamProcessor.SetValidator(ingestValidator())
+		streamProcessor.SetTransforms(ingestTransformRules)
+		streamProcessor.SetWorkers(ingestWorkers)
+		streamProcessor.SetSource(ingestSource)
+		defer attachIngestControls(streamProcessor, db)()
+		defer trackIngestMetrics(streamProcessor)()
 
 		// Set up progress reporting if not disabled
 		if !noProgress {
@@ -548,9 +1007,9 @@ func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force
 		}
 
 		// Start ingestion
-		fmt.Printf("\n🚀 Starting ingestion...\n")
-		fmt.Println("   This may take a while for large files.")
-		fmt.Println("   Press Ctrl+C to cancel.")
+		fmt.Printf("\n🚀 %s\n", i18n.T("ingest.starting"))
+		fmt.Println("   " + i18n.T("ingest.may_take_a_while"))
+		fmt.Println("   " + i18n.T("ingest.press_ctrl_c"))
 
 		startTime := time.Now()
 
@@ -559,58 +1018,162 @@ func ingestLocalFile(ctx context.Context, filePath string, dbPath string, force
 
 		if err != nil {
 			if err == context.Canceled {
-				fmt.Println("\n\n❌ Ingestion cancelled")
+				fmt.Println("\n\n❌ " + i18n.T("ingest.cancelled"))
+			} else {
+				printIngestHint(err)
 			}
 			return err
 		}
 
+		if err := bulk.finish(); err != nil {
+			return err
+		}
+
 		// Display completion stats
 		duration := time.Since(startTime)
 		stats := streamProcessor.GetStats()
 
-		fmt.Printf("\n\n✅ Ingestion completed successfully!\n")
-		fmt.Printf("\n📊 Statistics:\n")
-		fmt.Printf("   Duration:    %s\n", downloader.FormatDuration(duration))
+		fmt.Printf("\n\n✅ %s\n", i18n.T("ingest.completed"))
+		fmt.Printf("\n📊 %s\n", i18n.T("summary.statistics"))
+		printStat("summary.duration", 12, downloader.FormatDuration(duration))
 
 		// Safely get statistics with nil checks
 		if bytesProcessed, ok := stats["bytes_processed"].(int64); ok {
-			fmt.Printf("   Processed:   %s\n", downloader.FormatSize(bytesProcessed))
+			printStat("summary.processed", 12, downloader.FormatSize(bytesProcessed))
 			if duration.Seconds() > 0 {
-				fmt.Printf("   Speed:       %.1f MB/s\n", float64(bytesProcessed)/duration.Seconds()/(1024*1024))
+				printStat("summary.speed", 12, fmt.Sprintf("%.1f MB/s", float64(bytesProcessed)/duration.Seconds()/(1024*1024)))
 			}
 		}
 		if recordsInserted, ok := stats["records_inserted"].(int64); ok {
-			fmt.Printf("   Records:     %d\n", recordsInserted)
+			printStat("summary.records", 12, recordsInserted)
 		}
-		fmt.Printf("   Database:    %s\n", dbPath)
+		printStat("summary.database", 12, dbPath)
+		bulk.printPhases()
+
+		measureIngest(db, streamProcessor, stat.Size(), dbBytesBefore, duration)
 	}
 
 	// Update database statistics after successful ingestion
 	if !skipStats {
-		fmt.Printf("\n📈 Updating database statistics...")
+		fmt.Printf("\n📈 %s", i18n.T("ingest.updating_stats"))
 		if err := db.UpdateStatistics(); err != nil {
-			fmt.Printf(" ⚠️ Warning: Failed to update statistics: %v\n", err)
+			fmt.Printf(" ⚠️ %s\n", i18n.T("ingest.stats_failed", err))
 		} else {
 			fmt.Printf(" ✓\n")
 		}
 	}
+	if ingestOptimize {
+		optimizeDatabase(ctx, db)
+	}
 
 	// Get database stats
-	dbStats, _ := db.GetStats()
-	fmt.Printf("\n📈 Database Contents:\n")
-	fmt.Printf("   Studies:     %d\n", dbStats.TotalStudies)
-	fmt.Printf("   Experiments: %d\n", dbStats.TotalExperiments)
-	fmt.Printf("   Samples:     %d\n", dbStats.TotalSamples)
-	fmt.Printf("   Runs:        %d\n", dbStats.TotalRuns)
-
-	fmt.Printf("\n💡 Next steps:\n")
-	fmt.Printf("   • Search records: srake search 'your query'\n")
-	fmt.Printf("   • Start API server: srake server\n")
-	fmt.Printf("   • View database info: srake db info\n")
+	dbStats := databaseCounts(db)
+	fmt.Printf("\n📈 %s\n", i18n.T("summary.database_contents"))
+	printDatabaseCounts(dbStats)
+	reportExpectations(db)
+	reportQuarantine(db, started)
+
+	fmt.Printf("\n💡 %s\n", i18n.T("summary.next_steps"))
+	fmt.Printf("   • %s\n", i18n.T("summary.next_search"))
+	fmt.Printf("   • %s\n", i18n.T("summary.next_server"))
+	fmt.Printf("   • %s\n", i18n.T("summary.next_db_info"))
 
 	return nil
 }
 
+// printStat prints a line of an ingest summary with its label, in the
+// user's locale, padded to width columns
+func printStat(id string, width int, value interface{}) {
+	fmt.Printf("   %s %v\n", i18n.Pad(i18n.T(id), width), value)
+}
+
+// optimizeDatabase analyzes the database after an ingest, and vacuums it
+// when enough of it is free space, as 'srake db vacuum --auto' does
+func optimizeDatabase(ctx context.Context, db *database.DB) {
+	fmt.Printf("\n🧹 %s", i18n.T("ingest.analyzing"))
+	if err := db.Analyze(ctx); err != nil {
+		fmt.Printf(" ⚠️ %s\n", i18n.T("ingest.optimize_failed", err))
+		return
+	}
+	fmt.Printf(" ✓\n")
+
+	before, err := db.SpaceUsage()
+	if err != nil || !before.NeedsVacuum() {
+		return
+	}
+	fmt.Printf("🧹 %s", i18n.T("ingest.vacuuming", downloader.FormatSize(before.FreeBytes())))
+	if err := db.Vacuum(ctx); err != nil {
+		fmt.Printf(" ⚠️ %s\n", i18n.T("ingest.optimize_failed", err))
+		return
+	}
+	if after, err := db.SpaceUsage(); err == nil {
+		fmt.Printf(" ✓ %s\n", i18n.T("ingest.vacuumed", downloader.FormatSize(before.FileBytes), downloader.FormatSize(after.FileBytes)))
+	} else {
+		fmt.Printf(" ✓\n")
+	}
+}
+
+// databaseCounts returns the number of records of each type, estimated
+// from the database's sketches so that large databases are not counted row
+// by row
+func databaseCounts(db *database.DB) *database.DatabaseStats {
+	if err := db.FlushSketches(); err != nil {
+		fmt.Printf("\n⚠️  %s\n", i18n.T("ingest.sketches_failed", err))
+	}
+	stats, err := db.EstimateStats()
+	if err != nil {
+		stats, _ = db.GetStats()
+	}
+	return stats
+}
+
+// printDatabaseCounts prints the number of records of each type
+func printDatabaseCounts(stats *database.DatabaseStats) {
+	printStat("summary.studies", 12, stats.TotalStudies)
+	printStat("summary.experiments", 12, stats.TotalExperiments)
+	printStat("summary.samples", 12, stats.TotalSamples)
+	printStat("summary.runs", 12, stats.TotalRuns)
+}
+
+// maxReportedExpectations caps the expected records reportExpectations
+// lists one by one
+const maxReportedExpectations = 20
+
+// reportExpectations reports the records expected with 'srake expect
+// import' that the ingest brought in, and how many are still pending. It
+// prints nothing when no records are expected.
+func reportExpectations(db *database.DB) {
+	appeared, err := db.ReconcileExpectations()
+	if err != nil {
+		fmt.Printf("\n⚠️  %s\n", i18n.T("ingest.expect_failed", err))
+		return
+	}
+	pending, err := db.CountPendingExpectations()
+	if err != nil {
+		fmt.Printf("\n⚠️  %s\n", i18n.T("ingest.expect_failed", err))
+		return
+	}
+	if len(appeared) == 0 && pending == 0 {
+		return
+	}
+
+	fmt.Printf("\n🔔 %s\n", i18n.T("summary.expected_appeared", len(appeared)))
+	for i, e := range appeared {
+		if i == maxReportedExpectations {
+			fmt.Printf("   %s\n", i18n.T("summary.expected_more", len(appeared)-i))
+			break
+		}
+		label := ""
+		if e.Label != "" {
+			label = " " + e.Label
+		}
+		fmt.Printf("   • %s → %s (%s)%s\n", e.Expected, e.Accession, e.RecordType, label)
+	}
+	if pending > 0 {
+		fmt.Printf("   %s\n", i18n.T("summary.expected_pending", pending))
+	}
+}
+
 // progressBar handles progress display
 type progressBar struct {
 	totalBytes int64
@@ -646,19 +1209,21 @@ func (pb *progressBar) Update(p processor.Progress) {
 	speedMB := p.BytesPerSecond / (1024 * 1024)
 
 	// Format remaining time
-	remainingStr := "calculating..."
+	remainingStr := i18n.T("progress.calculating")
 	if p.EstimatedTimeRemaining > 0 {
 		remainingStr = downloader.FormatDuration(p.EstimatedTimeRemaining)
 	}
 
 	// Clear line and print progress
-	fmt.Printf("\r[%s] %.1f%% | %s / %s | %.1f MB/s | ETA: %s | Records: %d",
+	fmt.Printf("\r[%s] %.1f%% | %s / %s | %.1f MB/s | %s: %s | %s: %d",
 		bar,
 		p.PercentComplete,
 		downloader.FormatSize(p.BytesProcessed),
 		downloader.FormatSize(pb.totalBytes),
 		speedMB,
+		i18n.T("progress.eta"),
 		remainingStr,
+		i18n.T("progress.records"),
 		p.RecordsProcessed)
 }
 
@@ -708,23 +1273,54 @@ func hasFilters() bool {
 		filterMaxReads > 0 ||
 		filterMinBases > 0 ||
 		filterMaxBases > 0 ||
-		filterProfile != ""
+		filterProfile != "" ||
+		filterExpr != ""
 }
 
-// buildFilterOptions creates a FilterOptions struct from command-line flags
+// buildFilterOptions creates a FilterOptions struct from the filter profile
+// and command-line flags
 func buildFilterOptions() (*processor.FilterOptions, error) {
-	opts := &processor.FilterOptions{
-		TaxonomyIDs:   filterTaxonIDs,
-		ExcludeTaxIDs: filterExcludeTaxIDs,
-		Organisms:     filterOrganisms,
-		Platforms:     filterPlatforms,
-		Strategies:    filterStrategies,
-		MinReads:      filterMinReads,
-		MaxReads:      filterMaxReads,
-		MinBases:      filterMinBases,
-		MaxBases:      filterMaxBases,
-		StatsOnly:     filterStatsOnly,
-		Verbose:       filterVerbose,
+	// Start from the profile, if any; command-line flags override its values
+	opts := &processor.FilterOptions{}
+	if filterProfile != "" {
+		profile, err := processor.LoadFilterProfile(filterProfile)
+		if err != nil {
+			return nil, err
+		}
+		opts = profile
+	}
+	opts.StatsOnly = filterStatsOnly
+	opts.Verbose = filterVerbose
+
+	if len(filterTaxonIDs) > 0 {
+		opts.TaxonomyIDs = filterTaxonIDs
+	}
+	if len(filterExcludeTaxIDs) > 0 {
+		opts.ExcludeTaxIDs = filterExcludeTaxIDs
+	}
+	if len(filterOrganisms) > 0 {
+		opts.Organisms = filterOrganisms
+	}
+	if len(filterPlatforms) > 0 {
+		opts.Platforms = filterPlatforms
+	}
+	if len(filterStrategies) > 0 {
+		opts.Strategies = filterStrategies
+	}
+	if filterMinReads > 0 {
+		opts.MinReads = filterMinReads
+	}
+	if filterMaxReads > 0 {
+		opts.MaxReads = filterMaxReads
+	}
+	if filterMinBases > 0 {
+		opts.MinBases = filterMinBases
+	}
+	if filterMaxBases > 0 {
+		opts.MaxBases = filterMaxBases
+	}
+	if filterExpr != "" {
+		opts.Expr = filterExpr
 	}
 
 	// Parse date filters
@@ -744,12 +1340,6 @@ func buildFilterOptions() (*processor.FilterOptions, error) {
 		opts.DateTo = t
 	}
 
-	// Load profile if specified
-	if filterProfile != "" {
-		// TODO: Implement YAML profile loading
-		fmt.Printf("⚠️  Filter profiles not yet implemented, using command-line flags only\n")
-	}
-
 	// Validate the options
 	if err := opts.Validate(); err != nil {
 		return nil, err
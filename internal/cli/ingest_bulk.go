@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/i18n"
+)
+
+// bulkIngest is the bulk load of an ingest run with --bulk. Its methods do
+// nothing on a nil bulkIngest, so that ingests without --bulk can call them.
+type bulkIngest struct {
+	load     *database.BulkLoad
+	phases   []database.BulkPhase
+	finished bool
+}
+
+// beginBulkIngest starts a bulk load of db when --bulk is set
+func beginBulkIngest(db *database.DB) (*bulkIngest, error) {
+	if !ingestBulk {
+		return nil, nil
+	}
+	load, err := db.BeginBulkLoad()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start bulk load: %w", err)
+	}
+	return &bulkIngest{load: load}, nil
+}
+
+// finish merges the staged records and rebuilds the indexes, once. An
+// ingest that fails or is cancelled still finishes its bulk load, keeping
+// the records it staged as an ingest without --bulk keeps those it wrote.
+func (b *bulkIngest) finish() error {
+	if b == nil || b.finished {
+		return nil
+	}
+	b.finished = true
+	fmt.Printf("\n🧱 %s\n", i18n.T("ingest.bulk_finishing"))
+	phases, err := b.load.Finish(context.Background())
+	b.phases = phases
+	if err != nil {
+		return fmt.Errorf("failed to finish bulk load: %w", err)
+	}
+	return nil
+}
+
+// printPhases prints how long each phase of the bulk load took
+func (b *bulkIngest) printPhases() {
+	if b == nil || len(b.phases) == 0 {
+		return
+	}
+	fmt.Printf("\n⏱️  %s\n", i18n.T("summary.bulk_phases"))
+	for _, p := range b.phases {
+		printStat("summary.bulk_"+p.Name, 18, p.Duration.Round(10*time.Millisecond))
+	}
+}
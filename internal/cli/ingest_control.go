@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/processor"
+	"github.com/spf13/cobra"
+)
+
+// ingestStatus is the status snapshot reported over the control socket
+type ingestStatus struct {
+	PID              int     `json:"pid"`
+	Paused           bool    `json:"paused"`
+	ThrottleLevel    int     `json:"throttle_level,omitempty"`
+	CurrentFile      string  `json:"current_file,omitempty"`
+	BytesProcessed   int64   `json:"bytes_processed"`
+	TotalBytes       int64   `json:"total_bytes"`
+	RecordsProcessed int64   `json:"records_processed"`
+	PercentComplete  float64 `json:"percent_complete"`
+	BytesPerSecond   float64 `json:"bytes_per_second"`
+	ElapsedSeconds   float64 `json:"elapsed_seconds"`
+	ETASeconds       float64 `json:"eta_seconds"`
+	Error            string  `json:"error,omitempty"`
+}
+
+func newIngestStatus(p processor.Progress) *ingestStatus {
+	return &ingestStatus{
+		PID:              os.Getpid(),
+		Paused:           p.Paused,
+		ThrottleLevel:    p.ThrottleLevel,
+		CurrentFile:      p.CurrentFile,
+		BytesProcessed:   p.BytesProcessed,
+		TotalBytes:       p.TotalBytes,
+		RecordsProcessed: p.RecordsProcessed,
+		PercentComplete:  p.PercentComplete,
+		BytesPerSecond:   p.BytesPerSecond,
+		ElapsedSeconds:   p.TimeElapsed.Seconds(),
+		ETASeconds:       p.EstimatedTimeRemaining.Seconds(),
+	}
+}
+
+// attachIngestControls lets a running ingest be inspected, paused and
+// throttled: SIGUSR1 prints a status snapshot, SIGUSR2 toggles pause
+// (except on Windows, which has neither signal), and the control socket
+// serves 'srake ingest status|pause|resume'. Pausing checkpoints the
+// database and stops reading the input, which idles the download.
+// --nice and --max-query-latency throttle the ingest. The returned
+// function detaches the controls and resumes the ingest.
+func attachIngestControls(sp *processor.StreamProcessor, db *database.DB) func() {
+	controller := processor.NewController()
+	controller.OnPause = func() {
+		if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			fmt.Fprintf(os.Stderr, "\n⚠️  Checkpoint failed: %v\n", err)
+		}
+	}
+	sp.SetController(controller)
+
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	if ingestNice > 0 || ingestMaxLatency > 0 {
+		throttle := processor.NewThrottle(ingestNice)
+		sp.SetThrottle(throttle)
+		if ingestMaxLatency > 0 {
+			go throttle.Monitor(monitorCtx, ingestMaxLatency, db.ProbeLatency)
+		}
+	}
+
+	stopSignals := notifyIngestSignals(sp, controller)
+
+	listener := listenIngestControl()
+	if listener != nil {
+		go serveIngestControl(listener, sp, controller)
+	}
+
+	return func() {
+		stopMonitor()
+		stopSignals()
+		if listener != nil {
+			listener.Close()
+			os.Remove(paths.GetIngestControlPath())
+		}
+		controller.Resume()
+	}
+}
+
+// listenIngestControl opens the control socket, replacing a stale socket
+// left by a crashed ingest. Returns nil if the socket cannot be opened,
+// e.g. because another ingest is already running.
+func listenIngestControl() net.Listener {
+	socketPath := paths.GetIngestControlPath()
+	if err := os.MkdirAll(paths.GetPaths().StateDir, 0750); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(socketPath); err == nil {
+		if _, err := sendIngestControl("status"); err == nil {
+			fmt.Println("⚠️  Another ingest is running; pause/resume commands will go to it")
+			return nil
+		}
+		os.Remove(socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil
+	}
+	return listener
+}
+
+func serveIngestControl(listener net.Listener, sp *processor.StreamProcessor, controller *processor.Controller) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				return
+			}
+			var errMsg string
+			switch command := strings.TrimSpace(line); command {
+			case "status":
+			case "pause":
+				if controller.Pause() {
+					fmt.Println("\n⏸️  Ingestion paused (run 'srake ingest resume' to continue)")
+				} else {
+					errMsg = "ingest is already paused"
+				}
+			case "resume":
+				if controller.Resume() {
+					fmt.Println("\n▶️  Ingestion resumed")
+				} else {
+					errMsg = "ingest is not paused"
+				}
+			default:
+				errMsg = fmt.Sprintf("unknown command: %s", command)
+			}
+
+			status := newIngestStatus(sp.Status())
+			status.Error = errMsg
+			json.NewEncoder(conn).Encode(status)
+		}(conn)
+	}
+}
+
+// sendIngestControl sends a command to the running ingest and returns its
+// status after the command was applied
+func sendIngestControl(command string) (*ingestStatus, error) {
+	conn, err := net.DialTimeout("unix", paths.GetIngestControlPath(), 2*time.Second)
+	if err != nil {
+		return nil, errors.New("no running ingest found")
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return nil, fmt.Errorf("failed to contact ingest: %w", err)
+	}
+	var status ingestStatus
+	if err := json.NewDecoder(conn).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to read ingest status: %w", err)
+	}
+	return &status, nil
+}
+
+func printIngestStatus(s *ingestStatus) {
+	state := "running"
+	switch {
+	case s.Paused:
+		state = "paused"
+	case s.ThrottleLevel > 0:
+		state = fmt.Sprintf("running, throttled at level %d", s.ThrottleLevel)
+	}
+	fmt.Printf("\n📊 Ingest status (pid %d): %s\n", s.PID, state)
+	if s.TotalBytes > 0 {
+		fmt.Printf("   Progress:    %.1f%% (%s / %s)\n", s.PercentComplete,
+			downloader.FormatSize(s.BytesProcessed), downloader.FormatSize(s.TotalBytes))
+	} else {
+		fmt.Printf("   Processed:   %s\n", downloader.FormatSize(s.BytesProcessed))
+	}
+	fmt.Printf("   Records:     %d\n", s.RecordsProcessed)
+	fmt.Printf("   Speed:       %.1f MB/s\n", s.BytesPerSecond/(1024*1024))
+	fmt.Printf("   Elapsed:     %s\n", downloader.FormatDuration(time.Duration(s.ElapsedSeconds*float64(time.Second))))
+	if s.ETASeconds > 0 && !s.Paused {
+		fmt.Printf("   Remaining:   %s\n", downloader.FormatDuration(time.Duration(s.ETASeconds*float64(time.Second))))
+	}
+	if s.CurrentFile != "" {
+		fmt.Printf("   Current:     %s\n", s.CurrentFile)
+	}
+}
+
+// newIngestControlCmds creates the subcommands that control a running ingest
+func newIngestControlCmds() []*cobra.Command {
+	var statusJSON bool
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the status of a running ingest",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := sendIngestControl("status")
+			if err != nil {
+				return err
+			}
+			if statusJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(status)
+			}
+			printIngestStatus(status)
+			return nil
+		},
+	}
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Output as JSON")
+
+	pauseCmd := &cobra.Command{
+		Use:   "pause",
+		Short: "Pause a running ingest",
+		Long: `Pause a running ingest. Records read so far are checkpointed to the
+database and the download is idled until the ingest is resumed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIngestControl("pause", "⏸️  Ingestion paused")
+		},
+	}
+
+	resumeCmd := &cobra.Command{
+		Use:   "resume",
+		Short: "Resume a paused ingest",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIngestControl("resume", "▶️  Ingestion resumed")
+		},
+	}
+
+	return []*cobra.Command{statusCmd, pauseCmd, resumeCmd}
+}
+
+func runIngestControl(command, message string) error {
+	status, err := sendIngestControl(command)
+	if err != nil {
+		return err
+	}
+	if status.Error != "" {
+		return errors.New(status.Error)
+	}
+	fmt.Printf("%s at %.1f%% (%d records)\n", message, status.PercentComplete, status.RecordsProcessed)
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nishad/srake/internal/processor"
+)
+
+// notifyIngestSignals prints the status of the ingest on SIGUSR1 and
+// toggles pause on SIGUSR2 until the returned function is called
+func notifyIngestSignals(sp *processor.StreamProcessor, controller *processor.Controller) func() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1, syscall.SIGUSR2)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-sigChan:
+				if sig == syscall.SIGUSR2 {
+					if controller.Toggle() {
+						fmt.Println("\n⏸️  Ingestion paused (send SIGUSR2 again or run 'srake ingest resume')")
+					} else {
+						fmt.Println("\n▶️  Ingestion resumed")
+					}
+					continue
+				}
+				printIngestStatus(newIngestStatus(sp.Status()))
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package cli
+
+import "github.com/nishad/srake/internal/processor"
+
+// notifyIngestSignals does nothing on Windows, which has no SIGUSR1 or
+// SIGUSR2; 'srake ingest status|pause|resume' control the ingest instead
+func notifyIngestSignals(sp *processor.StreamProcessor, controller *processor.Controller) func() {
+	return func() {}
+}
@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/i18n"
+	"github.com/nishad/srake/internal/plan"
+	"github.com/nishad/srake/internal/processor"
+)
+
+// minEntrezWatch is the shortest --watch interval, which keeps polls from
+// running back to back against NCBI
+const minEntrezWatch = 5 * time.Minute
+
+// runEntrezIngest applies the SRA records NCBI modified since the last
+// sync, found and fetched through E-utilities, and with --watch keeps
+// polling for more. Entrez dates modifications to the day, so each poll
+// fetches the records modified from the day of the last sync on.
+func runEntrezIngest(ctx context.Context, planOut io.Writer) error {
+	if filterStatsOnly {
+		return fmt.Errorf("--stats-only cannot be combined with --entrez")
+	}
+	if ingestSource != "" && ingestSource != processor.SourceNCBI {
+		return fmt.Errorf("--entrez fetches records from NCBI and cannot be combined with --source %s", ingestSource)
+	}
+	if ingestWatch > 0 && ingestWatch < minEntrezWatch {
+		return fmt.Errorf("--watch must be at least %s", minEntrezWatch)
+	}
+	if ingestWatch > 0 && ingestDryRun {
+		return fmt.Errorf("--watch cannot be combined with --dry-run")
+	}
+
+	var filterOpts *processor.FilterOptions
+	if hasFilters() {
+		opts, err := buildFilterOptions()
+		if err != nil {
+			return fmt.Errorf("invalid filter options: %w", err)
+		}
+		filterOpts = opts
+	}
+
+	var since time.Time
+	if ingestSince != "" {
+		var err error
+		since, err = time.Parse("2006-01-02", ingestSince)
+		if err != nil {
+			return fmt.Errorf("invalid --since date %q (expected YYYY-MM-DD)", ingestSince)
+		}
+	}
+
+	feed := downloader.NewEntrezFeed()
+	if ingestDryRun {
+		return planEntrezIngest(ctx, feed, since, planOut)
+	}
+
+	// A watch waits out other ingests between polls rather than failing
+	if ingestWatch > 0 {
+		ingestWait = true
+	}
+	for {
+		if err := pollEntrez(ctx, feed, since, filterOpts); err != nil {
+			if err == context.Canceled {
+				fmt.Println("\n❌ " + i18n.T("ingest.cancelled_by_user"))
+				return nil
+			}
+			if ingestWatch == 0 {
+				return err
+			}
+			// A failed poll is retried at the next, which fetches the
+			// same days again
+			fmt.Printf("\n⚠️  Poll failed: %v\n", err)
+		}
+		if ingestWatch == 0 {
+			return nil
+		}
+		since = time.Time{} // Later polls continue from the last sync
+
+		fmt.Printf("\n💤 Next poll at %s\n", time.Now().Add(ingestWatch).Format("15:04"))
+		select {
+		case <-time.After(ingestWatch):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// pollEntrez takes the ingest lock and applies the records modified from
+// since, or from the last sync when since is zero, through today
+func pollEntrez(ctx context.Context, feed *downloader.EntrezFeed, since time.Time, filterOpts *processor.FilterOptions) error {
+	lock, err := lockDatabase(ctx, ingestDBPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	db, err := openIngestDatabase(ingestDBPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	if since.IsZero() {
+		if since, err = lastSyncDay(db); err != nil {
+			return err
+		}
+	}
+	until := time.Now().UTC().Truncate(24 * time.Hour)
+
+	fmt.Printf("🔍 Looking for SRA records modified from %s through %s...\n",
+		since.Format("2006-01-02"), until.Format("2006-01-02"))
+	uids, err := feed.ModifiedSince(ctx, since, until)
+	if err != nil {
+		return fmt.Errorf("failed to search Entrez: %w", err)
+	}
+	if len(uids) == 0 {
+		fmt.Println("\n✅ Database is up to date")
+		return db.RecordEntrezSync(database.EntrezSync{SyncedUntil: until})
+	}
+
+	batches := feed.Batches(uids)
+	fmt.Printf("\n📦 %d record(s) to apply in %d batch(es)\n", len(uids), len(batches))
+	if filterOpts != nil {
+		fmt.Printf("\n🔍 Applying filters:\n")
+		fmt.Printf("   %s\n", filterOpts.String())
+	}
+
+	startTime := time.Now()
+	var totalRecords, totalSuppressed int64
+	for i, batch := range batches {
+		if !ingestNoProgress {
+			fmt.Printf("\r   Batch %d/%d", i+1, len(batches))
+		}
+		records, suppressed, err := applyEntrezBatch(ctx, db, feed, batch, filterOpts)
+		if err != nil {
+			return fmt.Errorf("failed to apply Entrez records: %w", err)
+		}
+		totalRecords += records
+		totalSuppressed += suppressed
+	}
+
+	// Only a complete poll is recorded, so a failed one is fetched again
+	if err := db.RecordEntrezSync(database.EntrezSync{
+		SyncedUntil: until,
+		Records:     totalRecords,
+		Suppressed:  totalSuppressed,
+	}); err != nil {
+		return fmt.Errorf("failed to record Entrez sync: %w", err)
+	}
+
+	fmt.Printf("\n\n✅ Applied %d Entrez record(s) in %s\n", len(uids), downloader.FormatDuration(time.Since(startTime)))
+	fmt.Printf("   Records updated:    %d\n", totalRecords)
+	fmt.Printf("   Records suppressed: %d\n", totalSuppressed)
+
+	if !skipStats {
+		fmt.Printf("\n📈 %s", i18n.T("ingest.updating_stats"))
+		if err := db.UpdateStatistics(); err != nil {
+			fmt.Printf(" ⚠️ %s\n", i18n.T("ingest.stats_failed", err))
+		} else {
+			fmt.Printf(" ✓\n")
+		}
+	}
+	reportExpectations(db)
+	reportQuarantine(db, startTime)
+	return nil
+}
+
+// lastSyncDay returns the day the next poll of Entrez starts from: the
+// last day synced from Entrez or by a metadata file, whichever is later
+func lastSyncDay(db *database.DB) (time.Time, error) {
+	var since time.Time
+	last, err := db.LastEntrezSync()
+	if err != nil {
+		return since, fmt.Errorf("failed to read the last Entrez sync: %w", err)
+	}
+	if last != nil {
+		since = last.SyncedUntil
+	}
+	applied, err := db.ListAppliedUpdates()
+	if err != nil {
+		return since, fmt.Errorf("failed to read applied updates: %w", err)
+	}
+	if len(applied) > 0 && applied[len(applied)-1].FileDate.After(since) {
+		since = applied[len(applied)-1].FileDate
+	}
+	if since.IsZero() {
+		return since, fmt.Errorf("no metadata files have been ingested into %s; ingest a full dataset first with 'srake ingest --monthly', or give the date of the data already in the database with --since", ingestDBPath)
+	}
+	return since, nil
+}
+
+// applyEntrezBatch fetches a batch of records from Entrez and ingests
+// them, removing the records their submissions suppress, and returns the
+// number of records inserted or replaced and the number suppressed
+func applyEntrezBatch(ctx context.Context, db *database.DB, feed *downloader.EntrezFeed, uids []string, filterOpts *processor.FilterOptions) (int64, int64, error) {
+	sp := processor.NewStreamProcessor(db)
+	if filterOpts != nil {
+		fp, err := processor.NewFilteredProcessor(db, *filterOpts)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to create filtered processor: %w", err)
+		}
+		sp = fp.StreamProcessor
+	}
+	sp.SetStoreRaw(ingestStoreRaw)
+	sp.SetValidator(ingestValidator())
+	sp.SetTransforms(ingestTransformRules)
+	sp.SetSource(processor.SourceNCBI)
+	sp.SetApplySuppressions(true)
+	defer attachIngestControls(sp, db)()
+	defer trackIngestMetrics(sp)()
+
+	err := ingestWithRetry(ctx, func() error {
+		body, err := feed.Fetch(ctx, uids)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		return sp.ProcessReader(ctx, body, "entrez-sra.xml")
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stats := sp.GetStats()
+	return stats["records_processed"].(int64), stats["records_suppressed"].(int64), nil
+}
+
+// planEntrezIngest writes the plan of a poll of Entrez, which searches
+// Entrez for the records to fetch but changes nothing
+func planEntrezIngest(ctx context.Context, feed *downloader.EntrezFeed, since time.Time, planOut io.Writer) error {
+	db, err := openPlanDatabase(ingestDBPath)
+	if err == nil && db == nil {
+		err = fmt.Errorf("database not found at %s", ingestDBPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	if since.IsZero() {
+		if since, err = lastSyncDay(db); err != nil {
+			return err
+		}
+	}
+	until := time.Now().UTC().Truncate(24 * time.Hour)
+	uids, err := feed.ModifiedSince(ctx, since, until)
+	if err != nil {
+		return fmt.Errorf("failed to search Entrez: %w", err)
+	}
+
+	p := newIngestPlan(db, ingestDBPath)
+	if len(uids) == 0 {
+		p.AddStep("Nothing: no records were modified from %s through %s", since.Format("2006-01-02"), until.Format("2006-01-02"))
+		return p.Write(planOut, ingestPlanFormat)
+	}
+	p.AddSource("entrez", feed.BaseURL, 0)
+	p.AddStep("Fetch the %d SRA records modified from %s through %s from Entrez in %d batch(es)",
+		len(uids), since.Format("2006-01-02"), until.Format("2006-01-02"), len(feed.Batches(uids)))
+	if hasFilters() {
+		opts, err := buildFilterOptions()
+		if err != nil {
+			return fmt.Errorf("invalid filter options: %w", err)
+		}
+		p.AddStep("Keep only the records matching: %s", opts.String())
+	}
+	p.AddDestructiveStep("Replace the records already in the database that are fetched again")
+	p.AddDestructiveStep("Delete the records the fetched submissions suppress")
+	for _, table := range ingestTables {
+		p.AddTable(table, plan.AccessWrite, 0)
+	}
+	for _, table := range []string{"studies", "experiments", "samples", "runs"} {
+		p.AddTable(table, plan.AccessDelete, 0)
+	}
+	if ingestStoreRaw {
+		p.AddTable("raw_records", plan.AccessWrite, 0)
+		p.AddTable("raw_blobs", plan.AccessWrite, 0)
+	}
+	if ingestValidator() != nil {
+		p.AddTable("quarantine", plan.AccessWrite, 0)
+	}
+	p.AddTable("entrez_syncs", plan.AccessWrite, 1)
+	if !skipStats {
+		p.AddTable("statistics", plan.AccessWrite, 0)
+		p.AddStep("Update the database statistics")
+	}
+	return p.Write(planOut, ingestPlanFormat)
+}
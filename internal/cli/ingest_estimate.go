@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/i18n"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/processor"
+)
+
+// Ratios an ingest is estimated from before any ingest into the database
+// has been measured. They are rough, so the first estimate is too.
+const (
+	defaultRecordsPerByte      = 1.0 / 200
+	defaultGrowthPerByte       = 8.0
+	defaultBytesPerSecond      = 4 << 20
+	defaultIndexBytesPerRecord = 1000
+)
+
+// ingestEstimate is what ingesting an archive is expected to take
+type ingestEstimate struct {
+	Records     int64
+	DBGrowth    int64
+	IndexGrowth int64 // search index built by srake index afterwards
+	Duration    time.Duration
+	FreeBytes   int64 // on the volume of the database, -1 when unknown
+	Measured    int   // earlier ingests the ratios are taken from
+}
+
+// estimateIngest estimates ingesting an archive of archiveBytes into the
+// database at dbPath, which db is open on unless it does not exist yet,
+// from the ratios of the ingests measured before, or the default ratios
+// when there are none. The index is estimated from the size of the
+// existing index per record.
+func estimateIngest(db *database.DB, dbPath string, archiveBytes int64) *ingestEstimate {
+	recordsPerByte, growthPerByte, bytesPerSecond := defaultRecordsPerByte, defaultGrowthPerByte, float64(defaultBytesPerSecond)
+	e := &ingestEstimate{FreeBytes: -1}
+	if db != nil {
+		if r, err := db.IngestRatios(); err == nil && r.Ingests > 0 {
+			recordsPerByte, growthPerByte, bytesPerSecond = r.RecordsPerByte, r.GrowthPerByte, r.BytesPerSecond
+			e.Measured = r.Ingests
+		}
+	}
+
+	indexBytesPerRecord := float64(defaultIndexBytesPerRecord)
+	if indexBytes := dirSize(paths.GetIndexPath()); db != nil && indexBytes > 0 {
+		stats := databaseCounts(db)
+		if records := stats.TotalStudies + stats.TotalExperiments + stats.TotalSamples + stats.TotalRuns; records > 0 {
+			indexBytesPerRecord = float64(indexBytes) / float64(records)
+		}
+	}
+
+	e.Records = int64(float64(archiveBytes) * recordsPerByte)
+	e.DBGrowth = int64(float64(archiveBytes) * growthPerByte)
+	e.IndexGrowth = int64(float64(e.Records) * indexBytesPerRecord)
+	e.Duration = time.Duration(float64(archiveBytes) / bytesPerSecond * float64(time.Second))
+	if free, err := paths.FreeSpace(dbPath); err == nil {
+		e.FreeBytes = free
+	}
+	return e
+}
+
+// fits reports whether the database and index growth fit in the free
+// space of the volume, when it is known
+func (e *ingestEstimate) fits() bool {
+	return e.FreeBytes < 0 || e.DBGrowth+e.IndexGrowth <= e.FreeBytes
+}
+
+// print prints the estimate as a summary
+func (e *ingestEstimate) print(dbPath string) {
+	if e.Measured > 0 {
+		fmt.Printf("\n📐 %s\n", i18n.T("estimate.measured", e.Measured))
+	} else {
+		fmt.Printf("\n📐 %s\n", i18n.T("estimate.defaults"))
+	}
+	printStat("estimate.records", 10, fmt.Sprintf("~%d", e.Records))
+	printStat("estimate.database", 10, "+"+downloader.FormatSize(e.DBGrowth))
+	printStat("estimate.index", 10, "+"+downloader.FormatSize(e.IndexGrowth))
+	printStat("estimate.time", 10, "~"+downloader.FormatDuration(e.Duration))
+	if e.FreeBytes >= 0 {
+		printStat("estimate.free", 10, i18n.T("estimate.free_on", downloader.FormatSize(e.FreeBytes), filepath.Dir(dbPath)))
+	}
+	if hasFilters() {
+		fmt.Printf("   %s\n", i18n.T("estimate.filtered"))
+	}
+}
+
+// confirmIngestEstimate prints the estimate of ingesting an archive of
+// archiveBytes and asks whether to go ahead. The question is skipped with
+// --yes, when the user already confirmed the ingest, and when stdin is not
+// a terminal, as under cron; but an ingest estimated not to fit in the
+// free space of the volume fails without a terminal to confirm it on. It
+// returns whether to go ahead.
+func confirmIngestEstimate(db *database.DB, dbPath string, archiveBytes int64, yes, confirmed bool) (bool, error) {
+	if archiveBytes <= 0 || filterStatsOnly {
+		return true, nil
+	}
+	e := estimateIngest(db, dbPath, archiveBytes)
+	e.print(dbPath)
+
+	if !e.fits() {
+		need := downloader.FormatSize(e.DBGrowth + e.IndexGrowth)
+		fmt.Printf("\n⚠️  %s\n", i18n.T("estimate.no_space", need, downloader.FormatSize(e.FreeBytes)))
+		if yes {
+			return true, nil
+		}
+		if !stdinIsTerminal() {
+			return false, fmt.Errorf("the ingest is estimated to need %s, more than the %s free; pass --yes to ingest anyway", need, downloader.FormatSize(e.FreeBytes))
+		}
+		return askYesNo("Continue anyway? [y/N]: ", false), nil
+	}
+	if yes || confirmed || !stdinIsTerminal() {
+		return true, nil
+	}
+	return askYesNo("\nStart the ingest? [Y/n]: ", true), nil
+}
+
+// askYesNo asks a question on stdin, returning def for an empty answer
+func askYesNo(question string, def bool) bool {
+	fmt.Print(question)
+	var response string
+	fmt.Scanln(&response)
+	switch strings.ToLower(response) {
+	case "":
+		return def
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// stdinIsTerminal reports whether stdin is a terminal a question can be
+// asked on
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// databaseBytes returns the bytes of the pages of the database in use, or
+// -1 when they cannot be read
+func databaseBytes(db *database.DB) int64 {
+	u, err := db.SpaceUsage()
+	if err != nil {
+		return -1
+	}
+	return (u.Pages - u.FreePages) * u.PageSize
+}
+
+// measureIngest records the archive size, database growth and time of a
+// completed ingest, which estimate later ones. Filtered ingests keep only
+// part of their archives, so they are not measured.
+func measureIngest(db *database.DB, sp *processor.StreamProcessor, archiveBytes, dbBytesBefore int64, elapsed time.Duration) {
+	if hasFilters() || archiveBytes <= 0 || dbBytesBefore < 0 || sp.IngestID() == "" {
+		return
+	}
+	after := databaseBytes(db)
+	if after < 0 {
+		return
+	}
+	if err := db.MeasureIngest(sp.IngestID(), archiveBytes, after-dbBytesBefore, elapsed); err != nil {
+		fmt.Printf("⚠️  %s\n", i18n.T("estimate.measure_failed", err))
+	}
+}
+
+// dirSize returns the total size of the files under path, or 0 if it
+// cannot be read
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/i18n"
+	"github.com/nishad/srake/internal/processor"
+)
+
+// runIncrementalIngest applies the daily updates published since the last
+// metadata file ingested into the database, oldest first. Each update is
+// recorded once it has been applied, so an interrupted run resumes with
+// the first update that did not complete.
+func runIncrementalIngest(ctx context.Context, manager *downloader.MetadataManager, planOut io.Writer) error {
+	if filterStatsOnly {
+		return fmt.Errorf("--stats-only cannot be combined with --incremental")
+	}
+
+	var filterOpts *processor.FilterOptions
+	if hasFilters() {
+		opts, err := buildFilterOptions()
+		if err != nil {
+			return fmt.Errorf("invalid filter options: %w", err)
+		}
+		filterOpts = opts
+	}
+
+	var db *database.DB
+	var err error
+	if ingestDryRun {
+		db, err = openPlanDatabase(ingestDBPath)
+		if err == nil && db == nil {
+			err = fmt.Errorf("database not found at %s", ingestDBPath)
+		}
+	} else {
+		db, err = openIngestDatabase(ingestDBPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	applied, err := db.ListAppliedUpdates()
+	if err != nil {
+		return fmt.Errorf("failed to read applied updates: %w", err)
+	}
+	appliedNames := make(map[string]bool, len(applied))
+	for _, u := range applied {
+		appliedNames[u.FileName] = true
+	}
+
+	var since time.Time
+	switch {
+	case ingestSince != "":
+		since, err = time.Parse("2006-01-02", ingestSince)
+		if err != nil {
+			return fmt.Errorf("invalid --since date %q (expected YYYY-MM-DD)", ingestSince)
+		}
+	case len(applied) > 0:
+		since = applied[len(applied)-1].FileDate
+	default:
+		return fmt.Errorf("no metadata files have been ingested into %s; ingest a full dataset first with 'srake ingest --monthly', or give the date of the data already in the database with --since", ingestDBPath)
+	}
+
+	fmt.Printf("🔍 Looking for daily updates after %s...\n", since.Format("2006-01-02"))
+	files, err := manager.ListAvailableFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list available files: %w", err)
+	}
+
+	pending := downloader.PendingUpdates(files, since, appliedNames)
+	if ingestDryRun {
+		p := newIngestPlan(db, ingestDBPath)
+		if len(pending) == 0 {
+			p.AddStep("Nothing: the database is up to date")
+		} else if err := planIngestFiles(p, db, pending, false, true); err != nil {
+			return err
+		}
+		return p.Write(planOut, ingestPlanFormat)
+	}
+	if len(pending) == 0 {
+		fmt.Println("\n✅ Database is up to date")
+		return nil
+	}
+
+	// NCBI only keeps daily updates since the last monthly dataset, so an
+	// older database cannot be brought up to date from them
+	if oldest := oldestDailyFile(files); oldest != nil && oldest.Date.After(since.AddDate(0, 0, 1)) {
+		fmt.Printf("\n⚠️  The oldest daily update available is from %s; updates published between %s and then are no longer available.\n",
+			oldest.Date.Format("2006-01-02"), since.Format("2006-01-02"))
+		fmt.Println("   Ingest the latest monthly dataset with 'srake ingest --monthly --force' to catch up.")
+	}
+
+	fmt.Printf("\n📦 %d daily update(s) to apply:\n", len(pending))
+	for _, f := range pending {
+		fmt.Printf("   %s  %s\n", f.Date.Format("2006-01-02"), downloader.FormatSize(f.Size))
+	}
+	if filterOpts != nil {
+		fmt.Printf("\n🔍 Applying filters:\n")
+		fmt.Printf("   %s\n", filterOpts.String())
+	}
+
+	startTime := time.Now()
+	var totalRecords, totalSuppressed int64
+	for i, file := range pending {
+		fmt.Printf("\n🚀 Applying %s (%d/%d)...\n", colorBold(file.Name), i+1, len(pending))
+
+		records, suppressed, err := applyDailyUpdate(ctx, db, file, filterOpts)
+		if err != nil {
+			if err == context.Canceled {
+				fmt.Println("\n❌ " + i18n.T("ingest.cancelled_by_user"))
+				return nil
+			}
+			printIngestHint(err)
+			return fmt.Errorf("failed to apply %s: %w", file.Name, err)
+		}
+
+		if err := db.RecordAppliedUpdate(database.AppliedUpdate{
+			FileName:   file.Name,
+			FileType:   string(file.Type),
+			FileDate:   file.Date,
+			Records:    records,
+			Suppressed: suppressed,
+		}); err != nil {
+			return fmt.Errorf("failed to record applied update %s: %w", file.Name, err)
+		}
+		totalRecords += records
+		totalSuppressed += suppressed
+
+		fmt.Printf("\n   ✓ %d records updated, %d suppressed\n", records, suppressed)
+	}
+
+	fmt.Printf("\n✅ Applied %d daily update(s) in %s\n", len(pending), downloader.FormatDuration(time.Since(startTime)))
+	fmt.Printf("   Records updated:    %d\n", totalRecords)
+	fmt.Printf("   Records suppressed: %d\n", totalSuppressed)
+
+	if !skipStats {
+		fmt.Printf("\n📈 %s", i18n.T("ingest.updating_stats"))
+		if err := db.UpdateStatistics(); err != nil {
+			fmt.Printf(" ⚠️ %s\n", i18n.T("ingest.stats_failed", err))
+		} else {
+			fmt.Printf(" ✓\n")
+		}
+	}
+	reportExpectations(db)
+	reportQuarantine(db, startTime)
+	if ingestOptimize {
+		optimizeDatabase(ctx, db)
+	}
+
+	return nil
+}
+
+// applyDailyUpdate ingests one daily update, removing the records its
+// submissions suppress, and returns the number of records inserted or
+// replaced and the number suppressed.
+func applyDailyUpdate(ctx context.Context, db *database.DB, file downloader.MetadataFile, filterOpts *processor.FilterOptions) (int64, int64, error) {
+	var (
+		sp     *processor.StreamProcessor
+		ingest func() error
+	)
+	if filterOpts != nil {
+		fp, err := processor.NewFilteredProcessor(db, *filterOpts)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to create filtered processor: %w", err)
+		}
+		sp = fp.StreamProcessor
+		ingest = func() error { return fp.ProcessWithFilters(ctx, file.URL) }
+	} else {
+		sp = processor.NewStreamProcessor(db)
+		ingest = func() error { return sp.ProcessURL(ctx, file.URL) }
+	}
+	sp.SetStoreRaw(ingestStoreRaw)
+	sp.SetValidator(ingestValidator())
+	sp.SetTransforms(ingestTransformRules)
+	sp.SetWorkers(ingestWorkers)
+	sp.SetSource(remoteSource())
+	sp.SetApplySuppressions(true)
+	defer attachIngestControls(sp, db)()
+	defer trackIngestMetrics(sp)()
+
+	if !ingestNoProgress {
+		progressBar := newProgressBar(file.Size)
+		sp.SetProgressFunc(func(p processor.Progress) {
+			progressBar.Update(p)
+		})
+		defer progressBar.Finish()
+	}
+
+	if err := ingestWithRetry(ctx, ingest); err != nil {
+		return 0, 0, err
+	}
+
+	stats := sp.GetStats()
+	return stats["records_processed"].(int64), stats["records_suppressed"].(int64), nil
+}
+
+// oldestDailyFile returns the oldest daily update in files, or nil if
+// there is none
+func oldestDailyFile(files []downloader.MetadataFile) *downloader.MetadataFile {
+	var oldest *downloader.MetadataFile
+	for i := range files {
+		if files[i].Type == downloader.FileTypeDaily && (oldest == nil || files[i].Date.Before(oldest.Date)) {
+			oldest = &files[i]
+		}
+	}
+	return oldest
+}
+
+// recordAppliedFile records that a metadata file was ingested, so that a later
+// --incremental run applies only the daily updates published after it.
+// Failures are logged, not fatal.
+func recordAppliedFile(db *database.DB, file *downloader.MetadataFile, records int64) {
+	if file.Type != downloader.FileTypeDaily && file.Type != downloader.FileTypeMonthly {
+		return
+	}
+	if err := db.RecordAppliedUpdate(database.AppliedUpdate{
+		FileName: file.Name,
+		FileType: string(file.Type),
+		FileDate: file.Date,
+		Records:  records,
+	}); err != nil {
+		fmt.Printf("⚠️  Warning: failed to record applied file: %v\n", err)
+	}
+}
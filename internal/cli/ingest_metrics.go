@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nishad/srake/internal/i18n"
+	"github.com/nishad/srake/internal/metrics"
+	"github.com/nishad/srake/internal/processor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pushInterval is how often ingest metrics are pushed to a Pushgateway
+const pushInterval = 15 * time.Second
+
+// ingestMetricsJob is the Pushgateway job ingest metrics are pushed under
+const ingestMetricsJob = "srake_ingest"
+
+// ingestMetrics reports the throughput of an ingest, which may process
+// several files, from the status of the file being processed. The status
+// is read when the metrics are scraped or pushed.
+type ingestMetrics struct {
+	registry *prometheus.Registry
+
+	mu       sync.Mutex
+	current  *processor.StreamProcessor
+	reported processor.Progress // counts of current already added
+	records  float64            // totals over the files of the ingest
+	bytes    float64
+	progress processor.Progress // of the last file processed
+}
+
+// activeIngestMetrics is set while --metrics-addr or --pushgateway is in
+// use
+var activeIngestMetrics *ingestMetrics
+
+func newIngestMetrics() *ingestMetrics {
+	m := &ingestMetrics{registry: prometheus.NewRegistry()}
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "srake_ingest_records_total", Help: "Records processed by the ingest",
+		}, m.read(func() float64 { return m.records })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "srake_ingest_bytes_total", Help: "Archive bytes read by the ingest",
+		}, m.read(func() float64 { return m.bytes })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "srake_ingest_records_per_second", Help: "Records processed per second in the current file",
+		}, m.read(func() float64 {
+			if secs := m.progress.TimeElapsed.Seconds(); secs > 0 {
+				return float64(m.progress.RecordsProcessed) / secs
+			}
+			return 0
+		})),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "srake_ingest_bytes_per_second", Help: "Archive bytes read per second in the current file",
+		}, m.read(func() float64 { return m.progress.BytesPerSecond })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "srake_ingest_file_bytes", Help: "Size of the file being ingested, when known",
+		}, m.read(func() float64 { return float64(m.progress.TotalBytes) })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "srake_ingest_paused", Help: "1 while the ingest is paused",
+		}, m.read(func() float64 {
+			if m.progress.Paused {
+				return 1
+			}
+			return 0
+		})),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "srake_ingest_throttle_level", Help: "Throttle level of the ingest; 0 at full speed",
+		}, m.read(func() float64 { return float64(m.progress.ThrottleLevel) })),
+	)
+	return m
+}
+
+// read returns a function reporting value once the progress made since
+// the last update has been added
+func (m *ingestMetrics) read(value func() float64) func() float64 {
+	return func() float64 {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.updateLocked()
+		return value()
+	}
+}
+
+func (m *ingestMetrics) updateLocked() {
+	if m.current == nil {
+		// Nothing is being processed between files
+		m.progress.TimeElapsed = 0
+		m.progress.BytesPerSecond = 0
+		return
+	}
+	p := m.current.Status()
+	// A retry starts the file over, and its records are counted again
+	m.records += float64(max(p.RecordsProcessed-m.reported.RecordsProcessed, 0))
+	m.bytes += float64(max(p.BytesProcessed-m.reported.BytesProcessed, 0))
+	m.reported = p
+	m.progress = p
+}
+
+// trackIngestMetrics reports the progress of sp until the returned function
+// is called. It does nothing unless metrics were requested.
+func trackIngestMetrics(sp *processor.StreamProcessor) func() {
+	m := activeIngestMetrics
+	if m == nil {
+		return func() {}
+	}
+	m.mu.Lock()
+	m.current = sp
+	m.reported = processor.Progress{}
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.updateLocked()
+		m.current = nil
+	}
+}
+
+// startIngestMetrics serves the ingest metrics at addr and pushes them to
+// gateway every pushInterval, either of which may be empty. The returned
+// function pushes the final values and stops both.
+func startIngestMetrics(addr, gateway string) (func(), error) {
+	m := newIngestMetrics()
+
+	var server *http.Server
+	if addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serve metrics: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(m.registry))
+		server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go server.Serve(listener)
+		fmt.Printf("📈 %s\n", i18n.T("ingest.metrics_serving", listener.Addr()))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var pushing sync.WaitGroup
+	client := &http.Client{Timeout: 10 * time.Second}
+	push := func(ctx context.Context) {
+		if err := metrics.Push(ctx, client, gateway, ingestMetricsJob, m.registry); err != nil {
+			fmt.Printf("\n⚠️  %s\n", i18n.T("ingest.metrics_push", err))
+		}
+	}
+	if gateway != "" {
+		pushing.Add(1)
+		go func() {
+			defer pushing.Done()
+			ticker := time.NewTicker(pushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					push(ctx)
+				}
+			}
+		}()
+	}
+
+	activeIngestMetrics = m
+	return func() {
+		activeIngestMetrics = nil
+		cancel()
+		pushing.Wait()
+		if gateway != "" {
+			push(context.Background())
+		}
+		if server != nil {
+			server.Close()
+		}
+	}, nil
+}
@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/plan"
+)
+
+// ingestTables are the tables an ingest inserts or replaces records in,
+// directly or through triggers
+var ingestTables = []string{
+	"studies", "experiments", "samples", "runs", "submissions", "analyses",
+	"identifiers", "links", "experiment_samples", "sample_runs", "sample_attributes",
+	"sample_pool", "record_sources", "biosamples", "bioprojects", "sketches", "changes",
+}
+
+// startDryRun sends the progress messages of a dry run to stderr, so that
+// stdout holds nothing but the plan. It returns where to write the plan
+// and a function restoring stdout.
+func startDryRun() (io.Writer, func()) {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	return stdout, func() { os.Stdout = stdout }
+}
+
+// openPlanDatabase opens an existing database read-only for a dry run, so
+// that planning never creates or changes it. It returns nil when the
+// database does not exist yet.
+func openPlanDatabase(path string) (*database.DB, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	sqlDB, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return database.Wrap(sqlDB), nil
+}
+
+// newIngestPlan starts the plan of an ingest into the database at path,
+// which db is open on unless it does not exist yet
+func newIngestPlan(db *database.DB, path string) *plan.Plan {
+	p := plan.New("srake ingest")
+	p.Database = path
+	if db == nil {
+		p.AddStep("Create the database at %s", path)
+	}
+	return p
+}
+
+// planIngestFiles adds the steps of ingesting metadata archives to a plan.
+// download is set when the archives are first downloaded with
+// --connections, and updates for daily updates, whose suppressed records
+// are deleted.
+func planIngestFiles(p *plan.Plan, db *database.DB, files []downloader.MetadataFile, download, updates bool) error {
+	for _, f := range files {
+		p.AddSource(f.Name, f.URL, f.Size)
+		if download {
+			dest := filepath.Join(paths.GetDownloadsPath(), f.Name)
+			p.AddOutput(dest, f.Size)
+			p.AddStep("Download %s over %d connections to %s, resuming a partial download", f.Name, ingestConnections, dest)
+		}
+	}
+
+	if hasFilters() {
+		opts, err := buildFilterOptions()
+		if err != nil {
+			return fmt.Errorf("invalid filter options: %w", err)
+		}
+		p.AddStep("Keep only the records matching: %s", opts.String())
+	}
+	if filterStatsOnly {
+		p.AddStep("Count the matching records without storing them")
+		return nil
+	}
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	if ingestBulk {
+		p.AddStep("Drop the secondary indexes of studies, experiments, samples and runs")
+		p.AddStep("Stream %s and stage the records read", strings.Join(names, ", "))
+		p.AddStep("Merge the staged records into their tables, then rebuild the indexes and sample_runs")
+	} else {
+		p.AddStep("Stream %s and insert the records read", strings.Join(names, ", "))
+	}
+	var archiveBytes int64
+	for _, f := range files {
+		archiveBytes += f.Size
+	}
+	if archiveBytes > 0 {
+		e := estimateIngest(db, ingestDBPath, archiveBytes)
+		var dbBytes int64
+		if info, err := os.Stat(ingestDBPath); err == nil {
+			dbBytes = info.Size()
+		}
+		p.AddOutput(ingestDBPath, dbBytes+e.DBGrowth)
+		p.AddStep("Expect about %d records, %s more database and %s more search index, in about %s",
+			e.Records, downloader.FormatSize(e.DBGrowth), downloader.FormatSize(e.IndexGrowth), downloader.FormatDuration(e.Duration))
+	}
+	if db != nil {
+		if stats, err := db.EstimateStats(); err == nil && stats.TotalStudies+stats.TotalExperiments > 0 {
+			p.AddDestructiveStep("Replace the records already in the database (%d studies, %d experiments, %d samples, %d runs) that are read again",
+				stats.TotalStudies, stats.TotalExperiments, stats.TotalSamples, stats.TotalRuns)
+		}
+	}
+	if updates {
+		p.AddDestructiveStep("Delete the records the updates suppress")
+	}
+
+	for _, table := range ingestTables {
+		p.AddTable(table, plan.AccessWrite, 0)
+	}
+	if updates {
+		for _, table := range []string{"studies", "experiments", "samples", "runs"} {
+			p.AddTable(table, plan.AccessDelete, 0)
+		}
+	}
+	if ingestStoreRaw {
+		p.AddTable("raw_records", plan.AccessWrite, 0)
+		p.AddTable("raw_blobs", plan.AccessWrite, 0)
+	}
+	if ingestValidator() != nil {
+		p.AddTable("quarantine", plan.AccessWrite, 0)
+	}
+	var recorded int64
+	for _, f := range files {
+		if f.Type == downloader.FileTypeDaily || f.Type == downloader.FileTypeMonthly {
+			recorded++
+		}
+	}
+	if recorded > 0 {
+		p.AddTable("applied_updates", plan.AccessWrite, recorded)
+	}
+
+	if !skipStats {
+		p.AddTable("statistics", plan.AccessWrite, 0)
+		p.AddStep("Update the database statistics")
+	}
+	if ingestOptimize {
+		p.AddStep("Analyze the database, and vacuum it when over 10%% of it is free space")
+	}
+	return nil
+}
+
+// planLocalIngest returns the plan of ingesting a local archive
+func planLocalIngest(path string) (*plan.Plan, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	db, err := openPlanDatabase(ingestDBPath)
+	if err != nil {
+		return nil, err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	p := newIngestPlan(db, ingestDBPath)
+	file := downloader.MetadataFile{Name: filepath.Base(path), URL: path, Size: stat.Size()}
+	if err := planIngestFiles(p, db, []downloader.MetadataFile{file}, false, false); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/processor"
+)
+
+// loadIngestTransforms loads the attribute transforms --transforms names,
+// or the config's transforms file, returning nil when neither is set
+func loadIngestTransforms() (*processor.Transforms, error) {
+	path := ingestTransforms
+	if path == "" {
+		if cfg, _, err := config.LoadLayered(); err == nil {
+			path = cfg.Transforms
+		}
+	}
+	if path == "" {
+		return nil, nil
+	}
+	return processor.LoadTransforms(path)
+}
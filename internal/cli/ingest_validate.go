@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/i18n"
+	"github.com/nishad/srake/internal/validator"
+)
+
+// ingestValidator returns the validator --validate and --validate-schema
+// select, or nil when records are inserted without validation
+func ingestValidator() *validator.Validator {
+	if !ingestValidate && !ingestValidateSchema {
+		return nil
+	}
+	return validator.NewValidator(validator.ValidationConfig{
+		ValidateEnumerations: true,
+		ValidateReferences:   true,
+		ValidateRequired:     true,
+		Schema:               ingestValidateSchema,
+	})
+}
+
+// reportQuarantine reports the records quarantined since the ingest
+// started, by error type. It prints nothing when records are not
+// validated.
+func reportQuarantine(db *database.DB, since time.Time) {
+	if ingestValidator() == nil {
+		return
+	}
+	summary, err := db.SummarizeQuarantine(since)
+	if err != nil {
+		fmt.Printf("\n⚠️  %s\n", i18n.T("ingest.quarantine_failed", err))
+		return
+	}
+	if summary.Records == 0 {
+		fmt.Printf("\n🧪 %s\n", i18n.T("summary.validation_passed"))
+		return
+	}
+
+	fmt.Printf("\n🧪 %s\n", i18n.T("summary.quarantined", summary.Records))
+	types := make([]string, 0, len(summary.ByType))
+	width := 0
+	for t := range summary.ByType {
+		types = append(types, t)
+		width = max(width, len(t))
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if summary.ByType[types[i]] != summary.ByType[types[j]] {
+			return summary.ByType[types[i]] > summary.ByType[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	for _, t := range types {
+		fmt.Printf("   %-*s %d\n", width, t, summary.ByType[t])
+	}
+	fmt.Printf("   %s\n", i18n.T("summary.quarantine_hint"))
+}
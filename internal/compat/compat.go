@@ -0,0 +1,241 @@
+// Package compat negotiates compatibility between srake clients and API
+// servers of different releases. Each side states the schema version of
+// the API responses it speaks and the oldest one it still understands, so
+// that a version mismatch is reported as an upgrade message instead of
+// surfacing as a decoding error.
+package compat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the version of the /api/v1 request and response
+// schemas. It is increased when a field is removed, renamed or changes
+// type; adding fields or endpoints is compatible and adds a capability
+// instead.
+const SchemaVersion = 1
+
+// MinSchemaVersion is the oldest schema version this release still
+// understands, as a client reading responses and as a server answering
+// requests.
+const MinSchemaVersion = 1
+
+// HTTP headers carrying the versions. Clients send HeaderSchemaVersion
+// with each request; servers send all three with each response.
+const (
+	HeaderVersion          = "Srake-Version"
+	HeaderSchemaVersion    = "Srake-Schema-Version"
+	HeaderMinSchemaVersion = "Srake-Min-Schema-Version"
+)
+
+// VersionPath is the API endpoint reporting a server's Info. It stays
+// under v1, which every release serves, so that clients can find out what
+// servers older than v2 support.
+const VersionPath = "/api/v1/version"
+
+// Capabilities lists the optional API features this release provides.
+// A client checks the server's list before relying on a feature, and
+// falls back when it is missing.
+var Capabilities = []string{
+	"api.v2",
+	"collections",
+	"curation",
+	"export",
+	"export.msgpack",
+	"graphql",
+	"jobs",
+	"jobs.events",
+	"jobs.index",
+	"jobs.ingest",
+	"lookup",
+	"lookup.bulk",
+	"oai-pmh",
+	"openapi",
+	"search",
+	"search.cursor",
+	"search.feedback",
+	"search.hybrid",
+	"search.vector",
+	"validation",
+}
+
+// Info describes the release and API schema of a client or server.
+type Info struct {
+	Version          string   `json:"version"`
+	SchemaVersion    int      `json:"schema_version"`
+	MinSchemaVersion int      `json:"min_schema_version"`
+	Capabilities     []string `json:"capabilities"`
+}
+
+// Local returns the Info of this release.
+func Local(version string) Info {
+	return Info{
+		Version:          version,
+		SchemaVersion:    SchemaVersion,
+		MinSchemaVersion: MinSchemaVersion,
+		Capabilities:     Capabilities,
+	}
+}
+
+// Has reports whether the release provides a capability.
+func (i Info) Has(capability string) bool {
+	for _, c := range i.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is the outcome of comparing a client with a server.
+type Result struct {
+	// Compatible is false when one side is too old for the other
+	Compatible bool
+
+	// SchemaVersion is the schema version both sides speak: the lower of
+	// the two when they are compatible
+	SchemaVersion int
+
+	// Upgrade names the side that must be upgraded: "client", "server",
+	// or empty when none must
+	Upgrade string
+
+	// Missing lists the client's capabilities that the server lacks,
+	// which the client must do without
+	Missing []string
+
+	// Message explains the result, with the upgrade to make
+	Message string
+}
+
+// Check compares a client with the server it talks to.
+func Check(client, server Info) Result {
+	switch {
+	case client.SchemaVersion < server.MinSchemaVersion:
+		return Result{
+			Upgrade: "client",
+			Message: fmt.Sprintf("srake %s (API schema %d) is too old for the server, which runs srake %s and requires schema %d or newer; run 'srake self-update'",
+				orUnknown(client.Version), client.SchemaVersion, orUnknown(server.Version), server.MinSchemaVersion),
+		}
+	case server.SchemaVersion < client.MinSchemaVersion:
+		return Result{
+			Upgrade: "server",
+			Message: fmt.Sprintf("the server runs srake %s (API schema %d), which is too old for srake %s (requires schema %d or newer); ask the server administrator to upgrade it",
+				orUnknown(server.Version), server.SchemaVersion, orUnknown(client.Version), client.MinSchemaVersion),
+		}
+	}
+
+	result := Result{
+		Compatible:    true,
+		SchemaVersion: client.SchemaVersion,
+	}
+	if server.SchemaVersion < result.SchemaVersion {
+		result.SchemaVersion = server.SchemaVersion
+	}
+	for _, c := range client.Capabilities {
+		if !server.Has(c) {
+			result.Missing = append(result.Missing, c)
+		}
+	}
+	sort.Strings(result.Missing)
+
+	switch {
+	case len(result.Missing) > 0:
+		result.Message = fmt.Sprintf("the server runs an older srake (%s) without %s; these features are unavailable until it is upgraded",
+			orUnknown(server.Version), strings.Join(result.Missing, ", "))
+	case server.SchemaVersion > client.SchemaVersion:
+		result.Message = fmt.Sprintf("the server runs a newer srake (%s); run 'srake self-update' to use its new features",
+			orUnknown(server.Version))
+	default:
+		result.Message = "client and server are compatible"
+	}
+	return result
+}
+
+// ClientTooOld reports whether a request's schema version, as sent in
+// HeaderSchemaVersion, is older than this release can answer. Requests
+// without the header, such as those from browsers and generated clients,
+// are never rejected.
+func ClientTooOld(r *http.Request) (int, bool) {
+	v, err := strconv.Atoi(r.Header.Get(HeaderSchemaVersion))
+	if err != nil {
+		return 0, false
+	}
+	return v, v < MinSchemaVersion
+}
+
+// SetHeaders adds a server's versions to a response.
+func SetHeaders(h http.Header, version string) {
+	h.Set(HeaderVersion, version)
+	h.Set(HeaderSchemaVersion, strconv.Itoa(SchemaVersion))
+	h.Set(HeaderMinSchemaVersion, strconv.Itoa(MinSchemaVersion))
+}
+
+// Negotiate fetches the Info of the server at baseURL and checks it
+// against the client. Servers from before negotiation existed have no
+// version endpoint; they are reported as needing an upgrade rather than
+// as an error.
+func Negotiate(ctx context.Context, client *http.Client, baseURL string, local Info) (*Info, Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+VersionPath, nil)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	req.Header.Set(HeaderSchemaVersion, strconv.Itoa(local.SchemaVersion))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, Result{}, fmt.Errorf("cannot reach server: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, Result{}, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUpgradeRequired:
+		server := infoFromHeaders(resp.Header)
+		return &server, Check(local, server), nil
+	case http.StatusNotFound:
+		if resp.Header.Get(HeaderSchemaVersion) == "" {
+			server := Info{Version: "unknown"}
+			return &server, Result{
+				Upgrade: "server",
+				Message: "the server runs a srake release from before version negotiation; ask the server administrator to upgrade it",
+			}, nil
+		}
+		fallthrough
+	default:
+		return nil, Result{}, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	var server Info
+	if err := json.Unmarshal(body, &server); err != nil || server.SchemaVersion == 0 {
+		return nil, Result{}, fmt.Errorf("%s does not look like a srake server", baseURL)
+	}
+	return &server, Check(local, server), nil
+}
+
+// infoFromHeaders reads a server's versions from its response headers
+func infoFromHeaders(h http.Header) Info {
+	info := Info{Version: h.Get(HeaderVersion)}
+	info.SchemaVersion, _ = strconv.Atoi(h.Get(HeaderSchemaVersion))
+	info.MinSchemaVersion, _ = strconv.Atoi(h.Get(HeaderMinSchemaVersion))
+	return info
+}
+
+func orUnknown(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
@@ -0,0 +1,98 @@
+package compat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	client := Info{Version: "v1.4.0", SchemaVersion: 3, MinSchemaVersion: 2, Capabilities: []string{"search", "search.cursor", "jobs"}}
+
+	tests := []struct {
+		name       string
+		server     Info
+		compatible bool
+		upgrade    string
+		schema     int
+		missing    []string
+	}{
+		{"same", Info{SchemaVersion: 3, MinSchemaVersion: 2, Capabilities: client.Capabilities}, true, "", 3, nil},
+		{"older server", Info{SchemaVersion: 2, MinSchemaVersion: 1, Capabilities: []string{"search"}}, true, "", 2, []string{"jobs", "search.cursor"}},
+		{"newer server", Info{SchemaVersion: 4, MinSchemaVersion: 3, Capabilities: client.Capabilities}, true, "", 3, nil},
+		{"server too old", Info{SchemaVersion: 1, MinSchemaVersion: 1}, false, "server", 0, nil},
+		{"client too old", Info{SchemaVersion: 5, MinSchemaVersion: 4}, false, "client", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(client, tt.server)
+			if got.Compatible != tt.compatible || got.Upgrade != tt.upgrade || got.SchemaVersion != tt.schema {
+				t.Errorf("got compatible=%v upgrade=%q schema=%d, want %v %q %d (%s)",
+					got.Compatible, got.Upgrade, got.SchemaVersion, tt.compatible, tt.upgrade, tt.schema, got.Message)
+			}
+			if !reflect.DeepEqual(got.Missing, tt.missing) {
+				t.Errorf("missing = %v, want %v", got.Missing, tt.missing)
+			}
+			if got.Message == "" {
+				t.Error("expected a message")
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	server := Info{Version: "v1.2.0", SchemaVersion: 2, MinSchemaVersion: 2, Capabilities: []string{"search"}}
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != VersionPath {
+			http.NotFound(w, r)
+			return
+		}
+		sent = r.Header.Get(HeaderSchemaVersion)
+		w.Header().Set(HeaderVersion, server.Version)
+		w.Header().Set(HeaderSchemaVersion, "2")
+		w.Header().Set(HeaderMinSchemaVersion, "2")
+		if sent == "1" {
+			w.WriteHeader(http.StatusUpgradeRequired)
+			return
+		}
+		json.NewEncoder(w).Encode(server)
+	}))
+	defer srv.Close()
+
+	local := Info{Version: "v1.3.0", SchemaVersion: 2, MinSchemaVersion: 1, Capabilities: []string{"search", "jobs"}}
+	got, result, err := Negotiate(context.Background(), srv.Client(), srv.URL+"/", local)
+	if err != nil {
+		t.Fatalf("Negotiate failed: %v", err)
+	}
+	if sent != "2" {
+		t.Errorf("expected the client schema version in the request, got %q", sent)
+	}
+	if got.Version != "v1.2.0" || !result.Compatible || !reflect.DeepEqual(result.Missing, []string{"jobs"}) {
+		t.Errorf("unexpected negotiation: %+v %+v", got, result)
+	}
+
+	// A server that turns the client away still reports its versions
+	local.SchemaVersion = 1
+	_, result, err = Negotiate(context.Background(), srv.Client(), srv.URL, local)
+	if err != nil {
+		t.Fatalf("Negotiate failed: %v", err)
+	}
+	if result.Compatible || result.Upgrade != "client" {
+		t.Errorf("expected the client to need an upgrade, got %+v", result)
+	}
+
+	// Servers from before negotiation have no version endpoint
+	old := httptest.NewServer(http.NotFoundHandler())
+	defer old.Close()
+	_, result, err = Negotiate(context.Background(), old.Client(), old.URL, local)
+	if err != nil {
+		t.Fatalf("Negotiate failed: %v", err)
+	}
+	if result.Compatible || result.Upgrade != "server" {
+		t.Errorf("expected the server to need an upgrade, got %+v", result)
+	}
+}
@@ -16,6 +16,19 @@ type Config struct {
 	Search        SearchConfig    `yaml:"search"`   // Optional search
 	Vectors       VectorConfig    `yaml:"vectors"`  // Optional vectors
 	Embeddings    EmbeddingConfig `yaml:"embeddings"`
+	Catalog       CatalogConfig   `yaml:"catalog"` // Published metadata
+	Retention     RetentionConfig `yaml:"retention"`
+	Guardrails    GuardrailConfig `yaml:"guardrails"`
+	Retry         RetryConfig     `yaml:"retry"` // Download and ingest retries
+	Server        ServerConfig    `yaml:"server"`
+
+	// Metadata dump mirrors for ingest --source, by source name
+	Mirrors map[string]MirrorConfig `yaml:"mirrors"`
+
+	// Transforms is a YAML file of attribute rewrites ingest applies to
+	// the records of centers with nonstandard encodings; ingest
+	// --transforms overrides it
+	Transforms string `yaml:"transforms"`
 }
 
 // DatabaseConfig contains SQLite database settings
@@ -24,6 +37,22 @@ type DatabaseConfig struct {
 	CacheSize   int    `yaml:"cache_size"`   // in KB
 	MMapSize    int64  `yaml:"mmap_size"`    // in bytes
 	JournalMode string `yaml:"journal_mode"` // WAL
+
+	// Mode is primary, which ingests and serves, or replica, which serves
+	// a read-only copy kept by Replication: litestream or litefs
+	Mode        string `yaml:"mode"`
+	Replication string `yaml:"replication"`
+	MaxLag      int    `yaml:"max_lag"` // Seconds a replica may go without a change before /readyz fails; 0 for no limit
+
+	Archive ArchiveConfig `yaml:"archive"` // Cold storage of old runs
+}
+
+// ArchiveConfig sets which runs 'srake db archive' moves out of the
+// database, and where to
+type ArchiveConfig struct {
+	RunYears  int    `yaml:"run_years"` // Archive runs published more than this many years ago
+	Format    string `yaml:"format"`    // sqlite (queryable with --include-archived) or parquet
+	Directory string `yaml:"directory"` // Where archive files are written
 }
 
 // SearchConfig contains search-related settings
@@ -38,6 +67,27 @@ type SearchConfig struct {
 	BatchSize      int    `yaml:"batch_size"`       // Indexing batch size
 	UseCache       bool   `yaml:"use_cache"`        // Enable search cache
 	CacheTTL       int    `yaml:"cache_ttl"`        // Cache TTL in seconds
+	Shards         int    `yaml:"shards"`           // Bleve index shards for new indexes (1 = unsharded)
+
+	// Cross-encoder reordering the top results of searches asking for it
+	RerankModel      string `yaml:"rerank_model"`      // HuggingFace repo, installed with 'srake models pull'
+	RerankCandidates int    `yaml:"rerank_candidates"` // Top results reranked
+
+	// Adds the synonyms of query terms from vocabularies loaded by 'srake
+	// ontology load' to text searches
+	ExpandSynonyms bool `yaml:"expand_synonyms"`
+
+	// Numeric sample attributes bucketed into facet ranges at index time
+	AttributeRanges []AttributeRangeConfig `yaml:"attribute_ranges"`
+}
+
+// AttributeRangeConfig buckets a numeric sample attribute into facet ranges
+// when samples are indexed. Values given in other units of the same
+// quantity, such as months for an age in years, are converted first.
+type AttributeRangeConfig struct {
+	Attribute string    `yaml:"attribute"` // Attribute tag, e.g. age
+	Units     string    `yaml:"units"`     // Units of the bounds, e.g. years
+	Bounds    []float64 `yaml:"bounds"`    // Ascending bucket boundaries
 }
 
 // VectorConfig contains vector search settings
@@ -61,6 +111,175 @@ type EmbeddingConfig struct {
 	MaxTextLength   int      `yaml:"max_text_length"`  // Max tokens
 	CombineFields   []string `yaml:"combine_fields"`   // Fields to combine for embedding
 	CacheEmbeddings bool     `yaml:"cache_embeddings"` // Cache computed embeddings
+
+	ExecutionProvider string `yaml:"execution_provider"` // cpu, cuda, or coreml
+	Sessions          int    `yaml:"sessions"`           // Concurrent ONNX sessions; 0 picks from the CPUs
+	MaxBatchTokens    int    `yaml:"max_batch_tokens"`   // Padded tokens per inference batch
+}
+
+// CatalogConfig describes how a served srake catalog presents itself in
+// published metadata such as Bioschemas markup
+type CatalogConfig struct {
+	BaseURL       string `yaml:"base_url"`       // Public URL of the web UI
+	PublisherName string `yaml:"publisher_name"` // Organization hosting the catalog
+	PublisherURL  string `yaml:"publisher_url"`
+	License       string `yaml:"license"`     // License URL for the metadata
+	AdminEmail    string `yaml:"admin_email"` // OAI-PMH repository contact
+}
+
+// RetentionConfig limits how long ingest bookkeeping, caches, and other
+// generated files are kept. Ages are in days and sizes in MB; 0 disables
+// the limit.
+type RetentionConfig struct {
+	AutoCleanup     bool   `yaml:"auto_cleanup"`      // Clean up periodically while the server runs
+	CleanupInterval int    `yaml:"cleanup_interval"`  // Automatic cleanup interval in hours
+	ProgressDays    int    `yaml:"progress_days"`     // Finished ingest progress, checkpoints, processed files
+	KeepCheckpoints int    `yaml:"keep_checkpoints"`  // Checkpoints kept per unfinished ingest
+	DownloadDays    int    `yaml:"download_days"`     // Downloaded archives
+	DownloadMaxMB   int64  `yaml:"download_max_mb"`   // Total size of downloaded archives
+	SearchCacheDays int    `yaml:"search_cache_days"` // Query result cache
+	SnapshotDays    int    `yaml:"snapshot_days"`     // Index build snapshots
+	SnapshotMaxMB   int64  `yaml:"snapshot_max_mb"`   // Total size of index build snapshots
+	SnapshotDir     string `yaml:"snapshot_dir"`      // Index build snapshot directory
+	JobDays         int    `yaml:"job_days"`          // Finished background jobs and their results
+}
+
+// Guardrail actions, taken on queries estimated to read more rows than
+// GuardrailConfig.MaxRows
+const (
+	GuardrailForce  = "force"  // Run them only with --force
+	GuardrailRefuse = "refuse" // Never run them
+)
+
+// GuardrailConfig stops database-only searches, searches collecting their
+// hits, and exports whose estimated cost is above a threshold, before they
+// run
+type GuardrailConfig struct {
+	MaxRows int64  `yaml:"max_rows"` // Estimated rows or documents read (0 = no limit)
+	Action  string `yaml:"action"`   // force or refuse
+}
+
+// RetryConfig sets how downloads and ingests retry each kind of failure
+type RetryConfig struct {
+	Network       RetryPolicyConfig `yaml:"network"`       // Connection failures, 5xx, 429
+	Remote        RetryPolicyConfig `yaml:"remote"`        // Other 4xx responses
+	Decompression RetryPolicyConfig `yaml:"decompression"` // Corrupt gzip or tar data
+	Parse         RetryPolicyConfig `yaml:"parse"`         // Malformed XML
+	Constraint    RetryPolicyConfig `yaml:"constraint"`    // Database constraint violations
+	DiskFull      RetryPolicyConfig `yaml:"disk_full"`
+}
+
+// RetryPolicyConfig is the retry policy for one kind of failure. Delays
+// are in seconds and double after each retry.
+type RetryPolicyConfig struct {
+	MaxAttempts int `yaml:"max_attempts"` // Including the first; 1 disables retries
+	Delay       int `yaml:"delay"`        // Before the first retry
+	MaxDelay    int `yaml:"max_delay"`
+}
+
+// ServerConfig contains API server settings
+type ServerConfig struct {
+	Host      string          `yaml:"host"`
+	Port      int             `yaml:"port"`
+	GRPCPort  int             `yaml:"grpc_port"` // Serve the gRPC API on this port; 0 leaves it off
+	CORS      CORSConfig      `yaml:"cors"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Metrics   bool            `yaml:"metrics"` // Serve Prometheus metrics at /metrics
+	UI        bool            `yaml:"ui"`      // Serve the web UI at /ui/
+	Auth      AuthConfig      `yaml:"auth"`
+
+	// LogLevel sets which requests are logged: debug, info (all), warn
+	// (failed) or error (server errors)
+	LogLevel string `yaml:"log_level"`
+
+	// ReadOnly refuses requests that change the database, such as
+	// curation and collections, and jobs that ingest or rebuild the index
+	ReadOnly bool `yaml:"read_only"`
+
+	// IngestDir is the directory from which ingest jobs submitted to the
+	// API may read archives. When empty, they may only fetch archives
+	// from the NCBI, ENA and DDBJ mirrors.
+	IngestDir string `yaml:"ingest_dir"`
+
+	Warmup     WarmupConfig     `yaml:"warmup"`
+	Popularity PopularityConfig `yaml:"popularity"`
+
+	// APISunset maps deprecated REST API versions, such as v1, to the date
+	// as YYYY-MM-DD after which they may be removed, announced in the
+	// Sunset header of their responses
+	APISunset map[string]string `yaml:"api_sunset"`
+}
+
+// WarmupConfig sets what the server loads on startup before /readyz
+// reports it ready, so that the first searches after a deploy do not wait
+// for the index to open and the database to be read from disk
+type WarmupConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Queries []string `yaml:"queries"` // Searched once each
+	Timeout int      `yaml:"timeout"` // Seconds before reporting ready regardless; 0 waits
+}
+
+// PopularityConfig sets whether the server counts how often studies and
+// runs are returned by searches and fetched, which 'srake report popular'
+// lists and searches with boost_popular rank by
+type PopularityConfig struct {
+	Enabled       bool    `yaml:"enabled"`        // Count requests; off by default
+	FlushInterval int     `yaml:"flush_interval"` // Seconds between writes of the counts to the database
+	WindowDays    int     `yaml:"window_days"`    // Days of counts boost_popular reads; 0 reads them all
+	BoostWeight   float64 `yaml:"boost_weight"`   // Score added per natural log of the count, as a fraction
+}
+
+// AuthConfig requires an API key on every request but health checks.
+// Keys are listed here or created with 'srake server keys create'.
+type AuthConfig struct {
+	Enabled bool           `yaml:"enabled"`
+	Keys    []APIKeyConfig `yaml:"keys"`
+}
+
+// APIKeyConfig is an API key accepted by the server. The key is given
+// either as is or as its SHA-256 hash in hex, which keeps it out of the
+// config file.
+type APIKeyConfig struct {
+	Name              string  `yaml:"name"`
+	Key               string  `yaml:"key,omitempty"`
+	KeySHA256         string  `yaml:"key_sha256,omitempty"`
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty"` // 0 uses rate_limit
+	Burst             int     `yaml:"burst,omitempty"`
+	ReadOnly          bool    `yaml:"read_only,omitempty"` // Refuse writes made with this key
+}
+
+// CORSConfig sets which web origins may call the API
+type CORSConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	AllowedOrigins []string `yaml:"allowed_origins"` // "*" allows any origin
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	MaxAge         int      `yaml:"max_age"` // Seconds browsers may cache a preflight
+}
+
+// RateLimitConfig limits the requests each client address may make
+type RateLimitConfig struct {
+	Enabled           bool    `yaml:"enabled"`
+	RequestsPerSecond float64 `yaml:"requests_per_second"` // Sustained rate
+	Burst             int     `yaml:"burst"`               // Requests allowed at once
+}
+
+// TLSConfig serves the API over HTTPS
+type TLSConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CertFile   string `yaml:"cert_file"`   // PEM certificate chain
+	KeyFile    string `yaml:"key_file"`    // PEM private key
+	MinVersion string `yaml:"min_version"` // 1.2 or 1.3
+}
+
+// MirrorConfig overrides where a source publishes its metadata dumps.
+// Empty fields keep the built-in values.
+type MirrorConfig struct {
+	ListingURL     string `yaml:"listing_url"`     // Directory listing of the dumps
+	FileURL        string `yaml:"file_url"`        // URL template; {name} is the file name
+	DailyPattern   string `yaml:"daily_pattern"`   // Regexp of daily updates; group 1 is YYYYMMDD
+	MonthlyPattern string `yaml:"monthly_pattern"` // Regexp of full datasets
 }
 
 // DefaultConfig returns the default configuration
@@ -74,18 +293,32 @@ func DefaultConfig() *Config {
 			CacheSize:   10000,     // 40MB
 			MMapSize:    268435456, // 256MB
 			JournalMode: "WAL",
+			Mode:        "primary",
+			Archive: ArchiveConfig{
+				RunYears:  10,
+				Format:    "sqlite",
+				Directory: filepath.Join(p.DataDir, "archive"),
+			},
 		},
 		Search: SearchConfig{
-			Enabled:        true,
-			Backend:        getSearchBackend(),
-			IndexPath:      paths.GetIndexPath(),
-			RebuildOnStart: false,
-			AutoSync:       true,
-			SyncInterval:   300, // 5 minutes
-			DefaultLimit:   100,
-			BatchSize:      1000,
-			UseCache:       true,
-			CacheTTL:       3600,
+			Enabled:          true,
+			Backend:          getSearchBackend(),
+			IndexPath:        paths.GetIndexPath(),
+			RebuildOnStart:   false,
+			AutoSync:         true,
+			SyncInterval:     300, // 5 minutes
+			DefaultLimit:     100,
+			BatchSize:        1000,
+			UseCache:         true,
+			CacheTTL:         3600,
+			Shards:           1,
+			RerankModel:      "cross-encoder/ms-marco-MiniLM-L-6-v2",
+			RerankCandidates: 50,
+			ExpandSynonyms:   true,
+			AttributeRanges: []AttributeRangeConfig{
+				{Attribute: "age", Units: "years", Bounds: []float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}},
+				{Attribute: "coverage", Units: "x", Bounds: []float64{0, 10, 20, 30, 50, 100}},
+			},
 		},
 		Vectors: VectorConfig{
 			Enabled:          true,
@@ -96,14 +329,16 @@ func DefaultConfig() *Config {
 			Optimization:     "memory_efficient",
 		},
 		Embeddings: EmbeddingConfig{
-			Enabled:         true,
-			ModelsDirectory: paths.GetModelsPath(),
-			DefaultModel:    "Xenova/SapBERT-from-PubMedBERT-fulltext",
-			DefaultVariant:  "quantized",
-			BatchSize:       32,
-			NumThreads:      4,
-			MaxTextLength:   512,
-			CacheEmbeddings: true,
+			Enabled:           true,
+			ModelsDirectory:   paths.GetModelsPath(),
+			DefaultModel:      "Xenova/SapBERT-from-PubMedBERT-fulltext",
+			DefaultVariant:    "quantized",
+			BatchSize:         32,
+			NumThreads:        4,
+			MaxTextLength:     512,
+			CacheEmbeddings:   true,
+			ExecutionProvider: "cpu",
+			MaxBatchTokens:    8192,
 			CombineFields: []string{
 				"organism",
 				"library_strategy",
@@ -111,10 +346,69 @@ func DefaultConfig() *Config {
 				"abstract",
 			},
 		},
+		Retention: RetentionConfig{
+			AutoCleanup:     true,
+			CleanupInterval: 24,
+			ProgressDays:    30,
+			KeepCheckpoints: 10,
+			DownloadDays:    30,
+			SearchCacheDays: 7,
+			SnapshotDays:    14,
+			SnapshotDir:     ".srake/checkpoints",
+			JobDays:         7,
+		},
+		Guardrails: GuardrailConfig{
+			MaxRows: 10000000,
+			Action:  GuardrailForce,
+		},
+		Retry: RetryConfig{
+			Network:       RetryPolicyConfig{MaxAttempts: 5, Delay: 5, MaxDelay: 60},
+			Remote:        RetryPolicyConfig{MaxAttempts: 1},
+			Decompression: RetryPolicyConfig{MaxAttempts: 2, Delay: 5, MaxDelay: 5},
+			Parse:         RetryPolicyConfig{MaxAttempts: 1},
+			Constraint:    RetryPolicyConfig{MaxAttempts: 1},
+			DiskFull:      RetryPolicyConfig{MaxAttempts: 1},
+		},
+		Server: ServerConfig{
+			Host:     "0.0.0.0",
+			Port:     8080,
+			LogLevel: "info",
+			CORS: CORSConfig{
+				Enabled:        true,
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+				AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
+			},
+			RateLimit: RateLimitConfig{
+				Enabled:           false,
+				RequestsPerSecond: 10,
+				Burst:             20,
+			},
+			TLS:     TLSConfig{MinVersion: "1.2"},
+			Metrics: true,
+			UI:      true,
+			Warmup: WarmupConfig{
+				Enabled: true,
+				Queries: []string{"cancer", "RNA-Seq", "Homo sapiens", "single cell"},
+				Timeout: 300,
+			},
+			Popularity: PopularityConfig{
+				FlushInterval: 60,
+				WindowDays:    90,
+				BoostWeight:   0.1,
+			},
+		},
+		// Empty overrides, listed so that their settings are known
+		Mirrors: map[string]MirrorConfig{
+			"ncbi": {},
+			"ena":  {},
+			"ddbj": {},
+		},
 	}
 }
 
-// Load loads configuration from a file
+// Load loads configuration from a YAML or TOML file, the format chosen by
+// its extension, and applies environment variable overrides
 func Load(path string) (*Config, error) {
 	// Start with defaults
 	config := DefaultConfig()
@@ -132,23 +426,38 @@ func Load(path string) (*Config, error) {
 	}
 
 	// Parse YAML
+	if data, err = toYAML(path, data); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
 	if err := yaml.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if _, err := applyEnv(config); err != nil {
+		return nil, err
+	}
 
+	config.finalize()
+	return config, nil
+}
+
+// finalize expands paths and resolves settings that depend on each other
+// once all config files have been applied
+func (c *Config) finalize() {
 	// Validate and expand paths
-	config.DataDirectory = expandPath(config.DataDirectory)
-	config.Database.Path = expandPath(config.Database.Path)
-	config.Search.IndexPath = expandPath(config.Search.IndexPath)
-	config.Embeddings.ModelsDirectory = expandPath(config.Embeddings.ModelsDirectory)
+	c.DataDirectory = expandPath(c.DataDirectory)
+	c.Database.Path = expandPath(c.Database.Path)
+	c.Database.Archive.Directory = expandPath(c.Database.Archive.Directory)
+	c.Search.IndexPath = expandPath(c.Search.IndexPath)
+	c.Embeddings.ModelsDirectory = expandPath(c.Embeddings.ModelsDirectory)
+	c.Retention.SnapshotDir = expandPath(c.Retention.SnapshotDir)
+	c.Server.TLS.CertFile = expandPath(c.Server.TLS.CertFile)
+	c.Server.TLS.KeyFile = expandPath(c.Server.TLS.KeyFile)
 
 	// Validate vector config
-	if config.Vectors.Enabled && config.Vectors.RequiresSearch && !config.Search.Enabled {
+	if c.Vectors.Enabled && c.Vectors.RequiresSearch && !c.Search.Enabled {
 		// Disable vectors if search is disabled
-		config.Vectors.Enabled = false
+		c.Vectors.Enabled = false
 	}
-
-	return config, nil
 }
 
 // Save saves the configuration to a file
@@ -173,7 +482,9 @@ func (c *Config) Save(path string) error {
 	return nil
 }
 
-// GetConfigPath returns the default config file path
+// GetConfigPath returns the most specific config file: SRAKE_CONFIG, then
+// srake.yaml in the working directory, then the user config. This is the
+// file 'srake config edit' opens; LoadLayered merges all of them.
 func GetConfigPath() string {
 	// Check environment variable first
 	if path := os.Getenv("SRAKE_CONFIG"); path != "" {
@@ -181,8 +492,8 @@ func GetConfigPath() string {
 	}
 
 	// Check current directory
-	if _, err := os.Stat("srake.yaml"); err == nil {
-		return "srake.yaml"
+	if _, err := os.Stat(ProjectConfigFile); err == nil {
+		return ProjectConfigFile
 	}
 
 	// Use default location
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -95,6 +96,36 @@ search:
 	}
 }
 
+func TestLoadRetention(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+
+	yamlContent := `
+retention:
+  progress_days: 3
+  download_max_mb: 2048
+`
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0600); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Retention.ProgressDays != 3 {
+		t.Errorf("expected progress_days 3, got %d", cfg.Retention.ProgressDays)
+	}
+	if cfg.Retention.DownloadMaxMB != 2048 {
+		t.Errorf("expected download_max_mb 2048, got %d", cfg.Retention.DownloadMaxMB)
+	}
+	// Unset keys keep their defaults
+	if cfg.Retention.DownloadDays != 30 || !cfg.Retention.AutoCleanup {
+		t.Errorf("expected default retention settings to be kept, got %+v", cfg.Retention)
+	}
+}
+
 func TestLoadInvalidYAML(t *testing.T) {
 	dir := t.TempDir()
 	configPath := filepath.Join(dir, "config.yaml")
@@ -316,3 +347,311 @@ func TestGetSearchBackend(t *testing.T) {
 		t.Errorf("expected backend 'bleve' from env, got %q", result)
 	}
 }
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) Layer {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return Layer{Name: strings.TrimSuffix(name, ".yaml"), Path: path, Exists: true}
+	}
+
+	layers := []Layer{
+		write("system.yaml", `
+database:
+  path: /shared/srake.db
+search:
+  default_limit: 50
+retention:
+  job_days: 30
+mirrors:
+  ena:
+    listing_url: https://mirror.example.org/Metadata/
+`),
+		write("user.yaml", `
+search:
+  default_limit: 200
+  backnd: bleve
+retention:
+  job_days: 30
+`),
+		{Name: "project", Path: filepath.Join(dir, "missing.yaml")},
+	}
+
+	cfg, report, err := LoadLayers(layers)
+	if err != nil {
+		t.Fatalf("LoadLayers failed: %v", err)
+	}
+
+	// Later layers override earlier ones; untouched settings fall through
+	if cfg.Database.Path != "/shared/srake.db" {
+		t.Errorf("expected system database path, got %q", cfg.Database.Path)
+	}
+	if cfg.Search.DefaultLimit != 200 {
+		t.Errorf("expected user default_limit 200, got %d", cfg.Search.DefaultLimit)
+	}
+	if cfg.Search.BatchSize != 1000 {
+		t.Errorf("expected default batch_size, got %d", cfg.Search.BatchSize)
+	}
+	if cfg.Mirrors["ena"].ListingURL != "https://mirror.example.org/Metadata/" {
+		t.Errorf("expected ena mirror override, got %q", cfg.Mirrors["ena"].ListingURL)
+	}
+
+	// Only keys set to different values conflict
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Key != "search.default_limit" {
+		t.Fatalf("expected one conflict on search.default_limit, got %+v", report.Conflicts)
+	}
+	values := report.Conflicts[0].Values
+	if len(values) != 2 || values[0].Layer != "system" || values[1].Value != "200" {
+		t.Errorf("unexpected conflict values: %+v", values)
+	}
+
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "search.backnd") {
+		t.Errorf("expected unknown setting warning, got %v", report.Warnings)
+	}
+
+	var jobDays *Setting
+	for i := range report.Settings {
+		if report.Settings[i].Key == "retention.job_days" {
+			jobDays = &report.Settings[i]
+		}
+	}
+	if jobDays == nil || jobDays.Layer != "user" || jobDays.Value != "30" {
+		t.Errorf("expected retention.job_days from user layer, got %+v", jobDays)
+	}
+}
+
+func TestLoadLayersInvalidYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("search: [unclosed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := LoadLayers([]Layer{{Name: LayerUser, Path: path, Exists: true}})
+	if err == nil || !strings.Contains(err.Error(), "user config") {
+		t.Errorf("expected parse error naming the layer, got %v", err)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system.yaml")
+	if err := os.WriteFile(system, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SRAKE_SYSTEM_CONFIG", system)
+	t.Setenv("SRAKE_CONFIG", filepath.Join(dir, "explicit.yaml"))
+
+	layers := Layers()
+	var names []string
+	for _, l := range layers {
+		names = append(names, l.Name)
+	}
+	want := []string{LayerSystem, LayerUser, LayerProject, LayerExplicit}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected layers %v, got %v", want, names)
+	}
+	if layers[0].Path != system || !layers[0].Exists {
+		t.Errorf("expected existing system layer at %s, got %+v", system, layers[0])
+	}
+	if layers[3].Exists {
+		t.Errorf("expected missing explicit layer, got %+v", layers[3])
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.toml")
+	content := `# srake server settings
+[database]
+path = "/srv/srake/metadata.db"
+
+[search]
+index_path = '/srv/srake/index'
+default_limit = 1_000
+
+[[search.attribute_ranges]]
+attribute = "age"
+units = "years"
+bounds = [
+  0, 18, 65,   # adults
+  120,
+]
+
+[embeddings]
+default_model = "Xenova/SapBERT-from-PubMedBERT-fulltext"
+num_threads = 8
+
+[server]
+port = 8443
+cors = { enabled = true, allowed_origins = ["https://sra.example.org"] }
+rate_limit.enabled = true
+rate_limit.requests_per_second = 2.5
+
+[server.tls]
+enabled = true
+cert_file = "/etc/srake/tls/cert.pem"
+key_file = "/etc/srake/tls/key.pem"
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, report, err := LoadLayers([]Layer{{Name: LayerExplicit, Path: path, Exists: true}})
+	if err != nil {
+		t.Fatalf("LoadLayers failed: %v", err)
+	}
+	if len(report.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", report.Warnings)
+	}
+
+	if cfg.Database.Path != "/srv/srake/metadata.db" || cfg.Search.IndexPath != "/srv/srake/index" {
+		t.Errorf("unexpected paths %q, %q", cfg.Database.Path, cfg.Search.IndexPath)
+	}
+	if cfg.Search.DefaultLimit != 1000 {
+		t.Errorf("expected default_limit 1000, got %d", cfg.Search.DefaultLimit)
+	}
+	if len(cfg.Search.AttributeRanges) != 1 || len(cfg.Search.AttributeRanges[0].Bounds) != 4 {
+		t.Errorf("unexpected attribute ranges %+v", cfg.Search.AttributeRanges)
+	}
+	if cfg.Embeddings.NumThreads != 8 {
+		t.Errorf("expected 8 embedding threads, got %d", cfg.Embeddings.NumThreads)
+	}
+	s := cfg.Server
+	if s.Port != 8443 || s.Host != "0.0.0.0" {
+		t.Errorf("unexpected address %s:%d", s.Host, s.Port)
+	}
+	if !s.CORS.Enabled || len(s.CORS.AllowedOrigins) != 1 || len(s.CORS.AllowedMethods) == 0 {
+		t.Errorf("unexpected CORS settings %+v", s.CORS)
+	}
+	if !s.RateLimit.Enabled || s.RateLimit.RequestsPerSecond != 2.5 || s.RateLimit.Burst != 20 {
+		t.Errorf("unexpected rate limit %+v", s.RateLimit)
+	}
+	if !s.TLS.Enabled || s.TLS.KeyFile != "/etc/srake/tls/key.pem" || s.TLS.MinVersion != "1.2" {
+		t.Errorf("unexpected TLS settings %+v", s.TLS)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, doc := range []string{
+		`port = `,
+		`name = "unterminated`,
+		"[server]\nport = 1\nport = 2",
+		`bounds = [1, 2`,
+		`port = 80 80`,
+		"port = 1\n[port]",
+	} {
+		if _, err := parseTOML(doc); err == nil {
+			t.Errorf("expected an error parsing %q", doc)
+		}
+	}
+
+	doc, err := parseTOML(`
+title = "a \"quoted\" \u00e9 value"
+path = 'C:\data'
+text = """
+first \
+  second"""
+when = 2024-05-01T12:00:00Z
+day = 2024-05-01
+`)
+	if err != nil {
+		t.Fatalf("parseTOML failed: %v", err)
+	}
+	if doc["title"] != `a "quoted" é value` || doc["path"] != `C:\data` || doc["text"] != "first second" {
+		t.Errorf("unexpected strings %+v", doc)
+	}
+	if doc["when"] != "2024-05-01T12:00:00Z" {
+		t.Errorf("expected the date kept as a string, got %v", doc["when"])
+	}
+	if doc["day"] != "2024-05-01" {
+		t.Errorf("expected the local date kept as a string, got %v", doc["day"])
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "server:\n  port: 9000\n  cors:\n    allowed_origins: [\"*\"]\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SRAKE_SERVER_PORT", "9100")
+	t.Setenv("SRAKE_SERVER_CORS_ALLOWED_ORIGINS", "https://a.example.org, https://b.example.org")
+	t.Setenv("SRAKE_SERVER_TLS_ENABLED", "true")
+	t.Setenv("SRAKE_DB_PATH", "/env/srake.db")
+	t.Setenv("SRAKE_ONNX_PROVIDER", "cuda")
+
+	cfg, report, err := LoadLayers([]Layer{{Name: LayerUser, Path: path, Exists: true}})
+	if err != nil {
+		t.Fatalf("LoadLayers failed: %v", err)
+	}
+	if cfg.Server.Port != 9100 || !cfg.Server.TLS.Enabled || cfg.Database.Path != "/env/srake.db" {
+		t.Errorf("environment not applied: %+v, %q", cfg.Server, cfg.Database.Path)
+	}
+	if got := cfg.Server.CORS.AllowedOrigins; len(got) != 2 || got[1] != "https://b.example.org" {
+		t.Errorf("unexpected origins %v", got)
+	}
+	if cfg.Embeddings.ExecutionProvider != "cuda" {
+		t.Errorf("SRAKE_ONNX_PROVIDER not applied: %q", cfg.Embeddings.ExecutionProvider)
+	}
+
+	// The environment wins over the file and is reported as its own layer
+	var port *Conflict
+	for i := range report.Conflicts {
+		if report.Conflicts[i].Key == "server.port" {
+			port = &report.Conflicts[i]
+		}
+	}
+	if port == nil || port.Values[len(port.Values)-1].Layer != LayerEnv {
+		t.Errorf("expected a server.port conflict won by the environment, got %+v", report.Conflicts)
+	}
+
+	t.Setenv("SRAKE_SERVER_PORT", "eighty")
+	if _, _, err := LoadLayers(nil); err == nil || !strings.Contains(err.Error(), "SRAKE_SERVER_PORT") {
+		t.Errorf("expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestSetFileSetting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "# My settings\nembeddings:\n  batch_size: 64 # tuned\nserver:\n  port: 9000\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetFileSetting(path, "embeddings.default_model", "org/model"); err != nil {
+		t.Fatalf("SetFileSetting failed: %v", err)
+	}
+	if err := SetFileSetting(path, "server.port", "9100"); err != nil {
+		t.Fatalf("SetFileSetting failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{"# My settings", "batch_size: 64 # tuned", "default_model: org/model", "port: 9100"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config file missing %q:\n%s", want, data)
+		}
+	}
+	cfg, err := Load(path)
+	if err != nil || cfg.Embeddings.DefaultModel != "org/model" || cfg.Embeddings.BatchSize != 64 || cfg.Server.Port != 9100 {
+		t.Errorf("unexpected config %+v (%v)", cfg.Embeddings, err)
+	}
+
+	// A missing file is created
+	created := filepath.Join(t.TempDir(), "new", "config.yaml")
+	if err := SetFileSetting(created, "embeddings.default_model", "org/model"); err != nil {
+		t.Fatalf("SetFileSetting failed: %v", err)
+	}
+	if cfg, err := Load(created); err != nil || cfg.Embeddings.DefaultModel != "org/model" {
+		t.Errorf("unexpected created config (%v)", err)
+	}
+
+	if err := SetFileSetting(path, "embeddings.no_such_setting", "x"); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+	if err := SetFileSetting(path, "server.port", "eighty"); err == nil {
+		t.Error("expected an error for a value of the wrong type")
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LayerEnv names settings taken from environment variables in a Report.
+// They take precedence over every config file.
+const LayerEnv = "environment"
+
+// envAliases are environment variables srake read before any setting could
+// be overridden by name; they keep working when the generic name is unset.
+var envAliases = map[string]string{
+	"database.path":                 "SRAKE_DB_PATH",
+	"search.index_path":             "SRAKE_INDEX_PATH",
+	"embeddings.models_directory":   "SRAKE_MODELS_PATH",
+	"embeddings.execution_provider": "SRAKE_ONNX_PROVIDER",
+}
+
+// EnvVar returns the environment variable overriding a setting: SRAKE_
+// followed by its dotted key in upper case with dots as underscores, e.g.
+// SRAKE_SERVER_TLS_CERT_FILE for server.tls.cert_file.
+func EnvVar(key string) string {
+	return "SRAKE_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// applyEnv overrides settings of config from environment variables and
+// returns the values applied by dotted key. List settings take a
+// comma-separated value.
+func applyEnv(config *Config) (map[string]string, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]string)
+	overrides := make(map[string]interface{})
+	for key, isList := range settingKinds("", raw) {
+		value, ok := os.LookupEnv(EnvVar(key))
+		if alias, hasAlias := envAliases[key]; !ok && hasAlias {
+			value, ok = os.LookupEnv(alias)
+		}
+		if !ok || value == "" {
+			continue
+		}
+
+		var v interface{} = value
+		if isList {
+			items := []string{}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v = items
+		} else {
+			// Let YAML type numbers and booleans as in a config file
+			var typed interface{}
+			if err := yaml.Unmarshal([]byte(value), &typed); err == nil && typed != nil {
+				if _, isMap := typed.(map[string]interface{}); !isMap {
+					if _, isSlice := typed.([]interface{}); !isSlice {
+						v = typed
+					}
+				}
+			}
+		}
+		setPath(overrides, strings.Split(key, "."), v)
+		applied[key] = value
+	}
+	if len(applied) == 0 {
+		return applied, nil
+	}
+
+	data, err = yaml.Marshal(overrides)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		keys := make([]string, 0, len(applied))
+		for key := range applied {
+			keys = append(keys, EnvVar(key))
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("invalid value in %s: %w", strings.Join(keys, ", "), err)
+	}
+	return applied, nil
+}
+
+// settingKinds returns the dotted keys of the settings in raw, and whether
+// each holds a list
+func settingKinds(prefix string, raw map[string]interface{}) map[string]bool {
+	kinds := make(map[string]bool)
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for k, isList := range settingKinds(key, v) {
+				kinds[k] = isList
+			}
+		case []interface{}:
+			// Lists of tables cannot be given as one value
+			if len(v) == 0 {
+				kinds[key] = true
+			} else if _, isMap := v[0].(map[string]interface{}); !isMap {
+				kinds[key] = true
+			}
+		default:
+			kinds[key] = false
+		}
+	}
+	return kinds
+}
+
+// setPath sets a value in nested maps
+func setPath(m map[string]interface{}, path []string, value interface{}) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[k] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
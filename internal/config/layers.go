@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nishad/srake/internal/paths"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration layers, lowest precedence first. Each layer overrides the
+// settings it contains and leaves the rest to the layers below it.
+const (
+	LayerSystem   = "system"   // site-wide defaults, e.g. on a shared HPC install
+	LayerUser     = "user"     // per-user overrides
+	LayerProject  = "project"  // srake.yaml in the working directory
+	LayerExplicit = "explicit" // file named by SRAKE_CONFIG
+)
+
+// DefaultSystemConfigPath is the system-wide config file. It can be moved
+// with SRAKE_SYSTEM_CONFIG.
+const DefaultSystemConfigPath = "/etc/srake/config.yaml"
+
+// ProjectConfigFile is the project config file looked up in the working
+// directory. Each layer may be written in TOML instead, in a file ending
+// in .toml, such as srake.toml.
+const ProjectConfigFile = "srake.yaml"
+
+// Layer is a config file that takes part in the merged configuration.
+type Layer struct {
+	Name   string `json:"name" yaml:"name"`
+	Path   string `json:"path" yaml:"path"`
+	Exists bool   `json:"exists" yaml:"exists"`
+}
+
+// LayerValue is the value a layer gives a setting.
+type LayerValue struct {
+	Layer string `json:"layer" yaml:"layer"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// Setting is a key set by at least one config file, with the layer whose
+// value is in effect.
+type Setting struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+	Layer string `json:"layer" yaml:"layer"`
+}
+
+// Conflict is a key that several layers set to different values. The last
+// value wins.
+type Conflict struct {
+	Key    string       `json:"key" yaml:"key"`
+	Values []LayerValue `json:"values" yaml:"values"`
+}
+
+// Report describes how a merged configuration was assembled.
+type Report struct {
+	Layers    []Layer    `json:"layers" yaml:"layers"`
+	Settings  []Setting  `json:"settings" yaml:"settings"`
+	Conflicts []Conflict `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+	Warnings  []string   `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// Layers returns the config files consulted by LoadLayered, lowest
+// precedence first.
+func Layers() []Layer {
+	systemPath := os.Getenv("SRAKE_SYSTEM_CONFIG")
+	if systemPath == "" {
+		systemPath = DefaultSystemConfigPath
+	}
+
+	layers := []Layer{
+		{Name: LayerSystem, Path: systemPath},
+		{Name: LayerUser, Path: filepath.Join(paths.GetPaths().ConfigDir, "config.yaml")},
+		{Name: LayerProject, Path: ProjectConfigFile},
+	}
+	if path := os.Getenv("SRAKE_CONFIG"); path != "" {
+		layers = append(layers, Layer{Name: LayerExplicit, Path: path})
+	}
+
+	for i := range layers {
+		layers[i].Path = expandPath(layers[i].Path)
+		if _, err := os.Stat(layers[i].Path); err == nil {
+			layers[i].Exists = true
+		} else if layers[i].Name != LayerExplicit {
+			// Fall back to the TOML file of the layer
+			alt := strings.TrimSuffix(layers[i].Path, filepath.Ext(layers[i].Path)) + ".toml"
+			if _, err := os.Stat(alt); err == nil {
+				layers[i].Path = alt
+				layers[i].Exists = true
+			}
+		}
+	}
+	return layers
+}
+
+// LoadLayered merges the system, user, project, and SRAKE_CONFIG files over
+// the defaults, then applies environment variable overrides.
+func LoadLayered() (*Config, *Report, error) {
+	return LoadLayers(Layers())
+}
+
+// LoadLayeredFile is LoadLayered with path as the explicit layer in place
+// of SRAKE_CONFIG. Unlike the other layers, the file must exist.
+func LoadLayeredFile(path string) (*Config, *Report, error) {
+	var layers []Layer
+	for _, layer := range Layers() {
+		if layer.Name != LayerExplicit {
+			layers = append(layers, layer)
+		}
+	}
+	layers = append(layers, Layer{Name: LayerExplicit, Path: expandPath(path), Exists: true})
+	return LoadLayers(layers)
+}
+
+// LoadLayers merges the given config files over the defaults, later layers
+// taking precedence, then applies environment variable overrides (see
+// EnvVar). Missing files are skipped.
+func LoadLayers(layers []Layer) (*Config, *Report, error) {
+	config := DefaultConfig()
+	report := &Report{Layers: layers}
+	known := knownKeys(config)
+
+	values := make(map[string][]LayerValue)
+	for _, layer := range layers {
+		if !layer.Exists {
+			continue
+		}
+
+		data, err := os.ReadFile(layer.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s config %s: %w", layer.Name, layer.Path, err)
+		}
+		if data, err = toYAML(layer.Path, data); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s config %s: %w", layer.Name, layer.Path, err)
+		}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s config %s: %w", layer.Name, layer.Path, err)
+		}
+
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s config %s: %w", layer.Name, layer.Path, err)
+		}
+		flat := flattenSettings("", raw)
+		layerKeys := make([]string, 0, len(flat))
+		for key := range flat {
+			layerKeys = append(layerKeys, key)
+		}
+		sort.Strings(layerKeys)
+		for _, key := range layerKeys {
+			value := flat[key]
+			if !known[key] {
+				report.Warnings = append(report.Warnings,
+					fmt.Sprintf("unknown setting %q in %s config %s", key, layer.Name, layer.Path))
+				continue
+			}
+			values[key] = append(values[key], LayerValue{Layer: layer.Name, Value: value})
+		}
+	}
+
+	env, err := applyEnv(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range env {
+		values[key] = append(values[key], LayerValue{Layer: LayerEnv, Value: value})
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		set := values[key]
+		last := set[len(set)-1]
+		report.Settings = append(report.Settings, Setting{Key: key, Value: last.Value, Layer: last.Layer})
+		for _, v := range set[:len(set)-1] {
+			if v.Value != last.Value {
+				report.Conflicts = append(report.Conflicts, Conflict{Key: key, Values: set})
+				break
+			}
+		}
+	}
+
+	if config.Vectors.Enabled && config.Vectors.RequiresSearch && !config.Search.Enabled {
+		report.Warnings = append(report.Warnings,
+			"vectors.enabled is true but search.enabled is false; vectors will be disabled")
+	}
+
+	config.finalize()
+	return config, report, nil
+}
+
+// knownKeys returns the dotted keys of every setting in the config schema.
+func knownKeys(config *Config) map[string]bool {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for key := range flattenSettings("", raw) {
+		known[key] = true
+	}
+	return known
+}
+
+// flattenSettings turns nested YAML maps into dotted keys. Lists are kept
+// whole since a layer replaces them rather than merging into them.
+func flattenSettings(prefix string, raw map[string]interface{}) map[string]string {
+	flat := make(map[string]string)
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for k, sub := range flattenSettings(key, v) {
+				flat[k] = sub
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			flat[key] = "[" + strings.Join(items, ", ") + "]"
+		case nil:
+			// An empty section or value leaves the layers below in effect
+		default:
+			flat[key] = fmt.Sprint(v)
+		}
+	}
+	return flat
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UserConfigPath returns the user layer's config file, which commands that
+// change a setting write to.
+func UserConfigPath() string {
+	for _, layer := range Layers() {
+		if layer.Name == LayerUser {
+			return layer.Path
+		}
+	}
+	return ""
+}
+
+// SetFileSetting sets a setting, by dotted key, in a YAML config file,
+// keeping its other settings and comments. The file is created if missing.
+// TOML files are not rewritten.
+func SetFileSetting(path, key, value string) error {
+	if isTOML(path) {
+		return fmt.Errorf("cannot set %s in %s: TOML config files must be edited by hand", key, path)
+	}
+	if !knownKeys(DefaultConfig())[key] {
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	node := doc.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a mapping of settings", path)
+	}
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		node = mappingValue(node, part, yaml.MappingNode)
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("cannot set %s: %s is not a section in %s", key, part, path)
+		}
+	}
+	leaf := mappingValue(node, parts[len(parts)-1], yaml.ScalarNode)
+	leaf.Kind, leaf.Tag, leaf.Value, leaf.Content = yaml.ScalarNode, "", value, nil
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	out := buf.Bytes()
+	// Make sure the result still loads before replacing the file
+	if _, err := loadYAML(out); err != nil {
+		return fmt.Errorf("cannot set %s to %q: %w", key, value, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return os.WriteFile(path, out, 0600)
+}
+
+// mappingValue returns the value of key in a YAML mapping, adding a node
+// of the given kind when the key is missing
+func mappingValue(mapping *yaml.Node, key string, kind yaml.Kind) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	value := &yaml.Node{Kind: kind}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value
+}
+
+// loadYAML decodes a config file's contents over the defaults
+func loadYAML(data []byte) (*Config, error) {
+	config := DefaultConfig()
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// isTOML reports whether a config file is TOML rather than YAML
+func isTOML(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".toml")
+}
+
+// toYAML converts the content of a TOML config file to YAML, so that both
+// formats are decoded through the yaml tags of Config. YAML files are
+// returned unchanged.
+func toYAML(path string, data []byte) ([]byte, error) {
+	if !isTOML(path) {
+		return data, nil
+	}
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// parseTOML parses a TOML document. Dates are kept as strings.
+func parseTOML(data string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	if _, err := toml.Decode(data, &doc); err != nil {
+		return nil, err
+	}
+	return datesToStrings(doc).(map[string]interface{}), nil
+}
+
+// datesToStrings replaces the dates and times in a decoded TOML value with
+// their text, in RFC 3339 form
+func datesToStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = datesToStrings(value)
+		}
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, table := range v {
+			list[i] = datesToStrings(table)
+		}
+		return list
+	case []interface{}:
+		for i, value := range v {
+			v[i] = datesToStrings(value)
+		}
+	case time.Time:
+		// Local dates and times are decoded in zones named after their type
+		switch v.Location().String() {
+		case "date-local":
+			return v.Format(time.DateOnly)
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return v
+}
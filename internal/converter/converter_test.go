@@ -1,8 +1,12 @@
 package converter
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -351,3 +355,41 @@ func TestConvertSRPToSRR(t *testing.T) {
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
+
+func TestFetchGEOSeries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/esearch.fcgi":
+			if r.URL.Query().Get("term") == "GSE1000[ACCN] AND gse[ETYP]" {
+				w.Write([]byte(`{"esearchresult": {"idlist": ["100001", "200001000"]}}`))
+			} else {
+				w.Write([]byte(`{"esearchresult": {"idlist": []}}`))
+			}
+		case "/esummary.fcgi":
+			w.Write([]byte(`{"result": {"uids": ["100001", "200001000"],
+				"100001": {"accession": "GPL570", "title": "A platform"},
+				"200001000": {"accession": "GSE1000", "title": "Liver RNA-seq", "taxon": "Homo sapiens",
+					"gdstype": "Expression profiling by high throughput sequencing", "n_samples": 12, "pdat": "2020/01/31"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(u string) { eutilsURL = u }(eutilsURL)
+	eutilsURL = server.URL
+
+	series, err := FetchGEOSeries(context.Background(), server.Client(), "gse1000")
+	if err != nil {
+		t.Fatalf("FetchGEOSeries failed: %v", err)
+	}
+	if series.Title != "Liver RNA-seq" || series.Samples != 12 || series.Organism != "Homo sapiens" {
+		t.Errorf("unexpected series: %+v", series)
+	}
+
+	if _, err := FetchGEOSeries(context.Background(), server.Client(), "GSE2000"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected GSE2000 not to be found, got %v", err)
+	}
+	if _, err := FetchGEOSeries(context.Background(), server.Client(), "GSM1"); err == nil {
+		t.Error("expected an error for a GEO sample")
+	}
+}
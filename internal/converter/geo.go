@@ -0,0 +1,105 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// eutilsURL is the base URL of NCBI E-utilities, replaced in tests
+var eutilsURL = "https://eutils.ncbi.nlm.nih.gov/entrez/eutils"
+
+// GEOSeries is the summary of a GEO series kept by NCBI's GDS database
+type GEOSeries struct {
+	Accession  string `json:"accession"`
+	Title      string `json:"title"`
+	Summary    string `json:"summary,omitempty"`
+	Organism   string `json:"organism,omitempty"`
+	Type       string `json:"type,omitempty"` // such as "Expression profiling by high throughput sequencing"
+	Samples    int    `json:"samples"`
+	Published  string `json:"published,omitempty"` // YYYY/MM/DD
+	BioProject string `json:"bioproject,omitempty"`
+}
+
+// FetchGEOSeries fetches the summary of a GEO series (GSE) accession from
+// NCBI E-utilities. Its error mentions "not found" when GEO has no such
+// series.
+func FetchGEOSeries(ctx context.Context, client *http.Client, accession string) (*GEOSeries, error) {
+	accession = strings.ToUpper(strings.TrimSpace(accession))
+	if !strings.HasPrefix(accession, "GSE") {
+		return nil, fmt.Errorf("not a GEO series accession: %s", accession)
+	}
+
+	var search struct {
+		Result struct {
+			IDs []string `json:"idlist"`
+		} `json:"esearchresult"`
+	}
+	query := url.Values{"db": {"gds"}, "term": {accession + "[ACCN] AND gse[ETYP]"}, "retmode": {"json"}}
+	if err := getEutils(ctx, client, "esearch.fcgi", query, &search); err != nil {
+		return nil, err
+	}
+	if len(search.Result.IDs) == 0 {
+		return nil, fmt.Errorf("GEO series not found: %s", accession)
+	}
+
+	var summary struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	query = url.Values{"db": {"gds"}, "id": {strings.Join(search.Result.IDs, ",")}, "retmode": {"json"}}
+	if err := getEutils(ctx, client, "esummary.fcgi", query, &summary); err != nil {
+		return nil, err
+	}
+	// A term can match records of other accessions, such as the
+	// platforms of the series
+	for _, id := range search.Result.IDs {
+		var doc struct {
+			Accession  string `json:"accession"`
+			Title      string `json:"title"`
+			Summary    string `json:"summary"`
+			Taxon      string `json:"taxon"`
+			GDSType    string `json:"gdstype"`
+			Samples    int    `json:"n_samples"`
+			PDAT       string `json:"pdat"`
+			BioProject string `json:"bioproject"`
+		}
+		if err := json.Unmarshal(summary.Result[id], &doc); err != nil || doc.Accession != accession {
+			continue
+		}
+		return &GEOSeries{
+			Accession:  doc.Accession,
+			Title:      doc.Title,
+			Summary:    doc.Summary,
+			Organism:   doc.Taxon,
+			Type:       doc.GDSType,
+			Samples:    doc.Samples,
+			Published:  doc.PDAT,
+			BioProject: doc.BioProject,
+		}, nil
+	}
+	return nil, fmt.Errorf("GEO series not found: %s", accession)
+}
+
+// getEutils decodes the JSON response of an E-utilities request into v
+func getEutils(ctx context.Context, client *http.Client, endpoint string, query url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, eutilsURL+"/"+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "srake")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("E-utilities request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("E-utilities returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode E-utilities response: %w", err)
+	}
+	return nil
+}
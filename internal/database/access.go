@@ -0,0 +1,164 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Access levels of records
+const (
+	AccessPublic     = "public"
+	AccessControlled = "controlled"
+	AccessUnknown    = "unknown" // runs missing from the database
+)
+
+// accessBatchSize bounds the run accessions resolved per query
+const accessBatchSize = 500
+
+// RecordAccess is the access level of a record and the consent group it
+// was released under, e.g. "GRU" or "HMB-IRB" for dbGaP data. For a run
+// resolved by RunAccess, From names the record the level was taken from.
+type RecordAccess struct {
+	Accession  string `json:"accession"`
+	RecordType string `json:"record_type,omitempty"`
+	Access     string `json:"access"`
+	Consent    string `json:"consent,omitempty"`
+	From       string `json:"from,omitempty"`
+}
+
+// SetRecordAccess replaces the access hints of the given records with
+// hints, in a single transaction. Records without a hint lose any they had
+// from an earlier ingest.
+func (db *DB) SetRecordAccess(accessions []string, hints []RecordAccess) error {
+	tx, err := db.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	del, err := tx.Prepare(`DELETE FROM record_access WHERE accession = ?`)
+	if err != nil {
+		return err
+	}
+	defer del.Close()
+	for _, acc := range accessions {
+		if _, err := del.Exec(acc); err != nil {
+			return err
+		}
+	}
+
+	ins, err := tx.Prepare(`
+		INSERT OR REPLACE INTO record_access (accession, record_type, access, consent)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer ins.Close()
+	for _, h := range hints {
+		if _, err := ins.Exec(h.Accession, h.RecordType, h.Access, h.Consent); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRecordAccess returns the access hint stored for a record, or nil if
+// it has none.
+func (db *DB) GetRecordAccess(accession string) (*RecordAccess, error) {
+	var a RecordAccess
+	err := db.QueryRow(`
+		SELECT accession, record_type, access, COALESCE(consent, '')
+		FROM record_access
+		WHERE accession = ?
+	`, accession).Scan(&a.Accession, &a.RecordType, &a.Access, &a.Consent)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// RunAccess resolves the effective access level of runs. A run is
+// controlled if it, its experiment, its study, or one of its samples is;
+// otherwise it is public. Runs missing from the database are absent from
+// the result, since nothing is known about them.
+func (db *DB) RunAccess(runs []string) (map[string]*RecordAccess, error) {
+	result := make(map[string]*RecordAccess, len(runs))
+	for start := 0; start < len(runs); start += accessBatchSize {
+		batch := runs[start:min(start+accessBatchSize, len(runs))]
+		if err := db.resolveRunAccess(batch, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (db *DB) resolveRunAccess(runs []string, result map[string]*RecordAccess) error {
+	args := make([]interface{}, len(runs))
+	for i, run := range runs {
+		args[i] = run
+	}
+
+	// #nosec G201 - only placeholders are interpolated
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT r.run_accession, COALESCE(a.accession, ''), COALESCE(a.consent, '')
+		FROM runs r
+		LEFT JOIN experiments e ON e.experiment_accession = r.experiment_accession
+		LEFT JOIN record_access a ON a.access = '%s' AND (
+			a.accession IN (r.run_accession, r.experiment_accession, e.study_accession)
+			OR a.accession IN (SELECT es.sample_accession FROM experiment_samples es WHERE es.experiment_accession = r.experiment_accession)
+			OR a.accession IN (SELECT sa.sample_accession FROM samples sa WHERE sa.experiment_accession = r.experiment_accession)
+		)
+		WHERE r.run_accession IN (%s)
+		ORDER BY r.run_accession, a.accession
+	`, AccessControlled, placeholders(len(runs))), args...)
+	if err != nil {
+		return fmt.Errorf("failed to resolve run access: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var run, from, consent string
+		if err := rows.Scan(&run, &from, &consent); err != nil {
+			return err
+		}
+		existing := result[run]
+		if from == "" {
+			if existing == nil {
+				result[run] = &RecordAccess{Accession: run, RecordType: "run", Access: AccessPublic}
+			}
+			continue
+		}
+		// Several controlled records may apply; keep the first with a
+		// consent group
+		if existing == nil || existing.Access != AccessControlled || (existing.Consent == "" && consent != "") {
+			result[run] = &RecordAccess{Accession: run, RecordType: "run", Access: AccessControlled, Consent: consent, From: from}
+		}
+	}
+	return rows.Err()
+}
+
+// SplitOpenAccessRuns partitions runs, in order, into open-access runs,
+// controlled runs, and runs missing from the database, whose access level
+// cannot be checked.
+func (db *DB) SplitOpenAccessRuns(runs []string) (open []string, controlled []*RecordAccess, unknown []string, err error) {
+	access, err := db.RunAccess(runs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, run := range runs {
+		switch a := access[run]; {
+		case a == nil:
+			unknown = append(unknown, run)
+		case a.Access == AccessControlled:
+			controlled = append(controlled, a)
+		default:
+			open = append(open, run)
+		}
+	}
+	return open, controlled, unknown, nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxAccessionLookup is the most accessions LookupAccessions resolves in
+// one call
+const MaxAccessionLookup = 50000
+
+// sraAccession matches SRA, ENA and DDBJ study, experiment, sample and run
+// accessions, capturing the letter of the record type
+var sraAccession = regexp.MustCompile(`^[SED]R([PXSR])[0-9]+$`)
+
+// AccessionLookup holds the records found for a list of accessions, each
+// list in the order the accessions were given, and the accessions that
+// matched no record
+type AccessionLookup struct {
+	Studies     []*Study      `json:"studies"`
+	Experiments []*Experiment `json:"experiments"`
+	Samples     []*Sample     `json:"samples"`
+	Runs        []*Run        `json:"runs"`
+	NotFound    []string      `json:"not_found"`
+}
+
+// Found returns the number of records found
+func (l *AccessionLookup) Found() int {
+	return len(l.Studies) + len(l.Experiments) + len(l.Samples) + len(l.Runs)
+}
+
+// AccessionRecordType returns the record type of an SRA accession by its
+// prefix, such as run for SRR, ERR and DRR, and "" for any other value
+func AccessionRecordType(accession string) string {
+	m := sraAccession.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(accession)))
+	if m == nil {
+		return ""
+	}
+	return map[string]string{"P": "study", "X": "experiment", "S": "sample", "R": "run"}[m[1]]
+}
+
+// accessionQueries select the records of each type, scanned by
+// scanAccessionRecord, for a list of accessions appended as placeholders
+var accessionQueries = map[string]string{
+	"study": `SELECT study_accession, COALESCE(study_title, ''), COALESCE(study_abstract, ''),
+			COALESCE(study_type, ''), COALESCE(organism, ''), submission_date, COALESCE(metadata, '{}')
+		FROM studies WHERE study_accession IN `,
+	"experiment": `SELECT experiment_accession, COALESCE(study_accession, ''), COALESCE(title, ''),
+			COALESCE(library_strategy, ''), COALESCE(library_source, ''), COALESCE(platform, ''),
+			COALESCE(instrument_model, ''), COALESCE(metadata, '{}')
+		FROM experiments WHERE experiment_accession IN `,
+	"sample": `SELECT sample_accession, COALESCE(organism, ''), COALESCE(scientific_name, ''),
+			COALESCE(taxon_id, 0), COALESCE(tissue, ''), COALESCE(cell_type, ''),
+			COALESCE(description, ''), COALESCE(metadata, '{}')
+		FROM samples WHERE sample_accession IN `,
+	"run": `SELECT run_accession, COALESCE(experiment_accession, ''), COALESCE(total_spots, 0),
+			COALESCE(total_bases, 0), COALESCE(published, ''), COALESCE(metadata, '{}')
+		FROM runs WHERE run_accession IN `,
+}
+
+// scanAccessionRecord scans a row of an accessionQueries query, returning
+// the record's accession and the record
+func scanAccessionRecord(recordType string, row rowScanner) (string, interface{}, error) {
+	switch recordType {
+	case "study":
+		s := &Study{}
+		err := row.Scan(&s.StudyAccession, &s.StudyTitle, &s.StudyAbstract, &s.StudyType,
+			&s.Organism, &s.SubmissionDate, &s.Metadata)
+		return s.StudyAccession, s, err
+	case "experiment":
+		e := &Experiment{}
+		err := row.Scan(&e.ExperimentAccession, &e.StudyAccession, &e.Title, &e.LibraryStrategy,
+			&e.LibrarySource, &e.Platform, &e.InstrumentModel, &e.Metadata)
+		return e.ExperimentAccession, e, err
+	case "sample":
+		s := &Sample{}
+		err := row.Scan(&s.SampleAccession, &s.Organism, &s.ScientificName, &s.TaxonID,
+			&s.Tissue, &s.CellType, &s.Description, &s.Metadata)
+		return s.SampleAccession, s, err
+	default:
+		r := &Run{}
+		err := row.Scan(&r.RunAccession, &r.ExperimentAccession, &r.TotalSpots, &r.TotalBases,
+			&r.Published, &r.Metadata)
+		return r.RunAccession, r, err
+	}
+}
+
+// LookupAccessions fetches the records of a list of mixed study,
+// experiment, sample and run accessions, such as one read from a file,
+// with a query per type for every few hundred accessions. Accessions are
+// matched case-insensitively, and repeats are looked up once. Values that
+// are not SRA accessions are reported as not found.
+func (db *DB) LookupAccessions(accessions []string) (*AccessionLookup, error) {
+	if len(accessions) > MaxAccessionLookup {
+		return nil, fmt.Errorf("too many accessions: %d (at most %d per lookup)", len(accessions), MaxAccessionLookup)
+	}
+
+	seen := make(map[string]bool, len(accessions))
+	var order []string
+	byType := make(map[string][]string)
+	for _, acc := range accessions {
+		acc = strings.ToUpper(strings.TrimSpace(acc))
+		if acc == "" || seen[acc] {
+			continue
+		}
+		seen[acc] = true
+		order = append(order, acc)
+		if recordType := AccessionRecordType(acc); recordType != "" {
+			byType[recordType] = append(byType[recordType], acc)
+		}
+	}
+
+	found := make(map[string]interface{}, len(order))
+	for recordType, accs := range byType {
+		// Stay well under SQLite's bound parameter limit
+		const chunk = 500
+		for start := 0; start < len(accs); start += chunk {
+			end := min(start+chunk, len(accs))
+			args := make([]interface{}, 0, end-start)
+			for _, acc := range accs[start:end] {
+				args = append(args, acc)
+			}
+
+			rows, err := db.Query(accessionQueries[recordType]+`(`+placeholders(end-start)+`)`, args...)
+			if err != nil {
+				return nil, err
+			}
+			for rows.Next() {
+				acc, record, err := scanAccessionRecord(recordType, rows)
+				if err != nil {
+					rows.Close()
+					return nil, err
+				}
+				found[acc] = record
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	lookup := &AccessionLookup{
+		Studies:     []*Study{},
+		Experiments: []*Experiment{},
+		Samples:     []*Sample{},
+		Runs:        []*Run{},
+		NotFound:    []string{},
+	}
+	for _, acc := range order {
+		switch record := found[acc].(type) {
+		case *Study:
+			lookup.Studies = append(lookup.Studies, record)
+		case *Experiment:
+			lookup.Experiments = append(lookup.Experiments, record)
+		case *Sample:
+			lookup.Samples = append(lookup.Samples, record)
+		case *Run:
+			lookup.Runs = append(lookup.Runs, record)
+		default:
+			lookup.NotFound = append(lookup.NotFound, acc)
+		}
+	}
+	return lookup, nil
+}
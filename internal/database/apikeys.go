@@ -0,0 +1,116 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// apiKeyPrefix marks keys created by srake, so they are recognizable in
+// configs and secret scanners
+const apiKeyPrefix = "srk_"
+
+// APIKey is an API key accepted by srake server. Only the hash of the key
+// is stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	Name              string    `json:"name"`
+	RequestsPerSecond float64   `json:"requests_per_second,omitempty"` // 0 uses the server's rate limit
+	Burst             int       `json:"burst,omitempty"`
+	ReadOnly          bool      `json:"read_only"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// HashAPIKey returns the SHA-256 hash of key in hex, as stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey stores a new API key under k.Name and returns the key
+func (db *DB) CreateAPIKey(k *APIKey) (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now().UTC()
+	}
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM api_keys WHERE name = ?)`, k.Name).Scan(&exists); err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("API key already exists: %s", k.Name)
+	}
+	_, err := db.Exec(`
+		INSERT INTO api_keys (name, key_hash, requests_per_second, burst, read_only, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, k.Name, HashAPIKey(key), k.RequestsPerSecond, k.Burst, k.ReadOnly, k.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns the stored API keys, ordered by name
+func (db *DB) ListAPIKeys() ([]APIKey, error) {
+	rows, err := db.Query(`
+		SELECT name, requests_per_second, burst, read_only, created_at
+		FROM api_keys
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// LookupAPIKey returns the stored API key matching key, or nil without an
+// error if there is none
+func (db *DB) LookupAPIKey(key string) (*APIKey, error) {
+	row := db.QueryRow(`
+		SELECT name, requests_per_second, burst, read_only, created_at
+		FROM api_keys
+		WHERE key_hash = ?
+	`, HashAPIKey(key))
+	k, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return k, err
+}
+
+// DeleteAPIKey revokes the API key stored under name
+func (db *DB) DeleteAPIKey(name string) error {
+	result, err := db.Exec(`DELETE FROM api_keys WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("API key not found: %s", name)
+	}
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var k APIKey
+	if err := row.Scan(&k.Name, &k.RequestsPerSecond, &k.Burst, &k.ReadOnly, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Run archive formats. SQLite archives are read back by IncludeArchived;
+// Parquet archives are cold storage for other tools.
+const (
+	ArchiveSQLite  = "sqlite"
+	ArchiveParquet = "parquet"
+)
+
+// archivedRuns selects the runs published before a date. Runs without a
+// publication date are never archived.
+const archivedRuns = `published IS NOT NULL AND published != '' AND published < ?`
+
+// RunArchive is a file old runs have been moved to
+type RunArchive struct {
+	Path            string    `json:"path"`
+	Format          string    `json:"format"`
+	Runs            int64     `json:"runs"`
+	PublishedBefore string    `json:"published_before"` // latest cutoff of the runs moved to it
+	ArchivedAt      time.Time `json:"archived_at"`
+}
+
+// archiveCutoff formats the date before which runs are archived as their
+// publication dates are stored
+func archiveCutoff(before time.Time) string {
+	return before.UTC().Format("2006-01-02")
+}
+
+// CountArchivableRuns returns the number of runs published before a date,
+// which ArchiveRuns would move
+func (db *DB) CountArchivableRuns(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM runs WHERE `+archivedRuns, archiveCutoff(before)).Scan(&n)
+	return n, err
+}
+
+// ArchiveRuns moves the runs published before a date into the SQLite
+// archive at path, which is created if missing, and records the archive
+// so that IncludeArchived can read them back. Studies, experiments and
+// samples stay in the database. A run archived again replaces its copy.
+func (db *DB) ArchiveRuns(ctx context.Context, before time.Time, path string) (*RunArchive, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := archiveCutoff(before)
+
+	// Attached databases belong to one connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS archive", path); err != nil {
+		return nil, fmt.Errorf("failed to attach %s: %w", path, err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE archive")
+
+	// The archive's table is declared as the database's is
+	var schema string
+	err = conn.QueryRowContext(ctx, `SELECT sql FROM main.sqlite_master WHERE type = 'table' AND name = 'runs'`).Scan(&schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the runs table: %w", err)
+	}
+	columns, ok := strings.CutPrefix(schema, "CREATE TABLE runs")
+	if !ok {
+		return nil, fmt.Errorf("unexpected runs table: %s", schema)
+	}
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS archive.runs"+columns); err != nil {
+		return nil, fmt.Errorf("failed to create the archive: %w", err)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cols, err := sharedColumns(ctx, tx, "archive", "runs")
+	if err != nil {
+		return nil, err
+	}
+	list := strings.Join(cols, ", ")
+	res, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO archive.runs (`+list+`)
+		SELECT `+list+` FROM main.runs WHERE `+archivedRuns, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy runs: %w", err)
+	}
+	copied, _ := res.RowsAffected()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM main.runs WHERE `+archivedRuns, cutoff); err != nil {
+		return nil, fmt.Errorf("failed to remove archived runs: %w", err)
+	}
+
+	archive, err := recordRunArchive(ctx, tx, path, ArchiveSQLite, copied, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return archive, tx.Commit()
+}
+
+// ArchiveRunsTo moves the runs published before a date out of the
+// database, passing every column of them to write in accession order, for
+// archives in formats SQLite cannot attach. write returns the number of
+// runs it stored. The runs are read and deleted in one transaction, so
+// that none is deleted without having been written.
+func (db *DB) ArchiveRunsTo(ctx context.Context, before time.Time, path, format string, write func(*sql.Rows) (int64, error)) (*RunArchive, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := archiveCutoff(before)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT * FROM runs WHERE `+archivedRuns+` ORDER BY run_accession`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	written, err := write(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM runs WHERE `+archivedRuns, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove archived runs: %w", err)
+	}
+	if deleted, _ := res.RowsAffected(); deleted != written {
+		return nil, fmt.Errorf("wrote %d runs to %s but %d are due for archiving", written, path, deleted)
+	}
+
+	archive, err := recordRunArchive(ctx, tx, path, format, written, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return archive, tx.Commit()
+}
+
+// recordRunArchive adds the runs moved to an archive to its entry
+func recordRunArchive(ctx context.Context, tx *sql.Tx, path, format string, runs int64, cutoff string) (*RunArchive, error) {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO run_archives (path, format, runs, published_before, archived_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET
+			runs = runs + excluded.runs,
+			published_before = MAX(published_before, excluded.published_before),
+			archived_at = excluded.archived_at
+	`, path, format, runs, cutoff, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to record the archive: %w", err)
+	}
+	archive, err := scanRunArchive(tx.QueryRowContext(ctx, `
+		SELECT path, format, runs, published_before, archived_at FROM run_archives WHERE path = ?
+	`, path))
+	if err != nil {
+		return nil, err
+	}
+	archive.Runs = runs
+	return archive, nil
+}
+
+// ListRunArchives returns the archives runs have been moved to, ordered by
+// path
+func (db *DB) ListRunArchives() ([]RunArchive, error) {
+	rows, err := db.Query(`
+		SELECT path, format, runs, published_before, archived_at
+		FROM run_archives
+		ORDER BY path
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var archives []RunArchive
+	for rows.Next() {
+		a, err := scanRunArchive(rows)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, *a)
+	}
+	return archives, rows.Err()
+}
+
+func scanRunArchive(row rowScanner) (*RunArchive, error) {
+	a := &RunArchive{}
+	if err := row.Scan(&a.Path, &a.Format, &a.Runs, &a.PublishedBefore, &a.ArchivedAt); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// IncludeArchived makes the runs moved to SQLite archives readable as if
+// they had not been moved, and returns the number of archives attached. A
+// temporary view named runs takes the place of the table, so the database
+// is read-only for runs afterwards. A run in the database takes
+// precedence over an archived copy, as after an update re-ingests it.
+//
+// The archives are attached to a single connection, to which the database
+// is then limited.
+func (db *DB) IncludeArchived(ctx context.Context) (int, error) {
+	archives, err := db.ListRunArchives()
+	if err != nil {
+		return 0, err
+	}
+	var attach []RunArchive
+	for _, a := range archives {
+		if a.Format == ArchiveSQLite {
+			attach = append(attach, a)
+		}
+	}
+	if len(attach) == 0 {
+		return 0, nil
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	cols, err := tableColumns(ctx, db, "main", "runs")
+	if err != nil {
+		return 0, err
+	}
+	selects := []string{"SELECT " + strings.Join(cols, ", ") + " FROM main.runs"}
+	for i, a := range attach {
+		if _, err := os.Stat(a.Path); err != nil {
+			return 0, fmt.Errorf("run archive not found: %s", a.Path)
+		}
+		schema := fmt.Sprintf("archive%d", i)
+		if _, err := db.ExecContext(ctx, "ATTACH DATABASE ? AS "+schema, "file:"+a.Path+"?mode=ro"); err != nil {
+			return 0, fmt.Errorf("failed to attach %s: %w", a.Path, err)
+		}
+		archived, err := tableColumns(ctx, db, schema, "runs")
+		if err != nil {
+			return 0, err
+		}
+		// Columns added since the archive was written read as NULL
+		list := make([]string, len(cols))
+		for j, col := range cols {
+			list[j] = "NULL AS " + col
+			if slices.Contains(archived, col) {
+				list[j] = "a." + col
+			}
+		}
+		selects = append(selects, fmt.Sprintf(`SELECT %s FROM %s.runs a
+			WHERE NOT EXISTS (SELECT 1 FROM main.runs m WHERE m.run_accession = a.run_accession)`,
+			strings.Join(list, ", "), schema))
+	}
+
+	// #nosec G202 - schema and column names are generated, not user input
+	if _, err := db.ExecContext(ctx, "CREATE TEMP VIEW runs AS "+strings.Join(selects, " UNION ALL ")); err != nil {
+		return 0, fmt.Errorf("failed to include archived runs: %w", err)
+	}
+	return len(attach), nil
+}
@@ -0,0 +1,266 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bulkBatchSize is how many staged rows a bulk load writes per transaction
+const bulkBatchSize = 50000
+
+// Phases of a bulk load, in the order they run
+const (
+	BulkPhasePrepare    = "prepare"     // staging tables created, indexes dropped
+	BulkPhaseLoad       = "load"        // records written to the staging tables
+	BulkPhaseMerge      = "merge"       // staged records moved into the record tables
+	BulkPhaseIndex      = "index"       // dropped indexes rebuilt
+	BulkPhaseSampleRuns = "sample_runs" // sample_runs rebuilt
+)
+
+// stagedTable is a record table a bulk load writes through a staging table
+type stagedTable struct {
+	table   string
+	columns []string // key first, in the order the insert methods bind them
+}
+
+// staging returns the name of the staging table of t
+func (t stagedTable) staging() string {
+	return "bulk_" + t.table
+}
+
+// stagedTables are the record tables a bulk load stages, in the order they
+// are merged: experiments before runs, so that the FTS triggers of runs
+// find their experiments
+var stagedTables = []stagedTable{
+	{"studies", []string{"study_accession", "study_title", "study_abstract", "study_type", "organism", "submission_date", "metadata"}},
+	{"experiments", []string{"experiment_accession", "study_accession", "title", "library_strategy", "library_source", "platform", "instrument_model", "metadata"}},
+	{"samples", []string{"sample_accession", "experiment_accession", "organism", "scientific_name", "taxon_id", "tissue", "cell_type", "description", "metadata"}},
+	{"runs", []string{"run_accession", "experiment_accession", "total_spots", "total_bases", "published", "metadata"}},
+}
+
+// keptIndexes are not dropped by a bulk load: the FTS triggers of
+// experiments look up their runs by experiment while merging
+var keptIndexes = map[string]bool{
+	"idx_run_experiment": true,
+}
+
+// BulkPhase is how long a phase of a bulk load took
+type BulkPhase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// BulkLoad writes the studies, experiments, samples and runs inserted
+// while it runs into staging tables without rowids or secondary indexes,
+// many rows per transaction, and moves them into the record tables when
+// it finishes. The secondary indexes of the record tables are dropped
+// until then, and rebuilt once at the end instead of row by row.
+type BulkLoad struct {
+	db      *DB
+	start   time.Time
+	indexes []string // CREATE INDEX statements of the dropped indexes
+	phases  []BulkPhase
+
+	mu      sync.Mutex
+	pending map[string][][]interface{} // staged rows not yet written, by table
+	rows    int
+}
+
+// BeginBulkLoad starts a bulk load: until Finish, the records inserted are
+// staged rather than written to their tables, and so are not found by
+// queries. Rows left staged by a bulk load that was killed are discarded.
+func (db *DB) BeginBulkLoad() (*BulkLoad, error) {
+	if db.bulk.Load() != nil {
+		return nil, fmt.Errorf("a bulk load is already running")
+	}
+	start := time.Now()
+	b := &BulkLoad{db: db, pending: make(map[string][][]interface{})}
+
+	tables := make([]string, len(stagedTables))
+	for i, t := range stagedTables {
+		tables[i] = "'" + t.table + "'"
+		// #nosec G201 - table and column names are from a fixed list, not user input
+		schema := fmt.Sprintf(`
+			DROP TABLE IF EXISTS %[1]s;
+			CREATE TABLE %[1]s (%[2]s TEXT PRIMARY KEY NOT NULL, %[3]s) WITHOUT ROWID;
+		`, t.staging(), t.columns[0], strings.Join(t.columns[1:], ", "))
+		if _, err := db.Exec(schema); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", t.staging(), err)
+		}
+	}
+
+	// #nosec G202 - table names are from a fixed list, not user input
+	rows, err := db.Query(`
+		SELECT name, sql FROM sqlite_master
+		WHERE type = 'index' AND sql IS NOT NULL AND tbl_name IN (` + strings.Join(tables, ", ") + `)
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name, sql string
+		if err := rows.Scan(&name, &sql); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !keptIndexes[name] {
+			names = append(names, name)
+			b.indexes = append(b.indexes, sql)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if _, err := db.Exec(`DROP INDEX IF EXISTS "` + name + `"`); err != nil {
+			// Put back those already dropped
+			b.indexes = b.indexes[:i]
+			b.rebuildIndexes(context.Background())
+			return nil, fmt.Errorf("failed to drop index %s: %w", name, err)
+		}
+	}
+
+	db.bulk.Store(b)
+	b.phases = append(b.phases, BulkPhase{BulkPhasePrepare, time.Since(start)})
+	b.start = time.Now()
+	return b, nil
+}
+
+// stage adds a row to the staging table of table when a bulk load is
+// running, reporting whether it did. Rows are written once bulkBatchSize
+// of them are staged, so an error may be of rows staged before.
+func (db *DB) stage(table string, values ...interface{}) (bool, error) {
+	b := db.bulk.Load()
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[table] = append(b.pending[table], values)
+	b.rows++
+	if b.rows < bulkBatchSize {
+		return true, nil
+	}
+	return true, b.flush()
+}
+
+// flush writes the staged rows in a single transaction. b.mu is held.
+func (b *BulkLoad) flush() error {
+	if b.rows == 0 {
+		return nil
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range stagedTables {
+		rows := b.pending[t.table]
+		if len(rows) == 0 {
+			continue
+		}
+		// #nosec G202 - table names are from a fixed list, not user input
+		stmt, err := tx.Prepare(`INSERT OR REPLACE INTO ` + t.staging() + ` VALUES (` +
+			strings.TrimSuffix(strings.Repeat("?, ", len(t.columns)), ", ") + `)`)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if _, err := stmt.Exec(row...); err != nil {
+				stmt.Close()
+				return fmt.Errorf("failed to stage %s %v: %w", t.table, row[0], err)
+			}
+		}
+		stmt.Close()
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for table := range b.pending {
+		b.pending[table] = b.pending[table][:0]
+	}
+	b.rows = 0
+	return nil
+}
+
+// Finish ends a bulk load: it moves the staged records into their tables,
+// one transaction per table, rebuilds the dropped indexes and the
+// sample_runs table, and returns how long each phase took. Indexes are
+// rebuilt even when merging fails, so that the database is left usable.
+func (b *BulkLoad) Finish(ctx context.Context) ([]BulkPhase, error) {
+	if !b.db.bulk.CompareAndSwap(b, nil) {
+		return b.phases, fmt.Errorf("bulk load already finished")
+	}
+	b.mu.Lock()
+	err := b.flush()
+	b.mu.Unlock()
+	b.phases = append(b.phases, BulkPhase{BulkPhaseLoad, time.Since(b.start)})
+
+	if err == nil {
+		step := time.Now()
+		err = b.merge(ctx)
+		b.phases = append(b.phases, BulkPhase{BulkPhaseMerge, time.Since(step)})
+	}
+
+	step := time.Now()
+	if indexErr := b.rebuildIndexes(ctx); err == nil {
+		err = indexErr
+	}
+	b.phases = append(b.phases, BulkPhase{BulkPhaseIndex, time.Since(step)})
+	if err != nil {
+		return b.phases, err
+	}
+
+	step = time.Now()
+	if _, err := b.db.RebuildSampleRuns(); err != nil {
+		return b.phases, fmt.Errorf("failed to rebuild sample_runs: %w", err)
+	}
+	b.phases = append(b.phases, BulkPhase{BulkPhaseSampleRuns, time.Since(step)})
+	return b.phases, nil
+}
+
+// merge moves the staged rows into the record tables, in key order, and
+// drops the staging tables
+func (b *BulkLoad) merge(ctx context.Context) error {
+	for _, t := range stagedTables {
+		tx, err := b.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		columns := strings.Join(t.columns, ", ")
+		// #nosec G201 - table and column names are from a fixed list, not user input
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT OR REPLACE INTO %s (%s)
+			SELECT %s FROM %s ORDER BY %s
+		`, t.table, columns, columns, t.staging(), t.columns[0]))
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `DROP TABLE `+t.staging())
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to merge staged %s: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+// rebuildIndexes recreates the indexes dropped by BeginBulkLoad
+func (b *BulkLoad) rebuildIndexes(ctx context.Context) error {
+	for _, sql := range b.indexes {
+		if _, err := b.db.ExecContext(ctx, sql); err != nil {
+			return fmt.Errorf("failed to rebuild index: %w", err)
+		}
+	}
+	return nil
+}
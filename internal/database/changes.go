@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Change log operations. An upsert asks consumers to read the record again;
+// a record that no longer exists by then has been deleted.
+const (
+	ChangeUpsert = "upsert"
+	ChangeDelete = "delete"
+)
+
+// Change is the latest change to a record. Only the latest change is kept,
+// so a record changed several times appears once, at the generation of its
+// last change.
+type Change struct {
+	Generation int64     `json:"generation"`
+	Accession  string    `json:"accession"`
+	RecordType string    `json:"record_type"`
+	Op         string    `json:"op"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// changeTables are the record tables whose inserts, updates and deletes are
+// logged in changes
+var changeTables = []struct {
+	table, key, recordType string
+}{
+	{"studies", "study_accession", "study"},
+	{"experiments", "experiment_accession", "experiment"},
+	{"samples", "sample_accession", "sample"},
+	{"runs", "run_accession", "run"},
+	{"analyses", "analysis_accession", "analysis"},
+	{"submissions", "submission_accession", "submission"},
+}
+
+// logChange returns the trigger statements recording op on a record. The
+// old entry is deleted rather than replaced, as a trigger takes the
+// conflict policy of the statement that fired it, and INSERT OR IGNORE
+// would keep the old generation.
+func logChange(accession, recordType, op string) string {
+	return fmt.Sprintf(`
+			DELETE FROM changes WHERE accession = %[1]s;
+			INSERT INTO changes (accession, record_type, op) VALUES (%[1]s, %[2]s, '%[3]s');`,
+		accession, recordType, op)
+}
+
+// createChangeTriggers creates the triggers filling the change log, so that
+// ingests, incremental updates, suppressions and curations are all logged
+// without each having to do it
+func createChangeTriggers(db *sql.DB) error {
+	var triggers []string
+	for _, t := range changeTables {
+		recordType := "'" + t.recordType + "'"
+		triggers = append(triggers,
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS changes_%[1]s_after_insert AFTER INSERT ON %[1]s BEGIN%[2]s
+		END`, t.table, logChange("new."+t.key, recordType, ChangeUpsert)),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS changes_%[1]s_after_update AFTER UPDATE ON %[1]s BEGIN%[2]s
+		END`, t.table, logChange("new."+t.key, recordType, ChangeUpsert)),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS changes_%[1]s_after_delete AFTER DELETE ON %[1]s BEGIN%[2]s
+		END`, t.table, logChange("old."+t.key, recordType, ChangeDelete)),
+		)
+	}
+
+	// Curations are merged into the indexed documents of the records they
+	// overlay, which change with them
+	triggers = append(triggers,
+		`CREATE TRIGGER IF NOT EXISTS changes_curations_after_insert AFTER INSERT ON curations BEGIN`+
+			logChange("new.accession", "new.record_type", ChangeUpsert)+`
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS changes_curations_after_update AFTER UPDATE ON curations BEGIN`+
+			logChange("new.accession", "new.record_type", ChangeUpsert)+`
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS changes_curations_after_delete AFTER DELETE ON curations BEGIN`+
+			logChange("old.accession", "old.record_type", ChangeUpsert)+`
+		END`,
+		// So are the rules a record is flagged by. Updates only change the
+		// message and run of a flag, which are not indexed.
+		`CREATE TRIGGER IF NOT EXISTS changes_qc_flags_after_insert AFTER INSERT ON qc_flags BEGIN`+
+			logChange("new.accession", "new.record_type", ChangeUpsert)+`
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS changes_qc_flags_after_delete AFTER DELETE ON qc_flags BEGIN`+
+			logChange("old.accession", "old.record_type", ChangeUpsert)+`
+		END`,
+	)
+
+	for _, trigger := range triggers {
+		// #nosec G201 - table and column names are from a fixed list, not user input
+		if _, err := db.Exec(trigger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChangeGeneration returns the generation of the latest change logged, or 0
+// before any change. Pruning the log does not lower it.
+func (db *DB) ChangeGeneration(ctx context.Context) (int64, error) {
+	var generation int64
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'changes'), 0)
+	`).Scan(&generation)
+	return generation, err
+}
+
+// ChangesSince returns up to limit changes after generation, oldest first
+func (db *DB) ChangesSince(ctx context.Context, generation int64, limit int) ([]Change, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT generation, accession, record_type, op, changed_at
+		FROM changes
+		WHERE generation > ?
+		ORDER BY generation
+		LIMIT ?
+	`, generation, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []Change
+	for rows.Next() {
+		var c Change
+		if err := rows.Scan(&c.Generation, &c.Accession, &c.RecordType, &c.Op, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// ChangeCursor returns the last generation applied by consumer, and false
+// if the consumer has not recorded one
+func (db *DB) ChangeCursor(ctx context.Context, consumer string) (int64, bool, error) {
+	var generation int64
+	err := db.QueryRowContext(ctx, `SELECT generation FROM change_cursors WHERE consumer = ?`, consumer).Scan(&generation)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return generation, true, nil
+}
+
+// SetChangeCursor records that consumer has applied the changes up to
+// generation
+func (db *DB) SetChangeCursor(ctx context.Context, consumer string, generation int64) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO change_cursors (consumer, generation, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(consumer) DO UPDATE SET generation = excluded.generation, updated_at = excluded.updated_at
+	`, consumer, generation)
+	return err
+}
+
+// PruneChanges removes the changes every consumer has applied, or all of
+// them when no consumer has recorded a cursor, and returns how many were
+// removed. A consumer starting later begins with a full rebuild.
+func (db *DB) PruneChanges(ctx context.Context) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM changes
+		WHERE generation <= COALESCE((SELECT MIN(generation) FROM change_cursors), generation)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
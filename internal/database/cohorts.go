@@ -0,0 +1,312 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Generation identifies the state of the records in the database, so that
+// results computed at different times can be related to the data they saw.
+type Generation struct {
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	Records   int64     `json:"records"`
+}
+
+// String formats the generation for display.
+func (g Generation) String() string {
+	if g.UpdatedAt.IsZero() {
+		return fmt.Sprintf("%d records", g.Records)
+	}
+	return fmt.Sprintf("%d records, updated %s", g.Records, g.UpdatedAt.Local().Format("2006-01-02 15:04"))
+}
+
+// Cohort is a frozen search result: the query that produced it, the
+// database generation it ran against, and the records it matched.
+type Cohort struct {
+	Name        string            `json:"name"`
+	Query       string            `json:"query"`
+	Filters     map[string]string `json:"filters,omitempty"`
+	Generation  Generation        `json:"generation"`
+	MemberCount int               `json:"member_count"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// CohortMember is a record matched by a cohort, with a fingerprint of its
+// extracted fields at the time of matching.
+type CohortMember struct {
+	Accession   string `json:"accession"`
+	RecordType  string `json:"record_type,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// CohortDiff reports how the records matched by a cohort query changed.
+type CohortDiff struct {
+	Added     []CohortMember `json:"added"`
+	Removed   []CohortMember `json:"removed"`
+	Changed   []CohortMember `json:"changed"`
+	Unchanged int            `json:"unchanged"`
+}
+
+// GetGeneration returns the current generation of the database: the total
+// number of core records and the time of the last ingest or statistics
+// update.
+func (db *DB) GetGeneration() (*Generation, error) {
+	g := &Generation{}
+	for _, table := range []string{"studies", "experiments", "samples", "runs"} {
+		count, err := db.CountTable(table)
+		if err != nil {
+			return nil, err
+		}
+		g.Records += count
+	}
+
+	// ORDER BY keeps the column type, so the driver returns a time
+	for _, query := range []string{
+		`SELECT last_updated FROM statistics ORDER BY last_updated DESC LIMIT 1`,
+		`SELECT ingested_at FROM record_sources ORDER BY ingested_at DESC LIMIT 1`,
+	} {
+		var t time.Time
+		err := db.QueryRow(query).Scan(&t)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if t.After(g.UpdatedAt) {
+			g.UpdatedAt = t
+		}
+	}
+	return g, nil
+}
+
+// RecordFingerprint returns a short hash of a record's extracted fields,
+// or an empty string for record types without a table.
+func (db *DB) RecordFingerprint(recordType, accession string) (string, error) {
+	var record interface{}
+	var err error
+	switch recordType {
+	case "study":
+		record, err = db.GetStudy(accession)
+	case "experiment":
+		record, err = db.GetExperiment(accession)
+	case "sample":
+		record, err = db.GetSample(accession)
+	case "run":
+		record, err = db.GetRun(accession)
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// CreateCohort stores a cohort and its members. An existing cohort of the
+// same name is only replaced when replace is set.
+func (db *DB) CreateCohort(c *Cohort, members []CohortMember, replace bool) error {
+	filters, err := json.Marshal(c.Filters)
+	if err != nil {
+		return err
+	}
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now().UTC()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM cohorts WHERE name = ?`, c.Name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		if !replace {
+			return fmt.Errorf("cohort already exists: %s", c.Name)
+		}
+		if _, err := tx.Exec(`DELETE FROM cohort_members WHERE cohort_name = ?`, c.Name); err != nil {
+			return err
+		}
+	}
+
+	var updatedAt interface{}
+	if !c.Generation.UpdatedAt.IsZero() {
+		updatedAt = c.Generation.UpdatedAt
+	}
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO cohorts (name, query, filters, db_records, db_updated_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, c.Name, c.Query, string(filters), c.Generation.Records, updatedAt, c.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO cohort_members (cohort_name, accession, record_type, fingerprint)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, m := range members {
+		if _, err := stmt.Exec(c.Name, m.Accession, m.RecordType, m.Fingerprint); err != nil {
+			return err
+		}
+	}
+	c.MemberCount = len(members)
+
+	return tx.Commit()
+}
+
+// GetCohort retrieves a cohort with its member count.
+func (db *DB) GetCohort(name string) (*Cohort, error) {
+	c, err := scanCohort(db.QueryRow(`
+		SELECT c.name, c.query, c.filters, c.db_records, c.db_updated_at, c.created_at,
+			   (SELECT COUNT(*) FROM cohort_members m WHERE m.cohort_name = c.name)
+		FROM cohorts c
+		WHERE c.name = ?
+	`, name))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("cohort not found: %s", name)
+	}
+	return c, err
+}
+
+// ListCohorts returns all cohorts ordered by name.
+func (db *DB) ListCohorts() ([]Cohort, error) {
+	rows, err := db.Query(`
+		SELECT c.name, c.query, c.filters, c.db_records, c.db_updated_at, c.created_at, COUNT(m.accession)
+		FROM cohorts c
+		LEFT JOIN cohort_members m ON m.cohort_name = c.name
+		GROUP BY c.name
+		ORDER BY c.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cohorts []Cohort
+	for rows.Next() {
+		c, err := scanCohort(rows)
+		if err != nil {
+			return nil, err
+		}
+		cohorts = append(cohorts, *c)
+	}
+	return cohorts, rows.Err()
+}
+
+func scanCohort(row rowScanner) (*Cohort, error) {
+	c := &Cohort{}
+	var filters sql.NullString
+	var updatedAt sql.NullTime
+	if err := row.Scan(&c.Name, &c.Query, &filters, &c.Generation.Records, &updatedAt, &c.CreatedAt, &c.MemberCount); err != nil {
+		return nil, err
+	}
+	if filters.Valid && filters.String != "" {
+		if err := json.Unmarshal([]byte(filters.String), &c.Filters); err != nil {
+			return nil, fmt.Errorf("invalid filters for cohort %s: %w", c.Name, err)
+		}
+	}
+	c.Generation.UpdatedAt = updatedAt.Time
+	return c, nil
+}
+
+// GetCohortMembers returns the members of a cohort ordered by accession.
+func (db *DB) GetCohortMembers(name string) ([]CohortMember, error) {
+	rows, err := db.Query(`
+		SELECT accession, COALESCE(record_type, ''), COALESCE(fingerprint, '')
+		FROM cohort_members
+		WHERE cohort_name = ?
+		ORDER BY accession
+	`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []CohortMember
+	for rows.Next() {
+		var m CohortMember
+		if err := rows.Scan(&m.Accession, &m.RecordType, &m.Fingerprint); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// DeleteCohort removes a cohort and its members.
+func (db *DB) DeleteCohort(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM cohorts WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("cohort not found: %s", name)
+	}
+	if _, err := tx.Exec(`DELETE FROM cohort_members WHERE cohort_name = ?`, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DiffCohort compares the frozen members of a cohort with the records the
+// same query matches now. A member counts as changed when both sides have
+// a fingerprint and they differ; the current member is reported.
+func DiffCohort(frozen, current []CohortMember) *CohortDiff {
+	diff := &CohortDiff{
+		Added:   []CohortMember{},
+		Removed: []CohortMember{},
+		Changed: []CohortMember{},
+	}
+
+	before := make(map[string]CohortMember, len(frozen))
+	for _, m := range frozen {
+		before[m.Accession] = m
+	}
+	seen := make(map[string]bool, len(current))
+	for _, m := range current {
+		seen[m.Accession] = true
+		old, ok := before[m.Accession]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, m)
+		case old.Fingerprint != "" && m.Fingerprint != "" && old.Fingerprint != m.Fingerprint:
+			diff.Changed = append(diff.Changed, m)
+		default:
+			diff.Unchanged++
+		}
+	}
+	for _, m := range frozen {
+		if !seen[m.Accession] {
+			diff.Removed = append(diff.Removed, m)
+		}
+	}
+
+	for _, list := range [][]CohortMember{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Accession < list[j].Accession })
+	}
+	return diff
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Collection is a user-defined, named set of records.
+type Collection struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CollectionMember is a single record belonging to a collection.
+type CollectionMember struct {
+	Accession  string    `json:"accession"`
+	RecordType string    `json:"record_type,omitempty"`
+	AddedAt    time.Time `json:"added_at"`
+}
+
+// CreateCollection creates a collection if it does not already exist.
+// The description of an existing collection is only updated when a new one is given.
+func (db *DB) CreateCollection(name, description string) error {
+	_, err := db.Exec(`
+		INSERT INTO collections (name, description, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			description = COALESCE(NULLIF(excluded.description, ''), collections.description)
+	`, name, description, time.Now().UTC())
+	return err
+}
+
+// GetCollection retrieves a collection with its member count.
+func (db *DB) GetCollection(name string) (*Collection, error) {
+	c := &Collection{}
+	var description sql.NullString
+	err := db.QueryRow(`
+		SELECT c.name, c.description, c.created_at,
+			   (SELECT COUNT(*) FROM collection_members m WHERE m.collection_name = c.name)
+		FROM collections c
+		WHERE c.name = ?
+	`, name).Scan(&c.Name, &description, &c.CreatedAt, &c.MemberCount)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("collection not found: %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Description = description.String
+	return c, nil
+}
+
+// ListCollections returns all collections ordered by name.
+func (db *DB) ListCollections() ([]Collection, error) {
+	rows, err := db.Query(`
+		SELECT c.name, c.description, c.created_at, COUNT(m.accession)
+		FROM collections c
+		LEFT JOIN collection_members m ON m.collection_name = c.name
+		GROUP BY c.name
+		ORDER BY c.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []Collection
+	for rows.Next() {
+		var c Collection
+		var description sql.NullString
+		if err := rows.Scan(&c.Name, &description, &c.CreatedAt, &c.MemberCount); err != nil {
+			return nil, err
+		}
+		c.Description = description.String
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+// DeleteCollection removes a collection and all of its memberships.
+func (db *DB) DeleteCollection(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM collections WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("collection not found: %s", name)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM collection_members WHERE collection_name = ?`, name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddToCollection adds records to a collection, creating the collection if needed.
+// Accessions already in the collection are left untouched. Returns the number of
+// newly added members.
+func (db *DB) AddToCollection(name string, members []CollectionMember) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO collections (name, created_at) VALUES (?, ?)
+	`, name, now); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO collection_members (
+			collection_name, accession, record_type, added_at
+		) VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, m := range members {
+		result, err := stmt.Exec(name, m.Accession, m.RecordType, now)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+
+	return added, tx.Commit()
+}
+
+// RemoveFromCollection removes records from a collection.
+// Returns the number of members removed.
+func (db *DB) RemoveFromCollection(name string, accessions []string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		DELETE FROM collection_members WHERE collection_name = ? AND accession = ?
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	removed := 0
+	for _, acc := range accessions {
+		result, err := stmt.Exec(name, acc)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			removed++
+		}
+	}
+
+	return removed, tx.Commit()
+}
+
+// GetCollectionMembers returns the members of a collection in insertion order.
+func (db *DB) GetCollectionMembers(name string) ([]CollectionMember, error) {
+	rows, err := db.Query(`
+		SELECT accession, COALESCE(record_type, ''), added_at
+		FROM collection_members
+		WHERE collection_name = ?
+		ORDER BY added_at, accession
+	`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []CollectionMember
+	for rows.Next() {
+		var m CollectionMember
+		if err := rows.Scan(&m.Accession, &m.RecordType, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// GetCollectionAccessions returns just the accessions belonging to a collection.
+func (db *DB) GetCollectionAccessions(name string) ([]string, error) {
+	members, err := db.GetCollectionMembers(name)
+	if err != nil {
+		return nil, err
+	}
+
+	accessions := make([]string, len(members))
+	for i, m := range members {
+		accessions[i] = m.Accession
+	}
+	return accessions, nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// indexSelectivity is the share of a table, one in this many rows, that a
+// query searching it through an index is assumed to read
+const indexSelectivity = 10
+
+// QueryCost is the cost of a query estimated from its query plan, before
+// it runs
+type QueryCost struct {
+	Rows  int64    `json:"rows"`            // Rows the query reads
+	Scans []string `json:"scans,omitempty"` // Tables it reads in full
+}
+
+// tableRefs matches the tables of a query and their aliases
+var tableRefs = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+"?(\w+)"?(?:\s+(?:AS\s+)?(\w+))?`)
+
+// notAliases are the keywords that can follow a table name in place of an
+// alias
+var notAliases = map[string]bool{
+	"WHERE": true, "ORDER": true, "GROUP": true, "LIMIT": true, "ON": true, "USING": true,
+	"JOIN": true, "LEFT": true, "INNER": true, "CROSS": true, "NATURAL": true, "OUTER": true,
+	"UNION": true, "EXCEPT": true, "INTERSECT": true, "HAVING": true, "WINDOW": true,
+}
+
+// EstimateQueryCost estimates the rows a query reads from its query plan
+// and the sizes of its tables: every row of a table it scans, and a tenth
+// of a table it searches through an index. A LIMIT is not taken into
+// account, as a scan that filters rows may read the whole table to fill it.
+func (db *DB) EstimateQueryCost(ctx context.Context, query string, args ...interface{}) (*QueryCost, error) {
+	tables := make(map[string]string)
+	for _, m := range tableRefs.FindAllStringSubmatch(query, -1) {
+		tables[strings.ToLower(m[1])] = m[1]
+		if m[2] != "" && !notAliases[strings.ToUpper(m[2])] {
+			tables[strings.ToLower(m[2])] = m[1]
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan query: %w", err)
+	}
+	var details []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		details = append(details, detail)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cost := &QueryCost{}
+	for _, detail := range details {
+		// SCAN <table> ... or SEARCH <table> USING ...
+		fields := strings.Fields(detail)
+		if len(fields) < 2 || (fields[0] != "SCAN" && fields[0] != "SEARCH") {
+			continue
+		}
+		table, ok := tables[strings.ToLower(fields[1])]
+		if !ok {
+			continue // A constant row or a subquery
+		}
+		n, err := db.EstimateTableRows(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if fields[0] == "SCAN" {
+			cost.Rows += n
+			cost.Scans = append(cost.Scans, table)
+		} else {
+			cost.Rows += max(n/indexSelectivity, 1)
+		}
+	}
+	return cost, nil
+}
+
+// EstimateTableRows estimates the rows of a table from its largest rowid,
+// which is read from the end of the table rather than counted. It is
+// exact unless rows have been deleted.
+func (db *DB) EstimateTableRows(ctx context.Context, table string) (int64, error) {
+	if err := ValidateIdentifier(table); err != nil {
+		return 0, err
+	}
+	var n sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT MAX(rowid) FROM "`+table+`"`).Scan(&n)
+	if err != nil {
+		// Tables without a rowid are counted
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM "`+table+`"`).Scan(&n); err != nil {
+			return 0, fmt.Errorf("failed to count rows of %s: %w", table, err)
+		}
+	}
+	return n.Int64, nil
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Curation holds locally curated fields for a record. Curations are stored
+// in their own overlay table so they survive re-ingest of upstream data.
+type Curation struct {
+	Accession    string    `json:"accession"`
+	RecordType   string    `json:"record_type"`
+	CuratedTitle string    `json:"curated_title,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	Notes        string    `json:"notes,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// IsEmpty reports whether the curation carries no curated fields.
+func (c *Curation) IsEmpty() bool {
+	return c.CuratedTitle == "" && len(c.Tags) == 0 && c.Notes == ""
+}
+
+// UpsertCuration inserts or replaces the curation overlay for a record.
+func (db *DB) UpsertCuration(c *Curation) error {
+	tags, err := json.Marshal(c.Tags)
+	if err != nil {
+		return fmt.Errorf("failed to encode tags: %w", err)
+	}
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = time.Now().UTC()
+	}
+
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO curations (
+			accession, record_type, curated_title, tags, notes, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`, c.Accession, c.RecordType, c.CuratedTitle, string(tags), c.Notes, c.UpdatedAt)
+	return err
+}
+
+// GetCuration retrieves the curation overlay for a record.
+// Returns nil without an error if the record has not been curated.
+func (db *DB) GetCuration(accession string) (*Curation, error) {
+	row := db.QueryRow(`
+		SELECT accession, record_type, COALESCE(curated_title, ''),
+			   COALESCE(tags, '[]'), COALESCE(notes, ''), updated_at
+		FROM curations
+		WHERE accession = ?
+	`, accession)
+
+	c, err := scanCuration(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+// GetCurations retrieves curation overlays for a set of accessions, keyed by accession.
+// Accessions without a curation are absent from the result.
+func (db *DB) GetCurations(accessions []string) (map[string]*Curation, error) {
+	curations := make(map[string]*Curation)
+	if len(accessions) == 0 {
+		return curations, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(accessions)), ",")
+	args := make([]interface{}, len(accessions))
+	for i, acc := range accessions {
+		args[i] = acc
+	}
+
+	// #nosec G201 - only placeholders are interpolated
+	query := fmt.Sprintf(`
+		SELECT accession, record_type, COALESCE(curated_title, ''),
+			   COALESCE(tags, '[]'), COALESCE(notes, ''), updated_at
+		FROM curations
+		WHERE accession IN (%s)
+	`, placeholders)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCuration(rows)
+		if err != nil {
+			return nil, err
+		}
+		curations[c.Accession] = c
+	}
+
+	return curations, rows.Err()
+}
+
+// DeleteCuration removes the curation overlay for a record.
+func (db *DB) DeleteCuration(accession string) error {
+	_, err := db.Exec(`DELETE FROM curations WHERE accession = ?`, accession)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCuration(row rowScanner) (*Curation, error) {
+	c := &Curation{}
+	var tags string
+	if err := row.Scan(&c.Accession, &c.RecordType, &c.CuratedTitle,
+		&tags, &c.Notes, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tags), &c.Tags); err != nil {
+		return nil, fmt.Errorf("invalid tags for %s: %w", c.Accession, err)
+	}
+	return c, nil
+}
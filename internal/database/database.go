@@ -3,19 +3,49 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/nishad/srake/internal/sketch"
 )
 
 // DB wraps the SQL database connection
 type DB struct {
 	*sql.DB
 	path string
+
+	readOnly    bool   // opened as a replica, see OpenOptions
+	replication string // tool replicating the file, if any
+
+	*dbState
+
+	tx *sql.Tx // transaction of a view made by WithTx, nil otherwise
+}
+
+// dbState is the state of a database shared with the views of WithTx
+type dbState struct {
+	sketchMu sync.Mutex
+	sketches map[string]*sketch.HLL // values inserted since the last FlushSketches
+
+	bulk atomic.Pointer[BulkLoad] // running bulk load, see BeginBulkLoad
+}
+
+// Wrap returns a DB for a connection opened elsewhere, without creating
+// or migrating its schema
+func Wrap(sqlDB *sql.DB) *DB {
+	return &DB{DB: sqlDB, dbState: &dbState{}}
+}
+
+// Path returns the file the database was opened from
+func (db *DB) Path() string {
+	return db.path
 }
 
 // GetSQLDB returns the underlying SQL database connection
@@ -25,6 +55,12 @@ func (db *DB) GetSQLDB() *sql.DB {
 
 // Initialize creates and configures the database connection
 func Initialize(path string) (*DB, error) {
+	return Open(path, OpenOptions{})
+}
+
+// openPrimary opens the database at path for reading and writing, creating
+// its tables and bringing older schemas up to date
+func openPrimary(path string, opts OpenOptions) (*DB, error) {
 	db, err := sql.Open("sqlite3", path+"?_journal=WAL&_timeout=5000&_sync=NORMAL")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -43,6 +79,7 @@ func Initialize(path string) (*DB, error) {
 		"PRAGMA busy_timeout = 10000",       // 10 second timeout
 		"PRAGMA foreign_keys = OFF",         // Disable FK checks during import
 	}
+	pragmas = replicationPragmas(pragmas, opts.Replication)
 
 	for _, pragma := range pragmas {
 		if _, err := db.Exec(pragma); err != nil {
@@ -55,20 +92,63 @@ func Initialize(path string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	// Record the ingest of each record source in databases created before
+	if err := addRecordSourceIngests(db); err != nil {
+		return nil, fmt.Errorf("failed to add ingests to record_sources: %w", err)
+	}
+	if err := addIngestMeasures(db); err != nil {
+		return nil, fmt.Errorf("failed to add measures to ingests: %w", err)
+	}
+
+	// Log record changes from every write path
+	if err := createChangeTriggers(db); err != nil {
+		return nil, fmt.Errorf("failed to create change triggers: %w", err)
+	}
+
+	// Fill sample_runs in databases ingested before it existed
+	if err := backfillSampleRuns(db); err != nil {
+		return nil, fmt.Errorf("failed to fill sample_runs: %w", err)
+	}
+
+	// Keep the BioSample and BioProject tables in step with the
+	// identifiers and attributes they are read from
+	if err := createXrefTriggers(db); err != nil {
+		return nil, fmt.Errorf("failed to create cross-reference triggers: %w", err)
+	}
+	if err := runBackfill(db, "xrefs", backfillXrefs); err != nil {
+		return nil, fmt.Errorf("failed to fill biosamples and bioprojects: %w", err)
+	}
+
+	// Keep GEO accessions findable whatever identifier they came in
+	if err := createGEOTriggers(db); err != nil {
+		return nil, fmt.Errorf("failed to create GEO identifier triggers: %w", err)
+	}
+	if err := runBackfill(db, "geo_identifiers", backfillGEOIdentifiers); err != nil {
+		return nil, fmt.Errorf("failed to fill GEO identifiers: %w", err)
+	}
+
 	// Set connection pool settings
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	return &DB{
-		DB:   db,
-		path: path,
+		DB:          db,
+		path:        path,
+		replication: opts.Replication,
+		dbState:     &dbState{},
 	}, nil
 }
 
 func createTables(db *sql.DB) error {
 	// Core SRAmetadb-compatible schema from FINAL_IMPLEMENTATION_CONTEXT
 	schema := `
+	-- Text columns use SQLite's BINARY collation, which compares UTF-8
+	-- bytes, so that sorting does not depend on the locale or OS. Lookups
+	-- that ignore case use NOCASE, which folds ASCII letters only. Queries
+	-- whose output is shown or exported end their ORDER BY with a unique
+	-- key, so that ties come out the same on every machine.
+
 	-- Core SRAmetadb-compatible schema
 	CREATE TABLE IF NOT EXISTS studies (
 		study_accession TEXT PRIMARY KEY,
@@ -180,6 +260,46 @@ func createTables(db *sql.DB) error {
 	-- Index for quick lookups
 	CREATE INDEX IF NOT EXISTS idx_stats_table ON statistics(table_name);
 
+	-- NCBI taxonomy, numbered in pre-order (lft, rgt) so that the
+	-- descendants of a taxon are the taxa with lft between its lft and rgt
+	CREATE TABLE IF NOT EXISTS taxonomy (
+		tax_id INTEGER PRIMARY KEY,
+		parent_id INTEGER NOT NULL,
+		rank TEXT,
+		name TEXT,
+		lft INTEGER NOT NULL,
+		rgt INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_taxonomy_name ON taxonomy(name COLLATE NOCASE);
+	CREATE INDEX IF NOT EXISTS idx_taxonomy_lft ON taxonomy(lft);
+	CREATE INDEX IF NOT EXISTS idx_samples_taxon ON samples(taxon_id);
+
+	-- Vocabularies loaded by 'srake ontology load', such as MeSH or EFO,
+	-- and every label of their terms: the preferred name and its exact
+	-- synonyms, which searches are expanded with
+	CREATE TABLE IF NOT EXISTS ontologies (
+		name TEXT PRIMARY KEY,
+		format TEXT NOT NULL,
+		source_file TEXT,
+		terms INTEGER DEFAULT 0,
+		loaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS ontology_labels (
+		ontology TEXT NOT NULL,
+		term_id TEXT NOT NULL,
+		label TEXT NOT NULL COLLATE NOCASE,
+		preferred BOOLEAN DEFAULT 0,
+		PRIMARY KEY (ontology, term_id, label)
+	);
+	CREATE INDEX IF NOT EXISTS idx_ontology_labels_label ON ontology_labels(label);
+
+	-- HyperLogLog sketches of record and facet value counts
+	CREATE TABLE IF NOT EXISTS sketches (
+		dimension TEXT PRIMARY KEY,
+		registers BLOB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
 	-- Pool/multiplex relationships
 	CREATE TABLE IF NOT EXISTS sample_pool (
 		pool_id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -229,6 +349,359 @@ func createTables(db *sql.DB) error {
 	CREATE INDEX IF NOT EXISTS idx_link_record ON links(record_type, record_accession);
 	CREATE INDEX IF NOT EXISTS idx_exp_sample_exp ON experiment_samples(experiment_accession);
 	CREATE INDEX IF NOT EXISTS idx_exp_sample_sample ON experiment_samples(sample_accession);
+
+	-- Denormalized sample-to-run fast path, maintained at ingest from
+	-- experiment_samples and runs
+	CREATE TABLE IF NOT EXISTS sample_runs (
+		sample_accession TEXT NOT NULL,
+		run_accession TEXT NOT NULL,
+		experiment_accession TEXT NOT NULL,
+		study_accession TEXT,
+		PRIMARY KEY (sample_accession, run_accession)
+	);
+	CREATE INDEX IF NOT EXISTS idx_sample_runs_run ON sample_runs(run_accession);
+	CREATE INDEX IF NOT EXISTS idx_sample_runs_exp ON sample_runs(experiment_accession);
+	CREATE INDEX IF NOT EXISTS idx_sample_runs_study ON sample_runs(study_accession);
+
+	-- Sample attributes, one row per tag, maintained at ingest from the
+	-- sample attribute list. Tags are normalized (see NormalizeAttributeTag);
+	-- value_num holds the leading number of the value, if any.
+	CREATE TABLE IF NOT EXISTS sample_attributes (
+		sample_accession TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		value TEXT,
+		units TEXT,
+		value_num REAL
+	);
+	CREATE INDEX IF NOT EXISTS idx_sample_attributes_sample ON sample_attributes(sample_accession);
+	CREATE INDEX IF NOT EXISTS idx_sample_attributes_value ON sample_attributes(tag, value COLLATE NOCASE);
+	CREATE INDEX IF NOT EXISTS idx_sample_attributes_num ON sample_attributes(tag, value_num);
+
+	-- Local curation overlay, kept separate so it survives re-ingest
+	CREATE TABLE IF NOT EXISTS curations (
+		accession TEXT PRIMARY KEY,
+		record_type TEXT NOT NULL,
+		curated_title TEXT,
+		tags JSON,
+		notes TEXT,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- User-defined collections of records
+	CREATE TABLE IF NOT EXISTS collections (
+		name TEXT PRIMARY KEY,
+		description TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS collection_members (
+		collection_name TEXT NOT NULL,
+		accession TEXT NOT NULL,
+		record_type TEXT,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (collection_name, accession)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_collection_members_accession ON collection_members(accession);
+
+	-- Search relevance judgments for ranking evaluation and tuning
+	CREATE TABLE IF NOT EXISTS search_feedback (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		query TEXT NOT NULL,
+		accession TEXT NOT NULL,
+		relevant BOOLEAN NOT NULL,
+		source TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_search_feedback_query ON search_feedback(query);
+
+	-- How often studies and runs were returned by searches and fetched
+	-- through the API, by UTC day (YYYY-MM-DD), when the server counts them
+	CREATE TABLE IF NOT EXISTS record_popularity (
+		accession TEXT NOT NULL,
+		record_type TEXT NOT NULL,
+		day TEXT NOT NULL,
+		returned INTEGER NOT NULL DEFAULT 0,
+		fetched INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (accession, day)
+	);
+	CREATE INDEX IF NOT EXISTS idx_record_popularity_day ON record_popularity(day);
+
+	-- Asynchronous export and search jobs, persisted across server restarts
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		spec JSON NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT,
+		result_path TEXT,
+		result_size INTEGER DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMP,
+		finished_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, created_at);
+
+	-- Original record XML, compressed and stored once per distinct content
+	CREATE TABLE IF NOT EXISTS raw_blobs (
+		hash TEXT PRIMARY KEY,
+		codec TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		data BLOB NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS raw_records (
+		accession TEXT PRIMARY KEY,
+		record_type TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_raw_records_hash ON raw_records(hash);
+
+	-- Records that failed validation at ingest, kept with their original
+	-- XML and errors (a JSON array) instead of being inserted
+	CREATE TABLE IF NOT EXISTS quarantine (
+		ingest_id TEXT NOT NULL,
+		accession TEXT NOT NULL,
+		record_type TEXT NOT NULL,
+		source_file TEXT,
+		xml BLOB NOT NULL,
+		errors TEXT NOT NULL,
+		quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (ingest_id, accession)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_quarantine_accession ON quarantine(accession);
+
+	-- Archive (NCBI, ENA, DDBJ), file and ingest each record was last
+	-- ingested from
+	CREATE TABLE IF NOT EXISTS record_sources (
+		accession TEXT PRIMARY KEY,
+		record_type TEXT NOT NULL,
+		archive TEXT NOT NULL,
+		source_file TEXT,
+		ingested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		ingest_id TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_record_sources_archive ON record_sources(archive);
+
+	-- Each file or URL ingested; finished_at is NULL while it runs, or
+	-- when the ingest was interrupted. The archive size, database growth
+	-- and time of completed ingests estimate those of later ones.
+	CREATE TABLE IF NOT EXISTS ingests (
+		ingest_id TEXT PRIMARY KEY,
+		input TEXT NOT NULL,
+		archive TEXT,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP,
+		records INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		archive_bytes INTEGER,
+		db_growth INTEGER,
+		elapsed_seconds REAL
+	);
+
+	-- Access level and consent hints of records; records without a row are
+	-- open access
+	CREATE TABLE IF NOT EXISTS record_access (
+		accession TEXT PRIMARY KEY,
+		record_type TEXT NOT NULL,
+		access TEXT NOT NULL,
+		consent TEXT
+	);
+
+	-- Data files of runs from their DATA_BLOCK, so that a file on disk can be
+	-- traced back to its run by name or MD5 checksum (lower case hex)
+	CREATE TABLE IF NOT EXISTS run_files (
+		run_accession TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		filetype TEXT,
+		md5 TEXT,
+		PRIMARY KEY (run_accession, filename)
+	);
+	CREATE INDEX IF NOT EXISTS idx_run_files_filename ON run_files(filename);
+	CREATE INDEX IF NOT EXISTS idx_run_files_md5 ON run_files(md5);
+
+	-- NCBI metadata files ingested, so incremental ingest can apply only
+	-- newer daily updates
+	CREATE TABLE IF NOT EXISTS applied_updates (
+		file_name TEXT PRIMARY KEY,
+		file_type TEXT NOT NULL,
+		file_date DATE NOT NULL,
+		records INTEGER DEFAULT 0,
+		suppressed INTEGER DEFAULT 0,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Polls of Entrez for records modified since the last, so that the
+	-- next poll starts where the last left off
+	CREATE TABLE IF NOT EXISTS entrez_syncs (
+		synced_until DATE PRIMARY KEY,
+		records INTEGER DEFAULT 0,
+		suppressed INTEGER DEFAULT 0,
+		synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Frozen search results for tracking cohorts across database updates
+	CREATE TABLE IF NOT EXISTS cohorts (
+		name TEXT PRIMARY KEY,
+		query TEXT NOT NULL,
+		filters JSON,
+		db_records INTEGER DEFAULT 0,
+		db_updated_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS cohort_members (
+		cohort_name TEXT NOT NULL,
+		accession TEXT NOT NULL,
+		record_type TEXT,
+		fingerprint TEXT,
+		PRIMARY KEY (cohort_name, accession)
+	);
+
+	-- Latest change to each record, filled by triggers so that every write
+	-- path is logged; generation orders the changes and is never reused
+	CREATE TABLE IF NOT EXISTS changes (
+		generation INTEGER PRIMARY KEY AUTOINCREMENT,
+		accession TEXT NOT NULL UNIQUE,
+		record_type TEXT NOT NULL,
+		op TEXT NOT NULL,
+		changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Records violating quality rules, flagged by 'srake qc run --flag'.
+	-- run is the run that last found the violation; flagged_at is when it
+	-- was first found.
+	CREATE TABLE IF NOT EXISTS qc_flags (
+		accession TEXT NOT NULL,
+		record_type TEXT NOT NULL,
+		rule TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		message TEXT,
+		run INTEGER NOT NULL,
+		flagged_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (accession, rule)
+	);
+	CREATE INDEX IF NOT EXISTS idx_qc_flags_rule ON qc_flags(rule, run);
+
+	-- API keys accepted by srake server, stored as SHA-256 hashes
+	CREATE TABLE IF NOT EXISTS api_keys (
+		name TEXT PRIMARY KEY,
+		key_hash TEXT NOT NULL UNIQUE,
+		requests_per_second REAL DEFAULT 0,
+		burst INTEGER DEFAULT 0,
+		read_only BOOLEAN DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Searches saved by 'srake search --save', with the database generation
+	-- of their last watch run; filters are 'srake search' flags
+	CREATE TABLE IF NOT EXISTS saved_searches (
+		name TEXT PRIMARY KEY,
+		query TEXT NOT NULL,
+		filters JSON,
+		db_records INTEGER DEFAULT 0,
+		db_updated_at TIMESTAMP,
+		last_run_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Records each saved search has matched, so that a watch run can report
+	-- those it has not seen before
+	CREATE TABLE IF NOT EXISTS saved_search_hits (
+		search_name TEXT NOT NULL,
+		accession TEXT NOT NULL,
+		record_type TEXT,
+		first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (search_name, accession)
+	);
+
+	-- Last change generation applied by each consumer of the change log,
+	-- such as a search index
+	CREATE TABLE IF NOT EXISTS change_cursors (
+		consumer TEXT PRIMARY KEY,
+		generation INTEGER NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Backfills of databases created by older releases that have run, so
+	-- that they are not looked for again on every open
+	CREATE TABLE IF NOT EXISTS backfills (
+		name TEXT PRIMARY KEY,
+		ran_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Records linked to BioSample and BioProject accessions, kept by
+	-- triggers on identifiers and sample_attributes; source is
+	-- identifier or attribute
+	CREATE TABLE IF NOT EXISTS biosamples (
+		biosample_accession TEXT NOT NULL,
+		sample_accession TEXT NOT NULL,
+		source TEXT NOT NULL,
+		PRIMARY KEY (biosample_accession, sample_accession, source)
+	);
+	CREATE INDEX IF NOT EXISTS idx_biosamples_sample ON biosamples(sample_accession);
+	CREATE TABLE IF NOT EXISTS bioprojects (
+		bioproject_accession TEXT NOT NULL,
+		record_type TEXT NOT NULL,
+		record_accession TEXT NOT NULL,
+		source TEXT NOT NULL,
+		PRIMARY KEY (bioproject_accession, record_type, record_accession, source)
+	);
+	CREATE INDEX IF NOT EXISTS idx_bioprojects_record ON bioprojects(record_type, record_accession);
+
+	-- Internal IDs, such as LIMS or sample sheet IDs, mapped to accessions
+	-- by 'srake idmap import'; source names the file they came from
+	CREATE TABLE IF NOT EXISTS id_mappings (
+		internal_id TEXT NOT NULL COLLATE NOCASE,
+		accession TEXT NOT NULL,
+		record_type TEXT NOT NULL,
+		source TEXT NOT NULL,
+		imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (internal_id, accession)
+	);
+	CREATE INDEX IF NOT EXISTS idx_id_mappings_accession ON id_mappings(accession);
+
+	-- Accessions and aliases of submissions not yet public, imported by
+	-- 'srake expect import'; accession, record_type and appeared_at are
+	-- set once an ingest brings in the record they name
+	CREATE TABLE IF NOT EXISTS expectations (
+		source TEXT NOT NULL,
+		expected TEXT NOT NULL,
+		label TEXT,
+		imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		accession TEXT,
+		record_type TEXT,
+		appeared_at TIMESTAMP,
+		PRIMARY KEY (source, expected)
+	);
+	CREATE INDEX IF NOT EXISTS idx_expectations_appeared ON expectations(appeared_at);
+
+	-- Study embeddings of each model, with a hash of the text they were
+	-- made from, so that only new and changed studies are embedded again
+	CREATE TABLE IF NOT EXISTS embeddings (
+		model TEXT NOT NULL,
+		accession TEXT NOT NULL,
+		text_hash TEXT NOT NULL,
+		dims INTEGER NOT NULL,
+		vector BLOB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (model, accession)
+	);
+
+	-- Files old runs have been moved to, read back with IncludeArchived
+	CREATE TABLE IF NOT EXISTS run_archives (
+		path TEXT PRIMARY KEY,
+		format TEXT NOT NULL,
+		runs INTEGER NOT NULL DEFAULT 0,
+		published_before TEXT NOT NULL,
+		archived_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 
 	_, err := db.Exec(schema)
@@ -237,6 +710,15 @@ func createTables(db *sql.DB) error {
 
 // InsertStudy inserts or replaces a study record in the database.
 func (db *DB) InsertStudy(study *Study) error {
+	if staged, err := db.stage("studies",
+		study.StudyAccession, study.StudyTitle, study.StudyAbstract, study.StudyType,
+		study.Organism, study.SubmissionDate, study.Metadata); staged {
+		if err == nil {
+			db.observeStudy(study)
+		}
+		return err
+	}
+
 	query := `
 		INSERT OR REPLACE INTO studies (
 			study_accession, study_title, study_abstract, study_type,
@@ -246,6 +728,9 @@ func (db *DB) InsertStudy(study *Study) error {
 	_, err := db.Exec(query,
 		study.StudyAccession, study.StudyTitle, study.StudyAbstract, study.StudyType,
 		study.Organism, study.SubmissionDate, study.Metadata)
+	if err == nil {
+		db.observeStudy(study)
+	}
 	return err
 }
 
@@ -271,6 +756,16 @@ func (db *DB) GetStudy(accession string) (*Study, error) {
 
 // InsertExperiment inserts or replaces an experiment record in the database.
 func (db *DB) InsertExperiment(exp *Experiment) error {
+	if staged, err := db.stage("experiments",
+		exp.ExperimentAccession, exp.StudyAccession, exp.Title,
+		exp.LibraryStrategy, exp.LibrarySource, exp.Platform,
+		exp.InstrumentModel, exp.Metadata); staged {
+		if err == nil {
+			db.observeExperiment(exp)
+		}
+		return err
+	}
+
 	query := `
 		INSERT OR REPLACE INTO experiments (
 			experiment_accession, study_accession, title,
@@ -282,6 +777,9 @@ func (db *DB) InsertExperiment(exp *Experiment) error {
 		exp.ExperimentAccession, exp.StudyAccession, exp.Title,
 		exp.LibraryStrategy, exp.LibrarySource, exp.Platform,
 		exp.InstrumentModel, exp.Metadata)
+	if err == nil {
+		db.observeExperiment(exp)
+	}
 	return err
 }
 
@@ -307,8 +805,15 @@ func (db *DB) GetExperiment(accession string) (*Experiment, error) {
 	return exp, err
 }
 
-// InsertSample inserts or replaces a sample record in the database.
+// InsertSample inserts or replaces a sample record in the database, along
+// with its rows in sample_attributes.
 func (db *DB) InsertSample(sample *Sample) error {
+	tx, err := db.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		INSERT OR REPLACE INTO samples (
 			sample_accession, experiment_accession, organism,
@@ -316,11 +821,26 @@ func (db *DB) InsertSample(sample *Sample) error {
 			description, metadata
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := db.Exec(query,
+	values := []interface{}{
 		sample.SampleAccession, "", sample.Organism,
 		sample.ScientificName, sample.TaxonID, sample.Tissue,
-		sample.CellType, sample.Description, sample.Metadata)
-	return err
+		sample.CellType, sample.Description, sample.Metadata,
+	}
+	staged, err := db.stage("samples", values...)
+	if !staged {
+		_, err = tx.Exec(query, values...)
+	}
+	if err != nil {
+		return err
+	}
+	if err := replaceSampleAttributes(tx, sample.SampleAccession, sampleAttributes(sample)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.observeSample(sample)
+	return nil
 }
 
 // GetSample retrieves a sample by its accession identifier.
@@ -348,6 +868,15 @@ func (db *DB) GetSample(accession string) (*Sample, error) {
 
 // InsertRun inserts or replaces a run record in the database.
 func (db *DB) InsertRun(run *Run) error {
+	if staged, err := db.stage("runs",
+		run.RunAccession, run.ExperimentAccession, run.TotalSpots,
+		run.TotalBases, run.Published, run.Metadata); staged {
+		if err == nil {
+			db.observeRun(run)
+		}
+		return err
+	}
+
 	query := `
 		INSERT OR REPLACE INTO runs (
 			run_accession, experiment_accession, total_spots, total_bases,
@@ -357,6 +886,9 @@ func (db *DB) InsertRun(run *Run) error {
 	_, err := db.Exec(query,
 		run.RunAccession, run.ExperimentAccession, run.TotalSpots,
 		run.TotalBases, run.Published, run.Metadata)
+	if err == nil {
+		db.observeRun(run)
+	}
 	return err
 }
 
@@ -479,6 +1011,7 @@ func (db *DB) SearchByOrganism(organism string, limit int) ([]Sample, error) {
 			   description, COALESCE(metadata, '{}')
 		FROM samples
 		WHERE organism LIKE ? OR scientific_name LIKE ?
+		ORDER BY sample_accession
 		LIMIT ?
 	`
 
@@ -513,6 +1046,7 @@ func (db *DB) SearchByLibraryStrategy(strategy string, limit int) ([]Experiment,
 			   instrument_model, COALESCE(metadata, '{}')
 		FROM experiments
 		WHERE library_strategy LIKE ?
+		ORDER BY experiment_accession
 		LIMIT ?
 	`
 
@@ -559,6 +1093,7 @@ func (db *DB) FullTextSearch(query string) (interface{}, error) {
 		SELECT 'study', study_accession, study_title, organism
 		FROM studies
 		WHERE study_title LIKE ? OR study_abstract LIKE ? OR organism LIKE ?
+		ORDER BY study_accession
 		LIMIT 10
 	`
 	rows, err := db.Query(studyQuery, searchTerm, searchTerm, searchTerm)
@@ -586,6 +1121,7 @@ func (db *DB) FullTextSearch(query string) (interface{}, error) {
 		SELECT 'experiment', experiment_accession, title, platform, library_strategy
 		FROM experiments
 		WHERE title LIKE ? OR library_strategy LIKE ? OR platform LIKE ?
+		ORDER BY experiment_accession
 		LIMIT 10
 	`
 	rows2, err := db.Query(expQuery, searchTerm, searchTerm, searchTerm)
@@ -618,6 +1154,22 @@ type DatabaseStats struct {
 	TotalSamples     int       `json:"total_samples"`
 	TotalRuns        int       `json:"total_runs"`
 	LastUpdate       time.Time `json:"last_update"`
+	Approximate      bool      `json:"approximate,omitempty"` // estimated from sketches
+}
+
+// ProbeLatency times the lookup of a random study, the kind of read the
+// API server answers, to measure how much concurrent writes slow queries.
+func (db *DB) ProbeLatency(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	var accession string
+	err := db.QueryRowContext(ctx, `
+		SELECT study_accession FROM studies
+		WHERE rowid >= abs(random()) % (SELECT IFNULL(MAX(rowid), 0) + 1 FROM studies)
+		LIMIT 1`).Scan(&accession)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	return time.Since(start), nil
 }
 
 // GetStats returns live row counts for all core SRA tables.
@@ -645,7 +1197,16 @@ func (db *DB) GetStats() (*DatabaseStats, error) {
 
 // BatchInsertExperiments inserts multiple experiments in a single transaction for performance.
 func (db *DB) BatchInsertExperiments(experiments []Experiment) error {
-	tx, err := db.Begin()
+	if db.bulk.Load() != nil {
+		for i := range experiments {
+			if err := db.InsertExperiment(&experiments[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tx, err := db.beginWrite()
 	if err != nil {
 		return err
 	}
@@ -673,6 +1234,45 @@ func (db *DB) BatchInsertExperiments(experiments []Experiment) error {
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for i := range experiments {
+		db.observeExperiment(&experiments[i])
+	}
+	return nil
+}
+
+// ExperimentSample links an experiment to a sample it sequenced.
+type ExperimentSample struct {
+	ExperimentAccession string
+	SampleAccession     string
+}
+
+// InsertExperimentSamples records which samples experiments sequenced in a
+// single transaction, ignoring links that already exist.
+func (db *DB) InsertExperimentSamples(links []ExperimentSample) error {
+	tx, err := db.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO experiment_samples (experiment_accession, sample_accession)
+		VALUES (?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, l := range links {
+		if _, err := stmt.Exec(l.ExperimentAccession, l.SampleAccession); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
@@ -870,13 +1470,21 @@ func (db *DB) GetLinks(recordType, recordAccession string) ([]Link, error) {
 
 // Additional helper methods for service layer
 
-// Query executes a query that returns rows
+// Query executes a query that returns rows, in the transaction of a view
+// of WithTx
 func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.Query(query, args...)
+	}
 	return db.DB.Query(query, args...)
 }
 
-// QueryRow executes a query that returns at most one row
+// QueryRow executes a query that returns at most one row, in the
+// transaction of a view of WithTx
 func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRow(query, args...)
+	}
 	return db.DB.QueryRow(query, args...)
 }
 
@@ -1024,6 +1632,7 @@ func (db *DB) GetStudiesBatch(offset, limit int) ([]*Study, error) {
 	query := `
 		SELECT study_accession, study_title, study_abstract, study_type, organism
 		FROM studies
+		ORDER BY study_accession
 		LIMIT ? OFFSET ?
 	`
 	rows, err := db.Query(query, limit, offset)
@@ -1,9 +1,20 @@
 package database
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Helper to create a temporary test database
@@ -52,6 +63,81 @@ func TestInitializeInvalidPath(t *testing.T) {
 	}
 }
 
+func TestOpenReplica(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "srake.db")
+
+	if _, err := Open(path, OpenOptions{Mode: ModeReplica}); err == nil {
+		t.Error("expected an error for a replica that has not been copied yet")
+	}
+
+	primary, err := Open(path, OpenOptions{Replication: ReplicationLitestream})
+	if err != nil {
+		t.Fatalf("failed to open primary: %v", err)
+	}
+	if err := primary.InsertStudy(&Study{StudyAccession: "SRP000001", StudyTitle: "Liver"}); err != nil {
+		t.Fatalf("InsertStudy failed: %v", err)
+	}
+	var autocheckpoint int
+	if err := primary.QueryRow("PRAGMA wal_autocheckpoint").Scan(&autocheckpoint); err != nil || autocheckpoint != 0 {
+		t.Errorf("expected checkpoints left to Litestream, got wal_autocheckpoint %d (%v)", autocheckpoint, err)
+	}
+	defer primary.Close()
+
+	replica, err := Open(path, OpenOptions{Mode: ModeReplica, Replication: ReplicationLitestream})
+	if err != nil {
+		t.Fatalf("failed to open replica: %v", err)
+	}
+	defer replica.Close()
+	if !replica.ReadOnly() || primary.ReadOnly() {
+		t.Error("expected only the replica to be read-only")
+	}
+	if study, err := replica.GetStudy("SRP000001"); err != nil || study.StudyTitle != "Liver" {
+		t.Fatalf("expected the replica to read the primary's study, got %v, %v", study, err)
+	}
+	if err := replica.InsertStudy(&Study{StudyAccession: "SRP000002"}); err == nil {
+		t.Error("expected a replica to refuse writes")
+	}
+
+	status, err := replica.ReplicationStatus()
+	if err != nil {
+		t.Fatalf("ReplicationStatus failed: %v", err)
+	}
+	if status.Mode != ModeReplica || status.Replication != ReplicationLitestream || time.Since(status.LastChange) > time.Minute {
+		t.Errorf("unexpected replication status %+v", status)
+	}
+
+	if _, err := Open(path, OpenOptions{Mode: "standby"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestOpenLiteFS(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "srake.db")
+
+	// LiteFS writes the primary's hostname into its mount on replicas
+	if err := os.WriteFile(filepath.Join(dir, ".primary"), []byte("api-1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Open(path, OpenOptions{Replication: ReplicationLiteFS})
+	if err == nil || !strings.Contains(err.Error(), "api-1") {
+		t.Errorf("expected a primary open to name the LiteFS primary, got %v", err)
+	}
+
+	// Once this node is promoted
+	os.Remove(filepath.Join(dir, ".primary"))
+	db, err := Open(path, OpenOptions{Replication: ReplicationLiteFS})
+	if err != nil {
+		t.Fatalf("failed to open primary: %v", err)
+	}
+	defer db.Close()
+	status, err := db.ReplicationStatus()
+	if err != nil || status.Mode != ModePrimary || status.Primary != "" {
+		t.Errorf("unexpected replication status %+v (%v)", status, err)
+	}
+}
+
 func TestStudyOperations(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -93,6 +179,24 @@ func TestStudyOperations(t *testing.T) {
 	}
 }
 
+func TestProbeLatency(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// An empty database is probed without error
+	if _, err := db.ProbeLatency(context.Background()); err != nil {
+		t.Fatalf("ProbeLatency on an empty database failed: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := db.InsertStudy(&Study{StudyAccession: fmt.Sprintf("SRP%06d", i)}); err != nil {
+			t.Fatalf("InsertStudy failed: %v", err)
+		}
+	}
+	if latency, err := db.ProbeLatency(context.Background()); err != nil || latency <= 0 {
+		t.Errorf("ProbeLatency = %v, %v", latency, err)
+	}
+}
+
 func TestExperimentOperations(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -584,3 +688,2998 @@ func TestGetStudiesBatch(t *testing.T) {
 		t.Errorf("got %d studies, want 5", len(batch))
 	}
 }
+
+func TestStudiesBatchByteOrder(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Stored out of order; text sorts by UTF-8 bytes, not by locale rules
+	for _, acc := range []string{"srp2", "SRPé", "SRP1", "SRPz", "SRPZ"} {
+		if err := db.InsertStudy(&Study{StudyAccession: acc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch, err := db.GetStudiesBatch(0, 10)
+	if err != nil {
+		t.Fatalf("GetStudiesBatch failed: %v", err)
+	}
+	var got []string
+	for _, s := range batch {
+		got = append(got, s.StudyAccession)
+	}
+	if want := "SRP1 SRPZ SRPz SRPé srp2"; strings.Join(got, " ") != want {
+		t.Errorf("expected %s, got %s", want, strings.Join(got, " "))
+	}
+}
+
+func TestCurationOperations(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Missing curation is not an error
+	c, err := db.GetCuration("SRP000001")
+	if err != nil {
+		t.Fatalf("GetCuration failed: %v", err)
+	}
+	if c != nil {
+		t.Fatalf("expected nil curation, got %+v", c)
+	}
+
+	curation := &Curation{
+		Accession:    "SRP000001",
+		RecordType:   "study",
+		CuratedTitle: "Curated Title",
+		Tags:         []string{"cohort-a", "reviewed"},
+		Notes:        "checked by curator",
+	}
+	if err := db.UpsertCuration(curation); err != nil {
+		t.Fatalf("UpsertCuration failed: %v", err)
+	}
+
+	// Re-ingesting the upstream record must not drop the curation
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001", StudyTitle: "Upstream"}); err != nil {
+		t.Fatalf("InsertStudy failed: %v", err)
+	}
+
+	c, err = db.GetCuration("SRP000001")
+	if err != nil {
+		t.Fatalf("GetCuration failed: %v", err)
+	}
+	if c == nil || c.CuratedTitle != "Curated Title" || len(c.Tags) != 2 || c.Notes != "checked by curator" {
+		t.Errorf("unexpected curation: %+v", c)
+	}
+
+	all, err := db.GetCurations([]string{"SRP000001", "SRP000002"})
+	if err != nil {
+		t.Fatalf("GetCurations failed: %v", err)
+	}
+	if len(all) != 1 || all["SRP000001"] == nil {
+		t.Errorf("expected one curation, got %v", all)
+	}
+
+	if err := db.DeleteCuration("SRP000001"); err != nil {
+		t.Fatalf("DeleteCuration failed: %v", err)
+	}
+	if c, _ := db.GetCuration("SRP000001"); c != nil {
+		t.Errorf("expected curation to be deleted, got %+v", c)
+	}
+}
+
+func TestCollectionOperations(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.CreateCollection("my-cohort", "Liver samples"); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	added, err := db.AddToCollection("my-cohort", []CollectionMember{
+		{Accession: "SRR000001", RecordType: "run"},
+		{Accession: "SRR000002", RecordType: "run"},
+	})
+	if err != nil {
+		t.Fatalf("AddToCollection failed: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("expected 2 added, got %d", added)
+	}
+
+	// Re-adding an existing member is a no-op
+	added, err = db.AddToCollection("my-cohort", []CollectionMember{{Accession: "SRR000001", RecordType: "run"}})
+	if err != nil {
+		t.Fatalf("AddToCollection failed: %v", err)
+	}
+	if added != 0 {
+		t.Errorf("expected 0 added, got %d", added)
+	}
+
+	// Adding to an unknown collection creates it
+	if _, err := db.AddToCollection("other", []CollectionMember{{Accession: "SRP000001", RecordType: "study"}}); err != nil {
+		t.Fatalf("AddToCollection failed: %v", err)
+	}
+
+	collections, err := db.ListCollections()
+	if err != nil {
+		t.Fatalf("ListCollections failed: %v", err)
+	}
+	if len(collections) != 2 || collections[0].Name != "my-cohort" || collections[0].MemberCount != 2 {
+		t.Errorf("unexpected collections: %+v", collections)
+	}
+
+	c, err := db.GetCollection("my-cohort")
+	if err != nil {
+		t.Fatalf("GetCollection failed: %v", err)
+	}
+	if c.Description != "Liver samples" {
+		t.Errorf("expected description to be kept, got %q", c.Description)
+	}
+
+	removed, err := db.RemoveFromCollection("my-cohort", []string{"SRR000002", "SRR999999"})
+	if err != nil {
+		t.Fatalf("RemoveFromCollection failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 removed, got %d", removed)
+	}
+
+	accessions, err := db.GetCollectionAccessions("my-cohort")
+	if err != nil {
+		t.Fatalf("GetCollectionAccessions failed: %v", err)
+	}
+	if len(accessions) != 1 || accessions[0] != "SRR000001" {
+		t.Errorf("unexpected members: %v", accessions)
+	}
+
+	if err := db.DeleteCollection("my-cohort"); err != nil {
+		t.Fatalf("DeleteCollection failed: %v", err)
+	}
+	if _, err := db.GetCollection("my-cohort"); err == nil {
+		t.Error("expected error for deleted collection")
+	}
+	if members, _ := db.GetCollectionMembers("my-cohort"); len(members) != 0 {
+		t.Errorf("expected memberships to be deleted, got %v", members)
+	}
+	if err := db.DeleteCollection("my-cohort"); err == nil {
+		t.Error("expected error deleting missing collection")
+	}
+}
+
+func TestFeedbackOperations(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	err := db.InsertFeedback([]Feedback{
+		{Query: "Liver  Cancer", Accession: "SRP000001", Relevant: true, Source: "cli"},
+		{Query: "liver cancer", Accession: "SRP000002", Relevant: false, Source: "cli"},
+		{Query: "mouse brain", Accession: "SRP000003", Relevant: true},
+	})
+	if err != nil {
+		t.Fatalf("InsertFeedback failed: %v", err)
+	}
+
+	feedback, err := db.GetFeedback("LIVER cancer", 0)
+	if err != nil {
+		t.Fatalf("GetFeedback failed: %v", err)
+	}
+	if len(feedback) != 2 {
+		t.Fatalf("expected 2 judgments, got %d", len(feedback))
+	}
+	for _, f := range feedback {
+		if f.Query != "liver cancer" {
+			t.Errorf("expected normalized query, got %q", f.Query)
+		}
+		if f.Accession == "SRP000001" && !f.Relevant {
+			t.Error("expected SRP000001 to be relevant")
+		}
+		if f.Accession == "SRP000002" && f.Relevant {
+			t.Error("expected SRP000002 to be irrelevant")
+		}
+	}
+
+	all, err := db.GetFeedback("", 2)
+	if err != nil {
+		t.Fatalf("GetFeedback failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected limit to be applied, got %d", len(all))
+	}
+
+	if err := db.InsertFeedback([]Feedback{{Query: "  ", Accession: "SRP000001"}}); err == nil {
+		t.Error("expected error for empty query")
+	}
+}
+
+func TestHarvestRecords(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	submitted := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, acc := range []string{"SRP000001", "SRP000002", "SRP000003"} {
+		if err := db.InsertStudy(&Study{StudyAccession: acc, SubmissionDate: &submitted}); err != nil {
+			t.Fatalf("InsertStudy failed: %v", err)
+		}
+	}
+	curated := &Curation{
+		Accession:  "SRP000002",
+		RecordType: "study",
+		Notes:      "reviewed",
+		UpdatedAt:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := db.UpsertCuration(curated); err != nil {
+		t.Fatalf("UpsertCuration failed: %v", err)
+	}
+	if _, err := db.AddToCollection("liver", []CollectionMember{{Accession: "SRP000003", RecordType: "study"}}); err != nil {
+		t.Fatalf("AddToCollection failed: %v", err)
+	}
+
+	records, err := db.ListHarvestRecords(HarvestQuery{})
+	if err != nil {
+		t.Fatalf("ListHarvestRecords failed: %v", err)
+	}
+	if len(records) != 3 || records[0].Datestamp != "2020-05-01" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if !records[1].Curated || records[1].Datestamp != "2024-03-01" {
+		t.Errorf("expected curation datestamp, got %+v", records[1])
+	}
+	if len(records[2].Collections) != 1 || records[2].Collections[0] != "liver" {
+		t.Errorf("expected collection membership, got %+v", records[2])
+	}
+
+	tests := []struct {
+		name  string
+		query HarvestQuery
+		want  int
+	}{
+		{"from", HarvestQuery{From: "2024-01-01"}, 1},
+		{"until", HarvestQuery{Until: "2020-05-01"}, 2},
+		{"curated", HarvestQuery{CuratedOnly: true}, 1},
+		{"collection", HarvestQuery{Collection: "liver"}, 1},
+		{"page", HarvestQuery{Offset: 1, Limit: 1}, 1},
+	}
+	for _, tt := range tests {
+		records, err := db.ListHarvestRecords(tt.query)
+		if err != nil {
+			t.Fatalf("%s: ListHarvestRecords failed: %v", tt.name, err)
+		}
+		if len(records) != tt.want {
+			t.Errorf("%s: expected %d records, got %d", tt.name, tt.want, len(records))
+		}
+	}
+
+	count, err := db.CountHarvestRecords(HarvestQuery{From: "2020-01-01"})
+	if err != nil || count != 3 {
+		t.Errorf("expected count 3, got %d (%v)", count, err)
+	}
+
+	earliest, err := db.EarliestHarvestDatestamp()
+	if err != nil || earliest != "2020-05-01" {
+		t.Errorf("unexpected earliest datestamp %q (%v)", earliest, err)
+	}
+
+	if _, err := db.GetHarvestRecord("SRP999999"); err == nil {
+		t.Error("expected error for missing study")
+	}
+}
+
+func TestStreamFilterMatches(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	early := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	studies := []*Study{
+		{StudyAccession: "SRP000001", StudyType: "Transcriptome Analysis", SubmissionDate: &early, Metadata: `{"center_name":"BGI"}`},
+		{StudyAccession: "SRP000002", StudyType: "Whole Genome Sequencing", SubmissionDate: &late, Metadata: `{"center_name":"Broad"}`},
+	}
+	for _, s := range studies {
+		if err := db.InsertStudy(s); err != nil {
+			t.Fatalf("InsertStudy failed: %v", err)
+		}
+	}
+	experiments := []*Experiment{
+		{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001", LibraryStrategy: "RNA-Seq", Platform: "ILLUMINA"},
+		{ExperimentAccession: "SRX000002", StudyAccession: "SRP000002", LibraryStrategy: "WGS", Platform: "OXFORD_NANOPORE"},
+	}
+	for _, e := range experiments {
+		if err := db.InsertExperiment(e); err != nil {
+			t.Fatalf("InsertExperiment failed: %v", err)
+		}
+	}
+	samples := []*Sample{
+		{SampleAccession: "SRS000001", ScientificName: "Homo sapiens", TaxonID: 9606},
+		{SampleAccession: "SRS000002", ScientificName: "Mus musculus", TaxonID: 10090},
+	}
+	for i, s := range samples {
+		if err := db.InsertSample(s); err != nil {
+			t.Fatalf("InsertSample failed: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO experiment_samples (experiment_accession, sample_accession) VALUES (?, ?)`,
+			experiments[i].ExperimentAccession, s.SampleAccession); err != nil {
+			t.Fatalf("failed to link sample: %v", err)
+		}
+	}
+	runs := []*Run{
+		{RunAccession: "SRR000001", ExperimentAccession: "SRX000001", TotalSpots: 5000000},
+		{RunAccession: "SRR000002", ExperimentAccession: "SRX000001", TotalSpots: 100},
+		{RunAccession: "SRR000003", ExperimentAccession: "SRX000002"},
+	}
+	for _, r := range runs {
+		if err := db.InsertRun(r); err != nil {
+			t.Fatalf("InsertRun failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter RecordFilter
+		want   []string // matching runs
+	}{
+		{"no filters", RecordFilter{}, []string{"SRR000001", "SRR000002", "SRR000003"}},
+		{"taxon", RecordFilter{TaxonIDs: []int{9606}}, []string{"SRR000001", "SRR000002"}},
+		{"exclude taxon", RecordFilter{ExcludeTaxonIDs: []int{9606}}, []string{"SRR000003"}},
+		{"organism", RecordFilter{Organisms: []string{"Mus musculus"}}, []string{"SRR000003"}},
+		{"strategy and platform", RecordFilter{Strategies: []string{"RNA-Seq"}, Platforms: []string{"ILLUMINA"}}, []string{"SRR000001", "SRR000002"}},
+		{"study type", RecordFilter{StudyTypes: []string{"Whole Genome Sequencing"}}, []string{"SRR000003"}},
+		{"center", RecordFilter{Centers: []string{"BGI"}}, []string{"SRR000001", "SRR000002"}},
+		{"date", RecordFilter{DateFrom: "2020-01-01"}, []string{"SRR000003"}},
+		{"min reads keeps runs without statistics", RecordFilter{MinReads: 1000}, []string{"SRR000001", "SRR000003"}},
+		{"no match", RecordFilter{Platforms: []string{"PACBIO_SMRT"}}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := db.StreamFilterMatches(tt.filter, func(m *FilterMatch) error {
+			got = append(got, m.RunAccession)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: StreamFilterMatches failed: %v", tt.name, err)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected runs %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if err := db.StreamFilterMatches(RecordFilter{DateFrom: "2020-01-01", DateColumn: "last_updated"}, func(*FilterMatch) error { return nil }); err == nil {
+		t.Error("expected error for unsupported date field")
+	}
+}
+
+func TestRelatedStudies(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, acc := range []string{"SRP000001", "SRP000002", "SRP000003", "SRP000004"} {
+		if err := db.InsertStudy(&Study{StudyAccession: acc, StudyTitle: "Study " + acc}); err != nil {
+			t.Fatalf("InsertStudy failed: %v", err)
+		}
+	}
+	for _, acc := range []string{"SRP000001", "SRP000002"} {
+		if err := db.InsertIdentifier(&Identifier{RecordType: "study", RecordAccession: acc,
+			IDType: "external", IDNamespace: "BioProject", IDValue: "PRJNA100"}); err != nil {
+			t.Fatalf("InsertIdentifier failed: %v", err)
+		}
+	}
+	for _, acc := range []string{"SRP000001", "SRP000002", "SRP000003"} {
+		if err := db.InsertLink(&Link{RecordType: "study", RecordAccession: acc, LinkType: "xref", DB: "pubmed", ID: "12345"}); err != nil {
+			t.Fatalf("InsertLink failed: %v", err)
+		}
+	}
+	for i, acc := range []string{"SRP000001", "SRP000004"} {
+		exp := fmt.Sprintf("SRX00000%d", i+1)
+		sample := fmt.Sprintf("SRS00000%d", i+1)
+		if err := db.InsertExperiment(&Experiment{ExperimentAccession: exp, StudyAccession: acc}); err != nil {
+			t.Fatalf("InsertExperiment failed: %v", err)
+		}
+		if err := db.InsertSample(&Sample{SampleAccession: sample,
+			Metadata: `{"attributes":[{"tag":"cell line","value":"HepG2"}]}`}); err != nil {
+			t.Fatalf("InsertSample failed: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO experiment_samples (experiment_accession, sample_accession) VALUES (?, ?)`, exp, sample); err != nil {
+			t.Fatalf("failed to link sample: %v", err)
+		}
+	}
+
+	related, err := db.RelatedStudies("SRP000001", 0)
+	if err != nil {
+		t.Fatalf("RelatedStudies failed: %v", err)
+	}
+	if len(related) != 3 {
+		t.Fatalf("expected 3 related studies, got %+v", related)
+	}
+	first := related[0]
+	if first.Accession != "SRP000002" || first.Score != 6 || first.Title != "Study SRP000002" {
+		t.Errorf("unexpected top study: %+v", first)
+	}
+	if strings.Join(first.Reasons, "; ") != "shares BioProject PRJNA100; co-cited in PubMed 12345" {
+		t.Errorf("unexpected reasons: %v", first.Reasons)
+	}
+	if related[1].Accession != "SRP000003" || related[2].Accession != "SRP000004" {
+		t.Errorf("unexpected ranking: %s, %s", related[1].Accession, related[2].Accession)
+	}
+	if related[2].Reasons[0] != "same cell line HepG2" {
+		t.Errorf("unexpected cell line reason: %v", related[2].Reasons)
+	}
+
+	// Cell lines are matched through the attribute indexes, without
+	// scanning the attributes of every sample
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+relatedCellLines, "SRP000001", "SRP000001", 10)
+	if err != nil {
+		t.Fatalf("failed to plan cell line query: %v", err)
+	}
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(detail, "SCAN a") || strings.Contains(detail, "idx_sample_attributes_num") {
+			t.Errorf("cell line query reads attributes with %q", detail)
+		}
+	}
+	rows.Close()
+
+	if limited, _ := db.RelatedStudies("SRP000001", 1); len(limited) != 1 {
+		t.Errorf("expected limit to apply, got %d", len(limited))
+	}
+	if _, err := db.RelatedStudies("SRP999999", 0); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	base := time.Now().UTC().Add(-time.Hour)
+	for i, id := range []string{"job-a", "job-b", "job-c"} {
+		job := &Job{ID: id, Kind: "export", Spec: `{"query":"liver"}`, CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+		if err := db.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob failed: %v", err)
+		}
+	}
+
+	claimed, err := db.ClaimJob()
+	if err != nil {
+		t.Fatalf("ClaimJob failed: %v", err)
+	}
+	if claimed == nil || claimed.ID != "job-a" || claimed.Status != JobRunning {
+		t.Fatalf("expected oldest job to be claimed, got %+v", claimed)
+	}
+
+	if err := db.FinishJob("job-a", JobCompleted, "", "/tmp/job-a.json", 42); err != nil {
+		t.Fatalf("FinishJob failed: %v", err)
+	}
+	job, err := db.GetJob("job-a")
+	if err != nil {
+		t.Fatalf("GetJob failed: %v", err)
+	}
+	if job.Status != JobCompleted || job.ResultPath != "/tmp/job-a.json" || job.ResultSize != 42 {
+		t.Errorf("unexpected finished job: %+v", job)
+	}
+	if job.StartedAt == nil || job.FinishedAt == nil {
+		t.Error("expected start and finish times to be recorded")
+	}
+
+	if _, err := db.CancelJob("job-a"); err == nil {
+		t.Error("expected error cancelling a completed job")
+	}
+	if _, err := db.CancelJob("job-b"); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+
+	// Simulate a worker dying mid-job
+	if claimed, err = db.ClaimJob(); err != nil || claimed == nil || claimed.ID != "job-c" {
+		t.Fatalf("expected job-c to be claimed, got %+v (%v)", claimed, err)
+	}
+	n, err := db.RequeueRunningJobs()
+	if err != nil {
+		t.Fatalf("RequeueRunningJobs failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 requeued job, got %d", n)
+	}
+
+	queued, err := db.ListJobs(JobQueued, 0)
+	if err != nil {
+		t.Fatalf("ListJobs failed: %v", err)
+	}
+	if len(queued) != 1 || queued[0].ID != "job-c" {
+		t.Errorf("expected job-c to be queued again, got %+v", queued)
+	}
+
+	all, err := db.ListJobs("", 0)
+	if err != nil {
+		t.Fatalf("ListJobs failed: %v", err)
+	}
+	if len(all) != 3 || all[0].ID != "job-c" {
+		t.Errorf("expected 3 jobs newest first, got %+v", all)
+	}
+
+	if _, err := db.GetJob("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	// Finished jobs (job-a, job-b) are pruned; the queued job-c is kept
+	cutoff := time.Now().UTC().Add(time.Minute)
+	pruned, err := db.PruneJobs(cutoff, true)
+	if err != nil {
+		t.Fatalf("PruneJobs failed: %v", err)
+	}
+	if len(pruned) != 2 {
+		t.Errorf("expected 2 prunable jobs, got %d", len(pruned))
+	}
+	if _, err := db.PruneJobs(cutoff, false); err != nil {
+		t.Fatalf("PruneJobs failed: %v", err)
+	}
+	if all, _ = db.ListJobs("", 0); len(all) != 1 || all[0].ID != "job-c" {
+		t.Errorf("expected only job-c to remain, got %+v", all)
+	}
+}
+
+func TestRawRecords(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	xml := []byte(`<EXPERIMENT accession="SRX000001"><TITLE>liver</TITLE></EXPERIMENT>`)
+	written, err := db.StoreRawRecords([]RawRecord{
+		{Accession: "SRX000001", RecordType: "experiment", XML: xml},
+		{Accession: "SRX000002", RecordType: "experiment", XML: xml},
+	})
+	if err != nil {
+		t.Fatalf("StoreRawRecords failed: %v", err)
+	}
+	if written != 1 {
+		t.Errorf("expected identical XML to be stored once, got %d blobs", written)
+	}
+
+	info, got, err := db.GetRawRecord("SRX000002")
+	if err != nil {
+		t.Fatalf("GetRawRecord failed: %v", err)
+	}
+	if string(got) != string(xml) {
+		t.Errorf("expected %q, got %q", xml, got)
+	}
+	if info.Hash != RawRecordHash(xml) || info.Codec != RawCodecZstd || info.Size != int64(len(xml)) {
+		t.Errorf("unexpected record info: %+v", info)
+	}
+
+	// A new version replaces the pointer but keeps the old blob
+	updated := []byte(`<EXPERIMENT accession="SRX000001"><TITLE>kidney</TITLE></EXPERIMENT>`)
+	if _, err := db.StoreRawRecords([]RawRecord{{Accession: "SRX000001", RecordType: "experiment", XML: updated}}); err != nil {
+		t.Fatalf("StoreRawRecords failed: %v", err)
+	}
+	if _, got, _ := db.GetRawRecord("SRX000001"); string(got) != string(updated) {
+		t.Errorf("expected updated XML, got %q", got)
+	}
+
+	// Blobs written with gzip by earlier versions are still read
+	legacy := []byte(`<EXPERIMENT accession="SRX000003"/>`)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(legacy)
+	zw.Close()
+	if _, err := db.Exec(`INSERT INTO raw_blobs (hash, codec, size, data) VALUES (?, ?, ?, ?)`,
+		RawRecordHash(legacy), RawCodecGzip, len(legacy), gz.Bytes()); err != nil {
+		t.Fatalf("failed to insert gzip blob: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO raw_records (accession, record_type, hash, updated_at) VALUES (?, ?, ?, ?)`,
+		"SRX000003", "experiment", RawRecordHash(legacy), time.Now()); err != nil {
+		t.Fatalf("failed to insert raw record: %v", err)
+	}
+	if _, got, err := db.GetRawRecord("SRX000003"); err != nil || string(got) != string(legacy) {
+		t.Errorf("expected gzip XML, got %q, %v", got, err)
+	}
+
+	if _, _, err := db.GetRawRecord("SRX999999"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	err := db.QuarantineRecords([]QuarantinedRecord{
+		{IngestID: "old", Accession: "SRR000001", RecordType: "run", XML: []byte("<RUN/>"), Errors: []QuarantineError{{Type: "MISSING_REQUIRED_FIELD"}}},
+	})
+	if err != nil {
+		t.Fatalf("QuarantineRecords failed: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE quarantine SET quarantined_at = ?`, time.Now().UTC().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Now()
+	err = db.QuarantineRecords([]QuarantinedRecord{
+		{IngestID: "a", Accession: "SRS000001", RecordType: "sample", XML: []byte("<SAMPLE/>"), Errors: []QuarantineError{
+			{Type: "MISSING_REQUIRED_FIELD", Field: "TAXON_ID", Message: "TAXON_ID is required"},
+			{Type: "MISSING_REQUIRED_FIELD", Field: "SCIENTIFIC_NAME", Message: "SCIENTIFIC_NAME is required"},
+		}},
+		{IngestID: "a", Accession: "SRX000001", RecordType: "experiment", XML: []byte("<EXPERIMENT/>"), Errors: []QuarantineError{
+			{Type: "INVALID_REFERENCE", Message: "bad STUDY_REF"},
+		}},
+		{IngestID: "b", Accession: "SRS000001", RecordType: "sample", XML: []byte("<SAMPLE/>")},
+	})
+	if err != nil {
+		t.Fatalf("QuarantineRecords failed: %v", err)
+	}
+
+	summary, err := db.SummarizeQuarantine(since)
+	if err != nil {
+		t.Fatalf("SummarizeQuarantine failed: %v", err)
+	}
+	if summary.Records != 3 || summary.ByType["MISSING_REQUIRED_FIELD"] != 2 || summary.ByType["INVALID_REFERENCE"] != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	records, err := db.ListQuarantine("", "SRS000001", 0)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected SRS000001 quarantined by both ingests, got %+v (%v)", records, err)
+	}
+	if records, _ = db.ListQuarantine("a", "SRX000001", 0); len(records) != 1 || string(records[0].XML) != "<EXPERIMENT/>" || records[0].Errors[0].Type != "INVALID_REFERENCE" {
+		t.Errorf("unexpected quarantined experiment: %+v", records)
+	}
+
+	if n, err := db.ClearQuarantine("a"); err != nil || n != 2 {
+		t.Errorf("expected 2 records cleared, got %d (%v)", n, err)
+	}
+	if records, _ = db.ListQuarantine("", "", 0); len(records) != 2 || records[0].IngestID != "b" {
+		t.Errorf("expected ingest b and the old ingest to remain, newest first, got %+v", records)
+	}
+}
+
+func TestRecordSources(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	err := db.InsertRecordSources([]RecordSource{
+		{Accession: "ERP000001", RecordType: "study", Archive: "ena", SourceFile: "ena_study.xml.gz"},
+		{Accession: "DRX000001", RecordType: "experiment", Archive: "ddbj"},
+		{Accession: "ERS000001", RecordType: "sample", Archive: "ena"},
+	})
+	if err != nil {
+		t.Fatalf("InsertRecordSources failed: %v", err)
+	}
+
+	source, err := db.GetRecordSource("ERP000001")
+	if err != nil {
+		t.Fatalf("GetRecordSource failed: %v", err)
+	}
+	if source.Archive != "ena" || source.SourceFile != "ena_study.xml.gz" || source.IngestedAt.IsZero() {
+		t.Errorf("unexpected source: %+v", source)
+	}
+
+	counts, err := db.CountRecordsByArchive()
+	if err != nil {
+		t.Fatalf("CountRecordsByArchive failed: %v", err)
+	}
+	if counts["ena"] != 2 || counts["ddbj"] != 1 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+
+	if _, err := db.GetRecordSource("SRP999999"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestIngests(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ingest := &Ingest{ID: "0123456789abcdef", Input: "NCBI_SRA_Metadata_20250916.tar.gz", Archive: "ncbi"}
+	if err := db.StartIngest(ingest); err != nil {
+		t.Fatalf("StartIngest failed: %v", err)
+	}
+	err := db.InsertRecordSources([]RecordSource{
+		{Accession: "SRR000001", RecordType: "run", Archive: "ncbi", SourceFile: ingest.Input, IngestID: ingest.ID},
+	})
+	if err != nil {
+		t.Fatalf("InsertRecordSources failed: %v", err)
+	}
+
+	got, err := db.GetIngest(ingest.ID)
+	if err != nil {
+		t.Fatalf("GetIngest failed: %v", err)
+	}
+	if got.FinishedAt != nil || got.Input != ingest.Input || got.StartedAt.IsZero() {
+		t.Errorf("expected a running ingest, got %+v", got)
+	}
+
+	if err := db.FinishIngest(ingest.ID, 1, errors.New("disk full")); err != nil {
+		t.Fatalf("FinishIngest failed: %v", err)
+	}
+	got, _ = db.GetIngest(ingest.ID)
+	if got == nil || got.FinishedAt == nil || got.Records != 1 || got.Error != "disk full" {
+		t.Errorf("expected a failed ingest of 1 record, got %+v", got)
+	}
+
+	source, err := db.GetRecordSource("SRR000001")
+	if err != nil || source.IngestID != ingest.ID {
+		t.Errorf("expected the source to name its ingest, got %+v (%v)", source, err)
+	}
+	if _, err := db.GetIngest("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestIngestRatios(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if r, err := db.IngestRatios(); err != nil || r.Ingests != 0 {
+		t.Fatalf("expected no measured ingests, got %+v (%v)", r, err)
+	}
+
+	// Failed and unmeasured ingests do not count
+	for _, in := range []struct {
+		id      string
+		records int64
+		err     error
+		archive int64
+	}{
+		{"a", 1000, nil, 100000},
+		{"b", 3000, nil, 300000},
+		{"c", 5, errors.New("disk full"), 1000},
+		{"d", 7, nil, 0},
+	} {
+		if err := db.StartIngest(&Ingest{ID: in.id, Input: in.id + ".tar.gz"}); err != nil {
+			t.Fatalf("StartIngest failed: %v", err)
+		}
+		if err := db.FinishIngest(in.id, in.records, in.err); err != nil {
+			t.Fatalf("FinishIngest failed: %v", err)
+		}
+		if in.archive > 0 {
+			if err := db.MeasureIngest(in.id, in.archive, in.archive*5, 10*time.Second); err != nil {
+				t.Fatalf("MeasureIngest failed: %v", err)
+			}
+		}
+	}
+
+	r, err := db.IngestRatios()
+	if err != nil || r.Ingests != 2 {
+		t.Fatalf("expected 2 measured ingests, got %+v (%v)", r, err)
+	}
+	if r.RecordsPerByte != 0.01 || r.GrowthPerByte != 5 || r.BytesPerSecond != 20000 {
+		t.Errorf("unexpected ratios: %+v", r)
+	}
+	if got, _ := db.GetIngest("b"); got == nil || got.ArchiveBytes != 300000 || got.Elapsed != 10 {
+		t.Errorf("expected a measured ingest, got %+v", got)
+	}
+}
+
+// TestRecordSourcesUpgrade tests that databases created before ingests
+// were recorded gain the ingest_id column
+func TestRecordSourcesUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.Exec(`CREATE TABLE record_sources (
+		accession TEXT PRIMARY KEY,
+		record_type TEXT NOT NULL,
+		archive TEXT NOT NULL,
+		source_file TEXT,
+		ingested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO record_sources (accession, record_type, archive) VALUES ('SRP000001', 'study', 'ncbi')`)
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Initialize(path)
+	if err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer db.Close()
+
+	if source, err := db.GetRecordSource("SRP000001"); err != nil || source.IngestID != "" {
+		t.Errorf("expected the old source without an ingest, got %+v (%v)", source, err)
+	}
+	err = db.InsertRecordSources([]RecordSource{{Accession: "SRP000001", RecordType: "study", Archive: "ncbi", IngestID: "abc"}})
+	if err != nil {
+		t.Fatalf("InsertRecordSources failed: %v", err)
+	}
+	if source, _ := db.GetRecordSource("SRP000001"); source == nil || source.IngestID != "abc" {
+		t.Errorf("expected the ingest to be recorded, got %+v", source)
+	}
+}
+
+func TestCohorts(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, acc := range []string{"SRP000001", "SRP000002"} {
+		if err := db.InsertStudy(&Study{StudyAccession: acc, StudyTitle: "Liver " + acc, Metadata: "{}"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.UpdateStatistics(); err != nil {
+		t.Fatal(err)
+	}
+
+	generation, err := db.GetGeneration()
+	if err != nil {
+		t.Fatalf("GetGeneration failed: %v", err)
+	}
+	if generation.Records != 2 || generation.UpdatedAt.IsZero() {
+		t.Errorf("unexpected generation: %+v", generation)
+	}
+
+	var members []CohortMember
+	for _, acc := range []string{"SRP000001", "SRP000002"} {
+		fp, err := db.RecordFingerprint("study", acc)
+		if err != nil || fp == "" {
+			t.Fatalf("RecordFingerprint failed: %q, %v", fp, err)
+		}
+		members = append(members, CohortMember{Accession: acc, RecordType: "study", Fingerprint: fp})
+	}
+
+	cohort := &Cohort{Name: "liver", Query: "liver", Filters: map[string]string{"organism": "human"}, Generation: *generation}
+	if err := db.CreateCohort(cohort, members, false); err != nil {
+		t.Fatalf("CreateCohort failed: %v", err)
+	}
+	if err := db.CreateCohort(cohort, members, false); err == nil {
+		t.Error("expected error when freezing an existing cohort without replace")
+	}
+
+	got, err := db.GetCohort("liver")
+	if err != nil {
+		t.Fatalf("GetCohort failed: %v", err)
+	}
+	if got.MemberCount != 2 || got.Filters["organism"] != "human" || got.Generation.Records != 2 {
+		t.Errorf("unexpected cohort: %+v", got)
+	}
+
+	// Change one record, drop another, and add a new one
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001", StudyTitle: "Liver (revised)", Metadata: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	changed, _ := db.RecordFingerprint("study", "SRP000001")
+	current := []CohortMember{
+		{Accession: "SRP000001", RecordType: "study", Fingerprint: changed},
+		{Accession: "SRP000003", RecordType: "study"},
+	}
+	frozen, err := db.GetCohortMembers("liver")
+	if err != nil {
+		t.Fatalf("GetCohortMembers failed: %v", err)
+	}
+	diff := DiffCohort(frozen, current)
+	if len(diff.Added) != 1 || diff.Added[0].Accession != "SRP000003" ||
+		len(diff.Removed) != 1 || diff.Removed[0].Accession != "SRP000002" ||
+		len(diff.Changed) != 1 || diff.Changed[0].Accession != "SRP000001" || diff.Unchanged != 0 {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+
+	if err := db.CreateCohort(&Cohort{Name: "liver", Query: "liver"}, current, true); err != nil {
+		t.Fatalf("CreateCohort with replace failed: %v", err)
+	}
+	cohorts, err := db.ListCohorts()
+	if err != nil || len(cohorts) != 1 || cohorts[0].MemberCount != 2 {
+		t.Errorf("unexpected cohorts: %+v, %v", cohorts, err)
+	}
+
+	if err := db.DeleteCohort("liver"); err != nil {
+		t.Fatalf("DeleteCohort failed: %v", err)
+	}
+	if _, err := db.GetCohort("liver"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestSearchPartialAccessions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, acc := range []string{"SRR1234567", "SRR7123400", "SRR9999999"} {
+		if err := db.InsertRun(&Run{RunAccession: acc, ExperimentAccession: "SRX000001"}); err != nil {
+			t.Fatalf("InsertRun failed: %v", err)
+		}
+	}
+	if err := db.InsertSubmission(&Submission{SubmissionAccession: "SRA000001", Alias: "lab_batch_1234"}); err != nil {
+		t.Fatalf("InsertSubmission failed: %v", err)
+	}
+	if err := db.InsertIdentifier(&Identifier{RecordType: "run", RecordAccession: "SRR9999999",
+		IDType: IDTypeAlias, IDValue: "lane_1234"}); err != nil {
+		t.Fatalf("InsertIdentifier failed: %v", err)
+	}
+
+	fts := NewFTS5Manager(db)
+	check := func(label, fragment string, want []string) {
+		t.Helper()
+		matches, err := fts.SearchPartialAccessions(fragment, 10)
+		if err != nil {
+			t.Fatalf("%s: SearchPartialAccessions(%q) failed: %v", label, fragment, err)
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Accession)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: SearchPartialAccessions(%q) = %v, want %v", label, fragment, got, want)
+		}
+	}
+
+	// Without the trigram index the lookup scans the record tables
+	if fts.HasTrigramTable() {
+		t.Fatal("expected no trigram table before it is built")
+	}
+	check("scan", "1234", []string{"SRA000001", "SRR1234567", "SRR7123400", "SRR9999999"})
+	check("scan", "50_", nil)
+
+	count, err := fts.CreateTrigramTable()
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		t.Skip("SQLite built without FTS5 (use -tags sqlite_fts5), skipping trigram lookups")
+	}
+	if err != nil {
+		t.Fatalf("CreateTrigramTable failed: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("expected 5 indexed records, got %d", count)
+	}
+	check("trigram", "1234", []string{"SRA000001", "SRR1234567", "SRR7123400", "SRR9999999"})
+	check("trigram", "srr99", []string{"SRR9999999"})
+	check("short", "99", []string{"SRR9999999"})
+
+	// Records ingested, replaced and deleted after the index is built
+	if err := db.InsertRun(&Run{RunAccession: "SRR5551234", ExperimentAccession: "SRX000001"}); err != nil {
+		t.Fatalf("InsertRun failed: %v", err)
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR1234567", ExperimentAccession: "SRX000002"}); err != nil {
+		t.Fatalf("InsertRun failed: %v", err)
+	}
+	if err := db.InsertSubmission(&Submission{SubmissionAccession: "SRA000001", Alias: "lab_batch_2"}); err != nil {
+		t.Fatalf("InsertSubmission failed: %v", err)
+	}
+	if err := db.InsertIdentifier(&Identifier{RecordType: "run", RecordAccession: "SRR5551234",
+		IDType: IDTypeAlias, IDValue: "lane_7777"}); err != nil {
+		t.Fatalf("InsertIdentifier failed: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM runs WHERE run_accession = 'SRR7123400'`); err != nil {
+		t.Fatal(err)
+	}
+	check("trigram after ingest", "1234", []string{"SRR1234567", "SRR5551234", "SRR9999999"})
+	check("trigram after ingest", "7777", []string{"SRR5551234"})
+	check("trigram after ingest", "batch_2", []string{"SRA000001"})
+	var entries int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM fts_accession_trigram`).Scan(&entries); err != nil || entries != 6 {
+		t.Errorf("expected 6 trigram entries after ingest, got %d (%v)", entries, err)
+	}
+}
+
+func TestLookupIdentifiers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	err := db.InsertIdentifiers([]Identifier{
+		{RecordType: "sample", RecordAccession: "SRS000001", IDType: IDTypeAlias, IDNamespace: "GEO", IDValue: "GSM123_rep2"},
+		{RecordType: "sample", RecordAccession: "SRS000001", IDType: IDTypeSubmitter, IDValue: "gsm123_rep2"},
+		{RecordType: "sample", RecordAccession: "SRS000002", IDType: IDTypeAlias, IDValue: "gsm123_REP2"},
+		{RecordType: "sample", RecordAccession: "SRS000003", IDType: IDTypeAlias, IDValue: "GSM123_rep2_b"},
+		{RecordType: "sample", RecordAccession: "SRS000004", IDType: IDTypeAlias, IDValue: "old_GSM123_rep2"},
+		{RecordType: "sample", RecordAccession: "SRS000005", IDType: "external", IDValue: "GSM123_rep2"},
+		{RecordType: "sample", RecordAccession: "SRS000006", IDType: IDTypeAlias, IDValue: "GSM1230rep2"},
+	})
+	if err != nil {
+		t.Fatalf("InsertIdentifiers failed: %v", err)
+	}
+
+	matches, err := db.LookupIdentifiers("GSM123_rep2", nil, 10)
+	if err != nil {
+		t.Fatalf("LookupIdentifiers failed: %v", err)
+	}
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Accession+":"+m.Match)
+	}
+	want := []string{
+		"SRS000001:" + MatchExact,
+		"SRS000002:" + MatchCaseInsensitive,
+		"SRS000003:" + MatchPrefix,
+		"SRS000004:" + MatchSubstring,
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if matches[0].Namespace != "GEO" || matches[0].Score != 1.0 {
+		t.Errorf("unexpected best match: %+v", matches[0])
+	}
+
+	// Restricting to submitter IDs drops alias matches
+	matches, err = db.LookupIdentifiers("GSM123_REP2", []string{IDTypeSubmitter}, 10)
+	if err != nil {
+		t.Fatalf("LookupIdentifiers failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].IDType != IDTypeSubmitter || matches[0].Match != MatchCaseInsensitive {
+		t.Errorf("expected one case-insensitive submitter match, got %+v", matches)
+	}
+
+	if matches, _ := db.LookupIdentifiers("GSM123_rep2", nil, 2); len(matches) != 2 {
+		t.Errorf("expected limit of 2, got %d", len(matches))
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	const sum = "9e107d9d372bb6826bd81d3542a419d6"
+	err := db.SetRunFiles([]string{"SRR000001", "SRR000002"}, []RunFile{
+		{RunAccession: "SRR000001", Filename: "sample1_R1.fastq.gz", FileType: "fastq", MD5: strings.ToUpper(sum)},
+		{RunAccession: "SRR000001", Filename: "sample1_R2.fastq.gz", FileType: "fastq"},
+		{RunAccession: "SRR000002", Filename: "sample1_R1.fastq.gz", FileType: "fastq"},
+	})
+	if err != nil {
+		t.Fatalf("SetRunFiles failed: %v", err)
+	}
+
+	matches, err := db.LookupRunFiles(IDTypeMD5, sum, 10)
+	if err != nil {
+		t.Fatalf("LookupRunFiles failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Accession != "SRR000001" || matches[0].Namespace != "sample1_R1.fastq.gz" ||
+		matches[0].Match != MatchExact {
+		t.Errorf("expected an exact match on SRR000001, got %+v", matches)
+	}
+
+	matches, err = db.LookupRunFiles(IDTypeFilename, "sample1_R1.fastq.gz", 10)
+	if err != nil {
+		t.Fatalf("LookupRunFiles failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].Accession != "SRR000001" || matches[1].Accession != "SRR000002" {
+		t.Errorf("expected both runs, got %+v", matches)
+	}
+	if matches, _ := db.LookupRunFiles(IDTypeFilename, "sample1_R1", 10); len(matches) != 0 {
+		t.Errorf("expected no partial filename matches, got %+v", matches)
+	}
+	if _, err := db.LookupRunFiles(IDTypeAlias, "x", 10); err == nil {
+		t.Error("expected an error for a non-file identifier type")
+	}
+
+	// Re-ingesting a run replaces its files
+	if err := db.SetRunFiles([]string{"SRR000001"}, nil); err != nil {
+		t.Fatalf("SetRunFiles failed: %v", err)
+	}
+	if matches, _ := db.LookupRunFiles(IDTypeMD5, sum, 10); len(matches) != 0 {
+		t.Errorf("expected replaced files to be gone, got %+v", matches)
+	}
+
+	// Suppressing a run drops its files
+	if _, err := db.SuppressRecords([]string{"SRR000002"}); err != nil {
+		t.Fatalf("SuppressRecords failed: %v", err)
+	}
+	if matches, _ := db.LookupRunFiles(IDTypeFilename, "sample1_R1.fastq.gz", 10); len(matches) != 0 {
+		t.Errorf("expected suppressed run files to be gone, got %+v", matches)
+	}
+}
+
+func TestAppliedUpdates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if updates, err := db.ListAppliedUpdates(); err != nil || len(updates) != 0 {
+		t.Fatalf("expected no applied updates, got %v (%v)", updates, err)
+	}
+
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	for _, u := range []AppliedUpdate{
+		{FileName: "NCBI_SRA_Metadata_20250916.tar.gz", FileType: "daily", FileDate: day("2025-09-16"), Records: 10, Suppressed: 2},
+		{FileName: "NCBI_SRA_Metadata_Full_20250915.tar.gz", FileType: "monthly", FileDate: day("2025-09-15"), Records: 1000},
+	} {
+		if err := db.RecordAppliedUpdate(u); err != nil {
+			t.Fatalf("RecordAppliedUpdate failed: %v", err)
+		}
+	}
+
+	updates, err := db.ListAppliedUpdates()
+	if err != nil {
+		t.Fatalf("ListAppliedUpdates failed: %v", err)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 applied updates, got %d", len(updates))
+	}
+	last := updates[len(updates)-1]
+	if last.FileType != "daily" || !last.FileDate.Equal(day("2025-09-16")) || last.Suppressed != 2 {
+		t.Errorf("expected the daily update last, got %+v", last)
+	}
+}
+
+func TestEntrezSyncs(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if last, err := db.LastEntrezSync(); err != nil || last != nil {
+		t.Fatalf("expected no Entrez sync, got %v (%v)", last, err)
+	}
+
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	for _, s := range []EntrezSync{
+		{SyncedUntil: day("2025-09-17"), Records: 40},
+		{SyncedUntil: day("2025-09-18"), Records: 5},
+		{SyncedUntil: day("2025-09-18"), Records: 12, Suppressed: 1}, // A later poll of the same day
+	} {
+		if err := db.RecordEntrezSync(s); err != nil {
+			t.Fatalf("RecordEntrezSync failed: %v", err)
+		}
+	}
+
+	last, err := db.LastEntrezSync()
+	if err != nil {
+		t.Fatalf("LastEntrezSync failed: %v", err)
+	}
+	if last == nil || !last.SyncedUntil.Equal(day("2025-09-18")) || last.Records != 12 || last.Suppressed != 1 {
+		t.Errorf("expected the latest poll of 2025-09-18, got %+v", last)
+	}
+}
+
+func TestSampleRunsTable(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertExperiment(&Experiment{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertExperimentSamples([]ExperimentSample{
+		{ExperimentAccession: "SRX000001", SampleAccession: "SRS000001"},
+		{ExperimentAccession: "SRX000001", SampleAccession: "SRS000002"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if links, _ := db.GetSampleRuns("SRS000001"); len(links) != 0 {
+		t.Fatalf("expected no rows before refresh, got %+v", links)
+	}
+	if err := db.RefreshSampleRuns([]string{"SRX000001"}); err != nil {
+		t.Fatalf("RefreshSampleRuns failed: %v", err)
+	}
+	links, err := db.GetRunSamples("SRR000001")
+	if err != nil {
+		t.Fatalf("GetRunSamples failed: %v", err)
+	}
+	if len(links) != 2 || links[0].SampleAccession != "SRS000001" || links[1].StudyAccession != "SRP000001" {
+		t.Errorf("unexpected run samples %+v", links)
+	}
+
+	if n, err := db.RebuildSampleRuns(); err != nil || n != 2 {
+		t.Errorf("expected 2 rebuilt rows, got %d (%v)", n, err)
+	}
+
+	if _, err := db.SuppressRecords([]string{"SRS000002"}); err != nil {
+		t.Fatalf("SuppressRecords failed: %v", err)
+	}
+	if links, _ := db.GetRunSamples("SRR000001"); len(links) != 1 {
+		t.Errorf("expected the suppressed sample's row to be removed, got %+v", links)
+	}
+}
+
+func TestSampleAttributes(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	samples := []Sample{
+		{SampleAccession: "SRS000001", Organism: "Homo sapiens",
+			SampleAttributes: `[{"tag":"Tissue","value":"liver"},{"tag":"age","value":"52","units":"years"}]`},
+		{SampleAccession: "SRS000002", Organism: "Homo sapiens",
+			SampleAttributes: `[{"tag":"tissue","value":"Liver"},{"tag":"Age","value":"35 years"}]`},
+		{SampleAccession: "SRS000003", Organism: "Homo sapiens",
+			Metadata: `{"attributes":[{"tag":"tissue","value":"kidney"},{"tag":"age","value":"61"}]}`},
+	}
+	for i := range samples {
+		if err := db.InsertSample(&samples[i]); err != nil {
+			t.Fatalf("InsertSample failed: %v", err)
+		}
+	}
+
+	query := func(exprs ...string) []string {
+		t.Helper()
+		var conds []AttributeCondition
+		for _, e := range exprs {
+			c, err := ParseAttributeCondition(e)
+			if err != nil {
+				t.Fatalf("ParseAttributeCondition(%q) failed: %v", e, err)
+			}
+			conds = append(conds, c)
+		}
+		matches, total, err := db.QuerySampleAttributes(conds, 0, 0)
+		if err != nil {
+			t.Fatalf("QuerySampleAttributes failed: %v", err)
+		}
+		if total != len(matches) {
+			t.Errorf("total %d does not match %d matches", total, len(matches))
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.SampleAccession)
+		}
+		return got
+	}
+
+	if got := query("tissue=liver", "age>40"); len(got) != 1 || got[0] != "SRS000001" {
+		t.Errorf("tissue=liver AND age>40 = %v", got)
+	}
+	if got := query("tissue=liver"); len(got) != 2 {
+		t.Errorf("tissue=liver = %v", got)
+	}
+	if got := query("age>=35", "tissue!=liver"); len(got) != 1 || got[0] != "SRS000003" {
+		t.Errorf("age>=35 AND tissue!=liver = %v", got)
+	}
+	if got := query("tissue~IDN"); len(got) != 1 {
+		t.Errorf("tissue~IDN = %v", got)
+	}
+
+	conds := []AttributeCondition{{Tag: "tissue", Op: AttrOpEq, Value: "liver"}, {Tag: "age"}}
+	matches, total, err := db.QuerySampleAttributes(conds, 1, 1)
+	if err != nil || total != 2 || len(matches) != 1 {
+		t.Fatalf("expected the second of 2 matches, got %+v of %d (%v)", matches, total, err)
+	}
+	if m := matches[0]; m.SampleAccession != "SRS000002" || len(m.Attributes) != 2 || m.Attributes[1].Value != "35 years" {
+		t.Errorf("unexpected match %+v", m)
+	}
+
+	if _, err := ParseAttributeCondition("age>forty"); err == nil {
+		t.Error("expected an error for a non-numeric comparison")
+	}
+	if c, _ := ParseAttributeCondition("Cell Type >= 2"); c.Tag != "cell_type" || c.Op != AttrOpGe || c.Value != "2" {
+		t.Errorf("unexpected condition %+v", c)
+	}
+
+	tags, err := db.ListAttributeTags("", 0)
+	if err != nil || len(tags) != 2 || tags[0].Samples != 3 {
+		t.Errorf("unexpected tags %+v (%v)", tags, err)
+	}
+
+	attrs, err := db.GetSampleAttributes([]string{"SRS000002", "SRS000003", "SRS999999"}, []string{"Age"})
+	if err != nil || len(attrs) != 2 || len(attrs["SRS000002"]) != 1 || attrs["SRS000003"][0].Value != "61" {
+		t.Errorf("unexpected attributes %+v (%v)", attrs, err)
+	}
+
+	// Re-inserting a sample replaces its attributes
+	samples[0].SampleAttributes = `[{"tag":"tissue","value":"heart"}]`
+	if err := db.InsertSample(&samples[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := query("tissue=liver"); len(got) != 1 {
+		t.Errorf("expected the replaced attributes to be gone, got %v", got)
+	}
+
+	if n, err := db.RebuildSampleAttributes(); err != nil || n != 5 {
+		t.Errorf("expected 5 rows after a rebuild, got %d (%v)", n, err)
+	}
+}
+
+func TestResolveSampleAttributes(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001",
+		Metadata: `{"attributes":[{"tag":"Sex","value":"male"},{"tag":"Tissue","value":"liver"},{"tag":"disease state","value":"NASH"}]}`}); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []*Experiment{
+		{ExperimentAccession: "SRX000002", StudyAccession: "SRP000001", Metadata: `{"attributes":[{"tag":"tissue","value":"liver biopsy"}]}`},
+		{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001", Metadata: `{"attributes":[{"tag":"tissue","value":"hepatocytes"}]}`},
+	} {
+		if err := db.InsertExperiment(exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sample := range []*Sample{
+		{SampleAccession: "SRS000001", SampleAttributes: `[{"tag":"sex","value":"female"},{"tag":"age","value":"52","units":"years"}]`},
+		{SampleAccession: "SRS000002"},
+	} {
+		if err := db.InsertSample(sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertExperimentSamples([]ExperimentSample{
+		{ExperimentAccession: "SRX000001", SampleAccession: "SRS000001"},
+		{ExperimentAccession: "SRX000002", SampleAccession: "SRS000001"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := db.ResolveSampleAttributes([]string{"SRS000001", "SRS000002"})
+	if err != nil {
+		t.Fatalf("ResolveSampleAttributes failed: %v", err)
+	}
+	// The sample's own sex wins over the study's; the tissue comes from
+	// the first experiment by accession
+	want := []InheritedAttribute{
+		{Tag: "sex", Value: "female", Source: AttrSourceSample, SourceAccession: "SRS000001"},
+		{Tag: "age", Value: "52", Units: "years", Source: AttrSourceSample, SourceAccession: "SRS000001"},
+		{Tag: "tissue", Value: "hepatocytes", Source: AttrSourceExperiment, SourceAccession: "SRX000001"},
+		{Tag: "disease_state", Value: "NASH", Source: AttrSourceStudy, SourceAccession: "SRP000001"},
+	}
+	if got := resolved["SRS000001"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected attributes:\n got %+v\nwant %+v", got, want)
+	}
+	// A sample without experiments inherits nothing
+	if got := resolved["SRS000002"]; len(got) != 0 {
+		t.Errorf("expected no attributes for an unlinked sample, got %+v", got)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []*Experiment{
+		{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001"},
+		{ExperimentAccession: "SRX000002", StudyAccession: "SRP999999"},
+	} {
+		if err := db.InsertExperiment(exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, run := range []*Run{
+		{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"},
+		{RunAccession: "SRR000002", ExperimentAccession: "SRX999999"},
+	} {
+		if err := db.InsertRun(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertExperimentSamples([]ExperimentSample{{ExperimentAccession: "SRX000001", SampleAccession: "SRS999999"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE studies SET metadata = '{broken' WHERE study_accession = 'SRP000001'`); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.CheckIntegrity(10)
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	counts := make(map[string]int64)
+	for _, r := range report.Results {
+		counts[r.Check] = r.Count
+	}
+	want := map[string]int64{
+		CheckOrphanExperiments: 1,
+		CheckOrphanRuns:        1,
+		CheckOrphanSampleLinks: 1,
+		CheckInvalidJSON:       1,
+	}
+	for check, n := range want {
+		if counts[check] != n {
+			t.Errorf("expected %d %s, got %d", n, check, counts[check])
+		}
+	}
+	if report.Problems() != 4 {
+		t.Errorf("expected 4 problems, got %d", report.Problems())
+	}
+	if r := report.Results[0]; len(r.Examples) != 1 || r.Examples[0].Key != "SRX000002" || r.Examples[0].Missing != "SRP999999" {
+		t.Errorf("unexpected orphan experiment examples %+v", r.Examples)
+	}
+
+	if _, err := db.FixIntegrity("ignore"); err == nil {
+		t.Error("expected an error for an unknown fix strategy")
+	}
+
+	// Placeholders keep every ingested record
+	if _, err := db.FixIntegrity(FixPlaceholders); err != nil {
+		t.Fatalf("FixIntegrity failed: %v", err)
+	}
+	if report, _ := db.CheckIntegrity(0); report.Problems() != 0 {
+		t.Errorf("expected no problems after placeholders, got %+v", report.Results)
+	}
+	study, err := db.GetStudy("SRP999999")
+	if err != nil || study.Metadata != placeholderMetadata {
+		t.Errorf("expected a placeholder study, got %+v (%v)", study, err)
+	}
+	var runs int
+	db.QueryRow(`SELECT COUNT(*) FROM runs`).Scan(&runs)
+	if runs != 2 {
+		t.Errorf("expected both runs to be kept, got %d", runs)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	for i := 1; i <= 500; i++ {
+		if err := db.InsertStudy(&Study{StudyAccession: fmt.Sprintf("SRP%06d", i), StudyAbstract: strings.Repeat("x", 2000)}); err != nil {
+			t.Fatalf("InsertStudy failed: %v", err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM studies"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := db.SpaceUsage()
+	if err != nil {
+		t.Fatalf("SpaceUsage failed: %v", err)
+	}
+	if !before.NeedsVacuum() || before.FreeBytes() == 0 {
+		t.Fatalf("expected free pages after deleting every study, got %+v", before)
+	}
+
+	if err := db.Vacuum(ctx); err != nil {
+		t.Fatalf("Vacuum failed: %v", err)
+	}
+	after, err := db.SpaceUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.NeedsVacuum() || after.FileBytes >= before.FileBytes {
+		t.Errorf("expected a smaller file after vacuuming, got %+v then %+v", before, after)
+	}
+
+	if err := db.Analyze(ctx); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	for _, quick := range []bool{false, true} {
+		result, err := db.CheckStorageIntegrity(ctx, quick, 5)
+		if err != nil || result.Check != CheckStorage || result.Count != 0 {
+			t.Errorf("CheckStorageIntegrity(quick=%v) = %+v, %v", quick, result, err)
+		}
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := func(name string, studies ...*Study) string {
+		path := filepath.Join(dir, name)
+		db, err := Initialize(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		for _, s := range studies {
+			if err := db.InsertStudy(s); err != nil {
+				t.Fatalf("InsertStudy failed: %v", err)
+			}
+		}
+		return path
+	}
+	oldPath := snapshot("old.db",
+		&Study{StudyAccession: "SRP000001", StudyTitle: "kept"},
+		&Study{StudyAccession: "SRP000002", StudyTitle: "removed"},
+		&Study{StudyAccession: "SRP000003", StudyTitle: "before"},
+		&Study{StudyAccession: "SRP000005"},
+	)
+	newPath := snapshot("new.db",
+		&Study{StudyAccession: "SRP000001", StudyTitle: "kept"},
+		&Study{StudyAccession: "SRP000003", StudyTitle: "after"},
+		&Study{StudyAccession: "SRP000004", StudyTitle: "added"},
+		&Study{StudyAccession: "SRP000005", Organism: "Homo sapiens"},
+	)
+
+	diff, err := DiffSnapshots(context.Background(), oldPath, newPath, 1)
+	if err != nil {
+		t.Fatalf("DiffSnapshots failed: %v", err)
+	}
+	if len(diff.Tables) != len(diffTables) || diff.Tables[0].Table != "studies" {
+		t.Fatalf("unexpected tables %+v", diff.Tables)
+	}
+	studies := diff.Tables[0]
+	if studies.Added.Count != 1 || studies.Added.Accessions[0] != "SRP000004" {
+		t.Errorf("unexpected added %+v", studies.Added)
+	}
+	if studies.Removed.Count != 1 || studies.Removed.Accessions[0] != "SRP000002" {
+		t.Errorf("unexpected removed %+v", studies.Removed)
+	}
+	// A NULL column that gains a value is a change; the list is limited
+	if studies.Changed.Count != 2 || len(studies.Changed.Accessions) != 1 || studies.Changed.Accessions[0] != "SRP000003" {
+		t.Errorf("unexpected changed %+v", studies.Changed)
+	}
+	for _, td := range diff.Tables[1:] {
+		if td.Added.Count+td.Removed.Count+td.Changed.Count != 0 {
+			t.Errorf("%s: unexpected changes %+v", td.Table, td)
+		}
+	}
+
+	if _, err := DiffSnapshots(context.Background(), filepath.Join(dir, "missing.db"), newPath, 0); err == nil {
+		t.Error("expected an error for a missing snapshot")
+	}
+}
+
+func TestExtractStudies(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, study := range []string{"SRP000001", "SRP000002"} {
+		n := study[len(study)-1:]
+		if err := db.InsertStudy(&Study{StudyAccession: study}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertExperiment(&Experiment{ExperimentAccession: "SRX00000" + n, StudyAccession: study}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertSample(&Sample{SampleAccession: "SRS00000" + n, TaxonID: 9606}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertExperimentSamples([]ExperimentSample{{ExperimentAccession: "SRX00000" + n, SampleAccession: "SRS00000" + n}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertRun(&Run{RunAccession: "SRR00000" + n, ExperimentAccession: "SRX00000" + n}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertIdentifier(&Identifier{RecordType: "sample", RecordAccession: "SRS00000" + n, IDType: IDTypeAlias, IDValue: "alias" + n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO taxonomy (tax_id, parent_id, rank, name, lft, rgt) VALUES
+		(1, 1, 'no rank', 'root', 1, 6), (9606, 1, 'species', 'Homo sapiens', 2, 3), (10090, 1, 'species', 'Mus musculus', 4, 5)`); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "subset.db")
+	summary, err := db.ExtractStudies(context.Background(), []string{"srp000001", "SRP999999"}, path)
+	if err != nil {
+		t.Fatalf("ExtractStudies failed: %v", err)
+	}
+	if summary.Studies != 1 || len(summary.Missing) != 1 || summary.Missing[0] != "SRP999999" {
+		t.Errorf("expected SRP999999 to be missing, got %v", summary.Missing)
+	}
+	rows := make(map[string]int64)
+	for _, table := range summary.Tables {
+		rows[table.Table] = table.Rows
+	}
+	for table, want := range map[string]int64{"studies": 1, "experiments": 1, "samples": 1, "runs": 1, "experiment_samples": 1, "identifiers": 1, "taxonomy": 2} {
+		if rows[table] != want {
+			t.Errorf("expected %d rows of %s, got %d", want, table, rows[table])
+		}
+	}
+
+	subset, err := Initialize(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subset.Close()
+	if _, err := subset.GetRun("SRR000001"); err != nil {
+		t.Errorf("extracted run missing: %v", err)
+	}
+	if _, err := subset.GetStudy("SRP000002"); err == nil {
+		t.Error("unrequested study was extracted")
+	}
+	report, err := subset.CheckIntegrity(5)
+	if err != nil || report.Problems() != 0 {
+		t.Errorf("expected a consistent subset, got %+v, %v", report, err)
+	}
+
+	if _, err := db.ExtractStudies(context.Background(), []string{"SRP000001"}, path); err == nil {
+		t.Error("expected an error for an existing output")
+	}
+	if _, err := db.ExtractStudies(context.Background(), []string{"SRP999999"}, filepath.Join(t.TempDir(), "none.db")); err == nil {
+		t.Error("expected an error when no study exists")
+	}
+}
+
+func TestFixIntegrityDelete(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// The run's experiment is itself an orphan, so deleting it orphans the run
+	if err := db.InsertExperiment(&Experiment{ExperimentAccession: "SRX000001", StudyAccession: "SRP999999"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fixes, err := db.FixIntegrity(FixDelete)
+	if err != nil {
+		t.Fatalf("FixIntegrity failed: %v", err)
+	}
+	if len(fixes) != 2 || fixes[0].Table != "experiments" || fixes[1].Table != "runs" {
+		t.Errorf("unexpected fixes %+v", fixes)
+	}
+	if report, _ := db.CheckIntegrity(0); report.Problems() != 0 {
+		t.Errorf("expected no problems after deleting, got %+v", report.Results)
+	}
+}
+
+func TestFTSSearchSamplesAndRuns(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertSample(&Sample{SampleAccession: "SRS000001", Organism: "Homo sapiens",
+		Tissue: "liver", Description: "Hepatocellular carcinoma biopsy from a treated patient"}); err != nil {
+		t.Fatalf("InsertSample failed: %v", err)
+	}
+	if err := db.InsertExperiment(&Experiment{ExperimentAccession: "SRX000001", Title: "Liver tumour RNA-Seq",
+		LibraryStrategy: "RNA-Seq", Platform: "ILLUMINA"}); err != nil {
+		t.Fatalf("InsertExperiment failed: %v", err)
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001", TotalSpots: 42}); err != nil {
+		t.Fatalf("InsertRun failed: %v", err)
+	}
+
+	fts := NewFTS5Manager(db)
+	if fts.HasFTSTables() {
+		t.Fatal("expected no FTS tables before they are built")
+	}
+	err := fts.CreateFTSTables()
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		t.Skip("SQLite built without FTS5 (use -tags sqlite_fts5), skipping FTS searches")
+	}
+	if err != nil {
+		t.Fatalf("CreateFTSTables failed: %v", err)
+	}
+	if !fts.HasFTSTables() {
+		t.Fatal("expected FTS tables after they are built")
+	}
+
+	samples, err := fts.SearchSamples("carcinomas liver", 10)
+	if err != nil {
+		t.Fatalf("SearchSamples failed: %v", err)
+	}
+	if len(samples) != 1 || samples[0].SampleAccession != "SRS000001" {
+		t.Fatalf("unexpected samples: %+v", samples)
+	}
+	if got := samples[0].Snippets["description"]; !strings.Contains(got, HighlightStart+"carcinoma"+HighlightEnd) {
+		t.Errorf("expected highlighted description, got %q", got)
+	}
+	if got := samples[0].Snippets["tissue"]; got != HighlightStart+"liver"+HighlightEnd {
+		t.Errorf("expected highlighted tissue, got %q", got)
+	}
+	if samples, _ := fts.SearchSamples("liver kidney", 10); len(samples) != 0 {
+		t.Errorf("expected every term to be required, got %+v", samples)
+	}
+
+	runs, err := fts.SearchRuns("tumour rna-seq", 10)
+	if err != nil {
+		t.Fatalf("SearchRuns failed: %v", err)
+	}
+	if len(runs) != 1 || runs[0].RunAccession != "SRR000001" || runs[0].TotalSpots != 42 || runs[0].Platform != "ILLUMINA" {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+
+	// Records ingested after the build are kept current by triggers,
+	// including replaced records and runs ingested before their experiment
+	if err := db.InsertSample(&Sample{SampleAccession: "SRS000001", Organism: "Homo sapiens", Tissue: "kidney"}); err != nil {
+		t.Fatalf("InsertSample failed: %v", err)
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR000002", ExperimentAccession: "SRX000002"}); err != nil {
+		t.Fatalf("InsertRun failed: %v", err)
+	}
+	if err := db.InsertExperiment(&Experiment{ExperimentAccession: "SRX000002", Title: "Kidney ATAC-Seq"}); err != nil {
+		t.Fatalf("InsertExperiment failed: %v", err)
+	}
+	if samples, _ := fts.SearchSamples("liver", 10); len(samples) != 0 {
+		t.Errorf("expected the replaced sample to be removed, got %+v", samples)
+	}
+	if samples, _ := fts.SearchSamples("kidney", 10); len(samples) != 1 {
+		t.Errorf("expected the replacement sample, got %+v", samples)
+	}
+	if runs, _ := fts.SearchRuns("kidney", 10); len(runs) != 1 || runs[0].RunAccession != "SRR000002" {
+		t.Errorf("expected the run of the new experiment, got %+v", runs)
+	}
+}
+
+func TestStudySummaries(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001"}); err != nil {
+		t.Fatalf("InsertStudy failed: %v", err)
+	}
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000002"}); err != nil {
+		t.Fatalf("InsertStudy failed: %v", err)
+	}
+	for _, exp := range []*Experiment{
+		{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001", Platform: "ILLUMINA", LibraryStrategy: "RNA-Seq"},
+		{ExperimentAccession: "SRX000002", StudyAccession: "SRP000001", Platform: "ILLUMINA", LibraryStrategy: "WGS"},
+	} {
+		if err := db.InsertExperiment(exp); err != nil {
+			t.Fatalf("InsertExperiment failed: %v", err)
+		}
+	}
+	for _, run := range []*Run{
+		{RunAccession: "SRR000001", ExperimentAccession: "SRX000001", TotalBases: 100},
+		{RunAccession: "SRR000002", ExperimentAccession: "SRX000001", TotalBases: 50},
+		{RunAccession: "SRR000003", ExperimentAccession: "SRX000002", TotalBases: 25},
+	} {
+		if err := db.InsertRun(run); err != nil {
+			t.Fatalf("InsertRun failed: %v", err)
+		}
+	}
+	if err := db.InsertExperimentSamples([]ExperimentSample{
+		{ExperimentAccession: "SRX000001", SampleAccession: "SRS000001"},
+		{ExperimentAccession: "SRX000002", SampleAccession: "SRS000001"},
+	}); err != nil {
+		t.Fatalf("InsertExperimentSamples failed: %v", err)
+	}
+
+	summaries, err := db.StudySummaries(context.Background(), []string{"SRP000001", "SRP000002", "SRP999999"})
+	if err != nil {
+		t.Fatalf("StudySummaries failed: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 summaries, got %d", len(summaries))
+	}
+	s := summaries["SRP000001"]
+	if s.ExperimentCount != 2 || s.SampleCount != 1 || s.RunCount != 3 || s.TotalBases != 175 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if strings.Join(s.Platforms, ",") != "ILLUMINA" || len(s.LibraryStrategies) != 2 {
+		t.Errorf("unexpected technologies: %+v", s)
+	}
+	if s := summaries["SRP000002"]; s.ExperimentCount != 0 || s.Platforms != nil {
+		t.Errorf("unexpected empty summary: %+v", s)
+	}
+
+	// A spent budget returns what was read, with the context's error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summaries, err = db.StudySummaries(ctx, []string{"SRP000001"})
+	if err != context.Canceled || len(summaries) != 0 {
+		t.Errorf("expected no summaries and context.Canceled, got %d and %v", len(summaries), err)
+	}
+}
+
+func TestSketches(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Runs ingested before sketches were kept
+	for i := 0; i < 50; i++ {
+		if _, err := db.Exec(`INSERT INTO runs (run_accession) VALUES (?)`, fmt.Sprintf("SRR%06d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		exp := &Experiment{
+			ExperimentAccession: fmt.Sprintf("SRX%06d", i),
+			Platform:            []string{"ILLUMINA", "OXFORD_NANOPORE"}[i%2],
+			LibraryStrategy:     "RNA-Seq",
+		}
+		if err := db.InsertExperiment(exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR999999"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is stored yet, so the counts are exact
+	stats, err := db.EstimateStats()
+	if err != nil || stats.Approximate || stats.TotalRuns != 51 || stats.TotalExperiments != 20 {
+		t.Fatalf("unexpected stats before a flush: %+v (%v)", stats, err)
+	}
+
+	if err := db.FlushSketches(); err != nil {
+		t.Fatalf("FlushSketches failed: %v", err)
+	}
+	stats, err = db.EstimateStats()
+	if err != nil || !stats.Approximate || stats.TotalRuns != 51 || stats.TotalExperiments != 20 {
+		t.Errorf("unexpected estimated stats: %+v (%v)", stats, err)
+	}
+
+	// Records inserted after the flush count before the next one
+	if err := db.InsertRun(&Run{RunAccession: "SRR888888"}); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := db.DistinctCounts(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byDimension := make(map[string]DistinctCount)
+	for _, c := range counts {
+		byDimension[c.Dimension] = c
+	}
+	if c := byDimension[SketchRuns]; c.Count != 52 || !c.Approximate {
+		t.Errorf("unexpected run count %+v", c)
+	}
+	if c := byDimension[SketchPlatforms]; c.Count != 2 || !c.Approximate {
+		t.Errorf("unexpected platform count %+v", c)
+	}
+	if c := byDimension[SketchOrganisms]; c.Count != 0 || c.Approximate {
+		t.Errorf("expected organisms without a sketch to be counted, got %+v", c)
+	}
+
+	// Sketches keep deleted records until they are rebuilt
+	if _, err := db.Exec(`DELETE FROM experiments WHERE platform = 'OXFORD_NANOPORE'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RebuildSketches(); err != nil {
+		t.Fatalf("RebuildSketches failed: %v", err)
+	}
+	counts, err = db.DistinctCounts(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range counts {
+		if c.Dimension == SketchPlatforms && c.Count != 1 {
+			t.Errorf("expected 1 platform after a rebuild, got %+v", c)
+		}
+	}
+}
+
+func TestTaxonomy(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// root > Eukaryota > Primates > Homo sapiens; Eukaryota > Mus musculus
+	taxa := []Taxon{
+		{TaxID: 1, ParentID: 1, Rank: "no rank", Name: "root", Left: 1, Right: 10},
+		{TaxID: 2759, ParentID: 1, Rank: "domain", Name: "Eukaryota", Left: 2, Right: 9},
+		{TaxID: 9443, ParentID: 2759, Rank: "order", Name: "Primates", Left: 3, Right: 6},
+		{TaxID: 9606, ParentID: 9443, Rank: "species", Name: "Homo sapiens", Left: 4, Right: 5},
+		{TaxID: 10090, ParentID: 2759, Rank: "species", Name: "Mus musculus", Left: 7, Right: 8},
+	}
+	if err := db.ReplaceTaxonomy(taxa); err != nil {
+		t.Fatalf("ReplaceTaxonomy failed: %v", err)
+	}
+	for _, s := range []Sample{
+		{SampleAccession: "SRS000001", TaxonID: 9606},
+		{SampleAccession: "SRS000002", TaxonID: 10090},
+		{SampleAccession: "SRS000003"},
+	} {
+		if err := db.InsertSample(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	taxon, err := db.ResolveTaxon("primates")
+	if err != nil || taxon.TaxID != 9443 {
+		t.Fatalf("ResolveTaxon(primates) = %+v (%v)", taxon, err)
+	}
+	if _, err := db.ResolveTaxon("42"); !errors.Is(err, ErrTaxonNotFound) {
+		t.Errorf("expected ErrTaxonNotFound, got %v", err)
+	}
+
+	lineage, err := db.TaxonLineage(9606)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, l := range lineage {
+		names = append(names, l.Name)
+	}
+	if got := strings.Join(names, " > "); got != "root > Eukaryota > Primates > Homo sapiens" {
+		t.Errorf("unexpected lineage %s", got)
+	}
+
+	if n, err := db.CountDescendantSamples(9443); err != nil || n != 1 {
+		t.Errorf("expected 1 primate sample, got %d (%v)", n, err)
+	}
+	if n, err := db.CountDescendantSamples(2759); err != nil || n != 2 {
+		t.Errorf("expected 2 eukaryote samples, got %d (%v)", n, err)
+	}
+
+	ids, err := db.GetSampleTaxonIDs([]string{"SRS000001", "SRS000002", "SRS000003"})
+	if err != nil || len(ids) != 2 || ids["SRS000002"] != 10090 {
+		t.Errorf("unexpected taxon IDs %v (%v)", ids, err)
+	}
+}
+
+func TestChangeLog(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if g, err := db.ChangeGeneration(ctx); err != nil || g != 0 {
+		t.Fatalf("expected generation 0, got %d (%v)", g, err)
+	}
+	for _, acc := range []string{"SRP000001", "SRP000002"} {
+		if err := db.InsertStudy(&Study{StudyAccession: acc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertSample(&Sample{SampleAccession: "SRS000001"}); err != nil {
+		t.Fatal(err)
+	}
+	// A second change to a record moves it to the end of the log
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001", StudyTitle: "again"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT OR IGNORE INTO studies (study_accession) VALUES ('SRP000002')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SuppressRecords([]string{"SRP000002"}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := db.ChangesSince(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Accession+":"+c.RecordType+":"+c.Op)
+	}
+	want := "SRS000001:sample:upsert SRP000001:study:upsert SRP000002:study:delete"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("unexpected changes %v", got)
+	}
+
+	latest, err := db.ChangeGeneration(ctx)
+	if err != nil || latest != changes[2].Generation {
+		t.Fatalf("expected generation %d, got %d (%v)", changes[2].Generation, latest, err)
+	}
+	if after, err := db.ChangesSince(ctx, changes[0].Generation, 1); err != nil || len(after) != 1 || after[0].Accession != "SRP000001" {
+		t.Errorf("unexpected changes since %d: %+v (%v)", changes[0].Generation, after, err)
+	}
+
+	if err := db.UpsertCuration(&Curation{Accession: "SRS000001", RecordType: "sample", Notes: "checked"}); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := db.ChangesSince(ctx, latest, 10); err != nil || len(after) != 1 || after[0].Accession != "SRS000001" {
+		t.Errorf("expected the curated sample to change, got %+v (%v)", after, err)
+	}
+
+	// Changes are kept until every consumer has applied them
+	if _, ok, err := db.ChangeCursor(ctx, "index"); err != nil || ok {
+		t.Fatalf("expected no cursor, got %v (%v)", ok, err)
+	}
+	if err := db.SetChangeCursor(ctx, "index", latest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetChangeCursor(ctx, "sink", changes[0].Generation); err != nil {
+		t.Fatal(err)
+	}
+	if g, ok, err := db.ChangeCursor(ctx, "index"); err != nil || !ok || g != latest {
+		t.Fatalf("expected cursor %d, got %d %v (%v)", latest, g, ok, err)
+	}
+	if n, err := db.PruneChanges(ctx); err != nil || n != 0 {
+		t.Errorf("expected nothing pruned, got %d (%v)", n, err)
+	}
+	if err := db.SetChangeCursor(ctx, "sink", latest); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.PruneChanges(ctx); err != nil || n != 2 {
+		t.Errorf("expected 2 pruned, got %d (%v)", n, err)
+	}
+	if g, err := db.ChangeGeneration(ctx); err != nil || g != latest+1 {
+		t.Errorf("expected pruning to keep generation %d, got %d (%v)", latest+1, g, err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key, err := db.CreateAPIKey(&APIKey{Name: "lab", RequestsPerSecond: 2, Burst: 4, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		t.Errorf("expected key to start with %s, got %s", apiKeyPrefix, key)
+	}
+	if _, err := db.CreateAPIKey(&APIKey{Name: "lab"}); err == nil {
+		t.Error("expected an error creating a key under a name in use")
+	}
+
+	found, err := db.LookupAPIKey(key)
+	if err != nil || found == nil {
+		t.Fatalf("expected to find the key, got %v (%v)", found, err)
+	}
+	if found.Name != "lab" || found.RequestsPerSecond != 2 || found.Burst != 4 || !found.ReadOnly {
+		t.Errorf("unexpected key: %+v", found)
+	}
+	if found, err := db.LookupAPIKey(key + "x"); err != nil || found != nil {
+		t.Errorf("expected no key for a wrong key, got %v (%v)", found, err)
+	}
+
+	// Only the hash is stored
+	var stored int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE key_hash = ?`, key).Scan(&stored); err != nil || stored != 0 {
+		t.Errorf("expected the key not to be stored in plain text (%v)", err)
+	}
+
+	if _, err := db.CreateAPIKey(&APIKey{Name: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := db.ListAPIKeys()
+	if err != nil || len(keys) != 2 || keys[0].Name != "admin" || keys[1].Name != "lab" {
+		t.Fatalf("unexpected keys: %+v (%v)", keys, err)
+	}
+
+	if err := db.DeleteAPIKey("lab"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteAPIKey("lab"); err == nil {
+		t.Error("expected an error revoking a missing key")
+	}
+	if found, err := db.LookupAPIKey(key); err != nil || found != nil {
+		t.Errorf("expected a revoked key not to be found, got %v (%v)", found, err)
+	}
+}
+
+func TestQCFlags(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	flags := []QCFlag{
+		{Accession: "SRS000001", RecordType: "sample", Rule: "human-sample-sex", Severity: "warning", Message: "no sex"},
+		{Accession: "SRS000002", RecordType: "sample", Rule: "human-sample-sex", Severity: "warning", Message: "no sex"},
+		{Accession: "SRX000001", RecordType: "experiment", Rule: "rnaseq-source", Severity: "error"},
+	}
+	if err := db.FlagRecords(1, flags); err != nil {
+		t.Fatal(err)
+	}
+	before, err := db.ChangeGeneration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second run finds one sample again; the other now passes
+	if err := db.FlagRecords(2, flags[:1]); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := db.ClearStaleFlags(2, []string{"human-sample-sex"})
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 stale flag removed, got %d (%v)", removed, err)
+	}
+
+	// Only the flag removed changes the record's indexed rules
+	changes, err := db.ChangesSince(ctx, before, 10)
+	if err != nil || len(changes) != 1 || changes[0].Accession != "SRS000002" {
+		t.Errorf("expected only SRS000002 to change, got %+v (%v)", changes, err)
+	}
+
+	listed, err := db.ListFlags("", 0)
+	if err != nil || len(listed) != 2 || listed[0].Rule != "human-sample-sex" || listed[1].Accession != "SRX000001" {
+		t.Fatalf("unexpected flags: %+v (%v)", listed, err)
+	}
+	if listed[0].Message != "no sex" || listed[0].FlaggedAt.IsZero() {
+		t.Errorf("unexpected flag: %+v", listed[0])
+	}
+	if listed, err := db.ListFlags("rnaseq-source", 0); err != nil || len(listed) != 1 {
+		t.Errorf("expected 1 rnaseq-source flag, got %+v (%v)", listed, err)
+	}
+
+	rules, err := db.GetFlaggedRules([]string{"SRS000001", "SRS000002", "SRX000001"})
+	if err != nil || len(rules) != 2 || rules["SRS000001"][0] != "human-sample-sex" || rules["SRX000001"][0] != "rnaseq-source" {
+		t.Errorf("unexpected flagged rules: %v (%v)", rules, err)
+	}
+
+	if n, err := db.ClearFlags("rnaseq-source"); err != nil || n != 1 {
+		t.Errorf("expected 1 flag cleared, got %d (%v)", n, err)
+	}
+	if n, err := db.ClearFlags(""); err != nil || n != 1 {
+		t.Errorf("expected the last flag cleared, got %d (%v)", n, err)
+	}
+}
+
+func TestSavedSearches(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	s := &SavedSearch{Name: "liver", Query: "liver", Filters: map[string]string{"organism": "human"}}
+	if err := db.SaveSearch(s, false); err != nil {
+		t.Fatalf("SaveSearch failed: %v", err)
+	}
+	if err := db.SaveSearch(s, false); err == nil {
+		t.Error("expected error when saving an existing search without replace")
+	}
+
+	// The first run sees every match; later runs only the records not seen before
+	generation := Generation{Records: 2}
+	hits := []SavedSearchHit{{Accession: "SRP000001", RecordType: "study"}, {Accession: "SRP000002", RecordType: "study"}}
+	added, err := db.RecordSavedSearchRun("liver", generation, hits)
+	if err != nil || len(added) != 2 {
+		t.Fatalf("expected 2 new records, got %+v (%v)", added, err)
+	}
+	generation.Records = 3
+	added, err = db.RecordSavedSearchRun("liver", generation, []SavedSearchHit{
+		{Accession: "SRP000002", RecordType: "study"},
+		{Accession: "SRP000003", RecordType: "study"},
+	})
+	if err != nil || len(added) != 1 || added[0].Accession != "SRP000003" || added[0].FirstSeenAt.IsZero() {
+		t.Fatalf("expected only SRP000003 to be new, got %+v (%v)", added, err)
+	}
+	// A record that stopped matching is not new when it matches again
+	if added, err := db.RecordSavedSearchRun("liver", generation, hits[:1]); err != nil || len(added) != 0 {
+		t.Errorf("expected no new records, got %+v (%v)", added, err)
+	}
+
+	got, err := db.GetSavedSearch("liver")
+	if err != nil {
+		t.Fatalf("GetSavedSearch failed: %v", err)
+	}
+	if got.Seen != 3 || got.Filters["organism"] != "human" || got.Generation.Records != 3 || got.LastRunAt.IsZero() {
+		t.Errorf("unexpected saved search: %+v", got)
+	}
+
+	// Replacing a search forgets what it has seen
+	if err := db.SaveSearch(&SavedSearch{Name: "liver", Query: "liver cancer"}, true); err != nil {
+		t.Fatalf("SaveSearch with replace failed: %v", err)
+	}
+	searches, err := db.ListSavedSearches()
+	if err != nil || len(searches) != 1 || searches[0].Seen != 0 || searches[0].Query != "liver cancer" || !searches[0].LastRunAt.IsZero() {
+		t.Errorf("unexpected saved searches: %+v (%v)", searches, err)
+	}
+
+	if _, err := db.RecordSavedSearchRun("missing", generation, hits); err == nil {
+		t.Error("expected error recording a run of a missing search")
+	}
+	if err := db.DeleteSavedSearch("liver"); err != nil {
+		t.Fatalf("DeleteSavedSearch failed: %v", err)
+	}
+	if _, err := db.GetSavedSearch("liver"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestArchiveRuns(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	for _, r := range []Run{
+		{RunAccession: "SRR000001", ExperimentAccession: "SRX000001", Published: "2009-03-01 10:00:00"},
+		{RunAccession: "SRR000002", ExperimentAccession: "SRX000001", Published: "2012-06-15"},
+		{RunAccession: "SRR000003", ExperimentAccession: "SRX000001", Published: "2024-01-01"},
+		{RunAccession: "SRR000004", ExperimentAccession: "SRX000001"},
+	} {
+		if err := db.InsertRun(&r); err != nil {
+			t.Fatalf("InsertRun failed: %v", err)
+		}
+	}
+
+	before := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	if n, err := db.CountArchivableRuns(ctx, before); err != nil || n != 2 {
+		t.Fatalf("expected 2 runs to archive, got %d (%v)", n, err)
+	}
+	path := filepath.Join(filepath.Dir(db.Path()), "archive", "runs.db")
+	os.MkdirAll(filepath.Dir(path), 0750)
+	archive, err := db.ArchiveRuns(ctx, before, path)
+	if err != nil {
+		t.Fatalf("ArchiveRuns failed: %v", err)
+	}
+	if archive.Runs != 2 || archive.PublishedBefore != "2015-01-01" || archive.Format != ArchiveSQLite {
+		t.Errorf("unexpected archive: %+v", archive)
+	}
+	if _, err := db.GetRun("SRR000001"); err == nil {
+		t.Error("expected SRR000001 to be moved out of the database")
+	}
+	if _, err := db.GetRun("SRR000004"); err != nil {
+		t.Errorf("expected the run without a publication date to stay: %v", err)
+	}
+
+	// A run updated since it was archived is read from the database
+	if err := db.InsertRun(&Run{RunAccession: "SRR000002", ExperimentAccession: "SRX000002", Published: "2012-06-15"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another connection to the database reads the archive back
+	reader, err := Initialize(db.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if n, err := reader.IncludeArchived(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 archive to be attached, got %d (%v)", n, err)
+	}
+	run, err := reader.GetRun("SRR000001")
+	if err != nil || !strings.HasPrefix(run.Published, "2009-03-01") {
+		t.Errorf("expected archived run SRR000001, got %+v (%v)", run, err)
+	}
+	run, err = reader.GetRun("SRR000002")
+	if err != nil || run.ExperimentAccession != "SRX000002" {
+		t.Errorf("expected the database's copy of SRR000002, got %+v (%v)", run, err)
+	}
+	var total int
+	if err := reader.QueryRow("SELECT COUNT(*) FROM runs").Scan(&total); err != nil || total != 4 {
+		t.Errorf("expected 4 runs with archives included, got %d (%v)", total, err)
+	}
+
+	// Runs handed to a writer are deleted once written
+	var written []string
+	pq := filepath.Join(filepath.Dir(path), "runs.parquet")
+	archive, err = db.ArchiveRunsTo(ctx, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), pq, ArchiveParquet, func(rows *sql.Rows) (int64, error) {
+		for rows.Next() {
+			var acc, exp string
+			var spots, bases sql.NullInt64
+			var published, metadata sql.NullString
+			if err := rows.Scan(&acc, &exp, &spots, &bases, &published, &metadata); err != nil {
+				return 0, err
+			}
+			written = append(written, acc)
+		}
+		return int64(len(written)), rows.Err()
+	})
+	if err != nil {
+		t.Fatalf("ArchiveRunsTo failed: %v", err)
+	}
+	if strings.Join(written, " ") != "SRR000002 SRR000003" || archive.Runs != 2 {
+		t.Errorf("expected SRR000002 and SRR000003 to be written, got %v (%+v)", written, archive)
+	}
+
+	archives, err := db.ListRunArchives()
+	if err != nil || len(archives) != 2 || archives[0].Path != path || archives[1].Path != pq {
+		t.Errorf("unexpected archives: %+v (%v)", archives, err)
+	}
+}
+
+func TestResolveExternal(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertExperiment(&Experiment{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*Sample{
+		{SampleAccession: "SRS000001"},
+		{SampleAccession: "SRS000002", SampleAttributes: `[{"tag":"BioProject","value":"prjna000002"}]`},
+	} {
+		if err := db.InsertSample(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertExperimentSamples([]ExperimentSample{{ExperimentAccession: "SRX000001", SampleAccession: "SRS000001"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RebuildSampleRuns(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertIdentifiers([]Identifier{
+		{RecordType: "sample", RecordAccession: "SRS000001", IDType: "external", IDNamespace: "BioSample", IDValue: "SAMN00000001"},
+		{RecordType: "study", RecordAccession: "SRP000001", IDType: "external", IDNamespace: "BioProject", IDValue: "PRJNA000001"},
+		{RecordType: "sample", RecordAccession: "SRS000001", IDType: "submitter", IDValue: "SAMPLE-1"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := db.ResolveExternal("samn00000001")
+	if err != nil {
+		t.Fatalf("ResolveExternal failed: %v", err)
+	}
+	got := fmt.Sprint(links.Studies, links.Experiments, links.Samples, links.Runs)
+	if links.Type != XrefBioSample || got != "[SRP000001] [SRX000001] [SRS000001] [SRR000001]" {
+		t.Errorf("unexpected BioSample links: %s %+v", links.Type, links)
+	}
+
+	links, err = db.ResolveExternal("PRJNA000001")
+	if err != nil {
+		t.Fatalf("ResolveExternal failed: %v", err)
+	}
+	got = fmt.Sprint(links.Studies, links.Experiments, links.Samples, links.Runs)
+	if got != "[SRP000001] [SRX000001] [SRS000001] [SRR000001]" {
+		t.Errorf("unexpected BioProject links: %+v", links)
+	}
+
+	// Attributes are matched whatever their case
+	links, err = db.ResolveExternal("PRJNA000002")
+	if err != nil || fmt.Sprint(links.Samples) != "[SRS000002]" {
+		t.Errorf("expected SRS000002 from its attribute, got %+v (%v)", links, err)
+	}
+
+	// Replacing a sample's attributes drops the links they made
+	if err := db.InsertSample(&Sample{SampleAccession: "SRS000002"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ResolveExternal("PRJNA000002"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected PRJNA000002 not to be found, got %v", err)
+	}
+	if _, err := db.ResolveExternal("SRS000001"); err == nil {
+		t.Error("expected an error for an SRA accession")
+	}
+
+	// A rebuild finds the same links
+	if n, err := db.RebuildXrefs(); err != nil || n != 2 {
+		t.Errorf("expected 2 cross-references, got %d (%v)", n, err)
+	}
+}
+
+func TestRunBackfill(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Opening the database ran and recorded the backfills
+	var recorded int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM backfills WHERE name IN ('xrefs', 'geo_identifiers')`).Scan(&recorded); err != nil || recorded != 2 {
+		t.Fatalf("expected both backfills recorded, got %d (%v)", recorded, err)
+	}
+
+	runs := 0
+	backfill := func(*sql.DB) error { runs++; return nil }
+	for i := 0; i < 2; i++ {
+		if err := runBackfill(db.DB, "test", backfill); err != nil {
+			t.Fatalf("runBackfill failed: %v", err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("expected the backfill to run once, ran %d times", runs)
+	}
+
+	failing := func(*sql.DB) error { return errors.New("disk full") }
+	if err := runBackfill(db.DB, "failing", failing); err == nil {
+		t.Error("expected the error of the backfill")
+	}
+	if err := runBackfill(db.DB, "failing", backfill); err != nil || runs != 2 {
+		t.Errorf("expected a failed backfill to run again, ran %d times (%v)", runs, err)
+	}
+}
+
+func TestResolveGEO(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertExperiment(&Experiment{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertSample(&Sample{SampleAccession: "SRS000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertExperimentSamples([]ExperimentSample{{ExperimentAccession: "SRX000001", SampleAccession: "SRS000001"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertIdentifiers([]Identifier{
+		{RecordType: "study", RecordAccession: "SRP000001", IDType: "external", IDNamespace: "GEO", IDValue: "GSE1000"},
+		{RecordType: "experiment", RecordAccession: "SRX000001", IDType: IDTypeAlias, IDValue: "GSM2000"},
+		{RecordType: "sample", RecordAccession: "SRS000001", IDType: IDTypeAlias, IDValue: "GSM2000_rep1"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// GEO accessions get their own identifiers, but aliases merely
+	// starting with one do not
+	matches, err := db.LookupIdentifiers("GSM2000", []string{IDTypeGEO}, 10)
+	if err != nil || len(matches) != 1 || matches[0].Accession != "SRX000001" || matches[0].Namespace != NamespaceGEO {
+		t.Errorf("expected a GEO identifier of SRX000001, got %+v (%v)", matches, err)
+	}
+
+	want := "[SRP000001] [SRX000001] [SRS000001] [SRR000001]"
+	for _, acc := range []string{"GSE1000", "gsm2000"} {
+		links, err := db.ResolveExternal(acc)
+		if err != nil {
+			t.Fatalf("ResolveExternal(%s) failed: %v", acc, err)
+		}
+		if got := fmt.Sprint(links.Studies, links.Experiments, links.Samples, links.Runs); got != want {
+			t.Errorf("unexpected links of %s: %s", acc, got)
+		}
+	}
+	if links, _ := db.ResolveExternal("GSE1000"); links.Type != XrefGEOSeries {
+		t.Errorf("expected type %s, got %s", XrefGEOSeries, links.Type)
+	}
+
+	// Deleting the identifier a GEO accession came from removes its copy
+	if _, err := db.Exec(`DELETE FROM identifiers WHERE id_type = 'external' AND id_value = 'GSE1000'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ResolveExternal("GSE1000"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected GSE1000 not to be found, got %v", err)
+	}
+}
+
+func TestEmbeddingsStore(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	hash := EmbeddingTextHash("liver cancer")
+	if hash == EmbeddingTextHash("liver cancers") || len(hash) != 32 {
+		t.Errorf("unexpected text hash %q", hash)
+	}
+
+	stored := []StoredEmbedding{
+		{Accession: "SRP000002", TextHash: hash, Vector: []float32{0, 1.5, -2}},
+		{Accession: "SRP000001", TextHash: hash, Vector: []float32{1, 0, 0}},
+	}
+	if err := db.PutEmbeddings("model-a", stored); err != nil {
+		t.Fatalf("PutEmbeddings failed: %v", err)
+	}
+	if err := db.PutEmbeddings("model-b", stored[:1]); err != nil {
+		t.Fatalf("PutEmbeddings failed: %v", err)
+	}
+
+	// Vectors of another dimension are refused rather than mixed in
+	mixed := []StoredEmbedding{
+		{Accession: "SRP000003", TextHash: hash, Vector: []float32{1, 0, 0}},
+		{Accession: "SRP000004", TextHash: hash, Vector: []float32{1, 0}},
+	}
+	if err := db.PutEmbeddings("model-a", mixed); !errors.Is(err, ErrEmbeddingDims) {
+		t.Errorf("expected ErrEmbeddingDims, got %v", err)
+	}
+
+	// Models are kept apart
+	hashes, err := db.EmbeddingHashes("model-a")
+	if err != nil || len(hashes) != 2 || hashes["SRP000002"] != hash {
+		t.Errorf("unexpected hashes %v (%v)", hashes, err)
+	}
+	models, err := db.ListEmbeddingModels()
+	if err != nil || len(models) != 2 || models[0].Model != "model-a" || models[0].Count != 2 || models[0].Dims != 3 {
+		t.Errorf("unexpected models %+v (%v)", models, err)
+	}
+
+	var got []string
+	err = db.EachEmbedding("model-a", func(accession string, vector []float32) error {
+		got = append(got, fmt.Sprint(accession, vector))
+		return nil
+	})
+	if err != nil || strings.Join(got, " ") != "SRP000001[1 0 0] SRP000002[0 1.5 -2]" {
+		t.Errorf("unexpected embeddings %v (%v)", got, err)
+	}
+
+	if removed, err := db.DeleteEmbeddings("model-a", []string{"SRP000001", "SRP000009"}); err != nil || removed != 1 {
+		t.Errorf("expected 1 embedding removed, got %d (%v)", removed, err)
+	}
+	if removed, err := db.DeleteEmbeddings("model-b", nil); err != nil || removed != 1 {
+		t.Errorf("expected 1 embedding removed, got %d (%v)", removed, err)
+	}
+	if models, _ := db.ListEmbeddingModels(); len(models) != 1 || models[0].Count != 1 {
+		t.Errorf("unexpected models after deletion %+v", models)
+	}
+}
+
+func TestEstimateQueryCost(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	for i := 1; i <= 20; i++ {
+		study := &Study{StudyAccession: fmt.Sprintf("SRP%06d", i), Organism: "Homo sapiens"}
+		if err := db.InsertStudy(study); err != nil {
+			t.Fatalf("InsertStudy failed: %v", err)
+		}
+	}
+	if n, err := db.EstimateTableRows(ctx, "studies"); err != nil || n != 20 {
+		t.Fatalf("expected 20 studies, got %d (%v)", n, err)
+	}
+
+	// A LIKE reads every study
+	cost, err := db.EstimateQueryCost(ctx, "SELECT * FROM studies WHERE study_title LIKE ? LIMIT 5", "%liver%")
+	if err != nil {
+		t.Fatalf("EstimateQueryCost failed: %v", err)
+	}
+	if cost.Rows != 20 || len(cost.Scans) != 1 || cost.Scans[0] != "studies" {
+		t.Errorf("expected a scan of 20 studies, got %+v", cost)
+	}
+
+	// An indexed column narrows the search
+	cost, err = db.EstimateQueryCost(ctx, "SELECT * FROM studies s WHERE s.organism = ?", "Homo sapiens")
+	if err != nil || cost.Rows != 2 || len(cost.Scans) != 0 {
+		t.Errorf("expected an index search of 2 rows, got %+v (%v)", cost, err)
+	}
+
+	if _, err := db.EstimateTableRows(ctx, "studies; DROP TABLE runs"); err == nil {
+		t.Error("expected an error for an invalid table name")
+	}
+}
+
+func TestIDMappings(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	stored, err := db.ImportIDMappings("lims_map.tsv", []IDMapping{
+		{InternalID: "LIMS-0001", Accession: "SRS000001", RecordType: "sample"},
+		{InternalID: "LIMS-0002", Accession: "SRR000001", RecordType: "run"},
+		{InternalID: "LIMS-0002", Accession: "SRR000002", RecordType: "run"},
+	}, false)
+	if err != nil || stored != 3 {
+		t.Fatalf("expected 3 mappings stored, got %d (%v)", stored, err)
+	}
+
+	// Internal IDs are compared without regard to case
+	mappings, err := db.ResolveInternalID("lims-0002")
+	if err != nil || len(mappings) != 2 || mappings[0].Accession != "SRR000001" || mappings[1].Source != "lims_map.tsv" {
+		t.Fatalf("unexpected mappings of lims-0002: %+v (%v)", mappings, err)
+	}
+
+	ids, err := db.InternalIDsOf([]string{"SRS000001", "SRR000002", "SRR999999"})
+	if err != nil || len(ids) != 2 || ids["SRS000001"][0] != "LIMS-0001" || ids["SRR000002"][0] != "LIMS-0002" {
+		t.Errorf("unexpected internal IDs: %v (%v)", ids, err)
+	}
+
+	matches, err := db.LookupIdentifiers("LIMS-0001", []string{IDTypeInternal}, 10)
+	if err != nil || len(matches) != 1 || matches[0].Accession != "SRS000001" || matches[0].Namespace != "lims_map.tsv" {
+		t.Errorf("unexpected lookup of LIMS-0001: %+v (%v)", matches, err)
+	}
+
+	// Replacing a source drops the mappings it no longer has
+	if _, err := db.ImportIDMappings("lims_map.tsv", []IDMapping{
+		{InternalID: "LIMS-0001", Accession: "SRS000001", RecordType: "sample"},
+	}, true); err != nil {
+		t.Fatalf("ImportIDMappings failed: %v", err)
+	}
+	if _, err := db.ImportIDMappings("sheet.tsv", []IDMapping{
+		{InternalID: "S1", Accession: "SRX000001", RecordType: "experiment"},
+	}, false); err != nil {
+		t.Fatalf("ImportIDMappings failed: %v", err)
+	}
+	sources, err := db.ListIDMappingSources()
+	if err != nil || len(sources) != 2 || sources[0].Mappings != 1 || sources[0].ImportedAt.IsZero() {
+		t.Fatalf("unexpected sources: %+v (%v)", sources, err)
+	}
+
+	deleted, err := db.DeleteIDMappings("sheet.tsv")
+	if err != nil || deleted != 1 {
+		t.Errorf("expected 1 mapping deleted, got %d (%v)", deleted, err)
+	}
+	if mappings, _ := db.ResolveInternalID("S1"); len(mappings) != 0 {
+		t.Errorf("expected no mappings of S1 after delete, got %+v", mappings)
+	}
+}
+
+func TestExpectations(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	stored, err := db.ImportExpectations("samples.tsv", []Expectation{
+		{Expected: "SRP000001"},
+		{Expected: "liver-1", Label: "Liver, donor 1"},
+		{Expected: "liver-2"},
+	}, false)
+	if err != nil || stored != 3 {
+		t.Fatalf("expected 3 expectations stored, got %d (%v)", stored, err)
+	}
+	if appeared, err := db.ReconcileExpectations(); err != nil || len(appeared) != 0 {
+		t.Fatalf("expected nothing to appear yet, got %+v (%v)", appeared, err)
+	}
+
+	// The study appears by accession, and liver-1 by the alias of its sample
+	// rather than that of its experiment
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001"}); err != nil {
+		t.Fatalf("InsertStudy failed: %v", err)
+	}
+	if err := db.InsertIdentifiers([]Identifier{
+		{RecordType: "experiment", RecordAccession: "SRX000001", IDType: IDTypeAlias, IDValue: "liver-1"},
+		{RecordType: "sample", RecordAccession: "SRS000001", IDType: IDTypeAlias, IDValue: "liver-1"},
+	}); err != nil {
+		t.Fatalf("InsertIdentifiers failed: %v", err)
+	}
+	appeared, err := db.ReconcileExpectations()
+	if err != nil || len(appeared) != 2 {
+		t.Fatalf("expected 2 expectations to appear, got %+v (%v)", appeared, err)
+	}
+	if appeared[0].Expected != "SRP000001" || appeared[0].RecordType != "study" || appeared[0].AppearedAt == nil {
+		t.Errorf("unexpected appearance of the study: %+v", appeared[0])
+	}
+	if appeared[1].Accession != "SRS000001" || appeared[1].RecordType != "sample" || appeared[1].Label != "Liver, donor 1" {
+		t.Errorf("unexpected appearance of liver-1: %+v", appeared[1])
+	}
+
+	// Records appear once, and re-importing keeps their appearance
+	if appeared, _ := db.ReconcileExpectations(); len(appeared) != 0 {
+		t.Errorf("expected no second appearance, got %+v", appeared)
+	}
+	if _, err := db.ImportExpectations("samples.tsv", []Expectation{{Expected: "liver-1"}}, false); err != nil {
+		t.Fatalf("ImportExpectations failed: %v", err)
+	}
+	pending, err := db.ListExpectations("samples.tsv", true)
+	if err != nil || len(pending) != 1 || pending[0].Expected != "liver-2" {
+		t.Errorf("expected liver-2 pending, got %+v (%v)", pending, err)
+	}
+	if n, err := db.CountPendingExpectations(); err != nil || n != 1 {
+		t.Errorf("expected 1 pending expectation, got %d (%v)", n, err)
+	}
+	all, err := db.ListExpectations("", false)
+	if err != nil || len(all) != 3 || all[0].Expected != "SRP000001" || all[0].AppearedAt == nil {
+		t.Errorf("unexpected expectations: %+v (%v)", all, err)
+	}
+
+	deleted, err := db.DeleteExpectations("samples.tsv")
+	if err != nil || deleted != 3 {
+		t.Errorf("expected 3 expectations deleted, got %d (%v)", deleted, err)
+	}
+}
+
+func TestOntologies(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	err := db.ReplaceOntology(Ontology{Name: "efo", Format: "obo", SourceFile: "efo.obo"}, []OntologyTerm{
+		{ID: "EFO:0000182", Labels: []string{"hepatocellular carcinoma", "liver cancer", "HCC"}},
+		{ID: "EFO:0000001", Labels: []string{"experimental factor"}},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceOntology failed: %v", err)
+	}
+	err = db.ReplaceOntology(Ontology{Name: "mesh", Format: "mesh"}, []OntologyTerm{
+		{ID: "D006528", Labels: []string{"Carcinoma, Hepatocellular", "Hepatocellular Carcinoma", "Liver Cancer"}},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceOntology failed: %v", err)
+	}
+
+	// Labels are matched without regard to case, in every vocabulary
+	synonyms, err := db.OntologySynonyms([]string{"LIVER CANCER", "liver"})
+	if err != nil {
+		t.Fatalf("OntologySynonyms failed: %v", err)
+	}
+	got := strings.Join(synonyms["liver cancer"], "|")
+	want := "hepatocellular carcinoma|Carcinoma, Hepatocellular|HCC"
+	if got != want || len(synonyms) != 1 {
+		t.Errorf("expected synonyms %s, got %v", want, synonyms)
+	}
+
+	// Loading a vocabulary again replaces its terms
+	if err := db.ReplaceOntology(Ontology{Name: "efo", Format: "obo"}, []OntologyTerm{
+		{ID: "EFO:0000182", Labels: []string{"hepatocellular carcinoma"}},
+	}); err != nil {
+		t.Fatalf("ReplaceOntology failed: %v", err)
+	}
+	ontologies, err := db.ListOntologies()
+	if err != nil || len(ontologies) != 2 || ontologies[0].Name != "efo" || ontologies[0].Terms != 1 {
+		t.Fatalf("unexpected vocabularies: %+v (%v)", ontologies, err)
+	}
+
+	if err := db.DeleteOntology("mesh"); err != nil {
+		t.Fatalf("DeleteOntology failed: %v", err)
+	}
+	if synonyms, _ := db.OntologySynonyms([]string{"liver cancer"}); len(synonyms) != 0 {
+		t.Errorf("expected no synonyms after delete, got %v", synonyms)
+	}
+	if err := db.DeleteOntology("mesh"); err == nil {
+		t.Error("expected an error deleting a missing vocabulary")
+	}
+}
+
+func TestEnrichRun(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, run := range []Run{
+		{RunAccession: "SRR000001", Metadata: `{"run_center":"BGI"}`},
+		{RunAccession: "SRR000002", TotalSpots: 100, TotalBases: 15000, Published: "2020-01-01"},
+	} {
+		if err := db.InsertRun(&run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	missing, err := db.RunsMissingStats(10)
+	if err != nil || len(missing) != 1 || missing[0] != "SRR000001" {
+		t.Fatalf("expected SRR000001 to be missing statistics, got %v (%v)", missing, err)
+	}
+
+	enrichment := RunEnrichment{
+		RunAccession: "SRR000001",
+		TotalSpots:   200,
+		TotalBases:   30000,
+		SizeMB:       12,
+		Published:    "2021-02-03 04:05:06",
+		Source:       "ncbi-runinfo",
+	}
+	filled, err := db.EnrichRun(enrichment)
+	if err != nil {
+		t.Fatalf("EnrichRun failed: %v", err)
+	}
+	if strings.Join(filled, ",") != "total_spots,total_bases,published,size_mb" {
+		t.Errorf("unexpected fields filled in: %v", filled)
+	}
+	run, err := db.GetRun("SRR000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.TotalSpots != 200 || run.TotalBases != 30000 || !strings.HasPrefix(run.Published, "2021-02-03") {
+		t.Errorf("run not enriched: %+v", run)
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal([]byte(run.Metadata), &meta); err != nil {
+		t.Fatal(err)
+	}
+	record, _ := meta["enrichment"].(map[string]interface{})
+	if meta["run_center"] != "BGI" || meta["size_mb"] != float64(12) || record["source"] != "ncbi-runinfo" {
+		t.Errorf("unexpected metadata %s", run.Metadata)
+	}
+
+	// Values the run has are kept
+	enrichment.RunAccession = "SRR000002"
+	filled, err = db.EnrichRun(enrichment)
+	if err != nil || strings.Join(filled, ",") != "size_mb" {
+		t.Errorf("expected only size_mb filled in, got %v (%v)", filled, err)
+	}
+	if run, _ := db.GetRun("SRR000002"); run.TotalSpots != 100 || !strings.HasPrefix(run.Published, "2020-01-01") {
+		t.Errorf("existing values overwritten: %+v", run)
+	}
+	if filled, err := db.EnrichRun(enrichment); err != nil || len(filled) != 0 {
+		t.Errorf("expected nothing left to fill in, got %v (%v)", filled, err)
+	}
+
+	enrichment.RunAccession = "SRR999999"
+	if _, err := db.EnrichRun(enrichment); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("expected ErrRunNotFound, got %v", err)
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertRun(&Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WarmCache(context.Background()); err != nil {
+		t.Fatalf("WarmCache failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := db.WarmCache(ctx); err == nil {
+		t.Error("expected an error warming with a cancelled context")
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001", StudyTitle: "Old title"}); err != nil {
+		t.Fatal(err)
+	}
+
+	load, err := db.BeginBulkLoad()
+	if err != nil {
+		t.Fatalf("BeginBulkLoad failed: %v", err)
+	}
+	indexCount := func(name string) int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, name).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if indexCount("idx_study_organism") != 0 {
+		t.Error("expected secondary indexes to be dropped during a bulk load")
+	}
+	if indexCount("idx_run_experiment") != 1 {
+		t.Error("expected the index of runs by experiment to be kept")
+	}
+
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001", StudyTitle: "New title", Organism: "Homo sapiens"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.BatchInsertExperiments([]Experiment{{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertSample(&Sample{SampleAccession: "SRS000001", Organism: "Homo sapiens", TaxonID: 9606}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRun(&Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001", TotalSpots: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertExperimentSamples([]ExperimentSample{{ExperimentAccession: "SRX000001", SampleAccession: "SRS000001"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRun("SRR000001"); err == nil {
+		t.Error("expected staged runs not to be found before the bulk load finishes")
+	}
+
+	phases, err := load.Finish(context.Background())
+	if err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	var names []string
+	for _, p := range phases {
+		names = append(names, p.Name)
+	}
+	want := []string{BulkPhasePrepare, BulkPhaseLoad, BulkPhaseMerge, BulkPhaseIndex, BulkPhaseSampleRuns}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("phases = %v, want %v", names, want)
+	}
+
+	if study, err := db.GetStudy("SRP000001"); err != nil || study.StudyTitle != "New title" {
+		t.Errorf("expected the staged study to replace the old one, got %+v (%v)", study, err)
+	}
+	if run, err := db.GetRun("SRR000001"); err != nil || run.TotalSpots != 10 {
+		t.Errorf("expected the staged run, got %+v (%v)", run, err)
+	}
+	if sample, err := db.GetSample("SRS000001"); err != nil || sample.TaxonID != 9606 {
+		t.Errorf("expected the staged sample, got %+v (%v)", sample, err)
+	}
+	if runs, err := db.GetSampleRuns("SRS000001"); err != nil || len(runs) != 1 || runs[0].StudyAccession != "SRP000001" {
+		t.Errorf("expected sample_runs to be rebuilt, got %+v (%v)", runs, err)
+	}
+	if indexCount("idx_study_organism") != 1 || indexCount("idx_samples_taxon") != 1 {
+		t.Error("expected dropped indexes to be rebuilt")
+	}
+	var staging int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'bulk_%'`).Scan(&staging); err != nil || staging != 0 {
+		t.Errorf("expected staging tables to be dropped, found %d (%v)", staging, err)
+	}
+
+	// Inserts go straight to the tables again
+	if err := db.InsertRun(&Run{RunAccession: "SRR000002", ExperimentAccession: "SRX000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRun("SRR000002"); err != nil {
+		t.Errorf("expected run to be inserted after the bulk load: %v", err)
+	}
+	if _, err := load.Finish(context.Background()); err == nil {
+		t.Error("expected an error finishing a bulk load twice")
+	}
+}
+
+func TestPopularity(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	today := time.Now()
+	old := today.AddDate(0, 0, -60)
+	if err := db.AddPopularity(old, []PopularityCount{
+		{Accession: "SRP000001", RecordType: "study", Returned: 50},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.AddPopularity(today, []PopularityCount{
+			{Accession: "SRP000001", RecordType: "study", Returned: 1},
+			{Accession: "SRR000001", RecordType: "run", Returned: 2, Fetched: 3},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recent, err := db.PopularRecords("", today.AddDate(0, 0, -30), 10)
+	if err != nil {
+		t.Fatalf("PopularRecords failed: %v", err)
+	}
+	if len(recent) != 2 || recent[0].Accession != "SRR000001" || recent[0].Returned != 4 || recent[0].Fetched != 6 {
+		t.Errorf("unexpected recent popularity: %+v", recent)
+	}
+	ever, err := db.PopularRecords("study", time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ever) != 1 || ever[0].Total() != 52 {
+		t.Errorf("unexpected study popularity: %+v", ever)
+	}
+
+	popularity, err := db.Popularity([]string{"SRP000001", "SRR000001", "SRX000001"}, today.AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(popularity) != 2 || popularity["SRP000001"] != 2 || popularity["SRR000001"] != 10 {
+		t.Errorf("unexpected popularity: %v", popularity)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	write := func(db *DB, suffix string) error {
+		if err := db.InsertStudy(&Study{StudyAccession: "SRP00000" + suffix}); err != nil {
+			return err
+		}
+		if err := db.BatchInsertExperiments([]Experiment{{ExperimentAccession: "SRX00000" + suffix, StudyAccession: "SRP00000" + suffix}}); err != nil {
+			return err
+		}
+		if err := db.InsertRun(&Run{RunAccession: "SRR00000" + suffix, ExperimentAccession: "SRX00000" + suffix}); err != nil {
+			return err
+		}
+		return db.RefreshSampleRuns([]string{"SRX00000" + suffix})
+	}
+	count := func(table string) int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// A failure rolls back every write, those of methods with transactions
+	// of their own included
+	failed := errors.New("file failed")
+	err := db.WithTx(context.Background(), func(tx *DB) error {
+		if err := write(tx, "1"); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+	for _, table := range []string{"studies", "experiments", "runs"} {
+		if n := count(table); n != 0 {
+			t.Errorf("expected no %s after a rollback, got %d", table, n)
+		}
+	}
+
+	// Nested calls join the transaction
+	err = db.WithTx(context.Background(), func(tx *DB) error {
+		if err := write(tx, "1"); err != nil {
+			return err
+		}
+		return tx.WithTx(context.Background(), func(tx *DB) error { return write(tx, "2") })
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+	for _, table := range []string{"studies", "experiments", "runs"} {
+		if n := count(table); n != 2 {
+			t.Errorf("expected 2 %s after a commit, got %d", table, n)
+		}
+	}
+
+	// Writes outside a transaction are not held back
+	if err := write(db, "3"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("runs"); n != 3 {
+		t.Errorf("expected 3 runs, got %d", n)
+	}
+
+	// Reads through the view see its uncommitted writes, which the
+	// database does not, and a transaction cannot be begun in it
+	err = db.WithTx(context.Background(), func(tx *DB) error {
+		if err := tx.InsertSamplePool(&SamplePool{ParentSample: "SRS000001", MemberSample: "SRS000002"}); err != nil {
+			return err
+		}
+		if pools, err := tx.GetSamplePools("SRS000001"); err != nil || len(pools) != 1 {
+			t.Errorf("expected the view to read its pool, got %v, %v", pools, err)
+		}
+		if pools, err := db.GetSamplePools("SRS000001"); err != nil || len(pools) != 0 {
+			t.Errorf("expected the database not to read an uncommitted pool, got %v, %v", pools, err)
+		}
+		if _, err := tx.Begin(); err == nil {
+			t.Error("expected Begin to fail in a view")
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+}
+
+func TestLookupAccessions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.InsertStudy(&Study{StudyAccession: "SRP000001", StudyTitle: "Liver"}); err != nil {
+		t.Fatalf("InsertStudy failed: %v", err)
+	}
+	if err := db.InsertSample(&Sample{SampleAccession: "ERS000001", Organism: "Homo sapiens", TaxonID: 9606}); err != nil {
+		t.Fatalf("InsertSample failed: %v", err)
+	}
+	// More runs than are looked up in one query
+	var accessions []string
+	for i := 1; i <= 1200; i++ {
+		acc := fmt.Sprintf("SRR%06d", i)
+		if i%2 == 1 {
+			if err := db.InsertRun(&Run{RunAccession: acc, TotalSpots: int64(i)}); err != nil {
+				t.Fatalf("InsertRun failed: %v", err)
+			}
+		}
+		accessions = append(accessions, acc)
+	}
+	accessions = append(accessions, "srp000001", " ERS000001", "SRP000001", "GSM12345", "SRX999999", "")
+
+	lookup, err := db.LookupAccessions(accessions)
+	if err != nil {
+		t.Fatalf("LookupAccessions failed: %v", err)
+	}
+	if len(lookup.Studies) != 1 || lookup.Studies[0].StudyTitle != "Liver" {
+		t.Errorf("unexpected studies: %+v", lookup.Studies)
+	}
+	if len(lookup.Samples) != 1 || lookup.Samples[0].TaxonID != 9606 {
+		t.Errorf("unexpected samples: %+v", lookup.Samples)
+	}
+	// Runs come back in the order asked for
+	if len(lookup.Runs) != 600 || lookup.Runs[0].RunAccession != "SRR000001" || lookup.Runs[599].RunAccession != "SRR001199" {
+		t.Errorf("expected 600 runs in order, got %d", len(lookup.Runs))
+	}
+	if lookup.Found() != 602 || len(lookup.NotFound) != 602 {
+		t.Errorf("expected 602 found and 602 not found, got %d and %d", lookup.Found(), len(lookup.NotFound))
+	}
+	if last := lookup.NotFound[len(lookup.NotFound)-2:]; last[0] != "GSM12345" || last[1] != "SRX999999" {
+		t.Errorf("unexpected not found accessions: %v", last)
+	}
+
+	if _, err := db.LookupAccessions(make([]string, MaxAccessionLookup+1)); err == nil {
+		t.Error("expected an error for too many accessions")
+	}
+}
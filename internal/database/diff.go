@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// diffTables are the record tables compared by DiffSnapshots, with the
+// column identifying their records
+var diffTables = []struct {
+	table string
+	key   string
+}{
+	{"studies", "study_accession"},
+	{"experiments", "experiment_accession"},
+	{"samples", "sample_accession"},
+	{"runs", "run_accession"},
+	{"analyses", "analysis_accession"},
+	{"submissions", "submission_accession"},
+}
+
+// SnapshotDiff is the difference between two database snapshots
+type SnapshotDiff struct {
+	Old    string      `json:"old"`
+	New    string      `json:"new"`
+	Tables []TableDiff `json:"tables"`
+}
+
+// TableDiff lists the records of one table added, removed or changed
+// between two snapshots
+type TableDiff struct {
+	Table   string     `json:"table"`
+	Added   Accessions `json:"added"`
+	Removed Accessions `json:"removed"`
+	Changed Accessions `json:"changed"`
+}
+
+// Accessions counts a set of records, listing the first of them
+type Accessions struct {
+	Count      int64    `json:"count"`
+	Accessions []string `json:"accessions"`
+}
+
+// DiffSnapshots compares the records of two databases, such as monthly
+// snapshots, listing up to limit accessions of each kind of change (all
+// with limit 0). A record has changed when any column both databases have
+// differs. Neither database is modified.
+func DiffSnapshots(ctx context.Context, oldPath, newPath string, limit int) (*SnapshotDiff, error) {
+	for _, path := range []string{oldPath, newPath} {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("cannot open snapshot: %w", err)
+		}
+	}
+
+	conn, err := sql.Open("sqlite3", "file:"+newPath+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// The attached snapshot belongs to one connection
+	conn.SetMaxOpenConns(1)
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS old", "file:"+oldPath+"?mode=ro"); err != nil {
+		return nil, fmt.Errorf("failed to attach %s: %w", oldPath, err)
+	}
+
+	diff := &SnapshotDiff{Old: oldPath, New: newPath}
+	for _, t := range diffTables {
+		newCols, err := tableColumns(ctx, conn, "main", t.table)
+		if err != nil {
+			return nil, err
+		}
+		oldCols, err := tableColumns(ctx, conn, "old", t.table)
+		if err != nil {
+			return nil, err
+		}
+		// Tables an older version of srake did not create are skipped
+		if len(newCols) == 0 || len(oldCols) == 0 {
+			continue
+		}
+
+		td := TableDiff{Table: t.table}
+		notIn := func(a, b string) string {
+			return fmt.Sprintf(`SELECT x.%[1]s FROM %[2]s.%[3]s x
+				WHERE NOT EXISTS (SELECT 1 FROM %[4]s.%[3]s y WHERE y.%[1]s = x.%[1]s)
+				ORDER BY x.%[1]s`, t.key, a, t.table, b)
+		}
+		if err := collectAccessions(ctx, conn, notIn("main", "old"), limit, &td.Added); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.table, err)
+		}
+		if err := collectAccessions(ctx, conn, notIn("old", "main"), limit, &td.Removed); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.table, err)
+		}
+
+		var differs []string
+		for _, col := range newCols {
+			if col != t.key && slices.Contains(oldCols, col) {
+				differs = append(differs, fmt.Sprintf("n.%[1]s IS NOT o.%[1]s", col))
+			}
+		}
+		if len(differs) > 0 {
+			query := fmt.Sprintf(`SELECT n.%[1]s FROM main.%[2]s n JOIN old.%[2]s o ON o.%[1]s = n.%[1]s
+				WHERE %[3]s ORDER BY n.%[1]s`, t.key, t.table, strings.Join(differs, " OR "))
+			if err := collectAccessions(ctx, conn, query, limit, &td.Changed); err != nil {
+				return nil, fmt.Errorf("%s: %w", t.table, err)
+			}
+		}
+		diff.Tables = append(diff.Tables, td)
+	}
+	return diff, nil
+}
+
+// queryer is a database, connection or transaction
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// tableColumns returns the columns of a table in the given schema, or none
+// if it does not exist
+func tableColumns(ctx context.Context, conn queryer, schema, table string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT name FROM pragma_table_info(?, ?)`, table, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s.%s: %w", schema, table, err)
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+// collectAccessions counts the rows of query, keeping the first limit
+func collectAccessions(ctx context.Context, conn *sql.DB, query string, limit int, into *Accessions) error {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	into.Accessions = []string{}
+	for rows.Next() {
+		into.Count++
+		if limit > 0 && len(into.Accessions) >= limit {
+			continue
+		}
+		var accession string
+		if err := rows.Scan(&accession); err != nil {
+			return err
+		}
+		into.Accessions = append(into.Accessions, accession)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrEmbeddingDims is returned when an embedding has a different dimension
+// than those already stored for its model, which would mix vectors that
+// cannot be compared
+var ErrEmbeddingDims = errors.New("embedding dimension differs from the model's stored embeddings")
+
+// StoredEmbedding is the embedding of a record by one model, with the hash
+// of the text it was made from
+type StoredEmbedding struct {
+	Accession string
+	TextHash  string
+	Vector    []float32
+}
+
+// EmbeddingModel summarizes the embeddings stored for one model
+type EmbeddingModel struct {
+	Model string `json:"model"`
+	Count int64  `json:"count"`
+	Dims  int    `json:"dims"`
+}
+
+// EmbeddingTextHash returns the hash stored with an embedding of text
+func EmbeddingTextHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// PutEmbeddings stores embeddings made by model, replacing those of the
+// same records. All embeddings of a model must have the dimension of the
+// first stored; others fail with ErrEmbeddingDims and none are stored.
+func (db *DB) PutEmbeddings(model string, embeddings []StoredEmbedding) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var dims int
+	err = tx.QueryRow(`SELECT dims FROM embeddings WHERE model = ? LIMIT 1`, model).Scan(&dims)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO embeddings (model, accession, text_hash, dims, vector, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range embeddings {
+		if len(e.Vector) == 0 {
+			continue
+		}
+		if dims == 0 {
+			dims = len(e.Vector)
+		}
+		if len(e.Vector) != dims {
+			return fmt.Errorf("%w: %s has %d dimensions, %s embeddings have %d", ErrEmbeddingDims, e.Accession, len(e.Vector), model, dims)
+		}
+		if _, err := stmt.Exec(model, e.Accession, e.TextHash, len(e.Vector), encodeVector(e.Vector)); err != nil {
+			return fmt.Errorf("failed to store embedding of %s: %w", e.Accession, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// EmbeddingHashes returns the text hash of each embedding stored for model,
+// by accession
+func (db *DB) EmbeddingHashes(model string) (map[string]string, error) {
+	rows, err := db.Query(`SELECT accession, text_hash FROM embeddings WHERE model = ?`, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var accession, hash string
+		if err := rows.Scan(&accession, &hash); err != nil {
+			return nil, err
+		}
+		hashes[accession] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// EachEmbedding calls fn with every embedding stored for model, in
+// accession order
+func (db *DB) EachEmbedding(model string, fn func(accession string, vector []float32) error) error {
+	rows, err := db.Query(`SELECT accession, vector FROM embeddings WHERE model = ? ORDER BY accession`, model)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var accession string
+		var blob []byte
+		if err := rows.Scan(&accession, &blob); err != nil {
+			return err
+		}
+		vector, err := decodeVector(blob)
+		if err != nil {
+			return fmt.Errorf("embedding of %s: %w", accession, err)
+		}
+		if err := fn(accession, vector); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DeleteEmbeddings removes the embeddings of model for the given records,
+// or all of them when accessions is nil, and returns how many were removed
+func (db *DB) DeleteEmbeddings(model string, accessions []string) (int64, error) {
+	if accessions == nil {
+		result, err := db.Exec(`DELETE FROM embeddings WHERE model = ?`, model)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var removed int64
+	for _, accession := range accessions {
+		result, err := tx.Exec(`DELETE FROM embeddings WHERE model = ? AND accession = ?`, model, accession)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		removed += n
+	}
+	return removed, tx.Commit()
+}
+
+// ListEmbeddingModels returns the models embeddings are stored for, by name
+func (db *DB) ListEmbeddingModels() ([]EmbeddingModel, error) {
+	rows, err := db.Query(`
+		SELECT model, COUNT(*), MAX(dims)
+		FROM embeddings
+		GROUP BY model
+		ORDER BY model
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var models []EmbeddingModel
+	for rows.Next() {
+		var m EmbeddingModel
+		if err := rows.Scan(&m.Model, &m.Count, &m.Dims); err != nil {
+			return nil, err
+		}
+		models = append(models, m)
+	}
+	return models, rows.Err()
+}
+
+// encodeVector packs a vector as little-endian float32s
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeVector unpacks a vector written by encodeVector
+func decodeVector(buf []byte) ([]float32, error) {
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector of %d bytes", len(buf))
+	}
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vector, nil
+}
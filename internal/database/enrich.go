@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRunNotFound is returned by EnrichRun for runs not in the database
+var ErrRunNotFound = errors.New("run not found")
+
+// RunEnrichment holds run statistics and a release date fetched from
+// outside the metadata dumps, to fill in what a run is missing
+type RunEnrichment struct {
+	RunAccession string
+	TotalSpots   int64
+	TotalBases   int64
+	SizeMB       int64
+	Published    string
+	Source       string // where the values came from, e.g. ncbi-runinfo
+}
+
+// EnrichRun fills in the statistics and release date a run is missing
+// from e, keeping the values it has. Which fields were filled in, from
+// where and when is recorded under "enrichment" in the run's metadata JSON.
+// It returns the fields filled in, none when the run has them all, or
+// ErrRunNotFound.
+func (db *DB) EnrichRun(e RunEnrichment) ([]string, error) {
+	var spots, bases sql.NullInt64
+	var published, metadata sql.NullString
+	// published is read as text, as runs ingested without a date have an
+	// empty one rather than NULL
+	err := db.QueryRow(`
+		SELECT total_spots, total_bases, NULLIF(published, ''), metadata
+		FROM runs
+		WHERE run_accession = ?
+	`, e.RunAccession).Scan(&spots, &bases, &published, &metadata)
+	if err == sql.ErrNoRows {
+		return nil, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]interface{})
+	if metadata.String != "" {
+		if err := json.Unmarshal([]byte(metadata.String), &meta); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata of %s: %w", e.RunAccession, err)
+		}
+	}
+
+	var filled []string
+	if spots.Int64 == 0 && e.TotalSpots > 0 {
+		spots = sql.NullInt64{Int64: e.TotalSpots, Valid: true}
+		filled = append(filled, "total_spots")
+	}
+	if bases.Int64 == 0 && e.TotalBases > 0 {
+		bases = sql.NullInt64{Int64: e.TotalBases, Valid: true}
+		filled = append(filled, "total_bases")
+	}
+	if published.String == "" && e.Published != "" {
+		published = sql.NullString{String: e.Published, Valid: true}
+		filled = append(filled, "published")
+	}
+	if _, ok := meta["size_mb"]; !ok && e.SizeMB > 0 {
+		meta["size_mb"] = e.SizeMB
+		filled = append(filled, "size_mb")
+	}
+	if len(filled) == 0 {
+		return nil, nil
+	}
+
+	// Fields filled in by earlier enrichments stay listed
+	fields := filled
+	if previous, ok := meta["enrichment"].(map[string]interface{}); ok {
+		if listed, ok := previous["fields"].([]interface{}); ok {
+			fields = nil
+			for _, field := range listed {
+				if name, ok := field.(string); ok {
+					fields = append(fields, name)
+				}
+			}
+			fields = append(fields, filled...)
+		}
+	}
+	meta["enrichment"] = map[string]interface{}{
+		"source":      e.Source,
+		"fields":      fields,
+		"enriched_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+		UPDATE runs
+		SET total_spots = ?, total_bases = ?, published = ?, metadata = ?
+		WHERE run_accession = ?
+	`, spots, bases, published, string(data), e.RunAccession)
+	if err != nil {
+		return nil, err
+	}
+	return filled, nil
+}
+
+// RunsMissingStats returns up to limit runs, in accession order, without
+// a spot or base count
+func (db *DB) RunsMissingStats(limit int) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT run_accession
+		FROM runs
+		WHERE COALESCE(total_spots, 0) = 0 OR COALESCE(total_bases, 0) = 0
+		ORDER BY run_accession
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []string
+	for rows.Next() {
+		var run string
+		if err := rows.Scan(&run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
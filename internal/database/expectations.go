@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Expectation is a record a lab expects to go public, named by its
+// accession or by an alias, such as a sample name from a sample sheet.
+// Accession, RecordType and AppearedAt are set once an ingest brings in
+// the record.
+type Expectation struct {
+	Source     string     `json:"source"`
+	Expected   string     `json:"expected"`
+	Label      string     `json:"label,omitempty"`
+	ImportedAt time.Time  `json:"imported_at"`
+	Accession  string     `json:"accession,omitempty"`
+	RecordType string     `json:"record_type,omitempty"`
+	AppearedAt *time.Time `json:"appeared_at,omitempty"`
+}
+
+// ImportExpectations stores expected records from source in a single
+// transaction. An expectation imported before keeps whether and when its
+// record appeared, taking the new label. With replace, the expectations
+// imported before from source are deleted first. It returns how many
+// expectations were stored.
+func (db *DB) ImportExpectations(source string, expectations []Expectation, replace bool) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec(`DELETE FROM expectations WHERE source = ?`, source); err != nil {
+			return 0, err
+		}
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO expectations (source, expected, label, imported_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (source, expected) DO UPDATE SET
+			label = excluded.label,
+			imported_at = excluded.imported_at
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	var stored int64
+	for _, e := range expectations {
+		if _, err := stmt.Exec(source, e.Expected, e.Label, now); err != nil {
+			return 0, fmt.Errorf("failed to store expectation %s: %w", e.Expected, err)
+		}
+		stored++
+	}
+
+	return stored, tx.Commit()
+}
+
+// ReconcileExpectations looks for the records of the expectations that
+// have not appeared yet, and marks those it finds as appeared now. An
+// expectation names its record by accession, or by any identifier of the
+// record, such as its alias or BioSample accession; a sample is preferred
+// over the experiment, run or study that share an alias. It returns the
+// expectations that appeared.
+func (db *DB) ReconcileExpectations() ([]Expectation, error) {
+	pending, err := db.ListExpectations("", true)
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	find, err := tx.Prepare(`
+		SELECT accession, record_type FROM (
+			SELECT study_accession AS accession, 'study' AS record_type, 0 AS rank
+			FROM studies WHERE study_accession = ?1
+			UNION ALL
+			SELECT experiment_accession, 'experiment', 0
+			FROM experiments WHERE experiment_accession = ?1
+			UNION ALL
+			SELECT sample_accession, 'sample', 0
+			FROM samples WHERE sample_accession = ?1
+			UNION ALL
+			SELECT run_accession, 'run', 0
+			FROM runs WHERE run_accession = ?1
+			UNION ALL
+			SELECT record_accession, record_type, 1
+			FROM identifiers WHERE id_value = ?1
+		)
+		ORDER BY rank,
+			CASE record_type WHEN 'sample' THEN 0 WHEN 'experiment' THEN 1 WHEN 'run' THEN 2 ELSE 3 END,
+			accession
+		LIMIT 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer find.Close()
+
+	mark, err := tx.Prepare(`
+		UPDATE expectations SET accession = ?, record_type = ?, appeared_at = ?
+		WHERE source = ? AND expected = ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer mark.Close()
+
+	now := time.Now().UTC()
+	var appeared []Expectation
+	for _, e := range pending {
+		err := find.QueryRow(e.Expected).Scan(&e.Accession, &e.RecordType)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := mark.Exec(e.Accession, e.RecordType, now, e.Source, e.Expected); err != nil {
+			return nil, err
+		}
+		e.AppearedAt = &now
+		appeared = append(appeared, e)
+	}
+
+	return appeared, tx.Commit()
+}
+
+// ListExpectations returns the expectations imported from source, or from
+// every source when it is empty, ordered by source and expected name.
+// With pendingOnly, those whose records have appeared are left out.
+func (db *DB) ListExpectations(source string, pendingOnly bool) ([]Expectation, error) {
+	rows, err := db.Query(`
+		SELECT source, expected, COALESCE(label, ''), imported_at,
+			COALESCE(accession, ''), COALESCE(record_type, ''), appeared_at
+		FROM expectations
+		WHERE (?1 = '' OR source = ?1)
+			AND (NOT ?2 OR appeared_at IS NULL)
+		ORDER BY source, expected
+	`, source, pendingOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expectations []Expectation
+	for rows.Next() {
+		var e Expectation
+		var appearedAt sql.NullTime
+		if err := rows.Scan(&e.Source, &e.Expected, &e.Label, &e.ImportedAt,
+			&e.Accession, &e.RecordType, &appearedAt); err != nil {
+			return nil, err
+		}
+		if appearedAt.Valid {
+			e.AppearedAt = &appearedAt.Time
+		}
+		expectations = append(expectations, e)
+	}
+	return expectations, rows.Err()
+}
+
+// CountPendingExpectations returns how many expectations are waiting for
+// their records to appear
+func (db *DB) CountPendingExpectations() (int64, error) {
+	var n int64
+	err := db.QueryRow(`SELECT COUNT(*) FROM expectations WHERE appeared_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// DeleteExpectations deletes the expectations imported from source and
+// returns how many there were
+func (db *DB) DeleteExpectations(source string) (int64, error) {
+	result, err := db.Exec(`DELETE FROM expectations WHERE source = ?`, source)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
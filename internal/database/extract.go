@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// subsetRecords selects the accessions of every record copied into the
+// subset, for the tables keyed by accession
+const subsetRecords = `
+	SELECT study_accession FROM subset.studies
+	UNION ALL SELECT experiment_accession FROM subset.experiments
+	UNION ALL SELECT sample_accession FROM subset.samples
+	UNION ALL SELECT run_accession FROM subset.runs
+	UNION ALL SELECT analysis_accession FROM subset.analyses`
+
+// extractSteps copy a study subtree in order: each step may select rows
+// by those copied before it. Tables are aliased t.
+var extractSteps = []struct {
+	table string
+	where string
+}{
+	{"studies", `t.study_accession IN (SELECT accession FROM temp.extract_studies)`},
+	{"experiments", `t.study_accession IN (SELECT study_accession FROM subset.studies)`},
+	{"experiment_samples", `t.experiment_accession IN (SELECT experiment_accession FROM subset.experiments)`},
+	{"samples", `t.sample_accession IN (SELECT sample_accession FROM subset.experiment_samples)
+		OR t.experiment_accession IN (SELECT experiment_accession FROM subset.experiments)`},
+	{"runs", `t.experiment_accession IN (SELECT experiment_accession FROM subset.experiments)`},
+	{"analyses", `t.study_accession IN (SELECT study_accession FROM subset.studies)`},
+	{"sample_runs", `t.run_accession IN (SELECT run_accession FROM subset.runs)`},
+	{"sample_attributes", `t.sample_accession IN (SELECT sample_accession FROM subset.samples)`},
+	{"sample_pool", `t.parent_sample IN (SELECT sample_accession FROM subset.samples)`},
+	{"identifiers", `t.record_accession IN (` + subsetRecords + `)`},
+	{"links", `t.record_accession IN (` + subsetRecords + `)`},
+	{"curations", `t.accession IN (` + subsetRecords + `)`},
+	{"qc_flags", `t.accession IN (` + subsetRecords + `)`},
+	{"record_sources", `t.accession IN (` + subsetRecords + `)`},
+	{"ingests", `t.ingest_id IN (SELECT ingest_id FROM subset.record_sources)`},
+	{"record_access", `t.accession IN (` + subsetRecords + `)`},
+	{"raw_records", `t.accession IN (` + subsetRecords + `)`},
+	{"raw_blobs", `t.hash IN (SELECT hash FROM subset.raw_records)`},
+	// The lineage of each sample's taxon keeps taxonomy searches working
+	{"taxonomy", `EXISTS (SELECT 1 FROM main.taxonomy s
+		WHERE s.tax_id IN (SELECT taxon_id FROM subset.samples)
+		AND t.lft <= s.lft AND t.rgt >= s.rgt)`},
+}
+
+// ExtractSummary reports the rows copied by ExtractStudies
+type ExtractSummary struct {
+	Path    string         `json:"path"`
+	Studies int64          `json:"studies"` // studies extracted
+	Tables  []ExtractTable `json:"tables"`
+	Missing []string       `json:"missing,omitempty"` // studies not in the database
+}
+
+// ExtractTable is the number of rows copied from one table
+type ExtractTable struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+}
+
+// ExtractStudies copies the given studies, with their experiments,
+// samples, runs and analyses and the identifiers, links, attributes and
+// other rows of those records, into a new database at path. The copy is
+// self-contained: every record it references is in it. path must not
+// exist.
+func (db *DB) ExtractStudies(ctx context.Context, studies []string, path string) (*ExtractSummary, error) {
+	if len(studies) == 0 {
+		return nil, fmt.Errorf("no studies to extract")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+
+	// Create the schema, then fill it through a connection of our own,
+	// since attached databases and temporary tables belong to one
+	subset, err := Initialize(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	subset.Close()
+	summary, err := db.extractInto(ctx, studies, path)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	// Statistics and count sketches describe only the subset
+	subset, err = Initialize(path)
+	if err != nil {
+		return nil, err
+	}
+	defer subset.Close()
+	if err := subset.UpdateStatistics(); err != nil {
+		return nil, fmt.Errorf("failed to update statistics: %w", err)
+	}
+	if err := subset.RebuildSketches(); err != nil {
+		return nil, fmt.Errorf("failed to build count sketches: %w", err)
+	}
+	summary.Path = path
+	return summary, nil
+}
+
+func (db *DB) extractInto(ctx context.Context, studies []string, path string) (*ExtractSummary, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS subset", path); err != nil {
+		return nil, fmt.Errorf("failed to attach %s: %w", path, err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE subset")
+	if _, err := conn.ExecContext(ctx, "CREATE TEMP TABLE extract_studies (accession TEXT PRIMARY KEY)"); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), "DROP TABLE temp.extract_studies")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	summary := &ExtractSummary{}
+	for _, accession := range studies {
+		accession = strings.ToUpper(strings.TrimSpace(accession))
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO temp.extract_studies VALUES (?)", accession); err != nil {
+			return nil, err
+		}
+		var found int
+		err := tx.QueryRowContext(ctx, "SELECT 1 FROM studies WHERE study_accession = ?", accession).Scan(&found)
+		if err == sql.ErrNoRows {
+			summary.Missing = append(summary.Missing, accession)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(summary.Missing) == len(studies) {
+		return nil, fmt.Errorf("none of the studies are in the database")
+	}
+
+	for _, step := range extractSteps {
+		cols, err := sharedColumns(ctx, tx, "subset", step.table)
+		if err != nil {
+			return nil, err
+		}
+		list := "t." + strings.Join(cols, ", t.")
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT OR IGNORE INTO subset.%[1]s (%[2]s)
+			SELECT %[3]s FROM main.%[1]s t WHERE %[4]s`, step.table, strings.Join(cols, ", "), list, step.where))
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", step.table, err)
+		}
+		rows, _ := res.RowsAffected()
+		if step.table == "studies" {
+			summary.Studies = rows
+		}
+		summary.Tables = append(summary.Tables, ExtractTable{Table: step.table, Rows: rows})
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// sharedColumns returns the columns a table has in both the database and
+// an attached copy, which may have been created by different versions of
+// srake
+func sharedColumns(ctx context.Context, tx *sql.Tx, schema, table string) ([]string, error) {
+	src, err := tableColumns(ctx, tx, "main", table)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := tableColumns(ctx, tx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	for _, col := range src {
+		if slices.Contains(dst, col) {
+			shared = append(shared, col)
+		}
+	}
+	if len(shared) == 0 {
+		return nil, fmt.Errorf("table %s is missing", table)
+	}
+	return shared, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Feedback is a single relevance judgment of a record for a search query.
+type Feedback struct {
+	ID        int64     `json:"id"`
+	Query     string    `json:"query"`
+	Accession string    `json:"accession"`
+	Relevant  bool      `json:"relevant"`
+	Source    string    `json:"source,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NormalizeFeedbackQuery canonicalizes a query string so that judgments for
+// the same query typed with different case or spacing are grouped together.
+func NormalizeFeedbackQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// InsertFeedback records relevance judgments in a single transaction.
+func (db *DB) InsertFeedback(feedback []Feedback) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO search_feedback (query, accession, relevant, source, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for i := range feedback {
+		f := &feedback[i]
+		f.Query = NormalizeFeedbackQuery(f.Query)
+		if f.Query == "" || f.Accession == "" {
+			return fmt.Errorf("feedback requires a query and an accession")
+		}
+		if f.CreatedAt.IsZero() {
+			f.CreatedAt = now
+		}
+
+		result, err := stmt.Exec(f.Query, f.Accession, f.Relevant, f.Source, f.CreatedAt)
+		if err != nil {
+			return err
+		}
+		f.ID, _ = result.LastInsertId()
+	}
+
+	return tx.Commit()
+}
+
+// GetFeedback returns recorded judgments, newest first. An empty query returns
+// judgments for all queries; a non-positive limit returns all matches.
+func (db *DB) GetFeedback(query string, limit int) ([]Feedback, error) {
+	sqlQuery := `
+		SELECT id, query, accession, relevant, COALESCE(source, ''), created_at
+		FROM search_feedback
+	`
+	var args []interface{}
+	if query != "" {
+		sqlQuery += " WHERE query = ?"
+		args = append(args, NormalizeFeedbackQuery(query))
+	}
+	sqlQuery += " ORDER BY created_at DESC, id DESC"
+	if limit > 0 {
+		sqlQuery += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feedback []Feedback
+	for rows.Next() {
+		var f Feedback
+		if err := rows.Scan(&f.ID, &f.Query, &f.Accession, &f.Relevant, &f.Source, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		feedback = append(feedback, f)
+	}
+
+	return feedback, rows.Err()
+}
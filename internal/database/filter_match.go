@@ -0,0 +1,173 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RecordFilter selects ingested records by the same criteria ingest filters
+// apply to archives. Empty fields do not restrict the match.
+type RecordFilter struct {
+	TaxonIDs        []int
+	ExcludeTaxonIDs []int
+
+	// DateFrom and DateTo are inclusive YYYY-MM-DD dates compared against
+	// DateColumn ("submission" for studies, "published" for runs)
+	DateFrom   string
+	DateTo     string
+	DateColumn string
+
+	Organisms        []string
+	ExcludeOrganisms []string
+	Platforms        []string
+	Strategies       []string
+	StudyTypes       []string
+	InstrumentModels []string
+	Centers          []string
+
+	MinReads int64
+	MaxReads int64
+	MinBases int64
+	MaxBases int64
+}
+
+// FilterMatch is one study/experiment/sample/run combination matching a
+// RecordFilter. Sample and run accessions are empty when the experiment has
+// no linked samples or runs.
+type FilterMatch struct {
+	StudyAccession      string
+	ExperimentAccession string
+	SampleAccession     string
+	RunAccession        string
+}
+
+// filterDateColumns maps date fields to the columns they are compared against.
+var filterDateColumns = map[string]string{
+	"":           "s.submission_date",
+	"submission": "s.submission_date",
+	"published":  "r.published",
+}
+
+// where builds the WHERE clause of a filter match query.
+func (f RecordFilter) where() (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	in := func(column string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", column, placeholders(len(values))))
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	notIn := func(column string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s IS NULL OR %s NOT IN (%s))", column, column, placeholders(len(values))))
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	atLeast := func(column string, limit int64) {
+		if limit > 0 {
+			conditions = append(conditions, fmt.Sprintf("(COALESCE(%s, 0) = 0 OR %s >= ?)", column, column))
+			args = append(args, limit)
+		}
+	}
+	atMost := func(column string, limit int64) {
+		if limit > 0 {
+			conditions = append(conditions, fmt.Sprintf("(COALESCE(%s, 0) = 0 OR %s <= ?)", column, column))
+			args = append(args, limit)
+		}
+	}
+
+	if len(f.TaxonIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("sa.taxon_id IN (%s)", placeholders(len(f.TaxonIDs))))
+		for _, id := range f.TaxonIDs {
+			args = append(args, id)
+		}
+	}
+	if len(f.ExcludeTaxonIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("(sa.taxon_id IS NULL OR sa.taxon_id NOT IN (%s))", placeholders(len(f.ExcludeTaxonIDs))))
+		for _, id := range f.ExcludeTaxonIDs {
+			args = append(args, id)
+		}
+	}
+
+	if f.DateFrom != "" || f.DateTo != "" {
+		column, ok := filterDateColumns[f.DateColumn]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported date field for ingested records: %s", f.DateColumn)
+		}
+		if f.DateFrom != "" {
+			conditions = append(conditions, fmt.Sprintf("substr(%s, 1, 10) >= ?", column))
+			args = append(args, f.DateFrom)
+		}
+		if f.DateTo != "" {
+			conditions = append(conditions, fmt.Sprintf("substr(%s, 1, 10) <= ?", column))
+			args = append(args, f.DateTo)
+		}
+	}
+
+	in("sa.scientific_name", f.Organisms)
+	notIn("sa.scientific_name", f.ExcludeOrganisms)
+	in("e.platform", f.Platforms)
+	in("e.library_strategy", f.Strategies)
+	in("s.study_type", f.StudyTypes)
+	in("e.instrument_model", f.InstrumentModels)
+	in("json_extract(s.metadata, '$.center_name')", f.Centers)
+
+	// Runs without statistics (stored as 0) are kept, as they are during ingest
+	atLeast("r.total_spots", f.MinReads)
+	atMost("r.total_spots", f.MaxReads)
+	atLeast("r.total_bases", f.MinBases)
+	atMost("r.total_bases", f.MaxBases)
+
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// StreamFilterMatches calls fn for every record combination matching the
+// filter, in study accession order, without loading the result set into
+// memory. Returning an error from fn stops the scan.
+func (db *DB) StreamFilterMatches(f RecordFilter, fn func(*FilterMatch) error) error {
+	where, args, err := f.where()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT s.study_accession, e.experiment_accession,
+			COALESCE(sa.sample_accession, ''), COALESCE(r.run_accession, '')
+		FROM studies s
+		JOIN experiments e ON e.study_accession = s.study_accession
+		LEFT JOIN experiment_samples es ON es.experiment_accession = e.experiment_accession
+		LEFT JOIN samples sa ON sa.sample_accession = es.sample_accession
+		LEFT JOIN runs r ON r.experiment_accession = e.experiment_accession`+where+`
+		ORDER BY s.study_accession, e.experiment_accession`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate filters: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m FilterMatch
+		if err := rows.Scan(&m.StudyAccession, &m.ExperimentAccession, &m.SampleAccession, &m.RunAccession); err != nil {
+			return err
+		}
+		if err := fn(&m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// placeholders returns n comma-separated SQL parameter placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
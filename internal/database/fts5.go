@@ -5,8 +5,13 @@ import (
 	"log"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+// trigramMinLength is the shortest fragment the trigram tokenizer can match.
+// Shorter fragments fall back to a LIKE scan.
+const trigramMinLength = 3
+
 // FTS5Manager manages SQLite FTS5 tables for fast text search
 type FTS5Manager struct {
 	db *DB
@@ -135,92 +140,193 @@ func (f *FTS5Manager) createAccessionTable() error {
 	return nil
 }
 
-// createSampleFTSTable creates an FTS5 table for sample search
+// createSampleFTSTable creates an FTS5 table for sample search, keyed by
+// the rowid of each sample
 func (f *FTS5Manager) createSampleFTSTable() error {
-	// Drop existing table if it exists
-	_, err := f.db.DB.Exec(`DROP TABLE IF EXISTS fts_samples`)
-	if err != nil {
-		return err
-	}
-
-	// Create FTS5 table for samples
-	query := `
+	return f.rebuildFTSTable("fts_samples", ftsSampleTriggers, `
 		CREATE VIRTUAL TABLE fts_samples USING fts5(
-			sample_accession UNINDEXED,
-			description,
+			sample_accession,
 			organism,
 			scientific_name,
 			tissue,
-			tokenize='porter'
+			cell_type,
+			description,
+			tokenize='porter unicode61'
 		)
-	`
-	_, err = f.db.DB.Exec(query)
-	if err != nil {
-		return err
-	}
-
-	// Populate with sample data (batch insert for performance)
-	log.Println("[FTS5] Populating sample FTS table...")
-	query = `
-		INSERT INTO fts_samples
+	`, `
+		INSERT INTO fts_samples (rowid, sample_accession, organism, scientific_name, tissue, cell_type, description)
 		SELECT
+			rowid,
 			sample_accession,
-			COALESCE(description, ''),
 			COALESCE(organism, ''),
 			COALESCE(scientific_name, ''),
-			COALESCE(tissue, '')
+			COALESCE(tissue, ''),
+			COALESCE(cell_type, ''),
+			COALESCE(description, '')
 		FROM samples
-		LIMIT 1000000
-	`
-	_, err = f.db.DB.Exec(query)
-	if err != nil {
-		return fmt.Errorf("failed to populate sample FTS: %w", err)
-	}
-
-	return nil
+	`)
 }
 
-// createRunFTSTable creates an FTS5 table for run search
+// createRunFTSTable creates an FTS5 table for run search, keyed by the rowid
+// of each run. Runs carry no text of their own, so they are indexed by the
+// title and library of their experiment.
 func (f *FTS5Manager) createRunFTSTable() error {
-	// Drop existing table if it exists
-	_, err := f.db.DB.Exec(`DROP TABLE IF EXISTS fts_runs`)
+	return f.rebuildFTSTable("fts_runs", ftsRunTriggers, `
+		CREATE VIRTUAL TABLE fts_runs USING fts5(
+			run_accession,
+			experiment_accession,
+			title,
+			library_strategy,
+			platform,
+			instrument_model,
+			tokenize='porter unicode61'
+		)
+	`, `
+		INSERT INTO fts_runs (rowid, run_accession, experiment_accession, title, library_strategy, platform, instrument_model)
+		SELECT
+			r.rowid,
+			r.run_accession,
+			COALESCE(r.experiment_accession, ''),
+			COALESCE(e.title, ''),
+			COALESCE(e.library_strategy, ''),
+			COALESCE(e.platform, ''),
+			COALESCE(e.instrument_model, '')
+		FROM runs r
+		LEFT JOIN experiments e ON e.experiment_accession = r.experiment_accession
+	`)
+}
+
+// rebuildFTSTable drops and recreates an FTS5 table and the triggers that
+// keep it current, in one transaction
+func (f *FTS5Manager) rebuildFTSTable(table string, triggers []ftsTrigger, create, populate string) error {
+	tx, err := f.db.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// Create FTS5 table for runs
-	query := `
-		CREATE VIRTUAL TABLE fts_runs USING fts5(
-			run_accession UNINDEXED,
-			experiment_accession UNINDEXED,
-			total_spots,
-			total_bases,
-			tokenize='porter'
-		)
-	`
-	_, err = f.db.DB.Exec(query)
-	if err != nil {
+	// The triggers go first, as they would fail once the table is gone
+	for _, trigger := range triggers {
+		// #nosec G201 - trigger names are from a fixed list, not user input
+		if _, err := tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s", trigger.name)); err != nil {
+			return err
+		}
+	}
+	// #nosec G201 - table names are from a fixed list, not user input
+	if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(create); err != nil {
 		return err
 	}
 
-	// Populate with run data (batch insert for performance)
-	log.Println("[FTS5] Populating run FTS table...")
-	query = `
-		INSERT INTO fts_runs
-		SELECT
-			run_accession,
-			experiment_accession,
-			CAST(total_spots AS TEXT),
-			CAST(total_bases AS TEXT)
-		FROM runs
-		LIMIT 1000000
-	`
-	_, err = f.db.DB.Exec(query)
-	if err != nil {
-		return fmt.Errorf("failed to populate run FTS: %w", err)
+	log.Printf("[FTS5] Populating %s...", table)
+	if _, err := tx.Exec(populate); err != nil {
+		return fmt.Errorf("failed to populate %s: %w", table, err)
 	}
 
-	return nil
+	for _, trigger := range triggers {
+		if _, err := tx.Exec(trigger.sql); err != nil {
+			return fmt.Errorf("failed to create trigger %s: %w", trigger.name, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ftsTrigger is a trigger keeping an FTS5 table in step with its records
+type ftsTrigger struct {
+	name string
+	sql  string
+}
+
+// ftsSampleTriggers keep fts_samples current as samples are ingested. The
+// rows replaced by INSERT OR REPLACE fire no delete trigger, so their
+// entries are removed before each insert.
+var ftsSampleTriggers = []ftsTrigger{
+	{"fts_samples_before_insert", `
+		CREATE TRIGGER fts_samples_before_insert BEFORE INSERT ON samples BEGIN
+			DELETE FROM fts_samples WHERE rowid = (SELECT rowid FROM samples WHERE sample_accession = new.sample_accession);
+		END`},
+	{"fts_samples_after_insert", `
+		CREATE TRIGGER fts_samples_after_insert AFTER INSERT ON samples BEGIN
+			INSERT INTO fts_samples (rowid, sample_accession, organism, scientific_name, tissue, cell_type, description)
+			VALUES (new.rowid, new.sample_accession, COALESCE(new.organism, ''), COALESCE(new.scientific_name, ''),
+				COALESCE(new.tissue, ''), COALESCE(new.cell_type, ''), COALESCE(new.description, ''));
+		END`},
+	{"fts_samples_after_update", `
+		CREATE TRIGGER fts_samples_after_update AFTER UPDATE ON samples BEGIN
+			DELETE FROM fts_samples WHERE rowid = old.rowid;
+			INSERT INTO fts_samples (rowid, sample_accession, organism, scientific_name, tissue, cell_type, description)
+			VALUES (new.rowid, new.sample_accession, COALESCE(new.organism, ''), COALESCE(new.scientific_name, ''),
+				COALESCE(new.tissue, ''), COALESCE(new.cell_type, ''), COALESCE(new.description, ''));
+		END`},
+	{"fts_samples_after_delete", `
+		CREATE TRIGGER fts_samples_after_delete AFTER DELETE ON samples BEGIN
+			DELETE FROM fts_samples WHERE rowid = old.rowid;
+		END`},
+}
+
+// ftsRunColumns selects the fts_runs values of the run r
+const ftsRunColumns = `
+	r.rowid, r.run_accession, COALESCE(r.experiment_accession, ''),
+	COALESCE(e.title, ''), COALESCE(e.library_strategy, ''),
+	COALESCE(e.platform, ''), COALESCE(e.instrument_model, '')`
+
+// ftsRunTriggers keep fts_runs current as runs and their experiments are
+// ingested, in either order
+var ftsRunTriggers = []ftsTrigger{
+	{"fts_runs_before_insert", `
+		CREATE TRIGGER fts_runs_before_insert BEFORE INSERT ON runs BEGIN
+			DELETE FROM fts_runs WHERE rowid = (SELECT rowid FROM runs WHERE run_accession = new.run_accession);
+		END`},
+	{"fts_runs_after_insert", `
+		CREATE TRIGGER fts_runs_after_insert AFTER INSERT ON runs BEGIN
+			INSERT INTO fts_runs (rowid, run_accession, experiment_accession, title, library_strategy, platform, instrument_model)
+			SELECT` + ftsRunColumns + `
+			FROM runs r LEFT JOIN experiments e ON e.experiment_accession = r.experiment_accession
+			WHERE r.rowid = new.rowid;
+		END`},
+	{"fts_runs_after_update", `
+		CREATE TRIGGER fts_runs_after_update AFTER UPDATE ON runs BEGIN
+			DELETE FROM fts_runs WHERE rowid = old.rowid;
+			INSERT INTO fts_runs (rowid, run_accession, experiment_accession, title, library_strategy, platform, instrument_model)
+			SELECT` + ftsRunColumns + `
+			FROM runs r LEFT JOIN experiments e ON e.experiment_accession = r.experiment_accession
+			WHERE r.rowid = new.rowid;
+		END`},
+	{"fts_runs_after_delete", `
+		CREATE TRIGGER fts_runs_after_delete AFTER DELETE ON runs BEGIN
+			DELETE FROM fts_runs WHERE rowid = old.rowid;
+		END`},
+	{"fts_runs_after_experiment_insert", `
+		CREATE TRIGGER fts_runs_after_experiment_insert AFTER INSERT ON experiments BEGIN
+			DELETE FROM fts_runs WHERE rowid IN (SELECT rowid FROM runs WHERE experiment_accession = new.experiment_accession);
+			INSERT INTO fts_runs (rowid, run_accession, experiment_accession, title, library_strategy, platform, instrument_model)
+			SELECT` + ftsRunColumns + `
+			FROM runs r JOIN experiments e ON e.experiment_accession = r.experiment_accession
+			WHERE r.experiment_accession = new.experiment_accession;
+		END`},
+	{"fts_runs_after_experiment_update", `
+		CREATE TRIGGER fts_runs_after_experiment_update AFTER UPDATE ON experiments BEGIN
+			DELETE FROM fts_runs WHERE rowid IN (SELECT rowid FROM runs WHERE experiment_accession = new.experiment_accession);
+			INSERT INTO fts_runs (rowid, run_accession, experiment_accession, title, library_strategy, platform, instrument_model)
+			SELECT` + ftsRunColumns + `
+			FROM runs r JOIN experiments e ON e.experiment_accession = r.experiment_accession
+			WHERE r.experiment_accession = new.experiment_accession;
+		END`},
+}
+
+// HasFTSTables reports whether the sample and run FTS5 tables have been
+// built. Tables from older builds, which were not kept current, do not
+// count.
+func (f *FTS5Manager) HasFTSTables() bool {
+	var count int
+	err := f.db.DB.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'trigger' AND name IN ('fts_samples_after_insert', 'fts_runs_after_insert')
+	`).Scan(&count)
+	return err == nil && count == 2
 }
 
 // SearchAccessions searches for accessions using FTS5
@@ -237,7 +343,7 @@ func (f *FTS5Manager) SearchAccessions(query string, limit int) ([]AccessionResu
 			bm25(fts_accessions) as score
 		FROM fts_accessions
 		WHERE fts_accessions MATCH ?
-		ORDER BY score
+		ORDER BY score, accession
 		LIMIT ?
 	`
 
@@ -260,22 +366,66 @@ func (f *FTS5Manager) SearchAccessions(query string, limit int) ([]AccessionResu
 	return results, nil
 }
 
-// SearchSamples searches samples using FTS5
+// Markers around the matched terms of snippets, as used by Bleve's
+// highlighter
+const (
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// ftsSnippetTokens is the most tokens in a snippet of a long text column
+const ftsSnippetTokens = 16
+
+// ftsSnippets returns the snippet() expressions for columns of an FTS5
+// table, given by name in column order
+func ftsSnippets(table string, columns []string, from int) string {
+	exprs := make([]string, 0, len(columns)-from)
+	for i := from; i < len(columns); i++ {
+		exprs = append(exprs, fmt.Sprintf("snippet(%s, %d, '%s', '%s', '…', %d)",
+			table, i, HighlightStart, HighlightEnd, ftsSnippetTokens))
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// matchedSnippets keeps the snippets that contain a match, by column name
+func matchedSnippets(columns []string, snippets []string) map[string]string {
+	matched := make(map[string]string)
+	for i, snippet := range snippets {
+		if strings.Contains(snippet, HighlightStart) {
+			matched[columns[i]] = snippet
+		}
+	}
+	return matched
+}
+
+var ftsSampleColumns = []string{"sample_accession", "organism", "scientific_name", "tissue", "cell_type", "description"}
+
+// SearchSamples searches samples using FTS5. Every term of the query must
+// match; Snippets highlights the matches of each matching text column.
 func (f *FTS5Manager) SearchSamples(query string, limit int) ([]SampleResult, error) {
-	ftsQuery := escapeFTSQuery(query)
+	ftsQuery := ftsTermsQuery(query)
+	if ftsQuery == "" {
+		return nil, nil
+	}
 
-	sqlQuery := `
+	// #nosec G201 - snippet expressions are built from fixed column lists
+	sqlQuery := fmt.Sprintf(`
 		SELECT
-			sample_accession,
-			description,
-			organism,
-			scientific_name,
+			fts_samples.sample_accession,
+			COALESCE(s.experiment_accession, ''),
+			fts_samples.organism,
+			fts_samples.scientific_name,
+			fts_samples.tissue,
+			fts_samples.cell_type,
+			fts_samples.description,
+			%s,
 			bm25(fts_samples) as score
 		FROM fts_samples
+		JOIN samples s ON s.rowid = fts_samples.rowid
 		WHERE fts_samples MATCH ?
-		ORDER BY score
+		ORDER BY score, fts_samples.sample_accession
 		LIMIT ?
-	`
+	`, ftsSnippets("fts_samples", ftsSampleColumns, 1))
 
 	rows, err := f.db.DB.Query(sqlQuery, ftsQuery, limit)
 	if err != nil {
@@ -286,32 +436,49 @@ func (f *FTS5Manager) SearchSamples(query string, limit int) ([]SampleResult, er
 	var results []SampleResult
 	for rows.Next() {
 		var r SampleResult
-		err := rows.Scan(&r.SampleAccession, &r.Description, &r.Organism, &r.ScientificName, &r.Score)
+		snippets := make([]string, len(ftsSampleColumns)-1)
+		err := rows.Scan(&r.SampleAccession, &r.ExperimentAccession, &r.Organism, &r.ScientificName,
+			&r.Tissue, &r.CellType, &r.Description,
+			&snippets[0], &snippets[1], &snippets[2], &snippets[3], &snippets[4], &r.Score)
 		if err != nil {
 			return nil, err
 		}
+		r.Snippets = matchedSnippets(ftsSampleColumns[1:], snippets)
 		results = append(results, r)
 	}
 
-	return results, nil
+	return results, rows.Err()
 }
 
-// SearchRuns searches runs using FTS5
+var ftsRunColumnNames = []string{"run_accession", "experiment_accession", "title", "library_strategy", "platform", "instrument_model"}
+
+// SearchRuns searches runs using FTS5, by their own accessions and the
+// text of their experiments. Every term of the query must match.
 func (f *FTS5Manager) SearchRuns(query string, limit int) ([]RunResult, error) {
-	ftsQuery := escapeFTSQuery(query)
+	ftsQuery := ftsTermsQuery(query)
+	if ftsQuery == "" {
+		return nil, nil
+	}
 
-	sqlQuery := `
+	// #nosec G201 - snippet expressions are built from fixed column lists
+	sqlQuery := fmt.Sprintf(`
 		SELECT
-			run_accession,
-			experiment_accession,
-			total_spots,
-			total_bases,
+			fts_runs.run_accession,
+			fts_runs.experiment_accession,
+			fts_runs.title,
+			fts_runs.library_strategy,
+			fts_runs.platform,
+			fts_runs.instrument_model,
+			COALESCE(r.total_spots, 0),
+			COALESCE(r.total_bases, 0),
+			%s,
 			bm25(fts_runs) as score
 		FROM fts_runs
+		JOIN runs r ON r.rowid = fts_runs.rowid
 		WHERE fts_runs MATCH ?
-		ORDER BY score
+		ORDER BY score, fts_runs.run_accession
 		LIMIT ?
-	`
+	`, ftsSnippets("fts_runs", ftsRunColumnNames, 2))
 
 	rows, err := f.db.DB.Query(sqlQuery, ftsQuery, limit)
 	if err != nil {
@@ -322,14 +489,212 @@ func (f *FTS5Manager) SearchRuns(query string, limit int) ([]RunResult, error) {
 	var results []RunResult
 	for rows.Next() {
 		var r RunResult
-		err := rows.Scan(&r.RunAccession, &r.ExperimentAccession, &r.TotalSpots, &r.TotalBases, &r.Score)
+		snippets := make([]string, len(ftsRunColumnNames)-2)
+		err := rows.Scan(&r.RunAccession, &r.ExperimentAccession, &r.Title, &r.LibraryStrategy,
+			&r.Platform, &r.InstrumentModel, &r.TotalSpots, &r.TotalBases,
+			&snippets[0], &snippets[1], &snippets[2], &snippets[3], &r.Score)
 		if err != nil {
 			return nil, err
 		}
+		r.Snippets = matchedSnippets(ftsRunColumnNames[2:], snippets)
 		results = append(results, r)
 	}
 
-	return results, nil
+	return results, rows.Err()
+}
+
+// CreateTrigramTable builds the optional trigram index over accessions and
+// aliases used for partial accession lookups, with the triggers that keep
+// it current as records are ingested and deleted. It returns the number of
+// indexed records.
+func (f *FTS5Manager) CreateTrigramTable() (int64, error) {
+	log.Println("[FTS5] Creating trigram accession index")
+	start := time.Now()
+
+	var populate []string
+	for i, source := range trigramSources {
+		populate = append(populate, fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+			source.row("", i), source.table, source.condition("")))
+	}
+	err := f.rebuildFTSTable("fts_accession_trigram", trigramTriggers(), `
+		CREATE VIRTUAL TABLE fts_accession_trigram USING fts5(
+			accession,
+			type UNINDEXED,
+			alias,
+			tokenize='trigram'
+		)
+	`, `
+		INSERT INTO fts_accession_trigram (rowid, accession, type, alias)
+		`+strings.Join(populate, "\n\t\tUNION ALL\n\t\t"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create trigram table (SQLite 3.34+ required): %w", err)
+	}
+
+	var count int64
+	if err := f.db.DB.QueryRow(`SELECT COUNT(*) FROM fts_accession_trigram`).Scan(&count); err != nil {
+		return 0, err
+	}
+	log.Printf("[FTS5] Trigram index with %d records created in %v", count, time.Since(start))
+	return count, nil
+}
+
+// trigramSource is a table whose rows are entered in the trigram accession
+// index. The rowid of an entry is the rowid of its row times the number of
+// sources plus the position of its source, so that triggers can find it
+// again.
+type trigramSource struct {
+	table  string
+	key    []string // columns identifying a row
+	values string   // accession, type and alias of a row, {r} standing for the row
+	where  string   // rows that are entered, {r} standing for the row
+}
+
+var trigramSources = []trigramSource{
+	{"studies", []string{"study_accession"}, "{r}study_accession, 'study', ''", ""},
+	{"experiments", []string{"experiment_accession"}, "{r}experiment_accession, 'experiment', ''", ""},
+	{"samples", []string{"sample_accession"}, "{r}sample_accession, 'sample', ''", ""},
+	{"runs", []string{"run_accession"}, "{r}run_accession, 'run', ''", ""},
+	{"submissions", []string{"submission_accession"}, "{r}submission_accession, 'submission', COALESCE({r}alias, '')", ""},
+	{"analyses", []string{"analysis_accession"}, "{r}analysis_accession, 'analysis', COALESCE({r}alias, '')", ""},
+	{"identifiers", []string{"record_type", "record_accession", "id_type", "id_value"},
+		"{r}record_accession, {r}record_type, {r}id_value", "{r}id_type = '" + IDTypeAlias + "'"},
+}
+
+// row selects the entry of the row r, "new." or "old." in a trigger, of
+// the source at position i
+func (s trigramSource) row(r string, i int) string {
+	return fmt.Sprintf("%srowid * %d + %d, %s", r, len(trigramSources), i, strings.ReplaceAll(s.values, "{r}", r))
+}
+
+func (s trigramSource) condition(r string) string {
+	if s.where == "" {
+		return "1"
+	}
+	return strings.ReplaceAll(s.where, "{r}", r)
+}
+
+// trigramTriggers keep fts_accession_trigram current. The rows replaced by
+// INSERT OR REPLACE fire no delete trigger, so their entries are removed
+// before each insert.
+func trigramTriggers() []ftsTrigger {
+	var triggers []ftsTrigger
+	for i, source := range trigramSources {
+		var key []string
+		for _, column := range source.key {
+			key = append(key, fmt.Sprintf("%[1]s = new.%[1]s", column))
+		}
+		insert := fmt.Sprintf(`INSERT INTO fts_accession_trigram (rowid, accession, type, alias)
+			SELECT %s WHERE %s;`, source.row("new.", i), source.condition("new."))
+		remove := fmt.Sprintf(`DELETE FROM fts_accession_trigram WHERE rowid = old.rowid * %d + %d;`, len(trigramSources), i)
+
+		name := "fts_trigram_" + source.table
+		triggers = append(triggers,
+			ftsTrigger{name + "_before_insert", fmt.Sprintf(`
+		CREATE TRIGGER %s_before_insert BEFORE INSERT ON %s BEGIN
+			DELETE FROM fts_accession_trigram WHERE rowid = (SELECT rowid FROM %s WHERE %s) * %d + %d;
+		END`, name, source.table, source.table, strings.Join(key, " AND "), len(trigramSources), i)},
+			ftsTrigger{name + "_after_insert", fmt.Sprintf(`
+		CREATE TRIGGER %s_after_insert AFTER INSERT ON %s BEGIN
+			%s
+		END`, name, source.table, insert)},
+			ftsTrigger{name + "_after_update", fmt.Sprintf(`
+		CREATE TRIGGER %s_after_update AFTER UPDATE ON %s BEGIN
+			%s
+			%s
+		END`, name, source.table, remove, insert)},
+			ftsTrigger{name + "_after_delete", fmt.Sprintf(`
+		CREATE TRIGGER %s_after_delete AFTER DELETE ON %s BEGIN
+			%s
+		END`, name, source.table, remove)},
+		)
+	}
+	return triggers
+}
+
+// HasTrigramTable reports whether the trigram accession index has been
+// built. Tables from older builds, which were not kept current, do not
+// count.
+func (f *FTS5Manager) HasTrigramTable() bool {
+	var name string
+	err := f.db.DB.QueryRow(
+		`SELECT name FROM sqlite_master WHERE type = 'trigger' AND name = 'fts_trigram_studies_after_insert'`,
+	).Scan(&name)
+	return err == nil
+}
+
+// SearchPartialAccessions finds records whose accession or alias contains
+// the given fragment. It uses the trigram index when available and falls
+// back to scanning the record tables otherwise. Each record is reported
+// once; shorter accessions sort first since they are the closest matches.
+func (f *FTS5Manager) SearchPartialAccessions(fragment string, limit int) ([]PartialMatch, error) {
+	fragment = strings.TrimSpace(fragment)
+	if fragment == "" {
+		return nil, fmt.Errorf("empty accession fragment")
+	}
+
+	var query string
+	var args []interface{}
+	if utf8.RuneCountInString(fragment) >= trigramMinLength && f.HasTrigramTable() {
+		query = `
+			SELECT accession, type, MAX(alias)
+			FROM fts_accession_trigram
+			WHERE fts_accession_trigram MATCH ?
+			GROUP BY accession, type
+			ORDER BY length(accession), accession
+			LIMIT ?
+		`
+		args = []interface{}{`"` + strings.ReplaceAll(fragment, `"`, `""`) + `"`, limit}
+	} else {
+		pattern := "%" + escapeLikePattern(fragment) + "%"
+		query = `
+			SELECT accession, type, MAX(alias) FROM (
+				SELECT study_accession AS accession, 'study' AS type, '' AS alias
+				FROM studies WHERE study_accession LIKE ? ESCAPE '\'
+				UNION ALL
+				SELECT experiment_accession, 'experiment', ''
+				FROM experiments WHERE experiment_accession LIKE ? ESCAPE '\'
+				UNION ALL
+				SELECT sample_accession, 'sample', ''
+				FROM samples WHERE sample_accession LIKE ? ESCAPE '\'
+				UNION ALL
+				SELECT run_accession, 'run', ''
+				FROM runs WHERE run_accession LIKE ? ESCAPE '\'
+				UNION ALL
+				SELECT submission_accession, 'submission', COALESCE(alias, '')
+				FROM submissions WHERE submission_accession LIKE ? ESCAPE '\' OR alias LIKE ? ESCAPE '\'
+				UNION ALL
+				SELECT analysis_accession, 'analysis', COALESCE(alias, '')
+				FROM analyses WHERE analysis_accession LIKE ? ESCAPE '\' OR alias LIKE ? ESCAPE '\'
+				UNION ALL
+				SELECT record_accession, record_type, id_value
+				FROM identifiers WHERE id_type = 'alias' AND id_value LIKE ? ESCAPE '\'
+			)
+			GROUP BY accession, type
+			ORDER BY length(accession), accession
+			LIMIT ?
+		`
+		for i := 0; i < 9; i++ {
+			args = append(args, pattern)
+		}
+		args = append(args, limit)
+	}
+
+	rows, err := f.db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("partial accession search failed: %w", err)
+	}
+	defer rows.Close()
+
+	var results []PartialMatch
+	for rows.Next() {
+		var m PartialMatch
+		if err := rows.Scan(&m.Accession, &m.Type, &m.Alias); err != nil {
+			return nil, err
+		}
+		results = append(results, m)
+	}
+
+	return results, rows.Err()
 }
 
 // OptimizeFTSTables optimizes FTS5 tables for better performance
@@ -354,7 +719,7 @@ func (f *FTS5Manager) GetFTSStats() (map[string]int64, error) {
 	stats := make(map[string]int64)
 
 	// Get row counts for each FTS table
-	tables := []string{"fts_accessions", "fts_samples", "fts_runs"}
+	tables := []string{"fts_accessions", "fts_samples", "fts_runs", "fts_accession_trigram"}
 	for _, table := range tables {
 		var count int64
 		// #nosec G201 - table names are from a fixed list, not user input
@@ -389,6 +754,31 @@ func escapeFTSQuery(query string) string {
 	return result
 }
 
+// ftsTermsQuery quotes each term of a query as an FTS5 string, so that
+// every term must match and FTS5 operators are taken literally
+func ftsTermsQuery(query string) string {
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
+
+// escapeLikePattern escapes LIKE wildcards so the pattern matches literally
+// when used with ESCAPE '\'.
+func escapeLikePattern(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	return strings.ReplaceAll(s, "_", `\_`)
+}
+
+// PartialMatch is a record found by a partial accession or alias lookup.
+type PartialMatch struct {
+	Accession string `json:"accession"`
+	Type      string `json:"type"`
+	Alias     string `json:"alias,omitempty"`
+}
+
 // AccessionResult holds a single accession match from an FTS5 search, including its BM25 relevance score.
 type AccessionResult struct {
 	Accession string
@@ -400,18 +790,27 @@ type AccessionResult struct {
 
 // SampleResult holds a single sample match from an FTS5 search, including its BM25 relevance score.
 type SampleResult struct {
-	SampleAccession string
-	Description     string
-	Organism        string
-	ScientificName  string
-	Score           float64
+	SampleAccession     string
+	ExperimentAccession string
+	Organism            string
+	ScientificName      string
+	Tissue              string
+	CellType            string
+	Description         string
+	Snippets            map[string]string // highlighted matches by column
+	Score               float64
 }
 
 // RunResult holds a single run match from an FTS5 search, including its BM25 relevance score.
 type RunResult struct {
 	RunAccession        string
 	ExperimentAccession string
-	TotalSpots          string
-	TotalBases          string
+	Title               string
+	LibraryStrategy     string
+	Platform            string
+	InstrumentModel     string
+	TotalSpots          int64
+	TotalBases          int64
+	Snippets            map[string]string // highlighted matches by column
 	Score               float64
 }
@@ -0,0 +1,245 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// harvestDatestamp is the day a study last changed locally: its curation
+// time if curated, otherwise its submission date.
+const harvestDatestamp = `substr(COALESCE(c.updated_at, s.submission_date, '1970-01-01'), 1, 10)`
+
+// HarvestQuery selects studies for metadata harvesting.
+type HarvestQuery struct {
+	// From and Until are inclusive YYYY-MM-DD datestamps
+	From  string
+	Until string
+
+	// Collection restricts results to studies in a collection
+	Collection string
+
+	// CuratedOnly restricts results to studies with a curation overlay
+	CuratedOnly bool
+
+	Offset int
+	Limit  int
+}
+
+// HarvestRecord is a study header for metadata harvesting.
+type HarvestRecord struct {
+	Accession   string
+	Datestamp   string
+	Curated     bool
+	Collections []string
+}
+
+// HarvestSummary describes the records beneath a harvested study.
+type HarvestSummary struct {
+	Experiments []*Experiment
+	Organisms   []string
+	SampleCount int
+	RunCount    int
+}
+
+// where builds the FROM and WHERE clauses shared by harvest queries.
+func (q HarvestQuery) where() (string, []interface{}) {
+	clause := `FROM studies s LEFT JOIN curations c ON c.accession = s.study_accession`
+	var conditions []string
+	var args []interface{}
+
+	if q.Collection != "" {
+		clause += ` JOIN collection_members m ON m.accession = s.study_accession AND m.collection_name = ?`
+		args = append(args, q.Collection)
+	}
+	if q.CuratedOnly {
+		conditions = append(conditions, "c.accession IS NOT NULL")
+	}
+	if q.From != "" {
+		conditions = append(conditions, harvestDatestamp+" >= ?")
+		args = append(args, q.From)
+	}
+	if q.Until != "" {
+		conditions = append(conditions, harvestDatestamp+" <= ?")
+		args = append(args, q.Until)
+	}
+
+	if len(conditions) > 0 {
+		clause += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return clause, args
+}
+
+// ListHarvestRecords returns study headers matching the query, ordered by accession.
+func (db *DB) ListHarvestRecords(q HarvestQuery) ([]HarvestRecord, error) {
+	clause, args := q.where()
+	query := fmt.Sprintf(`
+		SELECT s.study_accession, %s, c.accession IS NOT NULL
+		%s
+		ORDER BY s.study_accession
+		LIMIT ? OFFSET ?
+	`, harvestDatestamp, clause)
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := db.Query(query, append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []HarvestRecord
+	for rows.Next() {
+		var r HarvestRecord
+		if err := rows.Scan(&r.Accession, &r.Datestamp, &r.Curated); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		if records[i].Collections, err = db.studyCollections(records[i].Accession); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// CountHarvestRecords returns the number of studies matching the query.
+func (db *DB) CountHarvestRecords(q HarvestQuery) (int, error) {
+	clause, args := q.where()
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) "+clause, args...).Scan(&count)
+	return count, err
+}
+
+// GetHarvestRecord returns the harvest header of a single study.
+func (db *DB) GetHarvestRecord(accession string) (*HarvestRecord, error) {
+	query := fmt.Sprintf(`
+		SELECT s.study_accession, %s, c.accession IS NOT NULL
+		FROM studies s LEFT JOIN curations c ON c.accession = s.study_accession
+		WHERE s.study_accession = ?
+	`, harvestDatestamp)
+
+	var r HarvestRecord
+	err := db.QueryRow(query, accession).Scan(&r.Accession, &r.Datestamp, &r.Curated)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("study not found: %s", accession)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Collections, err = db.studyCollections(accession); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// EarliestHarvestDatestamp returns the oldest datestamp of any study.
+func (db *DB) EarliestHarvestDatestamp() (string, error) {
+	var earliest string
+	err := db.QueryRow(fmt.Sprintf(`
+		SELECT COALESCE(MIN(%s), '1970-01-01')
+		FROM studies s LEFT JOIN curations c ON c.accession = s.study_accession
+	`, harvestDatestamp)).Scan(&earliest)
+	return earliest, err
+}
+
+// GetHarvestSummary returns the experiments of a study with sample and run counts.
+func (db *DB) GetHarvestSummary(accession string) (*HarvestSummary, error) {
+	rows, err := db.Query(`
+		SELECT experiment_accession, COALESCE(title, ''), COALESCE(library_strategy, ''),
+			   COALESCE(library_source, ''), COALESCE(platform, ''), COALESCE(instrument_model, '')
+		FROM experiments
+		WHERE study_accession = ?
+		ORDER BY experiment_accession
+	`, accession)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := &HarvestSummary{}
+	for rows.Next() {
+		e := &Experiment{StudyAccession: accession}
+		if err := rows.Scan(&e.ExperimentAccession, &e.Title, &e.LibraryStrategy,
+			&e.LibrarySource, &e.Platform, &e.InstrumentModel); err != nil {
+			return nil, err
+		}
+		summary.Experiments = append(summary.Experiments, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(DISTINCT es.sample_accession)
+		FROM experiment_samples es
+		JOIN experiments e ON e.experiment_accession = es.experiment_accession
+		WHERE e.study_accession = ?
+	`, accession).Scan(&summary.SampleCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*)
+		FROM runs r
+		JOIN experiments e ON e.experiment_accession = r.experiment_accession
+		WHERE e.study_accession = ?
+	`, accession).Scan(&summary.RunCount)
+	if err != nil {
+		return nil, err
+	}
+
+	orgRows, err := db.Query(`
+		SELECT DISTINCT s.scientific_name
+		FROM samples s
+		JOIN experiment_samples es ON es.sample_accession = s.sample_accession
+		JOIN experiments e ON e.experiment_accession = es.experiment_accession
+		WHERE e.study_accession = ? AND s.scientific_name IS NOT NULL AND s.scientific_name != ''
+		ORDER BY s.scientific_name
+	`, accession)
+	if err != nil {
+		return nil, err
+	}
+	defer orgRows.Close()
+
+	for orgRows.Next() {
+		var organism string
+		if err := orgRows.Scan(&organism); err != nil {
+			return nil, err
+		}
+		summary.Organisms = append(summary.Organisms, organism)
+	}
+	return summary, orgRows.Err()
+}
+
+// studyCollections returns the names of the collections containing a study.
+func (db *DB) studyCollections(accession string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT collection_name FROM collection_members
+		WHERE accession = ?
+		ORDER BY collection_name
+	`, accession)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
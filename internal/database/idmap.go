@@ -0,0 +1,166 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IDMapping links an internal ID, such as a LIMS or sample sheet ID, to
+// the accession of an SRA record
+type IDMapping struct {
+	InternalID string    `json:"internal_id"`
+	Accession  string    `json:"accession"`
+	RecordType string    `json:"record_type"`
+	Source     string    `json:"source"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// IDMappingSource is a file of ID mappings and how many it holds
+type IDMappingSource struct {
+	Source     string    `json:"source"`
+	Mappings   int       `json:"mappings"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// ImportIDMappings stores ID mappings from source in a single transaction,
+// replacing any earlier mapping of the same internal ID and accession.
+// With replace, the mappings imported before from source are deleted
+// first. It returns how many mappings were stored.
+func (db *DB) ImportIDMappings(source string, mappings []IDMapping, replace bool) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec(`DELETE FROM id_mappings WHERE source = ?`, source); err != nil {
+			return 0, err
+		}
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO id_mappings (internal_id, accession, record_type, source, imported_at)
+		VALUES (?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	var stored int64
+	for _, m := range mappings {
+		if _, err := stmt.Exec(m.InternalID, m.Accession, m.RecordType, source, now); err != nil {
+			return 0, fmt.Errorf("failed to store mapping %s -> %s: %w", m.InternalID, m.Accession, err)
+		}
+		stored++
+	}
+
+	return stored, tx.Commit()
+}
+
+// ResolveInternalID returns the mappings of an internal ID, compared
+// without regard to case
+func (db *DB) ResolveInternalID(id string) ([]IDMapping, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, nil
+	}
+	rows, err := db.Query(`
+		SELECT internal_id, accession, record_type, source, imported_at
+		FROM id_mappings
+		WHERE internal_id = ?
+		ORDER BY accession
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []IDMapping
+	for rows.Next() {
+		var m IDMapping
+		if err := rows.Scan(&m.InternalID, &m.Accession, &m.RecordType, &m.Source, &m.ImportedAt); err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, rows.Err()
+}
+
+// InternalIDsOf returns the internal IDs mapped to each of the given
+// accessions, keyed by accession. Accessions without any are left out.
+func (db *DB) InternalIDsOf(accessions []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+
+	// Stay well under SQLite's bound parameter limit
+	const chunk = 500
+	for start := 0; start < len(accessions); start += chunk {
+		end := min(start+chunk, len(accessions))
+		args := make([]interface{}, 0, end-start)
+		for _, acc := range accessions[start:end] {
+			args = append(args, acc)
+		}
+
+		rows, err := db.Query(`
+			SELECT accession, internal_id
+			FROM id_mappings
+			WHERE accession IN (`+placeholders(end-start)+`)
+			ORDER BY accession, internal_id`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var acc, id string
+			if err := rows.Scan(&acc, &id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			result[acc] = append(result[acc], id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ListIDMappingSources returns the sources of ID mappings ordered by name
+func (db *DB) ListIDMappingSources() ([]IDMappingSource, error) {
+	rows, err := db.Query(`
+		SELECT source, COUNT(*), imported_at, MAX(imported_at)
+		FROM id_mappings
+		GROUP BY source
+		ORDER BY source
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []IDMappingSource
+	for rows.Next() {
+		// The bare imported_at is taken from the row with the latest one,
+		// and scans as a time where the aggregate would not
+		var s IDMappingSource
+		var latest interface{}
+		if err := rows.Scan(&s.Source, &s.Mappings, &s.ImportedAt, &latest); err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return sources, rows.Err()
+}
+
+// DeleteIDMappings deletes the ID mappings imported from source and
+// returns how many there were
+func (db *DB) DeleteIDMappings(source string) (int64, error) {
+	result, err := db.Exec(`DELETE FROM id_mappings WHERE source = ?`, source)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
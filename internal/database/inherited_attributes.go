@@ -0,0 +1,155 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Sources of a resolved sample attribute
+const (
+	AttrSourceSample     = "sample"
+	AttrSourceExperiment = "experiment"
+	AttrSourceStudy      = "study"
+)
+
+// InheritedAttribute is an attribute of a sample, or one the sample lacks
+// that its experiment or study sets, with the record it came from
+type InheritedAttribute struct {
+	Tag             string `json:"tag"`
+	Value           string `json:"value"`
+	Units           string `json:"units,omitempty"`
+	Source          string `json:"source"` // sample, experiment or study
+	SourceAccession string `json:"source_accession"`
+}
+
+// recordAttributes returns the attributes kept in the metadata of a study
+// or experiment, with their tags normalized
+func recordAttributes(metadata string) []SampleAttribute {
+	var meta struct {
+		Attributes []SampleAttribute `json:"attributes"`
+	}
+	if metadata == "" || json.Unmarshal([]byte(metadata), &meta) != nil {
+		return nil
+	}
+	attrs := meta.Attributes[:0]
+	for _, a := range meta.Attributes {
+		if a.Tag = NormalizeAttributeTag(a.Tag); a.Tag != "" {
+			a.Value = strings.TrimSpace(a.Value)
+			a.Units = strings.TrimSpace(a.Units)
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// ResolveSampleAttributes returns the attributes of the given samples,
+// keyed by sample accession, each followed by those it inherits: the
+// attributes its experiments set that it lacks, then those its studies
+// set that it and its experiments lack. A tag set by several experiments
+// or studies of a sample is taken from the first by accession. Studies
+// and experiments keep their attributes from ingests since inheritance
+// was added; ingest again to inherit those of older databases.
+func (db *DB) ResolveSampleAttributes(accessions []string) (map[string][]InheritedAttribute, error) {
+	result := make(map[string][]InheritedAttribute)
+	seen := make(map[string]map[string]bool)
+	add := func(sample, source, sourceAccession string, attrs []SampleAttribute) {
+		tags := seen[sample]
+		if tags == nil {
+			tags = make(map[string]bool)
+			seen[sample] = tags
+		}
+		// A tag repeated within one record keeps all its values; one a
+		// record nearer the sample sets is not inherited
+		added := make(map[string]bool)
+		for _, a := range attrs {
+			if tags[a.Tag] && !added[a.Tag] {
+				continue
+			}
+			added[a.Tag] = true
+			result[sample] = append(result[sample], InheritedAttribute{
+				Tag: a.Tag, Value: a.Value, Units: a.Units,
+				Source: source, SourceAccession: sourceAccession,
+			})
+		}
+		for tag := range added {
+			tags[tag] = true
+		}
+	}
+
+	// Stay well under SQLite's bound parameter limit
+	const chunk = 500
+	for start := 0; start < len(accessions); start += chunk {
+		end := min(start+chunk, len(accessions))
+		args := make([]interface{}, 0, end-start)
+		for _, acc := range accessions[start:end] {
+			args = append(args, acc)
+		}
+
+		rows, err := db.Query(`
+			SELECT sample_accession, tag, COALESCE(value, ''), COALESCE(units, '')
+			FROM sample_attributes
+			WHERE sample_accession IN (`+placeholders(end-start)+`)
+			ORDER BY sample_accession, rowid`, args...)
+		if err != nil {
+			return nil, err
+		}
+		own := make(map[string][]SampleAttribute)
+		var order []string
+		for rows.Next() {
+			var a SampleAttribute
+			if err := rows.Scan(&a.SampleAccession, &a.Tag, &a.Value, &a.Units); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if _, ok := own[a.SampleAccession]; !ok {
+				order = append(order, a.SampleAccession)
+			}
+			own[a.SampleAccession] = append(own[a.SampleAccession], a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		for _, sample := range order {
+			add(sample, AttrSourceSample, sample, own[sample])
+		}
+
+		// Experiments first, then studies, each in accession order
+		for _, parent := range []struct {
+			source string
+			query  string
+		}{
+			{AttrSourceExperiment, `
+				SELECT es.sample_accession, e.experiment_accession, COALESCE(e.metadata, '')
+				FROM experiment_samples es
+				JOIN experiments e ON e.experiment_accession = es.experiment_accession
+				WHERE es.sample_accession IN (` + placeholders(end-start) + `)
+				ORDER BY es.sample_accession, e.experiment_accession`},
+			{AttrSourceStudy, `
+				SELECT DISTINCT es.sample_accession, st.study_accession, COALESCE(st.metadata, '')
+				FROM experiment_samples es
+				JOIN experiments e ON e.experiment_accession = es.experiment_accession
+				JOIN studies st ON st.study_accession = e.study_accession
+				WHERE es.sample_accession IN (` + placeholders(end-start) + `)
+				ORDER BY es.sample_accession, st.study_accession`},
+		} {
+			rows, err := db.Query(parent.query, args...)
+			if err != nil {
+				return nil, err
+			}
+			for rows.Next() {
+				var sample, accession, metadata string
+				if err := rows.Scan(&sample, &accession, &metadata); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				add(sample, parent.source, accession, recordAttributes(metadata))
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
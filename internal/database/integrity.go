@@ -0,0 +1,301 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Integrity checks run by CheckIntegrity
+const (
+	CheckOrphanExperiments     = "orphan_experiments"
+	CheckOrphanAnalyses        = "orphan_analyses"
+	CheckOrphanRuns            = "orphan_runs"
+	CheckOrphanSamples         = "orphan_samples"
+	CheckOrphanExperimentLinks = "orphan_experiment_links"
+	CheckOrphanSampleLinks     = "orphan_sample_links"
+	CheckInvalidJSON           = "invalid_json"
+)
+
+// Fix strategies for orphaned rows. Either strategy clears invalid JSON to
+// NULL and removes jobs whose spec is invalid.
+const (
+	// FixPlaceholders creates empty parent records for orphans, keeping
+	// every record that was ingested
+	FixPlaceholders = "placeholders"
+	// FixDelete removes orphans, and with them rows orphaned in turn
+	FixDelete = "delete"
+)
+
+// placeholderMetadata marks parent records created by FixPlaceholders
+const placeholderMetadata = `{"placeholder":true}`
+
+// orphanCheck finds rows of a table whose parent record is missing.
+// Foreign keys are not enforced during ingest, so these can arise from
+// partial archives or records whose parents were suppressed.
+type orphanCheck struct {
+	check       string
+	description string
+	table       string
+	key         string // column identifying the row
+	parentCol   string // column holding the parent accession
+	parentTable string
+	parentKey   string
+}
+
+// orphanChecks are ordered parents first, so that deleting orphans also
+// catches the rows of records deleted by an earlier check
+var orphanChecks = []orphanCheck{
+	{CheckOrphanExperiments, "experiments whose study is missing", "experiments", "experiment_accession", "study_accession", "studies", "study_accession"},
+	{CheckOrphanAnalyses, "analyses whose study is missing", "analyses", "analysis_accession", "study_accession", "studies", "study_accession"},
+	{CheckOrphanRuns, "runs whose experiment is missing", "runs", "run_accession", "experiment_accession", "experiments", "experiment_accession"},
+	{CheckOrphanSamples, "samples whose experiment is missing", "samples", "sample_accession", "experiment_accession", "experiments", "experiment_accession"},
+	{CheckOrphanExperimentLinks, "experiment-sample links to a missing experiment", "experiment_samples", "sample_accession", "experiment_accession", "experiments", "experiment_accession"},
+	{CheckOrphanSampleLinks, "experiment-sample links to a missing sample", "experiment_samples", "experiment_accession", "sample_accession", "samples", "sample_accession"},
+}
+
+// where selects the orphaned rows of the check's table, aliased t
+func (c orphanCheck) where() string {
+	return fmt.Sprintf(`t.%[1]s IS NOT NULL AND t.%[1]s != ''
+		AND NOT EXISTS (SELECT 1 FROM %[2]s p WHERE p.%[3]s = t.%[1]s)`, c.parentCol, c.parentTable, c.parentKey)
+}
+
+// jsonColumns lists the JSON columns of each table, with the column that
+// identifies a row
+var jsonColumns = []struct {
+	table   string
+	key     string
+	columns []string
+}{
+	{"studies", "study_accession", []string{"metadata"}},
+	{"experiments", "experiment_accession", []string{"metadata"}},
+	{"samples", "sample_accession", []string{"metadata"}},
+	{"runs", "run_accession", []string{"metadata"}},
+	{"submissions", "submission_accession", []string{"contacts", "actions", "submission_links", "submission_attributes", "metadata"}},
+	{"analyses", "analysis_accession", []string{"targets", "data_blocks", "assembly_ref", "run_labels", "seq_labels", "processing", "analysis_links", "analysis_attributes", "metadata"}},
+	{"curations", "accession", []string{"tags"}},
+	{"cohorts", "name", []string{"filters"}},
+	{"jobs", "id", []string{"spec"}},
+}
+
+// IntegrityProblem is one row that fails an integrity check
+type IntegrityProblem struct {
+	Table   string `json:"table"`
+	Key     string `json:"key"`
+	Missing string `json:"missing,omitempty"` // accession of the missing parent
+	Column  string `json:"column,omitempty"`  // JSON column that fails to parse
+	Message string `json:"message,omitempty"` // error reported by SQLite
+}
+
+// IntegrityResult is the outcome of one integrity check
+type IntegrityResult struct {
+	Check       string             `json:"check"`
+	Description string             `json:"description"`
+	Count       int64              `json:"count"`
+	Examples    []IntegrityProblem `json:"examples,omitempty"`
+}
+
+// IntegrityReport is the outcome of all integrity checks
+type IntegrityReport struct {
+	Results []IntegrityResult `json:"results"`
+}
+
+// Problems returns the total number of problems found
+func (r *IntegrityReport) Problems() int64 {
+	var n int64
+	for _, res := range r.Results {
+		n += res.Count
+	}
+	return n
+}
+
+// CheckIntegrity scans for orphaned records and JSON columns that fail to
+// parse, returning up to examples problems of each check.
+func (db *DB) CheckIntegrity(examples int) (*IntegrityReport, error) {
+	report := &IntegrityReport{}
+
+	for _, c := range orphanChecks {
+		result := IntegrityResult{Check: c.check, Description: c.description}
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + c.table + ` t WHERE ` + c.where()).Scan(&result.Count); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.check, err)
+		}
+		if result.Count > 0 && examples > 0 {
+			rows, err := db.Query(`SELECT t.`+c.key+`, t.`+c.parentCol+` FROM `+c.table+` t WHERE `+c.where()+`
+				ORDER BY t.`+c.key+` LIMIT ?`, examples)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", c.check, err)
+			}
+			for rows.Next() {
+				p := IntegrityProblem{Table: c.table}
+				if err := rows.Scan(&p.Key, &p.Missing); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				result.Examples = append(result.Examples, p)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	invalid := IntegrityResult{Check: CheckInvalidJSON, Description: "JSON columns that fail to parse"}
+	for _, t := range jsonColumns {
+		for _, col := range t.columns {
+			where := invalidJSON(col)
+			var n int64
+			if err := db.QueryRow(`SELECT COUNT(*) FROM ` + t.table + ` WHERE ` + where).Scan(&n); err != nil {
+				return nil, fmt.Errorf("%s: %s.%s: %w", CheckInvalidJSON, t.table, col, err)
+			}
+			invalid.Count += n
+			if n == 0 || len(invalid.Examples) >= examples {
+				continue
+			}
+
+			rows, err := db.Query(`SELECT `+t.key+` FROM `+t.table+` WHERE `+where+` ORDER BY `+t.key+` LIMIT ?`,
+				examples-len(invalid.Examples))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s.%s: %w", CheckInvalidJSON, t.table, col, err)
+			}
+			for rows.Next() {
+				p := IntegrityProblem{Table: t.table, Column: col}
+				if err := rows.Scan(&p.Key); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				invalid.Examples = append(invalid.Examples, p)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	report.Results = append(report.Results, invalid)
+
+	return report, nil
+}
+
+// invalidJSON selects rows whose column holds text that is not JSON. Empty
+// strings are treated like NULL.
+func invalidJSON(col string) string {
+	return col + ` IS NOT NULL AND ` + col + ` != '' AND NOT json_valid(` + col + `)`
+}
+
+// IntegrityFix is the number of rows changed by one fix
+type IntegrityFix struct {
+	Check  string `json:"check"`
+	Action string `json:"action"` // "created", "deleted" or "cleared"
+	Table  string `json:"table"`
+	Rows   int64  `json:"rows"`
+}
+
+// FixIntegrity repairs the problems found by CheckIntegrity in a single
+// transaction, handling orphans by the given strategy.
+func (db *DB) FixIntegrity(strategy string) ([]IntegrityFix, error) {
+	if strategy != FixPlaceholders && strategy != FixDelete {
+		return nil, fmt.Errorf("unknown fix strategy %q (use %s or %s)", strategy, FixPlaceholders, FixDelete)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var fixes []IntegrityFix
+	record := func(check, action, table string, res sql.Result) {
+		if n, _ := res.RowsAffected(); n > 0 {
+			fixes = append(fixes, IntegrityFix{Check: check, Action: action, Table: table, Rows: n})
+		}
+	}
+
+	for _, c := range orphanChecks {
+		if strategy == FixDelete {
+			res, err := tx.Exec(`DELETE FROM ` + c.table + ` AS t WHERE ` + c.where())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", c.check, err)
+			}
+			record(c.check, "deleted", c.table, res)
+			continue
+		}
+
+		cols, values, err := placeholderColumns(tx, c.parentTable, c.parentKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.check, err)
+		}
+		res, err := tx.Exec(`INSERT OR IGNORE INTO `+c.parentTable+` (`+c.parentKey+`, metadata`+cols+`)
+			SELECT DISTINCT t.`+c.parentCol+`, ?`+values+` FROM `+c.table+` t WHERE `+c.where(), placeholderMetadata)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.check, err)
+		}
+		record(c.check, "created", c.parentTable, res)
+	}
+
+	for _, t := range jsonColumns {
+		for _, col := range t.columns {
+			// A job cannot run without its spec, so it is removed instead
+			query, action := `UPDATE `+t.table+` SET `+col+` = NULL WHERE `+invalidJSON(col), "cleared"
+			if t.table == "jobs" {
+				query, action = `DELETE FROM `+t.table+` WHERE `+invalidJSON(col), "deleted"
+			}
+			res, err := tx.Exec(query)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s.%s: %w", CheckInvalidJSON, t.table, col, err)
+			}
+			record(CheckInvalidJSON, action, t.table+"."+col, res)
+		}
+	}
+
+	if strategy == FixDelete {
+		// Deleted runs and links may have fed the denormalized table
+		if _, err := tx.Exec(`DELETE FROM sample_runs WHERE NOT EXISTS
+			(SELECT 1 FROM runs r WHERE r.run_accession = sample_runs.run_accession)`); err != nil {
+			return nil, err
+		}
+	}
+
+	return fixes, tx.Commit()
+}
+
+// placeholderColumns returns the text and numeric columns of a table other
+// than key and metadata, with matching empty values, each list prefixed by
+// a comma. The readers scan these columns into plain strings and numbers,
+// so placeholders must not leave them NULL.
+func placeholderColumns(tx *sql.Tx, table, key string) (string, string, error) {
+	rows, err := tx.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+
+	var cols, values strings.Builder
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			dflt       sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &primaryKey); err != nil {
+			return "", "", err
+		}
+		if name == key || name == "metadata" {
+			continue
+		}
+		typ = strings.ToUpper(typ)
+		switch {
+		case strings.Contains(typ, "INT"), strings.Contains(typ, "REAL"):
+			values.WriteString(", 0")
+		case strings.Contains(typ, "TEXT"), strings.Contains(typ, "CHAR"):
+			values.WriteString(", ''")
+		default:
+			continue
+		}
+		cols.WriteString(", " + name)
+	}
+	return cols.String(), values.String(), rows.Err()
+}
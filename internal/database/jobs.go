@@ -0,0 +1,220 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a long-running export or search executed in the background. The
+// spec is the JSON request the job was submitted with.
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Spec       string     `json:"spec"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	ResultPath string     `json:"-"`
+	ResultSize int64      `json:"result_size,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// IsFinished reports whether the job has reached a final state.
+func (j *Job) IsFinished() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+const jobColumns = `id, kind, spec, status, COALESCE(error, ''), COALESCE(result_path, ''),
+	COALESCE(result_size, 0), created_at, started_at, finished_at`
+
+// CreateJob stores a new queued job.
+func (db *DB) CreateJob(job *Job) error {
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+	job.Status = JobQueued
+
+	_, err := db.Exec(`
+		INSERT INTO jobs (id, kind, spec, status, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, job.ID, job.Kind, job.Spec, job.Status, job.CreatedAt)
+	return err
+}
+
+// GetJob retrieves a job by ID.
+func (db *DB) GetJob(id string) (*Job, error) {
+	job, err := scanJob(db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("job not found: %s", id)
+	}
+	return job, err
+}
+
+// ListJobs returns jobs, newest first, optionally restricted to a status.
+// A limit of 0 returns all jobs.
+func (db *DB) ListJobs(status string, limit int) ([]Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC, id`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimJob marks the oldest queued job as running and returns it.
+// Returns nil without an error when no job is queued.
+func (db *DB) ClaimJob() (*Job, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	job, err := scanJob(tx.QueryRow(`SELECT `+jobColumns+` FROM jobs
+		WHERE status = ? ORDER BY created_at, id LIMIT 1`, JobQueued))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec(`UPDATE jobs SET status = ?, started_at = ? WHERE id = ?`,
+		JobRunning, now, job.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	job.Status = JobRunning
+	job.StartedAt = &now
+	return job, nil
+}
+
+// FinishJob records the outcome of a running job. Jobs cancelled while
+// running keep their cancelled state.
+func (db *DB) FinishJob(id, status, errMsg, resultPath string, resultSize int64) error {
+	_, err := db.Exec(`
+		UPDATE jobs SET status = ?, error = ?, result_path = ?, result_size = ?, finished_at = ?
+		WHERE id = ? AND status = ?
+	`, status, errMsg, resultPath, resultSize, time.Now().UTC(), id, JobRunning)
+	return err
+}
+
+// CancelJob cancels a queued or running job. Returns an error if the job
+// does not exist or has already finished.
+func (db *DB) CancelJob(id string) (*Job, error) {
+	job, err := db.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.IsFinished() {
+		return nil, fmt.Errorf("job %s already %s", id, job.Status)
+	}
+
+	now := time.Now().UTC()
+	if _, err := db.Exec(`UPDATE jobs SET status = ?, finished_at = ? WHERE id = ? AND status IN (?, ?)`,
+		JobCancelled, now, id, JobQueued, JobRunning); err != nil {
+		return nil, err
+	}
+	job.Status = JobCancelled
+	job.FinishedAt = &now
+	return job, nil
+}
+
+// RequeueRunningJobs returns jobs left running by an interrupted worker to
+// the queue. It should be called before a worker starts claiming jobs.
+func (db *DB) RequeueRunningJobs() (int, error) {
+	result, err := db.Exec(`UPDATE jobs SET status = ?, started_at = NULL WHERE status = ?`, JobQueued, JobRunning)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// PruneJobs deletes finished jobs that finished before cutoff and returns
+// them, so their result files can be removed. In a dry run the jobs are
+// returned without being deleted.
+func (db *DB) PruneJobs(cutoff time.Time, dryRun bool) ([]Job, error) {
+	rows, err := db.Query(`SELECT `+jobColumns+` FROM jobs
+		WHERE status IN (?, ?, ?) AND finished_at < ? ORDER BY finished_at`,
+		JobCompleted, JobFailed, JobCancelled, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return jobs, nil
+	}
+	for _, job := range jobs {
+		if _, err := db.Exec(`DELETE FROM jobs WHERE id = ?`, job.ID); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	job := &Job{}
+	var started, finished sql.NullTime
+	err := row.Scan(&job.ID, &job.Kind, &job.Spec, &job.Status, &job.Error, &job.ResultPath,
+		&job.ResultSize, &job.CreatedAt, &started, &finished)
+	if err != nil {
+		return nil, err
+	}
+	if started.Valid {
+		job.StartedAt = &started.Time
+	}
+	if finished.Valid {
+		job.FinishedAt = &finished.Time
+	}
+	return job, nil
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// CheckStorage is the check run by CheckStorageIntegrity
+const CheckStorage = "sqlite_integrity"
+
+// VacuumThreshold is the fraction of free pages above which NeedsVacuum
+// reports that vacuuming is worthwhile
+const VacuumThreshold = 0.1
+
+// maxStorageErrors bounds the errors PRAGMA integrity_check reports
+const maxStorageErrors = 100
+
+// SpaceUsage describes how the pages of the database file are used
+type SpaceUsage struct {
+	PageSize  int64 `json:"page_size"`
+	Pages     int64 `json:"pages"`
+	FreePages int64 `json:"free_pages"`
+	FileBytes int64 `json:"file_bytes"` // database file and write-ahead log
+}
+
+// FreeBytes returns the space held by free pages
+func (u *SpaceUsage) FreeBytes() int64 {
+	return u.FreePages * u.PageSize
+}
+
+// NeedsVacuum reports whether free pages make up more than VacuumThreshold
+// of the database
+func (u *SpaceUsage) NeedsVacuum() bool {
+	return u.Pages > 0 && float64(u.FreePages)/float64(u.Pages) > VacuumThreshold
+}
+
+// SpaceUsage returns the page counts of the database and the size of its
+// files on disk
+func (db *DB) SpaceUsage() (*SpaceUsage, error) {
+	u := &SpaceUsage{}
+	if err := db.QueryRow("PRAGMA page_size").Scan(&u.PageSize); err != nil {
+		return nil, fmt.Errorf("failed to read page size: %w", err)
+	}
+	if err := db.QueryRow("PRAGMA page_count").Scan(&u.Pages); err != nil {
+		return nil, fmt.Errorf("failed to read page count: %w", err)
+	}
+	if err := db.QueryRow("PRAGMA freelist_count").Scan(&u.FreePages); err != nil {
+		return nil, fmt.Errorf("failed to read free page count: %w", err)
+	}
+	for _, path := range []string{db.path, db.path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			u.FileBytes += info.Size()
+		}
+	}
+	return u, nil
+}
+
+// Vacuum rebuilds the database file without its free pages, then
+// truncates the write-ahead log so that the space is returned to the file
+// system. It needs free disk space of up to twice the database size.
+func (db *DB) Vacuum(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("vacuum failed: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed to checkpoint the write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// Analyze gathers the table and index statistics the query planner uses
+// to choose indexes
+func (db *DB) Analyze(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, "ANALYZE"); err != nil {
+		return fmt.Errorf("analyze failed: %w", err)
+	}
+	return nil
+}
+
+// CheckStorageIntegrity runs SQLite's integrity check over the database
+// file, returning up to examples of the errors it reports. With quick, it
+// skips checking that indexes match their tables, which is much faster.
+func (db *DB) CheckStorageIntegrity(ctx context.Context, quick bool, examples int) (IntegrityResult, error) {
+	pragma := "integrity_check"
+	if quick {
+		pragma = "quick_check"
+	}
+	result := IntegrityResult{Check: CheckStorage, Description: "pages and indexes that fail SQLite's " + pragma}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA %s(%d)", pragma, maxStorageErrors))
+	if err != nil {
+		return result, fmt.Errorf("%s: %w", CheckStorage, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return result, err
+		}
+		if msg == "ok" {
+			continue
+		}
+		result.Count++
+		if len(result.Examples) < examples {
+			result.Examples = append(result.Examples, IntegrityProblem{Message: msg})
+		}
+	}
+	return result, rows.Err()
+}
+
+// warmIndex is an index read through by WarmCache: the primary key of
+// table when index is empty
+type warmIndex struct {
+	table, column, index string
+}
+
+// warmIndexes are the indexes that lookups and the joins between studies,
+// experiments, samples and runs read most
+var warmIndexes = []warmIndex{
+	{"studies", "study_accession", ""},
+	{"experiments", "experiment_accession", ""},
+	{"samples", "sample_accession", ""},
+	{"runs", "run_accession", ""},
+	{"experiments", "study_accession", "idx_exp_study"},
+	{"samples", "experiment_accession", "idx_sample_experiment"},
+	{"runs", "experiment_accession", "idx_run_experiment"},
+	{"sample_runs", "run_accession", "idx_sample_runs_run"},
+	{"samples", "organism", "idx_sample_organism"},
+	{"experiments", "library_strategy", "idx_exp_strategy"},
+}
+
+// WarmCache reads the key indexes through once, so that the first lookups
+// after the database is opened find their pages in memory instead of on
+// disk. Pages read through the memory map stay in the operating system's
+// page cache, where every connection finds them.
+func (db *DB) WarmCache(ctx context.Context) error {
+	for _, w := range warmIndexes {
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s >= ''", w.table, w.column)
+		if w.index != "" {
+			query = fmt.Sprintf("SELECT COUNT(*) FROM %s INDEXED BY %s WHERE %s >= ''", w.table, w.index, w.column)
+		}
+		var n int64
+		if err := db.QueryRowContext(ctx, query).Scan(&n); err != nil {
+			name := w.index
+			if name == "" {
+				name = w.table + " primary key"
+			}
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+	return nil
+}
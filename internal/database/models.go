@@ -42,6 +42,9 @@ type Study struct {
 
 	// Full metadata
 	Metadata string `json:"metadata"` // JSON
+
+	// Local curation overlay, populated on read
+	Curation *Curation `json:"curation,omitempty"`
 }
 
 // Experiment represents a comprehensive SRA experiment record
@@ -95,6 +98,9 @@ type Experiment struct {
 
 	// Full metadata
 	Metadata string `json:"metadata"` // JSON
+
+	// Local curation overlay, populated on read
+	Curation *Curation `json:"curation,omitempty"`
 }
 
 // Sample represents a comprehensive SRA sample record
@@ -145,6 +151,9 @@ type Sample struct {
 
 	// Full metadata
 	Metadata string `json:"metadata"` // JSON
+
+	// Local curation overlay, populated on read
+	Curation *Curation `json:"curation,omitempty"`
 }
 
 // Run represents a comprehensive SRA run record
@@ -187,6 +196,9 @@ type Run struct {
 
 	// Full metadata
 	Metadata string `json:"metadata"` // JSON
+
+	// Local curation overlay, populated on read
+	Curation *Curation `json:"curation,omitempty"`
 }
 
 // Submission represents a submission record with enhanced fields
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ontology is a vocabulary loaded by 'srake ontology load'
+type Ontology struct {
+	Name       string    `json:"name"`
+	Format     string    `json:"format"`
+	SourceFile string    `json:"source_file,omitempty"`
+	Terms      int       `json:"terms"`
+	LoadedAt   time.Time `json:"loaded_at"`
+}
+
+// OntologyTerm is a term of a vocabulary with its labels, the preferred
+// name first
+type OntologyTerm struct {
+	ID     string
+	Labels []string
+}
+
+// ReplaceOntology stores a vocabulary, replacing the terms of any loaded
+// before under the same name.
+func (db *DB) ReplaceOntology(o Ontology, terms []OntologyTerm) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM ontology_labels WHERE ontology = ?`, o.Name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT OR REPLACE INTO ontologies (name, format, source_file, terms, loaded_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, o.Name, o.Format, o.SourceFile, len(terms), time.Now().UTC()); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO ontology_labels (ontology, term_id, label, preferred)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range terms {
+		for i, label := range t.Labels {
+			if _, err := stmt.Exec(o.Name, t.ID, label, i == 0); err != nil {
+				return fmt.Errorf("failed to store term %s: %w", t.ID, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// ListOntologies returns the loaded vocabularies ordered by name
+func (db *DB) ListOntologies() ([]Ontology, error) {
+	rows, err := db.Query(`
+		SELECT name, format, COALESCE(source_file, ''), terms, loaded_at
+		FROM ontologies
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ontologies []Ontology
+	for rows.Next() {
+		var o Ontology
+		if err := rows.Scan(&o.Name, &o.Format, &o.SourceFile, &o.Terms, &o.LoadedAt); err != nil {
+			return nil, err
+		}
+		ontologies = append(ontologies, o)
+	}
+	return ontologies, rows.Err()
+}
+
+// DeleteOntology deletes a vocabulary and its terms
+func (db *DB) DeleteOntology(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM ontologies WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("ontology not found: %s", name)
+	}
+	if _, err := tx.Exec(`DELETE FROM ontology_labels WHERE ontology = ?`, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// OntologySynonyms returns the other labels of the terms each of the given
+// labels names, in any loaded vocabulary, keyed by the label in lower case.
+// Preferred names come first, then shorter labels. Labels that name no
+// term are left out.
+func (db *DB) OntologySynonyms(labels []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	seen := make(map[string]map[string]bool)
+
+	// Stay well under SQLite's bound parameter limit
+	const chunk = 500
+	for start := 0; start < len(labels); start += chunk {
+		end := min(start+chunk, len(labels))
+		args := make([]interface{}, 0, end-start)
+		for _, label := range labels[start:end] {
+			args = append(args, label)
+		}
+
+		rows, err := db.Query(`
+			SELECT q.label, o.label
+			FROM ontology_labels q
+			JOIN ontology_labels o ON o.ontology = q.ontology AND o.term_id = q.term_id
+			WHERE q.label IN (`+placeholders(end-start)+`)
+			ORDER BY q.label, o.preferred DESC, length(o.label), o.label`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var label, synonym string
+			if err := rows.Scan(&label, &synonym); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			key := strings.ToLower(label)
+			if seen[key] == nil {
+				seen[key] = map[string]bool{key: true}
+			}
+			if seen[key][strings.ToLower(synonym)] {
+				continue
+			}
+			seen[key][strings.ToLower(synonym)] = true
+			result[key] = append(result[key], synonym)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// popularityDay is the layout of the days popularity is counted by
+const popularityDay = "2006-01-02"
+
+// PopularityCount is how often a record was returned by searches and
+// fetched on its own
+type PopularityCount struct {
+	Accession  string `json:"accession"`
+	RecordType string `json:"record_type"`
+	Returned   int64  `json:"returned"`
+	Fetched    int64  `json:"fetched"`
+}
+
+// Total returns the times the record was returned or fetched
+func (c PopularityCount) Total() int64 {
+	return c.Returned + c.Fetched
+}
+
+// AddPopularity adds counts to those of their records on the UTC day of
+// day, in a single transaction
+func (db *DB) AddPopularity(day time.Time, counts []PopularityCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO record_popularity (accession, record_type, day, returned, fetched)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (accession, day) DO UPDATE SET
+			returned = returned + excluded.returned,
+			fetched = fetched + excluded.fetched
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	d := day.UTC().Format(popularityDay)
+	for _, c := range counts {
+		if _, err := stmt.Exec(c.Accession, c.RecordType, d, c.Returned, c.Fetched); err != nil {
+			return fmt.Errorf("failed to count %s: %w", c.Accession, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// PopularRecords returns the limit records returned and fetched most often
+// since the UTC day of since, or ever when since is zero, most popular
+// first. recordType restricts them to studies or runs when set.
+func (db *DB) PopularRecords(recordType string, since time.Time, limit int) ([]PopularityCount, error) {
+	query := `
+		SELECT accession, MAX(record_type), SUM(returned), SUM(fetched)
+		FROM record_popularity
+		WHERE day >= ?`
+	args := []interface{}{sinceDay(since)}
+	if recordType != "" {
+		query += ` AND record_type = ?`
+		args = append(args, recordType)
+	}
+	query += `
+		GROUP BY accession
+		ORDER BY SUM(returned) + SUM(fetched) DESC, accession
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []PopularityCount
+	for rows.Next() {
+		var c PopularityCount
+		if err := rows.Scan(&c.Accession, &c.RecordType, &c.Returned, &c.Fetched); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Popularity returns how often each of the given records was returned or
+// fetched since the UTC day of since, or ever when since is zero. Records
+// never counted are left out.
+func (db *DB) Popularity(accessions []string, since time.Time) (map[string]int64, error) {
+	popularity := make(map[string]int64)
+	for start := 0; start < len(accessions); start += accessBatchSize {
+		batch := accessions[start:min(start+accessBatchSize, len(accessions))]
+		args := make([]interface{}, 0, len(batch)+1)
+		args = append(args, sinceDay(since))
+		for _, acc := range batch {
+			args = append(args, acc)
+		}
+		// #nosec G201 - only placeholders are interpolated
+		rows, err := db.Query(fmt.Sprintf(`
+			SELECT accession, SUM(returned) + SUM(fetched)
+			FROM record_popularity
+			WHERE day >= ? AND accession IN (%s)
+			GROUP BY accession
+		`, placeholders(len(batch))), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var acc string
+			var n int64
+			if err := rows.Scan(&acc, &n); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			popularity[acc] = n
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return popularity, nil
+}
+
+// sinceDay returns the first day counted from since
+func sinceDay(since time.Time) string {
+	if since.IsZero() {
+		return ""
+	}
+	return since.UTC().Format(popularityDay)
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QCFlag marks a record as violating a quality rule
+type QCFlag struct {
+	Accession  string    `json:"accession"`
+	RecordType string    `json:"record_type"`
+	Rule       string    `json:"rule"`
+	Severity   string    `json:"severity"`
+	Message    string    `json:"message,omitempty"`
+	FlaggedAt  time.Time `json:"flagged_at"`
+}
+
+// FlagRecords records flags found by run, a number identifying a run of
+// quality rules that is larger than that of earlier runs. A flag already
+// recorded keeps the time it was first found.
+func (db *DB) FlagRecords(run int64, flags []QCFlag) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO qc_flags (accession, record_type, rule, severity, message, run, flagged_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(accession, rule) DO UPDATE SET
+			severity = excluded.severity, message = excluded.message, run = excluded.run
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, f := range flags {
+		if _, err := stmt.Exec(f.Accession, f.RecordType, f.Rule, f.Severity, f.Message, run, now); err != nil {
+			return fmt.Errorf("failed to flag %s: %w", f.Accession, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ClearStaleFlags removes the flags of rules that run did not find again,
+// as their records now pass, and returns how many were removed
+func (db *DB) ClearStaleFlags(run int64, rules []string) (int64, error) {
+	if len(rules) == 0 {
+		return 0, nil
+	}
+	args := []interface{}{run}
+	for _, rule := range rules {
+		args = append(args, rule)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(rules)), ",")
+
+	// #nosec G201 - only placeholders are interpolated
+	result, err := db.Exec(fmt.Sprintf(`DELETE FROM qc_flags WHERE run < ? AND rule IN (%s)`, placeholders), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ClearFlags removes the flags of rule, or every flag when rule is empty,
+// and returns how many were removed
+func (db *DB) ClearFlags(rule string) (int64, error) {
+	result, err := db.Exec(`DELETE FROM qc_flags WHERE ? = '' OR rule = ?`, rule, rule)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListFlags returns up to limit flags of rule, or of every rule when rule
+// is empty, ordered by rule and accession. A limit of 0 returns them all.
+func (db *DB) ListFlags(rule string, limit int) ([]QCFlag, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.Query(`
+		SELECT accession, record_type, rule, severity, COALESCE(message, ''), flagged_at
+		FROM qc_flags
+		WHERE ? = '' OR rule = ?
+		ORDER BY rule, accession
+		LIMIT ?
+	`, rule, rule, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []QCFlag
+	for rows.Next() {
+		var f QCFlag
+		if err := rows.Scan(&f.Accession, &f.RecordType, &f.Rule, &f.Severity, &f.Message, &f.FlaggedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// GetFlaggedRules returns the rules each of accessions is flagged by,
+// keyed by accession. Accessions without flags are absent from the result.
+func (db *DB) GetFlaggedRules(accessions []string) (map[string][]string, error) {
+	flagged := make(map[string][]string)
+	if len(accessions) == 0 {
+		return flagged, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(accessions)), ",")
+	args := make([]interface{}, len(accessions))
+	for i, acc := range accessions {
+		args[i] = acc
+	}
+
+	// #nosec G201 - only placeholders are interpolated
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT accession, rule
+		FROM qc_flags
+		WHERE accession IN (%s)
+		ORDER BY accession, rule
+	`, placeholders), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var accession, rule string
+		if err := rows.Scan(&accession, &rule); err != nil {
+			return nil, err
+		}
+		flagged[accession] = append(flagged[accession], rule)
+	}
+	return flagged, rows.Err()
+}
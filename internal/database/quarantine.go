@@ -0,0 +1,139 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// QuarantinedRecord is a record that failed validation at ingest, kept
+// with its original XML instead of being inserted
+type QuarantinedRecord struct {
+	IngestID      string            `json:"ingest_id"`
+	Accession     string            `json:"accession"`
+	RecordType    string            `json:"record_type"`
+	SourceFile    string            `json:"source_file,omitempty"`
+	XML           []byte            `json:"-"`
+	Errors        []QuarantineError `json:"errors"`
+	QuarantinedAt time.Time         `json:"quarantined_at"`
+}
+
+// QuarantineError is a validation error of a quarantined record
+type QuarantineError struct {
+	Type    string `json:"type"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// QuarantineSummary counts quarantined records, and their errors by type
+type QuarantineSummary struct {
+	Records int            `json:"records"`
+	ByType  map[string]int `json:"by_type"`
+}
+
+// QuarantineRecords stores records that failed validation. A record
+// quarantined again by the same ingest replaces the earlier copy.
+func (db *DB) QuarantineRecords(records []QuarantinedRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	tx, err := db.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO quarantine (ingest_id, accession, record_type, source_file, xml, errors, quarantined_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, r := range records {
+		errs, err := json.Marshal(r.Errors)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(r.IngestID, r.Accession, r.RecordType, r.SourceFile, r.XML, string(errs), now); err != nil {
+			return fmt.Errorf("failed to quarantine %s: %w", r.Accession, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListQuarantine returns up to limit quarantined records, newest first, of
+// one ingest, or of every ingest when ingestID is empty, and only those of
+// an accession when it is set. A limit of 0 returns them all.
+func (db *DB) ListQuarantine(ingestID, accession string, limit int) ([]QuarantinedRecord, error) {
+	query := `
+		SELECT ingest_id, accession, record_type, COALESCE(source_file, ''), xml, errors, quarantined_at
+		FROM quarantine
+		WHERE (? = '' OR ingest_id = ?) AND (? = '' OR accession = ?)
+		ORDER BY quarantined_at DESC, accession
+	`
+	args := []interface{}{ingestID, ingestID, accession, accession}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []QuarantinedRecord
+	for rows.Next() {
+		var r QuarantinedRecord
+		var errs string
+		if err := rows.Scan(&r.IngestID, &r.Accession, &r.RecordType, &r.SourceFile, &r.XML, &errs, &r.QuarantinedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(errs), &r.Errors); err != nil {
+			return nil, fmt.Errorf("invalid errors of quarantined %s: %w", r.Accession, err)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// SummarizeQuarantine counts the records quarantined since a time, such
+// as the start of an ingest, and their errors by type
+func (db *DB) SummarizeQuarantine(since time.Time) (*QuarantineSummary, error) {
+	rows, err := db.Query(`SELECT errors FROM quarantine WHERE quarantined_at >= ?`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := &QuarantineSummary{ByType: make(map[string]int)}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var errs []QuarantineError
+		if err := json.Unmarshal([]byte(data), &errs); err != nil {
+			return nil, err
+		}
+		summary.Records++
+		for _, e := range errs {
+			summary.ByType[e.Type]++
+		}
+	}
+	return summary, rows.Err()
+}
+
+// ClearQuarantine removes the quarantined records of an ingest, or every
+// one when ingestID is empty, and returns how many were removed
+func (db *DB) ClearQuarantine(ingestID string) (int64, error) {
+	result, err := db.Exec(`DELETE FROM quarantine WHERE ? = '' OR ingest_id = ?`, ingestID, ingestID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codecs of raw blobs. The codec is stored with each blob, so blobs
+// written with gzip before zstd was used are still read.
+const (
+	RawCodecZstd = "zstd"
+	RawCodecGzip = "gzip"
+)
+
+// The encoder and decoder are shared; EncodeAll and DecodeAll may be called
+// concurrently
+var (
+	rawEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	rawDecoder, _ = zstd.NewReader(nil)
+)
+
+// RawRecord is the original XML of a single record as found in an archive.
+type RawRecord struct {
+	Accession  string
+	RecordType string
+	XML        []byte
+}
+
+// RawRecordInfo describes a stored raw record.
+type RawRecordInfo struct {
+	Accession  string    `json:"accession"`
+	RecordType string    `json:"record_type"`
+	Hash       string    `json:"hash"`
+	Codec      string    `json:"codec"`
+	Size       int64     `json:"size"`
+	StoredSize int64     `json:"stored_size"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// RawRecordHash returns the content address of a record's XML.
+func RawRecordHash(xml []byte) string {
+	sum := sha256.Sum256(xml)
+	return hex.EncodeToString(sum[:])
+}
+
+// StoreRawRecords stores the XML of the given records in a single
+// transaction. Identical XML is stored once; each accession points at the
+// blob of its latest version. It returns the number of new blobs written.
+func (db *DB) StoreRawRecords(records []RawRecord) (int, error) {
+	tx, err := db.beginWrite()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	blobStmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO raw_blobs (hash, codec, size, data)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer blobStmt.Close()
+
+	recordStmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO raw_records (accession, record_type, hash, updated_at)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer recordStmt.Close()
+
+	var buf []byte
+	now := time.Now().UTC()
+	written := 0
+	for _, r := range records {
+		if r.Accession == "" || len(r.XML) == 0 {
+			continue
+		}
+		hash := RawRecordHash(r.XML)
+
+		buf = rawEncoder.EncodeAll(r.XML, buf[:0])
+		result, err := blobStmt.Exec(hash, RawCodecZstd, len(r.XML), buf)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			written++
+		}
+		if _, err := recordStmt.Exec(r.Accession, r.RecordType, hash, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// GetRawRecord returns the stored XML of a record.
+func (db *DB) GetRawRecord(accession string) (*RawRecordInfo, []byte, error) {
+	var info RawRecordInfo
+	var data []byte
+	err := db.QueryRow(`
+		SELECT r.accession, r.record_type, r.hash, b.codec, b.size, LENGTH(b.data), r.updated_at, b.data
+		FROM raw_records r
+		JOIN raw_blobs b ON b.hash = r.hash
+		WHERE r.accession = ?
+	`, accession).Scan(&info.Accession, &info.RecordType, &info.Hash, &info.Codec,
+		&info.Size, &info.StoredSize, &info.UpdatedAt, &data)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("raw record not found: %s", accession)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	xml, err := decodeRawBlob(info.Codec, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode raw record %s: %w", accession, err)
+	}
+	if RawRecordHash(xml) != info.Hash {
+		return nil, nil, fmt.Errorf("raw record %s is corrupt: content does not match its hash", accession)
+	}
+	return &info, xml, nil
+}
+
+func decodeRawBlob(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case RawCodecZstd:
+		return rawDecoder.DecodeAll(data, nil)
+	case RawCodecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported codec: %s", codec)
+	}
+}
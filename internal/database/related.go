@@ -0,0 +1,186 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Weights of the cross-reference signals used to rank related studies
+const (
+	relatedWeightSharedID  = 3.0 // Same BioProject or other external identifier
+	relatedWeightCoCited   = 3.0 // Linked to the same publication
+	relatedWeightLinked    = 1.0 // Linked to the same external record
+	relatedWeightCellLine  = 1.0 // Samples from the same cell line
+	relatedCellLineMaxHits = 200 // Cap on cell line matches considered
+)
+
+// RelatedStudy is a study connected to another one by shared cross-references.
+type RelatedStudy struct {
+	Accession string   `json:"accession"`
+	Title     string   `json:"title,omitempty"`
+	Score     float64  `json:"score"`
+	Reasons   []string `json:"reasons"`
+}
+
+// relatedSet accumulates scores and explanations per study.
+type relatedSet map[string]*RelatedStudy
+
+func (r relatedSet) add(accession string, weight float64, reason string) {
+	rel, ok := r[accession]
+	if !ok {
+		rel = &RelatedStudy{Accession: accession}
+		r[accession] = rel
+	}
+	for _, existing := range rel.Reasons {
+		if existing == reason {
+			return
+		}
+	}
+	rel.Score += weight
+	rel.Reasons = append(rel.Reasons, reason)
+}
+
+// RelatedStudies finds studies that share external identifiers (such as a
+// BioProject), publication or database links, or sample cell lines with the
+// given study, ranked by the strength of the shared evidence.
+func (db *DB) RelatedStudies(accession string, limit int) ([]*RelatedStudy, error) {
+	if _, err := db.GetStudy(accession); err != nil {
+		return nil, err
+	}
+
+	related := make(relatedSet)
+	if err := db.relatedByIdentifier(accession, related); err != nil {
+		return nil, fmt.Errorf("failed to match identifiers: %w", err)
+	}
+	if err := db.relatedByLink(accession, related); err != nil {
+		return nil, fmt.Errorf("failed to match links: %w", err)
+	}
+	if err := db.relatedByCellLine(accession, related); err != nil {
+		return nil, fmt.Errorf("failed to match cell lines: %w", err)
+	}
+
+	results := make([]*RelatedStudy, 0, len(related))
+	for _, rel := range related {
+		results = append(results, rel)
+	}
+	SortRelatedStudies(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	for _, rel := range results {
+		db.QueryRow(`SELECT COALESCE(study_title, '') FROM studies WHERE study_accession = ?`,
+			rel.Accession).Scan(&rel.Title)
+	}
+	return results, nil
+}
+
+// SortRelatedStudies orders studies by descending score, then accession.
+func SortRelatedStudies(studies []*RelatedStudy) {
+	sort.Slice(studies, func(i, j int) bool {
+		if studies[i].Score != studies[j].Score {
+			return studies[i].Score > studies[j].Score
+		}
+		return studies[i].Accession < studies[j].Accession
+	})
+}
+
+// relatedByIdentifier matches studies sharing an external identifier.
+func (db *DB) relatedByIdentifier(accession string, related relatedSet) error {
+	rows, err := db.Query(`
+		SELECT DISTINCT other.record_accession, COALESCE(own.id_namespace, ''), own.id_value
+		FROM identifiers own
+		JOIN identifiers other ON other.id_value = own.id_value
+			AND other.record_type = 'study' AND other.record_accession != own.record_accession
+		WHERE own.record_type = 'study' AND own.record_accession = ? AND own.id_type = 'external'
+	`, accession)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var other, namespace, value string
+		if err := rows.Scan(&other, &namespace, &value); err != nil {
+			return err
+		}
+		if namespace == "" {
+			namespace = "identifier"
+		}
+		related.add(other, relatedWeightSharedID, fmt.Sprintf("shares %s %s", namespace, value))
+	}
+	return rows.Err()
+}
+
+// relatedByLink matches studies linked to the same external record.
+// Shared PubMed links mean the studies are cited by the same publication.
+func (db *DB) relatedByLink(accession string, related relatedSet) error {
+	rows, err := db.Query(`
+		SELECT DISTINCT other.record_accession, own.db, own.id
+		FROM links own
+		JOIN links other ON other.db = own.db AND other.id = own.id
+			AND other.record_type = 'study' AND other.record_accession != own.record_accession
+		WHERE own.record_type = 'study' AND own.record_accession = ?
+			AND COALESCE(own.db, '') != '' AND COALESCE(own.id, '') != ''
+	`, accession)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var other, linkDB, id string
+		if err := rows.Scan(&other, &linkDB, &id); err != nil {
+			return err
+		}
+		if strings.EqualFold(linkDB, "pubmed") {
+			related.add(other, relatedWeightCoCited, fmt.Sprintf("co-cited in PubMed %s", id))
+		} else {
+			related.add(other, relatedWeightLinked, fmt.Sprintf("linked to %s %s", linkDB, id))
+		}
+	}
+	return rows.Err()
+}
+
+// relatedCellLines selects the studies with samples from a cell line of
+// the samples of a study, up to a limit. The study's cell lines are looked
+// up first, then the samples sharing one through the (tag, value) index of
+// sample_attributes, so that only those samples are read; the joins are
+// ordered to keep SQLite from scanning every cell line attribute instead.
+const relatedCellLines = `
+		WITH own AS (
+			SELECT DISTINCT a.value AS cell_line
+			FROM experiments e
+			CROSS JOIN experiment_samples es ON es.experiment_accession = e.experiment_accession
+			CROSS JOIN sample_attributes a INDEXED BY idx_sample_attributes_sample
+				ON a.sample_accession = es.sample_accession
+			WHERE e.study_accession = ? AND a.tag = 'cell_line' AND a.value != ''
+		)
+		SELECT DISTINCT e.study_accession, own.cell_line
+		FROM own
+		CROSS JOIN sample_attributes a INDEXED BY idx_sample_attributes_value
+			ON a.tag = 'cell_line' AND a.value = own.cell_line COLLATE NOCASE
+		CROSS JOIN experiment_samples es ON es.sample_accession = a.sample_accession
+		CROSS JOIN experiments e ON e.experiment_accession = es.experiment_accession
+		WHERE e.study_accession != ?
+		ORDER BY e.study_accession
+		LIMIT ?`
+
+// relatedByCellLine matches studies with samples from the same cell line.
+func (db *DB) relatedByCellLine(accession string, related relatedSet) error {
+	rows, err := db.Query(relatedCellLines, accession, accession, relatedCellLineMaxHits)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var other, cellLine string
+		if err := rows.Scan(&other, &cellLine); err != nil {
+			return err
+		}
+		related.add(other, relatedWeightCellLine, fmt.Sprintf("same cell line %s", cellLine))
+	}
+	return rows.Err()
+}
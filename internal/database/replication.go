@@ -0,0 +1,204 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Open modes, see OpenOptions
+const (
+	ModePrimary = "primary" // Reads and writes; the only node that ingests
+	ModeReplica = "replica" // Only reads a copy kept by the replication tool
+)
+
+// Replication tools a database can be replicated with
+const (
+	ReplicationLitestream = "litestream"
+	ReplicationLiteFS     = "litefs"
+)
+
+// liteFSPrimaryFile is the file LiteFS keeps in its mount on replicas,
+// holding the hostname of the primary; it is absent on the primary
+const liteFSPrimaryFile = ".primary"
+
+// OpenOptions set how a database is opened when it is replicated to other
+// nodes, such as API servers scaled out behind a load balancer
+type OpenOptions struct {
+	// Mode is ModePrimary, the default, or ModeReplica. A replica opens
+	// the database read-only and leaves its schema as the primary wrote it.
+	Mode string
+
+	// Replication is ReplicationLitestream, ReplicationLiteFS, or empty
+	// when the database is not replicated. Litestream copies the WAL
+	// before it is checkpointed, so a primary leaves checkpoints to it;
+	// LiteFS serves the file through FUSE, so it is read without memory
+	// maps that would miss the pages LiteFS changes underneath.
+	Replication string
+}
+
+func (o OpenOptions) validate() error {
+	switch o.Mode {
+	case "", ModePrimary, ModeReplica:
+	default:
+		return fmt.Errorf("invalid database mode: %s (must be %s or %s)", o.Mode, ModePrimary, ModeReplica)
+	}
+	switch o.Replication {
+	case "", ReplicationLitestream, ReplicationLiteFS:
+	default:
+		return fmt.Errorf("invalid database replication: %s (must be %s or %s)", o.Replication, ReplicationLitestream, ReplicationLiteFS)
+	}
+	return nil
+}
+
+// Open opens the database at path in the mode of opts. Primaries create and
+// migrate the schema as Initialize does; under LiteFS, opening as primary
+// fails on a node LiteFS has not made the primary, whose mount refuses
+// writes. Replicas need the file to exist with its schema, since they
+// never write.
+func Open(path string, opts OpenOptions) (*DB, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Mode == ModeReplica {
+		return openReplica(path, opts)
+	}
+	if opts.Replication == ReplicationLiteFS {
+		primary, err := LiteFSPrimary(path)
+		if err != nil {
+			return nil, err
+		}
+		if primary != "" {
+			return nil, fmt.Errorf("LiteFS reports %s as the primary of %s; write to the database there", primary, path)
+		}
+	}
+	return openPrimary(path, opts)
+}
+
+// openReplica opens the database at path read-only
+func openReplica(path string, opts OpenOptions) (*DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("replica database not found: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_query_only=true&_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Only the pragmas that tune reads; the rest change the file
+	pragmas := []string{
+		"PRAGMA cache_size = 100000",
+		"PRAGMA temp_store = MEMORY",
+		"PRAGMA mmap_size = 1073741824",
+		"PRAGMA busy_timeout = 10000",
+	}
+	pragmas = replicationPragmas(pragmas, opts.Replication)
+	for _, pragma := range pragmas {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set pragma %s: %w", pragma, err)
+		}
+	}
+
+	// The primary creates the schema; a copy without it has not been
+	// replicated yet
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'studies'`).Scan(&tables); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read replica database: %w", err)
+	}
+	if tables == 0 {
+		db.Close()
+		return nil, fmt.Errorf("replica database %s has no srake tables; ingest on the primary first", path)
+	}
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	return &DB{
+		DB:          db,
+		path:        path,
+		readOnly:    true,
+		replication: opts.Replication,
+		dbState:     &dbState{},
+	}, nil
+}
+
+// replicationPragmas adjusts the pragmas a database is opened with to the
+// tool replicating it
+func replicationPragmas(pragmas []string, replication string) []string {
+	adjusted := make([]string, 0, len(pragmas))
+	for _, pragma := range pragmas {
+		switch {
+		case replication == ReplicationLitestream && strings.HasPrefix(pragma, "PRAGMA wal_checkpoint "):
+			continue
+		case replication == ReplicationLitestream && strings.HasPrefix(pragma, "PRAGMA wal_autocheckpoint "):
+			pragma = "PRAGMA wal_autocheckpoint = 0"
+		case replication == ReplicationLiteFS && strings.HasPrefix(pragma, "PRAGMA mmap_size "):
+			pragma = "PRAGMA mmap_size = 0"
+		}
+		adjusted = append(adjusted, pragma)
+	}
+	return adjusted
+}
+
+// ReadOnly reports whether the database was opened as a replica
+func (db *DB) ReadOnly() bool {
+	return db.readOnly
+}
+
+// LiteFSPrimary returns the hostname of the LiteFS primary of the database
+// at path, or "" when this node is the primary
+func LiteFSPrimary(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), liteFSPrimaryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the LiteFS primary: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ReplicationStatus describes the replication of a database, for health
+// checks
+type ReplicationStatus struct {
+	Mode        string `json:"mode"`
+	Replication string `json:"replication,omitempty"`
+	// Primary is the LiteFS primary, when this node is not it
+	Primary string `json:"primary,omitempty"`
+	// LastChange is when the database or its WAL last changed, on a
+	// replica when a change from the primary last arrived
+	LastChange time.Time `json:"last_change"`
+}
+
+// ReplicationStatus reports how the database is replicated and when it
+// last changed
+func (db *DB) ReplicationStatus() (*ReplicationStatus, error) {
+	status := &ReplicationStatus{Mode: ModePrimary, Replication: db.replication}
+	if db.readOnly {
+		status.Mode = ModeReplica
+	}
+	if db.replication == ReplicationLiteFS {
+		primary, err := LiteFSPrimary(db.path)
+		if err != nil {
+			return nil, err
+		}
+		status.Primary = primary
+	}
+
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return nil, err
+	}
+	status.LastChange = info.ModTime()
+	if wal, err := os.Stat(db.path + "-wal"); err == nil && wal.ModTime().After(status.LastChange) {
+		status.LastChange = wal.ModTime()
+	}
+	return status, nil
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Identifier types of run files, reported by LookupRunFiles
+const (
+	IDTypeFilename = "filename"
+	IDTypeMD5      = "md5"
+)
+
+// RunFile is a data file of a run, from the DATA_BLOCK of its XML
+type RunFile struct {
+	RunAccession string `json:"run_accession"`
+	Filename     string `json:"filename"`
+	FileType     string `json:"filetype,omitempty"`
+	MD5          string `json:"md5,omitempty"` // lower case hex
+}
+
+// SetRunFiles replaces the files of the given runs with files, in a single
+// transaction. Runs without files lose any they had from an earlier ingest.
+func (db *DB) SetRunFiles(runs []string, files []RunFile) error {
+	tx, err := db.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	del, err := tx.Prepare(`DELETE FROM run_files WHERE run_accession = ?`)
+	if err != nil {
+		return err
+	}
+	defer del.Close()
+	for _, run := range runs {
+		if _, err := del.Exec(run); err != nil {
+			return err
+		}
+	}
+
+	ins, err := tx.Prepare(`
+		INSERT OR REPLACE INTO run_files (run_accession, filename, filetype, md5)
+		VALUES (?, ?, ?, NULLIF(?, ''))
+	`)
+	if err != nil {
+		return err
+	}
+	defer ins.Close()
+	for _, f := range files {
+		if _, err := ins.Exec(f.RunAccession, f.Filename, f.FileType, strings.ToLower(f.MD5)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LookupRunFiles finds the runs with a file of the given name or MD5
+// checksum, as idType says. Only exact matches are returned, ignoring the
+// case of checksums; a checksum match reports the name of the file in
+// Namespace.
+func (db *DB) LookupRunFiles(idType, value string, limit int) ([]IdentifierMatch, error) {
+	value = strings.TrimSpace(value)
+	var column string
+	switch idType {
+	case IDTypeFilename:
+		column = "filename"
+	case IDTypeMD5:
+		column, value = "md5", strings.ToLower(value)
+	default:
+		return nil, fmt.Errorf("unknown run file identifier type: %s", idType)
+	}
+	if value == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+
+	// #nosec G201 - column is one of two fixed names
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT run_accession, filename
+		FROM run_files
+		WHERE %s = ?
+		ORDER BY run_accession, filename
+		LIMIT ?
+	`, column), value, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []IdentifierMatch
+	for rows.Next() {
+		var run, filename string
+		if err := rows.Scan(&run, &filename); err != nil {
+			return nil, err
+		}
+		m := IdentifierMatch{Accession: run, RecordType: "run", IDType: idType, Value: value,
+			Match: MatchExact, Score: matchScores[MatchExact]}
+		if idType == IDTypeMD5 {
+			m.Namespace = filename
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
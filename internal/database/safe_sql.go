@@ -22,14 +22,26 @@ var AllowedTables = map[string]bool{
 	"identifiers":        true,
 	"links":              true,
 	"experiment_samples": true,
+	"sample_runs":        true,
+	"sample_attributes":  true,
+	"taxonomy":           true,
+
+	// Local curation tables
+	"curations":          true,
+	"collections":        true,
+	"collection_members": true,
+	"search_feedback":    true,
+	"qc_flags":           true,
 
 	// FTS5 virtual tables
-	"fts_accessions": true,
-	"fts_samples":    true,
-	"fts_runs":       true,
+	"fts_accessions":        true,
+	"fts_samples":           true,
+	"fts_runs":              true,
+	"fts_accession_trigram": true,
 
 	// System tables
 	"statistics":     true,
+	"sketches":       true,
 	"sync_status":    true,
 	"progress":       true,
 	"index_progress": true,
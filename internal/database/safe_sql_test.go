@@ -172,7 +172,7 @@ func TestAllAllowedTables(t *testing.T) {
 		"studies", "experiments", "samples", "runs",
 		"submissions", "analyses", "sample_pool",
 		"identifiers", "links", "experiment_samples",
-		"fts_accessions", "fts_samples", "fts_runs",
+		"fts_accessions", "fts_samples", "fts_runs", "fts_accession_trigram",
 		"statistics", "sync_status", "progress", "index_progress",
 	}
 
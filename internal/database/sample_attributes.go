@@ -0,0 +1,392 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SampleAttribute is one tag/value pair of a sample's attribute list.
+type SampleAttribute struct {
+	SampleAccession string `json:"sample_accession,omitempty"`
+	Tag             string `json:"tag"`
+	Value           string `json:"value"`
+	Units           string `json:"units,omitempty"`
+}
+
+// Attribute condition operators. Ordering operators compare the leading
+// number of the value, so "age>40" matches "52 years"; the others compare
+// the text, ignoring case.
+const (
+	AttrOpEq       = "="
+	AttrOpNe       = "!="
+	AttrOpGt       = ">"
+	AttrOpGe       = ">="
+	AttrOpLt       = "<"
+	AttrOpLe       = "<="
+	AttrOpContains = "~"
+)
+
+// attrOps lists the condition operators
+var attrOps = []string{AttrOpNe, AttrOpGe, AttrOpLe, AttrOpEq, AttrOpGt, AttrOpLt, AttrOpContains}
+
+// AttributeCondition restricts samples to those with an attribute whose
+// value satisfies the operator. An empty Op only requires the tag.
+type AttributeCondition struct {
+	Tag   string `json:"tag"`
+	Op    string `json:"op,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// AttributeMatch is a sample matching attribute conditions, with its values
+// of the conditions' tags.
+type AttributeMatch struct {
+	SampleAccession string            `json:"sample_accession"`
+	Organism        string            `json:"organism,omitempty"`
+	Attributes      []SampleAttribute `json:"attributes"`
+}
+
+// leadingNumber matches the number a value starts with, e.g. 52 in "52 years"
+var leadingNumber = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?`)
+
+// NormalizeAttributeTag folds the spellings submitters use for a tag, such
+// as "Cell Type" and "cell_type", to one form.
+func NormalizeAttributeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(tag, "_", " "))), "_")
+}
+
+// attributeNumber returns the leading number of a value
+func attributeNumber(value string) (float64, bool) {
+	m := leadingNumber.FindString(strings.TrimSpace(value))
+	if m == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(m, 64)
+	return n, err == nil
+}
+
+// ParseAttributeCondition parses a condition such as "tissue=liver",
+// "age>=40", "disease~carcinoma" or a bare tag.
+func ParseAttributeCondition(expr string) (AttributeCondition, error) {
+	expr = strings.TrimSpace(expr)
+	pos, op := -1, ""
+	for _, candidate := range attrOps {
+		if i := strings.Index(expr, candidate); i >= 0 && (pos < 0 || i < pos || (i == pos && len(candidate) > len(op))) {
+			pos, op = i, candidate
+		}
+	}
+
+	cond := AttributeCondition{Tag: expr}
+	if pos >= 0 {
+		cond = AttributeCondition{
+			Tag:   strings.TrimSpace(expr[:pos]),
+			Op:    op,
+			Value: strings.TrimSpace(expr[pos+len(op):]),
+		}
+	}
+	cond.Tag = NormalizeAttributeTag(cond.Tag)
+	if cond.Tag == "" {
+		return cond, fmt.Errorf("attribute condition %q has no tag", expr)
+	}
+	switch cond.Op {
+	case AttrOpGt, AttrOpGe, AttrOpLt, AttrOpLe:
+		if _, ok := attributeNumber(cond.Value); !ok {
+			return cond, fmt.Errorf("attribute condition %q compares with %q, which is not a number", expr, cond.Value)
+		}
+	}
+	return cond, nil
+}
+
+// sql returns the condition as a query over sample_attributes selecting
+// sample accessions
+func (c AttributeCondition) sql() (string, []interface{}) {
+	query := `SELECT sample_accession FROM sample_attributes WHERE tag = ?`
+	args := []interface{}{c.Tag}
+	switch c.Op {
+	case AttrOpEq:
+		query += ` AND value = ? COLLATE NOCASE`
+		args = append(args, c.Value)
+	case AttrOpNe:
+		query += ` AND value != ? COLLATE NOCASE`
+		args = append(args, c.Value)
+	case AttrOpContains:
+		query += ` AND value LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(c.Value)+"%")
+	case AttrOpGt, AttrOpGe, AttrOpLt, AttrOpLe:
+		n, _ := attributeNumber(c.Value)
+		query += ` AND value_num ` + c.Op + ` ?`
+		args = append(args, n)
+	}
+	return query, args
+}
+
+// escapeLike escapes the LIKE wildcards of a literal
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// sampleAttributes returns the attribute list of a sample, from its
+// SampleAttributes column or, failing that, the attributes in its metadata
+func sampleAttributes(sample *Sample) []SampleAttribute {
+	var attrs []SampleAttribute
+	if sample.SampleAttributes != "" {
+		if json.Unmarshal([]byte(sample.SampleAttributes), &attrs) == nil {
+			return attrs
+		}
+	}
+	var meta struct {
+		Attributes []SampleAttribute `json:"attributes"`
+	}
+	if sample.Metadata != "" && json.Unmarshal([]byte(sample.Metadata), &meta) == nil {
+		return meta.Attributes
+	}
+	return nil
+}
+
+// replaceSampleAttributes replaces the sample_attributes rows of a sample
+func replaceSampleAttributes(tx writeTx, accession string, attrs []SampleAttribute) error {
+	if _, err := tx.Exec(`DELETE FROM sample_attributes WHERE sample_accession = ?`, accession); err != nil {
+		return err
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO sample_attributes (sample_accession, tag, value, units, value_num) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, a := range attrs {
+		tag := NormalizeAttributeTag(a.Tag)
+		if tag == "" {
+			continue
+		}
+		value := strings.TrimSpace(a.Value)
+		var num interface{}
+		if n, ok := attributeNumber(value); ok {
+			num = n
+		}
+		if _, err := stmt.Exec(accession, tag, value, strings.TrimSpace(a.Units), num); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildSampleAttributes recomputes the sample_attributes rows of the
+// samples whose metadata keeps their attribute list, and returns the number
+// of rows in the table. Databases ingested before the table existed need it
+// once; rows of samples ingested without the list in their metadata are
+// left alone.
+func (db *DB) RebuildSampleAttributes() (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT sample_accession, metadata FROM samples
+		WHERE json_valid(metadata) AND json_type(metadata, '$.attributes') = 'array'`)
+	if err != nil {
+		return 0, err
+	}
+	type sampleMeta struct{ accession, metadata string }
+	var samples []sampleMeta
+	for rows.Next() {
+		var s sampleMeta
+		if err := rows.Scan(&s.accession, &s.metadata); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		samples = append(samples, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, s := range samples {
+		attrs := sampleAttributes(&Sample{Metadata: s.metadata})
+		if err := replaceSampleAttributes(tx, s.accession, attrs); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int64
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM sample_attributes`).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// QuerySampleAttributes returns the samples satisfying every condition,
+// ordered by accession, with their values of the conditions' tags, and the
+// total number of matching samples.
+func (db *DB) QuerySampleAttributes(conditions []AttributeCondition, limit, offset int) ([]AttributeMatch, int, error) {
+	if len(conditions) == 0 {
+		return nil, 0, fmt.Errorf("at least one attribute condition is required")
+	}
+
+	var parts []string
+	var args []interface{}
+	var tags []interface{}
+	seenTag := make(map[string]bool)
+	for _, c := range conditions {
+		query, condArgs := c.sql()
+		parts = append(parts, query)
+		args = append(args, condArgs...)
+		if !seenTag[c.Tag] {
+			seenTag[c.Tag] = true
+			tags = append(tags, c.Tag)
+		}
+	}
+	matching := strings.Join(parts, "\nINTERSECT\n")
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM (`+matching+`)`, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := db.Query(`
+		SELECT m.sample_accession, COALESCE(s.organism, '')
+		FROM (`+matching+`) m
+		LEFT JOIN samples s ON s.sample_accession = m.sample_accession
+		ORDER BY m.sample_accession
+		LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	var matches []AttributeMatch
+	index := make(map[string]int)
+	for rows.Next() {
+		var m AttributeMatch
+		if err := rows.Scan(&m.SampleAccession, &m.Organism); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		index[m.SampleAccession] = len(matches)
+		matches = append(matches, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(matches) == 0 {
+		return matches, total, err
+	}
+
+	// The values of the queried tags, for display
+	accessions := make([]interface{}, len(matches))
+	for i, m := range matches {
+		accessions[i] = m.SampleAccession
+	}
+	rows, err = db.Query(`
+		SELECT sample_accession, tag, COALESCE(value, ''), COALESCE(units, '')
+		FROM sample_attributes
+		WHERE sample_accession IN (`+placeholders(len(accessions))+`)
+			AND tag IN (`+placeholders(len(tags))+`)
+		ORDER BY rowid`, append(accessions, tags...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a SampleAttribute
+		var accession string
+		if err := rows.Scan(&accession, &a.Tag, &a.Value, &a.Units); err != nil {
+			return nil, 0, err
+		}
+		m := &matches[index[accession]]
+		m.Attributes = append(m.Attributes, a)
+	}
+	return matches, total, rows.Err()
+}
+
+// AttributeTagCount is a sample attribute tag and the number of samples
+// that have it.
+type AttributeTagCount struct {
+	Tag     string `json:"tag"`
+	Samples int    `json:"samples"`
+}
+
+// ListAttributeTags returns the most common attribute tags, optionally
+// those starting with prefix.
+func (db *DB) ListAttributeTags(prefix string, limit int) ([]AttributeTagCount, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.Query(`
+		SELECT tag, COUNT(DISTINCT sample_accession) AS n
+		FROM sample_attributes
+		WHERE tag LIKE ? ESCAPE '\'
+		GROUP BY tag
+		ORDER BY n DESC, tag
+		LIMIT ?`, escapeLike(NormalizeAttributeTag(prefix))+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []AttributeTagCount
+	for rows.Next() {
+		var t AttributeTagCount
+		if err := rows.Scan(&t.Tag, &t.Samples); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// GetSampleAttributes returns the attributes with the given tags of the
+// given samples, keyed by sample accession.
+func (db *DB) GetSampleAttributes(accessions, tags []string) (map[string][]SampleAttribute, error) {
+	result := make(map[string][]SampleAttribute)
+	if len(accessions) == 0 || len(tags) == 0 {
+		return result, nil
+	}
+
+	tagArgs := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		tagArgs[i] = NormalizeAttributeTag(tag)
+	}
+
+	// Stay well under SQLite's bound parameter limit
+	const chunk = 500
+	for start := 0; start < len(accessions); start += chunk {
+		end := min(start+chunk, len(accessions))
+		args := make([]interface{}, 0, end-start+len(tagArgs))
+		for _, acc := range accessions[start:end] {
+			args = append(args, acc)
+		}
+		args = append(args, tagArgs...)
+
+		rows, err := db.Query(`
+			SELECT sample_accession, tag, COALESCE(value, ''), COALESCE(units, '')
+			FROM sample_attributes
+			WHERE sample_accession IN (`+placeholders(end-start)+`)
+				AND tag IN (`+placeholders(len(tagArgs))+`)
+			ORDER BY rowid`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var a SampleAttribute
+			if err := rows.Scan(&a.SampleAccession, &a.Tag, &a.Value, &a.Units); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			result[a.SampleAccession] = append(result[a.SampleAccession], a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
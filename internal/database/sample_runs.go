@@ -0,0 +1,123 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// SampleRun links a sample to a run of an experiment that sequenced it.
+type SampleRun struct {
+	SampleAccession     string `json:"sample_accession"`
+	RunAccession        string `json:"run_accession"`
+	ExperimentAccession string `json:"experiment_accession"`
+	StudyAccession      string `json:"study_accession,omitempty"`
+}
+
+// sampleRunsSelect joins the normalized tables into sample_runs rows
+const sampleRunsSelect = `
+	SELECT es.sample_accession, r.run_accession, r.experiment_accession, e.study_accession
+	FROM runs r
+	JOIN experiment_samples es ON es.experiment_accession = r.experiment_accession
+	LEFT JOIN experiments e ON e.experiment_accession = r.experiment_accession`
+
+// RefreshSampleRuns rebuilds the sample_runs rows of the given experiments
+// from their runs and sample links, in a single transaction. The ingest
+// calls it for every batch of experiments and runs, so the table stays
+// current whichever of the two arrives first.
+func (db *DB) RefreshSampleRuns(experiments []string) error {
+	// A bulk load rebuilds the whole table when it finishes
+	if db.bulk.Load() != nil {
+		return nil
+	}
+
+	tx, err := db.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	del, err := tx.Prepare(`DELETE FROM sample_runs WHERE experiment_accession = ?`)
+	if err != nil {
+		return err
+	}
+	defer del.Close()
+
+	ins, err := tx.Prepare(`INSERT OR REPLACE INTO sample_runs (sample_accession, run_accession, experiment_accession, study_accession)` +
+		sampleRunsSelect + `
+	WHERE r.experiment_accession = ?`)
+	if err != nil {
+		return err
+	}
+	defer ins.Close()
+
+	for _, exp := range experiments {
+		if _, err := del.Exec(exp); err != nil {
+			return err
+		}
+		if _, err := ins.Exec(exp); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RebuildSampleRuns recomputes the whole sample_runs table and returns the
+// number of rows.
+func (db *DB) RebuildSampleRuns() (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM sample_runs`); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`INSERT OR REPLACE INTO sample_runs (sample_accession, run_accession, experiment_accession, study_accession)` + sampleRunsSelect)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, tx.Commit()
+}
+
+// backfillSampleRuns fills an empty sample_runs table from databases
+// ingested before it was added. It does nothing once the table has rows.
+func backfillSampleRuns(db *sql.DB) error {
+	_, err := db.Exec(`INSERT OR IGNORE INTO sample_runs (sample_accession, run_accession, experiment_accession, study_accession)` +
+		sampleRunsSelect + `
+	WHERE NOT EXISTS (SELECT 1 FROM sample_runs)`)
+	return err
+}
+
+// GetSampleRuns returns the runs of a sample, ordered by run accession.
+func (db *DB) GetSampleRuns(sampleAccession string) ([]SampleRun, error) {
+	return db.querySampleRuns(`WHERE sample_accession = ?`, sampleAccession)
+}
+
+// GetRunSamples returns the samples sequenced by a run.
+func (db *DB) GetRunSamples(runAccession string) ([]SampleRun, error) {
+	return db.querySampleRuns(`WHERE run_accession = ?`, runAccession)
+}
+
+func (db *DB) querySampleRuns(where string, arg string) ([]SampleRun, error) {
+	rows, err := db.Query(`
+		SELECT sample_accession, run_accession, experiment_accession, COALESCE(study_accession, '')
+		FROM sample_runs
+		`+where+`
+		ORDER BY run_accession, sample_accession`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []SampleRun
+	for rows.Next() {
+		var l SampleRun
+		if err := rows.Scan(&l.SampleAccession, &l.RunAccession, &l.ExperimentAccession, &l.StudyAccession); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
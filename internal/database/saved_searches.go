@@ -0,0 +1,202 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SavedSearch is a search stored by name to be run again. Filters are
+// 'srake search' flags and their values, so that a saved search runs as it
+// was typed.
+type SavedSearch struct {
+	Name       string            `json:"name"`
+	Query      string            `json:"query"`
+	Filters    map[string]string `json:"filters,omitempty"`
+	Seen       int               `json:"seen"`       // records matched by its watch runs
+	Generation Generation        `json:"generation"` // database generation of the last watch run
+	LastRunAt  time.Time         `json:"last_run_at,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// SavedSearchHit is a record matched by a saved search, with the time a
+// watch run first matched it
+type SavedSearchHit struct {
+	Accession   string    `json:"accession"`
+	RecordType  string    `json:"record_type,omitempty"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+}
+
+// SaveSearch stores a saved search. An existing search of the same name is
+// only replaced when replace is set, and then forgets the records it has
+// seen.
+func (db *DB) SaveSearch(s *SavedSearch, replace bool) error {
+	filters, err := json.Marshal(s.Filters)
+	if err != nil {
+		return err
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now().UTC()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM saved_searches WHERE name = ?)`, s.Name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		if !replace {
+			return fmt.Errorf("saved search already exists: %s", s.Name)
+		}
+		if _, err := tx.Exec(`DELETE FROM saved_search_hits WHERE search_name = ?`, s.Name); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO saved_searches (name, query, filters, created_at)
+		VALUES (?, ?, ?, ?)
+	`, s.Name, s.Query, string(filters), s.CreatedAt)
+	if err != nil {
+		return err
+	}
+	s.Seen = 0
+	s.Generation = Generation{}
+	s.LastRunAt = time.Time{}
+	return tx.Commit()
+}
+
+// GetSavedSearch retrieves a saved search with the number of records it
+// has seen
+func (db *DB) GetSavedSearch(name string) (*SavedSearch, error) {
+	s, err := scanSavedSearch(db.QueryRow(`
+		SELECT s.name, s.query, s.filters, s.db_records, s.db_updated_at, s.last_run_at, s.created_at,
+			   (SELECT COUNT(*) FROM saved_search_hits h WHERE h.search_name = s.name)
+		FROM saved_searches s
+		WHERE s.name = ?
+	`, name))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("saved search not found: %s", name)
+	}
+	return s, err
+}
+
+// ListSavedSearches returns all saved searches ordered by name
+func (db *DB) ListSavedSearches() ([]SavedSearch, error) {
+	rows, err := db.Query(`
+		SELECT s.name, s.query, s.filters, s.db_records, s.db_updated_at, s.last_run_at, s.created_at,
+			   COUNT(h.accession)
+		FROM saved_searches s
+		LEFT JOIN saved_search_hits h ON h.search_name = s.name
+		GROUP BY s.name
+		ORDER BY s.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var searches []SavedSearch
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, *s)
+	}
+	return searches, rows.Err()
+}
+
+func scanSavedSearch(row rowScanner) (*SavedSearch, error) {
+	s := &SavedSearch{}
+	var filters sql.NullString
+	var updatedAt, lastRunAt sql.NullTime
+	if err := row.Scan(&s.Name, &s.Query, &filters, &s.Generation.Records, &updatedAt, &lastRunAt, &s.CreatedAt, &s.Seen); err != nil {
+		return nil, err
+	}
+	if filters.Valid && filters.String != "" {
+		if err := json.Unmarshal([]byte(filters.String), &s.Filters); err != nil {
+			return nil, fmt.Errorf("invalid filters for saved search %s: %w", s.Name, err)
+		}
+	}
+	s.Generation.UpdatedAt = updatedAt.Time
+	s.LastRunAt = lastRunAt.Time
+	return s, nil
+}
+
+// DeleteSavedSearch removes a saved search and the records it has seen
+func (db *DB) DeleteSavedSearch(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM saved_searches WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("saved search not found: %s", name)
+	}
+	if _, err := tx.Exec(`DELETE FROM saved_search_hits WHERE search_name = ?`, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordSavedSearchRun stores the records matched by a watch run of a saved
+// search against a database generation, and returns those no earlier run
+// matched, in the order given. Records that no longer match are kept, so
+// that a record leaving and coming back is not reported twice.
+func (db *DB) RecordSavedSearchRun(name string, generation Generation, hits []SavedSearchHit) ([]SavedSearchHit, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var updatedAt interface{}
+	if !generation.UpdatedAt.IsZero() {
+		updatedAt = generation.UpdatedAt
+	}
+	result, err := tx.Exec(`
+		UPDATE saved_searches SET db_records = ?, db_updated_at = ?, last_run_at = ?
+		WHERE name = ?
+	`, generation.Records, updatedAt, now, name)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("saved search not found: %s", name)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO saved_search_hits (search_name, accession, record_type, first_seen_at)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	added := []SavedSearchHit{}
+	for _, h := range hits {
+		result, err := stmt.Exec(name, h.Accession, h.RecordType, now)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			h.FirstSeenAt = now
+			added = append(added, h)
+		}
+	}
+	return added, tx.Commit()
+}
@@ -0,0 +1,318 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nishad/srake/internal/sketch"
+)
+
+// Sketch dimensions. The record dimensions estimate the number of records of
+// each kind; the others the number of distinct values of a facet.
+const (
+	SketchStudies           = "studies"
+	SketchExperiments       = "experiments"
+	SketchSamples           = "samples"
+	SketchRuns              = "runs"
+	SketchOrganisms         = "organism"
+	SketchStudyTypes        = "study_type"
+	SketchPlatforms         = "platform"
+	SketchLibraryStrategies = "library_strategy"
+	SketchLibrarySources    = "library_source"
+	SketchInstrumentModels  = "instrument_model"
+)
+
+// sketchDimension names a dimension and the query listing its values in a
+// column v
+type sketchDimension struct {
+	name   string
+	source string
+}
+
+// sketchDimensions lists the dimensions kept in the sketches table
+var sketchDimensions = []sketchDimension{
+	{SketchStudies, `SELECT study_accession AS v FROM studies`},
+	{SketchExperiments, `SELECT experiment_accession AS v FROM experiments`},
+	{SketchSamples, `SELECT sample_accession AS v FROM samples`},
+	{SketchRuns, `SELECT run_accession AS v FROM runs`},
+	{SketchOrganisms, `SELECT organism AS v FROM studies UNION ALL SELECT organism AS v FROM samples`},
+	{SketchStudyTypes, `SELECT study_type AS v FROM studies`},
+	{SketchPlatforms, `SELECT platform AS v FROM experiments`},
+	{SketchLibraryStrategies, `SELECT library_strategy AS v FROM experiments`},
+	{SketchLibrarySources, `SELECT library_source AS v FROM experiments`},
+	{SketchInstrumentModels, `SELECT instrument_model AS v FROM experiments`},
+}
+
+// DistinctCount is the number of distinct values of a sketch dimension.
+type DistinctCount struct {
+	Dimension   string `json:"dimension"`
+	Count       int64  `json:"count"`
+	Approximate bool   `json:"approximate"`
+}
+
+// observe adds values to the in-memory sketch of a dimension. Ingest calls
+// it for every record; FlushSketches writes the sketches to the database.
+func (db *DB) observe(dimension string, values ...string) {
+	db.sketchMu.Lock()
+	defer db.sketchMu.Unlock()
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		if db.sketches == nil {
+			db.sketches = make(map[string]*sketch.HLL)
+		}
+		h, ok := db.sketches[dimension]
+		if !ok {
+			h = sketch.New(sketch.DefaultPrecision)
+			db.sketches[dimension] = h
+		}
+		h.Add(v)
+	}
+}
+
+// observeStudy, observeExperiment, observeSample and observeRun record an
+// inserted record in the sketches
+func (db *DB) observeStudy(s *Study) {
+	db.observe(SketchStudies, s.StudyAccession)
+	db.observe(SketchOrganisms, s.Organism)
+	db.observe(SketchStudyTypes, s.StudyType)
+}
+
+func (db *DB) observeExperiment(e *Experiment) {
+	db.observe(SketchExperiments, e.ExperimentAccession)
+	db.observe(SketchPlatforms, e.Platform)
+	db.observe(SketchLibraryStrategies, e.LibraryStrategy)
+	db.observe(SketchLibrarySources, e.LibrarySource)
+	db.observe(SketchInstrumentModels, e.InstrumentModel)
+}
+
+func (db *DB) observeSample(s *Sample) {
+	db.observe(SketchSamples, s.SampleAccession)
+	db.observe(SketchOrganisms, s.Organism)
+}
+
+func (db *DB) observeRun(r *Run) {
+	db.observe(SketchRuns, r.RunAccession)
+}
+
+// FlushSketches merges the sketches of records inserted since the last
+// flush into those stored in the sketches table. A dimension without a
+// stored sketch, as in databases ingested before sketches were kept, is
+// built from the records themselves instead.
+func (db *DB) FlushSketches() error {
+	db.sketchMu.Lock()
+	pending := db.sketches
+	db.sketches = nil
+	db.sketchMu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := db.flushSketches(pending)
+	if err != nil {
+		// Keep the values for the next flush
+		db.sketchMu.Lock()
+		for name, h := range db.sketches {
+			if p, ok := pending[name]; ok {
+				p.Merge(h) // precision is always the default
+			} else {
+				pending[name] = h
+			}
+		}
+		db.sketches = pending
+		db.sketchMu.Unlock()
+	}
+	return err
+}
+
+func (db *DB) flushSketches(pending map[string]*sketch.HLL) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, dim := range sketchDimensions {
+		h, ok := pending[dim.name]
+		if !ok {
+			continue
+		}
+		stored, err := loadSketch(tx, dim.name)
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			if h, err = buildSketch(tx, dim); err != nil {
+				return fmt.Errorf("failed to build %s sketch: %w", dim.name, err)
+			}
+		} else if err := h.Merge(stored); err != nil {
+			return err
+		}
+		if err := storeSketch(tx, dim.name, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RebuildSketches rebuilds every sketch from the records, dropping values
+// of records that have since been deleted.
+func (db *DB) RebuildSketches() error {
+	db.sketchMu.Lock()
+	db.sketches = nil
+	db.sketchMu.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, dim := range sketchDimensions {
+		h, err := buildSketch(tx, dim)
+		if err != nil {
+			return fmt.Errorf("failed to build %s sketch: %w", dim.name, err)
+		}
+		if err := storeSketch(tx, dim.name, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DistinctCounts returns the number of distinct values of every sketch
+// dimension. Estimates come from the stored sketches, merged with those of
+// records not yet flushed, and are typically within 1% of the exact count.
+// With exact, or for dimensions without a stored sketch, the values are
+// counted, which takes minutes on a full SRA database.
+func (db *DB) DistinctCounts(exact bool) ([]DistinctCount, error) {
+	counts := make([]DistinctCount, 0, len(sketchDimensions))
+	for _, dim := range sketchDimensions {
+		c, err := db.distinctCount(dim, exact)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, nil
+}
+
+// EstimateStats returns the record counts of GetStats estimated from the
+// sketches, falling back to counting tables without one.
+func (db *DB) EstimateStats() (*DatabaseStats, error) {
+	stats := &DatabaseStats{LastUpdate: time.Now()}
+	totals := map[string]*int{
+		SketchStudies:     &stats.TotalStudies,
+		SketchExperiments: &stats.TotalExperiments,
+		SketchSamples:     &stats.TotalSamples,
+		SketchRuns:        &stats.TotalRuns,
+	}
+	for _, dim := range sketchDimensions {
+		total, ok := totals[dim.name]
+		if !ok {
+			continue
+		}
+		c, err := db.distinctCount(dim, false)
+		if err != nil {
+			return nil, err
+		}
+		*total = int(c.Count)
+		stats.Approximate = stats.Approximate || c.Approximate
+	}
+	return stats, nil
+}
+
+// distinctCount estimates or counts the distinct values of a dimension
+func (db *DB) distinctCount(dim sketchDimension, exact bool) (DistinctCount, error) {
+	c := DistinctCount{Dimension: dim.name}
+	if !exact {
+		h, err := loadSketch(db, dim.name)
+		if err != nil {
+			return c, err
+		}
+		if h != nil {
+			db.sketchMu.Lock()
+			if pending, ok := db.sketches[dim.name]; ok {
+				h.Merge(pending)
+			}
+			db.sketchMu.Unlock()
+			c.Count = int64(h.Count())
+			c.Approximate = true
+			return c, nil
+		}
+	}
+
+	query := `SELECT COUNT(DISTINCT v) FROM (` + dim.source + `) WHERE v IS NOT NULL AND v != ''`
+	if err := db.QueryRow(query).Scan(&c.Count); err != nil {
+		return c, fmt.Errorf("failed to count %s: %w", dim.name, err)
+	}
+	return c, nil
+}
+
+// querier is satisfied by both *DB and *sql.Tx
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadSketch returns the stored sketch of a dimension, or nil
+func loadSketch(q querier, dimension string) (*sketch.HLL, error) {
+	var data []byte
+	err := q.QueryRow(`SELECT registers FROM sketches WHERE dimension = ?`, dimension).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h := &sketch.HLL{}
+	if err := h.UnmarshalBinary(data); err != nil {
+		return nil, nil // rebuilt on the next flush
+	}
+	if h.Precision() != sketch.DefaultPrecision {
+		return nil, nil
+	}
+	return h, nil
+}
+
+// storeSketch writes the sketch of a dimension
+func storeSketch(tx *sql.Tx, dimension string, h *sketch.HLL) error {
+	data, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO sketches (dimension, registers, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)`, dimension, data)
+	return err
+}
+
+// buildSketch builds the sketch of a dimension from the records
+func buildSketch(tx *sql.Tx, dim sketchDimension) (*sketch.HLL, error) {
+	rows, err := tx.Query(`SELECT DISTINCT v FROM (` + dim.source + `) WHERE v IS NOT NULL AND v != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := sketch.New(sketch.DefaultPrecision)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		h.Add(v)
+	}
+	return h, rows.Err()
+}
+
+// Close writes sketches not yet flushed and closes the database.
+func (db *DB) Close() error {
+	flushErr := db.FlushSketches()
+	if err := db.DB.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecordSource records which archive, file and ingest a record was last
+// ingested from.
+type RecordSource struct {
+	Accession  string    `json:"accession"`
+	RecordType string    `json:"record_type"`
+	Archive    string    `json:"archive"`
+	SourceFile string    `json:"source_file,omitempty"`
+	IngestID   string    `json:"ingest_id,omitempty"`
+	IngestedAt time.Time `json:"ingested_at"`
+}
+
+// Ingest is one file or URL ingested into the database. FinishedAt is
+// nil while it runs, and stays nil when it was interrupted.
+type Ingest struct {
+	ID         string     `json:"ingest_id"`
+	Input      string     `json:"input"`
+	Archive    string     `json:"archive,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Records    int64      `json:"records"`
+	Error      string     `json:"error,omitempty"`
+
+	// Measured by MeasureIngest once the ingest completes: the size of
+	// the archive, how much the database grew and how long it took
+	ArchiveBytes int64   `json:"archive_bytes,omitempty"`
+	DBGrowth     int64   `json:"db_growth,omitempty"`
+	Elapsed      float64 `json:"elapsed_seconds,omitempty"`
+}
+
+// addColumn adds a column to a table of databases created before it
+// existed
+func addColumn(db *sql.DB, table, column, decl string) error {
+	var present bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, table, column).Scan(&present)
+	if err != nil || present {
+		return err
+	}
+	// #nosec G202 - table, column and decl are constants of this package
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl)
+	return err
+}
+
+// addRecordSourceIngests adds the ingest_id column to the record_sources
+// table of databases created before ingests were recorded, and indexes it
+func addRecordSourceIngests(db *sql.DB) error {
+	if err := addColumn(db, "record_sources", "ingest_id", "TEXT"); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_record_sources_ingest ON record_sources(ingest_id)`)
+	return err
+}
+
+// addIngestMeasures adds the columns MeasureIngest sets to the ingests
+// table of databases created before ingests were measured
+func addIngestMeasures(db *sql.DB) error {
+	for _, column := range []string{"archive_bytes INTEGER", "db_growth INTEGER", "elapsed_seconds REAL"} {
+		name, decl, _ := strings.Cut(column, " ")
+		if err := addColumn(db, "ingests", name, decl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartIngest records that an ingest has started, setting its start time
+// when unset.
+func (db *DB) StartIngest(ingest *Ingest) error {
+	if ingest.StartedAt.IsZero() {
+		ingest.StartedAt = time.Now().UTC()
+	}
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO ingests (ingest_id, input, archive, started_at)
+		VALUES (?, ?, NULLIF(?, ''), ?)
+	`, ingest.ID, ingest.Input, ingest.Archive, ingest.StartedAt)
+	return err
+}
+
+// FinishIngest records that an ingest has finished with the given number
+// of records, and the error it failed with, if any.
+func (db *DB) FinishIngest(id string, records int64, ingestErr error) error {
+	var message string
+	if ingestErr != nil {
+		message = ingestErr.Error()
+	}
+	_, err := db.Exec(`
+		UPDATE ingests SET finished_at = ?, records = ?, error = NULLIF(?, '')
+		WHERE ingest_id = ?
+	`, time.Now().UTC(), records, message, id)
+	return err
+}
+
+// MeasureIngest records the size of the archive of a completed ingest,
+// how many bytes the database grew by and how long the ingest took, from
+// which IngestRatios estimates later ingests.
+func (db *DB) MeasureIngest(id string, archiveBytes, dbGrowth int64, elapsed time.Duration) error {
+	_, err := db.Exec(`
+		UPDATE ingests SET archive_bytes = ?, db_growth = ?, elapsed_seconds = ?
+		WHERE ingest_id = ?
+	`, archiveBytes, dbGrowth, elapsed.Seconds(), id)
+	return err
+}
+
+// IngestRatios are the ratios of earlier ingests to the size of their
+// archives, which estimate the records, database growth and time of an
+// ingest from the size of its archive
+type IngestRatios struct {
+	Ingests        int     `json:"ingests"` // measured ingests the ratios are taken over
+	RecordsPerByte float64 `json:"records_per_byte"`
+	GrowthPerByte  float64 `json:"growth_per_byte"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// IngestRatios returns the ratios of the ingests measured by
+// MeasureIngest that completed without error, weighted by archive size.
+// Ingests is zero when none was measured.
+func (db *DB) IngestRatios() (*IngestRatios, error) {
+	var r IngestRatios
+	var archiveBytes, records, growth, seconds sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT COUNT(*), SUM(archive_bytes), SUM(records), SUM(db_growth), SUM(elapsed_seconds)
+		FROM ingests
+		WHERE finished_at IS NOT NULL AND error IS NULL
+			AND archive_bytes > 0 AND elapsed_seconds > 0
+	`).Scan(&r.Ingests, &archiveBytes, &records, &growth, &seconds)
+	if err != nil || r.Ingests == 0 {
+		return &r, err
+	}
+	r.RecordsPerByte = records.Float64 / archiveBytes.Float64
+	r.GrowthPerByte = max(growth.Float64, 0) / archiveBytes.Float64
+	r.BytesPerSecond = archiveBytes.Float64 / seconds.Float64
+	return &r, nil
+}
+
+// GetIngest returns an ingest by its ID.
+func (db *DB) GetIngest(id string) (*Ingest, error) {
+	var in Ingest
+	var finished sql.NullTime
+	err := db.QueryRow(`
+		SELECT ingest_id, input, COALESCE(archive, ''), started_at, finished_at, records, COALESCE(error, ''),
+			COALESCE(archive_bytes, 0), COALESCE(db_growth, 0), COALESCE(elapsed_seconds, 0)
+		FROM ingests
+		WHERE ingest_id = ?
+	`, id).Scan(&in.ID, &in.Input, &in.Archive, &in.StartedAt, &finished, &in.Records, &in.Error,
+		&in.ArchiveBytes, &in.DBGrowth, &in.Elapsed)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("ingest not found: %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if finished.Valid {
+		in.FinishedAt = &finished.Time
+	}
+	return &in, nil
+}
+
+// InsertRecordSources records the provenance of ingested records in a
+// single transaction, replacing earlier provenance of the same accessions.
+func (db *DB) InsertRecordSources(sources []RecordSource) error {
+	tx, err := db.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO record_sources (accession, record_type, archive, source_file, ingest_id, ingested_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for i := range sources {
+		s := &sources[i]
+		if s.IngestedAt.IsZero() {
+			s.IngestedAt = now
+		}
+		if _, err := stmt.Exec(s.Accession, s.RecordType, s.Archive, s.SourceFile, s.IngestID, s.IngestedAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRecordSource returns the provenance of a record.
+func (db *DB) GetRecordSource(accession string) (*RecordSource, error) {
+	var s RecordSource
+	err := db.QueryRow(`
+		SELECT accession, record_type, archive, COALESCE(source_file, ''), COALESCE(ingest_id, ''), ingested_at
+		FROM record_sources
+		WHERE accession = ?
+	`, accession).Scan(&s.Accession, &s.RecordType, &s.Archive, &s.SourceFile, &s.IngestID, &s.IngestedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("record source not found: %s", accession)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CountRecordsByArchive returns the number of ingested records per archive.
+func (db *DB) CountRecordsByArchive() (map[string]int64, error) {
+	rows, err := db.Query(`SELECT archive, COUNT(*) FROM record_sources GROUP BY archive`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var archive string
+		var count int64
+		if err := rows.Scan(&archive, &count); err != nil {
+			return nil, err
+		}
+		counts[archive] = count
+	}
+	return counts, rows.Err()
+}
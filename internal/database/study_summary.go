@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// studySummaryBatchSize is the number of studies summarised per query
+const studySummaryBatchSize = 100
+
+// StudySummary holds the child record counts and technologies of a study.
+type StudySummary struct {
+	StudyAccession    string   `json:"study_accession"`
+	ExperimentCount   int      `json:"experiment_count"`
+	SampleCount       int      `json:"sample_count"`
+	RunCount          int      `json:"run_count"`
+	TotalBases        int64    `json:"total_bases"`
+	Platforms         []string `json:"platforms,omitempty"`
+	LibraryStrategies []string `json:"library_strategies,omitempty"`
+}
+
+// studySummarySelect summarises each study with correlated subqueries,
+// which avoids multiplying experiments by samples by runs in one join
+const studySummarySelect = `
+	SELECT
+		s.study_accession,
+		(SELECT COUNT(*) FROM experiments e WHERE e.study_accession = s.study_accession),
+		(SELECT COUNT(DISTINCT es.sample_accession) FROM experiment_samples es
+			JOIN experiments e ON e.experiment_accession = es.experiment_accession
+			WHERE e.study_accession = s.study_accession),
+		(SELECT COUNT(*) FROM runs r
+			JOIN experiments e ON e.experiment_accession = r.experiment_accession
+			WHERE e.study_accession = s.study_accession),
+		(SELECT COALESCE(SUM(r.total_bases), 0) FROM runs r
+			JOIN experiments e ON e.experiment_accession = r.experiment_accession
+			WHERE e.study_accession = s.study_accession),
+		(SELECT GROUP_CONCAT(DISTINCT e.platform ORDER BY e.platform) FROM experiments e
+			WHERE e.study_accession = s.study_accession AND e.platform != ''),
+		(SELECT GROUP_CONCAT(DISTINCT e.library_strategy ORDER BY e.library_strategy) FROM experiments e
+			WHERE e.study_accession = s.study_accession AND e.library_strategy != '')
+	FROM studies s`
+
+// StudySummaries summarises the given studies, one query per batch of
+// studies taken in the order given. When ctx is done, the summaries read so
+// far are returned with ctx.Err(), so callers with a deadline get the
+// first studies summarised. Studies not in the database are left out.
+func (db *DB) StudySummaries(ctx context.Context, accessions []string) (map[string]*StudySummary, error) {
+	summaries := make(map[string]*StudySummary, len(accessions))
+
+	for start := 0; start < len(accessions); start += studySummaryBatchSize {
+		end := start + studySummaryBatchSize
+		if end > len(accessions) {
+			end = len(accessions)
+		}
+		batch := accessions[start:end]
+		args := make([]interface{}, len(batch))
+		for i, acc := range batch {
+			args[i] = acc
+		}
+
+		if err := db.scanStudySummaries(ctx, summaries, studySummarySelect+`
+	WHERE s.study_accession IN (`+placeholders(len(batch))+`)`, args); err != nil {
+			return summaries, err
+		}
+	}
+	return summaries, nil
+}
+
+func (db *DB) scanStudySummaries(ctx context.Context, summaries map[string]*StudySummary, query string, args []interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s StudySummary
+		var platforms, strategies sql.NullString
+		if err := rows.Scan(&s.StudyAccession, &s.ExperimentCount, &s.SampleCount, &s.RunCount,
+			&s.TotalBases, &platforms, &strategies); err != nil {
+			return err
+		}
+		if platforms.String != "" {
+			s.Platforms = strings.Split(platforms.String, ",")
+		}
+		if strategies.String != "" {
+			s.LibraryStrategies = strings.Split(strategies.String, ",")
+		}
+		summaries[s.StudyAccession] = &s
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return rows.Err()
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Taxon is a node of the NCBI taxonomy. Left and Right number the tree in
+// pre-order, so the descendants of a taxon have Left between its Left and
+// Right.
+type Taxon struct {
+	TaxID    int    `json:"tax_id"`
+	ParentID int    `json:"parent_id"`
+	Rank     string `json:"rank"`
+	Name     string `json:"name"`
+	Left     int    `json:"-"`
+	Right    int    `json:"-"`
+}
+
+// ErrTaxonNotFound is returned for taxon IDs and names not in the taxonomy
+var ErrTaxonNotFound = errors.New("taxon not found")
+
+// ReplaceTaxonomy replaces the stored taxonomy with the given nodes.
+func (db *DB) ReplaceTaxonomy(taxa []Taxon) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM taxonomy`); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO taxonomy (tax_id, parent_id, rank, name, lft, rgt) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range taxa {
+		if _, err := stmt.Exec(t.TaxID, t.ParentID, t.Rank, t.Name, t.Left, t.Right); err != nil {
+			return fmt.Errorf("failed to store taxon %d: %w", t.TaxID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// CountTaxa returns the number of taxa stored.
+func (db *DB) CountTaxa() (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM taxonomy`).Scan(&n)
+	return n, err
+}
+
+// GetTaxon returns the taxon with the given ID.
+func (db *DB) GetTaxon(taxID int) (*Taxon, error) {
+	return scanTaxon(db.QueryRow(`
+		SELECT tax_id, parent_id, COALESCE(rank, ''), COALESCE(name, ''), lft, rgt
+		FROM taxonomy WHERE tax_id = ?`, taxID))
+}
+
+// ResolveTaxon returns the taxon named by a tax ID or a scientific name,
+// ignoring case.
+func (db *DB) ResolveTaxon(idOrName string) (*Taxon, error) {
+	idOrName = strings.TrimSpace(idOrName)
+	if id, err := strconv.Atoi(idOrName); err == nil {
+		return db.GetTaxon(id)
+	}
+	return scanTaxon(db.QueryRow(`
+		SELECT tax_id, parent_id, COALESCE(rank, ''), COALESCE(name, ''), lft, rgt
+		FROM taxonomy WHERE name = ? COLLATE NOCASE
+		ORDER BY tax_id LIMIT 1`, idOrName))
+}
+
+// scanTaxon reads a taxon row
+func scanTaxon(row *sql.Row) (*Taxon, error) {
+	t := &Taxon{}
+	err := row.Scan(&t.TaxID, &t.ParentID, &t.Rank, &t.Name, &t.Left, &t.Right)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTaxonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// TaxonLineage returns a taxon and its ancestors, from the root down.
+func (db *DB) TaxonLineage(taxID int) ([]Taxon, error) {
+	rows, err := db.Query(`
+		WITH RECURSIVE lineage(tax_id, depth) AS (
+			SELECT ?, 0
+			UNION ALL
+			SELECT t.parent_id, l.depth + 1
+			FROM taxonomy t JOIN lineage l ON t.tax_id = l.tax_id
+			WHERE t.parent_id != t.tax_id AND l.depth < 100
+		)
+		SELECT t.tax_id, t.parent_id, COALESCE(t.rank, ''), COALESCE(t.name, ''), t.lft, t.rgt
+		FROM lineage l JOIN taxonomy t ON t.tax_id = l.tax_id
+		ORDER BY l.depth DESC`, taxID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lineage []Taxon
+	for rows.Next() {
+		var t Taxon
+		if err := rows.Scan(&t.TaxID, &t.ParentID, &t.Rank, &t.Name, &t.Left, &t.Right); err != nil {
+			return nil, err
+		}
+		lineage = append(lineage, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(lineage) == 0 {
+		return nil, ErrTaxonNotFound
+	}
+	return lineage, nil
+}
+
+// CountDescendantSamples returns the number of samples whose taxon is the
+// given taxon or one of its descendants.
+func (db *DB) CountDescendantSamples(taxID int) (int, error) {
+	t, err := db.GetTaxon(taxID)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM samples s
+		JOIN taxonomy t ON t.tax_id = s.taxon_id
+		WHERE t.lft BETWEEN ? AND ?`, t.Left, t.Right).Scan(&n)
+	return n, err
+}
+
+// GetSampleTaxonIDs returns the taxon IDs of the given samples, leaving out
+// samples without one.
+func (db *DB) GetSampleTaxonIDs(accessions []string) (map[string]int, error) {
+	ids := make(map[string]int)
+	if len(accessions) == 0 {
+		return ids, nil
+	}
+
+	// Stay well under SQLite's bound parameter limit
+	const chunk = 500
+	for start := 0; start < len(accessions); start += chunk {
+		end := min(start+chunk, len(accessions))
+		args := make([]interface{}, 0, end-start)
+		for _, acc := range accessions[start:end] {
+			args = append(args, acc)
+		}
+		rows, err := db.Query(`
+			SELECT sample_accession, taxon_id FROM samples
+			WHERE sample_accession IN (`+placeholders(len(args))+`) AND taxon_id > 0`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var acc string
+			var id int
+			if err := rows.Scan(&acc, &id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids[acc] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
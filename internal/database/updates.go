@@ -0,0 +1,185 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AppliedUpdate is an NCBI metadata file that has been ingested into the
+// database, either a monthly full dataset or a daily update.
+type AppliedUpdate struct {
+	FileName   string    `json:"file_name"`
+	FileType   string    `json:"file_type"`
+	FileDate   time.Time `json:"file_date"`
+	Records    int64     `json:"records"`
+	Suppressed int64     `json:"suppressed"`
+	AppliedAt  time.Time `json:"applied_at"`
+}
+
+// RecordAppliedUpdate records that a metadata file has been ingested,
+// replacing any earlier record of the same file.
+func (db *DB) RecordAppliedUpdate(u AppliedUpdate) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO applied_updates (file_name, file_type, file_date, records, suppressed, applied_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, u.FileName, u.FileType, u.FileDate.UTC().Format("2006-01-02"), u.Records, u.Suppressed)
+	return err
+}
+
+// ListAppliedUpdates returns the metadata files ingested so far, oldest
+// first.
+func (db *DB) ListAppliedUpdates() ([]AppliedUpdate, error) {
+	rows, err := db.Query(`
+		SELECT file_name, file_type, file_date, records, suppressed, applied_at
+		FROM applied_updates
+		ORDER BY file_date, applied_at, file_name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var updates []AppliedUpdate
+	for rows.Next() {
+		var u AppliedUpdate
+		if err := rows.Scan(&u.FileName, &u.FileType, &u.FileDate, &u.Records, &u.Suppressed, &u.AppliedAt); err != nil {
+			return nil, err
+		}
+		updates = append(updates, u)
+	}
+	return updates, rows.Err()
+}
+
+// SuppressRecords removes records withdrawn by their submitter, along
+// with their identifiers, links, access hints, provenance, and raw XML.
+// Suppressing a study removes its experiments, and suppressing an
+// experiment removes its runs; samples may be shared between studies and
+// are only removed when suppressed themselves. Curations and collection
+// memberships are kept, as they belong to the user. It returns the number
+// of studies, experiments, samples, and runs removed.
+func (db *DB) SuppressRecords(accessions []string) (int64, error) {
+	if len(accessions) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.beginWrite()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Expand studies and experiments to the records beneath them
+	targets := make(map[string]bool, len(accessions))
+	var order []string
+	add := func(acc string) {
+		if acc != "" && !targets[acc] {
+			targets[acc] = true
+			order = append(order, acc)
+		}
+	}
+	for _, acc := range accessions {
+		add(acc)
+	}
+	for i := 0; i < len(order); i++ {
+		rows, err := tx.Query(`
+			SELECT experiment_accession FROM experiments WHERE study_accession = ?
+			UNION
+			SELECT run_accession FROM runs WHERE experiment_accession = ?
+		`, order[i], order[i])
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var acc string
+			if err := rows.Scan(&acc); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			add(acc)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	core := []string{
+		`DELETE FROM studies WHERE study_accession = ?`,
+		`DELETE FROM experiments WHERE experiment_accession = ?`,
+		`DELETE FROM samples WHERE sample_accession = ?`,
+		`DELETE FROM runs WHERE run_accession = ?`,
+	}
+	related := []string{
+		`DELETE FROM submissions WHERE submission_accession = ?`,
+		`DELETE FROM identifiers WHERE record_accession = ?`,
+		`DELETE FROM links WHERE record_accession = ?`,
+		`DELETE FROM experiment_samples WHERE experiment_accession = ?1 OR sample_accession = ?1`,
+		`DELETE FROM sample_runs WHERE sample_accession = ?1 OR experiment_accession = ?1 OR run_accession = ?1`,
+		`DELETE FROM sample_pool WHERE parent_sample = ?`,
+		`DELETE FROM sample_attributes WHERE sample_accession = ?`,
+		`DELETE FROM record_access WHERE accession = ?`,
+		`DELETE FROM run_files WHERE run_accession = ?`,
+		`DELETE FROM record_sources WHERE accession = ?`,
+		`DELETE FROM raw_records WHERE accession = ?`,
+	}
+
+	var removed int64
+	for _, acc := range order {
+		for _, query := range core {
+			res, err := tx.Exec(query, acc)
+			if err != nil {
+				return 0, err
+			}
+			n, _ := res.RowsAffected()
+			removed += n
+		}
+		for _, query := range related {
+			if _, err := tx.Exec(query, acc); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// EntrezSync is a poll of Entrez for the SRA records modified up to a
+// day, applied between the daily metadata files.
+type EntrezSync struct {
+	SyncedUntil time.Time `json:"synced_until"` // Last day of modifications applied
+	Records     int64     `json:"records"`
+	Suppressed  int64     `json:"suppressed"`
+	SyncedAt    time.Time `json:"synced_at"`
+}
+
+// RecordEntrezSync records a poll of Entrez, replacing any earlier poll up
+// to the same day.
+func (db *DB) RecordEntrezSync(s EntrezSync) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO entrez_syncs (synced_until, records, suppressed, synced_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`, s.SyncedUntil.UTC().Format("2006-01-02"), s.Records, s.Suppressed)
+	return err
+}
+
+// LastEntrezSync returns the latest poll of Entrez, or nil if there has
+// been none.
+func (db *DB) LastEntrezSync() (*EntrezSync, error) {
+	var s EntrezSync
+	err := db.QueryRow(`
+		SELECT synced_until, records, suppressed, synced_at
+		FROM entrez_syncs
+		ORDER BY synced_until DESC, synced_at DESC
+		LIMIT 1
+	`).Scan(&s.SyncedUntil, &s.Records, &s.Suppressed, &s.SyncedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
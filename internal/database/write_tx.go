@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// writeTx is the transaction of a record write method: a transaction of
+// its own, or a savepoint of the transaction of a view of WithTx
+type writeTx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Commit() error
+	Rollback() error
+}
+
+// savepoint is a writeTx nested in the transaction of WithTx. Committing
+// it releases the savepoint, leaving its writes to the transaction.
+type savepoint struct {
+	*sql.Tx
+	done bool
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	if _, err := s.Tx.Exec(`RELEASE write`); err != nil {
+		return err
+	}
+	s.done = true
+	return nil
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	if _, err := s.Tx.Exec(`ROLLBACK TO write`); err != nil {
+		return err
+	}
+	_, err := s.Tx.Exec(`RELEASE write`)
+	return err
+}
+
+// errInTx is returned for a transaction begun on a view of WithTx, whose
+// statements already run in one
+var errInTx = errors.New("cannot begin a transaction within WithTx")
+
+// WithTx runs fn in a single transaction, committed when fn succeeds and
+// rolled back when it fails or ctx is cancelled, so that the records fn
+// writes land all or none. fn is handed a view of db whose statements run
+// in the transaction, so that its reads see the records written before
+// them; the record write methods with transactions of their own run as
+// savepoints of it. Writes through db itself, from fn or other goroutines,
+// are not part of the transaction. WithTx on a view joins its transaction,
+// and during a bulk load, which batches its own writes, fn is handed db.
+func (db *DB) WithTx(ctx context.Context, fn func(tx *DB) error) error {
+	if db.tx != nil || db.bulk.Load() != nil {
+		return fn(db)
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	view := &DB{
+		DB:          db.DB,
+		path:        db.path,
+		readOnly:    db.readOnly,
+		replication: db.replication,
+		dbState:     db.dbState,
+		tx:          tx,
+	}
+	if err := fn(view); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// beginWrite begins the transaction of a record write method
+func (db *DB) beginWrite() (writeTx, error) {
+	if db.tx == nil {
+		return db.DB.Begin()
+	}
+	if _, err := db.tx.Exec(`SAVEPOINT write`); err != nil {
+		return nil, err
+	}
+	return &savepoint{Tx: db.tx}, nil
+}
+
+// Begin begins a transaction, which a view of WithTx cannot
+func (db *DB) Begin() (*sql.Tx, error) {
+	if db.tx != nil {
+		return nil, errInTx
+	}
+	return db.DB.Begin()
+}
+
+// BeginTx begins a transaction, which a view of WithTx cannot
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if db.tx != nil {
+		return nil, errInTx
+	}
+	return db.DB.BeginTx(ctx, opts)
+}
+
+// Exec executes a statement, in the transaction of a view of WithTx
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.Exec(query, args...)
+	}
+	return db.DB.Exec(query, args...)
+}
+
+// ExecContext executes a statement, in the transaction of a view of WithTx
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.ExecContext(ctx, query, args...)
+	}
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+// QueryContext executes a query that returns rows, in the transaction of a
+// view of WithTx
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.QueryContext(ctx, query, args...)
+	}
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext executes a query that returns at most one row, in the
+// transaction of a view of WithTx
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRowContext(ctx, query, args...)
+	}
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+// Prepare creates a prepared statement, in the transaction of a view of
+// WithTx
+func (db *DB) Prepare(query string) (*sql.Stmt, error) {
+	if db.tx != nil {
+		return db.tx.Prepare(query)
+	}
+	return db.DB.Prepare(query)
+}
+
+// PrepareContext creates a prepared statement, in the transaction of a
+// view of WithTx
+func (db *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if db.tx != nil {
+		return db.tx.PrepareContext(ctx, query)
+	}
+	return db.DB.PrepareContext(ctx, query)
+}
@@ -0,0 +1,369 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// External accession types resolved by ResolveExternal
+const (
+	XrefBioSample  = "biosample"
+	XrefBioProject = "bioproject"
+	XrefGEOSeries  = "geo_series"
+	XrefGEOSample  = "geo_sample"
+)
+
+// IDTypeGEO and NamespaceGEO mark the copies of a record's identifiers that
+// are GEO series (GSE) or sample (GSM) accessions, whether submitted as an
+// alias, a secondary ID or an external ID
+const (
+	IDTypeGEO    = "geo"
+	NamespaceGEO = "GEO"
+)
+
+// Cross-reference sources: an IDENTIFIERS block or a sample attribute
+const (
+	xrefFromIdentifier = "identifier"
+	xrefFromAttribute  = "attribute"
+)
+
+// GLOB patterns of BioSample (SAMN, SAMEA, SAMD) and BioProject (PRJNA,
+// PRJEB, PRJDB) accessions, checked by the triggers
+const (
+	biosampleGlob  = `'SAM[NED][A0-9]*[0-9]'`
+	bioprojectGlob = `'PRJ[NED][AB][0-9]*'`
+)
+
+// geoAccession is the condition on an identifier value being a GEO series
+// or sample accession: GSE or GSM followed by digits only
+func geoAccession(value string) string {
+	return value + ` GLOB 'GS[EM][0-9]*' AND substr(` + value + `, 4) NOT GLOB '*[^0-9]*'`
+}
+
+var (
+	biosampleAccession  = regexp.MustCompile(`^SAM(N|EA|E|D)[0-9]+$`)
+	bioprojectAccession = regexp.MustCompile(`^PRJ(NA|EB|DB)[0-9]+$`)
+	geoSeriesAccession  = regexp.MustCompile(`^GSE[0-9]+$`)
+	geoSampleAccession  = regexp.MustCompile(`^GSM[0-9]+$`)
+)
+
+// xrefAttributeTags are the sample attributes holding BioSample or
+// BioProject accessions, as normalized by NormalizeAttributeTag
+const xrefAttributeTags = `('biosample', 'biosample_accession', 'bioproject', 'bioproject_accession')`
+
+// xrefSelects select the cross-references of existing identifiers and
+// attributes, for databases ingested before the tables existed. The
+// identifier ranges use the index on id_value.
+var xrefSelects = []string{
+	`INSERT OR IGNORE INTO biosamples (biosample_accession, sample_accession, source)
+		SELECT id_value, record_accession, '` + xrefFromIdentifier + `' FROM identifiers
+		WHERE id_value >= 'SAM' AND id_value < 'SAN' AND id_value GLOB ` + biosampleGlob + `
+		AND record_type = 'sample'`,
+	`INSERT OR IGNORE INTO bioprojects (bioproject_accession, record_type, record_accession, source)
+		SELECT id_value, record_type, record_accession, '` + xrefFromIdentifier + `' FROM identifiers
+		WHERE id_value >= 'PRJ' AND id_value < 'PRK' AND id_value GLOB ` + bioprojectGlob,
+	`INSERT OR IGNORE INTO biosamples (biosample_accession, sample_accession, source)
+		SELECT upper(value), sample_accession, '` + xrefFromAttribute + `' FROM sample_attributes
+		WHERE tag IN ` + xrefAttributeTags + ` AND upper(value) GLOB ` + biosampleGlob,
+	`INSERT OR IGNORE INTO bioprojects (bioproject_accession, record_type, record_accession, source)
+		SELECT upper(value), 'sample', sample_accession, '` + xrefFromAttribute + `' FROM sample_attributes
+		WHERE tag IN ` + xrefAttributeTags + ` AND upper(value) GLOB ` + bioprojectGlob,
+}
+
+// createXrefTriggers creates the triggers keeping biosamples and
+// bioprojects in step with identifiers and sample attributes. A
+// cross-reference is removed with the last row it was read from.
+func createXrefTriggers(db *sql.DB) error {
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS xrefs_identifiers_after_insert AFTER INSERT ON identifiers BEGIN
+			INSERT OR IGNORE INTO biosamples (biosample_accession, sample_accession, source)
+			SELECT new.id_value, new.record_accession, '` + xrefFromIdentifier + `'
+			WHERE new.record_type = 'sample' AND new.id_value GLOB ` + biosampleGlob + `;
+			INSERT OR IGNORE INTO bioprojects (bioproject_accession, record_type, record_accession, source)
+			SELECT new.id_value, new.record_type, new.record_accession, '` + xrefFromIdentifier + `'
+			WHERE new.id_value GLOB ` + bioprojectGlob + `;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS xrefs_identifiers_after_delete AFTER DELETE ON identifiers
+		WHEN NOT EXISTS (SELECT 1 FROM identifiers i WHERE i.record_type = old.record_type
+			AND i.record_accession = old.record_accession AND i.id_value = old.id_value) BEGIN
+			DELETE FROM biosamples WHERE biosample_accession = old.id_value
+				AND sample_accession = old.record_accession AND source = '` + xrefFromIdentifier + `';
+			DELETE FROM bioprojects WHERE bioproject_accession = old.id_value AND record_type = old.record_type
+				AND record_accession = old.record_accession AND source = '` + xrefFromIdentifier + `';
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS xrefs_attributes_after_insert AFTER INSERT ON sample_attributes
+		WHEN new.tag IN ` + xrefAttributeTags + ` BEGIN
+			INSERT OR IGNORE INTO biosamples (biosample_accession, sample_accession, source)
+			SELECT upper(new.value), new.sample_accession, '` + xrefFromAttribute + `'
+			WHERE upper(new.value) GLOB ` + biosampleGlob + `;
+			INSERT OR IGNORE INTO bioprojects (bioproject_accession, record_type, record_accession, source)
+			SELECT upper(new.value), 'sample', new.sample_accession, '` + xrefFromAttribute + `'
+			WHERE upper(new.value) GLOB ` + bioprojectGlob + `;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS xrefs_attributes_after_delete AFTER DELETE ON sample_attributes
+		WHEN old.tag IN ` + xrefAttributeTags + ` AND NOT EXISTS (SELECT 1 FROM sample_attributes a
+			WHERE a.sample_accession = old.sample_accession AND a.tag IN ` + xrefAttributeTags + `
+			AND upper(a.value) = upper(old.value)) BEGIN
+			DELETE FROM biosamples WHERE biosample_accession = upper(old.value)
+				AND sample_accession = old.sample_accession AND source = '` + xrefFromAttribute + `';
+			DELETE FROM bioprojects WHERE bioproject_accession = upper(old.value) AND record_type = 'sample'
+				AND record_accession = old.sample_accession AND source = '` + xrefFromAttribute + `';
+		END`,
+	}
+	for _, trigger := range triggers {
+		if _, err := db.Exec(trigger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createGEOTriggers creates the triggers copying the GEO accessions among
+// identifiers to identifiers of type IDTypeGEO, so that they are found
+// whatever identifier they were submitted as. Identifiers typed GEO in any
+// case are not copied, and a copy is removed with the last identifier it
+// was made from.
+func createGEOTriggers(db *sql.DB) error {
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS geo_identifiers_after_insert AFTER INSERT ON identifiers
+		WHEN lower(new.id_type) != '` + IDTypeGEO + `' AND ` + geoAccession("new.id_value") + ` BEGIN
+			INSERT OR IGNORE INTO identifiers (record_type, record_accession, id_type, id_namespace, id_value, id_label)
+			VALUES (new.record_type, new.record_accession, '` + IDTypeGEO + `', '` + NamespaceGEO + `', new.id_value, '');
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS geo_identifiers_after_delete AFTER DELETE ON identifiers
+		WHEN lower(old.id_type) != '` + IDTypeGEO + `' AND ` + geoAccession("old.id_value") + `
+			AND NOT EXISTS (SELECT 1 FROM identifiers i WHERE i.record_type = old.record_type
+			AND i.record_accession = old.record_accession AND i.id_value = old.id_value
+			AND lower(i.id_type) != '` + IDTypeGEO + `') BEGIN
+			DELETE FROM identifiers WHERE record_type = old.record_type AND record_accession = old.record_accession
+				AND id_type = '` + IDTypeGEO + `' AND id_value = old.id_value;
+		END`,
+	}
+	for _, trigger := range triggers {
+		if _, err := db.Exec(trigger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBackfill runs the backfill of the given name unless it has run on db
+// before, and records that it has. Backfills look for data missing in
+// databases created by older releases, which takes a scan of tables that
+// may hold millions of rows; once done, the triggers keep them filled.
+func runBackfill(db *sql.DB, name string, backfill func(*sql.DB) error) error {
+	var ran bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM backfills WHERE name = ?)`, name).Scan(&ran); err != nil || ran {
+		return err
+	}
+	if err := backfill(db); err != nil {
+		return err
+	}
+	_, err := db.Exec(`INSERT OR IGNORE INTO backfills (name) VALUES (?)`, name)
+	return err
+}
+
+// backfillGEOIdentifiers copies the GEO accessions among the identifiers
+// of databases ingested before GEO identifiers were kept. It does nothing
+// once any GEO identifier exists.
+func backfillGEOIdentifiers(db *sql.DB) error {
+	var filled bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM identifiers WHERE id_type = ?)`, IDTypeGEO).Scan(&filled)
+	if err != nil || filled {
+		return err
+	}
+	_, err = db.Exec(`INSERT OR IGNORE INTO identifiers (record_type, record_accession, id_type, id_namespace, id_value, id_label)
+		SELECT record_type, record_accession, ?, ?, id_value, '' FROM identifiers
+		WHERE id_value >= 'GS' AND id_value < 'GT' AND lower(id_type) != ? AND `+geoAccession("id_value"),
+		IDTypeGEO, NamespaceGEO, IDTypeGEO)
+	return err
+}
+
+// backfillXrefs fills empty biosamples and bioprojects tables from the
+// identifiers and attributes of databases ingested before they existed.
+// It does nothing once either has rows.
+func backfillXrefs(db *sql.DB) error {
+	var filled bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM biosamples) OR EXISTS (SELECT 1 FROM bioprojects)`).Scan(&filled)
+	if err != nil || filled {
+		return err
+	}
+	for _, query := range xrefSelects {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildXrefs recomputes the biosamples and bioprojects tables from the
+// identifiers and sample attributes, and returns the number of rows.
+func (db *DB) RebuildXrefs() (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"biosamples", "bioprojects"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return 0, err
+		}
+	}
+	var total int64
+	for _, query := range xrefSelects {
+		res, err := tx.Exec(query)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, tx.Commit()
+}
+
+// ExternalLinks are the SRA records linked to a BioSample, BioProject or
+// GEO accession, each list ordered by accession
+type ExternalLinks struct {
+	Accession   string   `json:"accession"`
+	Type        string   `json:"type"` // biosample, bioproject, geo_series or geo_sample
+	Studies     []string `json:"studies"`
+	Experiments []string `json:"experiments"`
+	Samples     []string `json:"samples"`
+	Runs        []string `json:"runs"`
+}
+
+// ExternalAccessionType returns the Xref type of a BioSample, BioProject
+// or GEO accession, and "" for any other
+func ExternalAccessionType(accession string) string {
+	accession = strings.ToUpper(strings.TrimSpace(accession))
+	switch {
+	case biosampleAccession.MatchString(accession):
+		return XrefBioSample
+	case bioprojectAccession.MatchString(accession):
+		return XrefBioProject
+	case geoSeriesAccession.MatchString(accession):
+		return XrefGEOSeries
+	case geoSampleAccession.MatchString(accession):
+		return XrefGEOSample
+	}
+	return ""
+}
+
+// Queries selecting the records linked to an external accession. Each
+// builds on those before it; every ? is the accession.
+var (
+	biosampleSamples = `SELECT sample_accession FROM biosamples WHERE biosample_accession = ?`
+
+	bioprojectStudies = `SELECT record_accession FROM bioprojects WHERE bioproject_accession = ? AND record_type = 'study'
+		UNION SELECT sr.study_accession FROM sample_runs sr
+		WHERE sr.sample_accession IN (SELECT record_accession FROM bioprojects WHERE bioproject_accession = ? AND record_type = 'sample')
+		AND sr.study_accession IS NOT NULL`
+)
+
+// geoRecords selects the records of a type carrying a GEO accession
+func geoRecords(recordType string) string {
+	return `SELECT record_accession FROM identifiers WHERE id_value = ? AND lower(id_type) = '` + IDTypeGEO +
+		`' AND record_type = '` + recordType + `'`
+}
+
+// geoQueries list the records linked to a GEO accession: those carrying
+// it, whatever their type, and the records related to them. A series is
+// usually carried by a study and a sample by a sample or an experiment.
+var geoQueries = [4]string{
+	geoRecords("study") + `
+	UNION SELECT study_accession FROM experiments WHERE experiment_accession IN (` + geoRecords("experiment") + `)
+		AND study_accession IS NOT NULL
+	UNION SELECT study_accession FROM sample_runs WHERE sample_accession IN (` + geoRecords("sample") + `)
+		AND study_accession IS NOT NULL`,
+	geoRecords("experiment") + `
+	UNION SELECT experiment_accession FROM experiments WHERE study_accession IN (` + geoRecords("study") + `)
+	UNION SELECT experiment_accession FROM experiment_samples WHERE sample_accession IN (` + geoRecords("sample") + `)`,
+	geoRecords("sample") + `
+	UNION SELECT sample_accession FROM experiment_samples WHERE experiment_accession IN (` + geoRecords("experiment") + `)
+	UNION SELECT es.sample_accession FROM experiment_samples es JOIN experiments e ON e.experiment_accession = es.experiment_accession
+		WHERE e.study_accession IN (` + geoRecords("study") + `)`,
+	`SELECT run_accession FROM runs WHERE experiment_accession IN (` + geoRecords("experiment") + `)
+	UNION SELECT r.run_accession FROM runs r JOIN experiments e ON e.experiment_accession = r.experiment_accession
+		WHERE e.study_accession IN (` + geoRecords("study") + `)
+	UNION SELECT run_accession FROM sample_runs WHERE sample_accession IN (` + geoRecords("sample") + `)`,
+}
+
+// xrefQueries are the queries listing the studies, experiments, samples
+// and runs linked to each type of external accession
+var xrefQueries = map[string][4]string{
+	XrefBioSample: {
+		`SELECT e.study_accession FROM experiments e WHERE e.experiment_accession IN (
+			SELECT experiment_accession FROM experiment_samples WHERE sample_accession IN (` + biosampleSamples + `))
+		UNION SELECT study_accession FROM sample_runs WHERE sample_accession IN (` + biosampleSamples + `)
+			AND study_accession IS NOT NULL`,
+		`SELECT experiment_accession FROM experiment_samples WHERE sample_accession IN (` + biosampleSamples + `)
+		UNION SELECT experiment_accession FROM sample_runs WHERE sample_accession IN (` + biosampleSamples + `)`,
+		biosampleSamples,
+		`SELECT run_accession FROM sample_runs WHERE sample_accession IN (` + biosampleSamples + `)`,
+	},
+	XrefBioProject: {
+		bioprojectStudies,
+		`SELECT experiment_accession FROM experiments WHERE study_accession IN (` + bioprojectStudies + `)`,
+		`SELECT es.sample_accession FROM experiment_samples es JOIN experiments e ON e.experiment_accession = es.experiment_accession
+			WHERE e.study_accession IN (` + bioprojectStudies + `)
+		UNION SELECT record_accession FROM bioprojects WHERE bioproject_accession = ? AND record_type = 'sample'`,
+		`SELECT r.run_accession FROM runs r JOIN experiments e ON e.experiment_accession = r.experiment_accession
+			WHERE e.study_accession IN (` + bioprojectStudies + `)`,
+	},
+	XrefGEOSeries: geoQueries,
+	XrefGEOSample: geoQueries,
+}
+
+// ResolveExternal returns the studies, experiments, samples and runs
+// linked to a BioSample, BioProject or GEO accession. A BioSample links its
+// samples and the experiments, runs and studies of those; a BioProject
+// links its studies, with their experiments, samples and runs, and the
+// samples naming it in their attributes. A GEO series or sample links the
+// records carrying it among their identifiers and those related to them.
+func (db *DB) ResolveExternal(accession string) (*ExternalLinks, error) {
+	accession = strings.ToUpper(strings.TrimSpace(accession))
+	kind := ExternalAccessionType(accession)
+	if kind == "" {
+		return nil, fmt.Errorf("not a BioSample, BioProject or GEO accession: %s", accession)
+	}
+
+	links := &ExternalLinks{Accession: accession, Type: kind}
+	lists := []*[]string{&links.Studies, &links.Experiments, &links.Samples, &links.Runs}
+	found := false
+	for i, query := range xrefQueries[kind] {
+		args := slices.Repeat([]interface{}{accession}, strings.Count(query, "?"))
+		accessions, err := db.queryAccessions(`SELECT DISTINCT * FROM (`+query+`) ORDER BY 1`, args)
+		if err != nil {
+			return nil, err
+		}
+		*lists[i] = accessions
+		found = found || len(accessions) > 0
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found: %s", kind, accession)
+	}
+	return links, nil
+}
+
+// queryAccessions returns the single column of a query's rows, never nil
+func (db *DB) queryAccessions(query string, args []interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accessions := []string{}
+	for rows.Next() {
+		var acc string
+		if err := rows.Scan(&acc); err != nil {
+			return nil, err
+		}
+		accessions = append(accessions, acc)
+	}
+	return accessions, rows.Err()
+}
@@ -0,0 +1,203 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	srerrors "github.com/nishad/srake/internal/errors"
+)
+
+// EntrezURL is the base URL of NCBI E-utilities
+const EntrezURL = "https://eutils.ncbi.nlm.nih.gov/entrez/eutils"
+
+// EntrezAPIKeyEnv names the environment variable holding an NCBI API key,
+// which raises the E-utilities rate limit from 3 to 10 requests a second
+const EntrezAPIKeyEnv = "NCBI_API_KEY"
+
+const (
+	entrezSearchPage = 10000 // UIDs per esearch request, the E-utilities maximum
+	entrezFetchBatch = 200   // Records per efetch request
+)
+
+// EntrezFeed finds the SRA records NCBI modified in a period through
+// E-utilities and fetches their XML. Entrez is updated through the day,
+// so it gives fresher records than the daily metadata tarballs.
+type EntrezFeed struct {
+	BaseURL   string // EntrezURL when empty
+	APIKey    string
+	Client    *http.Client
+	BatchSize int // Records per efetch request; entrezFetchBatch when 0
+	// Rate caps requests a second below NCBI's limit, which applies when 0
+	Rate float64
+
+	mu   sync.Mutex
+	last time.Time // Time of the last request, for rate limiting
+}
+
+// NewEntrezFeed creates a feed from NCBI, using the API key of
+// NCBI_API_KEY when set
+func NewEntrezFeed() *EntrezFeed {
+	return &EntrezFeed{
+		BaseURL: EntrezURL,
+		APIKey:  os.Getenv(EntrezAPIKeyEnv),
+		Client:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// EntrezDate formats a time as the day E-utilities date ranges take. Entrez
+// records modification dates to the day.
+func EntrezDate(t time.Time) string {
+	return t.UTC().Format("2006/01/02")
+}
+
+// ModifiedSince returns the UIDs of the SRA records, one per experiment
+// package, modified on the days from since through until
+func (f *EntrezFeed) ModifiedSince(ctx context.Context, since, until time.Time) ([]string, error) {
+	return f.search(ctx, url.Values{
+		"term":     {"all[filter]"},
+		"datetype": {"mdat"},
+		"mindate":  {EntrezDate(since)},
+		"maxdate":  {EntrezDate(until)},
+	})
+}
+
+// search returns the UIDs of the SRA records matching an esearch query,
+// paging through them
+func (f *EntrezFeed) search(ctx context.Context, params url.Values) ([]string, error) {
+	var uids []string
+	for {
+		var search struct {
+			Result struct {
+				Count string   `json:"count"`
+				IDs   []string `json:"idlist"`
+			} `json:"esearchresult"`
+		}
+		query := url.Values{
+			"db":       {"sra"},
+			"retstart": {strconv.Itoa(len(uids))},
+			"retmax":   {strconv.Itoa(entrezSearchPage)},
+			"retmode":  {"json"},
+		}
+		for key, values := range params {
+			query[key] = values
+		}
+		body, err := f.get(ctx, "esearch.fcgi", query)
+		if err != nil {
+			return nil, err
+		}
+		err = json.NewDecoder(body).Decode(&search)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode E-utilities search: %w", err)
+		}
+
+		uids = append(uids, search.Result.IDs...)
+		count, _ := strconv.Atoi(search.Result.Count)
+		if len(search.Result.IDs) == 0 || len(uids) >= count {
+			return uids, nil
+		}
+	}
+}
+
+// Batches splits UIDs into the batches Fetch is called with
+func (f *EntrezFeed) Batches(uids []string) [][]string {
+	size := f.BatchSize
+	if size <= 0 {
+		size = entrezFetchBatch
+	}
+	var batches [][]string
+	for len(uids) > 0 {
+		n := min(size, len(uids))
+		batches = append(batches, uids[:n])
+		uids = uids[n:]
+	}
+	return batches
+}
+
+// Fetch returns the XML of SRA records by UID, an EXPERIMENT_PACKAGE_SET
+// holding the submission, study, sample, experiment, and runs of each.
+// The caller closes it.
+func (f *EntrezFeed) Fetch(ctx context.Context, uids []string) (io.ReadCloser, error) {
+	query := url.Values{
+		"db":      {"sra"},
+		"id":      {strings.Join(uids, ",")},
+		"rettype": {"full"},
+		"retmode": {"xml"},
+	}
+	return f.get(ctx, "efetch.fcgi", query)
+}
+
+// get sends an E-utilities request, waiting as long as NCBI's rate limit
+// asks, and returns the response body
+func (f *EntrezFeed) get(ctx context.Context, endpoint string, query url.Values) (io.ReadCloser, error) {
+	if err := f.wait(ctx); err != nil {
+		return nil, err
+	}
+	if f.APIKey != "" {
+		query.Set("api_key", f.APIKey)
+	}
+	query.Set("tool", "srake")
+
+	base := f.BaseURL
+	if base == "" {
+		base = EntrezURL
+	}
+	// Long ID lists are posted, as E-utilities asks of over 200 UIDs
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/"+endpoint, strings.NewReader(query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "srake")
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("E-utilities request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &srerrors.StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return resp.Body, nil
+}
+
+// wait spaces requests to stay under NCBI's rate limit: 3 requests a
+// second, or 10 with an API key, or fewer with Rate
+func (f *EntrezFeed) wait(ctx context.Context) error {
+	interval := time.Second / 3
+	if f.APIKey != "" {
+		interval = time.Second / 10
+	}
+	if f.Rate > 0 {
+		interval = max(interval, time.Duration(float64(time.Second)/f.Rate))
+	}
+
+	f.mu.Lock()
+	next := f.last.Add(interval)
+	now := time.Now()
+	if next.Before(now) {
+		next = now
+	}
+	f.last = next
+	f.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(next)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
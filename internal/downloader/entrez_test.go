@@ -0,0 +1,117 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEntrezFeed(t *testing.T) {
+	var searches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("db") != "sra" || r.Form.Get("api_key") != "secret" {
+			t.Errorf("unexpected request: %s", r.Form.Encode())
+		}
+		switch r.URL.Path {
+		case "/esearch.fcgi":
+			searches++
+			if r.Form.Get("datetype") != "mdat" || r.Form.Get("mindate") != "2025/09/17" || r.Form.Get("maxdate") != "2025/09/18" {
+				t.Errorf("unexpected search: %s", r.Form.Encode())
+			}
+			// Two pages of results
+			ids := `["3","2"]`
+			if r.Form.Get("retstart") == "2" {
+				ids = `["1"]`
+			}
+			fmt.Fprintf(w, `{"esearchresult":{"count":"3","idlist":%s}}`, ids)
+		case "/efetch.fcgi":
+			if r.Form.Get("id") != "3,2" || r.Form.Get("retmode") != "xml" {
+				t.Errorf("unexpected fetch: %s", r.Form.Encode())
+			}
+			io.WriteString(w, "<EXPERIMENT_PACKAGE_SET/>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	feed := &EntrezFeed{BaseURL: server.URL, APIKey: "secret", BatchSize: 2}
+	since := time.Date(2025, 9, 17, 0, 0, 0, 0, time.UTC)
+	uids, err := feed.ModifiedSince(context.Background(), since, since.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("ModifiedSince failed: %v", err)
+	}
+	if strings.Join(uids, ",") != "3,2,1" || searches != 2 {
+		t.Fatalf("expected UIDs 3,2,1 from 2 searches, got %v from %d", uids, searches)
+	}
+
+	batches := feed.Batches(uids)
+	if len(batches) != 2 || len(batches[0]) != 2 || batches[1][0] != "1" {
+		t.Fatalf("expected batches of 2 and 1, got %v", batches)
+	}
+
+	body, err := feed.Fetch(context.Background(), batches[0])
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "<EXPERIMENT_PACKAGE_SET/>" {
+		t.Errorf("unexpected body: %s", data)
+	}
+
+	feed.BaseURL = server.URL + "/missing"
+	if _, err := feed.Fetch(context.Background(), batches[1]); err == nil {
+		t.Error("expected an error for a failed request")
+	}
+}
+
+func TestRunInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/esearch.fcgi":
+			if r.Form.Get("term") != "SRP000001[ACCN] OR SRR000003[ACCN]" {
+				t.Errorf("unexpected search: %s", r.Form.Encode())
+			}
+			fmt.Fprint(w, `{"esearchresult":{"count":"2","idlist":["11","12"]}}`)
+		case "/efetch.fcgi":
+			if r.Form.Get("rettype") != "runinfo" {
+				t.Errorf("unexpected fetch: %s", r.Form.Encode())
+			}
+			// The header repeats between experiments, and runs may repeat
+			io.WriteString(w, "Run,ReleaseDate,spots,bases,size_MB\n"+
+				"SRR000001,2021-02-03 04:05:06,200,30000,12\n"+
+				"\n"+
+				"Run,ReleaseDate,spots,bases,size_MB\n"+
+				"SRR000002,2021-02-03 04:05:06,,,\n"+
+				"SRR000001,2021-02-03 04:05:06,200,30000,12\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	feed := &EntrezFeed{BaseURL: server.URL}
+	runs, err := feed.RunInfo(context.Background(), []string{"SRP000001", "SRR000003"})
+	if err != nil {
+		t.Fatalf("RunInfo failed: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %+v", runs)
+	}
+	want := RunInfo{Run: "SRR000001", Spots: 200, Bases: 30000, SizeMB: 12, ReleaseDate: "2021-02-03 04:05:06"}
+	if runs[0] != want || runs[1].Run != "SRR000002" || runs[1].Spots != 0 {
+		t.Errorf("unexpected runs %+v", runs)
+	}
+
+	if _, err := ParseRunInfo(strings.NewReader("SRR000001,200\n")); err == nil {
+		t.Error("expected an error for run info without a header")
+	}
+}
@@ -0,0 +1,237 @@
+package downloader
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	srerrors "github.com/nishad/srake/internal/errors"
+)
+
+// ErrChecksumMismatch is returned when a downloaded file does not match its
+// published MD5 checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// partSuffix marks a file whose download has not finished. Fetch resumes
+// from a part file left by an interrupted transfer.
+const partSuffix = ".part"
+
+// Fetcher downloads resolved data files over HTTP, resuming interrupted
+// transfers and verifying each file against its published size and MD5
+// checksum.
+type Fetcher struct {
+	OutputDir     string
+	Client        *http.Client
+	RetryPolicies srerrors.Policies // srerrors.DefaultPolicies when nil
+	OnRetry       srerrors.RetryFunc
+
+	// Segments splits each file of at least MinSegmentSize bytes into this
+	// many ranges downloaded in parallel. 0 or 1 downloads a single stream.
+	Segments       int
+	MinSegmentSize int64 // DefaultMinSegmentSize when 0
+
+	// OnProgress, when set, is called twice a second during a transfer
+	// with the bytes of the file on disk and its size, 0 when unknown
+	OnProgress func(done, total int64)
+}
+
+// FetchResult describes a fetched file
+type FetchResult struct {
+	File     ManifestFile
+	Path     string
+	Bytes    int64 // bytes transferred by this fetch
+	Resumed  int64 // bytes kept from an earlier, interrupted fetch
+	Skipped  bool  // the file was already present and intact
+	Verified bool  // the file matched a published checksum
+	Duration time.Duration
+}
+
+// NewFetcher creates a fetcher writing below outputDir.
+func NewFetcher(outputDir string) *Fetcher {
+	return &Fetcher{
+		OutputDir: outputDir,
+		Client:    &http.Client{Timeout: 0}, // No timeout for large downloads
+	}
+}
+
+// Fetch downloads a file to its path below the output directory. A file
+// already there that matches the published size and checksum is kept. A
+// transfer that fails part way is retried from where it stopped; one that
+// completes with the wrong checksum is discarded and retried from the
+// start.
+func (f *Fetcher) Fetch(ctx context.Context, file ManifestFile) (*FetchResult, error) {
+	start := time.Now()
+	dest := filepath.Join(f.OutputDir, filepath.FromSlash(file.Path))
+	result := &FetchResult{File: file, Path: dest, Verified: file.MD5 != ""}
+
+	if err := checkFile(dest, file); err == nil {
+		result.Skipped = true
+		result.Duration = time.Since(start)
+		return result, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, err
+	}
+
+	policies := f.RetryPolicies
+	if policies == nil {
+		policies = srerrors.DefaultPolicies()
+	}
+	part := dest + partSuffix
+	progress := &transferProgress{report: f.OnProgress}
+	if f.OnProgress != nil {
+		progressCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go progress.run(progressCtx)
+	}
+	download := f.download
+	if f.Segments > 1 {
+		download = f.downloadSegments
+	}
+
+	first := true
+	err := srerrors.Retry(ctx, policies, func() error {
+		n, resumed, err := download(ctx, file, part, progress)
+		result.Bytes += n
+		if first {
+			result.Resumed = resumed
+			first = false
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkFile(part, file); err != nil {
+			return err
+		}
+		return os.Rename(part, dest)
+	}, f.OnRetry)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// download appends the rest of a file to its part file, restarting when
+// the server does not support ranges. It returns the bytes transferred and
+// the bytes already in the part file.
+func (f *Fetcher) download(ctx context.Context, file ManifestFile, part string, progress *transferProgress) (int64, int64, error) {
+	var offset int64
+	if stat, err := os.Stat(part); err == nil {
+		offset = stat.Size()
+	}
+	if file.Size > 0 && offset > file.Size {
+		if err := os.Remove(part); err != nil {
+			return 0, 0, err
+		}
+		offset = 0
+	}
+	if file.Size > 0 && offset == file.Size {
+		return 0, offset, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.URL, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return 0, offset, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return 0, offset, fmt.Errorf("unexpected Content-Range %q resuming %s", resp.Header.Get("Content-Range"), file.URL)
+		}
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// The server sent the whole file
+		flags |= os.O_TRUNC
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The part file already holds the whole file
+		return 0, offset, nil
+	default:
+		return 0, offset, &srerrors.StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	out, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return 0, offset, err
+	}
+	total := file.Size
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	progress.start(total, offset)
+	n, err := io.Copy(out, progress.reader(resp.Body))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return n, offset, err
+}
+
+// checkFile verifies a file against the published size and MD5 checksum.
+// A file too short to be complete is kept so a retry can resume it; a file
+// that is too long or fails the checksum is removed so a retry starts over.
+func checkFile(path string, file ManifestFile) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if file.Size > 0 && stat.Size() < file.Size {
+		return srerrors.E(srerrors.KindNetwork, io.ErrUnexpectedEOF,
+			fmt.Sprintf("%s has %d of %d bytes", filepath.Base(path), stat.Size(), file.Size))
+	}
+
+	mismatch := ""
+	if file.Size > 0 && stat.Size() > file.Size {
+		mismatch = fmt.Sprintf("%s has %d bytes, expected %d", filepath.Base(path), stat.Size(), file.Size)
+	} else if file.MD5 != "" {
+		sum, err := fileMD5(path)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, file.MD5) {
+			mismatch = fmt.Sprintf("%s has MD5 %s, expected %s", filepath.Base(path), sum, file.MD5)
+		}
+	}
+	if mismatch == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	// A corrupt transfer is worth retrying like a network failure
+	return srerrors.E(srerrors.KindNetwork, ErrChecksumMismatch, mismatch)
+}
+
+// fileMD5 returns the hex MD5 checksum of a file
+func fileMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New() // #nosec G401 - MD5 is the checksum ENA publishes
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,125 @@
+package downloader
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	srerrors "github.com/nishad/srake/internal/errors"
+)
+
+func TestFetcherFetch(t *testing.T) {
+	content := strings.Repeat("ACGT", 1024)
+	sum := md5.Sum([]byte(content))
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		body := content
+		if r.URL.Path == "/corrupt.fastq.gz" {
+			body = strings.Repeat("N", len(content))
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetcher := NewFetcher(dir)
+	fetcher.Client = server.Client()
+	fetcher.RetryPolicies = srerrors.Policies{srerrors.KindNetwork: {MaxAttempts: 2}}
+
+	file := ManifestFile{
+		Run:  "SRR000001",
+		URL:  server.URL + "/SRR000001_1.fastq.gz",
+		Path: "SRR000001/SRR000001_1.fastq.gz",
+		Size: int64(len(content)),
+		MD5:  hex.EncodeToString(sum[:]),
+	}
+
+	// An interrupted transfer resumes from its part file
+	dest := filepath.Join(dir, "SRR000001", "SRR000001_1.fastq.gz")
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest+partSuffix, []byte(content[:1000]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := fetcher.Fetch(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if result.Resumed != 1000 || result.Bytes != int64(len(content)-1000) || !result.Verified {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=1000-" {
+		t.Errorf("expected a ranged request, got %q", ranges)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != content {
+		t.Error("fetched file does not match the source")
+	}
+	if _, err := os.Stat(dest + partSuffix); !os.IsNotExist(err) {
+		t.Error("expected the part file to be renamed")
+	}
+
+	// A complete file is not fetched again
+	ranges = nil
+	result, err = fetcher.Fetch(context.Background(), file)
+	if err != nil {
+		t.Fatalf("second Fetch failed: %v", err)
+	}
+	if !result.Skipped || len(ranges) != 0 {
+		t.Errorf("expected the file to be skipped, got %+v after %d requests", result, len(ranges))
+	}
+
+	// A file failing its checksum is retried and then rejected
+	ranges = nil
+	corrupt := file
+	corrupt.URL = server.URL + "/corrupt.fastq.gz"
+	corrupt.Path = "SRR000001/corrupt.fastq.gz"
+	_, err = fetcher.Fetch(context.Background(), corrupt)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if len(ranges) != 2 {
+		t.Errorf("expected the corrupt file to be fetched twice, got %d requests", len(ranges))
+	}
+	if _, err := os.Stat(filepath.Join(dir, corrupt.Path+partSuffix)); !os.IsNotExist(err) {
+		t.Error("expected the corrupt part file to be removed")
+	}
+}
+
+func TestFetcherRestartsWithoutRanges(t *testing.T) {
+	content := "0123456789"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, content) // ignores Range
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetcher := NewFetcher(dir)
+	fetcher.Client = server.Client()
+	file := ManifestFile{Run: "SRR000002", URL: server.URL, Path: "SRR000002.sra", Size: int64(len(content))}
+	if err := os.WriteFile(filepath.Join(dir, file.Path+partSuffix), []byte("01234"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := fetcher.Fetch(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if result.Verified || result.Bytes != int64(len(content)) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, file.Path)); string(got) != content {
+		t.Errorf("fetched %q, want %q", got, content)
+	}
+}
@@ -0,0 +1,288 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Download manifest formats
+const (
+	ManifestAria2  = "aria2"   // aria2c input file (aria2c -i)
+	ManifestWget   = "wget"    // POSIX shell script using wget
+	ManifestAWSCLI = "aws-cli" // POSIX shell script using aws s3 cp
+)
+
+// DefaultENAFileReportURL is the ENA Portal API endpoint listing the files of
+// a run.
+const DefaultENAFileReportURL = "https://www.ebi.ac.uk/ena/portal/api/filereport"
+
+// ManifestFormats lists the supported manifest formats.
+func ManifestFormats() []string {
+	return []string{ManifestAria2, ManifestWget, ManifestAWSCLI}
+}
+
+// ValidManifestFormat reports whether format names a supported manifest
+// format.
+func ValidManifestFormat(format string) bool {
+	switch format {
+	case ManifestAria2, ManifestWget, ManifestAWSCLI:
+		return true
+	}
+	return false
+}
+
+// ManifestFile is a data file listed in a download manifest. Size and MD5
+// are zero when the source does not publish them.
+type ManifestFile struct {
+	Run  string `json:"run"`
+	URL  string `json:"url"`
+	Path string `json:"path"` // output path relative to the download directory
+	Size int64  `json:"size,omitempty"`
+	MD5  string `json:"md5,omitempty"`
+}
+
+// FileResolver finds the data files of a run.
+type FileResolver interface {
+	Resolve(ctx context.Context, run string, fileType SRAFileType) ([]ManifestFile, error)
+}
+
+// ENAResolver resolves run files, with sizes and MD5 checksums, from the ENA
+// file report.
+type ENAResolver struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewENAResolver creates a resolver for the public ENA Portal API.
+func NewENAResolver() *ENAResolver {
+	return &ENAResolver{
+		BaseURL: DefaultENAFileReportURL,
+		Client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Resolve returns the FASTQ or SRA files ENA lists for a run. A run ENA
+// knows but has no files of the requested type yields no files.
+func (r *ENAResolver) Resolve(ctx context.Context, run string, fileType SRAFileType) ([]ManifestFile, error) {
+	prefix := "sra"
+	if fileType == SRAFileTypeFASTQ {
+		prefix = "fastq"
+	}
+	fields := []string{"run_accession", prefix + "_ftp", prefix + "_bytes", prefix + "_md5"}
+
+	params := url.Values{}
+	params.Set("accession", run)
+	params.Set("result", "read_run")
+	params.Set("fields", strings.Join(fields, ","))
+	params.Set("format", "tsv")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.BaseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ENA for %s: %w", run, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("ENA file report for %s returned HTTP %d", run, resp.StatusCode)
+	}
+
+	return parseENAFileReport(resp.Body, fields)
+}
+
+// parseENAFileReport reads a TSV file report. File columns hold one value
+// per file, separated by semicolons.
+func parseENAFileReport(r io.Reader, fields []string) ([]ManifestFile, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var columns map[string]int
+	var files []ManifestFile
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		cells := strings.Split(line, "\t")
+		if columns == nil {
+			columns = make(map[string]int, len(cells))
+			for i, name := range cells {
+				columns[name] = i
+			}
+			for _, name := range fields {
+				if _, ok := columns[name]; !ok {
+					return nil, fmt.Errorf("ENA file report is missing column %s", name)
+				}
+			}
+			continue
+		}
+
+		cell := func(name string) []string {
+			i := columns[name]
+			if i >= len(cells) || cells[i] == "" {
+				return nil
+			}
+			return strings.Split(cells[i], ";")
+		}
+		run := cells[columns[fields[0]]]
+		urls, sizes, sums := cell(fields[1]), cell(fields[2]), cell(fields[3])
+		for i, u := range urls {
+			if u == "" {
+				continue
+			}
+			if !strings.Contains(u, "://") {
+				u = "https://" + u
+			}
+			file := ManifestFile{Run: run, URL: u, Path: run + "/" + path.Base(u)}
+			if i < len(sizes) {
+				file.Size, _ = strconv.ParseInt(sizes[i], 10, 64)
+			}
+			if i < len(sums) {
+				file.MD5 = sums[i]
+			}
+			files = append(files, file)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ENA file report: %w", err)
+	}
+	return files, nil
+}
+
+// WriteManifest writes files as a manifest in the given format.
+func WriteManifest(w io.Writer, format string, files []ManifestFile) error {
+	switch format {
+	case ManifestAria2:
+		return writeAria2Manifest(w, files)
+	case ManifestWget:
+		return writeScriptManifest(w, files, `wget -c -O "$2" "$1"`, func(f ManifestFile) (string, error) {
+			return f.URL, nil
+		})
+	case ManifestAWSCLI:
+		return writeScriptManifest(w, files, `aws s3 cp --no-sign-request "$1" "$2"`, func(f ManifestFile) (string, error) {
+			return s3URI(f.URL)
+		})
+	}
+	return fmt.Errorf("unsupported manifest format: %s (supported: %s)",
+		format, strings.Join(ManifestFormats(), ", "))
+}
+
+// manifestSummary describes the manifest contents for its header comment.
+func manifestSummary(files []ManifestFile) string {
+	var total int64
+	unknown := 0
+	for _, f := range files {
+		if f.Size > 0 {
+			total += f.Size
+		} else {
+			unknown++
+		}
+	}
+	summary := fmt.Sprintf("%d files, %s", len(files), FormatSize(total))
+	if unknown > 0 {
+		summary += fmt.Sprintf(" (%d without a published size)", unknown)
+	}
+	return summary
+}
+
+// writeAria2Manifest writes an aria2c input file. aria2c verifies the MD5
+// checksum itself; sizes are noted in comments.
+func writeAria2Manifest(w io.Writer, files []ManifestFile) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# srake download manifest: %s\n", manifestSummary(files))
+	fmt.Fprintf(bw, "# Run with: aria2c -i <this file> -c\n")
+	for _, f := range files {
+		if f.Size > 0 {
+			fmt.Fprintf(bw, "# %s %d bytes\n", f.Run, f.Size)
+		}
+		fmt.Fprintf(bw, "%s\n  out=%s\n", f.URL, f.Path)
+		if f.MD5 != "" {
+			fmt.Fprintf(bw, "  checksum=md5=%s\n", f.MD5)
+		}
+	}
+	return bw.Flush()
+}
+
+// manifestScriptHeader defines the functions shared by script manifests:
+// verify checks a downloaded file against its expected size and MD5, and
+// fetch downloads with the format's command and then verifies.
+const manifestScriptHeader = `set -eu
+
+verify() {
+	if [ -n "$2" ] && [ "$(wc -c < "$1" | tr -d ' ')" != "$2" ]; then
+		echo "size mismatch: $1" >&2
+		exit 1
+	fi
+	if [ -n "$3" ]; then
+		if command -v md5sum >/dev/null 2>&1; then
+			sum=$(md5sum "$1" | cut -d ' ' -f 1)
+		else
+			sum=$(md5 -q "$1")
+		fi
+		if [ "$sum" != "$3" ]; then
+			echo "checksum mismatch: $1" >&2
+			exit 1
+		fi
+	fi
+}
+
+fetch() {
+	mkdir -p "$(dirname "$2")"
+	%s
+	verify "$2" "$3" "$4"
+}
+
+`
+
+// writeScriptManifest writes a POSIX shell script that fetches each file
+// with command and verifies it. location maps a file to the argument the
+// command downloads from.
+func writeScriptManifest(w io.Writer, files []ManifestFile, command string, location func(ManifestFile) (string, error)) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#!/bin/sh\n# srake download manifest: %s\n", manifestSummary(files))
+	fmt.Fprintf(bw, manifestScriptHeader, command)
+	for _, f := range files {
+		loc, err := location(f)
+		if err != nil {
+			return err
+		}
+		size := ""
+		if f.Size > 0 {
+			size = strconv.FormatInt(f.Size, 10)
+		}
+		fmt.Fprintf(bw, "fetch %s %s %s %s\n", shellQuote(loc), shellQuote(f.Path), shellQuote(size), shellQuote(f.MD5))
+	}
+	return bw.Flush()
+}
+
+// s3URI converts a virtual-hosted S3 HTTPS URL into an s3:// URI.
+func s3URI(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Scheme == "s3" {
+		return rawURL, nil
+	}
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Host, ".s3.amazonaws.com") {
+		return "", fmt.Errorf("%s is not an S3 location; aws-cli manifests need the aws source", rawURL)
+	}
+	bucket := strings.TrimSuffix(u.Host, ".s3.amazonaws.com")
+	return "s3://" + bucket + u.Path, nil
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
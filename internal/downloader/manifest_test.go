@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestENAResolverResolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("accession"); got != "SRR000001" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !strings.Contains(r.URL.Query().Get("fields"), "fastq_md5") {
+			t.Errorf("expected fastq fields, got %q", r.URL.Query().Get("fields"))
+		}
+		w.Write([]byte("run_accession\tfastq_ftp\tfastq_bytes\tfastq_md5\n" +
+			"SRR000001\tftp.sra.ebi.ac.uk/vol1/fastq/SRR000/SRR000001/SRR000001_1.fastq.gz;" +
+			"ftp.sra.ebi.ac.uk/vol1/fastq/SRR000/SRR000001/SRR000001_2.fastq.gz\t100;200\taaa;bbb\n"))
+	}))
+	defer server.Close()
+
+	resolver := &ENAResolver{BaseURL: server.URL, Client: server.Client()}
+	files, err := resolver.Resolve(context.Background(), "SRR000001", SRAFileTypeFASTQ)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	want := ManifestFile{
+		Run:  "SRR000001",
+		URL:  "https://ftp.sra.ebi.ac.uk/vol1/fastq/SRR000/SRR000001/SRR000001_2.fastq.gz",
+		Path: "SRR000001/SRR000001_2.fastq.gz",
+		Size: 200,
+		MD5:  "bbb",
+	}
+	if files[1] != want {
+		t.Errorf("unexpected file: %+v", files[1])
+	}
+
+	files, err = resolver.Resolve(context.Background(), "SRR999999", SRAFileTypeFASTQ)
+	if err != nil {
+		t.Fatalf("Resolve of unknown run failed: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected no files for unknown run, got %d", len(files))
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	files := []ManifestFile{
+		{Run: "SRR000001", URL: "https://sra-pub-run-odp.s3.amazonaws.com/sra/SRR000001/SRR000001",
+			Path: "SRR000001/SRR000001.sra", Size: 1024, MD5: "abc"},
+		{Run: "SRR000002", URL: "https://sra-pub-run-odp.s3.amazonaws.com/sra/SRR000002/SRR000002",
+			Path: "SRR000002/SRR000002.sra"},
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{ManifestAria2, []string{
+			"2 files, 1.0 KB (1 without a published size)",
+			"https://sra-pub-run-odp.s3.amazonaws.com/sra/SRR000001/SRR000001\n  out=SRR000001/SRR000001.sra\n  checksum=md5=abc\n",
+		}},
+		{ManifestWget, []string{
+			"#!/bin/sh",
+			`wget -c -O "$2" "$1"`,
+			"fetch 'https://sra-pub-run-odp.s3.amazonaws.com/sra/SRR000001/SRR000001' 'SRR000001/SRR000001.sra' '1024' 'abc'",
+			"fetch 'https://sra-pub-run-odp.s3.amazonaws.com/sra/SRR000002/SRR000002' 'SRR000002/SRR000002.sra' '' ''",
+		}},
+		{ManifestAWSCLI, []string{
+			"aws s3 cp --no-sign-request",
+			"fetch 's3://sra-pub-run-odp/sra/SRR000001/SRR000001' 'SRR000001/SRR000001.sra' '1024' 'abc'",
+		}},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteManifest(&buf, tt.format, files); err != nil {
+			t.Fatalf("%s: WriteManifest failed: %v", tt.format, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s manifest missing %q:\n%s", tt.format, want, buf.String())
+			}
+		}
+	}
+
+	ena := []ManifestFile{{Run: "SRR000001", URL: "https://ftp.sra.ebi.ac.uk/vol1/SRR000001.fastq.gz", Path: "SRR000001/SRR000001.fastq.gz"}}
+	if err := WriteManifest(&bytes.Buffer{}, ManifestAWSCLI, ena); err == nil {
+		t.Error("expected an error writing non-S3 files as an aws-cli manifest")
+	}
+	if err := WriteManifest(&bytes.Buffer{}, "curl", files); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
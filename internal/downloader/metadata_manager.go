@@ -40,26 +40,29 @@ const (
 	FileTypeUnknown FileType = "unknown"
 )
 
-// MetadataManager discovers and manages metadata files from NCBI
+// MetadataManager discovers and manages metadata files from NCBI or one
+// of its mirrors
 type MetadataManager struct {
 	client  *http.Client
-	baseURL string
+	source  MetadataSource
+	daily   *regexp.Regexp
+	monthly *regexp.Regexp
 }
 
-// NewMetadataManager creates a new metadata manager
+// NewMetadataManager creates a new metadata manager for NCBI
 func NewMetadataManager() *MetadataManager {
-	return &MetadataManager{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		baseURL: NCBIMetadataBaseURL,
-	}
+	return NewMetadataManagerForSource(MetadataSources["ncbi"])
+}
+
+// Source returns the source the manager lists and fetches files from
+func (mm *MetadataManager) Source() MetadataSource {
+	return mm.source
 }
 
 // ListAvailableFiles discovers all available metadata files
 func (mm *MetadataManager) ListAvailableFiles(ctx context.Context) ([]MetadataFile, error) {
 	// Fetch directory listing
-	req, err := http.NewRequestWithContext(ctx, "GET", mm.baseURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", mm.source.ListingURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -108,9 +111,6 @@ func (mm *MetadataManager) parseDirectoryListing(html string) []MetadataFile {
 		matches = altPattern.FindAllStringSubmatch(html, -1)
 	}
 
-	dailyRegex := regexp.MustCompile(DailyFilePattern)
-	monthlyRegex := regexp.MustCompile(MonthlyFilePattern)
-
 	for _, match := range matches {
 		if len(match) < 4 {
 			continue
@@ -118,31 +118,22 @@ func (mm *MetadataManager) parseDirectoryListing(html string) []MetadataFile {
 
 		filename := match[1]
 
-		// Skip if not a metadata file we're interested in
-		if !strings.Contains(filename, "NCBI_SRA_Metadata") {
-			continue
-		}
-
-		// Determine file type
+		// Determine file type, skipping files that are not metadata dumps
 		var fileType FileType
 		var date time.Time
 
-		if monthlyRegex.MatchString(filename) {
+		if dateMatch := mm.monthly.FindStringSubmatch(filename); dateMatch != nil {
 			fileType = FileTypeMonthly
-			dateMatch := monthlyRegex.FindStringSubmatch(filename)
-			if len(dateMatch) > 1 {
-				date = parseDate(dateMatch[1])
-			}
-		} else if dailyRegex.MatchString(filename) {
+			date = parseDate(dateMatch[1])
+		} else if dateMatch := mm.daily.FindStringSubmatch(filename); dateMatch != nil {
 			fileType = FileTypeDaily
-			dateMatch := dailyRegex.FindStringSubmatch(filename)
-			if len(dateMatch) > 1 {
-				date = parseDate(dateMatch[1])
-			}
-		} else {
+			date = parseDate(dateMatch[1])
+		} else if strings.Contains(filename, "NCBI_SRA_Metadata") {
 			fileType = FileTypeUnknown
 			// Try to parse date from file modification time
 			date = parseModTime(match[2])
+		} else {
+			continue
 		}
 
 		// Parse size
@@ -150,7 +141,7 @@ func (mm *MetadataManager) parseDirectoryListing(html string) []MetadataFile {
 
 		file := MetadataFile{
 			Name:         filename,
-			URL:          mm.baseURL + filename,
+			URL:          mm.source.URL(filename),
 			Size:         size,
 			Date:         date,
 			Type:         fileType,
@@ -189,6 +180,22 @@ func (mm *MetadataManager) GetLatestFile(ctx context.Context, fileType FileType)
 	return &files[0], nil
 }
 
+// PendingUpdates returns the daily updates dated after the given day that
+// are not in applied, oldest first, which is the order they must be
+// applied in.
+func PendingUpdates(files []MetadataFile, after time.Time, applied map[string]bool) []MetadataFile {
+	var pending []MetadataFile
+	for _, f := range files {
+		if f.Type == FileTypeDaily && f.Date.After(after) && !applied[f.Name] {
+			pending = append(pending, f)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Date.Before(pending[j].Date)
+	})
+	return pending
+}
+
 // AutoSelectFile implements smart auto-selection logic
 func (mm *MetadataManager) AutoSelectFile(ctx context.Context) (*MetadataFile, error) {
 	files, err := mm.ListAvailableFiles(ctx)
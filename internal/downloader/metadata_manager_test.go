@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+)
+
+func TestPendingUpdates(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	// Listed newest first, as returned by ListAvailableFiles
+	files := []MetadataFile{
+		{Name: "NCBI_SRA_Metadata_20250918.tar.gz", Type: FileTypeDaily, Date: day("2025-09-18")},
+		{Name: "NCBI_SRA_Metadata_20250917.tar.gz", Type: FileTypeDaily, Date: day("2025-09-17")},
+		{Name: "NCBI_SRA_Metadata_20250916.tar.gz", Type: FileTypeDaily, Date: day("2025-09-16")},
+		{Name: "NCBI_SRA_Metadata_Full_20250915.tar.gz", Type: FileTypeMonthly, Date: day("2025-09-15")},
+		{Name: "NCBI_SRA_Metadata_20250914.tar.gz", Type: FileTypeDaily, Date: day("2025-09-14")},
+	}
+	applied := map[string]bool{"NCBI_SRA_Metadata_20250917.tar.gz": true}
+
+	pending := PendingUpdates(files, day("2025-09-15"), applied)
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending updates, got %d", len(pending))
+	}
+	if pending[0].Name != "NCBI_SRA_Metadata_20250916.tar.gz" || pending[1].Name != "NCBI_SRA_Metadata_20250918.tar.gz" {
+		t.Errorf("expected pending updates oldest first, got %s, %s", pending[0].Name, pending[1].Name)
+	}
+
+	if pending := PendingUpdates(files, day("2025-09-18"), nil); len(pending) != 0 {
+		t.Errorf("expected no pending updates, got %d", len(pending))
+	}
+}
+
+func TestMetadataSourceFromConfig(t *testing.T) {
+	src, err := MetadataSourceFromConfig("ena", map[string]config.MirrorConfig{
+		"ena": {ListingURL: "https://mirror.example.org/sra/Metadata/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := src.URL("NCBI_SRA_Metadata_20250916.tar.gz"); got != "https://mirror.example.org/sra/Metadata/NCBI_SRA_Metadata_20250916.tar.gz" {
+		t.Errorf("unexpected file URL %s", got)
+	}
+
+	if _, err := MetadataSourceFromConfig("sra", nil); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+	if _, err := MetadataSourceFromConfig("ddbj", map[string]config.MirrorConfig{
+		"ddbj": {FileURL: "https://mirror.example.org/sra/"},
+	}); err == nil {
+		t.Error("expected an error for a file URL without {name}")
+	}
+	if _, err := MetadataSourceFromConfig("ddbj", map[string]config.MirrorConfig{
+		"ddbj": {DailyPattern: `^NCBI_SRA_Metadata_\d{8}\.tar\.gz$`},
+	}); err == nil {
+		t.Error("expected an error for a pattern that does not capture the date")
+	}
+}
+
+func TestParseDirectoryListingMirror(t *testing.T) {
+	mm := NewMetadataManagerForSource(MetadataSources["ddbj"])
+	listing := `<a href="NCBI_SRA_Metadata_Full_20250915.tar.gz">NCBI_SRA_Metadata_Full_20250915.tar.gz</a>   15-Sep-2025 04:10  14G
+<a href="NCBI_SRA_Metadata_20250916.tar.gz">NCBI_SRA_Metadata_20250916.tar.gz</a>   16-Sep-2025 04:10  120M
+<a href="README.tar.gz">README.tar.gz</a>   01-Jan-2025 00:00  1K`
+
+	files := mm.parseDirectoryListing(listing)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 metadata files, got %d", len(files))
+	}
+	for _, f := range files {
+		if f.URL != DDBJMetadataBaseURL+f.Name {
+			t.Errorf("expected %s to be fetched from the DDBJ mirror, got %s", f.Name, f.URL)
+		}
+	}
+	if files[0].Type != FileTypeMonthly || files[1].Type != FileTypeDaily {
+		t.Errorf("unexpected file types %s, %s", files[0].Type, files[1].Type)
+	}
+}
@@ -0,0 +1,123 @@
+package downloader
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// runInfoSearchBatch is how many accessions one esearch request looks up
+const runInfoSearchBatch = 100
+
+// RunInfo is a run's statistics and release date as listed in NCBI's SRA
+// run info
+type RunInfo struct {
+	Run         string `json:"run"`
+	Spots       int64  `json:"spots,omitempty"`
+	Bases       int64  `json:"bases,omitempty"`
+	SizeMB      int64  `json:"size_mb,omitempty"`
+	ReleaseDate string `json:"release_date,omitempty"`
+}
+
+// RunInfo returns the run info of the runs of SRA records by accession:
+// of runs, or of every run of a study, experiment or sample. Accessions
+// NCBI does not know are left out.
+func (f *EntrezFeed) RunInfo(ctx context.Context, accessions []string) ([]RunInfo, error) {
+	var uids []string
+	for start := 0; start < len(accessions); start += runInfoSearchBatch {
+		end := min(start+runInfoSearchBatch, len(accessions))
+		terms := make([]string, 0, end-start)
+		for _, acc := range accessions[start:end] {
+			terms = append(terms, acc+"[ACCN]")
+		}
+		found, err := f.search(ctx, url.Values{"term": {strings.Join(terms, " OR ")}})
+		if err != nil {
+			return nil, err
+		}
+		uids = append(uids, found...)
+	}
+
+	var runs []RunInfo
+	seen := make(map[string]bool)
+	for _, batch := range f.Batches(uids) {
+		body, err := f.get(ctx, "efetch.fcgi", url.Values{
+			"db":      {"sra"},
+			"id":      {strings.Join(batch, ",")},
+			"rettype": {"runinfo"},
+			"retmode": {"csv"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		infos, err := ParseRunInfo(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if !seen[info.Run] {
+				seen[info.Run] = true
+				runs = append(runs, info)
+			}
+		}
+	}
+	return runs, nil
+}
+
+// ParseRunInfo reads the run info CSV of E-utilities, which may repeat its
+// header between the records of several experiments
+func ParseRunInfo(r io.Reader) ([]RunInfo, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var columns map[string]int
+	var runs []RunInfo
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return runs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse run info: %w", err)
+		}
+		if len(record) == 0 || (len(record) == 1 && record[0] == "") {
+			continue
+		}
+		if record[0] == "Run" {
+			columns = make(map[string]int, len(record))
+			for i, name := range record {
+				columns[name] = i
+			}
+			continue
+		}
+		if columns == nil {
+			return nil, fmt.Errorf("failed to parse run info: no header")
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		number := func(name string) int64 {
+			n, _ := strconv.ParseInt(field(name), 10, 64)
+			return n
+		}
+		if field("Run") == "" {
+			continue
+		}
+		runs = append(runs, RunInfo{
+			Run:         field("Run"),
+			Spots:       number("spots"),
+			Bases:       number("bases"),
+			SizeMB:      number("size_MB"),
+			ReleaseDate: field("ReleaseDate"),
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	srerrors "github.com/nishad/srake/internal/errors"
+)
+
+// DefaultMinSegmentSize is the smallest file split into segments when
+// Fetcher.MinSegmentSize is not set. Smaller files gain little from
+// parallel ranges.
+const DefaultMinSegmentSize = 64 << 20
+
+// progressInterval is how often OnProgress is called during a transfer
+const progressInterval = 500 * time.Millisecond
+
+// segment is the byte range [start, end) of a file downloaded by one
+// connection
+type segment struct {
+	start, end int64
+}
+
+// path returns the file a segment is downloaded to. The range is part of
+// the name so that a file split differently by an earlier run is never
+// mistaken for this segment.
+func (s segment) path(part string) string {
+	return fmt.Sprintf("%s.%d-%d", part, s.start, s.end)
+}
+
+// splitSegments divides size bytes into n ranges of about equal length
+func splitSegments(size int64, n int) []segment {
+	if int64(n) > size {
+		n = int(max(size, 1))
+	}
+	segments := make([]segment, n)
+	length := size / int64(n)
+	for i := range segments {
+		segments[i].start = int64(i) * length
+		segments[i].end = segments[i].start + length
+	}
+	segments[n-1].end = size
+	return segments
+}
+
+// downloadSegments downloads a file over f.Segments parallel connections,
+// each requesting one range. The part file always holds a prefix of the
+// file: the first segment is appended to it directly, and the others are
+// downloaded to files of their own and appended in order once all are
+// complete. An interrupted download resumes each segment where it
+// stopped. Servers that do not support ranges, and files smaller than
+// MinSegmentSize, are downloaded as a single stream.
+func (f *Fetcher) downloadSegments(ctx context.Context, file ManifestFile, part string, progress *transferProgress) (int64, int64, error) {
+	size, ranges, err := f.probe(ctx, file.URL)
+	if err != nil {
+		return 0, 0, err
+	}
+	minSize := f.MinSegmentSize
+	if minSize <= 0 {
+		minSize = DefaultMinSegmentSize
+	}
+	if !ranges || size < minSize {
+		return f.download(ctx, file, part, progress)
+	}
+	if file.Size > 0 && size != file.Size {
+		return 0, 0, fmt.Errorf("%s has %d bytes, expected %d", file.URL, size, file.Size)
+	}
+
+	segments := splitSegments(size, f.Segments)
+	if err := removeStaleSegments(part, segments); err != nil {
+		return 0, 0, err
+	}
+
+	var prefix int64
+	if stat, err := os.Stat(part); err == nil {
+		prefix = stat.Size()
+	}
+	if prefix > size {
+		if err := os.Remove(part); err != nil {
+			return 0, 0, err
+		}
+		prefix = 0
+	}
+
+	// Count the bytes already on disk as resumed
+	resumed := prefix
+	for _, s := range segments[1:] {
+		if s.end > prefix {
+			if stat, err := os.Stat(s.path(part)); err == nil {
+				resumed += min(stat.Size(), s.end-s.start)
+			}
+		}
+	}
+	progress.start(size, resumed)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var transferred atomic.Int64
+	var wg sync.WaitGroup
+	errs := make([]error, len(segments))
+	for i, s := range segments {
+		if s.end <= prefix {
+			continue // Already in the part file
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path := s.path(part)
+			if i == 0 {
+				path = part
+			}
+			n, err := f.downloadRange(ctx, file.URL, path, s, progress)
+			transferred.Add(n)
+			if err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Report the failure that cancelled the other segments
+	var failure error
+	for _, err := range errs {
+		if err != nil && (failure == nil || errors.Is(failure, context.Canceled)) {
+			failure = err
+		}
+	}
+	if failure != nil {
+		return transferred.Load(), resumed, failure
+	}
+	return transferred.Load(), resumed, joinSegments(part, segments)
+}
+
+// downloadRange appends the rest of segment s to path, which holds the
+// bytes of the segment already downloaded
+func (f *Fetcher) downloadRange(ctx context.Context, url, path string, s segment, progress *transferProgress) (int64, error) {
+	var have int64
+	if stat, err := os.Stat(path); err == nil {
+		have = stat.Size()
+	}
+	if have > s.end-s.start {
+		// Longer than the segment, so not written by it; start over
+		if err := os.Truncate(path, 0); err != nil {
+			return 0, err
+		}
+		have = 0
+	}
+	from := s.start + have
+	if from == s.end {
+		return 0, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, s.end-1))
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, &srerrors.StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", from)) {
+		return 0, fmt.Errorf("unexpected Content-Range %q for %s", resp.Header.Get("Content-Range"), url)
+	}
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	want := s.end - from
+	n, err := io.Copy(out, progress.reader(io.LimitReader(resp.Body, want)))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n < want {
+		err = srerrors.E(srerrors.KindNetwork, io.ErrUnexpectedEOF,
+			fmt.Sprintf("range %d-%d ended after %d of %d bytes", from, s.end-1, n, want))
+	}
+	return n, err
+}
+
+// probe returns the size of the file at url and whether the server serves
+// ranges of it
+func (f *Fetcher) probe(ctx context.Context, url string) (int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	// The body is at most one byte unless the server ignored the range, in
+	// which case closing it abandons the transfer
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-0/<size>
+		contentRange := resp.Header.Get("Content-Range")
+		i := strings.LastIndexByte(contentRange, '/')
+		if i < 0 {
+			return 0, false, nil
+		}
+		size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+		if err != nil {
+			return 0, false, nil // "*" when the size is unknown
+		}
+		return size, true, nil
+	case http.StatusOK:
+		return resp.ContentLength, false, nil
+	default:
+		return 0, false, &srerrors.StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+}
+
+// joinSegments appends the segment files to the part file in order,
+// removing each once it is appended. A join interrupted part way is
+// finished by the next download.
+func joinSegments(part string, segments []segment) error {
+	out, err := os.OpenFile(part, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	stat, err := out.Stat()
+	if err != nil {
+		return err
+	}
+	prefix := stat.Size()
+
+	for _, s := range segments[1:] {
+		if s.end <= prefix {
+			continue
+		}
+		if prefix > s.start {
+			// Drop a partly appended segment and append it again
+			if err := out.Truncate(s.start); err != nil {
+				return err
+			}
+		}
+		if err := appendFile(out, s.start, s.path(part)); err != nil {
+			return err
+		}
+		if err := out.Sync(); err != nil {
+			return err
+		}
+		if err := os.Remove(s.path(part)); err != nil {
+			return err
+		}
+		prefix = s.end
+	}
+	return nil
+}
+
+// appendFile copies the file at path to out at offset
+func appendFile(out *os.File, offset int64, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(io.NewOffsetWriter(out, offset), in)
+	return err
+}
+
+// removeStaleSegments removes segment files of part left by a run that
+// split the file differently
+func removeStaleSegments(part string, segments []segment) error {
+	current := make(map[string]bool, len(segments))
+	for _, s := range segments {
+		current[filepath.Base(s.path(part))] = true
+	}
+	entries, err := os.ReadDir(filepath.Dir(part))
+	if err != nil {
+		return err
+	}
+	prefix := filepath.Base(part) + "."
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, prefix) && !current[name] && isRange(name[len(prefix):]) {
+			if err := os.Remove(filepath.Join(filepath.Dir(part), name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isRange reports whether s has the form <start>-<end>
+func isRange(s string) bool {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return false
+	}
+	_, err1 := strconv.ParseInt(start, 10, 64)
+	_, err2 := strconv.ParseInt(end, 10, 64)
+	return err1 == nil && err2 == nil
+}
+
+// transferProgress counts the bytes of a file downloaded and reports them
+// to Fetcher.OnProgress
+type transferProgress struct {
+	report func(done, total int64)
+	done   atomic.Int64
+	total  atomic.Int64
+}
+
+// start sets the file size and the bytes already downloaded
+func (p *transferProgress) start(total, done int64) {
+	p.total.Store(total)
+	p.done.Store(done)
+}
+
+// reader counts the bytes read from r
+func (p *transferProgress) reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, done: &p.done}
+}
+
+// run calls report until ctx ends
+func (p *transferProgress) run(ctx context.Context) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.report(p.done.Load(), p.total.Load())
+		}
+	}
+}
+
+type progressReader struct {
+	r    io.Reader
+	done *atomic.Int64
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.done.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,127 @@
+package downloader
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	srerrors "github.com/nishad/srake/internal/errors"
+)
+
+func TestFetcherSegments(t *testing.T) {
+	content := strings.Repeat("ACGTTGCA", 4096)
+	sum := md5.Sum([]byte(content))
+
+	var mu sync.Mutex
+	var ranges []string
+	failOnce := "bytes=24576-32767"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		rng := r.Header.Get("Range")
+		ranges = append(ranges, rng)
+		fail := rng == failOnce
+		if fail {
+			failOnce = ""
+		}
+		mu.Unlock()
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	fetcher := NewFetcher(dir)
+	fetcher.Client = server.Client()
+	fetcher.RetryPolicies = srerrors.Policies{srerrors.KindNetwork: {MaxAttempts: 2}}
+	fetcher.Segments = 4
+	fetcher.MinSegmentSize = 1024
+
+	file := ManifestFile{
+		URL:  server.URL + "/NCBI_SRA_Metadata_Full_20250901.tar.gz",
+		Path: "NCBI_SRA_Metadata_Full_20250901.tar.gz",
+		MD5:  hex.EncodeToString(sum[:]),
+	}
+
+	// Segments left by an interrupted run resume where they stopped, and
+	// segments of a different split are discarded
+	part := filepath.Join(dir, file.Path) + partSuffix
+	os.WriteFile(part, []byte(content[:100]), 0644)
+	os.WriteFile(part+".8192-16384", []byte(content[8192:9000]), 0644)
+	os.WriteFile(part+".0-10923", []byte("stale"), 0644)
+
+	result, err := fetcher.Fetch(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	data, err := os.ReadFile(result.Path)
+	if err != nil || string(data) != content {
+		t.Fatalf("downloaded file differs from the original (%d bytes, %v)", len(data), err)
+	}
+	if result.Resumed != 100+808 {
+		t.Errorf("expected 908 resumed bytes, got %d", result.Resumed)
+	}
+
+	want := []string{"bytes=0-0", "bytes=100-8191", "bytes=9000-16383", "bytes=16384-24575"}
+	for _, w := range want {
+		found := false
+		for _, r := range ranges {
+			found = found || r == w
+		}
+		if !found {
+			t.Errorf("expected a request for %s, got %v", w, ranges)
+		}
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.part*"))
+	if len(leftovers) > 0 {
+		t.Errorf("expected no part files, got %v", leftovers)
+	}
+}
+
+func TestFetcherSegmentsFallback(t *testing.T) {
+	content := strings.Repeat("N", 4096)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A server that ignores ranges
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(t.TempDir())
+	fetcher.Client = server.Client()
+	fetcher.Segments = 4
+	fetcher.MinSegmentSize = 1024
+
+	result, err := fetcher.Fetch(context.Background(), ManifestFile{URL: server.URL + "/a.tar.gz", Path: "a.tar.gz"})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if data, _ := os.ReadFile(result.Path); string(data) != content {
+		t.Errorf("downloaded file differs from the original")
+	}
+	if len(ranges) != 2 || ranges[1] != "" {
+		t.Errorf("expected a probe and one plain request, got %q", ranges)
+	}
+}
+
+func TestSplitSegments(t *testing.T) {
+	segments := splitSegments(10, 3)
+	if len(segments) != 3 || segments[0] != (segment{0, 3}) || segments[2] != (segment{6, 10}) {
+		t.Errorf("unexpected segments %v", segments)
+	}
+	if segments := splitSegments(2, 8); len(segments) != 2 {
+		t.Errorf("expected 2 segments for 2 bytes, got %v", segments)
+	}
+}
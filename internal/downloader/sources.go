@@ -0,0 +1,125 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+)
+
+// Mirrors of the NCBI metadata reports. ENA and DDBJ exchange all SRA
+// records with NCBI as INSDC partners, so their mirrors carry the same
+// dumps under the same names.
+const (
+	ENAMetadataBaseURL  = "https://ftp.ebi.ac.uk/pub/databases/ena/sra/reports/Metadata/"
+	DDBJMetadataBaseURL = "https://ddbj.nig.ac.jp/public/mirror_database/sra/reports/Metadata/"
+)
+
+// MetadataSource describes where an archive publishes its metadata dumps
+// and how they are named.
+type MetadataSource struct {
+	Name           string // ncbi, ena, or ddbj
+	ListingURL     string // directory listing of the dumps
+	FileURL        string // URL template of a dump; {name} is its file name
+	DailyPattern   string // file name pattern of daily updates; group 1 is YYYYMMDD
+	MonthlyPattern string // file name pattern of full datasets; group 1 is YYYYMMDD
+}
+
+// MetadataSources lists the built-in sources by name.
+var MetadataSources = map[string]MetadataSource{
+	"ncbi": newMetadataSource("ncbi", NCBIMetadataBaseURL),
+	"ena":  newMetadataSource("ena", ENAMetadataBaseURL),
+	"ddbj": newMetadataSource("ddbj", DDBJMetadataBaseURL),
+}
+
+func newMetadataSource(name, baseURL string) MetadataSource {
+	return MetadataSource{
+		Name:           name,
+		ListingURL:     baseURL,
+		FileURL:        baseURL + "{name}",
+		DailyPattern:   DailyFilePattern,
+		MonthlyPattern: MonthlyFilePattern,
+	}
+}
+
+// MetadataSourceNames returns the names of the built-in sources, sorted.
+func MetadataSourceNames() []string {
+	names := make([]string, 0, len(MetadataSources))
+	for name := range MetadataSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MetadataSourceFromConfig returns the named source with the overrides of
+// the mirrors section of the configuration applied.
+func MetadataSourceFromConfig(name string, mirrors map[string]config.MirrorConfig) (MetadataSource, error) {
+	src, ok := MetadataSources[name]
+	if !ok {
+		return MetadataSource{}, fmt.Errorf("unknown metadata source %q (must be one of %s)",
+			name, strings.Join(MetadataSourceNames(), ", "))
+	}
+
+	mc := mirrors[name]
+	if mc.ListingURL != "" {
+		src.ListingURL = mc.ListingURL
+		if mc.FileURL == "" {
+			src.FileURL = strings.TrimSuffix(mc.ListingURL, "/") + "/{name}"
+		}
+	}
+	if mc.FileURL != "" {
+		src.FileURL = mc.FileURL
+	}
+	if mc.DailyPattern != "" {
+		src.DailyPattern = mc.DailyPattern
+	}
+	if mc.MonthlyPattern != "" {
+		src.MonthlyPattern = mc.MonthlyPattern
+	}
+
+	if err := src.Validate(); err != nil {
+		return MetadataSource{}, err
+	}
+	return src, nil
+}
+
+// Validate checks that the source's URL template names the file and that
+// its file name patterns compile and capture a date.
+func (s MetadataSource) Validate() error {
+	if !strings.Contains(s.FileURL, "{name}") {
+		return fmt.Errorf("file_url of metadata source %s must contain {name}", s.Name)
+	}
+	for _, pattern := range []string{s.DailyPattern, s.MonthlyPattern} {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid file pattern of metadata source %s: %w", s.Name, err)
+		}
+		if re.NumSubexp() < 1 {
+			return fmt.Errorf("file pattern %q of metadata source %s must capture the date", pattern, s.Name)
+		}
+	}
+	return nil
+}
+
+// URL returns the URL of the named dump.
+func (s MetadataSource) URL(name string) string {
+	return strings.ReplaceAll(s.FileURL, "{name}", name)
+}
+
+// NewMetadataManagerForSource creates a metadata manager for the dumps of
+// a source.
+func NewMetadataManagerForSource(src MetadataSource) *MetadataManager {
+	return &MetadataManager{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		source:  src,
+		daily:   regexp.MustCompile(src.DailyPattern),
+		monthly: regexp.MustCompile(src.MonthlyPattern),
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	srerrors "github.com/nishad/srake/internal/errors"
 )
 
 // DownloadSource represents the source for downloading files
@@ -43,7 +45,8 @@ type Config struct {
 	Threads       int
 	ParallelJobs  int
 	UseAspera     bool
-	RetryAttempts int
+	RetryAttempts int               // Retries after a network failure
+	RetryPolicies srerrors.Policies // Retries for other kinds of failure (srerrors.DefaultPolicies when nil)
 	Validate      bool
 	DryRun        bool
 	Verbose       bool
@@ -127,13 +130,19 @@ func (d *SRADownloader) Download(ctx context.Context, accession string) (*Downlo
 		}
 	}
 
-	// Download based on method
-	var downloadErr error
-	if d.config.UseAspera && d.canUseAspera() {
-		downloadErr = d.downloadWithAspera(ctx, url, outputPath)
-	} else {
-		downloadErr = d.downloadWithHTTP(ctx, url, outputPath)
-	}
+	// Download based on method, retrying according to the kind of failure
+	useAspera := d.config.UseAspera && d.canUseAspera()
+	downloadErr := srerrors.Retry(ctx, d.retryPolicies(), func() error {
+		if useAspera {
+			return d.downloadWithAspera(ctx, url, outputPath)
+		}
+		return d.downloadWithHTTP(ctx, url, outputPath)
+	}, func(err error, kind srerrors.Kind, attempt int, policy srerrors.Policy, wait time.Duration) {
+		if d.config.Verbose {
+			fmt.Printf("Download of %s failed (%s error: %v); attempt %d/%d in %v\n",
+				accession, kind, err, attempt, policy.MaxAttempts, wait)
+		}
+	})
 
 	if downloadErr != nil {
 		return nil, downloadErr
@@ -284,6 +293,24 @@ func (d *SRADownloader) detectBestSource(accession string) DownloadSource {
 	return SourceFTP
 }
 
+// retryPolicies returns the configured retry policies, with the number of
+// network attempts taken from RetryAttempts
+func (d *SRADownloader) retryPolicies() srerrors.Policies {
+	policies := srerrors.Policies{}
+	defaults := d.config.RetryPolicies
+	if defaults == nil {
+		defaults = srerrors.DefaultPolicies()
+	}
+	for kind, policy := range defaults {
+		policies[kind] = policy
+	}
+
+	network := policies.For(srerrors.KindNetwork)
+	network.MaxAttempts = d.config.RetryAttempts + 1
+	policies[srerrors.KindNetwork] = network
+	return policies
+}
+
 // downloadWithHTTP downloads a file using HTTP/HTTPS
 func (d *SRADownloader) downloadWithHTTP(ctx context.Context, url, outputPath string) error {
 	// Create temporary file
@@ -309,7 +336,7 @@ func (d *SRADownloader) downloadWithHTTP(ctx context.Context, url, outputPath st
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return &srerrors.StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 
 	// Copy with progress
@@ -449,3 +476,10 @@ func ParseFileType(s string) SRAFileType {
 		return SRAFileTypeSRA
 	}
 }
+
+// URL returns the download URL for an accession from the configured source
+// and file type, without contacting the source.
+func (d *SRADownloader) URL(accession string) (string, error) {
+	url, _, err := d.getDownloadURL(accession)
+	return url, err
+}
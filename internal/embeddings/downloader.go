@@ -1,8 +1,6 @@
 package embeddings
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -43,7 +41,7 @@ func NewDownloader(manager *Manager, progress chan<- DownloadProgress) *Download
 func (d *Downloader) DownloadModel(modelID string, variantName string) error {
 	config, err := GetModelConfig(modelID)
 	if err != nil {
-		return fmt.Errorf("model %s not found in registry", modelID)
+		return err
 	}
 
 	// Get the specific variant to download
@@ -106,6 +104,11 @@ func (d *Downloader) DownloadModel(modelID string, variantName string) error {
 		return fmt.Errorf("failed to set active variant: %w", err)
 	}
 
+	// Record the dimension and checksums of what was downloaded
+	if _, err := d.manager.RecordModelFiles(modelID); err != nil {
+		return fmt.Errorf("failed to record model files: %w", err)
+	}
+
 	return nil
 }
 
@@ -133,7 +136,11 @@ func (d *Downloader) DownloadVariant(modelID string, variantName string) error {
 	}
 
 	// Refresh model info
-	return d.manager.RefreshModels()
+	if err := d.manager.RefreshModels(); err != nil {
+		return err
+	}
+	_, err = d.manager.RecordModelFiles(modelID)
+	return err
 }
 
 // downloadFile downloads a file without progress tracking (for small files)
@@ -292,18 +299,10 @@ func VerifyFile(filePath string, expectedSHA256 string) error {
 		return nil // No hash to verify
 	}
 
-	file, err := os.Open(filePath)
+	actualHash, err := FileSHA256(filePath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		return err
-	}
-
-	actualHash := hex.EncodeToString(hasher.Sum(nil))
 	if actualHash != expectedSHA256 {
 		return fmt.Errorf("hash mismatch: expected %s, got %s", expectedSHA256, actualHash)
 	}
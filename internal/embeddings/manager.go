@@ -22,6 +22,13 @@ type ModelInfo struct {
 	Config        map[string]interface{} `json:"config"`         // Model configuration from config.json
 	InstalledAt   time.Time              `json:"installed_at"`
 	LastUsed      time.Time              `json:"last_used"`
+
+	// Dims is the embedding dimension, the hidden size of config.json
+	Dims int `json:"dims,omitempty"`
+
+	// Checksums are the SHA-256 of the ONNX and tokenizer files recorded
+	// when they were downloaded, by path relative to the model directory
+	Checksums map[string]string `json:"checksums,omitempty"`
 }
 
 // VariantInfo describes a specific model variant
@@ -9,7 +9,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	"github.com/sugarme/tokenizer"
@@ -24,30 +23,32 @@ var embeddedTokenizer []byte
 
 // ONNXEmbedder generates embeddings using ONNX Runtime
 type ONNXEmbedder struct {
-	session   *ort.DynamicAdvancedSession
+	sessions  chan *ort.DynamicAdvancedSession // Pool of sessions not running a batch
+	options   ONNXOptions
 	tokenizer *tokenizer.Tokenizer
 	modelPath string
 	enabled   bool
 }
 
-// NewONNXEmbedder creates a new ONNX embedder
+// NewONNXEmbedder creates a new ONNX embedder with the default options
 func NewONNXEmbedder(modelPath string, cacheDir string) (*ONNXEmbedder, error) {
+	return NewONNXEmbedderWithOptions(modelPath, cacheDir, DefaultONNXOptions())
+}
+
+// NewONNXEmbedderWithOptions creates a new ONNX embedder running its model
+// on a pool of opts.Sessions sessions of the configured execution provider
+func NewONNXEmbedderWithOptions(modelPath string, cacheDir string, opts ONNXOptions) (*ONNXEmbedder, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
 	embedder := &ONNXEmbedder{
 		modelPath: modelPath,
+		options:   opts,
 	}
 
-	// Initialize ONNX Runtime
-	// Set the library path for macOS
-	if runtime.GOOS == "darwin" {
-		libraryPath := "/opt/homebrew/lib/libonnxruntime.dylib"
-		if _, err := os.Stat(libraryPath); err != nil {
-			// Try alternate path for Intel Macs
-			libraryPath = "/usr/local/lib/libonnxruntime.dylib"
-		}
-		ort.SetSharedLibraryPath(libraryPath)
-	}
-	if err := ort.InitializeEnvironment(); err != nil {
-		return nil, fmt.Errorf("failed to initialize ONNX Runtime: %w", err)
+	if err := initONNXRuntime(); err != nil {
+		return nil, err
 	}
 
 	// Get model variant from environment
@@ -66,13 +67,11 @@ func NewONNXEmbedder(modelPath string, cacheDir string) (*ONNXEmbedder, error) {
 	}
 
 	// Load the model
-	inputs := []string{"input_ids", "attention_mask", "token_type_ids"}
-	outputs := []string{"last_hidden_state"}
-	session, err := ort.NewDynamicAdvancedSession(localModelPath, inputs, outputs, nil)
+	sessions, err := newSessions(localModelPath, "last_hidden_state", opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create ONNX session: %w", err)
+		return nil, err
 	}
-	embedder.session = session
+	embedder.sessions = sessions
 
 	// Load tokenizer - try embedded first, then file
 	var tokenizer *tokenizer.Tokenizer
@@ -327,99 +326,34 @@ func (e *ONNXEmbedder) Embed(text string) ([]float32, error) {
 		return nil, fmt.Errorf("embedder is not enabled")
 	}
 
-	// Tokenize the text using sugarme tokenizer
-	// The tokenizer automatically adds special tokens ([CLS] and [SEP] for BERT)
-	encoding, err := e.tokenizer.EncodeSingle(text)
+	// The tokenizer adds the special tokens ([CLS] and [SEP] for BERT)
+	tokens, err := e.tokenize(text)
 	if err != nil {
-		return nil, fmt.Errorf("failed to encode text: %w", err)
-	}
-
-	// Get token IDs and attention mask
-	tokenIDs := encoding.Ids
-	attentionMask := encoding.AttentionMask
-
-	// Convert to int64 for ONNX
-	inputIDs := make([]int64, len(tokenIDs))
-	maskIDs := make([]int64, len(attentionMask))
-	typeIDs := make([]int64, len(tokenIDs)) // All zeros for single sequence
-	for i := range tokenIDs {
-		inputIDs[i] = int64(tokenIDs[i])
-		maskIDs[i] = int64(attentionMask[i])
-		typeIDs[i] = 0 // Single sequence, so all zeros
-	}
-
-	// Create tensors
-	inputShape := ort.NewShape(1, int64(len(tokenIDs)))
-	inputIDsTensor, err := ort.NewTensor[int64](inputShape, inputIDs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create input tensor: %w", err)
-	}
-	defer inputIDsTensor.Destroy()
-
-	maskTensor, err := ort.NewTensor[int64](inputShape, maskIDs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create mask tensor: %w", err)
-	}
-	defer maskTensor.Destroy()
-
-	typeIDsTensor, err := ort.NewTensor[int64](inputShape, typeIDs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create type IDs tensor: %w", err)
+		return nil, err
 	}
-	defer typeIDsTensor.Destroy()
-
-	// Prepare outputs (will be allocated by Run)
-	outputs := []ort.Value{nil} // Model has 1 output
-
-	// Run inference with all 3 inputs
-	err = e.session.Run(
-		[]ort.Value{inputIDsTensor, maskTensor, typeIDsTensor},
-		outputs,
-	)
+	results, err := e.runBatch([][]int64{tokens})
 	if err != nil {
-		return nil, fmt.Errorf("failed to run inference: %w", err)
-	}
-	defer outputs[0].Destroy()
-
-	// Get output tensor
-	outputTensor, ok := outputs[0].(*ort.Tensor[float32])
-	if !ok {
-		return nil, fmt.Errorf("unexpected output type")
-	}
-
-	// Extract embeddings (mean pooling)
-	embeddings := outputTensor.GetData()
-
-	// For BERT models, we typically use the [CLS] token representation
-	// which is the first token's embedding
-	// The output shape is [batch_size, sequence_length, hidden_size]
-	// We want the [CLS] token (index 0) from the sequence
-
-	seqLen := len(tokenIDs)
-	embDim := len(embeddings) / seqLen
-
-	// Extract [CLS] token embedding (first token)
-	result := make([]float32, embDim)
-	for i := 0; i < embDim; i++ {
-		result[i] = embeddings[i]
+		return nil, err
 	}
-
-	return result, nil
+	return results[0], nil
 }
 
-// EmbedBatch generates embeddings for multiple texts
+// EmbedBatch generates embeddings for multiple texts, batched by token
+// count and run concurrently on the session pool
 func (e *ONNXEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
-	results := make([][]float32, len(texts))
+	if !e.enabled {
+		return nil, fmt.Errorf("embedder is not enabled")
+	}
 
+	tokens := make([][]int64, len(texts))
 	for i, text := range texts {
-		embedding, err := e.Embed(text)
+		ids, err := e.tokenize(text)
 		if err != nil {
 			return nil, fmt.Errorf("failed to embed text %d: %w", i, err)
 		}
-		results[i] = embedding
+		tokens[i] = ids
 	}
-
-	return results, nil
+	return e.embedTokens(tokens)
 }
 
 // IsEnabled returns whether the embedder is enabled
@@ -429,8 +363,8 @@ func (e *ONNXEmbedder) IsEnabled() bool {
 
 // Close cleans up resources
 func (e *ONNXEmbedder) Close() error {
-	if e.session != nil {
-		e.session.Destroy()
+	if e.sessions != nil {
+		closeSessions(e.sessions)
 	}
 	// Tokenizer doesn't need explicit cleanup with sugarme
 	return nil
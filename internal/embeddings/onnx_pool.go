@@ -0,0 +1,366 @@
+package embeddings
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nishad/srake/internal/config"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// Execution providers an ONNX session can run on
+const (
+	ProviderCPU    = "cpu"
+	ProviderCUDA   = "cuda"
+	ProviderCoreML = "coreml"
+)
+
+// ProviderEnv names the environment variable selecting the execution
+// provider when none is configured
+const ProviderEnv = "SRAKE_ONNX_PROVIDER"
+
+// ONNXOptions control how an ONNXEmbedder runs its model
+type ONNXOptions struct {
+	Provider       string // cpu, cuda or coreml
+	Sessions       int    // Sessions running batches concurrently; 0 picks from the CPUs
+	NumThreads     int    // Intra-op threads per session
+	MaxBatchTokens int    // Padded tokens per inference batch
+	MaxLength      int    // Tokens a text is truncated to
+}
+
+// DefaultONNXOptions returns the options of an embedder that is not
+// configured, with the provider of SRAKE_ONNX_PROVIDER
+func DefaultONNXOptions() ONNXOptions {
+	return ONNXOptions{
+		Provider:       os.Getenv(ProviderEnv),
+		NumThreads:     4,
+		MaxBatchTokens: 8192,
+		MaxLength:      512,
+	}
+}
+
+// ONNXOptionsFromConfig returns the options of the embedding settings
+func ONNXOptionsFromConfig(cfg config.EmbeddingConfig) ONNXOptions {
+	opts := DefaultONNXOptions()
+	if cfg.ExecutionProvider != "" {
+		opts.Provider = cfg.ExecutionProvider
+	}
+	opts.Sessions = cfg.Sessions
+	if cfg.NumThreads > 0 {
+		opts.NumThreads = cfg.NumThreads
+	}
+	if cfg.MaxBatchTokens > 0 {
+		opts.MaxBatchTokens = cfg.MaxBatchTokens
+	}
+	if cfg.MaxTextLength > 0 {
+		opts.MaxLength = cfg.MaxTextLength
+	}
+	return opts
+}
+
+// normalize fills in defaults and validates the provider
+func (o ONNXOptions) normalize() (ONNXOptions, error) {
+	o.Provider = strings.ToLower(strings.TrimSpace(o.Provider))
+	switch o.Provider {
+	case "":
+		o.Provider = ProviderCPU
+	case ProviderCPU, ProviderCUDA, ProviderCoreML:
+	default:
+		return o, fmt.Errorf("unknown ONNX execution provider: %s (must be cpu, cuda or coreml)", o.Provider)
+	}
+	if o.NumThreads <= 0 {
+		o.NumThreads = 4
+	}
+	if o.Sessions <= 0 {
+		// A GPU runs one batch at a time best; on CPUs, sessions share
+		// the cores between them
+		o.Sessions = 1
+		if o.Provider == ProviderCPU {
+			o.Sessions = max(1, runtime.NumCPU()/o.NumThreads)
+		}
+	}
+	if o.MaxLength <= 0 {
+		o.MaxLength = 512
+	}
+	if o.MaxBatchTokens < o.MaxLength {
+		o.MaxBatchTokens = o.MaxLength
+	}
+	return o, nil
+}
+
+// newSessionOptions returns the session options of opts, with its
+// execution provider appended
+func newSessionOptions(opts ONNXOptions) (*ort.SessionOptions, error) {
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session options: %w", err)
+	}
+	if err := options.SetIntraOpNumThreads(opts.NumThreads); err != nil {
+		options.Destroy()
+		return nil, fmt.Errorf("failed to set session threads: %w", err)
+	}
+
+	switch opts.Provider {
+	case ProviderCUDA:
+		cuda, err := ort.NewCUDAProviderOptions()
+		if err != nil {
+			options.Destroy()
+			return nil, fmt.Errorf("failed to create CUDA provider options: %w", err)
+		}
+		defer cuda.Destroy()
+		if err := options.AppendExecutionProviderCUDA(cuda); err != nil {
+			options.Destroy()
+			return nil, fmt.Errorf("failed to enable the CUDA execution provider: %w", err)
+		}
+	case ProviderCoreML:
+		if err := options.AppendExecutionProviderCoreML(0); err != nil {
+			options.Destroy()
+			return nil, fmt.Errorf("failed to enable the CoreML execution provider: %w", err)
+		}
+	}
+	return options, nil
+}
+
+// initONNXRuntime initializes ONNX Runtime, finding the Homebrew library
+// on macOS
+func initONNXRuntime() error {
+	if ort.IsInitialized() {
+		return nil
+	}
+	if runtime.GOOS == "darwin" {
+		libraryPath := "/opt/homebrew/lib/libonnxruntime.dylib"
+		if _, err := os.Stat(libraryPath); err != nil {
+			// Try alternate path for Intel Macs
+			libraryPath = "/usr/local/lib/libonnxruntime.dylib"
+		}
+		ort.SetSharedLibraryPath(libraryPath)
+	}
+	if err := ort.InitializeEnvironment(); err != nil {
+		return fmt.Errorf("failed to initialize ONNX Runtime: %w", err)
+	}
+	return nil
+}
+
+// newSessions creates the pool of sessions of the BERT model at path,
+// which reads token IDs, masks and types and writes the named output
+func newSessions(path, output string, opts ONNXOptions) (chan *ort.DynamicAdvancedSession, error) {
+	options, err := newSessionOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer options.Destroy()
+
+	inputs := []string{"input_ids", "attention_mask", "token_type_ids"}
+	outputs := []string{output}
+	sessions := make(chan *ort.DynamicAdvancedSession, opts.Sessions)
+	for i := 0; i < opts.Sessions; i++ {
+		session, err := ort.NewDynamicAdvancedSession(path, inputs, outputs, options)
+		if err != nil {
+			closeSessions(sessions)
+			return nil, fmt.Errorf("failed to create ONNX session: %w", err)
+		}
+		sessions <- session
+	}
+	return sessions, nil
+}
+
+// closeSessions destroys the sessions of a pool that are not in use
+func closeSessions(sessions chan *ort.DynamicAdvancedSession) {
+	for {
+		select {
+		case session := <-sessions:
+			session.Destroy()
+		default:
+			return
+		}
+	}
+}
+
+// planBatches groups sequences of the given lengths into batches of at most
+// maxTokens padded tokens, returning the indexes of each batch. Sequences
+// are grouped by length, so that little of a batch is padding.
+func planBatches(lengths []int, maxTokens int) [][]int {
+	order := make([]int, len(lengths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return lengths[order[a]] < lengths[order[b]] })
+
+	var batches [][]int
+	var batch []int
+	for _, i := range order {
+		// Lengths ascend, so this sequence sets the padded length
+		if len(batch) > 0 && (len(batch)+1)*lengths[i] > maxTokens {
+			batches = append(batches, batch)
+			batch = nil
+		}
+		batch = append(batch, i)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// tokenize encodes text as token IDs truncated to maxLength, keeping the
+// final [SEP] token
+func (e *ONNXEmbedder) tokenize(text string) ([]int64, error) {
+	encoding, err := e.tokenizer.EncodeSingle(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode text: %w", err)
+	}
+	ids := encoding.Ids
+	if n := e.options.MaxLength; len(ids) > n {
+		ids = append(ids[:n-1:n-1], ids[len(ids)-1])
+	}
+	tokens := make([]int64, len(ids))
+	for i, id := range ids {
+		tokens[i] = int64(id)
+	}
+	return tokens, nil
+}
+
+// runBatch embeds a batch of token sequences on one session of the pool,
+// padding them to the longest, and returns the [CLS] embedding of each
+func (e *ONNXEmbedder) runBatch(batch [][]int64) ([][]float32, error) {
+	data, seqLen, err := runPadded(e.sessions, batch, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The output is [batch, sequence, hidden]; BERT models use the
+	// [CLS] token, the first of each sequence
+	embDim := len(data) / (len(batch) * seqLen)
+	results := make([][]float32, len(batch))
+	for i := range batch {
+		offset := i * seqLen * embDim
+		results[i] = append([]float32(nil), data[offset:offset+embDim]...)
+	}
+	return results, nil
+}
+
+// runPadded runs a batch of token sequences, and their token types when
+// types is not nil, on one session of the pool, padding them to the
+// longest. It returns a copy of the output and the padded length.
+func runPadded(sessions chan *ort.DynamicAdvancedSession, batch, types [][]int64) ([]float32, int, error) {
+	seqLen := 0
+	for _, ids := range batch {
+		seqLen = max(seqLen, len(ids))
+	}
+
+	inputIDs := make([]int64, len(batch)*seqLen)
+	maskIDs := make([]int64, len(batch)*seqLen)
+	typeIDs := make([]int64, len(batch)*seqLen) // All zeros for single sequences
+	for i, ids := range batch {
+		copy(inputIDs[i*seqLen:], ids) // Padded with the [PAD] ID 0
+		for j := range ids {
+			maskIDs[i*seqLen+j] = 1
+		}
+		if types != nil {
+			copy(typeIDs[i*seqLen:], types[i])
+		}
+	}
+
+	shape := ort.NewShape(int64(len(batch)), int64(seqLen))
+	inputIDsTensor, err := ort.NewTensor(shape, inputIDs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create input tensor: %w", err)
+	}
+	defer inputIDsTensor.Destroy()
+	maskTensor, err := ort.NewTensor(shape, maskIDs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create mask tensor: %w", err)
+	}
+	defer maskTensor.Destroy()
+	typeIDsTensor, err := ort.NewTensor(shape, typeIDs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create type IDs tensor: %w", err)
+	}
+	defer typeIDsTensor.Destroy()
+
+	session := <-sessions
+	outputs := []ort.Value{nil} // Allocated by Run
+	err = session.Run([]ort.Value{inputIDsTensor, maskTensor, typeIDsTensor}, outputs)
+	sessions <- session
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to run inference: %w", err)
+	}
+	defer outputs[0].Destroy()
+
+	outputTensor, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected output type")
+	}
+	return append([]float32(nil), outputTensor.GetData()...), seqLen, nil
+}
+
+// embedTokens embeds token sequences in batches planned by token count,
+// run concurrently on the sessions of the pool
+func (e *ONNXEmbedder) embedTokens(tokens [][]int64) ([][]float32, error) {
+	lengths := make([]int, len(tokens))
+	for i, ids := range tokens {
+		lengths[i] = len(ids)
+	}
+	batches := planBatches(lengths, e.options.MaxBatchTokens)
+
+	results := make([][]float32, len(tokens))
+	err := runBatches(batches, e.options.Sessions, func(indexes []int) error {
+		batch := make([][]int64, len(indexes))
+		for i, index := range indexes {
+			batch[i] = tokens[index]
+		}
+		vectors, err := e.runBatch(batch)
+		if err != nil {
+			return err
+		}
+		for i, index := range indexes {
+			results[index] = vectors[i]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// runBatches runs batches on up to workers goroutines, stopping at the
+// first error
+func runBatches(batches [][]int, workers int, run func(indexes []int) error) error {
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	failed := make(chan struct{})
+
+	for w := 0; w < min(workers, len(batches)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for indexes := range work {
+				if err := run(indexes); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, indexes := range batches {
+		select {
+		case work <- indexes:
+		case <-failed:
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,188 @@
+package embeddings
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/sugarme/tokenizer"
+	"github.com/sugarme/tokenizer/pretrained"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// DefaultRerankModel is the cross-encoder reranking search results when
+// none is configured, a MiniLM trained on MS MARCO passage ranking
+const DefaultRerankModel = "cross-encoder/ms-marco-MiniLM-L-6-v2"
+
+// maxQueryTokens is how many tokens of a query a cross-encoder reads,
+// leaving the rest of its input to the document
+const maxQueryTokens = 64
+
+// ONNXReranker scores how relevant documents are to a query with an ONNX
+// cross-encoder, which reads the query and each document together. It is
+// slower than comparing embeddings but more accurate, so it reorders the
+// top results of a search.
+type ONNXReranker struct {
+	sessions  chan *ort.DynamicAdvancedSession
+	options   ONNXOptions
+	tokenizer *tokenizer.Tokenizer
+	cls, sep  int64
+	modelID   string
+}
+
+// NewONNXReranker loads a cross-encoder installed with 'srake models pull',
+// running its active variant on a pool of sessions
+func NewONNXReranker(modelID, modelsDir string, opts ONNXOptions) (*ONNXReranker, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+	manager, err := NewManager(modelsDir)
+	if err != nil {
+		return nil, err
+	}
+	model, err := manager.GetModel(modelID)
+	if err != nil {
+		return nil, fmt.Errorf("reranking model %s is not installed; install it with 'srake models pull %s'", modelID, modelID)
+	}
+	modelPath, err := manager.GetActiveVariantPath(modelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reranking model %s: %w", modelID, err)
+	}
+
+	tk, err := pretrained.FromFile(filepath.Join(model.Path, "tokenizer.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer of %s: %w", modelID, err)
+	}
+	cls, okCLS := tk.TokenToId("[CLS]")
+	sep, okSEP := tk.TokenToId("[SEP]")
+	if !okCLS || !okSEP {
+		return nil, fmt.Errorf("%s is not a BERT cross-encoder: its tokenizer has no [CLS] and [SEP] tokens", modelID)
+	}
+
+	if err := initONNXRuntime(); err != nil {
+		return nil, err
+	}
+	sessions, err := newSessions(modelPath, "logits", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ONNXReranker{
+		sessions:  sessions,
+		options:   opts,
+		tokenizer: tk,
+		cls:       int64(cls),
+		sep:       int64(sep),
+		modelID:   modelID,
+	}, nil
+}
+
+// Model returns the ID of the reranker's model
+func (r *ONNXReranker) Model() string {
+	return r.modelID
+}
+
+// IsEnabled reports whether the reranker has a model loaded
+func (r *ONNXReranker) IsEnabled() bool {
+	return r != nil && r.sessions != nil
+}
+
+// Score returns the relevance of each document to the query, as the
+// cross-encoder's logit: higher is more relevant
+func (r *ONNXReranker) Score(query string, docs []string) ([]float32, error) {
+	if !r.IsEnabled() {
+		return nil, fmt.Errorf("reranker is not enabled")
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	queryIDs, err := r.encode(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(queryIDs) > maxQueryTokens {
+		queryIDs = queryIDs[:maxQueryTokens]
+	}
+
+	pairs := make([][]int64, len(docs))
+	types := make([][]int64, len(docs))
+	lengths := make([]int, len(docs))
+	for i, doc := range docs {
+		docIDs, err := r.encode(doc)
+		if err != nil {
+			return nil, err
+		}
+		pairs[i], types[i] = pairTokens(r.cls, r.sep, queryIDs, docIDs, r.options.MaxLength)
+		lengths[i] = len(pairs[i])
+	}
+
+	scores := make([]float32, len(docs))
+	err = runBatches(planBatches(lengths, r.options.MaxBatchTokens), r.options.Sessions, func(indexes []int) error {
+		batch := make([][]int64, len(indexes))
+		batchTypes := make([][]int64, len(indexes))
+		for i, index := range indexes {
+			batch[i] = pairs[index]
+			batchTypes[i] = types[index]
+		}
+		logits, _, err := runPadded(r.sessions, batch, batchTypes)
+		if err != nil {
+			return err
+		}
+		// The output is [batch, labels]; with two labels, the second is
+		// the relevant class
+		labels := len(logits) / len(indexes)
+		for i, index := range indexes {
+			scores[index] = logits[i*labels+labels-1]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+// encode returns the token IDs of text without special tokens
+func (r *ONNXReranker) encode(text string) ([]int64, error) {
+	encoding, err := r.tokenizer.EncodeSingle(text, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode text: %w", err)
+	}
+	ids := make([]int64, len(encoding.Ids))
+	for i, id := range encoding.Ids {
+		ids[i] = int64(id)
+	}
+	return ids, nil
+}
+
+// pairTokens joins a query and document as a cross-encoder reads them,
+// [CLS] query [SEP] document [SEP], with the document truncated to fit
+// maxLength tokens. It returns the token IDs and their types: 0 for the
+// query and 1 for the document.
+func pairTokens(cls, sep int64, query, doc []int64, maxLength int) ([]int64, []int64) {
+	if room := maxLength - len(query) - 3; len(doc) > room {
+		doc = doc[:max(room, 0)]
+	}
+	ids := make([]int64, 0, len(query)+len(doc)+3)
+	ids = append(ids, cls)
+	ids = append(ids, query...)
+	ids = append(ids, sep)
+	ids = append(ids, doc...)
+	ids = append(ids, sep)
+
+	types := make([]int64, len(ids))
+	for i := len(query) + 2; i < len(ids); i++ {
+		types[i] = 1
+	}
+	return ids, types
+}
+
+// Close releases the reranker's sessions
+func (r *ONNXReranker) Close() error {
+	if r.sessions != nil {
+		closeSessions(r.sessions)
+		r.sessions = nil
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package embeddings
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/nishad/srake/internal/config"
 )
@@ -10,6 +11,7 @@ import (
 type SearchEmbedder struct {
 	onnx    *ONNXEmbedder
 	enabled bool
+	pending atomic.Int64 // Embed and EmbedBatch calls waiting or running
 }
 
 // NewSearchEmbedder creates an embedder for search integration
@@ -18,9 +20,10 @@ func NewSearchEmbedder(cfg *config.Config) (*SearchEmbedder, error) {
 		return &SearchEmbedder{enabled: false}, nil
 	}
 
-	onnx, err := NewONNXEmbedder(
+	onnx, err := NewONNXEmbedderWithOptions(
 		cfg.Embeddings.DefaultModel,
 		cfg.Embeddings.ModelsDirectory,
+		ONNXOptionsFromConfig(cfg.Embeddings),
 	)
 	if err != nil {
 		// Log warning but don't fail completely
@@ -45,6 +48,8 @@ func (s *SearchEmbedder) Embed(text string) ([]float32, error) {
 	if !s.enabled || s.onnx == nil {
 		return nil, fmt.Errorf("embedder is not enabled")
 	}
+	s.pending.Add(1)
+	defer s.pending.Add(-1)
 	return s.onnx.Embed(text)
 }
 
@@ -53,9 +58,17 @@ func (s *SearchEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
 	if !s.enabled || s.onnx == nil {
 		return nil, fmt.Errorf("embedder is not enabled")
 	}
+	s.pending.Add(1)
+	defer s.pending.Add(-1)
 	return s.onnx.EmbedBatch(texts)
 }
 
+// Pending returns the number of embedding calls waiting for the model or
+// running on it
+func (s *SearchEmbedder) Pending() int64 {
+	return s.pending.Load()
+}
+
 // IsEnabled returns whether the embedder is enabled
 func (s *SearchEmbedder) IsEnabled() bool {
 	return s.enabled
@@ -1,6 +1,9 @@
 package embeddings
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 const (
 	MB = 1024 * 1024
@@ -117,15 +120,64 @@ type ModelConfig struct {
 	ConfigFiles    []string       `json:"config_files"`    // Required config files
 }
 
-// GetModelConfig returns the configuration for a specific model
+// GetModelConfig returns the configuration for a specific model: its
+// registry entry, or for another HuggingFace repository named org/name,
+// the layout of ONNX exports such as Xenova's
 func GetModelConfig(modelID string) (*ModelConfig, error) {
 	config, exists := ModelRegistry[modelID]
 	if !exists {
+		if hub := HubModelConfig(modelID); hub != nil {
+			return hub, nil
+		}
 		return nil, fmt.Errorf("model %s not found in registry", modelID)
 	}
 	return &config, nil
 }
 
+// HubModelConfig returns the configuration of a HuggingFace repository not
+// in the registry, assuming ONNX exports under onnx/ and a BERT tokenizer,
+// or nil when repo is not of the form org/name. Its hidden size is read
+// from config.json once downloaded.
+func HubModelConfig(repo string) *ModelConfig {
+	org, name, ok := strings.Cut(repo, "/")
+	if !ok || org == "" || name == "" || strings.Contains(name, "/") || strings.Contains(repo, "..") {
+		return nil
+	}
+	baseURL := "https://huggingface.co/" + repo + "/resolve/main"
+	variant := func(name, filename, description string) ModelVariant {
+		return ModelVariant{
+			Name:        name,
+			Filename:    "onnx/" + filename,
+			URL:         baseURL + "/onnx/" + filename,
+			Default:     name == "quantized",
+			Description: description,
+		}
+	}
+	return &ModelConfig{
+		ID:           repo,
+		Organization: org,
+		Name:         name,
+		Description:  "HuggingFace repository " + repo,
+		ModelType:    "bert",
+		MaxLength:    512,
+		BaseURL:      baseURL,
+		Variants: []ModelVariant{
+			variant("quantized", "model_quantized.onnx", "Quantized model (INT8)"),
+			variant("fp16", "model_fp16.onnx", "Half precision (FP16)"),
+			variant("full", "model.onnx", "Full precision (FP32)"),
+		},
+		TokenizerFiles: []string{
+			"tokenizer.json",
+			"tokenizer_config.json",
+			"special_tokens_map.json",
+			"vocab.txt",
+		},
+		ConfigFiles: []string{
+			"config.json",
+		},
+	}
+}
+
 // GetDefaultVariant returns the default variant for a model
 func GetDefaultVariant(modelID string) (*ModelVariant, error) {
 	config, err := GetModelConfig(modelID)
@@ -0,0 +1,172 @@
+package embeddings
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Results of checking a model file against the checksum recorded for it
+const (
+	FileOK         = "ok"
+	FileModified   = "modified"
+	FileMissing    = "missing"
+	FileUnrecorded = "unrecorded" // No checksum recorded, e.g. copied in by hand
+)
+
+// tokenizerFiles are the files besides ONNX models whose checksums are
+// recorded for a model
+var tokenizerFiles = map[string]bool{
+	"tokenizer.json":          true,
+	"tokenizer_config.json":   true,
+	"special_tokens_map.json": true,
+	"vocab.txt":               true,
+}
+
+// FileCheck is the result of checking one file of a model
+type FileCheck struct {
+	File     string `json:"file"` // Relative to the model directory
+	Status   string `json:"status"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// FileSHA256 returns the hex SHA-256 of a file
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// modelFiles returns the ONNX and tokenizer files in a model directory,
+// relative to it and sorted
+func modelFiles(modelPath string) []string {
+	var files []string
+	filepath.Walk(modelPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(path, ".onnx") || tokenizerFiles[info.Name()] {
+			if rel, err := filepath.Rel(modelPath, path); err == nil {
+				files = append(files, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// configDims returns the embedding dimension given by a model's config.json,
+// or 0 when it gives none
+func configDims(config map[string]interface{}) int {
+	for _, key := range []string{"hidden_size", "d_model", "dim"} {
+		if v, ok := config[key].(float64); ok && v > 0 {
+			return int(v)
+		}
+	}
+	return 0
+}
+
+// RecordModelFiles rescans the variants of an installed model and records
+// its embedding dimension and the checksums of its ONNX and tokenizer
+// files, as after a download
+func (m *Manager) RecordModelFiles(modelID string) (*ModelInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	model, exists := m.models[modelID]
+	if !exists {
+		return nil, fmt.Errorf("model %s not found", modelID)
+	}
+
+	model.Variants = m.scanVariants(model.Path)
+	if data, err := os.ReadFile(filepath.Join(model.Path, "config.json")); err == nil {
+		var config map[string]interface{}
+		if err := json.Unmarshal(data, &config); err == nil {
+			model.Config = config
+		}
+	}
+	if dims := configDims(model.Config); dims > 0 {
+		model.Dims = dims
+	} else if config, ok := ModelRegistry[modelID]; ok {
+		model.Dims = config.HiddenSize
+	}
+
+	model.Checksums = make(map[string]string)
+	for _, file := range modelFiles(model.Path) {
+		sum, err := FileSHA256(filepath.Join(model.Path, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", file, err)
+		}
+		model.Checksums[file] = sum
+	}
+	if model.InstalledAt.IsZero() {
+		model.InstalledAt = time.Now()
+	}
+	return model, m.saveModelInfo(model)
+}
+
+// VerifyModel checks the ONNX and tokenizer files of an installed model
+// against the checksums recorded when they were downloaded, and against
+// the registry's checksum of a variant when one is published
+func (m *Manager) VerifyModel(modelID string) ([]FileCheck, error) {
+	model, err := m.GetModel(modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A published checksum wins over one recorded from a bad download
+	expected := make(map[string]string)
+	for file, sum := range model.Checksums {
+		expected[file] = sum
+	}
+	if config, ok := ModelRegistry[modelID]; ok {
+		for _, variant := range config.Variants {
+			if variant.SHA256 != "" {
+				expected[variant.Filename] = variant.SHA256
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var checks []FileCheck
+	for _, file := range modelFiles(model.Path) {
+		seen[file] = true
+		check := FileCheck{File: file, Expected: expected[file]}
+		if check.Actual, err = FileSHA256(filepath.Join(model.Path, filepath.FromSlash(file))); err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", file, err)
+		}
+		switch {
+		case check.Expected == "":
+			check.Status = FileUnrecorded
+		case check.Expected == check.Actual:
+			check.Status = FileOK
+		default:
+			check.Status = FileModified
+		}
+		checks = append(checks, check)
+	}
+	for file, sum := range model.Checksums {
+		if !seen[file] {
+			checks = append(checks, FileCheck{File: file, Status: FileMissing, Expected: sum})
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].File < checks[j].File })
+	return checks, nil
+}
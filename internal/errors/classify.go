@@ -0,0 +1,126 @@
+package errors
+
+import (
+	"archive/tar"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/nishad/srake/internal/i18n"
+)
+
+// StatusError reports an HTTP response with an unexpected status code.
+type StatusError struct {
+	Code   int
+	Status string // e.g. "503 Service Unavailable"
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	if e.Status != "" {
+		return "HTTP " + e.Status
+	}
+	return fmt.Sprintf("HTTP %d", e.Code)
+}
+
+// Transient reports whether the status is worth retrying: server errors,
+// rate limiting, and request timeouts.
+func (e *StatusError) Transient() bool {
+	return e.Code >= 500 || e.Code == http.StatusTooManyRequests || e.Code == http.StatusRequestTimeout
+}
+
+// Classify returns the kind of an error. An explicit kind anywhere in the
+// chain wins; otherwise the kind is inferred from well-known error values
+// of the network, compression, XML, and SQLite layers. Cancellation is
+// always KindUnknown so that it is never retried.
+func Classify(err error) Kind {
+	if err == nil || stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return KindUnknown
+	}
+
+	var e *Error
+	for target := err; stderrors.As(target, &e); target = e.Err {
+		if e.Kind != KindUnknown {
+			return e.Kind
+		}
+	}
+
+	var status *StatusError
+	if stderrors.As(err, &status) {
+		if status.Transient() {
+			return KindNetwork
+		}
+		return KindRemote
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	if stderrors.Is(err, syscall.ENOSPC) || strings.Contains(msg, "no space left on device") ||
+		strings.Contains(msg, "database or disk is full") {
+		return KindDiskFull
+	}
+
+	var corrupt flate.CorruptInputError
+	if stderrors.Is(err, gzip.ErrHeader) || stderrors.Is(err, gzip.ErrChecksum) ||
+		stderrors.Is(err, tar.ErrHeader) || stderrors.As(err, &corrupt) {
+		return KindDecompression
+	}
+
+	var syntax *xml.SyntaxError
+	if stderrors.As(err, &syntax) {
+		return KindParse
+	}
+
+	if strings.Contains(msg, "constraint failed") {
+		return KindConstraint
+	}
+
+	var netErr net.Error
+	if stderrors.Is(err, io.ErrUnexpectedEOF) || stderrors.As(err, &netErr) ||
+		stderrors.Is(err, syscall.ECONNRESET) || stderrors.Is(err, syscall.ECONNREFUSED) ||
+		stderrors.Is(err, syscall.EPIPE) {
+		return KindNetwork
+	}
+	for _, s := range []string{"connection reset", "connection refused", "broken pipe", "timeout", "temporary failure"} {
+		if strings.Contains(msg, s) {
+			return KindNetwork
+		}
+	}
+
+	return KindUnknown
+}
+
+// Hint returns advice for a user who hit an error of this kind, in the
+// user's locale, or "" if there is nothing more useful to say than the
+// error itself.
+func (k Kind) Hint() string {
+	switch k {
+	case KindNetwork:
+		return i18n.T("hint.network")
+	case KindRemote:
+		return i18n.T("hint.remote")
+	case KindDecompression:
+		return i18n.T("hint.decompression")
+	case KindParse:
+		return i18n.T("hint.parse")
+	case KindConstraint:
+		return i18n.T("hint.constraint")
+	case KindDiskFull:
+		return i18n.T("hint.disk_full")
+	default:
+		return ""
+	}
+}
+
+// Hint returns advice for a user who hit err, based on its kind.
+func Hint(err error) string {
+	return Classify(err).Hint()
+}
@@ -0,0 +1,65 @@
+package errors
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	var v struct{}
+	decodeErr := xml.NewDecoder(strings.NewReader("<a><b></a>")).Decode(&v)
+
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{"nil", nil, KindUnknown},
+		{"cancelled", fmt.Errorf("fetch: %w", context.Canceled), KindUnknown},
+		{"explicit kind", fmt.Errorf("outer: %w", E(Op("ingest"), KindConstraint, "duplicate")), KindConstraint},
+		{"explicit kind below unknown", Wrap("outer", E(KindParse, "bad")), KindParse},
+		{"503", &StatusError{Code: 503, Status: "503 Service Unavailable"}, KindNetwork},
+		{"429", fmt.Errorf("fetch: %w", &StatusError{Code: 429}), KindNetwork},
+		{"404", &StatusError{Code: 404, Status: "404 Not Found"}, KindRemote},
+		{"disk full", fmt.Errorf("write: %w", syscall.ENOSPC), KindDiskFull},
+		{"sqlite full", fmt.Errorf("database or disk is full"), KindDiskFull},
+		{"gzip header", fmt.Errorf("failed to create gzip reader: %w", gzip.ErrHeader), KindDecompression},
+		{"gzip checksum", gzip.ErrChecksum, KindDecompression},
+		{"flate", flate.CorruptInputError(12), KindDecompression},
+		{"xml", fmt.Errorf("failed to decode study set: %w", decodeErr), KindParse},
+		{"constraint", fmt.Errorf("UNIQUE constraint failed: studies.study_accession"), KindConstraint},
+		{"unexpected eof", fmt.Errorf("failed to read tar header: %w", io.ErrUnexpectedEOF), KindNetwork},
+		{"connection reset", fmt.Errorf("read tcp: %w", syscall.ECONNRESET), KindNetwork},
+		{"timeout text", fmt.Errorf("i/o timeout"), KindNetwork},
+		{"other", fmt.Errorf("something else"), KindUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHint(t *testing.T) {
+	if Hint(fmt.Errorf("something else")) != "" {
+		t.Error("unknown errors should have no hint")
+	}
+	for _, k := range []Kind{KindNetwork, KindRemote, KindDecompression, KindParse, KindConstraint, KindDiskFull} {
+		if k.Hint() == "" {
+			t.Errorf("%v should have a hint", k)
+		}
+	}
+	if !strings.Contains(Hint(syscall.ENOSPC), "disk is full") {
+		t.Errorf("unexpected hint for ENOSPC: %q", Hint(syscall.ENOSPC))
+	}
+}
@@ -33,6 +33,10 @@ const (
 	KindConfig
 	KindNetwork
 	KindParse
+	KindDecompression
+	KindConstraint
+	KindDiskFull
+	KindRemote
 )
 
 // String returns the string representation of the error kind.
@@ -52,6 +56,14 @@ func (k Kind) String() string {
 		return "network"
 	case KindParse:
 		return "parse"
+	case KindDecompression:
+		return "decompression"
+	case KindConstraint:
+		return "constraint"
+	case KindDiskFull:
+		return "disk_full"
+	case KindRemote:
+		return "remote"
 	default:
 		return "unknown"
 	}
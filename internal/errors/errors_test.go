@@ -106,6 +106,10 @@ func TestKindString(t *testing.T) {
 		{KindConfig, "config"},
 		{KindNetwork, "network"},
 		{KindParse, "parse"},
+		{KindDecompression, "decompression"},
+		{KindConstraint, "constraint"},
+		{KindDiskFull, "disk_full"},
+		{KindRemote, "remote"},
 	}
 
 	for _, tt := range tests {
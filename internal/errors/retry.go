@@ -0,0 +1,102 @@
+package errors
+
+import (
+	"context"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+)
+
+// Policy controls how often an operation failing with one kind of error
+// is attempted. MaxAttempts counts the first attempt, so 1 never retries.
+// The delay doubles after each retry, up to MaxDelay.
+type Policy struct {
+	MaxAttempts int
+	Delay       time.Duration
+	MaxDelay    time.Duration
+}
+
+// Backoff returns the delay before the given retry, counting from 1.
+func (p Policy) Backoff(retry int) time.Duration {
+	d := p.Delay
+	for i := 1; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// Policies maps error kinds to their retry policy. Kinds without an entry
+// are not retried.
+type Policies map[Kind]Policy
+
+// For returns the policy for kind k.
+func (p Policies) For(k Kind) Policy {
+	if policy, ok := p[k]; ok && policy.MaxAttempts > 0 {
+		return policy
+	}
+	return Policy{MaxAttempts: 1}
+}
+
+// DefaultPolicies retries network failures with backoff and corrupt
+// archives once, since a stream cut mid-transfer can look like either.
+// Parse, constraint, disk-full, and remote errors fail immediately:
+// repeating the work will not change the outcome.
+func DefaultPolicies() Policies {
+	return PoliciesFromConfig(config.DefaultConfig().Retry)
+}
+
+// PoliciesFromConfig converts the retry section of the configuration.
+func PoliciesFromConfig(c config.RetryConfig) Policies {
+	convert := func(pc config.RetryPolicyConfig) Policy {
+		return Policy{
+			MaxAttempts: pc.MaxAttempts,
+			Delay:       time.Duration(pc.Delay) * time.Second,
+			MaxDelay:    time.Duration(pc.MaxDelay) * time.Second,
+		}
+	}
+	return Policies{
+		KindNetwork:       convert(c.Network),
+		KindRemote:        convert(c.Remote),
+		KindDecompression: convert(c.Decompression),
+		KindParse:         convert(c.Parse),
+		KindConstraint:    convert(c.Constraint),
+		KindDiskFull:      convert(c.DiskFull),
+	}
+}
+
+// RetryFunc is called before each retry with the error that caused it,
+// its kind, the number of the upcoming attempt, and the delay before it.
+type RetryFunc func(err error, kind Kind, attempt int, policy Policy, wait time.Duration)
+
+// Retry calls fn until it succeeds, its error's policy allows no further
+// attempts, or ctx is done. The last error is returned unchanged.
+func Retry(ctx context.Context, policies Policies, fn func() error, onRetry RetryFunc) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		kind := Classify(err)
+		policy := policies.For(kind)
+		if attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		wait := policy.Backoff(attempt)
+		if onRetry != nil {
+			onRetry(err, kind, attempt+1, policy, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
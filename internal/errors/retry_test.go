@@ -0,0 +1,91 @@
+package errors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	p := Policy{MaxAttempts: 5, Delay: time.Second, MaxDelay: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestDefaultPolicies(t *testing.T) {
+	p := DefaultPolicies()
+	if p.For(KindNetwork).MaxAttempts <= 1 {
+		t.Error("network errors should be retried by default")
+	}
+	for _, k := range []Kind{KindParse, KindConstraint, KindDiskFull, KindRemote, KindUnknown} {
+		if got := p.For(k).MaxAttempts; got != 1 {
+			t.Errorf("%v errors should not be retried, got %d attempts", k, got)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policies := Policies{
+		KindNetwork:       {MaxAttempts: 3},
+		KindDecompression: {MaxAttempts: 2},
+	}
+
+	t.Run("transient then success", func(t *testing.T) {
+		calls, retries := 0, 0
+		err := Retry(context.Background(), policies, func() error {
+			calls++
+			if calls < 3 {
+				return &StatusError{Code: 503}
+			}
+			return nil
+		}, func(err error, kind Kind, attempt int, policy Policy, wait time.Duration) {
+			retries++
+			if kind != KindNetwork || attempt != retries+1 {
+				t.Errorf("unexpected retry: kind=%v attempt=%d", kind, attempt)
+			}
+		})
+		if err != nil || calls != 3 || retries != 2 {
+			t.Errorf("err=%v calls=%d retries=%d", err, calls, retries)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		calls := 0
+		err := Retry(context.Background(), policies, func() error {
+			calls++
+			return fmt.Errorf("read: connection reset by peer")
+		}, nil)
+		if err == nil || calls != 3 {
+			t.Errorf("err=%v calls=%d, want error after 3 calls", err, calls)
+		}
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		calls := 0
+		want := E(KindParse, "bad XML")
+		err := Retry(context.Background(), policies, func() error {
+			calls++
+			return want
+		}, nil)
+		if err != want || calls != 1 {
+			t.Errorf("err=%v calls=%d, want the parse error after 1 call", err, calls)
+		}
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := Retry(ctx, Policies{KindNetwork: {MaxAttempts: 10, Delay: time.Hour}}, func() error {
+			calls++
+			return &StatusError{Code: 502}
+		}, func(error, Kind, int, Policy, time.Duration) { cancel() })
+		if err == nil || calls != 1 {
+			t.Errorf("err=%v calls=%d, want error after 1 call", err, calls)
+		}
+	})
+}
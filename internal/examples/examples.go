@@ -0,0 +1,288 @@
+// Package examples holds the workflow recipes printed by 'srake examples'.
+// Each recipe is a sequence of shell commands; tests parse every srake
+// command in them against the real command tree, so a renamed or removed
+// flag fails the build instead of leaving the recipe stale.
+package examples
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Topic is a group of related recipes.
+type Topic struct {
+	Name     string
+	Summary  string
+	Examples []Example
+}
+
+// Example is a recipe: commands run in order, with what they do.
+type Example struct {
+	Title       string
+	Description string
+	Commands    []string
+}
+
+// Topics lists the recipes by topic, in the order 'srake examples' shows
+// them.
+var Topics = []Topic{
+	{
+		Name:    "search",
+		Summary: "Find studies, samples and runs in the local database",
+		Examples: []Example{
+			{
+				Title:       "Filter a full-text search",
+				Description: "Combine a query with metadata filters and keep the best matches.",
+				Commands: []string{
+					`srake search "liver cancer" --organism "homo sapiens" --library-strategy RNA-Seq --limit 20`,
+				},
+			},
+			{
+				Title:       "Explore facets before narrowing",
+				Description: "Count matches by organism, platform and strategy, then filter on a value.",
+				Commands: []string{
+					`srake search "liver" --facets --limit 5`,
+					`srake search "liver" --platform ILLUMINA --format csv --output liver.csv`,
+				},
+			},
+			{
+				Title:       "Search a clade",
+				Description: "Look up a taxon, then match samples of it and all its descendants.",
+				Commands: []string{
+					`srake taxonomy lineage "Mus musculus"`,
+					`srake search "brain" --taxon 10088 --include-descendants`,
+				},
+			},
+			{
+				Title:       "Query sample attributes",
+				Description: "Select samples by their submitted attributes, including numeric ranges.",
+				Commands: []string{
+					`srake attributes query "tissue=liver" "age>40" --format accession`,
+					`srake search "liver" --attribute-range "age:40-50 years"`,
+				},
+			},
+			{
+				Title:       "Start from a query template",
+				Description: "List the reviewed templates, then fill in a parameter and refine with any search flag.",
+				Commands: []string{
+					`srake templates`,
+					`srake search --template covid-wastewater --param country=Japan --date-from 2023-01-01`,
+				},
+			},
+		},
+	},
+	{
+		Name:    "ingest",
+		Summary: "Load and filter SRA metadata",
+		Examples: []Example{
+			{
+				Title:       "Build and keep a full database current",
+				Description: "Start from the monthly dataset, apply daily updates from cron, and refresh the search index.",
+				Commands: []string{
+					`srake ingest --monthly --connections 8`,
+					`srake ingest --incremental --wait`,
+					`srake index --build --wait`,
+				},
+			},
+			{
+				Title:       "Keep only human Illumina RNA-Seq",
+				Description: "Preview how many records the filters keep, then ingest them.",
+				Commands: []string{
+					`srake ingest --auto --taxon-ids 9606 --strategies RNA-Seq --platforms ILLUMINA --stats-only`,
+					`srake ingest --auto --taxon-ids 9606 --strategies RNA-Seq --platforms ILLUMINA`,
+				},
+			},
+			{
+				Title:       "Filter with an expression",
+				Description: "Keep records matching a CEL expression over their fields.",
+				Commands: []string{
+					`srake ingest --auto --filter-expr 'taxon_id == 9606 && total_bases > 1e9'`,
+				},
+			},
+			{
+				Title:       "Ingest an ENA dump",
+				Description: "Ingest a local XML dump and tag its records as ENA's.",
+				Commands: []string{
+					`srake ingest --file ena_study.xml.gz --source ena`,
+				},
+			},
+		},
+	},
+	{
+		Name:    "export",
+		Summary: "Take records and data out of srake",
+		Examples: []Example{
+			{
+				Title:       "Export an SRAmetadb database",
+				Description: "Write a SQLite file compatible with tools built for SRAmetadb.sqlite.",
+				Commands: []string{
+					`srake db export -o SRAmetadb.sqlite`,
+				},
+			},
+			{
+				Title:       "Download the runs of a search",
+				Description: "List matching runs, then fetch their FASTQ files from ENA.",
+				Commands: []string{
+					`srake search "liver AND organism:human" --format accession > runs.txt`,
+					`srake fetch --from-file runs.txt --parallel 4`,
+				},
+			},
+			{
+				Title:       "Hand downloads to aria2",
+				Description: "Write an aria2 input file for the FASTQ files of a search.",
+				Commands: []string{
+					`srake manifest --query "liver AND organism:human" --type fastq --format aria2 -o liver.aria2`,
+					`aria2c -i liver.aria2`,
+				},
+			},
+			{
+				Title:       "Freeze a cohort and track it",
+				Description: "Save the records a query matches today, then see what has changed since.",
+				Commands: []string{
+					`srake cohort freeze --query "liver AND organism:human" --name liver-cohort`,
+					`srake cohort diff liver-cohort`,
+				},
+			},
+		},
+	},
+}
+
+// Lookup returns the topic with the given name
+func Lookup(name string) (*Topic, bool) {
+	for i := range Topics {
+		if Topics[i].Name == name {
+			return &Topics[i], true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the topic names
+func Names() []string {
+	names := make([]string, len(Topics))
+	for i, t := range Topics {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Render writes the recipes of a topic as a shell script: titles and
+// descriptions are comments, so the output can be pasted or piped to sh.
+func Render(w io.Writer, t *Topic) {
+	fmt.Fprintf(w, "# %s: %s\n", t.Name, t.Summary)
+	for _, ex := range t.Examples {
+		fmt.Fprintf(w, "\n# %s\n", ex.Title)
+		if ex.Description != "" {
+			fmt.Fprintf(w, "# %s\n", ex.Description)
+		}
+		for _, c := range ex.Commands {
+			fmt.Fprintln(w, c)
+		}
+	}
+}
+
+// SrakeArgs returns the arguments of each srake command in a shell command
+// line, without the leading "srake". Quotes are removed, and the commands
+// of a pipeline or list are returned separately; redirections and other
+// programs are skipped.
+func SrakeArgs(line string) ([][]string, error) {
+	words, err := split(line)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands [][]string
+	var current []string
+	skipNext := false
+	flush := func() {
+		if len(current) > 0 && current[0] == "srake" {
+			commands = append(commands, current[1:])
+		}
+		current = nil
+	}
+	for _, w := range words {
+		switch {
+		case skipNext:
+			skipNext = false
+		case w.op && (w.text == ">" || w.text == ">>" || w.text == "<"):
+			skipNext = true // the redirected file
+		case w.op:
+			flush()
+		default:
+			current = append(current, w.text)
+		}
+	}
+	flush()
+	return commands, nil
+}
+
+// word is a shell word or, with op set, an operator
+type word struct {
+	text string
+	op   bool
+}
+
+// split splits a command line into words and operators, following the
+// quoting rules of sh closely enough for the recipes
+func split(line string) ([]word, error) {
+	var words []word
+	var b strings.Builder
+	inWord := false
+	end := func() {
+		if inWord {
+			words = append(words, word{text: b.String()})
+			b.Reset()
+			inWord = false
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch c {
+		case ' ', '\t':
+			end()
+		case '\'':
+			j := strings.IndexByte(line[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated ' in %q", line)
+			}
+			b.WriteString(line[i+1 : i+1+j])
+			inWord = true
+			i += j + 1
+		case '"':
+			inWord = true
+			for i++; ; i++ {
+				if i >= len(line) {
+					return nil, fmt.Errorf("unterminated \" in %q", line)
+				}
+				if line[i] == '"' {
+					break
+				}
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\"\\$`", line[i+1]) >= 0 {
+					i++
+				}
+				b.WriteByte(line[i])
+			}
+		case '\\':
+			if i+1 < len(line) {
+				i++
+				b.WriteByte(line[i])
+				inWord = true
+			}
+		case '|', '&', ';', '>', '<':
+			end()
+			op := string(c)
+			if i+1 < len(line) && (line[i+1] == c) {
+				op += string(c)
+				i++
+			}
+			words = append(words, word{text: op, op: true})
+		default:
+			b.WriteByte(c)
+			inWord = true
+		}
+	}
+	end()
+	return words, nil
+}
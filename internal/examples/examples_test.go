@@ -0,0 +1,96 @@
+package examples
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSrakeArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want [][]string
+	}{
+		{
+			line: `srake search "liver cancer" --organism "homo sapiens"`,
+			want: [][]string{{"search", "liver cancer", "--organism", "homo sapiens"}},
+		},
+		{
+			line: `srake search 'a && b' --format accession > runs.txt && srake fetch --from-file runs.txt`,
+			want: [][]string{{"search", "a && b", "--format", "accession"}, {"fetch", "--from-file", "runs.txt"}},
+		},
+		{
+			line: `srake search "say \"hi\"" | head -5`,
+			want: [][]string{{"search", `say "hi"`}},
+		},
+		{
+			line: `aria2c -i liver.aria2`,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		got, err := SrakeArgs(tt.line)
+		if err != nil {
+			t.Errorf("SrakeArgs(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SrakeArgs(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	if _, err := SrakeArgs(`srake search "liver`); err == nil {
+		t.Error("expected an error for an unterminated quote")
+	}
+}
+
+func TestTopics(t *testing.T) {
+	seen := map[string]bool{}
+	for _, topic := range Topics {
+		if seen[topic.Name] {
+			t.Errorf("duplicate topic %q", topic.Name)
+		}
+		seen[topic.Name] = true
+		if topic.Summary == "" || len(topic.Examples) == 0 {
+			t.Errorf("topic %q needs a summary and examples", topic.Name)
+		}
+
+		for _, ex := range topic.Examples {
+			srake := 0
+			for _, c := range ex.Commands {
+				commands, err := SrakeArgs(c)
+				if err != nil {
+					t.Errorf("%s / %s: %v", topic.Name, ex.Title, err)
+				}
+				srake += len(commands)
+			}
+			if srake == 0 {
+				t.Errorf("%s / %s runs no srake command", topic.Name, ex.Title)
+			}
+		}
+	}
+
+	if topic, ok := Lookup("ingest"); !ok || topic.Name != "ingest" {
+		t.Error("Lookup(ingest) failed")
+	}
+	if _, ok := Lookup("missing"); ok {
+		t.Error("Lookup(missing) succeeded")
+	}
+}
+
+func TestRender(t *testing.T) {
+	topic, _ := Lookup("export")
+	var buf bytes.Buffer
+	Render(&buf, topic)
+
+	// Everything but the commands is a comment
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "srake ") && !strings.HasPrefix(line, "aria2c ") {
+			t.Errorf("unexpected line %q", line)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Dump formats
+const (
+	FormatParquet = "parquet"
+	FormatJSONL   = "jsonl"
+	FormatCSV     = "csv"
+	FormatTSV     = "tsv"
+)
+
+// Dump compression codecs. Parquet compresses each page; the text formats
+// compress the whole stream.
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+)
+
+// DumpTables are the tables that can be dumped
+var DumpTables = []string{
+	"studies", "experiments", "samples", "runs", "submissions", "analyses",
+	"experiment_samples", "sample_runs",
+}
+
+// ColumnKind is the value type of a dumped column
+type ColumnKind int
+
+const (
+	KindString ColumnKind = iota
+	KindInt
+	KindFloat
+)
+
+// Column is one column of a dump
+type Column struct {
+	Name string
+	Kind ColumnKind
+}
+
+// RowWriter writes rows in a dump format. Close flushes buffered rows and
+// any footer, but leaves the underlying writer open.
+type RowWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// FormatFromPath infers the dump format and compression from a file name,
+// such as runs.parquet or runs.csv.gz. It returns empty strings for names
+// it does not recognise.
+func FormatFromPath(path string) (format, compression string) {
+	name := strings.ToLower(filepath.Base(path))
+	if strings.HasSuffix(name, ".gz") {
+		compression = CompressGzip
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	switch filepath.Ext(name) {
+	case ".parquet":
+		format = FormatParquet
+	case ".jsonl", ".ndjson":
+		format = FormatJSONL
+	case ".csv":
+		format = FormatCSV
+	case ".tsv":
+		format = FormatTSV
+	}
+	return format, compression
+}
+
+// NewRowWriter returns a writer of the given format and compression
+func NewRowWriter(w io.Writer, format, compression string, columns []Column) (RowWriter, error) {
+	if compression == "" {
+		compression = CompressNone
+	}
+	if compression != CompressNone && compression != CompressGzip {
+		return nil, fmt.Errorf("unsupported compression: %s (use %s or %s)", compression, CompressNone, CompressGzip)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns to export")
+	}
+
+	if format == FormatParquet {
+		return newParquetWriter(w, columns, compression == CompressGzip)
+	}
+
+	var zw *gzip.Writer
+	if compression == CompressGzip {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+
+	var rw RowWriter
+	switch format {
+	case FormatJSONL:
+		rw = &jsonlWriter{w: w, columns: columns}
+	case FormatCSV, FormatTSV:
+		cw := csv.NewWriter(w)
+		if format == FormatTSV {
+			cw.Comma = '\t'
+		}
+		header := make([]string, len(columns))
+		for i, col := range columns {
+			header[i] = col.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		rw = &csvWriter{w: cw}
+	default:
+		return nil, fmt.Errorf("unsupported format: %s (use %s, %s, %s or %s)", format, FormatParquet, FormatJSONL, FormatCSV, FormatTSV)
+	}
+
+	if zw != nil {
+		return &gzipRowWriter{RowWriter: rw, zw: zw}, nil
+	}
+	return rw, nil
+}
+
+// csvWriter writes rows as CSV or TSV with a header line
+type csvWriter struct {
+	w   *csv.Writer
+	row []string
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	c.row = c.row[:0]
+	for _, v := range values {
+		c.row = append(c.row, formatValue(v))
+	}
+	return c.w.Write(c.row)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes rows as JSON objects, one per line, with keys in
+// column order
+type jsonlWriter struct {
+	w       io.Writer
+	columns []Column
+	line    []byte
+}
+
+func (j *jsonlWriter) WriteRow(values []interface{}) error {
+	j.line = append(j.line[:0], '{')
+	for i, col := range j.columns {
+		if i > 0 {
+			j.line = append(j.line, ',')
+		}
+		key, _ := json.Marshal(col.Name)
+		j.line = append(j.line, key...)
+		j.line = append(j.line, ':')
+
+		var v interface{}
+		if i < len(values) {
+			v = values[i]
+		}
+		value, err := json.Marshal(jsonValue(v, col.Kind))
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		j.line = append(j.line, value...)
+	}
+	j.line = append(j.line, '}', '\n')
+	_, err := j.w.Write(j.line)
+	return err
+}
+
+func (j *jsonlWriter) Close() error { return nil }
+
+// jsonValue converts a database value for JSON encoding. Numeric columns
+// stay numbers where possible; everything else is a string.
+func jsonValue(v interface{}, kind ColumnKind) interface{} {
+	switch kind {
+	case KindInt:
+		if n, ok, err := toInt64(v); ok && err == nil {
+			return n
+		}
+	case KindFloat:
+		if f, ok, err := toFloat64(v); ok && err == nil {
+			return f
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	if s := formatValue(v); s != "" || kind == KindString {
+		return s
+	}
+	return nil
+}
+
+// gzipRowWriter compresses the output of a text row writer
+type gzipRowWriter struct {
+	RowWriter
+	zw *gzip.Writer
+}
+
+func (g *gzipRowWriter) Close() error {
+	if err := g.RowWriter.Close(); err != nil {
+		return err
+	}
+	return g.zw.Close()
+}
+
+// TableColumns returns the columns of a dumpable table, typed by their
+// declared SQLite types
+func TableColumns(db *sql.DB, table string) ([]Column, error) {
+	if !isDumpTable(table) {
+		return nil, fmt.Errorf("unknown table: %s (use one of %s)", table, strings.Join(DumpTables, ", "))
+	}
+
+	rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []Column
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			dflt       sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &primaryKey); err != nil {
+			return nil, err
+		}
+		columns = append(columns, Column{Name: name, Kind: kindOf(typ)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", table)
+	}
+	return columns, nil
+}
+
+// kindOf maps a declared SQLite type to a column kind, following SQLite's
+// affinity rules
+func kindOf(declType string) ColumnKind {
+	t := strings.ToUpper(declType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return KindInt
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return KindString
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return KindFloat
+	}
+	return KindString
+}
+
+func isDumpTable(table string) bool {
+	for _, t := range DumpTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectColumns picks the named columns, in the order given. An empty
+// selection keeps every column.
+func SelectColumns(columns []Column, names []string) ([]Column, error) {
+	if len(names) == 0 {
+		return columns, nil
+	}
+	byName := make(map[string]Column, len(columns))
+	for _, col := range columns {
+		byName[col.Name] = col
+	}
+	selected := make([]Column, 0, len(names))
+	for _, name := range names {
+		col, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		selected = append(selected, col)
+	}
+	return selected, nil
+}
+
+// dumpKeys are the accession columns of the tables whose rows can be
+// selected by accession
+var dumpKeys = map[string]string{
+	"studies":     "study_accession",
+	"experiments": "experiment_accession",
+	"samples":     "sample_accession",
+	"runs":        "run_accession",
+	"submissions": "submission_accession",
+	"analyses":    "analysis_accession",
+}
+
+// dumpOrder is the primary key of each dump table. Rows are written in
+// its order rather than the order they were stored, which depends on how
+// the database was ingested, so that dumps of the same records are
+// identical.
+var dumpOrder = map[string]string{
+	"studies":            "study_accession",
+	"experiments":        "experiment_accession",
+	"samples":            "sample_accession",
+	"runs":               "run_accession",
+	"submissions":        "submission_accession",
+	"analyses":           "analysis_accession",
+	"experiment_samples": "experiment_accession, sample_accession",
+	"sample_runs":        "sample_accession, run_accession",
+}
+
+// accessionBatch is the number of accessions looked up per query
+const accessionBatch = 500
+
+// DumpOptions selects the rows and columns of a table dump
+type DumpOptions struct {
+	Table   string
+	Columns []string // all columns when empty
+	Limit   int      // all rows when zero
+
+	// Accessions restricts the dump to these records, written in this
+	// order, such as the hits of a search. Accessions not in the table
+	// are skipped.
+	Accessions []string
+}
+
+// DumpTable streams the rows of a table to the writer returned by open,
+// returning the number of rows written. Without accessions, rows are
+// written in primary key order, read through the key's index.
+func DumpTable(ctx context.Context, db *sql.DB, opts DumpOptions, open func([]Column) (RowWriter, error)) (int64, error) {
+	all, err := TableColumns(db, opts.Table)
+	if err != nil {
+		return 0, err
+	}
+	columns, err := SelectColumns(all, opts.Columns)
+	if err != nil {
+		return 0, err
+	}
+	key, byAccession := dumpKeys[opts.Table]
+	if opts.Accessions != nil && !byAccession {
+		return 0, fmt.Errorf("table %s cannot be selected by accession", opts.Table)
+	}
+
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = `"` + col.Name + `"`
+	}
+	selectCols := strings.Join(names, ", ")
+
+	w, err := open(columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	write := func(values []interface{}) error {
+		if opts.Limit > 0 && count >= int64(opts.Limit) {
+			return nil
+		}
+		if err := w.WriteRow(values); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+
+	if opts.Accessions == nil {
+		query := `SELECT ` + selectCols + ` FROM ` + opts.Table + ` ORDER BY ` + dumpOrder[opts.Table]
+		var args []interface{}
+		if opts.Limit > 0 {
+			query += ` LIMIT ?`
+			args = append(args, opts.Limit)
+		}
+		err = scanRows(ctx, db, query, args, len(columns), func(values []interface{}) error {
+			return write(values)
+		})
+	} else {
+		// The key is selected last to order each batch by the accessions
+		for start := 0; start < len(opts.Accessions) && err == nil; start += accessionBatch {
+			batch := opts.Accessions[start:min(start+accessionBatch, len(opts.Accessions))]
+			args := make([]interface{}, len(batch))
+			for i, acc := range batch {
+				args[i] = acc
+			}
+			query := `SELECT ` + selectCols + `, "` + key + `" FROM ` + opts.Table +
+				` WHERE "` + key + `" IN (?` + strings.Repeat(", ?", len(batch)-1) + `)`
+
+			found := make(map[string][]interface{}, len(batch))
+			err = scanRows(ctx, db, query, args, len(columns)+1, func(values []interface{}) error {
+				found[formatValue(values[len(columns)])] = append([]interface{}(nil), values[:len(columns)]...)
+				return nil
+			})
+			for _, acc := range batch {
+				if values, ok := found[acc]; ok && err == nil {
+					err = write(values)
+				}
+			}
+		}
+	}
+	if err != nil {
+		w.Close()
+		return count, err
+	}
+	return count, w.Close()
+}
+
+// scanRows runs a query and calls fn with the values of each row. The
+// values slice is reused between rows.
+func scanRows(ctx context.Context, db *sql.DB, query string, args []interface{}, n int, fn func([]interface{}) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, n)
+	ptrs := make([]interface{}, n)
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CopyRows writes every row of rows, whose columns must be those the
+// writer was opened with, and returns the number written. It closes
+// neither.
+func CopyRows(rows *sql.Rows, w RowWriter) (int64, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	var count int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return count, err
+		}
+		if err := w.WriteRow(values); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
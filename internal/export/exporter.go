@@ -62,9 +62,7 @@ func NewExporter(cfg *Config) (*Exporter, error) {
 	}
 
 	// Wrap in database struct for compatibility
-	sourceDB := &database.DB{
-		DB: sourceConn,
-	}
+	sourceDB := database.Wrap(sourceConn)
 
 	// Create output directory if needed
 	outputDir := filepath.Dir(cfg.OutputPath)
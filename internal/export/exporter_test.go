@@ -1,9 +1,19 @@
 package export
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/nishad/srake/internal/database"
 )
 
 func TestNullString(t *testing.T) {
@@ -124,3 +134,290 @@ func TestStatsFields(t *testing.T) {
 		t.Errorf("expected 5s duration, got %v", stats.Duration)
 	}
 }
+
+func TestDumpTable(t *testing.T) {
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Stored out of order, as an ingest may write them
+	for _, run := range []*database.Run{
+		{RunAccession: "SRR000003", ExperimentAccession: "SRX000002"},
+		{RunAccession: "SRR000001", ExperimentAccession: "SRX000001", TotalSpots: 100, Metadata: `{"a":1}`},
+		{RunAccession: "SRR000002", ExperimentAccession: "SRX000001", TotalSpots: 200},
+	} {
+		if err := db.InsertRun(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dump := func(format string, opts DumpOptions) string {
+		t.Helper()
+		var buf bytes.Buffer
+		opts.Table = "runs"
+		_, err := DumpTable(context.Background(), db.DB, opts, func(columns []Column) (RowWriter, error) {
+			return NewRowWriter(&buf, format, CompressNone, columns)
+		})
+		if err != nil {
+			t.Fatalf("DumpTable(%s) failed: %v", format, err)
+		}
+		return buf.String()
+	}
+
+	got := dump(FormatCSV, DumpOptions{Columns: []string{"run_accession", "total_spots"}})
+	if want := "run_accession,total_spots\nSRR000001,100\nSRR000002,200\nSRR000003,0\n"; got != want {
+		t.Errorf("unexpected CSV:\n%s", got)
+	}
+
+	got = dump(FormatJSONL, DumpOptions{Columns: []string{"run_accession", "total_spots", "metadata"}, Accessions: []string{"SRR000002", "SRR999999", "SRR000001"}})
+	want := `{"run_accession":"SRR000002","total_spots":200,"metadata":""}` + "\n" +
+		`{"run_accession":"SRR000001","total_spots":100,"metadata":"{\"a\":1}"}` + "\n"
+	if got != want {
+		t.Errorf("unexpected JSONL:\n%s", got)
+	}
+
+	got = dump(FormatParquet, DumpOptions{Limit: 2})
+	accessions := readParquetColumn(t, []byte(got), "run_accession")
+	spots := readParquetColumn(t, []byte(got), "total_spots")
+	if len(accessions) != 2 || accessions[0] != "SRR000001" || accessions[1] != "SRR000002" {
+		t.Errorf("unexpected parquet accessions %v", accessions)
+	}
+	if len(spots) != 2 || spots[0] != int64(100) || spots[1] != int64(200) {
+		t.Errorf("unexpected parquet spots %v", spots)
+	}
+
+	var buf bytes.Buffer
+	_, err = DumpTable(context.Background(), db.DB, DumpOptions{Table: "runs", Columns: []string{"nope"}}, func(columns []Column) (RowWriter, error) {
+		return NewRowWriter(&buf, FormatCSV, CompressNone, columns)
+	})
+	if err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+	if _, err := TableColumns(db.DB, "sqlite_master"); err == nil {
+		t.Error("expected an error for a table that cannot be dumped")
+	}
+}
+
+func TestDumpJoined(t *testing.T) {
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.InsertStudy(&database.Study{StudyAccession: "SRP000001", StudyTitle: "Liver, cohort A", Metadata: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertExperiment(&database.Experiment{ExperimentAccession: "SRX000001", StudyAccession: "SRP000001", LibraryStrategy: "RNA-Seq", Metadata: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertSample(&database.Sample{SampleAccession: "SRS000001", ScientificName: "Homo sapiens", TaxonID: 9606,
+		SampleAttributes: `[{"tag":"Sex","value":"female"},{"tag":"age","value":"52"}]`}); err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range []*database.Run{
+		{RunAccession: "SRR000001", ExperimentAccession: "SRX000001", TotalSpots: 100},
+		{RunAccession: "SRR000002", ExperimentAccession: "SRX000002", TotalSpots: 200},
+	} {
+		if err := db.InsertRun(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertExperimentSamples([]database.ExperimentSample{{ExperimentAccession: "SRX000001", SampleAccession: "SRS000001"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RefreshSampleRuns([]string{"SRX000001"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := func(opts JoinedOptions) string {
+		t.Helper()
+		var buf bytes.Buffer
+		_, err := DumpJoined(context.Background(), db.DB, opts, func(columns []Column) (RowWriter, error) {
+			return NewRowWriter(&buf, FormatCSV, CompressNone, columns)
+		})
+		if err != nil {
+			t.Fatalf("DumpJoined failed: %v", err)
+		}
+		return buf.String()
+	}
+
+	// A run without a linked sample is kept, with empty sample columns
+	got := dump(JoinedOptions{Columns: []string{"run_accession", "study_title", "organism", "total_spots", "attr_Sex", "attr_age", "attr_tissue"}})
+	want := "run_accession,study_title,organism,total_spots,attr_sex,attr_age,attr_tissue\n" +
+		"SRR000001,\"Liver, cohort A\",Homo sapiens,100,female,52,\n" +
+		"SRR000002,,,200,,,\n"
+	if got != want {
+		t.Errorf("unexpected CSV:\n%s", got)
+	}
+
+	got = dump(JoinedOptions{Attributes: []string{"sex"}, Limit: 1})
+	if lines := strings.Split(strings.TrimSpace(got), "\n"); len(lines) != 2 || !strings.HasSuffix(lines[0], ",attr_sex") || !strings.HasPrefix(lines[1], "SRR000001,") {
+		t.Errorf("expected every column and one row, got:\n%s", got)
+	}
+
+	if _, err := DumpJoined(context.Background(), db.DB, JoinedOptions{Columns: []string{"sex"}}, nil); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+
+	// Inherited attributes are taken from the experiment, then the study,
+	// and name their source
+	if _, err := db.Exec(`UPDATE studies SET metadata = ? WHERE study_accession = 'SRP000001'`,
+		`{"attributes":[{"tag":"Sex","value":"male"},{"tag":"Tissue","value":"liver"},{"tag":"disease","value":"NASH"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE experiments SET metadata = ? WHERE experiment_accession = 'SRX000001'`,
+		`{"attributes":[{"tag":"tissue","value":"liver biopsy"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	got = dump(JoinedOptions{Columns: []string{"run_accession", "attr_sex", "attr_tissue", "attr_disease", "attr_age"}, Inherit: true})
+	want = "run_accession,attr_sex,attr_sex_source,attr_tissue,attr_tissue_source,attr_disease,attr_disease_source,attr_age,attr_age_source\n" +
+		"SRR000001,female,sample,liver biopsy,experiment,NASH,study,52,sample\n" +
+		"SRR000002,,,,,,,,\n"
+	if got != want {
+		t.Errorf("unexpected inherited CSV:\n%s", got)
+	}
+	got = dump(JoinedOptions{Columns: []string{"run_accession", "attr_tissue"}})
+	if want := "run_accession,attr_tissue\nSRR000001,\nSRR000002,\n"; got != want {
+		t.Errorf("expected no inherited attributes without Inherit, got:\n%s", got)
+	}
+
+	estimate, err := EstimateJoined(context.Background(), db.DB, JoinedOptions{Columns: []string{"run_accession"}}, FormatCSV, CompressNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.Rows != 2 || estimate.Columns != 1 || estimate.Bytes != int64(len("run_accession\nSRR000001\nSRR000002\n")) {
+		t.Errorf("unexpected estimate: %+v", estimate)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	columns := []Column{{Name: "accession", Kind: KindString}, {Name: "spots", Kind: KindInt}, {Name: "gc", Kind: KindFloat}}
+	var buf bytes.Buffer
+	w, err := NewRowWriter(&buf, FormatParquet, CompressGzip, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty numbers are nulls; the last row starts a second row group
+	rows := parquetRowGroupRows + 1
+	for i := 0; i < rows; i++ {
+		row := []interface{}{fmt.Sprintf("SRR%06d", i), int64(i), 0.5}
+		if i == 1 {
+			row = []interface{}{nil, "", nil}
+		}
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.NumRowGroups() != 2 || r.NumRows() != int64(rows) {
+		t.Errorf("expected %d rows in 2 row groups, got %d in %d", rows, r.NumRows(), r.NumRowGroups())
+	}
+	if chunk, err := r.MetaData().RowGroup(0).ColumnChunk(0); err != nil || chunk.Compression() != compress.Codecs.Gzip {
+		t.Errorf("expected a gzip-compressed column chunk (%v)", err)
+	}
+	r.Close()
+
+	accessions := readParquetColumn(t, buf.Bytes(), "accession")
+	spots := readParquetColumn(t, buf.Bytes(), "spots")
+	gc := readParquetColumn(t, buf.Bytes(), "gc")
+	if len(accessions) != rows || accessions[0] != "SRR000000" || accessions[1] != nil || accessions[rows-1] != fmt.Sprintf("SRR%06d", rows-1) {
+		t.Errorf("unexpected accessions %v ... %v", accessions[:2], accessions[rows-1])
+	}
+	if spots[1] != nil || spots[2] != int64(2) || gc[1] != nil || gc[2] != 0.5 {
+		t.Errorf("unexpected values %v %v, %v %v", spots[1], spots[2], gc[1], gc[2])
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path, format, compression string
+	}{
+		{"runs.parquet", FormatParquet, ""},
+		{"out/Runs.CSV.gz", FormatCSV, CompressGzip},
+		{"hits.ndjson", FormatJSONL, ""},
+		{"runs.txt", "", ""},
+	}
+	for _, tt := range tests {
+		format, compression := FormatFromPath(tt.path)
+		if format != tt.format || compression != tt.compression {
+			t.Errorf("FormatFromPath(%q) = %q, %q, want %q, %q", tt.path, format, compression, tt.format, tt.compression)
+		}
+	}
+}
+
+// readParquetColumn reads the values of a column of a Parquet file, nulls
+// as nil
+func readParquetColumn(t *testing.T, data []byte, name string) []interface{} {
+	t.Helper()
+	r, err := file.NewParquetReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to read parquet: %v", err)
+	}
+	defer r.Close()
+	col := r.MetaData().Schema.ColumnIndexByName(name)
+	if col < 0 {
+		t.Fatalf("parquet file has no column %s", name)
+	}
+
+	var values []interface{}
+	for g := 0; g < r.NumRowGroups(); g++ {
+		group := r.RowGroup(g)
+		reader, err := group.Column(col)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := group.NumRows()
+		levels := make([]int16, n)
+		var read []interface{}
+		switch c := reader.(type) {
+		case *file.Int64ColumnChunkReader:
+			batch := make([]int64, n)
+			_, count, err := c.ReadBatch(n, batch, levels, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range batch[:count] {
+				read = append(read, v)
+			}
+		case *file.Float64ColumnChunkReader:
+			batch := make([]float64, n)
+			_, count, err := c.ReadBatch(n, batch, levels, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range batch[:count] {
+				read = append(read, v)
+			}
+		case *file.ByteArrayColumnChunkReader:
+			batch := make([]parquet.ByteArray, n)
+			_, count, err := c.ReadBatch(n, batch, levels, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range batch[:count] {
+				read = append(read, string(v))
+			}
+		default:
+			t.Fatalf("unexpected column reader %T", reader)
+		}
+		for _, level := range levels {
+			if level == 0 {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, read[0])
+			read = read[1:]
+		}
+	}
+	return values
+}
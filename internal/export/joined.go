@@ -0,0 +1,232 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// AttributePrefix starts the names of the sample attribute columns of a
+// joined export, such as attr_sex, so that they cannot clash with the
+// fixed columns
+const AttributePrefix = "attr_"
+
+// joinedColumn is a fixed column of a joined export and the expression
+// selecting it
+type joinedColumn struct {
+	Column
+	expr string
+}
+
+// joinedColumns are the fixed columns of a joined export
+var joinedColumns = []joinedColumn{
+	{Column{"run_accession", KindString}, "r.run_accession"},
+	{Column{"experiment_accession", KindString}, "r.experiment_accession"},
+	{Column{"sample_accession", KindString}, "sr.sample_accession"},
+	{Column{"study_accession", KindString}, "e.study_accession"},
+	{Column{"study_title", KindString}, "st.study_title"},
+	{Column{"organism", KindString}, "COALESCE(NULLIF(s.scientific_name, ''), s.organism)"},
+	{Column{"taxon_id", KindInt}, "s.taxon_id"},
+	{Column{"tissue", KindString}, "s.tissue"},
+	{Column{"cell_type", KindString}, "s.cell_type"},
+	{Column{"library_strategy", KindString}, "e.library_strategy"},
+	{Column{"library_source", KindString}, "e.library_source"},
+	{Column{"library_layout", KindString}, "json_extract(e.metadata, '$.library_layout')"},
+	{Column{"platform", KindString}, "e.platform"},
+	{Column{"instrument_model", KindString}, "e.instrument_model"},
+	{Column{"total_spots", KindInt}, "r.total_spots"},
+	{Column{"total_bases", KindInt}, "r.total_bases"},
+	{Column{"published", KindString}, "r.published"},
+}
+
+// JoinedColumnNames returns the names of the fixed columns of a joined
+// export
+func JoinedColumnNames() []string {
+	names := make([]string, len(joinedColumns))
+	for i, col := range joinedColumns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// JoinedOptions selects the columns and rows of a joined export
+type JoinedOptions struct {
+	// Columns names fixed columns and attribute columns, in order. When
+	// empty, every fixed column is written, followed by the attributes of
+	// Attributes.
+	Columns    []string
+	Attributes []string // tags, without AttributePrefix
+	Limit      int      // all rows when zero
+
+	// Inherit fills the attributes a sample lacks from those of the run's
+	// experiment, then its study, and follows each attribute column with
+	// an attr_<tag>_source column naming the record the value came from:
+	// sample, experiment or study.
+	Inherit bool
+}
+
+// SourceSuffix ends the names of the columns that name the source of an
+// inherited attribute, such as attr_sex_source
+const SourceSuffix = "_source"
+
+// attributeExprs return the expressions selecting an attribute of the
+// sample of a row, of its experiment and of its study, and their arguments
+func attributeExprs(tag string) ([]string, []interface{}) {
+	// A tag given several times keeps its first value
+	exprs := []string{`(SELECT a.value FROM sample_attributes a
+			WHERE a.sample_accession = sr.sample_accession AND a.tag = ? ORDER BY a.rowid LIMIT 1)`}
+	// Studies and experiments keep their attributes, with tags as
+	// submitted, in their metadata
+	for _, table := range []string{"e", "st"} {
+		exprs = append(exprs, `(SELECT json_extract(j.value, '$.value')
+			FROM json_each(CASE WHEN json_valid(`+table+`.metadata) THEN `+table+`.metadata ELSE '{}' END, '$.attributes') j
+			WHERE LOWER(REPLACE(TRIM(json_extract(j.value, '$.tag')), ' ', '_')) = ? ORDER BY j.key LIMIT 1)`)
+	}
+	return exprs, []interface{}{tag, tag, tag}
+}
+
+// joinedQuery returns the columns of a joined export and the query
+// selecting them
+func joinedQuery(opts JoinedOptions) ([]Column, string, []interface{}, error) {
+	names := opts.Columns
+	if len(names) == 0 {
+		names = JoinedColumnNames()
+		for _, tag := range opts.Attributes {
+			names = append(names, AttributePrefix+tag)
+		}
+	}
+
+	byName := make(map[string]joinedColumn, len(joinedColumns))
+	for _, col := range joinedColumns {
+		byName[col.Name] = col
+	}
+
+	var columns []Column
+	var exprs []string
+	var args []interface{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if col, ok := byName[name]; ok {
+			columns = append(columns, col.Column)
+			exprs = append(exprs, col.expr)
+			continue
+		}
+		tag := strings.TrimPrefix(name, AttributePrefix)
+		if tag == name || tag == "" {
+			return nil, "", nil, fmt.Errorf("unknown column: %s (use %s or %s<tag>)", name, strings.Join(JoinedColumnNames(), ", "), AttributePrefix)
+		}
+		tag = database.NormalizeAttributeTag(tag)
+		columns = append(columns, Column{Name: AttributePrefix + tag, Kind: KindString})
+		sources, sourceArgs := attributeExprs(tag)
+		if !opts.Inherit {
+			exprs = append(exprs, sources[0])
+			args = append(args, sourceArgs[0])
+			continue
+		}
+		exprs = append(exprs, `COALESCE(`+strings.Join(sources, ", ")+`)`)
+		args = append(args, sourceArgs...)
+
+		columns = append(columns, Column{Name: AttributePrefix + tag + SourceSuffix, Kind: KindString})
+		exprs = append(exprs, `CASE WHEN `+sources[0]+` IS NOT NULL THEN 'sample'
+			WHEN `+sources[1]+` IS NOT NULL THEN 'experiment'
+			WHEN `+sources[2]+` IS NOT NULL THEN 'study' END`)
+		args = append(args, sourceArgs...)
+	}
+	if len(columns) == 0 {
+		return nil, "", nil, fmt.Errorf("no columns to export")
+	}
+
+	// Runs are the outer loop, read through their primary key, so that rows
+	// stream in accession order without sorting the whole result
+	query := `SELECT ` + strings.Join(exprs, ", ") + `
+		FROM runs r
+		LEFT JOIN sample_runs sr ON sr.run_accession = r.run_accession
+		LEFT JOIN samples s ON s.sample_accession = sr.sample_accession
+		LEFT JOIN experiments e ON e.experiment_accession = r.experiment_accession
+		LEFT JOIN studies st ON st.study_accession = e.study_accession
+		ORDER BY r.run_accession, sr.sample_accession`
+	if opts.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, opts.Limit)
+	}
+	return columns, query, args, nil
+}
+
+// DumpJoined streams runs joined to their samples, experiments and
+// studies, one row per run and sample, to the writer returned by open, and
+// returns the number of rows written. Sample attributes are flattened into
+// one column per tag. Rows are read from a single query as they are
+// written, so memory use does not grow with the number of runs.
+func DumpJoined(ctx context.Context, db *sql.DB, opts JoinedOptions, open func([]Column) (RowWriter, error)) (int64, error) {
+	columns, query, args, err := joinedQuery(opts)
+	if err != nil {
+		return 0, err
+	}
+	w, err := open(columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = scanRows(ctx, db, query, args, len(columns), func(values []interface{}) error {
+		count++
+		return w.WriteRow(values)
+	})
+	if err != nil {
+		w.Close()
+		return count, err
+	}
+	return count, w.Close()
+}
+
+// estimateSample is the number of rows written to estimate the size of a
+// joined export
+const estimateSample = 1000
+
+// JoinedEstimate is the expected size of a joined export
+type JoinedEstimate struct {
+	Columns int   `json:"columns"`
+	Rows    int64 `json:"rows"`
+	Bytes   int64 `json:"bytes"` // extrapolated from the first rows
+}
+
+// EstimateJoined counts the rows of a joined export and estimates its size
+// in a format by writing its first rows
+func EstimateJoined(ctx context.Context, db *sql.DB, opts JoinedOptions, format, compression string) (*JoinedEstimate, error) {
+	var rows int64
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM runs r
+		LEFT JOIN sample_runs sr ON sr.run_accession = r.run_accession
+	`).Scan(&rows)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Limit > 0 && int64(opts.Limit) < rows {
+		rows = int64(opts.Limit)
+	}
+
+	sample := opts
+	sample.Limit = estimateSample
+	if rows < estimateSample {
+		sample.Limit = int(rows)
+	}
+	counter := &countingWriter{w: io.Discard}
+	var columns int
+	sampled, err := DumpJoined(ctx, db, sample, func(cols []Column) (RowWriter, error) {
+		columns = len(cols)
+		return NewRowWriter(counter, format, compression, cols)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &JoinedEstimate{Columns: columns, Rows: rows, Bytes: counter.n}
+	if sampled > 0 && rows > sampled {
+		estimate.Bytes = counter.n * rows / sampled
+	}
+	return estimate, nil
+}
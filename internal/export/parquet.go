@@ -0,0 +1,270 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/schema"
+)
+
+// A row group is written once either limit is reached, so that memory use
+// is bounded by the row group size and wide JSON columns stay at a size
+// readers handle comfortably.
+const (
+	parquetRowGroupRows  = 100000
+	parquetRowGroupBytes = 64 << 20
+)
+
+// parquetWriter writes rows as a Parquet file of optional columns. Rows are
+// buffered by column and written as a row group as the group fills, so the
+// output never needs to be seeked.
+type parquetWriter struct {
+	fw      *file.Writer
+	columns []Column
+
+	// Buffered row group, one entry per column. Only defined values are
+	// buffered; the definition levels mark nulls.
+	defined [][]int16
+	ints    [][]int64
+	floats  [][]float64
+	strings [][]parquet.ByteArray
+	bytes   int
+	rows    int
+}
+
+func newParquetWriter(w io.Writer, columns []Column, gzipped bool) (*parquetWriter, error) {
+	fields := make(schema.FieldList, len(columns))
+	for i, col := range columns {
+		var err error
+		switch col.Kind {
+		case KindInt:
+			fields[i], err = schema.NewPrimitiveNode(col.Name, parquet.Repetitions.Optional, parquet.Types.Int64, -1, -1)
+		case KindFloat:
+			fields[i], err = schema.NewPrimitiveNode(col.Name, parquet.Repetitions.Optional, parquet.Types.Double, -1, -1)
+		default:
+			fields[i], err = schema.NewPrimitiveNodeLogical(col.Name, parquet.Repetitions.Optional,
+				schema.StringLogicalType{}, parquet.Types.ByteArray, -1, -1)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", col.Name, err)
+		}
+	}
+	root, err := schema.NewGroupNode("schema", parquet.Repetitions.Required, fields, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	props := []parquet.WriterProperty{parquet.WithCreatedBy("srake")}
+	if gzipped {
+		props = append(props, parquet.WithCompression(compress.Codecs.Gzip))
+	}
+	// The file writer closes its sink, which belongs to the caller
+	sink := struct{ io.Writer }{w}
+
+	return &parquetWriter{
+		fw:      file.NewParquetWriter(sink, root, file.WithWriterProps(parquet.NewWriterProperties(props...))),
+		columns: columns,
+		defined: make([][]int16, len(columns)),
+		ints:    make([][]int64, len(columns)),
+		floats:  make([][]float64, len(columns)),
+		strings: make([][]parquet.ByteArray, len(columns)),
+	}, nil
+}
+
+func (pw *parquetWriter) WriteRow(values []interface{}) error {
+	if len(values) != len(pw.columns) {
+		return fmt.Errorf("row has %d values, expected %d", len(values), len(pw.columns))
+	}
+	for i, v := range values {
+		ok, err := pw.appendValue(i, v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", pw.columns[i].Name, err)
+		}
+		var level int16
+		if ok {
+			level = 1
+		}
+		pw.defined[i] = append(pw.defined[i], level)
+	}
+	pw.rows++
+	if pw.rows >= parquetRowGroupRows || pw.bytes >= parquetRowGroupBytes {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+// appendValue buffers a value of a column, reporting whether the value is
+// defined. Empty strings in numeric columns are written as nulls.
+func (pw *parquetWriter) appendValue(i int, v interface{}) (bool, error) {
+	if v == nil {
+		return false, nil
+	}
+
+	switch pw.columns[i].Kind {
+	case KindInt:
+		n, ok, err := toInt64(v)
+		if !ok || err != nil {
+			return false, err
+		}
+		pw.ints[i] = append(pw.ints[i], n)
+		pw.bytes += 8
+	case KindFloat:
+		f, ok, err := toFloat64(v)
+		if !ok || err != nil {
+			return false, err
+		}
+		pw.floats[i] = append(pw.floats[i], f)
+		pw.bytes += 8
+	default:
+		s := formatValue(v)
+		pw.strings[i] = append(pw.strings[i], parquet.ByteArray(s))
+		pw.bytes += 4 + len(s)
+	}
+	return true, nil
+}
+
+// flushRowGroup writes the buffered rows as a row group
+func (pw *parquetWriter) flushRowGroup() error {
+	if pw.rows == 0 {
+		return nil
+	}
+
+	group := pw.fw.AppendRowGroup()
+	for i, col := range pw.columns {
+		cw, err := group.NextColumn()
+		if err != nil {
+			return err
+		}
+		switch w := cw.(type) {
+		case *file.Int64ColumnChunkWriter:
+			_, err = w.WriteBatch(pw.ints[i], pw.defined[i], nil)
+		case *file.Float64ColumnChunkWriter:
+			_, err = w.WriteBatch(pw.floats[i], pw.defined[i], nil)
+		case *file.ByteArrayColumnChunkWriter:
+			_, err = w.WriteBatch(pw.strings[i], pw.defined[i], nil)
+		default:
+			err = fmt.Errorf("unexpected column writer %T", cw)
+		}
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.Name, err)
+		}
+
+		pw.defined[i] = pw.defined[i][:0]
+		pw.ints[i] = pw.ints[i][:0]
+		pw.floats[i] = pw.floats[i][:0]
+		pw.strings[i] = pw.strings[i][:0]
+	}
+	if err := group.Close(); err != nil {
+		return err
+	}
+
+	pw.bytes = 0
+	pw.rows = 0
+	return nil
+}
+
+// Close writes the last row group and the file footer. It does not close
+// the underlying writer.
+func (pw *parquetWriter) Close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+	return pw.fw.Close()
+}
+
+// toInt64 converts a database value for an integer column
+func toInt64(v interface{}) (int64, bool, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, true, nil
+	case int:
+		return int64(n), true, nil
+	case float64:
+		return int64(n), true, nil
+	case bool:
+		if n {
+			return 1, true, nil
+		}
+		return 0, true, nil
+	}
+	s := formatValue(v)
+	if s == "" {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%q is not an integer", s)
+	}
+	return n, true, nil
+}
+
+// toFloat64 converts a database value for a floating point column
+func toFloat64(v interface{}) (float64, bool, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, true, nil
+	case int64:
+		return float64(n), true, nil
+	case int:
+		return float64(n), true, nil
+	}
+	s := formatValue(v)
+	if s == "" {
+		return 0, false, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%q is not a number", s)
+	}
+	return f, true, nil
+}
+
+// ValueText renders a value of a dumped row as text, as the text formats
+// write it
+func ValueText(v interface{}) string {
+	return formatValue(v)
+}
+
+// ValueInt converts a value of a dumped integer column, reporting false for
+// NULL and values that are not integers
+func ValueInt(v interface{}) (int64, bool) {
+	n, ok, err := toInt64(v)
+	return n, ok && err == nil
+}
+
+// formatValue renders a database value as text
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// countingWriter tracks the offset of the next byte written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
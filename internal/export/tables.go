@@ -68,6 +68,7 @@ func (e *Exporter) exportStudies() error {
 			study_accession, study_title, study_type, study_abstract,
 			organism, submission_date, metadata
 		FROM studies
+		ORDER BY study_accession
 	`)
 	if err != nil {
 		return err
@@ -155,6 +156,7 @@ func (e *Exporter) exportSamples() error {
 			sample_accession, description, taxon_id, scientific_name,
 			organism, tissue, cell_type, metadata
 		FROM samples
+		ORDER BY sample_accession
 	`)
 	if err != nil {
 		return err
@@ -263,6 +265,7 @@ func (e *Exporter) exportExperiments() error {
 			es.sample_accession
 		FROM experiments e
 		LEFT JOIN experiment_samples es ON e.experiment_accession = es.experiment_accession
+		ORDER BY e.experiment_accession, es.sample_accession
 	`)
 	if err != nil {
 		return err
@@ -383,6 +386,7 @@ func (e *Exporter) exportRuns() error {
 			r.run_accession, r.experiment_accession,
 			r.total_spots, r.total_bases, r.published, r.metadata
 		FROM runs r
+		ORDER BY r.run_accession
 	`)
 	if err != nil {
 		return err
@@ -0,0 +1,187 @@
+// Package expr evaluates filter expressions written in the Common
+// Expression Language (CEL), such as
+//
+//	taxon_id == 9606 && strategy in ["RNA-Seq", "ATAC-seq"] && total_bases > 1e9
+//
+// Expressions are compiled and run by cel-go with the standard library
+// and the string extensions (lowerAscii, upperAscii, split, ...).
+// Variables have the dynamic type dyn, and ints and doubles compare by
+// value, so a field compares with a number of either type. Expressions
+// have no side effects or access to anything but the variables they are
+// given, and regular expressions use RE2, so evaluating an expression
+// from the command line or a profile is safe.
+//
+// Variables that are declared but not bound evaluate to Unknown. Any
+// operation on Unknown is Unknown, except that && and || use three-valued
+// logic: false && Unknown is false and true || Unknown is true. This lets
+// one expression filter records of different types, each binding only its
+// own fields.
+package expr
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+)
+
+// Vars binds variable names to values. Values may be nil, bool, int,
+// int64, float64, string, []string, []interface{}, map[string]string, or
+// map[string]interface{}.
+type Vars map[string]interface{}
+
+type unknown struct{}
+
+// String implements fmt.Stringer.
+func (unknown) String() string { return "unknown" }
+
+// Unknown is the value of a declared variable the record does not bind.
+var Unknown interface{} = unknown{}
+
+// IsUnknown reports whether v is Unknown.
+func IsUnknown(v interface{}) bool {
+	_, ok := v.(unknown)
+	return ok
+}
+
+// Error reports an expression that cannot be compiled.
+type Error struct {
+	Column  int // 1-based; 0 if the error is not tied to a position
+	Message string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("%s at column %d", e.Message, e.Column)
+	}
+	return e.Message
+}
+
+// Program is a compiled expression.
+type Program struct {
+	source  string
+	env     *cel.Env
+	program cel.Program
+}
+
+// Compile parses and type-checks an expression. If declared is not nil,
+// identifiers that are not in it are rejected, so that a misspelled field
+// is reported up front instead of silently matching nothing; otherwise
+// every identifier in the expression is declared.
+func Compile(source string, declared []string) (*Program, error) {
+	if declared == nil {
+		parser, err := cel.NewEnv()
+		if err != nil {
+			return nil, err
+		}
+		parsed, iss := parser.Parse(source)
+		if iss.Err() != nil {
+			return nil, compileError(iss)
+		}
+		declared = identifiers(parsed)
+	}
+
+	opts := []cel.EnvOption{ext.Strings(), cel.CrossTypeNumericComparisons(true)}
+	for _, name := range declared {
+		opts = append(opts, cel.Variable(name, cel.DynType))
+	}
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		return nil, err
+	}
+	checked, iss := env.Compile(source)
+	if iss.Err() != nil {
+		return nil, compileError(iss)
+	}
+	// Regular expressions with a constant pattern are compiled, and
+	// rejected when invalid, here rather than on each evaluation
+	program, err := env.Program(checked, cel.EvalOptions(cel.OptPartialEval, cel.OptOptimize))
+	if err != nil {
+		return nil, &Error{Message: err.Error()}
+	}
+	return &Program{source: source, env: env, program: program}, nil
+}
+
+// compileError returns the first error of a parse or check
+func compileError(iss *cel.Issues) error {
+	errs := iss.Errors()
+	if len(errs) == 0 {
+		return iss.Err()
+	}
+	return &Error{Column: errs[0].Location.Column() + 1, Message: errs[0].Message}
+}
+
+// identifiers returns the variables a parsed expression refers to,
+// leaving out those bound by macros such as all() and exists()
+func identifiers(parsed *cel.Ast) []string {
+	idents := make(map[string]bool)
+	bound := make(map[string]bool)
+	ast.PreOrderVisit(parsed.NativeRep().Expr(), ast.NewExprVisitor(func(e ast.Expr) {
+		switch e.Kind() {
+		case ast.IdentKind:
+			idents[e.AsIdent()] = true
+		case ast.ComprehensionKind:
+			c := e.AsComprehension()
+			bound[c.IterVar()] = true
+			bound[c.IterVar2()] = true
+			bound[c.AccuVar()] = true
+		}
+	}))
+	names := make([]string, 0, len(idents))
+	for name := range idents {
+		if !bound[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// String returns the source of the expression.
+func (p *Program) String() string {
+	return p.source
+}
+
+// Eval evaluates the expression with the given variables, returning its
+// value as a Go value, or Unknown.
+func (p *Program) Eval(vars Vars) (interface{}, error) {
+	v, err := p.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if types.IsUnknown(v) {
+		return Unknown, nil
+	}
+	return v.Value(), nil
+}
+
+// Matches evaluates a boolean expression. It reports true unless the
+// expression is false, so a record is only rejected by clauses about
+// fields it has. A result that is neither boolean nor Unknown is an error.
+func (p *Program) Matches(vars Vars) (bool, error) {
+	v, err := p.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	switch v := v.(type) {
+	case types.Bool:
+		return bool(v), nil
+	case *types.Unknown:
+		return true, nil
+	default:
+		return false, fmt.Errorf("expression returned %s, not a boolean", v.Type().TypeName())
+	}
+}
+
+func (p *Program) eval(vars Vars) (ref.Val, error) {
+	// Declared variables that vars does not bind are unknown
+	activation, err := p.env.PartialVars(map[string]interface{}(vars))
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := p.program.Eval(activation)
+	return v, err
+}
@@ -0,0 +1,151 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := Vars{
+		"taxon_id":    9606,
+		"strategy":    "RNA-Seq",
+		"total_bases": int64(2_000_000_000),
+		"organism":    "Homo sapiens",
+		"attributes":  map[string]string{"tissue": "liver"},
+		"tags":        []string{"a", "b"},
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{`taxon_id == 9606 && strategy in ["RNA-Seq", "ATAC-seq"] && total_bases > 1e9`, true},
+		{`taxon_id == 10090 || total_bases < 1e9`, false},
+		{`!(taxon_id == 9606)`, false},
+		{`taxon_id == 9606.0 && total_bases >= 2e9`, true},
+		{`taxon_id != 9606 ? "other" : "human"`, "human"},
+		{`1 + 2 * 3 - 4 / 2 % 3`, int64(5)},
+		{`7.0 / 2.0`, 3.5},
+		{`-total_bases < 0`, true},
+		{`"mouse" + 's'`, "mouses"},
+		{`organism.startsWith("Homo") && organism.endsWith("sapiens") && organism.contains("o s")`, true},
+		{`organism.lowerAscii() == "homo sapiens"`, true},
+		{`organism.matches("^Homo [a-z]+$")`, true},
+		{`size(organism) == 12 && tags.size() == 2`, true},
+		{`attributes.tissue == "liver" && attributes["tissue"] == "liver"`, true},
+		{`"tissue" in attributes && !("disease" in attributes)`, true},
+		{`!has(attributes.disease) && has(attributes.tissue)`, true},
+		{`tags[1] == "b"`, true},
+		{`int("42") + 1 == 43 && double("1.5") == 1.5 && string(7) == "7"`, true},
+		{`0x10 == 16 && 1e3 == 1000.0 && .5 == 0.5`, true},
+		{`[1, 2] + [3] == [1, 2, 3]`, true},
+		{`tags.exists(t, t == "b") && tags.all(t, size(t) == 1)`, true},
+		{`organism.split(" ")[0]`, "Homo"},
+	}
+
+	for _, tt := range tests {
+		p, err := Compile(tt.expr, nil)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		got, err := p.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	p, err := Compile(`taxon_id == 9606 && total_bases > 1e9`, []string{"taxon_id", "total_bases"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		vars Vars
+		want bool
+	}{
+		{Vars{"taxon_id": 9606}, true},   // run fields unknown
+		{Vars{"taxon_id": 10090}, false}, // false && unknown
+		{Vars{"total_bases": 5}, false},  // unknown && false
+		{Vars{"total_bases": 5e9}, true}, // sample fields unknown
+		{Vars{}, true},                   // nothing known
+		{Vars{"taxon_id": 9606, "total_bases": 5}, false},
+	}
+	for _, tt := range tests {
+		got, err := p.Matches(tt.vars)
+		if err != nil {
+			t.Errorf("Matches(%v) failed: %v", tt.vars, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Matches(%v) = %v, want %v", tt.vars, got, tt.want)
+		}
+	}
+
+	// true || unknown is true; an unknown condition makes ?: unknown
+	if v, _ := mustCompile(t, `taxon_id == 9606 || total_bases > 0`).Eval(Vars{"taxon_id": 9606}); v != true {
+		t.Errorf("expected true || unknown to be true, got %v", v)
+	}
+	if v, _ := mustCompile(t, `taxon_id == 1 ? 1 : 2`).Eval(Vars{}); !IsUnknown(v) {
+		t.Errorf("expected unknown condition to be unknown, got %v", v)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`taxon == 9606`, `undeclared reference to 'taxon' (in container '') at column 1`},
+		{`taxon_id ==`, "at column 12"},
+		{`taxon_id == 9606)`, "at column 17"},
+		{`"unterminated`, "at column 1"},
+		{`strategy.matches("(")`, "missing closing )"},
+		{`strategy.contains()`, "no matching overload for 'contains'"},
+		{`exec("rm")`, "undeclared reference to 'exec'"},
+		{`1 == "1"`, "no matching overload"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.expr, []string{"taxon_id", "strategy"})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	vars := Vars{"organism": "Homo sapiens", "count": 3, "attributes": map[string]string{}}
+	tests := []string{
+		`organism > 5`,
+		`count / 0 == 1`,
+		`organism - 1`,
+		`attributes.disease == "healthy"`, // no such key
+		`count`,                           // not a boolean
+	}
+	for _, src := range tests {
+		if _, err := mustCompile(t, src).Matches(vars); err == nil {
+			t.Errorf("Matches(%q) succeeded, want an error", src)
+		}
+	}
+
+	// A decided && or || absorbs an error on the other side
+	if ok, err := mustCompile(t, `count == 1 && organism > 5`).Matches(vars); err != nil || ok {
+		t.Errorf("expected false && error to be false, got %v, %v", ok, err)
+	}
+}
+
+func mustCompile(t *testing.T, src string) *Program {
+	t.Helper()
+	p, err := Compile(src, nil)
+	if err != nil {
+		t.Fatalf("Compile(%q) failed: %v", src, err)
+	}
+	return p
+}
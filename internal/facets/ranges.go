@@ -0,0 +1,148 @@
+// Package facets buckets numeric sample attributes, such as age or
+// coverage, into the ranges offered as search facets.
+package facets
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+)
+
+// FieldName is the index field holding the range labels of a document,
+// written attribute:label, e.g. "age:10-20 years".
+const FieldName = "attribute_ranges"
+
+// unitScale converts a unit to the base unit of its quantity
+type unitScale struct {
+	quantity string
+	factor   float64
+}
+
+// units maps the unit spellings found in sample attributes to their
+// quantity and their size in the quantity's base unit
+var units = map[string]unitScale{
+	"year": {"time", 365.25}, "years": {"time", 365.25}, "yr": {"time", 365.25}, "yrs": {"time", 365.25}, "y": {"time", 365.25},
+	"month": {"time", 30.4375}, "months": {"time", 30.4375}, "mo": {"time", 30.4375},
+	"week": {"time", 7}, "weeks": {"time", 7}, "wk": {"time", 7}, "wks": {"time", 7},
+	"day": {"time", 1}, "days": {"time", 1}, "d": {"time", 1},
+	"hour": {"time", 1.0 / 24}, "hours": {"time", 1.0 / 24}, "h": {"time", 1.0 / 24}, "hr": {"time", 1.0 / 24}, "hrs": {"time", 1.0 / 24},
+
+	"x": {"coverage", 1}, "fold": {"coverage", 1},
+
+	"bp": {"length", 1}, "kb": {"length", 1e3}, "mb": {"length", 1e6}, "gb": {"length", 1e9},
+
+	"mg": {"mass", 1e-3}, "g": {"mass", 1}, "kg": {"mass", 1e3},
+}
+
+// leadingNumber splits a value into its leading number and the text after it
+var leadingNumber = regexp.MustCompile(`^([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)\s*(.*)$`)
+
+// Range buckets the values of one attribute.
+type Range struct {
+	Attribute string
+	Units     string
+	Bounds    []float64
+}
+
+// FromConfig returns the ranges of the search configuration, checking that
+// their bounds ascend and their units are known.
+func FromConfig(cfgs []config.AttributeRangeConfig) ([]Range, error) {
+	ranges := make([]Range, 0, len(cfgs))
+	for _, c := range cfgs {
+		r := Range{
+			Attribute: database.NormalizeAttributeTag(c.Attribute),
+			Units:     strings.TrimSpace(c.Units),
+			Bounds:    c.Bounds,
+		}
+		if r.Attribute == "" {
+			return nil, fmt.Errorf("attribute range has no attribute")
+		}
+		if len(r.Bounds) < 2 {
+			return nil, fmt.Errorf("attribute range %s needs at least two bounds", r.Attribute)
+		}
+		for i := 1; i < len(r.Bounds); i++ {
+			if r.Bounds[i] <= r.Bounds[i-1] {
+				return nil, fmt.Errorf("attribute range %s bounds must ascend", r.Attribute)
+			}
+		}
+		if r.Units != "" {
+			if _, ok := lookupUnit(r.Units); !ok {
+				return nil, fmt.Errorf("attribute range %s has unknown units %q", r.Attribute, r.Units)
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// Bucket returns the label of the range holding value, e.g. "10-20 years",
+// or "100+ years" past the last bound. Units come from unit or, failing
+// that, the word after the number in value; values without units are taken
+// to be in the range's units. It reports false for values that are not
+// numbers, have units of another quantity, or fall below the first bound.
+func (r Range) Bucket(value, unit string) (string, bool) {
+	m := leadingNumber.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return "", false
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return "", false
+	}
+	if unit = strings.TrimSpace(unit); unit == "" {
+		if words := strings.Fields(m[2]); len(words) > 0 {
+			unit = words[0] // "52 years old"
+		}
+	}
+
+	if unit != "" && r.Units != "" && !strings.EqualFold(unit, r.Units) {
+		from, ok := lookupUnit(unit)
+		to, _ := lookupUnit(r.Units)
+		if !ok || from.quantity != to.quantity {
+			return "", false
+		}
+		n = n * from.factor / to.factor
+	}
+
+	if n < r.Bounds[0] {
+		return "", false
+	}
+	last := len(r.Bounds) - 1
+	if n >= r.Bounds[last] {
+		return r.label(formatBound(r.Bounds[last]) + "+"), true
+	}
+	for i := 1; i <= last; i++ {
+		if n < r.Bounds[i] {
+			return r.label(formatBound(r.Bounds[i-1]) + "-" + formatBound(r.Bounds[i])), true
+		}
+	}
+	return "", false
+}
+
+// label appends the range's units to a span
+func (r Range) label(span string) string {
+	if r.Units == "" {
+		return span
+	}
+	return span + " " + r.Units
+}
+
+// Term returns the value indexed in FieldName for a bucket label.
+func (r Range) Term(label string) string {
+	return r.Attribute + ":" + label
+}
+
+// lookupUnit finds a unit by its spelling, ignoring case and a trailing dot
+func lookupUnit(unit string) (unitScale, bool) {
+	s, ok := units[strings.TrimSuffix(strings.ToLower(strings.TrimSpace(unit)), ".")]
+	return s, ok
+}
+
+// formatBound writes a bound without trailing zeros
+func formatBound(b float64) string {
+	return strconv.FormatFloat(b, 'f', -1, 64)
+}
@@ -0,0 +1,64 @@
+package facets
+
+import (
+	"testing"
+
+	"github.com/nishad/srake/internal/config"
+)
+
+func TestRangeBucket(t *testing.T) {
+	ranges, err := FromConfig([]config.AttributeRangeConfig{
+		{Attribute: "Age", Units: "years", Bounds: []float64{0, 10, 20, 50}},
+		{Attribute: "coverage", Units: "x", Bounds: []float64{0, 30, 100}},
+	})
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+	age, coverage := ranges[0], ranges[1]
+	if age.Attribute != "age" {
+		t.Errorf("expected the attribute tag to be normalized, got %q", age.Attribute)
+	}
+
+	tests := []struct {
+		r            Range
+		value, units string
+		want         string
+	}{
+		{age, "12", "", "10-20 years"},
+		{age, "12", "years", "10-20 years"},
+		{age, "52 years old", "", "50+ years"},
+		{age, "18", "months", "0-10 years"},
+		{age, "18 months", "", "0-10 years"},
+		{age, "10Y", "", "10-20 years"},
+		{age, "730", "days", "0-10 years"},
+		{age, "adult", "", ""},
+		{age, "12", "kg", ""},
+		{age, "12", "furlongs", ""},
+		{age, "-1", "", ""},
+		{coverage, "45x", "", "30-100 x"},
+		{coverage, "30", "fold", "30-100 x"},
+	}
+	for _, tt := range tests {
+		got, ok := tt.r.Bucket(tt.value, tt.units)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("%s Bucket(%q, %q) = %q, %v; want %q", tt.r.Attribute, tt.value, tt.units, got, ok, tt.want)
+		}
+	}
+
+	if term := age.Term("10-20 years"); term != "age:10-20 years" {
+		t.Errorf("unexpected term %q", term)
+	}
+}
+
+func TestFromConfigRejectsBadRanges(t *testing.T) {
+	for _, cfg := range []config.AttributeRangeConfig{
+		{Attribute: "", Units: "years", Bounds: []float64{0, 10}},
+		{Attribute: "age", Units: "years", Bounds: []float64{10}},
+		{Attribute: "age", Units: "years", Bounds: []float64{10, 10}},
+		{Attribute: "age", Units: "aeons", Bounds: []float64{0, 10}},
+	} {
+		if _, err := FromConfig([]config.AttributeRangeConfig{cfg}); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
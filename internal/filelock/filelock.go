@@ -0,0 +1,198 @@
+// Package filelock provides advisory lock files that keep srake processes
+// from writing the same database or search index at once. Locks are held
+// by the operating system, so a crashed process never leaves a stale lock
+// behind; the lock file only records who holds it for diagnostics.
+package filelock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Suffix is appended to the path of the database or index being locked
+const Suffix = ".lock"
+
+// pollInterval is how often Acquire retries a held lock while waiting
+const pollInterval = 250 * time.Millisecond
+
+// errHeld is returned by the platform lock call when another process holds
+// the lock
+var errHeld = errors.New("lock held")
+
+// Holder describes the process holding a lock.
+type Holder struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host,omitempty"`
+	Command string    `json:"command,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// String returns e.g. "PID 4242 (srake ingest) since 2026-10-16 09:30:00"
+func (h *Holder) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "PID %d", h.PID)
+	if h.Host != "" {
+		if host, _ := os.Hostname(); host != h.Host {
+			fmt.Fprintf(&b, " on %s", h.Host)
+		}
+	}
+	if h.Command != "" {
+		fmt.Fprintf(&b, " (%s)", h.Command)
+	}
+	if !h.Since.IsZero() {
+		fmt.Fprintf(&b, " since %s", h.Since.Local().Format("2006-01-02 15:04:05"))
+	}
+	return b.String()
+}
+
+// LockedError is returned when a lock is held by another process.
+type LockedError struct {
+	Path   string  // the database or index
+	Holder *Holder // nil when the holder has not recorded itself yet
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%s is locked by another process", e.Path)
+	}
+	return fmt.Sprintf("%s is locked by %s", e.Path, e.Holder)
+}
+
+// Lock is a held lock. Release it when done.
+type Lock struct {
+	path string
+	f    *os.File
+}
+
+// Options control Acquire.
+type Options struct {
+	// Command describes the holder to processes that find the lock held,
+	// e.g. "srake ingest"
+	Command string
+
+	// Wait keeps retrying a held lock until it is released or the context
+	// ends, instead of failing at once
+	Wait bool
+
+	// OnWait is called once when Wait finds the lock held
+	OnWait func(err *LockedError)
+}
+
+// Acquire takes the lock on path, a database file or index directory,
+// through the lock file path+Suffix. When another process holds it,
+// Acquire returns a *LockedError, or with opts.Wait waits for it.
+func Acquire(ctx context.Context, path string, opts Options) (*Lock, error) {
+	lockPath := path + Suffix
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	waited := false
+	for {
+		err := lockFile(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errHeld) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		locked := &LockedError{Path: path, Holder: readHolder(f)}
+		if !opts.Wait {
+			f.Close()
+			return nil, locked
+		}
+		if !waited && opts.OnWait != nil {
+			opts.OnWait(locked)
+		}
+		waited = true
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+
+	host, _ := os.Hostname()
+	holder := Holder{PID: os.Getpid(), Host: host, Command: opts.Command, Since: time.Now()}
+	if err := writeHolder(f, &holder); err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return &Lock{path: lockPath, f: f}, nil
+}
+
+// Release clears the holder record and releases the lock. The lock file is
+// left in place: removing it could let two processes lock different files
+// for the same path.
+func (l *Lock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	l.f.Truncate(0)
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
+
+// ReadHolder returns the process recorded in the lock file of path, or nil
+// when the lock file is missing or empty. The record may be left by a
+// process that has since exited; only Acquire tells whether the lock is
+// held.
+func ReadHolder(path string) (*Holder, error) {
+	f, err := os.Open(path + Suffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readHolder(f), nil
+}
+
+// readHolder parses the holder record of an open lock file
+func readHolder(f *os.File) *Holder {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 64*1024))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var h Holder
+	if err := json.Unmarshal(data, &h); err != nil || h.PID == 0 {
+		return nil
+	}
+	return &h
+}
+
+// writeHolder replaces the holder record of a lock file
+func writeHolder(f *os.File, h *Holder) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(append(data, '\n'), 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
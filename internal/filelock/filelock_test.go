@@ -0,0 +1,82 @@
+//go:build unix
+
+package filelock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "SRAmetadb.sqlite")
+
+	first, err := Acquire(context.Background(), path, Options{Command: "srake ingest"})
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	// flock conflicts between separate opens even within one process
+	_, err = Acquire(context.Background(), path, Options{})
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("expected LockedError, got %v", err)
+	}
+	if locked.Holder == nil || locked.Holder.PID != os.Getpid() {
+		t.Fatalf("expected holder PID %d, got %+v", os.Getpid(), locked.Holder)
+	}
+	if msg := locked.Error(); !strings.Contains(msg, "(srake ingest) since") {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if h, err := ReadHolder(path); err != nil || h != nil {
+		t.Errorf("expected no holder after release, got %+v, %v", h, err)
+	}
+
+	second, err := Acquire(context.Background(), path, Options{})
+	if err != nil {
+		t.Fatalf("Acquire after release failed: %v", err)
+	}
+	second.Release()
+}
+
+func TestAcquireWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.bleve")
+
+	first, err := Acquire(context.Background(), path, Options{})
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	waiting := make(chan struct{})
+	go func() {
+		<-waiting
+		time.Sleep(50 * time.Millisecond)
+		first.Release()
+	}()
+
+	second, err := Acquire(context.Background(), path, Options{
+		Wait:   true,
+		OnWait: func(*LockedError) { close(waiting) },
+	})
+	if err != nil {
+		t.Fatalf("waiting Acquire failed: %v", err)
+	}
+	second.Release()
+
+	// A cancelled wait gives up
+	third, _ := Acquire(context.Background(), path, Options{})
+	defer third.Release()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, path, Options{Wait: true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
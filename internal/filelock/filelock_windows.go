@@ -0,0 +1,52 @@
+//go:build windows
+
+package filelock
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+
+	errorLockViolation syscall.Errno = 33
+	errorIOPending     syscall.Errno = 997
+)
+
+// lockOffsetHigh places the locked byte far past the holder record, since
+// Windows locks are mandatory and would otherwise keep other processes
+// from reading who holds the lock
+const lockOffsetHigh = 0x7fffffff
+
+// lockFile takes an exclusive lock on f without blocking. The lock is
+// released by Windows when the process exits.
+func lockFile(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: lockOffsetHigh}
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r != 0 {
+		return nil
+	}
+	if errors.Is(err, errorLockViolation) || errors.Is(err, errorIOPending) {
+		return errHeld
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: lockOffsetHigh}
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package i18n translates user-facing CLI messages such as progress lines,
+// ingest summaries and error hints.
+//
+// The locale is chosen from SRAKE_LANG, then the POSIX LC_ALL, LC_MESSAGES
+// and LANG variables, so "ja_JP.UTF-8" selects Japanese. Messages missing
+// from a locale's catalog fall back to English.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultLocale is used when no supported locale is configured
+const DefaultLocale = "en"
+
+// localeEnv are the variables consulted for the locale, in order
+var localeEnv = []string{"SRAKE_LANG", "LC_ALL", "LC_MESSAGES", "LANG"}
+
+// catalogs maps a locale to its messages, keyed by message ID
+var catalogs = map[string]map[string]string{
+	"en": english,
+	"ja": japanese,
+}
+
+var (
+	mu       sync.RWMutex
+	current  string
+	detected sync.Once
+)
+
+// Locales returns the supported locales
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Locale returns the current locale, detecting it from the environment on
+// first use
+func Locale() string {
+	detected.Do(func() {
+		mu.Lock()
+		if current == "" {
+			current = DetectLocale()
+		}
+		mu.Unlock()
+	})
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// SetLocale overrides the detected locale. Unsupported locales select
+// English.
+func SetLocale(tag string) {
+	detected.Do(func() {})
+	mu.Lock()
+	defer mu.Unlock()
+	if locale, ok := normalize(tag); ok {
+		current = locale
+	} else {
+		current = DefaultLocale
+	}
+}
+
+// DetectLocale returns the first supported locale named by the
+// environment, or English
+func DetectLocale() string {
+	for _, name := range localeEnv {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		// An explicit but unsupported setting, such as LC_ALL=C, stops the
+		// search just as it would for other programs
+		if locale, ok := normalize(value); ok {
+			return locale
+		}
+		return DefaultLocale
+	}
+	return DefaultLocale
+}
+
+// normalize reduces a locale such as "ja_JP.UTF-8" or "ja-JP" to a
+// supported catalog name
+func normalize(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, ".@"); i >= 0 {
+		tag = tag[:i]
+	}
+	if i := strings.IndexAny(tag, "_-"); i >= 0 {
+		tag = tag[:i]
+	}
+	_, ok := catalogs[tag]
+	return tag, ok
+}
+
+// T returns the message with the given ID in the current locale, formatted
+// with args as by fmt.Sprintf. Unknown IDs are returned unchanged.
+func T(id string, args ...interface{}) string {
+	format, ok := catalogs[Locale()][id]
+	if !ok {
+		if format, ok = english[id]; !ok {
+			format = id
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Pad right-pads s with spaces to width terminal columns, counting wide
+// characters such as kana and kanji as two columns
+func Pad(s string, width int) string {
+	if w := Width(s); w < width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	return s
+}
+
+// Width returns the number of terminal columns s occupies
+func Width(s string) int {
+	width := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		if isWide(r) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// isWide reports whether r is an East Asian wide or fullwidth character
+func isWide(r rune) bool {
+	switch {
+	case r >= 0x1100 && r <= 0x115F, // Hangul Jamo
+		r >= 0x2E80 && r <= 0x303E, // CJK radicals and punctuation
+		r >= 0x3041 && r <= 0x33FF, // Kana and CJK compatibility
+		r >= 0x3400 && r <= 0x4DBF, // CJK extension A
+		r >= 0x4E00 && r <= 0x9FFF, // CJK unified ideographs
+		r >= 0xAC00 && r <= 0xD7A3, // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF, // CJK compatibility ideographs
+		r >= 0xFF00 && r <= 0xFF60, // Fullwidth forms
+		r >= 0xFFE0 && r <= 0xFFE6:
+		return true
+	}
+	return false
+}
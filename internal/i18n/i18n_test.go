@@ -0,0 +1,101 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectLocale(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"unset", nil, "en"},
+		{"LANG", map[string]string{"LANG": "ja_JP.UTF-8"}, "ja"},
+		{"SRAKE_LANG wins", map[string]string{"SRAKE_LANG": "en", "LANG": "ja_JP.UTF-8"}, "en"},
+		{"LC_ALL over LANG", map[string]string{"LC_ALL": "ja-JP", "LANG": "en_US.UTF-8"}, "ja"},
+		{"unsupported stops search", map[string]string{"LC_ALL": "C", "LANG": "ja_JP.UTF-8"}, "en"},
+		{"unsupported language", map[string]string{"LANG": "de_DE.UTF-8"}, "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range localeEnv {
+				t.Setenv(name, tt.env[name])
+			}
+			if got := DetectLocale(); got != tt.want {
+				t.Errorf("DetectLocale() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestT(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+
+	SetLocale("ja_JP.UTF-8")
+	if Locale() != "ja" {
+		t.Fatalf("Locale() = %q, want ja", Locale())
+	}
+	if got := T("ingest.retrying", "5s", 1, 3); got != "5s 後に再試行します (1/3 回目)..." {
+		t.Errorf("unexpected Japanese message: %q", got)
+	}
+
+	SetLocale("fr")
+	if got := T("ingest.retrying", "5s", 1, 3); got != "Retrying in 5s (attempt 1/3)..." {
+		t.Errorf("unexpected fallback message: %q", got)
+	}
+	if got := T("no.such.message"); got != "no.such.message" {
+		t.Errorf("unknown IDs should be returned unchanged, got %q", got)
+	}
+}
+
+// TestCatalogs checks that every translation has an English original with
+// the same formatting verbs
+func TestCatalogs(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for id, message := range catalog {
+			original, ok := english[id]
+			if !ok {
+				t.Errorf("%s: %q has no English message", locale, id)
+				continue
+			}
+			if verbs(message) != verbs(original) {
+				t.Errorf("%s: %q has verbs %q, English has %q", locale, id, verbs(message), verbs(original))
+			}
+		}
+	}
+}
+
+// verbs returns the formatting verbs in a message, in order
+func verbs(message string) string {
+	var found []string
+	for i := 0; i < len(message)-1; i++ {
+		if message[i] == '%' {
+			found = append(found, message[i:i+2])
+			i++
+		}
+	}
+	return strings.Join(found, " ")
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"Runs:", 8, "Runs:   "},
+		{"ラン:", 8, "ラン:   "},
+		{"データベース:", 8, "データベース:"},
+	}
+	for _, tt := range tests {
+		if got := Pad(tt.s, tt.width); got != tt.want {
+			t.Errorf("Pad(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+	if Width("処理量:") != 7 {
+		t.Errorf("Width(%q) = %d, want 7", "処理量:", Width("処理量:"))
+	}
+}
@@ -0,0 +1,180 @@
+package i18n
+
+// english is the reference catalog; every message ID must be defined here
+var english = map[string]string{
+	// Ingest progress
+	"ingest.starting":          "Starting ingestion...",
+	"ingest.starting_filtered": "Starting filtered ingestion...",
+	"ingest.may_take_a_while":  "This may take a while for large files.",
+	"ingest.press_ctrl_c":      "Press Ctrl+C to cancel.",
+	"ingest.cancelled":         "Ingestion cancelled",
+	"ingest.cancelled_by_user": "Ingestion cancelled by user",
+	"ingest.completed":         "Ingestion completed successfully!",
+	"ingest.interrupted":       "Ingestion interrupted by a %s error: %v",
+	"ingest.retrying":          "Retrying in %s (attempt %d/%d)...",
+	"ingest.db_has_data":       "Database already contains data:",
+	"ingest.use_force":         "Use --force to overwrite existing data",
+	"ingest.updating_stats":    "Updating database statistics...",
+	"ingest.stats_failed":      "Warning: Failed to update statistics: %v",
+	"ingest.sketches_failed":   "Warning: Failed to save count sketches: %v",
+	"ingest.lock_waiting":      "%v; waiting for it to finish...",
+	"ingest.lock_hint":         "Rerun with --wait to start once it finishes.",
+	"ingest.downloading":       "Downloading over %d connections...",
+	"ingest.metrics_serving":   "Serving metrics at http://%s/metrics",
+	"ingest.metrics_push":      "Warning: Failed to push metrics: %v",
+	"ingest.analyzing":         "Analyzing the database for the query planner...",
+	"ingest.vacuuming":         "Vacuuming the database to reclaim %s...",
+	"ingest.vacuumed":          "%s → %s",
+	"ingest.optimize_failed":   "Warning: Failed to optimize the database: %v",
+	"ingest.bulk_finishing":    "Merging staged records and rebuilding indexes...",
+	"ingest.expect_failed":     "Warning: Failed to reconcile expected records: %v",
+	"ingest.quarantine_failed": "Warning: Failed to summarize quarantined records: %v",
+
+	// Progress bar
+	"progress.calculating": "calculating...",
+	"progress.eta":         "ETA",
+	"progress.records":     "Records",
+	"progress.done":        "Done",
+
+	// Summaries
+	"summary.statistics":         "Statistics:",
+	"summary.time_elapsed":       "Time elapsed:",
+	"summary.duration":           "Duration:",
+	"summary.records_processed":  "Records processed:",
+	"summary.bytes_processed":    "Bytes processed:",
+	"summary.processed":          "Processed:",
+	"summary.speed":              "Speed:",
+	"summary.records_per_second": "Records/second:",
+	"summary.records":            "Records:",
+	"summary.database":           "Database:",
+	"summary.database_totals":    "Database totals:",
+	"summary.database_contents":  "Database Contents:",
+	"summary.studies":            "Studies:",
+	"summary.experiments":        "Experiments:",
+	"summary.samples":            "Samples:",
+	"summary.runs":               "Runs:",
+	"summary.next_steps":         "Next steps:",
+	"summary.next_search":        "Search records: srake search 'your query'",
+	"summary.next_server":        "Start API server: srake server",
+	"summary.next_db_info":       "View database info: srake db info",
+	"summary.bulk_phases":        "Bulk load phases:",
+	"summary.bulk_prepare":       "Prepare:",
+	"summary.bulk_load":          "Load:",
+	"summary.bulk_merge":         "Merge:",
+	"summary.bulk_index":         "Rebuild indexes:",
+	"summary.bulk_sample_runs":   "Sample runs:",
+	"summary.expected_appeared":  "Expected records now public: %d",
+	"summary.expected_more":      "... and %d more (list them with srake expect status)",
+	"summary.expected_pending":   "Still pending: %d (list them with srake expect status --pending)",
+	"summary.validation_passed":  "Every record passed validation",
+	"summary.quarantined":        "Records quarantined for failing validation: %d",
+	"summary.quarantine_hint":    "Inspect them with srake quarantine",
+
+	// Estimates before an ingest
+	"estimate.measured":       "Estimate, from %d earlier ingest(s):",
+	"estimate.defaults":       "Rough estimate (no earlier ingest measured yet):",
+	"estimate.records":        "Records:",
+	"estimate.database":       "Database:",
+	"estimate.index":          "Index:",
+	"estimate.time":           "Time:",
+	"estimate.free":           "Free:",
+	"estimate.free_on":        "%s on %s",
+	"estimate.filtered":       "Filters keep only part of the records, so less will be stored.",
+	"estimate.no_space":       "The database and index are estimated to need %s, more than the %s free",
+	"estimate.measure_failed": "Warning: Failed to record the size of the ingest: %v",
+
+	// Error hints
+	"hint.network":       "The connection to the server failed. This is usually temporary; try again later or check your network.",
+	"hint.remote":        "The server rejected the request. Check that the URL or file name exists.",
+	"hint.decompression": "The archive is corrupt or truncated. Delete any partial download and fetch it again.",
+	"hint.parse":         "The XML could not be parsed. The file may not contain SRA metadata.",
+	"hint.constraint":    "A record conflicts with data already in the database. Try a fresh database with --db.",
+	"hint.disk_full":     "The disk is full. Free some space, or move the database with --db or SRAKE_DB_PATH.",
+}
+
+// japanese covers the messages DDBJ users see during ingest
+var japanese = map[string]string{
+	"ingest.starting":          "取り込みを開始しています...",
+	"ingest.starting_filtered": "フィルタ付きの取り込みを開始しています...",
+	"ingest.may_take_a_while":  "大きなファイルでは時間がかかることがあります。",
+	"ingest.press_ctrl_c":      "Ctrl+C でキャンセルできます。",
+	"ingest.cancelled":         "取り込みをキャンセルしました",
+	"ingest.cancelled_by_user": "ユーザーが取り込みをキャンセルしました",
+	"ingest.completed":         "取り込みが完了しました！",
+	"ingest.interrupted":       "%s エラーにより取り込みが中断されました: %v",
+	"ingest.retrying":          "%s 後に再試行します (%d/%d 回目)...",
+	"ingest.db_has_data":       "データベースには既にデータがあります:",
+	"ingest.use_force":         "既存のデータを上書きするには --force を指定してください",
+	"ingest.updating_stats":    "データベースの統計情報を更新しています...",
+	"ingest.stats_failed":      "警告: 統計情報を更新できませんでした: %v",
+	"ingest.sketches_failed":   "警告: 件数スケッチを保存できませんでした: %v",
+	"ingest.lock_waiting":      "%v; 終了を待っています...",
+	"ingest.lock_hint":         "終了後に開始するには --wait を付けて再実行してください。",
+	"ingest.downloading":       "%d 本の接続でダウンロードしています...",
+	"ingest.metrics_serving":   "http://%s/metrics でメトリクスを公開しています",
+	"ingest.metrics_push":      "警告: メトリクスを送信できませんでした: %v",
+	"ingest.analyzing":         "クエリプランナー用にデータベースを分析しています...",
+	"ingest.vacuuming":         "データベースをバキュームして %s を解放しています...",
+	"ingest.vacuumed":          "%s → %s",
+	"ingest.optimize_failed":   "警告: データベースを最適化できませんでした: %v",
+	"ingest.bulk_finishing":    "ステージングしたレコードを統合し、インデックスを再構築しています...",
+	"ingest.expect_failed":     "警告: 予定レコードを照合できませんでした: %v",
+	"ingest.quarantine_failed": "警告: 隔離したレコードを集計できませんでした: %v",
+
+	"progress.calculating": "計算中...",
+	"progress.eta":         "残り",
+	"progress.records":     "レコード",
+	"progress.done":        "完了",
+
+	"summary.statistics":         "統計:",
+	"summary.time_elapsed":       "経過時間:",
+	"summary.duration":           "所要時間:",
+	"summary.records_processed":  "処理レコード数:",
+	"summary.bytes_processed":    "処理バイト数:",
+	"summary.processed":          "処理量:",
+	"summary.speed":              "速度:",
+	"summary.records_per_second": "レコード/秒:",
+	"summary.records":            "レコード数:",
+	"summary.database":           "データベース:",
+	"summary.database_totals":    "データベースの合計:",
+	"summary.database_contents":  "データベースの内容:",
+	"summary.studies":            "スタディ:",
+	"summary.experiments":        "実験:",
+	"summary.samples":            "サンプル:",
+	"summary.runs":               "ラン:",
+	"summary.next_steps":         "次のステップ:",
+	"summary.next_search":        "レコードを検索: srake search 'クエリ'",
+	"summary.next_server":        "API サーバーを起動: srake server",
+	"summary.next_db_info":       "データベース情報を表示: srake db info",
+	"summary.bulk_phases":        "一括読み込みの各段階:",
+	"summary.bulk_prepare":       "準備:",
+	"summary.bulk_load":          "読み込み:",
+	"summary.bulk_merge":         "統合:",
+	"summary.bulk_index":         "インデックス再構築:",
+	"summary.bulk_sample_runs":   "サンプルとラン:",
+	"summary.expected_appeared":  "公開された予定レコード: %d",
+	"summary.expected_more":      "... ほか %d 件 (srake expect status で一覧表示)",
+	"summary.expected_pending":   "未公開: %d (srake expect status --pending で一覧表示)",
+	"summary.validation_passed":  "すべてのレコードが検証に合格しました",
+	"summary.quarantined":        "検証に失敗して隔離したレコード: %d",
+	"summary.quarantine_hint":    "srake quarantine で確認できます",
+
+	"estimate.measured":       "見積もり (過去 %d 回の取り込みから):",
+	"estimate.defaults":       "概算 (計測済みの取り込みはまだありません):",
+	"estimate.records":        "レコード:",
+	"estimate.database":       "データベース:",
+	"estimate.index":          "インデックス:",
+	"estimate.time":           "所要時間:",
+	"estimate.free":           "空き容量:",
+	"estimate.free_on":        "%s (%s)",
+	"estimate.filtered":       "フィルタによって一部のレコードのみが保存されるため、実際の容量は少なくなります。",
+	"estimate.no_space":       "データベースとインデックスに %s 必要と見積もられますが、空き容量は %s です",
+	"estimate.measure_failed": "警告: 取り込みのサイズを記録できませんでした: %v",
+
+	"hint.network":       "サーバーに接続できませんでした。通常は一時的な問題です。しばらくしてから再試行するか、ネットワークを確認してください。",
+	"hint.remote":        "サーバーがリクエストを拒否しました。URL またはファイル名が存在するか確認してください。",
+	"hint.decompression": "アーカイブが破損しているか、途中で切れています。部分的にダウンロードしたファイルを削除し、再取得してください。",
+	"hint.parse":         "XML を解析できませんでした。ファイルに SRA メタデータが含まれていない可能性があります。",
+	"hint.constraint":    "レコードがデータベース内の既存データと競合しています。--db で新しいデータベースを指定してください。",
+	"hint.disk_full":     "ディスクの空き容量がありません。容量を確保するか、--db または SRAKE_DB_PATH でデータベースを移動してください。",
+}
@@ -0,0 +1,296 @@
+// Package jsonpatch implements RFC 6902 JSON Patch over generic JSON documents
+// decoded with encoding/json (maps, slices, and scalar values).
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Operation is a single RFC 6902 patch operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is an ordered list of operations applied atomically.
+type Patch []Operation
+
+// Decode parses a JSON Patch document.
+func Decode(data []byte) (Patch, error) {
+	var p Patch
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+	return p, nil
+}
+
+// Apply applies the patch to doc and returns the patched document.
+// The input document is not modified; if any operation fails the
+// whole patch is rejected.
+func (p Patch) Apply(doc interface{}) (interface{}, error) {
+	// Work on a deep copy so a failing operation leaves doc untouched
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	for i, op := range p {
+		out, err = op.apply(out)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return out, nil
+}
+
+func (op Operation) apply(doc interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "remove":
+		doc, _, err := remove(doc, op.Path)
+		return doc, err
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		doc, _, err = remove(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "move":
+		if op.Path == op.From || strings.HasPrefix(op.Path, op.From+"/") {
+			if op.Path == op.From {
+				return doc, nil
+			}
+			return nil, fmt.Errorf("cannot move a value into one of its children")
+		}
+		doc, value, err := remove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "copy":
+		value, err := get(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err = deepCopy(value)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "test":
+		want, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := get(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+func (op Operation) value() (interface{}, error) {
+	if len(op.Value) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+	var v interface{}
+	if err := json.Unmarshal(op.Value, &v); err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+	return v, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		t = strings.ReplaceAll(t, "~1", "/")
+		tokens[i] = strings.ReplaceAll(t, "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if idx > max {
+		return 0, fmt.Errorf("array index %d out of range", idx)
+	}
+	return idx, nil
+}
+
+func get(doc interface{}, path string) (interface{}, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := doc
+	for _, t := range tokens {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[t]
+			if !ok {
+				return nil, fmt.Errorf("path %q not found", path)
+			}
+			cur = v
+		case []interface{}:
+			idx, err := arrayIndex(t, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			cur = node[idx]
+		default:
+			return nil, fmt.Errorf("path %q not found", path)
+		}
+	}
+	return cur, nil
+}
+
+// add inserts value at path, returning the (possibly new) root document.
+func add(doc interface{}, path string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return update(doc, tokens, func(parent interface{}, last string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[last] = value
+			return node, nil
+		case []interface{}:
+			idx, err := arrayIndex(last, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot add to non-container at %q", path)
+		}
+	})
+}
+
+// remove deletes the value at path and returns the new root and the removed value.
+func remove(doc interface{}, path string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	var removed interface{}
+	doc, err = update(doc, tokens, func(parent interface{}, last string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			v, ok := node[last]
+			if !ok {
+				return nil, fmt.Errorf("path %q not found", path)
+			}
+			removed = v
+			delete(node, last)
+			return node, nil
+		case []interface{}:
+			idx, err := arrayIndex(last, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[idx]
+			return append(node[:idx], node[idx+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path %q not found", path)
+		}
+	})
+	return doc, removed, err
+}
+
+// update walks to the parent of the final token and replaces it with the
+// result of fn. Slices are re-assigned into their parent since append may
+// reallocate them.
+func update(node interface{}, tokens []string, fn func(parent interface{}, last string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	t := tokens[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[t]
+		if !ok {
+			return nil, fmt.Errorf("path segment %q not found", t)
+		}
+		updated, err := update(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[t] = updated
+		return n, nil
+	case []interface{}:
+		idx, err := arrayIndex(t, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := update(n[idx], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("path segment %q not found", t)
+	}
+}
+
+func deepCopy(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(raw, &out)
+	return out, err
+}
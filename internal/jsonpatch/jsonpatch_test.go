@@ -0,0 +1,140 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeDoc(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("failed to decode %s: %v", s, err)
+	}
+	return v
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "add field",
+			doc:   `{"notes":"a"}`,
+			patch: `[{"op":"add","path":"/curated_title","value":"T"}]`,
+			want:  `{"notes":"a","curated_title":"T"}`,
+		},
+		{
+			name:  "append to array",
+			doc:   `{"tags":["x"]}`,
+			patch: `[{"op":"add","path":"/tags/-","value":"y"}]`,
+			want:  `{"tags":["x","y"]}`,
+		},
+		{
+			name:  "insert into array",
+			doc:   `{"tags":["x","z"]}`,
+			patch: `[{"op":"add","path":"/tags/1","value":"y"}]`,
+			want:  `{"tags":["x","y","z"]}`,
+		},
+		{
+			name:  "remove array element",
+			doc:   `{"tags":["x","y","z"]}`,
+			patch: `[{"op":"remove","path":"/tags/1"}]`,
+			want:  `{"tags":["x","z"]}`,
+		},
+		{
+			name:  "replace field",
+			doc:   `{"notes":"old"}`,
+			patch: `[{"op":"replace","path":"/notes","value":"new"}]`,
+			want:  `{"notes":"new"}`,
+		},
+		{
+			name:  "move field",
+			doc:   `{"notes":"n"}`,
+			patch: `[{"op":"move","from":"/notes","path":"/curated_title"}]`,
+			want:  `{"curated_title":"n"}`,
+		},
+		{
+			name:  "copy field",
+			doc:   `{"notes":"n"}`,
+			patch: `[{"op":"copy","from":"/notes","path":"/curated_title"}]`,
+			want:  `{"notes":"n","curated_title":"n"}`,
+		},
+		{
+			name:  "test then replace",
+			doc:   `{"notes":"n"}`,
+			patch: `[{"op":"test","path":"/notes","value":"n"},{"op":"replace","path":"/notes","value":"m"}]`,
+			want:  `{"notes":"m"}`,
+		},
+		{
+			name:  "escaped pointer",
+			doc:   `{"a/b":1,"c~d":2}`,
+			patch: `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/c~0d"}]`,
+			want:  `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Decode([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			got, err := p.Apply(decodeDoc(t, tt.doc))
+			if err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if want := decodeDoc(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+	}{
+		{"failed test", `{"notes":"n"}`, `[{"op":"test","path":"/notes","value":"x"}]`},
+		{"remove missing", `{}`, `[{"op":"remove","path":"/notes"}]`},
+		{"replace missing", `{}`, `[{"op":"replace","path":"/notes","value":"x"}]`},
+		{"index out of range", `{"tags":[]}`, `[{"op":"add","path":"/tags/2","value":"x"}]`},
+		{"leading zero index", `{"tags":["a","b"]}`, `[{"op":"remove","path":"/tags/01"}]`},
+		{"unknown op", `{}`, `[{"op":"merge","path":"/notes","value":"x"}]`},
+		{"missing value", `{}`, `[{"op":"add","path":"/notes"}]`},
+		{"bad pointer", `{}`, `[{"op":"add","path":"notes","value":"x"}]`},
+		{"move into child", `{"a":{}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Decode([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if _, err := p.Apply(decodeDoc(t, tt.doc)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	doc := map[string]interface{}{"notes": "keep"}
+	p, err := Decode([]byte(`[{"op":"replace","path":"/notes","value":"changed"},{"op":"remove","path":"/missing"}]`))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if _, err := p.Apply(doc); err == nil {
+		t.Fatal("expected error")
+	}
+	if doc["notes"] != "keep" {
+		t.Errorf("input document was modified: %v", doc)
+	}
+}
@@ -0,0 +1,32 @@
+// Package metrics serves metrics registered with the Prometheus client,
+// along with those of the Go runtime and the process, for scraping from
+// /metrics, and pushes them to a Pushgateway.
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Handler serves the metrics of r, with the Go runtime and process metrics,
+// in the format the scraper asks for.
+func Handler(r *prometheus.Registry) http.Handler {
+	runtime := prometheus.NewRegistry()
+	runtime.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return promhttp.HandlerFor(prometheus.Gatherers{r, runtime}, promhttp.HandlerOpts{})
+}
+
+// Push replaces the metrics of job on the Pushgateway at gateway with the
+// metrics of r. Runtime metrics are not pushed, since they would describe
+// the pushing process long after it exits.
+func Push(ctx context.Context, client *http.Client, gateway, job string, r prometheus.Gatherer) error {
+	return push.New(gateway, job).Client(client).Gatherer(r).PushContext(ctx)
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandler(t *testing.T) {
+	r := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "srake_http_requests_total", Help: "Requests served",
+	}, []string{"route", "status"})
+	r.MustRegister(requests)
+	requests.WithLabelValues("/api/v1/search", "200").Add(3)
+
+	w := httptest.NewRecorder()
+	Handler(r).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected a text response, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"# TYPE srake_http_requests_total counter",
+		`srake_http_requests_total{route="/api/v1/search",status="200"} 3`,
+		"go_goroutines ",
+		"process_start_time_seconds ",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected %s in:\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	r := prometheus.NewRegistry()
+	records := prometheus.NewCounter(prometheus.CounterOpts{Name: "srake_ingest_records_total", Help: "Records ingested"})
+	r.MustRegister(records)
+	records.Add(42)
+	if err := Push(context.Background(), server.Client(), server.URL+"/", "srake_ingest", r); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/srake_ingest" {
+		t.Errorf("unexpected request %s %s", method, path)
+	}
+	// The body is in the protobuf format; the metric name is readable in it
+	if !strings.Contains(body, "srake_ingest_records_total") || strings.Contains(body, "go_goroutines") {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -0,0 +1,219 @@
+package oaipmh
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/packaging"
+)
+
+// Metadata format identifiers
+const (
+	prefixDC  = "oai_dc"
+	prefixSRA = "sra"
+
+	dcNamespace        = "http://purl.org/dc/elements/1.1/"
+	oaiDCNamespace     = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	oaiDCSchema        = "http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+	sraNamespace       = "https://github.com/nishad/srake/oai/sra/"
+	sraSchemaPath      = "/sra.xsd"
+	sraRepositoryName  = "NCBI Sequence Read Archive"
+	sraRecordURLPrefix = "https://www.ncbi.nlm.nih.gov/sra/"
+)
+
+// metadataFormatDef is a metadata format the provider can disseminate.
+type metadataFormatDef struct {
+	prefix    string
+	schema    string
+	namespace string
+	render    func(d *recordData) interface{}
+}
+
+// recordData is what a metadata format renders for one study.
+type recordData struct {
+	study   *database.Study
+	summary *database.HarvestSummary
+	header  *database.HarvestRecord
+	catalog packaging.Catalog
+	schema  string
+}
+
+// formats lists the supported metadata formats. The SRA format schema is
+// served by the provider itself, next to its base URL.
+func (p *Provider) formats(base string) []metadataFormatDef {
+	return []metadataFormatDef{
+		{prefix: prefixDC, schema: oaiDCSchema, namespace: oaiDCNamespace, render: renderDC},
+		{prefix: prefixSRA, schema: strings.TrimRight(base, "/") + sraSchemaPath, namespace: sraNamespace, render: renderSRA},
+	}
+}
+
+// format looks up a metadata format by prefix.
+func (p *Provider) format(base, prefix string) (metadataFormatDef, bool) {
+	for _, f := range p.formats(base) {
+		if f.prefix == prefix {
+			return f, true
+		}
+	}
+	return metadataFormatDef{}, false
+}
+
+// dublinCore is an oai_dc record.
+type dublinCore struct {
+	XMLName        xml.Name `xml:"oai_dc:dc"`
+	OAIDC          string   `xml:"xmlns:oai_dc,attr"`
+	DC             string   `xml:"xmlns:dc,attr"`
+	XSI            string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+
+	Title       []string `xml:"dc:title"`
+	Creator     []string `xml:"dc:creator"`
+	Subject     []string `xml:"dc:subject"`
+	Description []string `xml:"dc:description"`
+	Publisher   []string `xml:"dc:publisher"`
+	Date        []string `xml:"dc:date"`
+	Type        []string `xml:"dc:type"`
+	Identifier  []string `xml:"dc:identifier"`
+	Relation    []string `xml:"dc:relation"`
+	Rights      []string `xml:"dc:rights"`
+}
+
+func renderDC(d *recordData) interface{} {
+	study := d.study
+	dc := &dublinCore{
+		OAIDC:          oaiDCNamespace,
+		DC:             dcNamespace,
+		XSI:            xsiNamespace,
+		SchemaLocation: oaiDCNamespace + " " + oaiDCSchema,
+		Title:          []string{packaging.StudyTitle(study)},
+		Type:           []string{"Dataset"},
+		Identifier:     []string{study.StudyAccession},
+		Subject:        subjects(study, d.summary),
+	}
+
+	url := d.catalog.StudyURL(study.StudyAccession)
+	dc.Identifier = append(dc.Identifier, url)
+	if sraURL := sraRecordURLPrefix + study.StudyAccession; sraURL != url {
+		dc.Relation = append(dc.Relation, sraURL)
+	}
+
+	if center := packaging.StudyCenter(study); center != "" {
+		dc.Creator = append(dc.Creator, center)
+	}
+	if desc := packaging.StudyDescription(study); desc != "" {
+		dc.Description = append(dc.Description, desc)
+	}
+	if publisher := d.catalog.PublisherName; publisher != "" {
+		dc.Publisher = append(dc.Publisher, publisher)
+	} else {
+		dc.Publisher = append(dc.Publisher, sraRepositoryName)
+	}
+	if study.SubmissionDate != nil {
+		dc.Date = append(dc.Date, study.SubmissionDate.Format(dateLayout))
+	}
+	if license := d.catalog.License; license != "" {
+		dc.Rights = append(dc.Rights, license)
+	}
+	return dc
+}
+
+// sraStudy is a record in the srake SRA format.
+type sraStudy struct {
+	XMLName        xml.Name `xml:"sra:study"`
+	SRA            string   `xml:"xmlns:sra,attr"`
+	XSI            string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Accession      string   `xml:"accession,attr"`
+
+	Title          string          `xml:"sra:title"`
+	CuratedTitle   string          `xml:"sra:curatedTitle,omitempty"`
+	Abstract       string          `xml:"sra:abstract,omitempty"`
+	StudyType      string          `xml:"sra:studyType,omitempty"`
+	CenterName     string          `xml:"sra:centerName,omitempty"`
+	SubmissionDate string          `xml:"sra:submissionDate,omitempty"`
+	URL            string          `xml:"sra:url"`
+	Organisms      []string        `xml:"sra:organism"`
+	Tags           []string        `xml:"sra:tag"`
+	Notes          string          `xml:"sra:notes,omitempty"`
+	Collections    []string        `xml:"sra:collection"`
+	SampleCount    int             `xml:"sra:sampleCount"`
+	RunCount       int             `xml:"sra:runCount"`
+	Experiments    []sraExperiment `xml:"sra:experiment"`
+}
+
+type sraExperiment struct {
+	Accession       string `xml:"accession,attr"`
+	Title           string `xml:"sra:title,omitempty"`
+	LibraryStrategy string `xml:"sra:libraryStrategy,omitempty"`
+	LibrarySource   string `xml:"sra:librarySource,omitempty"`
+	Platform        string `xml:"sra:platform,omitempty"`
+	InstrumentModel string `xml:"sra:instrumentModel,omitempty"`
+}
+
+func renderSRA(d *recordData) interface{} {
+	study, summary := d.study, d.summary
+	rec := &sraStudy{
+		SRA:            sraNamespace,
+		XSI:            xsiNamespace,
+		SchemaLocation: sraNamespace + " " + d.schema,
+		Accession:      study.StudyAccession,
+		Title:          study.StudyTitle,
+		Abstract:       packaging.StudyDescription(study),
+		StudyType:      study.StudyType,
+		CenterName:     packaging.StudyCenter(study),
+		URL:            d.catalog.StudyURL(study.StudyAccession),
+		Organisms:      summary.Organisms,
+		Collections:    d.header.Collections,
+		SampleCount:    summary.SampleCount,
+		RunCount:       summary.RunCount,
+	}
+	if study.SubmissionDate != nil {
+		rec.SubmissionDate = study.SubmissionDate.Format(dateLayout)
+	}
+	if len(rec.Organisms) == 0 && study.Organism != "" {
+		rec.Organisms = []string{study.Organism}
+	}
+	if c := study.Curation; c != nil {
+		rec.CuratedTitle = c.CuratedTitle
+		rec.Tags = c.Tags
+		rec.Notes = c.Notes
+	}
+	for _, e := range summary.Experiments {
+		rec.Experiments = append(rec.Experiments, sraExperiment{
+			Accession:       e.ExperimentAccession,
+			Title:           e.Title,
+			LibraryStrategy: e.LibraryStrategy,
+			LibrarySource:   e.LibrarySource,
+			Platform:        e.Platform,
+			InstrumentModel: e.InstrumentModel,
+		})
+	}
+	return rec
+}
+
+// subjects collects organisms, sequencing strategies, the study type, and
+// curated tags as Dublin Core subjects.
+func subjects(study *database.Study, summary *database.HarvestSummary) []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(v string) {
+		if v != "" && !seen[strings.ToLower(v)] {
+			seen[strings.ToLower(v)] = true
+			out = append(out, v)
+		}
+	}
+
+	for _, o := range summary.Organisms {
+		add(o)
+	}
+	for _, e := range summary.Experiments {
+		add(e.LibraryStrategy)
+	}
+	add(study.StudyType)
+	if study.Curation != nil {
+		for _, tag := range study.Curation.Tags {
+			add(tag)
+		}
+	}
+	return out
+}
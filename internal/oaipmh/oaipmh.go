@@ -0,0 +1,496 @@
+// Package oaipmh implements an OAI-PMH 2.0 data provider over srake studies,
+// so that library and discovery systems can harvest the local catalog.
+//
+// Studies are exposed as records in Dublin Core (oai_dc) and in a richer SRA
+// format (sra). Curated studies and user-defined collections are exposed as
+// sets for selective harvesting.
+package oaipmh
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/packaging"
+)
+
+// OAI-PMH protocol constants
+const (
+	oaiNamespace      = "http://www.openarchives.org/OAI/2.0/"
+	oaiSchemaLocation = "http://www.openarchives.org/OAI/2.0/ http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	xsiNamespace      = "http://www.w3.org/2001/XMLSchema-instance"
+	granularity       = "YYYY-MM-DD"
+	dateLayout        = "2006-01-02"
+)
+
+// Set specs
+const (
+	setCurated          = "curated"
+	setCollectionPrefix = "collection-"
+)
+
+// Error codes defined by the protocol
+const (
+	errBadArgument             = "badArgument"
+	errBadResumptionToken      = "badResumptionToken"
+	errBadVerb                 = "badVerb"
+	errCannotDisseminateFormat = "cannotDisseminateFormat"
+	errIDDoesNotExist          = "idDoesNotExist"
+	errNoRecordsMatch          = "noRecordsMatch"
+)
+
+// Config holds provider settings.
+type Config struct {
+	RepositoryName string
+	AdminEmail     string
+
+	// RepositoryIdentifier namespaces record identifiers as
+	// oai:<RepositoryIdentifier>:<accession>
+	RepositoryIdentifier string
+
+	// Catalog supplies canonical study URLs and the publisher
+	Catalog packaging.Catalog
+
+	// PageSize is the number of records per list response
+	PageSize int
+}
+
+//go:embed sra.xsd
+var sraSchema []byte
+
+// Provider serves OAI-PMH requests.
+type Provider struct {
+	db  *database.DB
+	cfg Config
+}
+
+// NewProvider creates a provider over the studies in db.
+func NewProvider(db *database.DB, cfg Config) *Provider {
+	if cfg.RepositoryName == "" {
+		cfg.RepositoryName = "srake SRA metadata catalog"
+	}
+	if cfg.AdminEmail == "" {
+		cfg.AdminEmail = "admin@localhost"
+	}
+	if cfg.RepositoryIdentifier == "" {
+		cfg.RepositoryIdentifier = "srake"
+		if u, err := url.Parse(cfg.Catalog.BaseURL); err == nil && u.Hostname() != "" {
+			cfg.RepositoryIdentifier = u.Hostname()
+		}
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 100
+	}
+	return &Provider{db: db, cfg: cfg}
+}
+
+// oaiError is a protocol error reported in the response body.
+type oaiError struct {
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+func (e *oaiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newError(code, format string, args ...interface{}) *oaiError {
+	return &oaiError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ServeHTTP handles a GET or form-encoded POST OAI-PMH request. The schema
+// of the sra metadata format is served below the base URL.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, sraSchemaPath) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(sraSchema)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	resp := &response{
+		Xmlns:          oaiNamespace,
+		XSI:            xsiNamespace,
+		SchemaLocation: oaiSchemaLocation,
+		ResponseDate:   time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Request:        request{URL: baseURL(r)},
+	}
+
+	if err := p.handle(r, resp); err != nil {
+		oaiErr, ok := err.(*oaiError)
+		if !ok {
+			log.Printf("OAI-PMH request failed: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		resp.Errors = []*oaiError{oaiErr}
+
+		// Request attributes are only echoed for well-formed requests
+		if oaiErr.Code == errBadVerb || oaiErr.Code == errBadArgument {
+			resp.Request = request{URL: resp.Request.URL}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(resp); err != nil {
+		log.Printf("Error encoding OAI-PMH response: %v", err)
+	}
+}
+
+// verbArguments lists the required and optional arguments of each verb.
+var verbArguments = map[string]struct{ required, optional []string }{
+	"Identify":            {},
+	"ListMetadataFormats": {optional: []string{"identifier"}},
+	"ListSets":            {optional: []string{"resumptionToken"}},
+	"GetRecord":           {required: []string{"identifier", "metadataPrefix"}},
+	"ListIdentifiers":     {optional: []string{"metadataPrefix", "from", "until", "set", "resumptionToken"}},
+	"ListRecords":         {optional: []string{"metadataPrefix", "from", "until", "set", "resumptionToken"}},
+}
+
+// handle validates the request arguments and dispatches on the verb.
+func (p *Provider) handle(r *http.Request, resp *response) error {
+	values := r.Form
+	if len(values["verb"]) != 1 {
+		return newError(errBadVerb, "exactly one verb is required")
+	}
+	verb := values.Get("verb")
+	spec, ok := verbArguments[verb]
+	if !ok {
+		return newError(errBadVerb, "illegal verb: %s", verb)
+	}
+
+	args := make(map[string]string)
+	allowed := make(map[string]bool)
+	for _, name := range append(spec.required, spec.optional...) {
+		allowed[name] = true
+	}
+	for name, v := range values {
+		if name == "verb" {
+			continue
+		}
+		if !allowed[name] {
+			return newError(errBadArgument, "illegal argument for %s: %s", verb, name)
+		}
+		if len(v) != 1 {
+			return newError(errBadArgument, "repeated argument: %s", name)
+		}
+		args[name] = v[0]
+	}
+	for _, name := range spec.required {
+		if args[name] == "" {
+			return newError(errBadArgument, "missing required argument: %s", name)
+		}
+	}
+
+	resp.Request.Verb = verb
+	resp.Request.Identifier = args["identifier"]
+	resp.Request.MetadataPrefix = args["metadataPrefix"]
+	resp.Request.From = args["from"]
+	resp.Request.Until = args["until"]
+	resp.Request.Set = args["set"]
+	resp.Request.ResumptionToken = args["resumptionToken"]
+
+	switch verb {
+	case "Identify":
+		return p.identify(resp)
+	case "ListMetadataFormats":
+		return p.listMetadataFormats(resp, args["identifier"])
+	case "ListSets":
+		return p.listSets(resp, args["resumptionToken"])
+	case "GetRecord":
+		return p.getRecord(resp, args["identifier"], args["metadataPrefix"])
+	default:
+		return p.list(resp, verb == "ListRecords", args)
+	}
+}
+
+func (p *Provider) identify(resp *response) error {
+	earliest, err := p.db.EarliestHarvestDatestamp()
+	if err != nil {
+		return err
+	}
+	resp.Identify = &identify{
+		RepositoryName:    p.cfg.RepositoryName,
+		BaseURL:           resp.Request.URL,
+		ProtocolVersion:   "2.0",
+		AdminEmail:        p.cfg.AdminEmail,
+		EarliestDatestamp: earliest,
+		DeletedRecord:     "no",
+		Granularity:       granularity,
+	}
+	return nil
+}
+
+func (p *Provider) listMetadataFormats(resp *response, identifier string) error {
+	if identifier != "" {
+		if _, err := p.lookup(identifier); err != nil {
+			return err
+		}
+	}
+
+	var formats []metadataFormat
+	for _, f := range p.formats(resp.Request.URL) {
+		formats = append(formats, metadataFormat{
+			Prefix:    f.prefix,
+			Schema:    f.schema,
+			Namespace: f.namespace,
+		})
+	}
+	resp.ListMetadataFormats = &listMetadataFormats{Formats: formats}
+	return nil
+}
+
+func (p *Provider) listSets(resp *response, token string) error {
+	if token != "" {
+		return newError(errBadResumptionToken, "set lists are not paged")
+	}
+
+	collections, err := p.db.ListCollections()
+	if err != nil {
+		return err
+	}
+
+	sets := []set{{Spec: setCurated, Name: "Curated studies"}}
+	for _, c := range collections {
+		name := c.Name
+		if c.Description != "" {
+			name = fmt.Sprintf("%s: %s", c.Name, c.Description)
+		}
+		sets = append(sets, set{Spec: setCollectionPrefix + c.Name, Name: name})
+	}
+	resp.ListSets = &listSets{Sets: sets}
+	return nil
+}
+
+func (p *Provider) getRecord(resp *response, identifier, prefix string) error {
+	format, ok := p.format(resp.Request.URL, prefix)
+	if !ok {
+		return newError(errCannotDisseminateFormat, "unsupported metadata format: %s", prefix)
+	}
+
+	header, err := p.lookup(identifier)
+	if err != nil {
+		return err
+	}
+
+	rec, err := p.record(header, format)
+	if err != nil {
+		return err
+	}
+	resp.GetRecord = &getRecord{Record: *rec}
+	return nil
+}
+
+// list serves ListIdentifiers and ListRecords.
+func (p *Provider) list(resp *response, withMetadata bool, args map[string]string) error {
+	var state listState
+	if token := args["resumptionToken"]; token != "" {
+		if len(args) > 1 {
+			return newError(errBadArgument, "resumptionToken is an exclusive argument")
+		}
+		var ok bool
+		if state, ok = decodeToken(token); !ok {
+			return newError(errBadResumptionToken, "invalid resumption token")
+		}
+	} else {
+		state = listState{
+			prefix: args["metadataPrefix"],
+			set:    args["set"],
+			from:   args["from"],
+			until:  args["until"],
+		}
+		if state.prefix == "" {
+			return newError(errBadArgument, "missing required argument: metadataPrefix")
+		}
+		for _, date := range []string{state.from, state.until} {
+			if date == "" {
+				continue
+			}
+			if _, err := time.Parse(dateLayout, date); err != nil {
+				return newError(errBadArgument, "invalid date %q: expected %s", date, granularity)
+			}
+		}
+		if state.from != "" && state.until != "" && state.from > state.until {
+			return newError(errBadArgument, "from must not be later than until")
+		}
+	}
+
+	format, ok := p.format(resp.Request.URL, state.prefix)
+	if !ok {
+		return newError(errCannotDisseminateFormat, "unsupported metadata format: %s", state.prefix)
+	}
+
+	query := database.HarvestQuery{
+		From:   state.from,
+		Until:  state.until,
+		Offset: state.offset,
+		Limit:  p.cfg.PageSize,
+	}
+	switch {
+	case state.set == "":
+	case state.set == setCurated:
+		query.CuratedOnly = true
+	case strings.HasPrefix(state.set, setCollectionPrefix):
+		query.Collection = strings.TrimPrefix(state.set, setCollectionPrefix)
+	default:
+		return newError(errNoRecordsMatch, "unknown set: %s", state.set)
+	}
+
+	total, err := p.db.CountHarvestRecords(query)
+	if err != nil {
+		return err
+	}
+	headers, err := p.db.ListHarvestRecords(query)
+	if err != nil {
+		return err
+	}
+	if len(headers) == 0 {
+		if state.offset > 0 {
+			return newError(errBadResumptionToken, "resumption token is past the end of the list")
+		}
+		return newError(errNoRecordsMatch, "no records match the request")
+	}
+
+	// Incomplete lists carry a token; the last page carries an empty one
+	var token *resumptionToken
+	if total > p.cfg.PageSize {
+		token = &resumptionToken{CompleteListSize: total, Cursor: state.offset}
+		if next := state.offset + len(headers); next < total {
+			state.offset = next
+			token.Value = state.encode()
+		}
+	}
+
+	if !withMetadata {
+		list := &listIdentifiers{ResumptionToken: token}
+		for _, h := range headers {
+			list.Headers = append(list.Headers, p.header(h))
+		}
+		resp.ListIdentifiers = list
+		return nil
+	}
+
+	list := &listRecords{ResumptionToken: token}
+	for _, h := range headers {
+		rec, err := p.record(&h, format)
+		if err != nil {
+			return err
+		}
+		list.Records = append(list.Records, *rec)
+	}
+	resp.ListRecords = list
+	return nil
+}
+
+// lookup resolves an OAI identifier to a study header.
+func (p *Provider) lookup(identifier string) (*database.HarvestRecord, error) {
+	prefix := "oai:" + p.cfg.RepositoryIdentifier + ":"
+	if !strings.HasPrefix(identifier, prefix) {
+		return nil, newError(errIDDoesNotExist, "unknown identifier: %s", identifier)
+	}
+
+	header, err := p.db.GetHarvestRecord(strings.TrimPrefix(identifier, prefix))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, newError(errIDDoesNotExist, "unknown identifier: %s", identifier)
+		}
+		return nil, err
+	}
+	return header, nil
+}
+
+// header builds the OAI header of a study.
+func (p *Provider) header(h database.HarvestRecord) header {
+	hdr := header{
+		Identifier: "oai:" + p.cfg.RepositoryIdentifier + ":" + h.Accession,
+		Datestamp:  h.Datestamp,
+	}
+	if h.Curated {
+		hdr.SetSpecs = append(hdr.SetSpecs, setCurated)
+	}
+	for _, c := range h.Collections {
+		hdr.SetSpecs = append(hdr.SetSpecs, setCollectionPrefix+c)
+	}
+	return hdr
+}
+
+// record loads a study and renders it in the given format.
+func (p *Provider) record(h *database.HarvestRecord, format metadataFormatDef) (*record, error) {
+	study, err := p.db.GetStudy(h.Accession)
+	if err != nil {
+		return nil, err
+	}
+	if study.Curation, err = p.db.GetCuration(h.Accession); err != nil {
+		return nil, fmt.Errorf("failed to load curation: %w", err)
+	}
+	summary, err := p.db.GetHarvestSummary(h.Accession)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load study summary: %w", err)
+	}
+
+	return &record{
+		Header: p.header(*h),
+		Metadata: &metadata{Content: format.render(&recordData{
+			study:   study,
+			summary: summary,
+			header:  h,
+			catalog: p.cfg.Catalog,
+			schema:  format.schema,
+		})},
+	}, nil
+}
+
+// listState is the position in a list request, carried in resumption tokens.
+type listState struct {
+	prefix, set, from, until string
+	offset                   int
+}
+
+func (s listState) encode() string {
+	raw := strings.Join([]string{strconv.Itoa(s.offset), s.prefix, s.set, s.from, s.until}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeToken(token string) (listState, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return listState{}, false
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 5 {
+		return listState{}, false
+	}
+	offset, err := strconv.Atoi(parts[0])
+	if err != nil || offset < 0 {
+		return listState{}, false
+	}
+	return listState{offset: offset, prefix: parts[1], set: parts[2], from: parts[3], until: parts[4]}, true
+}
+
+// baseURL reconstructs the URL the provider was reached at.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
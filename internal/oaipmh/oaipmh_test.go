@@ -0,0 +1,267 @@
+package oaipmh
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/packaging"
+)
+
+func setupProvider(t *testing.T, pageSize int) *Provider {
+	t.Helper()
+
+	dir := t.TempDir()
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	submitted := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, acc := range []string{"SRP000001", "SRP000002", "SRP000003"} {
+		study := &database.Study{
+			StudyAccession: acc,
+			StudyTitle:     "Study " + acc,
+			StudyAbstract:  "Abstract of " + acc,
+			SubmissionDate: &submitted,
+			Metadata:       `{"center_name":"Example Lab"}`,
+		}
+		if err := db.InsertStudy(study); err != nil {
+			t.Fatalf("InsertStudy failed: %v", err)
+		}
+	}
+	if err := db.InsertExperiment(&database.Experiment{
+		ExperimentAccession: "SRX000001",
+		StudyAccession:      "SRP000001",
+		LibraryStrategy:     "RNA-Seq",
+		Platform:            "ILLUMINA",
+	}); err != nil {
+		t.Fatalf("InsertExperiment failed: %v", err)
+	}
+	if err := db.UpsertCuration(&database.Curation{
+		Accession:    "SRP000001",
+		RecordType:   "study",
+		CuratedTitle: "Curated liver study",
+		Tags:         []string{"liver"},
+		UpdatedAt:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}); err != nil {
+		t.Fatalf("UpsertCuration failed: %v", err)
+	}
+	if _, err := db.AddToCollection("cohort", []database.CollectionMember{{Accession: "SRP000002", RecordType: "study"}}); err != nil {
+		t.Fatalf("AddToCollection failed: %v", err)
+	}
+
+	return NewProvider(db, Config{
+		AdminEmail: "curator@example.org",
+		Catalog:    packaging.Catalog{BaseURL: "https://sra.example.org"},
+		PageSize:   pageSize,
+	})
+}
+
+// oaiResponse decodes the parts of a response the tests inspect
+type oaiResponse struct {
+	Error *struct {
+		Code string `xml:"code,attr"`
+	} `xml:"error"`
+	Identify struct {
+		BaseURL           string `xml:"baseURL"`
+		EarliestDatestamp string `xml:"earliestDatestamp"`
+	} `xml:"Identify"`
+	Sets    []string `xml:"ListSets>set>setSpec"`
+	Headers []struct {
+		Identifier string   `xml:"identifier"`
+		Datestamp  string   `xml:"datestamp"`
+		SetSpecs   []string `xml:"setSpec"`
+	} `xml:"ListIdentifiers>header"`
+	Records []struct {
+		Identifier string `xml:"header>identifier"`
+		Metadata   struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"metadata"`
+	} `xml:"ListRecords>record"`
+	Record struct {
+		Identifier string `xml:"header>identifier"`
+		Metadata   struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"metadata"`
+	} `xml:"GetRecord>record"`
+	Token struct {
+		Value            string `xml:",chardata"`
+		CompleteListSize int    `xml:"completeListSize,attr"`
+	} `xml:"ListIdentifiers>resumptionToken"`
+}
+
+func harvest(t *testing.T, p *Provider, query string) *oaiResponse {
+	t.Helper()
+	req := httptest.NewRequest("GET", "http://localhost/oai?"+query, nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("%s: expected status 200, got %d", query, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/xml") {
+		t.Errorf("%s: unexpected content type %s", query, ct)
+	}
+
+	var resp oaiResponse
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: invalid XML: %v\n%s", query, err, w.Body.String())
+	}
+	return &resp
+}
+
+func TestIdentify(t *testing.T) {
+	p := setupProvider(t, 0)
+
+	resp := harvest(t, p, "verb=Identify")
+	if resp.Error != nil {
+		t.Fatalf("unexpected error %s", resp.Error.Code)
+	}
+	if resp.Identify.BaseURL != "http://localhost/oai" || resp.Identify.EarliestDatestamp != "2020-05-01" {
+		t.Errorf("unexpected Identify: %+v", resp.Identify)
+	}
+}
+
+func TestListSets(t *testing.T) {
+	p := setupProvider(t, 0)
+
+	resp := harvest(t, p, "verb=ListSets")
+	if len(resp.Sets) != 2 || resp.Sets[0] != "curated" || resp.Sets[1] != "collection-cohort" {
+		t.Errorf("unexpected sets: %v", resp.Sets)
+	}
+}
+
+func TestListIdentifiers(t *testing.T) {
+	p := setupProvider(t, 0)
+
+	resp := harvest(t, p, "verb=ListIdentifiers&metadataPrefix=oai_dc")
+	if len(resp.Headers) != 3 {
+		t.Fatalf("expected 3 headers, got %d", len(resp.Headers))
+	}
+	first := resp.Headers[0]
+	if first.Identifier != "oai:sra.example.org:SRP000001" || first.Datestamp != "2024-03-01" {
+		t.Errorf("unexpected header: %+v", first)
+	}
+	if len(first.SetSpecs) != 1 || first.SetSpecs[0] != "curated" {
+		t.Errorf("expected curated set, got %v", first.SetSpecs)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"verb=ListIdentifiers&metadataPrefix=oai_dc&set=curated", 1},
+		{"verb=ListIdentifiers&metadataPrefix=oai_dc&set=collection-cohort", 1},
+		{"verb=ListIdentifiers&metadataPrefix=oai_dc&from=2024-01-01", 1},
+		{"verb=ListIdentifiers&metadataPrefix=oai_dc&until=2021-01-01", 2},
+	}
+	for _, tt := range tests {
+		resp := harvest(t, p, tt.query)
+		if len(resp.Headers) != tt.want {
+			t.Errorf("%s: expected %d headers, got %d", tt.query, tt.want, len(resp.Headers))
+		}
+	}
+}
+
+func TestResumptionToken(t *testing.T) {
+	p := setupProvider(t, 2)
+
+	resp := harvest(t, p, "verb=ListIdentifiers&metadataPrefix=sra")
+	if len(resp.Headers) != 2 || resp.Token.Value == "" || resp.Token.CompleteListSize != 3 {
+		t.Fatalf("expected first page with token, got %d headers, token %+v", len(resp.Headers), resp.Token)
+	}
+
+	resp = harvest(t, p, "verb=ListIdentifiers&resumptionToken="+resp.Token.Value)
+	if len(resp.Headers) != 1 || resp.Headers[0].Identifier != "oai:sra.example.org:SRP000003" {
+		t.Fatalf("unexpected second page: %+v", resp.Headers)
+	}
+	if resp.Token.Value != "" {
+		t.Errorf("expected empty token on last page, got %q", resp.Token.Value)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	p := setupProvider(t, 0)
+
+	resp := harvest(t, p, "verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:sra.example.org:SRP000001")
+	if resp.Error != nil {
+		t.Fatalf("unexpected error %s", resp.Error.Code)
+	}
+	dc := resp.Record.Metadata.Inner
+	for _, want := range []string{
+		"<dc:title>Curated liver study</dc:title>",
+		"<dc:creator>Example Lab</dc:creator>",
+		"<dc:subject>RNA-Seq</dc:subject>",
+		"<dc:identifier>https://sra.example.org/browse/study/SRP000001</dc:identifier>",
+		"<dc:date>2020-05-01</dc:date>",
+	} {
+		if !strings.Contains(dc, want) {
+			t.Errorf("Dublin Core record missing %s:\n%s", want, dc)
+		}
+	}
+
+	resp = harvest(t, p, "verb=ListRecords&metadataPrefix=sra&set=curated")
+	if len(resp.Records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(resp.Records))
+	}
+	sra := resp.Records[0].Metadata.Inner
+	for _, want := range []string{
+		`accession="SRP000001"`,
+		"<sra:curatedTitle>Curated liver study</sra:curatedTitle>",
+		"<sra:tag>liver</sra:tag>",
+		"<sra:libraryStrategy>RNA-Seq</sra:libraryStrategy>",
+		"http://localhost/oai/sra.xsd",
+	} {
+		if !strings.Contains(sra, want) {
+			t.Errorf("SRA record missing %s:\n%s", want, sra)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	p := setupProvider(t, 0)
+
+	tests := []struct {
+		query string
+		code  string
+	}{
+		{"", "badVerb"},
+		{"verb=Harvest", "badVerb"},
+		{"verb=Identify&set=curated", "badArgument"},
+		{"verb=ListRecords", "badArgument"},
+		{"verb=ListRecords&metadataPrefix=oai_dc&from=2024", "badArgument"},
+		{"verb=ListRecords&metadataPrefix=oai_dc&metadataPrefix=sra", "badArgument"},
+		{"verb=ListRecords&metadataPrefix=marc21", "cannotDisseminateFormat"},
+		{"verb=ListRecords&metadataPrefix=oai_dc&set=unknown", "noRecordsMatch"},
+		{"verb=ListRecords&metadataPrefix=oai_dc&from=2030-01-01", "noRecordsMatch"},
+		{"verb=ListRecords&resumptionToken=bogus", "badResumptionToken"},
+		{"verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:sra.example.org:SRP999999", "idDoesNotExist"},
+		{"verb=GetRecord&metadataPrefix=oai_dc&identifier=SRP000001", "idDoesNotExist"},
+	}
+	for _, tt := range tests {
+		resp := harvest(t, p, tt.query)
+		if resp.Error == nil || resp.Error.Code != tt.code {
+			t.Errorf("%q: expected %s, got %+v", tt.query, tt.code, resp.Error)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	p := setupProvider(t, 0)
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/oai/sra.xsd", nil))
+	if !strings.Contains(w.Body.String(), `targetNamespace="`+sraNamespace+`"`) {
+		t.Errorf("unexpected schema response:\n%s", w.Body.String())
+	}
+}
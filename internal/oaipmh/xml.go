@@ -0,0 +1,97 @@
+package oaipmh
+
+import "encoding/xml"
+
+// response is the OAI-PMH envelope. Exactly one of the verb elements or
+// Errors is set.
+type response struct {
+	XMLName        xml.Name `xml:"OAI-PMH"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	XSI            string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	ResponseDate   string   `xml:"responseDate"`
+	Request        request  `xml:"request"`
+
+	Errors              []*oaiError          `xml:"error,omitempty"`
+	Identify            *identify            `xml:"Identify,omitempty"`
+	ListMetadataFormats *listMetadataFormats `xml:"ListMetadataFormats,omitempty"`
+	ListSets            *listSets            `xml:"ListSets,omitempty"`
+	GetRecord           *getRecord           `xml:"GetRecord,omitempty"`
+	ListIdentifiers     *listIdentifiers     `xml:"ListIdentifiers,omitempty"`
+	ListRecords         *listRecords         `xml:"ListRecords,omitempty"`
+}
+
+type request struct {
+	URL             string `xml:",chardata"`
+	Verb            string `xml:"verb,attr,omitempty"`
+	Identifier      string `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string `xml:"metadataPrefix,attr,omitempty"`
+	From            string `xml:"from,attr,omitempty"`
+	Until           string `xml:"until,attr,omitempty"`
+	Set             string `xml:"set,attr,omitempty"`
+	ResumptionToken string `xml:"resumptionToken,attr,omitempty"`
+}
+
+type identify struct {
+	RepositoryName    string `xml:"repositoryName"`
+	BaseURL           string `xml:"baseURL"`
+	ProtocolVersion   string `xml:"protocolVersion"`
+	AdminEmail        string `xml:"adminEmail"`
+	EarliestDatestamp string `xml:"earliestDatestamp"`
+	DeletedRecord     string `xml:"deletedRecord"`
+	Granularity       string `xml:"granularity"`
+}
+
+type metadataFormat struct {
+	Prefix    string `xml:"metadataPrefix"`
+	Schema    string `xml:"schema"`
+	Namespace string `xml:"metadataNamespace"`
+}
+
+type listMetadataFormats struct {
+	Formats []metadataFormat `xml:"metadataFormat"`
+}
+
+type set struct {
+	Spec string `xml:"setSpec"`
+	Name string `xml:"setName"`
+}
+
+type listSets struct {
+	Sets []set `xml:"set"`
+}
+
+type header struct {
+	Identifier string   `xml:"identifier"`
+	Datestamp  string   `xml:"datestamp"`
+	SetSpecs   []string `xml:"setSpec"`
+}
+
+type metadata struct {
+	Content interface{}
+}
+
+type record struct {
+	Header   header    `xml:"header"`
+	Metadata *metadata `xml:"metadata,omitempty"`
+}
+
+type getRecord struct {
+	Record record `xml:"record"`
+}
+
+type resumptionToken struct {
+	Value            string `xml:",chardata"`
+	CompleteListSize int    `xml:"completeListSize,attr"`
+	Cursor           int    `xml:"cursor,attr"`
+}
+
+type listIdentifiers struct {
+	Headers         []header         `xml:"header"`
+	ResumptionToken *resumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+type listRecords struct {
+	Records         []record         `xml:"record"`
+	ResumptionToken *resumptionToken `xml:"resumptionToken,omitempty"`
+}
@@ -0,0 +1,218 @@
+// Package ontology reads the terms and synonyms of biomedical vocabularies,
+// OBO ontologies such as EFO, MONDO or DOID and the MeSH descriptors, so
+// that searches can match a term by any of its names.
+package ontology
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Vocabulary formats read by Load
+const (
+	FormatOBO  = "obo"
+	FormatMeSH = "mesh"
+)
+
+// Term is a term of a vocabulary with its preferred name and the other
+// names meaning the same
+type Term struct {
+	ID       string
+	Name     string
+	Synonyms []string
+}
+
+// Labels returns the names of the term, its preferred name first, without
+// duplicates
+func (t Term) Labels() []string {
+	seen := make(map[string]bool)
+	var labels []string
+	for _, label := range append([]string{t.Name}, t.Synonyms...) {
+		label = strings.TrimSpace(label)
+		key := strings.ToLower(label)
+		if label == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+// Vocabulary is the terms read from a file, with the name it gives itself:
+// the ontology header of an OBO file, or mesh
+type Vocabulary struct {
+	Name   string
+	Format string
+	Terms  []Term
+}
+
+// Load reads a vocabulary from an OBO file or a MeSH descriptor XML file
+// (desc<year>.xml), either of which may be gzip-compressed. The format is
+// detected from the content.
+func Load(path string) (*Vocabulary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", filepath.Base(path), err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(4096)
+	trimmed := bytes.TrimSpace(head)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return ReadMeSH(br)
+	case bytes.HasPrefix(trimmed, []byte("format-version:")) || bytes.Contains(head, []byte("[Term]")):
+		return ReadOBO(br)
+	}
+	return nil, fmt.Errorf("%s is neither an OBO file nor MeSH descriptor XML", filepath.Base(path))
+}
+
+// ReadOBO reads the terms of an OBO ontology with their exact synonyms.
+// Broad, narrow and related synonyms name other things and are left out,
+// as are obsolete terms.
+func ReadOBO(r io.Reader) (*Vocabulary, error) {
+	v := &Vocabulary{Format: FormatOBO}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var term *Term
+	var inTerm, obsolete bool
+	flush := func() {
+		if term != nil && inTerm && !obsolete && term.ID != "" && term.Name != "" {
+			v.Terms = append(v.Terms, *term)
+		}
+		term, obsolete = nil, false
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			flush()
+			inTerm = line == "[Term]"
+			term = &Term{}
+			continue
+		}
+		tag, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		if term == nil {
+			// The header, before the first stanza
+			if tag == "ontology" && v.Name == "" {
+				v.Name = value
+			}
+			continue
+		}
+		if !inTerm {
+			continue
+		}
+		switch tag {
+		case "id":
+			term.ID = value
+		case "name":
+			term.Name = value
+		case "is_obsolete":
+			obsolete = value == "true"
+		case "synonym":
+			if text, scope, ok := parseOBOSynonym(value); ok && scope == "EXACT" {
+				term.Synonyms = append(term.Synonyms, text)
+			}
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read OBO file: %w", err)
+	}
+	return v, nil
+}
+
+// parseOBOSynonym splits the value of a synonym tag, "text" SCOPE [xrefs],
+// into its text and scope
+func parseOBOSynonym(value string) (text, scope string, ok bool) {
+	if !strings.HasPrefix(value, `"`) {
+		return "", "", false
+	}
+	var b strings.Builder
+	i := 1
+	for ; i < len(value) && value[i] != '"'; i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	if i == len(value) {
+		return "", "", false
+	}
+	fields := strings.Fields(value[i+1:])
+	if len(fields) == 0 {
+		return b.String(), "RELATED", true // The OBO default scope
+	}
+	return b.String(), fields[0], true
+}
+
+// meshDescriptor is a DescriptorRecord of the MeSH descriptor XML
+type meshDescriptor struct {
+	UI       string `xml:"DescriptorUI"`
+	Name     string `xml:"DescriptorName>String"`
+	Concepts []struct {
+		Preferred string   `xml:"PreferredConceptYN,attr"`
+		Terms     []string `xml:"TermList>Term>String"`
+	} `xml:"ConceptList>Concept"`
+}
+
+// ReadMeSH reads the descriptors of a MeSH descriptor XML file with the
+// entry terms of their preferred concept. The terms of narrower concepts
+// name other things and are left out.
+func ReadMeSH(r io.Reader) (*Vocabulary, error) {
+	v := &Vocabulary{Name: "mesh", Format: FormatMeSH}
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MeSH XML: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "DescriptorRecord" {
+			continue
+		}
+		var d meshDescriptor
+		if err := decoder.DecodeElement(&d, &start); err != nil {
+			return nil, fmt.Errorf("failed to read MeSH descriptor: %w", err)
+		}
+		term := Term{ID: d.UI, Name: d.Name}
+		for _, c := range d.Concepts {
+			if c.Preferred == "Y" {
+				term.Synonyms = append(term.Synonyms, c.Terms...)
+			}
+		}
+		if term.ID != "" && term.Name != "" {
+			v.Terms = append(v.Terms, term)
+		}
+	}
+	return v, nil
+}
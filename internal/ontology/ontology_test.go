@@ -0,0 +1,110 @@
+package ontology
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOBO = `format-version: 1.2
+ontology: efo
+
+[Term]
+id: EFO:0000182
+name: hepatocellular carcinoma
+synonym: "liver cancer" EXACT []
+synonym: "HCC" EXACT [MONDO:0007256]
+synonym: "hepatoma" RELATED []
+synonym: "liver \"primary\" cancer" EXACT []
+
+[Term]
+id: EFO:0000001
+name: experimental factor
+is_obsolete: true
+
+[Typedef]
+id: part_of
+name: part of
+`
+
+const testMeSH = `<?xml version="1.0" encoding="UTF-8"?>
+<DescriptorRecordSet LanguageCode="eng">
+<DescriptorRecord DescriptorClass="1">
+  <DescriptorUI>D006528</DescriptorUI>
+  <DescriptorName><String>Carcinoma, Hepatocellular</String></DescriptorName>
+  <ConceptList>
+    <Concept PreferredConceptYN="Y">
+      <ConceptUI>M0009956</ConceptUI>
+      <TermList>
+        <Term><String>Carcinoma, Hepatocellular</String></Term>
+        <Term><String>Hepatocellular Carcinoma</String></Term>
+      </TermList>
+    </Concept>
+    <Concept PreferredConceptYN="N">
+      <TermList>
+        <Term><String>Hepatoma, Morris</String></Term>
+      </TermList>
+    </Concept>
+  </ConceptList>
+</DescriptorRecord>
+</DescriptorRecordSet>
+`
+
+func TestReadOBO(t *testing.T) {
+	v, err := ReadOBO(strings.NewReader(testOBO))
+	if err != nil {
+		t.Fatalf("ReadOBO failed: %v", err)
+	}
+	if v.Name != "efo" || v.Format != FormatOBO || len(v.Terms) != 1 {
+		t.Fatalf("expected one efo term, got %+v", v)
+	}
+	labels := v.Terms[0].Labels()
+	want := `hepatocellular carcinoma|liver cancer|HCC|liver "primary" cancer`
+	if strings.Join(labels, "|") != want {
+		t.Errorf("expected labels %s, got %v", want, labels)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	// MeSH XML, gzip-compressed
+	path := filepath.Join(dir, "desc2025.xml.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(testMeSH))
+	gz.Close()
+	f.Close()
+
+	v, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if v.Name != "mesh" || len(v.Terms) != 1 || v.Terms[0].ID != "D006528" {
+		t.Fatalf("unexpected vocabulary: %+v", v)
+	}
+	if labels := v.Terms[0].Labels(); strings.Join(labels, "|") != "Carcinoma, Hepatocellular|Hepatocellular Carcinoma" {
+		t.Errorf("expected the terms of the preferred concept, got %v", labels)
+	}
+
+	path = filepath.Join(dir, "efo.obo")
+	if err := os.WriteFile(path, []byte(testOBO), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := Load(path); err != nil || v.Format != FormatOBO {
+		t.Errorf("expected an OBO vocabulary, got %+v (%v)", v, err)
+	}
+
+	path = filepath.Join(dir, "terms.txt")
+	if err := os.WriteFile(path, []byte("liver\tcancer\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,154 @@
+package packaging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// Bioschemas Dataset profile identifiers
+const (
+	schemaOrgContext  = "https://schema.org"
+	bioschemasDataset = "https://bioschemas.org/profiles/Dataset/1.0-RELEASE"
+)
+
+// Catalog describes the srake deployment that publishes Bioschemas markup.
+// Without a base URL, records point at their NCBI SRA landing pages.
+type Catalog struct {
+	// BaseURL is the public root of the web UI, e.g. https://sra.example.org
+	BaseURL       string
+	PublisherName string
+	PublisherURL  string
+	License       string
+}
+
+// StudyURL returns the canonical URL of a study page in the catalog.
+func (c Catalog) StudyURL(accession string) string {
+	if c.BaseURL == "" {
+		return recordURL(accession)
+	}
+	return strings.TrimRight(c.BaseURL, "/") + "/browse/study/" + accession
+}
+
+// BuildBioschemas describes the bundle as a schema.org Dataset conforming to
+// the Bioschemas Dataset profile, for embedding in study pages so that they can
+// be indexed by Google Dataset Search and other harvesters.
+func BuildBioschemas(b *Bundle, c Catalog) (map[string]interface{}, error) {
+	if b == nil || b.Study == nil {
+		return nil, fmt.Errorf("bundle has no study")
+	}
+	study := b.Study
+	url := c.StudyURL(study.StudyAccession)
+
+	dataset := entity{
+		"@context": []interface{}{
+			schemaOrgContext,
+			map[string]string{"dct": "http://purl.org/dc/terms/"},
+		},
+		"@type": "Dataset",
+		"@id":   url,
+		"dct:conformsTo": entity{
+			"@type": "CreativeWork",
+			"@id":   bioschemasDataset,
+		},
+		"name":                StudyTitle(study),
+		"description":         bioschemasDescription(b),
+		"identifier":          study.StudyAccession,
+		"url":                 url,
+		"isAccessibleForFree": !controlled(b),
+		"includedInDataCatalog": entity{
+			"@type": "DataCatalog",
+			"name":  sraRepoName,
+			"url":   sraURL,
+		},
+	}
+	if url != recordURL(study.StudyAccession) {
+		dataset["sameAs"] = recordURL(study.StudyAccession)
+	}
+
+	if c.PublisherName != "" {
+		publisher := entity{"@type": "Organization", "name": c.PublisherName}
+		if c.PublisherURL != "" {
+			publisher["url"] = c.PublisherURL
+		}
+		dataset["publisher"] = publisher
+	} else {
+		dataset["publisher"] = entity{"@type": "Organization", "name": sraRepoName, "url": sraURL}
+	}
+	if c.License != "" {
+		dataset["license"] = c.License
+	}
+	if controlled(b) {
+		conditions := "Controlled access: data are released on approval of an access request to dbGaP"
+		if b.Access.Consent != "" {
+			conditions += ", under consent group " + b.Access.Consent
+		}
+		dataset["conditionsOfAccess"] = conditions
+	}
+
+	if center := StudyCenter(study); center != "" {
+		dataset["creator"] = entity{"@type": "Organization", "name": center}
+	}
+	if date := studyDate(study); date != nil {
+		dataset["datePublished"] = date.Format("2006-01-02")
+	}
+	if kw := keywords(b); len(kw) > 0 {
+		dataset["keywords"] = kw
+	}
+	if techniques := libraryStrategies(b); len(techniques) > 0 {
+		dataset["measurementTechnique"] = techniques
+	}
+
+	var taxa []entity
+	seen := make(map[int]bool)
+	for _, s := range b.Samples {
+		if s.TaxonID > 0 && !seen[s.TaxonID] {
+			seen[s.TaxonID] = true
+			taxa = append(taxa, entity{
+				"@type":    "DefinedTerm",
+				"@id":      taxonURL(s.TaxonID),
+				"name":     firstNonEmpty(s.ScientificName, s.Organism),
+				"termCode": fmt.Sprintf("NCBITaxon:%d", s.TaxonID),
+			})
+		}
+	}
+	if len(taxa) > 0 {
+		dataset["about"] = taxa
+	}
+
+	var distributions []entity
+	for _, r := range b.Runs {
+		distributions = append(distributions, entity{
+			"@type":          "DataDownload",
+			"name":           r.RunAccession,
+			"contentUrl":     runDataURL(r.RunAccession),
+			"encodingFormat": "application/x-sra",
+		})
+	}
+	if len(distributions) > 0 {
+		dataset["distribution"] = distributions
+	}
+
+	return dataset, nil
+}
+
+// bioschemasDescription returns the study description, or a summary of the
+// study contents when none was submitted, since the profile requires one.
+func bioschemasDescription(b *Bundle) string {
+	if desc := StudyDescription(b.Study); desc != "" {
+		return desc
+	}
+	summary := fmt.Sprintf("Sequencing study %s in the %s with %d samples and %d runs",
+		b.Study.StudyAccession, sraRepoName, len(b.Samples), len(b.Runs))
+	if strategies := libraryStrategies(b); len(strategies) > 0 {
+		summary += " (" + strings.Join(strategies, ", ") + ")"
+	}
+	return summary + "."
+}
+
+// controlled reports whether the data of the bundle are under controlled
+// access
+func controlled(b *Bundle) bool {
+	return b.Access != nil && b.Access.Access == database.AccessControlled
+}
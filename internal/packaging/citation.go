@@ -0,0 +1,279 @@
+package packaging
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported citation styles
+const (
+	StyleText   = "text"
+	StyleBibTeX = "bibtex"
+)
+
+// maxCitedRuns is how many run accessions a citation lists before
+// summarizing them as a count and range
+const maxCitedRuns = 10
+
+// CitationStyles lists the supported citation styles.
+func CitationStyles() []string {
+	return []string{StyleText, StyleBibTeX}
+}
+
+// ValidCitationStyle reports whether style names a supported citation style.
+func ValidCitationStyle(style string) bool {
+	switch strings.ToLower(style) {
+	case StyleText, StyleBibTeX:
+		return true
+	}
+	return false
+}
+
+// RecordLinks are the landing pages of a record at the three INSDC archives,
+// which mirror each other's SRA records.
+type RecordLinks struct {
+	NCBI string `json:"ncbi"`
+	ENA  string `json:"ena"`
+	DDBJ string `json:"ddbj"`
+}
+
+// Links returns the canonical NCBI, ENA, and DDBJ URLs of an SRA, BioProject,
+// or BioSample accession.
+func Links(accession string) RecordLinks {
+	accession = strings.ToUpper(accession)
+	ncbi := "https://www.ncbi.nlm.nih.gov/sra/" + accession
+	ddbj := "https://ddbj.nig.ac.jp/resource/sra-" + sraRecordType(accession) + "/" + accession
+	switch {
+	case strings.HasPrefix(accession, "PRJ"):
+		ncbi = "https://www.ncbi.nlm.nih.gov/bioproject/" + accession
+		ddbj = "https://ddbj.nig.ac.jp/resource/bioproject/" + accession
+	case strings.HasPrefix(accession, "SAM"):
+		ncbi = biosampleURL(accession)
+		ddbj = "https://ddbj.nig.ac.jp/resource/biosample/" + accession
+	}
+	return RecordLinks{
+		NCBI: ncbi,
+		ENA:  "https://www.ebi.ac.uk/ena/browser/view/" + accession,
+		DDBJ: ddbj,
+	}
+}
+
+// sraRecordType returns the SRA record type an accession names from its
+// third letter, as DDBJ's resource URLs spell it.
+func sraRecordType(accession string) string {
+	if len(accession) < 3 {
+		return "run"
+	}
+	switch accession[2] {
+	case 'P':
+		return "study"
+	case 'X':
+		return "experiment"
+	case 'S':
+		return "sample"
+	case 'A':
+		return "submission"
+	}
+	return "run"
+}
+
+// Archive returns the INSDC archive an SRA accession was submitted to, by
+// its first letter, and the URL of the record there.
+func Archive(accession string) (name, url string) {
+	links := Links(accession)
+	switch strings.ToUpper(accession)[:min(1, len(accession))] {
+	case "E":
+		return "European Nucleotide Archive", links.ENA
+	case "D":
+		return "DDBJ Sequence Read Archive", links.DDBJ
+	}
+	return "NCBI Sequence Read Archive", links.NCBI
+}
+
+// Citation describes a record for citing in a manuscript: the study it
+// belongs to, the runs it comprises, and where it can be found.
+type Citation struct {
+	Accession      string      `json:"accession"`
+	StudyAccession string      `json:"study_accession"`
+	BioProject     string      `json:"bioproject,omitempty"`
+	Title          string      `json:"title"`
+	Author         string      `json:"author,omitempty"` // Submitting center
+	Archive        string      `json:"archive"`
+	URL            string      `json:"url"`
+	Links          RecordLinks `json:"links"`
+	Released       *time.Time  `json:"released,omitempty"`
+	Updated        *time.Time  `json:"updated,omitempty"`
+	Runs           []string    `json:"runs"`
+}
+
+// NewCitation describes accession, a record of the study of the bundle, for
+// citing. The runs are those of the record: all runs of the study, or those
+// of an experiment, sample, or single run.
+func NewCitation(accession string, b *Bundle) (*Citation, error) {
+	if b == nil || b.Study == nil {
+		return nil, fmt.Errorf("bundle has no study")
+	}
+	accession = strings.ToUpper(accession)
+	archive, url := Archive(accession)
+	c := &Citation{
+		Accession:      accession,
+		StudyAccession: b.Study.StudyAccession,
+		BioProject:     b.BioProject,
+		Title:          StudyTitle(b.Study),
+		Author:         StudyCenter(b.Study),
+		Archive:        archive,
+		URL:            url,
+		Links:          Links(accession),
+		Released:       studyDate(b.Study),
+		Updated:        b.Study.LastUpdate,
+		Runs:           []string{},
+	}
+
+	samples := make(map[string]bool)
+	if sraRecordType(accession) == "sample" {
+		for exp, accs := range b.ExperimentSamples {
+			for _, acc := range accs {
+				if acc == accession {
+					samples[exp] = true
+				}
+			}
+		}
+	}
+	for _, r := range b.Runs {
+		switch {
+		case accession == b.Study.StudyAccession,
+			r.RunAccession == accession,
+			r.ExperimentAccession == accession,
+			samples[r.ExperimentAccession]:
+			c.Runs = append(c.Runs, r.RunAccession)
+		}
+	}
+	sort.Strings(c.Runs)
+	return c, nil
+}
+
+// WriteCitation writes a citation in the given style: a reference and a
+// data availability statement as text, or a BibTeX entry.
+func WriteCitation(w io.Writer, style string, c *Citation) error {
+	switch strings.ToLower(style) {
+	case StyleText:
+		_, err := io.WriteString(w, c.Text())
+		return err
+	case StyleBibTeX:
+		_, err := io.WriteString(w, c.BibTeX())
+		return err
+	}
+	return fmt.Errorf("unsupported citation style: %s (supported: %s)",
+		style, strings.Join(CitationStyles(), ", "))
+}
+
+// Text returns the reference and data availability statement of a citation.
+func (c *Citation) Text() string {
+	var b strings.Builder
+	switch {
+	case c.Author != "" && c.Released != nil:
+		fmt.Fprintf(&b, "%s (%d). ", c.Author, c.Released.Year())
+	case c.Author != "":
+		fmt.Fprintf(&b, "%s. ", c.Author)
+	case c.Released != nil:
+		fmt.Fprintf(&b, "(%d). ", c.Released.Year())
+	}
+	fmt.Fprintf(&b, "%s. %s, accession %s", strings.TrimSuffix(c.Title, "."), c.Archive, c.Accession)
+	if c.BioProject != "" {
+		fmt.Fprintf(&b, " (BioProject %s)", c.BioProject)
+	}
+	fmt.Fprintf(&b, ". %s\n", c.URL)
+
+	var dates []string
+	if c.Released != nil {
+		dates = append(dates, "Released "+c.Released.Format("2006-01-02"))
+	}
+	if c.Updated != nil {
+		dates = append(dates, "last updated "+c.Updated.Format("2006-01-02"))
+	}
+	if len(dates) > 0 {
+		fmt.Fprintf(&b, "%s.\n", strings.Join(dates, "; "))
+	}
+
+	fmt.Fprintf(&b, "\nData availability: The sequencing data are available in the %s under accession %s", c.Archive, c.Accession)
+	if c.Accession != c.StudyAccession {
+		fmt.Fprintf(&b, " of study %s", c.StudyAccession)
+	}
+	if c.BioProject != "" {
+		fmt.Fprintf(&b, " (BioProject %s)", c.BioProject)
+	}
+	fmt.Fprintf(&b, " at %s", c.URL)
+	if runs := c.runList(); runs != "" {
+		fmt.Fprintf(&b, ", comprising %s", runs)
+	}
+	fmt.Fprintf(&b, ". The records are mirrored at %s.\n", strings.Join(c.mirrors(), " and "))
+	return b.String()
+}
+
+// BibTeX returns a citation as a BibTeX @misc entry keyed by accession.
+func (c *Citation) BibTeX() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@misc{%s,\n", c.Accession)
+	if c.Author != "" {
+		fmt.Fprintf(&b, "  author = {{%s}},\n", bibtexEscape(c.Author))
+	}
+	fmt.Fprintf(&b, "  title = {{%s}},\n", bibtexEscape(c.Title))
+	fmt.Fprintf(&b, "  howpublished = {%s},\n", c.Archive)
+	if c.Released != nil {
+		fmt.Fprintf(&b, "  year = {%d},\n", c.Released.Year())
+		fmt.Fprintf(&b, "  month = {%d},\n", c.Released.Month())
+	}
+	note := "Accession " + c.Accession
+	if c.Accession != c.StudyAccession {
+		note += " of study " + c.StudyAccession
+	}
+	if c.BioProject != "" {
+		note += "; BioProject " + c.BioProject
+	}
+	if runs := c.runList(); runs != "" {
+		note += "; " + runs
+	}
+	fmt.Fprintf(&b, "  note = {%s},\n", bibtexEscape(note))
+	fmt.Fprintf(&b, "  url = {%s}\n", c.URL)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// runList names the runs of a citation, or counts them with their range
+// when there are more than maxCitedRuns.
+func (c *Citation) runList() string {
+	switch n := len(c.Runs); {
+	case n == 0:
+		return ""
+	case n == 1:
+		return "run " + c.Runs[0]
+	case n <= maxCitedRuns:
+		return fmt.Sprintf("%d runs (%s)", n, strings.Join(c.Runs, ", "))
+	default:
+		return fmt.Sprintf("%d runs (%s to %s)", n, c.Runs[0], c.Runs[n-1])
+	}
+}
+
+// mirrors returns the landing pages of a citation at the archives other
+// than the one it cites.
+func (c *Citation) mirrors() []string {
+	var urls []string
+	for _, url := range []string{c.Links.NCBI, c.Links.ENA, c.Links.DDBJ} {
+		if url != c.URL {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// bibtexEscape escapes the characters special to BibTeX and LaTeX.
+func bibtexEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\textbackslash{}`,
+		"{", `\{`, "}", `\}`,
+		"&", `\&`, "%", `\%`, "$", `\$`, "#", `\#`, "_", `\_`,
+	).Replace(s)
+}
@@ -0,0 +1,180 @@
+package packaging
+
+import (
+	"fmt"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// DATS 2.2 identifiers
+const (
+	datsContext  = "https://w3id.org/dats/context/sdo/dataset_sdo_context.jsonld"
+	sraSource    = "NCBI SRA"
+	taxonSource  = "NCBI Taxonomy"
+	sraRepoName  = "NCBI Sequence Read Archive"
+	datsDataType = "nucleotide sequencing"
+)
+
+// annotation is a DATS value annotation
+func annotation(value string) entity {
+	return entity{"value": value}
+}
+
+// datsIdentifier is a DATS identifier object
+func datsIdentifier(id, source string) entity {
+	return entity{"identifier": id, "identifierSource": source}
+}
+
+// buildDATS describes the bundle as a DATS 2.2 Dataset. Samples become
+// Materials the dataset is about, and each run becomes a distribution.
+func buildDATS(b *Bundle) entity {
+	study := b.Study
+
+	dataset := entity{
+		"@context":   datsContext,
+		"@type":      "Dataset",
+		"title":      StudyTitle(study),
+		"identifier": datsIdentifier(study.StudyAccession, sraSource),
+		"types":      datsTypes(b),
+		"storedIn": entity{
+			"@type": "DataRepository",
+			"name":  sraRepoName,
+		},
+		"extraProperties": []entity{
+			{
+				"category": "generated",
+				"values":   []entity{annotation(b.GeneratedAt.Format("2006-01-02T15:04:05Z"))},
+			},
+		},
+	}
+
+	if desc := StudyDescription(study); desc != "" {
+		dataset["description"] = desc
+	}
+
+	// Creators are required; fall back to the archive when no center is recorded
+	creator := StudyCenter(study)
+	if creator == "" {
+		creator = sraRepoName
+	}
+	dataset["creators"] = []entity{{"@type": "Organization", "name": creator}}
+
+	if date := studyDate(study); date != nil {
+		dataset["dates"] = []entity{{
+			"date": date.Format("2006-01-02"),
+			"type": annotation("publication"),
+		}}
+	}
+
+	if kw := keywords(b); len(kw) > 0 {
+		var values []entity
+		for _, k := range kw {
+			values = append(values, annotation(k))
+		}
+		dataset["keywords"] = values
+	}
+
+	var about []entity
+	taxa := make(map[int]bool)
+	for _, s := range b.Samples {
+		about = append(about, datsMaterial(s))
+		if s.TaxonID > 0 && !taxa[s.TaxonID] {
+			taxa[s.TaxonID] = true
+			about = append(about, datsTaxon(s))
+		}
+	}
+	if len(about) > 0 {
+		dataset["isAbout"] = about
+	}
+
+	var distributions []entity
+	for _, r := range b.Runs {
+		distributions = append(distributions, entity{
+			"@type":      "DatasetDistribution",
+			"identifier": datsIdentifier(r.RunAccession, sraSource),
+			"title":      r.RunAccession,
+			"formats":    []string{"SRA"},
+			"access": entity{
+				"@type":       "Access",
+				"landingPage": recordURL(r.RunAccession),
+				"accessURL":   runDataURL(r.RunAccession),
+			},
+		})
+	}
+	if len(distributions) > 0 {
+		dataset["distributions"] = distributions
+	}
+
+	if study.Curation != nil && study.Curation.Notes != "" {
+		props := dataset["extraProperties"].([]entity)
+		dataset["extraProperties"] = append(props, entity{
+			"category": "curation notes",
+			"values":   []entity{annotation(study.Curation.Notes)},
+		})
+	}
+
+	return dataset
+}
+
+// datsTypes describes the data type, sequencing methods, and platforms of the study.
+func datsTypes(b *Bundle) []entity {
+	information := b.Study.StudyType
+	if information == "" {
+		information = datsDataType
+	}
+
+	var platforms []string
+	for _, e := range b.Experiments {
+		platforms = append(platforms, e.Platform)
+	}
+
+	types := []entity{{"information": annotation(information)}}
+	for _, strategy := range libraryStrategies(b) {
+		types = append(types, entity{"method": annotation(strategy)})
+	}
+	for _, platform := range distinct(platforms) {
+		types = append(types, entity{"platform": annotation(platform)})
+	}
+	return types
+}
+
+// datsMaterial describes a sample as a DATS Material.
+func datsMaterial(s *database.Sample) entity {
+	material := entity{
+		"@type":      "Material",
+		"name":       firstNonEmpty(s.Title, s.SampleAccession),
+		"identifier": datsIdentifier(s.SampleAccession, sraSource),
+	}
+	if s.Description != "" {
+		material["description"] = s.Description
+	}
+	if s.BiosampleAccession != "" {
+		material["alternateIdentifiers"] = []entity{datsIdentifier(s.BiosampleAccession, "NCBI BioSample")}
+	}
+	if s.TaxonID > 0 {
+		material["taxonomy"] = []entity{datsTaxon(s)}
+	}
+
+	var characteristics []entity
+	for _, c := range sampleCharacteristics(s) {
+		characteristics = append(characteristics, entity{
+			"@type":  "Dimension",
+			"name":   annotation(c.name),
+			"values": []string{c.value},
+		})
+	}
+	if len(characteristics) > 0 {
+		material["characteristics"] = characteristics
+	}
+
+	return material
+}
+
+// datsTaxon describes the taxon of a sample as DATS TaxonomicInformation.
+func datsTaxon(s *database.Sample) entity {
+	return entity{
+		"@type":      "TaxonomicInformation",
+		"name":       firstNonEmpty(s.ScientificName, s.Organism),
+		"identifier": datsIdentifier(fmt.Sprintf("NCBITaxon:%d", s.TaxonID), taxonSource),
+	}
+}
@@ -0,0 +1,272 @@
+// Package packaging builds standards-based metadata packages (RO-Crate, DATS)
+// describing an SRA study together with its samples and runs, for deposition in
+// institutional repositories and FAIR compliance reporting.
+package packaging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// Supported package formats
+const (
+	FormatROCrate = "ro-crate"
+	FormatDATS    = "dats"
+)
+
+// Formats lists the supported package formats.
+func Formats() []string {
+	return []string{FormatROCrate, FormatDATS}
+}
+
+// ValidFormat reports whether format names a supported package format.
+func ValidFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case FormatROCrate, "rocrate", FormatDATS:
+		return true
+	}
+	return false
+}
+
+// Bundle is the record graph of a study that a package describes.
+type Bundle struct {
+	Study       *database.Study
+	Experiments []*database.Experiment
+	Samples     []*database.Sample
+	Runs        []*database.Run
+
+	// ExperimentSamples maps experiment accessions to the samples they sequenced.
+	ExperimentSamples map[string][]string
+
+	// BioProject is the BioProject accession of the study, if known.
+	BioProject string
+
+	// Access is the access level of the study: controlled when the study
+	// or one of its runs is, with the consent group it was released under.
+	// Nil when unknown, which is taken as public.
+	Access *database.RecordAccess
+
+	// GeneratedAt is recorded in the package; defaults to the current time.
+	GeneratedAt time.Time
+}
+
+// Build creates a package document for the bundle in the given format.
+func Build(format string, b *Bundle) (interface{}, error) {
+	if b == nil || b.Study == nil {
+		return nil, fmt.Errorf("bundle has no study")
+	}
+	if b.GeneratedAt.IsZero() {
+		b.GeneratedAt = time.Now().UTC()
+	}
+
+	if !ValidFormat(format) {
+		return nil, fmt.Errorf("unsupported package format: %s (supported: %s)",
+			format, strings.Join(Formats(), ", "))
+	}
+
+	if strings.ToLower(format) == FormatDATS {
+		return buildDATS(b), nil
+	}
+	return buildROCrate(b), nil
+}
+
+// Write builds a package and writes it as indented JSON.
+func Write(w io.Writer, format string, b *Bundle) error {
+	doc, err := Build(format, b)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// DefaultFilename returns the conventional file name for a package format.
+func DefaultFilename(format string) string {
+	if strings.ToLower(format) == FormatDATS {
+		return "DATS.json"
+	}
+	return "ro-crate-metadata.json"
+}
+
+// recordURL returns the NCBI SRA landing page for an accession.
+func recordURL(accession string) string {
+	return "https://www.ncbi.nlm.nih.gov/sra/" + accession
+}
+
+// biosampleURL returns the NCBI BioSample landing page for an accession.
+func biosampleURL(accession string) string {
+	return "https://www.ncbi.nlm.nih.gov/biosample/" + accession
+}
+
+// runDataURL returns the public cloud location of a run's SRA data file.
+func runDataURL(accession string) string {
+	return fmt.Sprintf("https://sra-pub-run-odp.s3.amazonaws.com/sra/%s/%s", accession, accession)
+}
+
+// taxonURL returns the NCBI Taxonomy term for a taxon ID.
+func taxonURL(taxonID int) string {
+	return fmt.Sprintf("http://purl.obolibrary.org/obo/NCBITaxon_%d", taxonID)
+}
+
+// StudyTitle prefers a locally curated title over the upstream one.
+func StudyTitle(s *database.Study) string {
+	if s.Curation != nil && s.Curation.CuratedTitle != "" {
+		return s.Curation.CuratedTitle
+	}
+	if s.StudyTitle != "" {
+		return s.StudyTitle
+	}
+	return s.StudyAccession
+}
+
+// StudyDescription returns the abstract, falling back to the description.
+func StudyDescription(s *database.Study) string {
+	if s.StudyAbstract != "" {
+		return s.StudyAbstract
+	}
+	return s.StudyDescription
+}
+
+// StudyCenter returns the submitting center from the study record or its metadata.
+func StudyCenter(s *database.Study) string {
+	if s.CenterName != "" {
+		return s.CenterName
+	}
+	return metadataString(s.Metadata, "center_name")
+}
+
+// studyDate returns the best available publication date of a study.
+func studyDate(s *database.Study) *time.Time {
+	if s.FirstPublic != nil {
+		return s.FirstPublic
+	}
+	return s.SubmissionDate
+}
+
+// keywords collects distinct study-level keywords: study type, organisms,
+// library strategies, and curated tags.
+func keywords(b *Bundle) []string {
+	values := []string{b.Study.StudyType, b.Study.Organism}
+	for _, s := range b.Samples {
+		values = append(values, s.Organism)
+	}
+	values = append(values, libraryStrategies(b)...)
+	if b.Study.Curation != nil {
+		values = append(values, b.Study.Curation.Tags...)
+	}
+	return distinct(values)
+}
+
+// libraryStrategies collects the distinct library strategies of the study's experiments.
+func libraryStrategies(b *Bundle) []string {
+	var values []string
+	for _, e := range b.Experiments {
+		values = append(values, e.LibraryStrategy)
+	}
+	return distinct(values)
+}
+
+// experimentsByAccession indexes experiments by accession.
+func experimentsByAccession(b *Bundle) map[string]*database.Experiment {
+	index := make(map[string]*database.Experiment, len(b.Experiments))
+	for _, e := range b.Experiments {
+		index[e.ExperimentAccession] = e
+	}
+	return index
+}
+
+// characteristic is a named sample property
+type characteristic struct {
+	name  string
+	value string
+}
+
+// sampleCharacteristics lists the populated descriptive fields of a sample.
+func sampleCharacteristics(s *database.Sample) []characteristic {
+	fields := []characteristic{
+		{"tissue", s.Tissue},
+		{"cell type", s.CellType},
+		{"cell line", s.CellLine},
+		{"strain", s.Strain},
+		{"sex", s.Sex},
+		{"age", s.Age},
+		{"disease", s.Disease},
+		{"treatment", s.Treatment},
+		{"geographic location", s.GeoLocName},
+		{"collection date", s.CollectionDate},
+	}
+
+	var out []characteristic
+	for _, f := range fields {
+		if f.value != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// experimentSummary describes how a run was sequenced.
+func experimentSummary(e *database.Experiment) string {
+	parts := []string{e.ExperimentAccession}
+	for _, v := range []string{e.LibraryStrategy, e.LibrarySource, e.Platform, e.InstrumentModel} {
+		if v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// slug turns a label into an identifier fragment.
+func slug(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// metadataString reads a top-level string field from a JSON metadata blob.
+func metadataString(metadata, key string) string {
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(metadata), &fields) != nil {
+		return ""
+	}
+	s, _ := fields[key].(string)
+	return s
+}
+
+// distinct returns the non-empty values in sorted order without duplicates.
+func distinct(values []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,257 @@
+package packaging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+func testBundle() *Bundle {
+	published := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	return &Bundle{
+		Study: &database.Study{
+			StudyAccession: "SRP000001",
+			StudyTitle:     "Liver RNA-Seq",
+			StudyAbstract:  "Expression profiling of liver tissue",
+			StudyType:      "Transcriptome Analysis",
+			SubmissionDate: &published,
+			Metadata:       `{"center_name":"Example Lab"}`,
+		},
+		Experiments: []*database.Experiment{
+			{ExperimentAccession: "SRX000001", LibraryStrategy: "RNA-Seq", Platform: "ILLUMINA"},
+		},
+		Samples: []*database.Sample{
+			{SampleAccession: "SRS000001", TaxonID: 9606, ScientificName: "Homo sapiens", Tissue: "liver"},
+		},
+		Runs: []*database.Run{
+			{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"},
+		},
+		ExperimentSamples: map[string][]string{"SRX000001": {"SRS000001"}},
+		GeneratedAt:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// graphByID indexes the entities of an RO-Crate graph
+func graphByID(t *testing.T, doc map[string]interface{}) map[string]map[string]interface{} {
+	t.Helper()
+	graph, ok := doc["@graph"].([]interface{})
+	if !ok {
+		t.Fatalf("missing @graph")
+	}
+	index := make(map[string]map[string]interface{})
+	for _, node := range graph {
+		e := node.(map[string]interface{})
+		index[e["@id"].(string)] = e
+	}
+	return index
+}
+
+func decodePackage(t *testing.T, format string) map[string]interface{} {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, format, testBundle()); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return doc
+}
+
+func TestROCrate(t *testing.T) {
+	doc := decodePackage(t, FormatROCrate)
+	graph := graphByID(t, doc)
+
+	descriptor := graph["ro-crate-metadata.json"]
+	if descriptor == nil {
+		t.Fatal("missing metadata descriptor")
+	}
+	if conforms := descriptor["conformsTo"].(map[string]interface{}); conforms["@id"] != roCrateSpec {
+		t.Errorf("unexpected conformsTo: %v", conforms)
+	}
+
+	root := graph["./"]
+	if root == nil {
+		t.Fatal("missing root dataset")
+	}
+	if root["name"] != "Liver RNA-Seq" || root["datePublished"] != "2020-05-01" {
+		t.Errorf("unexpected root dataset: %v", root)
+	}
+	if creator := root["creator"].(map[string]interface{}); graph[creator["@id"].(string)]["name"] != "Example Lab" {
+		t.Errorf("expected creator from study metadata, got %v", creator)
+	}
+
+	// Every referenced part must be described in the graph
+	for _, part := range root["hasPart"].([]interface{}) {
+		id := part.(map[string]interface{})["@id"].(string)
+		file := graph[id]
+		if file == nil || file["@type"] != "File" {
+			t.Errorf("hasPart %s is not a File entity", id)
+		}
+	}
+
+	sample := graph[recordURL("SRS000001")]
+	if sample == nil || sample["@type"] != "BioSample" {
+		t.Fatalf("missing sample entity: %v", sample)
+	}
+	if graph[taxonURL(9606)] == nil {
+		t.Error("missing taxon entity")
+	}
+}
+
+func TestDATS(t *testing.T) {
+	doc := decodePackage(t, FormatDATS)
+
+	if doc["@type"] != "Dataset" || doc["title"] != "Liver RNA-Seq" {
+		t.Errorf("unexpected dataset: %v", doc)
+	}
+	for _, field := range []string{"types", "creators", "distributions", "isAbout", "dates"} {
+		if _, ok := doc[field]; !ok {
+			t.Errorf("missing %s", field)
+		}
+	}
+
+	dist := doc["distributions"].([]interface{})[0].(map[string]interface{})
+	access := dist["access"].(map[string]interface{})
+	if access["accessURL"] != runDataURL("SRR000001") {
+		t.Errorf("unexpected access URL: %v", access["accessURL"])
+	}
+}
+
+func TestCuratedTitle(t *testing.T) {
+	b := testBundle()
+	b.Study.Curation = &database.Curation{CuratedTitle: "Curated", Tags: []string{"my-cohort"}}
+
+	doc, err := Build(FormatROCrate, b)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	root := doc.(entity)["@graph"].([]entity)[1]
+	if root["name"] != "Curated" {
+		t.Errorf("expected curated title, got %v", root["name"])
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	if _, err := Build("xml", testBundle()); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+	if _, err := Build(FormatROCrate, &Bundle{}); err == nil {
+		t.Error("expected error for bundle without study")
+	}
+}
+
+func TestBioschemas(t *testing.T) {
+	doc, err := BuildBioschemas(testBundle(), Catalog{
+		BaseURL:       "https://sra.example.org/",
+		PublisherName: "Example Institute",
+		License:       "https://creativecommons.org/publicdomain/zero/1.0/",
+	})
+	if err != nil {
+		t.Fatalf("BuildBioschemas failed: %v", err)
+	}
+
+	if doc["@type"] != "Dataset" || doc["name"] != "Liver RNA-Seq" {
+		t.Errorf("unexpected dataset: %v", doc)
+	}
+	if doc["url"] != "https://sra.example.org/browse/study/SRP000001" {
+		t.Errorf("unexpected canonical URL: %v", doc["url"])
+	}
+	if doc["sameAs"] != recordURL("SRP000001") {
+		t.Errorf("expected sameAs to point at SRA, got %v", doc["sameAs"])
+	}
+	if publisher := doc["publisher"].(entity); publisher["name"] != "Example Institute" {
+		t.Errorf("unexpected publisher: %v", publisher)
+	}
+	if len(doc["distribution"].([]entity)) != 1 {
+		t.Errorf("expected one distribution, got %v", doc["distribution"])
+	}
+
+	// Without a catalog the SRA record is canonical
+	doc, _ = BuildBioschemas(testBundle(), Catalog{})
+	if doc["url"] != recordURL("SRP000001") || doc["sameAs"] != nil {
+		t.Errorf("unexpected default URLs: %v, %v", doc["url"], doc["sameAs"])
+	}
+
+	b := testBundle()
+	b.Study.StudyAbstract = ""
+	doc, _ = BuildBioschemas(b, Catalog{})
+	if desc, _ := doc["description"].(string); desc == "" {
+		t.Error("expected generated description")
+	}
+	if doc["isAccessibleForFree"] != true || doc["conditionsOfAccess"] != nil {
+		t.Errorf("expected open access, got %v, %v", doc["isAccessibleForFree"], doc["conditionsOfAccess"])
+	}
+
+	// Controlled data are not free to access, and name their consent group
+	b.Access = &database.RecordAccess{Accession: "SRP000001", Access: database.AccessControlled, Consent: "GRU"}
+	doc, _ = BuildBioschemas(b, Catalog{})
+	if doc["isAccessibleForFree"] != false {
+		t.Errorf("expected controlled access, got %v", doc["isAccessibleForFree"])
+	}
+	if conditions, _ := doc["conditionsOfAccess"].(string); !strings.Contains(conditions, "GRU") {
+		t.Errorf("expected the consent group in the conditions, got %q", conditions)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	links := Links("drp000001")
+	if links.NCBI != "https://www.ncbi.nlm.nih.gov/sra/DRP000001" ||
+		links.ENA != "https://www.ebi.ac.uk/ena/browser/view/DRP000001" ||
+		links.DDBJ != "https://ddbj.nig.ac.jp/resource/sra-study/DRP000001" {
+		t.Errorf("unexpected links %+v", links)
+	}
+	if got := Links("PRJNA12345").NCBI; got != "https://www.ncbi.nlm.nih.gov/bioproject/PRJNA12345" {
+		t.Errorf("unexpected BioProject link %s", got)
+	}
+	if name, url := Archive("ERR000001"); name != "European Nucleotide Archive" || url != Links("ERR000001").ENA {
+		t.Errorf("unexpected archive %s %s", name, url)
+	}
+}
+
+func TestCitation(t *testing.T) {
+	b := testBundle()
+	b.BioProject = "PRJNA000001"
+	b.Runs = append(b.Runs, &database.Run{RunAccession: "SRR000002", ExperimentAccession: "SRX000002"})
+
+	c, err := NewCitation("SRS000001", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.StudyAccession != "SRP000001" || len(c.Runs) != 1 || c.Runs[0] != "SRR000001" {
+		t.Errorf("unexpected citation %+v", c)
+	}
+
+	c, _ = NewCitation("SRP000001", b)
+	text := c.Text()
+	for _, want := range []string{
+		"Example Lab (2020). Liver RNA-Seq. NCBI Sequence Read Archive, accession SRP000001 (BioProject PRJNA000001).",
+		"Released 2020-05-01.",
+		"comprising 2 runs (SRR000001, SRR000002)",
+		"https://www.ebi.ac.uk/ena/browser/view/SRP000001",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text citation missing %q:\n%s", want, text)
+		}
+	}
+
+	b.Study.StudyTitle = "Liver RNA-Seq of 50% of mice"
+	c, _ = NewCitation("SRP000001", b)
+	var buf bytes.Buffer
+	if err := WriteCitation(&buf, StyleBibTeX, c); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"@misc{SRP000001,", `title = {{Liver RNA-Seq of 50\% of mice}}`, "year = {2020}", "url = {https://www.ncbi.nlm.nih.gov/sra/SRP000001}"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("BibTeX citation missing %q:\n%s", want, buf.String())
+		}
+	}
+	if err := WriteCitation(&buf, "apa", c); err == nil {
+		t.Error("expected an error for an unsupported style")
+	}
+}
@@ -0,0 +1,170 @@
+package packaging
+
+import (
+	"fmt"
+)
+
+// RO-Crate 1.1 identifiers
+const (
+	roCrateContext = "https://w3id.org/ro/crate/1.1/context"
+	roCrateSpec    = "https://w3id.org/ro/crate/1.1"
+	sraURL         = "https://www.ncbi.nlm.nih.gov/sra"
+)
+
+// entity is a flattened JSON-LD node
+type entity = map[string]interface{}
+
+// ref is a JSON-LD reference to another entity in the graph
+func ref(id string) entity {
+	return entity{"@id": id}
+}
+
+// buildROCrate describes the bundle as an RO-Crate 1.1 metadata document.
+// Runs are data entities pointing at their public SRA files; samples are
+// contextual entities typed with the Bioschemas BioSample profile.
+func buildROCrate(b *Bundle) entity {
+	study := b.Study
+	experiments := experimentsByAccession(b)
+
+	root := entity{
+		"@id":             "./",
+		"@type":           "Dataset",
+		"name":            StudyTitle(study),
+		"identifier":      study.StudyAccession,
+		"url":             recordURL(study.StudyAccession),
+		"publisher":       ref(sraURL),
+		"sdDatePublished": b.GeneratedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if desc := StudyDescription(study); desc != "" {
+		root["description"] = desc
+	}
+	if date := studyDate(study); date != nil {
+		root["datePublished"] = date.Format("2006-01-02")
+	}
+	if kw := keywords(b); len(kw) > 0 {
+		root["keywords"] = kw
+	}
+	if techniques := libraryStrategies(b); len(techniques) > 0 {
+		root["measurementTechnique"] = techniques
+	}
+	if study.Curation != nil && study.Curation.Notes != "" {
+		root["comment"] = study.Curation.Notes
+	}
+
+	graph := []entity{
+		{
+			"@id":        "ro-crate-metadata.json",
+			"@type":      "CreativeWork",
+			"conformsTo": ref(roCrateSpec),
+			"about":      ref("./"),
+		},
+		root,
+		{
+			"@id":   sraURL,
+			"@type": "Organization",
+			"name":  "NCBI Sequence Read Archive",
+			"url":   sraURL,
+		},
+	}
+
+	if center := StudyCenter(study); center != "" {
+		centerID := "#center-" + slug(center)
+		root["creator"] = ref(centerID)
+		graph = append(graph, entity{
+			"@id":   centerID,
+			"@type": "Organization",
+			"name":  center,
+		})
+	}
+
+	// Samples and their taxa
+	taxa := make(map[int]bool)
+	var samples, sampleRefs []entity
+	for _, s := range b.Samples {
+		sample := entity{
+			"@id":        recordURL(s.SampleAccession),
+			"@type":      "BioSample",
+			"name":       firstNonEmpty(s.Title, s.SampleAccession),
+			"identifier": s.SampleAccession,
+			"url":        recordURL(s.SampleAccession),
+		}
+		if s.Description != "" {
+			sample["description"] = s.Description
+		}
+		if s.BiosampleAccession != "" {
+			sample["sameAs"] = biosampleURL(s.BiosampleAccession)
+		}
+		if s.TaxonID > 0 {
+			sample["taxonomicRange"] = ref(taxonURL(s.TaxonID))
+			if !taxa[s.TaxonID] {
+				taxa[s.TaxonID] = true
+				graph = append(graph, entity{
+					"@id":      taxonURL(s.TaxonID),
+					"@type":    "DefinedTerm",
+					"name":     firstNonEmpty(s.ScientificName, s.Organism),
+					"termCode": fmt.Sprintf("NCBITaxon:%d", s.TaxonID),
+				})
+			}
+		}
+
+		var properties []entity
+		for _, c := range sampleCharacteristics(s) {
+			id := fmt.Sprintf("#%s-%s", s.SampleAccession, slug(c.name))
+			properties = append(properties, ref(id))
+			graph = append(graph, entity{
+				"@id":   id,
+				"@type": "PropertyValue",
+				"name":  c.name,
+				"value": c.value,
+			})
+		}
+		if len(properties) > 0 {
+			sample["additionalProperty"] = properties
+		}
+
+		samples = append(samples, sample)
+		sampleRefs = append(sampleRefs, ref(recordURL(s.SampleAccession)))
+	}
+	if len(sampleRefs) > 0 {
+		root["about"] = sampleRefs
+	}
+	graph = append(graph, samples...)
+
+	// Runs as data entities
+	var parts []entity
+	for _, r := range b.Runs {
+		file := entity{
+			"@id":        runDataURL(r.RunAccession),
+			"@type":      "File",
+			"name":       r.RunAccession,
+			"identifier": r.RunAccession,
+			"url":        recordURL(r.RunAccession),
+		}
+		if exp, ok := experiments[r.ExperimentAccession]; ok {
+			file["description"] = experimentSummary(exp)
+		}
+		if sampleAccs := b.ExperimentSamples[r.ExperimentAccession]; len(sampleAccs) > 0 {
+			var about []entity
+			for _, acc := range sampleAccs {
+				about = append(about, ref(recordURL(acc)))
+			}
+			file["about"] = about
+		}
+		parts = append(parts, ref(runDataURL(r.RunAccession)))
+		graph = append(graph, file)
+	}
+	if len(parts) > 0 {
+		root["hasPart"] = parts
+	}
+
+	return entity{
+		"@context": []interface{}{
+			roCrateContext,
+			map[string]string{
+				"BioSample":      "https://bioschemas.org/BioSample",
+				"taxonomicRange": "https://bioschemas.org/terms/taxonomicRange",
+			},
+		},
+		"@graph": graph,
+	}
+}
@@ -0,0 +1,26 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// FreeSpace returns the bytes free to the user on the volume that holds
+// path, which need not exist yet: its nearest existing parent is asked
+func FreeSpace(path string) (int64, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return freeSpace(dir)
+}
@@ -99,6 +99,35 @@ func GetResumePath() string {
 	return filepath.Join(GetPaths().StateDir, "resume")
 }
 
+// GetIngestControlPath returns the path of the control socket of a running ingest
+func GetIngestControlPath() string {
+	return filepath.Join(GetPaths().StateDir, "ingest.sock")
+}
+
+// GetJobsPath returns the path to the background job results directory
+func GetJobsPath() string {
+	if path := os.Getenv("SRAKE_JOBS_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(GetPaths().DataDir, "jobs")
+}
+
+// GetTemplatesPath returns the path to the query templates directory
+func GetTemplatesPath() string {
+	if path := os.Getenv("SRAKE_TEMPLATES_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(GetPaths().ConfigDir, "templates")
+}
+
+// GetRulesPath returns the path to the quality rules directory
+func GetRulesPath() string {
+	if path := os.Getenv("SRAKE_RULES_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(GetPaths().ConfigDir, "rules")
+}
+
 // EnsureDirectories creates all necessary directories
 func EnsureDirectories() error {
 	paths := GetPaths()
@@ -106,6 +135,7 @@ func EnsureDirectories() error {
 		paths.ConfigDir,
 		paths.DataDir,
 		filepath.Join(paths.DataDir, "models"),
+		filepath.Join(paths.DataDir, "jobs"),
 		paths.CacheDir,
 		filepath.Join(paths.CacheDir, "downloads"),
 		filepath.Join(paths.CacheDir, "index"),
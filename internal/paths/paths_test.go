@@ -1,6 +1,7 @@
 package paths
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -157,6 +158,56 @@ func TestGetResumePath(t *testing.T) {
 	}
 }
 
+func TestGetIngestControlPath(t *testing.T) {
+	t.Setenv("SRAKE_STATE_HOME", "/custom/state")
+	path := GetIngestControlPath()
+	if path != "/custom/state/ingest.sock" {
+		t.Errorf("expected '/custom/state/ingest.sock', got %q", path)
+	}
+}
+
+func TestGetJobsPath(t *testing.T) {
+	path := GetJobsPath()
+	if path == "" {
+		t.Error("GetJobsPath should not return empty string")
+	}
+	if !strings.HasSuffix(path, "jobs") {
+		t.Errorf("expected path to end with 'jobs', got %q", path)
+	}
+}
+
+func TestGetJobsPathWithEnv(t *testing.T) {
+	t.Setenv("SRAKE_JOBS_PATH", "/custom/jobs")
+	path := GetJobsPath()
+	if path != "/custom/jobs" {
+		t.Errorf("expected '/custom/jobs', got %q", path)
+	}
+}
+
+func TestGetTemplatesPath(t *testing.T) {
+	t.Setenv("SRAKE_CONFIG_HOME", "/custom/config")
+	if path := GetTemplatesPath(); path != "/custom/config/templates" {
+		t.Errorf("expected '/custom/config/templates', got %q", path)
+	}
+
+	t.Setenv("SRAKE_TEMPLATES_PATH", "/shared/templates")
+	if path := GetTemplatesPath(); path != "/shared/templates" {
+		t.Errorf("expected '/shared/templates', got %q", path)
+	}
+}
+
+func TestGetRulesPath(t *testing.T) {
+	t.Setenv("SRAKE_CONFIG_HOME", "/custom/config")
+	if path := GetRulesPath(); path != "/custom/config/rules" {
+		t.Errorf("expected '/custom/config/rules', got %q", path)
+	}
+
+	t.Setenv("SRAKE_RULES_PATH", "/shared/rules")
+	if path := GetRulesPath(); path != "/shared/rules" {
+		t.Errorf("expected '/shared/rules', got %q", path)
+	}
+}
+
 func TestEnsureDirectories(t *testing.T) {
 	// Use temp directory to avoid polluting the filesystem
 	dir := t.TempDir()
@@ -210,3 +261,14 @@ func TestEmbeddingsPathAdjacentToDatabase(t *testing.T) {
 		t.Errorf("expected embeddings path %q, got %q", expected, path)
 	}
 }
+
+func TestFreeSpace(t *testing.T) {
+	// A path that does not exist yet is measured on its nearest parent
+	free, err := FreeSpace(filepath.Join(t.TempDir(), "missing", "srake.db"))
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("free space is not supported on this platform")
+	}
+	if err != nil || free <= 0 {
+		t.Errorf("expected free space, got %d (%v)", free, err)
+	}
+}
@@ -0,0 +1,189 @@
+// Package plan describes what a long-running or destructive command would
+// do without doing it. Commands given --dry-run build a Plan of the data
+// they would read, the files and tables they would write and the steps
+// they would take, and print it for review in change-managed environments.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of Write
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatText = "text"
+)
+
+// Table access modes, from least to most invasive
+const (
+	AccessRead   = "read"
+	AccessWrite  = "write"
+	AccessDelete = "delete"
+)
+
+// Plan is what one invocation of a command would do
+type Plan struct {
+	Command     string   `json:"command" yaml:"command"`
+	Database    string   `json:"database,omitempty" yaml:"database,omitempty"`
+	Sources     []Source `json:"sources,omitempty" yaml:"sources,omitempty"`
+	Outputs     []Output `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	Tables      []Table  `json:"tables,omitempty" yaml:"tables,omitempty"`
+	Steps       []Step   `json:"steps" yaml:"steps"`
+	Destructive bool     `json:"destructive" yaml:"destructive"` // some step removes or replaces data
+}
+
+// Source is data the command would read
+type Source struct {
+	Name     string `json:"name" yaml:"name"`
+	Location string `json:"location" yaml:"location"` // path or URL
+	Bytes    int64  `json:"bytes,omitempty" yaml:"bytes,omitempty"`
+}
+
+// Output is a file or directory the command would write
+type Output struct {
+	Path           string `json:"path" yaml:"path"`
+	EstimatedBytes int64  `json:"estimated_bytes,omitempty" yaml:"estimated_bytes,omitempty"`
+	Exists         bool   `json:"exists" yaml:"exists"` // and would be replaced or added to
+}
+
+// Table is a database table the command would touch. Rows is the number
+// of rows read, written or deleted when it can be told in advance.
+type Table struct {
+	Name   string `json:"name" yaml:"name"`
+	Access string `json:"access" yaml:"access"`
+	Rows   int64  `json:"rows,omitempty" yaml:"rows,omitempty"`
+}
+
+// Step is one action of the command, in the order they would run
+type Step struct {
+	Action      string `json:"action" yaml:"action"`
+	Destructive bool   `json:"destructive,omitempty" yaml:"destructive,omitempty"`
+}
+
+// New returns an empty plan of a command, such as "srake ingest"
+func New(command string) *Plan {
+	return &Plan{Command: command, Steps: []Step{}}
+}
+
+// ValidFormat reports whether format is an output format of Write
+func ValidFormat(format string) bool {
+	return format == FormatJSON || format == FormatYAML || format == FormatText
+}
+
+// AddSource adds data the command would read
+func (p *Plan) AddSource(name, location string, bytes int64) {
+	p.Sources = append(p.Sources, Source{Name: name, Location: location, Bytes: bytes})
+}
+
+// AddOutput adds a file or directory the command would write, noting
+// whether it already exists
+func (p *Plan) AddOutput(path string, estimatedBytes int64) {
+	_, err := os.Stat(path)
+	p.Outputs = append(p.Outputs, Output{Path: path, EstimatedBytes: estimatedBytes, Exists: err == nil})
+}
+
+// AddTable adds a table the command would touch; rows is 0 when unknown
+func (p *Plan) AddTable(name, access string, rows int64) {
+	p.Tables = append(p.Tables, Table{Name: name, Access: access, Rows: rows})
+}
+
+// AddStep adds the next step of the command
+func (p *Plan) AddStep(format string, args ...interface{}) {
+	p.Steps = append(p.Steps, Step{Action: fmt.Sprintf(format, args...)})
+}
+
+// AddDestructiveStep adds the next step of the command, one that removes
+// or replaces data, and marks the plan destructive
+func (p *Plan) AddDestructiveStep(format string, args ...interface{}) {
+	p.Steps = append(p.Steps, Step{Action: fmt.Sprintf(format, args...), Destructive: true})
+	p.Destructive = true
+}
+
+// Write prints the plan to w as JSON, YAML or text
+func (p *Plan) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case FormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+		return enc.Close()
+	case FormatText:
+		return p.writeText(w)
+	}
+	return fmt.Errorf("invalid plan format: %s (must be json, yaml or text)", format)
+}
+
+func (p *Plan) writeText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan for %s", p.Command)
+	if p.Destructive {
+		b.WriteString(" (destructive)")
+	}
+	b.WriteString("\n")
+	if p.Database != "" {
+		fmt.Fprintf(&b, "\nDatabase: %s\n", p.Database)
+	}
+	if len(p.Sources) > 0 {
+		b.WriteString("\nSources:\n")
+		for _, s := range p.Sources {
+			fmt.Fprintf(&b, "  %s  %s%s\n", s.Name, s.Location, sizeSuffix(s.Bytes, ""))
+		}
+	}
+	if len(p.Outputs) > 0 {
+		b.WriteString("\nOutputs:\n")
+		for _, o := range p.Outputs {
+			exists := ""
+			if o.Exists {
+				exists = " [exists]"
+			}
+			fmt.Fprintf(&b, "  %s%s%s\n", o.Path, sizeSuffix(o.EstimatedBytes, "~"), exists)
+		}
+	}
+	if len(p.Tables) > 0 {
+		b.WriteString("\nTables:\n")
+		for _, t := range p.Tables {
+			rows := ""
+			if t.Rows > 0 {
+				rows = fmt.Sprintf(" (%d rows)", t.Rows)
+			}
+			fmt.Fprintf(&b, "  %-6s  %s%s\n", t.Access, t.Name, rows)
+		}
+	}
+	b.WriteString("\nSteps:\n")
+	for i, s := range p.Steps {
+		marker := ""
+		if s.Destructive {
+			marker = " [destructive]"
+		}
+		fmt.Fprintf(&b, "  %d. %s%s\n", i+1, s.Action, marker)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// sizeSuffix formats a byte count for the text plan, or "" when unknown
+func sizeSuffix(bytes int64, prefix string) string {
+	if bytes <= 0 {
+		return ""
+	}
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size, unit := float64(bytes), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf(" (%s%.1f %s)", prefix, size, units[unit])
+}
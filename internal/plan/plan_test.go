@@ -0,0 +1,79 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func testPlan(t *testing.T) *Plan {
+	t.Helper()
+	existing := filepath.Join(t.TempDir(), "out.sqlite")
+	if err := os.WriteFile(existing, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New("srake db export")
+	p.Database = "/data/srake.db"
+	p.AddSource("database", "/data/srake.db", 3<<30)
+	p.AddOutput(existing, 2<<30)
+	p.AddTable("runs", AccessRead, 1000)
+	p.AddStep("Copy %d runs", 1000)
+	p.AddDestructiveStep("Replace %s", existing)
+	return p
+}
+
+func TestPlanJSON(t *testing.T) {
+	p := testPlan(t)
+	if !p.Destructive || !p.Outputs[0].Exists {
+		t.Fatalf("expected a destructive plan replacing an existing output: %+v", p)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var got Plan
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON plan: %v\n%s", err, buf.String())
+	}
+	if got.Command != "srake db export" || len(got.Steps) != 2 || !got.Steps[1].Destructive || got.Tables[0].Rows != 1000 {
+		t.Errorf("unexpected plan: %+v", got)
+	}
+}
+
+func TestPlanYAML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testPlan(t).Write(&buf, FormatYAML); err != nil {
+		t.Fatal(err)
+	}
+	var got Plan
+	if err := yaml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid YAML plan: %v\n%s", err, buf.String())
+	}
+	if got.Sources[0].Bytes != 3<<30 || !got.Destructive {
+		t.Errorf("unexpected plan: %+v", got)
+	}
+}
+
+func TestPlanText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testPlan(t).Write(&buf, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Plan for srake db export (destructive)", "(3.0 GB)", "(~2.0 GB) [exists]", "read    runs (1000 rows)", "2. Replace"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("text plan lacks %q:\n%s", want, out)
+		}
+	}
+
+	if err := New("x").Write(&buf, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
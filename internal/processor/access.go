@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/parser"
+)
+
+// AccessStore is implemented by databases that record the access level
+// of ingested records.
+type AccessStore interface {
+	SetRecordAccess(accessions []string, hints []database.RecordAccess) error
+}
+
+// consentTags name attributes holding the consent group a record was
+// released under, most specific first. dbGaP BioSamples carry
+// gap_consent_short_name (e.g. GRU) and gap_consent_code.
+var consentTags = []string{"gap_consent_short_name", "consent", "consent_group", "data_use_limitation", "gap_consent_code"}
+
+// accessTags name attributes stating an access level directly
+var accessTags = map[string]bool{"access": true, "access_level": true, "data_access": true, "visibility": true}
+
+// dbGaPTags name attributes holding a dbGaP study accession
+var dbGaPTags = map[string]bool{"gap_accession": true, "dbgap_study_accession": true, "dbgap_accession": true}
+
+// ExtractAccess looks for access-level hints in a record: dbGaP
+// cross-references and identifiers, consent attributes, and attributes
+// stating an access level. It returns an empty access if the record has
+// none, and controlled if any hint restricts access.
+func ExtractAccess(identifiers *parser.Identifiers, links []parser.Link, attributes []parser.Attribute) (access, consent string) {
+	controlled := false
+	public := false
+
+	if identifiers != nil {
+		for _, id := range identifiers.ExternalIDs {
+			if strings.EqualFold(id.Namespace, "dbgap") || isDbGaPAccession(id.Value) {
+				controlled = true
+			}
+		}
+	}
+	for _, link := range links {
+		if link.XRefLink != nil && (strings.EqualFold(link.XRefLink.DB, "dbgap") || isDbGaPAccession(link.XRefLink.ID)) {
+			controlled = true
+		}
+	}
+
+	values := make(map[string]string)
+	for _, attr := range attributes {
+		tag := normalizeTag(attr.Tag)
+		value := strings.TrimSpace(attr.Value)
+		if value == "" {
+			continue
+		}
+		if _, ok := values[tag]; !ok {
+			values[tag] = value
+		}
+		switch {
+		case accessTags[tag]:
+			switch v := strings.ToLower(value); {
+			case strings.Contains(v, "controlled") || strings.Contains(v, "restricted") ||
+				strings.Contains(v, "protected") || strings.Contains(v, "dbgap"):
+				controlled = true
+			case isOpenConsent(v):
+				public = true
+			}
+		case dbGaPTags[tag] && isDbGaPAccession(value):
+			controlled = true
+		}
+	}
+
+	for _, tag := range consentTags {
+		value, ok := values[tag]
+		if !ok {
+			continue
+		}
+		if isOpenConsent(strings.ToLower(value)) {
+			public = true
+			continue
+		}
+		controlled = true
+		if consent == "" {
+			consent = value
+		}
+	}
+
+	switch {
+	case controlled:
+		return database.AccessControlled, consent
+	case public:
+		return database.AccessPublic, ""
+	default:
+		return "", ""
+	}
+}
+
+// normalizeTag lowercases an attribute tag and joins its words with
+// underscores, so "Consent Group" matches consent_group
+func normalizeTag(tag string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(tag), func(r rune) bool {
+		return r == ' ' || r == '_' || r == '-'
+	}), "_")
+}
+
+// isOpenConsent reports whether a lowercased consent or access value means
+// the data is unrestricted
+func isOpenConsent(v string) bool {
+	switch v {
+	case "public", "open", "open access", "open_access", "unrestricted":
+		return true
+	}
+	return false
+}
+
+// isDbGaPAccession reports whether s is a dbGaP study accession such as
+// phs000424 or phs000424.v9.p2
+func isDbGaPAccession(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return len(s) > 3 && strings.HasPrefix(s, "phs") && s[3] >= '0' && s[3] <= '9'
+}
+
+// accessHint builds the access hint of a record, or returns nil if the
+// record has none
+func accessHint(recordType, accession string, identifiers *parser.Identifiers, links []parser.Link, attributes []parser.Attribute) *database.RecordAccess {
+	access, consent := ExtractAccess(identifiers, links, attributes)
+	if access == "" {
+		return nil
+	}
+	return &database.RecordAccess{Accession: accession, RecordType: recordType, Access: access, Consent: consent}
+}
+
+// recordAccess replaces the access hints of ingested records. Failures are
+// logged, not fatal.
+func (sp *StreamProcessor) recordAccess(db Database, accessions []string, hints []database.RecordAccess) {
+	store, ok := db.(AccessStore)
+	if !ok || len(accessions) == 0 {
+		return
+	}
+	if err := store.SetRecordAccess(accessions, hints); err != nil {
+		fmt.Printf("Warning: failed to record access levels: %v\n", err)
+	}
+}
@@ -653,6 +653,86 @@ func TestAttributeExtraction(t *testing.T) {
 }
 
 // TestBatchExtraction tests batch extraction operations
+// TestCenterTransforms tests per-center attribute rewriting during extraction
+func TestCenterTransforms(t *testing.T) {
+	transforms, err := ParseTransforms([]byte(`
+centers:
+  - center: Packed Center
+    rules:
+      - tag: characteristics
+        split: ';\s*'
+        key_value: '^\s*([^=]+?)\s*=\s*(.*?)\s*$'
+      - rename:
+          Organism Part: tissue
+          cell type: cell_type
+`))
+	if err != nil {
+		t.Fatalf("ParseTransforms failed: %v", err)
+	}
+
+	extractor := NewComprehensiveExtractor(nil, ExtractionOptions{
+		ExtractAttributes:     true,
+		ExtractFromAttributes: true,
+		Transforms:            transforms,
+	})
+
+	packed := &parser.SampleAttributes{
+		Attributes: []parser.Attribute{
+			{Tag: "characteristics", Value: "organism part=liver; cell type = hepatocyte; untagged"},
+			{Tag: "sex", Value: "female"},
+		},
+	}
+
+	dbSample := extractor.extractSampleData(parser.Sample{
+		Accession:        "SRS000001",
+		CenterName:       "PACKED CENTER",
+		SampleAttributes: packed,
+	})
+	if dbSample.Tissue != "liver" || dbSample.CellType != "hepatocyte" || dbSample.Sex != "female" {
+		t.Errorf("expected unpacked fields, got tissue=%q cell_type=%q sex=%q",
+			dbSample.Tissue, dbSample.CellType, dbSample.Sex)
+	}
+
+	var attrs []map[string]string
+	if err := json.Unmarshal([]byte(dbSample.SampleAttributes), &attrs); err != nil {
+		t.Fatalf("invalid attributes JSON: %v", err)
+	}
+	if len(attrs) != 4 || attrs[2]["tag"] != "characteristics" || attrs[2]["value"] != "untagged" {
+		t.Errorf("unexpected transformed attributes: %v", attrs)
+	}
+
+	// Other centers are not affected
+	dbSample = extractor.extractSampleData(parser.Sample{
+		Accession:        "SRS000002",
+		CenterName:       "Other Center",
+		SampleAttributes: packed,
+	})
+	if dbSample.Tissue != "" {
+		t.Errorf("expected no transform for other centers, got tissue=%q", dbSample.Tissue)
+	}
+}
+
+// TestParseTransformsErrors tests validation of transform configurations
+func TestParseTransformsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"missing center", "centers:\n  - rules:\n      - rename: {a: b}\n"},
+		{"empty rule", "centers:\n  - center: X\n    rules:\n      - tag: a\n"},
+		{"bad regex", "centers:\n  - center: X\n    rules:\n      - split: '('\n"},
+		{"key_value groups", "centers:\n  - center: X\n    rules:\n      - key_value: '(.*)'\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseTransforms([]byte(tt.config)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
 func TestBatchExtraction(t *testing.T) {
 	// TODO: Rewrite test to use new streaming ExtractExperiments method
 	t.Skip("Test needs to be updated for new streaming architecture")
@@ -1857,3 +1937,46 @@ func TestSubmissionEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+// TestFilterProfile tests loading ingest filters from a YAML profile
+func TestFilterProfile(t *testing.T) {
+	opts, err := ParseFilterProfile([]byte(`
+taxon_ids: [9606]
+organisms: [Homo sapiens]
+platforms: [illumina]
+strategies: [rnaseq]
+date_from: 2020-01-01
+date_to: 2021-12-31
+min_reads: 1000000
+`))
+	if err != nil {
+		t.Fatalf("ParseFilterProfile failed: %v", err)
+	}
+	if !opts.HasFilters() || opts.DateField != "submission" {
+		t.Errorf("expected filters with default date field, got %+v", opts)
+	}
+	if opts.Platforms[0] != "ILLUMINA" || opts.Strategies[0] != "RNA-Seq" {
+		t.Errorf("expected normalized platform and strategy, got %v %v", opts.Platforms, opts.Strategies)
+	}
+
+	rf := opts.RecordFilter()
+	if rf.DateFrom != "2020-01-01" || rf.DateTo != "2021-12-31" || rf.MinReads != 1000000 || rf.TaxonIDs[0] != 9606 {
+		t.Errorf("unexpected record filter: %+v", rf)
+	}
+
+	empty, err := ParseFilterProfile(nil)
+	if err != nil || empty.HasFilters() {
+		t.Errorf("expected empty profile without filters, got %+v, %v", empty, err)
+	}
+
+	for _, bad := range []string{
+		"date_from: 2020/01/01",
+		"taxon_id: [9606]",
+		"min_reads: 10\nmax_reads: 5",
+		"date_field: modified\ndate_from: 2020-01-01",
+	} {
+		if _, err := ParseFilterProfile([]byte(bad)); err == nil {
+			t.Errorf("expected error for profile %q", bad)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Controller pauses and resumes a running ingest. While paused, the
+// processor stops reading its input, which idles the download and frees
+// disk IO; records read so far have already been written.
+type Controller struct {
+	mu        sync.Mutex
+	paused    bool
+	resumed   chan struct{} // closed on resume
+	pausedAt  time.Time
+	pausedFor time.Duration // total time spent paused before pausedAt
+
+	// OnPause is called after the ingest is paused, e.g. to checkpoint
+	// the database
+	OnPause func()
+}
+
+// NewController creates a controller in the running state
+func NewController() *Controller {
+	return &Controller{}
+}
+
+// Pause pauses the ingest. Returns false if it was already paused.
+func (c *Controller) Pause() bool {
+	c.mu.Lock()
+	if c.paused {
+		c.mu.Unlock()
+		return false
+	}
+	c.paused = true
+	c.pausedAt = time.Now()
+	c.resumed = make(chan struct{})
+	onPause := c.OnPause
+	c.mu.Unlock()
+
+	if onPause != nil {
+		onPause()
+	}
+	return true
+}
+
+// Resume resumes a paused ingest. Returns false if it was not paused.
+func (c *Controller) Resume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return false
+	}
+	c.paused = false
+	c.pausedFor += time.Since(c.pausedAt)
+	close(c.resumed)
+	return true
+}
+
+// Toggle pauses a running ingest or resumes a paused one, and returns
+// whether it is now paused.
+func (c *Controller) Toggle() bool {
+	if c.Pause() {
+		return true
+	}
+	c.Resume()
+	return false
+}
+
+// Paused reports whether the ingest is paused
+func (c *Controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// PausedFor returns the total time the ingest has spent paused
+func (c *Controller) PausedFor() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return c.pausedFor + time.Since(c.pausedAt)
+	}
+	return c.pausedFor
+}
+
+// Wait blocks while the ingest is paused. It returns early with the
+// context's error if ctx is cancelled.
+func (c *Controller) Wait(ctx context.Context) error {
+	c.mu.Lock()
+	resumed := c.resumed
+	paused := c.paused
+	c.mu.Unlock()
+
+	if !paused {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -158,7 +158,8 @@ func (ce *ComprehensiveExtractor) extractExperimentData(exp parser.Experiment) *
 	}
 
 	if ce.options.ExtractAttributes && exp.ExperimentAttributes != nil {
-		attrs := ce.extractAttributes(exp.ExperimentAttributes.Attributes)
+		attributes := ce.options.Transforms.Apply(exp.CenterName, exp.ExperimentAttributes.Attributes)
+		attrs := ce.extractAttributes(attributes)
 		dbExp.ExperimentAttributes = marshalJSON(attrs)
 		metadata["attributes"] = attrs
 	}
@@ -122,13 +122,14 @@ func (ce *ComprehensiveExtractor) extractRunData(run parser.Run) *database.Run {
 	}
 
 	if ce.options.ExtractAttributes && run.RunAttributes != nil {
-		attrs := ce.extractAttributes(run.RunAttributes.Attributes)
+		attributes := ce.options.Transforms.Apply(run.CenterName, run.RunAttributes.Attributes)
+		attrs := ce.extractAttributes(attributes)
 		dbRun.RunAttributes = marshalJSON(attrs)
 		metadata["attributes"] = attrs
 
 		// Extract known quality metrics from attributes
 		if ce.options.ExtractFromAttributes {
-			for _, attr := range run.RunAttributes.Attributes {
+			for _, attr := range attributes {
 				switch strings.ToLower(attr.Tag) {
 				case "quality_score_mean":
 					if val, err := strconv.ParseFloat(attr.Value, 64); err == nil {
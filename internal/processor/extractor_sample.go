@@ -80,13 +80,14 @@ func (ce *ComprehensiveExtractor) extractSampleData(sample parser.Sample) *datab
 
 	// Extract attributes
 	if ce.options.ExtractAttributes && sample.SampleAttributes != nil {
-		attrs := ce.extractAttributes(sample.SampleAttributes.Attributes)
+		attributes := ce.options.Transforms.Apply(sample.CenterName, sample.SampleAttributes.Attributes)
+		attrs := ce.extractAttributes(attributes)
 		metadata["attributes"] = attrs
 		dbSample.SampleAttributes = marshalJSON(attrs)
 
 		// Extract known fields from attributes
 		if ce.options.ExtractFromAttributes {
-			for _, attr := range sample.SampleAttributes.Attributes {
+			for _, attr := range attributes {
 				switch strings.ToLower(attr.Tag) {
 				case "tissue":
 					dbSample.Tissue = attr.Value
@@ -180,7 +180,8 @@ func (ce *ComprehensiveExtractor) extractStudyData(study parser.Study) *database
 
 	// Extract attributes
 	if ce.options.ExtractAttributes && study.StudyAttributes != nil {
-		attrs := ce.extractAttributes(study.StudyAttributes.Attributes)
+		attributes := ce.options.Transforms.Apply(study.CenterName, study.StudyAttributes.Attributes)
+		attrs := ce.extractAttributes(attributes)
 		if len(attrs) > 0 {
 			metadata["attributes"] = attrs
 			dbStudy.StudyAttributes = marshalJSON(attrs)
@@ -188,7 +189,7 @@ func (ce *ComprehensiveExtractor) extractStudyData(study parser.Study) *database
 
 		// Try to extract organism from attributes if enabled
 		if ce.options.ExtractFromAttributes {
-			for _, attr := range study.StudyAttributes.Attributes {
+			for _, attr := range attributes {
 				if attr.Tag == "organism" || attr.Tag == "scientific_name" {
 					dbStudy.Organism = ce.normalizeOrganism(attr.Value)
 					break
@@ -115,7 +115,8 @@ func (ce *ComprehensiveExtractor) extractSubmissionData(submission parser.Submis
 	}
 
 	if ce.options.ExtractAttributes && submission.SubmissionAttributes != nil {
-		attrs := ce.extractAttributes(submission.SubmissionAttributes.Attributes)
+		attributes := ce.options.Transforms.Apply(submission.CenterName, submission.SubmissionAttributes.Attributes)
+		attrs := ce.extractAttributes(attributes)
 		dbSubmission.SubmissionAttributes = marshalJSON(attrs)
 		metadata["attributes"] = attrs
 	}
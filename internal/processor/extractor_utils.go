@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"strings"
 
+	"github.com/nishad/srake/internal/database"
 	"github.com/nishad/srake/internal/parser"
 )
 
@@ -23,6 +24,25 @@ func (ce *ComprehensiveExtractor) extractAttributes(attrs []parser.Attribute) []
 	return attributes
 }
 
+// sampleAttributeList converts sample attributes for the sample_attributes
+// table
+func sampleAttributeList(attrs []parser.Attribute) []database.SampleAttribute {
+	list := make([]database.SampleAttribute, len(attrs))
+	for i, attr := range attrs {
+		list[i] = database.SampleAttribute{Tag: attr.Tag, Value: attr.Value, Units: attr.Units}
+	}
+	return list
+}
+
+// attributesMetadata returns the metadata of a study or experiment, which
+// keeps its attributes for samples to inherit
+func attributesMetadata(attrs []parser.Attribute) string {
+	if len(attrs) == 0 {
+		return "{}"
+	}
+	return marshalJSON(map[string]interface{}{"attributes": sampleAttributeList(attrs)})
+}
+
 // extractLinks converts links to a map
 func (ce *ComprehensiveExtractor) extractLinks(links []parser.Link) []map[string]string {
 	var result []map[string]string
@@ -0,0 +1,28 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// TxStore is implemented by databases that can write the records of an XML
+// file in a single transaction, through the store handed to fn
+type TxStore interface {
+	WithTx(ctx context.Context, fn func(tx *database.DB) error) error
+}
+
+// inFileTx runs fn, which writes the records of one XML file to db, in a
+// single transaction when the database supports it: a file that fails part
+// way, or an ingest killed while writing it, leaves none of its records
+// rather than an experiment without its runs, so that resuming only has to
+// process it again. Writes through sp.db itself are not part of it.
+func (sp *StreamProcessor) inFileTx(ctx context.Context, fn func(db Database) error) error {
+	store, ok := sp.db.(TxStore)
+	if !ok {
+		return fn(sp.db)
+	}
+	return store.WithTx(ctx, func(tx *database.DB) error {
+		return fn(tx)
+	})
+}
@@ -0,0 +1,282 @@
+package processor
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/expr"
+	"github.com/nishad/srake/internal/parser"
+)
+
+// FilterExprFields lists the fields a filter expression may refer to.
+// Each record binds the fields of its type, and runs also bind the
+// fields of their experiment, samples and study (see relatedFields). A
+// clause about fields a record does not bind neither keeps nor drops it:
+//
+//	all:        record_type, accession, center
+//	study:      study_accession, title, study_type
+//	experiment: experiment_accession, study_accession, title, strategy,
+//	            source, selection, platform, instrument
+//	sample:     sample_accession, title, taxon_id, organism, tissue,
+//	            cell_type, attributes
+//	run:        run_accession, experiment_accession, total_spots, total_bases
+var FilterExprFields = []string{
+	"record_type", "accession", "center",
+	"study_accession", "experiment_accession", "sample_accession", "run_accession",
+	"title", "study_type",
+	"strategy", "source", "selection", "platform", "instrument",
+	"taxon_id", "organism", "tissue", "cell_type", "attributes",
+	"total_spots", "total_bases",
+}
+
+// CompileFilterExpr compiles a filter expression such as
+// `taxon_id == 9606 && strategy in ["RNA-Seq", "ATAC-seq"] && total_bases > 1e9`.
+func CompileFilterExpr(source string) (*expr.Program, error) {
+	p, err := expr.Compile(source, FilterExprFields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression: %w", err)
+	}
+	return p, nil
+}
+
+// SetFilterExpr makes the processor skip records for which the expression
+// is false. A nil expression keeps every record.
+func (sp *StreamProcessor) SetFilterExpr(p *expr.Program) {
+	sp.filterExpr = p
+}
+
+// relatedFields are the fields of a run's experiment, samples and study
+// that the run is filtered with, so that an expression such as
+// `taxon_id == 9606 && total_bases > 1e9` drops the runs of other
+// organisms, not only their samples
+var relatedFields = map[string][]string{
+	"experiment": {"study_accession", "strategy", "source", "selection", "platform", "instrument"},
+	"sample":     {"sample_accession", "taxon_id", "organism", "tissue", "cell_type", "attributes"},
+	"study":      {"study_type"},
+}
+
+// relatedLimit bounds the records of each type kept for filtering runs,
+// for inputs that are not split into submissions
+const relatedLimit = 100000
+
+// relatedRecords holds the fields of the studies, experiments and samples
+// of the submission being ingested, which its runs are filtered with.
+// NCBI archives hold each submission in a directory, whose runs are
+// deferred until its other files are read (see deferRuns).
+type relatedRecords struct {
+	dir         string
+	studies     map[string]expr.Vars
+	experiments map[string]expr.Vars
+	samples     map[string]expr.Vars
+	expSamples  map[string][]string
+}
+
+// reset forgets the records of the previous submission
+func (r *relatedRecords) reset(dir string) {
+	*r = relatedRecords{
+		dir:         dir,
+		studies:     make(map[string]expr.Vars),
+		experiments: make(map[string]expr.Vars),
+		samples:     make(map[string]expr.Vars),
+		expSamples:  make(map[string][]string),
+	}
+}
+
+func (r *relatedRecords) add(vars expr.Vars) {
+	if r.studies == nil {
+		r.reset(r.dir)
+	}
+	var records map[string]expr.Vars
+	switch vars["record_type"] {
+	case "study":
+		records = r.studies
+	case "experiment":
+		records = r.experiments
+	case "sample":
+		records = r.samples
+	}
+	if records != nil && len(records) < relatedLimit {
+		records[vars["accession"].(string)] = vars
+	}
+}
+
+// runVars returns the variables of a run with the fields of its
+// experiment and study bound, once for each of its samples
+func (r *relatedRecords) runVars(vars expr.Vars) []expr.Vars {
+	bind := func(to, from expr.Vars, recordType string) {
+		for _, field := range relatedFields[recordType] {
+			if v, ok := from[field]; ok {
+				to[field] = v
+			}
+		}
+	}
+
+	experiment, _ := vars["experiment_accession"].(string)
+	if exp := r.experiments[experiment]; exp != nil {
+		bind(vars, exp, "experiment")
+		studyAccession, _ := exp["study_accession"].(string)
+		if study := r.studies[studyAccession]; study != nil {
+			bind(vars, study, "study")
+		}
+	}
+
+	var all []expr.Vars
+	for _, accession := range r.expSamples[experiment] {
+		if sample := r.samples[accession]; sample != nil {
+			v := maps.Clone(vars)
+			bind(v, sample, "sample")
+			all = append(all, v)
+		}
+	}
+	if len(all) == 0 {
+		return []expr.Vars{vars}
+	}
+	return all
+}
+
+// keep reports whether a record passes the filter expression. A record the
+// expression fails on is skipped; the first such failure is logged.
+func (sp *StreamProcessor) keep(accession string, vars expr.Vars) bool {
+	if sp.filterExpr == nil {
+		return true
+	}
+	sp.related.add(vars)
+	if !sp.matches(accession, vars) {
+		sp.recordsFiltered.Add(1)
+		return false
+	}
+	return true
+}
+
+// keepRun reports whether a run passes the filter expression with the
+// fields of its experiment, samples and study bound, when they are in the
+// same submission. A run of a pooled experiment is kept if it passes with
+// any of the samples.
+func (sp *StreamProcessor) keepRun(accession string, vars expr.Vars) bool {
+	if sp.filterExpr == nil {
+		return true
+	}
+	for _, v := range sp.related.runVars(vars) {
+		if sp.matches(accession, v) {
+			return true
+		}
+	}
+	sp.recordsFiltered.Add(1)
+	return false
+}
+
+func (sp *StreamProcessor) matches(accession string, vars expr.Vars) bool {
+	ok, err := sp.filterExpr.Matches(vars)
+	if err != nil {
+		sp.filterErrOnce.Do(func() {
+			fmt.Printf("Warning: filter expression failed on %s, skipping such records: %v\n", accession, err)
+		})
+	}
+	return ok
+}
+
+// linkSamples records the samples an experiment sequenced, for filtering
+// its runs
+func (sp *StreamProcessor) linkSamples(links []database.ExperimentSample) {
+	if sp.filterExpr == nil {
+		return
+	}
+	r := &sp.related
+	if r.expSamples == nil {
+		r.reset(r.dir)
+	}
+	for _, l := range links {
+		if len(r.expSamples) < relatedLimit {
+			r.expSamples[l.ExperimentAccession] = append(r.expSamples[l.ExperimentAccession], l.SampleAccession)
+		}
+	}
+}
+
+// deferRuns reports whether the archive entry name is a run file to be
+// written after the other files of its submission directory, so that its
+// runs are filtered with their samples and study. Entering a new
+// directory first calls flush with the runs deferred in the previous one.
+func (sp *StreamProcessor) deferRuns(name string, flush func() error) (bool, error) {
+	if sp.filterExpr == nil {
+		return false, nil
+	}
+	if dir := path.Dir(name); dir != sp.related.dir {
+		if err := flush(); err != nil {
+			return false, err
+		}
+		sp.related.reset(dir)
+	}
+	return isRunFile(name), nil
+}
+
+// isRunFile reports whether an archive entry is a run set, by the name
+// decodeXMLFile goes by
+func isRunFile(name string) bool {
+	return strings.Contains(name, "run") && !strings.Contains(name, "experiment") &&
+		!strings.Contains(name, "study") && !strings.Contains(name, "sample")
+}
+
+func studyVars(study *parser.Study, dbStudy *database.Study) expr.Vars {
+	return expr.Vars{
+		"record_type":     "study",
+		"accession":       study.Accession,
+		"center":          study.CenterName,
+		"study_accession": study.Accession,
+		"title":           dbStudy.StudyTitle,
+		"study_type":      dbStudy.StudyType,
+	}
+}
+
+func experimentVars(exp *parser.Experiment, dbExp *database.Experiment) expr.Vars {
+	return expr.Vars{
+		"record_type":          "experiment",
+		"accession":            exp.Accession,
+		"center":               exp.CenterName,
+		"experiment_accession": exp.Accession,
+		"study_accession":      dbExp.StudyAccession,
+		"title":                dbExp.Title,
+		"strategy":             dbExp.LibraryStrategy,
+		"source":               dbExp.LibrarySource,
+		"selection":            exp.Design.LibraryDescriptor.LibrarySelection,
+		"platform":             dbExp.Platform,
+		"instrument":           dbExp.InstrumentModel,
+	}
+}
+
+func sampleVars(sample *parser.Sample, dbSample *database.Sample) expr.Vars {
+	attributes := make(map[string]string)
+	if sample.SampleAttributes != nil {
+		for _, attr := range sample.SampleAttributes.Attributes {
+			if _, ok := attributes[attr.Tag]; !ok {
+				attributes[attr.Tag] = attr.Value
+			}
+		}
+	}
+	return expr.Vars{
+		"record_type":      "sample",
+		"accession":        sample.Accession,
+		"center":           sample.CenterName,
+		"sample_accession": sample.Accession,
+		"title":            sample.Title,
+		"taxon_id":         dbSample.TaxonID,
+		"organism":         dbSample.ScientificName,
+		"tissue":           dbSample.Tissue,
+		"cell_type":        dbSample.CellType,
+		"attributes":       attributes,
+	}
+}
+
+func runVars(run *parser.Run, dbRun *database.Run) expr.Vars {
+	return expr.Vars{
+		"record_type":          "run",
+		"accession":            run.Accession,
+		"center":               run.CenterName,
+		"run_accession":        run.Accession,
+		"experiment_accession": dbRun.ExperimentAccession,
+		"total_spots":          dbRun.TotalSpots,
+		"total_bases":          dbRun.TotalBases,
+	}
+}
@@ -37,6 +37,10 @@ type FilterOptions struct {
 	Centers   []string // Submission centers
 	Countries []string // Geographic origin (from attributes)
 
+	// Expression filter, e.g. `taxon_id == 9606 && total_bases > 1e9`;
+	// see FilterExprFields
+	Expr string
+
 	// Control flags
 	SkipIfNoMatch bool // Skip entire file if no matches
 	StatsOnly     bool // Just count matches without inserting
@@ -58,6 +62,7 @@ type FilterStats struct {
 	SkippedByStrategy int64
 	SkippedByReads    int64
 	SkippedByCenter   int64
+	SkippedByExpr     int64
 
 	// Unique record tracking
 	UniqueStudies     map[string]bool
@@ -122,6 +127,12 @@ func (f *FilterOptions) Validate() error {
 			f.MinBases, f.MaxBases)
 	}
 
+	if f.Expr != "" {
+		if _, err := CompileFilterExpr(f.Expr); err != nil {
+			return err
+		}
+	}
+
 	// Normalize platform names
 	for i, platform := range f.Platforms {
 		f.Platforms[i] = strings.ToUpper(platform)
@@ -152,7 +163,8 @@ func (f *FilterOptions) HasFilters() bool {
 		f.MinBases > 0 ||
 		f.MaxBases > 0 ||
 		len(f.Centers) > 0 ||
-		len(f.Countries) > 0
+		len(f.Countries) > 0 ||
+		f.Expr != ""
 }
 
 // String returns a human-readable description of the filters
@@ -186,6 +198,9 @@ func (f *FilterOptions) String() string {
 	if f.MaxReads > 0 {
 		parts = append(parts, fmt.Sprintf("MaxReads=%d", f.MaxReads))
 	}
+	if f.Expr != "" {
+		parts = append(parts, fmt.Sprintf("Expr=%q", f.Expr))
+	}
 
 	if len(parts) == 0 {
 		return "No filters"
@@ -215,6 +230,7 @@ Skip Reasons:
   By Strategy:  %d
   By Reads:     %d
   By Center:    %d
+  By Expr:      %d
 
 Unique Records Matched:
   Studies:     %d
@@ -233,6 +249,7 @@ Processing Time: %s`,
 		s.SkippedByStrategy,
 		s.SkippedByReads,
 		s.SkippedByCenter,
+		s.SkippedByExpr,
 		len(s.UniqueStudies),
 		len(s.UniqueExperiments),
 		len(s.UniqueSamples),
@@ -0,0 +1,155 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"gopkg.in/yaml.v3"
+)
+
+// FilterProfile is a reusable set of filters stored as YAML, loaded with
+// ingest --filter-profile or evaluated with filter apply.
+//
+// Example profile:
+//
+//	taxon_ids: [9606]
+//	strategies: [RNA-Seq]
+//	platforms: [ILLUMINA]
+//	date_from: 2020-01-01
+//	min_reads: 1000000
+//	expr: 'attributes["disease"] == "healthy" || size(attributes) == 0'
+type FilterProfile struct {
+	TaxonIDs         []int    `yaml:"taxon_ids"`
+	ExcludeTaxonIDs  []int    `yaml:"exclude_taxon_ids"`
+	DateFrom         string   `yaml:"date_from"` // YYYY-MM-DD
+	DateTo           string   `yaml:"date_to"`   // YYYY-MM-DD
+	DateField        string   `yaml:"date_field"`
+	Organisms        []string `yaml:"organisms"`
+	ExcludeOrganisms []string `yaml:"exclude_organisms"`
+	Platforms        []string `yaml:"platforms"`
+	Strategies       []string `yaml:"strategies"`
+	StudyTypes       []string `yaml:"study_types"`
+	InstrumentModels []string `yaml:"instrument_models"`
+	Centers          []string `yaml:"centers"`
+	MinReads         int64    `yaml:"min_reads"`
+	MaxReads         int64    `yaml:"max_reads"`
+	MinBases         int64    `yaml:"min_bases"`
+	MaxBases         int64    `yaml:"max_bases"`
+	Expr             string   `yaml:"expr"`
+}
+
+// LoadFilterProfile reads a filter profile from a YAML file.
+func LoadFilterProfile(path string) (*FilterOptions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filter profile: %w", err)
+	}
+	return ParseFilterProfile(data)
+}
+
+// ParseFilterProfile parses a YAML filter profile into validated filter options.
+func ParseFilterProfile(data []byte) (*FilterOptions, error) {
+	var p FilterProfile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse filter profile: %w", err)
+	}
+
+	opts := &FilterOptions{
+		TaxonomyIDs:      p.TaxonIDs,
+		ExcludeTaxIDs:    p.ExcludeTaxonIDs,
+		DateField:        p.DateField,
+		Organisms:        p.Organisms,
+		ExcludeOrganisms: p.ExcludeOrganisms,
+		Platforms:        p.Platforms,
+		Strategies:       p.Strategies,
+		StudyTypes:       p.StudyTypes,
+		InstrumentModels: p.InstrumentModels,
+		Centers:          p.Centers,
+		MinReads:         p.MinReads,
+		MaxReads:         p.MaxReads,
+		MinBases:         p.MinBases,
+		MaxBases:         p.MaxBases,
+		Expr:             p.Expr,
+	}
+
+	var err error
+	if p.DateFrom != "" {
+		if opts.DateFrom, err = time.Parse("2006-01-02", p.DateFrom); err != nil {
+			return nil, fmt.Errorf("invalid date_from in filter profile: %w", err)
+		}
+	}
+	if p.DateTo != "" {
+		if opts.DateTo, err = time.Parse("2006-01-02", p.DateTo); err != nil {
+			return nil, fmt.Errorf("invalid date_to in filter profile: %w", err)
+		}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// RecordFilter converts the options to a filter over ingested records.
+func (f *FilterOptions) RecordFilter() database.RecordFilter {
+	rf := database.RecordFilter{
+		TaxonIDs:         f.TaxonomyIDs,
+		ExcludeTaxonIDs:  f.ExcludeTaxIDs,
+		DateColumn:       f.DateField,
+		Organisms:        f.Organisms,
+		ExcludeOrganisms: f.ExcludeOrganisms,
+		Platforms:        f.Platforms,
+		Strategies:       f.Strategies,
+		StudyTypes:       f.StudyTypes,
+		InstrumentModels: f.InstrumentModels,
+		Centers:          f.Centers,
+		MinReads:         f.MinReads,
+		MaxReads:         f.MaxReads,
+		MinBases:         f.MinBases,
+		MaxBases:         f.MaxBases,
+	}
+	if !f.DateFrom.IsZero() {
+		rf.DateFrom = f.DateFrom.Format("2006-01-02")
+	}
+	if !f.DateTo.IsZero() {
+		rf.DateTo = f.DateTo.Format("2006-01-02")
+	}
+	return rf
+}
+
+// EvaluateFilters streams the ingested records matching the filters,
+// collecting the unique matching accessions at each level. When fn is not
+// nil it is called for every match as it is read.
+func EvaluateFilters(db *database.DB, filters *FilterOptions, fn func(*database.FilterMatch) error) (*FilterStats, error) {
+	if filters.Expr != "" {
+		return nil, fmt.Errorf("filter expressions are only applied at ingest; remove expr from the profile")
+	}
+	stats := NewFilterStats()
+	err := db.StreamFilterMatches(filters.RecordFilter(), func(m *database.FilterMatch) error {
+		stats.TotalMatched++
+		stats.UniqueStudies[m.StudyAccession] = true
+		stats.UniqueExperiments[m.ExperimentAccession] = true
+		if m.SampleAccession != "" {
+			stats.UniqueSamples[m.SampleAccession] = true
+		}
+		if m.RunAccession != "" {
+			stats.UniqueRuns[m.RunAccession] = true
+		}
+		if fn != nil {
+			return fn(m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.ProcessingTime = time.Since(stats.StartTime)
+	return stats, nil
+}
@@ -24,8 +24,17 @@ func NewFilteredProcessor(db Database, filters FilterOptions) (*FilteredProcesso
 		return nil, fmt.Errorf("invalid filter options: %w", err)
 	}
 
+	sp := NewStreamProcessor(db)
+	if filters.Expr != "" {
+		p, err := CompileFilterExpr(filters.Expr)
+		if err != nil {
+			return nil, err
+		}
+		sp.SetFilterExpr(p)
+	}
+
 	return &FilteredProcessor{
-		StreamProcessor: NewStreamProcessor(db),
+		StreamProcessor: sp,
 		filters:         filters,
 		stats:           NewFilterStats(),
 	}, nil
@@ -52,6 +61,10 @@ func (fp *FilteredProcessor) ProcessWithFilters(ctx context.Context, source stri
 		err = fp.ProcessFile(ctx, source)
 	}
 
+	skipped := fp.recordsFiltered.Load()
+	fp.stats.SkippedByExpr += skipped
+	fp.stats.TotalSkipped += skipped
+
 	// Print final statistics
 	if fp.filters.HasFilters() {
 		fmt.Println("\n" + fp.stats.GetSummary())
@@ -207,6 +220,7 @@ func (fp *FilteredProcessor) ProcessSample(sample *parser.Sample) error {
 
 	// Extract additional attributes if available
 	if sample.SampleAttributes != nil {
+		dbSample.SampleAttributes = marshalJSON(sampleAttributeList(sample.SampleAttributes.Attributes))
 		for _, attr := range sample.SampleAttributes.Attributes {
 			switch strings.ToLower(attr.Tag) {
 			case "tissue":
@@ -4,19 +4,24 @@ package processor
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/nishad/srake/internal/database"
+	srerrors "github.com/nishad/srake/internal/errors"
+	"github.com/nishad/srake/internal/expr"
 	"github.com/nishad/srake/internal/parser"
+	"github.com/nishad/srake/internal/validator"
 )
 
 // Database defines the storage operations required by the stream processor.
@@ -46,13 +51,33 @@ type Database interface {
 
 // StreamProcessor handles streaming processing of tar.gz files from HTTP
 type StreamProcessor struct {
-	db              Database
-	client          *http.Client
-	progressFunc    ProgressFunc
-	bytesProcessed  atomic.Int64
-	totalBytes      int64
-	recordsInserted atomic.Int64
-	startTime       time.Time
+	db                 Database
+	client             *http.Client
+	progressFunc       ProgressFunc
+	bytesProcessed     atomic.Int64
+	totalBytes         int64
+	recordsInserted    atomic.Int64
+	recordsSuppressed  atomic.Int64 // removed by SUPPRESS actions
+	startTime          time.Time
+	currentFile        atomic.Value // string
+	controller         *Controller
+	throttle           *Throttle
+	identifiers        *IdentifierHandler
+	storeRaw           bool
+	source             string // archive set by the caller
+	detectedSource     string // archive of the current input
+	sourceFile         string // base name of the current input
+	ingestID           string // ID of the ingest of the current input
+	applySuppressions  bool   // apply SUPPRESS actions of submissions
+	filterExpr         *expr.Program
+	recordsFiltered    atomic.Int64 // skipped by filterExpr
+	filterErrOnce      sync.Once
+	related            relatedRecords // of the current submission, see keepRun
+	validator          *validator.Validator
+	transforms         *Transforms
+	quarantined        map[string]bool // of the XML file being written
+	recordsQuarantined atomic.Int64    // failed validation
+	workers            int             // XML files of an archive decoded in parallel
 }
 
 // ProgressFunc is called periodically with progress updates
@@ -68,12 +93,43 @@ type Progress struct {
 	BytesPerSecond         float64
 	TimeElapsed            time.Duration
 	EstimatedTimeRemaining time.Duration
+	Paused                 bool
+	ThrottleLevel          int // 0 at full speed
+}
+
+// MarshalJSON encodes progress with snake_case names and durations in
+// seconds, as the ingest control socket and API job events report it
+func (p Progress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BytesProcessed   int64   `json:"bytes_processed"`
+		TotalBytes       int64   `json:"total_bytes,omitempty"`
+		RecordsProcessed int64   `json:"records_processed"`
+		CurrentFile      string  `json:"current_file,omitempty"`
+		PercentComplete  float64 `json:"percent_complete"`
+		BytesPerSecond   float64 `json:"bytes_per_second,omitempty"`
+		ElapsedSeconds   float64 `json:"elapsed_seconds"`
+		ETASeconds       float64 `json:"eta_seconds,omitempty"`
+		Paused           bool    `json:"paused,omitempty"`
+		ThrottleLevel    int     `json:"throttle_level,omitempty"`
+	}{
+		BytesProcessed:   p.BytesProcessed,
+		TotalBytes:       p.TotalBytes,
+		RecordsProcessed: p.RecordsProcessed,
+		CurrentFile:      p.CurrentFile,
+		PercentComplete:  p.PercentComplete,
+		BytesPerSecond:   p.BytesPerSecond,
+		ElapsedSeconds:   p.TimeElapsed.Seconds(),
+		ETASeconds:       p.EstimatedTimeRemaining.Seconds(),
+		Paused:           p.Paused,
+		ThrottleLevel:    p.ThrottleLevel,
+	})
 }
 
 // NewStreamProcessor creates a new stream processor
 func NewStreamProcessor(db Database) *StreamProcessor {
 	return &StreamProcessor{
-		db: db,
+		db:          db,
+		identifiers: NewIdentifierHandler(db),
 		client: &http.Client{
 			Timeout: 0, // No timeout for large files
 			Transport: &http.Transport{
@@ -91,11 +147,26 @@ func (sp *StreamProcessor) SetProgressFunc(f ProgressFunc) {
 	sp.progressFunc = f
 }
 
-// ProcessURL streams and processes a tar.gz file from the given URL
+// SetController lets c pause and resume processing
+func (sp *StreamProcessor) SetController(c *Controller) {
+	sp.controller = c
+}
+
+// SetThrottle lets t slow processing down
+func (sp *StreamProcessor) SetThrottle(t *Throttle) {
+	sp.throttle = t
+}
+
+// ProcessURL streams and processes a tar.gz archive or XML document from
+// the given URL
 func (sp *StreamProcessor) ProcessURL(ctx context.Context, url string) error {
+	sp.setInput(url)
 	sp.startTime = time.Now()
 	sp.bytesProcessed.Store(0)
 	sp.recordsInserted.Store(0)
+	sp.recordsSuppressed.Store(0)
+	sp.recordsFiltered.Store(0)
+	sp.recordsQuarantined.Store(0)
 
 	// Make HTTP request
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -110,7 +181,7 @@ func (sp *StreamProcessor) ProcessURL(ctx context.Context, url string) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error: %s", resp.Status)
+		return &srerrors.StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 
 	// Get total size if available
@@ -118,19 +189,27 @@ func (sp *StreamProcessor) ProcessURL(ctx context.Context, url string) error {
 
 	// Create a counting reader to track progress
 	countingReader := &countingReader{
-		reader:   resp.Body,
-		counter:  &sp.bytesProcessed,
-		callback: sp.updateProgress,
+		ctx:        ctx,
+		reader:     resp.Body,
+		counter:    &sp.bytesProcessed,
+		callback:   sp.updateProgress,
+		controller: sp.controller,
+		throttle:   sp.throttle,
 	}
 
-	return sp.processTarGzStream(ctx, countingReader)
+	return sp.processStream(ctx, countingReader, url)
 }
 
-// ProcessFile streams and processes a local tar.gz file
+// ProcessFile streams and processes a local tar.gz archive or XML document,
+// optionally gzipped
 func (sp *StreamProcessor) ProcessFile(ctx context.Context, filePath string) error {
+	sp.setInput(filePath)
 	sp.startTime = time.Now()
 	sp.bytesProcessed.Store(0)
 	sp.recordsInserted.Store(0)
+	sp.recordsSuppressed.Store(0)
+	sp.recordsFiltered.Store(0)
+	sp.recordsQuarantined.Store(0)
 
 	// Open the file
 	file, err := os.Open(filePath)
@@ -148,24 +227,70 @@ func (sp *StreamProcessor) ProcessFile(ctx context.Context, filePath string) err
 
 	// Create a counting reader to track progress
 	countingReader := &countingReader{
-		reader:   file,
-		counter:  &sp.bytesProcessed,
-		callback: sp.updateProgress,
+		ctx:        ctx,
+		reader:     file,
+		counter:    &sp.bytesProcessed,
+		callback:   sp.updateProgress,
+		controller: sp.controller,
+		throttle:   sp.throttle,
 	}
 
-	return sp.processTarGzStream(ctx, countingReader)
+	return sp.processStream(ctx, countingReader, filePath)
 }
 
-// processTarGzStream processes a tar.gz stream from any reader
-func (sp *StreamProcessor) processTarGzStream(ctx context.Context, reader io.Reader) error {
-	// Chain: Reader → Gzip Reader → Tar Reader
-	gzipReader, err := gzip.NewReader(reader)
-	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %w", err)
+// ProcessReader streams and processes a tar.gz archive or XML document,
+// optionally gzipped, read from reader, such as an E-utilities response.
+// The name identifies the input in progress reports and record sources.
+func (sp *StreamProcessor) ProcessReader(ctx context.Context, reader io.Reader, name string) error {
+	sp.setInput(name)
+	sp.startTime = time.Now()
+	sp.bytesProcessed.Store(0)
+	sp.recordsInserted.Store(0)
+	sp.recordsSuppressed.Store(0)
+	sp.recordsFiltered.Store(0)
+	sp.recordsQuarantined.Store(0)
+	sp.totalBytes = 0
+
+	countingReader := &countingReader{
+		ctx:        ctx,
+		reader:     reader,
+		counter:    &sp.bytesProcessed,
+		callback:   sp.updateProgress,
+		controller: sp.controller,
+		throttle:   sp.throttle,
+	}
+
+	return sp.processStream(ctx, countingReader, name)
+}
+
+// processTarStream processes an uncompressed tar stream from any reader
+func (sp *StreamProcessor) processTarStream(ctx context.Context, reader io.Reader) error {
+	if sp.workers > 1 {
+		return sp.processTarPipeline(ctx, reader)
 	}
-	defer gzipReader.Close()
+	tarReader := tar.NewReader(reader)
 
-	tarReader := tar.NewReader(gzipReader)
+	process := func(name string, reader io.Reader) error {
+		if err := sp.processXMLStream(ctx, reader, name); err != nil {
+			// Nothing more can be stored once the disk is full
+			if srerrors.Classify(err) == srerrors.KindDiskFull {
+				return fmt.Errorf("failed to process %s: %w", name, err)
+			}
+			// Log error but continue processing
+			fmt.Printf("Warning: failed to process %s: %v\n", name, err)
+		}
+		return nil
+	}
+	var deferred []archiveEntry
+	flush := func() error {
+		for _, e := range deferred {
+			if err := process(e.name, bytes.NewReader(e.data)); err != nil {
+				return err
+			}
+		}
+		deferred = nil
+		return nil
+	}
 
 	// Process each file in the tar archive
 	for {
@@ -192,60 +317,112 @@ func (sp *StreamProcessor) processTarGzStream(ctx context.Context, reader io.Rea
 		if strings.HasSuffix(header.Name, ".xml") {
 			sp.updateProgress(header.Name)
 
-			if err := sp.processXMLStream(ctx, tarReader, header.Name); err != nil {
-				// Log error but continue processing
-				fmt.Printf("Warning: failed to process %s: %v\n", header.Name, err)
+			later, err := sp.deferRuns(header.Name, flush)
+			if err != nil {
+				return err
+			}
+			if later {
+				data, err := io.ReadAll(tarReader)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", header.Name, err)
+				}
+				deferred = append(deferred, archiveEntry{name: header.Name, data: data})
 				continue
 			}
+			if err := process(header.Name, tarReader); err != nil {
+				return err
+			}
 		}
 	}
 
-	return nil
+	return flush()
 }
 
-// processXMLStream processes a single XML file from the tar stream
+// processXMLStream processes a single XML file from the tar stream, in a
+// single transaction. The file is read before the transaction begins, so
+// that a paused or stalled input does not hold it open.
 func (sp *StreamProcessor) processXMLStream(ctx context.Context, reader io.Reader, filename string) error {
-	decoder := xml.NewDecoder(reader)
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+
+	return sp.inFileTx(ctx, func(db Database) error {
+		reader, err := sp.storeRawRecords(db, bytes.NewReader(data), filename)
+		if err != nil {
+			return err
+		}
 
-	// Use a smaller buffer for streaming
+		var records xmlRecords
+		err = decodeXMLFile(reader, filename, &records, func() error {
+			return sp.insertRecords(ctx, db, &records, false)
+		})
+		if err != nil {
+			return err
+		}
+		return sp.insertRecords(ctx, db, &records, true)
+	})
+}
+
+// decodeXMLFile decodes the records of an XML file of an archive into
+// records: the record set its name says it holds, or, for files not named
+// after their record type, as in ENA and DDBJ dumps, the records found
+// anywhere in it, calling flush, when set, after each.
+func decodeXMLFile(reader io.Reader, filename string, records *xmlRecords, flush func() error) error {
+	decoder := xml.NewDecoder(reader)
 	decoder.CharsetReader = nil // Use default UTF-8
 
 	// Determine file type from name
+	var err error
+	var set string
 	switch {
 	case strings.Contains(filename, "experiment"):
-		return sp.processExperiments(ctx, decoder)
+		var expSet parser.ExperimentSet
+		set = "experiment set"
+		err = decoder.Decode(&expSet)
+		records.experiments = expSet.Experiments
 	case strings.Contains(filename, "study"):
-		return sp.processStudies(ctx, decoder)
+		var studySet parser.StudySet
+		set = "study set"
+		err = decoder.Decode(&studySet)
+		records.studies = studySet.Studies
 	case strings.Contains(filename, "sample"):
-		return sp.processSamples(ctx, decoder)
+		var sampleSet parser.SampleSet
+		set = "sample set"
+		err = decoder.Decode(&sampleSet)
+		records.samples = sampleSet.Samples
 	case strings.Contains(filename, "run"):
-		return sp.processRuns(ctx, decoder)
+		var runSet parser.RunSet
+		set = "run set"
+		err = decoder.Decode(&runSet)
+		records.runs = runSet.Runs
 	default:
-		// Skip unknown file types
-		return nil
+		return decodeXMLDocument(decoder, filename, records, flush)
 	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to decode %s: %w", set, err)
+	}
+	return nil
 }
 
-// processExperiments streams and processes experiment records
-func (sp *StreamProcessor) processExperiments(ctx context.Context, decoder *xml.Decoder) error {
+// insertExperiments converts and inserts experiment records in batches
+func (sp *StreamProcessor) insertExperiments(ctx context.Context, db Database, experiments []parser.Experiment) error {
 	batch := make([]database.Experiment, 0, 5000) // Optimized batch size
+	var ids []database.Identifier
+	var samples []database.ExperimentSample
 
-	// Decode the entire ExperimentSet
-	var expSet parser.ExperimentSet
-	if err := decoder.Decode(&expSet); err != nil {
-		if err != io.EOF {
-			return fmt.Errorf("failed to decode experiment set: %w", err)
-		}
-		return nil
-	}
-
-	// Process each experiment in the set
-	for _, exp := range expSet.Experiments {
+	for _, exp := range experiments {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
+		if sp.quarantined[exp.Accession] {
+			continue
+		}
+		if exp.ExperimentAttributes != nil {
+			exp.ExperimentAttributes.Attributes = sp.transforms.Apply(exp.CenterName, exp.ExperimentAttributes.Attributes)
+		}
 
 		// Extract platform and instrument
 		platform := ""
@@ -272,48 +449,72 @@ func (sp *StreamProcessor) processExperiments(ctx context.Context, decoder *xml.
 			InstrumentModel:     instrument,
 			Metadata:            "{}",
 		}
+		if exp.ExperimentAttributes != nil {
+			dbExp.Metadata = attributesMetadata(exp.ExperimentAttributes.Attributes)
+		}
+		sp.linkSamples(experimentSamples(&exp))
+		if !sp.keep(exp.Accession, experimentVars(&exp, &dbExp)) {
+			continue
+		}
 
 		batch = append(batch, dbExp)
+		ids = append(ids, sp.identifiers.RecordIdentifiers(exp.Identifiers, "experiment", exp.Accession, exp.Alias, exp.CenterName)...)
+		samples = append(samples, experimentSamples(&exp)...)
 
 		// Insert batch when full
 		if len(batch) >= 5000 { // Optimized batch size
-			if err := sp.db.BatchInsertExperiments(batch); err != nil {
+			if err := db.BatchInsertExperiments(batch); err != nil {
 				return fmt.Errorf("failed to insert experiments: %w", err)
 			}
 			sp.recordsInserted.Add(int64(len(batch)))
+			sp.recordSources(db, "experiment", experimentAccessions(batch))
+			sp.recordIdentifiers(db, ids)
+			sp.recordExperimentSamples(db, samples)
+			sp.refreshSampleRuns(db, experimentAccessions(batch))
 			batch = batch[:0]
+			ids = ids[:0]
+			samples = samples[:0]
 		}
 	}
 
 	// Insert remaining batch
 	if len(batch) > 0 {
-		if err := sp.db.BatchInsertExperiments(batch); err != nil {
+		if err := db.BatchInsertExperiments(batch); err != nil {
 			return fmt.Errorf("failed to insert final experiments batch: %w", err)
 		}
 		sp.recordsInserted.Add(int64(len(batch)))
+		sp.recordSources(db, "experiment", experimentAccessions(batch))
+		sp.recordIdentifiers(db, ids)
+		sp.recordExperimentSamples(db, samples)
+		sp.refreshSampleRuns(db, experimentAccessions(batch))
 	}
 
 	return nil
 }
 
-// processStudies streams and processes study records
-func (sp *StreamProcessor) processStudies(ctx context.Context, decoder *xml.Decoder) error {
-	// Decode the entire StudySet
-	var studySet parser.StudySet
-	if err := decoder.Decode(&studySet); err != nil {
-		if err != io.EOF {
-			return fmt.Errorf("failed to decode study set: %w", err)
-		}
-		return nil
-	}
-
-	// Process each study in the set
-	for _, study := range studySet.Studies {
+// insertStudies converts and inserts study records
+func (sp *StreamProcessor) insertStudies(ctx context.Context, db Database, studies []parser.Study) error {
+	var inserted []string
+	var ids []database.Identifier
+	var hints []database.RecordAccess
+	defer func() {
+		sp.recordSources(db, "study", inserted)
+		sp.recordIdentifiers(db, ids)
+		sp.recordAccess(db, inserted, hints)
+	}()
+
+	for _, study := range studies {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
+		if sp.quarantined[study.Accession] {
+			continue
+		}
+		if study.StudyAttributes != nil {
+			study.StudyAttributes.Attributes = sp.transforms.Apply(study.CenterName, study.StudyAttributes.Attributes)
+		}
 
 		// Extract study type
 		studyType := ""
@@ -332,37 +533,61 @@ func (sp *StreamProcessor) processStudies(ctx context.Context, decoder *xml.Deco
 			StudyType:      studyType,
 			Metadata:       "{}",
 		}
+		if study.StudyAttributes != nil {
+			dbStudy.Metadata = attributesMetadata(study.StudyAttributes.Attributes)
+		}
+		if !sp.keep(study.Accession, studyVars(&study, &dbStudy)) {
+			continue
+		}
 
-		if err := sp.db.InsertStudy(&dbStudy); err != nil {
+		if err := db.InsertStudy(&dbStudy); err != nil {
 			// Log but continue
 			fmt.Printf("Warning: failed to insert study %s: %v\n", study.Accession, err)
 			continue
 		}
 
 		sp.recordsInserted.Add(1)
+		inserted = append(inserted, study.Accession)
+		ids = append(ids, sp.identifiers.RecordIdentifiers(study.Identifiers, "study", study.Accession, study.Alias, study.CenterName)...)
+		var links []parser.Link
+		if study.StudyLinks != nil {
+			links = study.StudyLinks.Links
+		}
+		var attrs []parser.Attribute
+		if study.StudyAttributes != nil {
+			attrs = study.StudyAttributes.Attributes
+		}
+		if hint := accessHint("study", study.Accession, study.Identifiers, links, attrs); hint != nil {
+			hints = append(hints, *hint)
+		}
 	}
 
 	return nil
 }
 
-// processSamples streams and processes sample records
-func (sp *StreamProcessor) processSamples(ctx context.Context, decoder *xml.Decoder) error {
-	// Decode the entire SampleSet
-	var sampleSet parser.SampleSet
-	if err := decoder.Decode(&sampleSet); err != nil {
-		if err != io.EOF {
-			return fmt.Errorf("failed to decode sample set: %w", err)
-		}
-		return nil
-	}
-
-	// Process each sample in the set
-	for _, sample := range sampleSet.Samples {
+// insertSamples converts and inserts sample records
+func (sp *StreamProcessor) insertSamples(ctx context.Context, db Database, samples []parser.Sample) error {
+	var inserted []string
+	var ids []database.Identifier
+	var hints []database.RecordAccess
+	defer func() {
+		sp.recordSources(db, "sample", inserted)
+		sp.recordIdentifiers(db, ids)
+		sp.recordAccess(db, inserted, hints)
+	}()
+
+	for _, sample := range samples {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
+		if sp.quarantined[sample.Accession] {
+			continue
+		}
+		if sample.SampleAttributes != nil {
+			sample.SampleAttributes.Attributes = sp.transforms.Apply(sample.CenterName, sample.SampleAttributes.Attributes)
+		}
 
 		// Convert to database model
 		dbSample := database.Sample{
@@ -375,6 +600,7 @@ func (sp *StreamProcessor) processSamples(ctx context.Context, decoder *xml.Deco
 
 		// Extract organism from attributes
 		if sample.SampleAttributes != nil {
+			dbSample.SampleAttributes = marshalJSON(sampleAttributeList(sample.SampleAttributes.Attributes))
 			for _, attr := range sample.SampleAttributes.Attributes {
 				switch attr.Tag {
 				case "organism":
@@ -387,35 +613,61 @@ func (sp *StreamProcessor) processSamples(ctx context.Context, decoder *xml.Deco
 			}
 		}
 
-		if err := sp.db.InsertSample(&dbSample); err != nil {
+		if !sp.keep(sample.Accession, sampleVars(&sample, &dbSample)) {
+			continue
+		}
+
+		if err := db.InsertSample(&dbSample); err != nil {
 			fmt.Printf("Warning: failed to insert sample %s: %v\n", sample.Accession, err)
 			continue
 		}
 
 		sp.recordsInserted.Add(1)
+		inserted = append(inserted, sample.Accession)
+		ids = append(ids, sp.identifiers.RecordIdentifiers(sample.Identifiers, "sample", sample.Accession, sample.Alias, sample.CenterName)...)
+		var links []parser.Link
+		if sample.SampleLinks != nil {
+			links = sample.SampleLinks.Links
+		}
+		var attrs []parser.Attribute
+		if sample.SampleAttributes != nil {
+			attrs = sample.SampleAttributes.Attributes
+		}
+		if hint := accessHint("sample", sample.Accession, sample.Identifiers, links, attrs); hint != nil {
+			hints = append(hints, *hint)
+		}
 	}
 
 	return nil
 }
 
-// processRuns streams and processes run records
-func (sp *StreamProcessor) processRuns(ctx context.Context, decoder *xml.Decoder) error {
-	// Decode the entire RunSet
-	var runSet parser.RunSet
-	if err := decoder.Decode(&runSet); err != nil {
-		if err != io.EOF {
-			return fmt.Errorf("failed to decode run set: %w", err)
-		}
-		return nil
-	}
-
-	// Process each run in the set
-	for _, r := range runSet.Runs {
+// insertRuns converts and inserts run records
+func (sp *StreamProcessor) insertRuns(ctx context.Context, db Database, runs []parser.Run) error {
+	var inserted, experiments []string
+	var ids []database.Identifier
+	var hints []database.RecordAccess
+	var files []database.RunFile
+	seen := make(map[string]bool)
+	defer func() {
+		sp.recordSources(db, "run", inserted)
+		sp.recordIdentifiers(db, ids)
+		sp.recordAccess(db, inserted, hints)
+		sp.recordRunFiles(db, inserted, files)
+		sp.refreshSampleRuns(db, experiments)
+	}()
+
+	for _, r := range runs {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
+		if sp.quarantined[r.Accession] {
+			continue
+		}
+		if r.RunAttributes != nil {
+			r.RunAttributes.Attributes = sp.transforms.Apply(r.CenterName, r.RunAttributes.Attributes)
+		}
 
 		// Extract statistics safely
 		totalSpots := int64(0)
@@ -434,13 +686,34 @@ func (sp *StreamProcessor) processRuns(ctx context.Context, decoder *xml.Decoder
 			Published:           "", // Empty string as we changed this to string type
 			Metadata:            "{}",
 		}
+		if !sp.keepRun(r.Accession, runVars(&r, &dbRun)) {
+			continue
+		}
 
-		if err := sp.db.InsertRun(&dbRun); err != nil {
+		if err := db.InsertRun(&dbRun); err != nil {
 			fmt.Printf("Warning: failed to insert run %s: %v\n", r.Accession, err)
 			continue
 		}
 
 		sp.recordsInserted.Add(1)
+		inserted = append(inserted, r.Accession)
+		if exp := dbRun.ExperimentAccession; exp != "" && !seen[exp] {
+			seen[exp] = true
+			experiments = append(experiments, exp)
+		}
+		ids = append(ids, sp.identifiers.RecordIdentifiers(r.Identifiers, "run", r.Accession, r.Alias, r.CenterName)...)
+		files = append(files, runFiles(&r)...)
+		var links []parser.Link
+		if r.RunLinks != nil {
+			links = r.RunLinks.Links
+		}
+		var attrs []parser.Attribute
+		if r.RunAttributes != nil {
+			attrs = r.RunAttributes.Attributes
+		}
+		if hint := accessHint("run", r.Accession, r.Identifiers, links, attrs); hint != nil {
+			hints = append(hints, *hint)
+		}
 	}
 
 	return nil
@@ -448,13 +721,37 @@ func (sp *StreamProcessor) processRuns(ctx context.Context, decoder *xml.Decoder
 
 // updateProgress updates and reports progress
 func (sp *StreamProcessor) updateProgress(currentFile string) {
+	if currentFile != "" {
+		sp.currentFile.Store(currentFile)
+	}
 	if sp.progressFunc == nil {
 		return
 	}
+	sp.progressFunc(sp.snapshot(currentFile))
+}
+
+// Status returns a snapshot of the current progress
+func (sp *StreamProcessor) Status() Progress {
+	currentFile, _ := sp.currentFile.Load().(string)
+	return sp.snapshot(currentFile)
+}
 
+// snapshot computes the current progress. Rates and estimates exclude time
+// spent paused.
+func (sp *StreamProcessor) snapshot(currentFile string) Progress {
 	bytesProcessed := sp.bytesProcessed.Load()
 	recordsProcessed := sp.recordsInserted.Load()
 	elapsed := time.Since(sp.startTime)
+	active := elapsed
+	paused := false
+	if sp.controller != nil {
+		active -= sp.controller.PausedFor()
+		paused = sp.controller.Paused()
+	}
+	throttleLevel := 0
+	if sp.throttle != nil {
+		throttleLevel = sp.throttle.Level()
+	}
 
 	var percentComplete float64
 	var estimatedRemaining time.Duration
@@ -463,16 +760,16 @@ func (sp *StreamProcessor) updateProgress(currentFile string) {
 	if sp.totalBytes > 0 {
 		percentComplete = float64(bytesProcessed) / float64(sp.totalBytes) * 100
 		if bytesProcessed > 0 {
-			totalTime := elapsed.Seconds() * float64(sp.totalBytes) / float64(bytesProcessed)
-			estimatedRemaining = time.Duration(totalTime-elapsed.Seconds()) * time.Second
+			totalTime := active.Seconds() * float64(sp.totalBytes) / float64(bytesProcessed)
+			estimatedRemaining = time.Duration(totalTime-active.Seconds()) * time.Second
 		}
 	}
 
-	if elapsedSec := elapsed.Seconds(); elapsedSec > 0 {
-		bytesPerSecond = float64(bytesProcessed) / elapsedSec
+	if activeSec := active.Seconds(); activeSec > 0 {
+		bytesPerSecond = float64(bytesProcessed) / activeSec
 	}
 
-	sp.progressFunc(Progress{
+	return Progress{
 		BytesProcessed:         bytesProcessed,
 		TotalBytes:             sp.totalBytes,
 		RecordsProcessed:       recordsProcessed,
@@ -481,17 +778,34 @@ func (sp *StreamProcessor) updateProgress(currentFile string) {
 		BytesPerSecond:         bytesPerSecond,
 		TimeElapsed:            elapsed,
 		EstimatedTimeRemaining: estimatedRemaining,
-	})
+		Paused:                 paused,
+		ThrottleLevel:          throttleLevel,
+	}
 }
 
-// countingReader wraps an io.Reader and counts bytes read
+// countingReader wraps an io.Reader and counts bytes read. Reads block
+// while the controller, if any, is paused, and rest as long as the
+// throttle, if any, asks.
 type countingReader struct {
-	reader   io.Reader
-	counter  *atomic.Int64
-	callback func(string)
+	ctx        context.Context
+	reader     io.Reader
+	counter    *atomic.Int64
+	callback   func(string)
+	controller *Controller
+	throttle   *Throttle
 }
 
 func (cr *countingReader) Read(p []byte) (n int, err error) {
+	if cr.controller != nil {
+		if err := cr.controller.Wait(cr.ctx); err != nil {
+			return 0, err
+		}
+	}
+	if cr.throttle != nil {
+		if err := cr.throttle.Wait(cr.ctx); err != nil {
+			return 0, err
+		}
+	}
 	n, err = cr.reader.Read(p)
 	if n > 0 {
 		cr.counter.Add(int64(n))
@@ -515,10 +829,13 @@ func (sp *StreamProcessor) GetStats() map[string]interface{} {
 	}
 
 	return map[string]interface{}{
-		"bytes_processed":    bytesProcessed,
-		"records_processed":  recordsProcessed,
-		"elapsed_time":       elapsed.String(),
-		"bytes_per_second":   bytesPerSecond,
-		"records_per_second": recordsPerSecond,
+		"bytes_processed":     bytesProcessed,
+		"records_processed":   recordsProcessed,
+		"records_suppressed":  sp.recordsSuppressed.Load(),
+		"records_filtered":    sp.recordsFiltered.Load(),
+		"records_quarantined": sp.recordsQuarantined.Load(),
+		"elapsed_time":        elapsed.String(),
+		"bytes_per_second":    bytesPerSecond,
+		"records_per_second":  recordsPerSecond,
 	}
 }
@@ -9,11 +9,15 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/parser"
+	"github.com/nishad/srake/internal/validator"
 )
 
 // TestStreamProcessor tests the HTTP streaming processor
@@ -112,6 +116,645 @@ func TestContextCancellation(t *testing.T) {
 	}
 }
 
+// TestPauseResume tests that a paused processor stops reading until resumed
+func TestPauseResume(t *testing.T) {
+	testData := createTestTarGz(t)
+
+	dir := t.TempDir()
+	path := dir + "/test.tar.gz"
+	if err := os.WriteFile(path, testData, 0600); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	processor := NewStreamProcessor(newMockDatabase())
+	controller := NewController()
+	paused := make(chan struct{})
+	controller.OnPause = func() { close(paused) }
+	processor.SetController(controller)
+
+	if !controller.Pause() {
+		t.Fatal("expected Pause to succeed")
+	}
+	<-paused
+	if controller.Pause() {
+		t.Error("expected second Pause to report already paused")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- processor.ProcessFile(context.Background(), path) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if status := processor.Status(); status.BytesProcessed != 0 || !status.Paused {
+		t.Errorf("expected no progress while paused, got %+v", status)
+	}
+
+	if paused := controller.Toggle(); paused {
+		t.Error("expected Toggle to resume")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("processing did not resume")
+	}
+
+	if status := processor.Status(); status.BytesProcessed != int64(len(testData)) || status.Paused {
+		t.Errorf("unexpected final status: %+v", status)
+	}
+	if controller.PausedFor() < 50*time.Millisecond {
+		t.Errorf("expected paused time to be tracked, got %v", controller.PausedFor())
+	}
+}
+
+// TestPausedCancellation tests that cancelling a paused ingest stops it
+func TestPausedCancellation(t *testing.T) {
+	testData := createTestTarGz(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testData)
+	}))
+	defer server.Close()
+
+	processor := NewStreamProcessor(newMockDatabase())
+	controller := NewController()
+	controller.Pause()
+	processor.SetController(controller)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := processor.ProcessURL(ctx, server.URL); err == nil {
+		t.Error("expected cancellation error while paused")
+	}
+}
+
+// TestThrottle tests that the throttle rests in proportion to the work done
+// and that Monitor's adjustments stay between the floor and the maximum
+func TestThrottle(t *testing.T) {
+	throttle := NewThrottle(3)
+	var rested time.Duration
+	throttle.sleep = func(ctx context.Context, d time.Duration) error {
+		rested += d
+		return nil
+	}
+
+	throttle.Wait(context.Background())
+	time.Sleep(30 * time.Millisecond)
+	throttle.Wait(context.Background())
+	if rested < 90*time.Millisecond || rested > 300*time.Millisecond {
+		t.Errorf("expected a rest of about 3x the 30ms worked, got %v", rested)
+	}
+
+	// Slow queries raise the level, fast ones lower it to the floor
+	for i := 0; i < 20; i++ {
+		throttle.adjust(200*time.Millisecond, 100*time.Millisecond)
+	}
+	if level := throttle.Level(); level != MaxThrottleLevel {
+		t.Errorf("expected level %d after slow queries, got %d", MaxThrottleLevel, level)
+	}
+	throttle.adjust(80*time.Millisecond, 100*time.Millisecond)
+	if level := throttle.Level(); level != MaxThrottleLevel {
+		t.Errorf("expected level to hold near the target, got %d", level)
+	}
+	for i := 0; i < 20; i++ {
+		throttle.adjust(10*time.Millisecond, 100*time.Millisecond)
+	}
+	if level := throttle.Level(); level != 3 {
+		t.Errorf("expected level to return to the floor of 3, got %d", level)
+	}
+
+	if level := NewThrottle(50).Level(); level != MaxThrottleLevel {
+		t.Errorf("expected level to be clamped to %d, got %d", MaxThrottleLevel, level)
+	}
+}
+
+// TestThrottledProcessing tests that a throttled ingest still completes and
+// reports its level
+func TestThrottledProcessing(t *testing.T) {
+	testData := createTestTarGz(t)
+	path := t.TempDir() + "/test.tar.gz"
+	if err := os.WriteFile(path, testData, 0600); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	processor := NewStreamProcessor(newMockDatabase())
+	processor.SetThrottle(NewThrottle(2))
+	if err := processor.ProcessFile(context.Background(), path); err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+	if status := processor.Status(); status.BytesProcessed != int64(len(testData)) || status.ThrottleLevel != 2 {
+		t.Errorf("unexpected final status: %+v", status)
+	}
+}
+
+// TestStoreRaw tests that raw record XML is stored alongside extracted fields
+func TestStoreRaw(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "test.tar.gz")
+	if err := os.WriteFile(archive, createTestTarGz(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	processor := NewStreamProcessor(db)
+	processor.SetStoreRaw(true)
+	if err := processor.ProcessFile(context.Background(), archive); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	info, xml, err := db.GetRawRecord("SRX001")
+	if err != nil {
+		t.Fatalf("Expected raw experiment to be stored: %v", err)
+	}
+	if info.RecordType != "experiment" {
+		t.Errorf("Expected record type experiment, got %s", info.RecordType)
+	}
+	if !strings.HasPrefix(string(xml), `<EXPERIMENT accession="SRX001">`) ||
+		!strings.HasSuffix(string(xml), "</EXPERIMENT>") ||
+		!strings.Contains(string(xml), "<INSTRUMENT_MODEL>HiSeq 2000</INSTRUMENT_MODEL>") {
+		t.Errorf("Unexpected raw XML: %s", xml)
+	}
+	if _, err := db.GetExperiment("SRX001"); err != nil {
+		t.Errorf("Expected extracted experiment to be stored: %v", err)
+	}
+	if _, _, err := db.GetRawRecord("SRP001"); err != nil {
+		t.Errorf("Expected raw study to be stored: %v", err)
+	}
+}
+
+// TestValidateQuarantine tests that records failing validation are
+// quarantined with their XML instead of being inserted
+func TestValidateQuarantine(t *testing.T) {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	write := func(name, content string) {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := io.WriteString(tarWriter, content); err != nil {
+			t.Fatalf("Failed to write tar content: %v", err)
+		}
+	}
+	write("SRA000001/study.xml", `<STUDY_SET>
+	<STUDY accession="SRP000001"><DESCRIPTOR><STUDY_TITLE>Valid</STUDY_TITLE><STUDY_TYPE existing_study_type="Other"/></DESCRIPTOR></STUDY>
+	<STUDY accession="SRP000002"><DESCRIPTOR><STUDY_TITLE>No type</STUDY_TITLE></DESCRIPTOR></STUDY>
+</STUDY_SET>`)
+	write("SRA000001/sample.xml", `<SAMPLE_SET>
+	<SAMPLE accession="SRS000001"><SAMPLE_NAME><COMMON_NAME>human</COMMON_NAME></SAMPLE_NAME></SAMPLE>
+	<SAMPLE accession="SRS000002"><SAMPLE_NAME><TAXON_ID>9606</TAXON_ID><SCIENTIFIC_NAME>Homo sapiens</SCIENTIFIC_NAME></SAMPLE_NAME></SAMPLE>
+</SAMPLE_SET>`)
+	tarWriter.Close()
+	gzWriter.Close()
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "test.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("Failed to initialize database: %v", err)
+			}
+			defer db.Close()
+
+			processor := NewStreamProcessor(db)
+			processor.SetWorkers(workers)
+			processor.SetStoreRaw(true)
+			processor.SetValidator(validator.DefaultValidator())
+			started := time.Now()
+			if err := processor.ProcessFile(context.Background(), archive); err != nil {
+				t.Fatalf("Failed to process file: %v", err)
+			}
+
+			if _, err := db.GetStudy("SRP000001"); err != nil {
+				t.Errorf("Expected the valid study to be inserted: %v", err)
+			}
+			if _, err := db.GetStudy("SRP000002"); err == nil {
+				t.Error("Expected the invalid study not to be inserted")
+			}
+			if _, err := db.GetSample("SRS000002"); err != nil {
+				t.Errorf("Expected the valid sample to be inserted: %v", err)
+			}
+			if _, _, err := db.GetRawRecord("SRP000002"); err == nil {
+				t.Error("Expected no raw XML of the invalid study")
+			}
+			if got := processor.GetStats()["records_quarantined"]; got != int64(2) {
+				t.Errorf("Expected 2 records quarantined, got %v", got)
+			}
+
+			records, err := db.ListQuarantine(processor.IngestID(), "SRP000002", 0)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("Expected the invalid study to be quarantined, got %+v (%v)", records, err)
+			}
+			if r := records[0]; r.RecordType != "study" || r.SourceFile != "study.xml" ||
+				!strings.Contains(string(r.XML), "No type") || r.Errors[0].Field != "STUDY_TYPE" {
+				t.Errorf("Unexpected quarantined record: %+v", r)
+			}
+
+			summary, err := db.SummarizeQuarantine(started)
+			if err != nil {
+				t.Fatalf("SummarizeQuarantine failed: %v", err)
+			}
+			if summary.Records != 2 || summary.ByType["MISSING_REQUIRED_FIELD"] != 3 {
+				t.Errorf("Unexpected summary: %+v", summary)
+			}
+		})
+	}
+}
+
+// TestParallelDecoding tests that archives decoded by several workers are
+// written in archive order, skipping files that fail to decode
+func TestParallelDecoding(t *testing.T) {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	write := func(name, content string) {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := io.WriteString(tarWriter, content); err != nil {
+			t.Fatalf("Failed to write tar content: %v", err)
+		}
+	}
+	// Each study is written once per file, its last title winning when the
+	// files are written in order
+	for i := 0; i < 20; i++ {
+		write(fmt.Sprintf("SRA%06d/study.xml", i), fmt.Sprintf(`<STUDY_SET>
+	<STUDY accession="SRP000001"><DESCRIPTOR><STUDY_TITLE>Title %d</STUDY_TITLE></DESCRIPTOR></STUDY>
+	<STUDY accession="SRP%06d"><DESCRIPTOR><STUDY_TITLE>Study %d</STUDY_TITLE></DESCRIPTOR></STUDY>
+</STUDY_SET>`, i, i+100, i))
+		if i == 10 {
+			write("SRA000010/broken.xml", "<STUDY_SET><STUDY accession=")
+		}
+	}
+	tarWriter.Close()
+	gzWriter.Close()
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "test.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	processor := NewStreamProcessor(db)
+	processor.SetWorkers(4)
+	processor.SetStoreRaw(true)
+	if err := processor.ProcessFile(context.Background(), archive); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	if study, err := db.GetStudy("SRP000001"); err != nil || study.StudyTitle != "Title 19" {
+		t.Errorf("Expected the last title to win, got %+v (%v)", study, err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := db.GetStudy(fmt.Sprintf("SRP%06d", i+100)); err != nil {
+			t.Errorf("Expected study %d to be stored: %v", i, err)
+		}
+	}
+	if _, _, err := db.GetRawRecord("SRP000119"); err != nil {
+		t.Errorf("Expected raw study to be stored: %v", err)
+	}
+}
+
+// TestSplitRawRecords tests splitting a record set into records
+func TestSplitRawRecords(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<RUN_SET>
+	<RUN accession="SRR1"><RUN_ATTRIBUTES><RUN_ATTRIBUTE/></RUN_ATTRIBUTES></RUN>
+	<RUN alias="no accession"/>
+	<RUN accession="SRR2"/>
+</RUN_SET>`)
+
+	records, err := SplitRawRecords(data)
+	if err != nil {
+		t.Fatalf("SplitRawRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if string(records[0].XML) != `<RUN accession="SRR1"><RUN_ATTRIBUTES><RUN_ATTRIBUTE/></RUN_ATTRIBUTES></RUN>` {
+		t.Errorf("Unexpected XML for SRR1: %s", records[0].XML)
+	}
+	if records[1].Accession != "SRR2" || records[1].RecordType != "run" || string(records[1].XML) != `<RUN accession="SRR2"/>` {
+		t.Errorf("Unexpected second record: %+v", records[1])
+	}
+}
+
+// TestProcessENADocument tests ingesting a gzipped ENA XML dump with a
+// non-NCBI wrapper, and provenance tagging of its records
+func TestProcessENADocument(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "ena_study.xml.gz")
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	io.WriteString(gzWriter, `<?xml version="1.0" encoding="UTF-8"?>
+<ROOT request="ERP000001&amp;display=xml">
+	<STUDY accession="ERP000001">
+		<DESCRIPTOR>
+			<STUDY_TITLE>ENA Study</STUDY_TITLE>
+		</DESCRIPTOR>
+	</STUDY>
+	<SAMPLE accession="ERS000001" alias="GSM123_rep2" center_name="GEO">
+		<IDENTIFIERS>
+			<PRIMARY_ID>ERS000001</PRIMARY_ID>
+			<SUBMITTER_ID namespace="LAB">liver-042</SUBMITTER_ID>
+		</IDENTIFIERS>
+		<SAMPLE_NAME><TAXON_ID>9606</TAXON_ID><SCIENTIFIC_NAME>Homo sapiens</SCIENTIFIC_NAME></SAMPLE_NAME>
+	</SAMPLE>
+</ROOT>`)
+	gzWriter.Close()
+	if err := os.WriteFile(dump, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	processor := NewStreamProcessor(db)
+	if err := processor.ProcessFile(context.Background(), dump); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	study, err := db.GetStudy("ERP000001")
+	if err != nil {
+		t.Fatalf("Expected study to be ingested: %v", err)
+	}
+	if study.StudyTitle != "ENA Study" {
+		t.Errorf("Expected title 'ENA Study', got %q", study.StudyTitle)
+	}
+	if _, err := db.GetSample("ERS000001"); err != nil {
+		t.Errorf("Expected sample to be ingested: %v", err)
+	}
+
+	// Aliases and submitter IDs are recorded for lookup
+	for idType, value := range map[string]string{
+		database.IDTypeAlias:     "GSM123_rep2",
+		database.IDTypeSubmitter: "liver-042",
+	} {
+		matches, err := db.LookupIdentifiers(value, []string{idType}, 10)
+		if err != nil {
+			t.Fatalf("LookupIdentifiers failed: %v", err)
+		}
+		if len(matches) != 1 || matches[0].Accession != "ERS000001" || matches[0].RecordType != "sample" {
+			t.Errorf("Expected %s %q to find ERS000001, got %+v", idType, value, matches)
+		}
+	}
+
+	source, err := db.GetRecordSource("ERP000001")
+	if err != nil {
+		t.Fatalf("Expected provenance to be recorded: %v", err)
+	}
+	if source.Archive != SourceENA || source.SourceFile != "ena_study.xml.gz" || source.RecordType != "study" {
+		t.Errorf("Unexpected provenance: %+v", source)
+	}
+	ingest, err := db.GetIngest(source.IngestID)
+	if err != nil {
+		t.Fatalf("Expected the ingest to be recorded: %v", err)
+	}
+	if ingest.Input != dump || ingest.FinishedAt == nil || ingest.Records == 0 || ingest.Error != "" {
+		t.Errorf("Unexpected ingest: %+v", ingest)
+	}
+
+	// An explicit source overrides detection
+	processor.SetSource(SourceDDBJ)
+	if err := processor.ProcessFile(context.Background(), dump); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+	if source, _ := db.GetRecordSource("ERS000001"); source == nil || source.Archive != SourceDDBJ {
+		t.Errorf("Expected explicit source to be recorded, got %+v", source)
+	}
+}
+
+// TestProcessReaderPackages tests ingesting the experiment packages
+// E-utilities returns from a reader
+func TestProcessReaderPackages(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<EXPERIMENT_PACKAGE_SET>
+	<EXPERIMENT_PACKAGE>
+		<EXPERIMENT accession="SRX000001">
+			<TITLE>Liver RNA-Seq</TITLE>
+			<STUDY_REF accession="SRP000001"/>
+		</EXPERIMENT>
+		<STUDY accession="SRP000001">
+			<DESCRIPTOR><STUDY_TITLE>Liver Study</STUDY_TITLE></DESCRIPTOR>
+		</STUDY>
+		<SAMPLE accession="SRS000001">
+			<SAMPLE_NAME><TAXON_ID>9606</TAXON_ID><SCIENTIFIC_NAME>Homo sapiens</SCIENTIFIC_NAME></SAMPLE_NAME>
+		</SAMPLE>
+		<RUN_SET>
+			<RUN accession="SRR000001">
+				<EXPERIMENT_REF accession="SRX000001"/>
+			</RUN>
+		</RUN_SET>
+	</EXPERIMENT_PACKAGE>
+</EXPERIMENT_PACKAGE_SET>`
+
+	processor := NewStreamProcessor(db)
+	processor.SetSource(SourceNCBI)
+	if err := processor.ProcessReader(context.Background(), strings.NewReader(doc), "entrez-sra.xml"); err != nil {
+		t.Fatalf("Failed to process reader: %v", err)
+	}
+
+	if study, err := db.GetStudy("SRP000001"); err != nil || study.StudyTitle != "Liver Study" {
+		t.Errorf("Expected study to be ingested, got %+v (%v)", study, err)
+	}
+	if _, err := db.GetRun("SRR000001"); err != nil {
+		t.Errorf("Expected run to be ingested: %v", err)
+	}
+	if got := processor.GetStats()["records_processed"].(int64); got != 4 {
+		t.Errorf("Expected 4 records processed, got %d", got)
+	}
+	if source, _ := db.GetRecordSource("SRR000001"); source == nil || source.SourceFile != "entrez-sra.xml" {
+		t.Errorf("Expected provenance of the reader, got %+v", source)
+	}
+}
+
+// TestFileTransaction tests that a file failing part way leaves none of
+// its records, even those written in batches before the failure
+func TestFileTransaction(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	// A full batch of experiments is inserted before the run, which is cut
+	// off
+	var doc strings.Builder
+	doc.WriteString("<EXPERIMENT_SET>")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&doc, `<EXPERIMENT accession="SRX%06d"><TITLE>Experiment %d</TITLE></EXPERIMENT>`, i, i)
+	}
+	doc.WriteString(`</EXPERIMENT_SET><RUN_SET><RUN accession="SRR000001"><EXPERIMENT_REF accession="SRX000001"`)
+
+	processor := NewStreamProcessor(db)
+	if err := processor.ProcessReader(context.Background(), strings.NewReader(doc.String()), "ena-dump.xml"); err == nil {
+		t.Fatal("Expected the truncated document to fail")
+	}
+	if exp, err := db.GetExperiment("SRX000001"); err == nil {
+		t.Errorf("Expected no experiments of the failed document, got %+v", exp)
+	}
+	if source, _ := db.GetRecordSource("SRX000001"); source != nil {
+		t.Errorf("Expected no provenance of the failed document, got %+v", source)
+	}
+
+	// The same document, whole, lands in full
+	doc.WriteString(`/></RUN></RUN_SET>`)
+	if err := processor.ProcessReader(context.Background(), strings.NewReader(doc.String()), "ena-dump.xml"); err != nil {
+		t.Fatalf("Failed to process reader: %v", err)
+	}
+	if _, err := db.GetExperiment("SRX004999"); err != nil {
+		t.Errorf("Expected experiments to be ingested: %v", err)
+	}
+	if _, err := db.GetRun("SRR000001"); err != nil {
+		t.Errorf("Expected run to be ingested: %v", err)
+	}
+}
+
+// pausingReader pauses controller once head has been read, before tail
+type pausingReader struct {
+	head, tail io.Reader
+	controller *Controller
+	paused     chan struct{}
+}
+
+func (r *pausingReader) Read(p []byte) (int, error) {
+	if r.head != nil {
+		n, err := r.head.Read(p)
+		if err == io.EOF {
+			r.head = nil
+			r.controller.Pause()
+			close(r.paused)
+			err = nil
+		}
+		return n, err
+	}
+	return r.tail.Read(p)
+}
+
+// TestPausedFileTransaction tests that pausing part way through a
+// standalone XML document leaves the database open to other writers
+func TestPausedFileTransaction(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.db")
+	db, err := database.Initialize(path)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	other, err := database.Initialize(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer other.Close()
+
+	// More than a batch of experiments is read before the pause
+	var head strings.Builder
+	head.WriteString("<EXPERIMENT_SET>")
+	for i := 0; i < 6000; i++ {
+		fmt.Fprintf(&head, `<EXPERIMENT accession="SRX%06d"><TITLE>Experiment %d</TITLE></EXPERIMENT>`, i, i)
+	}
+	controller := NewController()
+	reader := &pausingReader{
+		head:       strings.NewReader(head.String()),
+		tail:       strings.NewReader("</EXPERIMENT_SET>"),
+		controller: controller,
+		paused:     make(chan struct{}),
+	}
+
+	processor := NewStreamProcessor(db)
+	processor.SetController(controller)
+	done := make(chan error, 1)
+	go func() { done <- processor.ProcessReader(context.Background(), reader, "ena-dump.xml") }()
+
+	<-reader.paused
+	time.Sleep(50 * time.Millisecond)
+	conn, err := other.GetSQLDB().Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(context.Background(), "PRAGMA busy_timeout = 200"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(),
+		"INSERT INTO studies (study_accession, study_title) VALUES ('SRP999999', 'Other writer')"); err != nil {
+		t.Errorf("Expected another writer to commit while paused: %v", err)
+	}
+
+	controller.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to process reader: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("processing did not resume")
+	}
+	if _, err := db.GetExperiment("SRX005999"); err != nil {
+		t.Errorf("Expected experiments to be ingested: %v", err)
+	}
+	var n int
+	if err := db.GetSQLDB().QueryRow("SELECT COUNT(*) FROM studies WHERE study_accession = 'SRP999999'").Scan(&n); err != nil || n != 1 {
+		t.Errorf("Expected the other writer's study, got %d (%v)", n, err)
+	}
+}
+
+// TestDetectSource tests archive detection from file names and accessions
+func TestDetectSource(t *testing.T) {
+	tests := map[string]string{
+		"ena_study.xml.gz":                          SourceENA,
+		"https://ftp.ebi.ac.uk/pub/sra/x.xml.gz":    SourceENA,
+		"/mirror/DRA000123.experiment.xml":          SourceDDBJ,
+		"ddbj_dump.tar.gz":                          SourceDDBJ,
+		"NCBI_SRA_Metadata_20250915.tar.gz":         SourceNCBI,
+		"https://ftp.ncbi.nlm.nih.gov/sra/a.tar.gz": SourceNCBI,
+		"generated_samples.xml":                     "",
+		"drama.xml":                                 "",
+	}
+	for name, want := range tests {
+		if got := DetectSource(name); got != want {
+			t.Errorf("DetectSource(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	if ArchiveForAccession("DRX000001") != SourceDDBJ || ArchiveForAccession("ERR1") != SourceENA ||
+		ArchiveForAccession("SRP1") != SourceNCBI || ArchiveForAccession("X") != "" {
+		t.Error("Unexpected archive for accession prefix")
+	}
+	if _, err := ParseSource("genbank"); err == nil {
+		t.Error("Expected error for unknown source")
+	}
+}
+
 // TestHTTPError tests handling of HTTP errors
 func TestHTTPError(t *testing.T) {
 	// Create server that returns 404
@@ -318,3 +961,504 @@ func (m *mockDatabase) InsertLink(link *database.Link) error {
 func (m *mockDatabase) GetLinks(recordType, recordAccession string) ([]database.Link, error) {
 	return nil, nil
 }
+
+// TestRecordAccess tests that consent and dbGaP hints are stored at ingest
+// and inherited by runs
+func TestRecordAccess(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "records.xml")
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<ROOT>
+	<STUDY accession="SRP000001">
+		<DESCRIPTOR><STUDY_TITLE>Controlled study</STUDY_TITLE></DESCRIPTOR>
+		<STUDY_LINKS><STUDY_LINK><XREF_LINK><DB>dbgap</DB><ID>phs000424</ID></XREF_LINK></STUDY_LINK></STUDY_LINKS>
+	</STUDY>
+	<STUDY accession="SRP000002">
+		<DESCRIPTOR><STUDY_TITLE>Open study</STUDY_TITLE></DESCRIPTOR>
+	</STUDY>
+	<SAMPLE accession="SRS000002">
+		<SAMPLE_NAME><TAXON_ID>9606</TAXON_ID></SAMPLE_NAME>
+		<SAMPLE_ATTRIBUTES>
+			<SAMPLE_ATTRIBUTE><TAG>gap_consent_code</TAG><VALUE>1</VALUE></SAMPLE_ATTRIBUTE>
+			<SAMPLE_ATTRIBUTE><TAG>gap_consent_short_name</TAG><VALUE>GRU</VALUE></SAMPLE_ATTRIBUTE>
+		</SAMPLE_ATTRIBUTES>
+	</SAMPLE>
+	<SAMPLE accession="SRS000003">
+		<SAMPLE_NAME><TAXON_ID>9606</TAXON_ID></SAMPLE_NAME>
+	</SAMPLE>
+	<EXPERIMENT accession="SRX000001">
+		<STUDY_REF accession="SRP000001"/>
+		<DESIGN><SAMPLE_DESCRIPTOR accession="SRS000003"/></DESIGN>
+	</EXPERIMENT>
+	<EXPERIMENT accession="SRX000002">
+		<STUDY_REF accession="SRP000002"/>
+		<DESIGN><SAMPLE_DESCRIPTOR accession="SRS000002"/></DESIGN>
+	</EXPERIMENT>
+	<EXPERIMENT accession="SRX000003">
+		<STUDY_REF accession="SRP000002"/>
+		<DESIGN><SAMPLE_DESCRIPTOR accession="SRS000003"/></DESIGN>
+	</EXPERIMENT>
+	<RUN accession="SRR000001"><EXPERIMENT_REF accession="SRX000001"/></RUN>
+	<RUN accession="SRR000002"><EXPERIMENT_REF accession="SRX000002"/></RUN>
+	<RUN accession="SRR000003"><EXPERIMENT_REF accession="SRX000003"/></RUN>
+</ROOT>`
+	if err := os.WriteFile(dump, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := NewStreamProcessor(db).ProcessFile(context.Background(), dump); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	if hint, _ := db.GetRecordAccess("SRS000002"); hint == nil || hint.Access != database.AccessControlled || hint.Consent != "GRU" {
+		t.Errorf("Expected sample consent GRU, got %+v", hint)
+	}
+	if hint, _ := db.GetRecordAccess("SRP000002"); hint != nil {
+		t.Errorf("Expected no hint for open study, got %+v", hint)
+	}
+
+	open, controlled, unknown, err := db.SplitOpenAccessRuns([]string{"SRR000001", "SRR000002", "SRR000003", "SRR999999"})
+	if err != nil {
+		t.Fatalf("SplitOpenAccessRuns failed: %v", err)
+	}
+	if strings.Join(open, ",") != "SRR000003" || strings.Join(unknown, ",") != "SRR999999" {
+		t.Errorf("Unexpected open %v or unknown %v runs", open, unknown)
+	}
+	if len(controlled) != 2 || controlled[0].From != "SRP000001" || controlled[1].Consent != "GRU" {
+		t.Errorf("Unexpected controlled runs: %+v %+v", controlled[0], controlled[1])
+	}
+}
+
+// TestRunFiles tests that the DATA_BLOCK files of runs are recorded
+func TestRunFiles(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "runs.xml")
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<RUN_SET>
+	<RUN accession="SRR000001">
+		<EXPERIMENT_REF accession="SRX000001"/>
+		<DATA_BLOCK>
+			<FILES>
+				<FILE filename="s1_R1.fastq.gz" filetype="fastq" checksum_method="MD5" checksum="9E107D9D372BB6826BD81D3542A419D6"/>
+				<FILE filename="s1_R2.fastq.gz" filetype="fastq" checksum_method="SHA-256" checksum="abc"/>
+			</FILES>
+		</DATA_BLOCK>
+	</RUN>
+</RUN_SET>`
+	if err := os.WriteFile(dump, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := NewStreamProcessor(db).ProcessFile(context.Background(), dump); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	matches, err := db.LookupRunFiles(database.IDTypeMD5, "9e107d9d372bb6826bd81d3542a419d6", 10)
+	if err != nil {
+		t.Fatalf("LookupRunFiles failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Accession != "SRR000001" || matches[0].Namespace != "s1_R1.fastq.gz" {
+		t.Errorf("Expected s1_R1.fastq.gz of SRR000001, got %+v", matches)
+	}
+	if matches, _ := db.LookupRunFiles(database.IDTypeFilename, "s1_R2.fastq.gz", 10); len(matches) != 1 {
+		t.Errorf("Expected s1_R2.fastq.gz to be recorded, got %+v", matches)
+	}
+	if matches, _ := db.LookupRunFiles(database.IDTypeMD5, "abc", 10); len(matches) != 0 {
+		t.Errorf("Expected no MD5 for a SHA-256 checksum, got %+v", matches)
+	}
+}
+
+// TestExtractAccess tests access-level hints in attributes
+func TestExtractAccess(t *testing.T) {
+	attr := func(tag, value string) []parser.Attribute {
+		return []parser.Attribute{{Tag: tag, Value: value}}
+	}
+	tests := []struct {
+		name    string
+		attrs   []parser.Attribute
+		access  string
+		consent string
+	}{
+		{"none", attr("tissue", "liver"), "", ""},
+		{"open consent", attr("Consent", "public"), database.AccessPublic, ""},
+		{"consent group", attr("consent", "HMB-IRB"), database.AccessControlled, "HMB-IRB"},
+		{"access level", attr("data access", "Controlled Access"), database.AccessControlled, ""},
+		{"dbgap accession", attr("gap_accession", "phs000424.v9.p2"), database.AccessControlled, ""},
+		{"not dbgap", attr("gap_accession", "phsx"), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, consent := ExtractAccess(nil, nil, tt.attrs)
+			if access != tt.access || consent != tt.consent {
+				t.Errorf("ExtractAccess() = %q, %q, want %q, %q", access, consent, tt.access, tt.consent)
+			}
+		})
+	}
+
+	ids := &parser.Identifiers{ExternalIDs: []parser.QualifiedID{{Namespace: "dbGaP", Value: "phs000424"}}}
+	if access, _ := ExtractAccess(ids, nil, nil); access != database.AccessControlled {
+		t.Errorf("Expected dbGaP external ID to be controlled, got %q", access)
+	}
+}
+
+// TestApplySuppressions tests that a daily update replaces changed records
+// and removes the targets of SUPPRESS actions
+func TestApplySuppressions(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.xml")
+	baseDoc := `<?xml version="1.0" encoding="UTF-8"?>
+<ROOT>
+	<STUDY accession="SRP000001"><DESCRIPTOR><STUDY_TITLE>Old title</STUDY_TITLE></DESCRIPTOR></STUDY>
+	<STUDY accession="SRP000002"><DESCRIPTOR><STUDY_TITLE>Withdrawn</STUDY_TITLE></DESCRIPTOR></STUDY>
+	<SAMPLE accession="SRS000001"><SAMPLE_NAME><TAXON_ID>9606</TAXON_ID></SAMPLE_NAME></SAMPLE>
+	<EXPERIMENT accession="SRX000002">
+		<STUDY_REF accession="SRP000002"/>
+		<DESIGN><SAMPLE_DESCRIPTOR accession="SRS000001"/></DESIGN>
+	</EXPERIMENT>
+	<RUN accession="SRR000002"><EXPERIMENT_REF accession="SRX000002"/></RUN>
+</ROOT>`
+	update := filepath.Join(dir, "SRA000003.submission.xml")
+	updateDoc := `<?xml version="1.0" encoding="UTF-8"?>
+<SUBMISSION_SET>
+	<SUBMISSION accession="SRA000003">
+		<ACTIONS>
+			<ACTION><MODIFY source="study.xml"/></ACTION>
+			<ACTION><SUPPRESS target="SRP000002"/></ACTION>
+		</ACTIONS>
+	</SUBMISSION>
+	<STUDY accession="SRP000001"><DESCRIPTOR><STUDY_TITLE>New title</STUDY_TITLE></DESCRIPTOR></STUDY>
+</SUBMISSION_SET>`
+	if err := os.WriteFile(base, []byte(baseDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(update, []byte(updateDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := NewStreamProcessor(db).ProcessFile(ctx, base); err != nil {
+		t.Fatalf("Failed to process base: %v", err)
+	}
+
+	// Suppressions are ignored unless enabled
+	if err := NewStreamProcessor(db).ProcessFile(ctx, update); err != nil {
+		t.Fatalf("Failed to process update: %v", err)
+	}
+	if _, err := db.GetStudy("SRP000002"); err != nil {
+		t.Fatalf("Expected study to be kept without suppressions enabled: %v", err)
+	}
+
+	sp := NewStreamProcessor(db)
+	sp.SetApplySuppressions(true)
+	if err := sp.ProcessFile(ctx, update); err != nil {
+		t.Fatalf("Failed to process update: %v", err)
+	}
+
+	if study, err := db.GetStudy("SRP000001"); err != nil || study.StudyTitle != "New title" {
+		t.Errorf("Expected updated study title, got %+v (%v)", study, err)
+	}
+	for _, check := range []func() error{
+		func() error { _, err := db.GetStudy("SRP000002"); return err },
+		func() error { _, err := db.GetExperiment("SRX000002"); return err },
+		func() error { _, err := db.GetRun("SRR000002"); return err },
+	} {
+		if check() == nil {
+			t.Error("Expected suppressed study, experiment, and run to be removed")
+		}
+	}
+	if _, err := db.GetSample("SRS000001"); err != nil {
+		t.Errorf("Expected sample to be kept: %v", err)
+	}
+	if n := sp.GetStats()["records_suppressed"].(int64); n != 3 {
+		t.Errorf("Expected 3 records suppressed, got %d", n)
+	}
+}
+
+// TestFilterExpr tests that a filter expression skips records by the
+// fields of their own type
+func TestFilterExpr(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "records.xml")
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<ROOT>
+	<STUDY accession="SRP000001"><DESCRIPTOR><STUDY_TITLE>Study</STUDY_TITLE></DESCRIPTOR></STUDY>
+	<SAMPLE accession="SRS000001"><SAMPLE_NAME><TAXON_ID>9606</TAXON_ID></SAMPLE_NAME></SAMPLE>
+	<SAMPLE accession="SRS000002"><SAMPLE_NAME><TAXON_ID>10090</TAXON_ID></SAMPLE_NAME></SAMPLE>
+	<EXPERIMENT accession="SRX000001">
+		<STUDY_REF accession="SRP000001"/>
+		<DESIGN><LIBRARY_DESCRIPTOR><LIBRARY_STRATEGY>RNA-Seq</LIBRARY_STRATEGY></LIBRARY_DESCRIPTOR></DESIGN>
+	</EXPERIMENT>
+	<EXPERIMENT accession="SRX000002">
+		<STUDY_REF accession="SRP000001"/>
+		<DESIGN><LIBRARY_DESCRIPTOR><LIBRARY_STRATEGY>WGS</LIBRARY_STRATEGY></LIBRARY_DESCRIPTOR></DESIGN>
+	</EXPERIMENT>
+	<RUN accession="SRR000001"><EXPERIMENT_REF accession="SRX000001"/><Statistics total_spots="10" total_bases="2000000000"/></RUN>
+	<RUN accession="SRR000002"><EXPERIMENT_REF accession="SRX000001"/><Statistics total_spots="10" total_bases="1000"/></RUN>
+</ROOT>`
+	if err := os.WriteFile(dump, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	fp, err := NewFilteredProcessor(db, FilterOptions{
+		Expr: `taxon_id == 9606 && strategy in ["RNA-Seq", "ATAC-seq"] && total_bases > 1e9`,
+	})
+	if err != nil {
+		t.Fatalf("NewFilteredProcessor failed: %v", err)
+	}
+	if err := fp.ProcessWithFilters(context.Background(), dump); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	for acc, want := range map[string]bool{
+		"SRP000001": true, "SRS000001": true, "SRS000002": false,
+		"SRX000001": true, "SRX000002": false, "SRR000001": true, "SRR000002": false,
+	} {
+		var err error
+		switch acc[:3] {
+		case "SRP":
+			_, err = db.GetStudy(acc)
+		case "SRS":
+			_, err = db.GetSample(acc)
+		case "SRX":
+			_, err = db.GetExperiment(acc)
+		default:
+			_, err = db.GetRun(acc)
+		}
+		if got := err == nil; got != want {
+			t.Errorf("%s: kept = %v, want %v", acc, got, want)
+		}
+	}
+	if fp.GetStats().SkippedByExpr != 3 {
+		t.Errorf("Expected 3 records skipped by expression, got %d", fp.GetStats().SkippedByExpr)
+	}
+
+	if _, err := NewFilteredProcessor(db, FilterOptions{Expr: "taxid == 9606"}); err == nil {
+		t.Error("Expected an undeclared field to be rejected")
+	}
+}
+
+// TestFilterExprRelated tests that runs are filtered with the fields of
+// their experiment, samples and study, which come after the runs in the
+// submission directories of an archive
+func TestFilterExprRelated(t *testing.T) {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	write := func(name, content string) {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := io.WriteString(tarWriter, content); err != nil {
+			t.Fatalf("Failed to write tar content: %v", err)
+		}
+	}
+	write("SRA000001/SRA000001.experiment.xml", `<EXPERIMENT_SET>
+	<EXPERIMENT accession="SRX000001"><STUDY_REF accession="SRP000001"/>
+		<DESIGN><SAMPLE_DESCRIPTOR accession="SRS000001"/><LIBRARY_DESCRIPTOR><LIBRARY_STRATEGY>RNA-Seq</LIBRARY_STRATEGY></LIBRARY_DESCRIPTOR></DESIGN>
+	</EXPERIMENT>
+	<EXPERIMENT accession="SRX000002"><STUDY_REF accession="SRP000001"/>
+		<DESIGN><SAMPLE_DESCRIPTOR accession="SRS000002"/><LIBRARY_DESCRIPTOR><LIBRARY_STRATEGY>RNA-Seq</LIBRARY_STRATEGY></LIBRARY_DESCRIPTOR></DESIGN>
+	</EXPERIMENT>
+</EXPERIMENT_SET>`)
+	write("SRA000001/SRA000001.run.xml", `<RUN_SET>
+	<RUN accession="SRR000001"><EXPERIMENT_REF accession="SRX000001"/><Statistics total_spots="10" total_bases="2000000000"/></RUN>
+	<RUN accession="SRR000002"><EXPERIMENT_REF accession="SRX000002"/><Statistics total_spots="10" total_bases="2000000000"/></RUN>
+</RUN_SET>`)
+	write("SRA000001/SRA000001.sample.xml", `<SAMPLE_SET>
+	<SAMPLE accession="SRS000001"><SAMPLE_NAME><TAXON_ID>9606</TAXON_ID></SAMPLE_NAME></SAMPLE>
+	<SAMPLE accession="SRS000002"><SAMPLE_NAME><TAXON_ID>10090</TAXON_ID></SAMPLE_NAME></SAMPLE>
+</SAMPLE_SET>`)
+	write("SRA000001/SRA000001.study.xml", `<STUDY_SET>
+	<STUDY accession="SRP000001"><DESCRIPTOR><STUDY_TITLE>Study</STUDY_TITLE></DESCRIPTOR></STUDY>
+</STUDY_SET>`)
+	tarWriter.Close()
+	gzWriter.Close()
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "test.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 4} {
+		db, err := database.Initialize(filepath.Join(dir, fmt.Sprintf("test%d.db", workers)))
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+
+		fp, err := NewFilteredProcessor(db, FilterOptions{
+			Expr: `taxon_id == 9606 && strategy in ["RNA-Seq", "ATAC-seq"] && total_bases > 1e9`,
+		})
+		if err != nil {
+			t.Fatalf("NewFilteredProcessor failed: %v", err)
+		}
+		fp.SetWorkers(workers)
+		if err := fp.ProcessWithFilters(context.Background(), archive); err != nil {
+			t.Fatalf("Failed to process file: %v", err)
+		}
+
+		if _, err := db.GetRun("SRR000001"); err != nil {
+			t.Errorf("workers %d: expected the run of the human sample to be kept: %v", workers, err)
+		}
+		if _, err := db.GetRun("SRR000002"); err == nil {
+			t.Errorf("workers %d: expected the run of the mouse sample to be skipped", workers)
+		}
+		if _, err := db.GetStudy("SRP000001"); err != nil {
+			t.Errorf("workers %d: expected the study to be kept: %v", workers, err)
+		}
+	}
+}
+
+func TestSampleRuns(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.xml")
+	// Runs come before their experiment, as they can across archive files
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<ROOT>
+	<RUN accession="SRR000001"><EXPERIMENT_REF accession="SRX000001"/></RUN>
+	<RUN accession="SRR000002"><EXPERIMENT_REF accession="SRX000001"/></RUN>
+	<EXPERIMENT accession="SRX000001">
+		<STUDY_REF accession="SRP000001"/>
+		<DESIGN><SAMPLE_DESCRIPTOR accession="SRS000001"/></DESIGN>
+	</EXPERIMENT>
+	<EXPERIMENT accession="SRX000002">
+		<STUDY_REF accession="SRP000001"/>
+		<DESIGN><SAMPLE_DESCRIPTOR accession="SRS000001"/></DESIGN>
+	</EXPERIMENT>
+	<RUN accession="SRR000003"><EXPERIMENT_REF accession="SRX000002"/></RUN>
+</ROOT>`
+	if err := os.WriteFile(path, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := NewStreamProcessor(db).ProcessFile(context.Background(), path); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	links, err := db.GetSampleRuns("SRS000001")
+	if err != nil {
+		t.Fatalf("GetSampleRuns failed: %v", err)
+	}
+	if len(links) != 3 {
+		t.Fatalf("Expected 3 runs for the sample, got %+v", links)
+	}
+	for i, want := range []string{"SRR000001", "SRR000002", "SRR000003"} {
+		if links[i].RunAccession != want || links[i].StudyAccession != "SRP000001" {
+			t.Errorf("Expected %s of SRP000001, got %+v", want, links[i])
+		}
+	}
+}
+
+// TestIngestTransforms tests that the attributes of records from centers
+// with transforms are rewritten before they are filtered and inserted
+func TestIngestTransforms(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "transforms.yaml")
+	config := `
+centers:
+  - center: BGI
+    rules:
+      - tag: characteristics
+        split: ';\s*'
+        key_value: '^\s*([^=]+?)\s*=\s*(.*?)\s*$'
+      - rename:
+          cell type: cell_type
+`
+	if err := os.WriteFile(rules, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dump := filepath.Join(dir, "records.xml")
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<ROOT>
+	<SAMPLE accession="SRS000001" center_name="bgi">
+		<SAMPLE_NAME><TAXON_ID>9606</TAXON_ID></SAMPLE_NAME>
+		<SAMPLE_ATTRIBUTES>
+			<SAMPLE_ATTRIBUTE><TAG>characteristics</TAG><VALUE>tissue=liver; cell type=hepatocyte</VALUE></SAMPLE_ATTRIBUTE>
+		</SAMPLE_ATTRIBUTES>
+	</SAMPLE>
+	<SAMPLE accession="SRS000002" center_name="GEO">
+		<SAMPLE_NAME><TAXON_ID>9606</TAXON_ID></SAMPLE_NAME>
+		<SAMPLE_ATTRIBUTES>
+			<SAMPLE_ATTRIBUTE><TAG>characteristics</TAG><VALUE>tissue=liver</VALUE></SAMPLE_ATTRIBUTE>
+			<SAMPLE_ATTRIBUTE><TAG>tissue</TAG><VALUE>lung</VALUE></SAMPLE_ATTRIBUTE>
+		</SAMPLE_ATTRIBUTES>
+	</SAMPLE>
+</ROOT>`
+	if err := os.WriteFile(dump, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	transforms, err := LoadTransforms(rules)
+	if err != nil {
+		t.Fatalf("LoadTransforms failed: %v", err)
+	}
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	fp, err := NewFilteredProcessor(db, FilterOptions{Expr: `"tissue" in attributes`})
+	if err != nil {
+		t.Fatalf("NewFilteredProcessor failed: %v", err)
+	}
+	fp.SetTransforms(transforms)
+	if err := fp.ProcessWithFilters(context.Background(), dump); err != nil {
+		t.Fatalf("Failed to process file: %v", err)
+	}
+
+	sample, err := db.GetSample("SRS000001")
+	if err != nil {
+		t.Fatalf("Expected the transformed sample to pass the filter: %v", err)
+	}
+	if sample.Tissue != "liver" || sample.CellType != "hepatocyte" {
+		t.Errorf("Expected tissue liver and cell type hepatocyte, got %q and %q", sample.Tissue, sample.CellType)
+	}
+	attrs, err := db.GetSampleAttributes([]string{"SRS000001", "SRS000002"}, []string{"characteristics", "tissue"})
+	if err != nil {
+		t.Fatalf("GetSampleAttributes failed: %v", err)
+	}
+	if len(attrs["SRS000001"]) != 1 || attrs["SRS000001"][0].Value != "liver" {
+		t.Errorf("Expected the packed attribute to be split, got %+v", attrs["SRS000001"])
+	}
+
+	other, err := db.GetSample("SRS000002")
+	if err != nil {
+		t.Fatalf("GetSample failed: %v", err)
+	}
+	if other.Tissue != "lung" || len(attrs["SRS000002"]) != 2 {
+		t.Errorf("Expected the sample of another center unchanged, got tissue %q and %+v", other.Tissue, attrs["SRS000002"])
+	}
+}
@@ -7,6 +7,12 @@ import (
 	"github.com/nishad/srake/internal/parser"
 )
 
+// IdentifierStore is implemented by databases that can store many
+// identifiers in one transaction.
+type IdentifierStore interface {
+	InsertIdentifiers(identifiers []database.Identifier) error
+}
+
 // IdentifierHandler manages structured identifier and link storage
 type IdentifierHandler struct {
 	db Database
@@ -109,6 +115,38 @@ func (ih *IdentifierHandler) ExtractIdentifiers(identifiers *parser.Identifiers,
 	return structuredIDs
 }
 
+// RecordIdentifiers returns the identifiers of a record worth looking up:
+// its center-assigned alias and everything in its IDENTIFIERS block except
+// the primary ID, which repeats the accession.
+func (ih *IdentifierHandler) RecordIdentifiers(identifiers *parser.Identifiers, recordType, recordAccession, alias, centerName string) []database.Identifier {
+	var ids []database.Identifier
+	if alias != "" && alias != recordAccession {
+		ids = append(ids, database.Identifier{
+			RecordType:      recordType,
+			RecordAccession: recordAccession,
+			IDType:          database.IDTypeAlias,
+			IDNamespace:     centerName,
+			IDValue:         alias,
+		})
+	}
+
+	for _, id := range ih.ExtractIdentifiers(identifiers, recordType, recordAccession) {
+		if id.IDType == "primary" || id.IDValue == "" {
+			continue
+		}
+		ids = append(ids, database.Identifier{
+			RecordType:      id.RecordType,
+			RecordAccession: id.RecordAccession,
+			IDType:          id.IDType,
+			IDNamespace:     id.IDNamespace,
+			IDValue:         id.IDValue,
+			IDLabel:         id.IDLabel,
+		})
+	}
+
+	return ids
+}
+
 // ExtractLinks extracts all links from a record
 func (ih *IdentifierHandler) ExtractLinks(links []parser.Link, recordType, recordAccession string) []StructuredLink {
 	var structuredLinks []StructuredLink
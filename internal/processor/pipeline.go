@@ -0,0 +1,216 @@
+package processor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/nishad/srake/internal/database"
+	srerrors "github.com/nishad/srake/internal/errors"
+)
+
+// SetWorkers sets how many XML files of an archive are decoded in
+// parallel. With more than one, the archive is read on one goroutine, its
+// files decoded by n workers and their records written by a single writer,
+// in archive order; 1 or less decodes each file as it is read.
+func (sp *StreamProcessor) SetWorkers(n int) {
+	sp.workers = n
+}
+
+// archiveEntry is an XML file read from an archive, numbered in archive
+// order
+type archiveEntry struct {
+	seq  int
+	name string
+	data []byte
+}
+
+// decodedEntry holds the records decoded from an archive entry, or the
+// error decoding it
+type decodedEntry struct {
+	seq         int
+	name        string
+	records     xmlRecords
+	raw         []database.RawRecord         // when storing raw records
+	quarantined []database.QuarantinedRecord // when validating
+	err         error
+}
+
+// processTarPipeline processes a tar stream with sp.workers decoders
+// between the reader and the writer. At most two files per worker are
+// read but not yet written, so that a slow writer holds up the reader
+// instead of the archive piling up in memory.
+func (sp *StreamProcessor) processTarPipeline(ctx context.Context, reader io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	inFlight := make(chan struct{}, 2*sp.workers)
+	entries := make(chan archiveEntry)
+	decoded := make(chan decodedEntry)
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(entries)
+		readErr <- sp.readTarEntries(ctx, reader, inFlight, entries)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < sp.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range entries {
+				select {
+				case decoded <- sp.decodeEntry(e):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(decoded)
+	}()
+
+	err := sp.writeEntries(ctx, decoded, inFlight)
+
+	// Stop the reader and decoders, and wait for them
+	cancel()
+	for range decoded {
+	}
+	if err != nil {
+		return err
+	}
+	return <-readErr
+}
+
+// readTarEntries reads the XML files of a tar stream into entries, in
+// order, taking a slot of inFlight for each
+func (sp *StreamProcessor) readTarEntries(ctx context.Context, reader io.Reader, inFlight chan<- struct{}, entries chan<- archiveEntry) error {
+	tarReader := tar.NewReader(reader)
+	seq := 0
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || !strings.HasSuffix(header.Name, ".xml") {
+			continue
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		sp.updateProgress(header.Name)
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+
+		select {
+		case entries <- archiveEntry{seq: seq, name: header.Name, data: data}:
+			seq++
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// decodeEntry decodes the records of an archive entry, and splits out its
+// raw records when they are stored or validated
+func (sp *StreamProcessor) decodeEntry(e archiveEntry) decodedEntry {
+	d := decodedEntry{seq: e.seq, name: e.name}
+	if _, ok := sp.db.(RawStore); (sp.storeRaw && ok) || sp.validator != nil {
+		// Malformed files are reported by the decoder
+		raw, _ := SplitRawRecords(e.data)
+		if d.raw, d.quarantined, d.err = sp.checkRecords(raw, e.name); d.err != nil {
+			return d
+		}
+	}
+	d.err = decodeXMLFile(bytes.NewReader(e.data), e.name, &d.records, nil)
+	return d
+}
+
+// writeEntries inserts the records of decoded entries in archive order,
+// releasing the slot of inFlight of each once written. As when processing
+// one file at a time, files that fail are reported and skipped, unless
+// the disk is full.
+func (sp *StreamProcessor) writeEntries(ctx context.Context, decoded <-chan decodedEntry, inFlight <-chan struct{}) error {
+	write := func(e *decodedEntry) error {
+		err := sp.writeEntry(ctx, e)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if srerrors.Classify(err) == srerrors.KindDiskFull {
+				return fmt.Errorf("failed to process %s: %w", e.name, err)
+			}
+			fmt.Printf("Warning: failed to process %s: %v\n", e.name, err)
+		}
+		return nil
+	}
+	// Run files deferred until their submission directory is written
+	var deferred []decodedEntry
+	flush := func() error {
+		for i := range deferred {
+			if err := write(&deferred[i]); err != nil {
+				return err
+			}
+		}
+		deferred = nil
+		return nil
+	}
+
+	pending := make(map[int]decodedEntry)
+	next := 0
+	for d := range decoded {
+		pending[d.seq] = d
+		for {
+			e, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			later, err := sp.deferRuns(e.name, flush)
+			if err == nil && later {
+				deferred = append(deferred, e)
+			} else if err == nil {
+				err = write(&e)
+			}
+			<-inFlight
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// writeEntry quarantines the records of an entry that failed validation,
+// stores its raw records and inserts the rest, in a single transaction
+func (sp *StreamProcessor) writeEntry(ctx context.Context, e *decodedEntry) error {
+	return sp.inFileTx(ctx, func(db Database) error {
+		if err := sp.writeRecordXML(db, e.raw, e.quarantined); err != nil {
+			return err
+		}
+		if e.err != nil {
+			return e.err
+		}
+		return sp.insertRecords(ctx, db, &e.records, true)
+	})
+}
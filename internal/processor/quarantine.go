@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"path"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/validator"
+)
+
+// QuarantineStore is implemented by databases that can keep the records
+// that failed validation at ingest, with their XML and errors.
+type QuarantineStore interface {
+	QuarantineRecords(records []database.QuarantinedRecord) error
+}
+
+// validatedRecordTypes are the record types validated at ingest: those
+// inserted. Submissions are applied and analyses kept as raw XML only.
+var validatedRecordTypes = map[string]bool{
+	"study":      true,
+	"experiment": true,
+	"sample":     true,
+	"run":        true,
+}
+
+// SetValidator makes the processor validate each study, experiment, sample
+// and run before inserting it. Records with validation errors are
+// quarantined with their XML, if the database supports it, instead of
+// being inserted; warnings do not quarantine a record. A nil validator
+// inserts every record.
+func (sp *StreamProcessor) SetValidator(v *validator.Validator) {
+	sp.validator = v
+}
+
+// checkRecords validates the raw records of an XML file, returning those
+// that pass and those to quarantine
+func (sp *StreamProcessor) checkRecords(raw []database.RawRecord, name string) ([]database.RawRecord, []database.QuarantinedRecord, error) {
+	if sp.validator == nil {
+		return raw, nil, nil
+	}
+
+	passed := raw[:0:0]
+	var quarantined []database.QuarantinedRecord
+	for _, r := range raw {
+		if !validatedRecordTypes[r.RecordType] {
+			passed = append(passed, r)
+			continue
+		}
+		result, err := sp.validator.ValidateXML(r.XML)
+		if err != nil {
+			return nil, nil, err
+		}
+		if result.IsValid {
+			passed = append(passed, r)
+			continue
+		}
+		q := database.QuarantinedRecord{
+			IngestID:   sp.ingestID,
+			Accession:  r.Accession,
+			RecordType: r.RecordType,
+			SourceFile: path.Base(name),
+			XML:        r.XML,
+		}
+		for _, e := range result.Errors {
+			q.Errors = append(q.Errors, database.QuarantineError{Type: e.Type, Field: e.Field, Message: e.Message})
+		}
+		quarantined = append(quarantined, q)
+	}
+	return passed, quarantined, nil
+}
+
+// quarantine stores the records of an XML file that failed validation and
+// marks them to be skipped when its records are inserted
+func (sp *StreamProcessor) quarantine(db Database, records []database.QuarantinedRecord) error {
+	sp.quarantined = nil
+	if len(records) == 0 {
+		return nil
+	}
+	if store, ok := db.(QuarantineStore); ok {
+		if err := store.QuarantineRecords(records); err != nil {
+			return err
+		}
+	}
+	sp.quarantined = make(map[string]bool, len(records))
+	for _, r := range records {
+		sp.quarantined[r.Accession] = true
+	}
+	sp.recordsQuarantined.Add(int64(len(records)))
+	return nil
+}
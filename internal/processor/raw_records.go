@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// RawStore is implemented by databases that can keep the original XML of
+// each record next to its extracted fields.
+type RawStore interface {
+	StoreRawRecords(records []database.RawRecord) (int, error)
+}
+
+// rawRecordTypes maps record elements to their record types
+var rawRecordTypes = map[string]string{
+	"STUDY":      "study",
+	"EXPERIMENT": "experiment",
+	"SAMPLE":     "sample",
+	"RUN":        "run",
+	"SUBMISSION": "submission",
+	"ANALYSIS":   "analysis",
+}
+
+// SplitRawRecords returns the XML of each record in a record set document,
+// byte for byte as it appears in the input.
+func SplitRawRecords(data []byte) ([]database.RawRecord, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var records []database.RawRecord
+	depth := 0
+
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			recordType, ok := rawRecordTypes[t.Name.Local]
+			if depth != 1 || !ok {
+				depth++
+				continue
+			}
+			if err := decoder.Skip(); err != nil {
+				return records, err
+			}
+			accession := ""
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "accession" {
+					accession = attr.Value
+				}
+			}
+			if accession != "" {
+				records = append(records, database.RawRecord{
+					Accession:  accession,
+					RecordType: recordType,
+					XML:        bytes.Clone(data[start:decoder.InputOffset()]),
+				})
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// SetStoreRaw enables storing the original XML of each record, if the
+// database supports it.
+func (sp *StreamProcessor) SetStoreRaw(enabled bool) {
+	sp.storeRaw = enabled
+}
+
+// storeRawRecords reads an XML file fully when its raw records are stored
+// or validated, quarantines those failing validation, stores the raw
+// records of the rest, and returns a reader over the same content for
+// regular processing.
+func (sp *StreamProcessor) storeRawRecords(db Database, reader io.Reader, name string) (io.Reader, error) {
+	sp.quarantined = nil
+	if _, ok := db.(RawStore); (!sp.storeRaw || !ok) && sp.validator == nil {
+		return reader, nil
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	records, err := SplitRawRecords(data)
+	if err != nil {
+		// Malformed files are reported by the decoder during processing
+		return bytes.NewReader(data), nil
+	}
+	records, quarantined, err := sp.checkRecords(records, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := sp.writeRecordXML(db, records, quarantined); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// writeRecordXML quarantines the records of an XML file that failed
+// validation, so that they are skipped when its records are inserted, and
+// stores the raw records of the rest when they are stored.
+func (sp *StreamProcessor) writeRecordXML(db Database, raw []database.RawRecord, quarantined []database.QuarantinedRecord) error {
+	if err := sp.quarantine(db, quarantined); err != nil {
+		return fmt.Errorf("failed to quarantine records: %w", err)
+	}
+	if store, ok := db.(RawStore); ok && sp.storeRaw && len(raw) > 0 {
+		if _, err := store.StoreRawRecords(raw); err != nil {
+			return fmt.Errorf("failed to store raw records: %w", err)
+		}
+	}
+	return nil
+}
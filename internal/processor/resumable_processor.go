@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/nishad/srake/internal/database"
+	srerrors "github.com/nishad/srake/internal/errors"
 	"github.com/nishad/srake/internal/parser"
 	"github.com/nishad/srake/internal/progress"
 )
@@ -30,11 +31,10 @@ type ResumableProcessor struct {
 
 // ResumeOptions configures resume behavior
 type ResumeOptions struct {
-	ForceRestart    bool          // Force fresh start even if progress exists
-	Interactive     bool          // Ask user about resume
-	CheckpointEvery time.Duration // How often to checkpoint
-	MaxRetries      int           // Maximum retry attempts
-	RetryDelay      time.Duration // Initial retry delay
+	ForceRestart    bool              // Force fresh start even if progress exists
+	Interactive     bool              // Ask user about resume
+	CheckpointEvery time.Duration     // How often to checkpoint
+	RetryPolicies   srerrors.Policies // Per-kind retry policies (srerrors.DefaultPolicies when nil)
 }
 
 // NewResumableProcessor creates a processor with resume capabilities
@@ -157,46 +157,29 @@ func (rp *ResumableProcessor) ProcessURLWithResume(ctx context.Context, url stri
 	return rp.processWithRetry(ctx, url, progressInfo, opts)
 }
 
-// processWithRetry handles retry logic for failed downloads/processing
+// processWithRetry handles retry logic for failed downloads/processing.
+// Each failure is classified and retried according to the policy for its
+// kind, so a dropped connection is retried while malformed XML is not.
 func (rp *ResumableProcessor) processWithRetry(ctx context.Context, url string, progress *progress.Progress, opts ResumeOptions) error {
-	maxRetries := opts.MaxRetries
-	if maxRetries == 0 {
-		maxRetries = 3
+	policies := opts.RetryPolicies
+	if policies == nil {
+		policies = srerrors.DefaultPolicies()
 	}
 
-	retryDelay := opts.RetryDelay
-	if retryDelay == 0 {
-		retryDelay = 5 * time.Second
-	}
-
-	var lastErr error
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		if attempt > 0 {
-			fmt.Printf("Retry attempt %d/%d after %v...\n", attempt, maxRetries, retryDelay)
-			time.Sleep(retryDelay)
-			retryDelay *= 2 // Exponential backoff
-		}
-
-		err := rp.processURLInternal(ctx, url, progress)
-		if err == nil {
-			// Success - mark as completed
-			return rp.tracker.MarkCompleted()
-		}
-
-		lastErr = err
-
-		// Check if error is retryable
-		if !rp.isRetryableError(err) {
-			break
-		}
-
-		// Update progress state
+	err := srerrors.Retry(ctx, policies, func() error {
+		return rp.processURLInternal(ctx, url, progress)
+	}, func(err error, kind srerrors.Kind, attempt int, policy srerrors.Policy, wait time.Duration) {
 		_ = rp.tracker.MarkFailed(err.Error())
+		fmt.Printf("%s error: %v\n", kind, err)
+		fmt.Printf("Retry attempt %d/%d after %v...\n", attempt, policy.MaxAttempts, wait)
+	})
+	if err != nil {
+		_ = rp.tracker.MarkFailed(fmt.Sprintf("%s error: %v", srerrors.Classify(err), err))
+		return err
 	}
 
-	// Final failure
-	_ = rp.tracker.MarkFailed(fmt.Sprintf("Failed after %d attempts: %v", maxRetries, lastErr))
-	return lastErr
+	// Success - mark as completed
+	return rp.tracker.MarkCompleted()
 }
 
 // processURLInternal performs the actual processing with resume support
@@ -225,7 +208,7 @@ func (rp *ResumableProcessor) processURLInternal(ctx context.Context, url string
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return fmt.Errorf("unexpected response: %w", &srerrors.StatusError{Code: resp.StatusCode, Status: resp.Status})
 	}
 
 	// Update total bytes if not resuming
@@ -308,8 +291,14 @@ func (rp *ResumableProcessor) processTarGzStreamWithResume(ctx context.Context,
 			continue
 		}
 
-		// Process the XML file
-		recordCount, err := rp.processXMLFileWithTracking(tarReader, header)
+		// Process the XML file, recording it as processed only once all of
+		// its records are committed
+		var recordCount int
+		err = rp.inFileTx(ctx, func(db Database) error {
+			var err error
+			recordCount, err = rp.processXMLFileWithTracking(db, tarReader, header)
+			return err
+		})
 		if err != nil {
 			fmt.Printf("Error processing %s: %v\n", header.Name, err)
 			// Continue with next file instead of failing completely
@@ -340,8 +329,9 @@ func (rp *ResumableProcessor) processTarGzStreamWithResume(ctx context.Context,
 	return nil
 }
 
-// processXMLFileWithTracking processes an XML file and returns record count
-func (rp *ResumableProcessor) processXMLFileWithTracking(reader io.Reader, header *tar.Header) (int, error) {
+// processXMLFileWithTracking processes an XML file into db and returns
+// record count
+func (rp *ResumableProcessor) processXMLFileWithTracking(db Database, reader io.Reader, header *tar.Header) (int, error) {
 	decoder := xml.NewDecoder(reader)
 	recordCount := 0
 
@@ -360,7 +350,7 @@ func (rp *ResumableProcessor) processXMLFileWithTracking(reader io.Reader, heade
 				var expSet parser.ExperimentSet
 				if err := decoder.DecodeElement(&expSet, &se); err == nil {
 					for _, exp := range expSet.Experiments {
-						if err := rp.processExperiment(&exp); err == nil {
+						if err := rp.processExperiment(db, &exp); err == nil {
 							recordCount++
 						}
 					}
@@ -370,7 +360,7 @@ func (rp *ResumableProcessor) processXMLFileWithTracking(reader io.Reader, heade
 				var sampleSet parser.SampleSet
 				if err := decoder.DecodeElement(&sampleSet, &se); err == nil {
 					for _, sample := range sampleSet.Samples {
-						if err := rp.processSample(&sample); err == nil {
+						if err := rp.processSample(db, &sample); err == nil {
 							recordCount++
 						}
 					}
@@ -380,7 +370,7 @@ func (rp *ResumableProcessor) processXMLFileWithTracking(reader io.Reader, heade
 				var runSet parser.RunSet
 				if err := decoder.DecodeElement(&runSet, &se); err == nil {
 					for _, run := range runSet.Runs {
-						if err := rp.processRun(&run); err == nil {
+						if err := rp.processRun(db, &run); err == nil {
 							recordCount++
 						}
 					}
@@ -390,7 +380,7 @@ func (rp *ResumableProcessor) processXMLFileWithTracking(reader io.Reader, heade
 				var studySet parser.StudySet
 				if err := decoder.DecodeElement(&studySet, &se); err == nil {
 					for _, study := range studySet.Studies {
-						if err := rp.processStudy(&study); err == nil {
+						if err := rp.processStudy(db, &study); err == nil {
 							recordCount++
 						}
 					}
@@ -404,7 +394,7 @@ func (rp *ResumableProcessor) processXMLFileWithTracking(reader io.Reader, heade
 }
 
 // Helper methods for processing different record types
-func (rp *ResumableProcessor) processExperiment(exp *parser.Experiment) error {
+func (rp *ResumableProcessor) processExperiment(db Database, exp *parser.Experiment) error {
 	dbExp := &database.Experiment{
 		ExperimentAccession: exp.Accession,
 		Title:               exp.Title,
@@ -420,10 +410,10 @@ func (rp *ResumableProcessor) processExperiment(exp *parser.Experiment) error {
 		dbExp.LibrarySelection = exp.Design.LibraryDescriptor.LibrarySelection
 	}
 
-	return rp.db.InsertExperiment(dbExp)
+	return db.InsertExperiment(dbExp)
 }
 
-func (rp *ResumableProcessor) processSample(sample *parser.Sample) error {
+func (rp *ResumableProcessor) processSample(db Database, sample *parser.Sample) error {
 	dbSample := &database.Sample{
 		SampleAccession: sample.Accession,
 		Title:           sample.Title,
@@ -437,10 +427,10 @@ func (rp *ResumableProcessor) processSample(sample *parser.Sample) error {
 		dbSample.TaxonID = sample.SampleName.TaxonID
 	}
 
-	return rp.db.InsertSample(dbSample)
+	return db.InsertSample(dbSample)
 }
 
-func (rp *ResumableProcessor) processRun(run *parser.Run) error {
+func (rp *ResumableProcessor) processRun(db Database, run *parser.Run) error {
 	dbRun := &database.Run{
 		RunAccession:        run.Accession,
 		ExperimentAccession: run.ExperimentRef.Accession,
@@ -451,10 +441,10 @@ func (rp *ResumableProcessor) processRun(run *parser.Run) error {
 		dbRun.TotalBases = run.Statistics.TotalBases
 	}
 
-	return rp.db.InsertRun(dbRun)
+	return db.InsertRun(dbRun)
 }
 
-func (rp *ResumableProcessor) processStudy(study *parser.Study) error {
+func (rp *ResumableProcessor) processStudy(db Database, study *parser.Study) error {
 	var studyType string
 	if study.Descriptor.StudyType != nil {
 		if study.Descriptor.StudyType.ExistingStudyType != "" {
@@ -470,7 +460,7 @@ func (rp *ResumableProcessor) processStudy(study *parser.Study) error {
 		StudyAbstract:  study.Descriptor.StudyAbstract,
 		StudyType:      studyType,
 	}
-	return rp.db.InsertStudy(dbStudy)
+	return db.InsertStudy(dbStudy)
 }
 
 // Helper methods
@@ -554,26 +544,6 @@ func (rp *ResumableProcessor) calculateChecksum(data string) string {
 	return hex.EncodeToString(h[:])
 }
 
-func (rp *ResumableProcessor) isRetryableError(err error) bool {
-	// Check for retryable errors
-	errStr := err.Error()
-	retryableErrors := []string{
-		"connection reset",
-		"broken pipe",
-		"timeout",
-		"temporary failure",
-		"EOF",
-	}
-
-	for _, retryable := range retryableErrors {
-		if strings.Contains(strings.ToLower(errStr), retryable) {
-			return true
-		}
-	}
-
-	return false
-}
-
 func (rp *ResumableProcessor) reportProgress(currentFile string) {
 	stats, err := rp.tracker.GetStatistics()
 	if err != nil {
@@ -0,0 +1,519 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/parser"
+)
+
+// Archives publishing SRA metadata
+const (
+	SourceNCBI = "ncbi"
+	SourceENA  = "ena"
+	SourceDDBJ = "ddbj"
+)
+
+// Sources lists the supported archives.
+var Sources = []string{SourceNCBI, SourceENA, SourceDDBJ}
+
+// ProvenanceStore is implemented by databases that record which archive
+// each record was ingested from.
+type ProvenanceStore interface {
+	InsertRecordSources(sources []database.RecordSource) error
+}
+
+// IngestStore is implemented by databases that record each input
+// ingested, which the provenance of its records refers to.
+type IngestStore interface {
+	StartIngest(ingest *database.Ingest) error
+	FinishIngest(id string, records int64, err error) error
+}
+
+// ParseSource validates an archive name. An empty name means the archive
+// is detected from the file name or the record accessions.
+func ParseSource(source string) (string, error) {
+	source = strings.ToLower(strings.TrimSpace(source))
+	if source == "" {
+		return "", nil
+	}
+	for _, s := range Sources {
+		if s == source {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown source %q (must be one of %s)", source, strings.Join(Sources, ", "))
+}
+
+// DetectSource guesses the archive from a file name or URL, returning an
+// empty string if it cannot tell.
+func DetectSource(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "ebi.ac.uk"):
+		return SourceENA
+	case strings.Contains(lower, "ddbj.nig.ac.jp"):
+		return SourceDDBJ
+	case strings.Contains(lower, "ncbi.nlm.nih.gov"):
+		return SourceNCBI
+	}
+
+	// Archive names appear as words of the file name, e.g. ena_study.xml.gz,
+	// NCBI_SRA_Metadata_20250915.tar.gz, or DRA000001.study.xml
+	words := strings.FieldsFunc(path.Base(lower), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	for _, word := range words {
+		switch {
+		case word == "ena" || word == "ebi":
+			return SourceENA
+		case word == "ddbj" || (strings.HasPrefix(word, "dra") && len(word) > 3 && word[3] >= '0' && word[3] <= '9'):
+			return SourceDDBJ
+		case word == "ncbi":
+			return SourceNCBI
+		}
+	}
+	return ""
+}
+
+// ArchiveForAccession returns the archive that issued an accession, based
+// on its prefix (SRx for NCBI, ERx for ENA, DRx for DDBJ).
+func ArchiveForAccession(accession string) string {
+	if len(accession) < 3 {
+		return ""
+	}
+	switch accession[0] {
+	case 'S', 's':
+		return SourceNCBI
+	case 'E', 'e':
+		return SourceENA
+	case 'D', 'd':
+		return SourceDDBJ
+	}
+	return ""
+}
+
+// SetSource sets the archive recorded as the provenance of ingested
+// records. When unset, it is detected from the input name, falling back
+// to the accession prefix of each record.
+func (sp *StreamProcessor) SetSource(source string) {
+	sp.source = source
+}
+
+// setInput records the name of the file or URL being ingested, under a
+// new ingest ID
+func (sp *StreamProcessor) setInput(name string) {
+	sp.sourceFile = path.Base(name)
+	if sp.source == "" {
+		sp.detectedSource = DetectSource(name)
+	} else {
+		sp.detectedSource = sp.source
+	}
+	sp.ingestID = newIngestID()
+}
+
+// IngestID returns the ID the last input was ingested under, which
+// database.DB.GetIngest and MeasureIngest take
+func (sp *StreamProcessor) IngestID() string {
+	return sp.ingestID
+}
+
+// newIngestID returns a random ID for an ingest
+func newIngestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startIngest records the start of the ingest of the current input
+func (sp *StreamProcessor) startIngest(name string) {
+	store, ok := sp.db.(IngestStore)
+	if !ok {
+		return
+	}
+	ingest := &database.Ingest{ID: sp.ingestID, Input: name, Archive: sp.detectedSource}
+	if err := store.StartIngest(ingest); err != nil {
+		fmt.Printf("Warning: failed to record ingest: %v\n", err)
+	}
+}
+
+// finishIngest records the end of the ingest of the current input, and
+// the error it failed with
+func (sp *StreamProcessor) finishIngest(err error) {
+	store, ok := sp.db.(IngestStore)
+	if !ok {
+		return
+	}
+	if err := store.FinishIngest(sp.ingestID, sp.recordsInserted.Load(), err); err != nil {
+		fmt.Printf("Warning: failed to record ingest: %v\n", err)
+	}
+}
+
+// recordSources records the provenance of inserted records
+func (sp *StreamProcessor) recordSources(db Database, recordType string, accessions []string) {
+	store, ok := db.(ProvenanceStore)
+	if !ok || len(accessions) == 0 {
+		return
+	}
+
+	sources := make([]database.RecordSource, 0, len(accessions))
+	for _, acc := range accessions {
+		archive := sp.detectedSource
+		if archive == "" {
+			archive = ArchiveForAccession(acc)
+		}
+		if archive == "" {
+			continue
+		}
+		sources = append(sources, database.RecordSource{
+			Accession:  acc,
+			RecordType: recordType,
+			Archive:    archive,
+			SourceFile: sp.sourceFile,
+			IngestID:   sp.ingestID,
+		})
+	}
+	if err := store.InsertRecordSources(sources); err != nil {
+		fmt.Printf("Warning: failed to record sources: %v\n", err)
+	}
+}
+
+// recordIdentifiers stores the aliases and identifiers of ingested records
+// so they can be looked up later. Failures are logged, not fatal.
+func (sp *StreamProcessor) recordIdentifiers(db Database, ids []database.Identifier) {
+	if len(ids) == 0 {
+		return
+	}
+
+	if store, ok := db.(IdentifierStore); ok {
+		if err := store.InsertIdentifiers(ids); err != nil {
+			fmt.Printf("Warning: failed to record identifiers: %v\n", err)
+		}
+		return
+	}
+	for i := range ids {
+		if err := db.InsertIdentifier(&ids[i]); err != nil {
+			fmt.Printf("Warning: failed to record identifiers: %v\n", err)
+			return
+		}
+	}
+}
+
+// ExperimentSampleStore is implemented by databases that record which
+// samples each experiment sequenced.
+type ExperimentSampleStore interface {
+	InsertExperimentSamples(links []database.ExperimentSample) error
+}
+
+// recordExperimentSamples stores the samples sequenced by ingested
+// experiments. Failures are logged, not fatal.
+func (sp *StreamProcessor) recordExperimentSamples(db Database, links []database.ExperimentSample) {
+	store, ok := db.(ExperimentSampleStore)
+	if !ok || len(links) == 0 {
+		return
+	}
+	if err := store.InsertExperimentSamples(links); err != nil {
+		fmt.Printf("Warning: failed to record experiment samples: %v\n", err)
+	}
+}
+
+// RunFileStore is implemented by databases that record the data files of
+// runs.
+type RunFileStore interface {
+	SetRunFiles(runs []string, files []database.RunFile) error
+}
+
+// recordRunFiles replaces the data files of ingested runs. Failures are
+// logged, not fatal.
+func (sp *StreamProcessor) recordRunFiles(db Database, runs []string, files []database.RunFile) {
+	store, ok := db.(RunFileStore)
+	if !ok || len(runs) == 0 {
+		return
+	}
+	if err := store.SetRunFiles(runs, files); err != nil {
+		fmt.Printf("Warning: failed to record run files: %v\n", err)
+	}
+}
+
+// runFiles returns the data files listed in the DATA_BLOCK of a run, with
+// their MD5 checksums when they have one
+func runFiles(r *parser.Run) []database.RunFile {
+	if r.DataBlock == nil {
+		return nil
+	}
+	var files []database.RunFile
+	for _, f := range r.DataBlock.Files {
+		if f.Filename == "" {
+			continue
+		}
+		file := database.RunFile{RunAccession: r.Accession, Filename: f.Filename, FileType: f.FileType}
+		if strings.EqualFold(f.ChecksumMethod, "MD5") {
+			file.MD5 = f.Checksum
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// SampleRunStore is implemented by databases that keep the denormalized
+// sample-to-run table.
+type SampleRunStore interface {
+	RefreshSampleRuns(experiments []string) error
+}
+
+// refreshSampleRuns updates the sample-to-run rows of experiments whose
+// runs or sample links were ingested. Failures are logged, not fatal.
+func (sp *StreamProcessor) refreshSampleRuns(db Database, experiments []string) {
+	store, ok := db.(SampleRunStore)
+	if !ok || len(experiments) == 0 {
+		return
+	}
+	if err := store.RefreshSampleRuns(experiments); err != nil {
+		fmt.Printf("Warning: failed to update sample runs: %v\n", err)
+	}
+}
+
+// experimentSamples returns the links from an experiment to the samples
+// named by its sample descriptor, including the members of a pool
+func experimentSamples(exp *parser.Experiment) []database.ExperimentSample {
+	var links []database.ExperimentSample
+	add := func(sample string) {
+		if sample != "" {
+			links = append(links, database.ExperimentSample{ExperimentAccession: exp.Accession, SampleAccession: sample})
+		}
+	}
+
+	desc := exp.Design.SampleDescriptor
+	add(desc.Accession)
+	if desc.Pool != nil {
+		for _, m := range desc.Pool.Members {
+			if m.Accession != desc.Accession {
+				add(m.Accession)
+			}
+		}
+	}
+	return links
+}
+
+func experimentAccessions(experiments []database.Experiment) []string {
+	accessions := make([]string, len(experiments))
+	for i, exp := range experiments {
+		accessions[i] = exp.ExperimentAccession
+	}
+	return accessions
+}
+
+// Input formats recognized by sniffInput
+const (
+	formatGzip = "gzip"
+	formatTar  = "tar"
+	formatXML  = "xml"
+)
+
+// sniffInput identifies the format of a buffered stream from its first
+// bytes, ignoring a byte order mark and whitespace before XML markup
+func sniffInput(br *bufio.Reader) (string, error) {
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+	switch {
+	case len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b:
+		return formatGzip, nil
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return formatTar, nil
+	}
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.TrimLeft(head, " \t\r\n")
+	if len(head) > 0 && head[0] == '<' {
+		return formatXML, nil
+	}
+	return "", fmt.Errorf("unrecognized format: expected a tar.gz archive or an XML document, optionally gzipped")
+}
+
+// processStream detects whether the input is a tar.gz archive, a gzipped
+// XML document, or a plain XML document, and processes it accordingly. The
+// ingest is recorded with the number of records it inserted.
+func (sp *StreamProcessor) processStream(ctx context.Context, reader io.Reader, name string) (err error) {
+	sp.startIngest(name)
+	defer func() { sp.finishIngest(err) }()
+	sp.related.reset("")
+
+	br := bufio.NewReaderSize(reader, 64*1024)
+	format, err := sniffInput(br)
+	if err != nil {
+		return err
+	}
+
+	if format == formatGzip {
+		gzipReader, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		defer gzipReader.Close()
+
+		br = bufio.NewReaderSize(gzipReader, 64*1024)
+		if format, err = sniffInput(br); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case formatTar:
+		return sp.processTarStream(ctx, br)
+	case formatXML:
+		return sp.processXMLFile(ctx, br, name)
+	}
+	return fmt.Errorf("unrecognized format: nested gzip compression")
+}
+
+// processXMLFile processes an XML document ingested on its own rather than
+// from an archive, in a single transaction. The document is read before the
+// transaction begins, so that a paused or stalled input does not hold it
+// open.
+func (sp *StreamProcessor) processXMLFile(ctx context.Context, reader io.Reader, name string) error {
+	sp.updateProgress(path.Base(name))
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return sp.inFileTx(ctx, func(db Database) error {
+		reader, err := sp.storeRawRecords(db, bytes.NewReader(data), name)
+		if err != nil {
+			return err
+		}
+		return sp.processXMLDocument(ctx, db, reader, name)
+	})
+}
+
+// processXMLDocument processes a standalone XML document. Besides the
+// record sets used in NCBI archives, it accepts records nested in other
+// wrappers, such as the ROOT element of ENA browser exports.
+func (sp *StreamProcessor) processXMLDocument(ctx context.Context, db Database, reader io.Reader, name string) error {
+	var records xmlRecords
+	err := decodeXMLDocument(xml.NewDecoder(reader), name, &records, func() error {
+		return sp.insertRecords(ctx, db, &records, false)
+	})
+	if err != nil {
+		return err
+	}
+	return sp.insertRecords(ctx, db, &records, true)
+}
+
+// xmlRecords are the records decoded from an XML document, by type, and
+// the targets of the SUPPRESS actions of its submissions
+type xmlRecords struct {
+	studies     []parser.Study
+	experiments []parser.Experiment
+	samples     []parser.Sample
+	runs        []parser.Run
+	suppressed  []string
+}
+
+// decodeXMLDocument decodes the records found anywhere in an XML document
+// into records, calling flush, when set, after each
+func decodeXMLDocument(decoder *xml.Decoder, name string, records *xmlRecords, flush func() error) error {
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch se.Name.Local {
+		case "STUDY":
+			var study parser.Study
+			if err := decoder.DecodeElement(&study, &se); err != nil {
+				return fmt.Errorf("failed to decode study: %w", err)
+			}
+			records.studies = append(records.studies, study)
+		case "EXPERIMENT":
+			var exp parser.Experiment
+			if err := decoder.DecodeElement(&exp, &se); err != nil {
+				return fmt.Errorf("failed to decode experiment: %w", err)
+			}
+			records.experiments = append(records.experiments, exp)
+		case "SAMPLE":
+			var sample parser.Sample
+			if err := decoder.DecodeElement(&sample, &se); err != nil {
+				return fmt.Errorf("failed to decode sample: %w", err)
+			}
+			records.samples = append(records.samples, sample)
+		case "RUN":
+			var run parser.Run
+			if err := decoder.DecodeElement(&run, &se); err != nil {
+				return fmt.Errorf("failed to decode run: %w", err)
+			}
+			records.runs = append(records.runs, run)
+		case "SUBMISSION":
+			var sub parser.Submission
+			if err := decoder.DecodeElement(&sub, &se); err != nil {
+				return fmt.Errorf("failed to decode submission: %w", err)
+			}
+			records.suppressed = append(records.suppressed, SuppressTargets(&sub)...)
+			continue
+		default:
+			// Descend into set and wrapper elements
+			continue
+		}
+
+		if flush != nil {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// insertRecords inserts the records of each type once there is a full
+// batch of them, or, when final, all of them, and then applies the
+// suppressions
+func (sp *StreamProcessor) insertRecords(ctx context.Context, db Database, records *xmlRecords, final bool) error {
+	const batchSize = 5000
+	if final || len(records.studies) >= batchSize {
+		if err := sp.insertStudies(ctx, db, records.studies); err != nil {
+			return err
+		}
+		records.studies = records.studies[:0]
+	}
+	if final || len(records.experiments) >= batchSize {
+		if err := sp.insertExperiments(ctx, db, records.experiments); err != nil {
+			return err
+		}
+		records.experiments = records.experiments[:0]
+	}
+	if final || len(records.samples) >= batchSize {
+		if err := sp.insertSamples(ctx, db, records.samples); err != nil {
+			return err
+		}
+		records.samples = records.samples[:0]
+	}
+	if final || len(records.runs) >= batchSize {
+		if err := sp.insertRuns(ctx, db, records.runs); err != nil {
+			return err
+		}
+		records.runs = records.runs[:0]
+	}
+	if final {
+		return sp.suppress(db, records.suppressed)
+	}
+	return nil
+}
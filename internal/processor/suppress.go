@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/parser"
+)
+
+// SuppressStore is implemented by databases that can remove records
+// withdrawn from the archive.
+type SuppressStore interface {
+	SuppressRecords(accessions []string) (int64, error)
+}
+
+// SetApplySuppressions makes SUPPRESS actions in submission documents
+// remove their target records. It is meant for applying daily updates on
+// top of a full dataset; full datasets carry the historical actions of
+// records that may since have been released again.
+func (sp *StreamProcessor) SetApplySuppressions(enabled bool) {
+	sp.applySuppressions = enabled
+}
+
+// SuppressTargets returns the accessions a submission asks to suppress.
+func SuppressTargets(sub *parser.Submission) []string {
+	if sub == nil || sub.Actions == nil {
+		return nil
+	}
+	var targets []string
+	for _, action := range sub.Actions.Actions {
+		if action.Suppress == nil {
+			continue
+		}
+		if target := strings.TrimSpace(action.Suppress.Target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// suppress removes the targets of SUPPRESS actions if enabled. Unlike the
+// provenance and access side tables, failing to remove a record is fatal:
+// the database would silently keep a withdrawn record.
+func (sp *StreamProcessor) suppress(db Database, accessions []string) error {
+	if !sp.applySuppressions || len(accessions) == 0 {
+		return nil
+	}
+	store, ok := db.(SuppressStore)
+	if !ok {
+		return nil
+	}
+	n, err := store.SuppressRecords(accessions)
+	if err != nil {
+		return fmt.Errorf("failed to suppress records: %w", err)
+	}
+	sp.recordsSuppressed.Add(n)
+	return nil
+}
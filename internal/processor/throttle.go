@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MaxThrottleLevel is the highest throttle level. At level n an ingest
+// rests n times as long as it works, so level 10 runs at 1/11 of its full
+// speed.
+const MaxThrottleLevel = 10
+
+const (
+	// minRest is the shortest rest taken; shorter rests are saved up, since
+	// sleeping for microseconds after every read costs more than it yields
+	minRest = 50 * time.Millisecond
+
+	// maxWork bounds the work counted between two reads, so that time
+	// spent paused or stalled on the network is not repaid with a rest
+	maxWork = time.Second
+
+	// probeInterval is how often Monitor measures query latency
+	probeInterval = 2 * time.Second
+)
+
+// Throttle slows an ingest down so that queries on the same database stay
+// responsive. The ingest rests between reads of its input, which spaces out
+// its writes; the level sets how long it rests. Monitor raises the level
+// while queries are slower than a target and lowers it again once they
+// recover, never below the level the throttle was created with.
+type Throttle struct {
+	mu       sync.Mutex
+	level    int
+	floor    int           // level set by hand, e.g. with --nice
+	debt     time.Duration // rest owed but not yet taken
+	lastWake time.Time
+
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewThrottle creates a throttle at level, clamped to 0..MaxThrottleLevel
+func NewThrottle(level int) *Throttle {
+	level = min(max(level, 0), MaxThrottleLevel)
+	return &Throttle{level: level, floor: level, sleep: sleepContext}
+}
+
+// Level returns the current throttle level
+func (t *Throttle) Level() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.level
+}
+
+// Wait rests for the work done since the previous call, scaled by the
+// level. It returns early with the context's error if ctx is cancelled.
+func (t *Throttle) Wait(ctx context.Context) error {
+	t.mu.Lock()
+	now := time.Now()
+	if !t.lastWake.IsZero() {
+		worked := min(now.Sub(t.lastWake), maxWork)
+		t.debt += worked * time.Duration(t.level)
+	}
+	t.lastWake = now
+	rest := t.debt
+	if rest < minRest {
+		t.mu.Unlock()
+		return nil
+	}
+	t.debt = 0
+	t.mu.Unlock()
+
+	err := t.sleep(ctx, rest)
+
+	t.mu.Lock()
+	t.lastWake = time.Now()
+	t.mu.Unlock()
+	return err
+}
+
+// Monitor measures query latency with probe every few seconds until ctx is
+// cancelled. The level goes up while the latency exceeds target, and down
+// once it is below half of it. Failed probes are ignored.
+func (t *Throttle) Monitor(ctx context.Context, target time.Duration, probe func(context.Context) (time.Duration, error)) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			latency, err := probe(ctx)
+			if err != nil {
+				continue
+			}
+			t.adjust(latency, target)
+		}
+	}
+}
+
+// adjust moves the level one step towards keeping latency under target
+func (t *Throttle) adjust(latency, target time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case latency > target && t.level < MaxThrottleLevel:
+		t.level++
+	case latency < target/2 && t.level > t.floor:
+		t.level--
+	}
+}
+
+// sleepContext sleeps for d, returning early if ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,178 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/nishad/srake/internal/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// Transforms rewrites the attributes of records from centers that encode
+// them in nonstandard ways. Rules are selected by the center_name of a
+// record and applied in order before attributes are extracted.
+//
+// Example configuration:
+//
+//	centers:
+//	  - center: BGI
+//	    rules:
+//	      # "tissue=liver; sex=male" becomes two attributes
+//	      - tag: characteristics
+//	        split: ';\s*'
+//	        key_value: '^\s*([^=]+?)\s*=\s*(.*?)\s*$'
+//	      - rename:
+//	          organism part: tissue
+//	          cell type: cell_type
+type Transforms struct {
+	Centers []CenterTransform `yaml:"centers"`
+
+	byCenter map[string][]*TransformRule
+}
+
+// CenterTransform holds the rules for one submitting center.
+type CenterTransform struct {
+	Center string          `yaml:"center"` // Matched case-insensitively
+	Rules  []TransformRule `yaml:"rules"`
+}
+
+// TransformRule rewrites attributes. Split and KeyValue apply to attributes
+// whose tag matches Tag (all attributes when Tag is empty); Rename applies
+// to every attribute after splitting.
+type TransformRule struct {
+	Tag      string            `yaml:"tag"`
+	Split    string            `yaml:"split"`     // Regex separating packed values
+	KeyValue string            `yaml:"key_value"` // Regex capturing a tag and a value
+	Rename   map[string]string `yaml:"rename"`    // Tag renames, matched case-insensitively
+
+	split    *regexp.Regexp
+	keyValue *regexp.Regexp
+	rename   map[string]string
+}
+
+// LoadTransforms reads a transform configuration from a YAML file.
+func LoadTransforms(path string) (*Transforms, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transforms: %w", err)
+	}
+	return ParseTransforms(data)
+}
+
+// SetTransforms makes the processor rewrite the attributes of each study,
+// experiment, sample and run with t before filtering and inserting it. A
+// nil t inserts attributes as submitted.
+func (sp *StreamProcessor) SetTransforms(t *Transforms) {
+	sp.transforms = t
+}
+
+// ParseTransforms parses and compiles a YAML transform configuration.
+func ParseTransforms(data []byte) (*Transforms, error) {
+	t := &Transforms{}
+	if err := yaml.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("failed to parse transforms: %w", err)
+	}
+
+	t.byCenter = make(map[string][]*TransformRule)
+	for i := range t.Centers {
+		center := &t.Centers[i]
+		if center.Center == "" {
+			return nil, fmt.Errorf("transform %d: center is required", i+1)
+		}
+		key := strings.ToLower(strings.TrimSpace(center.Center))
+		for j := range center.Rules {
+			rule := &center.Rules[j]
+			if err := rule.compile(); err != nil {
+				return nil, fmt.Errorf("center %s, rule %d: %w", center.Center, j+1, err)
+			}
+			t.byCenter[key] = append(t.byCenter[key], rule)
+		}
+	}
+	return t, nil
+}
+
+func (r *TransformRule) compile() error {
+	if r.Split == "" && r.KeyValue == "" && len(r.Rename) == 0 {
+		return fmt.Errorf("rule has no split, key_value, or rename")
+	}
+
+	var err error
+	if r.Split != "" {
+		if r.split, err = regexp.Compile(r.Split); err != nil {
+			return fmt.Errorf("invalid split pattern: %w", err)
+		}
+	}
+	if r.KeyValue != "" {
+		if r.keyValue, err = regexp.Compile(r.KeyValue); err != nil {
+			return fmt.Errorf("invalid key_value pattern: %w", err)
+		}
+		if r.keyValue.NumSubexp() != 2 {
+			return fmt.Errorf("key_value pattern must have two capture groups (tag and value)")
+		}
+	}
+
+	r.rename = make(map[string]string, len(r.Rename))
+	for from, to := range r.Rename {
+		r.rename[strings.ToLower(from)] = to
+	}
+	return nil
+}
+
+// Apply returns the attributes of a record from center after applying the
+// center's rules. Attributes of other centers are returned unchanged.
+func (t *Transforms) Apply(center string, attrs []parser.Attribute) []parser.Attribute {
+	if t == nil || len(attrs) == 0 {
+		return attrs
+	}
+	rules := t.byCenter[strings.ToLower(strings.TrimSpace(center))]
+	for _, rule := range rules {
+		attrs = rule.apply(attrs)
+	}
+	return attrs
+}
+
+func (r *TransformRule) apply(attrs []parser.Attribute) []parser.Attribute {
+	result := make([]parser.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		pieces := []parser.Attribute{attr}
+		if r.Tag == "" || strings.EqualFold(attr.Tag, r.Tag) {
+			pieces = r.unpack(attr)
+		}
+		for _, piece := range pieces {
+			if to, ok := r.rename[strings.ToLower(piece.Tag)]; ok {
+				piece.Tag = to
+			}
+			result = append(result, piece)
+		}
+	}
+	return result
+}
+
+// unpack splits a packed attribute value and parses key/value pieces.
+// Pieces that do not match the key/value pattern keep the original tag.
+func (r *TransformRule) unpack(attr parser.Attribute) []parser.Attribute {
+	values := []string{attr.Value}
+	if r.split != nil {
+		values = nil
+		for _, v := range r.split.Split(attr.Value, -1) {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+
+	var pieces []parser.Attribute
+	for _, v := range values {
+		piece := parser.Attribute{Tag: attr.Tag, Value: v, Units: attr.Units}
+		if r.keyValue != nil {
+			if m := r.keyValue.FindStringSubmatch(v); m != nil && strings.TrimSpace(m[1]) != "" {
+				piece.Tag = strings.TrimSpace(m[1])
+				piece.Value = strings.TrimSpace(m[2])
+			}
+		}
+		pieces = append(pieces, piece)
+	}
+	return pieces
+}
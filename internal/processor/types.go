@@ -50,6 +50,9 @@ type ExtractionOptions struct {
 	ValidateXML           bool // Validate XML against schemas
 	StrictValidation      bool // Fail on validation errors (vs warnings only)
 	LogValidationIssues   bool // Log validation issues
+
+	// Transforms rewrites attributes of centers with nonstandard encodings
+	Transforms *Transforms
 }
 
 // DefaultExtractionOptions returns default extraction options
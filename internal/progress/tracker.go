@@ -401,34 +401,67 @@ func (t *Tracker) GetStatistics() (*Statistics, error) {
 
 // CleanupOldProgress removes old completed or failed progress records
 func (t *Tracker) CleanupOldProgress(olderThan time.Duration) error {
-	cutoff := time.Now().Add(-olderThan)
-
-	// Delete old checkpoints first
-	_, err := t.db.Exec(`DELETE FROM ingest_checkpoints
-						  WHERE progress_id IN (
-							  SELECT id FROM ingest_progress
-							  WHERE (state = ? OR state = ?) AND updated_at < ?
-						  )`, StateCompleted, StateFailed, cutoff)
-	if err != nil {
+	_, err := PruneProgress(t.db, olderThan, 0, false)
+	return err
+}
+
+// PruneStats counts the progress rows removed (or, in a dry run, that
+// would be removed) by PruneProgress
+type PruneStats struct {
+	Progress       int64 `json:"progress"`
+	ProcessedFiles int64 `json:"processed_files"`
+	Checkpoints    int64 `json:"checkpoints"`
+}
+
+// PruneProgress removes completed or failed ingest progress last updated
+// before olderThan, with its processed files and checkpoints. For ingests
+// that are kept, only the newest keepCheckpoints checkpoints are retained;
+// 0 keeps all of them. An olderThan of 0 keeps all progress records.
+func PruneProgress(db *sql.DB, olderThan time.Duration, keepCheckpoints int, dryRun bool) (*PruneStats, error) {
+	stats := &PruneStats{}
+	run := func(count *int64, table, where string, args ...interface{}) error {
+		if dryRun {
+			return db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+where, args...).Scan(count)
+		}
+		result, err := db.Exec(`DELETE FROM `+table+` WHERE `+where, args...)
+		if err != nil {
+			return err
+		}
+		*count, err = result.RowsAffected()
 		return err
 	}
 
-	// Delete processed files
-	_, err = t.db.Exec(`DELETE FROM processed_files
-						 WHERE progress_id IN (
-							 SELECT id FROM ingest_progress
-							 WHERE (state = ? OR state = ?) AND updated_at < ?
-						 )`, StateCompleted, StateFailed, cutoff)
-	if err != nil {
-		return err
+	if olderThan > 0 {
+		cutoff := time.Now().Add(-olderThan)
+		expired := `progress_id IN (SELECT id FROM ingest_progress
+			WHERE (state = ? OR state = ?) AND updated_at < ?)`
+
+		// Delete dependent rows first
+		if err := run(&stats.Checkpoints, "ingest_checkpoints", expired, StateCompleted, StateFailed, cutoff); err != nil {
+			return nil, fmt.Errorf("failed to prune checkpoints: %w", err)
+		}
+		if err := run(&stats.ProcessedFiles, "processed_files", expired, StateCompleted, StateFailed, cutoff); err != nil {
+			return nil, fmt.Errorf("failed to prune processed files: %w", err)
+		}
+		if err := run(&stats.Progress, "ingest_progress", `(state = ? OR state = ?) AND updated_at < ?`,
+			StateCompleted, StateFailed, cutoff); err != nil {
+			return nil, fmt.Errorf("failed to prune progress: %w", err)
+		}
 	}
 
-	// Delete progress records
-	_, err = t.db.Exec(`DELETE FROM ingest_progress
-						 WHERE (state = ? OR state = ?) AND updated_at < ?`,
-		StateCompleted, StateFailed, cutoff)
+	if keepCheckpoints > 0 {
+		var superseded int64
+		if err := run(&superseded, "ingest_checkpoints", `id NOT IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY progress_id ORDER BY id DESC) AS n
+				FROM ingest_checkpoints
+			) WHERE n <= ?)`, keepCheckpoints); err != nil {
+			return nil, fmt.Errorf("failed to prune checkpoints: %w", err)
+		}
+		stats.Checkpoints += superseded
+	}
 
-	return err
+	return stats, nil
 }
 
 // Helper methods
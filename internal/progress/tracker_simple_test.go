@@ -330,6 +330,66 @@ func TestCleanup(t *testing.T) {
 }
 
 // Run all tests
+func TestPruneProgress(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+
+	tracker, err := NewTracker(db)
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+
+	// Old completed ingestion with a processed file and a checkpoint
+	old, err := tracker.StartOrResume("https://example.com/old.tar.gz", false)
+	if err != nil {
+		t.Fatalf("Failed to start old ingestion: %v", err)
+	}
+	if err := tracker.RecordFileProcessed("old.xml", 100, 1, ""); err != nil {
+		t.Fatalf("Failed to record file: %v", err)
+	}
+	if err := tracker.createCheckpoint(1, 1, 1); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	tracker.MarkCompleted()
+	db.Exec("UPDATE ingest_progress SET updated_at = datetime('now', '-10 days') WHERE id = ?", old.ID)
+
+	// Unfinished ingestion with many checkpoints
+	if _, err := tracker.StartOrResume("https://example.com/active.tar.gz", false); err != nil {
+		t.Fatalf("Failed to start active ingestion: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := tracker.createCheckpoint(int64(i), int64(i), int64(i)); err != nil {
+			t.Fatalf("Failed to create checkpoint: %v", err)
+		}
+	}
+
+	// A dry run only counts
+	stats, err := PruneProgress(db, 7*24*time.Hour, 2, true)
+	if err != nil {
+		t.Fatalf("PruneProgress failed: %v", err)
+	}
+	if stats.Progress != 1 || stats.ProcessedFiles != 1 || stats.Checkpoints != 4 {
+		t.Errorf("unexpected dry run stats: %+v", stats)
+	}
+	if p, _ := tracker.GetProgress(old.SourceHash); p == nil {
+		t.Fatal("dry run should not delete progress")
+	}
+
+	stats, err = PruneProgress(db, 7*24*time.Hour, 2, false)
+	if err != nil {
+		t.Fatalf("PruneProgress failed: %v", err)
+	}
+	if stats.Progress != 1 || stats.ProcessedFiles != 1 || stats.Checkpoints != 4 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM ingest_checkpoints WHERE progress_id = ?", tracker.progressID).Scan(&remaining)
+	if remaining != 2 {
+		t.Errorf("expected 2 checkpoints kept, got %d", remaining)
+	}
+}
+
 func TestAll(t *testing.T) {
 	tests := []struct {
 		name string
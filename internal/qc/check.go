@@ -0,0 +1,299 @@
+package qc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/expr"
+)
+
+// pageSize is the number of records read and checked at a time
+const pageSize = 1000
+
+// Violation is a record that fails a rule
+type Violation struct {
+	Rule       string `json:"rule"`
+	Severity   string `json:"severity"`
+	RecordType string `json:"record_type"`
+	Accession  string `json:"accession"`
+	Message    string `json:"message"`
+}
+
+// Result counts the records a rule applied to and those violating it
+type Result struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Record      string `json:"record"`
+	Severity    string `json:"severity"`
+	Checked     int64  `json:"checked"`
+	Violations  int64  `json:"violations"`
+}
+
+// recordSource reads the fields of one record type
+type recordSource struct {
+	table   string
+	key     string // accession column
+	columns string // columns read by scan, starting with key
+	scan    func(rows *sql.Rows) (expr.Vars, error)
+}
+
+var recordSources = map[string]recordSource{
+	"study": {
+		table:   "studies",
+		key:     "study_accession",
+		columns: "study_accession, study_title, study_abstract, study_type, organism",
+		scan: func(rows *sql.Rows) (expr.Vars, error) {
+			var accession string
+			var title, abstract, studyType, organism sql.NullString
+			if err := rows.Scan(&accession, &title, &abstract, &studyType, &organism); err != nil {
+				return nil, err
+			}
+			return expr.Vars{
+				"accession":  accession,
+				"title":      title.String,
+				"abstract":   abstract.String,
+				"study_type": studyType.String,
+				"organism":   organism.String,
+			}, nil
+		},
+	},
+	"experiment": {
+		table: "experiments",
+		key:   "experiment_accession",
+		columns: `experiment_accession, study_accession, title, library_strategy, library_source,
+			json_extract(metadata, '$.library_selection'), json_extract(metadata, '$.library_layout'),
+			platform, instrument_model`,
+		scan: func(rows *sql.Rows) (expr.Vars, error) {
+			var accession string
+			var study, title, strategy, source, selection, layout, platform, instrument sql.NullString
+			if err := rows.Scan(&accession, &study, &title, &strategy, &source,
+				&selection, &layout, &platform, &instrument); err != nil {
+				return nil, err
+			}
+			return expr.Vars{
+				"accession":       accession,
+				"study_accession": study.String,
+				"title":           title.String,
+				"strategy":        strategy.String,
+				"source":          source.String,
+				"selection":       selection.String,
+				"layout":          layout.String,
+				"platform":        platform.String,
+				"instrument":      instrument.String,
+			}, nil
+		},
+	},
+	"sample": {
+		table:   "samples",
+		key:     "sample_accession",
+		columns: "sample_accession, taxon_id, COALESCE(NULLIF(scientific_name, ''), organism), tissue, cell_type, description",
+		scan: func(rows *sql.Rows) (expr.Vars, error) {
+			var accession string
+			var taxonID sql.NullInt64
+			var organism, tissue, cellType, description sql.NullString
+			if err := rows.Scan(&accession, &taxonID, &organism, &tissue, &cellType, &description); err != nil {
+				return nil, err
+			}
+			vars := expr.Vars{
+				"accession":   accession,
+				"taxon_id":    nil,
+				"organism":    organism.String,
+				"tissue":      tissue.String,
+				"cell_type":   cellType.String,
+				"description": description.String,
+				"attributes":  map[string]string{},
+			}
+			if taxonID.Valid {
+				vars["taxon_id"] = taxonID.Int64
+			}
+			return vars, nil
+		},
+	},
+	"run": {
+		table:   "runs",
+		key:     "run_accession",
+		columns: "run_accession, experiment_accession, total_spots, total_bases",
+		scan: func(rows *sql.Rows) (expr.Vars, error) {
+			var accession string
+			var experiment sql.NullString
+			var spots, bases sql.NullInt64
+			if err := rows.Scan(&accession, &experiment, &spots, &bases); err != nil {
+				return nil, err
+			}
+			return expr.Vars{
+				"accession":            accession,
+				"experiment_accession": experiment.String,
+				"total_spots":          spots.Int64,
+				"total_bases":          bases.Int64,
+			}, nil
+		},
+	},
+}
+
+// Run checks the records of db against rules, calling fn with each
+// violation as it is found, and returns the counts of each rule in the
+// order of rules. Each record type is read once for all of its rules. fn
+// returning an error stops the run.
+func Run(ctx context.Context, db *database.DB, rules []*Rule, fn func(Violation) error) ([]Result, error) {
+	results := make([]Result, len(rules))
+	byType := make(map[string][]int)
+	for i, r := range rules {
+		results[i] = Result{Rule: r.Name, Description: r.Description, Record: r.Record, Severity: r.Severity}
+		byType[r.Record] = append(byType[r.Record], i)
+	}
+
+	for _, recordType := range RecordTypes {
+		indexes := byType[recordType]
+		if len(indexes) == 0 {
+			continue
+		}
+		err := scanRecords(ctx, db, recordType, func(vars expr.Vars) error {
+			for _, i := range indexes {
+				applies, message := rules[i].evaluate(vars)
+				if !applies {
+					continue
+				}
+				results[i].Checked++
+				if message == "" {
+					continue
+				}
+				results[i].Violations++
+				err := fn(Violation{
+					Rule:       rules[i].Name,
+					Severity:   rules[i].Severity,
+					RecordType: recordType,
+					Accession:  vars["accession"].(string),
+					Message:    message,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// evaluate reports whether the rule applies to a record and, if the record
+// fails it, why. A record the expressions cannot be evaluated on fails.
+func (r *Rule) evaluate(vars expr.Vars) (bool, string) {
+	if r.when != nil {
+		ok, err := r.when.Matches(vars)
+		if err != nil {
+			return true, fmt.Sprintf("cannot evaluate when: %v", err)
+		}
+		if !ok {
+			return false, ""
+		}
+	}
+	ok, err := r.check.Matches(vars)
+	switch {
+	case err != nil:
+		return true, fmt.Sprintf("cannot evaluate check: %v", err)
+	case !ok && r.Description != "":
+		return true, r.Description
+	case !ok:
+		return true, "fails " + r.Check
+	}
+	return true, ""
+}
+
+// scanRecords calls fn with the fields of every record of recordType, a
+// page at a time in accession order so that no read is held open while fn
+// runs
+func scanRecords(ctx context.Context, db *database.DB, recordType string, fn func(expr.Vars) error) error {
+	src := recordSources[recordType]
+	// #nosec G201 - table and column names are from a fixed list, not user input
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s > ? ORDER BY %s LIMIT ?", src.columns, src.table, src.key, src.key)
+
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page, err := readPage(ctx, db, src, query, after)
+		if err != nil {
+			return fmt.Errorf("failed to read %s records: %w", recordType, err)
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		if recordType == "sample" {
+			if err := addAttributes(ctx, db, page); err != nil {
+				return fmt.Errorf("failed to read sample attributes: %w", err)
+			}
+		}
+		for _, vars := range page {
+			if err := fn(vars); err != nil {
+				return err
+			}
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+		after = page[len(page)-1]["accession"].(string)
+	}
+}
+
+func readPage(ctx context.Context, db *database.DB, src recordSource, query, after string) ([]expr.Vars, error) {
+	rows, err := db.QueryContext(ctx, query, after, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var page []expr.Vars
+	for rows.Next() {
+		vars, err := src.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, vars)
+	}
+	return page, rows.Err()
+}
+
+// addAttributes binds the attributes of a page of samples. A tag given
+// several times keeps its first value.
+func addAttributes(ctx context.Context, db *database.DB, page []expr.Vars) error {
+	bySample := make(map[string]map[string]string, len(page))
+	args := make([]interface{}, len(page))
+	for i, vars := range page {
+		accession := vars["accession"].(string)
+		bySample[accession] = vars["attributes"].(map[string]string)
+		args[i] = accession
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(page)), ",")
+
+	// #nosec G201 - only placeholders are interpolated
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT sample_accession, tag, COALESCE(value, '')
+		FROM sample_attributes
+		WHERE sample_accession IN (%s)
+		ORDER BY rowid
+	`, placeholders), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var accession, tag, value string
+		if err := rows.Scan(&accession, &tag, &value); err != nil {
+			return err
+		}
+		if attributes := bySample[accession]; attributes != nil {
+			if _, ok := attributes[tag]; !ok {
+				attributes[tag] = value
+			}
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,172 @@
+package qc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+func TestParse(t *testing.T) {
+	rules, err := Parse([]byte(`
+rules:
+  - name: rnaseq-source
+    description: RNA-Seq experiments must have a transcriptomic source
+    record: experiment
+    severity: error
+    when: strategy == "RNA-Seq"
+    check: source == "TRANSCRIPTOMIC"
+  - name: sample-tissue
+    record: sample
+    check: tissue != ""
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].when == nil || rules[1].when != nil {
+		t.Fatalf("unexpected rules: %+v", rules)
+	}
+	if rules[1].Severity != SeverityWarning {
+		t.Errorf("expected severity to default to %s, got %s", SeverityWarning, rules[1].Severity)
+	}
+
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"no name", "rules:\n  - record: run\n    check: total_bases > 0", "no name"},
+		{"bad record", "rules:\n  - name: a\n    record: dataset\n    check: 'true'", "record must be"},
+		{"bad severity", "rules:\n  - name: a\n    record: run\n    severity: fatal\n    check: 'true'", "severity"},
+		{"no check", "rules:\n  - name: a\n    record: run", "no check"},
+		{"field of another type", "rules:\n  - name: a\n    record: run\n    check: tissue != ''", "invalid check"},
+		{"bad when", "rules:\n  - name: a\n    record: run\n    when: total_bases >\n    check: 'true'", "invalid when"},
+		{"duplicate", "rules:\n  - name: a\n    record: run\n    check: 'true'\n  - name: a\n    record: run\n    check: 'true'", "twice"},
+		{"unknown field", "rules:\n  - name: a\n    record: run\n    check: 'true'\n    level: 3", "failed to parse"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse([]byte(tt.yaml)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SRAKE_RULES_PATH", dir)
+
+	rules, err := List()
+	if err != nil {
+		t.Fatalf("built-in rules are invalid: %v", err)
+	}
+	builtin, err := Select(rules, []string{"human-sample-sex"})
+	if err != nil || builtin[0].Source != Builtin {
+		t.Fatalf("expected the built-in human-sample-sex rule, got %+v (%v)", builtin, err)
+	}
+
+	// A rule in the rules directory replaces the built-in rule of its name
+	local := "rules:\n  - name: human-sample-sex\n    record: sample\n    severity: error\n    check: '\"sex\" in attributes'\n"
+	if err := os.WriteFile(filepath.Join(dir, "local.yaml"), []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err = List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := Select(rules, []string{"human-sample-sex"})
+	if err != nil || replaced[0].Severity != SeverityError || replaced[0].Source != filepath.Join(dir, "local.yaml") {
+		t.Errorf("expected the local rule to replace the built-in one, got %+v (%v)", replaced, err)
+	}
+	for i := 1; i < len(rules); i++ {
+		if rules[i-1].Record == rules[i].Record && rules[i-1].Name > rules[i].Name {
+			t.Errorf("rules are not sorted: %s before %s", rules[i-1].Name, rules[i].Name)
+		}
+	}
+
+	if _, err := Select(rules, []string{"no-such-rule"}); err == nil {
+		t.Error("expected an error selecting an unknown rule")
+	}
+}
+
+func TestRun(t *testing.T) {
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	experiments := []*database.Experiment{
+		{ExperimentAccession: "SRX000001", LibraryStrategy: "RNA-Seq", LibrarySource: "TRANSCRIPTOMIC", Metadata: "{}"},
+		{ExperimentAccession: "SRX000002", LibraryStrategy: "RNA-Seq", LibrarySource: "GENOMIC", Metadata: "{}"},
+		{ExperimentAccession: "SRX000003", LibraryStrategy: "WGS", LibrarySource: "GENOMIC", Metadata: "{}"},
+	}
+	for _, e := range experiments {
+		if err := db.InsertExperiment(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	samples := []*database.Sample{
+		{SampleAccession: "SRS000001", TaxonID: 9606, SampleAttributes: `[{"tag":"Sex","value":"female"}]`},
+		{SampleAccession: "SRS000002", TaxonID: 9606, SampleAttributes: `[{"tag":"tissue","value":"liver"}]`},
+		{SampleAccession: "SRS000003", TaxonID: 10090},
+	}
+	for _, s := range samples {
+		if err := db.InsertSample(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules, err := Parse([]byte(`
+rules:
+  - name: rnaseq-source
+    description: RNA-Seq experiments must have a transcriptomic source
+    record: experiment
+    severity: error
+    when: strategy == "RNA-Seq"
+    check: source == "TRANSCRIPTOMIC"
+  - name: human-sample-sex
+    record: sample
+    when: taxon_id == 9606
+    check: '"sex" in attributes'
+  - name: run-bases
+    record: run
+    check: total_bases > 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var violations []Violation
+	results, err := Run(context.Background(), db, rules, func(v Violation) error {
+		violations = append(violations, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Result{
+		{Rule: "rnaseq-source", Record: "experiment", Severity: SeverityError, Checked: 2, Violations: 1},
+		{Rule: "human-sample-sex", Record: "sample", Severity: SeverityWarning, Checked: 2, Violations: 1},
+		{Rule: "run-bases", Record: "run", Severity: SeverityWarning},
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Rule != w.Rule || got.Severity != w.Severity || got.Checked != w.Checked || got.Violations != w.Violations {
+			t.Errorf("result %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+
+	if len(violations) != 2 {
+		t.Fatalf("expected 2 violations, got %+v", violations)
+	}
+	if v := violations[0]; v.Accession != "SRX000002" || v.Rule != "rnaseq-source" || v.Message != "RNA-Seq experiments must have a transcriptomic source" {
+		t.Errorf("unexpected violation: %+v", v)
+	}
+	if v := violations[1]; v.Accession != "SRS000002" || v.RecordType != "sample" || v.Message != `fails "sex" in attributes` {
+		t.Errorf("unexpected violation: %+v", v)
+	}
+}
@@ -0,0 +1,238 @@
+// Package qc checks the database against quality rules: declarative
+// statements about what the records of one type must look like, such as
+// "RNA-Seq experiments must have a transcriptomic library source". Rules
+// are YAML so that curators can write and review them like code. The
+// built-in rules are embedded; files in the rules directory add to them or
+// replace them by name.
+//
+// Example rules file:
+//
+//	rules:
+//	  - name: human-sample-sex
+//	    description: Human samples should have a sex attribute
+//	    record: sample
+//	    severity: warning
+//	    when: taxon_id == 9606
+//	    check: '"sex" in attributes'
+//
+// A rule applies to the records of its type for which the optional when
+// expression holds, and each of them must satisfy check. Expressions use
+// the syntax of 'srake ingest --filter-expr' over the fields in Fields.
+package qc
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nishad/srake/internal/expr"
+	"github.com/nishad/srake/internal/paths"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed builtin/*.yaml
+var builtin embed.FS
+
+// Builtin is the Source of the rules shipped with srake
+const Builtin = "built-in"
+
+// Severities of a rule violation
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Fields lists the fields rule expressions may refer to, by record type.
+// Every record binds all the fields of its type; a missing value is the
+// empty string, or null for taxon_id.
+//
+//	study:      accession, title, abstract, study_type, organism
+//	experiment: accession, study_accession, title, strategy, source,
+//	            selection, layout, platform, instrument
+//	sample:     accession, taxon_id, organism, tissue, cell_type,
+//	            description, attributes (normalized tag to value)
+//	run:        accession, experiment_accession, total_spots, total_bases
+var Fields = map[string][]string{
+	"study":      {"accession", "title", "abstract", "study_type", "organism"},
+	"experiment": {"accession", "study_accession", "title", "strategy", "source", "selection", "layout", "platform", "instrument"},
+	"sample":     {"accession", "taxon_id", "organism", "tissue", "cell_type", "description", "attributes"},
+	"run":        {"accession", "experiment_accession", "total_spots", "total_bases"},
+}
+
+// RecordTypes are the record types rules may check, in the order they are
+// checked
+var RecordTypes = []string{"study", "experiment", "sample", "run"}
+
+// Rule is a quality rule.
+type Rule struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Record      string `yaml:"record"`
+	Severity    string `yaml:"severity"`
+	When        string `yaml:"when"`
+	Check       string `yaml:"check"`
+
+	// Source is the file the rule was read from, or Builtin
+	Source string `yaml:"-"`
+
+	when  *expr.Program // nil when the rule applies to every record
+	check *expr.Program
+}
+
+// Parse parses and validates a YAML rules file.
+func Parse(data []byte) ([]*Rule, error) {
+	var file struct {
+		Rules []*Rule `yaml:"rules"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for _, r := range file.Rules {
+		if err := r.compile(); err != nil {
+			return nil, err
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("rule %s is defined twice", r.Name)
+		}
+		names[r.Name] = true
+	}
+	return file.Rules, nil
+}
+
+// compile validates the rule and compiles its expressions
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule has no name")
+	}
+	fields, ok := Fields[r.Record]
+	if !ok {
+		return fmt.Errorf("rule %s: record must be one of %s", r.Name, strings.Join(RecordTypes, ", "))
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = SeverityWarning
+	case SeverityError, SeverityWarning:
+	default:
+		return fmt.Errorf("rule %s: severity must be %s or %s", r.Name, SeverityError, SeverityWarning)
+	}
+	if strings.TrimSpace(r.Check) == "" {
+		return fmt.Errorf("rule %s has no check", r.Name)
+	}
+
+	var err error
+	if strings.TrimSpace(r.When) != "" {
+		if r.when, err = expr.Compile(r.When, fields); err != nil {
+			return fmt.Errorf("rule %s: invalid when: %w", r.Name, err)
+		}
+	}
+	if r.check, err = expr.Compile(r.Check, fields); err != nil {
+		return fmt.Errorf("rule %s: invalid check: %w", r.Name, err)
+	}
+	return nil
+}
+
+// List returns all rules sorted by record type and name. Rules in the
+// rules directory replace built-in rules of the same name.
+func List() ([]*Rule, error) {
+	byName := make(map[string]*Rule)
+
+	entries, err := fs.ReadDir(builtin, "builtin")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		data, err := builtin.ReadFile("builtin/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		rules, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("built-in %s: %w", e.Name(), err)
+		}
+		for _, r := range rules {
+			r.Source = Builtin
+			byName[r.Name] = r
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(paths.GetRulesPath(), "*.yaml"))
+	for _, path := range files {
+		rules, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			byName[r.Name] = r
+		}
+	}
+
+	list := make([]*Rule, 0, len(byName))
+	for _, r := range byName {
+		list = append(list, r)
+	}
+	Sort(list)
+	return list, nil
+}
+
+// LoadFile reads the rules of a YAML file
+func LoadFile(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	rules, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, r := range rules {
+		r.Source = path
+	}
+	return rules, nil
+}
+
+// Select returns the rules with the given names, in the order of rules. It
+// fails on a name that is not among them.
+func Select(rules []*Rule, names []string) ([]*Rule, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []*Rule
+	for _, r := range rules {
+		if wanted[r.Name] {
+			selected = append(selected, r)
+			delete(wanted, r.Name)
+		}
+	}
+	for _, name := range names {
+		if wanted[name] {
+			return nil, fmt.Errorf("unknown rule %q (run 'srake qc rules' to list them)", name)
+		}
+	}
+	return selected, nil
+}
+
+// Sort orders rules by record type, in the order of RecordTypes, and name
+func Sort(rules []*Rule) {
+	order := make(map[string]int, len(RecordTypes))
+	for i, t := range RecordTypes {
+		order[t] = i
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Record != rules[j].Record {
+			return order[rules[i].Record] < order[rules[j].Record]
+		}
+		return rules[i].Name < rules[j].Name
+	})
+}
@@ -0,0 +1,260 @@
+// Package retention removes ingest bookkeeping, caches, and other generated
+// files once they exceed their configured age or size limits.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/progress"
+)
+
+// Cleanup targets
+const (
+	TargetProgress    = "progress"
+	TargetDownloads   = "downloads"
+	TargetSearchCache = "search-cache"
+	TargetSnapshots   = "snapshots"
+	TargetJobs        = "jobs"
+)
+
+// Targets lists all cleanup targets in the order they are processed.
+var Targets = []string{TargetProgress, TargetDownloads, TargetSearchCache, TargetSnapshots, TargetJobs}
+
+// Policy holds the limits applied by Run. A zero age or size disables
+// that limit.
+type Policy struct {
+	ProgressAge      time.Duration
+	KeepCheckpoints  int
+	DownloadAge      time.Duration
+	DownloadMaxBytes int64
+	SearchCacheAge   time.Duration
+	SnapshotAge      time.Duration
+	SnapshotMaxBytes int64
+	JobAge           time.Duration
+
+	DownloadsDir   string
+	SearchCacheDir string
+	SnapshotDir    string
+	JobsDir        string
+}
+
+// FromConfig builds a policy from the retention section of the
+// configuration, using the standard directories.
+func FromConfig(c config.RetentionConfig) Policy {
+	const day = 24 * time.Hour
+	const mb = 1024 * 1024
+
+	return Policy{
+		ProgressAge:      time.Duration(c.ProgressDays) * day,
+		KeepCheckpoints:  c.KeepCheckpoints,
+		DownloadAge:      time.Duration(c.DownloadDays) * day,
+		DownloadMaxBytes: c.DownloadMaxMB * mb,
+		SearchCacheAge:   time.Duration(c.SearchCacheDays) * day,
+		SnapshotAge:      time.Duration(c.SnapshotDays) * day,
+		SnapshotMaxBytes: c.SnapshotMaxMB * mb,
+		JobAge:           time.Duration(c.JobDays) * day,
+
+		DownloadsDir:   paths.GetDownloadsPath(),
+		SearchCacheDir: filepath.Join(paths.GetPaths().CacheDir, "search"),
+		SnapshotDir:    c.SnapshotDir,
+		JobsDir:        paths.GetJobsPath(),
+	}
+}
+
+// Result reports what was removed from one target, or in a dry run what
+// would be removed.
+type Result struct {
+	Target string `json:"target"`
+	Rows   int64  `json:"rows,omitempty"`
+	Files  int    `json:"files,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+}
+
+// Report summarizes a cleanup run.
+type Report struct {
+	DryRun  bool      `json:"dry_run"`
+	Results []*Result `json:"results"`
+}
+
+// Run applies the policy to the given targets (all targets when none are
+// given). db may be nil, in which case database targets are skipped.
+func Run(db *database.DB, p Policy, targets []string, dryRun bool) (*Report, error) {
+	if len(targets) == 0 {
+		targets = Targets
+	}
+	report := &Report{DryRun: dryRun}
+	now := time.Now()
+
+	for _, target := range targets {
+		result := &Result{Target: target}
+		var err error
+
+		switch target {
+		case TargetProgress:
+			if db == nil {
+				continue
+			}
+			var stats *progress.PruneStats
+			stats, err = pruneProgress(db, p, dryRun)
+			if stats != nil {
+				result.Rows = stats.Progress + stats.ProcessedFiles + stats.Checkpoints
+			}
+		case TargetDownloads:
+			result.Files, result.Bytes, err = PruneFiles(p.DownloadsDir, p.DownloadAge, p.DownloadMaxBytes, now, dryRun)
+		case TargetSearchCache:
+			result.Files, result.Bytes, err = PruneFiles(p.SearchCacheDir, p.SearchCacheAge, 0, now, dryRun)
+		case TargetSnapshots:
+			result.Files, result.Bytes, err = PruneFiles(p.SnapshotDir, p.SnapshotAge, p.SnapshotMaxBytes, now, dryRun)
+		case TargetJobs:
+			if db == nil || p.JobAge <= 0 {
+				continue
+			}
+			result.Rows, result.Files, result.Bytes, err = pruneJobs(db, now.Add(-p.JobAge), dryRun)
+		default:
+			return nil, fmt.Errorf("unknown cleanup target: %s", target)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to clean %s: %w", target, err)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// pruneProgress removes finished ingest progress and superseded checkpoints.
+func pruneProgress(db *database.DB, p Policy, dryRun bool) (*progress.PruneStats, error) {
+	// Make sure the progress tables exist before counting or deleting
+	if _, err := progress.NewTracker(db.DB); err != nil {
+		return nil, err
+	}
+	return progress.PruneProgress(db.DB, p.ProgressAge, p.KeepCheckpoints, dryRun)
+}
+
+// pruneJobs removes finished jobs and their result files.
+func pruneJobs(db *database.DB, cutoff time.Time, dryRun bool) (int64, int, int64, error) {
+	jobs, err := db.PruneJobs(cutoff, dryRun)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var files int
+	var size int64
+	for _, job := range jobs {
+		if job.ResultPath == "" {
+			continue
+		}
+		info, err := os.Stat(job.ResultPath)
+		if err != nil {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(job.ResultPath); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		files++
+		size += info.Size()
+	}
+	return int64(len(jobs)), files, size, nil
+}
+
+// PruneFiles removes files under dir modified before now minus maxAge,
+// then the oldest remaining files until their total size is at most
+// maxBytes. It returns the number and total size of the removed files.
+// A missing directory is not an error.
+func PruneFiles(dir string, maxAge time.Duration, maxBytes int64, now time.Time, dryRun bool) (int, int64, error) {
+	if dir == "" || (maxAge <= 0 && maxBytes <= 0) {
+		return 0, 0, nil
+	}
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, file{path, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Oldest first, so size limits evict the least recently written files
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+
+	var count int
+	var removed int64
+	for _, f := range files {
+		expired := maxAge > 0 && f.modTime.Before(now.Add(-maxAge))
+		oversized := maxBytes > 0 && total > maxBytes
+		if !expired && !oversized {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				return count, removed, err
+			}
+		}
+		count++
+		removed += f.size
+		total -= f.size
+	}
+	return count, removed, nil
+}
+
+// Schedule runs the policy on all targets every interval until ctx is
+// cancelled, starting immediately. Failures are logged.
+func Schedule(ctx context.Context, db *database.DB, p Policy, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := Run(db, p, nil, false)
+		if err != nil {
+			log.Printf("Retention cleanup failed: %v", err)
+		} else if rows, files, size := report.Totals(); rows > 0 || files > 0 {
+			log.Printf("Retention cleanup removed %d rows and %d files (%d bytes)", rows, files, size)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Totals sums the rows, files, and bytes of all results.
+func (r *Report) Totals() (rows int64, files int, bytes int64) {
+	for _, result := range r.Results {
+		rows += result.Rows
+		files += result.Files
+		bytes += result.Bytes
+	}
+	return rows, files, bytes
+}
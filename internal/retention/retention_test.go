@@ -0,0 +1,130 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+func writeFile(t *testing.T, path string, size int, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPruneFilesByAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeFile(t, filepath.Join(dir, "old.tar.gz"), 10, now.Add(-40*24*time.Hour))
+	writeFile(t, filepath.Join(dir, "nested", "old.xml"), 5, now.Add(-31*24*time.Hour))
+	writeFile(t, filepath.Join(dir, "new.tar.gz"), 20, now.Add(-time.Hour))
+
+	count, size, err := PruneFiles(dir, 30*24*time.Hour, 0, now, true)
+	if err != nil {
+		t.Fatalf("PruneFiles failed: %v", err)
+	}
+	if count != 2 || size != 15 {
+		t.Errorf("expected 2 files (15 bytes) in dry run, got %d (%d bytes)", count, size)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.tar.gz")); err != nil {
+		t.Error("dry run should not remove files")
+	}
+
+	if _, _, err := PruneFiles(dir, 30*24*time.Hour, 0, now, false); err != nil {
+		t.Fatalf("PruneFiles failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.tar.gz")); !os.IsNotExist(err) {
+		t.Error("expected old file to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.tar.gz")); err != nil {
+		t.Error("expected recent file to be kept")
+	}
+}
+
+func TestPruneFilesBySize(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeFile(t, filepath.Join(dir, "a"), 100, now.Add(-3*time.Hour))
+	writeFile(t, filepath.Join(dir, "b"), 100, now.Add(-2*time.Hour))
+	writeFile(t, filepath.Join(dir, "c"), 100, now.Add(-time.Hour))
+
+	count, size, err := PruneFiles(dir, 0, 150, now, false)
+	if err != nil {
+		t.Fatalf("PruneFiles failed: %v", err)
+	}
+	if count != 2 || size != 200 {
+		t.Errorf("expected oldest 2 files removed, got %d (%d bytes)", count, size)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c")); err != nil {
+		t.Error("expected newest file to be kept")
+	}
+}
+
+func TestPruneFilesMissingDir(t *testing.T) {
+	count, _, err := PruneFiles(filepath.Join(t.TempDir(), "missing"), time.Hour, 0, time.Now(), false)
+	if err != nil || count != 0 {
+		t.Errorf("expected missing directory to be ignored, got %d, %v", count, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	resultPath := filepath.Join(dir, "jobs", "old.json")
+	writeFile(t, resultPath, 42, now)
+	if err := db.CreateJob(&database.Job{ID: "old", Kind: "search", Spec: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ClaimJob(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FinishJob("old", database.JobCompleted, "", resultPath, 42); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`UPDATE jobs SET finished_at = ? WHERE id = 'old'`, now.Add(-10*24*time.Hour))
+
+	writeFile(t, filepath.Join(dir, "downloads", "NCBI_SRA_Metadata.tar.gz"), 10, now.Add(-60*24*time.Hour))
+
+	policy := Policy{
+		ProgressAge:  30 * 24 * time.Hour,
+		DownloadAge:  30 * 24 * time.Hour,
+		JobAge:       7 * 24 * time.Hour,
+		DownloadsDir: filepath.Join(dir, "downloads"),
+		JobsDir:      filepath.Join(dir, "jobs"),
+	}
+
+	report, err := Run(db, policy, nil, false)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	rows, files, size := report.Totals()
+	if rows != 1 || files != 2 || size != 52 {
+		t.Errorf("expected 1 row and 2 files (52 bytes), got %d, %d (%d bytes)", rows, files, size)
+	}
+	if _, err := os.Stat(resultPath); !os.IsNotExist(err) {
+		t.Error("expected job result to be removed")
+	}
+	if _, err := db.GetJob("old"); err == nil {
+		t.Error("expected job to be removed")
+	}
+
+	if _, err := Run(db, policy, []string{"bogus"}, true); err == nil {
+		t.Error("expected error for unknown target")
+	}
+}
@@ -18,7 +18,7 @@ func CreateSearchBackend(cfg *config.Config) (SearchBackend, error) {
 	}
 
 	// Open database connection
-	db, err := database.Initialize(cfg.Database.Path)
+	db, err := database.Open(cfg.Database.Path, database.OpenOptions{Mode: cfg.Database.Mode, Replication: cfg.Database.Replication})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -36,6 +36,8 @@ func CreateSearchBackend(cfg *config.Config) (SearchBackend, error) {
 			MaxSearchResults: cfg.Search.DefaultLimit,
 			IndexPath:        paths.GetIndexPath(),
 			EmbeddingsPath:   paths.GetEmbeddingsPath(),
+			Shards:           cfg.Search.Shards,
+			QuantizeVectors:  cfg.Vectors.UseQuantized,
 		}
 
 		backend, err := NewTieredSearchBackend(db, tieredCfg)
@@ -60,6 +62,7 @@ func CreateSearchBackend(cfg *config.Config) (SearchBackend, error) {
 				} else {
 					// Backend is already the correct type (*TieredSearchBackend)
 					backend.SetEmbedder(embedder)
+					tieredCfg.EmbeddingModel = embedder.GetLoadedModel()
 					log.Printf("[FACTORY] Successfully initialized embedder for tiered backend")
 				}
 			}
@@ -74,8 +77,9 @@ func CreateSearchBackend(cfg *config.Config) (SearchBackend, error) {
 		return backend, nil
 	}
 
-	// Fall back to basic Bleve index wrapped as backend
-	bleveIndex, err := InitBleveIndex(cfg.Search.IndexPath)
+	// Fall back to basic Bleve index wrapped as backend, which also handles
+	// sharded indexes the enhanced backend refuses
+	bleveIndex, err := InitBleveIndexWithShards(cfg.Search.IndexPath, cfg.Search.Shards)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize Bleve index: %w", err)
 	}
@@ -10,19 +10,52 @@ import (
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/search/query"
+
+	"github.com/nishad/srake/internal/facets"
+	"github.com/nishad/srake/internal/taxonomy"
 )
 
-// BleveIndex wraps the Bleve search index
+// BleveIndex wraps the Bleve search index. A sharded index routes each
+// document to one shard by its ID and searches all shards in parallel
+// through an index alias that merges their results.
 type BleveIndex struct {
-	index bleve.Index
-	path  string
+	index  bleve.Index   // the index, or an alias over all shards
+	shards []bleve.Index // shard indexes; empty when unsharded
+	path   string
 }
 
 // InitBleveIndex initializes or opens a Bleve index
 func InitBleveIndex(indexPath string) (*BleveIndex, error) {
+	return InitBleveIndexWithShards(indexPath, 1)
+}
+
+// InitBleveIndexWithShards opens a Bleve index, creating it with the given
+// number of shards if it does not exist. An existing index keeps the layout
+// it was built with.
+func InitBleveIndexWithShards(indexPath string, shards int) (*BleveIndex, error) {
 	start := time.Now()
 	log.Printf("[INIT] Opening Bleve index: %s", indexPath)
 
+	layout, err := ReadShardLayout(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if layout != nil || (shards > 1 && !isBleveIndex(indexPath)) {
+		indexes, err := openShards(indexPath, shards)
+		if err != nil {
+			return nil, err
+		}
+		b := &BleveIndex{
+			index:  bleve.NewIndexAlias(indexes...),
+			shards: indexes,
+			path:   indexPath,
+		}
+		if docCount, err := b.GetDocCount(); err == nil {
+			log.Printf("[INIT] Index loaded with %d documents in %d shards in %v", docCount, len(indexes), time.Since(start))
+		}
+		return b, nil
+	}
+
 	// Check if index exists and get its size
 	if _, err := os.Stat(indexPath); err == nil {
 		log.Printf("[INIT] Existing index found, size: %.2f MB", float64(getDirectorySize(indexPath))/(1024*1024))
@@ -40,7 +73,7 @@ func InitBleveIndex(indexPath string) (*BleveIndex, error) {
 		}
 		log.Printf("[INIT] New index created in %v", time.Since(start))
 	} else if err != nil {
-		return nil, fmt.Errorf("failed to open index: %w", err)
+		return nil, openError(indexPath, err)
 	} else {
 		// Get index statistics
 		if docCount, err := index.DocCount(); err == nil {
@@ -56,6 +89,46 @@ func InitBleveIndex(indexPath string) (*BleveIndex, error) {
 	}, nil
 }
 
+// isBleveIndex reports whether path holds a single unsharded Bleve index
+func isBleveIndex(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "index_meta.json"))
+	return err == nil
+}
+
+// indexFor returns the index a document ID is stored in
+func (b *BleveIndex) indexFor(id string) bleve.Index {
+	if len(b.shards) == 0 {
+		return b.index
+	}
+	return b.shards[ShardFor(id, len(b.shards))]
+}
+
+// ShardCount returns the number of shards, or 1 for an unsharded index
+func (b *BleveIndex) ShardCount() int {
+	if len(b.shards) == 0 {
+		return 1
+	}
+	return len(b.shards)
+}
+
+// ShardDocCounts returns the number of documents in each shard
+func (b *BleveIndex) ShardDocCounts() ([]uint64, error) {
+	if len(b.shards) == 0 {
+		count, err := b.index.DocCount()
+		return []uint64{count}, err
+	}
+
+	counts := make([]uint64, len(b.shards))
+	for i, shard := range b.shards {
+		count, err := shard.DocCount()
+		if err != nil {
+			return nil, fmt.Errorf("shard %d: %w", i, err)
+		}
+		counts[i] = count
+	}
+	return counts, nil
+}
+
 // getDirectorySize calculates the total size of a directory
 func getDirectorySize(path string) int64 {
 	var size int64
@@ -121,6 +194,24 @@ func createBiologicalIndexMapping() mapping.IndexMapping {
 	// Date fields
 	docMapping.AddFieldMappingsAt("submission_date", createDateFieldMapping())
 
+	// Local curation fields
+	docMapping.AddFieldMappingsAt("curated_title", createTextFieldMapping())
+	docMapping.AddFieldMappingsAt("tags", createKeywordFieldMapping())
+	docMapping.AddFieldMappingsAt("notes", createTextFieldMapping())
+
+	// Quality rules the record violates (see 'srake qc run --flag')
+	docMapping.AddFieldMappingsAt(FieldQCFlags, createKeywordFieldMapping())
+
+	// Numeric attribute ranges, e.g. "age:40-50 years"
+	docMapping.AddFieldMappingsAt(facets.FieldName, createKeywordFieldMapping())
+
+	// Sample taxonomy: taxon ID, lineage IDs and ancestor names by rank
+	docMapping.AddFieldMappingsAt(taxonomy.FieldTaxonID, createKeywordFieldMapping())
+	docMapping.AddFieldMappingsAt(taxonomy.FieldLineage, createKeywordFieldMapping())
+	for _, rank := range taxonomy.Ranks {
+		docMapping.AddFieldMappingsAt(taxonomy.RankField(rank), createKeywordFieldMapping())
+	}
+
 	// Set the default mapping (applies to all documents)
 	indexMapping.DefaultMapping = docMapping
 
@@ -207,41 +298,58 @@ type RunDoc struct {
 // Index operations
 func (b *BleveIndex) IndexStudy(study StudyDoc) error {
 	study.Type = "study"
-	return b.index.Index(study.StudyAccession, study)
+	return b.indexFor(study.StudyAccession).Index(study.StudyAccession, study)
 }
 
 func (b *BleveIndex) IndexExperiment(exp ExperimentDoc) error {
 	exp.Type = "experiment"
-	return b.index.Index(exp.ExperimentAccession, exp)
+	return b.indexFor(exp.ExperimentAccession).Index(exp.ExperimentAccession, exp)
 }
 
 func (b *BleveIndex) IndexSample(sample SampleDoc) error {
 	sample.Type = "sample"
-	return b.index.Index(sample.SampleAccession, sample)
+	return b.indexFor(sample.SampleAccession).Index(sample.SampleAccession, sample)
 }
 
 func (b *BleveIndex) IndexRun(run RunDoc) error {
 	run.Type = "run"
-	return b.index.Index(run.RunAccession, run)
+	return b.indexFor(run.RunAccession).Index(run.RunAccession, run)
 }
 
 // BleveSearchResult is an alias for bleve.SearchResult for easier access
 type BleveSearchResult = bleve.SearchResult
 
+// scoreOrder sorts hits by descending score, breaking ties by document ID
+// so that equal scores come back in the same order from any index build
+var scoreOrder = []string{"-_score", "_id"}
+
 // Search performs a full-text search
 func (b *BleveIndex) Search(queryStr string, limit int) (*bleve.SearchResult, error) {
-	query := bleve.NewQueryStringQuery(queryStr)
+	searchRequest, err := textSearchRequest(queryStr, limit)
+	if err != nil {
+		return nil, err
+	}
+	return b.index.Search(searchRequest)
+}
+
+// textSearchRequest builds the request of a full-text search
+func textSearchRequest(queryStr string, limit int) (*bleve.SearchRequest, error) {
+	query, err := parseTextQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
 	searchRequest := bleve.NewSearchRequest(query)
 	searchRequest.Size = limit
 	searchRequest.Fields = []string{"*"}
+	searchRequest.SortBy(scoreOrder)
 
 	// Add facets for filtering
 	searchRequest.AddFacet("organism", bleve.NewFacetRequest("organism", 10))
 	searchRequest.AddFacet("library_strategy", bleve.NewFacetRequest("library_strategy", 10))
 	searchRequest.AddFacet("platform", bleve.NewFacetRequest("platform", 10))
 	searchRequest.AddFacet("type", bleve.NewFacetRequest("type", 5))
-
-	return b.index.Search(searchRequest)
+	searchRequest.AddFacet(facets.FieldName, bleve.NewFacetRequest(facets.FieldName, 50))
+	return searchRequest, nil
 }
 
 // SearchWithQuery performs a search with a pre-built query
@@ -258,12 +366,14 @@ func (b *BleveIndex) SearchWithQuery(q interface{}, limit int) (*bleve.SearchRes
 	searchRequest := bleve.NewSearchRequest(searchQuery)
 	searchRequest.Size = limit
 	searchRequest.Fields = []string{"*"}
+	searchRequest.SortBy(scoreOrder)
 
 	// Add facets for filtering
 	searchRequest.AddFacet("organism", bleve.NewFacetRequest("organism", 10))
 	searchRequest.AddFacet("library_strategy", bleve.NewFacetRequest("library_strategy", 10))
 	searchRequest.AddFacet("platform", bleve.NewFacetRequest("platform", 10))
 	searchRequest.AddFacet("type", bleve.NewFacetRequest("type", 5))
+	searchRequest.AddFacet(facets.FieldName, bleve.NewFacetRequest(facets.FieldName, 50))
 	searchRequest.AddFacet("library_source", bleve.NewFacetRequest("library_source", 10))
 	searchRequest.AddFacet("library_layout", bleve.NewFacetRequest("library_layout", 5))
 
@@ -286,51 +396,114 @@ func (b *BleveIndex) BuildConjunctionQuery(queries []interface{}) query.Query {
 
 // SearchWithFilters performs a search with additional filters
 func (b *BleveIndex) SearchWithFilters(queryStr string, filters map[string]string, limit int) (*bleve.SearchResult, error) {
-	// Build queries
-	var queries []query.Query
+	q, err := filteredQuery(queryStr, filters, nil)
+	if err != nil {
+		return nil, err
+	}
+	searchRequest := bleve.NewSearchRequest(q)
+	searchRequest.Size = limit
+	searchRequest.Fields = []string{"*"}
+	searchRequest.SortBy(scoreOrder)
+
+	return b.index.Search(searchRequest)
+}
 
+// FacetCounts counts the values of the given fields across all documents
+// matching a query, without retrieving hits. An empty query matches all.
+func (b *BleveIndex) FacetCounts(queryStr string, fields []string, size int) (*bleve.SearchResult, error) {
+	var q query.Query = bleve.NewMatchAllQuery()
 	if queryStr != "" {
-		queries = append(queries, bleve.NewQueryStringQuery(queryStr))
+		var err error
+		if q, err = parseTextQuery(queryStr); err != nil {
+			return nil, err
+		}
 	}
 
-	// Add filter queries
-	// Use appropriate query types based on field mapping
-	for field, value := range filters {
-		var fieldQuery query.Query
+	searchRequest := bleve.NewSearchRequest(q)
+	searchRequest.Size = 0
+	for _, field := range fields {
+		searchRequest.AddFacet(field, bleve.NewFacetRequest(field, size))
+	}
 
-		// Platform uses keyword analyzer (exact match)
-		if field == "platform" {
-			termQuery := bleve.NewTermQuery(value)
-			termQuery.SetField(field)
-			fieldQuery = termQuery
-		} else {
-			// For text fields, use phrase match for exact matching
-			phraseQuery := bleve.NewMatchPhraseQuery(value)
-			phraseQuery.SetField(field)
-			fieldQuery = phraseQuery
+	return b.index.Search(searchRequest)
+}
+
+// FacetValueCounts counts the documents matching a query that carry each of
+// the given terms in a facet field. It fills in values that fell outside the
+// top terms returned by FacetCounts.
+func (b *BleveIndex) FacetValueCounts(queryStr, field string, values []string) (map[string]int, error) {
+	var q query.Query = bleve.NewMatchAllQuery()
+	if queryStr != "" {
+		var err error
+		if q, err = parseTextQuery(queryStr); err != nil {
+			return nil, err
 		}
+	}
+
+	counts := make(map[string]int, len(values))
+	for _, value := range values {
+		termQuery := bleve.NewTermQuery(value)
+		termQuery.SetField(field)
 
-		queries = append(queries, fieldQuery)
+		searchRequest := bleve.NewSearchRequest(bleve.NewConjunctionQuery(q, termQuery))
+		searchRequest.Size = 0
+		result, err := b.index.Search(searchRequest)
+		if err != nil {
+			return nil, err
+		}
+		counts[value] = int(result.Total)
 	}
+	return counts, nil
+}
 
-	// Create the final query
-	var finalQuery query.Query
-	if len(queries) == 0 {
-		finalQuery = bleve.NewMatchAllQuery()
-	} else if len(queries) == 1 {
-		finalQuery = queries[0]
-	} else {
-		// Use ConjunctionQuery to AND all conditions
+// SearchInCollection performs a search restricted to the given document IDs,
+// such as the members of a user-defined collection
+func (b *BleveIndex) SearchInCollection(queryStr string, filters map[string]string, ids []string, limit int) (*bleve.SearchResult, error) {
+	queries := []query.Query{bleve.NewDocIDQuery(ids)}
+
+	if queryStr != "" {
+		q, err := parseTextQuery(queryStr)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+
+	for field, value := range filters {
+		queries = append(queries, filterQuery(field, value))
+	}
+
+	var finalQuery query.Query = queries[0]
+	if len(queries) > 1 {
 		finalQuery = bleve.NewConjunctionQuery(queries...)
 	}
 
 	searchRequest := bleve.NewSearchRequest(finalQuery)
 	searchRequest.Size = limit
 	searchRequest.Fields = []string{"*"}
+	searchRequest.SortBy(scoreOrder)
 
 	return b.index.Search(searchRequest)
 }
 
+// filterQuery builds an exact-match query for a filter field.
+// Uses appropriate query types based on field mapping.
+func filterQuery(field, value string) query.Query {
+	// Platform, attribute ranges, taxon IDs and quality flags use the
+	// keyword analyzer (exact match)
+	switch field {
+	case "platform", facets.FieldName, taxonomy.FieldTaxonID, taxonomy.FieldLineage, FieldQCFlags:
+		termQuery := bleve.NewTermQuery(value)
+		termQuery.SetField(field)
+		return termQuery
+	}
+
+	// For text fields, use phrase match for exact matching
+	phraseQuery := bleve.NewMatchPhraseQuery(value)
+	phraseQuery.SetField(field)
+	return phraseQuery
+}
+
 // FuzzySearch performs a fuzzy search for typo tolerance
 func (b *BleveIndex) FuzzySearch(queryStr string, fuzziness int, limit int) (*bleve.SearchResult, error) {
 	fuzzyQuery := bleve.NewFuzzyQuery(queryStr)
@@ -339,13 +512,22 @@ func (b *BleveIndex) FuzzySearch(queryStr string, fuzziness int, limit int) (*bl
 	searchRequest := bleve.NewSearchRequest(fuzzyQuery)
 	searchRequest.Size = limit
 	searchRequest.Fields = []string{"*"}
+	searchRequest.SortBy(scoreOrder)
 
 	return b.index.Search(searchRequest)
 }
 
-// BatchIndex indexes multiple documents in a batch
+// BatchIndex indexes multiple documents in a batch. On a sharded index the
+// batch is split by shard and the shard batches are applied in parallel.
 func (b *BleveIndex) BatchIndex(docs []interface{}) error {
-	batch := b.index.NewBatch()
+	targets := b.shards
+	if len(targets) == 0 {
+		targets = []bleve.Index{b.index}
+	}
+	batches := make([]*bleve.Batch, len(targets))
+	for i, target := range targets {
+		batches[i] = target.NewBatch()
+	}
 
 	for _, doc := range docs {
 		var id string
@@ -380,17 +562,35 @@ func (b *BleveIndex) BatchIndex(docs []interface{}) error {
 			continue
 		}
 
-		if err := batch.Index(id, typedDoc); err != nil {
+		if err := batches[ShardFor(id, len(targets))].Index(id, typedDoc); err != nil {
 			return fmt.Errorf("failed to add document %s to batch: %w", id, err)
 		}
 	}
 
-	return b.index.Batch(batch)
+	if len(targets) == 1 {
+		return targets[0].Batch(batches[0])
+	}
+	return runPerShard(len(targets), func(shard int) error {
+		if batches[shard].Size() == 0 {
+			return nil
+		}
+		return targets[shard].Batch(batches[shard])
+	})
 }
 
 // Close closes the Bleve index
 func (b *BleveIndex) Close() error {
-	return b.index.Close()
+	if len(b.shards) == 0 {
+		return b.index.Close()
+	}
+
+	var firstErr error
+	for _, shard := range b.shards {
+		if err := shard.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // GetDocCount returns the number of documents in the index
@@ -400,5 +600,5 @@ func (b *BleveIndex) GetDocCount() (uint64, error) {
 
 // Delete removes a document from the index
 func (b *BleveIndex) Delete(id string) error {
-	return b.index.Delete(id)
+	return b.indexFor(id).Delete(id)
 }
@@ -25,13 +25,23 @@ type BleveBackend struct {
 	mu     sync.RWMutex
 }
 
-// NewBleveBackend creates a new Bleve search backend
+// NewBleveBackend creates a new Bleve search backend. It only handles
+// unsharded indexes; a sharded index is refused so that CreateSearchBackend
+// falls back to the shard-aware BleveIndex.
 func NewBleveBackend(cfg *config.Config) (*BleveBackend, error) {
 	b := &BleveBackend{
 		config: cfg,
 		path:   cfg.Search.IndexPath,
 	}
 
+	layout, err := ReadShardLayout(b.path)
+	if err != nil {
+		return nil, err
+	}
+	if layout != nil || (cfg.Search.Shards > 1 && !isBleveIndex(b.path)) {
+		return nil, fmt.Errorf("sharded index at %s is not supported by this backend", b.path)
+	}
+
 	// Try to open existing index
 	index, err := bleve.Open(b.path)
 	if err == bleve.ErrorIndexPathDoesNotExist {
@@ -42,7 +52,7 @@ func NewBleveBackend(cfg *config.Config) (*BleveBackend, error) {
 			return nil, fmt.Errorf("failed to create index: %w", err)
 		}
 	} else if err != nil {
-		return nil, fmt.Errorf("failed to open index: %w", err)
+		return nil, openError(b.path, err)
 	}
 
 	b.index = index
@@ -206,12 +216,82 @@ func (b *BleveBackend) DeleteBatch(ids []string) error {
 func (b *BleveBackend) Search(queryStr string, opts SearchOptions) (*SearchResult, error) {
 	start := time.Now()
 
-	// Build query
-	var q query.Query
+	q, err := filteredTextQuery(queryStr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// A cursor scan resumes after the last hit of the previous page
+	if opts.Cursor != "" {
+		page, next, err := searchPage(b.index, q, opts.Limit, opts.Cursor, configureSearch(opts))
+		if err != nil {
+			return nil, err
+		}
+		result := b.convertSearchResultWithFiltering(page, queryStr, start, opts)
+		result.TotalHits = int(page.Total)
+		result.NextCursor = next
+		result.Mode = "text"
+		return result, nil
+	}
+
+	// Set timeout if specified
+	// Note: SearchContext is not available in Bleve v2.3
+	// TODO: Add timeout support when upgrading to newer Bleve version
+
+	// Execute search
+	searchResult, err := b.index.Search(rankedSearchRequest(q, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to our result format
+	result := b.convertSearchResultWithFiltering(searchResult, queryStr, start, opts)
+	result.Mode = "text"
+
+	return result, nil
+}
+
+// SearchStream ranks the hits of a search without their stored fields and
+// then reads those a batch at a time as the hits are emitted. Cursor pages
+// are read with their fields, as by Search.
+func (b *BleveBackend) SearchStream(queryStr string, opts SearchOptions, header func(*SearchResult) error, emit func(Hit) error) error {
+	if opts.Cursor != "" {
+		result, err := b.Search(queryStr, opts)
+		if err != nil {
+			return err
+		}
+		return emitResult(result, header, emit)
+	}
+
+	start := time.Now()
+	q, err := filteredTextQuery(queryStr, opts)
+	if err != nil {
+		return err
+	}
+	searchRequest := rankedSearchRequest(q, opts)
+	searchRequest.Fields = nil
+	searchResult, err := b.index.Search(searchRequest)
+	if err != nil {
+		return err
+	}
+
+	result := b.convertSearchResultWithFiltering(searchResult, queryStr, start, opts)
+	result.Mode = "text"
+	if err := header(result); err != nil {
+		return err
+	}
+	return emitHits(b.index, result.Hits, emit)
+}
+
+// filteredTextQuery builds the query of a text search restricted by its
+// filters
+func filteredTextQuery(queryStr string, opts SearchOptions) (query.Query, error) {
+	var q query.Query = bleve.NewMatchAllQuery()
 	if queryStr != "" {
-		q = bleve.NewQueryStringQuery(queryStr)
-	} else {
-		q = bleve.NewMatchAllQuery()
+		var err error
+		if q, err = parseTextQuery(queryStr); err != nil {
+			return nil, err
+		}
 	}
 
 	// Apply filters if any
@@ -224,40 +304,37 @@ func (b *BleveBackend) Search(queryStr string, opts SearchOptions) (*SearchResul
 		}
 		q = bleve.NewConjunctionQuery(queries...)
 	}
+	return q, nil
+}
 
-	// Create search request
+// configureSearch adds the facets and highlighting of a search to its
+// request
+func configureSearch(opts SearchOptions) func(*bleve.SearchRequest) {
+	return func(searchRequest *bleve.SearchRequest) {
+		// Add facets if requested
+		for _, facetField := range opts.Facets {
+			searchRequest.AddFacet(facetField, bleve.NewFacetRequest(facetField, 10))
+		}
+
+		// Add highlight if requested
+		if opts.Highlight {
+			searchRequest.Highlight = bleve.NewHighlight()
+		}
+	}
+}
+
+// rankedSearchRequest builds the request of a page of a search in score
+// order
+func rankedSearchRequest(q query.Query, opts SearchOptions) *bleve.SearchRequest {
 	searchRequest := bleve.NewSearchRequest(q)
 	searchRequest.Size = opts.Limit
 	searchRequest.From = opts.Offset
 
 	// Add fields to retrieve
 	searchRequest.Fields = []string{"*"}
-
-	// Add facets if requested
-	for _, facetField := range opts.Facets {
-		searchRequest.AddFacet(facetField, bleve.NewFacetRequest(facetField, 10))
-	}
-
-	// Add highlight if requested
-	if opts.Highlight {
-		searchRequest.Highlight = bleve.NewHighlight()
-	}
-
-	// Set timeout if specified
-	// Note: SearchContext is not available in Bleve v2.3
-	// TODO: Add timeout support when upgrading to newer Bleve version
-
-	// Execute search
-	searchResult, err := b.index.Search(searchRequest)
-	if err != nil {
-		return nil, err
-	}
-
-	// Convert to our result format
-	result := b.convertSearchResultWithFiltering(searchResult, queryStr, start, opts)
-	result.Mode = "text"
-
-	return result, nil
+	searchRequest.SortBy(scoreOrder)
+	configureSearch(opts)(searchRequest)
+	return searchRequest
 }
 
 // SearchWithVector performs a hybrid text + vector search
@@ -271,7 +348,10 @@ func (b *BleveBackend) SearchWithVector(queryStr string, vector []float32, opts
 	// Build text query if provided
 	var textQuery query.Query
 	if queryStr != "" {
-		textQuery = bleve.NewQueryStringQuery(queryStr)
+		var err error
+		if textQuery, err = parseTextQuery(queryStr); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create search request
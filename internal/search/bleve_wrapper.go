@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/blevesearch/bleve/v2"
 )
 
 // bleveIndexWrapper wraps BleveIndex to implement SearchBackend interface
@@ -50,12 +52,51 @@ func (w *bleveIndexWrapper) DeleteBatch(ids []string) error {
 
 // Search operations
 func (w *bleveIndexWrapper) Search(query string, opts SearchOptions) (*SearchResult, error) {
+	if opts.Cursor != "" {
+		page, next, err := w.index.SearchPage(query, stringFilters(opts.Filters), opts.Limit, opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		return cursorResult(query, page, next), nil
+	}
+
 	bleveResult, err := w.index.Search(query, opts.Limit)
 	if err != nil {
 		return nil, err
 	}
+	return wrapperResult(query, bleveResult), nil
+}
+
+// SearchStream ranks the hits of a search without their stored fields and
+// then reads those a batch at a time as the hits are emitted. Cursor pages
+// are read with their fields, as by Search.
+func (w *bleveIndexWrapper) SearchStream(query string, opts SearchOptions, header func(*SearchResult) error, emit func(Hit) error) error {
+	if opts.Cursor != "" {
+		result, err := w.Search(query, opts)
+		if err != nil {
+			return err
+		}
+		return emitResult(result, header, emit)
+	}
+
+	searchRequest, err := textSearchRequest(query, opts.Limit)
+	if err != nil {
+		return err
+	}
+	searchRequest.Fields = nil
+	bleveResult, err := w.index.index.Search(searchRequest)
+	if err != nil {
+		return err
+	}
+	result := wrapperResult(query, bleveResult)
+	if err := header(result); err != nil {
+		return err
+	}
+	return emitHits(w.index.index, result.Hits, emit)
+}
 
-	// Convert BleveSearchResult to SearchResult
+// wrapperResult converts a Bleve search result to a SearchResult
+func wrapperResult(query string, bleveResult *bleve.SearchResult) *SearchResult {
 	result := &SearchResult{
 		Query:     query,
 		TotalHits: int(bleveResult.Total),
@@ -94,7 +135,7 @@ func (w *bleveIndexWrapper) Search(query string, opts SearchOptions) (*SearchRes
 		}
 	}
 
-	return result, nil
+	return result
 }
 
 func (w *bleveIndexWrapper) SearchWithVector(query string, vector []float32, opts SearchOptions) (*SearchResult, error) {
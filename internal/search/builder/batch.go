@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/nishad/srake/internal/search"
 )
 
 // BatchProcessor handles batch processing of documents
@@ -141,7 +143,6 @@ func (b *IndexBuilder) processStudiesBatch(ctx context.Context, offset int64, li
 	defer rows.Close()
 
 	docs := make([]interface{}, 0, limit)
-	texts := make([]string, 0, limit) // For batch embedding
 	count := 0
 
 	for rows.Next() {
@@ -175,10 +176,11 @@ func (b *IndexBuilder) processStudiesBatch(ctx context.Context, offset int64, li
 			doc["submission_date"] = study.SubmissionDate.Time
 		}
 
-		// Prepare text for embedding if enabled
-		if b.isEmbeddingEnabled() {
-			text := prepareStudyText(study.Title.String, study.Abstract.String)
-			texts = append(texts, text)
+		// Add the study's embedding, made by updateStudyEmbeddings
+		if b.vectors != nil {
+			if vector, ok := b.vectors.Vector(study.Accession); ok {
+				doc["embedding"] = vector
+			}
 		}
 
 		docs = append(docs, doc)
@@ -193,25 +195,14 @@ func (b *IndexBuilder) processStudiesBatch(ctx context.Context, offset int64, li
 		return count, fmt.Errorf("error iterating study rows: %w", err)
 	}
 
-	// Generate embeddings if enabled
-	if b.isEmbeddingEnabled() && len(texts) > 0 {
-		embeddings, err := b.generateBatchEmbeddings(texts)
-		if err != nil {
-			// Log error but continue without embeddings
-			fmt.Printf("Warning: Failed to generate embeddings for studies batch: %v\n", err)
-		} else {
-			// Add embeddings to documents
-			for i, doc := range docs {
-				if i < len(embeddings) && embeddings[i] != nil {
-					docMap := doc.(map[string]interface{})
-					docMap["embedding"] = embeddings[i]
-				}
-			}
-		}
-	}
-
 	// Index the batch
 	if count > 0 {
+		if err := search.MergeCurations(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge curations: %w", err)
+		}
+		if err := search.MergeQCFlags(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge quality flags: %w", err)
+		}
 		if err := b.backend.IndexBatch(docs); err != nil {
 			return count, fmt.Errorf("failed to index batch: %w", err)
 		}
@@ -299,6 +290,12 @@ func (b *IndexBuilder) processExperimentsBatch(ctx context.Context, offset int64
 
 	// Index the batch
 	if count > 0 {
+		if err := search.MergeCurations(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge curations: %w", err)
+		}
+		if err := search.MergeQCFlags(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge quality flags: %w", err)
+		}
 		if err := b.backend.IndexBatch(docs); err != nil {
 			return count, fmt.Errorf("failed to index batch: %w", err)
 		}
@@ -386,6 +383,18 @@ func (b *IndexBuilder) processSamplesBatch(ctx context.Context, offset int64, li
 
 	// Index the batch
 	if count > 0 {
+		if err := search.MergeCurations(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge curations: %w", err)
+		}
+		if err := search.MergeQCFlags(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge quality flags: %w", err)
+		}
+		if err := search.MergeAttributeRanges(b.db, b.config, docs); err != nil {
+			return count, fmt.Errorf("failed to merge attribute ranges: %w", err)
+		}
+		if err := search.MergeTaxonomy(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge taxonomy: %w", err)
+		}
 		if err := b.backend.IndexBatch(docs); err != nil {
 			return count, fmt.Errorf("failed to index batch: %w", err)
 		}
@@ -455,6 +464,12 @@ func (b *IndexBuilder) processRunsBatch(ctx context.Context, offset int64, limit
 
 	// Index the batch
 	if count > 0 {
+		if err := search.MergeCurations(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge curations: %w", err)
+		}
+		if err := search.MergeQCFlags(b.db, docs); err != nil {
+			return count, fmt.Errorf("failed to merge quality flags: %w", err)
+		}
 		if err := b.backend.IndexBatch(docs); err != nil {
 			return count, fmt.Errorf("failed to index batch: %w", err)
 		}
@@ -9,6 +9,7 @@ import (
 	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
 	"github.com/nishad/srake/internal/embeddings"
+	"github.com/nishad/srake/internal/paths"
 	"github.com/nishad/srake/internal/search"
 )
 
@@ -32,6 +33,7 @@ type BuildOptions struct {
 	NumWorkers         int    // Number of parallel workers
 	WithEmbeddings     bool   // Generate embeddings during indexing
 	EmbeddingModel     string // Model for embeddings
+	VectorsPath        string // Study vector index written with embeddings
 	ProgressFile       string // Path to progress file
 	CheckpointDir      string // Directory for checkpoints
 	Resume             bool   // Resume from checkpoint
@@ -48,6 +50,7 @@ type IndexBuilder struct {
 	progress *Progress
 	options  BuildOptions
 	embedder *embeddings.SearchEmbedder
+	vectors  *search.VectorIndex // Study embeddings for k-NN search
 
 	// Runtime state
 	mu           sync.RWMutex
@@ -84,6 +87,9 @@ func NewIndexBuilder(cfg *config.Config, db *database.DB, backend search.SearchB
 	if options.CheckpointDir == "" {
 		options.CheckpointDir = ".srake/checkpoints"
 	}
+	if options.VectorsPath == "" {
+		options.VectorsPath = search.VectorIndexPath(paths.GetEmbeddingsPath())
+	}
 
 	builder := &IndexBuilder{
 		config:       cfg,
@@ -126,6 +132,13 @@ func NewIndexBuilder(cfg *config.Config, db *database.DB, backend search.SearchB
 			fmt.Printf("Warning: Failed to initialize embedder: %v\n", err)
 		} else {
 			builder.embedder = embedder
+			builder.vectors = search.NewVectorIndex(0, cfg.Vectors.UseQuantized)
+			if options.Resume {
+				// Keep the embeddings of studies indexed before the interruption
+				if vectors, err := search.OpenVectorIndex(options.VectorsPath); err == nil {
+					builder.vectors = vectors
+				}
+			}
 		}
 	}
 
@@ -280,6 +293,14 @@ func (b *IndexBuilder) executeBuild(ctx context.Context) error {
 		return fmt.Errorf("failed to create FTS5 tables: %w", err)
 	}
 
+	// Embed the studies that need it before indexing them; the index can
+	// still be built without embeddings
+	if b.isEmbeddingEnabled() && !b.progress.IsTypeCompleted("studies") {
+		if err := b.updateStudyEmbeddings(ctx); err != nil {
+			fmt.Printf("Warning: Failed to update study embeddings: %v\n", err)
+		}
+	}
+
 	// Index studies and experiments into Bleve (Tier 1 and Tier 2)
 	// Samples and runs use SQLite FTS5 (Tier 3) and don't need Bleve indexing
 	// This matches the TieredSearchBackend architecture where:
@@ -316,7 +337,7 @@ func (b *IndexBuilder) executeBuild(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	return b.saveVectors()
 }
 
 // indexDocumentType indexes all documents of a specific type
@@ -397,6 +418,10 @@ func (b *IndexBuilder) createCheckpoint() error {
 	}
 	checkpoint.IndexSnapshot = snapshotPath
 
+	if err := b.saveVectors(); err != nil {
+		return err
+	}
+
 	// Add checkpoint to progress
 	b.progress.AddCheckpoint(checkpoint)
 	b.progress.LastCheckpointDocs = b.progress.ProcessedDocs
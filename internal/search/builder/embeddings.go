@@ -1,8 +1,11 @@
 package builder
 
 import (
+	"context"
 	"fmt"
 	"strings"
+
+	"github.com/nishad/srake/internal/search"
 )
 
 // generateEmbedding generates embedding for a single text
@@ -65,15 +68,6 @@ func combineTextFields(fields ...string) string {
 	return strings.Join(nonEmpty, " ")
 }
 
-// prepareStudyText prepares study text for embedding
-func prepareStudyText(title, abstract string) string {
-	text := combineTextFields(title, abstract)
-	if text == "" {
-		return ""
-	}
-	return text
-}
-
 // prepareExperimentText prepares experiment text for embedding
 func prepareExperimentText(title, libraryStrategy, platform string) string {
 	text := combineTextFields(title, libraryStrategy, platform)
@@ -96,3 +90,34 @@ func prepareSampleText(title, organism, attributes string) string {
 func (b *IndexBuilder) isEmbeddingEnabled() bool {
 	return b.embedder != nil && b.options.WithEmbeddings
 }
+
+// updateStudyEmbeddings embeds the studies that are new or changed since
+// their stored embeddings were made, and loads the embeddings of every
+// study to be added to the index
+func (b *IndexBuilder) updateStudyEmbeddings(ctx context.Context) error {
+	model := b.config.Embeddings.DefaultModel
+	update, err := search.UpdateStudyEmbeddings(ctx, b.db, b.embedder, model, b.options.BatchSize, nil)
+	if err != nil {
+		return err
+	}
+	vectors, err := search.LoadStudyVectors(b.db, model, b.config.Vectors.UseQuantized)
+	if err != nil {
+		return err
+	}
+	b.vectors = vectors
+	if b.options.Verbose {
+		fmt.Printf("Embedded %d studies, reused %d stored embeddings\n", update.Embedded, update.Unchanged)
+	}
+	return nil
+}
+
+// saveVectors writes the study vector index, if embeddings are generated
+func (b *IndexBuilder) saveVectors() error {
+	if b.vectors == nil || b.vectors.Len() == 0 {
+		return nil
+	}
+	if err := b.vectors.Save(b.options.VectorsPath); err != nil {
+		return fmt.Errorf("failed to save study embeddings: %w", err)
+	}
+	return nil
+}
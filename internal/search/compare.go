@@ -0,0 +1,71 @@
+package search
+
+import (
+	"math"
+	"sort"
+)
+
+// FacetDelta compares how often a facet value occurs in two result sets.
+// Percentages are relative to the total hits of each query.
+type FacetDelta struct {
+	Value    string  `json:"value"`
+	CountA   int     `json:"count_a"`
+	CountB   int     `json:"count_b"`
+	PercentA float64 `json:"percent_a"`
+	PercentB float64 `json:"percent_b"`
+	// Difference is PercentA minus PercentB, in percentage points
+	Difference float64 `json:"difference"`
+}
+
+// FacetComparison holds the per-value differences of one facet field.
+type FacetComparison struct {
+	Field  string       `json:"field"`
+	Deltas []FacetDelta `json:"deltas"`
+}
+
+// CompareFacets lines up the values of a facet from two queries, ordered by
+// the size of the difference in share between them.
+func CompareFacets(field string, totalA, totalB uint64, a, b []FacetValue) FacetComparison {
+	deltas := make(map[string]*FacetDelta)
+	get := func(value string) *FacetDelta {
+		d, ok := deltas[value]
+		if !ok {
+			d = &FacetDelta{Value: value}
+			deltas[value] = d
+		}
+		return d
+	}
+	for _, v := range a {
+		get(v.Value).CountA += v.Count
+	}
+	for _, v := range b {
+		get(v.Value).CountB += v.Count
+	}
+
+	comparison := FacetComparison{Field: field, Deltas: make([]FacetDelta, 0, len(deltas))}
+	for _, d := range deltas {
+		d.PercentA = percentOf(d.CountA, totalA)
+		d.PercentB = percentOf(d.CountB, totalB)
+		d.Difference = d.PercentA - d.PercentB
+		comparison.Deltas = append(comparison.Deltas, *d)
+	}
+
+	sort.Slice(comparison.Deltas, func(i, j int) bool {
+		di, dj := comparison.Deltas[i], comparison.Deltas[j]
+		if math.Abs(di.Difference) != math.Abs(dj.Difference) {
+			return math.Abs(di.Difference) > math.Abs(dj.Difference)
+		}
+		if di.CountA+di.CountB != dj.CountA+dj.CountB {
+			return di.CountA+di.CountB > dj.CountA+dj.CountB
+		}
+		return di.Value < dj.Value
+	})
+	return comparison
+}
+
+func percentOf(count int, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(total)
+}
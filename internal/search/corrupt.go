@@ -0,0 +1,130 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// CorruptIndexError reports a search index, or a shard of one, that exists
+// but cannot be opened, typically after an unclean shutdown.
+type CorruptIndexError struct {
+	Path string
+	Err  error
+}
+
+func (e *CorruptIndexError) Error() string {
+	return fmt.Sprintf("search index at %s cannot be opened (%v); rebuild it with 'srake index --rebuild --only-missing'", e.Path, e.Err)
+}
+
+func (e *CorruptIndexError) Unwrap() error {
+	return e.Err
+}
+
+// IsIndexCorrupt reports whether err is or wraps a CorruptIndexError
+func IsIndexCorrupt(err error) bool {
+	var corrupt *CorruptIndexError
+	return errors.As(err, &corrupt)
+}
+
+// openError classifies an error opening the existing Bleve index at path.
+// Indexes that cannot be read are corrupt, unless this user may not read
+// them.
+func openError(path string, err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return &CorruptIndexError{Path: path, Err: err}
+}
+
+// checkIndex opens the Bleve index at path and closes it again. It returns
+// whether the index exists, and a CorruptIndexError if it cannot be opened.
+func checkIndex(path string) (bool, error) {
+	index, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return true, openError(path, err)
+	}
+	return true, index.Close()
+}
+
+// IndexRepair describes the parts of an index SetAsideCorrupt found missing
+// or unreadable
+type IndexRepair struct {
+	Shards  int   // shards of the index, 1 when unsharded
+	Rebuild []int // shards to index again, shard 0 for a whole unsharded index
+	// SetAside is the directory the unreadable parts were moved to, empty
+	// when none were
+	SetAside string
+}
+
+// SetAsideCorrupt finds the parts of an index that are missing or cannot be
+// opened: the whole of an unsharded index, or single shards of a sharded
+// one. Unreadable parts are moved to a directory beside the index,
+// <index>.corrupt-<time>, so that they are created anew when the index is
+// next opened; they are kept for inspection rather than deleted. Records
+// routed to the shards in the returned Rebuild are missing from the index.
+func SetAsideCorrupt(indexPath string) (*IndexRepair, error) {
+	layout, err := ReadShardLayout(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	repair := &IndexRepair{Shards: 1}
+	var corrupt []string
+	if layout == nil {
+		exists, err := checkIndex(indexPath)
+		if err != nil && !IsIndexCorrupt(err) {
+			return nil, err
+		}
+		if !exists || err != nil {
+			repair.Rebuild = []int{0}
+		}
+		if err != nil {
+			corrupt = append(corrupt, indexPath)
+		}
+	} else {
+		repair.Shards = layout.Shards
+		for i := 0; i < layout.Shards; i++ {
+			exists, err := checkIndex(ShardPath(indexPath, i))
+			if err != nil && !IsIndexCorrupt(err) {
+				return nil, err
+			}
+			if !exists || err != nil {
+				repair.Rebuild = append(repair.Rebuild, i)
+			}
+			if err != nil {
+				corrupt = append(corrupt, ShardPath(indexPath, i))
+			}
+		}
+	}
+	if len(corrupt) == 0 {
+		return repair, nil
+	}
+
+	dir := fmt.Sprintf("%s.corrupt-%s", filepath.Clean(indexPath), time.Now().Format("20060102-150405"))
+	if layout == nil {
+		// The whole index moves
+		if err := os.Rename(indexPath, dir); err != nil {
+			return nil, fmt.Errorf("failed to set aside corrupt index: %w", err)
+		}
+		repair.SetAside = dir
+		return repair, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	for _, path := range corrupt {
+		if err := os.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			return nil, fmt.Errorf("failed to set aside corrupt shard: %w", err)
+		}
+	}
+	repair.SetAside = dir
+	return repair, nil
+}
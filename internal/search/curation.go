@@ -0,0 +1,81 @@
+package search
+
+import (
+	"github.com/nishad/srake/internal/database"
+)
+
+// FieldQCFlags is the index field holding the quality rules a record is
+// flagged as violating
+const FieldQCFlags = "qc_flags"
+
+// MergeCurations adds local curation fields (curated_title, tags, notes) to
+// index documents so curated records are searchable by their curated values.
+// Documents are expected to be maps carrying the record accession under "id".
+func MergeCurations(db *database.DB, docs []interface{}) error {
+	accessions := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if m, ok := doc.(map[string]interface{}); ok {
+			if id, ok := m["id"].(string); ok {
+				accessions = append(accessions, id)
+			}
+		}
+	}
+
+	curations, err := db.GetCurations(accessions)
+	if err != nil {
+		return err
+	}
+	if len(curations) == 0 {
+		return nil
+	}
+
+	for _, doc := range docs {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := m["id"].(string)
+		c, ok := curations[id]
+		if !ok {
+			continue
+		}
+		if c.CuratedTitle != "" {
+			m["curated_title"] = c.CuratedTitle
+		}
+		if len(c.Tags) > 0 {
+			m["tags"] = c.Tags
+		}
+		if c.Notes != "" {
+			m["notes"] = c.Notes
+		}
+	}
+
+	return nil
+}
+
+// MergeQCFlags adds the quality rules each document's record is flagged by
+// to the documents, so that searches can filter on them
+func MergeQCFlags(db *database.DB, docs []interface{}) error {
+	accessions := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if m, ok := doc.(map[string]interface{}); ok {
+			if id, ok := m["id"].(string); ok {
+				accessions = append(accessions, id)
+			}
+		}
+	}
+
+	flagged, err := db.GetFlaggedRules(accessions)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if m, ok := doc.(map[string]interface{}); ok {
+			id, _ := m["id"].(string)
+			if rules, ok := flagged[id]; ok {
+				m[FieldQCFlags] = rules
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package search
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2"
+	blevesearch "github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// StartCursor begins a cursor scan over the results of a search. Each page
+// returns the cursor of the next one, which, unlike an offset, costs the
+// same however deep the page. Cursor scans return hits in document ID
+// order rather than by score, since the ID gives every hit a stable
+// position to resume after.
+const StartCursor = "*"
+
+// streamPageSize is the number of hits read per page while streaming
+const streamPageSize = 1000
+
+// ErrInvalidCursor is returned for a cursor that was not issued by a search
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// BleveMatch is an alias for a Bleve search hit
+type BleveMatch = blevesearch.DocumentMatch
+
+// encodeCursor encodes the ID of the last hit of a page as an opaque cursor
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// decodeCursor returns the search-after position of a cursor, or nil for
+// StartCursor
+func decodeCursor(cursor string) ([]string, error) {
+	if cursor == StartCursor {
+		return nil, nil
+	}
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(id) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return []string{string(id)}, nil
+}
+
+// searchPage runs one page of a cursor scan. The cursor of the next page is
+// empty after the last page.
+func searchPage(index bleve.Index, q query.Query, size int, cursor string, configure func(*bleve.SearchRequest)) (*bleve.SearchResult, string, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req := bleve.NewSearchRequest(q)
+	req.Size = size
+	req.Fields = []string{"*"}
+	req.SortBy([]string{"_id"})
+	req.SearchAfter = after
+	if configure != nil {
+		configure(req)
+	}
+
+	result, err := index.Search(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(result.Hits) == size && size > 0 {
+		next = encodeCursor(result.Hits[len(result.Hits)-1].ID)
+	}
+	return result, next, nil
+}
+
+// filteredQuery builds the query of a search restricted by filters and,
+// when ids is not empty, to the given documents
+func filteredQuery(queryStr string, filters map[string]string, ids []string) (query.Query, error) {
+	var queries []query.Query
+	if len(ids) > 0 {
+		queries = append(queries, bleve.NewDocIDQuery(ids))
+	}
+	if queryStr != "" {
+		q, err := parseTextQuery(queryStr)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	for field, value := range filters {
+		queries = append(queries, filterQuery(field, value))
+	}
+
+	switch len(queries) {
+	case 0:
+		return bleve.NewMatchAllQuery(), nil
+	case 1:
+		return queries[0], nil
+	}
+	return bleve.NewConjunctionQuery(queries...), nil
+}
+
+// SearchPage returns one page of a filtered search, starting with
+// StartCursor, and the cursor of the next page, which is empty after the
+// last page.
+func (b *BleveIndex) SearchPage(queryStr string, filters map[string]string, size int, cursor string) (*bleve.SearchResult, string, error) {
+	q, err := filteredQuery(queryStr, filters, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return searchPage(b.index, q, size, cursor, nil)
+}
+
+// StreamSearch calls fn with each hit of a filtered search in document ID
+// order, reading the index a page at a time so that memory use does not
+// grow with the number of hits. ids, when not empty, restricts the search
+// to those documents. A limit of 0 streams every hit. fn returning an
+// error stops the search.
+func (b *BleveIndex) StreamSearch(queryStr string, filters map[string]string, ids []string, limit int, fn func(*BleveMatch) error) error {
+	q, err := filteredQuery(queryStr, filters, ids)
+	if err != nil {
+		return err
+	}
+	cursor := StartCursor
+	for sent := 0; limit <= 0 || sent < limit; {
+		size := streamPageSize
+		if limit > 0 && limit-sent < size {
+			size = limit - sent
+		}
+
+		result, next, err := searchPage(b.index, q, size, cursor, nil)
+		if err != nil {
+			return err
+		}
+		for _, hit := range result.Hits {
+			if err := fn(hit); err != nil {
+				return err
+			}
+		}
+		sent += len(result.Hits)
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+	return nil
+}
+
+// cursorResult converts a page of a cursor scan to a search result
+func cursorResult(queryStr string, page *bleve.SearchResult, next string) *SearchResult {
+	return &SearchResult{
+		Query:      queryStr,
+		TotalHits:  int(page.Total),
+		Hits:       HitsFromBleve(page),
+		TimeMs:     page.Took.Milliseconds(),
+		Mode:       "text",
+		NextCursor: next,
+	}
+}
+
+// stringFilters converts search option filters to the string filters of
+// BleveIndex
+func stringFilters(filters map[string]interface{}) map[string]string {
+	if len(filters) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(filters))
+	for field, value := range filters {
+		out[field] = fmt.Sprintf("%v", value)
+	}
+	return out
+}
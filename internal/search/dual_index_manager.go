@@ -37,9 +37,10 @@ func NewDualIndexManager(cfg *config.Config) (*DualIndexManager, error) {
 
 	// Initialize embedder if configured
 	if cfg.Embeddings.Enabled {
-		embedder, err := embeddings.NewONNXEmbedder(
+		embedder, err := embeddings.NewONNXEmbedderWithOptions(
 			cfg.Embeddings.DefaultModel,
 			cfg.Embeddings.ModelsDirectory,
+			embeddings.ONNXOptionsFromConfig(cfg.Embeddings),
 		)
 		if err != nil {
 			fmt.Printf("Warning: Failed to initialize embedder: %v\n", err)
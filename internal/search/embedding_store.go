@@ -0,0 +1,173 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// EmbeddingUpdate counts the studies an embedding update went through
+type EmbeddingUpdate struct {
+	Model     string `json:"model"`
+	Studies   int    `json:"studies"`
+	Embedded  int    `json:"embedded"`  // new or with changed text
+	Unchanged int    `json:"unchanged"` // stored embedding reused
+	Removed   int64  `json:"removed"`   // of studies no longer in the database
+}
+
+// StudyEmbeddingText returns the text a study is embedded from: its title,
+// abstract and type
+func StudyEmbeddingText(title, abstract, studyType string) string {
+	var fields []string
+	for _, field := range []string{title, abstract, studyType} {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// UpdateStudyEmbeddings embeds, with model, the studies that have no stored
+// embedding of it or whose text changed since theirs was made, in batches
+// of batchSize. Embeddings of studies no longer in the database are
+// removed. progress, if set, is called after each batch with the studies
+// embedded so far and the number to embed.
+func UpdateStudyEmbeddings(ctx context.Context, db *database.DB, embedder EmbedderInterface, model string, batchSize int, progress func(done, total int)) (*EmbeddingUpdate, error) {
+	if embedder == nil || !embedder.IsEnabled() {
+		return nil, fmt.Errorf("embedder is not enabled")
+	}
+	if batchSize <= 0 {
+		batchSize = 32
+	}
+
+	stored, err := db.EmbeddingHashes(model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stored embeddings: %w", err)
+	}
+
+	// Find the studies to embed first, so that no query is open while
+	// embeddings are written
+	update := &EmbeddingUpdate{Model: model}
+	var pending []string
+	rows, err := db.QueryContext(ctx, `
+		SELECT study_accession, COALESCE(study_title, ''), COALESCE(study_abstract, ''), COALESCE(study_type, '')
+		FROM studies
+		ORDER BY study_accession
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query studies: %w", err)
+	}
+	for rows.Next() {
+		var accession, title, abstract, studyType string
+		if err := rows.Scan(&accession, &title, &abstract, &studyType); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan study: %w", err)
+		}
+		update.Studies++
+		hash, ok := stored[accession]
+		delete(stored, accession)
+		text := StudyEmbeddingText(title, abstract, studyType)
+		switch {
+		case text == "":
+		case ok && hash == database.EmbeddingTextHash(text):
+			update.Unchanged++
+		default:
+			pending = append(pending, accession)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query studies: %w", err)
+	}
+
+	if len(stored) > 0 {
+		removed := make([]string, 0, len(stored))
+		for accession := range stored {
+			removed = append(removed, accession)
+		}
+		if update.Removed, err = db.DeleteEmbeddings(model, removed); err != nil {
+			return nil, fmt.Errorf("failed to remove embeddings: %w", err)
+		}
+	}
+
+	for start := 0; start < len(pending); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return update, err
+		}
+		end := min(start+batchSize, len(pending))
+		n, err := embedStudies(ctx, db, embedder, model, pending[start:end])
+		if err != nil {
+			return update, err
+		}
+		update.Embedded += n
+		if progress != nil {
+			progress(end, len(pending))
+		}
+	}
+	return update, nil
+}
+
+// embedStudies embeds and stores a batch of studies
+func embedStudies(ctx context.Context, db *database.DB, embedder EmbedderInterface, model string, accessions []string) (int, error) {
+	args := make([]interface{}, len(accessions))
+	for i, accession := range accessions {
+		args[i] = accession
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT study_accession, COALESCE(study_title, ''), COALESCE(study_abstract, ''), COALESCE(study_type, '')
+		FROM studies
+		WHERE study_accession IN (?`+strings.Repeat(",?", len(accessions)-1)+`)
+		ORDER BY study_accession
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query studies: %w", err)
+	}
+	var batch []database.StoredEmbedding
+	var texts []string
+	for rows.Next() {
+		var accession, title, abstract, studyType string
+		if err := rows.Scan(&accession, &title, &abstract, &studyType); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan study: %w", err)
+		}
+		text := StudyEmbeddingText(title, abstract, studyType)
+		batch = append(batch, database.StoredEmbedding{Accession: accession, TextHash: database.EmbeddingTextHash(text)})
+		texts = append(texts, text)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to query studies: %w", err)
+	}
+	if len(texts) == 0 {
+		return 0, nil
+	}
+
+	vectors, err := embedder.EmbedBatch(texts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed studies: %w", err)
+	}
+	for i := range batch {
+		if i < len(vectors) {
+			batch[i].Vector = vectors[i]
+		}
+	}
+	if err := db.PutEmbeddings(model, batch); err != nil {
+		return 0, fmt.Errorf("failed to store embeddings: %w", err)
+	}
+	return len(batch), nil
+}
+
+// LoadStudyVectors returns a vector index of the study embeddings stored
+// for model
+func LoadStudyVectors(db *database.DB, model string, quantized bool) (*VectorIndex, error) {
+	vectors := NewVectorIndex(0, quantized)
+	err := db.EachEmbedding(model, func(accession string, vector []float32) error {
+		return vectors.Add(accession, vector)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load study embeddings: %w", err)
+	}
+	return vectors, nil
+}
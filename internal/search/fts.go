@@ -0,0 +1,129 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// SearchFTS searches samples and runs in the SQLite FTS5 tables (tier 3),
+// for when the Bleve index is missing or out of date. Hits of both types
+// are ranked together by BM25 score, higher being better, with snippets of
+// the matching columns as highlights. Filters keep the hits whose field
+// equals the filter value, ignoring case.
+func SearchFTS(db *database.DB, query string, opts SearchOptions) (*SearchResult, error) {
+	start := time.Now()
+
+	fts := database.NewFTS5Manager(db)
+	if !fts.HasFTSTables() {
+		return nil, fmt.Errorf("full-text tables not built; run 'srake index --build-fts'")
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	candidates := limit + opts.Offset
+
+	samples, err := fts.SearchSamples(query, candidates)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := fts.SearchRuns(query, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(samples)+len(runs))
+	for _, s := range samples {
+		hits = append(hits, Hit{
+			ID:    s.SampleAccession,
+			Type:  "sample",
+			Score: -s.Score,
+			Fields: map[string]interface{}{
+				"type":                 "sample",
+				"title":                s.Description,
+				"organism":             s.Organism,
+				"scientific_name":      s.ScientificName,
+				"tissue":               s.Tissue,
+				"cell_type":            s.CellType,
+				"experiment_accession": s.ExperimentAccession,
+			},
+			Highlights: snippetHighlights(s.Snippets),
+		})
+	}
+	for _, r := range runs {
+		hits = append(hits, Hit{
+			ID:    r.RunAccession,
+			Type:  "run",
+			Score: -r.Score,
+			Fields: map[string]interface{}{
+				"type":                 "run",
+				"title":                r.Title,
+				"library_strategy":     r.LibraryStrategy,
+				"platform":             r.Platform,
+				"instrument_model":     r.InstrumentModel,
+				"experiment_accession": r.ExperimentAccession,
+				"total_spots":          r.TotalSpots,
+				"total_bases":          r.TotalBases,
+			},
+			Highlights: snippetHighlights(r.Snippets),
+		})
+	}
+
+	if len(opts.Filters) > 0 {
+		filtered := hits[:0]
+		for _, hit := range hits {
+			if hitMatchesFilters(hit, opts.Filters) {
+				filtered = append(filtered, hit)
+			}
+		}
+		hits = filtered
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	total := len(hits)
+	if opts.Offset >= len(hits) {
+		hits = hits[:0]
+	} else {
+		hits = hits[opts.Offset:]
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return &SearchResult{
+		Query:     query,
+		TotalHits: total,
+		Hits:      hits,
+		TimeMs:    time.Since(start).Milliseconds(),
+		Mode:      "fts5",
+	}, nil
+}
+
+// snippetHighlights converts FTS5 snippets to highlight fragments
+func snippetHighlights(snippets map[string]string) map[string][]string {
+	if len(snippets) == 0 {
+		return nil
+	}
+	highlights := make(map[string][]string, len(snippets))
+	for column, snippet := range snippets {
+		highlights[column] = []string{snippet}
+	}
+	return highlights
+}
+
+// hitMatchesFilters reports whether each filtered field of a hit equals the
+// filter value
+func hitMatchesFilters(hit Hit, filters map[string]interface{}) bool {
+	for field, want := range filters {
+		got, ok := hit.Fields[field]
+		if !ok || !strings.EqualFold(fmt.Sprint(got), fmt.Sprint(want)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Rank fusion methods for hybrid search
+const (
+	// FusionWeighted blends vector similarity with the text score divided
+	// by the best text score, weighted by HybridWeight
+	FusionWeighted = "weighted"
+	// FusionRRF sums reciprocal ranks, 1/(60+rank), from each list,
+	// weighted by HybridWeight. It ignores the scales of the raw scores.
+	FusionRRF = "rrf"
+)
+
+// DefaultHybridWeight is the weight of vector scores when none is given
+const DefaultHybridWeight = 0.7
+
+// rrfK dampens the advantage of the very top ranks in reciprocal rank
+// fusion; 60 is the constant from the original RRF paper
+const rrfK = 60
+
+// ValidFusion reports whether method names a rank fusion method
+func ValidFusion(method string) error {
+	switch method {
+	case "", FusionWeighted, FusionRRF:
+		return nil
+	}
+	return fmt.Errorf("unknown fusion method %q (use %s or %s)", method, FusionWeighted, FusionRRF)
+}
+
+// FuseHits combines text and vector results, each ranked best first, into
+// one list ranked by fused score. weight is the share of the vector
+// score, from 0 (text only) to 1 (vector only). Hits found by both
+// searches keep the vector hit's similarity and the text hit's fields.
+func FuseHits(text, vector []Hit, method string, weight float64) []Hit {
+	if weight < 0 {
+		weight = 0
+	}
+	if weight > 1 {
+		weight = 1
+	}
+
+	var maxText float64
+	for _, h := range text {
+		if h.Score > maxText {
+			maxText = h.Score
+		}
+	}
+	textScore := func(rank int, h Hit) float64 {
+		if method == FusionRRF {
+			return 1 / float64(rrfK+rank+1)
+		}
+		if maxText == 0 {
+			return 0
+		}
+		return h.Score / maxText
+	}
+	vectorScore := func(rank int, h Hit) float64 {
+		if method == FusionRRF {
+			return 1 / float64(rrfK+rank+1)
+		}
+		return float64(h.Similarity)
+	}
+
+	merged := make(map[string]*Hit, len(text)+len(vector))
+	order := make([]string, 0, len(text)+len(vector))
+	for rank, h := range vector {
+		hit := h
+		hit.Score = weight * vectorScore(rank, h)
+		merged[h.ID] = &hit
+		order = append(order, h.ID)
+	}
+	for rank, h := range text {
+		score := (1 - weight) * textScore(rank, h)
+		if hit, ok := merged[h.ID]; ok {
+			hit.Score += score
+			if h.Fields != nil {
+				hit.Fields = h.Fields
+			}
+			if h.Highlights != nil {
+				hit.Highlights = h.Highlights
+			}
+			continue
+		}
+		hit := h
+		hit.Score = score
+		merged[h.ID] = &hit
+		order = append(order, h.ID)
+	}
+
+	hits := make([]Hit, 0, len(order))
+	for _, id := range order {
+		hits = append(hits, *merged[id])
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits
+}
+
+// HitsFromBleve converts Bleve matches to hits, in rank order
+func HitsFromBleve(result *BleveSearchResult) []Hit {
+	if result == nil {
+		return nil
+	}
+	hits := make([]Hit, 0, len(result.Hits))
+	for _, m := range result.Hits {
+		docType, _ := m.Fields["type"].(string)
+		hits = append(hits, Hit{
+			ID:         m.ID,
+			Type:       docType,
+			Score:      m.Score,
+			Fields:     m.Fields,
+			Highlights: m.Fragments,
+		})
+	}
+	return hits
+}
+
+// hybridResult pages fused hits into a result
+func hybridResult(query string, hits []Hit, opts SearchOptions, limit int) *SearchResult {
+	total := len(hits)
+	if opts.Offset >= len(hits) {
+		hits = nil
+	} else {
+		hits = hits[opts.Offset:]
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return &SearchResult{
+		Query:     query,
+		TotalHits: total,
+		Hits:      hits,
+		Mode:      "hybrid",
+	}
+}
@@ -26,10 +26,26 @@ type SearchBackend interface {
 	Rebuild(ctx context.Context) error
 }
 
+// Warmer is implemented by backends that open their index or fill their
+// caches on first use, to do so before the first search
+type Warmer interface {
+	Warm() error
+}
+
+// Streamer is implemented by backends that can hand out the hits of a text
+// search as their stored fields are read, rather than as a page built in
+// full. SearchStream calls header with the ranked hits, which have no
+// fields yet, and then emit with each hit and its fields in rank order. It
+// stops at the first error header or emit returns.
+type Streamer interface {
+	SearchStream(query string, opts SearchOptions, header func(*SearchResult) error, emit func(Hit) error) error
+}
+
 // SearchOptions contains search parameters
 type SearchOptions struct {
 	Limit        int                    // Maximum results to return
 	Offset       int                    // Pagination offset
+	Cursor       string                 // Resume a cursor scan; StartCursor begins one
 	Filters      map[string]interface{} // Field filters
 	Facets       []string               // Facet fields to return
 	Highlight    bool                   // Enable highlighting
@@ -46,6 +62,7 @@ type SearchOptions struct {
 	TopPercentile       int     // Only return top N percentile of results
 	ShowConfidence      bool    // Include confidence levels in results
 	HybridWeight        float32 // Weight for hybrid scoring (0=text only, 1=vector only)
+	Fusion              string  // Hybrid rank fusion: weighted (default) or rrf
 
 	// Performance options
 	TimeoutMs int  // Query timeout in milliseconds
@@ -60,17 +77,32 @@ type SearchResult struct {
 	Facets    map[string][]FacetValue `json:"facets,omitempty"`
 	TimeMs    int64                   `json:"time_ms"`
 	Mode      string                  `json:"mode"` // "text", "vector", "hybrid"
+
+	// NextCursor resumes a cursor scan after this page; empty after the
+	// last page
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	// Reranked is how many of the top hits a reranker reordered
+	Reranked int `json:"reranked,omitempty"`
+
+	// Expansions are the terms of the query expanded with their synonyms
+	Expansions []Expansion `json:"expansions,omitempty"`
+
+	// Warning is set when the results come from the database because the
+	// search index cannot be opened
+	Warning string `json:"warning,omitempty"`
 }
 
 // Hit represents a single search result
 type Hit struct {
-	ID         string                 `json:"id"`
-	Score      float64                `json:"score,omitempty"`
-	Similarity float32                `json:"similarity,omitempty"` // Cosine similarity for vector search
-	Confidence string                 `json:"confidence,omitempty"` // "high", "medium", "low"
-	Fields     map[string]interface{} `json:"fields"`
-	Highlights map[string][]string    `json:"highlights,omitempty"`
-	Type       string                 `json:"type"` // study, experiment, sample, run
+	ID          string                 `json:"id"`
+	Score       float64                `json:"score,omitempty"`
+	Similarity  float32                `json:"similarity,omitempty"`   // Cosine similarity for vector search
+	RerankScore float32                `json:"rerank_score,omitempty"` // Relevance given by a reranker
+	Confidence  string                 `json:"confidence,omitempty"`   // "high", "medium", "low"
+	Fields      map[string]interface{} `json:"fields"`
+	Highlights  map[string][]string    `json:"highlights,omitempty"`
+	Type        string                 `json:"type"` // study, experiment, sample, run
 }
 
 // FacetValue represents a facet value and count
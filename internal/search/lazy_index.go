@@ -16,6 +16,7 @@ type LazyIndex struct {
 	lastAccess time.Time
 	idleTimer  *time.Timer
 	idleTime   time.Duration
+	shards     int // shards for a newly created index
 	mu         sync.RWMutex
 
 	// Stats
@@ -24,8 +25,9 @@ type LazyIndex struct {
 	searchCount int
 }
 
-// NewLazyIndex creates a new lazy-loading index wrapper
-func NewLazyIndex(path string, idleTime time.Duration) *LazyIndex {
+// NewLazyIndex creates a new lazy-loading index wrapper. shards sets how
+// many shards the index is created with if it does not exist yet.
+func NewLazyIndex(path string, idleTime time.Duration, shards int) *LazyIndex {
 	if idleTime == 0 {
 		idleTime = 5 * time.Minute // Default idle timeout
 	}
@@ -33,6 +35,7 @@ func NewLazyIndex(path string, idleTime time.Duration) *LazyIndex {
 	return &LazyIndex{
 		path:     path,
 		idleTime: idleTime,
+		shards:   shards,
 	}
 }
 
@@ -52,7 +55,7 @@ func (l *LazyIndex) ensureOpen() error {
 	log.Printf("[LAZY] Loading index from %s (load #%d)", l.path, l.loadCount+1)
 	start := time.Now()
 
-	index, err := InitBleveIndex(l.path)
+	index, err := InitBleveIndexWithShards(l.path, l.shards)
 	if err != nil {
 		return fmt.Errorf("failed to load index: %w", err)
 	}
@@ -141,6 +144,19 @@ func (l *LazyIndex) SearchWithFilters(queryStr string, filters map[string]string
 	return l.index.SearchWithFilters(queryStr, filters, limit)
 }
 
+// SearchPage returns one page of a cursor scan
+func (l *LazyIndex) SearchPage(queryStr string, filters map[string]string, size int, cursor string) (*bleve.SearchResult, string, error) {
+	if err := l.ensureOpen(); err != nil {
+		return nil, "", err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	l.searchCount++
+	return l.index.SearchPage(queryStr, filters, size, cursor)
+}
+
 // BatchIndex indexes multiple documents
 func (l *LazyIndex) BatchIndex(docs []interface{}) error {
 	if err := l.ensureOpen(); err != nil {
@@ -20,6 +20,10 @@ type Manager struct {
 
 	mu    sync.RWMutex
 	cache *SearchCache
+
+	// degraded is the error opening a corrupt index, in place of which
+	// text searches read the database
+	degraded error
 }
 
 // EmbedderInterface will be implemented in embeddings package
@@ -35,6 +39,10 @@ type SearchCache struct {
 	entries map[string]*cacheEntry
 	maxSize int
 	ttl     time.Duration
+
+	// generation is the database change generation the cached results
+	// were computed at
+	generation int64
 }
 
 type cacheEntry struct {
@@ -63,11 +71,17 @@ func NewManager(cfg *config.Config, db *database.DB) (*Manager, error) {
 		log.Printf("[INIT] Creating search backend")
 		backendStart := time.Now()
 		backend, err := CreateSearchBackend(cfg)
-		if err != nil {
+		if IsIndexCorrupt(err) {
+			// Stay available, searching the database until the index is
+			// rebuilt
+			log.Printf("[INIT] Warning: %v; searching the database instead", err)
+			m.degraded = err
+		} else if err != nil {
 			return nil, fmt.Errorf("failed to create search backend: %w", err)
+		} else {
+			m.bleve = backend
+			log.Printf("[INIT] Search backend created in %v", time.Since(backendStart))
 		}
-		m.bleve = backend
-		log.Printf("[INIT] Search backend created in %v", time.Since(backendStart))
 	}
 
 	return m, nil
@@ -77,6 +91,7 @@ func NewManager(cfg *config.Config, db *database.DB) (*Manager, error) {
 func (m *Manager) Search(query string, opts SearchOptions) (*SearchResult, error) {
 	// Check cache first
 	if m.cache != nil && !opts.NoCache {
+		m.dropStaleCache()
 		if cached := m.cache.get(m.cacheKey(query, opts)); cached != nil {
 			return cached, nil
 		}
@@ -84,6 +99,9 @@ func (m *Manager) Search(query string, opts SearchOptions) (*SearchResult, error
 
 	// Determine search mode
 	mode := m.determineSearchMode(opts)
+	if opts.Cursor != "" && mode != "text" {
+		return nil, fmt.Errorf("cursor pagination needs the full-text index (search mode %s)", mode)
+	}
 
 	var result *SearchResult
 	var err error
@@ -105,14 +123,58 @@ func (m *Manager) Search(query string, opts SearchOptions) (*SearchResult, error
 		return nil, err
 	}
 
-	// Cache the result
-	if m.cache != nil && !opts.NoCache {
+	// Cache the result, unless it stands in for an index that cannot be
+	// opened
+	if m.cache != nil && !opts.NoCache && result.Warning == "" {
 		m.cache.set(m.cacheKey(query, opts), result)
 	}
 
 	return result, nil
 }
 
+// SearchStream runs a search like Search, but calls header with the ranked
+// hits before their fields are read and then emit with each hit as it is
+// read, when the search is a text search on a backend that implements
+// Streamer. Other searches are run in full first, and streamed results are
+// not cached.
+func (m *Manager) SearchStream(query string, opts SearchOptions, header func(*SearchResult) error, emit func(Hit) error) error {
+	streamer, ok := m.bleve.(Streamer)
+	if !ok || !m.bleve.IsEnabled() || m.determineSearchMode(opts) != "text" {
+		result, err := m.Search(query, opts)
+		if err != nil {
+			return err
+		}
+		return emitResult(result, header, emit)
+	}
+	if m.cache != nil && !opts.NoCache {
+		m.dropStaleCache()
+		if cached := m.cache.get(m.cacheKey(query, opts)); cached != nil {
+			return emitResult(cached, header, emit)
+		}
+	}
+
+	// A lazily opened index may turn out to be corrupt only now, which is
+	// before any hit has been handed out
+	started := false
+	err := streamer.SearchStream(query, opts, func(result *SearchResult) error {
+		started = true
+		m.setDegraded(nil)
+		return header(result)
+	}, emit)
+	if IsIndexCorrupt(err) && !started {
+		m.setDegraded(err)
+		if opts.Cursor != "" {
+			return err
+		}
+		result, err := m.searchDegraded(query, opts)
+		if err != nil {
+			return err
+		}
+		return emitResult(result, header, emit)
+	}
+	return err
+}
+
 // determineSearchMode decides which search mode to use
 func (m *Manager) determineSearchMode(opts SearchOptions) string {
 	if !m.config.IsSearchEnabled() {
@@ -212,15 +274,64 @@ func (m *Manager) searchSQLite(query string, opts SearchOptions) (*SearchResult,
 // searchBleve performs a text search using Bleve
 func (m *Manager) searchBleve(query string, opts SearchOptions) (*SearchResult, error) {
 	if m.bleve == nil || !m.bleve.IsEnabled() {
-		return m.searchSQLite(query, opts)
+		if opts.Cursor != "" {
+			if err := m.Degraded(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("cursor pagination needs the full-text index")
+		}
+		return m.searchDegraded(query, opts)
 	}
 
-	return m.bleve.Search(query, opts)
+	// A lazily opened index may turn out to be corrupt only now
+	result, err := m.bleve.Search(query, opts)
+	if IsIndexCorrupt(err) {
+		m.setDegraded(err)
+		if opts.Cursor != "" {
+			return nil, err
+		}
+		return m.searchDegraded(query, opts)
+	}
+	if err == nil {
+		m.setDegraded(nil)
+	}
+	return result, err
+}
+
+// searchDegraded searches the database, warning in the result when it
+// stands in for an index that cannot be opened
+func (m *Manager) searchDegraded(query string, opts SearchOptions) (*SearchResult, error) {
+	result, err := m.searchSQLite(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	if degraded := m.Degraded(); degraded != nil {
+		result.Warning = "results are from the database: " + degraded.Error()
+	}
+	return result, nil
+}
+
+// Degraded returns the error opening a corrupt search index while text
+// searches fall back to the database, or nil when the index is readable
+func (m *Manager) Degraded() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.degraded
+}
+
+// setDegraded records whether the index could be opened
+func (m *Manager) setDegraded(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil && m.degraded == nil {
+		log.Printf("[SEARCH] Warning: %v; searching the database instead", err)
+	}
+	m.degraded = err
 }
 
 // searchWithVector performs a pure vector search
 func (m *Manager) searchWithVector(query string, opts SearchOptions) (*SearchResult, error) {
-	if m.embedder == nil || !m.embedder.IsEnabled() {
+	if m.embedder == nil || !m.embedder.IsEnabled() || m.bleve == nil {
 		return m.searchBleve(query, opts)
 	}
 
@@ -235,7 +346,7 @@ func (m *Manager) searchWithVector(query string, opts SearchOptions) (*SearchRes
 
 // searchHybrid performs a hybrid text + vector search
 func (m *Manager) searchHybrid(query string, opts SearchOptions) (*SearchResult, error) {
-	if m.embedder == nil || !m.embedder.IsEnabled() {
+	if m.embedder == nil || !m.embedder.IsEnabled() || m.bleve == nil {
 		return m.searchBleve(query, opts)
 	}
 
@@ -305,7 +416,7 @@ func (m *Manager) GetStats() (*IndexStats, error) {
 		DocumentCount:  0, // TODO: Query from SQLite
 		IndexSize:      0,
 		LastModified:   time.Now(),
-		IsHealthy:      true,
+		IsHealthy:      m.Degraded() == nil,
 		Backend:        "sqlite",
 		VectorsEnabled: false,
 	}, nil
@@ -319,6 +430,32 @@ func (m *Manager) Close() error {
 	return nil
 }
 
+// SetCacheTTL sets how long search results stay cached. Results cached
+// before are kept or dropped by the new TTL.
+func (m *Manager) SetCacheTTL(ttl time.Duration) {
+	if m.cache == nil {
+		return
+	}
+	m.cache.mu.Lock()
+	m.cache.ttl = ttl
+	m.cache.mu.Unlock()
+}
+
+// Warm opens the search index ahead of the first search when the backend
+// opens it lazily. An index found to be corrupt degrades searches to the
+// database, as when a search finds it.
+func (m *Manager) Warm() error {
+	warmer, ok := m.bleve.(Warmer)
+	if !ok {
+		return m.Degraded()
+	}
+	err := warmer.Warm()
+	if IsIndexCorrupt(err) {
+		m.setDegraded(err)
+	}
+	return err
+}
+
 // GetBackend returns the search backend
 func (m *Manager) GetBackend() SearchBackend {
 	return m.bleve
@@ -331,6 +468,19 @@ func (m *Manager) SetEmbedder(embedder EmbedderInterface) {
 	m.embedder = embedder
 }
 
+// dropStaleCache clears the cached results once the database has changed
+// since they were computed
+func (m *Manager) dropStaleCache() {
+	if m.sqlite == nil {
+		return
+	}
+	generation, err := m.sqlite.ChangeGeneration(context.Background())
+	if err != nil {
+		return
+	}
+	m.cache.invalidate(generation)
+}
+
 // cacheKey generates a cache key for a search query
 func (m *Manager) cacheKey(query string, opts SearchOptions) string {
 	return fmt.Sprintf("%s:%+v", query, opts)
@@ -384,3 +534,14 @@ func (c *SearchCache) clear() {
 	defer c.mu.Unlock()
 	c.entries = make(map[string]*cacheEntry)
 }
+
+// invalidate clears the cache if generation differs from the one its
+// entries were computed at
+func (c *SearchCache) invalidate(generation int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		c.entries = make(map[string]*cacheEntry)
+		c.generation = generation
+	}
+}
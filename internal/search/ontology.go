@@ -0,0 +1,225 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// maxExpansionWords is the most words of a query looked up as one term
+const maxExpansionWords = 5
+
+// maxSynonyms is the most synonyms a term of a query is expanded with
+const maxSynonyms = 10
+
+// Expansion is a term of a query and the synonyms it was expanded with
+type Expansion struct {
+	Term     string   `json:"term"`
+	Synonyms []string `json:"synonyms"`
+}
+
+// ExpandQuery expands the terms of a query that name a term of a
+// vocabulary loaded by 'srake ontology load' with its other labels, so
+// that "liver cancer" also matches "hepatocellular carcinoma". Runs of up
+// to five words and quoted phrases are looked up, longest first. Plain
+// queries get the synonyms added as phrases, which the query string search
+// scores like the words around them; queries in the query language get the
+// term replaced by a group matching it or any of its synonyms. Terms with
+// a field, a wildcard or a NOT are left as they are. It returns the query
+// unchanged when no term has synonyms.
+func ExpandQuery(db *database.DB, src string) (string, []Expansion, error) {
+	spans := expansionSpans(src)
+	var labels []string
+	for _, span := range spans {
+		labels = append(labels, span.candidates()...)
+	}
+	if len(labels) == 0 {
+		return src, nil, nil
+	}
+	synonyms, err := db.OntologySynonyms(labels)
+	if err != nil || len(synonyms) == 0 {
+		return src, nil, err
+	}
+	expanded, expansions := expandQuery(src, spans, synonyms)
+	return expanded, expansions, nil
+}
+
+// expansionSpan is a run of words, or a single phrase, of a query that
+// may be expanded. start and end are the rune offsets of each unit.
+type expansionSpan struct {
+	units      []string
+	start, end []int
+	phrase     bool
+}
+
+// candidates returns the labels a span is looked up by: every run of up to
+// maxExpansionWords of its words, or its phrase
+func (s expansionSpan) candidates() []string {
+	if s.phrase {
+		return []string{strings.Join(strings.Fields(s.units[0]), " ")}
+	}
+	var labels []string
+	for i := range s.units {
+		for n := 1; n <= maxExpansionWords && i+n <= len(s.units); n++ {
+			labels = append(labels, strings.Join(s.units[i:i+n], " "))
+		}
+	}
+	return labels
+}
+
+// expansionSpans returns the runs of words and the phrases of a query that
+// match any field and are not negated
+func expansionSpans(src string) []expansionSpan {
+	tokens, err := lexQuery(src)
+	if err != nil {
+		return nil // The search reports the error
+	}
+	runes := []rune(src)
+
+	var spans []expansionSpan
+	var current *expansionSpan
+	endSpan := func() {
+		if current != nil {
+			spans = append(spans, *current)
+			current = nil
+		}
+	}
+
+	// groups records, for each open parenthesis, whether it is the value
+	// of a field
+	var groups []bool
+	inField := func() bool {
+		for _, fielded := range groups {
+			if fielded {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		var prev queryToken
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		afterModifier := i > 0 && (prev.kind == qtField || prev.kind == qtNot || prev.kind == qtCompare)
+
+		switch {
+		case t.kind == qtPunct && (t.text == "[" || t.text == "{"):
+			// A range: skip to its end
+			endSpan()
+			for i+1 < len(tokens) && !(tokens[i].kind == qtPunct && (tokens[i].text == "]" || tokens[i].text == "}")) {
+				i++
+			}
+		case t.kind == qtPunct && t.text == "(":
+			endSpan()
+			groups = append(groups, afterModifier && prev.kind == qtField)
+		case t.kind == qtPunct && t.text == ")":
+			endSpan()
+			if len(groups) > 0 {
+				groups = groups[:len(groups)-1]
+			}
+		case t.kind == qtWord && !afterModifier && !inField() && !strings.ContainsAny(t.text, "*?"):
+			if current == nil || current.phrase {
+				endSpan()
+				current = &expansionSpan{}
+			}
+			current.units = append(current.units, t.text)
+			current.start = append(current.start, t.pos)
+			current.end = append(current.end, t.pos+len([]rune(t.text)))
+		case t.kind == qtPhrase && !afterModifier && !inField():
+			endSpan()
+			spans = append(spans, expansionSpan{
+				units:  []string{t.text},
+				start:  []int{t.pos},
+				end:    []int{phraseEnd(runes, t.pos)},
+				phrase: true,
+			})
+		default:
+			endSpan()
+		}
+	}
+	endSpan()
+	return spans
+}
+
+// phraseEnd returns the rune offset after the closing quote of the phrase
+// starting at pos
+func phraseEnd(runes []rune, pos int) int {
+	for i := pos + 1; i < len(runes); i++ {
+		if runes[i] == '\\' {
+			i++
+			continue
+		}
+		if runes[i] == '"' {
+			return i + 1
+		}
+	}
+	return len(runes)
+}
+
+// expandQuery expands the spans of a query whose words, longest runs
+// first, have synonyms, keyed in lower case
+func expandQuery(src string, spans []expansionSpan, synonyms map[string][]string) (string, []Expansion) {
+	type replacement struct {
+		start, end int
+		term       string
+		synonyms   []string
+	}
+	var replacements []replacement
+	for _, span := range spans {
+		if span.phrase {
+			term := span.candidates()[0]
+			if syns := synonyms[strings.ToLower(term)]; len(syns) > 0 {
+				replacements = append(replacements, replacement{span.start[0], span.end[0], term, syns})
+			}
+			continue
+		}
+		for i := 0; i < len(span.units); {
+			n := min(maxExpansionWords, len(span.units)-i)
+			for ; n > 0; n-- {
+				term := strings.Join(span.units[i:i+n], " ")
+				if syns := synonyms[strings.ToLower(term)]; len(syns) > 0 {
+					replacements = append(replacements, replacement{span.start[i], span.end[i+n-1], term, syns})
+					break
+				}
+			}
+			i += max(n, 1)
+		}
+	}
+	if len(replacements) == 0 {
+		return src, nil
+	}
+
+	plain := !usesQueryLanguage(src)
+	runes := []rune(src)
+	var expansions []Expansion
+	var added []string
+	// Replace from the end so that earlier offsets stay valid
+	for i := len(replacements) - 1; i >= 0; i-- {
+		r := replacements[i]
+		syns := r.synonyms[:min(len(r.synonyms), maxSynonyms)]
+		expansions = append([]Expansion{{Term: r.term, Synonyms: syns}}, expansions...)
+
+		quoted := make([]string, len(syns))
+		for j, syn := range syns {
+			quoted[j] = quotePhrase(syn)
+		}
+		if plain {
+			added = append(quoted, added...)
+			continue
+		}
+		group := "(" + string(runes[r.start:r.end]) + " OR " + strings.Join(quoted, " OR ") + ")"
+		runes = append(runes[:r.start], append([]rune(group), runes[r.end:]...)...)
+	}
+	if plain {
+		return src + " " + strings.Join(added, " "), expansions
+	}
+	return string(runes), expansions
+}
+
+// quotePhrase quotes text as a phrase of the query language
+func quotePhrase(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
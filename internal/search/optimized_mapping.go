@@ -56,6 +56,13 @@ func createOptimizedIndexMapping() mapping.IndexMapping {
 	docMapping.AddFieldMappingsAt("organism", createTextField(true, false))
 	docMapping.AddFieldMappingsAt("scientific_name", createTextField(false, false))
 
+	// === Local curation fields ===
+
+	docMapping.AddFieldMappingsAt("curated_title", createTextField(true, true))
+	docMapping.AddFieldMappingsAt("tags", createKeywordField(true, true))
+	docMapping.AddFieldMappingsAt("notes", createTextField(true, false))
+	docMapping.AddFieldMappingsAt(FieldQCFlags, createKeywordField(true, false))
+
 	// === Fields to SKIP (expensive or rarely searched) ===
 	// - spots (numeric, expensive)
 	// - bases (numeric, expensive)
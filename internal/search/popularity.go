@@ -0,0 +1,31 @@
+package search
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultPopularityBoost is the score a popularity boost adds per natural
+// log of a record's count, as a fraction of the score, when the
+// configuration does not say
+const DefaultPopularityBoost = 0.1
+
+// BoostPopular multiplies the score of each of the first n hits by 1 +
+// weight*ln(1+count), count being how often the hit's record was returned
+// or fetched, and reorders them by the boosted score, leaving the hits
+// after them in place. Hits boosted alike keep their order. A record
+// returned a thousand times thus ranks as if about 70% more relevant with
+// the default weight: popularity breaks near ties but does not bury a
+// clearly better match.
+func BoostPopular(hits []Hit, popularity map[string]int64, weight float64, n int) {
+	n = min(n, len(hits))
+	if weight <= 0 || len(popularity) == 0 {
+		return
+	}
+	for i := range hits[:n] {
+		if count := popularity[hits[i].ID]; count > 0 {
+			hits[i].Score *= 1 + weight*math.Log1p(float64(count))
+		}
+	}
+	sort.SliceStable(hits[:n], func(a, b int) bool { return hits[a].Score > hits[b].Score })
+}
@@ -0,0 +1,481 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The search query language, in the style of Lucene:
+//
+//	organism:"Homo sapiens" AND (strategy:RNA-Seq OR strategy:scRNA-Seq)
+//	liver NOT organism:mouse
+//	spots:>1000000 date:[2020-01-01 TO 2021-01-01]
+//	platform:(ILLUMINA OR "OXFORD_NANOPORE")
+//
+// Terms next to each other must all match, as if joined by AND. AND binds
+// tighter than OR; NOT applies to the term or group after it. Operators are
+// upper case, so that "rock and roll" is three words. A field applies to
+// the value after its colon, which may be a word, a "quoted phrase", a
+// parenthesized group, a comparison (>, >=, <, <=) or a range: [a TO b]
+// includes its bounds, {a TO b} excludes them, and * leaves a bound open.
+// Words may contain * and ? wildcards.
+
+// QueryError reports a search query that cannot be parsed.
+type QueryError struct {
+	Column  int // 1-based; 0 if the error is not tied to a position
+	Message string
+}
+
+// Error implements the error interface.
+func (e *QueryError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("invalid query: %s at column %d", e.Message, e.Column)
+	}
+	return "invalid query: " + e.Message
+}
+
+type queryTokenKind int
+
+const (
+	qtEOF queryTokenKind = iota
+	qtWord
+	qtPhrase
+	qtField // a word followed by a colon
+	qtAnd
+	qtOr
+	qtNot
+	qtCompare // >, >=, < or <=
+	qtPunct   // ( ) [ ] { }
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string // word, decoded phrase, field name or punctuation
+	pos  int    // rune offset in the query
+}
+
+// String describes the token in error messages.
+func (t queryToken) String() string {
+	switch t.kind {
+	case qtEOF:
+		return "end of query"
+	case qtPhrase:
+		return `"` + t.text + `"`
+	case qtField:
+		return fmt.Sprintf("%q", t.text+":")
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// queryNodeKind is the kind of a parsed query node
+type queryNodeKind int
+
+const (
+	nodeTerm   queryNodeKind = iota // a word, possibly with wildcards
+	nodePhrase                      // a quoted phrase
+	nodeRange                       // a comparison or range
+	nodeAnd
+	nodeOr
+	nodeNot
+)
+
+// queryNode is a node of a parsed query. Field is empty for terms and
+// phrases that match any field.
+type queryNode struct {
+	kind     queryNodeKind
+	field    string
+	value    string
+	children []*queryNode
+
+	// Range bounds; an empty bound is open
+	min, max                   string
+	minInclusive, maxInclusive bool
+}
+
+// String renders the node in a canonical form, for tests and debugging
+func (n *queryNode) String() string {
+	prefix := ""
+	if n.field != "" {
+		prefix = n.field + ":"
+	}
+	switch n.kind {
+	case nodeTerm:
+		return prefix + n.value
+	case nodePhrase:
+		return prefix + `"` + n.value + `"`
+	case nodeRange:
+		open, close := "{", "}"
+		if n.minInclusive {
+			open = "["
+		}
+		if n.maxInclusive {
+			close = "]"
+		}
+		min, max := n.min, n.max
+		if min == "" {
+			min = "*"
+		}
+		if max == "" {
+			max = "*"
+		}
+		return prefix + open + min + " TO " + max + close
+	case nodeNot:
+		return "NOT " + n.children[0].String()
+	}
+	op := " AND "
+	if n.kind == nodeOr {
+		op = " OR "
+	}
+	parts := make([]string, len(n.children))
+	for i, c := range n.children {
+		parts[i] = c.String()
+	}
+	return "(" + strings.Join(parts, op) + ")"
+}
+
+// isQueryPunct reports whether r ends a word
+func isQueryPunct(r rune) bool {
+	switch r {
+	case '(', ')', '[', ']', '{', '}', '"', ':':
+		return true
+	}
+	return unicode.IsSpace(r)
+}
+
+func lexQuery(src string) ([]queryToken, error) {
+	runes := []rune(src)
+	var tokens []queryToken
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, &QueryError{Column: start + 1, Message: "unterminated phrase"}
+			}
+			i++
+			tokens = append(tokens, queryToken{kind: qtPhrase, text: b.String(), pos: start})
+
+		case r == '(' || r == ')' || r == '[' || r == ']' || r == '{' || r == '}':
+			tokens = append(tokens, queryToken{kind: qtPunct, text: string(r), pos: i})
+			i++
+
+		case r == '>' || r == '<':
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			tokens = append(tokens, queryToken{kind: qtCompare, text: op, pos: i})
+			i += len(op)
+
+		case r == ':':
+			return nil, &QueryError{Column: i + 1, Message: "missing field name before ':'"}
+
+		case (r == '-' || r == '+') && i+1 < len(runes) &&
+			(!isQueryPunct(runes[i+1]) || runes[i+1] == '"' || runes[i+1] == '('):
+			// -term excludes a term, as NOT does; +term requires it, as
+			// every term is by default
+			if r == '-' {
+				tokens = append(tokens, queryToken{kind: qtNot, text: "-", pos: i})
+			}
+			i++
+
+		default:
+			start := i
+			for i < len(runes) && !isQueryPunct(runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+			kind := qtWord
+			switch {
+			case i < len(runes) && runes[i] == ':':
+				kind = qtField
+				i++
+			case word == "AND" || word == "&&":
+				kind = qtAnd
+			case word == "OR" || word == "||":
+				kind = qtOr
+			case word == "NOT":
+				kind = qtNot
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: word, pos: start})
+		}
+	}
+	return append(tokens, queryToken{kind: qtEOF, pos: len(runes)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// parseQuery parses a query written in the query language
+func parseQuery(src string) (*queryNode, error) {
+	tokens, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	if p.peek().kind == qtEOF {
+		return nil, p.errorf("empty query")
+	}
+	n, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != qtEOF {
+		return nil, p.errorf("unexpected %s", t)
+	}
+	return n, nil
+}
+
+// usesQueryLanguage reports whether a query uses fields, operators, groups
+// or ranges. Other queries are plain words and phrases, which the query
+// string search scores as before.
+func usesQueryLanguage(src string) bool {
+	tokens, err := lexQuery(src)
+	if err != nil {
+		return true // so that the error is reported
+	}
+	for _, t := range tokens {
+		switch t.kind {
+		case qtField, qtAnd, qtOr, qtPunct, qtCompare:
+			return true
+		case qtNot:
+			// The query string syntax has -term too
+			if t.text != "-" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.kind != qtEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return &QueryError{Column: p.peek().pos + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) expectPunct(punct string) error {
+	if t := p.peek(); t.kind != qtPunct || t.text != punct {
+		return p.errorf("expected %q, found %s", punct, t)
+	}
+	p.next()
+	return nil
+}
+
+// parseOr parses terms separated by OR. field is the field of an enclosing
+// field:(...) group, which applies to the terms without a field of their own.
+func (p *queryParser) parseOr(field string) (*queryNode, error) {
+	n, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+	children := []*queryNode{n}
+	for p.peek().kind == qtOr {
+		p.next()
+		n, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, n)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &queryNode{kind: nodeOr, children: children}, nil
+}
+
+// parseAnd parses terms separated by AND or nothing
+func (p *queryParser) parseAnd(field string) (*queryNode, error) {
+	n, err := p.parseNot(field)
+	if err != nil {
+		return nil, err
+	}
+	children := []*queryNode{n}
+	for {
+		t := p.peek()
+		if t.kind == qtAnd {
+			p.next()
+		} else if !startsTerm(t) {
+			break
+		}
+		n, err := p.parseNot(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, n)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &queryNode{kind: nodeAnd, children: children}, nil
+}
+
+// startsTerm reports whether t begins a term, which joins the terms before
+// it with an implicit AND
+func startsTerm(t queryToken) bool {
+	switch t.kind {
+	case qtWord, qtPhrase, qtField, qtNot, qtCompare:
+		return true
+	case qtPunct:
+		return t.text == "(" || t.text == "[" || t.text == "{"
+	}
+	return false
+}
+
+func (p *queryParser) parseNot(field string) (*queryNode, error) {
+	if p.peek().kind == qtNot {
+		p.next()
+		n, err := p.parseNot(field)
+		if err != nil {
+			return nil, err
+		}
+		return &queryNode{kind: nodeNot, children: []*queryNode{n}}, nil
+	}
+	return p.parseTerm(field)
+}
+
+func (p *queryParser) parseTerm(field string) (*queryNode, error) {
+	t := p.peek()
+	switch t.kind {
+	case qtField:
+		if field != "" {
+			return nil, p.errorf("field %s inside the group of field %s", t, field)
+		}
+		p.next()
+		return p.parseValue(t.text)
+
+	case qtWord:
+		p.next()
+		return &queryNode{kind: nodeTerm, field: field, value: t.text}, nil
+
+	case qtPhrase:
+		p.next()
+		return &queryNode{kind: nodePhrase, field: field, value: t.text}, nil
+
+	case qtPunct:
+		if t.text == "(" {
+			p.next()
+			n, err := p.parseOr(field)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		}
+	}
+
+	bound := t.kind == qtCompare || t.kind == qtPunct && (t.text == "[" || t.text == "{")
+	switch {
+	case bound && field != "":
+		// A comparison or range in a field group, as in spots:(>10 AND <20)
+		return p.parseValue(field)
+	case bound:
+		return nil, p.errorf("%s needs a field, as in spots:%s", t, t.text)
+	case t.kind == qtEOF:
+		return nil, p.errorf("expected a term, found %s", t)
+	}
+	return nil, p.errorf("unexpected %s", t)
+}
+
+// parseValue parses the value of a field: a term, phrase, group, comparison
+// or range
+func (p *queryParser) parseValue(field string) (*queryNode, error) {
+	t := p.peek()
+	switch {
+	case t.kind == qtCompare:
+		p.next()
+		bound := p.peek()
+		if bound.kind != qtWord && bound.kind != qtPhrase {
+			return nil, p.errorf("expected a value after %s, found %s", t.text, bound)
+		}
+		p.next()
+		n := &queryNode{kind: nodeRange, field: field}
+		switch t.text {
+		case ">", ">=":
+			n.min, n.minInclusive = bound.text, t.text == ">="
+		case "<", "<=":
+			n.max, n.maxInclusive = bound.text, t.text == "<="
+		}
+		return n, nil
+
+	case t.kind == qtPunct && (t.text == "[" || t.text == "{"):
+		return p.parseRange(field)
+
+	case t.kind == qtPunct && t.text == "(":
+		return p.parseTerm(field)
+
+	case t.kind == qtWord || t.kind == qtPhrase:
+		return p.parseTerm(field)
+	}
+	return nil, p.errorf("expected a value for field %s, found %s", field, t)
+}
+
+// parseRange parses [min TO max], with { or } for an exclusive bound
+func (p *queryParser) parseRange(field string) (*queryNode, error) {
+	open := p.next()
+	n := &queryNode{kind: nodeRange, field: field, minInclusive: open.text == "[", maxInclusive: true}
+
+	bound := func() (string, error) {
+		t := p.peek()
+		if t.kind != qtWord && t.kind != qtPhrase {
+			return "", p.errorf("expected a range bound, found %s", t)
+		}
+		p.next()
+		if t.kind == qtWord && t.text == "*" {
+			return "", nil
+		}
+		return t.text, nil
+	}
+
+	var err error
+	if n.min, err = bound(); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != qtWord || t.text != "TO" {
+		return nil, p.errorf("expected TO, found %s", t)
+	}
+	p.next()
+	if n.max, err = bound(); err != nil {
+		return nil, err
+	}
+
+	switch t := p.peek(); {
+	case t.kind == qtPunct && t.text == "]":
+	case t.kind == qtPunct && t.text == "}":
+		n.maxInclusive = false
+	default:
+		return nil, p.errorf("expected ] or }, found %s", t)
+	}
+	p.next()
+	if n.min == "" && n.max == "" {
+		return nil, &QueryError{Column: open.pos + 1, Message: "range has no bounds"}
+	}
+	return n, nil
+}
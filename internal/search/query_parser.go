@@ -2,12 +2,14 @@ package search
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/nishad/srake/internal/facets"
+	"github.com/nishad/srake/internal/taxonomy"
 )
 
 // QueryParser handles advanced query syntax parsing
@@ -34,225 +36,209 @@ func NewQueryParser() *QueryParser {
 			"layout":   "library_layout",
 			"source":   "library_source",
 			"select":   "library_selection",
+			"strategy": "library_strategy",
+			"date":     "submission_date",
 		},
 	}
 }
 
-// ParseAdvancedQuery parses an advanced query string into a Bleve query
+// ParseAdvancedQuery parses a query written in the query language (see
+// query_lang.go) into a Bleve query
 func (p *QueryParser) ParseAdvancedQuery(queryStr string) (query.Query, error) {
 	// Handle empty query
-	if queryStr == "" {
+	if strings.TrimSpace(queryStr) == "" {
 		return bleve.NewMatchAllQuery(), nil
 	}
 
-	// Check for field-specific queries (field:value)
-	if strings.Contains(queryStr, ":") {
-		return p.parseFieldQuery(queryStr)
+	n, err := parseQuery(queryStr)
+	if err != nil {
+		return nil, err
 	}
-
-	// Check for boolean operators
-	if containsBooleanOp(queryStr) {
-		return p.parseBooleanQuery(queryStr)
-	}
-
-	// Check for wildcards
-	if strings.Contains(queryStr, "*") || strings.Contains(queryStr, "?") {
-		return p.parseWildcardQuery(queryStr)
-	}
-
-	// Check for phrase queries (quoted strings)
-	if strings.Contains(queryStr, "\"") {
-		return p.parsePhraseQuery(queryStr)
-	}
-
-	// Default to simple query string
-	return bleve.NewQueryStringQuery(queryStr), nil
+	return p.buildQuery(n)
 }
 
-// parseFieldQuery parses field-specific queries like "organism:human"
-func (p *QueryParser) parseFieldQuery(queryStr string) (query.Query, error) {
-	// Regular expression to match field:value patterns
-	fieldPattern := regexp.MustCompile(`(\w+):("[^"]+"|[^\s]+)`)
-	matches := fieldPattern.FindAllStringSubmatch(queryStr, -1)
-
-	if len(matches) == 0 {
+// parseTextQuery builds the query for the text of a search. Queries of
+// plain words and phrases keep the query string syntax and its scoring;
+// those using fields, operators or ranges are parsed as the query language.
+func parseTextQuery(queryStr string) (query.Query, error) {
+	if !usesQueryLanguage(queryStr) {
 		return bleve.NewQueryStringQuery(queryStr), nil
 	}
+	return NewQueryParser().ParseAdvancedQuery(queryStr)
+}
 
-	queries := []query.Query{}
-
-	for _, match := range matches {
-		field := match[1]
-		value := strings.Trim(match[2], "\"")
+// buildQuery converts a parsed query to a Bleve query
+func (p *QueryParser) buildQuery(n *queryNode) (query.Query, error) {
+	field := n.field
+	if alias, ok := p.fieldAliases[field]; ok {
+		field = alias
+	}
 
-		// Resolve field alias
-		if alias, ok := p.fieldAliases[field]; ok {
-			field = alias
+	switch n.kind {
+	case nodeTerm:
+		if strings.ContainsAny(n.value, "*?") {
+			return wildcardQuery(field, n.value), nil
+		}
+		if field == "" {
+			return bleve.NewMatchQuery(n.value), nil
+		}
+		if isNumericField(field) && !isNumeric(n.value) {
+			return nil, &QueryError{Message: fmt.Sprintf("%s needs a number, not %q", n.field, n.value)}
 		}
+		return p.createFieldQuery(field, n.value), nil
 
-		// Check for range queries
-		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
-			rangeQuery, err := p.parseRangeQuery(field, value)
-			if err != nil {
-				return nil, err
-			}
-			queries = append(queries, rangeQuery)
-		} else {
-			// Create appropriate query based on field type
-			fieldQuery := p.createFieldQuery(field, value)
-			queries = append(queries, fieldQuery)
+	case nodePhrase:
+		if field == "" {
+			return bleve.NewMatchPhraseQuery(n.value), nil
 		}
-	}
+		return p.createFieldQuery(field, n.value), nil
 
-	// Handle remaining text not captured by field patterns
-	remaining := fieldPattern.ReplaceAllString(queryStr, "")
-	remaining = strings.TrimSpace(remaining)
-	if remaining != "" {
-		queries = append(queries, bleve.NewQueryStringQuery(remaining))
-	}
+	case nodeRange:
+		return rangeQuery(field, n)
 
-	// Combine queries
-	if len(queries) == 1 {
-		return queries[0], nil
-	}
-	return bleve.NewConjunctionQuery(queries...), nil
-}
+	case nodeNot:
+		q, err := p.buildQuery(n.children[0])
+		if err != nil {
+			return nil, err
+		}
+		boolQuery := bleve.NewBooleanQuery()
+		boolQuery.AddMust(bleve.NewMatchAllQuery())
+		boolQuery.AddMustNot(q)
+		return boolQuery, nil
 
-// parseBooleanQuery parses queries with AND, OR, NOT operators
-func (p *QueryParser) parseBooleanQuery(queryStr string) (query.Query, error) {
-	// Split by OR first (lower precedence)
-	orParts := splitByOperator(queryStr, " OR ")
-	if len(orParts) > 1 {
-		orQueries := []query.Query{}
-		for _, part := range orParts {
-			q, err := p.parseAndQuery(part)
+	case nodeOr:
+		queries := make([]query.Query, 0, len(n.children))
+		for _, c := range n.children {
+			q, err := p.buildQuery(c)
 			if err != nil {
 				return nil, err
 			}
-			orQueries = append(orQueries, q)
+			queries = append(queries, q)
 		}
-		return bleve.NewDisjunctionQuery(orQueries...), nil
+		return bleve.NewDisjunctionQuery(queries...), nil
 	}
 
-	// No OR, try AND
-	return p.parseAndQuery(queryStr)
-}
-
-// parseAndQuery handles AND and NOT operators
-func (p *QueryParser) parseAndQuery(queryStr string) (query.Query, error) {
-	// Split by AND
-	andParts := splitByOperator(queryStr, " AND ")
-
-	mustQueries := []query.Query{}
-	mustNotQueries := []query.Query{}
-
-	for _, part := range andParts {
-		part = strings.TrimSpace(part)
-
-		// Handle NOT operator
-		if strings.HasPrefix(part, "NOT ") {
-			notPart := strings.TrimPrefix(part, "NOT ")
-			q, err := p.ParseAdvancedQuery(notPart)
+	// AND: negated terms exclude matches of the others, or of all
+	// documents when every term is negated
+	var mustQueries, mustNotQueries []query.Query
+	for _, c := range n.children {
+		if c.kind == nodeNot {
+			q, err := p.buildQuery(c.children[0])
 			if err != nil {
 				return nil, err
 			}
 			mustNotQueries = append(mustNotQueries, q)
-		} else {
-			q, err := p.ParseAdvancedQuery(part)
-			if err != nil {
-				return nil, err
-			}
-			mustQueries = append(mustQueries, q)
-		}
-	}
-
-	// Build boolean query
-	if len(mustNotQueries) > 0 {
-		boolQuery := bleve.NewBooleanQuery()
-		for _, q := range mustQueries {
-			boolQuery.AddMust(q)
+			continue
 		}
-		for _, q := range mustNotQueries {
-			boolQuery.AddMustNot(q)
+		q, err := p.buildQuery(c)
+		if err != nil {
+			return nil, err
 		}
-		return boolQuery, nil
+		mustQueries = append(mustQueries, q)
 	}
-
-	if len(mustQueries) == 1 {
-		return mustQueries[0], nil
+	if len(mustNotQueries) == 0 {
+		return bleve.NewConjunctionQuery(mustQueries...), nil
 	}
-	return bleve.NewConjunctionQuery(mustQueries...), nil
+	if len(mustQueries) == 0 {
+		mustQueries = append(mustQueries, bleve.NewMatchAllQuery())
+	}
+	boolQuery := bleve.NewBooleanQuery()
+	boolQuery.AddMust(mustQueries...)
+	boolQuery.AddMustNot(mustNotQueries...)
+	return boolQuery, nil
 }
 
-// parseWildcardQuery handles wildcard patterns
-func (p *QueryParser) parseWildcardQuery(queryStr string) (query.Query, error) {
-	// Convert simple wildcards to regex
-	pattern := strings.ReplaceAll(queryStr, "*", ".*")
-	pattern = strings.ReplaceAll(pattern, "?", ".")
-
-	regexQuery := bleve.NewRegexpQuery(pattern)
-	return regexQuery, nil
+// wildcardQuery matches a pattern with * and ? wildcards. Text fields are
+// indexed in lower case, so their patterns are too.
+func wildcardQuery(field, pattern string) query.Query {
+	if !isKeywordField(field) {
+		pattern = strings.ToLower(pattern)
+	}
+	wildcard := bleve.NewWildcardQuery(pattern)
+	if field != "" {
+		wildcard.SetField(field)
+	}
+	return wildcard
 }
 
-// parsePhraseQuery handles quoted phrases
-func (p *QueryParser) parsePhraseQuery(queryStr string) (query.Query, error) {
-	// Extract quoted phrases
-	phrasePattern := regexp.MustCompile(`"([^"]+)"`)
-	matches := phrasePattern.FindAllStringSubmatch(queryStr, -1)
-
-	if len(matches) == 0 {
-		return bleve.NewQueryStringQuery(queryStr), nil
+// rangeQuery builds a numeric, date or term range query for a comparison
+// or range, depending on the field
+func rangeQuery(field string, n *queryNode) (query.Query, error) {
+	if field == "" {
+		return nil, &QueryError{Message: "a range needs a field"}
+	}
+	minInclusive, maxInclusive := n.minInclusive, n.maxInclusive
+
+	switch {
+	case isNumericField(field):
+		var min, max *float64
+		for _, b := range []struct {
+			value string
+			dst   **float64
+		}{{n.min, &min}, {n.max, &max}} {
+			if b.value == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(b.value, 64)
+			if err != nil {
+				return nil, &QueryError{Message: fmt.Sprintf("%s needs a number, not %q", n.field, b.value)}
+			}
+			*b.dst = &v
+		}
+		return numericRangeQuery(field, min, max, &minInclusive, &maxInclusive), nil
+
+	case isDateField(field):
+		var start, end time.Time
+		for _, b := range []struct {
+			value string
+			dst   *time.Time
+		}{{n.min, &start}, {n.max, &end}} {
+			if b.value == "" {
+				continue
+			}
+			t, err := parseQueryDate(b.value)
+			if err != nil {
+				return nil, &QueryError{Message: fmt.Sprintf("%s needs a date such as 2020-01-31, not %q", n.field, b.value)}
+			}
+			*b.dst = t
+		}
+		dateQuery := bleve.NewDateRangeInclusiveQuery(start, end, &minInclusive, &maxInclusive)
+		dateQuery.SetField(field)
+		return dateQuery, nil
 	}
 
-	queries := []query.Query{}
+	termQuery := bleve.NewTermRangeInclusiveQuery(n.min, n.max, &minInclusive, &maxInclusive)
+	termQuery.SetField(field)
+	return termQuery, nil
+}
 
-	for _, match := range matches {
-		phrase := match[1]
-		phraseQuery := bleve.NewMatchPhraseQuery(phrase)
-		queries = append(queries, phraseQuery)
+// numericRangeQuery matches a numeric field under each of the names it is
+// indexed as
+func numericRangeQuery(field string, min, max *float64, minInclusive, maxInclusive *bool) query.Query {
+	fields := numericFieldNames[field]
+	if len(fields) == 0 {
+		fields = []string{field}
 	}
-
-	// Handle remaining text
-	remaining := phrasePattern.ReplaceAllString(queryStr, "")
-	remaining = strings.TrimSpace(remaining)
-	if remaining != "" {
-		queries = append(queries, bleve.NewQueryStringQuery(remaining))
+	queries := make([]query.Query, len(fields))
+	for i, f := range fields {
+		numQuery := bleve.NewNumericRangeInclusiveQuery(min, max, minInclusive, maxInclusive)
+		numQuery.SetField(f)
+		queries[i] = numQuery
 	}
-
 	if len(queries) == 1 {
-		return queries[0], nil
+		return queries[0]
 	}
-	return bleve.NewConjunctionQuery(queries...), nil
+	return bleve.NewDisjunctionQuery(queries...)
 }
 
-// parseRangeQuery parses range queries like "[100 TO 1000]"
-func (p *QueryParser) parseRangeQuery(field, value string) (query.Query, error) {
-	// Remove brackets
-	value = strings.Trim(value, "[]")
-
-	// Split by TO
-	parts := strings.Split(value, " TO ")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid range syntax: %s", value)
-	}
-
-	min := strings.TrimSpace(parts[0])
-	max := strings.TrimSpace(parts[1])
-
-	// Check if numeric
-	if isNumeric(min) && isNumeric(max) {
-		minVal, _ := strconv.ParseFloat(min, 64)
-		maxVal, _ := strconv.ParseFloat(max, 64)
-
-		rangeQuery := bleve.NewNumericRangeQuery(&minVal, &maxVal)
-		rangeQuery.SetField(field)
-		return rangeQuery, nil
+// parseQueryDate parses a date, a month or a year, or an RFC 3339 time
+func parseQueryDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
 	}
-
-	// For non-numeric, use term range
-	rangeQuery := bleve.NewTermRangeQuery(min, max)
-	rangeQuery.SetField(field)
-	return rangeQuery, nil
+	return time.Time{}, fmt.Errorf("invalid date: %s", s)
 }
 
 // createFieldQuery creates appropriate query type based on field
@@ -260,9 +246,8 @@ func (p *QueryParser) createFieldQuery(field, value string) query.Query {
 	// Numeric fields
 	if isNumericField(field) {
 		if num, err := strconv.ParseFloat(value, 64); err == nil {
-			numQuery := bleve.NewNumericRangeQuery(&num, &num)
-			numQuery.SetField(field)
-			return numQuery
+			inclusive := true
+			return numericRangeQuery(field, &num, &num, &inclusive, &inclusive)
 		}
 	}
 
@@ -273,56 +258,29 @@ func (p *QueryParser) createFieldQuery(field, value string) query.Query {
 		return termQuery
 	}
 
-	// Text fields (analyzed)
-	matchQuery := bleve.NewMatchQuery(value)
-	matchQuery.SetField(field)
-	return matchQuery
+	// Text fields (analyzed), matching the words of the value in order, so
+	// that strategy:RNA-Seq does not match any text with "seq" in it
+	phraseQuery := bleve.NewMatchPhraseQuery(value)
+	phraseQuery.SetField(field)
+	return phraseQuery
 }
 
 // Helper functions
-func containsBooleanOp(s string) bool {
-	return strings.Contains(s, " AND ") ||
-		strings.Contains(s, " OR ") ||
-		strings.Contains(s, "NOT ")
-}
-
-func splitByOperator(s, op string) []string {
-	// Split while respecting quoted strings
-	var parts []string
-	var current strings.Builder
-	inQuotes := false
-
-	words := strings.Split(s, " ")
-	for i, word := range words {
-		if strings.Count(word, "\"")%2 == 1 {
-			inQuotes = !inQuotes
-		}
-
-		if !inQuotes && i > 0 && word == strings.TrimSpace(op) {
-			parts = append(parts, current.String())
-			current.Reset()
-		} else {
-			if current.Len() > 0 {
-				current.WriteString(" ")
-			}
-			current.WriteString(word)
-		}
-	}
-
-	if current.Len() > 0 {
-		parts = append(parts, current.String())
-	}
-
-	return parts
-}
-
 func isNumeric(s string) bool {
 	_, err := strconv.ParseFloat(s, 64)
 	return err == nil
 }
 
+// numericFieldNames lists the index fields of numeric fields indexed under
+// more than one name: the index builder writes total_spots and total_bases
+// where incremental sync writes spots and bases
+var numericFieldNames = map[string][]string{
+	"spots": {"spots", "total_spots"},
+	"bases": {"bases", "total_bases"},
+}
+
 func isNumericField(field string) bool {
-	numericFields := []string{"spots", "bases", "size", "count"}
+	numericFields := []string{"spots", "bases", "total_spots", "total_bases", "size", "count"}
 	for _, nf := range numericFields {
 		if field == nf {
 			return true
@@ -334,7 +292,9 @@ func isNumericField(field string) bool {
 func isKeywordField(field string) bool {
 	keywordFields := []string{
 		"platform", "instrument_model", "study_type",
-		"library_layout", "accession", "*_accession",
+		"library_layout", "library_source", "library_selection",
+		"type", "tags", "accession", "*_accession", FieldQCFlags,
+		facets.FieldName, taxonomy.FieldTaxonID, taxonomy.FieldLineage,
 	}
 	for _, kf := range keywordFields {
 		if field == kf || strings.HasSuffix(field, "_accession") {
@@ -344,6 +304,10 @@ func isKeywordField(field string) bool {
 	return false
 }
 
+func isDateField(field string) bool {
+	return field == "submission_date"
+}
+
 // ParseFilters converts filter flags to field queries
 func (p *QueryParser) ParseFilters(filters map[string]string) []query.Query {
 	queries := []query.Query{}
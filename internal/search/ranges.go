@@ -0,0 +1,68 @@
+package search
+
+import (
+	"slices"
+
+	"github.com/nishad/srake/internal/config"
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/facets"
+)
+
+// MergeAttributeRanges adds the numeric attribute ranges of samples, such as
+// "age:40-50 years", to their index documents so searches can facet and
+// filter on them. Ranges come from search.attribute_ranges in the config.
+// Documents are expected to be maps carrying the sample accession under "id".
+func MergeAttributeRanges(db *database.DB, cfg *config.Config, docs []interface{}) error {
+	if cfg == nil || len(cfg.Search.AttributeRanges) == 0 {
+		return nil
+	}
+	ranges, err := facets.FromConfig(cfg.Search.AttributeRanges)
+	if err != nil {
+		return err
+	}
+
+	accessions := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if m, ok := doc.(map[string]interface{}); ok {
+			if id, ok := m["id"].(string); ok {
+				accessions = append(accessions, id)
+			}
+		}
+	}
+	tags := make([]string, len(ranges))
+	for i, r := range ranges {
+		tags[i] = r.Attribute
+	}
+
+	attributes, err := db.GetSampleAttributes(accessions, tags)
+	if err != nil {
+		return err
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	for _, doc := range docs {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := m["id"].(string)
+		var terms []string
+		for _, a := range attributes[id] {
+			for _, r := range ranges {
+				if r.Attribute != a.Tag {
+					continue
+				}
+				if label, ok := r.Bucket(a.Value, a.Units); ok && !slices.Contains(terms, r.Term(label)) {
+					terms = append(terms, r.Term(label))
+				}
+			}
+		}
+		if len(terms) > 0 {
+			m[facets.FieldName] = terms
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultRerankCandidates is how many of the top results a reranker
+// reorders when the configuration does not say
+const DefaultRerankCandidates = 50
+
+// RerankerInterface scores how relevant documents are to a query, such as
+// a cross-encoder reading the query and each document together. Higher
+// scores are more relevant.
+type RerankerInterface interface {
+	Score(query string, docs []string) ([]float32, error)
+	IsEnabled() bool
+}
+
+// HitText returns the text of a hit a reranker reads: its title, then its
+// abstract or description
+func HitText(fields map[string]interface{}) string {
+	var parts []string
+	for _, keys := range [][]string{
+		{"title", "study_title"},
+		{"description", "study_abstract", "abstract"},
+	} {
+		for _, key := range keys {
+			if v, ok := fields[key].(string); ok && strings.TrimSpace(v) != "" {
+				parts = append(parts, strings.TrimSpace(v))
+				break
+			}
+		}
+	}
+	if len(parts) == 0 {
+		if organism, ok := fields["organism"].(string); ok {
+			return organism
+		}
+	}
+	return strings.Join(parts, ". ")
+}
+
+// rerankOrder scores the texts with a reranker and returns their indexes,
+// most relevant first, and the score of each text. Texts the reranker
+// scores alike keep their order.
+func rerankOrder(r RerankerInterface, query string, texts []string) ([]int, []float32, error) {
+	if r == nil || !r.IsEnabled() {
+		return nil, nil, fmt.Errorf("no reranking model is available")
+	}
+	scores, err := r.Score(query, texts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to rerank results: %w", err)
+	}
+	if len(scores) != len(texts) {
+		return nil, nil, fmt.Errorf("reranker returned %d scores for %d results", len(scores), len(texts))
+	}
+	order := make([]int, len(texts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	return order, scores, nil
+}
+
+// RerankHits reorders the first n hits by their reranker score, which it
+// sets as each hit's RerankScore, leaving the hits after them in place.
+// It returns how many hits were reranked.
+func RerankHits(r RerankerInterface, query string, hits []Hit, n int) (int, error) {
+	n = min(n, len(hits))
+	if n <= 1 {
+		return n, nil
+	}
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = HitText(hits[i].Fields)
+	}
+	order, scores, err := rerankOrder(r, query, texts)
+	if err != nil {
+		return 0, err
+	}
+
+	reranked := make([]Hit, n)
+	for i, index := range order {
+		reranked[i] = hits[index]
+		reranked[i].RerankScore = scores[index]
+	}
+	copy(hits, reranked)
+	return n, nil
+}
+
+// RerankBleve reorders the first n hits of a Bleve result by their
+// reranker score, leaving the hits after them in place. It returns how
+// many hits were reranked.
+func RerankBleve(r RerankerInterface, query string, result *BleveSearchResult, n int) (int, error) {
+	if result == nil {
+		return 0, nil
+	}
+	n = min(n, len(result.Hits))
+	if n <= 1 {
+		return n, nil
+	}
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = HitText(result.Hits[i].Fields)
+	}
+	order, _, err := rerankOrder(r, query, texts)
+	if err != nil {
+		return 0, err
+	}
+
+	reranked := make([]*BleveMatch, n)
+	for i, index := range order {
+		reranked[i] = result.Hits[index]
+	}
+	copy(result.Hits, reranked)
+	return n, nil
+}
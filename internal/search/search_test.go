@@ -1,9 +1,13 @@
 package search
 
 import (
+	"context"
 	"database/sql"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -75,7 +79,7 @@ func TestSearchManager(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to open SQLite: %v", err)
 	}
-	db := &database.DB{DB: sqlDB}
+	db := database.Wrap(sqlDB)
 	defer db.Close()
 
 	// Create search manager
@@ -226,6 +230,265 @@ func TestBatchIndexing(t *testing.T) {
 	}
 }
 
+// TestShardedIndex tests routing documents to shards and merging results on read
+func TestShardedIndex(t *testing.T) {
+	indexPath := t.TempDir() + "/sharded.bleve"
+	index, err := InitBleveIndexWithShards(indexPath, 4)
+	if err != nil {
+		t.Fatalf("Failed to initialize sharded index: %v", err)
+	}
+
+	if index.ShardCount() != 4 {
+		t.Fatalf("Expected 4 shards, got %d", index.ShardCount())
+	}
+
+	var docs []interface{}
+	for i := 1; i <= 40; i++ {
+		docs = append(docs, SampleDoc{
+			SampleAccession: fmt.Sprintf("SRS%06d", i),
+			Organism:        "Homo sapiens",
+			Tissue:          "liver",
+		})
+	}
+	if err := index.BatchIndex(docs); err != nil {
+		t.Fatalf("Batch indexing failed: %v", err)
+	}
+
+	counts, err := index.ShardDocCounts()
+	if err != nil {
+		t.Fatalf("Failed to get shard counts: %v", err)
+	}
+	used := 0
+	for shard, count := range counts {
+		if count > 0 {
+			used++
+		}
+		// Every document sits in the shard its ID routes to
+		for _, doc := range docs {
+			id := doc.(SampleDoc).SampleAccession
+			if ShardFor(id, 4) != shard {
+				continue
+			}
+			if d, err := index.shards[shard].Document(id); err != nil || d == nil {
+				t.Errorf("Document %s not found in shard %d", id, shard)
+			}
+		}
+	}
+	if used < 2 {
+		t.Errorf("Expected documents spread over several shards, got %v", counts)
+	}
+
+	results, err := index.Search("liver", 100)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if results.Total != 40 || len(results.Hits) != 40 {
+		t.Errorf("Expected 40 merged hits, got total=%d hits=%d", results.Total, len(results.Hits))
+	}
+
+	if err := index.Delete("SRS000007"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := index.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Reopening detects the layout, whatever shard count is requested
+	reopened, err := InitBleveIndex(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen sharded index: %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.ShardCount() != 4 {
+		t.Errorf("Expected reopened index to have 4 shards, got %d", reopened.ShardCount())
+	}
+	count, err := reopened.GetDocCount()
+	if err != nil {
+		t.Fatalf("Failed to get document count: %v", err)
+	}
+	if count != 39 {
+		t.Errorf("Expected 39 documents after deletion, got %d", count)
+	}
+
+	sizes, err := ShardSizes(indexPath)
+	if err != nil || len(sizes) != 4 {
+		t.Errorf("Expected 4 shard sizes, got %v (err %v)", sizes, err)
+	}
+}
+
+// TestCreateSearchBackendSharded tests that a sharded index is opened through
+// the shard-aware backend whatever the build tags
+func TestCreateSearchBackendSharded(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DataDirectory = t.TempDir()
+	cfg.Database.Path = cfg.DataDirectory + "/metadata.db"
+	cfg.Search.Enabled = true
+	cfg.Search.Backend = "bleve"
+	cfg.Search.IndexPath = cfg.DataDirectory + "/sharded.bleve"
+	cfg.Search.Shards = 4
+
+	backend, err := CreateSearchBackend(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create search backend: %v", err)
+	}
+	defer backend.Close()
+
+	wrapper, ok := backend.(*bleveIndexWrapper)
+	if !ok {
+		t.Fatalf("Expected the shard-aware backend, got %T", backend)
+	}
+	if wrapper.index.ShardCount() != 4 {
+		t.Errorf("Expected 4 shards, got %d", wrapper.index.ShardCount())
+	}
+	if layout, err := ReadShardLayout(cfg.Search.IndexPath); err != nil || layout == nil {
+		t.Errorf("Expected a shard layout, got %v (%v)", layout, err)
+	}
+}
+
+// TestCorruptIndex tests detecting and setting aside unreadable indexes
+func TestCorruptIndex(t *testing.T) {
+	indexPath := t.TempDir() + "/sharded.bleve"
+	index, err := InitBleveIndexWithShards(indexPath, 4)
+	if err != nil {
+		t.Fatalf("Failed to initialize sharded index: %v", err)
+	}
+	var docs []interface{}
+	for i := 1; i <= 40; i++ {
+		docs = append(docs, SampleDoc{SampleAccession: fmt.Sprintf("SRS%06d", i), Tissue: "liver"})
+	}
+	if err := index.BatchIndex(docs); err != nil {
+		t.Fatalf("Batch indexing failed: %v", err)
+	}
+	index.Close()
+
+	// An intact index has nothing to rebuild
+	repair, err := SetAsideCorrupt(indexPath)
+	if err != nil || len(repair.Rebuild) != 0 || repair.SetAside != "" {
+		t.Fatalf("Expected nothing to rebuild, got %+v (err %v)", repair, err)
+	}
+
+	// Damage one shard, as an unclean shutdown might
+	if err := os.WriteFile(ShardPath(indexPath, 1)+"/index_meta.json", []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitBleveIndex(indexPath); !IsIndexCorrupt(err) {
+		t.Fatalf("Expected a corrupt index error, got %v", err)
+	}
+
+	repair, err = SetAsideCorrupt(indexPath)
+	if err != nil {
+		t.Fatalf("SetAsideCorrupt failed: %v", err)
+	}
+	if repair.Shards != 4 || len(repair.Rebuild) != 1 || repair.Rebuild[0] != 1 {
+		t.Fatalf("Expected shard 1 to rebuild, got %+v", repair)
+	}
+	if _, err := os.Stat(repair.SetAside + "/shard-001"); err != nil {
+		t.Errorf("Expected the damaged shard kept in %s: %v", repair.SetAside, err)
+	}
+
+	// The other shards keep their documents
+	reopened, err := InitBleveIndex(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen index: %v", err)
+	}
+	want := 0
+	for _, doc := range docs {
+		if ShardFor(doc.(SampleDoc).SampleAccession, 4) != 1 {
+			want++
+		}
+	}
+	if count, _ := reopened.GetDocCount(); int(count) != want {
+		t.Errorf("Expected %d documents in the intact shards, got %d", want, count)
+	}
+	reopened.Close()
+
+	// An unreadable unsharded index is set aside whole
+	plainPath := t.TempDir() + "/plain.bleve"
+	plain, err := InitBleveIndex(plainPath)
+	if err != nil {
+		t.Fatalf("Failed to initialize index: %v", err)
+	}
+	plain.Close()
+	if err := os.WriteFile(plainPath+"/index_meta.json", []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repair, err = SetAsideCorrupt(plainPath)
+	if err != nil || repair.Shards != 1 || len(repair.Rebuild) != 1 {
+		t.Fatalf("Expected the whole index to rebuild, got %+v (err %v)", repair, err)
+	}
+	if _, err := os.Stat(plainPath); !os.IsNotExist(err) {
+		t.Errorf("Expected %s moved aside", plainPath)
+	}
+}
+
+// TestCursorPagination tests paging and streaming hits with cursors
+func TestCursorPagination(t *testing.T) {
+	indexPath := t.TempDir() + "/cursor.bleve"
+	index, err := InitBleveIndexWithShards(indexPath, 2)
+	if err != nil {
+		t.Fatalf("Failed to initialize index: %v", err)
+	}
+	defer index.Close()
+
+	var docs []interface{}
+	for i := 1; i <= 25; i++ {
+		docs = append(docs, SampleDoc{
+			SampleAccession: fmt.Sprintf("SRS%06d", i),
+			Organism:        "Homo sapiens",
+			Tissue:          "liver",
+		})
+	}
+	if err := index.BatchIndex(docs); err != nil {
+		t.Fatalf("Batch indexing failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	cursor := StartCursor
+	pages := 0
+	for cursor != "" {
+		page, next, err := index.SearchPage("liver", nil, 10, cursor)
+		if err != nil {
+			t.Fatalf("SearchPage failed: %v", err)
+		}
+		for _, hit := range page.Hits {
+			if seen[hit.ID] {
+				t.Errorf("Hit %s returned twice", hit.ID)
+			}
+			seen[hit.ID] = true
+		}
+		cursor = next
+		pages++
+	}
+	if len(seen) != 25 || pages != 3 {
+		t.Errorf("Expected 25 hits in 3 pages, got %d in %d", len(seen), pages)
+	}
+
+	if _, _, err := index.SearchPage("liver", nil, 10, "not a cursor!"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+
+	var streamed []string
+	err = index.StreamSearch("liver", nil, []string{"SRS000003", "SRS000001", "SRS000002"}, 0, func(hit *BleveMatch) error {
+		streamed = append(streamed, hit.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamSearch failed: %v", err)
+	}
+	if strings.Join(streamed, ",") != "SRS000001,SRS000002,SRS000003" {
+		t.Errorf("Expected collection members in ID order, got %v", streamed)
+	}
+
+	count := 0
+	if err := index.StreamSearch("", nil, nil, 7, func(*BleveMatch) error { count++; return nil }); err != nil {
+		t.Fatalf("StreamSearch failed: %v", err)
+	}
+	if count != 7 {
+		t.Errorf("Expected 7 hits with a limit, got %d", count)
+	}
+}
+
 // TestSearchWithFilters tests filtered search functionality
 func TestSearchWithFilters(t *testing.T) {
 	// Create temporary config
@@ -312,6 +575,155 @@ func TestSearchWithFilters(t *testing.T) {
 	}
 }
 
+// TestParseQuery tests parsing of the search query language
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`organism:"mus musculus" AND strategy:RNA-Seq`, `(organism:"mus musculus" AND strategy:RNA-Seq)`},
+		{`liver brain OR kidney`, `((liver AND brain) OR kidney)`},
+		{`liver AND (brain OR kidney)`, `(liver AND (brain OR kidney))`},
+		{`NOT organism:mouse`, `NOT organism:mouse`},
+		{`liver -organism:mouse`, `(liver AND NOT organism:mouse)`},
+		{`spots:>1000000`, `spots:{1000000 TO *}`},
+		{`spots:<=10`, `spots:{* TO 10]`},
+		{`date:[2020-01-01 TO 2021-01-01}`, `date:[2020-01-01 TO 2021-01-01}`},
+		{`bases:[* TO 5e9]`, `bases:[* TO 5e9]`},
+		{`platform:(ILLUMINA OR "ION_TORRENT")`, `(platform:ILLUMINA OR platform:"ION_TORRENT")`},
+		{`title:canc*`, `title:canc*`},
+	}
+	for _, tt := range tests {
+		n, err := parseQuery(tt.query)
+		if err != nil {
+			t.Errorf("parseQuery(%q) failed: %v", tt.query, err)
+			continue
+		}
+		if got := n.String(); got != tt.want {
+			t.Errorf("parseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	errs := []struct {
+		query string
+		want  string
+	}{
+		{`organism:"mus musculus`, "unterminated phrase at column 10"},
+		{`(liver OR brain`, `expected ")"`},
+		{`liver AND`, "expected a term, found end of query"},
+		{`>5`, "needs a field"},
+		{`spots:[1 5]`, "expected TO"},
+		{`date:[* TO *]`, "range has no bounds"},
+		{`organism:(strategy:WGS)`, "inside the group"},
+		{`:liver`, "missing field name"},
+	}
+	for _, tt := range errs {
+		_, err := parseQuery(tt.query)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseQuery(%q) error = %v, want %q", tt.query, err, tt.want)
+		}
+	}
+
+	// Plain words and phrases keep the query string syntax
+	for query, want := range map[string]bool{
+		`human liver "single cell"`: false,
+		`liver -mouse`:              false,
+		`rock and roll`:             false,
+		`organism:human`:            true,
+		`liver OR brain`:            true,
+		`(liver)`:                   true,
+	} {
+		if got := usesQueryLanguage(query); got != want {
+			t.Errorf("usesQueryLanguage(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestExpandQuery(t *testing.T) {
+	synonyms := map[string][]string{
+		"liver cancer": {"hepatocellular carcinoma", "HCC"},
+		"liver":        {"hepar"},
+		"mouse":        {"Mus musculus"},
+		"single cell":  {"single-cell"},
+	}
+	tests := []struct {
+		query string
+		want  string
+		terms []string
+	}{
+		// Plain queries get the synonyms added, longest runs first
+		{`human liver cancer`, `human liver cancer "hepatocellular carcinoma" "HCC"`, []string{"liver cancer"}},
+		{`Liver "single cell"`, `Liver "single cell" "hepar" "single-cell"`, []string{"Liver", "single cell"}},
+		{`liver -mouse`, `liver -mouse "hepar"`, []string{"liver"}},
+		// The query language gets groups
+		{`liver cancer AND organism:mouse`, `(liver cancer OR "hepatocellular carcinoma" OR "HCC") AND organism:mouse`, []string{"liver cancer"}},
+		{`NOT mouse OR liv*`, `NOT mouse OR liv*`, nil},
+		{`title:(liver) spots:[1 TO 5] (mouse)`, `title:(liver) spots:[1 TO 5] ((mouse OR "Mus musculus"))`, []string{"mouse"}},
+		{`kidney`, `kidney`, nil},
+	}
+	for _, tt := range tests {
+		got, expansions := expandQuery(tt.query, expansionSpans(tt.query), synonyms)
+		if got != tt.want {
+			t.Errorf("expandQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+		var terms []string
+		for _, e := range expansions {
+			terms = append(terms, e.Term)
+		}
+		if strings.Join(terms, ",") != strings.Join(tt.terms, ",") {
+			t.Errorf("expandQuery(%q) expanded %v, want %v", tt.query, terms, tt.terms)
+		}
+		if _, err := parseQuery(got); err != nil {
+			t.Errorf("expanded query %s does not parse: %v", got, err)
+		}
+	}
+}
+
+// TestQueryLanguageSearch tests searching the index with the query language
+func TestQueryLanguageSearch(t *testing.T) {
+	index, err := InitBleveIndex(t.TempDir() + "/query.bleve")
+	if err != nil {
+		t.Fatalf("Failed to initialize Bleve index: %v", err)
+	}
+	defer index.Close()
+
+	docs := []interface{}{
+		ExperimentDoc{Type: "experiment", ExperimentAccession: "SRX000001", Title: "Mouse RNA-Seq", LibraryStrategy: "RNA-Seq", Platform: "ILLUMINA"},
+		ExperimentDoc{Type: "experiment", ExperimentAccession: "SRX000002", Title: "Human ChIP-Seq", LibraryStrategy: "ChIP-Seq", Platform: "ILLUMINA"},
+		ExperimentDoc{Type: "experiment", ExperimentAccession: "SRX000003", Title: "Mouse ChIP-Seq", LibraryStrategy: "ChIP-Seq", Platform: "PACBIO"},
+	}
+	if err := index.BatchIndex(docs); err != nil {
+		t.Fatalf("Failed to index documents: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  uint64
+	}{
+		{`strategy:ChIP-Seq AND NOT platform:PACBIO`, 1},
+		{`title:mouse AND platform:(ILLUMINA OR PACBIO)`, 2},
+		{`strategy:ChIP-Seq -title:human`, 1},
+		{`title:mouse OR title:human`, 3},
+		{`title:mou*`, 2},
+	}
+	for _, tt := range tests {
+		result, err := index.Search(tt.query, 10)
+		if err != nil {
+			t.Errorf("Search(%q) failed: %v", tt.query, err)
+			continue
+		}
+		if result.Total != tt.want {
+			t.Errorf("Search(%q) found %d, want %d", tt.query, result.Total, tt.want)
+		}
+	}
+
+	var queryErr *QueryError
+	if _, err := index.Search(`title:(mouse`, 10); !errors.As(err, &queryErr) {
+		t.Errorf("Expected a QueryError for an unclosed group, got %v", err)
+	}
+}
+
 // BenchmarkIndexing benchmarks indexing performance
 func BenchmarkIndexing(b *testing.B) {
 	cfg := config.DefaultConfig()
@@ -413,6 +825,194 @@ func TestVectorSearch(t *testing.T) {
 	t.Log("✅ Basic search test completed successfully!")
 }
 
+// TestVectorIndex tests k-NN search over study embeddings and its persistence
+func TestVectorIndex(t *testing.T) {
+	for _, quantized := range []bool{false, true} {
+		t.Run(fmt.Sprintf("quantized=%v", quantized), func(t *testing.T) {
+			index := NewVectorIndex(0, quantized)
+			vectors := map[string][]float32{
+				"SRP000001": {1, 0, 0},
+				"SRP000002": {0.9, 0.1, 0},
+				"SRP000003": {0, 0, 1},
+			}
+			for id, v := range vectors {
+				if err := index.Add(id, v); err != nil {
+					t.Fatalf("Failed to add %s: %v", id, err)
+				}
+			}
+			if err := index.Add("SRP000004", []float32{1, 0}); err == nil {
+				t.Error("Expected an error for a vector of the wrong dimension")
+			}
+
+			path := VectorIndexPath(t.TempDir())
+			if err := index.Save(path); err != nil {
+				t.Fatalf("Failed to save index: %v", err)
+			}
+			loaded, err := OpenVectorIndex(path)
+			if err != nil {
+				t.Fatalf("Failed to open index: %v", err)
+			}
+			if loaded.Len() != 3 || loaded.Dims() != 3 || loaded.Quantized() != quantized {
+				t.Fatalf("Loaded index has %d vectors of %d dimensions, quantized=%v",
+					loaded.Len(), loaded.Dims(), loaded.Quantized())
+			}
+
+			hits, err := loaded.Search([]float32{2, 0, 0}, 2, nil)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if len(hits) != 2 || hits[0].ID != "SRP000001" || hits[1].ID != "SRP000002" {
+				t.Fatalf("Unexpected neighbours: %+v", hits)
+			}
+			if hits[0].Similarity < 0.99 {
+				t.Errorf("Expected similarity near 1, got %f", hits[0].Similarity)
+			}
+
+			// Documents rejected by keep are skipped
+			hits, _ = loaded.Search([]float32{1, 0, 0}, 1, func(id string) bool { return id != "SRP000001" })
+			if len(hits) != 1 || hits[0].ID != "SRP000002" {
+				t.Errorf("Expected SRP000002 when SRP000001 is excluded, got %+v", hits)
+			}
+
+			if !loaded.Remove("SRP000001") || loaded.Remove("SRP000001") {
+				t.Error("Expected SRP000001 to be removed exactly once")
+			}
+			if v, ok := loaded.Vector("SRP000003"); !ok || v[2] < 0.99 {
+				t.Errorf("Expected SRP000003 to survive the removal, got %v", v)
+			}
+
+			// A truncated file, or a header claiming more vectors than the
+			// file holds, is an error rather than an allocation of its size
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			huge := append([]byte{}, data...)
+			binary.LittleEndian.PutUint64(huge[len(vectorIndexMagic)+5:], 1<<60)
+			for name, corrupt := range map[string][]byte{"truncated": data[:len(data)-1], "huge count": huge} {
+				if err := os.WriteFile(path, corrupt, 0644); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := OpenVectorIndex(path); err == nil {
+					t.Errorf("Expected an error opening a %s index", name)
+				}
+			}
+		})
+	}
+}
+
+// TestFuseHits tests hybrid rank fusion of text and vector results
+func TestFuseHits(t *testing.T) {
+	text := []Hit{{ID: "SRP000001", Score: 10}, {ID: "SRP000002", Score: 5}}
+	vector := []Hit{{ID: "SRP000002", Similarity: 0.9}, {ID: "SRP000003", Similarity: 0.8}}
+
+	// A study found by both searches outranks those found by one
+	for _, method := range []string{FusionWeighted, FusionRRF} {
+		hits := FuseHits(text, vector, method, 0.5)
+		if len(hits) != 3 || hits[0].ID != "SRP000002" {
+			t.Errorf("%s: expected SRP000002 first of 3 hits, got %+v", method, hits)
+		}
+		if hits[0].Similarity != 0.9 {
+			t.Errorf("%s: expected the vector similarity to be kept, got %f", method, hits[0].Similarity)
+		}
+	}
+
+	// The weight moves the ranking between text only and vector only
+	if hits := FuseHits(text, vector, FusionWeighted, 0); hits[0].ID != "SRP000001" {
+		t.Errorf("Expected the best text hit first with weight 0, got %s", hits[0].ID)
+	}
+	hits := FuseHits(text, vector, FusionWeighted, 1)
+	if hits[0].ID != "SRP000002" || hits[1].ID != "SRP000003" {
+		t.Errorf("Expected vector order with weight 1, got %+v", hits)
+	}
+
+	result := hybridResult("cancer", hits, SearchOptions{Offset: 1}, 1)
+	if result.TotalHits != 3 || len(result.Hits) != 1 || result.Hits[0].ID != "SRP000003" {
+		t.Errorf("Unexpected page of fused hits: %+v", result)
+	}
+
+	if err := ValidFusion("borda"); err == nil {
+		t.Error("Expected an error for an unknown fusion method")
+	}
+}
+
+// termReranker scores a text by how often it mentions the query
+type termReranker struct{}
+
+func (termReranker) Score(query string, docs []string) ([]float32, error) {
+	scores := make([]float32, len(docs))
+	for i, doc := range docs {
+		scores[i] = float32(strings.Count(strings.ToLower(doc), query))
+	}
+	return scores, nil
+}
+
+func (termReranker) IsEnabled() bool { return true }
+
+func TestRerankHits(t *testing.T) {
+	hits := []Hit{
+		{ID: "SRP000001", Fields: map[string]interface{}{"title": "Liver atlas"}},
+		{ID: "SRP000002", Fields: map[string]interface{}{"title": "Heart atlas", "description": "Heart development"}},
+		{ID: "SRP000003", Fields: map[string]interface{}{"study_title": "Heart"}},
+		{ID: "SRP000004", Fields: map[string]interface{}{"title": "Heart, heart, heart"}},
+	}
+	if text := HitText(hits[1].Fields); text != "Heart atlas. Heart development" {
+		t.Errorf("Unexpected hit text: %q", text)
+	}
+
+	// Only the first three are reordered, ties keeping their order
+	n, err := RerankHits(termReranker{}, "heart", hits, 3)
+	if err != nil || n != 3 {
+		t.Fatalf("RerankHits returned %d, %v", n, err)
+	}
+	var ids []string
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	if strings.Join(ids, ",") != "SRP000002,SRP000003,SRP000001,SRP000004" {
+		t.Errorf("Unexpected order: %v", ids)
+	}
+	if hits[0].RerankScore != 2 || hits[3].RerankScore != 0 {
+		t.Errorf("Unexpected rerank scores: %+v", hits)
+	}
+
+	result := &BleveSearchResult{Hits: []*BleveMatch{
+		{ID: "SRP000001", Fields: map[string]interface{}{"title": "Liver atlas"}},
+		{ID: "SRP000004", Fields: map[string]interface{}{"title": "Heart, heart, heart"}},
+	}}
+	if _, err := RerankBleve(termReranker{}, "heart", result, 50); err != nil || result.Hits[0].ID != "SRP000004" {
+		t.Errorf("Expected SRP000004 first, got %s, %v", result.Hits[0].ID, err)
+	}
+
+	if _, err := RerankHits(nil, "heart", hits, 3); err == nil {
+		t.Error("Expected an error without a reranker")
+	}
+}
+
+func TestBoostPopular(t *testing.T) {
+	hits := []Hit{
+		{ID: "SRP000001", Score: 1.0},
+		{ID: "SRP000002", Score: 0.9},
+		{ID: "SRP000003", Score: 0.5},
+		{ID: "SRP000004", Score: 0.1},
+	}
+	popularity := map[string]int64{"SRP000002": 100, "SRP000003": 1000, "SRP000004": 1000000}
+
+	// Only the first three are reordered; a popular near tie overtakes,
+	// a clearly weaker match does not
+	BoostPopular(hits, popularity, DefaultPopularityBoost, 3)
+	var ids []string
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	if strings.Join(ids, ",") != "SRP000002,SRP000001,SRP000003,SRP000004" {
+		t.Errorf("Unexpected order: %v", ids)
+	}
+	if hits[1].Score != 1.0 || hits[3].Score != 0.1 {
+		t.Errorf("Expected unboosted scores to be kept: %+v", hits)
+	}
+}
+
 // BenchmarkSearch benchmarks search performance
 func BenchmarkSearch(b *testing.B) {
 	cfg := config.DefaultConfig()
@@ -444,3 +1044,191 @@ func BenchmarkSearch(b *testing.B) {
 		}
 	}
 }
+
+// TestCompareFacets tests side-by-side facet differences between two queries
+func TestCompareFacets(t *testing.T) {
+	a := []FacetValue{{Value: "Homo sapiens", Count: 60}, {Value: "Mus musculus", Count: 20}}
+	b := []FacetValue{{Value: "Mus musculus", Count: 150}, {Value: "Danio rerio", Count: 10}}
+
+	comparison := CompareFacets("organism", 100, 200, a, b)
+	if comparison.Field != "organism" || len(comparison.Deltas) != 3 {
+		t.Fatalf("unexpected comparison: %+v", comparison)
+	}
+
+	first, second := comparison.Deltas[0], comparison.Deltas[1]
+	if first.Value != "Homo sapiens" || first.CountB != 0 || first.PercentA != 60 || first.Difference != 60 {
+		t.Errorf("unexpected largest difference: %+v", first)
+	}
+	if second.Value != "Mus musculus" || second.PercentA != 20 || second.PercentB != 75 || second.Difference != -55 {
+		t.Errorf("unexpected second difference: %+v", second)
+	}
+	if last := comparison.Deltas[2]; last.Value != "Danio rerio" || last.PercentB != 5 {
+		t.Errorf("unexpected smallest difference: %+v", last)
+	}
+
+	empty := CompareFacets("platform", 0, 0, nil, nil)
+	if len(empty.Deltas) != 0 {
+		t.Errorf("expected no deltas, got %+v", empty.Deltas)
+	}
+}
+
+// TestFacetValueCounts tests counting facet values outside the top terms
+func TestFacetValueCounts(t *testing.T) {
+	index, err := InitBleveIndex(t.TempDir() + "/facets.bleve")
+	if err != nil {
+		t.Fatalf("Failed to initialize Bleve index: %v", err)
+	}
+	defer index.Close()
+
+	platforms := []string{"ILLUMINA", "ILLUMINA", "ILLUMINA", "OXFORD_NANOPORE", "PACBIO_SMRT"}
+	for i, platform := range platforms {
+		if err := index.IndexExperiment(ExperimentDoc{
+			Type:                "experiment",
+			ExperimentAccession: fmt.Sprintf("SRX%06d", i+1),
+			Title:               "Liver RNA-Seq",
+			Platform:            platform,
+		}); err != nil {
+			t.Fatalf("Failed to index experiment: %v", err)
+		}
+	}
+
+	result, err := index.FacetCounts("liver", []string{"platform"}, 1)
+	if err != nil {
+		t.Fatalf("FacetCounts failed: %v", err)
+	}
+	if terms := result.Facets["platform"].Terms.Terms(); len(terms) != 1 || terms[0].Term != "ILLUMINA" {
+		t.Fatalf("Expected only ILLUMINA in the top terms, got %+v", terms)
+	}
+
+	counts, err := index.FacetValueCounts("liver", "platform", []string{"OXFORD_NANOPORE", "PACBIO_SMRT", "ION_TORRENT"})
+	if err != nil {
+		t.Fatalf("FacetValueCounts failed: %v", err)
+	}
+	if counts["OXFORD_NANOPORE"] != 1 || counts["PACBIO_SMRT"] != 1 || counts["ION_TORRENT"] != 0 {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+
+	counts, err = index.FacetValueCounts("", "platform", []string{"ILLUMINA"})
+	if err != nil {
+		t.Fatalf("FacetValueCounts failed: %v", err)
+	}
+	if counts["ILLUMINA"] != 3 {
+		t.Errorf("Expected 3 ILLUMINA experiments for the empty query, got %v", counts)
+	}
+}
+
+// TestSearchFTS tests the FTS5 search of samples and runs
+func TestSearchFTS(t *testing.T) {
+	db, err := database.Initialize(t.TempDir() + "/fts.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	db.InsertSample(&database.Sample{SampleAccession: "SRS000001", Organism: "Homo sapiens", Tissue: "liver", Description: "liver biopsy"})
+	db.InsertSample(&database.Sample{SampleAccession: "SRS000002", Organism: "Mus musculus", Tissue: "liver"})
+	db.InsertExperiment(&database.Experiment{ExperimentAccession: "SRX000001", Title: "Liver RNA-Seq", Platform: "ILLUMINA"})
+	db.InsertRun(&database.Run{RunAccession: "SRR000001", ExperimentAccession: "SRX000001"})
+
+	if _, err := SearchFTS(db, "liver", SearchOptions{}); err == nil {
+		t.Fatal("Expected an error before the FTS5 tables are built")
+	}
+	if err := database.NewFTS5Manager(db).CreateFTSTables(); err != nil {
+		t.Skipf("FTS5 not available: %v", err)
+	}
+
+	result, err := SearchFTS(db, "liver", SearchOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchFTS failed: %v", err)
+	}
+	if result.TotalHits != 3 || len(result.Hits) != 2 {
+		t.Errorf("Expected 2 of 3 hits, got %d of %d", len(result.Hits), result.TotalHits)
+	}
+	for _, hit := range result.Hits {
+		if len(hit.Highlights) == 0 {
+			t.Errorf("Expected highlights for %s", hit.ID)
+		}
+	}
+
+	result, err = SearchFTS(db, "liver", SearchOptions{Limit: 5, Filters: map[string]interface{}{"organism": "homo sapiens"}})
+	if err != nil {
+		t.Fatalf("SearchFTS failed: %v", err)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].ID != "SRS000001" {
+		t.Errorf("Expected only SRS000001 with the organism filter, got %+v", result.Hits)
+	}
+}
+
+// countingEmbedder embeds a text as its length, counting the texts embedded
+type countingEmbedder struct {
+	texts []string
+}
+
+func (e *countingEmbedder) Embed(text string) ([]float32, error) {
+	e.texts = append(e.texts, text)
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func (e *countingEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = e.Embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *countingEmbedder) IsEnabled() bool { return true }
+
+func TestUpdateStudyEmbeddings(t *testing.T) {
+	db, err := database.Initialize(t.TempDir() + "/embed.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	for _, study := range []*database.Study{
+		{StudyAccession: "SRP000001", StudyTitle: "Liver RNA-Seq", StudyAbstract: "Human liver"},
+		{StudyAccession: "SRP000002", StudyTitle: "Mouse brain"},
+		{StudyAccession: "SRP000003"},
+	} {
+		if err := db.InsertStudy(study); err != nil {
+			t.Fatalf("InsertStudy failed: %v", err)
+		}
+	}
+
+	// The first update embeds every study with text
+	embedder := &countingEmbedder{}
+	update, err := UpdateStudyEmbeddings(context.Background(), db, embedder, "test-model", 1, nil)
+	if err != nil {
+		t.Fatalf("UpdateStudyEmbeddings failed: %v", err)
+	}
+	if update.Studies != 3 || update.Embedded != 2 || update.Unchanged != 0 {
+		t.Errorf("Unexpected first update: %+v", update)
+	}
+
+	// The next only embeds the study whose text changed
+	db.InsertStudy(&database.Study{StudyAccession: "SRP000002", StudyTitle: "Mouse brain", StudyType: "Transcriptome Analysis"})
+	embedder.texts = nil
+	if update, err = UpdateStudyEmbeddings(context.Background(), db, embedder, "test-model", 10, nil); err != nil {
+		t.Fatalf("UpdateStudyEmbeddings failed: %v", err)
+	}
+	if update.Embedded != 1 || update.Unchanged != 1 || len(embedder.texts) != 1 || embedder.texts[0] != "Mouse brain Transcriptome Analysis" {
+		t.Errorf("Expected only SRP000002 to be embedded again, got %+v of %q", update, embedder.texts)
+	}
+
+	// Embeddings of removed studies are dropped
+	if _, err := db.Exec(`DELETE FROM studies WHERE study_accession = 'SRP000001'`); err != nil {
+		t.Fatal(err)
+	}
+	if update, err = UpdateStudyEmbeddings(context.Background(), db, embedder, "test-model", 10, nil); err != nil || update.Removed != 1 {
+		t.Errorf("Expected 1 embedding removed, got %+v (%v)", update, err)
+	}
+
+	vectors, err := LoadStudyVectors(db, "test-model", false)
+	if err != nil || vectors.Len() != 1 || vectors.Dims() != 2 {
+		t.Fatalf("Unexpected study vectors (%v)", err)
+	}
+	if _, ok := vectors.Vector("SRP000002"); !ok {
+		t.Error("Expected the vector of SRP000002")
+	}
+}
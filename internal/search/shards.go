@@ -0,0 +1,274 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// ShardLayoutFile records the shard layout in the root of a sharded index.
+// An index directory without it is a single unsharded Bleve index.
+const ShardLayoutFile = "srake_shards.json"
+
+// ShardLayout describes how documents are routed to shard indexes.
+type ShardLayout struct {
+	Shards int    `json:"shards"`
+	Hash   string `json:"hash"` // routing hash of the document ID
+}
+
+// ShardFor returns the shard a document ID is routed to. Routing depends only
+// on the ID, so a record always lands in the same shard across rebuilds and
+// updates.
+func ShardFor(id string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// ShardPath returns the directory of one shard of a sharded index.
+func ShardPath(indexPath string, shard int) string {
+	return filepath.Join(indexPath, fmt.Sprintf("shard-%03d", shard))
+}
+
+// ReadShardLayout returns the layout of a sharded index, or nil if the index
+// is unsharded or does not exist yet.
+func ReadShardLayout(indexPath string) (*ShardLayout, error) {
+	data, err := os.ReadFile(filepath.Join(indexPath, ShardLayoutFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shard layout: %w", err)
+	}
+
+	var layout ShardLayout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, fmt.Errorf("failed to parse shard layout: %w", err)
+	}
+	if layout.Shards < 1 {
+		return nil, fmt.Errorf("invalid shard layout: %d shards", layout.Shards)
+	}
+	return &layout, nil
+}
+
+// ShardSizes returns the on-disk size of each shard of a sharded index, or
+// nil if the index is unsharded.
+func ShardSizes(indexPath string) ([]int64, error) {
+	layout, err := ReadShardLayout(indexPath)
+	if err != nil || layout == nil {
+		return nil, err
+	}
+
+	sizes := make([]int64, layout.Shards)
+	for i := range sizes {
+		sizes[i] = getDirectorySize(ShardPath(indexPath, i))
+	}
+	return sizes, nil
+}
+
+// openShards opens the shards of a sharded index, creating the index with
+// the given number of shards if it does not exist.
+func openShards(indexPath string, shards int) ([]bleve.Index, error) {
+	layout, err := ReadShardLayout(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if layout == nil {
+		if err := os.MkdirAll(indexPath, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create index directory: %w", err)
+		}
+		layout = &ShardLayout{Shards: shards, Hash: "fnv1a"}
+		data, err := json.MarshalIndent(layout, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(indexPath, ShardLayoutFile), data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write shard layout: %w", err)
+		}
+		log.Printf("[INIT] Creating index with %d shards", shards)
+	} else if shards > 1 && shards != layout.Shards {
+		log.Printf("[INIT] Index has %d shards; rebuild it to use %d", layout.Shards, shards)
+	}
+
+	indexes := make([]bleve.Index, 0, layout.Shards)
+	for i := 0; i < layout.Shards; i++ {
+		path := ShardPath(indexPath, i)
+		index, err := bleve.Open(path)
+		if err == bleve.ErrorIndexPathDoesNotExist {
+			index, err = bleve.New(path, createBiologicalIndexMapping())
+		} else if err != nil {
+			err = openError(path, err)
+		}
+		if err != nil {
+			for _, opened := range indexes {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("failed to open shard %d: %w", i, err)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// runPerShard runs fn for each shard in parallel and returns the first error.
+func runPerShard(shards int, fn func(shard int) error) error {
+	errs := make([]error, shards)
+	var wg sync.WaitGroup
+	for i := 0; i < shards; i++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			errs[shard] = fn(shard)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// MisroutedDoc is a document stored in a shard other than the one its ID
+// routes to, typically left behind by an interrupted rebuild.
+type MisroutedDoc struct {
+	ID    string `json:"id"`
+	Shard int    `json:"shard"` // shard holding the document
+	Home  int    `json:"home"`  // shard the ID routes to
+	// Duplicate is set when the home shard also holds the document, so
+	// the same record appears twice in search results
+	Duplicate bool `json:"duplicate"`
+}
+
+// CheckShards scans a sharded index for misrouted and duplicated documents.
+// It returns nil for an unsharded index.
+func CheckShards(indexPath string) ([]MisroutedDoc, error) {
+	layout, err := ReadShardLayout(indexPath)
+	if err != nil || layout == nil {
+		return nil, err
+	}
+
+	indexes := make([]bleve.Index, 0, layout.Shards)
+	defer func() {
+		for _, index := range indexes {
+			index.Close()
+		}
+	}()
+	for i := 0; i < layout.Shards; i++ {
+		index, err := bleve.Open(ShardPath(indexPath, i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open shard %d: %w", i, err)
+		}
+		indexes = append(indexes, index)
+	}
+
+	var misrouted []MisroutedDoc
+	for shard, index := range indexes {
+		err := eachDocID(index, func(id string) error {
+			home := ShardFor(id, layout.Shards)
+			if home == shard {
+				return nil
+			}
+			doc, err := indexes[home].Document(id)
+			if err != nil {
+				return err
+			}
+			misrouted = append(misrouted, MisroutedDoc{ID: id, Shard: shard, Home: home, Duplicate: doc != nil})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("shard %d: %w", shard, err)
+		}
+	}
+	return misrouted, nil
+}
+
+// RemoveMisrouted deletes misrouted documents from the shards holding them.
+// Documents missing from their home shard are moved there first, so that no
+// record drops out of the index.
+func RemoveMisrouted(indexPath string, docs []MisroutedDoc) error {
+	layout, err := ReadShardLayout(indexPath)
+	if err != nil || layout == nil || len(docs) == 0 {
+		return err
+	}
+
+	indexes, err := openShards(indexPath, layout.Shards)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, index := range indexes {
+			index.Close()
+		}
+	}()
+
+	for _, d := range docs {
+		if d.Shard >= len(indexes) || d.Home >= len(indexes) {
+			continue
+		}
+		if !d.Duplicate {
+			// Stored fields are all the index keeps, so reindex from those
+			fields, err := storedFields(indexes[d.Shard], d.ID)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", d.ID, err)
+			}
+			if err := indexes[d.Home].Index(d.ID, fields); err != nil {
+				return fmt.Errorf("failed to move %s: %w", d.ID, err)
+			}
+		}
+		if err := indexes[d.Shard].Delete(d.ID); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", d.ID, err)
+		}
+	}
+	return nil
+}
+
+// eachDocID calls fn with the ID of every document in an index, in ID order.
+func eachDocID(index bleve.Index, fn func(id string) error) error {
+	const pageSize = 1000
+	var after []string
+	for {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), pageSize, 0, false)
+		req.SortBy([]string{"_id"})
+		req.SearchAfter = after
+		result, err := index.Search(req)
+		if err != nil {
+			return err
+		}
+		for _, hit := range result.Hits {
+			if err := fn(hit.ID); err != nil {
+				return err
+			}
+		}
+		if len(result.Hits) < pageSize {
+			return nil
+		}
+		after = []string{result.Hits[len(result.Hits)-1].ID}
+	}
+}
+
+// storedFields returns the stored fields of a document.
+func storedFields(index bleve.Index, id string) (map[string]interface{}, error) {
+	req := bleve.NewSearchRequest(bleve.NewDocIDQuery([]string{id}))
+	req.Fields = []string{"*"}
+	result, err := index.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Hits) == 0 {
+		return nil, fmt.Errorf("document not found")
+	}
+	return result.Hits[0].Fields, nil
+}
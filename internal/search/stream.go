@@ -0,0 +1,59 @@
+package search
+
+import (
+	"github.com/blevesearch/bleve/v2"
+)
+
+// streamFieldsBatch is how many hits a streamed search reads the stored
+// fields of at a time, after reading those of the first hit on its own
+const streamFieldsBatch = 50
+
+// emitHits reads the stored fields of ranked hits a batch at a time and
+// calls emit with each hit in rank order once its batch is read. The first
+// batch holds only the first hit, so that it is not held back by the rest.
+func emitHits(index bleve.Index, hits []Hit, emit func(Hit) error) error {
+	for start, size := 0, 1; start < len(hits); start, size = start+size, streamFieldsBatch {
+		batch := hits[start:min(start+size, len(hits))]
+		ids := make([]string, len(batch))
+		for i, hit := range batch {
+			ids[i] = hit.ID
+		}
+
+		req := bleve.NewSearchRequest(bleve.NewDocIDQuery(ids))
+		req.Size = len(ids)
+		req.Fields = []string{"*"}
+		result, err := index.Search(req)
+		if err != nil {
+			return err
+		}
+		fields := make(map[string]map[string]interface{}, len(result.Hits))
+		for _, match := range result.Hits {
+			fields[match.ID] = match.Fields
+		}
+
+		for _, hit := range batch {
+			hit.Fields = fields[hit.ID]
+			if typeField, ok := hit.Fields["type"].(string); ok {
+				hit.Type = typeField
+			}
+			if err := emit(hit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// emitResult hands out a search result built in full as a streamed search
+// would, for searches whose hits cannot be read one batch at a time
+func emitResult(result *SearchResult, header func(*SearchResult) error, emit func(Hit) error) error {
+	if err := header(result); err != nil {
+		return err
+	}
+	for _, hit := range result.Hits {
+		if err := emit(hit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
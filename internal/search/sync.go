@@ -3,13 +3,16 @@ package search
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
 	"github.com/nishad/srake/internal/embeddings"
+	"github.com/nishad/srake/internal/filelock"
 )
 
 // Syncer handles synchronization between SQLite and Bleve index
@@ -20,6 +23,19 @@ type Syncer struct {
 	embedder *embeddings.Embedder
 	stopChan chan struct{}
 	running  bool
+
+	// OnProgress, when set, is called after each batch with the number of
+	// documents indexed since the sync started
+	OnProgress func(indexed int64)
+	indexed    int64
+
+	// IndexLocked is set when the caller already holds the index lock,
+	// which FullSync then does not take again: a process cannot take the
+	// same lock twice
+	IndexLocked bool
+
+	// keep, when set, selects the documents indexed by ID
+	keep func(id string) bool
 }
 
 // NewSyncer creates a new index syncer
@@ -102,18 +118,53 @@ func (s *Syncer) backgroundSync(ctx context.Context) {
 		case <-s.stopChan:
 			return
 		case <-ticker.C:
+			// Leave the index to a CLI build or ingest holding it
+			lock, err := s.lockIndex(ctx)
+			var locked *filelock.LockedError
+			if errors.As(err, &locked) {
+				log.Printf("Skipping sync: %v", err)
+				continue
+			}
+			if err != nil {
+				log.Printf("Sync error: %v", err)
+				continue
+			}
 			if err := s.IncrementalSync(ctx); err != nil {
 				log.Printf("Sync error: %v", err)
 			}
+			lock.Release()
 		}
 	}
 }
 
+// lockIndex takes the write lock on the index, failing when another
+// process holds it. It returns a nil lock when the caller holds it.
+func (s *Syncer) lockIndex(ctx context.Context) (*filelock.Lock, error) {
+	if s.IndexLocked {
+		return nil, nil
+	}
+	return filelock.Acquire(ctx, s.config.Search.IndexPath, filelock.Options{Command: "srake server sync"})
+}
+
 // FullSync performs a complete rebuild of the search index from SQLite
 func (s *Syncer) FullSync(ctx context.Context) error {
 	log.Println("Starting full index sync...")
 
+	lock, err := s.lockIndex(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	// Changes made while the index is rebuilt are applied again by the
+	// next incremental sync
+	generation, err := s.db.ChangeGeneration(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read change generation: %w", err)
+	}
+
 	// Rebuild the index
+	s.indexed = 0
 	if err := s.backend.Rebuild(ctx); err != nil {
 		return fmt.Errorf("failed to rebuild index: %w", err)
 	}
@@ -138,43 +189,70 @@ func (s *Syncer) FullSync(ctx context.Context) error {
 		return fmt.Errorf("failed to index runs: %w", err)
 	}
 
+	if err := s.markSynced(ctx, generation); err != nil {
+		return err
+	}
+
 	log.Println("Full index sync completed")
 	return nil
 }
 
-// IncrementalSync performs incremental synchronization of changes
-func (s *Syncer) IncrementalSync(ctx context.Context) error {
-	// TODO: Implement change tracking
-	// For now, we'll do a simple check for new records
-	// In production, use timestamps or a change log table
-
-	// Get last sync time (stored in index metadata or config)
-	// For now, just sync recent records
-	since := time.Now().Add(-time.Duration(s.config.Search.SyncInterval) * time.Second * 2)
+// SyncShards indexes again the records routed to the given shards of an
+// index split into n, such as those SetAsideCorrupt found missing, leaving
+// the documents of the other shards as they are
+func (s *Syncer) SyncShards(ctx context.Context, n int, shards []int) error {
+	lock, err := s.lockIndex(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
 
-	// Index recent studies
-	if err := s.indexStudiesSince(ctx, since); err != nil {
-		return fmt.Errorf("failed to sync studies: %w", err)
+	rebuild := make(map[int]bool, len(shards))
+	for _, shard := range shards {
+		rebuild[shard] = true
+	}
+	s.keep = func(id string) bool {
+		return rebuild[ShardFor(id, n)]
 	}
+	defer func() { s.keep = nil }()
 
-	return nil
+	s.indexed = 0
+	for _, src := range []docSource{studyDocs, experimentDocs, sampleDocs, runDocs} {
+		if err := s.indexAll(ctx, src); err != nil {
+			return fmt.Errorf("failed to index %s: %w", src.table, err)
+		}
+	}
+	return s.backend.Flush()
 }
 
-// IndexStudies indexes all studies from the database
-func (s *Syncer) IndexStudies(ctx context.Context) error {
-	query := `
-		SELECT study_accession, study_title, study_abstract, study_type,
-		       organism, submission_date
-		FROM studies
-		LIMIT ? OFFSET ?
-	`
+// reportIndexed counts n more documents indexed and reports the total
+func (s *Syncer) reportIndexed(n int) {
+	s.indexed += int64(n)
+	if s.OnProgress != nil {
+		s.OnProgress(s.indexed)
+	}
+}
 
-	batchSize := s.config.Search.BatchSize
-	offset := 0
-	totalIndexed := 0
-	batchesSinceFlush := 0
-	flushInterval := 10 // Flush every 10 batches
+// IncrementalSync applies the changes logged in the database since the
+// index was last synced: changed records are indexed again and deleted ones
+// removed
+func (s *Syncer) IncrementalSync(ctx context.Context) error {
+	consumer := s.changeConsumer()
+	generation, ok, err := s.db.ChangeCursor(ctx, consumer)
+	if err != nil {
+		return fmt.Errorf("failed to read change cursor: %w", err)
+	}
+	if !ok {
+		// An index built before the change log cannot tell which changes it
+		// missed, so it follows the changes made from now on
+		if generation, err = s.db.ChangeGeneration(ctx); err != nil {
+			return fmt.Errorf("failed to read change generation: %w", err)
+		}
+		log.Printf("Index has not been synced with the change log; rebuild it to include earlier changes")
+		return s.db.SetChangeCursor(ctx, consumer, generation)
+	}
 
+	applied := 0
 	for {
 		select {
 		case <-ctx.Done():
@@ -182,104 +260,131 @@ func (s *Syncer) IndexStudies(ctx context.Context) error {
 		default:
 		}
 
-		rows, err := s.db.Query(query, batchSize, offset)
+		changes, err := s.db.ChangesSince(ctx, generation, s.config.Search.BatchSize)
 		if err != nil {
-			return fmt.Errorf("failed to query studies: %w", err)
+			return fmt.Errorf("failed to read changes: %w", err)
+		}
+		if len(changes) == 0 {
+			break
+		}
+		if err := s.applyChanges(ctx, changes); err != nil {
+			return fmt.Errorf("failed to apply changes: %w", err)
 		}
 
-		docs := make([]interface{}, 0, batchSize)
-		count := 0
-
-		for rows.Next() {
-			var study struct {
-				Accession      string
-				Title          sql.NullString
-				Abstract       sql.NullString
-				Type           sql.NullString
-				Organism       sql.NullString
-				SubmissionDate sql.NullTime
-			}
-
-			if err := rows.Scan(&study.Accession, &study.Title, &study.Abstract,
-				&study.Type, &study.Organism, &study.SubmissionDate); err != nil {
-				rows.Close()
-				return fmt.Errorf("failed to scan study: %w", err)
-			}
+		// The cursor only moves past changes saved in the index
+		if err := s.backend.Flush(); err != nil {
+			return fmt.Errorf("failed to flush index: %w", err)
+		}
+		generation = changes[len(changes)-1].Generation
+		if err := s.db.SetChangeCursor(ctx, consumer, generation); err != nil {
+			return fmt.Errorf("failed to save change cursor: %w", err)
+		}
+		applied += len(changes)
+	}
 
-			doc := map[string]interface{}{
-				"id":       study.Accession,
-				"type":     "study",
-				"title":    study.Title.String,
-				"abstract": study.Abstract.String,
-				"organism": study.Organism.String,
-			}
+	if applied > 0 {
+		log.Printf("Applied %d changes to the index", applied)
+		s.pruneChanges(ctx)
+	}
+	return nil
+}
 
-			if study.Type.Valid {
-				doc["study_type"] = study.Type.String
-			}
+// changeConsumer names the index among the consumers of the change log
+func (s *Syncer) changeConsumer() string {
+	return "index:" + s.config.Search.IndexPath
+}
 
-			if study.SubmissionDate.Valid {
-				doc["submission_date"] = study.SubmissionDate.Time
-			}
+// markSynced records that the index holds every change up to generation,
+// and prunes the changes no consumer still needs
+func (s *Syncer) markSynced(ctx context.Context, generation int64) error {
+	if err := s.db.SetChangeCursor(ctx, s.changeConsumer(), generation); err != nil {
+		return fmt.Errorf("failed to save change cursor: %w", err)
+	}
+	s.pruneChanges(ctx)
+	return nil
+}
 
-			// Generate embedding if embedder is available
-			if s.embedder != nil && s.embedder.IsModelLoaded() {
-				text := embeddings.PrepareTextForEmbedding(
-					study.Organism.String,
-					"", // No library strategy for studies
-					study.Title.String,
-					study.Abstract.String,
-				)
-
-				if embedding, err := s.embedder.EmbedText(text); err == nil {
-					doc["embedding"] = embedding
-				}
-			}
+// pruneChanges removes applied changes, logging rather than failing the
+// sync as they are only kept for consumers
+func (s *Syncer) pruneChanges(ctx context.Context) {
+	if _, err := s.db.PruneChanges(ctx); err != nil {
+		log.Printf("Warning: failed to prune change log: %v", err)
+	}
+}
 
-			docs = append(docs, doc)
-			count++
-		}
-		rows.Close()
+// docSource reads the index documents of one record type
+type docSource struct {
+	recordType string // type of the documents and of their records in the change log
+	table      string
+	key        string // accession column
+	columns    string // columns read by scan
+	scan       func(s *Syncer, rows *sql.Rows) (map[string]interface{}, error)
+}
 
-		if count == 0 {
-			break // No more records
-		}
+var (
+	studyDocs = docSource{
+		recordType: "study",
+		table:      "studies",
+		key:        "study_accession",
+		columns:    "study_accession, study_title, study_abstract, study_type, organism, submission_date",
+		scan:       (*Syncer).scanStudy,
+	}
+	experimentDocs = docSource{
+		recordType: "experiment",
+		table:      "experiments",
+		key:        "experiment_accession",
+		columns:    "experiment_accession, title, library_strategy, platform, instrument_model",
+		scan:       (*Syncer).scanExperiment,
+	}
+	sampleDocs = docSource{
+		recordType: "sample",
+		table:      "samples",
+		key:        "sample_accession",
+		columns:    "sample_accession, organism, scientific_name, tissue, cell_type, description",
+		scan:       (*Syncer).scanSample,
+	}
+	runDocs = docSource{
+		recordType: "run",
+		table:      "runs",
+		key:        "run_accession",
+		columns:    "run_accession, total_spots, total_bases",
+		scan:       (*Syncer).scanRun,
+	}
+)
 
-		// Index batch
-		if err := s.backend.IndexBatch(docs); err != nil {
-			return fmt.Errorf("failed to index batch: %w", err)
-		}
+// docSources are the indexed record types by the record type logged in the
+// change log
+var docSources = map[string]docSource{
+	studyDocs.recordType:      studyDocs,
+	experimentDocs.recordType: experimentDocs,
+	sampleDocs.recordType:     sampleDocs,
+	runDocs.recordType:        runDocs,
+}
 
-		totalIndexed += count
-		offset += batchSize
-		batchesSinceFlush++
+// IndexStudies indexes all studies from the database
+func (s *Syncer) IndexStudies(ctx context.Context) error {
+	return s.indexAll(ctx, studyDocs)
+}
 
-		// Periodically flush the index for progressive saving
-		if batchesSinceFlush >= flushInterval {
-			log.Printf("Flushing index after %d batches (%d documents indexed so far)", batchesSinceFlush, totalIndexed)
-			if err := s.backend.Flush(); err != nil {
-				log.Printf("Warning: failed to flush index: %v", err)
-			}
-			batchesSinceFlush = 0
-		}
+// IndexExperiments indexes all experiments from the database
+func (s *Syncer) IndexExperiments(ctx context.Context) error {
+	return s.indexAll(ctx, experimentDocs)
+}
 
-		if count < batchSize {
-			break // Last batch
-		}
-	}
+// IndexSamples indexes all samples from the database
+func (s *Syncer) IndexSamples(ctx context.Context) error {
+	return s.indexAll(ctx, sampleDocs)
+}
 
-	log.Printf("Indexed %d studies", totalIndexed)
-	return nil
+// IndexRuns indexes all runs from the database
+func (s *Syncer) IndexRuns(ctx context.Context) error {
+	return s.indexAll(ctx, runDocs)
 }
 
-// IndexExperiments indexes all experiments from the database
-func (s *Syncer) IndexExperiments(ctx context.Context) error {
-	query := `
-		SELECT experiment_accession, title, library_strategy,
-		       platform, instrument_model
-		FROM experiments
-		LIMIT ? OFFSET ?
-	`
+// indexAll indexes every record of src in batches
+func (s *Syncer) indexAll(ctx context.Context, src docSource) error {
+	// #nosec G201 - table and column names are from a fixed list, not user input
+	query := fmt.Sprintf("SELECT %s FROM %s LIMIT ? OFFSET ?", src.columns, src.table)
 
 	batchSize := s.config.Search.BatchSize
 	offset := 0
@@ -296,71 +401,36 @@ func (s *Syncer) IndexExperiments(ctx context.Context) error {
 
 		rows, err := s.db.Query(query, batchSize, offset)
 		if err != nil {
-			return fmt.Errorf("failed to query experiments: %w", err)
+			return fmt.Errorf("failed to query %s: %w", src.table, err)
 		}
-
-		docs := make([]interface{}, 0, batchSize)
-		count := 0
-
-		for rows.Next() {
-			var exp struct {
-				Accession       string
-				Title           sql.NullString
-				LibraryStrategy sql.NullString
-				Platform        sql.NullString
-				InstrumentModel sql.NullString
-			}
-
-			if err := rows.Scan(&exp.Accession, &exp.Title, &exp.LibraryStrategy,
-				&exp.Platform, &exp.InstrumentModel); err != nil {
-				rows.Close()
-				return fmt.Errorf("failed to scan experiment: %w", err)
-			}
-
-			doc := map[string]interface{}{
-				"id":               exp.Accession,
-				"type":             "experiment",
-				"title":            exp.Title.String,
-				"library_strategy": exp.LibraryStrategy.String,
-				"platform":         exp.Platform.String,
-				"instrument_model": exp.InstrumentModel.String,
-			}
-
-			// Generate embedding if embedder is available
-			if s.embedder != nil && s.embedder.IsModelLoaded() {
-				text := embeddings.PrepareTextForEmbedding(
-					"", // No organism at experiment level
-					exp.LibraryStrategy.String,
-					exp.Title.String,
-					"", // No abstract for experiments
-				)
-
-				if embedding, err := s.embedder.EmbedText(text); err == nil {
-					doc["embedding"] = embedding
-				}
-			}
-
-			docs = append(docs, doc)
-			count++
+		docs, err := s.scanDocs(src, rows)
+		if err != nil {
+			return err
 		}
-		rows.Close()
+		count := len(docs)
 
 		if count == 0 {
 			break // No more records
 		}
 
-		// Index batch
-		if err := s.backend.IndexBatch(docs); err != nil {
-			return fmt.Errorf("failed to index batch: %w", err)
+		docs = s.keptDocs(docs)
+		if len(docs) > 0 {
+			if err := s.prepareDocs(src, docs); err != nil {
+				return err
+			}
+			if err := s.backend.IndexBatch(docs); err != nil {
+				return fmt.Errorf("failed to index batch: %w", err)
+			}
 		}
 
-		totalIndexed += count
+		totalIndexed += len(docs)
+		s.reportIndexed(len(docs))
 		offset += batchSize
 		batchesSinceFlush++
 
 		// Periodically flush the index for progressive saving
 		if batchesSinceFlush >= flushInterval {
-			log.Printf("Flushing index after %d batches (%d experiments indexed so far)", batchesSinceFlush, totalIndexed)
+			log.Printf("Flushing index after %d batches (%d %s indexed so far)", batchesSinceFlush, totalIndexed, src.table)
 			if err := s.backend.Flush(); err != nil {
 				log.Printf("Warning: failed to flush index: %v", err)
 			}
@@ -372,209 +442,255 @@ func (s *Syncer) IndexExperiments(ctx context.Context) error {
 		}
 	}
 
-	log.Printf("Indexed %d experiments", totalIndexed)
+	log.Printf("Indexed %d %s", totalIndexed, src.table)
 	return nil
 }
 
-// IndexSamples indexes all samples from the database
-func (s *Syncer) IndexSamples(ctx context.Context) error {
-	query := `
-		SELECT sample_accession, organism, scientific_name,
-		       tissue, cell_type, description
-		FROM samples
-		LIMIT ? OFFSET ?
-	`
-
-	batchSize := s.config.Search.BatchSize
-	offset := 0
-	totalIndexed := 0
-	batchesSinceFlush := 0
-	flushInterval := 10 // Flush every 10 batches
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+// scanDocs reads the documents of src from rows and closes them
+func (s *Syncer) scanDocs(src docSource, rows *sql.Rows) ([]interface{}, error) {
+	defer rows.Close()
+	var docs []interface{}
+	for rows.Next() {
+		doc, err := src.scan(s, rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", src.recordType, err)
 		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
 
-		rows, err := s.db.Query(query, batchSize, offset)
-		if err != nil {
-			return fmt.Errorf("failed to query samples: %w", err)
+// keptDocs returns the docs selected by keep
+func (s *Syncer) keptDocs(docs []interface{}) []interface{} {
+	if s.keep == nil {
+		return docs
+	}
+	kept := docs[:0]
+	for _, doc := range docs {
+		if s.keepsDoc(doc.(map[string]interface{})) {
+			kept = append(kept, doc)
 		}
+	}
+	return kept
+}
 
-		docs := make([]interface{}, 0, batchSize)
-		count := 0
-
-		for rows.Next() {
-			var sample struct {
-				Accession      string
-				Organism       sql.NullString
-				ScientificName sql.NullString
-				Tissue         sql.NullString
-				CellType       sql.NullString
-				Description    sql.NullString
-			}
+// keepsDoc reports whether doc is selected by keep
+func (s *Syncer) keepsDoc(doc map[string]interface{}) bool {
+	id, _ := doc["id"].(string)
+	return s.keep == nil || s.keep(id)
+}
 
-			if err := rows.Scan(&sample.Accession, &sample.Organism, &sample.ScientificName,
-				&sample.Tissue, &sample.CellType, &sample.Description); err != nil {
-				rows.Close()
-				return fmt.Errorf("failed to scan sample: %w", err)
-			}
+// prepareDocs applies local curations and quality flags to docs, and to
+// samples their attribute ranges and taxonomy
+func (s *Syncer) prepareDocs(src docSource, docs []interface{}) error {
+	if err := MergeCurations(s.db, docs); err != nil {
+		return fmt.Errorf("failed to merge curations: %w", err)
+	}
+	if err := MergeQCFlags(s.db, docs); err != nil {
+		return fmt.Errorf("failed to merge quality flags: %w", err)
+	}
+	if src.recordType != sampleDocs.recordType {
+		return nil
+	}
+	if err := MergeAttributeRanges(s.db, s.config, docs); err != nil {
+		return fmt.Errorf("failed to merge attribute ranges: %w", err)
+	}
+	if err := MergeTaxonomy(s.db, docs); err != nil {
+		return fmt.Errorf("failed to merge taxonomy: %w", err)
+	}
+	return nil
+}
 
-			doc := map[string]interface{}{
-				"id":              sample.Accession,
-				"type":            "sample",
-				"organism":        sample.Organism.String,
-				"scientific_name": sample.ScientificName.String,
-				"tissue":          sample.Tissue.String,
-				"cell_type":       sample.CellType.String,
-				"description":     sample.Description.String,
-			}
+// embed adds the embedding of text to doc if an embedder is loaded
+func (s *Syncer) embed(doc map[string]interface{}, text string) {
+	if s.embedder == nil || !s.embedder.IsModelLoaded() || !s.keepsDoc(doc) {
+		return
+	}
+	if embedding, err := s.embedder.EmbedText(text); err == nil {
+		doc["embedding"] = embedding
+	}
+}
 
-			// Generate embedding if embedder is available
-			if s.embedder != nil && s.embedder.IsModelLoaded() {
-				text := embeddings.PrepareTextForEmbedding(
-					sample.Organism.String,
-					"", // No library strategy for samples
-					sample.Tissue.String+" "+sample.CellType.String,
-					sample.Description.String,
-				)
-
-				if embedding, err := s.embedder.EmbedText(text); err == nil {
-					doc["embedding"] = embedding
-				}
-			}
+func (s *Syncer) scanStudy(rows *sql.Rows) (map[string]interface{}, error) {
+	var study struct {
+		Accession      string
+		Title          sql.NullString
+		Abstract       sql.NullString
+		Type           sql.NullString
+		Organism       sql.NullString
+		SubmissionDate sql.NullTime
+	}
+	if err := rows.Scan(&study.Accession, &study.Title, &study.Abstract,
+		&study.Type, &study.Organism, &study.SubmissionDate); err != nil {
+		return nil, err
+	}
 
-			docs = append(docs, doc)
-			count++
-		}
-		rows.Close()
+	doc := map[string]interface{}{
+		"id":       study.Accession,
+		"type":     "study",
+		"title":    study.Title.String,
+		"abstract": study.Abstract.String,
+		"organism": study.Organism.String,
+	}
+	if study.Type.Valid {
+		doc["study_type"] = study.Type.String
+	}
+	if study.SubmissionDate.Valid {
+		doc["submission_date"] = study.SubmissionDate.Time
+	}
 
-		if count == 0 {
-			break // No more records
-		}
+	s.embed(doc, embeddings.PrepareTextForEmbedding(
+		study.Organism.String,
+		"", // No library strategy for studies
+		study.Title.String,
+		study.Abstract.String,
+	))
+	return doc, nil
+}
 
-		// Index batch
-		if err := s.backend.IndexBatch(docs); err != nil {
-			return fmt.Errorf("failed to index batch: %w", err)
-		}
+func (s *Syncer) scanExperiment(rows *sql.Rows) (map[string]interface{}, error) {
+	var exp struct {
+		Accession       string
+		Title           sql.NullString
+		LibraryStrategy sql.NullString
+		Platform        sql.NullString
+		InstrumentModel sql.NullString
+	}
+	if err := rows.Scan(&exp.Accession, &exp.Title, &exp.LibraryStrategy,
+		&exp.Platform, &exp.InstrumentModel); err != nil {
+		return nil, err
+	}
 
-		totalIndexed += count
-		offset += batchSize
-		batchesSinceFlush++
+	doc := map[string]interface{}{
+		"id":               exp.Accession,
+		"type":             "experiment",
+		"title":            exp.Title.String,
+		"library_strategy": exp.LibraryStrategy.String,
+		"platform":         exp.Platform.String,
+		"instrument_model": exp.InstrumentModel.String,
+	}
 
-		// Periodically flush the index for progressive saving
-		if batchesSinceFlush >= flushInterval {
-			log.Printf("Flushing index after %d batches (%d samples indexed so far)", batchesSinceFlush, totalIndexed)
-			if err := s.backend.Flush(); err != nil {
-				log.Printf("Warning: failed to flush index: %v", err)
-			}
-			batchesSinceFlush = 0
-		}
+	s.embed(doc, embeddings.PrepareTextForEmbedding(
+		"", // No organism at experiment level
+		exp.LibraryStrategy.String,
+		exp.Title.String,
+		"", // No abstract for experiments
+	))
+	return doc, nil
+}
 
-		if count < batchSize {
-			break // Last batch
-		}
+func (s *Syncer) scanSample(rows *sql.Rows) (map[string]interface{}, error) {
+	var sample struct {
+		Accession      string
+		Organism       sql.NullString
+		ScientificName sql.NullString
+		Tissue         sql.NullString
+		CellType       sql.NullString
+		Description    sql.NullString
+	}
+	if err := rows.Scan(&sample.Accession, &sample.Organism, &sample.ScientificName,
+		&sample.Tissue, &sample.CellType, &sample.Description); err != nil {
+		return nil, err
 	}
 
-	log.Printf("Indexed %d samples", totalIndexed)
-	return nil
+	doc := map[string]interface{}{
+		"id":              sample.Accession,
+		"type":            "sample",
+		"organism":        sample.Organism.String,
+		"scientific_name": sample.ScientificName.String,
+		"tissue":          sample.Tissue.String,
+		"cell_type":       sample.CellType.String,
+		"description":     sample.Description.String,
+	}
+
+	s.embed(doc, embeddings.PrepareTextForEmbedding(
+		sample.Organism.String,
+		"", // No library strategy for samples
+		sample.Tissue.String+" "+sample.CellType.String,
+		sample.Description.String,
+	))
+	return doc, nil
 }
 
-// IndexRuns indexes all runs from the database
-func (s *Syncer) IndexRuns(ctx context.Context) error {
-	query := `
-		SELECT run_accession, total_spots, total_bases
-		FROM runs
-		LIMIT ? OFFSET ?
-	`
+func (s *Syncer) scanRun(rows *sql.Rows) (map[string]interface{}, error) {
+	var run struct {
+		Accession string
+		Spots     sql.NullInt64
+		Bases     sql.NullInt64
+	}
+	if err := rows.Scan(&run.Accession, &run.Spots, &run.Bases); err != nil {
+		return nil, err
+	}
 
-	batchSize := s.config.Search.BatchSize
-	offset := 0
-	totalIndexed := 0
-	batchesSinceFlush := 0
-	flushInterval := 10 // Flush every 10 batches
+	doc := map[string]interface{}{
+		"id":   run.Accession,
+		"type": "run",
+	}
+	if run.Spots.Valid {
+		doc["spots"] = run.Spots.Int64
+	}
+	if run.Bases.Valid {
+		doc["bases"] = run.Bases.Int64
+	}
+	return doc, nil
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+// applyChanges indexes the changed records again and removes the deleted
+// ones. Changes to record types that are not indexed are skipped.
+func (s *Syncer) applyChanges(ctx context.Context, changes []database.Change) error {
+	byType := make(map[string][]string)
+	for _, c := range changes {
+		if _, ok := docSources[c.RecordType]; ok {
+			byType[c.RecordType] = append(byType[c.RecordType], c.Accession)
 		}
+	}
 
-		rows, err := s.db.Query(query, batchSize, offset)
+	for recordType, accessions := range byType {
+		src := docSources[recordType]
+		// #nosec G201 - table and column names are from a fixed list, not user input
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (?%s)",
+			src.columns, src.table, src.key, strings.Repeat(", ?", len(accessions)-1))
+		args := make([]interface{}, len(accessions))
+		for i, acc := range accessions {
+			args[i] = acc
+		}
+		rows, err := s.db.QueryContext(ctx, query, args...)
 		if err != nil {
-			return fmt.Errorf("failed to query runs: %w", err)
+			return fmt.Errorf("failed to query %s: %w", src.table, err)
 		}
-
-		docs := make([]interface{}, 0, batchSize)
-		count := 0
-
-		for rows.Next() {
-			var run struct {
-				Accession string
-				Spots     sql.NullInt64
-				Bases     sql.NullInt64
-			}
-
-			if err := rows.Scan(&run.Accession, &run.Spots, &run.Bases); err != nil {
-				rows.Close()
-				return fmt.Errorf("failed to scan run: %w", err)
-			}
-
-			doc := map[string]interface{}{
-				"id":   run.Accession,
-				"type": "run",
-			}
-
-			if run.Spots.Valid {
-				doc["spots"] = run.Spots.Int64
-			}
-			if run.Bases.Valid {
-				doc["bases"] = run.Bases.Int64
-			}
-
-			docs = append(docs, doc)
-			count++
+		docs, err := s.scanDocs(src, rows)
+		if err != nil {
+			return err
 		}
-		rows.Close()
 
-		if count == 0 {
-			break // No more records
+		// Whatever was not found has been deleted, whichever change was
+		// logged last
+		found := make(map[string]bool, len(docs))
+		for _, doc := range docs {
+			found[doc.(map[string]interface{})["id"].(string)] = true
 		}
-
-		// Index batch
-		if err := s.backend.IndexBatch(docs); err != nil {
-			return fmt.Errorf("failed to index batch: %w", err)
+		var deleted []string
+		for _, acc := range accessions {
+			if !found[acc] {
+				deleted = append(deleted, acc)
+			}
 		}
 
-		totalIndexed += count
-		offset += batchSize
-		batchesSinceFlush++
-
-		// Periodically flush the index for progressive saving
-		if batchesSinceFlush >= flushInterval {
-			log.Printf("Flushing index after %d batches (%d runs indexed so far)", batchesSinceFlush, totalIndexed)
-			if err := s.backend.Flush(); err != nil {
-				log.Printf("Warning: failed to flush index: %v", err)
+		if len(docs) > 0 {
+			if err := s.prepareDocs(src, docs); err != nil {
+				return err
+			}
+			if err := s.backend.IndexBatch(docs); err != nil {
+				return fmt.Errorf("failed to index batch: %w", err)
 			}
-			batchesSinceFlush = 0
 		}
-
-		if count < batchSize {
-			break // Last batch
+		if len(deleted) > 0 {
+			if err := s.backend.DeleteBatch(deleted); err != nil {
+				return fmt.Errorf("failed to delete documents: %w", err)
+			}
 		}
+		s.reportIndexed(len(docs) + len(deleted))
 	}
-
-	log.Printf("Indexed %d runs", totalIndexed)
-	return nil
-}
-
-// indexStudiesSince indexes studies modified since a given time
-func (s *Syncer) indexStudiesSince(ctx context.Context, since time.Time) error {
-	// TODO: Implement incremental sync based on modification time
-	// For now, this is a placeholder
 	return nil
 }
 
@@ -2,9 +2,7 @@ package search
 
 import (
 	"context"
-	"crypto/md5"
 	"database/sql"
-	"encoding/hex"
 	"fmt"
 	"log"
 	"runtime"
@@ -37,18 +35,15 @@ func validateSyncTable(table string) error {
 // OptimizedSyncer provides high-performance synchronization
 type OptimizedSyncer struct {
 	*Syncer
-	workers    int
-	checkpoint map[string]string // Track checksums for incremental sync
-	mu         sync.RWMutex
-	progress   atomic.Int64
+	workers  int
+	progress atomic.Int64
 }
 
 // NewOptimizedSyncer creates an optimized syncer with parallel processing
 func NewOptimizedSyncer(s *Syncer) *OptimizedSyncer {
 	return &OptimizedSyncer{
-		Syncer:     s,
-		workers:    runtime.NumCPU(),
-		checkpoint: make(map[string]string),
+		Syncer:  s,
+		workers: runtime.NumCPU(),
 	}
 }
 
@@ -63,6 +58,11 @@ func (o *OptimizedSyncer) ParallelFullSync(ctx context.Context) error {
 	start := time.Now()
 	log.Printf("Starting parallel full sync with %d workers...", o.workers)
 
+	generation, err := o.db.ChangeGeneration(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read change generation: %w", err)
+	}
+
 	// Create work channels
 	workChan := make(chan workItem, o.workers*2)
 	errChan := make(chan error, o.workers)
@@ -111,7 +111,10 @@ func (o *OptimizedSyncer) ParallelFullSync(ctx context.Context) error {
 	log.Printf("Parallel sync completed: %d documents in %v (%.0f docs/sec)",
 		processed, elapsed, float64(processed)/elapsed.Seconds())
 
-	return totalErr
+	if totalErr != nil {
+		return totalErr
+	}
+	return o.markSynced(ctx, generation)
 }
 
 // streamTable streams table data to workers.
@@ -163,109 +166,6 @@ func (o *OptimizedSyncer) streamTable(ctx context.Context, table string, workCha
 	return nil
 }
 
-// IncrementalSync performs an incremental sync using checksums
-func (o *OptimizedSyncer) IncrementalSync(ctx context.Context) error {
-	start := time.Now()
-	log.Println("Starting incremental sync...")
-
-	tables := []string{"study", "experiment", "sample", "run"}
-	var totalUpdated int
-
-	for _, table := range tables {
-		updated, err := o.syncTableIncremental(ctx, table)
-		if err != nil {
-			return fmt.Errorf("incremental sync failed for %s: %w", table, err)
-		}
-		totalUpdated += updated
-	}
-
-	elapsed := time.Since(start)
-	log.Printf("Incremental sync completed: %d updates in %v", totalUpdated, elapsed)
-
-	return nil
-}
-
-// syncTableIncremental syncs only changed records.
-// The table name is validated against allowedSyncTables to prevent SQL injection.
-func (o *OptimizedSyncer) syncTableIncremental(ctx context.Context, table string) (int, error) {
-	// Validate table name to prevent SQL injection
-	if err := validateSyncTable(table); err != nil {
-		return 0, fmt.Errorf("syncTableIncremental: %w", err)
-	}
-
-	// Get records with checksums
-	query := fmt.Sprintf(`
-		SELECT *,
-		       MD5(CAST(COALESCE(%s_accession, '') ||
-		                COALESCE(CAST(updated_at AS TEXT), '') AS TEXT)) as checksum
-		FROM %s
-		WHERE updated_at > datetime('now', '-1 hour')
-	`, table, table)
-
-	rows, err := o.db.QueryContext(ctx, query)
-	if err != nil {
-		// Fallback for tables without updated_at
-		query = fmt.Sprintf("SELECT * FROM %s", table)
-		rows, err = o.db.QueryContext(ctx, query)
-		if err != nil {
-			return 0, err
-		}
-	}
-	defer rows.Close()
-
-	var updated int
-	var incrementalSkipped int
-	batch := make([]interface{}, 0, 100)
-
-	for rows.Next() {
-		doc, err := o.scanTableRow(table, rows)
-		if err != nil {
-			incrementalSkipped++
-			continue
-		}
-
-		// Calculate checksum
-		checksum := o.calculateChecksum(doc)
-		key := fmt.Sprintf("%s:%s", table, o.getDocID(doc))
-
-		o.mu.RLock()
-		oldChecksum, exists := o.checkpoint[key]
-		o.mu.RUnlock()
-
-		// Only index if new or changed
-		if !exists || oldChecksum != checksum {
-			batch = append(batch, doc)
-
-			o.mu.Lock()
-			o.checkpoint[key] = checksum
-			o.mu.Unlock()
-
-			updated++
-		}
-
-		// Process batch
-		if len(batch) >= 100 {
-			if err := o.processBatch(ctx, table, batch); err != nil {
-				return updated, err
-			}
-			batch = make([]interface{}, 0, 100)
-		}
-	}
-
-	// Process remaining
-	if len(batch) > 0 {
-		if err := o.processBatch(ctx, table, batch); err != nil {
-			return updated, err
-		}
-	}
-
-	if incrementalSkipped > 0 {
-		log.Printf("Warning: skipped %d rows during %s incremental sync", incrementalSkipped, table)
-	}
-
-	return updated, nil
-}
-
 // processBatch processes a batch with embeddings if enabled
 func (o *OptimizedSyncer) processBatch(ctx context.Context, table string, batch []interface{}) error {
 	// Note: Embedding generation would be handled by the search manager's embedder
@@ -275,29 +175,6 @@ func (o *OptimizedSyncer) processBatch(ctx context.Context, table string, batch
 	return o.backend.IndexBatch(batch)
 }
 
-// calculateChecksum calculates a checksum for a document
-func (o *OptimizedSyncer) calculateChecksum(doc interface{}) string {
-	h := md5.New()
-	fmt.Fprintf(h, "%+v", doc)
-	return hex.EncodeToString(h.Sum(nil))
-}
-
-// getDocID extracts the document ID
-func (o *OptimizedSyncer) getDocID(doc interface{}) string {
-	switch d := doc.(type) {
-	case StudyDoc:
-		return d.StudyAccession
-	case ExperimentDoc:
-		return d.ExperimentAccession
-	case SampleDoc:
-		return d.SampleAccession
-	case RunDoc:
-		return d.RunAccession
-	default:
-		return ""
-	}
-}
-
 // extractTextForEmbedding extracts text for embedding generation
 func (o *OptimizedSyncer) extractTextForEmbedding(doc interface{}) string {
 	switch d := doc.(type) {
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/taxonomy"
+)
+
+// MergeTaxonomy adds the taxon of samples to their index documents: the
+// taxon ID, the IDs of its lineage, and the names of its ancestors at the
+// ranks of taxonomy.Ranks, so searches can filter and facet at any rank.
+// Lineages need the taxonomy loaded by 'srake taxonomy load'; without it
+// only the taxon ID is added. Documents are expected to be maps carrying
+// the sample accession under "id".
+func MergeTaxonomy(db *database.DB, docs []interface{}) error {
+	accessions := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if m, ok := doc.(map[string]interface{}); ok {
+			if id, ok := m["id"].(string); ok {
+				accessions = append(accessions, id)
+			}
+		}
+	}
+
+	taxonIDs, err := db.GetSampleTaxonIDs(accessions)
+	if err != nil {
+		return err
+	}
+	if len(taxonIDs) == 0 {
+		return nil
+	}
+
+	// Samples of a batch share few taxa; resolve each lineage once
+	lineages := make(map[int][]database.Taxon)
+	for _, id := range taxonIDs {
+		if _, ok := lineages[id]; ok {
+			continue
+		}
+		lineage, err := db.TaxonLineage(id)
+		if err != nil && !errors.Is(err, database.ErrTaxonNotFound) {
+			return err
+		}
+		lineages[id] = lineage
+	}
+
+	for _, doc := range docs {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := m["id"].(string)
+		taxID, ok := taxonIDs[id]
+		if !ok {
+			continue
+		}
+		m[taxonomy.FieldTaxonID] = strconv.Itoa(taxID)
+
+		lineage := lineages[taxID]
+		if len(lineage) == 0 {
+			continue
+		}
+		ids := make([]string, len(lineage))
+		for i, t := range lineage {
+			ids[i] = strconv.Itoa(t.TaxID)
+			if slices.Contains(taxonomy.Ranks, t.Rank) {
+				m[taxonomy.RankField(t.Rank)] = t.Name
+			}
+		}
+		m[taxonomy.FieldLineage] = ids
+	}
+
+	return nil
+}
+
+// TaxonFilter returns the filter selecting samples of a taxon, given by tax
+// ID or scientific name, and with includeDescendants those of every taxon
+// below it. Names are resolved through the taxonomy loaded by 'srake
+// taxonomy load', which descendants also need. Unknown taxa return an
+// error wrapping database.ErrTaxonNotFound.
+func TaxonFilter(db *database.DB, taxon string, includeDescendants bool) (field, value string, err error) {
+	id, convErr := strconv.Atoi(taxon)
+	if convErr != nil || includeDescendants {
+		t, err := db.ResolveTaxon(taxon)
+		if errors.Is(err, database.ErrTaxonNotFound) {
+			if n, _ := db.CountTaxa(); n == 0 {
+				return "", "", fmt.Errorf("%w: %q needs the NCBI taxonomy; run 'srake taxonomy load' first", err, taxon)
+			}
+			return "", "", fmt.Errorf("%w: %q", err, taxon)
+		}
+		if err != nil {
+			return "", "", err
+		}
+		id = t.TaxID
+	}
+
+	if includeDescendants {
+		return taxonomy.FieldLineage, strconv.Itoa(id), nil
+	}
+	return taxonomy.FieldTaxonID, strconv.Itoa(id), nil
+}
@@ -39,6 +39,9 @@ type TieredSearchBackend struct {
 	studyCache map[string]*StudySearchDoc
 	cacheTTL   time.Duration
 	cacheTime  time.Time
+
+	// Study embeddings, loaded on first vector search
+	vectors *VectorSearcher
 }
 
 // TieredConfig configures the tiered search backend
@@ -47,6 +50,7 @@ type TieredConfig struct {
 	IndexStudies     bool
 	IndexExperiments bool
 	UseEmbeddings    bool
+	EmbeddingModel   string // model study embeddings are stored under
 
 	// Batch sizes for indexing
 	StudyBatchSize int
@@ -57,9 +61,16 @@ type TieredConfig struct {
 	CacheTTL         time.Duration
 	MaxSearchResults int
 
+	// QuantizeVectors stores study embeddings as int8 instead of float32
+	QuantizeVectors bool
+
 	// Paths
 	IndexPath      string
 	EmbeddingsPath string
+
+	// Shards partitions a new Bleve index by accession hash; 0 or 1 builds
+	// a single index
+	Shards int
 }
 
 // StudySearchDoc represents an enriched study document with aggregated data
@@ -98,7 +109,7 @@ func NewTieredSearchBackend(db *database.DB, cfg *TieredConfig) (*TieredSearchBa
 	}
 
 	// Create lazy index with optimized mapping
-	lazyIdx := NewLazyIndex(cfg.IndexPath, cfg.IdleTimeout)
+	lazyIdx := NewLazyIndex(cfg.IndexPath, cfg.IdleTimeout, cfg.Shards)
 
 	return &TieredSearchBackend{
 		db:         db,
@@ -122,10 +133,43 @@ func (t *TieredSearchBackend) IsEnabled() bool {
 	return true
 }
 
-// Search performs a tiered search based on query intent
+// Search performs a tiered search based on query intent. With UseVectors
+// and an embedder, it runs a vector search instead, or a hybrid one unless
+// VectorWeight is 1.
 func (t *TieredSearchBackend) Search(query string, opts SearchOptions) (*SearchResult, error) {
 	start := time.Now()
 
+	t.mu.RLock()
+	embedder := t.embedder
+	t.mu.RUnlock()
+	if opts.UseVectors && embedder != nil && embedder.IsEnabled() {
+		vector, err := embedder.Embed(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed query: %w", err)
+		}
+		textQuery := query
+		if opts.VectorWeight >= 1.0 {
+			textQuery = ""
+		}
+		result, err := t.SearchWithVector(textQuery, vector, opts)
+		if err != nil {
+			return nil, err
+		}
+		result.Query = query
+		return result, nil
+	}
+
+	// Cursor scans page through the Bleve index, whatever the intent
+	if opts.Cursor != "" {
+		page, next, err := t.lazyIdx.SearchPage(query, stringFilters(opts.Filters), opts.Limit, opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		result := cursorResult(query, page, next)
+		result.TimeMs = time.Since(start).Milliseconds()
+		return result, nil
+	}
+
 	// Detect search intent
 	intent := t.detectSearchIntent(query)
 
@@ -239,6 +283,9 @@ func (t *TieredSearchBackend) searchStudies(query string, opts SearchOptions) (*
 	// Search using Bleve
 	bleveResult, err := t.lazyIdx.Search(query, opts.Limit)
 	if err != nil {
+		if t.hasFTSTables() {
+			return t.searchSQLiteFTS(query, opts)
+		}
 		return nil, fmt.Errorf("bleve search failed: %w", err)
 	}
 
@@ -293,6 +340,9 @@ func (t *TieredSearchBackend) searchTechnical(query string, opts SearchOptions)
 	// Search with filters
 	bleveResult, err := t.lazyIdx.SearchWithFilters(query, filters, opts.Limit)
 	if err != nil {
+		if t.hasFTSTables() {
+			return t.searchSQLiteFTS(query, opts)
+		}
 		return nil, fmt.Errorf("filtered search failed: %w", err)
 	}
 
@@ -324,6 +374,10 @@ func (t *TieredSearchBackend) searchAll(query string, opts SearchOptions) (*Sear
 		// Fall back to SQLite FTS5 if Bleve fails
 		return t.searchSQLiteFTS(query, opts)
 	}
+	if bleveResult.Total == 0 && t.hasFTSTables() {
+		// Samples and runs are only in the FTS5 tables
+		return t.searchSQLiteFTS(query, opts)
+	}
 
 	// Convert results
 	result := &SearchResult{
@@ -345,19 +399,15 @@ func (t *TieredSearchBackend) searchAll(query string, opts SearchOptions) (*Sear
 	return result, nil
 }
 
-// searchSQLiteFTS performs a fallback search using SQLite FTS5
+// searchSQLiteFTS performs a fallback search of samples and runs using
+// SQLite FTS5
 func (t *TieredSearchBackend) searchSQLiteFTS(query string, opts SearchOptions) (*SearchResult, error) {
-	// Placeholder for SQLite FTS5 implementation
-	result := &SearchResult{
-		Query:     query,
-		TotalHits: 0,
-		Hits:      []Hit{},
-		Mode:      "fts5",
-	}
-
-	// TODO: Implement SQLite FTS5 search
+	return SearchFTS(t.db, query, opts)
+}
 
-	return result, nil
+// hasFTSTables reports whether the FTS5 tables can stand in for Bleve
+func (t *TieredSearchBackend) hasFTSTables() bool {
+	return database.NewFTS5Manager(t.db).HasFTSTables()
 }
 
 // searchCachedStudies searches using cached aggregated study data
@@ -413,16 +463,56 @@ func (t *TieredSearchBackend) shouldUseCache() bool {
 	return time.Since(t.cacheTime) < t.cacheTTL
 }
 
-// SearchWithVector performs a search with vector similarity
+// vectorSearcher returns the searcher over the study embeddings, loading
+// them on first use
+func (t *TieredSearchBackend) vectorSearcher() (*VectorSearcher, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.vectors == nil {
+		path := VectorIndexPath(t.config.EmbeddingsPath)
+		index, err := OpenVectorIndex(path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no study embeddings at %s; build them with 'srake index --build --with-embeddings'", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.vectors = NewVectorSearcher(t.db, index, t.embedder)
+	}
+	return t.vectors, nil
+}
+
+// SearchWithVector performs a k-NN search over the study embeddings. With
+// a text query as well, text and vector results are fused into one ranking
+// by opts.Fusion, weighting vector scores by HybridWeight.
 func (t *TieredSearchBackend) SearchWithVector(query string, vector []float32, opts SearchOptions) (*SearchResult, error) {
-	// TODO: Implement vector search
-	return t.Search(query, opts)
+	vs, err := t.vectorSearcher()
+	if err != nil {
+		return nil, err
+	}
+	if query == "" {
+		return vs.SearchVector(vector, opts)
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	textResult, err := t.lazyIdx.Search(query, limit+opts.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("bleve search failed: %w", err)
+	}
+	return vs.SearchHybridVector(query, vector, HitsFromBleve(textResult), opts)
 }
 
-// FindSimilar finds documents similar to the given ID
+// FindSimilar finds the studies whose embeddings are nearest to a study's
 func (t *TieredSearchBackend) FindSimilar(id string, opts SearchOptions) (*SearchResult, error) {
-	// TODO: Implement similarity search
-	return nil, fmt.Errorf("similarity search not yet implemented")
+	vs, err := t.vectorSearcher()
+	if err != nil {
+		return nil, err
+	}
+	return vs.FindSimilar(id, opts)
 }
 
 // Index adds a document to the search index
@@ -442,6 +532,15 @@ func (t *TieredSearchBackend) IndexBatch(docs []interface{}) error {
 	return t.lazyIdx.BatchIndex(docs)
 }
 
+// Warm opens the lazy index and refreshes the study cache, which the
+// first search would otherwise wait for
+func (t *TieredSearchBackend) Warm() error {
+	if err := t.lazyIdx.ensureOpen(); err != nil {
+		return err
+	}
+	return t.RefreshCache()
+}
+
 // Rebuild rebuilds the entire index from the database
 func (t *TieredSearchBackend) Rebuild(ctx context.Context) error {
 	log.Printf("[TIERED] Starting index rebuild")
@@ -458,7 +557,22 @@ func (t *TieredSearchBackend) Rebuild(ctx context.Context) error {
 	}
 
 	// Create new lazy index with optimized mapping
-	t.lazyIdx = NewLazyIndex(t.config.IndexPath, t.config.IdleTimeout)
+	t.lazyIdx = NewLazyIndex(t.config.IndexPath, t.config.IdleTimeout, t.config.Shards)
+
+	// Only new and changed studies are embedded; the embeddings of the
+	// others are read back from the database
+	vectors := NewVectorIndex(0, t.config.QuantizeVectors)
+	if t.config.UseEmbeddings && t.embedder != nil && t.embedder.IsEnabled() {
+		update, err := UpdateStudyEmbeddings(ctx, t.db, t.embedder, t.config.EmbeddingModel, t.config.StudyBatchSize, nil)
+		if err != nil {
+			log.Printf("[TIERED] Warning: failed to update study embeddings: %v", err)
+		} else {
+			log.Printf("[TIERED] Embedded %d studies, reused %d stored embeddings", update.Embedded, update.Unchanged)
+		}
+		if vectors, err = LoadStudyVectors(t.db, t.config.EmbeddingModel, t.config.QuantizeVectors); err != nil {
+			return err
+		}
+	}
 
 	// Step 2: Create FTS5 tables for Tier 3 (samples/runs)
 	log.Printf("[TIERED] Creating FTS5 tables for fast accession lookups")
@@ -470,7 +584,7 @@ func (t *TieredSearchBackend) Rebuild(ctx context.Context) error {
 	// Step 3: Index studies (Tier 1) - most important, full indexing
 	if t.config.IndexStudies {
 		log.Printf("[TIERED] Indexing studies (Tier 1)")
-		if err := t.indexStudies(ctx); err != nil {
+		if err := t.indexStudies(ctx, vectors); err != nil {
 			return fmt.Errorf("failed to index studies: %w", err)
 		}
 	}
@@ -483,6 +597,17 @@ func (t *TieredSearchBackend) Rebuild(ctx context.Context) error {
 		}
 	}
 
+	if vectors.Len() > 0 {
+		path := VectorIndexPath(t.config.EmbeddingsPath)
+		if err := vectors.Save(path); err != nil {
+			return fmt.Errorf("failed to save study embeddings: %w", err)
+		}
+		t.mu.Lock()
+		t.vectors = NewVectorSearcher(t.db, vectors, t.embedder)
+		t.mu.Unlock()
+		log.Printf("[TIERED] Saved %d study embeddings to %s", vectors.Len(), path)
+	}
+
 	// Step 5: Optimize FTS5 tables for better performance
 	if err := ftsManager.OptimizeFTSTables(); err != nil {
 		log.Printf("[TIERED] Warning: failed to optimize FTS5 tables: %v", err)
@@ -492,17 +617,18 @@ func (t *TieredSearchBackend) Rebuild(ctx context.Context) error {
 	return nil
 }
 
-// indexStudies indexes all studies with aggregated metadata
-func (t *TieredSearchBackend) indexStudies(ctx context.Context) error {
+// indexStudies indexes all studies with aggregated metadata, adding their
+// embeddings from vectors
+func (t *TieredSearchBackend) indexStudies(ctx context.Context, vectors *VectorIndex) error {
 	query := `
 		SELECT
 			s.study_accession,
 			s.study_title,
 			s.study_abstract,
 			s.study_type,
-			GROUP_CONCAT(DISTINCT e.library_strategy) as library_strategies,
-			GROUP_CONCAT(DISTINCT e.platform) as platforms,
-			GROUP_CONCAT(DISTINCT sa.organism) as organisms,
+			GROUP_CONCAT(DISTINCT e.library_strategy ORDER BY e.library_strategy) as library_strategies,
+			GROUP_CONCAT(DISTINCT e.platform ORDER BY e.platform) as platforms,
+			GROUP_CONCAT(DISTINCT sa.organism ORDER BY sa.organism) as organisms,
 			COUNT(DISTINCT e.experiment_accession) as experiment_count,
 			COUNT(DISTINCT sa.sample_accession) as sample_count,
 			COUNT(DISTINCT r.run_accession) as run_count
@@ -511,6 +637,7 @@ func (t *TieredSearchBackend) indexStudies(ctx context.Context) error {
 		LEFT JOIN samples sa ON e.experiment_accession = sa.experiment_accession
 		LEFT JOIN runs r ON e.experiment_accession = r.experiment_accession
 		GROUP BY s.study_accession
+		ORDER BY s.study_accession
 		LIMIT ?
 		OFFSET ?
 	`
@@ -577,36 +704,15 @@ func (t *TieredSearchBackend) indexStudies(ctx context.Context) error {
 			break // No more records
 		}
 
-		// Generate embeddings for this batch if embedder is available
-		if t.config.UseEmbeddings && t.embedder != nil && t.embedder.IsEnabled() {
-			texts := make([]string, len(batch))
+		// Add the stored embeddings of the batch's studies
+		if vectors.Len() > 0 {
 			for i, doc := range batch {
 				if study, ok := doc.(StudySearchDoc); ok {
-					// Combine title and abstract for embedding
-					text := study.StudyTitle
-					if study.StudyAbstract != "" {
-						text = text + " " + study.StudyAbstract
-					}
-					if study.StudyType != "" {
-						text = text + " " + study.StudyType
-					}
-					texts[i] = text
-				}
-			}
-
-			// Generate embeddings
-			embeddings, err := t.embedder.EmbedBatch(texts)
-			if err != nil {
-				log.Printf("[TIERED] Warning: failed to generate embeddings for batch: %v", err)
-			} else {
-				// Add embeddings to the documents
-				for i, doc := range batch {
-					if study, ok := doc.(StudySearchDoc); ok && i < len(embeddings) {
-						study.Embedding = embeddings[i]
+					if vector, ok := vectors.Vector(study.StudyAccession); ok {
+						study.Embedding = vector
 						batch[i] = study
 					}
 				}
-				log.Printf("[TIERED] Generated embeddings for %d studies", len(embeddings))
 			}
 		}
 
@@ -639,6 +745,7 @@ func (t *TieredSearchBackend) indexExperiments(ctx context.Context) error {
 			e.platform,
 			e.instrument_model
 		FROM experiments e
+		ORDER BY e.experiment_accession
 		LIMIT ?
 		OFFSET ?
 	`
@@ -769,8 +876,8 @@ func (t *TieredSearchBackend) RefreshCache() error {
 			s.study_title,
 			s.study_abstract,
 			s.study_type,
-			GROUP_CONCAT(DISTINCT e.library_strategy) as library_strategies,
-			GROUP_CONCAT(DISTINCT e.platform) as platforms,
+			GROUP_CONCAT(DISTINCT e.library_strategy ORDER BY e.library_strategy) as library_strategies,
+			GROUP_CONCAT(DISTINCT e.platform ORDER BY e.platform) as platforms,
 			COUNT(DISTINCT e.experiment_accession) as experiment_count,
 			COUNT(DISTINCT sa.sample_accession) as sample_count,
 			COUNT(DISTINCT r.run_accession) as run_count
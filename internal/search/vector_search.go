@@ -0,0 +1,294 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	blevesearch "github.com/blevesearch/bleve/v2/search"
+	"github.com/nishad/srake/internal/database"
+)
+
+// vectorFilterOversample is how many more neighbours than requested are
+// fetched when results are filtered, since filters are applied afterwards
+const vectorFilterOversample = 10
+
+// vectorFilterFields are the filters supported in vector mode, mapped to
+// their study columns
+var vectorFilterFields = map[string]string{
+	"organism":   "organism",
+	"study_type": "study_type",
+}
+
+// VectorSearcher answers k-NN queries over study embeddings, embedding
+// query text with the same model the index was built with.
+type VectorSearcher struct {
+	db       *database.DB
+	index    *VectorIndex
+	embedder EmbedderInterface
+}
+
+// NewVectorSearcher creates a searcher over a vector index. The embedder
+// is only needed for text queries.
+func NewVectorSearcher(db *database.DB, index *VectorIndex, embedder EmbedderInterface) *VectorSearcher {
+	return &VectorSearcher{db: db, index: index, embedder: embedder}
+}
+
+// Index returns the searcher's vector index
+func (vs *VectorSearcher) Index() *VectorIndex {
+	return vs.index
+}
+
+// Search embeds the query and returns the most similar studies
+func (vs *VectorSearcher) Search(query string, opts SearchOptions) (*SearchResult, error) {
+	if vs.embedder == nil || !vs.embedder.IsEnabled() {
+		return nil, fmt.Errorf("no embedding model is available to embed the query")
+	}
+	vector, err := vs.embedder.Embed(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	result, err := vs.SearchVector(vector, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Query = query
+	return result, nil
+}
+
+// SearchVector returns the studies most similar to a vector
+func (vs *VectorSearcher) SearchVector(vector []float32, opts SearchOptions) (*SearchResult, error) {
+	return vs.search(vector, "", opts)
+}
+
+// SearchHybrid embeds the query and ranks the text hits for it together
+// with the most similar studies. text should hold at least Offset+Limit
+// hits, best first.
+func (vs *VectorSearcher) SearchHybrid(query string, text []Hit, opts SearchOptions) (*SearchResult, error) {
+	if vs.embedder == nil || !vs.embedder.IsEnabled() {
+		return nil, fmt.Errorf("no embedding model is available to embed the query")
+	}
+	vector, err := vs.embedder.Embed(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	return vs.SearchHybridVector(query, vector, text, opts)
+}
+
+// SearchHybridVector ranks text hits together with the studies most
+// similar to a vector, fusing their scores by opts.Fusion and
+// opts.HybridWeight
+func (vs *VectorSearcher) SearchHybridVector(query string, vector []float32, text []Hit, opts SearchOptions) (*SearchResult, error) {
+	start := time.Now()
+	if err := ValidFusion(opts.Fusion); err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	// Gather as many candidates from the vector side as the text side
+	candidates := opts
+	candidates.Limit = limit + opts.Offset
+	candidates.Offset = 0
+	vectorResult, err := vs.SearchVector(vector, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	weight := float64(opts.HybridWeight)
+	if weight <= 0 {
+		weight = DefaultHybridWeight
+	}
+	result := hybridResult(query, FuseHits(text, vectorResult.Hits, opts.Fusion, weight), opts, limit)
+	result.TimeMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// FindSimilar returns the studies most similar to an indexed study
+func (vs *VectorSearcher) FindSimilar(id string, opts SearchOptions) (*SearchResult, error) {
+	vector, ok := vs.index.Vector(id)
+	if !ok {
+		return nil, fmt.Errorf("no embedding for %s", id)
+	}
+	return vs.search(vector, id, opts)
+}
+
+func (vs *VectorSearcher) search(vector []float32, exclude string, opts SearchOptions) (*SearchResult, error) {
+	start := time.Now()
+
+	filters := make(map[string]string)
+	for key, value := range opts.Filters {
+		column, ok := vectorFilterFields[key]
+		if !ok {
+			return nil, fmt.Errorf("filter %q is not supported in vector mode", key)
+		}
+		filters[column] = fmt.Sprint(value)
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	k := opts.KNN
+	if k < limit+opts.Offset {
+		k = limit + opts.Offset
+	}
+	if len(filters) > 0 {
+		k *= vectorFilterOversample
+	}
+
+	var keep func(string) bool
+	if exclude != "" {
+		keep = func(id string) bool { return id != exclude }
+	}
+	neighbours, err := vs.index.Search(vector, k, keep)
+	if err != nil {
+		return nil, err
+	}
+
+	studies, err := vs.studyFields(neighbours)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(neighbours))
+	for _, n := range neighbours {
+		if n.Similarity < opts.SimilarityThreshold {
+			break // neighbours are sorted by similarity
+		}
+		fields, ok := studies[n.ID]
+		if !ok {
+			continue // removed from the database since indexing
+		}
+		if !matchesFilters(fields, filters) {
+			continue
+		}
+		hit := Hit{
+			ID:         n.ID,
+			Type:       "study",
+			Score:      float64(n.Similarity),
+			Similarity: n.Similarity,
+			Fields:     fields,
+		}
+		if opts.ShowConfidence {
+			hit.Confidence = similarityConfidence(n.Similarity)
+		}
+		hits = append(hits, hit)
+	}
+
+	total := len(hits)
+	if opts.Offset >= len(hits) {
+		hits = nil
+	} else {
+		hits = hits[opts.Offset:]
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return &SearchResult{
+		TotalHits: total,
+		Hits:      hits,
+		TimeMs:    time.Since(start).Milliseconds(),
+		Mode:      "vector",
+	}, nil
+}
+
+// studyFields loads the displayed fields of the neighbouring studies
+func (vs *VectorSearcher) studyFields(neighbours []VectorHit) (map[string]map[string]interface{}, error) {
+	studies := make(map[string]map[string]interface{}, len(neighbours))
+	if vs.db == nil || len(neighbours) == 0 {
+		return studies, nil
+	}
+
+	// Stay well below SQLite's limit on bound parameters
+	const chunk = 500
+	for start := 0; start < len(neighbours); start += chunk {
+		end := start + chunk
+		if end > len(neighbours) {
+			end = len(neighbours)
+		}
+		args := make([]interface{}, 0, end-start)
+		for _, n := range neighbours[start:end] {
+			args = append(args, n.ID)
+		}
+
+		rows, err := vs.db.Query(`
+			SELECT study_accession, COALESCE(study_title, ''), COALESCE(study_abstract, ''),
+			       COALESCE(study_type, ''), COALESCE(organism, '')
+			FROM studies
+			WHERE study_accession IN (?`+strings.Repeat(",?", len(args)-1)+`)`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load studies: %w", err)
+		}
+		for rows.Next() {
+			var accession, title, abstract, studyType, organism string
+			if err := rows.Scan(&accession, &title, &abstract, &studyType, &organism); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan study: %w", err)
+			}
+			studies[accession] = map[string]interface{}{
+				"type":            "study",
+				"study_accession": accession,
+				"study_title":     title,
+				"study_abstract":  abstract,
+				"study_type":      studyType,
+				"organism":        organism,
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return studies, nil
+}
+
+// matchesFilters reports whether the fields equal every filter value,
+// ignoring case
+func matchesFilters(fields map[string]interface{}, filters map[string]string) bool {
+	for column, want := range filters {
+		got, _ := fields[column].(string)
+		if !strings.EqualFold(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// similarityConfidence grades a cosine similarity
+func similarityConfidence(similarity float32) string {
+	switch {
+	case similarity > 0.8:
+		return "high"
+	case similarity > 0.5:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// AsBleveResult converts a result to the Bleve result type, so that
+// vector results can be printed by the same formatters as text results.
+func (r *SearchResult) AsBleveResult() *BleveSearchResult {
+	out := &BleveSearchResult{
+		Total: uint64(r.TotalHits),
+		Hits:  make(blevesearch.DocumentMatchCollection, 0, len(r.Hits)),
+		Took:  time.Duration(r.TimeMs) * time.Millisecond,
+	}
+	for _, h := range r.Hits {
+		out.Hits = append(out.Hits, &blevesearch.DocumentMatch{
+			ID:        h.ID,
+			Score:     h.Score,
+			Fields:    h.Fields,
+			Fragments: h.Highlights,
+		})
+		if h.Score > out.MaxScore {
+			out.MaxScore = h.Score
+		}
+	}
+	return out
+}
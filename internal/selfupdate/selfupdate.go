@@ -0,0 +1,417 @@
+// Package selfupdate replaces the running srake binary with a build from
+// the GitHub releases, after checking it against the release's SHA-256
+// checksums.
+package selfupdate
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release channels
+const (
+	ChannelStable = "stable" // published releases only
+	ChannelBeta   = "beta"   // pre-releases as well
+)
+
+// Channels lists the release channels.
+var Channels = []string{ChannelStable, ChannelBeta}
+
+const (
+	// DefaultRepository is the GitHub repository releases are taken from
+	DefaultRepository = "nishad/srake"
+
+	// DefaultAPIURL is the base URL of the GitHub API
+	DefaultAPIURL = "https://api.github.com"
+
+	// checksumsAsset lists the SHA-256 checksum of every archive of a
+	// release, as written by sha256sum
+	checksumsAsset = "SHA256SUMS.txt"
+
+	// maxBinarySize bounds the binary extracted from an archive
+	maxBinarySize = 512 << 20
+)
+
+// Release is a GitHub release.
+type Release struct {
+	TagName    string  `json:"tag_name"`
+	Name       string  `json:"name"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	HTMLURL    string  `json:"html_url"`
+	Assets     []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// asset returns the release asset with the given name
+func (r *Release) asset(name string) (*Asset, bool) {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i], true
+		}
+	}
+	return nil, false
+}
+
+// Updater finds and installs releases for one platform.
+type Updater struct {
+	Repository string
+	APIURL     string
+	Token      string // optional GitHub token, to raise the API rate limit
+	OS         string
+	Arch       string
+	Client     *http.Client
+}
+
+// New returns an updater for the running platform. GITHUB_TOKEN, when
+// set, authenticates the API requests.
+func New() *Updater {
+	return &Updater{
+		Repository: DefaultRepository,
+		APIURL:     DefaultAPIURL,
+		Token:      os.Getenv("GITHUB_TOKEN"),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Client:     &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+// ValidChannel returns an error for an unknown release channel.
+func ValidChannel(channel string) error {
+	for _, c := range Channels {
+		if channel == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown release channel %q (use %s)", channel, strings.Join(Channels, " or "))
+}
+
+// AssetName returns the name of the release archive for the platform.
+func (u *Updater) AssetName() string {
+	return fmt.Sprintf("srake-%s-%s.tar.gz", u.OS, u.Arch)
+}
+
+// binaryName returns the name of the binary inside the release archive
+func (u *Updater) binaryName() string {
+	return fmt.Sprintf("srake-%s-%s", u.OS, u.Arch)
+}
+
+// Latest returns the newest release on a channel that has a build for the
+// platform.
+func (u *Updater) Latest(ctx context.Context, channel string) (*Release, error) {
+	if err := ValidChannel(channel); err != nil {
+		return nil, err
+	}
+
+	var releases []Release
+	url := fmt.Sprintf("%s/repos/%s/releases?per_page=50", strings.TrimSuffix(u.APIURL, "/"), u.Repository)
+	if err := u.getJSON(ctx, url, &releases); err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	var latest *Release
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft || (r.Prerelease && channel != ChannelBeta) {
+			continue
+		}
+		if _, ok := r.asset(u.AssetName()); !ok {
+			continue
+		}
+		if latest == nil || CompareVersions(r.TagName, latest.TagName) > 0 {
+			latest = r
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no %s release of %s has a build for %s/%s", channel, u.Repository, u.OS, u.Arch)
+	}
+	return latest, nil
+}
+
+// Install downloads the platform's archive from a release, checks it
+// against the release checksums, and atomically replaces the binary at
+// target with the one it contains. The new binary must run with
+// --version before it is moved into place.
+func (u *Updater) Install(ctx context.Context, release *Release, target string) error {
+	archive, ok := release.asset(u.AssetName())
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s/%s", release.TagName, u.OS, u.Arch)
+	}
+	sums, ok := release.asset(checksumsAsset)
+	if !ok {
+		return fmt.Errorf("release %s has no %s; refusing to install an unverified binary", release.TagName, checksumsAsset)
+	}
+
+	checksums, err := u.fetchChecksums(ctx, sums.URL)
+	if err != nil {
+		return err
+	}
+	want, ok := checksums[archive.Name]
+	if !ok {
+		return fmt.Errorf("%s does not list %s", checksumsAsset, archive.Name)
+	}
+
+	// Temporary files go next to the target, so the final rename stays on
+	// one filesystem and is atomic
+	dir := filepath.Dir(target)
+	tmpArchive, err := os.CreateTemp(dir, ".srake-update-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("cannot write to %s: %w", dir, err)
+	}
+	defer os.Remove(tmpArchive.Name())
+	defer tmpArchive.Close()
+
+	hash := sha256.New()
+	if err := u.download(ctx, archive.URL, io.MultiWriter(tmpArchive, hash)); err != nil {
+		return fmt.Errorf("failed to download %s: %w", archive.Name, err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", archive.Name, want, got)
+	}
+
+	if _, err := tmpArchive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tmpBinary, err := os.CreateTemp(dir, ".srake-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpBinary.Name())
+	defer tmpBinary.Close()
+
+	if err := extractBinary(tmpArchive, u.binaryName(), tmpBinary); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", archive.Name, err)
+	}
+	if err := tmpBinary.Close(); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0755)
+	if info, err := os.Stat(target); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmpBinary.Name(), mode); err != nil {
+		return err
+	}
+	if out, err := exec.CommandContext(ctx, tmpBinary.Name(), "--version").CombinedOutput(); err != nil {
+		return fmt.Errorf("downloaded binary does not run: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	if err := os.Rename(tmpBinary.Name(), target); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+	return nil
+}
+
+// fetchChecksums downloads and parses a sha256sum listing
+func (u *Updater) fetchChecksums(ctx context.Context, url string) (map[string]string, error) {
+	var buf strings.Builder
+	if err := u.download(ctx, url, &buf); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", checksumsAsset, err)
+	}
+	return parseChecksums(buf.String()), nil
+}
+
+// parseChecksums reads "<hex>  <name>" lines; binary-mode names start
+// with '*'
+func parseChecksums(text string) map[string]string {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums
+}
+
+// extractBinary copies the named file from a gzipped tar archive
+func extractBinary(r io.Reader, name string, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("archive does not contain %s", name)
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || filepath.Base(hdr.Name) != name {
+			continue
+		}
+		if hdr.Size > maxBinarySize {
+			return fmt.Errorf("%s is too large (%d bytes)", name, hdr.Size)
+		}
+		_, err = io.Copy(w, io.LimitReader(tr, maxBinarySize))
+		return err
+	}
+}
+
+func (u *Updater) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := u.newRequest(ctx, url)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (u *Updater) download(ctx context.Context, url string, w io.Writer) error {
+	req, err := u.newRequest(ctx, url)
+	if err != nil {
+		return err
+	}
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (u *Updater) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "srake-self-update")
+	if u.Token != "" && strings.HasPrefix(url, u.APIURL) {
+		req.Header.Set("Authorization", "Bearer "+u.Token)
+	}
+	return req, nil
+}
+
+// CompareVersions orders two release versions such as v1.2.0 and
+// v1.3.0-beta.1, returning -1, 0 or 1. A pre-release sorts before its
+// release. Versions that do not parse, such as "dev", sort first.
+func CompareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+
+	for i := 0; i < 3; i++ {
+		if va.core[i] != vb.core[i] {
+			return compareInts(va.core[i], vb.core[i])
+		}
+	}
+	switch {
+	case va.pre == vb.pre:
+		return 0
+	case va.pre == "":
+		return 1
+	case vb.pre == "":
+		return -1
+	}
+	return comparePrerelease(va.pre, vb.pre)
+}
+
+type version struct {
+	core [3]int
+	pre  string
+}
+
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	s, v.pre, _ = strings.Cut(s, "-")
+
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.core[i] = n
+	}
+	return v, true
+}
+
+// comparePrerelease compares dot-separated pre-release identifiers, numeric
+// ones numerically, as semantic versioning does
+func comparePrerelease(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				return compareInts(na, nb)
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(pa[i], pb[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(pa), len(pb))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
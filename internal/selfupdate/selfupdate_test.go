@@ -0,0 +1,195 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.0", "v1.2.0", 0},
+		{"v1.2.0", "1.2.0", 0},
+		{"v1.10.0", "v1.9.3", 1},
+		{"v1.2.0-beta.1", "v1.2.0", -1},
+		{"v1.2.0-beta.2", "v1.2.0-beta.10", -1},
+		{"v1.2.0-alpha", "v1.2.0-beta", -1},
+		{"v1.2.0-rc.1", "v1.2.0-rc.1.1", -1},
+		{"dev", "v0.0.1", -1},
+		{"v0.0.1", "dev", 1},
+		{"v2", "v1.9.9", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// makeArchive builds a release archive holding one binary
+func makeArchive(t *testing.T, name string, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"README.md", []byte("readme")}, {name, content}} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0755, Size: int64(len(f.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newReleaseServer serves a release list and the assets of each release
+func newReleaseServer(t *testing.T, archive []byte, checksum string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	assets := func(tag string) []Asset {
+		return []Asset{
+			{Name: "srake-linux-amd64.tar.gz", URL: srv.URL + "/download/" + tag + "/srake-linux-amd64.tar.gz"},
+			{Name: "SHA256SUMS.txt", URL: srv.URL + "/download/" + tag + "/SHA256SUMS.txt"},
+		}
+	}
+	releases := []Release{
+		{TagName: "v1.1.0", Assets: assets("v1.1.0")},
+		{TagName: "v1.3.0-beta.1", Prerelease: true, Assets: assets("v1.3.0-beta.1")},
+		{TagName: "v1.2.0", Assets: assets("v1.2.0")},
+		{TagName: "v1.4.0", Draft: true, Assets: assets("v1.4.0")},
+		{TagName: "v1.5.0", Assets: []Asset{{Name: "srake-darwin-arm64.tar.gz"}}},
+	}
+
+	mux.HandleFunc("/repos/nishad/srake/releases", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(releases)
+	})
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		switch filepath.Base(r.URL.Path) {
+		case "SHA256SUMS.txt":
+			fmt.Fprintf(w, "%s  srake-linux-amd64.tar.gz\n%s  srake-darwin-arm64.tar.gz\n", checksum, strings.Repeat("0", 64))
+		default:
+			w.Write(archive)
+		}
+	})
+	return srv
+}
+
+func newTestUpdater(srv *httptest.Server) *Updater {
+	return &Updater{
+		Repository: DefaultRepository,
+		APIURL:     srv.URL,
+		OS:         "linux",
+		Arch:       "amd64",
+		Client:     srv.Client(),
+	}
+}
+
+func TestLatest(t *testing.T) {
+	srv := newReleaseServer(t, nil, "")
+	u := newTestUpdater(srv)
+
+	release, err := u.Latest(context.Background(), ChannelStable)
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if release.TagName != "v1.2.0" {
+		t.Errorf("expected stable release v1.2.0, got %s", release.TagName)
+	}
+
+	release, err = u.Latest(context.Background(), ChannelBeta)
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if release.TagName != "v1.3.0-beta.1" {
+		t.Errorf("expected beta release v1.3.0-beta.1, got %s", release.TagName)
+	}
+
+	if _, err := u.Latest(context.Background(), "nightly"); err == nil {
+		t.Error("expected an error for an unknown channel")
+	}
+
+	u.Arch = "riscv64"
+	if _, err := u.Latest(context.Background(), ChannelStable); err == nil {
+		t.Error("expected an error when no release has a build for the platform")
+	}
+}
+
+func TestInstall(t *testing.T) {
+	script := []byte("#!/bin/sh\necho srake v1.2.0\n")
+	archive := makeArchive(t, "srake-linux-amd64", script)
+	sum := sha256.Sum256(archive)
+
+	target := filepath.Join(t.TempDir(), "srake")
+	if err := os.WriteFile(target, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("verified", func(t *testing.T) {
+		srv := newReleaseServer(t, archive, hex.EncodeToString(sum[:]))
+		u := newTestUpdater(srv)
+		release, err := u.Latest(context.Background(), ChannelStable)
+		if err != nil {
+			t.Fatalf("Latest failed: %v", err)
+		}
+		if err := u.Install(context.Background(), release, target); err != nil {
+			t.Fatalf("Install failed: %v", err)
+		}
+		got, err := os.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, script) {
+			t.Errorf("target not replaced, got %q", got)
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		if err := os.WriteFile(target, []byte("old"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		srv := newReleaseServer(t, archive, strings.Repeat("a", 64))
+		u := newTestUpdater(srv)
+		release, err := u.Latest(context.Background(), ChannelStable)
+		if err != nil {
+			t.Fatalf("Latest failed: %v", err)
+		}
+		err = u.Install(context.Background(), release, target)
+		if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Fatalf("expected a checksum mismatch, got %v", err)
+		}
+		if got, _ := os.ReadFile(target); string(got) != "old" {
+			t.Error("target should be left alone when verification fails")
+		}
+		entries, _ := os.ReadDir(filepath.Dir(target))
+		if len(entries) != 1 {
+			t.Errorf("expected temporary files to be removed, found %d entries", len(entries))
+		}
+	})
+}
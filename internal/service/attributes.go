@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// ErrCodeInvalidAttributeQuery is the ServiceError code for malformed
+// attribute queries.
+const ErrCodeInvalidAttributeQuery = "invalid_attribute_query"
+
+// defaultAttributeQueryLimit caps attribute query results when the request
+// sets no limit
+const defaultAttributeQueryLimit = 100
+
+// AttributeQueryRequest selects samples by their attributes. Each
+// condition is written tag, tag=value, tag!=value, tag~text, or a number
+// comparison such as age>40; a sample must satisfy all of them.
+type AttributeQueryRequest struct {
+	Conditions []string `json:"conditions"`
+	Limit      int      `json:"limit,omitempty"` // 0 for the default, negative for all matches
+	Offset     int      `json:"offset,omitempty"`
+}
+
+// AttributeQueryResponse lists the matching samples with their values of
+// the queried tags
+type AttributeQueryResponse struct {
+	Conditions []database.AttributeCondition `json:"conditions"`
+	Samples    []database.AttributeMatch     `json:"samples"`
+	Total      int                           `json:"total"`
+	Limit      int                           `json:"limit"`
+	Offset     int                           `json:"offset"`
+}
+
+// QueryAttributes returns the samples whose attributes satisfy every
+// condition of the request, ordered by accession.
+func (m *MetadataService) QueryAttributes(ctx context.Context, req *AttributeQueryRequest) (*AttributeQueryResponse, error) {
+	if len(req.Conditions) == 0 {
+		return nil, &ServiceError{Code: ErrCodeInvalidAttributeQuery, Message: "at least one condition is required"}
+	}
+	conditions := make([]database.AttributeCondition, len(req.Conditions))
+	for i, expr := range req.Conditions {
+		c, err := database.ParseAttributeCondition(expr)
+		if err != nil {
+			return nil, &ServiceError{Code: ErrCodeInvalidAttributeQuery, Message: err.Error()}
+		}
+		conditions[i] = c
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultAttributeQueryLimit
+	}
+	offset := max(req.Offset, 0)
+
+	samples, total, err := m.db.QuerySampleAttributes(conditions, max(limit, 0), offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sample attributes: %w", err)
+	}
+	if samples == nil {
+		samples = []database.AttributeMatch{}
+	}
+
+	return &AttributeQueryResponse{
+		Conditions: conditions,
+		Samples:    samples,
+		Total:      total,
+		Limit:      limit,
+		Offset:     offset,
+	}, nil
+}
+
+// ListAttributeTags returns the most common sample attribute tags starting
+// with prefix.
+func (m *MetadataService) ListAttributeTags(ctx context.Context, prefix string, limit int) ([]database.AttributeTagCount, error) {
+	if limit <= 0 {
+		limit = defaultAttributeQueryLimit
+	}
+	tags, err := m.db.ListAttributeTags(prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attribute tags: %w", err)
+	}
+	if tags == nil {
+		tags = []database.AttributeTagCount{}
+	}
+	return tags, nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// ErrCodeInvalidCohort is the ServiceError code for malformed cohort requests.
+const ErrCodeInvalidCohort = "invalid_cohort"
+
+// cohortPageSize is the number of search results fetched per request while
+// collecting cohort members
+const cohortPageSize = 1000
+
+// CohortRequest freezes the results of a search as a named cohort
+type CohortRequest struct {
+	Name    string            `json:"name"`
+	Query   string            `json:"query"`
+	Filters map[string]string `json:"filters,omitempty"`
+	Limit   int               `json:"limit,omitempty"`   // maximum members; 0 for no limit
+	Replace bool              `json:"replace,omitempty"` // replace an existing cohort
+}
+
+// CohortDiffResponse compares a frozen cohort with the current results of
+// its query
+type CohortDiffResponse struct {
+	Cohort     *database.Cohort     `json:"cohort"`
+	Generation *database.Generation `json:"generation"`
+	Matched    int                  `json:"matched"`
+	*database.CohortDiff
+}
+
+// CohortService freezes search results and compares them with later runs
+// of the same query, for tracking cohorts across database updates.
+type CohortService struct {
+	db        *database.DB
+	searchSvc *SearchService
+}
+
+// NewCohortService creates a cohort service
+func NewCohortService(db *database.DB, searchSvc *SearchService) *CohortService {
+	return &CohortService{db: db, searchSvc: searchSvc}
+}
+
+// Freeze runs the query and stores its matches, with the current database
+// generation, under the cohort name
+func (c *CohortService) Freeze(ctx context.Context, req *CohortRequest) (*database.Cohort, error) {
+	if !collectionNamePattern.MatchString(req.Name) {
+		return nil, &ServiceError{
+			Code:    ErrCodeInvalidCohort,
+			Message: "cohort name must start with a letter or digit and contain only letters, digits, '.', '_' or '-'",
+		}
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, &ServiceError{Code: ErrCodeInvalidCohort, Message: "query is required"}
+	}
+	if !req.Replace {
+		if _, err := c.db.GetCohort(req.Name); err == nil {
+			return nil, &ServiceError{Code: ErrCodeInvalidCohort, Message: fmt.Sprintf("cohort %s already exists", req.Name)}
+		}
+	}
+
+	generation, err := c.db.GetGeneration()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database generation: %w", err)
+	}
+	members, err := c.match(ctx, req.Query, req.Filters, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	cohort := &database.Cohort{
+		Name:       req.Name,
+		Query:      req.Query,
+		Filters:    req.Filters,
+		Generation: *generation,
+	}
+	if err := c.db.CreateCohort(cohort, members, req.Replace); err != nil {
+		return nil, fmt.Errorf("failed to store cohort: %w", err)
+	}
+	return cohort, nil
+}
+
+// Diff runs a cohort's query again and reports which records were added,
+// removed, or changed since it was frozen
+func (c *CohortService) Diff(ctx context.Context, name string) (*CohortDiffResponse, error) {
+	cohort, err := c.db.GetCohort(name)
+	if err != nil {
+		return nil, err
+	}
+	frozen, err := c.db.GetCohortMembers(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cohort members: %w", err)
+	}
+
+	generation, err := c.db.GetGeneration()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database generation: %w", err)
+	}
+	current, err := c.match(ctx, cohort.Query, cohort.Filters, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CohortDiffResponse{
+		Cohort:     cohort,
+		Generation: generation,
+		Matched:    len(current),
+		CohortDiff: database.DiffCohort(frozen, current),
+	}, nil
+}
+
+// Get returns a cohort and its members
+func (c *CohortService) Get(ctx context.Context, name string) (*database.Cohort, []database.CohortMember, error) {
+	cohort, err := c.db.GetCohort(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := c.db.GetCohortMembers(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get cohort members: %w", err)
+	}
+	return cohort, members, nil
+}
+
+// List returns all cohorts
+func (c *CohortService) List(ctx context.Context) ([]database.Cohort, error) {
+	cohorts, err := c.db.ListCohorts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cohorts: %w", err)
+	}
+	if cohorts == nil {
+		cohorts = []database.Cohort{}
+	}
+	return cohorts, nil
+}
+
+// Delete removes a cohort
+func (c *CohortService) Delete(ctx context.Context, name string) error {
+	return c.db.DeleteCohort(name)
+}
+
+// match collects all records matching a query, page by page, with the
+// fingerprint of each record's current fields
+func (c *CohortService) match(ctx context.Context, query string, filters map[string]string, limit int) ([]database.CohortMember, error) {
+	if c.searchSvc == nil {
+		return nil, fmt.Errorf("search is not available")
+	}
+
+	var members []database.CohortMember
+	seen := make(map[string]bool)
+	for offset := 0; ; offset += cohortPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.searchSvc.Search(ctx, &SearchRequest{
+			Query:   query,
+			Filters: filters,
+			Limit:   cohortPageSize,
+			Offset:  offset,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range resp.Results {
+			if seen[hit.ID] {
+				continue
+			}
+			seen[hit.ID] = true
+
+			fingerprint, err := c.db.RecordFingerprint(hit.Type, hit.ID)
+			if err != nil {
+				// Indexed but no longer in the database; track membership only
+				fingerprint = ""
+			}
+			members = append(members, database.CohortMember{
+				Accession:   hit.ID,
+				RecordType:  hit.Type,
+				Fingerprint: fingerprint,
+			})
+			if limit > 0 && len(members) >= limit {
+				return members, nil
+			}
+		}
+
+		if len(resp.Results) < cohortPageSize || offset+len(resp.Results) >= resp.TotalResults {
+			return members, nil
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// ErrCodeInvalidCollection is the ServiceError code for malformed collection requests.
+const ErrCodeInvalidCollection = "invalid_collection"
+
+// collectionNamePattern restricts collection names to URL-safe identifiers.
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// CollectionRequest creates a collection or adds members to one
+type CollectionRequest struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Accessions  []string `json:"accessions,omitempty"`
+}
+
+// CollectionResponse describes a collection and its members
+type CollectionResponse struct {
+	*database.Collection
+	Members []database.CollectionMember `json:"members"`
+}
+
+// CollectionUpdate reports the outcome of adding or removing members
+type CollectionUpdate struct {
+	Name    string   `json:"name"`
+	Added   int      `json:"added,omitempty"`
+	Removed int      `json:"removed,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// ListCollections returns all user-defined collections
+func (m *MetadataService) ListCollections(ctx context.Context) ([]database.Collection, error) {
+	collections, err := m.db.ListCollections()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	if collections == nil {
+		collections = []database.Collection{}
+	}
+	return collections, nil
+}
+
+// GetCollection returns a collection together with its members
+func (m *MetadataService) GetCollection(ctx context.Context, name string) (*CollectionResponse, error) {
+	collection, err := m.db.GetCollection(name)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := m.db.GetCollectionMembers(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection members: %w", err)
+	}
+	if members == nil {
+		members = []database.CollectionMember{}
+	}
+
+	return &CollectionResponse{Collection: collection, Members: members}, nil
+}
+
+// CreateCollection creates a collection and adds any accessions given in the request
+func (m *MetadataService) CreateCollection(ctx context.Context, req *CollectionRequest) (*CollectionUpdate, error) {
+	if !collectionNamePattern.MatchString(req.Name) {
+		return nil, &ServiceError{
+			Code:    ErrCodeInvalidCollection,
+			Message: "collection name must start with a letter or digit and contain only letters, digits, '.', '_' or '-'",
+		}
+	}
+
+	if err := m.db.CreateCollection(req.Name, req.Description); err != nil {
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
+
+	if len(req.Accessions) == 0 {
+		return &CollectionUpdate{Name: req.Name}, nil
+	}
+	return m.AddToCollection(ctx, req.Name, req.Accessions)
+}
+
+// AddToCollection adds records to an existing collection. Accessions that do not
+// resolve to a known record are skipped and reported as missing.
+func (m *MetadataService) AddToCollection(ctx context.Context, name string, accessions []string) (*CollectionUpdate, error) {
+	if _, err := m.db.GetCollection(name); err != nil {
+		return nil, err
+	}
+	if len(accessions) == 0 {
+		return nil, &ServiceError{Code: ErrCodeInvalidCollection, Message: "no accessions provided"}
+	}
+
+	update := &CollectionUpdate{Name: name}
+	members := make([]database.CollectionMember, 0, len(accessions))
+	for _, acc := range accessions {
+		acc = strings.TrimSpace(acc)
+		recordType, err := m.GetAccessionType(ctx, acc)
+		if err != nil {
+			update.Missing = append(update.Missing, acc)
+			continue
+		}
+		members = append(members, database.CollectionMember{Accession: acc, RecordType: recordType})
+	}
+
+	added, err := m.db.AddToCollection(name, members)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add to collection: %w", err)
+	}
+	update.Added = added
+
+	return update, nil
+}
+
+// RemoveFromCollection removes records from a collection
+func (m *MetadataService) RemoveFromCollection(ctx context.Context, name string, accessions []string) (*CollectionUpdate, error) {
+	if _, err := m.db.GetCollection(name); err != nil {
+		return nil, err
+	}
+
+	removed, err := m.db.RemoveFromCollection(name, accessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove from collection: %w", err)
+	}
+
+	return &CollectionUpdate{Name: name, Removed: removed}, nil
+}
+
+// DeleteCollection deletes a collection and its memberships
+func (m *MetadataService) DeleteCollection(ctx context.Context, name string) error {
+	return m.db.DeleteCollection(name)
+}
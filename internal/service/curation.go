@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/jsonpatch"
+)
+
+// ErrCodeInvalidPatch is the ServiceError code for patches that cannot be applied.
+const ErrCodeInvalidPatch = "invalid_patch"
+
+// PatchRecord applies an RFC 6902 JSON Patch to the curation overlay of a record.
+// Only curator-editable fields (curated_title, tags, notes) may be touched; the
+// upstream record itself is never modified. A patch that leaves every field
+// empty removes the overlay.
+func (m *MetadataService) PatchRecord(ctx context.Context, accession string, patch jsonpatch.Patch) (*database.Curation, error) {
+	recordType, err := m.GetAccessionType(ctx, accession)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := m.db.GetCuration(accession)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load curation: %w", err)
+	}
+	if current == nil {
+		current = &database.Curation{Accession: accession, RecordType: recordType}
+	}
+
+	tags := make([]interface{}, 0, len(current.Tags))
+	for _, tag := range current.Tags {
+		tags = append(tags, tag)
+	}
+	doc := map[string]interface{}{
+		"curated_title": current.CuratedTitle,
+		"tags":          tags,
+		"notes":         current.Notes,
+	}
+
+	patched, err := patch.Apply(doc)
+	if err != nil {
+		return nil, &ServiceError{Code: ErrCodeInvalidPatch, Message: err.Error()}
+	}
+
+	updated, err := curationFromDocument(accession, recordType, patched)
+	if err != nil {
+		return nil, &ServiceError{Code: ErrCodeInvalidPatch, Message: err.Error()}
+	}
+
+	if updated.IsEmpty() {
+		if err := m.db.DeleteCuration(accession); err != nil {
+			return nil, fmt.Errorf("failed to delete curation: %w", err)
+		}
+		return updated, nil
+	}
+
+	if err := m.db.UpsertCuration(updated); err != nil {
+		return nil, fmt.Errorf("failed to save curation: %w", err)
+	}
+	return updated, nil
+}
+
+// curationFromDocument validates a patched curation document and converts it
+// back into a Curation.
+func curationFromDocument(accession, recordType string, doc interface{}) (*database.Curation, error) {
+	fields, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("curation document must be an object")
+	}
+
+	c := &database.Curation{
+		Accession:  accession,
+		RecordType: recordType,
+		UpdatedAt:  time.Now().UTC(),
+	}
+
+	for field, value := range fields {
+		switch field {
+		case "curated_title", "notes":
+			if value == nil {
+				continue
+			}
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a string", field)
+			}
+			if field == "curated_title" {
+				c.CuratedTitle = s
+			} else {
+				c.Notes = s
+			}
+		case "tags":
+			if value == nil {
+				continue
+			}
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("tags must be an array of strings")
+			}
+			for _, item := range list {
+				tag, ok := item.(string)
+				if !ok || tag == "" {
+					return nil, fmt.Errorf("tags must be an array of non-empty strings")
+				}
+				c.Tags = append(c.Tags, tag)
+			}
+		default:
+			return nil, fmt.Errorf("field %q is not curator-editable", field)
+		}
+	}
+
+	return c, nil
+}
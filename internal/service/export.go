@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/wire"
 )
 
 // ExportService handles data export in various formats
@@ -54,6 +55,8 @@ func (e *ExportService) Export(ctx context.Context, req *ExportRequest, writer i
 		return e.exportXML(searchResp.Results, writer, req.Fields)
 	case "jsonl", "ndjson":
 		return e.exportJSONLines(searchResp.Results, writer, req.Fields)
+	case "msgpack":
+		return e.exportMsgpack(searchResp.Results, writer, req.Fields)
 	default:
 		return fmt.Errorf("unsupported export format: %s", req.Format)
 	}
@@ -104,6 +107,22 @@ func (e *ExportService) exportJSONLines(results []*SearchResult, writer io.Write
 	return nil
 }
 
+// exportMsgpack exports results as a stream of MessagePack maps, the
+// records of exportJSONLines in the compact wire format
+func (e *ExportService) exportMsgpack(results []*SearchResult, writer io.Writer, fields []string) error {
+	enc := wire.NewEncoder(writer)
+	for _, res := range results {
+		data := res.Fields
+		if len(fields) > 0 {
+			data = e.filterFields(res.Fields, fields)
+		}
+		if err := enc.Encode(data); err != nil {
+			return err
+		}
+	}
+	return enc.Flush()
+}
+
 // exportCSV exports results as CSV
 func (e *ExportService) exportCSV(results []*SearchResult, writer io.Writer, fields []string) error {
 	w := csv.NewWriter(writer)
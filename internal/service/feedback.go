@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// ErrCodeInvalidFeedback is the ServiceError code for malformed feedback requests.
+const ErrCodeInvalidFeedback = "invalid_feedback"
+
+// FeedbackRequest carries relevance judgments for the results of a query
+type FeedbackRequest struct {
+	Query      string   `json:"query"`
+	Relevant   []string `json:"relevant,omitempty"`
+	Irrelevant []string `json:"irrelevant,omitempty"`
+	Source     string   `json:"source,omitempty"`
+}
+
+// FeedbackResponse reports how many judgments were recorded
+type FeedbackResponse struct {
+	Query    string `json:"query"`
+	Recorded int    `json:"recorded"`
+}
+
+// RecordFeedback logs relevance judgments for later tuning of ranking.
+func (s *SearchService) RecordFeedback(ctx context.Context, req *FeedbackRequest) (*FeedbackResponse, error) {
+	feedback, err := BuildFeedback(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.InsertFeedback(feedback); err != nil {
+		return nil, fmt.Errorf("failed to record feedback: %w", err)
+	}
+
+	return &FeedbackResponse{
+		Query:    database.NormalizeFeedbackQuery(req.Query),
+		Recorded: len(feedback),
+	}, nil
+}
+
+// BuildFeedback validates a feedback request and expands it into one judgment
+// per accession. Duplicate accessions are collapsed; an accession listed as both
+// relevant and irrelevant is rejected.
+func BuildFeedback(req *FeedbackRequest) ([]database.Feedback, error) {
+	query := database.NormalizeFeedbackQuery(req.Query)
+	if query == "" {
+		return nil, &ServiceError{Code: ErrCodeInvalidFeedback, Message: "query is required"}
+	}
+
+	judgments := make(map[string]bool)
+	var feedback []database.Feedback
+	add := func(accessions []string, relevant bool) error {
+		for _, acc := range accessions {
+			acc = strings.ToUpper(strings.TrimSpace(acc))
+			if acc == "" {
+				continue
+			}
+			if prev, seen := judgments[acc]; seen {
+				if prev != relevant {
+					return &ServiceError{
+						Code:    ErrCodeInvalidFeedback,
+						Message: fmt.Sprintf("%s is marked both relevant and irrelevant", acc),
+					}
+				}
+				continue
+			}
+			judgments[acc] = relevant
+			feedback = append(feedback, database.Feedback{
+				Query:     query,
+				Accession: acc,
+				Relevant:  relevant,
+				Source:    req.Source,
+			})
+		}
+		return nil
+	}
+	if err := add(req.Relevant, true); err != nil {
+		return nil, err
+	}
+	if err := add(req.Irrelevant, false); err != nil {
+		return nil, err
+	}
+
+	if len(feedback) == 0 {
+		return nil, &ServiceError{Code: ErrCodeInvalidFeedback, Message: "at least one relevant or irrelevant accession is required"}
+	}
+
+	return feedback, nil
+}
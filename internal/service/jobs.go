@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/filelock"
+	"github.com/nishad/srake/internal/processor"
+)
+
+// ErrCodeInvalidJob is the ServiceError code for malformed job requests.
+const ErrCodeInvalidJob = "invalid_job"
+
+// Job kinds
+const (
+	JobKindExport = "export"
+	JobKindSearch = "search"
+	JobKindIngest = "ingest"
+	JobKindIndex  = "index"
+)
+
+// jobPollInterval is how often an idle worker checks for queued jobs and a
+// busy worker checks whether its job was cancelled.
+const jobPollInterval = time.Second
+
+// JobRequest describes a long-running search, export, ingest or index
+// rebuild to run in the background
+type JobRequest struct {
+	Type    string            `json:"type"` // export, search, ingest, index
+	Query   string            `json:"query"`
+	Filters map[string]string `json:"filters,omitempty"`
+	Format  string            `json:"format,omitempty"` // export format; defaults to json
+	Limit   int               `json:"limit,omitempty"`
+	Fields  []string          `json:"fields,omitempty"`
+	File    string            `json:"file,omitempty"`   // ingest: archive path on the server, or URL
+	Source  string            `json:"source,omitempty"` // ingest: archive of the file; detected by default
+}
+
+// JobService queues searches, exports, ingests and index rebuilds and runs
+// them in the background. Jobs are stored in the database and their results
+// in a directory, so both survive restarts. The progress of running ingests
+// and rebuilds is kept in memory.
+type JobService struct {
+	db        *database.DB
+	searchSvc *SearchService
+	exportSvc *ExportService
+	resultDir string
+
+	mu       sync.Mutex
+	progress map[string]processor.Progress
+}
+
+// NewJobService creates a job service writing results to resultDir
+func NewJobService(db *database.DB, searchSvc *SearchService, exportSvc *ExportService, resultDir string) *JobService {
+	return &JobService{
+		db:        db,
+		searchSvc: searchSvc,
+		exportSvc: exportSvc,
+		resultDir: resultDir,
+		progress:  make(map[string]processor.Progress),
+	}
+}
+
+// Submit validates a job request and queues it
+func (j *JobService) Submit(ctx context.Context, req *JobRequest) (*database.Job, error) {
+	if err := normalizeJobRequest(req); err != nil {
+		return nil, err
+	}
+
+	spec, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &database.Job{ID: id, Kind: req.Type, Spec: string(spec)}
+	if err := j.db.CreateJob(job); err != nil {
+		return nil, fmt.Errorf("failed to queue job: %w", err)
+	}
+	return job, nil
+}
+
+// Get returns a job by ID
+func (j *JobService) Get(ctx context.Context, id string) (*database.Job, error) {
+	return j.db.GetJob(id)
+}
+
+// List returns recent jobs, optionally restricted to a status
+func (j *JobService) List(ctx context.Context, status string, limit int) ([]database.Job, error) {
+	return j.db.ListJobs(status, limit)
+}
+
+// Cancel cancels a queued or running job
+func (j *JobService) Cancel(ctx context.Context, id string) (*database.Job, error) {
+	return j.db.CancelJob(id)
+}
+
+// Progress returns the progress of a running ingest or index job. It
+// reports false for other jobs, and before the first progress update.
+func (j *JobService) Progress(id string) (processor.Progress, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	p, ok := j.progress[id]
+	return p, ok
+}
+
+func (j *JobService) setProgress(id string, p processor.Progress) {
+	j.mu.Lock()
+	j.progress[id] = p
+	j.mu.Unlock()
+}
+
+// ResultPath returns the result file of a completed job
+func (j *JobService) ResultPath(ctx context.Context, id string) (*database.Job, error) {
+	job, err := j.db.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != database.JobCompleted {
+		return job, &ServiceError{
+			Code:    ErrCodeInvalidJob,
+			Message: fmt.Sprintf("job %s is %s; results are available once it completes", id, job.Status),
+		}
+	}
+	return job, nil
+}
+
+// Run processes queued jobs until ctx is cancelled. Jobs left running by a
+// previous worker are queued again first.
+func (j *JobService) Run(ctx context.Context) error {
+	if err := os.MkdirAll(j.resultDir, 0750); err != nil {
+		return fmt.Errorf("failed to create job directory: %w", err)
+	}
+	if n, err := j.db.RequeueRunningJobs(); err != nil {
+		return fmt.Errorf("failed to requeue interrupted jobs: %w", err)
+	} else if n > 0 {
+		log.Printf("Requeued %d interrupted job(s)", n)
+	}
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before waiting again
+		for {
+			job, err := j.db.ClaimJob()
+			if err != nil {
+				log.Printf("Failed to claim job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			j.process(ctx, job)
+			if ctx.Err() != nil {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// process runs one claimed job and records its outcome.
+func (j *JobService) process(ctx context.Context, job *database.Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go j.watchCancellation(jobCtx, job.ID, cancel)
+	defer func() {
+		j.mu.Lock()
+		delete(j.progress, job.ID)
+		j.mu.Unlock()
+	}()
+
+	resultPath, err := j.execute(jobCtx, job)
+	if jobCtx.Err() != nil {
+		// Cancelled, or shutting down, in which case the job is left running
+		// so it is requeued on restart
+		os.Remove(resultPath)
+		return
+	}
+	if err != nil {
+		os.Remove(resultPath)
+		if err := j.db.FinishJob(job.ID, database.JobFailed, err.Error(), "", 0); err != nil {
+			log.Printf("Failed to record job %s failure: %v", job.ID, err)
+		}
+		return
+	}
+
+	var size int64
+	if info, err := os.Stat(resultPath); err == nil {
+		size = info.Size()
+	}
+	if err := j.db.FinishJob(job.ID, database.JobCompleted, "", resultPath, size); err != nil {
+		log.Printf("Failed to record job %s completion: %v", job.ID, err)
+	}
+}
+
+// watchCancellation cancels a running job once it is cancelled in the
+// database, which may happen from another process.
+func (j *JobService) watchCancellation(ctx context.Context, id string, cancel context.CancelFunc) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if job, err := j.db.GetJob(id); err == nil && job.Status == database.JobCancelled {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// execute runs a job and returns the path of its result file.
+func (j *JobService) execute(ctx context.Context, job *database.Job) (string, error) {
+	var req JobRequest
+	if err := json.Unmarshal([]byte(job.Spec), &req); err != nil {
+		return "", fmt.Errorf("invalid job spec: %w", err)
+	}
+
+	switch job.Kind {
+	case JobKindExport:
+		path := filepath.Join(j.resultDir, job.ID+"."+JobResultExtension(req.Format))
+		return path, j.exportSvc.ExportToFile(ctx, &ExportRequest{
+			Query:   req.Query,
+			Filters: req.Filters,
+			Format:  req.Format,
+			Limit:   req.Limit,
+			Fields:  req.Fields,
+		}, path)
+	case JobKindSearch:
+		path := filepath.Join(j.resultDir, job.ID+".json")
+		resp, err := j.searchSvc.Search(ctx, &SearchRequest{
+			Query:   req.Query,
+			Filters: req.Filters,
+			Limit:   req.Limit,
+			Fields:  req.Fields,
+		})
+		if err != nil {
+			return "", fmt.Errorf("search failed: %w", err)
+		}
+		return path, writeJobJSON(path, resp)
+	case JobKindIngest:
+		path := filepath.Join(j.resultDir, job.ID+".json")
+		progress, err := j.ingest(ctx, job.ID, &req)
+		if err != nil {
+			return "", err
+		}
+		return path, writeJobJSON(path, progress)
+	case JobKindIndex:
+		if j.searchSvc == nil {
+			return "", fmt.Errorf("search is not available")
+		}
+		path := filepath.Join(j.resultDir, job.ID+".json")
+		var last processor.Progress
+		err := j.searchSvc.RebuildIndex(ctx, func(p processor.Progress) {
+			last = p
+			j.setProgress(job.ID, p)
+		})
+		if err != nil {
+			return "", fmt.Errorf("index rebuild failed: %w", err)
+		}
+		return path, writeJobJSON(path, last)
+	default:
+		return "", fmt.Errorf("unknown job type: %s", job.Kind)
+	}
+}
+
+// ingest ingests the file of an ingest job into the database and returns
+// its final progress. It takes the database lock an ingest from the CLI
+// takes, so the two never write at once.
+func (j *JobService) ingest(ctx context.Context, id string, req *JobRequest) (processor.Progress, error) {
+	lock, err := filelock.Acquire(ctx, j.db.Path(), filelock.Options{Command: "srake server ingest"})
+	if err != nil {
+		return processor.Progress{}, err
+	}
+	defer lock.Release()
+
+	sp := processor.NewStreamProcessor(j.db)
+	sp.SetSource(req.Source)
+	sp.SetProgressFunc(func(p processor.Progress) {
+		j.setProgress(id, p)
+	})
+	if isURL(req.File) {
+		err = sp.ProcessURL(ctx, req.File)
+	} else {
+		err = sp.ProcessFile(ctx, req.File)
+	}
+	if err != nil {
+		return sp.Status(), fmt.Errorf("ingest failed: %w", err)
+	}
+
+	if err := j.db.UpdateStatistics(); err != nil {
+		log.Printf("Failed to update statistics after job %s: %v", id, err)
+	}
+	if err := j.db.FlushSketches(); err != nil {
+		log.Printf("Failed to save count sketches after job %s: %v", id, err)
+	}
+	return sp.Status(), nil
+}
+
+// isURL reports whether an ingest file is downloaded rather than read from
+// the server's disk
+func isURL(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// JobResultExtension returns the result file extension for an export format
+func JobResultExtension(format string) string {
+	if format == "ndjson" {
+		return "jsonl"
+	}
+	return format
+}
+
+// normalizeJobRequest applies defaults and validates a job request.
+func normalizeJobRequest(req *JobRequest) error {
+	req.Type = strings.ToLower(strings.TrimSpace(req.Type))
+	if req.Type == "" {
+		req.Type = JobKindExport
+	}
+	req.Format = strings.ToLower(strings.TrimSpace(req.Format))
+	if req.Format == "" {
+		req.Format = "json"
+	}
+
+	switch req.Type {
+	case JobKindExport:
+		switch req.Format {
+		case "json", "jsonl", "ndjson", "csv", "tsv", "xml":
+		default:
+			return &ServiceError{Code: ErrCodeInvalidJob, Message: fmt.Sprintf("unsupported export format: %s", req.Format)}
+		}
+	case JobKindSearch:
+		if req.Format != "json" {
+			return &ServiceError{Code: ErrCodeInvalidJob, Message: "search jobs only produce json"}
+		}
+	case JobKindIngest, JobKindIndex:
+		if req.Format != "json" {
+			return &ServiceError{Code: ErrCodeInvalidJob, Message: req.Type + " jobs only produce json"}
+		}
+		if req.Type == JobKindIndex {
+			return nil
+		}
+		if strings.TrimSpace(req.File) == "" {
+			return &ServiceError{Code: ErrCodeInvalidJob, Message: "file is required"}
+		}
+		source, err := processor.ParseSource(req.Source)
+		if err != nil {
+			return &ServiceError{Code: ErrCodeInvalidJob, Message: err.Error()}
+		}
+		req.Source = source
+		return nil
+	default:
+		return &ServiceError{Code: ErrCodeInvalidJob, Message: fmt.Sprintf("unknown job type: %s (must be export, search, ingest or index)", req.Type)}
+	}
+
+	if strings.TrimSpace(req.Query) == "" && len(req.Filters) == 0 {
+		return &ServiceError{Code: ErrCodeInvalidJob, Message: "query or filters are required"}
+	}
+	if req.Limit < 0 {
+		return &ServiceError{Code: ErrCodeInvalidJob, Message: "limit must not be negative"}
+	}
+	return nil
+}
+
+func writeJobJSON(path string, v interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// ErrCodeInvalidLookup is the ServiceError code for malformed lookup requests.
+const ErrCodeInvalidLookup = "invalid_lookup"
+
+// defaultLookupLimit caps lookup candidates when the request sets no limit
+const defaultLookupLimit = 20
+
+// md5Pattern matches an MD5 checksum in hex
+var md5Pattern = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+// LookupRequest finds records by a center-assigned alias or submitter ID,
+// or by an internal ID imported with 'srake idmap import'. Query searches
+// all three kinds of identifier. MD5 and Filename find the runs with a
+// data file of that checksum or name.
+type LookupRequest struct {
+	Alias       string `json:"alias,omitempty"`
+	SubmitterID string `json:"submitter_id,omitempty"`
+	InternalID  string `json:"internal_id,omitempty"`
+	MD5         string `json:"md5,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	Query       string `json:"query,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+// LookupResponse lists candidate records ranked by match quality
+type LookupResponse struct {
+	Value      string                     `json:"value"`
+	IDTypes    []string                   `json:"id_types"`
+	Candidates []database.IdentifierMatch `json:"candidates"`
+	Total      int                        `json:"total"`
+}
+
+// Lookup returns candidate accessions for an alias, submitter ID or
+// internal ID, best matches first, or the runs with a data file of an MD5
+// checksum or name.
+func (m *MetadataService) Lookup(ctx context.Context, req *LookupRequest) (*LookupResponse, error) {
+	var value string
+	var idTypes []string
+	set := 0
+	if v := strings.TrimSpace(req.Alias); v != "" {
+		value, idTypes = v, []string{database.IDTypeAlias}
+		set++
+	}
+	if v := strings.TrimSpace(req.SubmitterID); v != "" {
+		value, idTypes = v, []string{database.IDTypeSubmitter}
+		set++
+	}
+	if v := strings.TrimSpace(req.InternalID); v != "" {
+		value, idTypes = v, []string{database.IDTypeInternal}
+		set++
+	}
+	if v := strings.TrimSpace(req.MD5); v != "" {
+		value, idTypes = v, []string{database.IDTypeMD5}
+		set++
+	}
+	if v := strings.TrimSpace(req.Filename); v != "" {
+		value, idTypes = v, []string{database.IDTypeFilename}
+		set++
+	}
+	if v := strings.TrimSpace(req.Query); v != "" {
+		value, idTypes = v, []string{database.IDTypeAlias, database.IDTypeSubmitter, database.IDTypeInternal}
+		set++
+	}
+	if set != 1 {
+		return nil, &ServiceError{
+			Code:    ErrCodeInvalidLookup,
+			Message: "exactly one of alias, submitter_id, internal_id, md5, filename or query is required",
+		}
+	}
+	if idTypes[0] == database.IDTypeMD5 && !md5Pattern.MatchString(value) {
+		return nil, &ServiceError{
+			Code:    ErrCodeInvalidLookup,
+			Message: fmt.Sprintf("invalid md5 %q: expected 32 hexadecimal digits", value),
+		}
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLookupLimit
+	}
+
+	var matches []database.IdentifierMatch
+	var err error
+	switch idTypes[0] {
+	case database.IDTypeMD5, database.IDTypeFilename:
+		matches, err = m.db.LookupRunFiles(idTypes[0], value, limit)
+	default:
+		matches, err = m.db.LookupIdentifiers(value, idTypes, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up identifiers: %w", err)
+	}
+	if matches == nil {
+		matches = []database.IdentifierMatch{}
+	}
+
+	return &LookupResponse{
+		Value:      value,
+		IDTypes:    idTypes,
+		Candidates: matches,
+		Total:      len(matches),
+	}, nil
+}
+
+// AccessionLookupRequest lists study, experiment, sample and run
+// accessions to fetch at once, up to database.MaxAccessionLookup
+type AccessionLookupRequest struct {
+	Accessions []string `json:"accessions"`
+}
+
+// LookupAccessions fetches the records of many accessions at once, with
+// the accessions that matched none
+func (m *MetadataService) LookupAccessions(ctx context.Context, req *AccessionLookupRequest) (*database.AccessionLookup, error) {
+	if len(req.Accessions) == 0 {
+		return nil, &ServiceError{Code: ErrCodeInvalidLookup, Message: "accessions required"}
+	}
+	if len(req.Accessions) > database.MaxAccessionLookup {
+		return nil, &ServiceError{
+			Code:    ErrCodeInvalidLookup,
+			Message: fmt.Sprintf("too many accessions: %d (at most %d per lookup)", len(req.Accessions), database.MaxAccessionLookup),
+		}
+	}
+	lookup, err := m.db.LookupAccessions(req.Accessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up accessions: %w", err)
+	}
+	return lookup, nil
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/downloader"
+)
+
+// ErrCodeInvalidManifest is the ServiceError code for malformed manifest requests.
+const ErrCodeInvalidManifest = "invalid_manifest"
+
+// manifestPageSize is the number of search results fetched per request while
+// collecting manifest runs
+const manifestPageSize = 1000
+
+// Manifest file sources. ENA publishes sizes and checksums; the cloud and
+// NCBI sources serve the SRA object, whose location is derived from the run
+// accession alone.
+const (
+	ManifestSourceENA  = "ena"
+	ManifestSourceAWS  = "aws"
+	ManifestSourceGCP  = "gcp"
+	ManifestSourceNCBI = "ncbi"
+)
+
+// ManifestRequest selects runs, by search query and/or accessions, whose data
+// files go into a download manifest. Studies, experiments and samples expand
+// to their runs.
+type ManifestRequest struct {
+	Query      string            `json:"query,omitempty"`
+	Filters    map[string]string `json:"filters,omitempty"`
+	Accessions []string          `json:"accessions,omitempty"`
+	Limit      int               `json:"limit,omitempty"`     // maximum runs; 0 for no limit
+	FileType   string            `json:"file_type,omitempty"` // sra (default) or fastq
+	Source     string            `json:"source,omitempty"`    // ena (default), aws, gcp or ncbi
+
+	// OpenAccessOnly leaves out controlled-access runs, and runs whose
+	// access level cannot be checked
+	OpenAccessOnly bool `json:"open_access_only,omitempty"`
+}
+
+// ManifestResponse lists the resolved files. Unresolved runs have no files of
+// the requested type at the source; excluded runs were left out by
+// OpenAccessOnly.
+type ManifestResponse struct {
+	Runs       []string                  `json:"runs"`
+	Files      []downloader.ManifestFile `json:"files"`
+	Unresolved []string                  `json:"unresolved,omitempty"`
+	Excluded   []*database.RecordAccess  `json:"excluded,omitempty"`
+}
+
+// ManifestService resolves search results to the data files of their runs,
+// for fetching with external download tools.
+type ManifestService struct {
+	db        *database.DB
+	searchSvc *SearchService
+	resolver  downloader.FileResolver
+}
+
+// NewManifestService creates a manifest service. searchSvc may be nil when
+// manifests are built from accessions only.
+func NewManifestService(db *database.DB, searchSvc *SearchService) *ManifestService {
+	return &ManifestService{db: db, searchSvc: searchSvc, resolver: downloader.NewENAResolver()}
+}
+
+// Build collects the requested runs and resolves their data files
+func (s *ManifestService) Build(ctx context.Context, req *ManifestRequest) (*ManifestResponse, error) {
+	if strings.TrimSpace(req.Query) == "" && len(req.Accessions) == 0 {
+		return nil, &ServiceError{Code: ErrCodeInvalidManifest, Message: "a query or accessions are required"}
+	}
+
+	fileType := strings.ToLower(req.FileType)
+	if fileType == "" {
+		fileType = "sra"
+	}
+	if fileType != "sra" && fileType != "fastq" {
+		return nil, &ServiceError{Code: ErrCodeInvalidManifest, Message: fmt.Sprintf("unsupported file type: %s (supported: sra, fastq)", req.FileType)}
+	}
+	source := strings.ToLower(req.Source)
+	if source == "" {
+		source = ManifestSourceENA
+	}
+	switch source {
+	case ManifestSourceENA:
+	case ManifestSourceAWS, ManifestSourceGCP, ManifestSourceNCBI:
+		if fileType != "sra" {
+			return nil, &ServiceError{Code: ErrCodeInvalidManifest, Message: fmt.Sprintf("%s only serves SRA files; use the ena source for FASTQ", source)}
+		}
+	default:
+		return nil, &ServiceError{Code: ErrCodeInvalidManifest, Message: fmt.Sprintf("unsupported source: %s (supported: ena, aws, gcp, ncbi)", req.Source)}
+	}
+
+	runs, excluded, err := s.collectRuns(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ManifestResponse{Runs: runs, Files: []downloader.ManifestFile{}, Excluded: excluded}
+	if source == ManifestSourceENA {
+		ft := downloader.ParseFileType(fileType)
+		for _, run := range runs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			files, err := s.resolver.Resolve(ctx, run, ft)
+			if err != nil {
+				return nil, err
+			}
+			if len(files) == 0 {
+				response.Unresolved = append(response.Unresolved, run)
+				continue
+			}
+			response.Files = append(response.Files, files...)
+		}
+		return response, nil
+	}
+
+	d := downloader.NewSRADownloader(downloader.Config{
+		Source:   downloader.ParseSource(source),
+		FileType: downloader.SRAFileTypeSRA,
+	})
+	for _, run := range runs {
+		url, err := d.URL(run)
+		if err != nil {
+			response.Unresolved = append(response.Unresolved, run)
+			continue
+		}
+		response.Files = append(response.Files, downloader.ManifestFile{
+			Run:  run,
+			URL:  url,
+			Path: run + "/" + run + ".sra",
+		})
+	}
+	return response, nil
+}
+
+// collectRuns expands the request's accessions and search matches to run
+// accessions, in order of first appearance. With OpenAccessOnly it also
+// returns the runs it left out.
+func (s *ManifestService) collectRuns(ctx context.Context, req *ManifestRequest) ([]string, []*database.RecordAccess, error) {
+	meta := NewMetadataService(s.db)
+	var runs []string
+	var excluded []*database.RecordAccess
+	seen := make(map[string]bool)
+	add := func(recordType, accession string) (bool, error) {
+		expanded, err := s.runsFor(ctx, meta, recordType, accession)
+		if err != nil {
+			return false, err
+		}
+		if req.OpenAccessOnly {
+			if expanded, err = s.openAccess(expanded, seen, &excluded); err != nil {
+				return false, err
+			}
+		}
+		for _, run := range expanded {
+			if seen[run] {
+				continue
+			}
+			seen[run] = true
+			runs = append(runs, run)
+			if req.Limit > 0 && len(runs) >= req.Limit {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	for _, acc := range req.Accessions {
+		acc = strings.ToUpper(strings.TrimSpace(acc))
+		if acc == "" {
+			continue
+		}
+		recordType, err := meta.GetAccessionType(ctx, acc)
+		if err != nil {
+			return nil, nil, &ServiceError{Code: ErrCodeInvalidManifest, Message: err.Error()}
+		}
+		if done, err := add(recordType, acc); err != nil || done {
+			return runs, excluded, err
+		}
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		return runs, excluded, nil
+	}
+	if s.searchSvc == nil {
+		return nil, nil, fmt.Errorf("search is not available")
+	}
+	for offset := 0; ; offset += manifestPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := s.searchSvc.Search(ctx, &SearchRequest{
+			Query:   req.Query,
+			Filters: req.Filters,
+			Limit:   manifestPageSize,
+			Offset:  offset,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, hit := range resp.Results {
+			if done, err := add(hit.Type, hit.ID); err != nil || done {
+				return runs, excluded, err
+			}
+		}
+
+		if len(resp.Results) < manifestPageSize || offset+len(resp.Results) >= resp.TotalResults {
+			return runs, excluded, nil
+		}
+	}
+}
+
+// runsFor returns the runs of a study, experiment, sample or run
+func (s *ManifestService) runsFor(ctx context.Context, meta *MetadataService, recordType, accession string) ([]string, error) {
+	var records []*database.Run
+	var err error
+	switch recordType {
+	case "run":
+		return []string{accession}, nil
+	case "study":
+		records, err = meta.GetRunsByStudy(ctx, accession, 0)
+	case "experiment":
+		records, err = meta.GetRunsByExperiment(ctx, accession, 0)
+	case "sample":
+		return s.runsForSample(accession)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runs for %s: %w", accession, err)
+	}
+
+	runs := make([]string, len(records))
+	for i, r := range records {
+		runs[i] = r.RunAccession
+	}
+	return runs, nil
+}
+
+// openAccess drops controlled runs, and runs unknown to the database, from
+// runs, appending those not seen before to excluded
+func (s *ManifestService) openAccess(runs []string, seen map[string]bool, excluded *[]*database.RecordAccess) ([]string, error) {
+	open, controlled, unknown, err := s.db.SplitOpenAccessRuns(runs)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range controlled {
+		if !seen[a.Accession] {
+			seen[a.Accession] = true
+			*excluded = append(*excluded, a)
+		}
+	}
+	for _, run := range unknown {
+		if !seen[run] {
+			seen[run] = true
+			*excluded = append(*excluded, &database.RecordAccess{Accession: run, RecordType: "run", Access: database.AccessUnknown})
+		}
+	}
+	return open, nil
+}
+
+// runsForSample returns the runs of the experiments that sequenced a sample
+func (s *ManifestService) runsForSample(accession string) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT r.run_accession
+		FROM runs r
+		JOIN experiment_samples es ON es.experiment_accession = r.experiment_accession
+		WHERE es.sample_accession = ?
+		ORDER BY r.run_accession
+	`, accession)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runs for %s: %w", accession, err)
+	}
+	defer rows.Close()
+
+	var runs []string
+	for rows.Next() {
+		var run string
+		if err := rows.Scan(&run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
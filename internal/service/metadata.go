@@ -53,9 +53,16 @@ func (m *MetadataService) GetMetadata(ctx context.Context, req *MetadataRequest)
 	return response, nil
 }
 
-// GetStudy retrieves a study by accession
+// GetStudy retrieves a study by accession, merged with any local curation
 func (m *MetadataService) GetStudy(ctx context.Context, accession string) (*database.Study, error) {
-	return m.db.GetStudy(accession)
+	study, err := m.db.GetStudy(accession)
+	if err != nil {
+		return nil, err
+	}
+	if study.Curation, err = m.db.GetCuration(accession); err != nil {
+		return nil, fmt.Errorf("failed to load curation: %w", err)
+	}
+	return study, nil
 }
 
 // GetStudies retrieves multiple studies with pagination
@@ -85,19 +92,28 @@ func (m *MetadataService) GetStudies(ctx context.Context, limit, offset int) ([]
 	return studies, nil
 }
 
-// GetExperiment retrieves an experiment by accession
+// GetExperiment retrieves an experiment by accession, merged with any local curation
 func (m *MetadataService) GetExperiment(ctx context.Context, accession string) (*database.Experiment, error) {
-	return m.db.GetExperiment(accession)
+	experiment, err := m.db.GetExperiment(accession)
+	if err != nil {
+		return nil, err
+	}
+	if experiment.Curation, err = m.db.GetCuration(accession); err != nil {
+		return nil, fmt.Errorf("failed to load curation: %w", err)
+	}
+	return experiment, nil
 }
 
-// GetExperimentsByStudy retrieves all experiments for a study
-func (m *MetadataService) GetExperimentsByStudy(ctx context.Context, studyAccession string) ([]*database.Experiment, error) {
+// GetExperimentsByStudy retrieves the experiments of a study, at most limit
+// of them (0 for all)
+func (m *MetadataService) GetExperimentsByStudy(ctx context.Context, studyAccession string, limit int) ([]*database.Experiment, error) {
 	query := `SELECT experiment_accession, study_accession, title,
 			   library_strategy, library_source, platform,
 			   instrument_model, COALESCE(metadata, '{}')
-		FROM experiments WHERE study_accession = ? ORDER BY experiment_accession`
+		FROM experiments WHERE study_accession = ? ORDER BY experiment_accession
+		LIMIT ?`
 
-	rows, err := m.db.Query(query, studyAccession)
+	rows, err := m.db.Query(query, studyAccession, sqlLimit(limit))
 	if err != nil {
 		return nil, err
 	}
@@ -119,13 +135,20 @@ func (m *MetadataService) GetExperimentsByStudy(ctx context.Context, studyAccess
 	return experiments, nil
 }
 
-// GetSample retrieves a sample by accession
+// GetSample retrieves a sample by accession, merged with any local curation
 func (m *MetadataService) GetSample(ctx context.Context, accession string) (*database.Sample, error) {
-	return m.db.GetSample(accession)
+	sample, err := m.db.GetSample(accession)
+	if err != nil {
+		return nil, err
+	}
+	if sample.Curation, err = m.db.GetCuration(accession); err != nil {
+		return nil, fmt.Errorf("failed to load curation: %w", err)
+	}
+	return sample, nil
 }
 
-// GetSamplesByStudy retrieves all samples for a study via the experiment_samples junction table
-func (m *MetadataService) GetSamplesByStudy(ctx context.Context, studyAccession string) ([]*database.Sample, error) {
+// GetSamplesByStudy retrieves the samples of a study via the experiment_samples junction table, at most limit of them (0 for all)
+func (m *MetadataService) GetSamplesByStudy(ctx context.Context, studyAccession string, limit int) ([]*database.Sample, error) {
 	query := `
 		SELECT DISTINCT s.sample_accession, s.organism, s.scientific_name,
 			   s.taxon_id, s.tissue, s.cell_type, s.description,
@@ -135,9 +158,10 @@ func (m *MetadataService) GetSamplesByStudy(ctx context.Context, studyAccession
 		JOIN experiments e ON e.experiment_accession = es.experiment_accession
 		WHERE e.study_accession = ?
 		ORDER BY s.sample_accession
+		LIMIT ?
 	`
 
-	rows, err := m.db.Query(query, studyAccession)
+	rows, err := m.db.Query(query, studyAccession, sqlLimit(limit))
 	if err != nil {
 		return nil, err
 	}
@@ -159,18 +183,128 @@ func (m *MetadataService) GetSamplesByStudy(ctx context.Context, studyAccession
 	return samples, nil
 }
 
-// GetRun retrieves a run by accession
+// GetSamplesByExperiment retrieves the samples an experiment sequenced via the experiment_samples junction table, at most limit of them (0 for all)
+func (m *MetadataService) GetSamplesByExperiment(ctx context.Context, experimentAccession string, limit int) ([]*database.Sample, error) {
+	query := `
+		SELECT s.sample_accession, s.organism, s.scientific_name,
+			   s.taxon_id, s.tissue, s.cell_type, s.description,
+			   COALESCE(s.metadata, '{}')
+		FROM samples s
+		JOIN experiment_samples es ON es.sample_accession = s.sample_accession
+		WHERE es.experiment_accession = ?
+		ORDER BY s.sample_accession
+		LIMIT ?
+	`
+
+	rows, err := m.db.Query(query, experimentAccession, sqlLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []*database.Sample
+	for rows.Next() {
+		var sample database.Sample
+		if err := rows.Scan(
+			&sample.SampleAccession, &sample.Organism, &sample.ScientificName,
+			&sample.TaxonID, &sample.Tissue, &sample.CellType,
+			&sample.Description, &sample.Metadata,
+		); err != nil {
+			continue
+		}
+		samples = append(samples, &sample)
+	}
+
+	return samples, nil
+}
+
+// GetExperimentsBySample retrieves the experiments that sequenced a sample via the experiment_samples junction table, at most limit of them (0 for all)
+func (m *MetadataService) GetExperimentsBySample(ctx context.Context, sampleAccession string, limit int) ([]*database.Experiment, error) {
+	query := `SELECT e.experiment_accession, e.study_accession, e.title,
+			   e.library_strategy, e.library_source, e.platform,
+			   e.instrument_model, COALESCE(e.metadata, '{}')
+		FROM experiments e
+		JOIN experiment_samples es ON es.experiment_accession = e.experiment_accession
+		WHERE es.sample_accession = ?
+		ORDER BY e.experiment_accession
+		LIMIT ?`
+
+	rows, err := m.db.Query(query, sampleAccession, sqlLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var experiments []*database.Experiment
+	for rows.Next() {
+		var exp database.Experiment
+		if err := rows.Scan(
+			&exp.ExperimentAccession, &exp.StudyAccession, &exp.Title,
+			&exp.LibraryStrategy, &exp.LibrarySource, &exp.Platform,
+			&exp.InstrumentModel, &exp.Metadata,
+		); err != nil {
+			continue
+		}
+		experiments = append(experiments, &exp)
+	}
+
+	return experiments, nil
+}
+
+// GetRun retrieves a run by accession, merged with any local curation
 func (m *MetadataService) GetRun(ctx context.Context, accession string) (*database.Run, error) {
-	return m.db.GetRun(accession)
+	run, err := m.db.GetRun(accession)
+	if err != nil {
+		return nil, err
+	}
+	if run.Curation, err = m.db.GetCuration(accession); err != nil {
+		return nil, fmt.Errorf("failed to load curation: %w", err)
+	}
+	return run, nil
 }
 
-// GetRunsByExperiment retrieves all runs for an experiment
-func (m *MetadataService) GetRunsByExperiment(ctx context.Context, experimentAccession string) ([]*database.Run, error) {
+// GetRunsByExperiment retrieves the runs of an experiment, at most limit of
+// them (0 for all)
+func (m *MetadataService) GetRunsByExperiment(ctx context.Context, experimentAccession string, limit int) ([]*database.Run, error) {
 	query := `SELECT run_accession, experiment_accession, total_spots,
 			   total_bases, published, COALESCE(metadata, '{}')
-		FROM runs WHERE experiment_accession = ? ORDER BY run_accession`
+		FROM runs WHERE experiment_accession = ? ORDER BY run_accession
+		LIMIT ?`
+
+	rows, err := m.db.Query(query, experimentAccession, sqlLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	rows, err := m.db.Query(query, experimentAccession)
+	var runs []*database.Run
+	for rows.Next() {
+		var run database.Run
+		if err := rows.Scan(
+			&run.RunAccession, &run.ExperimentAccession, &run.TotalSpots,
+			&run.TotalBases, &run.Published, &run.Metadata,
+		); err != nil {
+			continue
+		}
+		runs = append(runs, &run)
+	}
+
+	return runs, nil
+}
+
+// GetRunsBySample retrieves the runs of the experiments that sequenced a
+// sample via the denormalized sample_runs table, at most limit of them (0
+// for all)
+func (m *MetadataService) GetRunsBySample(ctx context.Context, sampleAccession string, limit int) ([]*database.Run, error) {
+	query := `SELECT r.run_accession, r.experiment_accession, r.total_spots,
+			   r.total_bases, r.published, COALESCE(r.metadata, '{}')
+		FROM sample_runs sr
+		JOIN runs r ON r.run_accession = sr.run_accession
+		WHERE sr.sample_accession = ?
+		ORDER BY r.run_accession
+		LIMIT ?`
+
+	rows, err := m.db.Query(query, sampleAccession, sqlLimit(limit))
 	if err != nil {
 		return nil, err
 	}
@@ -236,6 +370,15 @@ func (m *MetadataService) GetRunsByStudy(ctx context.Context, studyAccession str
 	return runs, nil
 }
 
+// sqlLimit returns the LIMIT of a query returning at most limit rows, or
+// all of them for 0
+func sqlLimit(limit int) int {
+	if limit <= 0 {
+		return -1
+	}
+	return limit
+}
+
 // GetStudyMetadata retrieves the complete metadata graph for a study,
 // including its experiments, samples, and up to 100 runs.
 func (m *MetadataService) GetStudyMetadata(ctx context.Context, studyAccession string) (map[string]interface{}, error) {
@@ -246,13 +389,13 @@ func (m *MetadataService) GetStudyMetadata(ctx context.Context, studyAccession s
 	}
 
 	// Get experiments
-	experiments, err := m.GetExperimentsByStudy(ctx, studyAccession)
+	experiments, err := m.GetExperimentsByStudy(ctx, studyAccession, 0)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get samples
-	samples, err := m.GetSamplesByStudy(ctx, studyAccession)
+	samples, err := m.GetSamplesByStudy(ctx, studyAccession, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -330,6 +473,17 @@ func (m *MetadataService) existsInTable(table, column, accession string) (bool,
 	return count > 0, nil
 }
 
+// DistinctCounts returns the number of records of each type and of
+// distinct organisms, platforms and other facet values, estimated from the
+// database's sketches unless exact is set.
+func (m *MetadataService) DistinctCounts(ctx context.Context, exact bool) ([]database.DistinctCount, error) {
+	counts, err := m.db.DistinctCounts(exact)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count distinct values: %w", err)
+	}
+	return counts, nil
+}
+
 // Health verifies the service is operational by checking the database connection
 // and executing a basic query.
 func (m *MetadataService) Health(ctx context.Context) error {
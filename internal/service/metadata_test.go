@@ -183,7 +183,7 @@ func TestGetExperimentsByStudy(t *testing.T) {
 	seedTestData(t, db)
 
 	ctx := context.Background()
-	exps, err := svc.GetExperimentsByStudy(ctx, "SRP000001")
+	exps, err := svc.GetExperimentsByStudy(ctx, "SRP000001", 0)
 	if err != nil {
 		t.Fatalf("GetExperimentsByStudy failed: %v", err)
 	}
@@ -228,7 +228,7 @@ func TestGetRunsByExperiment(t *testing.T) {
 	seedTestData(t, db)
 
 	ctx := context.Background()
-	runs, err := svc.GetRunsByExperiment(ctx, "SRX000001")
+	runs, err := svc.GetRunsByExperiment(ctx, "SRX000001", 0)
 	if err != nil {
 		t.Fatalf("GetRunsByExperiment failed: %v", err)
 	}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/packaging"
+)
+
+// GetStudyBundle loads a study with all of its experiments, samples, and runs
+// for building a metadata package.
+func (m *MetadataService) GetStudyBundle(ctx context.Context, studyAccession string) (*packaging.Bundle, error) {
+	study, err := m.GetStudy(ctx, studyAccession)
+	if err != nil {
+		return nil, err
+	}
+
+	experiments, err := m.GetExperimentsByStudy(ctx, studyAccession, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get experiments: %w", err)
+	}
+
+	samples, err := m.GetSamplesByStudy(ctx, studyAccession, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get samples: %w", err)
+	}
+
+	runs, err := m.GetRunsByStudy(ctx, studyAccession, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runs: %w", err)
+	}
+
+	rows, err := m.db.Query(`
+		SELECT es.experiment_accession, es.sample_accession
+		FROM experiment_samples es
+		JOIN experiments e ON e.experiment_accession = es.experiment_accession
+		WHERE e.study_accession = ?
+		ORDER BY es.experiment_accession, es.sample_accession
+	`, studyAccession)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get experiment samples: %w", err)
+	}
+	defer rows.Close()
+
+	experimentSamples := make(map[string][]string)
+	for rows.Next() {
+		var expAcc, sampleAcc string
+		if err := rows.Scan(&expAcc, &sampleAcc); err != nil {
+			return nil, err
+		}
+		experimentSamples[expAcc] = append(experimentSamples[expAcc], sampleAcc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A study names at most one BioProject in practice
+	var bioproject string
+	err = m.db.QueryRow(`
+		SELECT bioproject_accession FROM bioprojects
+		WHERE record_type = 'study' AND record_accession = ?
+		ORDER BY bioproject_accession LIMIT 1
+	`, studyAccession).Scan(&bioproject)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get BioProject: %w", err)
+	}
+
+	access, err := m.studyAccess(studyAccession, runs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access level: %w", err)
+	}
+
+	return &packaging.Bundle{
+		Study:             study,
+		Experiments:       experiments,
+		Samples:           samples,
+		Runs:              runs,
+		ExperimentSamples: experimentSamples,
+		BioProject:        bioproject,
+		Access:            access,
+	}, nil
+}
+
+// studyAccess returns the access level of a study: controlled when the
+// study is, or else when one of its runs is, preferring a run with a
+// consent group
+func (m *MetadataService) studyAccess(studyAccession string, runs []*database.Run) (*database.RecordAccess, error) {
+	access, err := m.db.GetRecordAccess(studyAccession)
+	if err != nil || (access != nil && access.Access == database.AccessControlled) {
+		return access, err
+	}
+
+	accessions := make([]string, len(runs))
+	for i, r := range runs {
+		accessions[i] = r.RunAccession
+	}
+	runAccess, err := m.db.RunAccess(accessions)
+	if err != nil {
+		return nil, err
+	}
+	result := &database.RecordAccess{Accession: studyAccession, RecordType: "study", Access: database.AccessPublic}
+	for _, run := range accessions {
+		a := runAccess[run]
+		if a == nil || a.Access != database.AccessControlled {
+			continue
+		}
+		if result.Access != database.AccessControlled || (result.Consent == "" && a.Consent != "") {
+			result = &database.RecordAccess{Accession: studyAccession, RecordType: "study", Access: database.AccessControlled, Consent: a.Consent, From: a.From}
+		}
+	}
+	return result, nil
+}
+
+// GetCitation describes a study, experiment, sample, or run for citing in
+// a manuscript, with the study it belongs to and the runs it comprises.
+// Its error mentions "not found" when the record is not in the database.
+func (m *MetadataService) GetCitation(ctx context.Context, accession string) (*packaging.Citation, error) {
+	accType, err := m.GetAccessionType(ctx, accession)
+	if err != nil {
+		return nil, err
+	}
+
+	studyAccession := accession
+	switch accType {
+	case "experiment":
+		experiment, err := m.db.GetExperiment(accession)
+		if err != nil {
+			return nil, err
+		}
+		studyAccession = experiment.StudyAccession
+	case "sample":
+		experiments, err := m.GetExperimentsBySample(ctx, accession, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(experiments) == 0 {
+			return nil, fmt.Errorf("study of sample %s not found", accession)
+		}
+		studyAccession = experiments[0].StudyAccession
+	case "run":
+		run, err := m.db.GetRun(accession)
+		if err != nil {
+			return nil, err
+		}
+		experiment, err := m.db.GetExperiment(run.ExperimentAccession)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get experiment of run %s: %w", accession, err)
+		}
+		studyAccession = experiment.StudyAccession
+	}
+
+	bundle, err := m.GetStudyBundle(ctx, studyAccession)
+	if err != nil {
+		return nil, err
+	}
+	return packaging.NewCitation(accession, bundle)
+}
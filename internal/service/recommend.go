@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/search"
+)
+
+// ErrCodeInvalidRecommendation is the ServiceError code for malformed recommendation requests.
+const ErrCodeInvalidRecommendation = "invalid_recommendation"
+
+// semanticWeight scales embedding similarity (0-1) against the
+// cross-reference weights used by database.RelatedStudies.
+const semanticWeight = 2.0
+
+// SimilarFinder finds documents whose embeddings are close to a document's
+// own embedding. It is implemented by search.Manager.
+type SimilarFinder interface {
+	FindSimilar(id string, opts search.SearchOptions) (*search.SearchResult, error)
+}
+
+// RecommendRequest asks for studies comparable to a study
+type RecommendRequest struct {
+	Accession string `json:"accession"`
+	Limit     int    `json:"limit,omitempty"`
+	Semantic  bool   `json:"semantic"` // Include embedding similarity
+}
+
+// RecommendResponse lists recommended studies with the reasons for each
+type RecommendResponse struct {
+	Accession       string                   `json:"accession"`
+	Title           string                   `json:"title,omitempty"`
+	Recommendations []*database.RelatedStudy `json:"recommendations"`
+	Semantic        bool                     `json:"semantic"`
+	Note            string                   `json:"note,omitempty"`
+}
+
+// RecommendService recommends studies from shared cross-references and
+// embedding similarity
+type RecommendService struct {
+	db      *database.DB
+	similar SimilarFinder
+}
+
+// NewRecommendService creates a recommendation service. similar may be nil,
+// in which case only cross-references are used.
+func NewRecommendService(db *database.DB, similar SimilarFinder) *RecommendService {
+	return &RecommendService{db: db, similar: similar}
+}
+
+// Recommend returns studies that share BioProjects, publications, links, or
+// cell lines with the requested study, merged with semantically similar
+// studies when embeddings are available.
+func (r *RecommendService) Recommend(ctx context.Context, req *RecommendRequest) (*RecommendResponse, error) {
+	accession := strings.ToUpper(strings.TrimSpace(req.Accession))
+	if accession == "" {
+		return nil, &ServiceError{Code: ErrCodeInvalidRecommendation, Message: "accession is required"}
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	study, err := r.db.GetStudy(accession)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rank all cross-referenced studies so semantic matches can be merged in
+	related, err := r.db.RelatedStudies(accession, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find related studies: %w", err)
+	}
+	byAccession := make(map[string]*database.RelatedStudy, len(related))
+	for _, rel := range related {
+		byAccession[rel.Accession] = rel
+	}
+
+	resp := &RecommendResponse{Accession: accession, Title: study.StudyTitle}
+	if req.Semantic {
+		if r.similar == nil {
+			resp.Note = "semantic similarity unavailable: search index not configured"
+		} else if err := r.addSimilar(accession, limit, byAccession, &related); err != nil {
+			resp.Note = fmt.Sprintf("semantic similarity unavailable: %v", err)
+		} else {
+			resp.Semantic = true
+		}
+	}
+
+	database.SortRelatedStudies(related)
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	resp.Recommendations = related
+	return resp, nil
+}
+
+// addSimilar merges studies with similar embeddings into the related set.
+func (r *RecommendService) addSimilar(accession string, limit int, byAccession map[string]*database.RelatedStudy, related *[]*database.RelatedStudy) error {
+	// Over-fetch, since hits include other record types and the study itself
+	result, err := r.similar.FindSimilar(accession, search.SearchOptions{Limit: limit * 3, UseVectors: true})
+	if err != nil {
+		return err
+	}
+
+	for _, hit := range result.Hits {
+		if hit.ID == accession || (hit.Type != "" && hit.Type != "study") {
+			continue
+		}
+		similarity := float64(hit.Similarity)
+		if similarity <= 0 {
+			similarity = hit.Score
+		}
+
+		rel, ok := byAccession[hit.ID]
+		if !ok {
+			rel = &database.RelatedStudy{Accession: hit.ID}
+			if title, ok := hit.Fields["title"].(string); ok {
+				rel.Title = title
+			} else if study, err := r.db.GetStudy(hit.ID); err == nil {
+				rel.Title = study.StudyTitle
+			}
+			byAccession[hit.ID] = rel
+			*related = append(*related, rel)
+		}
+		rel.Score += semanticWeight * similarity
+		rel.Reasons = append(rel.Reasons, fmt.Sprintf("similar abstract (%.2f)", similarity))
+	}
+	return nil
+}
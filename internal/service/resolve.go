@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nishad/srake/internal/database"
+)
+
+// ErrCodeInvalidAccession is the ServiceError code for accessions that are
+// not BioSample, BioProject or GEO accessions.
+const ErrCodeInvalidAccession = "invalid_accession"
+
+// Resolve returns the SRA studies, experiments, samples and runs linked to
+// a BioSample, BioProject or GEO accession. Its error mentions "not found"
+// when no record is linked.
+func (m *MetadataService) Resolve(ctx context.Context, accession string) (*database.ExternalLinks, error) {
+	accession = strings.ToUpper(strings.TrimSpace(accession))
+	if database.ExternalAccessionType(accession) == "" {
+		return nil, &ServiceError{
+			Code:    ErrCodeInvalidAccession,
+			Message: fmt.Sprintf("not a BioSample, BioProject or GEO accession: %s", accession),
+		}
+	}
+
+	links, err := m.db.ResolveExternal(accession)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to resolve %s: %w", accession, err)
+	}
+	return links, nil
+}
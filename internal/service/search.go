@@ -2,19 +2,64 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nishad/srake/internal/config"
 	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/embeddings"
+	"github.com/nishad/srake/internal/paths"
+	"github.com/nishad/srake/internal/processor"
 	"github.com/nishad/srake/internal/search"
 )
 
+// ErrCodeInvalidCursor is the ServiceError code for search cursors that
+// cannot be resumed.
+const ErrCodeInvalidCursor = "invalid_cursor"
+
+// ErrCodeUnknownTaxon is the ServiceError code for taxon filters naming a
+// taxon not in the loaded taxonomy.
+const ErrCodeUnknownTaxon = "unknown_taxon"
+
+// ErrCodeInvalidQuery is the ServiceError code for queries that do not
+// parse in the search query language.
+const ErrCodeInvalidQuery = "invalid_query"
+
+// ErrCodeInvalidOptions is the ServiceError code for search options that
+// cannot be combined.
+const ErrCodeInvalidOptions = "invalid_options"
+
 // SearchService handles search operations
 type SearchService struct {
 	db         *database.DB
+	config     *config.Config
 	manager    *search.Manager
 	useVectors bool
+
+	// Study embeddings for mode=vector, loaded on first use
+	vectorsOnce sync.Once
+	vectors     *search.VectorSearcher
+	embedder    atomic.Pointer[embeddings.SearchEmbedder] // read by metrics scrapes
+	vectorsErr  error
+	embedding   *config.EmbeddingConfig // nil uses the defaults
+
+	// Cross-encoder for reranking, loaded on first use
+	rerankOnce       sync.Once
+	reranker         *embeddings.ONNXReranker
+	rerankErr        error
+	rerankModel      string
+	rerankCandidates int
+
+	// noExpand turns off the expansion of queries with synonyms
+	noExpand bool
+
+	// Popularity boosts of searches with BoostPopular
+	popularityWindow int // days; 0 counts them all
+	popularityWeight float64
 }
 
 // NewSearchService creates a new search service
@@ -37,13 +82,176 @@ func NewSearchService(db *database.DB, indexPath string) (*SearchService, error)
 
 	return &SearchService{
 		db:         db,
+		config:     cfg,
 		manager:    manager,
 		useVectors: false, // Will be enabled when vector support is added
 	}, nil
 }
 
+// SetEmbeddingConfig sets the model that embeds queries for vector search.
+// It must be called before the first vector or hybrid search.
+func (s *SearchService) SetEmbeddingConfig(cfg config.EmbeddingConfig) {
+	s.embedding = &cfg
+}
+
+// SetRerankConfig sets the cross-encoder that reranks results and how many
+// of the top results it reorders, 0 for the default. It must be called
+// before the first reranked search.
+func (s *SearchService) SetRerankConfig(model string, candidates int) {
+	s.rerankModel = model
+	s.rerankCandidates = candidates
+}
+
+// SetExpandSynonyms sets whether the terms of text searches are expanded
+// with their synonyms from the vocabularies loaded by 'srake ontology
+// load', which they are by default
+func (s *SearchService) SetExpandSynonyms(enabled bool) {
+	s.noExpand = !enabled
+}
+
+// SetPopularityConfig sets how searches with BoostPopular weigh how often
+// their results were returned and fetched, and over how many days
+func (s *SearchService) SetPopularityConfig(cfg config.PopularityConfig) {
+	s.popularityWindow = cfg.WindowDays
+	s.popularityWeight = cfg.BoostWeight
+}
+
 // Search performs a search using the search manager
 func (s *SearchService) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	result, err := s.runSearch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	response := newSearchResponse(req, result)
+	response.Results = make([]*SearchResult, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		response.Results = append(response.Results, newSearchResult(hit))
+	}
+	return response, nil
+}
+
+// SearchStream runs a search like Search, but hands over the totals and
+// facets first, to header, and then each result in rank order to emit. Text
+// searches emit each result as the backend reads it; reranked, boosted,
+// vector and hybrid searches, which order the whole page first, emit theirs
+// once it is complete. It stops at the first error header or emit returns.
+func (s *SearchService) SearchStream(ctx context.Context, req *SearchRequest, header func(*SearchStreamHeader) error, emit func(*SearchResult) error) error {
+	emitHit := func(hit search.Hit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return emit(newSearchResult(hit))
+	}
+
+	if req.SearchMode == "vector" || req.SearchMode == "hybrid" || req.Rerank || req.BoostPopular {
+		result, err := s.runSearch(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err := header(newSearchStreamHeader(req, result)); err != nil {
+			return err
+		}
+		for _, hit := range result.Hits {
+			if err := emitHit(hit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	plan, err := s.planSearch(req)
+	if err != nil {
+		return err
+	}
+	started := false
+	err = s.manager.SearchStream(plan.textQuery, plan.opts, func(result *search.SearchResult) error {
+		started = true
+		result.Expansions = plan.expansions
+		return header(newSearchStreamHeader(req, result))
+	}, emitHit)
+	if err != nil && !started {
+		return searchError(err)
+	}
+	return err
+}
+
+// newSearchStreamHeader converts a search result to the header of a
+// streamed response
+func newSearchStreamHeader(req *SearchRequest, result *search.SearchResult) *SearchStreamHeader {
+	response := newSearchResponse(req, result)
+	return &SearchStreamHeader{
+		TotalResults: response.TotalResults,
+		Returned:     len(result.Hits),
+		Query:        response.Query,
+		TimeTaken:    response.TimeTaken,
+		SearchMode:   response.SearchMode,
+		Facets:       response.Facets,
+		NextCursor:   response.NextCursor,
+		Reranked:     response.Reranked,
+		Expansions:   response.Expansions,
+		Warning:      response.Warning,
+	}
+}
+
+// searchPlan is a search request checked and converted to the search it
+// runs on the backend
+type searchPlan struct {
+	opts       search.SearchOptions
+	textQuery  string             // query of text searches, with synonyms
+	expansions []search.Expansion // synonyms added to textQuery
+	candidates int                // top hits reranked or boosted
+}
+
+// runSearch runs the search of a request on the backend its mode selects
+func (s *SearchService) runSearch(ctx context.Context, req *SearchRequest) (*search.SearchResult, error) {
+	plan, err := s.planSearch(req)
+	if err != nil {
+		return nil, err
+	}
+	opts, candidates := plan.opts, plan.candidates
+
+	// Perform search
+	var result *search.SearchResult
+	switch req.SearchMode {
+	case "vector":
+		result, err = s.searchVectors(req.Query, opts)
+	case "hybrid":
+		result, err = s.searchHybrid(req.Query, opts)
+	default:
+		result, err = s.manager.Search(plan.textQuery, opts)
+		if err == nil {
+			result.Expansions = plan.expansions
+		}
+	}
+	if err != nil {
+		return nil, searchError(err)
+	}
+
+	if req.Rerank {
+		reranker, err := s.loadReranker()
+		if err != nil {
+			return nil, err
+		}
+		if result.Reranked, err = search.RerankHits(reranker, req.Query, result.Hits, candidates); err != nil {
+			return nil, err
+		}
+	}
+	if req.BoostPopular {
+		if err := s.boostPopular(result.Hits, candidates); err != nil {
+			return nil, err
+		}
+	}
+	if req.Rerank || req.BoostPopular {
+		start := min(req.Offset, len(result.Hits))
+		result.Hits = result.Hits[start:min(start+req.Limit, len(result.Hits))]
+	}
+
+	return result, nil
+}
+
+// planSearch checks a request and converts it to the search it runs
+func (s *SearchService) planSearch(req *SearchRequest) (*searchPlan, error) {
 	// Validate request
 	if req.Limit <= 0 {
 		req.Limit = 20
@@ -56,11 +264,14 @@ func (s *SearchService) Search(ctx context.Context, req *SearchRequest) (*Search
 	opts := search.SearchOptions{
 		Limit:               req.Limit,
 		Offset:              req.Offset,
+		Cursor:              req.Cursor,
 		SimilarityThreshold: req.SimilarityThreshold,
 		MinScore:            float64(req.MinScore),
 		TopPercentile:       req.TopPercentile,
 		ShowConfidence:      req.ShowConfidence,
 		UseVectors:          req.UseVectors && s.useVectors,
+		HybridWeight:        req.HybridWeight,
+		Fusion:              req.Fusion,
 	}
 
 	// Convert filters
@@ -70,59 +281,266 @@ func (s *SearchService) Search(ctx context.Context, req *SearchRequest) (*Search
 			opts.Filters[k] = v
 		}
 	}
+	if req.Taxon != "" {
+		field, value, err := search.TaxonFilter(s.db, req.Taxon, req.IncludeDescendants)
+		if errors.Is(err, database.ErrTaxonNotFound) {
+			return nil, &ServiceError{Code: ErrCodeUnknownTaxon, Message: err.Error()}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve taxon: %w", err)
+		}
+		if opts.Filters == nil {
+			opts.Filters = make(map[string]interface{})
+		}
+		opts.Filters[field] = value
+	}
 
-	// Perform search
-	result, err := s.manager.Search(req.Query, opts)
+	if req.Cursor != "" && (req.SearchMode == "vector" || req.SearchMode == "hybrid") {
+		return nil, &ServiceError{
+			Code:    ErrCodeInvalidCursor,
+			Message: "cursor pagination is not supported in " + req.SearchMode + " mode",
+		}
+	}
+
+	// Reranking and popularity boosts reorder the top candidates, so they
+	// fetch them all and page through them afterwards
+	candidates := 0
+	if req.BoostPopular {
+		if req.Rerank {
+			return nil, &ServiceError{Code: ErrCodeInvalidOptions, Message: "boost_popular cannot be combined with rerank"}
+		}
+		if req.Cursor != "" {
+			return nil, &ServiceError{Code: ErrCodeInvalidCursor, Message: "cursor pagination is not supported with boost_popular"}
+		}
+		candidates = search.DefaultRerankCandidates
+		opts.Offset = 0
+		opts.Limit = max(candidates, req.Offset+req.Limit)
+	}
+	if req.Rerank {
+		if req.Cursor != "" {
+			return nil, &ServiceError{Code: ErrCodeInvalidCursor, Message: "cursor pagination is not supported with rerank"}
+		}
+		candidates = req.RerankCandidates
+		if candidates <= 0 {
+			candidates = s.rerankCandidates
+		}
+		if candidates <= 0 {
+			candidates = search.DefaultRerankCandidates
+		}
+		candidates = min(candidates, 1000)
+		opts.Offset = 0
+		opts.Limit = max(candidates, req.Offset+req.Limit)
+	}
+
+	// Text searches also match the synonyms of the query's terms; the
+	// embedding and the reranker read the query as written
+	var expansions []search.Expansion
+	textQuery := req.Query
+	textMode := req.SearchMode != "vector" && req.SearchMode != "hybrid"
+	if textMode && !s.noExpand && !req.NoExpand && req.Query != "" {
+		var err error
+		if textQuery, expansions, err = search.ExpandQuery(s.db, req.Query); err != nil {
+			return nil, fmt.Errorf("failed to expand query: %w", err)
+		}
+	}
+
+	return &searchPlan{opts: opts, textQuery: textQuery, expansions: expansions, candidates: candidates}, nil
+}
+
+// searchError converts the errors of a backend search that the request is
+// to blame for to service errors
+func searchError(err error) error {
+	if errors.Is(err, search.ErrInvalidCursor) {
+		return &ServiceError{Code: ErrCodeInvalidCursor, Message: "invalid cursor; start a scan with cursor=*"}
+	}
+	var queryErr *search.QueryError
+	if errors.As(err, &queryErr) {
+		return &ServiceError{Code: ErrCodeInvalidQuery, Message: queryErr.Error()}
+	}
+	return fmt.Errorf("search failed: %w", err)
+}
+
+// boostPopular reorders the first n hits by their scores boosted with how
+// often their records were returned and fetched
+func (s *SearchService) boostPopular(hits []search.Hit, n int) error {
+	ids := make([]string, 0, min(n, len(hits)))
+	for _, hit := range hits[:min(n, len(hits))] {
+		ids = append(ids, hit.ID)
+	}
+	var since time.Time
+	if s.popularityWindow > 0 {
+		since = time.Now().AddDate(0, 0, -s.popularityWindow)
+	}
+	popularity, err := s.db.Popularity(ids, since)
 	if err != nil {
-		return nil, fmt.Errorf("search failed: %w", err)
+		return fmt.Errorf("failed to read popularity: %w", err)
+	}
+	weight := s.popularityWeight
+	if weight <= 0 {
+		weight = search.DefaultPopularityBoost
 	}
+	search.BoostPopular(hits, popularity, weight, n)
+	return nil
+}
+
+// loadReranker returns the cross-encoder reranking results, loading it on
+// first use
+func (s *SearchService) loadReranker() (*embeddings.ONNXReranker, error) {
+	s.rerankOnce.Do(func() {
+		model := s.rerankModel
+		if model == "" {
+			model = embeddings.DefaultRerankModel
+		}
+		embedding := config.DefaultConfig().Embeddings
+		embedding.ModelsDirectory = paths.GetModelsPath()
+		if s.embedding != nil {
+			embedding = *s.embedding
+		}
+		reranker, err := embeddings.NewONNXReranker(model, embedding.ModelsDirectory, embeddings.ONNXOptionsFromConfig(embedding))
+		if err != nil {
+			s.rerankErr = fmt.Errorf("failed to load reranking model: %w", err)
+			return
+		}
+		s.reranker = reranker
+	})
+	return s.reranker, s.rerankErr
+}
 
-	// Convert search results to response
+// newSearchResponse returns the response to a search without its results
+func newSearchResponse(req *SearchRequest, result *search.SearchResult) *SearchResponse {
 	response := &SearchResponse{
-		Results:      make([]*SearchResult, 0, len(result.Hits)),
 		TotalResults: result.TotalHits,
 		Query:        req.Query,
 		TimeTaken:    result.TimeMs,
 		SearchMode:   result.Mode,
+		NextCursor:   result.NextCursor,
+		Reranked:     result.Reranked,
+		Expansions:   result.Expansions,
+		Warning:      result.Warning,
 	}
-
-	// Convert hits to search results
-	for _, hit := range result.Hits {
-		sr := &SearchResult{
-			ID:         hit.ID,
-			Type:       hit.Type,
-			Score:      float32(hit.Score),
-			Similarity: hit.Similarity,
-			Confidence: hit.Confidence,
-			Fields:     hit.Fields,
-			Highlights: hit.Highlights,
+	if len(result.Facets) > 0 {
+		response.Facets = make(map[string]interface{}, len(result.Facets))
+		for field, values := range result.Facets {
+			response.Facets[field] = values
 		}
+	}
+	return response
+}
 
-		// Extract key fields
-		if title, ok := hit.Fields["title"].(string); ok {
-			sr.Title = title
-		} else if title, ok := hit.Fields["study_title"].(string); ok {
-			sr.Title = title
-		}
-		if desc, ok := hit.Fields["description"].(string); ok {
-			sr.Description = desc
-		} else if desc, ok := hit.Fields["study_abstract"].(string); ok {
-			sr.Description = desc
+// newSearchResult converts a search hit to a result, extracting its key
+// fields
+func newSearchResult(hit search.Hit) *SearchResult {
+	sr := &SearchResult{
+		ID:          hit.ID,
+		Type:        hit.Type,
+		Score:       float32(hit.Score),
+		Similarity:  hit.Similarity,
+		Confidence:  hit.Confidence,
+		RerankScore: hit.RerankScore,
+		Fields:      hit.Fields,
+		Highlights:  hit.Highlights,
+	}
+
+	if title, ok := hit.Fields["title"].(string); ok {
+		sr.Title = title
+	} else if title, ok := hit.Fields["study_title"].(string); ok {
+		sr.Title = title
+	}
+	if desc, ok := hit.Fields["description"].(string); ok {
+		sr.Description = desc
+	} else if desc, ok := hit.Fields["study_abstract"].(string); ok {
+		sr.Description = desc
+	}
+	if org, ok := hit.Fields["organism"].(string); ok {
+		sr.Organism = org
+	}
+	if platform, ok := hit.Fields["platform"].(string); ok {
+		sr.Platform = platform
+	}
+	if strategy, ok := hit.Fields["library_strategy"].(string); ok {
+		sr.LibraryStrategy = strategy
+	}
+	return sr
+}
+
+// searchVectors runs a k-NN search over the study embeddings written by
+// 'srake index --build --with-embeddings'
+func (s *SearchService) searchVectors(query string, opts search.SearchOptions) (*search.SearchResult, error) {
+	if query == "" {
+		return nil, fmt.Errorf("vector search needs a query")
+	}
+	vectors, err := s.vectorSearcher()
+	if err != nil {
+		return nil, err
+	}
+	return vectors.Search(query, opts)
+}
+
+// searchHybrid fuses text search results with the nearest studies in the
+// embedding space into a single ranking
+func (s *SearchService) searchHybrid(query string, opts search.SearchOptions) (*search.SearchResult, error) {
+	if query == "" {
+		return nil, fmt.Errorf("hybrid search needs a query")
+	}
+	if err := search.ValidFusion(opts.Fusion); err != nil {
+		return nil, err
+	}
+	vectors, err := s.vectorSearcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Both sides contribute candidates for the requested page
+	textOpts := opts
+	textOpts.Limit = opts.Limit + opts.Offset
+	textOpts.Offset = 0
+	text, err := s.manager.Search(query, textOpts)
+	if err != nil {
+		return nil, err
+	}
+	return vectors.SearchHybrid(query, text.Hits, opts)
+}
+
+// vectorSearcher returns the searcher over the study embeddings, loading
+// them and the embedding model on first use
+func (s *SearchService) vectorSearcher() (*search.VectorSearcher, error) {
+	s.vectorsOnce.Do(func() {
+		indexPath := search.VectorIndexPath(paths.GetEmbeddingsPath())
+		index, err := search.OpenVectorIndex(indexPath)
+		if os.IsNotExist(err) {
+			s.vectorsErr = fmt.Errorf("no study embeddings at %s; build them with 'srake index --build --with-embeddings'", indexPath)
+			return
 		}
-		if org, ok := hit.Fields["organism"].(string); ok {
-			sr.Organism = org
+		if err != nil {
+			s.vectorsErr = err
+			return
 		}
-		if platform, ok := hit.Fields["platform"].(string); ok {
-			sr.Platform = platform
+
+		cfg := config.DefaultConfig()
+		if s.embedding != nil {
+			cfg.Embeddings = *s.embedding
+		} else {
+			cfg.Embeddings.ModelsDirectory = paths.GetModelsPath()
 		}
-		if strategy, ok := hit.Fields["library_strategy"].(string); ok {
-			sr.LibraryStrategy = strategy
+		cfg.Embeddings.Enabled = true
+		embedder, err := embeddings.NewSearchEmbedder(cfg)
+		if err != nil {
+			s.vectorsErr = fmt.Errorf("failed to load embedding model: %w", err)
+			return
 		}
+		s.embedder.Store(embedder)
+		s.vectors = search.NewVectorSearcher(s.db, index, embedder)
+	})
+	return s.vectors, s.vectorsErr
+}
 
-		response.Results = append(response.Results, sr)
+// PendingEmbeddings returns the number of query embeddings waiting for the
+// model or running on it; 0 until vector search is first used
+func (s *SearchService) PendingEmbeddings() int64 {
+	if embedder := s.embedder.Load(); embedder != nil {
+		return embedder.Pending()
 	}
-
-	return response, nil
+	return 0
 }
 
 // BuildIndex builds or rebuilds the search index
@@ -134,6 +552,37 @@ func (s *SearchService) BuildIndex(ctx context.Context, batchSize int, withEmbed
 	return nil
 }
 
+// RebuildIndex rebuilds the search index from the database, calling
+// onProgress after each batch with the documents indexed so far. Searches
+// run while it rebuilds see a partial index.
+func (s *SearchService) RebuildIndex(ctx context.Context, onProgress func(processor.Progress)) error {
+	if s.manager == nil || s.manager.GetBackend() == nil {
+		return fmt.Errorf("search index is not enabled")
+	}
+
+	cfg := *s.config
+	cfg.Search.BatchSize = config.DefaultConfig().Search.BatchSize
+	syncer, err := search.NewSyncer(&cfg, s.db, s.manager.GetBackend())
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+
+	// Estimate the documents to index for the percentage
+	var total int64
+	if stats, err := s.db.EstimateStats(); err == nil {
+		total = int64(stats.TotalStudies + stats.TotalExperiments + stats.TotalSamples + stats.TotalRuns)
+	}
+	start := time.Now()
+	syncer.OnProgress = func(indexed int64) {
+		p := processor.Progress{RecordsProcessed: indexed, TimeElapsed: time.Since(start)}
+		if total > 0 {
+			p.PercentComplete = min(float64(indexed)/float64(total)*100, 100)
+		}
+		onProgress(p)
+	}
+	return syncer.FullSync(ctx)
+}
+
 // GetStats retrieves search statistics
 func (s *SearchService) GetStats(ctx context.Context) (*SearchStats, error) {
 	if s.manager == nil {
@@ -155,13 +604,27 @@ func (s *SearchService) GetStats(ctx context.Context) (*SearchStats, error) {
 
 	stats.TotalDocuments = studyCount + experimentCount + sampleCount + runCount
 
+	// Estimate counts from the sketches when the cache is empty, and the
+	// number of distinct facet values
+	if distinct, err := s.db.DistinctCounts(false); err == nil {
+		stats.Distinct = distinct
+		if len(cachedStats) == 0 {
+			for _, c := range distinct {
+				switch c.Dimension {
+				case database.SketchStudies, database.SketchExperiments, database.SketchSamples, database.SketchRuns:
+					stats.TotalDocuments += c.Count
+				}
+			}
+		}
+	}
+
 	// Get top organisms
 	rows, err := s.db.Query(`
 		SELECT organism, COUNT(*) as count
 		FROM studies
 		WHERE organism IS NOT NULL AND organism != ''
 		GROUP BY organism
-		ORDER BY count DESC
+		ORDER BY count DESC, organism
 		LIMIT 10
 	`)
 	if err == nil {
@@ -181,7 +644,7 @@ func (s *SearchService) GetStats(ctx context.Context) (*SearchStats, error) {
 		FROM experiments
 		WHERE platform IS NOT NULL AND platform != ''
 		GROUP BY platform
-		ORDER BY count DESC
+		ORDER BY count DESC, platform
 		LIMIT 10
 	`)
 	if err == nil {
@@ -201,7 +664,7 @@ func (s *SearchService) GetStats(ctx context.Context) (*SearchStats, error) {
 		FROM experiments
 		WHERE library_strategy IS NOT NULL AND library_strategy != ''
 		GROUP BY library_strategy
-		ORDER BY count DESC
+		ORDER BY count DESC, library_strategy
 		LIMIT 10
 	`)
 	if err == nil {
@@ -222,6 +685,12 @@ func (s *SearchService) GetStats(ctx context.Context) (*SearchStats, error) {
 
 // Close cleans up the search service
 func (s *SearchService) Close() error {
+	if embedder := s.embedder.Load(); embedder != nil {
+		embedder.Close()
+	}
+	if s.reranker != nil {
+		s.reranker.Close()
+	}
 	if s.manager != nil {
 		return s.manager.Close()
 	}
@@ -239,3 +708,29 @@ func (s *SearchService) Health(ctx context.Context) error {
 	}
 	return nil
 }
+
+// Warm opens the search index ahead of the first search, when it is
+// opened lazily
+func (s *SearchService) Warm() error {
+	if s.manager == nil {
+		return nil
+	}
+	return s.manager.Warm()
+}
+
+// SetCacheTTL sets how long search results stay cached; it may be called
+// while searches run
+func (s *SearchService) SetCacheTTL(ttl time.Duration) {
+	if s.manager != nil {
+		s.manager.SetCacheTTL(ttl)
+	}
+}
+
+// Degraded returns the error opening a corrupt search index while text
+// searches fall back to the database, or nil when the index is readable
+func (s *SearchService) Degraded() error {
+	if s.manager == nil {
+		return nil
+	}
+	return s.manager.Degraded()
+}
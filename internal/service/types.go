@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/nishad/srake/internal/database"
+	"github.com/nishad/srake/internal/search"
 )
 
 // SearchRequest represents a search request with all parameters
@@ -12,9 +13,16 @@ type SearchRequest struct {
 	Query   string            `json:"query"`
 	Filters map[string]string `json:"filters,omitempty"`
 
-	// Pagination
-	Limit  int `json:"limit,omitempty"`
-	Offset int `json:"offset,omitempty"`
+	// Taxon restricts results to samples of an NCBI taxon, given by ID or
+	// scientific name, and with IncludeDescendants to the taxa below it
+	Taxon              string `json:"taxon,omitempty"`
+	IncludeDescendants bool   `json:"include_descendants,omitempty"`
+
+	// Pagination. Cursor, when set, replaces Offset: "*" starts a cursor
+	// scan and each response's NextCursor continues it.
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
 
 	// Output control
 	Format string   `json:"format,omitempty"`
@@ -32,6 +40,20 @@ type SearchRequest struct {
 	TopPercentile       int     `json:"top_percentile,omitempty"`
 	ShowConfidence      bool    `json:"show_confidence,omitempty"`
 	HybridWeight        float32 `json:"hybrid_weight,omitempty"`
+	Fusion              string  `json:"fusion,omitempty"`
+
+	// Rerank reorders the top RerankCandidates results, or the configured
+	// number when 0, with a cross-encoder
+	Rerank           bool `json:"rerank,omitempty"`
+	RerankCandidates int  `json:"rerank_candidates,omitempty"`
+
+	// NoExpand searches the query as written, without adding the synonyms
+	// of its terms from loaded vocabularies
+	NoExpand bool `json:"no_expand,omitempty"`
+
+	// BoostPopular ranks the top results higher the more often their
+	// records were returned and fetched through the API
+	BoostPopular bool `json:"boost_popular,omitempty"`
 }
 
 // SearchResponse represents search results
@@ -42,6 +64,25 @@ type SearchResponse struct {
 	TimeTaken    int64                  `json:"time_taken_ms"`
 	SearchMode   string                 `json:"search_mode,omitempty"`
 	Facets       map[string]interface{} `json:"facets,omitempty"`
+	NextCursor   string                 `json:"next_cursor,omitempty"`
+	Reranked     int                    `json:"reranked,omitempty"`
+	Expansions   []search.Expansion     `json:"expansions,omitempty"`
+	Warning      string                 `json:"warning,omitempty"`
+}
+
+// SearchStreamHeader is the first line of a streamed search response,
+// followed by a line for each of the Returned results
+type SearchStreamHeader struct {
+	TotalResults int                    `json:"total_results"`
+	Returned     int                    `json:"returned"`
+	Query        string                 `json:"query"`
+	TimeTaken    int64                  `json:"time_taken_ms"`
+	SearchMode   string                 `json:"search_mode,omitempty"`
+	Facets       map[string]interface{} `json:"facets,omitempty"`
+	NextCursor   string                 `json:"next_cursor,omitempty"`
+	Reranked     int                    `json:"reranked,omitempty"`
+	Expansions   []search.Expansion     `json:"expansions,omitempty"`
+	Warning      string                 `json:"warning,omitempty"`
 }
 
 // SearchResult represents a single search result
@@ -56,6 +97,7 @@ type SearchResult struct {
 	Score           float32                `json:"score,omitempty"`
 	Similarity      float32                `json:"similarity,omitempty"`
 	Confidence      string                 `json:"confidence,omitempty"`
+	RerankScore     float32                `json:"rerank_score,omitempty"`
 	Fields          map[string]interface{} `json:"fields,omitempty"`
 	Highlights      map[string][]string    `json:"highlights,omitempty"`
 }
@@ -94,6 +136,9 @@ type SearchStats struct {
 	TopOrganisms     []StatItem `json:"top_organisms,omitempty"`
 	TopPlatforms     []StatItem `json:"top_platforms,omitempty"`
 	TopStrategies    []StatItem `json:"top_strategies,omitempty"`
+
+	// Estimated record and facet value counts
+	Distinct []database.DistinctCount `json:"distinct,omitempty"`
 }
 
 // StatItem for statistical data
@@ -126,7 +171,7 @@ type CountItem struct {
 type ExportRequest struct {
 	Query   string            `json:"query"`
 	Filters map[string]string `json:"filters,omitempty"`
-	Format  string            `json:"format"` // json, csv, tsv, xml
+	Format  string            `json:"format"` // json, jsonl, csv, tsv, xml or msgpack
 	Limit   int               `json:"limit,omitempty"`
 	Fields  []string          `json:"fields,omitempty"`
 }
@@ -0,0 +1,142 @@
+// Package sketch implements HyperLogLog sketches, which estimate the number
+// of distinct values in a stream in a few kilobytes, however long the
+// stream.
+package sketch
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// DefaultPrecision gives 16384 registers, a 16 KB sketch with a standard
+// error of about 0.8%
+const DefaultPrecision = 14
+
+// encodingVersion is the first byte of a marshalled sketch
+const encodingVersion = 1
+
+// ErrInvalidSketch is returned when unmarshalling data that is not a sketch
+var ErrInvalidSketch = errors.New("invalid sketch encoding")
+
+// HLL is a HyperLogLog sketch. The zero value is not usable; use New.
+type HLL struct {
+	p         uint8
+	registers []uint8
+}
+
+// New returns an empty sketch with 2^precision registers. Precision is
+// clamped to 4-18.
+func New(precision uint8) *HLL {
+	precision = min(max(precision, 4), 18)
+	return &HLL{p: precision, registers: make([]uint8, 1<<precision)}
+}
+
+// Precision returns the sketch's precision.
+func (h *HLL) Precision() uint8 {
+	return h.p
+}
+
+// Add records a value.
+func (h *HLL) Add(value string) {
+	x := hash(value)
+	idx := x >> (64 - h.p)
+	// Rank of the first set bit in the remaining bits; the sentinel bit
+	// bounds it when they are all zero
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Count returns the estimated number of distinct values added.
+func (h *HLL) Count() uint64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha(m) * m * m / sum
+
+	// Linear counting is more accurate while many registers are empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Merge folds other into h, so h estimates the distinct values added to
+// either. Both sketches must have the same precision.
+func (h *HLL) Merge(other *HLL) error {
+	if other.p != h.p {
+		return errors.New("cannot merge sketches of different precision")
+	}
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Empty reports whether no values have been added.
+func (h *HLL) Empty() bool {
+	for _, r := range h.registers {
+		if r != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the sketch as a version byte, the precision and
+// the registers.
+func (h *HLL) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 2+len(h.registers))
+	data[0] = encodingVersion
+	data[1] = h.p
+	copy(data[2:], h.registers)
+	return data, nil
+}
+
+// UnmarshalBinary decodes a sketch written by MarshalBinary.
+func (h *HLL) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != encodingVersion || data[1] < 4 || data[1] > 18 || len(data) != 2+1<<data[1] {
+		return ErrInvalidSketch
+	}
+	h.p = data[1]
+	h.registers = append([]uint8(nil), data[2:]...)
+	return nil
+}
+
+// hash returns a well-mixed 64-bit hash of a value
+func hash(value string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(value))
+	// FNV leaves the high bits poorly mixed for short keys, and the high
+	// bits choose the register; finish with the MurmurHash3 mixer
+	x := f.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// alpha is the bias correction for m registers
+func alpha(m float64) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/m)
+}
@@ -0,0 +1,59 @@
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHLLCount(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		h := New(DefaultPrecision)
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprintf("SRR%07d", i))
+			h.Add(fmt.Sprintf("SRR%07d", i)) // duplicates do not count
+		}
+		got := float64(h.Count())
+		if n == 0 {
+			if got != 0 || !h.Empty() {
+				t.Errorf("empty sketch counted %v", got)
+			}
+			continue
+		}
+		if rel := math.Abs(got-float64(n)) / float64(n); rel > 0.03 {
+			t.Errorf("count of %d values = %v (%.1f%% off)", n, got, rel*100)
+		}
+	}
+}
+
+func TestHLLMergeAndMarshal(t *testing.T) {
+	a, b := New(DefaultPrecision), New(DefaultPrecision)
+	for i := 0; i < 5000; i++ {
+		a.Add(fmt.Sprintf("SRS%d", i))
+		b.Add(fmt.Sprintf("SRS%d", i+2500))
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if got := float64(a.Count()); math.Abs(got-7500)/7500 > 0.03 {
+		t.Errorf("merged count = %v, want about 7500", got)
+	}
+	if err := a.Merge(New(10)); err == nil {
+		t.Error("expected merging sketches of different precision to fail")
+	}
+
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded HLL
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Count() != a.Count() || decoded.Precision() != DefaultPrecision {
+		t.Errorf("decoded sketch counts %d, want %d", decoded.Count(), a.Count())
+	}
+	if err := decoded.UnmarshalBinary(data[:100]); err != ErrInvalidSketch {
+		t.Errorf("expected ErrInvalidSketch for truncated data, got %v", err)
+	}
+}
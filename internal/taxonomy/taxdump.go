@@ -0,0 +1,246 @@
+// Package taxonomy reads the NCBI taxonomy dump (taxdump) and numbers its
+// tree so that the descendants of a taxon form a contiguous range.
+package taxonomy
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DumpURL is where NCBI publishes the taxonomy dump
+const DumpURL = "https://ftp.ncbi.nlm.nih.gov/pub/taxonomy/taxdump.tar.gz"
+
+// RootID is the taxon ID of the root of the NCBI taxonomy
+const RootID = 1
+
+// Index fields written for samples with a known taxon
+const (
+	FieldTaxonID = "taxon_id"      // the sample's own taxon ID
+	FieldLineage = "taxon_lineage" // the IDs of the taxon and all its ancestors
+)
+
+// Ranks are the taxonomic ranks indexed as taxon_<rank> fields, from the
+// top. NCBI renamed superkingdom to domain in 2025; dumps carry one or the
+// other.
+var Ranks = []string{"domain", "superkingdom", "kingdom", "phylum", "class", "order", "family", "genus", "species"}
+
+// RankField returns the index field holding the name of a sample's
+// ancestor at rank, e.g. taxon_order.
+func RankField(rank string) string {
+	return "taxon_" + rank
+}
+
+// Node is a taxon of the dump. Left and Right number the tree in
+// pre-order: the descendants of a node are the nodes whose Left lies
+// between its Left and Right.
+type Node struct {
+	TaxID    int
+	ParentID int
+	Rank     string
+	Name     string
+	Left     int
+	Right    int
+}
+
+// Load reads the nodes and scientific names of a taxdump, given as the
+// taxdump.tar.gz archive or a directory holding nodes.dmp and names.dmp,
+// and numbers the tree.
+func Load(path string) ([]Node, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []Node
+	var names map[int]string
+	if info.IsDir() {
+		if nodes, err = readFile(filepath.Join(path, "nodes.dmp"), ReadNodes); err != nil {
+			return nil, err
+		}
+		if names, err = readFile(filepath.Join(path, "names.dmp"), ReadNames); err != nil {
+			return nil, err
+		}
+	} else if nodes, names, err = readArchive(path); err != nil {
+		return nil, err
+	}
+
+	for i := range nodes {
+		nodes[i].Name = names[nodes[i].TaxID]
+	}
+	if err := Number(nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// readFile parses one dump file
+func readFile[T any](path string, parse func(io.Reader) (T, error)) (T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer f.Close()
+	v, err := parse(f)
+	if err != nil {
+		return v, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return v, nil
+}
+
+// readArchive parses nodes.dmp and names.dmp from taxdump.tar.gz
+func readArchive(path string) ([]Node, map[int]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s is not a gzipped taxdump: %w", filepath.Base(path), err)
+	}
+	defer gz.Close()
+
+	var nodes []Node
+	var names map[int]string
+	tr := tar.NewReader(gz)
+	for nodes == nil || names == nil {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch filepath.Base(hdr.Name) {
+		case "nodes.dmp":
+			if nodes, err = ReadNodes(tr); err != nil {
+				return nil, nil, fmt.Errorf("nodes.dmp: %w", err)
+			}
+		case "names.dmp":
+			if names, err = ReadNames(tr); err != nil {
+				return nil, nil, fmt.Errorf("names.dmp: %w", err)
+			}
+		}
+	}
+	if nodes == nil || names == nil {
+		return nil, nil, fmt.Errorf("%s does not hold nodes.dmp and names.dmp", filepath.Base(path))
+	}
+	return nodes, names, nil
+}
+
+// fields splits a dump line, whose fields are separated by "\t|\t" and
+// which ends in "\t|"
+func fields(line string) []string {
+	line = strings.TrimSuffix(strings.TrimRight(line, "\r\n"), "\t|")
+	return strings.Split(line, "\t|\t")
+}
+
+// ReadNodes parses nodes.dmp: tax ID, parent tax ID and rank, followed by
+// columns srake does not use.
+func ReadNodes(r io.Reader) ([]Node, error) {
+	var nodes []Node
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		f := fields(scanner.Text())
+		if len(f) < 3 {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(f[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad tax ID %q", n, f[0])
+		}
+		parent, err := strconv.Atoi(strings.TrimSpace(f[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad parent tax ID %q", n, f[1])
+		}
+		nodes = append(nodes, Node{TaxID: id, ParentID: parent, Rank: strings.TrimSpace(f[2])})
+	}
+	return nodes, scanner.Err()
+}
+
+// ReadNames parses names.dmp, returning the scientific name of each taxon.
+func ReadNames(r io.Reader) (map[int]string, error) {
+	names := make(map[int]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		f := fields(scanner.Text())
+		if len(f) < 4 || strings.TrimSpace(f[3]) != "scientific name" {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(f[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad tax ID %q", n, f[0])
+		}
+		names[id] = strings.TrimSpace(f[1])
+	}
+	return names, scanner.Err()
+}
+
+// Number sets Left and Right of every node by walking the tree from the
+// root in pre-order, children in tax ID order. Nodes unreachable from the
+// root are an error.
+func Number(nodes []Node) error {
+	index := make(map[int]int, len(nodes))
+	children := make(map[int][]int)
+	for i, n := range nodes {
+		index[n.TaxID] = i
+		if n.TaxID != n.ParentID {
+			children[n.ParentID] = append(children[n.ParentID], n.TaxID)
+		}
+	}
+	if _, ok := index[RootID]; !ok {
+		return fmt.Errorf("taxonomy has no root (tax ID %d)", RootID)
+	}
+	for _, ids := range children {
+		sort.Ints(ids)
+	}
+
+	// Iterative walk: the tree is too deep for comfortable recursion on
+	// some branches, and a cycle must not hang
+	type frame struct {
+		id   int
+		next int // index of the next child to visit
+	}
+	counter := 0
+	visited := 0
+	stack := []frame{{id: RootID}}
+	counter++
+	nodes[index[RootID]].Left = counter
+	visited++
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		kids := children[top.id]
+		if top.next < len(kids) {
+			child := kids[top.next]
+			top.next++
+			i, ok := index[child]
+			if !ok || nodes[i].Left != 0 {
+				continue
+			}
+			counter++
+			nodes[i].Left = counter
+			visited++
+			stack = append(stack, frame{id: child})
+			continue
+		}
+		counter++
+		nodes[index[top.id]].Right = counter
+		stack = stack[:len(stack)-1]
+	}
+
+	if visited != len(nodes) {
+		return fmt.Errorf("%d taxa are not descendants of the root", len(nodes)-visited)
+	}
+	return nil
+}
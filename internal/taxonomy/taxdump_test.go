@@ -0,0 +1,104 @@
+package taxonomy
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testNodes = `1	|	1	|	no rank	|		|
+2759	|	1	|	domain	|		|
+9443	|	2759	|	order	|		|
+9604	|	9443	|	family	|		|
+9606	|	9604	|	species	|		|
+9598	|	9604	|	species	|		|
+10090	|	2759	|	species	|		|
+`
+
+const testNames = `1	|	root	|		|	scientific name	|
+2759	|	Eukaryota	|		|	scientific name	|
+2759	|	eukaryotes	|		|	genbank common name	|
+9443	|	Primates	|		|	scientific name	|
+9604	|	Hominidae	|		|	scientific name	|
+9606	|	Homo sapiens	|		|	scientific name	|
+9606	|	human	|		|	genbank common name	|
+9598	|	Pan troglodytes	|		|	scientific name	|
+10090	|	Mus musculus	|		|	scientific name	|
+`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "nodes.dmp"), []byte(testNodes), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "names.dmp"), []byte(testNames), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same dump as an archive
+	archive := filepath.Join(t.TempDir(), "taxdump.tar.gz")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{"names.dmp": testNames, "citations.dmp": "", "nodes.dmp": testNodes} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	for _, path := range []string{dir, archive} {
+		nodes, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load(%s) failed: %v", path, err)
+		}
+		if len(nodes) != 7 {
+			t.Fatalf("expected 7 nodes, got %d", len(nodes))
+		}
+		byID := make(map[int]Node)
+		for _, n := range nodes {
+			byID[n.TaxID] = n
+		}
+		if n := byID[9606]; n.Name != "Homo sapiens" || n.Rank != "species" || n.ParentID != 9604 {
+			t.Errorf("unexpected node %+v", n)
+		}
+
+		// Primates span the hominids but not the mouse
+		primates := byID[9443]
+		contains := func(outer, inner Node) bool {
+			return inner.Left >= outer.Left && inner.Left <= outer.Right
+		}
+		for _, id := range []int{9604, 9606, 9598} {
+			if !contains(primates, byID[id]) {
+				t.Errorf("expected %d to be a descendant of primates", id)
+			}
+		}
+		if contains(primates, byID[10090]) {
+			t.Error("mouse numbered as a primate")
+		}
+		if root := byID[RootID]; root.Left != 1 || root.Right != 14 {
+			t.Errorf("unexpected root numbering %+v", root)
+		}
+	}
+}
+
+func TestNumberRejectsDetachedTaxa(t *testing.T) {
+	nodes, err := ReadNodes(strings.NewReader(testNodes + "42\t|\t41\t|\tspecies\t|\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Number(nodes); err == nil {
+		t.Error("expected a taxon outside the tree to be rejected")
+	}
+}
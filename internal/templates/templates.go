@@ -0,0 +1,259 @@
+// Package templates holds query templates: named, parameterized sets of
+// search filters for common use cases, such as SARS-CoV-2 wastewater
+// surveillance. Templates are YAML so that they can be reviewed like code
+// and shared between teams. The built-in templates are embedded; those in
+// the templates directory add to them or replace them by name.
+//
+// Example template:
+//
+//	name: covid-wastewater
+//	description: SARS-CoV-2 amplicon sequencing of wastewater
+//	params:
+//	  - name: country
+//	    description: Country to match, e.g. Japan
+//	    required: true
+//	query: SARS-CoV-2 ${country}
+//	filters:
+//	  organism: wastewater metagenome
+//	  library-strategy: AMPLICON
+//
+// Filters are named after the flags of 'srake search'. Parameters are
+// referenced as ${name} in the query and filter values.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nishad/srake/internal/paths"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed builtin/*.yaml
+var builtin embed.FS
+
+// Builtin is the Source of the templates shipped with srake
+const Builtin = "built-in"
+
+// Template is a parameterized search.
+type Template struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Notes       string            `yaml:"notes"`
+	Params      []Param           `yaml:"params"`
+	Query       string            `yaml:"query"`
+	Filters     map[string]string `yaml:"filters"`
+
+	// Source is the file the template was read from, or Builtin
+	Source string `yaml:"-"`
+
+	data []byte
+}
+
+// Param is a value supplied when a template is used.
+type Param struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Default     string `yaml:"default"`
+	Required    bool   `yaml:"required"`
+}
+
+// Parse parses and validates a YAML template.
+func Parse(data []byte) (*Template, error) {
+	var t Template
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&t); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	if t.Name == "" {
+		return nil, fmt.Errorf("template has no name")
+	}
+
+	declared := make(map[string]bool)
+	for _, p := range t.Params {
+		if p.Name == "" {
+			return nil, fmt.Errorf("template %s: parameter has no name", t.Name)
+		}
+		if declared[p.Name] {
+			return nil, fmt.Errorf("template %s: parameter %q is declared twice", t.Name, p.Name)
+		}
+		declared[p.Name] = true
+	}
+
+	// Every reference must name a declared parameter
+	var undeclared []string
+	check := func(s string) {
+		os.Expand(s, func(name string) string {
+			if !declared[name] {
+				undeclared = append(undeclared, name)
+			}
+			return ""
+		})
+	}
+	check(t.Query)
+	for _, v := range t.Filters {
+		check(v)
+	}
+	if len(undeclared) > 0 {
+		return nil, fmt.Errorf("template %s: undeclared parameter %q", t.Name, undeclared[0])
+	}
+
+	t.data = data
+	return &t, nil
+}
+
+// YAML returns the source of the template
+func (t *Template) YAML() []byte {
+	return t.data
+}
+
+// Expand substitutes values, falling back to the parameter defaults, into
+// the template. It returns the query and the non-empty filters.
+func (t *Template) Expand(values map[string]string) (string, map[string]string, error) {
+	resolved := make(map[string]string, len(t.Params))
+	for _, p := range t.Params {
+		v, ok := values[p.Name]
+		if !ok {
+			v = p.Default
+		}
+		if p.Required && strings.TrimSpace(v) == "" {
+			return "", nil, fmt.Errorf("template %s requires --param %s=<%s>", t.Name, p.Name, p.Description)
+		}
+		resolved[p.Name] = v
+	}
+	for name := range values {
+		if _, ok := resolved[name]; !ok {
+			return "", nil, fmt.Errorf("template %s has no parameter %q (parameters: %s)", t.Name, name, strings.Join(t.paramNames(), ", "))
+		}
+	}
+
+	expand := func(s string) string {
+		return strings.Join(strings.Fields(os.Expand(s, func(name string) string { return resolved[name] })), " ")
+	}
+	filters := make(map[string]string, len(t.Filters))
+	for name, v := range t.Filters {
+		if v = expand(v); v != "" {
+			filters[name] = v
+		}
+	}
+	return expand(t.Query), filters, nil
+}
+
+func (t *Template) paramNames() []string {
+	names := make([]string, len(t.Params))
+	for i, p := range t.Params {
+		names[i] = p.Name
+	}
+	if len(names) == 0 {
+		return []string{"none"}
+	}
+	return names
+}
+
+// ParseParams parses --param values of the form name=value
+func ParseParams(args []string) (map[string]string, error) {
+	values := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid parameter %q (expected name=value)", arg)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// Load returns the template with the given name, looking in the templates
+// directory before the built-in templates. A name ending in .yaml or .yml,
+// or containing a path separator, is read as a file.
+func Load(name string) (*Template, error) {
+	if isPath(name) {
+		return loadFile(name)
+	}
+
+	path := filepath.Join(paths.GetTemplatesPath(), name+".yaml")
+	if _, err := os.Stat(path); err == nil {
+		return loadFile(path)
+	}
+
+	data, err := builtin.ReadFile("builtin/" + name + ".yaml")
+	if err != nil {
+		return nil, fmt.Errorf("unknown template %q (run 'srake templates' to list them)", name)
+	}
+	return parseBuiltin(data)
+}
+
+// List returns all templates sorted by name. Templates in the templates
+// directory replace built-in templates of the same name.
+func List() ([]*Template, error) {
+	byName := make(map[string]*Template)
+
+	entries, err := fs.ReadDir(builtin, "builtin")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		data, err := builtin.ReadFile("builtin/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		t, err := parseBuiltin(data)
+		if err != nil {
+			return nil, err
+		}
+		byName[t.Name] = t
+	}
+
+	files, _ := filepath.Glob(filepath.Join(paths.GetTemplatesPath(), "*.yaml"))
+	for _, path := range files {
+		t, err := loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		byName[t.Name] = t
+	}
+
+	list := make([]*Template, 0, len(byName))
+	for _, t := range byName {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func loadFile(path string) (*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	t, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t.Source = path
+	return t, nil
+}
+
+func parseBuiltin(data []byte) (*Template, error) {
+	t, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	t.Source = Builtin
+	return t, nil
+}
+
+func isPath(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml" || strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/')
+}
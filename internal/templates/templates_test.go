@@ -0,0 +1,140 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinTemplates(t *testing.T) {
+	t.Setenv("SRAKE_TEMPLATES_PATH", t.TempDir())
+
+	list, err := List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) < 3 {
+		t.Fatalf("expected the built-in templates, got %d", len(list))
+	}
+	for _, tpl := range list {
+		if tpl.Source != Builtin || tpl.Description == "" {
+			t.Errorf("%s: unexpected source %q or missing description", tpl.Name, tpl.Source)
+		}
+		// Defaults alone expand every built-in template
+		if _, _, err := tpl.Expand(nil); err != nil {
+			t.Errorf("%s: %v", tpl.Name, err)
+		}
+	}
+
+	tpl, err := Load("covid-wastewater")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	query, filters, err := tpl.Expand(map[string]string{"country": "Japan"})
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+	if query != "SARS-CoV-2 Japan" {
+		t.Errorf("unexpected query %q", query)
+	}
+	if filters["organism"] != "wastewater metagenome" || filters["date-from"] != "2020-01-01" {
+		t.Errorf("unexpected filters %v", filters)
+	}
+
+	if _, err := Load("missing"); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tpl, err := Parse([]byte(`
+name: test
+params:
+  - name: tissue
+    required: true
+  - name: strategy
+    default: RNA-Seq
+  - name: since
+query: ${tissue} atlas
+filters:
+  library-strategy: ${strategy}
+  date-from: ${since}
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if _, _, err := tpl.Expand(nil); err == nil || !strings.Contains(err.Error(), "--param tissue") {
+		t.Errorf("expected a missing parameter error, got %v", err)
+	}
+	if _, _, err := tpl.Expand(map[string]string{"tissue": "liver", "organ": "x"}); err == nil {
+		t.Error("expected an unknown parameter error")
+	}
+
+	query, filters, err := tpl.Expand(map[string]string{"tissue": "liver"})
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+	if query != "liver atlas" {
+		t.Errorf("unexpected query %q", query)
+	}
+	// An empty value drops its filter
+	if len(filters) != 1 || filters["library-strategy"] != "RNA-Seq" {
+		t.Errorf("unexpected filters %v", filters)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		"query: x",
+		"name: t\nquery: ${missing}",
+		"name: t\nparams: [{name: a}, {name: a}]",
+		"name: t\nfilter: {}",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	values, err := ParseParams([]string{"country=JP", "note=a=b"})
+	if err != nil || values["country"] != "JP" || values["note"] != "a=b" {
+		t.Errorf("unexpected result %v, %v", values, err)
+	}
+	if _, err := ParseParams([]string{"country"}); err == nil {
+		t.Error("expected an error without =")
+	}
+}
+
+func TestUserTemplates(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SRAKE_TEMPLATES_PATH", dir)
+
+	// A team template replaces the built-in one of the same name
+	data := []byte("name: gut-microbiome\ndescription: Our gut cohort\nquery: stool\n")
+	if err := os.WriteFile(filepath.Join(dir, "gut-microbiome.yaml"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := Load("gut-microbiome")
+	if err != nil || tpl.Description != "Our gut cohort" || string(tpl.YAML()) != string(data) {
+		t.Fatalf("expected the team template, got %+v, %v", tpl, err)
+	}
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range list {
+		if l.Name == "gut-microbiome" && l.Source == Builtin {
+			t.Error("List kept the replaced built-in template")
+		}
+	}
+
+	// A path is read directly
+	path := filepath.Join(t.TempDir(), "shared.yml")
+	os.WriteFile(path, []byte("name: shared\n"), 0644)
+	if tpl, err := Load(path); err != nil || tpl.Name != "shared" || tpl.Source != path {
+		t.Errorf("Load(%s) = %+v, %v", path, tpl, err)
+	}
+}
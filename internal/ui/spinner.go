@@ -5,6 +5,8 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"github.com/nishad/srake/internal/i18n"
 )
 
 // Spinner provides a simple command-line spinner for long-running operations
@@ -108,7 +110,7 @@ func ShowSpinner(message string, fn func() error) error {
 	if err != nil {
 		spinner.Stop(fmt.Sprintf("✗ %s", err.Error()))
 	} else {
-		spinner.Stop("✓ Done")
+		spinner.Stop("✓ " + i18n.T("progress.done"))
 	}
 	return err
 }
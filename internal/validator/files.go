@@ -0,0 +1,169 @@
+package validator
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileResult is the validation result of one XML file. Path names the
+// file on disk, and Member the file inside it when it is a tar archive.
+// Result is nil when the file could not be read, as Error then says.
+type FileResult struct {
+	Path   string            `json:"path"`
+	Member string            `json:"member,omitempty"`
+	Result *ValidationResult `json:"result,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// Name returns the path of the file, with the member of an archive after
+// a colon
+func (r *FileResult) Name() string {
+	if r.Member != "" {
+		return r.Path + ":" + r.Member
+	}
+	return r.Path
+}
+
+// Failed reports whether the file could not be read or has errors
+func (r *FileResult) Failed() bool {
+	return r.Error != "" || (r.Result != nil && len(r.Result.Errors) > 0)
+}
+
+// xmlExtensions are the extensions of the files ValidatePath reads in a
+// directory
+var xmlExtensions = []string{".xml", ".xml.gz", ".tar", ".tar.gz", ".tgz"}
+
+// ValidatePath validates the SRA XML documents at path: an XML document,
+// gzipped or plain, the XML documents in a tar or tar.gz archive, or the
+// documents and archives under a directory, in path order. A file that
+// cannot be read is reported in its result rather than failing the rest;
+// the error returned is for a path that cannot be read at all.
+func (v *Validator) ValidatePath(path string) ([]FileResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return v.validateFile(path), nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && hasXMLExtension(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var results []FileResult
+	for _, f := range files {
+		results = append(results, v.validateFile(f)...)
+	}
+	return results, nil
+}
+
+// hasXMLExtension reports whether a file in a directory is read by
+// ValidatePath
+func hasXMLExtension(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range xmlExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFile validates an XML document or the documents of a tar
+// archive, either optionally gzipped
+func (v *Validator) validateFile(path string) []FileResult {
+	failed := func(err error) []FileResult {
+		return []FileResult{{Path: path, Error: err.Error()}}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return failed(err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 64*1024)
+	if isGzip(br) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return failed(fmt.Errorf("failed to read gzip: %w", err))
+		}
+		defer gz.Close()
+		br = bufio.NewReaderSize(gz, 64*1024)
+	}
+
+	if isTar(br) {
+		return v.validateTar(path, br)
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return failed(err)
+	}
+	return []FileResult{v.validateDocument(path, "", data)}
+}
+
+// validateTar validates the XML documents of a tar archive
+func (v *Validator) validateTar(path string, r io.Reader) []FileResult {
+	var results []FileResult
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return append(results, FileResult{Path: path, Error: fmt.Sprintf("failed to read tar archive: %v", err)})
+		}
+		if header.Typeflag != tar.TypeReg || !strings.HasSuffix(strings.ToLower(header.Name), ".xml") {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return append(results, FileResult{Path: path, Member: header.Name, Error: err.Error()})
+		}
+		results = append(results, v.validateDocument(path, header.Name, data))
+	}
+	return results
+}
+
+// validateDocument validates one XML document
+func (v *Validator) validateDocument(path, member string, data []byte) FileResult {
+	result, err := v.ValidateXML(data)
+	if err != nil {
+		return FileResult{Path: path, Member: member, Error: err.Error()}
+	}
+	return FileResult{Path: path, Member: member, Result: result}
+}
+
+// isGzip reports whether a buffered stream starts with the gzip magic
+func isGzip(br *bufio.Reader) bool {
+	head, _ := br.Peek(2)
+	return len(head) == 2 && head[0] == 0x1f && head[1] == 0x8b
+}
+
+// isTar reports whether a buffered stream starts with a ustar header
+func isTar(br *bufio.Reader) bool {
+	head, _ := br.Peek(262)
+	return len(head) == 262 && bytes.Equal(head[257:262], []byte("ustar"))
+}
@@ -0,0 +1,154 @@
+package validator
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+)
+
+// SARIF 2.1.0, the format code scanning tools such as GitHub's read
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// ruleReadError is the rule of files that could not be read
+const ruleReadError = "READ_ERROR"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool      sarifTool       `json:"tool"`
+	Artifacts []sarifArtifact `json:"artifacts,omitempty"`
+	Results   []sarifResult   `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version,omitempty"`
+	Rules   []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+// sarifArtifact is a file; a member of a tar archive names the archive as
+// its parent
+type sarifArtifact struct {
+	Location    sarifArtifactLocation `json:"location"`
+	ParentIndex *int                  `json:"parentIndex,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI   string `json:"uri"`
+	Index *int   `json:"index,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// WriteSARIF writes the errors and warnings of results to w as a SARIF
+// log of a tool with the given name and version, one result per error or
+// warning, for code scanning in submission pipelines
+func WriteSARIF(w io.Writer, results []FileResult, tool, version string) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: tool, Version: version}},
+		Results: []sarifResult{},
+	}
+	rules := make(map[string]bool)
+	artifacts := make(map[string]int)
+
+	// artifact returns the index of the artifact of a file, adding it and
+	// the archive it is in
+	artifact := func(path, member string) int {
+		uri := filepath.ToSlash(path)
+		index, ok := artifacts[uri]
+		if !ok {
+			index = len(run.Artifacts)
+			artifacts[uri] = index
+			run.Artifacts = append(run.Artifacts, sarifArtifact{Location: sarifArtifactLocation{URI: uri}})
+		}
+		if member == "" {
+			return index
+		}
+		parent := index
+		key := uri + ":" + member
+		if index, ok = artifacts[key]; !ok {
+			index = len(run.Artifacts)
+			artifacts[key] = index
+			run.Artifacts = append(run.Artifacts, sarifArtifact{Location: sarifArtifactLocation{URI: member}, ParentIndex: &parent})
+		}
+		return index
+	}
+
+	add := func(r *FileResult, rule, level, message string, line, column int) {
+		if !rules[rule] {
+			rules[rule] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: rule})
+		}
+		index := artifact(r.Path, r.Member)
+		uri := run.Artifacts[index].Location.URI
+		loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri, Index: &index}}
+		if line > 0 {
+			loc.Region = &sarifRegion{StartLine: line, StartColumn: column}
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    rule,
+			Level:     level,
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{{PhysicalLocation: loc}},
+		})
+	}
+
+	for i := range results {
+		r := &results[i]
+		if r.Error != "" {
+			add(r, ruleReadError, "error", r.Error, 0, 0)
+			continue
+		}
+		if r.Result == nil {
+			continue
+		}
+		for _, e := range r.Result.Errors {
+			add(r, e.Type, "error", e.Message, e.Line, e.Column)
+		}
+		for _, w := range r.Result.Warnings {
+			add(r, w.Type, "warning", w.Message, 0, 0)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
@@ -0,0 +1,517 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// xsiNamespace is the namespace of instance attributes such as
+// xsi:noNamespaceSchemaLocation, which schemas do not declare
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// xmlElement is an element of the document validated, with the line and
+// column its start tag begins at
+type xmlElement struct {
+	name         string
+	attrs        []xml.Attr
+	text         strings.Builder
+	children     []*xmlElement
+	line, column int
+}
+
+// parseDocument reads an XML document into a tree of elements, returning
+// the line of a syntax error
+func parseDocument(data []byte) (*xmlElement, int, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		line, column := decoder.InputPos()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntax *xml.SyntaxError
+			if errors.As(err, &syntax) {
+				line = syntax.Line
+			}
+			return nil, line, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			e := &xmlElement{name: t.Name.Local, attrs: t.Attr, line: line, column: column}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root == nil {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, 1, fmt.Errorf("no root element")
+	}
+	return root, 0, nil
+}
+
+// schemaValidation validates a document against a schema, adding each
+// problem to the result with its line and column
+type schemaValidation struct {
+	schema *xsdSchema
+	result *ValidationResult
+}
+
+func (sv *schemaValidation) fail(e *xmlElement, errType, format string, args ...interface{}) {
+	sv.result.Errors = append(sv.result.Errors, ValidationError{
+		Type:    errType,
+		Field:   e.name,
+		Message: fmt.Sprintf(format, args...),
+		Line:    e.line,
+		Column:  e.column,
+	})
+}
+
+// validateSchema validates a document against the bundled SRA XSDs in
+// place of the built-in checks
+func (v *Validator) validateSchema(xmlData []byte, result *ValidationResult) error {
+	schema, err := loadSRASchema()
+	if err != nil {
+		return fmt.Errorf("failed to load the SRA schemas: %w", err)
+	}
+
+	root, line, err := parseDocument(xmlData)
+	if err != nil {
+		result.Errors = append(result.Errors, ValidationError{
+			Type:    "XML_PARSE_ERROR",
+			Message: fmt.Sprintf("XML parsing error: %v", err),
+			Line:    line,
+		})
+		return nil
+	}
+	result.DocType = strings.ToLower(strings.TrimSuffix(root.name, "_SET"))
+
+	sv := &schemaValidation{schema: schema, result: result}
+	decl, ok := schema.elements[root.name]
+	if !ok {
+		sv.fail(root, "UNKNOWN_ROOT", "No SRA schema declares the root element %s", root.name)
+		return nil
+	}
+	sv.element(root, decl)
+
+	// Content errors are found before those of the children; report them
+	// in document order
+	slices.SortStableFunc(result.Errors, func(a, b ValidationError) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return nil
+}
+
+// element validates an element against its declaration
+func (sv *schemaValidation) element(e *xmlElement, decl *elementDecl) {
+	sv.result.Stats.ElementsValidated++
+	switch {
+	case decl.complex != nil:
+		sv.complex(e, decl.complex)
+	case decl.simple != nil:
+		sv.simple(e, func(value string) error { return sv.schema.checkSimple(decl.simple, value) })
+	case decl.typeName == anyType:
+	default:
+		if ct, ok := sv.schema.complexTypes[decl.typeName]; ok {
+			sv.complex(e, ct)
+			return
+		}
+		sv.simple(e, func(value string) error { return sv.schema.checkType(decl.typeName, value) })
+	}
+}
+
+// simple validates an element of a simple type, which has neither
+// attributes nor children
+func (sv *schemaValidation) simple(e *xmlElement, check func(string) error) {
+	for _, a := range e.attrs {
+		if !instanceAttribute(a) {
+			sv.fail(e, "UNEXPECTED_ATTRIBUTE", "Attribute %s is not allowed on %s", a.Name.Local, e.name)
+		}
+	}
+	if len(e.children) > 0 {
+		sv.fail(e.children[0], "UNEXPECTED_ELEMENT", "Element %s is not allowed in %s, which holds text only", e.children[0].name, e.name)
+		return
+	}
+	if err := check(e.text.String()); err != nil {
+		sv.fail(e, "INVALID_VALUE", "%s: %v", e.name, err)
+	}
+}
+
+// complex validates the attributes and content of an element of a complex
+// type, and its children
+func (sv *schemaValidation) complex(e *xmlElement, ct *complexType) {
+	attrs := sv.schema.attributesOf(ct)
+	present := make(map[string]bool)
+	for _, a := range e.attrs {
+		if instanceAttribute(a) {
+			continue
+		}
+		present[a.Name.Local] = true
+		decl, ok := attrs[a.Name.Local]
+		if !ok {
+			sv.fail(e, "UNEXPECTED_ATTRIBUTE", "Attribute %s is not allowed on %s", a.Name.Local, e.name)
+			continue
+		}
+		sv.result.Stats.AttributesChecked++
+		var err error
+		if decl.simple != nil {
+			err = sv.schema.checkSimple(decl.simple, a.Value)
+		} else {
+			err = sv.schema.checkType(decl.typeName, a.Value)
+		}
+		if err != nil {
+			sv.fail(e, "INVALID_VALUE", "Attribute %s of %s: %v", a.Name.Local, e.name, err)
+		}
+	}
+	for _, name := range sortedKeys(attrs) {
+		if attrs[name].required && !present[name] {
+			sv.fail(e, "MISSING_ATTRIBUTE", "%s is missing the required attribute %s", e.name, name)
+		}
+	}
+
+	// Simple content: text of the type extended
+	if base := sv.schema.valueType(ct); base != "" {
+		if len(e.children) > 0 {
+			sv.fail(e.children[0], "UNEXPECTED_ELEMENT", "Element %s is not allowed in %s, which holds text only", e.children[0].name, e.name)
+		} else if err := sv.schema.checkType(base, e.text.String()); err != nil {
+			sv.fail(e, "INVALID_VALUE", "%s: %v", e.name, err)
+		}
+		return
+	}
+
+	if strings.TrimSpace(e.text.String()) != "" {
+		sv.fail(e, "UNEXPECTED_TEXT", "%s may only contain elements, not text", e.name)
+	}
+	sv.content(e, ct)
+	for _, child := range e.children {
+		if decl, ok := ct.elements[child.name]; ok {
+			sv.element(child, decl)
+		}
+	}
+}
+
+// content checks the children of an element against its content model,
+// reporting the first child that does not fit, or the elements missing
+func (sv *schemaValidation) content(e *xmlElement, ct *complexType) {
+	if ct.content == nil {
+		if len(e.children) > 0 {
+			sv.fail(e.children[0], "UNEXPECTED_ELEMENT", "Element %s is not allowed in %s, which must be empty", e.children[0].name, e.name)
+		}
+		return
+	}
+
+	m := &contentMatcher{tried: make(map[int][]string)}
+	for _, child := range e.children {
+		m.names = append(m.names, child.name)
+	}
+	ends := m.match(ct.content, []int{0})
+	if slices.Contains(ends, len(m.names)) {
+		return
+	}
+
+	// The furthest any match got is where the children went wrong
+	furthest := 0
+	for _, end := range ends {
+		furthest = max(furthest, end)
+	}
+	for pos := range m.tried {
+		furthest = max(furthest, pos)
+	}
+	expected := m.expected(furthest)
+	if furthest < len(e.children) {
+		child := e.children[furthest]
+		if expected == "" {
+			sv.fail(child, "UNEXPECTED_ELEMENT", "Element %s is not expected in %s", child.name, e.name)
+		} else {
+			sv.fail(child, "UNEXPECTED_ELEMENT", "Element %s is not expected in %s; expected %s", child.name, e.name, expected)
+		}
+		return
+	}
+	sv.fail(e, "MISSING_ELEMENT", "%s is incomplete; expected %s", e.name, expected)
+}
+
+// contentMatcher matches the names of an element's children against a
+// content model, remembering the elements tried at each position for
+// error messages
+type contentMatcher struct {
+	names []string
+	tried map[int][]string
+}
+
+// match returns the positions the particle can end at, repeated between
+// its minOccurs and maxOccurs, when started at any of from
+func (m *contentMatcher) match(p *particle, from []int) []int {
+	ends := make(map[int]bool)
+	if p.min == 0 {
+		for _, i := range from {
+			ends[i] = true
+		}
+	}
+	limit := p.max
+	if limit == unbounded {
+		// Every repetition beyond these consumes nothing new
+		limit = len(m.names) + p.min + 1
+	}
+	current := from
+	for count := 1; count <= limit && len(current) > 0; count++ {
+		next := m.once(p, current)
+		if count >= p.min {
+			// Repeating from a position already reached ends where it did
+			// before, so only new positions go on
+			current = current[:0:0]
+			for _, i := range next {
+				if !ends[i] {
+					ends[i] = true
+					current = append(current, i)
+				}
+			}
+		} else {
+			current = next
+		}
+	}
+	return sortedPositions(ends)
+}
+
+// once returns the positions the particle can end at when matched once
+func (m *contentMatcher) once(p *particle, from []int) []int {
+	var ends []int
+	switch p.kind {
+	case particleElement:
+		for _, i := range from {
+			if i < len(m.names) && m.names[i] == p.element.name {
+				ends = union(ends, []int{i + 1})
+			} else {
+				m.tried[i] = append(m.tried[i], p.element.name)
+			}
+		}
+	case particleSequence:
+		ends = from
+		for _, c := range p.children {
+			if ends = m.match(c, ends); len(ends) == 0 {
+				break
+			}
+		}
+	case particleChoice:
+		for _, c := range p.children {
+			ends = union(ends, m.match(c, from))
+		}
+	case particleAll:
+		for _, i := range from {
+			if end, ok := m.all(p, i); ok {
+				ends = union(ends, []int{end})
+			}
+		}
+	}
+	return ends
+}
+
+// all matches the elements of an all group, in any order, from position i
+func (m *contentMatcher) all(p *particle, i int) (int, bool) {
+	seen := make(map[string]bool)
+	for ; i < len(m.names); i++ {
+		found := false
+		for _, c := range p.children {
+			if c.element != nil && c.element.name == m.names[i] && !seen[m.names[i]] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		seen[m.names[i]] = true
+	}
+
+	// Expected next are the required elements missing, or without them
+	// any element not seen
+	var missing, unseen []string
+	for _, c := range p.children {
+		if c.element == nil || seen[c.element.name] {
+			continue
+		}
+		unseen = append(unseen, c.element.name)
+		if c.min > 0 {
+			missing = append(missing, c.element.name)
+		}
+	}
+	if len(missing) > 0 {
+		m.tried[i] = append(m.tried[i], missing...)
+		return i, false
+	}
+	m.tried[i] = append(m.tried[i], unseen...)
+	return i, true
+}
+
+// expected lists the elements tried at a position
+func (m *contentMatcher) expected(pos int) string {
+	names := slices.Clone(m.tried[pos])
+	slices.Sort(names)
+	names = slices.Compact(names)
+	if len(names) == 1 {
+		return names[0]
+	}
+	if len(names) > 1 {
+		return "one of " + strings.Join(names, ", ")
+	}
+	return ""
+}
+
+// sortedPositions returns a set of positions in order
+func sortedPositions(set map[int]bool) []int {
+	out := make([]int, 0, len(set))
+	for i := range set {
+		out = append(out, i)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// union returns the positions in either a or b, in order
+func union(a, b []int) []int {
+	out := append(slices.Clone(a), b...)
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// attributesOf returns the attributes of a complex type by name, with those
+// of its attribute groups and of the type it extends
+func (s *xsdSchema) attributesOf(ct *complexType) map[string]*attributeDecl {
+	attrs := make(map[string]*attributeDecl)
+	for ; ct != nil; ct = s.complexTypes[ct.base] {
+		for _, a := range ct.attributes {
+			attrs[a.name] = a
+		}
+		for _, group := range ct.groups {
+			for _, a := range s.attributeGroups[group] {
+				attrs[a.name] = a
+			}
+		}
+		if ct.base == "" {
+			break
+		}
+	}
+	return attrs
+}
+
+// valueType returns the simple type of the text of a complex type with
+// simple content, or "" for a type with element content
+func (s *xsdSchema) valueType(ct *complexType) string {
+	for ct.base != "" {
+		base, ok := s.complexTypes[ct.base]
+		if !ok {
+			return ct.base
+		}
+		ct = base
+	}
+	return ""
+}
+
+// checkType checks a value against a named simple type or a built-in one
+func (s *xsdSchema) checkType(name, value string) error {
+	if st, ok := s.simpleTypes[name]; ok {
+		return s.checkSimple(st, value)
+	}
+	return checkBuiltin(name, value)
+}
+
+// checkSimple checks a value against a restriction of a base type
+func (s *xsdSchema) checkSimple(st *simpleType, value string) error {
+	if err := s.checkType(st.base, value); err != nil {
+		return err
+	}
+	if len(st.enums) == 0 {
+		return nil
+	}
+	v := value
+	if st.base != "xs:string" {
+		v = strings.Join(strings.Fields(value), " ")
+	}
+	if slices.Contains(st.enums, v) {
+		return nil
+	}
+	if len(st.enums) <= 12 {
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(st.enums, ", "))
+	}
+	return fmt.Errorf("%q is not one of the %d allowed values", value, len(st.enums))
+}
+
+var (
+	dateTimePattern = regexp.MustCompile(`^-?\d{4,}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+	datePattern     = regexp.MustCompile(`^-?\d{4,}-\d{2}-\d{2}(Z|[+-]\d{2}:\d{2})?$`)
+)
+
+// checkBuiltin checks a value against a built-in XML Schema type; types
+// the SRA schemas do not use are not checked
+func checkBuiltin(name, value string) error {
+	v := strings.TrimSpace(value)
+	var err error
+	switch name {
+	case "xs:int":
+		_, err = strconv.ParseInt(strings.TrimPrefix(v, "+"), 10, 32)
+	case "xs:integer":
+		_, err = strconv.ParseInt(strings.TrimPrefix(v, "+"), 10, 64)
+	case "xs:nonNegativeInteger":
+		_, err = strconv.ParseUint(strings.TrimPrefix(v, "+"), 10, 64)
+	case "xs:float", "xs:double":
+		if v != "INF" && v != "-INF" && v != "NaN" {
+			_, err = strconv.ParseFloat(v, 64)
+		}
+	case "xs:boolean":
+		if v != "true" && v != "false" && v != "1" && v != "0" {
+			err = errors.New("invalid syntax")
+		}
+	case "xs:dateTime":
+		if !dateTimePattern.MatchString(v) {
+			err = errors.New("invalid syntax")
+		}
+	case "xs:date":
+		if !datePattern.MatchString(v) {
+			err = errors.New("invalid syntax")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", value, strings.TrimPrefix(name, "xs:"))
+	}
+	return nil
+}
+
+// instanceAttribute reports whether an attribute belongs to the document
+// rather than the schema, such as namespace declarations
+func instanceAttribute(a xml.Attr) bool {
+	switch a.Name.Space {
+	case "xmlns", "xml", "xsi", xsiNamespace:
+		return true
+	}
+	return a.Name.Local == "xmlns"
+}
+
+func sortedKeys(m map[string]*attributeDecl) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
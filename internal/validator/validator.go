@@ -19,7 +19,11 @@ type ValidationConfig struct {
 	ValidateEnumerations bool
 	ValidateReferences   bool
 	ValidateRequired     bool
-	StrictMode           bool
+	StrictMode           bool // report warnings as errors
+
+	// Schema validates documents against the bundled official SRA XSDs
+	// in place of the checks above
+	Schema bool
 }
 
 // NewValidator creates a new validator
@@ -56,6 +60,7 @@ type ValidationError struct {
 	Field   string `json:"field,omitempty"`
 	Message string `json:"message"`
 	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
 }
 
 // ValidationWarning represents a validation warning
@@ -81,6 +86,14 @@ func (v *Validator) ValidateXML(xmlData []byte) (*ValidationResult, error) {
 		Stats:    ValidationStats{},
 	}
 
+	if v.config.Schema {
+		if err := v.validateSchema(xmlData, result); err != nil {
+			return result, err
+		}
+		result.IsValid = len(result.Errors) == 0
+		return result, nil
+	}
+
 	// Determine document type
 	docType := v.detectDocumentType(xmlData)
 	result.DocType = docType
@@ -111,14 +124,48 @@ func (v *Validator) ValidateXML(xmlData []byte) (*ValidationResult, error) {
 		})
 	}
 
+	// In strict mode, warnings fail the document too
+	if v.config.StrictMode {
+		for _, w := range result.Warnings {
+			result.Errors = append(result.Errors, ValidationError{Type: w.Type, Field: w.Field, Message: w.Message})
+		}
+		result.Warnings = []ValidationWarning{}
+	}
+
 	// Set overall validity
 	result.IsValid = len(result.Errors) == 0
 
 	return result, nil
 }
 
-// detectDocumentType determines the type of SRA document
+// documentTypes maps record and record set elements to document types
+var documentTypes = map[string]string{
+	"STUDY": "study", "STUDY_SET": "study",
+	"SAMPLE": "sample", "SAMPLE_SET": "sample",
+	"EXPERIMENT": "experiment", "EXPERIMENT_SET": "experiment",
+	"RUN": "run", "RUN_SET": "run",
+	"ANALYSIS": "analysis", "ANALYSIS_SET": "analysis",
+	"SUBMISSION": "submission", "SUBMISSION_SET": "submission",
+}
+
+// detectDocumentType determines the type of SRA document from its first
+// record or record set element, so that an experiment's STUDY_REF does not
+// make it a study
 func (v *Validator) detectDocumentType(xmlData []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(xmlData))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			if docType, ok := documentTypes[se.Name.Local]; ok {
+				return docType
+			}
+		}
+	}
+
+	// Malformed documents are typed by the elements they mention
 	if bytes.Contains(xmlData, []byte("<STUDY")) || bytes.Contains(xmlData, []byte("<STUDY_SET")) {
 		return "study"
 	} else if bytes.Contains(xmlData, []byte("<SAMPLE")) || bytes.Contains(xmlData, []byte("<SAMPLE_SET")) {
@@ -1,6 +1,13 @@
 package validator
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -47,6 +54,7 @@ func TestDetectDocumentType(t *testing.T) {
 		{"sample set", `<SAMPLE_SET><SAMPLE accession="SRS000001"></SAMPLE></SAMPLE_SET>`, "sample"},
 		{"experiment", `<EXPERIMENT accession="SRX000001"><TITLE>Test</TITLE></EXPERIMENT>`, "experiment"},
 		{"experiment set", `<EXPERIMENT_SET><EXPERIMENT></EXPERIMENT></EXPERIMENT_SET>`, "experiment"},
+		{"experiment with study ref", `<EXPERIMENT accession="SRX000001"><STUDY_REF accession="SRP000001"/></EXPERIMENT>`, "experiment"},
 		{"run", `<RUN accession="SRR000001"></RUN>`, "run"},
 		{"run set", `<RUN_SET><RUN></RUN></RUN_SET>`, "run"},
 		{"analysis", `<ANALYSIS accession="SRZ000001"><TITLE>Test</TITLE></ANALYSIS>`, "analysis"},
@@ -474,3 +482,195 @@ func TestDocTypeField(t *testing.T) {
 		t.Errorf("expected DocType 'study', got %q", result.DocType)
 	}
 }
+
+func TestStrictMode(t *testing.T) {
+	xml := []byte(`<UNKNOWN_SET/>`)
+
+	result, err := DefaultValidator().ValidateXML(xml)
+	if err != nil || !result.IsValid || len(result.Warnings) != 1 {
+		t.Fatalf("expected a valid document with a warning, got %+v (%v)", result, err)
+	}
+
+	strict := NewValidator(ValidationConfig{StrictMode: true})
+	result, err = strict.ValidateXML(xml)
+	if err != nil || result.IsValid || len(result.Errors) != 1 || len(result.Warnings) != 0 {
+		t.Errorf("expected the warning as an error in strict mode, got %+v (%v)", result, err)
+	}
+}
+
+// writeTarGz writes a tar.gz archive of the given files
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	dir := t.TempDir()
+	valid := `<STUDY_SET><STUDY accession="SRP000001"><DESCRIPTOR><STUDY_TITLE>T</STUDY_TITLE><STUDY_TYPE existing_study_type="Other"/></DESCRIPTOR></STUDY></STUDY_SET>`
+	invalid := `<SAMPLE_SET><SAMPLE accession="SRS000001"><SAMPLE_NAME><TAXON_ID>human</TAXON_ID><SCIENTIFIC_NAME>Homo sapiens</SCIENTIFIC_NAME></SAMPLE_NAME></SAMPLE></SAMPLE_SET>`
+	if err := os.WriteFile(filepath.Join(dir, "study.xml"), []byte(valid), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not XML"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTarGz(t, filepath.Join(dir, "submission.tar.gz"), map[string]string{
+		"SRA000001/SRA000001.sample.xml": invalid,
+		"SRA000001/README":               "skipped",
+	})
+
+	results, err := DefaultValidator().ValidatePath(dir)
+	if err != nil {
+		t.Fatalf("ValidatePath failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 documents, got %+v", results)
+	}
+	if results[0].Failed() || results[0].Member != "" || results[0].Result.DocType != "study" {
+		t.Errorf("expected the study to be valid, got %+v", results[0])
+	}
+	sample := results[1]
+	if !sample.Failed() || sample.Name() != filepath.Join(dir, "submission.tar.gz")+":SRA000001/SRA000001.sample.xml" {
+		t.Errorf("expected the sample in the archive to fail, got %+v", sample)
+	}
+
+	if _, err := DefaultValidator().ValidatePath(filepath.Join(dir, "missing.xml")); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	results := []FileResult{
+		{Path: "sub.tar.gz", Member: "a.sample.xml", Result: &ValidationResult{
+			Errors:   []ValidationError{{Type: "INVALID_FORMAT", Message: "TAXON_ID must be numeric"}},
+			Warnings: []ValidationWarning{{Type: "UNKNOWN_PLATFORM", Message: "Platform type not recognized"}},
+		}},
+		{Path: "broken.xml.gz", Error: "failed to read gzip: unexpected EOF"},
+		{Path: "ok.xml", Result: &ValidationResult{IsValid: true}},
+	}
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, results, "srake", "1.0.0"); err != nil {
+		t.Fatalf("WriteSARIF failed: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	run := log.Runs[0]
+	if len(run.Results) != 3 || len(run.Tool.Driver.Rules) != 3 {
+		t.Fatalf("expected 3 results of 3 rules, got %+v", run)
+	}
+	if r := run.Results[0]; r.Level != "error" || r.RuleID != "INVALID_FORMAT" || *r.Locations[0].PhysicalLocation.ArtifactLocation.Index != 1 {
+		t.Errorf("unexpected first result: %+v", r)
+	}
+	if a := run.Artifacts[1]; a.Location.URI != "a.sample.xml" || a.ParentIndex == nil || *a.ParentIndex != 0 {
+		t.Errorf("expected the member nested in its archive, got %+v", a)
+	}
+	if r := run.Results[1]; r.Level != "warning" {
+		t.Errorf("expected a warning, got %+v", r)
+	}
+	if r := run.Results[2]; r.RuleID != ruleReadError || r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "broken.xml.gz" {
+		t.Errorf("unexpected read error result: %+v", r)
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	schema, err := loadSRASchema()
+	if err != nil {
+		t.Fatalf("failed to load the bundled schemas: %v", err)
+	}
+	for _, root := range []string{"STUDY_SET", "SAMPLE_SET", "EXPERIMENT_SET", "RUN_SET", "ANALYSIS_SET", "SUBMISSION"} {
+		if schema.elements[root] == nil {
+			t.Errorf("expected a declaration of %s", root)
+		}
+	}
+
+	v := NewValidator(ValidationConfig{Schema: true})
+	valid := `<?xml version="1.0" encoding="UTF-8"?>
+<SAMPLE_SET xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="SRA.sample.xsd">
+  <SAMPLE alias="liver-1" center_name="EXAMPLE">
+    <IDENTIFIERS><EXTERNAL_ID namespace="BioSample">SAMN00000001</EXTERNAL_ID></IDENTIFIERS>
+    <TITLE>Liver biopsy</TITLE>
+    <SAMPLE_NAME>
+      <SCIENTIFIC_NAME>Homo sapiens</SCIENTIFIC_NAME>
+      <TAXON_ID>9606</TAXON_ID>
+    </SAMPLE_NAME>
+    <SAMPLE_ATTRIBUTES>
+      <SAMPLE_ATTRIBUTE><TAG>tissue</TAG><VALUE>liver</VALUE></SAMPLE_ATTRIBUTE>
+    </SAMPLE_ATTRIBUTES>
+  </SAMPLE>
+</SAMPLE_SET>`
+	result, err := v.ValidateXML([]byte(valid))
+	if err != nil || !result.IsValid || result.DocType != "sample" {
+		t.Fatalf("expected a valid sample, got %+v (%v)", result, err)
+	}
+
+	invalid := `<SAMPLE_SET>
+  <SAMPLE alias="a" colour="red">
+    <TITLE>Liver</TITLE>
+    <DESCRIPTION>No name</DESCRIPTION>
+  </SAMPLE>
+  <SAMPLE><SAMPLE_NAME><TAXON_ID>human</TAXON_ID></SAMPLE_NAME>
+    <IDENTIFIERS><EXTERNAL_ID>1</EXTERNAL_ID></IDENTIFIERS></SAMPLE>
+  <SAMPLE><SAMPLE_NAME><COMMON_NAME>human</COMMON_NAME></SAMPLE_NAME></SAMPLE>
+</SAMPLE_SET>`
+	result, err = v.ValidateXML([]byte(invalid))
+	if err != nil {
+		t.Fatalf("ValidateXML failed: %v", err)
+	}
+	want := []ValidationError{
+		{Type: "UNEXPECTED_ATTRIBUTE", Line: 2, Column: 3},
+		{Type: "UNEXPECTED_ELEMENT", Line: 4, Column: 5},
+		{Type: "INVALID_VALUE", Line: 6, Column: 24},
+		{Type: "UNEXPECTED_ELEMENT", Line: 7, Column: 5},
+		{Type: "MISSING_ATTRIBUTE", Line: 7, Column: 18},
+		{Type: "MISSING_ELEMENT", Line: 8, Column: 11},
+	}
+	if result.IsValid || len(result.Errors) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), result.Errors)
+	}
+	for i, w := range want {
+		if e := result.Errors[i]; e.Type != w.Type || e.Line != w.Line || e.Column != w.Column {
+			t.Errorf("error %d: expected %s at %d:%d, got %s at %d:%d: %s", i, w.Type, w.Line, w.Column, e.Type, e.Line, e.Column, e.Message)
+		}
+	}
+	if msg := result.Errors[1].Message; !strings.Contains(msg, "expected SAMPLE_NAME") {
+		t.Errorf("expected SAMPLE_NAME to be named as expected, got %q", msg)
+	}
+
+	result, err = v.ValidateXML([]byte(`<STUDY><DESCRIPTOR><STUDY_TITLE>T</STUDY_TITLE><STUDY_TYPE existing_study_type="Bogus"/></DESCRIPTOR></STUDY>`))
+	if err != nil || len(result.Errors) != 1 || result.Errors[0].Type != "INVALID_VALUE" {
+		t.Errorf("expected an invalid study type, got %+v (%v)", result, err)
+	}
+	result, err = v.ValidateXML([]byte(`<PROJECT/>`))
+	if err != nil || len(result.Errors) != 1 || result.Errors[0].Type != "UNKNOWN_ROOT" {
+		t.Errorf("expected an unknown root element, got %+v (%v)", result, err)
+	}
+	result, err = v.ValidateXML([]byte("<SAMPLE_SET>\n<SAMPLE>\n</SAMPLE_SET>"))
+	if err != nil || len(result.Errors) != 1 || result.Errors[0].Type != "XML_PARSE_ERROR" || result.Errors[0].Line != 3 {
+		t.Errorf("expected a parse error on line 3, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,358 @@
+package validator
+
+import (
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"sync"
+)
+
+// schemaFS holds the official SRA XML schemas published by NCBI, which
+// SRA.common.xsd is included into
+//
+//go:embed schemas/*.xsd
+var schemaFS embed.FS
+
+// unbounded is the maxOccurs of particles that may repeat without limit
+const unbounded = -1
+
+// anyType is the type of elements declared without one, whose content is
+// not checked
+const anyType = "xs:anyType"
+
+// xsdSchema is the subset of XML Schema the SRA schemas use: sequences,
+// choices and all groups of elements, simple types restricting built-in
+// types to enumerations, simple content extensions, and attribute groups,
+// all without a target namespace
+type xsdSchema struct {
+	elements        map[string]*elementDecl
+	complexTypes    map[string]*complexType
+	simpleTypes     map[string]*simpleType
+	attributeGroups map[string][]*attributeDecl
+}
+
+// elementDecl declares an element, of a named type or an anonymous one
+type elementDecl struct {
+	name     string
+	min, max int
+	typeName string
+	complex  *complexType
+	simple   *simpleType
+}
+
+type particleKind int
+
+const (
+	particleElement particleKind = iota
+	particleSequence
+	particleChoice
+	particleAll
+)
+
+// particle is an element or a group of particles in a content model
+type particle struct {
+	kind     particleKind
+	min, max int
+	element  *elementDecl
+	children []*particle
+}
+
+// complexType is a type with attributes, and either element content or,
+// when base is set, the simple content of the type it extends
+type complexType struct {
+	content    *particle // nil for empty or simple content
+	base       string
+	attributes []*attributeDecl
+	groups     []string                // attribute groups referenced
+	elements   map[string]*elementDecl // elements of the content by name
+}
+
+// simpleType restricts a base type to an enumeration of values
+type simpleType struct {
+	base  string
+	enums []string
+}
+
+// attributeDecl declares an attribute, of a named type or an anonymous one
+type attributeDecl struct {
+	name     string
+	required bool
+	typeName string
+	simple   *simpleType
+}
+
+// xsdNode is an element of an XSD document
+type xsdNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xsdNode  `xml:",any"`
+}
+
+// attr returns the value of an attribute of the node, or ""
+func (n *xsdNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+var sraSchema struct {
+	once   sync.Once
+	schema *xsdSchema
+	err    error
+}
+
+// loadSRASchema returns the bundled SRA schemas, parsed on first use
+func loadSRASchema() (*xsdSchema, error) {
+	sraSchema.once.Do(func() {
+		sraSchema.schema, sraSchema.err = parseSchemas(schemaFS, "schemas/*.xsd")
+	})
+	return sraSchema.schema, sraSchema.err
+}
+
+// parseSchemas parses the XSD documents matching pattern into one schema.
+// Includes are not followed: every document the includes name must match.
+func parseSchemas(fsys fs.FS, pattern string) (*xsdSchema, error) {
+	s := &xsdSchema{
+		elements:        make(map[string]*elementDecl),
+		complexTypes:    make(map[string]*complexType),
+		simpleTypes:     make(map[string]*simpleType),
+		attributeGroups: make(map[string][]*attributeDecl),
+	}
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var root xsdNode
+		if err := xml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		if err := s.add(&root); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+	}
+	return s, nil
+}
+
+// add adds the top-level declarations of an XSD document
+func (s *xsdSchema) add(root *xsdNode) error {
+	for i := range root.Children {
+		n := &root.Children[i]
+		name := n.attr("name")
+		var err error
+		switch n.XMLName.Local {
+		case "element":
+			s.elements[name], err = parseElement(n)
+		case "complexType":
+			s.complexTypes[name], err = parseComplexType(n)
+		case "simpleType":
+			s.simpleTypes[name], err = parseSimpleType(n)
+		case "attributeGroup":
+			var ct complexType
+			if err = ct.addAttributes(n); err == nil {
+				s.attributeGroups[name] = ct.attributes
+			}
+		case "include", "annotation":
+		default:
+			err = fmt.Errorf("unsupported declaration xs:%s", n.XMLName.Local)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parseOccurs returns the minOccurs and maxOccurs of a particle
+func parseOccurs(n *xsdNode) (int, int, error) {
+	occurs := func(attr string) (int, error) {
+		switch v := n.attr(attr); v {
+		case "":
+			return 1, nil
+		case "unbounded":
+			return unbounded, nil
+		default:
+			return strconv.Atoi(v)
+		}
+	}
+	min, err := occurs("minOccurs")
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := occurs("maxOccurs")
+	if err != nil {
+		return 0, 0, err
+	}
+	return min, max, nil
+}
+
+func parseElement(n *xsdNode) (*elementDecl, error) {
+	min, max, err := parseOccurs(n)
+	if err != nil {
+		return nil, err
+	}
+	e := &elementDecl{name: n.attr("name"), min: min, max: max, typeName: n.attr("type")}
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "complexType":
+			e.complex, err = parseComplexType(c)
+		case "simpleType":
+			e.simple, err = parseSimpleType(c)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e.typeName == "" && e.complex == nil && e.simple == nil {
+		e.typeName = anyType
+	}
+	return e, nil
+}
+
+func parseComplexType(n *xsdNode) (*complexType, error) {
+	ct := &complexType{elements: make(map[string]*elementDecl)}
+	if n.attr("mixed") == "true" {
+		return nil, fmt.Errorf("unsupported mixed content")
+	}
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "sequence", "choice", "all":
+			p, err := parseParticle(c)
+			if err != nil {
+				return nil, err
+			}
+			ct.content = p
+			ct.collectElements(p)
+		case "simpleContent":
+			for j := range c.Children {
+				ext := &c.Children[j]
+				if ext.XMLName.Local == "annotation" {
+					continue
+				}
+				if ext.XMLName.Local != "extension" {
+					return nil, fmt.Errorf("unsupported simple content xs:%s", ext.XMLName.Local)
+				}
+				ct.base = ext.attr("base")
+				if err := ct.addAttributes(ext); err != nil {
+					return nil, err
+				}
+			}
+		case "attribute", "attributeGroup", "annotation":
+		default:
+			return nil, fmt.Errorf("unsupported content xs:%s", c.XMLName.Local)
+		}
+	}
+	if err := ct.addAttributes(n); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// addAttributes adds the attributes and attribute group references among
+// the children of n
+func (ct *complexType) addAttributes(n *xsdNode) error {
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "attribute":
+			a := &attributeDecl{name: c.attr("name"), required: c.attr("use") == "required", typeName: c.attr("type")}
+			for j := range c.Children {
+				if c.Children[j].XMLName.Local == "simpleType" {
+					var err error
+					if a.simple, err = parseSimpleType(&c.Children[j]); err != nil {
+						return err
+					}
+				}
+			}
+			ct.attributes = append(ct.attributes, a)
+		case "attributeGroup":
+			ct.groups = append(ct.groups, c.attr("ref"))
+		}
+	}
+	return nil
+}
+
+// collectElements indexes the elements of a content model by name
+func (ct *complexType) collectElements(p *particle) {
+	if p.element != nil {
+		if _, ok := ct.elements[p.element.name]; !ok {
+			ct.elements[p.element.name] = p.element
+		}
+		return
+	}
+	for _, c := range p.children {
+		ct.collectElements(c)
+	}
+}
+
+func parseParticle(n *xsdNode) (*particle, error) {
+	min, max, err := parseOccurs(n)
+	if err != nil {
+		return nil, err
+	}
+	p := &particle{min: min, max: max}
+	switch n.XMLName.Local {
+	case "sequence":
+		p.kind = particleSequence
+	case "choice":
+		p.kind = particleChoice
+	case "all":
+		p.kind = particleAll
+	}
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "element":
+			e, err := parseElement(c)
+			if err != nil {
+				return nil, err
+			}
+			p.children = append(p.children, &particle{kind: particleElement, min: e.min, max: e.max, element: e})
+		case "sequence", "choice", "all":
+			child, err := parseParticle(c)
+			if err != nil {
+				return nil, err
+			}
+			p.children = append(p.children, child)
+		case "annotation":
+		default:
+			return nil, fmt.Errorf("unsupported particle xs:%s", c.XMLName.Local)
+		}
+	}
+	return p, nil
+}
+
+func parseSimpleType(n *xsdNode) (*simpleType, error) {
+	for i := range n.Children {
+		r := &n.Children[i]
+		switch r.XMLName.Local {
+		case "restriction":
+			st := &simpleType{base: r.attr("base")}
+			for j := range r.Children {
+				switch f := &r.Children[j]; f.XMLName.Local {
+				case "enumeration":
+					st.enums = append(st.enums, f.attr("value"))
+				case "annotation":
+				default:
+					return nil, fmt.Errorf("unsupported facet xs:%s", f.XMLName.Local)
+				}
+			}
+			return st, nil
+		case "annotation":
+		default:
+			return nil, fmt.Errorf("unsupported simple type xs:%s", r.XMLName.Local)
+		}
+	}
+	return nil, fmt.Errorf("simple type without a restriction")
+}
@@ -401,9 +401,12 @@ func quantizeToInt8(floats []float32) []byte {
 		}
 	}
 
-	// Scale to int8 range
-	scale := float32(255) / (max - min)
+	// Scale to int8 range. A constant vector has no range and maps to 0.
 	bytes := make([]byte, len(floats))
+	if max == min {
+		return bytes
+	}
+	scale := float32(255) / (max - min)
 	for i, f := range floats {
 		scaled := (f - min) * scale
 		bytes[i] = byte(scaled)
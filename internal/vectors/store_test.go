@@ -0,0 +1,115 @@
+package vectors
+
+import (
+	"math"
+	"testing"
+)
+
+// embedding returns a 384-dimensional vector with the given leading values
+func embedding(values ...float32) []float32 {
+	v := make([]float32, 384)
+	copy(v, values)
+	return v
+}
+
+func TestFloatsBytesRoundTrip(t *testing.T) {
+	floats := []float32{0, 1.5, -2.25, math.MaxFloat32, float32(math.Inf(-1))}
+	got := bytesToFloats(floatsToBytes(floats))
+	if len(got) != len(floats) {
+		t.Fatalf("Expected %d floats, got %d", len(floats), len(got))
+	}
+	for i := range floats {
+		if got[i] != floats[i] {
+			t.Errorf("Float %d: expected %v, got %v", i, floats[i], got[i])
+		}
+	}
+}
+
+func TestQuantizeToInt8(t *testing.T) {
+	q := quantizeToInt8([]float32{-1, 0, 0.5, 1})
+	if q[0] != 0 || q[3] != 255 {
+		t.Errorf("Expected the range to map to 0..255, got %v", q)
+	}
+	for i := 1; i < len(q); i++ {
+		if q[i] < q[i-1] {
+			t.Errorf("Expected quantization to keep the order of values, got %v", q)
+		}
+	}
+	if q[1] < 125 || q[1] > 128 {
+		t.Errorf("Expected the midpoint near 127, got %d", q[1])
+	}
+
+	// A constant vector has no range to scale
+	for _, b := range quantizeToInt8([]float32{0.3, 0.3, 0.3}) {
+		if b != 0 {
+			t.Errorf("Expected a constant vector to quantize to zeros, got %d", b)
+		}
+	}
+	if len(quantizeToInt8(nil)) != 0 {
+		t.Error("Expected an empty vector to quantize to nothing")
+	}
+}
+
+func TestCosineDistance(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float32
+	}{
+		{[]float32{1, 0}, []float32{2, 0}, 0},
+		{[]float32{1, 0}, []float32{0, 3}, 1},
+		{[]float32{1, 0}, []float32{-1, 0}, 2},
+		{[]float32{0, 0}, []float32{1, 0}, 1}, // zero vectors are maximally distant
+	}
+	for _, tt := range tests {
+		if got := cosineDistance(tt.a, tt.b); math.Abs(float64(got-tt.want)) > 1e-6 {
+			t.Errorf("cosineDistance(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSearchSimilar(t *testing.T) {
+	vs, err := NewVectorStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	defer vs.Close()
+
+	projects := []*ProjectVector{
+		{ProjectID: "SRP000001", Title: "Human liver", Organism: "Homo sapiens", Embedding: embedding(1, 0, 0)},
+		{ProjectID: "SRP000002", Title: "Human kidney", Organism: "Homo sapiens", Embedding: embedding(0.9, 0.1, 0)},
+		{ProjectID: "SRP000003", Title: "Mouse brain", Organism: "Mus musculus", Embedding: embedding(0.8, 0, 0.2)},
+		{ProjectID: "SRP000004", Title: "Soil", Organism: "metagenome", Embedding: embedding(0, 0, 1)},
+	}
+	for _, p := range projects {
+		if err := vs.InsertProjectVector(p); err != nil {
+			t.Fatalf("Failed to insert %s: %v", p.ProjectID, err)
+		}
+	}
+	if err := vs.InsertProjectVector(&ProjectVector{ProjectID: "SRP000005", Embedding: []float32{1}}); err == nil {
+		t.Error("Expected an error for an embedding of the wrong dimension")
+	}
+
+	// Results are ordered by distance and limited
+	results, err := vs.SearchSimilar(embedding(1, 0, 0), 3)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 3 || results[0].ID != "SRP000001" || results[1].ID != "SRP000002" || results[2].ID != "SRP000003" {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+	if results[0].Score < 0.999 || results[0].Distance > 0.001 {
+		t.Errorf("Expected an exact match to score 1, got %+v", results[0])
+	}
+
+	// A project is not similar to itself, and filters narrow the candidates
+	results, err = vs.FindSimilarProjects("SRP000001", 10, map[string]interface{}{"organism": "Homo sapiens"})
+	if err != nil {
+		t.Fatalf("FindSimilarProjects failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "SRP000002" {
+		t.Errorf("Expected only SRP000002, got %+v", results)
+	}
+	if _, err := vs.FindSimilarProjects("SRP999999", 10, nil); err == nil {
+		t.Error("Expected an error for an unknown project")
+	}
+}
@@ -0,0 +1,166 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoder writes values to a stream as MessagePack
+type Encoder struct {
+	w   *bufio.Writer
+	enc *msgpack.Encoder
+}
+
+// NewEncoder returns an encoder writing to w. Values are buffered; call
+// Flush once they have been encoded.
+func NewEncoder(w io.Writer) *Encoder {
+	bw := bufio.NewWriter(w)
+	enc := msgpack.NewEncoder(bw)
+	// Keys are sorted, as encoding/json sorts them, so that equal records
+	// encode alike
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	return &Encoder{w: bw, enc: enc}
+}
+
+// Flush writes the buffered values to the underlying writer
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// Encode writes a value. Maps, slices and scalars are written as they are;
+// other values, such as structs, are written as their JSON encoding would
+// be, with the same field names.
+func (e *Encoder) Encode(v interface{}) error {
+	plain, err := plainValue(v)
+	if err != nil {
+		return err
+	}
+	return e.enc.Encode(plain)
+}
+
+// plainValue returns v as the nil, booleans, numbers, strings, binary
+// values, slices and string-keyed maps MessagePack represents directly
+func plainValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, bool, string, []byte, []string,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if list[i], err = plainValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			var err error
+			if m[k], err = plainValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return plainValue(generic)
+}
+
+// Decoder reads MessagePack values from a stream
+type Decoder struct {
+	r   *bufio.Reader
+	dec *msgpack.Decoder
+}
+
+// NewDecoder returns a decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	br := bufio.NewReader(r)
+	return &Decoder{r: br, dec: msgpack.NewDecoder(br)}
+}
+
+// Decode reads the next value, as the types encoding/json decodes into an
+// interface{}, except that integers are int64, or uint64 above the range
+// of int64, and binary values []byte. It returns io.EOF at the end of the
+// stream, and io.ErrUnexpectedEOF if the stream ends within a value.
+func (d *Decoder) Decode() (interface{}, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, err
+	}
+	v, err := d.dec.DecodeInterface()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodedValue(v)
+}
+
+// decodedValue widens the numbers of a decoded value to int64, uint64 and
+// float64, and rejects extension types
+func decodedValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, bool, string, []byte, int64, float64:
+		return v, nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return v, nil
+		}
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case []interface{}:
+		for i, item := range v {
+			var err error
+			if v[i], err = decodedValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case map[string]interface{}:
+		for k, item := range v {
+			var err error
+			if v[k], err = decodedValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported MessagePack value of type %T", v)
+}
@@ -0,0 +1,60 @@
+// Package wire implements the compact encoding srake clients and servers
+// can negotiate for bulk transfers: a stream of MessagePack values, one
+// per record, usually gzip-compressed. MessagePack keeps the structure of
+// JSON but writes numbers and lengths in binary, so a record takes about
+// half the bytes of its JSON and decodes without parsing text.
+//
+// Values are limited to what records need: nil, booleans, integers,
+// floats, strings, binary, arrays and maps with string keys. Extension
+// types are rejected.
+package wire
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of a stream of MessagePack values
+const ContentType = "application/msgpack"
+
+// contentTypes are the media types accepted for ContentType, including the
+// one used before it was registered
+var contentTypes = []string{ContentType, "application/x-msgpack"}
+
+// Accepts reports whether an Accept header asks for MessagePack
+func Accepts(accept string) bool {
+	for _, t := range contentTypes {
+		if acceptsToken(accept, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsGzip reports whether an Accept-Encoding header allows gzip
+func AcceptsGzip(acceptEncoding string) bool {
+	return acceptsToken(acceptEncoding, "gzip")
+}
+
+// acceptsToken reports whether a header listing values with optional
+// quality factors, such as "application/msgpack;q=0.9, */*;q=0.1", names a
+// value without refusing it with q=0. Wildcards are not matched, so that a
+// client only receives what it asked for by name.
+func acceptsToken(header, token string) bool {
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(value), token) {
+			continue
+		}
+		for _, p := range strings.Split(params, ";") {
+			name, q, ok := strings.Cut(p, "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil && v == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	values := []interface{}{
+		nil, true, false,
+		int64(0), int64(127), int64(128), int64(255), int64(256), int64(65535), int64(65536),
+		int64(math.MaxUint32), int64(math.MaxUint32) + 1, int64(math.MaxInt64),
+		int64(-1), int64(-32), int64(-33), int64(-128), int64(-129), int64(-32768), int64(-32769),
+		int64(math.MinInt32), int64(math.MinInt32) - 1, int64(math.MinInt64),
+		uint64(math.MaxUint64),
+		1.5, -0.25,
+		"", "liver", strings.Repeat("a", 31), strings.Repeat("b", 32), strings.Repeat("c", 256), strings.Repeat("d", 70000),
+		[]byte{1, 2, 3},
+		[]interface{}{}, []interface{}{"a", int64(1), nil},
+		make([]interface{}, 20),
+		map[string]interface{}{},
+		map[string]interface{}{"accession": "SRR000001", "spots": int64(1200000), "attributes": map[string]interface{}{"sex": "female"}},
+	}
+	large := make(map[string]interface{})
+	for i := 0; i < 40; i++ {
+		large[strings.Repeat("k", i+1)] = int64(i)
+	}
+	values = append(values, large)
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode(%v) failed: %v", v, err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(&buf)
+	for _, want := range values {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("Decode failed for %v: %v", want, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip of %v (%T) gave %v (%T)", want, want, got, got)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the stream, got %v", err)
+	}
+}
+
+func TestEncodeStruct(t *testing.T) {
+	type record struct {
+		ID     string   `json:"id"`
+		Score  float32  `json:"score,omitempty"`
+		Spots  int      `json:"spots"`
+		Tags   []string `json:"tags"`
+		hidden string
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(record{ID: "SRS000001", Spots: 42, Tags: []string{"liver"}, hidden: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	enc.Flush()
+
+	got, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"id": "SRS000001", "spots": int64(42), "tags": []interface{}{"liver"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("struct encoded as %v, want %v", got, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Encode(map[string]interface{}{"title": "Liver, cohort A"})
+	enc.Flush()
+
+	truncated := buf.Bytes()[:buf.Len()-3]
+	if _, err := NewDecoder(bytes.NewReader(truncated)).Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated value, got %v", err)
+	}
+	// An extension type
+	if _, err := NewDecoder(bytes.NewReader([]byte{0xd4, 0x01, 0x00})).Decode(); err == nil {
+		t.Error("expected an error for an extension type")
+	}
+	// A timestamp, an extension type MessagePack defines
+	if _, err := NewDecoder(bytes.NewReader([]byte{0xd6, 0xff, 0x00, 0x00, 0x00, 0x01})).Decode(); err == nil {
+		t.Error("expected an error for a timestamp")
+	}
+	// A map with an integer key
+	if _, err := NewDecoder(bytes.NewReader([]byte{0x81, 0x01, 0x02})).Decode(); err == nil {
+		t.Error("expected an error for a non-string map key")
+	}
+	// A string claiming more than maxLength bytes
+	if _, err := NewDecoder(bytes.NewReader([]byte{0xdb, 0xff, 0xff, 0xff, 0xff})).Decode(); err == nil {
+		t.Error("expected an error for an overlong string")
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   bool
+	}{
+		{"application/msgpack", true},
+		{"application/json, application/x-msgpack;q=0.9", true},
+		{"Application/MsgPack ; q=1", true},
+		{"application/msgpack;q=0", false},
+		{"application/json", false},
+		{"*/*", false},
+		{"", false},
+	} {
+		if got := Accepts(tc.accept); got != tc.want {
+			t.Errorf("Accepts(%q) = %v, want %v", tc.accept, got, tc.want)
+		}
+	}
+
+	if !AcceptsGzip("gzip, deflate, br") || AcceptsGzip("identity") || AcceptsGzip("gzip;q=0") {
+		t.Error("unexpected result from AcceptsGzip")
+	}
+}
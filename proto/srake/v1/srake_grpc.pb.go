@@ -0,0 +1,255 @@
+// The srake gRPC API, served by srake-server on its gRPC port
+// (server.grpc_port) next to the HTTP API. Generate a client with protoc
+// or buf for any language; the Go code of this package is generated with
+// make proto.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: srake/v1/srake.proto
+
+package srakev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Srake_Search_FullMethodName       = "/srake.v1.Srake/Search"
+	Srake_GetRecord_FullMethodName    = "/srake.v1.Srake/GetRecord"
+	Srake_ListRuns_FullMethodName     = "/srake.v1.Srake/ListRuns"
+	Srake_StreamExport_FullMethodName = "/srake.v1.Srake/StreamExport"
+)
+
+// SrakeClient is the client API for Srake service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SrakeClient interface {
+	// Search the index, a page at a time
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// Get a study, experiment, sample or run by accession
+	GetRecord(ctx context.Context, in *GetRecordRequest, opts ...grpc.CallOption) (*Record, error)
+	// Stream the runs of a study, experiment or sample
+	ListRuns(ctx context.Context, in *ListRunsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Run], error)
+	// Stream the records of one type matching a search, or all of them
+	StreamExport(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Record], error)
+}
+
+type srakeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSrakeClient(cc grpc.ClientConnInterface) SrakeClient {
+	return &srakeClient{cc}
+}
+
+func (c *srakeClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, Srake_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *srakeClient) GetRecord(ctx context.Context, in *GetRecordRequest, opts ...grpc.CallOption) (*Record, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Record)
+	err := c.cc.Invoke(ctx, Srake_GetRecord_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *srakeClient) ListRuns(ctx context.Context, in *ListRunsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Run], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Srake_ServiceDesc.Streams[0], Srake_ListRuns_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListRunsRequest, Run]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Srake_ListRunsClient = grpc.ServerStreamingClient[Run]
+
+func (c *srakeClient) StreamExport(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Record], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Srake_ServiceDesc.Streams[1], Srake_StreamExport_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportRequest, Record]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Srake_StreamExportClient = grpc.ServerStreamingClient[Record]
+
+// SrakeServer is the server API for Srake service.
+// All implementations must embed UnimplementedSrakeServer
+// for forward compatibility.
+type SrakeServer interface {
+	// Search the index, a page at a time
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// Get a study, experiment, sample or run by accession
+	GetRecord(context.Context, *GetRecordRequest) (*Record, error)
+	// Stream the runs of a study, experiment or sample
+	ListRuns(*ListRunsRequest, grpc.ServerStreamingServer[Run]) error
+	// Stream the records of one type matching a search, or all of them
+	StreamExport(*ExportRequest, grpc.ServerStreamingServer[Record]) error
+	mustEmbedUnimplementedSrakeServer()
+}
+
+// UnimplementedSrakeServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSrakeServer struct{}
+
+func (UnimplementedSrakeServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedSrakeServer) GetRecord(context.Context, *GetRecordRequest) (*Record, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetRecord not implemented")
+}
+func (UnimplementedSrakeServer) ListRuns(*ListRunsRequest, grpc.ServerStreamingServer[Run]) error {
+	return status.Error(codes.Unimplemented, "method ListRuns not implemented")
+}
+func (UnimplementedSrakeServer) StreamExport(*ExportRequest, grpc.ServerStreamingServer[Record]) error {
+	return status.Error(codes.Unimplemented, "method StreamExport not implemented")
+}
+func (UnimplementedSrakeServer) mustEmbedUnimplementedSrakeServer() {}
+func (UnimplementedSrakeServer) testEmbeddedByValue()               {}
+
+// UnsafeSrakeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SrakeServer will
+// result in compilation errors.
+type UnsafeSrakeServer interface {
+	mustEmbedUnimplementedSrakeServer()
+}
+
+func RegisterSrakeServer(s grpc.ServiceRegistrar, srv SrakeServer) {
+	// If the following call panics, it indicates UnimplementedSrakeServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Srake_ServiceDesc, srv)
+}
+
+func _Srake_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SrakeServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Srake_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SrakeServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Srake_GetRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SrakeServer).GetRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Srake_GetRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SrakeServer).GetRecord(ctx, req.(*GetRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Srake_ListRuns_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRunsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SrakeServer).ListRuns(m, &grpc.GenericServerStream[ListRunsRequest, Run]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Srake_ListRunsServer = grpc.ServerStreamingServer[Run]
+
+func _Srake_StreamExport_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SrakeServer).StreamExport(m, &grpc.GenericServerStream[ExportRequest, Record]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Srake_StreamExportServer = grpc.ServerStreamingServer[Record]
+
+// Srake_ServiceDesc is the grpc.ServiceDesc for Srake service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Srake_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "srake.v1.Srake",
+	HandlerType: (*SrakeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Search",
+			Handler:    _Srake_Search_Handler,
+		},
+		{
+			MethodName: "GetRecord",
+			Handler:    _Srake_GetRecord_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListRuns",
+			Handler:       _Srake_ListRuns_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamExport",
+			Handler:       _Srake_StreamExport_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "srake/v1/srake.proto",
+}
@@ -34,6 +34,12 @@ export class ApiService {
     return response.json();
   }
 
+  static async getStudyJsonLd(studyId: string): Promise<Record<string, unknown>> {
+    const response = await fetch(`${API_BASE}/studies/${studyId}/jsonld`);
+    if (!response.ok) throw new Error('Failed to fetch study JSON-LD');
+    return response.json();
+  }
+
   static async getRunDetails(runId: string): Promise<any> {
     const response = await fetch(`${API_BASE}/runs/${runId}`);
     if (!response.ok) throw new Error('Failed to fetch run details');